@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"traderadmin/backend/ibkr"
+	"traderadmin/backend/risk"
+)
+
+// Live reports whether the account trades real money. IBKR paper account
+// codes start with D, as in DU1234567; an account without a code is taken
+// to be live, as the safer assumption.
+func (account IBKRAccount) Live() bool {
+	return !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(account.AccountCode)), "D")
+}
+
+// faMethods are the methods an FA group may allocate orders by
+var faMethods = []string{ibkr.FAMethodEqualQuantity, ibkr.FAMethodNetLiq, ibkr.FAMethodAvailableEquity, ibkr.FAMethodPctChange}
+
+// faPctChange is the method allocating by FAPercentage, named where the
+// ibkr package is shadowed
+const faPctChange = ibkr.FAMethodPctChange
+
+// faAllocation returns the allocation of the account's orders among its
+// sub-accounts, inactive unless it is a financial-advisor account
+func (account IBKRAccount) faAllocation() ibkr.FAAllocation {
+	return ibkr.FAAllocation{
+		Group:      account.FAGroup,
+		Profile:    account.FAProfile,
+		Method:     account.FAMethod,
+		Percentage: account.FAPercentage,
+	}
+}
+
+// ibkrAccount returns the account named name
+func (c Configuration) ibkrAccount(name string) (IBKRAccount, bool) {
+	for _, account := range c.IBKRConnection.Accounts {
+		if account.Name == name {
+			return account, true
+		}
+	}
+	return IBKRAccount{}, false
+}
+
+// activeIBKRAccount returns the account named by ActiveAccount, or the first
+// when it is not set. Without accounts it is empty.
+func (c Configuration) activeIBKRAccount() IBKRAccount {
+	if account, ok := c.ibkrAccount(c.IBKRConnection.ActiveAccount); ok {
+		return account
+	}
+	if len(c.IBKRConnection.Accounts) > 0 && c.IBKRConnection.ActiveAccount == "" {
+		return c.IBKRConnection.Accounts[0]
+	}
+	return IBKRAccount{}
+}
+
+// activeAccountCode returns the code of the active account, which positions,
+// orders and metrics are scoped to
+func (a *App) activeAccountCode() string {
+	return a.config.activeIBKRAccount().AccountCode
+}
+
+// inActiveAccount reports whether a position or order of account belongs to
+// the active account. Those without an account, and all of them when the
+// active account has no code, do. An advisor account allocating its orders
+// holds its positions in sub-accounts, so all of them do too.
+func (a *App) inActiveAccount(account string) bool {
+	code := a.activeAccountCode()
+	return account == "" || code == "" || strings.EqualFold(account, code) || a.config.activeIBKRAccount().faAllocation().Active()
+}
+
+// forActiveAccount places order for the active account, allocated among its
+// sub-accounts when it is a financial-advisor account
+func (a *App) forActiveAccount(order ibkr.ComboOrder) ibkr.ComboOrder {
+	account := a.config.activeIBKRAccount()
+	order.Account = account.AccountCode
+	order.FAAllocation = account.faAllocation()
+	return order
+}
+
+// accountExposures returns the legs of legs held by the active account
+func (a *App) accountExposures(legs []risk.LegExposure) []risk.LegExposure {
+	scoped := make([]risk.LegExposure, 0, len(legs))
+	for _, leg := range legs {
+		if a.inActiveAccount(leg.Account) {
+			scoped = append(scoped, leg)
+		}
+	}
+	return scoped
+}
+
+// accountOrders returns the orders of orders placed for the active account
+func (a *App) accountOrders(orders []ibkr.OrderState) []ibkr.OrderState {
+	scoped := make([]ibkr.OrderState, 0, len(orders))
+	for _, order := range orders {
+		if a.inActiveAccount(order.Account) {
+			scoped = append(scoped, order)
+		}
+	}
+	return scoped
+}
+
+// SwitchAccount makes the account named name the active one and saves the
+// configuration. The connections to TWS/Gateway are closed and reopened with
+// the account's settings, and the status is refreshed to show it.
+func (a *App) SwitchAccount(name string) error {
+	account, ok := a.config.ibkrAccount(name)
+	if !ok {
+		return fmt.Errorf("no IBKR account is named %q", name)
+	}
+	if a.config.activeIBKRAccount().Name == name {
+		return nil
+	}
+
+	previous := a.config
+	config := a.config
+	config.IBKRConnection.ActiveAccount = name
+	a.setConfig(config)
+	if err := a.saveConfig("SwitchAccount", name); err != nil {
+		a.setConfig(previous)
+		return err
+	}
+
+	logEvent := log.Info()
+	if account.Live() {
+		logEvent = log.Warn()
+	}
+	logEvent.Str("account", name).Str("account_code", account.AccountCode).Bool("live", account.Live()).Msg("Switched IBKR account")
+	a.collector.refresh()
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"traderadmin/backend/ibkr"
+	"traderadmin/backend/risk"
+)
+
+// twoAccounts returns a paper and a live account on a port nothing listens on
+func twoAccounts(t *testing.T) []IBKRAccount {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	return []IBKRAccount{
+		{Name: "paper", Host: "127.0.0.1", Port: port, ClientIDTrading: 1, ClientIDData: 2, AccountCode: "DU123456"},
+		{Name: "live", Host: "127.0.0.1", Port: port, ClientIDTrading: 11, ClientIDData: 12, AccountCode: "U7654321"},
+	}
+}
+
+func TestSwitchAccount(t *testing.T) {
+	app := NewApp()
+	app.configPath = filepath.Join(t.TempDir(), "config.toml")
+	var statuses []StatusInfo
+	app.emit = func(name string, data ...interface{}) {
+		if name == StatusUpdateEvent {
+			statuses = append(statuses, data[0].(StatusInfo))
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	app.bgCtx = ctx
+	defer app.stopIBKRConnections()
+
+	config := validConfig()
+	config.IBKRConnection.Accounts = twoAccounts(t)
+	app.setConfig(config)
+	manager := app.ibkrConnections()
+	if status := app.collectStatus(); status.IBKR.Account != "paper" || status.IBKR.AccountCode != "DU123456" || status.IBKR.Live {
+		t.Errorf("collectStatus().IBKR = %+v, want the first account active", status.IBKR)
+	}
+
+	if err := app.SwitchAccount("live"); err != nil {
+		t.Fatalf("SwitchAccount() error = %v", err)
+	}
+	if app.ibkrConnections() == manager {
+		t.Error("SwitchAccount did not reconnect")
+	}
+	if connections := app.GetIBKRConnections(); len(connections) != 2 || connections[0].ClientID != 11 || connections[1].ClientID != 12 {
+		t.Errorf("GetIBKRConnections() = %+v, want the live account's client ids", connections)
+	}
+	if len(statuses) == 0 || statuses[len(statuses)-1].IBKR.Account != "live" || !statuses[len(statuses)-1].IBKR.Live {
+		t.Errorf("Status events = %+v, want the live account reported", statuses)
+	}
+	if data, err := os.ReadFile(app.configPath); err != nil || !strings.Contains(string(data), `active_account = "live"`) {
+		t.Errorf("Saved config = %s, %v, want the live account active", data, err)
+	}
+
+	// Switching to the active account keeps the connections
+	manager = app.ibkrConnections()
+	if err := app.SwitchAccount("live"); err != nil || app.ibkrConnections() != manager {
+		t.Errorf("SwitchAccount() to the active account error = %v, reconnected %v", err, app.ibkrConnections() != manager)
+	}
+	if err := app.SwitchAccount("advisor"); err == nil || app.config.IBKRConnection.ActiveAccount != "live" {
+		t.Errorf("SwitchAccount() to an unknown account error = %v, active %q", err, app.config.IBKRConnection.ActiveAccount)
+	}
+}
+
+func TestActiveAccountScopesPositionsAndOrders(t *testing.T) {
+	app, client, _ := orderTestApp()
+	app.config.IBKRConnection.Accounts = twoAccounts(t)
+	app.config.IBKRConnection.ActiveAccount = "live"
+	app.exposures = &fakeExposures{legs: []risk.LegExposure{
+		{Symbol: "SPY", Quantity: -1, Account: "DU123456"},
+		{Symbol: "QQQ", Quantity: -1, Account: "U7654321"},
+		{Symbol: "IWM", Quantity: -1},
+	}}
+	client.open = []ibkr.OrderState{
+		{OrderID: 7, Symbol: "SPY", Account: "DU123456"},
+		{OrderID: 8, Symbol: "QQQ", Account: "U7654321"},
+	}
+
+	legs, err := app.openExposures()
+	if err != nil || len(legs) != 2 || legs[0].Symbol != "QQQ" || legs[1].Symbol != "IWM" {
+		t.Errorf("openExposures() = %+v, %v, want the live account's and the unattributed legs", legs, err)
+	}
+	orders, err := app.GetOpenOrders()
+	if err != nil || len(orders) != 1 || orders[0].OrderID != 8 {
+		t.Errorf("GetOpenOrders() = %+v, %v, want the live account's order", orders, err)
+	}
+	if metrics := app.collectMetrics(app.collectStatus()); metrics.Portfolio.AccountCode != "U7654321" {
+		t.Errorf("Portfolio.AccountCode = %q, want the live account", metrics.Portfolio.AccountCode)
+	}
+
+	// The paper account's positions and orders do not count against the limit
+	app.config.TradingParameters.GlobalMaxConcurrentPositions = 4
+	if _, err := app.PlaceSpreadOrder(testSpread()); err != nil {
+		t.Fatal(err)
+	}
+	if account := client.placed[0].Account; account != "U7654321" {
+		t.Errorf("Order placed for %q, want the live account", account)
+	}
+}
+
+func TestFAAllocation(t *testing.T) {
+	app, client, _ := orderTestApp()
+	app.config.TradingParameters.GlobalMaxConcurrentPositions = 3
+	app.config.IBKRConnection.Accounts = []IBKRAccount{{Name: "advisor", AccountCode: "F1234567", FAGroup: "Growth", FAMethod: ibkr.FAMethodNetLiq}}
+	app.exposures = &fakeExposures{legs: []risk.LegExposure{
+		{Symbol: "SPY", Expiry: "20240119", Strike: 400, Right: "P", Quantity: -2, Account: "U1111111"},
+		{Symbol: "SPY", Expiry: "20240119", Strike: 400, Right: "P", Quantity: -1, Account: "U2222222"},
+		{Symbol: "QQQ", Expiry: "20240119", Strike: 350, Right: "C", Quantity: -1, Account: "U2222222"},
+	}}
+
+	if _, err := app.PlaceSpreadOrder(testSpread()); err != nil {
+		t.Fatal(err)
+	}
+	want := ibkr.FAAllocation{Group: "Growth", Method: ibkr.FAMethodNetLiq}
+	if placed := client.placed[0]; placed.FAAllocation != want || placed.Account != "F1234567" {
+		t.Errorf("Placed order allocated %+v for %q, want %+v for the advisor account", placed.FAAllocation, placed.Account, want)
+	}
+	if whatIf := client.orders[0]; whatIf.FAAllocation != want {
+		t.Errorf("What-if order allocated %+v, want %+v", whatIf.FAAllocation, want)
+	}
+
+	// The sub-accounts' positions are summed in the metrics
+	metrics := app.collectMetrics(StatusInfo{})
+	if metrics.Portfolio.OpenPositionsCount != 2 || len(metrics.OpenPositions) != 2 ||
+		metrics.OpenPositions[1].Symbol != "SPY 20240119 400P" || metrics.OpenPositions[1].Quantity != -3 {
+		t.Errorf("Metrics positions = %+v, count %d; want SPY summed over both sub-accounts", metrics.OpenPositions, metrics.Portfolio.OpenPositionsCount)
+	}
+	accounts, err := app.GetSubAccountPositions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 2 || accounts[0].Account != "U1111111" || len(accounts[0].Legs) != 1 || len(accounts[1].Legs) != 2 || accounts[1].Greeks.LegCount != 2 {
+		t.Errorf("GetSubAccountPositions() = %+v, want each sub-account's legs", accounts)
+	}
+}
+
+func TestIBKRAccountLive(t *testing.T) {
+	for code, want := range map[string]bool{"DU123456": false, "df1234": false, "U7654321": true, "F1234": true, "": true} {
+		if got := (IBKRAccount{AccountCode: code}).Live(); got != want {
+			t.Errorf("Live() of %q = %v, want %v", code, got, want)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"traderadmin/backend/scanner"
+)
+
+// Limits of RunAdHocScan, which waits on the scanner while the user does
+const (
+	maxAdHocSymbols          = 200
+	defaultAdHocLookbackDays = 60
+	maxAdHocLookbackDays     = 5 * 365
+	adHocScanTimeout         = 5 * time.Minute
+)
+
+// adHocSymbol matches a ticker such as SPY, BRK.B or BF-B
+var adHocSymbol = regexp.MustCompile(`^[A-Z][A-Z0-9]{0,5}([.-][A-Z0-9]{1,2})?$`)
+
+// AdHocScanResult is the outcome of RunAdHocScan: the signals strongest
+// first, and the symbols the scanner left out with the reason
+type AdHocScanResult struct {
+	StartDate string `json:"startDate"`
+	EndDate   string `json:"endDate"`
+	scanner.ScanResult
+}
+
+// adHocScan holds the cancel function of the running RunAdHocScan, nil
+// when none is running
+type adHocScan struct {
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+// ListScanStrategies returns the strategies the scanner can evaluate, with
+// the parameters RunAdHocScan may override
+func (a *App) ListScanStrategies() ([]scanner.StrategyInfo, error) {
+	client, err := a.scannerClient()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), scannerFetchTimeout)
+	defer cancel()
+	return client.Strategies(ctx)
+}
+
+// RunAdHocScan scans symbols now with strategies, every strategy when
+// empty, over the last lookbackDays days, 60 when zero. paramOverrides
+// overrides strategy parameters by strategy name for this scan only. The
+// request is checked against the strategies the scanner lists before it is
+// sent. The scanner answers a scan at once rather than streaming it, so the
+// result comes back when the whole scan is done, or with an error wrapping
+// context.Canceled once CancelAdHocScan stops it. Only one ad-hoc scan runs
+// at a time; another is refused with ErrOperationInProgress.
+func (a *App) RunAdHocScan(symbols []string, strategies []string, lookbackDays int, paramOverrides map[string]map[string]float64) (*AdHocScanResult, error) {
+	symbols, err := adHocSymbols(symbols)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case lookbackDays < 0 || lookbackDays > maxAdHocLookbackDays:
+		return nil, fmt.Errorf("lookback must be between 0 (for %d) and %d days, got %d", defaultAdHocLookbackDays, maxAdHocLookbackDays, lookbackDays)
+	case lookbackDays == 0:
+		lookbackDays = defaultAdHocLookbackDays
+	}
+
+	client, err := a.scannerClient()
+	if err != nil {
+		return nil, err
+	}
+	ctx, stop, err := a.startAdHocScan()
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+
+	available, err := client.Strategies(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the scanner's strategies: %w", err)
+	}
+	paramOverrides = adHocOverrides(paramOverrides)
+	if strategies, err = adHocStrategies(strategies, paramOverrides, available); err != nil {
+		return nil, err
+	}
+
+	end := time.Now()
+	result := &AdHocScanResult{
+		StartDate: end.AddDate(0, 0, -lookbackDays).Format("2006-01-02"),
+		EndDate:   end.Format("2006-01-02"),
+	}
+	log.Info().Strs("symbols", symbols).Strs("strategies", strategies).Int("lookback_days", lookbackDays).Msg("Running ad-hoc scan")
+	result.ScanResult, err = client.Scan(ctx, scanner.ScanRequest{
+		Symbols:    symbols,
+		Strategies: strategies,
+		StartDate:  result.StartDate,
+		EndDate:    result.EndDate,
+		Parameters: paramOverrides,
+	})
+	if errors.Is(err, context.Canceled) {
+		log.Info().Msg("Ad-hoc scan cancelled")
+		return nil, fmt.Errorf("ad-hoc scan cancelled: %w", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Int("signals", len(result.Signals)).Int("errors", len(result.Errors)).Float64("seconds", result.ScanTimeSeconds).Msg("Ad-hoc scan finished")
+	return result, nil
+}
+
+// CancelAdHocScan stops the running RunAdHocScan
+func (a *App) CancelAdHocScan() {
+	a.adHocScan.mu.Lock()
+	defer a.adHocScan.mu.Unlock()
+	if a.adHocScan.cancel != nil {
+		a.adHocScan.cancel()
+	}
+}
+
+// startAdHocScan claims the ad-hoc scan and returns its context, cancelled
+// by CancelAdHocScan, on shutdown and after adHocScanTimeout. stop releases
+// the claim once the scan has returned, so a cancelled scan still holds it
+// while it unwinds.
+func (a *App) startAdHocScan() (ctx context.Context, stop func(), err error) {
+	parent := a.bgCtx
+	if parent == nil {
+		parent = context.Background()
+	}
+
+	a.adHocScan.mu.Lock()
+	defer a.adHocScan.mu.Unlock()
+	if a.adHocScan.cancel != nil {
+		return nil, nil, fmt.Errorf("ad-hoc scan: %w: another scan is still running", ErrOperationInProgress)
+	}
+	ctx, cancel := context.WithTimeout(parent, adHocScanTimeout)
+	a.adHocScan.cancel = cancel
+	stop = func() {
+		a.adHocScan.mu.Lock()
+		defer a.adHocScan.mu.Unlock()
+		cancel()
+		a.adHocScan.cancel = nil
+	}
+	return ctx, stop, nil
+}
+
+// adHocSymbols upper-cases and trims symbols, dropping repeats, and checks
+// that there are between one and maxAdHocSymbols well-formed ones
+func adHocSymbols(symbols []string) ([]string, error) {
+	var normalized, malformed []string
+	for _, symbol := range symbols {
+		symbol = strings.ToUpper(strings.TrimSpace(symbol))
+		switch {
+		case symbol == "" || slices.Contains(normalized, symbol):
+		case !adHocSymbol.MatchString(symbol):
+			malformed = append(malformed, symbol)
+		default:
+			normalized = append(normalized, symbol)
+		}
+	}
+	switch {
+	case len(malformed) > 0:
+		return nil, fmt.Errorf("invalid symbols %s: use tickers such as SPY or BRK.B", strings.Join(malformed, ", "))
+	case len(normalized) == 0:
+		return nil, fmt.Errorf("at least one symbol is required")
+	case len(normalized) > maxAdHocSymbols:
+		return nil, fmt.Errorf("an ad-hoc scan takes at most %d symbols, got %d", maxAdHocSymbols, len(normalized))
+	}
+	return normalized, nil
+}
+
+// adHocOverrides upper-cases and trims the strategy names of overrides, the
+// way adHocStrategies does the strategies, merging names that differ only in
+// case
+func adHocOverrides(overrides map[string]map[string]float64) map[string]map[string]float64 {
+	if overrides == nil {
+		return nil
+	}
+	normalized := make(map[string]map[string]float64, len(overrides))
+	for name, params := range overrides {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if normalized[name] == nil {
+			normalized[name] = make(map[string]float64, len(params))
+		}
+		for param, value := range params {
+			normalized[name][param] = value
+		}
+	}
+	return normalized
+}
+
+// adHocStrategies upper-cases strategies and checks them and the parameter
+// overrides against the strategies the scanner lists. An override must name
+// a strategy of the scan, and a parameter of it within its bounds.
+func adHocStrategies(strategies []string, overrides map[string]map[string]float64, available []scanner.StrategyInfo) ([]string, error) {
+	known := make(map[string]scanner.StrategyInfo, len(available))
+	names := make([]string, 0, len(available))
+	for _, info := range available {
+		known[info.Name] = info
+		names = append(names, info.Name)
+	}
+
+	var selected []string
+	for _, name := range strategies {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if name == "" || slices.Contains(selected, name) {
+			continue
+		}
+		if _, ok := known[name]; !ok {
+			return nil, fmt.Errorf("unknown strategy %s, the scanner has %s", name, strings.Join(names, ", "))
+		}
+		selected = append(selected, name)
+	}
+
+	overridden := make([]string, 0, len(overrides))
+	for name := range overrides {
+		overridden = append(overridden, name)
+	}
+	sort.Strings(overridden)
+	for _, name := range overridden {
+		info, ok := known[name]
+		if !ok || (len(selected) > 0 && !slices.Contains(selected, name)) {
+			return nil, fmt.Errorf("parameters given for %s, which the scan does not evaluate", name)
+		}
+		for param, value := range overrides[name] {
+			index := slices.IndexFunc(info.Params, func(p scanner.StrategyParam) bool { return p.Name == param })
+			if index < 0 {
+				return nil, fmt.Errorf("%s has no parameter %s", name, param)
+			}
+			if p := info.Params[index]; p.Min < p.Max && (value < p.Min || value > p.Max) {
+				return nil, fmt.Errorf("%s %s must be between %g and %g, got %g", name, param, p.Min, p.Max, value)
+			}
+		}
+	}
+	return selected, nil
+}
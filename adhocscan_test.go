@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	scannerpb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// scriptedScanner lists HIGH_BASE and LOW_BASE and answers Scan with a
+// scripted response, or blocks until the scan is cancelled while block is set
+type scriptedScanner struct {
+	scannerpb.UnimplementedScannerServiceServer
+	block   bool
+	scanned chan *scannerpb.ScanRequest
+}
+
+func (s *scriptedScanner) ListStrategies(ctx context.Context, req *scannerpb.ListStrategiesRequest) (*scannerpb.ListStrategiesResponse, error) {
+	return &scannerpb.ListStrategiesResponse{Strategies: []*scannerpb.StrategyInfo{
+		{Name: "HIGH_BASE", Params: []*scannerpb.StrategyParam{{Name: "min_atr_ratio", DefaultValue: 1.5, Min: 0.5, Max: 5}}},
+		{Name: "LOW_BASE"},
+	}}, nil
+}
+
+func (s *scriptedScanner) Scan(ctx context.Context, req *scannerpb.ScanRequest) (*scannerpb.ScanResponse, error) {
+	s.scanned <- req
+	if s.block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return &scannerpb.ScanResponse{
+		Signals: map[string]*scannerpb.SignalList{
+			"AAPL": {SignalTypes: []string{"LONG"}, Strategies: []string{"HIGH_BASE"}},
+			"MSFT": {SignalTypes: []string{"LONG"}, Strategies: []string{"HIGH_BASE"}},
+		},
+		RankedSignals: []*scannerpb.RankedSignal{
+			{Symbol: "MSFT", Strategy: "HIGH_BASE", Direction: "LONG", Score: 80},
+			{Symbol: "AAPL", Strategy: "HIGH_BASE", Direction: "LONG", Score: 55},
+		},
+		Errors: map[string]string{"GAPS": "DATA_QUALITY: 5 missing trading days, at most 2 allowed"},
+	}, nil
+}
+
+func TestRunAdHocScan(t *testing.T) {
+	app := NewApp()
+	fake := &scriptedScanner{scanned: make(chan *scannerpb.ScanRequest, 1)}
+	serveScanner(t, app, fake)
+
+	result, err := app.RunAdHocScan([]string{" aapl", "MSFT", "gaps", "AAPL"}, []string{"high_base"}, 30, map[string]map[string]float64{" high_base": {"min_atr_ratio": 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := <-fake.scanned
+	if strings.Join(req.Symbols, ",") != "AAPL,MSFT,GAPS" || strings.Join(req.Strategies, ",") != "HIGH_BASE" || req.Parameters["HIGH_BASE"].GetValues()["min_atr_ratio"] != 2 {
+		t.Errorf("Scan request = %v", req)
+	}
+	if want := time.Now().AddDate(0, 0, -30).Format("2006-01-02"); req.DateRange.GetStartDate() != want || result.StartDate != want {
+		t.Errorf("Scan started %s, result says %s; want %s", req.DateRange.GetStartDate(), result.StartDate, want)
+	}
+	if len(result.Signals) != 2 || result.Signals[0].Symbol != "MSFT" || result.Signals[1].Score != 55 {
+		t.Errorf("Signals = %+v, want MSFT then AAPL", result.Signals)
+	}
+	if !strings.HasPrefix(result.Errors["GAPS"], "DATA_QUALITY") {
+		t.Errorf("Errors = %v, want GAPS's data quality", result.Errors)
+	}
+}
+
+func TestRunAdHocScanRejects(t *testing.T) {
+	app := NewApp()
+	serveScanner(t, app, &scriptedScanner{scanned: make(chan *scannerpb.ScanRequest, 1)})
+
+	many := make([]string, maxAdHocSymbols+1)
+	for i := range many {
+		many[i] = fmt.Sprintf("S%d", i)
+	}
+	for _, tt := range []struct {
+		name       string
+		symbols    []string
+		strategies []string
+		lookback   int
+		overrides  map[string]map[string]float64
+		want       string
+	}{
+		{"no symbols", []string{" "}, nil, 0, nil, "at least one symbol"},
+		{"malformed symbol", []string{"AAPL", "AA PL", "$SPY"}, nil, 0, nil, "invalid symbols AA PL, $SPY"},
+		{"too many symbols", many, nil, 0, nil, "at most 200 symbols"},
+		{"negative lookback", []string{"AAPL"}, nil, -1, nil, "lookback"},
+		{"unknown strategy", []string{"AAPL"}, []string{"MID_BASE"}, 0, nil, "unknown strategy MID_BASE, the scanner has HIGH_BASE, LOW_BASE"},
+		{"strategy not scanned", []string{"AAPL"}, []string{"LOW_BASE"}, 0, map[string]map[string]float64{"HIGH_BASE": {"min_atr_ratio": 2}}, "HIGH_BASE, which the scan does not evaluate"},
+		{"unknown parameter", []string{"AAPL"}, nil, 0, map[string]map[string]float64{"HIGH_BASE": {"period": 2}}, "HIGH_BASE has no parameter period"},
+		{"parameter out of range", []string{"AAPL"}, nil, 0, map[string]map[string]float64{"HIGH_BASE": {"min_atr_ratio": 9}}, "between 0.5 and 5, got 9"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := app.RunAdHocScan(tt.symbols, tt.strategies, tt.lookback, tt.overrides); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("RunAdHocScan() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCancelAdHocScan(t *testing.T) {
+	app := NewApp()
+	fake := &scriptedScanner{block: true, scanned: make(chan *scannerpb.ScanRequest, 1)}
+	serveScanner(t, app, fake)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := app.RunAdHocScan([]string{"AAPL"}, nil, 0, nil)
+		done <- err
+	}()
+	<-fake.scanned
+
+	// A second scan is refused while the first runs
+	if _, err := app.RunAdHocScan([]string{"MSFT"}, nil, 0, nil); !errors.Is(err, ErrOperationInProgress) {
+		t.Errorf("Concurrent RunAdHocScan() error = %v, want ErrOperationInProgress", err)
+	}
+	app.CancelAdHocScan()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("RunAdHocScan() error = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunAdHocScan did not return after CancelAdHocScan")
+	}
+	// Cancelling with no scan running does nothing, and the next scan is
+	// no longer refused
+	app.CancelAdHocScan()
+	if _, err := app.RunAdHocScan([]string{"MSFT"}, []string{"MID_BASE"}, 0, nil); err == nil || errors.Is(err, ErrOperationInProgress) {
+		t.Errorf("RunAdHocScan() after the cancelled scan error = %v, want the unknown strategy", err)
+	}
+}
@@ -1,46 +1,84 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/BurntSushi/toml"
-	"github.com/fsnotify/fsnotify"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog/log"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
 
+	"github.com/trustdan/ibkr-trader/go/pkg/calendar"
+	"github.com/trustdan/ibkr-trader/go/pkg/configwatch"
+
+	"traderadmin/backend/health"
+	"traderadmin/backend/history"
+	"traderadmin/backend/ibkr"
+	"traderadmin/backend/journal"
 	"traderadmin/backend/models" // Using the correct module path from go.mod
+	"traderadmin/backend/notifications"
+	"traderadmin/backend/options"
+	"traderadmin/backend/orchestrator"
+	"traderadmin/backend/risk"
+	"traderadmin/backend/scanner"
+	"traderadmin/backend/watchlist"
+	"traderadmin/internal/instance"
 )
 
-// Configuration holds all settings loaded from config.toml
+// Configuration holds all settings loaded from config.toml. Settings tagged
+// secret:"true" are redacted from everything shared beyond the file, such as
+// presets.
 type Configuration struct {
+	// ConfigVersion is the layout of the file; older files are migrated on load
+	ConfigVersion int `toml:"config_version" json:"ConfigVersion" jsonschema:"description=Layout version of the config file; older files are migrated when loaded,minimum=1"`
+
 	General struct {
-		LogLevel string `toml:"log_level" json:"log_level" jsonschema:"description=Logging level for the application,enum=DEBUG,enum=INFO,enum=WARNING,enum=ERROR,enum=CRITICAL,default=INFO"`
+		LogLevel             string `toml:"log_level" json:"log_level" jsonschema:"description=Logging level for the application,enum=DEBUG,enum=INFO,enum=WARNING,enum=ERROR,enum=CRITICAL,default=INFO"`
+		StatusRefreshSeconds int    `toml:"status_refresh_seconds" json:"StatusRefreshSeconds" jsonschema:"description=Seconds between status and metrics refreshes pushed to the frontend,minimum=1,default=5"`
+		DryRun               bool   `toml:"dry_run" json:"DryRun" jsonschema:"description=Log what stack operations, config saves, orders and cache clears would do instead of doing it,default=false"`
+		CacheDir             string `toml:"cache_dir" json:"CacheDir" jsonschema:"description=Directory of cached data cleared by ClearCache; empty uses cache next to config.toml"`
+		ViewerMode           bool   `toml:"viewer_mode" json:"ViewerMode" jsonschema:"description=Bind only the read-only service so this TraderAdmin can look but not change anything; read at startup,default=false"`
 	} `toml:"general" json:"General"`
 
 	IBKRConnection struct {
-		Host            string `toml:"host" json:"Host" jsonschema:"description=IBKR TWS/Gateway host address,default=localhost"`
-		Port            int    `toml:"port" json:"Port" jsonschema:"description=IBKR TWS/Gateway port,minimum=1,maximum=65535,default=7497"`
-		ClientIDTrading int    `toml:"client_id_trading" json:"ClientIDTrading" jsonschema:"description=Client ID for trading connection,minimum=1,default=1"`
-		ClientIDData    int    `toml:"client_id_data" json:"ClientIDData" jsonschema:"description=Client ID for data connection,minimum=1,default=2"`
-		AccountCode     string `toml:"account_code" json:"AccountCode" jsonschema:"description=IBKR account code"`
-		ReadOnlyAPI     bool   `toml:"read_only_api" json:"ReadOnlyAPI" jsonschema:"description=Whether to use read-only API mode,default=false"`
+		ActiveAccount string        `toml:"active_account" json:"ActiveAccount" jsonschema:"description=Name of the account TraderAdmin connects to; empty uses the first"`
+		Accounts      []IBKRAccount `toml:"accounts" json:"Accounts" jsonschema:"description=TWS/Gateway accounts to switch between such as a paper and a live account"`
+
+		// Kept-alive TWS/Gateway connections; zero uses the defaults
+		HeartbeatSeconds  int `toml:"heartbeat_seconds" json:"HeartbeatSeconds" jsonschema:"description=Seconds between heartbeats on the TWS/Gateway connections; two missed intervals drop the connection,minimum=0,default=10"`
+		MaxBackoffSeconds int `toml:"max_backoff_seconds" json:"MaxBackoffSeconds" jsonschema:"description=Longest wait in seconds between reconnection attempts,minimum=0,default=60"`
 	} `toml:"ibkr_connection" json:"IBKRConnection"`
 
 	TradingParameters struct {
 		GlobalMaxConcurrentPositions  int     `toml:"global_max_concurrent_positions" json:"GlobalMaxConcurrentPositions" jsonschema:"description=Maximum number of concurrent positions,minimum=1,default=10"`
+		MaxDailyTrades                int     `toml:"max_daily_trades" json:"MaxDailyTrades" jsonschema:"description=Maximum trades entered per day; 0 is unlimited,minimum=0,default=3"`
 		DefaultRiskPerTradePercentage float64 `toml:"default_risk_per_trade_percentage" json:"DefaultRiskPerTradePercentage" jsonschema:"description=Percentage of account to risk per trade,minimum=0.1,maximum=5.0,default=1.0"`
 		EmergencyStopLossPercentage   float64 `toml:"emergency_stop_loss_percentage" json:"EmergencyStopLossPercentage" jsonschema:"description=Emergency stop loss percentage for the portfolio,minimum=1.0,maximum=20.0,default=5.0"`
+		PriceImprovementFactor        float64 `toml:"price_improvement_factor" json:"PriceImprovementFactor" jsonschema:"description=Where between the natural bid and ask spread orders placed from TraderAdmin are priced: 0.5 is the mid price and less is closer to the bid; 0 uses 0.4,minimum=0,maximum=1,default=0.4"`
 	} `toml:"trading_parameters" json:"TradingParameters"`
 
+	Universe struct {
+		Symbols          []string `toml:"symbols" json:"Symbols" jsonschema:"description=Symbols the scanner considers for trades"`
+		MinMarketCap     float64  `toml:"min_market_cap" json:"MinMarketCap" jsonschema:"description=Minimum market capitalization in dollars,minimum=0,default=10000000000"`
+		MinPrice         float64  `toml:"min_price" json:"MinPrice" jsonschema:"description=Minimum share price,minimum=0,default=20"`
+		MinVolume        float64  `toml:"min_volume" json:"MinVolume" jsonschema:"description=Minimum average daily share volume,minimum=0,default=1000000"`
+		CacheExpiryHours int      `toml:"cache_expiry_hours" json:"CacheExpiryHours" jsonschema:"description=Hours before the filtered universe is rebuilt,minimum=1,default=24"`
+		Sectors          []string `toml:"sectors" json:"Sectors" jsonschema:"description=Sectors to restrict scans to; empty scans all sectors"`
+	} `toml:"universe" json:"Universe"`
+
 	OptionsFilters struct {
 		// Liquidity
 		MinOpenInterest           int     `toml:"min_open_interest" json:"MinOpenInterest" jsonschema:"description=Minimum open interest for an option contract,minimum=0,default=500"`
@@ -69,6 +107,16 @@ type Configuration struct {
 		MinPositionTheta    float64 `toml:"min_position_theta" json:"MinPositionTheta" jsonschema:"description=Minimum positive theta decay per day per position,minimum=0.0,maximum=10.0,default=0.10"`
 	} `toml:"greek_limits" json:"GreekLimits"`
 
+	PortfolioGreekLimits struct {
+		UsePortfolioGreekLimits bool    `toml:"use_portfolio_greek_limits" json:"UsePortfolioGreekLimits" jsonschema:"description=Whether to enforce limits on aggregate portfolio Greeks,default=true"`
+		MaxAbsNetDelta          float64 `toml:"max_abs_net_delta" json:"MaxAbsNetDelta" jsonschema:"description=Maximum absolute net portfolio delta in share equivalents,minimum=0,default=500"`
+		MaxAbsNetGamma          float64 `toml:"max_abs_net_gamma" json:"MaxAbsNetGamma" jsonschema:"description=Maximum absolute net portfolio gamma in share equivalents,minimum=0,default=50"`
+		MaxAbsNetVega           float64 `toml:"max_abs_net_vega" json:"MaxAbsNetVega" jsonschema:"description=Maximum absolute net portfolio vega in dollars per vol point,minimum=0,default=1000"`
+		UseMinNetTheta          bool    `toml:"use_min_net_theta" json:"UseMinNetTheta" jsonschema:"description=Whether to enforce the minimum net portfolio theta; off lets debit spreads through,default=false"`
+		MinNetTheta             float64 `toml:"min_net_theta" json:"MinNetTheta" jsonschema:"description=Minimum net portfolio theta in dollars per day when use_min_net_theta is set,default=0"`
+		MaxGreeksAgeSeconds     int     `toml:"max_greeks_age_seconds" json:"MaxGreeksAgeSeconds" jsonschema:"description=Greeks older than this are flagged as stale,minimum=0,default=300"`
+	} `toml:"portfolio_greek_limits" json:"PortfolioGreekLimits"`
+
 	TradeTiming struct {
 		// Dynamic DTE Calculation
 		UseDynamicDTE     bool    `toml:"use_dynamic_dte" json:"UseDynamicDTE" jsonschema:"description=Whether to use dynamic DTE calculation,default=true"`
@@ -85,20 +133,122 @@ type Configuration struct {
 		AvoidExDividendDaysBefore int `toml:"avoid_ex_dividend_days_before" json:"AvoidExDividendDaysBefore" jsonschema:"description=Number of days before ex-dividend date to avoid,minimum=0,maximum=30,default=2"`
 	} `toml:"trade_timing" json:"TradeTiming"`
 
+	OptionChain struct {
+		StrikeBandPercentage float64 `toml:"strike_band_percentage" json:"StrikeBandPercentage" jsonschema:"description=Strikes fetched within this percentage of the underlying price,minimum=1,maximum=100,default=15"`
+		MarketDataLines      int     `toml:"market_data_lines" json:"MarketDataLines" jsonschema:"description=IBKR market data lines used at once when fetching a chain,minimum=1,default=90"`
+		MaxContracts         int     `toml:"max_contracts" json:"MaxContracts" jsonschema:"description=Most options fetched per chain; larger chains are truncated near the money,minimum=0,default=400"`
+		CacheExpiryMinutes   int     `toml:"cache_expiry_minutes" json:"CacheExpiryMinutes" jsonschema:"description=Minutes a fetched option chain is reused,minimum=0,default=5"`
+	} `toml:"option_chain" json:"OptionChain"`
+
+	SpreadBuilder struct {
+		SpreadWidth   float64 `toml:"spread_width" json:"SpreadWidth" jsonschema:"description=Distance between the short and long strikes; 0 pairs adjacent strikes,minimum=0,default=5"`
+		StrikeOffset  int     `toml:"strike_offset" json:"StrikeOffset" jsonschema:"description=Strikes between the money and the nearest short strike considered,minimum=0,default=1"`
+		MaxCandidates int     `toml:"max_candidates" json:"MaxCandidates" jsonschema:"description=Number of spread candidates and near misses returned,minimum=1,default=10"`
+		Score         string  `toml:"score" json:"Score" jsonschema:"description=How candidates are ranked,enum=POP_REWARD_RISK,enum=POP,enum=REWARD_RISK,enum=CREDIT,default=POP_REWARD_RISK"`
+
+		EnabledSpreadTypes []string `toml:"enabled_spread_types" json:"EnabledSpreadTypes" jsonschema:"description=Spread strategies built; empty builds them all,enum=BULL_PUT,enum=BEAR_CALL,enum=IRON_CONDOR"`
+	} `toml:"spread_builder" json:"SpreadBuilder"`
+
 	StrategyDefaults map[string]map[string]interface{} `toml:"strategy_defaults" json:"StrategyDefaults"`
 
+	History struct {
+		SnapshotIntervalMinutes int `toml:"snapshot_interval_minutes" json:"SnapshotIntervalMinutes" jsonschema:"description=Minutes between portfolio snapshots while connected to IBKR,minimum=1,default=5"`
+		RetentionDays           int `toml:"retention_days" json:"RetentionDays" jsonschema:"description=Days of full-resolution history to keep before compacting to daily,minimum=1,default=30"`
+	} `toml:"history" json:"History"`
+
 	Kubernetes struct {
-		Namespace                  string `toml:"namespace" json:"Namespace" jsonschema:"description=Kubernetes namespace for services,default=traderadmin"`
-		ConfigMapName              string `toml:"config_map_name" json:"ConfigMapName" jsonschema:"description=Name of the ConfigMap for configuration,default=traderadmin-config"`
-		OrchestratorDeploymentName string `toml:"orchestrator_deployment_name" json:"OrchestratorDeploymentName" jsonschema:"description=Name of the Orchestrator deployment,default=traderadmin-orchestrator"`
+		Namespace                  string            `toml:"namespace" json:"Namespace" jsonschema:"description=Kubernetes namespace for services,default=traderadmin"`
+		ConfigMapName              string            `toml:"config_map_name" json:"ConfigMapName" jsonschema:"description=Name of the ConfigMap for configuration,default=traderadmin-config"`
+		OrchestratorDeploymentName string            `toml:"orchestrator_deployment_name" json:"OrchestratorDeploymentName" jsonschema:"description=Name of the Orchestrator deployment,default=traderadmin-orchestrator"`
+		PushConfigOnSave           bool              `toml:"push_config_on_save" json:"PushConfigOnSave" jsonschema:"description=Push config.toml to the ConfigMap whenever the configuration is saved,default=false"`
+		RestartDeployments         map[string]string `toml:"restart_deployments" json:"RestartDeployments" jsonschema:"description=Deployments to roll when the ConfigMap changes: annotate-restart or none"`
+		ManifestsDir               string            `toml:"manifests_dir" json:"ManifestsDir" jsonschema:"description=Directory of stack manifests to deploy; empty uses the built-in kubernetes/base manifests"`
+		MaxReplicas                map[string]int    `toml:"max_replicas" json:"MaxReplicas" jsonschema:"description=Most replicas ScaleDeployment sets per deployment; deployments not listed are limited to one"`
 	} `toml:"kubernetes" json:"Kubernetes"`
 
+	Containers struct {
+		Labels          []string `toml:"labels" json:"Labels" jsonschema:"description=Docker label selectors listing a container, as key=value or key"`
+		NamePatterns    []string `toml:"name_patterns" json:"NamePatterns" jsonschema:"description=Regular expressions matched against container names"`
+		ImagePatterns   []string `toml:"image_patterns" json:"ImagePatterns" jsonschema:"description=Regular expressions matched against container images"`
+		ExcludePatterns []string `toml:"exclude_patterns" json:"ExcludePatterns" jsonschema:"description=Regular expressions for container names never listed"`
+		// MaxRestartsPerHour is how often a container may restart in an hour
+		// before the stack is reported degraded
+		MaxRestartsPerHour int `toml:"max_restarts_per_hour" json:"MaxRestartsPerHour" jsonschema:"description=Restarts of a container within an hour above which the stack is reported degraded,minimum=0,default=3"`
+	} `toml:"containers" json:"Containers"`
+
+	Docker DockerSettings `toml:"docker" json:"Docker"`
+
+	DockerStack struct {
+		StopTimeoutSeconds int                  `toml:"stop_timeout_seconds" json:"StopTimeoutSeconds" jsonschema:"description=Seconds a stopped container has to exit after SIGTERM before it is killed,minimum=0,default=30"`
+		ConfigMountPath    string               `toml:"config_mount_path" json:"ConfigMountPath" jsonschema:"description=Path the config directory is bind mounted at in created containers,default=/app/config"`
+		Network            string               `toml:"network" json:"Network" jsonschema:"description=Docker network created containers join; empty uses the default bridge"`
+		Containers         []StackContainerSpec `toml:"containers" json:"Containers" jsonschema:"description=Containers created by StartStack when none of the stack exist"`
+	} `toml:"docker_stack" json:"DockerStack"`
+
+	Health struct {
+		ListenAddress string             `toml:"listen_address" json:"ListenAddress" jsonschema:"description=Address serving /health and /metrics such as 127.0.0.1:9091; empty serves neither"`
+		Dependencies  []HealthDependency `toml:"dependencies" json:"Dependencies" jsonschema:"description=Services probed by the health check"`
+	} `toml:"health" json:"Health"`
+
+	Metrics struct {
+		Enabled       bool   `toml:"enabled" json:"Enabled" jsonschema:"description=Serve the portfolio and alert metrics to Prometheus,default=false"`
+		ListenAddress string `toml:"listen_address" json:"ListenAddress" jsonschema:"description=Address serving /metrics; only local scrapes unless it binds another interface,default=127.0.0.1:9464"`
+	} `toml:"metrics" json:"Metrics"`
+
+	ScannerConfig struct {
+		Host       string `toml:"host" json:"Host" jsonschema:"description=Scanner service host,default=localhost"`
+		Port       int    `toml:"port" json:"Port" jsonschema:"description=Scanner service gRPC port,minimum=1,maximum=65535,default=50051"`
+		Embedded   bool   `toml:"embedded" json:"Embedded" jsonschema:"description=Run the scanner inside TraderAdmin instead of dialing the scanner service,default=false"`
+		ConfigFile string `toml:"config_file" json:"ConfigFile" jsonschema:"description=Scanner YAML config of the embedded scanner, relative to the config file's directory; empty uses the scanner's defaults"`
+	} `toml:"scanner_config" json:"ScannerConfig"`
+
+	Orchestrator struct {
+		Address string `toml:"address" json:"Address" jsonschema:"description=host:port of the orchestrator's control service; pausing, resuming and reloading go through it when set, and through the containers or deployments when empty or unreachable"`
+	} `toml:"orchestrator" json:"Orchestrator"`
+
 	Schedule struct {
 		TradingStartTime string `toml:"trading_start_time" json:"TradingStartTime" jsonschema:"description=Trading start time (Eastern Time),default=09:30"`
 		TradingEndTime   string `toml:"trading_end_time" json:"TradingEndTime" jsonschema:"description=Trading end time (Eastern Time),default=16:00"`
 		WeekendTrading   bool   `toml:"weekend_trading" json:"WeekendTrading" jsonschema:"description=Whether to allow trading on weekends,default=false"`
 	} `toml:"schedule" json:"Schedule"`
 
+	EmergencyStop struct {
+		ClosePositions  bool `toml:"close_positions" json:"ClosePositions" jsonschema:"description=Have an emergency stop also place orders closing the open spread positions at the natural price,default=false"`
+		AutoTrigger     bool `toml:"auto_trigger" json:"AutoTrigger" jsonschema:"description=Run an emergency stop when the day's drawdown reaches TradingParameters.EmergencyStopLossPercentage,default=false"`
+		CooldownMinutes int  `toml:"cooldown_minutes" json:"CooldownMinutes" jsonschema:"description=Minutes after an automatic emergency stop before the drawdown can trigger another; 0 waits 60,minimum=0,default=60"`
+	} `toml:"emergency_stop" json:"EmergencyStop"`
+
+	ExitManagement struct {
+		Enabled         bool    `toml:"enabled" json:"Enabled" jsonschema:"description=Evaluate the open trades of the trade journal against their profit target and stop loss while connected to IBKR,default=false"`
+		IntervalSeconds int     `toml:"interval_seconds" json:"IntervalSeconds" jsonschema:"description=Seconds between evaluations of the open trades; 0 waits 30,minimum=0,default=30"`
+		TargetProfitPct float64 `toml:"target_profit_pct" json:"TargetProfitPct" jsonschema:"description=Percent of a trade's max profit that triggers its exit unless its strategy_defaults table sets target_profit_pct; 0 never,minimum=0,maximum=100,default=50"`
+		StopLossPct     float64 `toml:"stop_loss_pct" json:"StopLossPct" jsonschema:"description=Percent of a trade's max loss that triggers its exit unless its strategy_defaults table sets stop_loss_pct; 0 never,minimum=0,maximum=100,default=50"`
+		AutoExit        bool    `toml:"auto_exit" json:"AutoExit" jsonschema:"description=Place an order closing a trade that crosses its target or stop instead of only alerting unless its strategy_defaults table sets auto_exit,default=false"`
+	} `toml:"exit_management" json:"ExitManagement"`
+
+	Watchlists struct {
+		Enabled             bool `toml:"enabled" json:"Enabled" jsonschema:"description=Alert on the scanner's signals for the symbols of the watchlists kept in watchlists.json next to the config file,default=false"`
+		PollIntervalSeconds int  `toml:"poll_interval_seconds" json:"PollIntervalSeconds" jsonschema:"description=Seconds between checks of the scanner's latest scan against the watchlists; 0 waits 60,minimum=0,default=60"`
+		QuietPeriodMinutes  int  `toml:"quiet_period_minutes" json:"QuietPeriodMinutes" jsonschema:"description=Minutes before a watchlist alerts the same signal of a symbol again,minimum=0,default=240"`
+	} `toml:"watchlists" json:"Watchlists"`
+
+	NotificationCenter struct {
+		MaxEvents  int `toml:"max_events" json:"MaxEvents" jsonschema:"description=Most events the notification center keeps, the oldest dropped first; 0 keeps 500,minimum=0,default=500"`
+		MaxAgeDays int `toml:"max_age_days" json:"MaxAgeDays" jsonschema:"description=Days the notification center keeps an event; 0 keeps 30,minimum=0,default=30"`
+	} `toml:"notification_center" json:"NotificationCenter"`
+
+	MarketCalendar struct {
+		Timezone     string `toml:"timezone" json:"Timezone" jsonschema:"description=IANA timezone the exchange's hours are kept in; empty uses the calendar's America/New_York"`
+		OverrideFile string `toml:"override_file" json:"OverrideFile" jsonschema:"description=JSON file of holidays and early closes merged over the embedded NYSE calendar; an empty name removes a date"`
+	} `toml:"market_calendar" json:"MarketCalendar"`
+
+	EventCalendar struct {
+		Type          string `toml:"type" json:"Type" jsonschema:"description=Source of the earnings and ex-dividend dates option expirations are skipped around; none disables it,enum=none,enum=mock,enum=http,default=none"`
+		URL           string `toml:"url" json:"URL" jsonschema:"description=Endpoint of the http event calendar"`
+		Token         string `toml:"token" json:"Token" secret:"true" jsonschema:"description=Bearer token of the http event calendar"`
+		CacheTTLHours int    `toml:"cache_ttl_hours" json:"CacheTTLHours" jsonschema:"description=Hours an event date is reused; 0 keeps 24,minimum=0,default=24"`
+	} `toml:"event_calendar" json:"EventCalendar"`
+
 	TradingSchedule struct {
 		Enabled      bool     `toml:"enabled" json:"Enabled" jsonschema:"description=Master switch for the scheduler,default=true"`
 		StartTimeUTC string   `toml:"start_time_utc" json:"StartTimeUTC" jsonschema:"description=Trading start time in HH:MM format (UTC),default=13:30"`
@@ -113,6 +263,7 @@ type Configuration struct {
 			MinDailyRealizedPnl                 float64 `toml:"min_daily_realized_pnl" json:"MinDailyRealizedPnl" jsonschema:"description=Minimum acceptable daily realized P&L,default=-500.0"`
 			MaxPortfolioDrawdownPercentageToday float64 `toml:"max_portfolio_drawdown_percentage_today" json:"MaxPortfolioDrawdownPercentageToday" jsonschema:"description=Maximum acceptable portfolio drawdown percentage for the day,minimum=0,maximum=100,default=5.0"`
 			MaxApiErrorsPerHour                 int     `toml:"max_api_errors_per_hour" json:"MaxApiErrorsPerHour" jsonschema:"description=Maximum acceptable API errors per hour,minimum=0,default=10"`
+			MaxShortLegDelta                    float64 `toml:"max_short_leg_delta" json:"MaxShortLegDelta" jsonschema:"description=Absolute delta of an open trade's short leg above which it is alerted; 0 disables,minimum=0,maximum=1,default=0"`
 		} `toml:"thresholds" json:"Thresholds"`
 		Notifications struct {
 			Email struct {
@@ -121,107 +272,289 @@ type Configuration struct {
 				SmtpHost   string   `toml:"smtp_host" json:"SmtpHost" jsonschema:"description=SMTP server hostname"`
 				SmtpPort   int      `toml:"smtp_port" json:"SmtpPort" jsonschema:"description=SMTP server port,minimum=1,maximum=65535,default=587"`
 				SmtpUser   string   `toml:"smtp_user" json:"SmtpUser" jsonschema:"description=SMTP server username"`
-				SmtpPass   string   `toml:"smtp_pass" json:"SmtpPass" jsonschema:"description=SMTP server password (or environment variable name)"`
+				SmtpPass   string   `toml:"smtp_pass" json:"SmtpPass" secret:"true" jsonschema:"description=SMTP server password (or environment variable name)"`
 			} `toml:"email" json:"Email"`
 			Slack struct {
 				Enabled    bool   `toml:"enabled" json:"Enabled" jsonschema:"description=Enable Slack notifications,default=false"`
-				WebhookUrl string `toml:"webhook_url" json:"WebhookUrl" jsonschema:"description=Slack webhook URL (or environment variable name)"`
+				WebhookUrl string `toml:"webhook_url" json:"WebhookUrl" secret:"true" jsonschema:"description=Slack webhook URL (or environment variable name)"`
 			} `toml:"slack" json:"Slack"`
 		} `toml:"notifications" json:"Notifications"`
 	} `toml:"alerts_config" json:"AlertsConfig"`
 }
 
+// DockerSettings select the Docker daemon TraderAdmin manages containers on.
+// Without a host, DOCKER_HOST and the platform default are used.
+type DockerSettings struct {
+	Host        string `toml:"host" json:"Host" jsonschema:"description=Docker daemon as unix:// or npipe:// or tcp:// or ssh://; empty uses DOCKER_HOST"`
+	TLSCertPath string `toml:"tls_cert_path" json:"TLSCertPath" jsonschema:"description=Directory holding ca.pem and cert.pem and key.pem for a TLS tcp:// host"`
+	APIVersion  string `toml:"api_version" json:"APIVersion" jsonschema:"description=Docker API version to pin such as 1.43; empty negotiates"`
+}
+
+// IBKRAccount is a named TWS/Gateway login TraderAdmin can connect to, such
+// as a paper account, a live account or an advisor sub-account
+type IBKRAccount struct {
+	Name            string `toml:"name" json:"Name" jsonschema:"description=Name the account is switched to by"`
+	Host            string `toml:"host" json:"Host" jsonschema:"description=IBKR TWS/Gateway host address,default=localhost"`
+	Port            int    `toml:"port" json:"Port" jsonschema:"description=IBKR TWS/Gateway port,minimum=1,maximum=65535,default=7497"`
+	ClientIDTrading int    `toml:"client_id_trading" json:"ClientIDTrading" jsonschema:"description=Client ID for trading connection,minimum=1,default=1"`
+	ClientIDData    int    `toml:"client_id_data" json:"ClientIDData" jsonschema:"description=Client ID for data connection,minimum=1,default=2"`
+	AccountCode     string `toml:"account_code" json:"AccountCode" jsonschema:"description=IBKR account code"`
+	ReadOnlyAPI     bool   `toml:"read_only_api" json:"ReadOnlyAPI" jsonschema:"description=Whether to use read-only API mode,default=false"`
+
+	// Allocation of every order of a financial-advisor account among its
+	// sub-accounts: a group with a method, or a profile
+	FAGroup      string  `toml:"fa_group" json:"FAGroup" jsonschema:"description=FA group orders are allocated to; not with FAProfile"`
+	FAProfile    string  `toml:"fa_profile" json:"FAProfile" jsonschema:"description=FA allocation profile orders are allocated by; not with FAGroup"`
+	FAMethod     string  `toml:"fa_method" json:"FAMethod" jsonschema:"description=How orders are allocated among FAGroup's accounts,enum=,enum=EqualQuantity,enum=NetLiq,enum=AvailableEquity,enum=PctChange"`
+	FAPercentage float64 `toml:"fa_percentage" json:"FAPercentage" jsonschema:"description=Percentage change of each account's position for the PctChange method,minimum=-100,maximum=100"`
+}
+
+// StackContainerSpec describes a container StartStack creates from an image
+type StackContainerSpec struct {
+	Name    string            `toml:"name" json:"Name" jsonschema:"description=Container name"`
+	Image   string            `toml:"image" json:"Image" jsonschema:"description=Image and tag to run"`
+	Ports   []string          `toml:"ports" json:"Ports" jsonschema:"description=Published ports as host:container"`
+	Volumes []string          `toml:"volumes" json:"Volumes" jsonschema:"description=Bind mounts and volumes as source:target or source:target:ro"`
+	Env     map[string]string `toml:"env" json:"Env" jsonschema:"description=Environment variables"`
+}
+
+// HealthDependency is a service probed by the health check. A failing
+// critical dependency reports the stack down; any other degrades it.
+type HealthDependency struct {
+	Name      string `toml:"name" json:"Name" jsonschema:"description=Dependency name"`
+	Type      string `toml:"type" json:"Type" jsonschema:"description=How the dependency is probed,enum=grpc,enum=http,enum=ibkr,enum=kubernetes"`
+	Address   string `toml:"address" json:"Address" jsonschema:"description=host:port for grpc and ibkr; URL for http; deployment for kubernetes. Empty ibkr and kubernetes addresses use the active IBKR account and the orchestrator deployment"`
+	Service   string `toml:"service" json:"Service" jsonschema:"description=gRPC service checked; empty checks the whole server"`
+	Critical  bool   `toml:"critical" json:"Critical" jsonschema:"description=Whether a failure takes the stack down rather than degrading it,default=false"`
+	TimeoutMs int    `toml:"timeout_ms" json:"TimeoutMs" jsonschema:"description=Milliseconds the probe may take,minimum=0,default=2000"`
+}
+
+// ServiceStatus is the state of a trading service, from its Kubernetes
+// deployment once the cluster is reachable
+type ServiceStatus struct {
+	Name        string    `json:"name"`
+	Running     bool      `json:"running"`
+	Health      string    `json:"health"` // "healthy", "degraded", "unhealthy", "stopped", "unknown"
+	LastChecked time.Time `json:"lastChecked"`
+	Message     string    `json:"message,omitempty"`
+	// DesiredReplicas and ReadyReplicas are the deployment's, shown as
+	// ready/desired
+	DesiredReplicas int32 `json:"desiredReplicas"`
+	ReadyReplicas   int32 `json:"readyReplicas"`
+}
+
 // StatusInfo represents the current status of the application
 type StatusInfo struct {
 	IBKR struct {
 		Connected     bool      `json:"connected"`
 		LastConnected time.Time `json:"lastConnected,omitempty"`
 		Error         string    `json:"error,omitempty"`
+		// Account is the name of the active account and AccountCode its code;
+		// Live is set unless it is a paper account
+		Account     string `json:"account,omitempty"`
+		AccountCode string `json:"accountCode,omitempty"`
+		Live        bool   `json:"live"`
 	} `json:"ibkr"`
-	Services []struct {
-		Name        string    `json:"name"`
-		Running     bool      `json:"running"`
-		Health      string    `json:"health"` // "healthy", "unhealthy", "unknown"
-		LastChecked time.Time `json:"lastChecked"`
-		Message     string    `json:"message,omitempty"`
-	} `json:"services"`
-	ActivePositions int       `json:"activePositions"`
-	TradingActive   bool      `json:"tradingActive"`
-	IsTradingHours  bool      `json:"isTradingHours"`
-	LastUpdated     time.Time `json:"lastUpdated"`
+	Services        []ServiceStatus `json:"services"`
+	ActivePositions int             `json:"activePositions"`
+	TradingActive   bool            `json:"tradingActive"`
+	IsTradingHours  bool            `json:"isTradingHours"`
+	// MarketStatus says why it is not, as in "Market closed: Independence Day"
+	MarketStatus string    `json:"marketStatus,omitempty"`
+	DryRun       bool      `json:"dryRun"`
+	LastUpdated  time.Time `json:"lastUpdated"`
+	// Orchestrator is what the orchestrator reports of itself, nil without
+	// an [orchestrator] address; when reachable it also sets ActivePositions
+	// and TradingActive
+	Orchestrator *OrchestratorStatus `json:"orchestrator,omitempty"`
+	// Scanner is the scanner's version and its compatibility with TraderAdmin
+	Scanner *ScannerStatus `json:"scanner,omitempty"`
+	// Containers sums up the stack's Docker containers, nil without Docker
+	Containers *ContainersStatus `json:"containers,omitempty"`
 }
 
 // App struct
 type App struct {
 	ctx            context.Context
+	bgCtx          context.Context
+	bgCancel       context.CancelFunc
 	config         Configuration
 	configPath     string
-	watcher        *fsnotify.Watcher
+	configWatch    *configwatch.Watcher
 	configLoaded   bool
+	configWarnings []ConfigWarning
+	// configAuditMu serializes the audit log's writes; pendingPreset is the
+	// configuration ApplyConfigPreset last returned, until the next save
+	configAuditMu  sync.Mutex
+	pendingPreset  *pendingPreset
 	status         StatusInfo
 	lastUpdated    time.Time
-	k8sClient      *kubernetes.Clientset
-	k8sConfig      *rest.Config
+	collector      *statusCollector
 	servicesPaused bool
+	// restarting lets one SaveConfigurationAndRestart run at a time
+	restarting operationGuard
+	// viewer is set before binding when only the ReadService is bound
+	viewer bool
+	// readOnlyOverride lets guarded methods run in read-only mode
+	readOnlyOverride bool
+	ivHistory        *options.IVHistoryStore
+	orderClient      ibkr.OrderClient
+	marketData       ibkr.MarketDataClient
+	account          ibkr.AccountClient
+	optionChains     optionChainCache
+	cacheClearing    cacheClearing
+	adHocScan        adHocScan
+	exposures        risk.ExposureSource
+	equityStore      *history.EquityStore
+	journal          *journal.Journal
+	health           *health.Aggregator
+	metrics          *prometheus.Registry
+	exporter         *metricsExporter
+
+	// Connections to TWS/Gateway, restarted when the active account changes
+	ibkrMu     sync.RWMutex
+	ibkrConn   *ibkr.ConnectionManager
+	ibkrCancel context.CancelFunc
+	ibkrDone   chan struct{}
+
+	// Client of the scanner service, dialed on first use, and its version,
+	// checked once per connection
+	scannerMu      sync.Mutex
+	scanner        *scanner.Client
+	scannerAddr    string
+	scannerVersion *ScannerStatus
+	// Scanner engine run in-process with [scanner_config] embedded, created
+	// on first use and only stopped when switched off, since its metrics are
+	// registered with the app's
+	embeddedScanner *scanner.Embedded
+	// Metadata of the symbols looked up, shared with the scanner
+	symbolMetadata *scanner.MetadataCache
+
+	// Client of the orchestrator's control service, dialed on first use
+	orchestratorMu   sync.Mutex
+	orchestrator     *orchestrator.Client
+	orchestratorAddr string
+	dialOrchestrator func(address string) (*orchestrator.Client, error)
+
+	// Emergency stops run one at a time; emergencyOrders are the closing
+	// orders they placed by order ID, with their symbol, and emergencyAutoAt
+	// is when the drawdown last triggered one
+	emergencyMu     sync.Mutex
+	emergencyOrders map[int64]string
+	emergencyAutoMu sync.Mutex
+	emergencyAutoAt time.Time
+
+	// Latest evaluation of each open trade by the exit manager
+	exitMu     sync.Mutex
+	exitStatus []PositionExitStatus
+
+	// Last-known risk of each open trade, kept for those a refresh cannot
+	// quote, and the trades whose short leg delta is past the alert threshold
+	riskMu        sync.Mutex
+	lastRisk      map[int64]PositionRisk
+	deltaBreached map[int64]bool
+
+	// Watchlists alerted on when the scanner signals one of their symbols
+	watchlists *watchlist.Store
+
+	// Notification center of alerts, operations and state changes;
+	// tradingHours is whether the last refresh was in trading hours
+	notifications *notifications.Store
+	scheduleMu    sync.Mutex
+	tradingHours  *bool
+
+	// Exchange calendar of [market_calendar], loaded on first use
+	calendarMu  sync.Mutex
+	calendar    *calendar.MarketCalendar
+	calendarKey string
+
+	// Earnings and ex-dividend dates of [event_calendar], nil when disabled
+	events calendar.EventCalendarProvider
+
+	// Optional backends, connected in the background by startBackendDiscovery
+	backendMu            sync.RWMutex
+	backends             BackendStatus
+	backoff              backoffPolicy
+	k8s                  *kubernetesClients
+	dockerMu             sync.RWMutex
+	docker               *dockerClient
+	newDockerClient      func(DockerSettings) (*dockerClient, error)
+	pingDocker           func(context.Context) error
+	listContainers       func(context.Context) ([]ContainerInfo, error)
+	inspectStates        func(ctx context.Context, ids []string) ([]containerState, error)
+	containers           containerCache
+	restarts             restartHistory
+	runDocker            func(ctx context.Context, args ...string) error
+	streamDocker         func(ctx context.Context, onLine func(string), args ...string) error
+	newKubernetesClients func() (*kubernetesClients, error)
+	emit                 func(name string, data ...interface{})
+
+	// Single-instance lock; secondInstance is set when another instance
+	// holds it, and this one only offers to focus that one
+	instanceLock   *instance.Lock
+	secondInstance bool
 }
 
 // NewApp creates a new App application struct
 func NewApp() *App {
-	return &App{
-		configPath:     "config/config.toml", // Default path relative to executable
-		servicesPaused: false,
-	}
-}
-
-// Initializes Kubernetes client
-func (a *App) initKubernetesClient() error {
-	var k8sConfig *rest.Config
-	var err error
-
-	// Try to use in-cluster config first (for when running inside Kubernetes)
-	k8sConfig, err = rest.InClusterConfig()
-	if err != nil {
-		// If that fails, try to use local kubeconfig
-		kubeconfig := os.Getenv("KUBECONFIG")
-		if kubeconfig == "" {
-			// If KUBECONFIG is not set, use default location
-			home, err := os.UserHomeDir()
-			if err != nil {
-				return fmt.Errorf("failed to find home directory: %w", err)
-			}
-			kubeconfig = filepath.Join(home, ".kube", "config")
-		}
-
-		k8sConfig, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
-		if err != nil {
-			return fmt.Errorf("failed to build kubeconfig: %w", err)
-		}
-	}
-
-	// Create the clientset
-	clientset, err := kubernetes.NewForConfig(k8sConfig)
-	if err != nil {
-		return fmt.Errorf("failed to create Kubernetes client: %w", err)
+	app := &App{
+		configPath:           "config/config.toml", // Default path relative to executable
+		servicesPaused:       false,
+		backoff:              defaultBackoff,
+		emergencyOrders:      make(map[int64]string),
+		newDockerClient:      newDockerClient,
+		newKubernetesClients: kubernetesClientsFromConfig,
+		symbolMetadata:       scanner.NewMetadataCache(),
+		dialOrchestrator: func(address string) (*orchestrator.Client, error) {
+			return orchestrator.Dial(address)
+		},
 	}
-
-	a.k8sClient = clientset
-	a.k8sConfig = k8sConfig
-	return nil
+	app.pingDocker = app.pingDockerCLI
+	app.listContainers = app.dockerPS
+	app.inspectStates = app.dockerInspect
+	app.runDocker = app.dockerCommand
+	app.streamDocker = app.dockerStream
+	app.collector = app.newStatusCollector()
+	app.health = app.newHealthAggregator()
+	app.exporter = newMetricsExporter(app.metrics)
+	return app
 }
 
 // startup is called when the app starts. The context is saved
 // so we can call the runtime methods
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
+	a.bgCtx, a.bgCancel = context.WithCancel(ctx)
 
-	// Initialize config watcher
+	if a.secondInstance {
+		go a.offerRunningInstance()
+		return
+	}
+
+	// Initialize config watcher; without it edits of the file need a restart
 	var err error
-	a.watcher, err = fsnotify.NewWatcher()
+	a.configWatch, err = configwatch.New(a.configPath, configwatch.Options{
+		Load:    a.reloadConfig,
+		OnError: func(err error) { log.Error().Err(err).Msg("Failed to reload configuration") },
+	})
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to create config watcher")
-		return
 	}
 
+	// Open the notification center first so it records the warnings of the
+	// config file; its retention is set as the config is applied
+	a.notifications, err = notifications.Open(a.dataDir(), notifications.Retention{})
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to open notification center, notifications will be unavailable")
+	}
+
+	// Orders, market data and positions go over the connections of the
+	// running manager, which applying the configuration starts and restarts
+	// for each account
+	client := ibkr.NewClient(a.ibkrConnections)
+	a.orderClient, a.marketData, a.account = client, client, client
+	a.exposures = positionExposures{account: client, marketData: client}
+
 	// Load initial configuration
 	if err := a.LoadConfig(); err != nil {
 		log.Error().Err(err).Msg("Failed to load initial configuration")
@@ -229,34 +562,83 @@ func (a *App) startup(ctx context.Context) {
 
 	// Initialize status
 	a.initializeStatus()
+	a.collector.seed(a.status)
+
+	// Open the IV history store used for IV rank calculations
+	a.ivHistory, err = options.NewIVHistoryStore(a.dataDir())
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to open IV history store, IV rank will be unavailable")
+	}
+
+	// Open the equity history store and start recording portfolio snapshots
+	a.equityStore, err = history.NewEquityStore(a.dataDir())
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to open equity history store, equity curve will be unavailable")
+	} else {
+		go a.recordEquityHistory(a.bgCtx)
+	}
+
+	// Open the trade journal used for trade history and daily trade statistics
+	a.journal, err = journal.Open(a.dataDir())
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to open trade journal, trade history will be unavailable")
+	}
 
-	// Initialize Kubernetes client (can be used later for service management)
-	if err := a.initKubernetesClient(); err != nil {
-		log.Warn().Err(err).Msg("Failed to initialize Kubernetes client, service management may not work")
+	// Open the watchlists, kept apart from config.toml since alerting on them
+	// rewrites the file
+	a.watchlists, err = watchlist.Open(a.configDir())
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to open watchlists, watchlist alerts will be unavailable")
 	}
 
+	// Connect to Docker and Kubernetes in the background; service management
+	// reports ErrBackendUnavailable until they are up
+	a.startBackendDiscovery(a.bgCtx)
+
+	// Keep the container list current from Docker events once Docker is up
+	go a.watchContainers(a.bgCtx)
+
+	// Check the open trades against their profit targets and stop losses,
+	// when enabled
+	go a.manageExits(a.bgCtx)
+
+	// Alert on the scanner's signals for the symbols of the watchlists, when
+	// enabled
+	go a.watchSignals(a.bgCtx)
+
+	// Start the embedded scanner's scheduled scans, when enabled
+	if a.config.ScannerConfig.Embedded {
+		if _, err := a.scannerClient(); err != nil {
+			log.Warn().Err(err).Msg("Failed to start the embedded scanner")
+		}
+	}
+
+	// Refresh the status and metrics shown by the frontend in the background
+	go a.collector.run(a.bgCtx)
+
+	// Serve the aggregated health of the stack's dependencies, when configured
+	go a.serveHealth(a.bgCtx)
+
+	// Serve the portfolio and alert metrics to Prometheus, when enabled
+	go a.serveMetrics(a.bgCtx)
+
 	// Start watching config file for changes
-	go a.watchConfig()
+	if a.configWatch != nil {
+		go a.configWatch.Run(a.bgCtx)
+	}
+}
+
+// dataDir returns the directory used for persisted application data, next to the config file
+func (a *App) dataDir() string {
+	return filepath.Join(filepath.Dir(a.configPath), "data")
 }
 
 // initializeStatus initializes the status info with default values
 func (a *App) initializeStatus() {
 	now := time.Now()
+	tradingHours, marketStatus := a.tradingHoursStatus(now)
 	a.status = StatusInfo{
-		IBKR: struct {
-			Connected     bool      `json:"connected"`
-			LastConnected time.Time `json:"lastConnected,omitempty"`
-			Error         string    `json:"error,omitempty"`
-		}{
-			Connected: false,
-		},
-		Services: []struct {
-			Name        string    `json:"name"`
-			Running     bool      `json:"running"`
-			Health      string    `json:"health"`
-			LastChecked time.Time `json:"lastChecked"`
-			Message     string    `json:"message,omitempty"`
-		}{
+		Services: []ServiceStatus{
 			{
 				Name:        "Orchestrator",
 				Running:     false,
@@ -272,41 +654,14 @@ func (a *App) initializeStatus() {
 		},
 		ActivePositions: 0,
 		TradingActive:   false,
-		IsTradingHours:  a.isTradingHours(),
+		IsTradingHours:  tradingHours,
+		MarketStatus:    marketStatus,
+		DryRun:          a.IsDryRun(),
 		LastUpdated:     now,
 	}
 	a.lastUpdated = now
 }
 
-// isTradingHours checks if the current time is within trading hours
-func (a *App) isTradingHours() bool {
-	now := time.Now()
-
-	// Check if it's a weekend (Saturday=6, Sunday=0)
-	if now.Weekday() == time.Saturday || now.Weekday() == time.Sunday {
-		if !a.config.Schedule.WeekendTrading {
-			return false
-		}
-	}
-
-	// Simple implementation - assuming times are in the format "HH:MM" and in Eastern Time
-	// In a real implementation, would need to handle time zones properly
-	hour, minute := now.Hour(), now.Minute()
-	currentTimeMinutes := hour*60 + minute
-
-	// Parse trading start time
-	var startHour, startMinute int
-	fmt.Sscanf(a.config.Schedule.TradingStartTime, "%d:%d", &startHour, &startMinute)
-	startTimeMinutes := startHour*60 + startMinute
-
-	// Parse trading end time
-	var endHour, endMinute int
-	fmt.Sscanf(a.config.Schedule.TradingEndTime, "%d:%d", &endHour, &endMinute)
-	endTimeMinutes := endHour*60 + endMinute
-
-	return currentTimeMinutes >= startTimeMinutes && currentTimeMinutes <= endTimeMinutes
-}
-
 // LoadConfig loads the configuration from the config file
 func (a *App) LoadConfig() error {
 	absPath, err := filepath.Abs(a.configPath)
@@ -314,31 +669,83 @@ func (a *App) LoadConfig() error {
 		return fmt.Errorf("failed to get absolute path: %w", err)
 	}
 
-	_, err = os.Stat(absPath)
+	data, err := os.ReadFile(absPath)
 	if os.IsNotExist(err) {
 		return fmt.Errorf("config file not found at %s", absPath)
 	}
-
-	_, err = toml.DecodeFile(absPath, &a.config)
 	if err != nil {
-		return fmt.Errorf("failed to decode config file: %w", err)
+		return fmt.Errorf("failed to read config file: %w", err)
 	}
-
-	// Start watching the config file directory
-	configDir := filepath.Dir(absPath)
-	if err := a.watcher.Add(configDir); err != nil {
-		log.Error().Err(err).Str("dir", configDir).Msg("Failed to watch config directory")
+	loaded, err := a.applyConfigFile(data)
+	if err != nil {
+		return err
+	}
+	if a.configWatch != nil {
+		a.configWatch.MarkLoaded(loaded)
 	}
 
-	a.configLoaded = true
 	log.Info().Str("path", absPath).Msg("Configuration loaded successfully")
+	return nil
+}
 
+// reloadConfig loads the config file's content once the config watcher has
+// seen it change
+func (a *App) reloadConfig(data []byte) error {
+	log.Info().Msg("Config file changed, reloading...")
+	if _, err := a.applyConfigFile(data); err != nil {
+		return err
+	}
+	log.Info().Str("path", a.configPath).Msg("Configuration reloaded")
 	return nil
 }
 
+// applyConfigFile migrates, decodes, validates and applies the config file's
+// content, and returns the content applied. A file of an older layout is
+// rewritten in the current one after a backup.
+func (a *App) applyConfigFile(data []byte) ([]byte, error) {
+	migrated, version, err := migrateConfig(data, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate config file: %w", err)
+	}
+	if version > currentConfigVersion {
+		log.Warn().Int("version", version).Int("supported", currentConfigVersion).Msg("Config file is newer than this TraderAdmin, settings it does not know are ignored")
+	}
+	config, warnings, err := decodeConfig(migrated)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode config file: %w", err)
+	}
+	warnings = append(warnings, strategyDefaultsWarnings(config)...)
+
+	// An invalid edit of a loaded configuration is rejected; on startup the
+	// configuration is used anyway, so that it can be fixed in the settings
+	if err := a.validateConfig(config); err != nil {
+		if a.configLoaded {
+			return nil, fmt.Errorf("keeping the current configuration: %w", err)
+		}
+		log.Warn().Err(err).Msg("Loaded configuration is invalid")
+	}
+	if version < currentConfigVersion {
+		if err := a.writeMigratedConfig(data, migrated, version); err != nil {
+			log.Warn().Err(err).Msg("Using the migrated configuration without saving it")
+		}
+	}
+	a.setConfig(config)
+	a.setConfigWarnings(warnings)
+	a.configLoaded = true
+	return migrated, nil
+}
+
 // SaveConfig saves the current configuration to the config file
 func (a *App) SaveConfig() error {
-	// Create a backup of the current config file
+	return a.saveConfig("SaveConfig", "")
+}
+
+// saveConfig saves the current configuration to the config file and logs the
+// save by action in the config audit log
+func (a *App) saveConfig(action, detail string) error {
+	// Create a backup of the current config file, keeping its content for
+	// the audit log
+	previous, _ := os.ReadFile(a.configPath)
 	if _, err := os.Stat(a.configPath); err == nil {
 		backupPath := a.configPath + ".bak"
 		if err := os.Rename(a.configPath, backupPath); err != nil {
@@ -347,48 +754,27 @@ func (a *App) SaveConfig() error {
 		}
 	}
 
-	// Create the config file
-	file, err := os.Create(a.configPath)
-	if err != nil {
+	// Write the config file, which the config watcher then need not reload
+	logStrategyDefaultsWarnings(a.config)
+	a.config.ConfigVersion = currentConfigVersion
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(a.config); err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+	if err := os.WriteFile(a.configPath, buf.Bytes(), 0644); err != nil {
 		return fmt.Errorf("failed to create config file: %w", err)
 	}
-	defer file.Close()
-
-	encoder := toml.NewEncoder(file)
-	if err := encoder.Encode(a.config); err != nil {
-		return fmt.Errorf("failed to encode config: %w", err)
+	if a.configWatch != nil {
+		a.configWatch.MarkLoaded(buf.Bytes())
 	}
+	a.recordConfigAudit(action, detail, previous, buf.Bytes())
 
 	log.Info().Str("path", a.configPath).Msg("Configuration saved successfully")
-	return nil
-}
-
-// watchConfig watches for changes to the config file and reloads it when changed
-func (a *App) watchConfig() {
-	defer a.watcher.Close()
 
-	for {
-		select {
-		case event, ok := <-a.watcher.Events:
-			if !ok {
-				return
-			}
-
-			if event.Op&fsnotify.Write == fsnotify.Write || event.Op&fsnotify.Create == fsnotify.Create {
-				if filepath.Base(event.Name) == filepath.Base(a.configPath) {
-					log.Info().Msg("Config file changed, reloading...")
-					if err := a.LoadConfig(); err != nil {
-						log.Error().Err(err).Msg("Failed to reload configuration")
-					}
-				}
-			}
-		case err, ok := <-a.watcher.Errors:
-			if !ok {
-				return
-			}
-			log.Error().Err(err).Msg("Config watcher error")
-		}
+	if err := a.pushConfigOnSave(); err != nil {
+		return fmt.Errorf("configuration saved, but not pushed to the cluster: %w", err)
 	}
+	return nil
 }
 
 // GetConfig returns the current configuration (for frontend)
@@ -397,10 +783,13 @@ func (a *App) GetConfig() Configuration {
 	return a.config
 }
 
-// UpdateConfig updates the configuration and saves it
+// UpdateConfig validates the configuration, then updates and saves it
 func (a *App) UpdateConfig(newConfig Configuration) error {
-	a.config = newConfig
-	return a.SaveConfig()
+	if err := a.validateConfig(newConfig); err != nil {
+		return err
+	}
+	a.setConfig(newConfig)
+	return a.saveConfig("UpdateConfig", "")
 }
 
 // IsConfigLoaded returns whether the configuration has been loaded
@@ -408,6 +797,389 @@ func (a *App) IsConfigLoaded() bool {
 	return a.configLoaded
 }
 
+// ValidationError is one invalid configuration value. Field is the path of
+// the value in the JSON configuration, e.g. "TradeTiming.MinDTE" or
+// "TradingSchedule.DaysOfWeek[2]", so the frontend can highlight the input.
+type ValidationError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationErrors lists every invalid value of a configuration
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, fieldErr := range e {
+		messages[i] = fieldErr.Error()
+	}
+	return "invalid configuration: " + strings.Join(messages, "; ")
+}
+
+// ValidateConfig returns the invalid values of config, or nothing when it is
+// valid; UpdateConfig and SaveConfigurationAndRestart reject the same values
+func (a *App) ValidateConfig(config Configuration) ValidationErrors {
+	var errs ValidationErrors
+	errors.As(a.validateConfig(config), &errs)
+	return errs
+}
+
+// dockerAPIVersion matches a Docker API version such as 1.43
+var dockerAPIVersion = regexp.MustCompile(`^1\.\d+$`)
+
+// tradingDays are the values accepted in TradingSchedule.DaysOfWeek
+var tradingDays = map[string]bool{
+	"Mon": true, "Tue": true, "Wed": true, "Thu": true, "Fri": true, "Sat": true, "Sun": true,
+}
+
+// validateConfig checks config for values the services cannot run with and
+// returns ValidationErrors listing all of them
+func (a *App) validateConfig(config Configuration) error {
+	var errs ValidationErrors
+	invalid := func(field, format string, args ...interface{}) {
+		errs = append(errs, ValidationError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+	percentage := func(field string, value float64) {
+		if value < 0 || value > 100 {
+			invalid(field, "must be between 0 and 100, got %g", value)
+		}
+	}
+	port := func(field string, value int) {
+		if value < 1 || value > 65535 {
+			invalid(field, "must be a port between 1 and 65535, got %d", value)
+		}
+	}
+	clock := func(field, value string) (time.Time, bool) {
+		parsed, err := time.Parse("15:04", value)
+		if err != nil {
+			invalid(field, "must be a time as HH:MM, got %q", value)
+			return time.Time{}, false
+		}
+		return parsed, true
+	}
+
+	// Connection
+	ibkr := config.IBKRConnection
+	if len(ibkr.Accounts) == 0 {
+		invalid("IBKRConnection.Accounts", "must list at least one account")
+	}
+	names := make(map[string]bool, len(ibkr.Accounts))
+	for i, account := range ibkr.Accounts {
+		field := fmt.Sprintf("IBKRConnection.Accounts[%d]", i)
+		switch {
+		case strings.TrimSpace(account.Name) == "":
+			invalid(field+".Name", "is required")
+		case names[account.Name]:
+			invalid(field+".Name", "%q names another account too", account.Name)
+		}
+		names[account.Name] = true
+		port(field+".Port", account.Port)
+		switch {
+		case account.FAGroup != "" && account.FAProfile != "":
+			invalid(field+".FAProfile", "cannot be set with FAGroup %q; orders are allocated by a group or a profile", account.FAGroup)
+		case account.FAMethod != "" && account.FAGroup == "":
+			invalid(field+".FAMethod", "needs an FAGroup to allocate among")
+		case account.FAGroup != "" && !slices.Contains(faMethods, account.FAMethod):
+			invalid(field+".FAMethod", "must be EqualQuantity, NetLiq, AvailableEquity or PctChange for FAGroup %q, got %q", account.FAGroup, account.FAMethod)
+		case account.FAMethod == faPctChange && (account.FAPercentage == 0 || account.FAPercentage < -100 || account.FAPercentage > 100):
+			invalid(field+".FAPercentage", "must be a nonzero percentage between -100 and 100 for PctChange, got %g", account.FAPercentage)
+		case account.FAMethod != faPctChange && account.FAPercentage != 0:
+			invalid(field+".FAPercentage", "only applies to the PctChange method")
+		}
+		if !account.ReadOnlyAPI && strings.TrimSpace(account.AccountCode) == "" {
+			invalid(field+".AccountCode", "is required unless ReadOnlyAPI is set")
+		}
+	}
+	if ibkr.ActiveAccount != "" && !names[ibkr.ActiveAccount] {
+		invalid("IBKRConnection.ActiveAccount", "must be the name of an account, got %q", ibkr.ActiveAccount)
+	}
+	if ibkr.HeartbeatSeconds < 0 {
+		invalid("IBKRConnection.HeartbeatSeconds", "must not be negative, got %d", ibkr.HeartbeatSeconds)
+	}
+	if ibkr.MaxBackoffSeconds < 0 {
+		invalid("IBKRConnection.MaxBackoffSeconds", "must not be negative, got %d", ibkr.MaxBackoffSeconds)
+	}
+
+	// Scanner
+	if config.ScannerConfig.Port != 0 {
+		port("ScannerConfig.Port", config.ScannerConfig.Port)
+	}
+
+	// Risk
+	trading := config.TradingParameters
+	if trading.GlobalMaxConcurrentPositions < 0 {
+		invalid("TradingParameters.GlobalMaxConcurrentPositions", "must not be negative, got %d", trading.GlobalMaxConcurrentPositions)
+	}
+	if trading.MaxDailyTrades < 0 {
+		invalid("TradingParameters.MaxDailyTrades", "must not be negative, got %d", trading.MaxDailyTrades)
+	}
+	percentage("TradingParameters.DefaultRiskPerTradePercentage", trading.DefaultRiskPerTradePercentage)
+	percentage("TradingParameters.EmergencyStopLossPercentage", trading.EmergencyStopLossPercentage)
+	if trading.PriceImprovementFactor < 0 || trading.PriceImprovementFactor > 1 {
+		invalid("TradingParameters.PriceImprovementFactor", "must be between 0 and 1, got %g", trading.PriceImprovementFactor)
+	}
+
+	// Options filters
+	filters := config.OptionsFilters
+	percentage("OptionsFilters.MinIVRank", filters.MinIVRank)
+	percentage("OptionsFilters.MaxIVRank", filters.MaxIVRank)
+	if filters.UseIVRankFilter && filters.MinIVRank > filters.MaxIVRank {
+		invalid("OptionsFilters.MinIVRank", "must not be greater than MaxIVRank (%g > %g)", filters.MinIVRank, filters.MaxIVRank)
+	}
+	if filters.UseIVSkewFilter && filters.MinPutCallIVSkewPercentage > filters.MaxPutCallIVSkewPercentage {
+		invalid("OptionsFilters.MinPutCallIVSkewPercentage", "must not be greater than MaxPutCallIVSkewPercentage (%g > %g)",
+			filters.MinPutCallIVSkewPercentage, filters.MaxPutCallIVSkewPercentage)
+	}
+	percentage("OptionsFilters.MinProbabilityOfProfitPercentage", filters.MinProbabilityOfProfitPercentage)
+
+	// Option chains
+	percentage("OptionChain.StrikeBandPercentage", config.OptionChain.StrikeBandPercentage)
+	if config.OptionChain.MaxContracts < 0 {
+		invalid("OptionChain.MaxContracts", "must not be negative, got %d", config.OptionChain.MaxContracts)
+	}
+
+	// Spread builder
+	builder := config.SpreadBuilder
+	if builder.SpreadWidth < 0 {
+		invalid("SpreadBuilder.SpreadWidth", "must not be negative, got %g", builder.SpreadWidth)
+	}
+	if builder.StrikeOffset < 0 {
+		invalid("SpreadBuilder.StrikeOffset", "must not be negative, got %d", builder.StrikeOffset)
+	}
+	switch strings.ToUpper(builder.Score) {
+	case "", options.ScorePOPRewardRisk, options.ScorePOP, options.ScoreRewardRisk, options.ScoreCredit:
+	default:
+		invalid("SpreadBuilder.Score", "must be POP_REWARD_RISK, POP, REWARD_RISK or CREDIT, got %q", builder.Score)
+	}
+	for i, spreadType := range builder.EnabledSpreadTypes {
+		if !slices.Contains(options.SpreadStrategies, spreadType) {
+			invalid(fmt.Sprintf("SpreadBuilder.EnabledSpreadTypes[%d]", i), "must be BULL_PUT, BEAR_CALL or IRON_CONDOR, got %q", spreadType)
+		}
+	}
+
+	// Strategy defaults
+	validateStrategyDefaults(config, invalid)
+
+	// Docker
+	docker := config.Docker
+	if docker.Host != "" {
+		scheme, _, ok := strings.Cut(docker.Host, "://")
+		switch {
+		case !ok:
+			invalid("Docker.Host", "must be a URL such as tcp://host:2376, got %q", docker.Host)
+		case scheme != "unix" && scheme != "npipe" && scheme != "tcp" && scheme != "ssh":
+			invalid("Docker.Host", "must use unix, npipe, tcp or ssh, got %q", scheme)
+		}
+	}
+	if docker.TLSCertPath != "" && !strings.HasPrefix(docker.Host, "tcp://") {
+		invalid("Docker.TLSCertPath", "needs a tcp:// Docker.Host")
+	}
+	if docker.APIVersion != "" && !dockerAPIVersion.MatchString(docker.APIVersion) {
+		invalid("Docker.APIVersion", "must be a version such as 1.43, got %q", docker.APIVersion)
+	}
+
+	// Kubernetes
+	for name, max := range config.Kubernetes.MaxReplicas {
+		if max < 0 {
+			invalid("Kubernetes.MaxReplicas."+name, "must not be negative, got %d", max)
+		}
+	}
+
+	// Containers
+	if config.Containers.MaxRestartsPerHour < 0 {
+		invalid("Containers.MaxRestartsPerHour", "must not be negative, got %d", config.Containers.MaxRestartsPerHour)
+	}
+
+	// Docker stack
+	stack := config.DockerStack
+	if stack.StopTimeoutSeconds < 0 {
+		invalid("DockerStack.StopTimeoutSeconds", "must not be negative, got %d", stack.StopTimeoutSeconds)
+	}
+	stackNames := make(map[string]bool)
+	for i, spec := range stack.Containers {
+		field := fmt.Sprintf("DockerStack.Containers[%d]", i)
+		switch {
+		case strings.TrimSpace(spec.Name) == "":
+			invalid(field+".Name", "is required")
+		case stackNames[spec.Name]:
+			invalid(field+".Name", "duplicates container %q", spec.Name)
+		}
+		stackNames[spec.Name] = true
+		if strings.TrimSpace(spec.Image) == "" {
+			invalid(field+".Image", "is required")
+		}
+		for j, volume := range spec.Volumes {
+			if !strings.Contains(volume, ":") {
+				invalid(fmt.Sprintf("%s.Volumes[%d]", field, j), "must be source:target, got %q", volume)
+			}
+		}
+	}
+
+	// Health
+	healthNames := make(map[string]bool)
+	for i, dependency := range config.Health.Dependencies {
+		field := fmt.Sprintf("Health.Dependencies[%d]", i)
+		switch {
+		case strings.TrimSpace(dependency.Name) == "":
+			invalid(field+".Name", "is required")
+		case healthNames[dependency.Name]:
+			invalid(field+".Name", "duplicates dependency %q", dependency.Name)
+		}
+		healthNames[dependency.Name] = true
+		switch dependency.Type {
+		case HealthGRPC, HealthHTTP:
+			if dependency.Address == "" {
+				invalid(field+".Address", "is required for %s", dependency.Type)
+			}
+		case HealthIBKR, HealthKubernetes:
+		default:
+			invalid(field+".Type", "must be grpc, http, ibkr or kubernetes, got %q", dependency.Type)
+		}
+		if dependency.TimeoutMs < 0 {
+			invalid(field+".TimeoutMs", "must not be negative, got %d", dependency.TimeoutMs)
+		}
+	}
+
+	// Metrics
+	if address := config.Metrics.ListenAddress; address != "" {
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			invalid("Metrics.ListenAddress", "must be host:port, got %q", address)
+		}
+	}
+
+	// Orchestrator
+	if address := config.Orchestrator.Address; address != "" {
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			invalid("Orchestrator.Address", "must be host:port, got %q", address)
+		}
+	}
+
+	// Emergency stop
+	if config.EmergencyStop.CooldownMinutes < 0 {
+		invalid("EmergencyStop.CooldownMinutes", "must not be negative, got %d", config.EmergencyStop.CooldownMinutes)
+	}
+
+	// Exit management
+	exits := config.ExitManagement
+	if exits.IntervalSeconds < 0 {
+		invalid("ExitManagement.IntervalSeconds", "must not be negative, got %d", exits.IntervalSeconds)
+	}
+	percentage("ExitManagement.TargetProfitPct", exits.TargetProfitPct)
+	percentage("ExitManagement.StopLossPct", exits.StopLossPct)
+
+	// Watchlists
+	if config.Watchlists.PollIntervalSeconds < 0 {
+		invalid("Watchlists.PollIntervalSeconds", "must not be negative, got %d", config.Watchlists.PollIntervalSeconds)
+	}
+	if config.Watchlists.QuietPeriodMinutes < 0 {
+		invalid("Watchlists.QuietPeriodMinutes", "must not be negative, got %d", config.Watchlists.QuietPeriodMinutes)
+	}
+
+	// Notification center
+	if config.NotificationCenter.MaxEvents < 0 {
+		invalid("NotificationCenter.MaxEvents", "must not be negative, got %d", config.NotificationCenter.MaxEvents)
+	}
+	if config.NotificationCenter.MaxAgeDays < 0 {
+		invalid("NotificationCenter.MaxAgeDays", "must not be negative, got %d", config.NotificationCenter.MaxAgeDays)
+	}
+
+	// Market calendar
+	if timezone := config.MarketCalendar.Timezone; timezone != "" {
+		if _, err := time.LoadLocation(timezone); err != nil {
+			invalid("MarketCalendar.Timezone", "must be an IANA timezone such as America/New_York, got %q", timezone)
+		}
+	}
+	if file := config.MarketCalendar.OverrideFile; file != "" {
+		if _, err := calendar.NewMarketCalendar(file, ""); err != nil {
+			invalid("MarketCalendar.OverrideFile", "%v", err)
+		}
+	}
+	if events := config.EventCalendar; events.Type != "" {
+		if _, err := calendar.NewEventCalendarProvider(events.Type, events.URL, events.Token, 0); err != nil {
+			invalid("EventCalendar.Type", "%v", err)
+		}
+	}
+
+	// Greeks; a position's delta is per share, so at most 1
+	greeks := config.GreekLimits
+	if greeks.MaxAbsPositionDelta < 0 || greeks.MaxAbsPositionDelta > 1 {
+		invalid("GreekLimits.MaxAbsPositionDelta", "must be between 0 and 1, got %g", greeks.MaxAbsPositionDelta)
+	}
+	if greeks.MaxAbsPositionGamma < 0 {
+		invalid("GreekLimits.MaxAbsPositionGamma", "must not be negative, got %g", greeks.MaxAbsPositionGamma)
+	}
+	if greeks.MaxAbsPositionVega < 0 {
+		invalid("GreekLimits.MaxAbsPositionVega", "must not be negative, got %g", greeks.MaxAbsPositionVega)
+	}
+	if config.PortfolioGreekLimits.MaxAbsNetDelta < 0 {
+		invalid("PortfolioGreekLimits.MaxAbsNetDelta", "must not be negative, got %g", config.PortfolioGreekLimits.MaxAbsNetDelta)
+	}
+
+	// Trade timing
+	timing := config.TradeTiming
+	if timing.MinDTE < 0 {
+		invalid("TradeTiming.MinDTE", "must not be negative, got %d", timing.MinDTE)
+	}
+	if timing.MinDTE > timing.MaxDTE {
+		invalid("TradeTiming.MinDTE", "must not be greater than MaxDTE (%d > %d)", timing.MinDTE, timing.MaxDTE)
+	}
+	switch strings.ToUpper(timing.TargetDTEMode) {
+	case "", options.DTEModeFixed, options.DTEModeATRMultiple, options.DTEModeVolatilityIndex:
+	default:
+		invalid("TradeTiming.TargetDTEMode", "must be FIXED, ATR_MULTIPLE or VOLATILITY_INDEX, got %q", timing.TargetDTEMode)
+	}
+
+	// Schedules
+	if config.Schedule.TradingStartTime != "" || config.Schedule.TradingEndTime != "" {
+		start, startOK := clock("Schedule.TradingStartTime", config.Schedule.TradingStartTime)
+		end, endOK := clock("Schedule.TradingEndTime", config.Schedule.TradingEndTime)
+		if startOK && endOK && !start.Before(end) {
+			invalid("Schedule.TradingStartTime", "must be before TradingEndTime")
+		}
+	}
+	if schedule := config.TradingSchedule; schedule.Enabled {
+		clock("TradingSchedule.StartTimeUTC", schedule.StartTimeUTC)
+		clock("TradingSchedule.StopTimeUTC", schedule.StopTimeUTC)
+	}
+	for i, day := range config.TradingSchedule.DaysOfWeek {
+		if !tradingDays[day] {
+			invalid(fmt.Sprintf("TradingSchedule.DaysOfWeek[%d]", i), "must be one of Mon, Tue, Wed, Thu, Fri, Sat or Sun, got %q", day)
+		}
+	}
+
+	// Alerts
+	percentage("AlertsConfig.Thresholds.MaxPortfolioDrawdownPercentageToday", config.AlertsConfig.Thresholds.MaxPortfolioDrawdownPercentageToday)
+	if delta := config.AlertsConfig.Thresholds.MaxShortLegDelta; delta < 0 || delta > 1 {
+		invalid("AlertsConfig.Thresholds.MaxShortLegDelta", "must be between 0 and 1, got %g", delta)
+	}
+	if email := config.AlertsConfig.Notifications.Email; email.Enabled {
+		if strings.TrimSpace(email.SmtpHost) == "" {
+			invalid("AlertsConfig.Notifications.Email.SmtpHost", "is required when email notifications are enabled")
+		}
+		port("AlertsConfig.Notifications.Email.SmtpPort", email.SmtpPort)
+		if len(email.Recipients) == 0 {
+			invalid("AlertsConfig.Notifications.Email.Recipients", "needs at least one recipient when email notifications are enabled")
+		}
+		for i, recipient := range email.Recipients {
+			if !strings.Contains(recipient, "@") {
+				invalid(fmt.Sprintf("AlertsConfig.Notifications.Email.Recipients[%d]", i), "must be an email address, got %q", recipient)
+			}
+		}
+	}
+	if slack := config.AlertsConfig.Notifications.Slack; slack.Enabled && strings.TrimSpace(slack.WebhookUrl) == "" {
+		invalid("AlertsConfig.Notifications.Slack.WebhookUrl", "is required when Slack notifications are enabled")
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
 // GetConfigSchema generates a JSONSchema from the Configuration struct
 func (a *App) GetConfigSchema() (string, error) {
 	// Use reflection to generate a JSONSchema from the Configuration struct
@@ -433,41 +1205,72 @@ func (a *App) GetConfigSchema() (string, error) {
 			"IBKRConnection": map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
-					"Host": map[string]interface{}{
+					"ActiveAccount": map[string]interface{}{
 						"type":        "string",
-						"default":     "localhost",
-						"description": "IBKR TWS/Gateway host address",
+						"description": "Name of the account TraderAdmin connects to; empty uses the first",
 					},
-					"Port": map[string]interface{}{
-						"type":        "integer",
-						"minimum":     1,
-						"maximum":     65535,
-						"default":     7497,
-						"description": "IBKR TWS/Gateway port",
+					"Accounts": map[string]interface{}{
+						"type":        "array",
+						"minItems":    1,
+						"description": "TWS/Gateway accounts to switch between such as a paper and a live account",
+						"items": map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{
+								"Name": map[string]interface{}{
+									"type":        "string",
+									"description": "Name the account is switched to by",
+								},
+								"Host": map[string]interface{}{
+									"type":        "string",
+									"default":     "localhost",
+									"description": "IBKR TWS/Gateway host address",
+								},
+								"Port": map[string]interface{}{
+									"type":        "integer",
+									"minimum":     1,
+									"maximum":     65535,
+									"default":     7497,
+									"description": "IBKR TWS/Gateway port",
+								},
+								"ClientIDTrading": map[string]interface{}{
+									"type":        "integer",
+									"minimum":     1,
+									"default":     1,
+									"description": "Client ID for trading connection",
+								},
+								"ClientIDData": map[string]interface{}{
+									"type":        "integer",
+									"minimum":     1,
+									"default":     2,
+									"description": "Client ID for data connection",
+								},
+								"AccountCode": map[string]interface{}{
+									"type":        "string",
+									"description": "IBKR account code",
+								},
+								"ReadOnlyAPI": map[string]interface{}{
+									"type":        "boolean",
+									"default":     false,
+									"description": "Whether to use read-only API mode",
+								},
+							},
+							"required": []string{"Name", "Host", "Port", "ClientIDTrading"},
+						},
 					},
-					"ClientIDTrading": map[string]interface{}{
+					"HeartbeatSeconds": map[string]interface{}{
 						"type":        "integer",
-						"minimum":     1,
-						"default":     1,
-						"description": "Client ID for trading connection",
+						"minimum":     0,
+						"default":     10,
+						"description": "Seconds between heartbeats on the TWS/Gateway connections; two missed intervals drop the connection",
 					},
-					"ClientIDData": map[string]interface{}{
+					"MaxBackoffSeconds": map[string]interface{}{
 						"type":        "integer",
-						"minimum":     1,
-						"default":     2,
-						"description": "Client ID for data connection",
-					},
-					"AccountCode": map[string]interface{}{
-						"type":        "string",
-						"description": "IBKR account code",
-					},
-					"ReadOnlyAPI": map[string]interface{}{
-						"type":        "boolean",
-						"default":     false,
-						"description": "Whether to use read-only API mode",
+						"minimum":     0,
+						"default":     60,
+						"description": "Longest wait in seconds between reconnection attempts",
 					},
 				},
-				"required": []string{"Host", "Port", "ClientIDTrading", "AccountCode"},
+				"required": []string{"Accounts"},
 			},
 			"TradingParameters": map[string]interface{}{
 				"type": "object",
@@ -478,6 +1281,12 @@ func (a *App) GetConfigSchema() (string, error) {
 						"default":     10,
 						"description": "Maximum number of concurrent positions",
 					},
+					"MaxDailyTrades": map[string]interface{}{
+						"type":        "integer",
+						"minimum":     0,
+						"default":     3,
+						"description": "Maximum trades entered per day; 0 is unlimited",
+					},
 					"DefaultRiskPerTradePercentage": map[string]interface{}{
 						"type":        "number",
 						"minimum":     0.1,
@@ -492,6 +1301,13 @@ func (a *App) GetConfigSchema() (string, error) {
 						"default":     5.0,
 						"description": "Emergency stop loss percentage for the portfolio",
 					},
+					"PriceImprovementFactor": map[string]interface{}{
+						"type":        "number",
+						"minimum":     0,
+						"maximum":     1,
+						"default":     0.4,
+						"description": "Where between the natural bid and ask spread orders placed from TraderAdmin are priced: 0.5 is the mid price and less is closer to the bid",
+					},
 				},
 			},
 		},
@@ -506,99 +1322,85 @@ func (a *App) GetConfigSchema() (string, error) {
 	return string(schemaJSON), nil
 }
 
-// GetStatus returns the current status of the application
+// GetStatus returns the status of the application as of the last refresh
 func (a *App) GetStatus() StatusInfo {
-	// First check if we're connected to IBKR
-	ibkrConnected := a.TestIBKRConnection()
+	status, _ := a.collector.snapshot()
+	status.DryRun = a.IsDryRun()
+	return status
+}
+
+// collectStatus probes IBKR and the services for the status collector
+func (a *App) collectStatus() StatusInfo {
+	// The connection manager keeps the IBKR state, so nothing is dialed here
+	ibkrConnected, connectedSince, ibkrError := a.ibkrStatus()
 
 	now := time.Now()
 	a.lastUpdated = now
 
 	// Update status with real information
 	a.status.IBKR.Connected = ibkrConnected
+	a.status.IBKR.Error = ibkrError
+	account := a.config.activeIBKRAccount()
+	a.status.IBKR.Account, a.status.IBKR.AccountCode, a.status.IBKR.Live = account.Name, account.AccountCode, account.Live()
 	if ibkrConnected {
-		a.status.IBKR.LastConnected = now
-		a.status.IBKR.Error = ""
-	} else {
-		a.status.IBKR.Error = "Unable to connect to Interactive Brokers TWS/Gateway"
+		a.status.IBKR.LastConnected = connectedSince
 	}
 
 	// Update trading hours status
-	a.status.IsTradingHours = a.isTradingHours()
-
-	// Get active positions count - TODO: implement real count from IBKR position data
-	// For now just return the placeholder
+	a.status.IsTradingHours, a.status.MarketStatus = a.tradingHoursStatus(now)
+	a.status.DryRun = a.IsDryRun()
+
+	// The orchestrator knows whether it trades and how many positions it holds
+	a.status.Orchestrator = a.orchestratorStatus()
+	if orchestrator := a.status.Orchestrator; orchestrator != nil && orchestrator.Reachable {
+		a.status.TradingActive = orchestrator.TradingActive
+		a.status.ActivePositions = orchestrator.OpenPositions
+	}
+	a.status.Scanner = a.scannerStatus()
+	a.status.Containers = a.containersStatus()
 
-	// Update services status - when we have real k8s integration
-	if a.k8sClient != nil {
-		a.updateServicesStatus()
+	// Update services status once Kubernetes is available
+	if client, err := a.kubernetesClient(); err == nil {
+		a.updateServicesStatus(client)
 	}
 
 	a.status.LastUpdated = now
 	return a.status
 }
 
-// updateServicesStatus checks the status of trading services in Kubernetes
-func (a *App) updateServicesStatus() {
-	if a.k8sClient == nil {
-		return
-	}
-
-	namespace := a.config.Kubernetes.Namespace
-	if namespace == "" {
-		namespace = "traderadmin"
-	}
-
-	// List deployments to check service status
-	deployments, err := a.k8sClient.AppsV1().Deployments(namespace).List(context.Background(), metav1.ListOptions{})
+// updateServicesStatus checks the replicas of the trading services'
+// deployments in Kubernetes
+func (a *App) updateServicesStatus(client kubernetes.Interface) {
+	ctx, cancel := context.WithTimeout(context.Background(), deploymentTimeout)
+	defer cancel()
+	deployments, err := a.managedDeployments(ctx, client)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to list deployments")
 		return
 	}
 
-	// Clear existing services array
-	a.status.Services = make([]struct {
-		Name        string    `json:"name"`
-		Running     bool      `json:"running"`
-		Health      string    `json:"health"`
-		LastChecked time.Time `json:"lastChecked"`
-		Message     string    `json:"message,omitempty"`
-	}, 0)
-
-	for _, deployment := range deployments.Items {
-		if deployment.Labels["app"] == "traderadmin" {
-			serviceStatus := struct {
-				Name        string    `json:"name"`
-				Running     bool      `json:"running"`
-				Health      string    `json:"health"`
-				LastChecked time.Time `json:"lastChecked"`
-				Message     string    `json:"message,omitempty"`
-			}{
-				Name:        deployment.Name,
-				LastChecked: time.Now(),
-			}
-
-			// Check if deployment is available
-			if deployment.Status.AvailableReplicas > 0 {
-				serviceStatus.Running = true
-				serviceStatus.Health = "healthy"
-			} else {
-				serviceStatus.Running = false
-				serviceStatus.Health = "unhealthy"
-				serviceStatus.Message = fmt.Sprintf("Deployment has %d/%d replicas available",
-					deployment.Status.AvailableReplicas, *deployment.Spec.Replicas)
-			}
-
-			a.status.Services = append(a.status.Services, serviceStatus)
+	a.status.Services = make([]ServiceStatus, 0, len(deployments))
+	for _, deployment := range deployments {
+		service := ServiceStatus{
+			Name:            deployment.Name,
+			Running:         deployment.ReadyReplicas > 0,
+			Health:          deployment.Health,
+			LastChecked:     time.Now(),
+			DesiredReplicas: deployment.DesiredReplicas,
+			ReadyReplicas:   deployment.ReadyReplicas,
 		}
+		if deployment.Health != ReplicasHealthy {
+			service.Message = deployment.Replicas() + " replicas ready"
+		}
+		a.status.Services = append(a.status.Services, service)
 	}
 }
 
 // TestIBKRConnection tests the connection to IBKR
 func (a *App) TestIBKRConnection() bool {
 	// Try to connect to the IBKR TWS/Gateway API
-	host := a.config.IBKRConnection.Host
-	port := a.config.IBKRConnection.Port
+	account := a.config.activeIBKRAccount()
+	host, port := account.Host, account.Port
 
 	// Simple TCP connection test to see if TWS/Gateway is running
 	address := fmt.Sprintf("%s:%d", host, port)
@@ -617,29 +1419,67 @@ func (a *App) TestIBKRConnection() bool {
 
 // shutdown is called when the app is about to quit
 func (a *App) shutdown(ctx context.Context) {
-	if a.watcher != nil {
-		a.watcher.Close()
+	if a.bgCancel != nil {
+		a.bgCancel()
+	}
+	a.stopIBKRConnections()
+	a.scannerMu.Lock()
+	if a.scanner != nil {
+		a.scanner.Close()
+	}
+	if a.embeddedScanner != nil {
+		a.embeddedScanner.Stop()
+	}
+	a.scannerMu.Unlock()
+	a.orchestratorMu.Lock()
+	if a.orchestrator != nil {
+		a.orchestrator.Close()
+	}
+	a.orchestratorMu.Unlock()
+	if a.configWatch != nil {
+		a.configWatch.Close()
+	}
+	if a.instanceLock != nil {
+		if err := a.instanceLock.Release(); err != nil {
+			log.Warn().Err(err).Msg("Failed to release the single-instance lock")
+		}
 	}
 }
 
-// PauseTradingServices pauses all trading services by scaling down their Kubernetes deployments
+// tradingDeployments are the Kubernetes deployments PauseTradingServices and
+// ResumeTradingServices scale
+func (a *App) tradingDeployments() []string {
+	return []string{
+		a.config.Kubernetes.OrchestratorDeploymentName,
+		// Add other deployments as needed
+	}
+}
+
+// PauseTradingServices pauses trading through the orchestrator's control
+// service, or when it is not configured or unreachable by scaling down the
+// trading services' Kubernetes deployments
 func (a *App) PauseTradingServices() error {
-	if a.k8sClient == nil {
-		return fmt.Errorf("Kubernetes client not initialized")
+	if err := a.requireWritable("PauseTradingServices"); err != nil {
+		return err
+	}
+	if handled, err := a.controlOrchestrator(a.executor("pause"), "pause trading through the orchestrator", pauseOrchestrator("paused from TraderAdmin")); handled {
+		if err != nil {
+			return fmt.Errorf("failed to pause the orchestrator: %w", err)
+		}
+		a.servicesPaused = true
+		return nil
+	}
+	client, err := a.kubernetesClient()
+	if err != nil {
+		return err
 	}
 
 	namespace := a.config.Kubernetes.Namespace
 	log.Info().Str("namespace", namespace).Msg("Pausing trading services")
 
-	// Get deployments to pause (e.g., orchestrator, scanner)
-	deploymentsToScale := []string{
-		a.config.Kubernetes.OrchestratorDeploymentName,
-		// Add other deployments as needed
-	}
-
 	// Scale down each deployment to 0 replicas
-	for _, deploymentName := range deploymentsToScale {
-		scale, err := a.k8sClient.AppsV1().Deployments(namespace).GetScale(a.ctx, deploymentName, metav1.GetOptions{})
+	for _, deploymentName := range a.tradingDeployments() {
+		scale, err := client.AppsV1().Deployments(namespace).GetScale(a.ctx, deploymentName, metav1.GetOptions{})
 		if err != nil {
 			log.Error().Err(err).Str("deployment", deploymentName).Msg("Failed to get deployment scale")
 			continue
@@ -650,7 +1490,7 @@ func (a *App) PauseTradingServices() error {
 
 		// Set replicas to 0
 		scale.Spec.Replicas = 0
-		_, err = a.k8sClient.AppsV1().Deployments(namespace).UpdateScale(a.ctx, deploymentName, scale, metav1.UpdateOptions{})
+		_, err = client.AppsV1().Deployments(namespace).UpdateScale(a.ctx, deploymentName, scale, metav1.UpdateOptions{})
 		if err != nil {
 			return fmt.Errorf("failed to scale down deployment %s: %w", deploymentName, err)
 		}
@@ -662,24 +1502,31 @@ func (a *App) PauseTradingServices() error {
 	return nil
 }
 
-// ResumeTradingServices resumes all trading services by scaling up their Kubernetes deployments
+// ResumeTradingServices resumes trading through the orchestrator's control
+// service, or when it is not configured or unreachable by scaling up the
+// trading services' Kubernetes deployments
 func (a *App) ResumeTradingServices() error {
-	if a.k8sClient == nil {
-		return fmt.Errorf("Kubernetes client not initialized")
+	if err := a.requireWritable("ResumeTradingServices"); err != nil {
+		return err
+	}
+	if handled, err := a.controlOrchestrator(a.executor("resume"), "resume trading through the orchestrator", resumeOrchestrator); handled {
+		if err != nil {
+			return fmt.Errorf("failed to resume the orchestrator: %w", err)
+		}
+		a.servicesPaused = false
+		return nil
+	}
+	client, err := a.kubernetesClient()
+	if err != nil {
+		return err
 	}
 
 	namespace := a.config.Kubernetes.Namespace
 	log.Info().Str("namespace", namespace).Msg("Resuming trading services")
 
-	// Get deployments to resume
-	deploymentsToScale := []string{
-		a.config.Kubernetes.OrchestratorDeploymentName,
-		// Add other deployments as needed
-	}
-
 	// Scale up each deployment to 1 replica (or original replica count)
-	for _, deploymentName := range deploymentsToScale {
-		scale, err := a.k8sClient.AppsV1().Deployments(namespace).GetScale(a.ctx, deploymentName, metav1.GetOptions{})
+	for _, deploymentName := range a.tradingDeployments() {
+		scale, err := client.AppsV1().Deployments(namespace).GetScale(a.ctx, deploymentName, metav1.GetOptions{})
 		if err != nil {
 			log.Error().Err(err).Str("deployment", deploymentName).Msg("Failed to get deployment scale")
 			continue
@@ -687,7 +1534,7 @@ func (a *App) ResumeTradingServices() error {
 
 		// Set replicas to 1 (or the original value if you kept track of it)
 		scale.Spec.Replicas = 1
-		_, err = a.k8sClient.AppsV1().Deployments(namespace).UpdateScale(a.ctx, deploymentName, scale, metav1.UpdateOptions{})
+		_, err = client.AppsV1().Deployments(namespace).UpdateScale(a.ctx, deploymentName, scale, metav1.UpdateOptions{})
 		if err != nil {
 			return fmt.Errorf("failed to scale up deployment %s: %w", deploymentName, err)
 		}
@@ -699,62 +1546,126 @@ func (a *App) ResumeTradingServices() error {
 	return nil
 }
 
-// SaveConfigurationAndRestart saves the configuration and restarts the services
-func (a *App) SaveConfigurationAndRestart(configData map[string]interface{}) error {
-	var err error
-
-	// Step 1: Pause trading services
-	if !a.servicesPaused {
-		err = a.PauseTradingServices()
+// SaveConfigurationAndRestart saves the configuration and restarts the
+// services. Its report lists the steps taken; in dry-run mode the
+// configuration is only validated. Each step is emitted as a
+// RestartProgressEvent, and a call made while another is running returns
+// ErrOperationInProgress at once.
+func (a *App) SaveConfigurationAndRestart(configData map[string]interface{}) (OperationReport, error) {
+	return a.saveConfigurationAndRestart("SaveConfigurationAndRestart", "", func() (Configuration, error) {
+		// Create a JSON string from the map
+		jsonBytes, err := json.Marshal(configData)
 		if err != nil {
-			return fmt.Errorf("failed to pause trading services: %w", err)
+			return Configuration{}, fmt.Errorf("failed to marshal config data: %w", err)
 		}
-	}
 
-	// Step 2: Validate & Save configuration
-	// Create a JSON string from the map
-	jsonBytes, err := json.Marshal(configData)
+		// Create a new Configuration object
+		var newConfig Configuration
+		if err := json.Unmarshal(jsonBytes, &newConfig); err != nil {
+			return Configuration{}, fmt.Errorf("failed to unmarshal config data: %w", err)
+		}
+		return newConfig, nil
+	})
+}
+
+// saveConfigurationAndRestart runs SaveConfigurationAndRestart for operation,
+// the bound method logged in the config audit log, with the configuration
+// built by newConfig once the operation is allowed
+func (a *App) saveConfigurationAndRestart(operation, detail string, newConfig func() (Configuration, error)) (report OperationReport, err error) {
+	exec := a.executor("save-and-restart")
+	report = exec.report()
+	if err := a.restarting.begin(operation); err != nil {
+		return report, err
+	}
+	defer a.restarting.end()
+	progress := &restartProgress{app: a, exec: exec}
+	defer func() { progress.finish(err) }()
+	defer exec.finish(&report)
+
+	// Step 1: Validate the configuration before touching the services
+	progress.start(RestartValidate)
+	if err := a.requireWritable(operation); err != nil {
+		return report, err
+	}
+	config, err := newConfig()
 	if err != nil {
-		return fmt.Errorf("failed to marshal config data: %w", err)
+		return report, err
+	}
+	if err := a.validateConfig(config); err != nil {
+		return report, err
 	}
+	progress.succeed(nil)
 
-	// Create a new Configuration object
-	var newConfig Configuration
-	err = json.Unmarshal(jsonBytes, &newConfig)
-	if err != nil {
-		return fmt.Errorf("failed to unmarshal config data: %w", err)
+	// Step 2: Pause trading services and save the configuration
+	if !a.servicesPaused {
+		progress.start(RestartPause)
+		err = exec.run("pause the trading services", a.PauseTradingServices)
+		if err != nil {
+			progress.fail(err, a.tradingServiceProgress(ProgressFailed))
+			return report, fmt.Errorf("failed to pause trading services: %w", err)
+		}
+		progress.succeed(a.tradingServiceProgress("paused"))
+		report.Succeeded = append(report.Succeeded, "pause")
+	} else {
+		progress.skip(RestartPause)
 	}
 
 	// Create a backup of the current config file
+	progress.start(RestartBackup)
 	if _, err := os.Stat(a.configPath); err == nil {
 		timestamp := time.Now().Format("20060102_150405")
 		backupPath := fmt.Sprintf("%s.bak.%s", a.configPath, timestamp)
-		if err := copyFile(a.configPath, backupPath); err != nil {
+		if err := exec.run("copy "+a.configPath+" to "+backupPath, func() error { return copyFile(a.configPath, backupPath) }); err != nil {
 			log.Warn().Err(err).Msg("Failed to create backup of config file")
 			// Continue anyway - we'll try to write the new file
 		} else {
-			log.Info().Str("backup", backupPath).Msg("Created backup of config file")
+			log.Info().Str("backup", backupPath).Bool("dry_run", report.DryRun).Msg("Created backup of config file")
 		}
 	}
-
-	// Update the app's configuration
-	a.config = newConfig
-
-	// Save the new configuration
-	err = a.SaveConfig()
+	progress.succeed(nil)
+
+	// Update the app's configuration and save it
+	progress.start(RestartSave)
+	err = exec.run("apply the configuration and write it to "+a.configPath, func() error {
+		a.setConfig(config)
+		return a.saveConfig(operation, detail)
+	})
 	if err != nil {
-		return fmt.Errorf("failed to save configuration: %w", err)
+		return report, fmt.Errorf("failed to save configuration: %w", err)
+	}
+	progress.succeed(nil)
+	report.Succeeded = append(report.Succeeded, "save")
+
+	// Step 3: Have the orchestrator reread the configuration; without its
+	// control service the resumed deployments read it on start
+	progress.start(RestartReload)
+	if handled, err := a.controlOrchestrator(exec, "reload the orchestrator's configuration", reloadOrchestrator); handled {
+		if err != nil {
+			log.Error().Err(err).Msg("Orchestrator rejected the saved configuration")
+			report.Failed = append(report.Failed, ContainerOutcome{Name: "reload", Reason: err.Error()})
+			progress.emit(ProgressFailed, err, nil)
+		} else {
+			report.Succeeded = append(report.Succeeded, "reload")
+			progress.succeed(nil)
+		}
+	} else {
+		progress.skip(RestartReload)
 	}
 
-	// Step 3: Resume trading services
-	err = a.ResumeTradingServices()
+	// Step 4: Resume trading services
+	progress.start(RestartResume)
+	err = exec.run("resume the trading services", a.ResumeTradingServices)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to resume trading services, but configuration was saved")
-		return fmt.Errorf("configuration saved, but failed to resume services: %w", err)
+		report.Failed = append(report.Failed, ContainerOutcome{Name: "resume", Reason: err.Error()})
+		progress.fail(err, a.tradingServiceProgress(ProgressFailed))
+		return report, fmt.Errorf("configuration saved, but failed to resume services: %w", err)
 	}
+	progress.succeed(a.tradingServiceProgress("resumed"))
+	report.Succeeded = append(report.Succeeded, "resume")
 
-	log.Info().Msg("Successfully saved configuration and restarted services")
-	return nil
+	log.Info().Bool("dry_run", report.DryRun).Msg("Successfully saved configuration and restarted services")
+	return report, nil
 }
 
 // Helper function to copy a file
@@ -774,19 +1685,27 @@ func copyFile(src, dst string) error {
 	return nil
 }
 
-// GetLatestMetrics returns the latest metrics for the system
+// GetLatestMetrics returns the metrics of the system as of the last refresh
 func (a *App) GetLatestMetrics() (models.AllMetrics, error) {
+	_, metrics := a.collector.snapshot()
+	return metrics, nil
+}
+
+// collectMetrics gathers the metrics for the status collector, given the
+// status collected just before
+func (a *App) collectMetrics(status StatusInfo) models.AllMetrics {
 	now := time.Now()
 
 	// Create a metrics object with realistic initial values as fallback
 	metrics := models.AllMetrics{
 		Portfolio: models.PortfolioMetrics{
 			Timestamp:          now,
-			Equity:             0.00, // Will be filled with real data if possible
+			Equity:             0.00, // Filled from the account summary when connected
 			RealizedPNLToday:   0.00,
 			UnrealizedPNL:      0.00,
 			OpenPositionsCount: 0,
 			BuyingPower:        0.00,
+			AccountCode:        a.activeAccountCode(),
 		},
 		Trades: models.TradeStatsToday{
 			ExecutedCount: 0,
@@ -804,41 +1723,49 @@ func (a *App) GetLatestMetrics() (models.AllMetrics, error) {
 		OpenPositions: []models.Position{},
 	}
 
-	// If connected to IBKR, try to fetch real account data
-	if a.status.IBKR.Connected {
-		log.Info().Msg("Attempting to fetch real account data from IBKR")
-
-		// Direct socket API check (simple implementation)
-		// This just verifies we can establish communication
-		host := a.config.IBKRConnection.Host
-		port := a.config.IBKRConnection.Port
-		address := fmt.Sprintf("%s:%d", host, port)
+	// Daily trade statistics come from the trade journal
+	if a.journal != nil {
+		metrics.Trades = a.journal.StatsForDay(now)
+	}
 
-		conn, err := net.DialTimeout("tcp", address, 2*time.Second)
+	// The status collected just before has probed the IBKR connection; the
+	// portfolio values stay zero until TWS reports them
+	if status.IBKR.Connected && a.account != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		summary, err := a.account.AccountSummary(ctx, a.activeAccountCode())
+		cancel()
 		if err != nil {
-			log.Error().Err(err).Msg("Failed to connect to IBKR for metrics")
-			return metrics, nil // Return placeholder metrics
+			log.Debug().Err(err).Msg("Failed to load the account summary")
+		} else {
+			metrics.Portfolio.Equity = summary.NetLiquidation
+			metrics.Portfolio.BuyingPower = summary.BuyingPower
+			metrics.Portfolio.RealizedPNLToday = summary.RealizedPnL
+			metrics.Portfolio.UnrealizedPNL = summary.UnrealizedPnL
 		}
-		defer conn.Close()
+	} else {
+		log.Debug().Msg("Not connected to IBKR, using placeholder metrics")
+	}
 
-		// In a future implementation, this would be replaced with full TWS API calls
-		// For now we'll try to send a minimal request to see if we can get account data
-		// Note: For real implementation, you would use the official IBKR API client
+	// An advisor account's positions are held by its sub-accounts and
+	// summed here; GetSubAccountPositions breaks them down
+	if a.config.activeIBKRAccount().faAllocation().Active() && a.exposures != nil {
+		if legs, err := a.openExposures(); err != nil {
+			log.Debug().Err(err).Msg("Failed to load the sub-accounts' positions")
+		} else {
+			metrics.OpenPositions = sumPositions(legs)
+			metrics.Portfolio.OpenPositionsCount = openPositions(legs, nil)
+		}
+	}
 
-		// While we don't have full API integration, at least show zeros instead of placeholders
-		// to indicate we're connected but not showing mock data
-		metrics.Portfolio.Equity = 0.00
-		metrics.Portfolio.BuyingPower = 0.00
-		metrics.Portfolio.RealizedPNLToday = 0.00
-		metrics.Portfolio.UnrealizedPNL = 0.00
+	return metrics
+}
 
-		// Set last data sync to now since we've checked connection
-		metrics.System.LastDataSync = now
-	} else {
-		log.Warn().Msg("Not connected to IBKR, using placeholder metrics")
+// GetIVRank returns the IV rank and IV percentile of currentIV against the recorded IV history for a symbol
+func (a *App) GetIVRank(symbol string, currentIV float64) (options.IVRankResult, error) {
+	if a.ivHistory == nil {
+		return options.IVRankResult{}, fmt.Errorf("IV history store not initialized")
 	}
-
-	return metrics, nil
+	return a.ivHistory.Rank(symbol, currentIV), nil
 }
 
 // TestAlertNotification sends a test alert to the specified channel
@@ -874,6 +1801,13 @@ func (a *App) TestAlertNotification(channelType string, message string) error {
 
 		log.Info().Str("webhook_url", webhookUrl).Msg("Would send Slack notification")
 
+	case watchlist.ChannelInApp:
+		if a.notifications == nil {
+			return fmt.Errorf("notification center not initialized")
+		}
+		a.notify(notifications.SeverityInfo, notifications.CategoryAlert, message, nil)
+		return nil
+
 	default:
 		return fmt.Errorf("unsupported notification channel: %s", channelType)
 	}
@@ -1,26 +1,44 @@
 package main
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"traderadmin/backend/ibkr"
+	"traderadmin/backend/risk"
 )
 
+// validConfig returns a configuration that passes validation
+func validConfig() Configuration {
+	var config Configuration
+	config.IBKRConnection.Accounts = []IBKRAccount{{Name: "paper", Host: "localhost", Port: 7497, AccountCode: "DU123456"}}
+	config.TradingParameters.DefaultRiskPerTradePercentage = 1.0
+	config.TradeTiming.MinDTE = 7
+	config.TradeTiming.MaxDTE = 90
+	return config
+}
+
 func TestConfigValidation(t *testing.T) {
 	tests := []struct {
-		name        string
-		config      Configuration
-		shouldError bool
+		name       string
+		config     Configuration
+		wantFields []string
 	}{
 		{
 			name: "Valid configuration",
 			config: func() Configuration {
 				// Create a valid configuration
 				var config Configuration
-				config.IBKRConnection.Host = "localhost"
-				config.IBKRConnection.Port = 7497
-				config.IBKRConnection.ClientIDTrading = 1
-				config.IBKRConnection.ClientIDData = 2
-				config.IBKRConnection.AccountCode = "DU123456"
+				config.IBKRConnection.Accounts = []IBKRAccount{
+					{Name: "paper", Host: "localhost", Port: 7497, ClientIDTrading: 1, ClientIDData: 2, AccountCode: "DU123456"},
+				}
 
 				// Valid trading parameters
 				config.TradingParameters.GlobalMaxConcurrentPositions = 10
@@ -49,16 +67,14 @@ func TestConfigValidation(t *testing.T) {
 
 				return config
 			}(),
-			shouldError: false,
+			wantFields: nil,
 		},
 		{
 			name: "Invalid DTE range",
 			config: func() Configuration {
 				// Start with valid config
 				var config Configuration
-				config.IBKRConnection.Host = "localhost"
-				config.IBKRConnection.Port = 7497
-				config.IBKRConnection.ClientIDTrading = 1
+				config.IBKRConnection.Accounts = []IBKRAccount{{Name: "paper", Host: "localhost", Port: 7497, ClientIDTrading: 1}}
 
 				// Set invalid DTE range where MinDTE > MaxDTE
 				config.TradeTiming.MinDTE = 90
@@ -66,16 +82,14 @@ func TestConfigValidation(t *testing.T) {
 
 				return config
 			}(),
-			shouldError: true,
+			wantFields: []string{"TradeTiming.MinDTE", "IBKRConnection.Accounts[0].AccountCode"},
 		},
 		{
 			name: "Invalid IV rank range",
 			config: func() Configuration {
 				// Start with valid config
 				var config Configuration
-				config.IBKRConnection.Host = "localhost"
-				config.IBKRConnection.Port = 7497
-				config.IBKRConnection.ClientIDTrading = 1
+				config.IBKRConnection.Accounts = []IBKRAccount{{Name: "paper", Host: "localhost", Port: 7497, ClientIDTrading: 1}}
 
 				// Set invalid IV rank range where Min > Max
 				config.OptionsFilters.UseIVRankFilter = true
@@ -84,16 +98,14 @@ func TestConfigValidation(t *testing.T) {
 
 				return config
 			}(),
-			shouldError: true,
+			wantFields: []string{"OptionsFilters.MinIVRank", "IBKRConnection.Accounts[0].AccountCode"},
 		},
 		{
 			name: "Invalid trading schedule times",
 			config: func() Configuration {
 				// Start with valid config
 				var config Configuration
-				config.IBKRConnection.Host = "localhost"
-				config.IBKRConnection.Port = 7497
-				config.IBKRConnection.ClientIDTrading = 1
+				config.IBKRConnection.Accounts = []IBKRAccount{{Name: "paper", Host: "localhost", Port: 7497, ClientIDTrading: 1}}
 
 				// Set invalid trading schedule times
 				config.TradingSchedule.Enabled = true
@@ -102,62 +114,295 @@ func TestConfigValidation(t *testing.T) {
 
 				return config
 			}(),
-			shouldError: true,
+			wantFields: []string{"TradingSchedule.StartTimeUTC", "IBKRConnection.Accounts[0].AccountCode"},
+		},
+		{
+			name: "Read-only API without account code",
+			config: func() Configuration {
+				config := validConfig()
+				config.IBKRConnection.Accounts[0].AccountCode = ""
+				config.IBKRConnection.Accounts[0].ReadOnlyAPI = true
+				return config
+			}(),
+			wantFields: nil,
+		},
+		{
+			name: "Risk percentages over 100 and port out of range",
+			config: func() Configuration {
+				config := validConfig()
+				config.IBKRConnection.Accounts[0].Port = 70000
+				config.TradingParameters.DefaultRiskPerTradePercentage = 150
+				config.TradingParameters.EmergencyStopLossPercentage = -5
+				config.AlertsConfig.Thresholds.MaxPortfolioDrawdownPercentageToday = 101
+				return config
+			}(),
+			wantFields: []string{
+				"IBKRConnection.Accounts[0].Port",
+				"TradingParameters.DefaultRiskPerTradePercentage",
+				"TradingParameters.EmergencyStopLossPercentage",
+				"AlertsConfig.Thresholds.MaxPortfolioDrawdownPercentageToday",
+			},
+		},
+		{
+			name: "Delta limit above one",
+			config: func() Configuration {
+				config := validConfig()
+				config.GreekLimits.MaxAbsPositionDelta = 50
+				config.PortfolioGreekLimits.MaxAbsNetDelta = -1
+				return config
+			}(),
+			wantFields: []string{"GreekLimits.MaxAbsPositionDelta", "PortfolioGreekLimits.MaxAbsNetDelta"},
+		},
+		{
+			name: "Schedule times and days",
+			config: func() Configuration {
+				config := validConfig()
+				config.Schedule.TradingStartTime = "16:00"
+				config.Schedule.TradingEndTime = "09:30"
+				config.TradingSchedule.Enabled = true
+				config.TradingSchedule.StartTimeUTC = "13:30"
+				config.TradingSchedule.StopTimeUTC = "8pm"
+				config.TradingSchedule.DaysOfWeek = []string{"Mon", "Tuesday", "Fri", "Funday"}
+				return config
+			}(),
+			wantFields: []string{
+				"Schedule.TradingStartTime",
+				"TradingSchedule.StopTimeUTC",
+				"TradingSchedule.DaysOfWeek[1]",
+				"TradingSchedule.DaysOfWeek[3]",
+			},
+		},
+		{
+			name: "Target DTE mode",
+			config: func() Configuration {
+				config := validConfig()
+				config.TradeTiming.TargetDTEMode = "EARNINGS"
+				return config
+			}(),
+			wantFields: []string{"TradeTiming.TargetDTEMode"},
+		},
+		{
+			name: "Price improvement factor",
+			config: func() Configuration {
+				config := validConfig()
+				config.TradingParameters.PriceImprovementFactor = 1.5
+				return config
+			}(),
+			wantFields: []string{"TradingParameters.PriceImprovementFactor"},
+		},
+		{
+			name: "Spread types",
+			config: func() Configuration {
+				config := validConfig()
+				config.SpreadBuilder.EnabledSpreadTypes = []string{"IRON_CONDOR", "STRANGLE"}
+				return config
+			}(),
+			wantFields: []string{"SpreadBuilder.EnabledSpreadTypes[1]"},
+		},
+		{
+			name: "FA group and profile together",
+			config: func() Configuration {
+				config := validConfig()
+				config.IBKRConnection.Accounts[0].FAGroup = "Growth"
+				config.IBKRConnection.Accounts[0].FAMethod = ibkr.FAMethodNetLiq
+				config.IBKRConnection.Accounts[0].FAProfile = "Conservative"
+				return config
+			}(),
+			wantFields: []string{"IBKRConnection.Accounts[0].FAProfile"},
+		},
+		{
+			name: "FA method without a group and percentage without PctChange",
+			config: func() Configuration {
+				config := validConfig()
+				config.IBKRConnection.Accounts[0].FAMethod = ibkr.FAMethodEqualQuantity
+				config.IBKRConnection.Accounts = append(config.IBKRConnection.Accounts, IBKRAccount{
+					Name: "advisor", Host: "localhost", Port: 7496, ClientIDTrading: 1, ClientIDData: 2, AccountCode: "F1234567",
+					FAGroup: "Growth", FAMethod: ibkr.FAMethodPctChange, FAPercentage: 150,
+				})
+				return config
+			}(),
+			wantFields: []string{"IBKRConnection.Accounts[0].FAMethod", "IBKRConnection.Accounts[1].FAPercentage"},
+		},
+		{
+			name: "FA group with a method",
+			config: func() Configuration {
+				config := validConfig()
+				config.IBKRConnection.Accounts[0].FAGroup = "Growth"
+				config.IBKRConnection.Accounts[0].FAMethod = ibkr.FAMethodPctChange
+				config.IBKRConnection.Accounts[0].FAPercentage = -50
+				return config
+			}(),
+			wantFields: nil,
+		},
+		{
+			name: "Docker host scheme, TLS and API version",
+			config: func() Configuration {
+				config := validConfig()
+				config.Docker.Host = "http://docker.lan:2375"
+				config.Docker.TLSCertPath = "/etc/docker/certs"
+				config.Docker.APIVersion = "v1.43"
+				return config
+			}(),
+			wantFields: []string{"Docker.Host", "Docker.TLSCertPath", "Docker.APIVersion"},
+		},
+		{
+			name: "Remote Docker host over TLS",
+			config: func() Configuration {
+				config := validConfig()
+				config.Docker.Host = "tcp://docker.lan:2376"
+				config.Docker.TLSCertPath = "/etc/docker/certs"
+				config.Docker.APIVersion = "1.43"
+				return config
+			}(),
+			wantFields: nil,
+		},
+		{
+			name: "Health dependencies without names types or addresses",
+			config: func() Configuration {
+				config := validConfig()
+				config.Health.Dependencies = []HealthDependency{
+					{Name: "scanner", Type: HealthGRPC},
+					{Name: "scanner", Type: HealthIBKR, TimeoutMs: -1},
+					{Type: "redis", Address: "localhost:6379"},
+				}
+				return config
+			}(),
+			wantFields: []string{
+				"Health.Dependencies[0].Address",
+				"Health.Dependencies[1].Name",
+				"Health.Dependencies[1].TimeoutMs",
+				"Health.Dependencies[2].Name",
+				"Health.Dependencies[2].Type",
+			},
+		},
+		{
+			name: "Health dependencies defaulting to the IBKR connection and orchestrator",
+			config: func() Configuration {
+				config := validConfig()
+				config.Health.Dependencies = []HealthDependency{
+					{Name: "ibkr", Type: HealthIBKR, Critical: true},
+					{Name: "orchestrator", Type: HealthKubernetes},
+					{Name: "scanner", Type: HealthGRPC, Address: "localhost:50051", TimeoutMs: 500},
+				}
+				return config
+			}(),
+			wantFields: nil,
+		},
+		{
+			name: "Scanner port out of range",
+			config: func() Configuration {
+				config := validConfig()
+				config.ScannerConfig.Port = 70000
+				return config
+			}(),
+			wantFields: []string{"ScannerConfig.Port"},
+		},
+		{
+			name: "Incomplete alert channels",
+			config: func() Configuration {
+				config := validConfig()
+				config.AlertsConfig.Notifications.Email.Enabled = true
+				config.AlertsConfig.Notifications.Email.SmtpPort = 587
+				config.AlertsConfig.Notifications.Slack.Enabled = true
+				return config
+			}(),
+			wantFields: []string{
+				"AlertsConfig.Notifications.Email.SmtpHost",
+				"AlertsConfig.Notifications.Email.Recipients",
+				"AlertsConfig.Notifications.Slack.WebhookUrl",
+			},
+		},
+		{
+			name: "Complete email channel",
+			config: func() Configuration {
+				config := validConfig()
+				config.AlertsConfig.Notifications.Email.Enabled = true
+				config.AlertsConfig.Notifications.Email.SmtpHost = "smtp.example.com"
+				config.AlertsConfig.Notifications.Email.SmtpPort = 587
+				config.AlertsConfig.Notifications.Email.Recipients = []string{"trader@example.com"}
+				return config
+			}(),
+			wantFields: nil,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			app := NewApp()
-			// We need to call app.validateConfig which should exist in your app.go
-			// If it doesn't exist, you'll need to extract the validation logic into a separate method
 			err := app.validateConfig(tt.config)
 
-			if (err != nil) != tt.shouldError {
-				t.Errorf("validateConfig() error = %v, shouldError %v", err, tt.shouldError)
+			var gotFields []string
+			var errs ValidationErrors
+			if errors.As(err, &errs) {
+				for _, fieldErr := range errs {
+					gotFields = append(gotFields, fieldErr.Field)
+				}
+			} else if err != nil {
+				t.Fatalf("validateConfig() error = %v, want ValidationErrors", err)
+			}
+
+			sort.Strings(gotFields)
+			want := append([]string(nil), tt.wantFields...)
+			sort.Strings(want)
+			if strings.Join(gotFields, ",") != strings.Join(want, ",") {
+				t.Errorf("validateConfig() fields = %v, want %v (error: %v)", gotFields, want, err)
 			}
 		})
 	}
 }
 
-// Mock function to simulate the validation logic from app.go
-// You'll need to implement this with your actual validation logic
-func (a *App) validateConfig(config Configuration) error {
-	// Example validation rules:
-
-	// Validate DTE range
-	if config.TradeTiming.MinDTE > config.TradeTiming.MaxDTE {
-		return &ValidationError{Field: "TradeTiming.MinDTE/MaxDTE", Message: "MinDTE cannot be greater than MaxDTE"}
+func TestTemplateConfigIsValid(t *testing.T) {
+	var config Configuration
+	if _, err := toml.DecodeFile(filepath.Join("config", "config.template.toml"), &config); err != nil {
+		t.Fatal(err)
 	}
+	if errs := NewApp().ValidateConfig(config); len(errs) > 0 {
+		t.Errorf("Template config is invalid: %v", errs)
+	}
+}
 
-	// Validate IV rank range if filter is enabled
-	if config.OptionsFilters.UseIVRankFilter &&
-		config.OptionsFilters.MinIVRank > config.OptionsFilters.MaxIVRank {
-		return &ValidationError{Field: "OptionsFilters.MinIVRank/MaxIVRank", Message: "MinIVRank cannot be greater than MaxIVRank"}
+func TestTemplateGreekLimitsAcceptDebitSpreads(t *testing.T) {
+	app := NewApp()
+	if _, err := toml.DecodeFile(filepath.Join("config", "config.template.toml"), &app.config); err != nil {
+		t.Fatal(err)
 	}
+	app.exposures = &fakeExposures{}
 
-	// Validate trading schedule time format
-	if config.TradingSchedule.Enabled {
-		_, err := time.Parse("15:04", config.TradingSchedule.StartTimeUTC)
-		if err != nil {
-			return &ValidationError{Field: "TradingSchedule.StartTimeUTC", Message: "Invalid time format, should be HH:MM"}
-		}
-
-		_, err = time.Parse("15:04", config.TradingSchedule.StopTimeUTC)
-		if err != nil {
-			return &ValidationError{Field: "TradingSchedule.StopTimeUTC", Message: "Invalid time format, should be HH:MM"}
-		}
+	// A bull call debit spread decays, leaving net theta negative
+	now := time.Now()
+	debit := []risk.LegExposure{
+		{Symbol: "SPY", Strike: 400, Right: "C", Quantity: 1, Greeks: risk.Greeks{Delta: 0.50, Theta: -0.08, UpdatedAt: now}},
+		{Symbol: "SPY", Strike: 405, Right: "C", Quantity: -1, Greeks: risk.Greeks{Delta: 0.40, Theta: -0.05, UpdatedAt: now}},
+	}
+	check, err := app.CheckNewPositionAgainstLimits(debit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !check.Allowed || check.Projected.Theta >= 0 {
+		t.Errorf("Debit spread at theta %.2f: allowed=%v violations=%v, want allowed", check.Projected.Theta, check.Allowed, check.Violations)
 	}
 
-	return nil
+	// Enabling the floor rejects it
+	app.config.PortfolioGreekLimits.UseMinNetTheta = true
+	if check, _ := app.CheckNewPositionAgainstLimits(debit); check.Allowed {
+		t.Error("Debit spread allowed with a theta floor of 0")
+	}
 }
 
-// ValidationError represents a config validation error
-type ValidationError struct {
-	Field   string
-	Message string
-}
+func TestUpdateConfigRejectsInvalidConfig(t *testing.T) {
+	app := NewApp()
+	app.configPath = filepath.Join(t.TempDir(), "config.toml")
 
-func (e *ValidationError) Error() string {
-	return "Validation error in " + e.Field + ": " + e.Message
+	config := validConfig()
+	config.TradeTiming.MinDTE = 120
+	err := app.UpdateConfig(config)
+	if !strings.Contains(err.Error(), "TradeTiming.MinDTE: must not be greater than MaxDTE (120 > 90)") {
+		t.Fatalf("UpdateConfig() error = %v", err)
+	}
+	if app.config.TradeTiming.MinDTE != 0 {
+		t.Error("UpdateConfig() applied an invalid configuration")
+	}
+	if _, statErr := os.Stat(app.configPath); !os.IsNotExist(statErr) {
+		t.Error("UpdateConfig() wrote an invalid configuration")
+	}
 }
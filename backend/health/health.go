@@ -1,29 +1,199 @@
 package health
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
+	"sort"
+	"strconv"
+	"sync"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Health statuses of a dependency and of the whole stack
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded"
+	StatusDown     = "down"
 )
 
+// DefaultTimeout bounds a probe whose dependency sets no timeout
+const DefaultTimeout = 2 * time.Second
+
+// Probe checks one dependency, returning an error when it is not healthy
+type Probe func(ctx context.Context) error
+
+// Dependency is a service the stack needs. A failing critical dependency
+// takes the stack down; any other failure only degrades it.
+type Dependency struct {
+	Name     string
+	Critical bool
+	Timeout  time.Duration
+	Probe    Probe
+}
+
+// DependencyStatus is the outcome of probing one dependency
+type DependencyStatus struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	Critical  bool    `json:"critical"`
+	LatencyMs float64 `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+}
+
 // HealthStatus represents the health status response
 type HealthStatus struct {
-	Status    string    `json:"status"`
-	Timestamp time.Time `json:"timestamp"`
-	Version   string    `json:"version"`
+	Status       string             `json:"status"`
+	Timestamp    time.Time          `json:"timestamp"`
+	Version      string             `json:"version"`
+	Dependencies []DependencyStatus `json:"dependencies"`
 }
 
-// Handler returns a simple health check handler function
-func Handler(version string) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		status := HealthStatus{
-			Status:    "ok",
-			Timestamp: time.Now(),
-			Version:   version,
+// Aggregator probes the stack's dependencies concurrently and exports the
+// outcome of each as Prometheus gauges
+type Aggregator struct {
+	version      string
+	dependencies func() []Dependency
+
+	up      *prometheus.GaugeVec
+	latency *prometheus.GaugeVec
+
+	mu sync.Mutex
+	// exported are the dependencies with gauges, removed when they are no
+	// longer configured
+	exported map[string]bool
+}
+
+// NewAggregator returns an aggregator probing the dependencies returned by
+// dependencies on each check, so they follow configuration changes. The
+// gauges are registered with registerer unless it is nil.
+func NewAggregator(version string, dependencies func() []Dependency, registerer prometheus.Registerer) *Aggregator {
+	a := &Aggregator{
+		version:      version,
+		dependencies: dependencies,
+		up: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "traderadmin_dependency_up",
+			Help: "Whether the dependency passed its last health probe (1) or not (0).",
+		}, []string{"dependency", "critical"}),
+		latency: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "traderadmin_dependency_latency_seconds",
+			Help: "Duration of the dependency's last health probe.",
+		}, []string{"dependency"}),
+		exported: make(map[string]bool),
+	}
+	if registerer != nil {
+		registerer.MustRegister(a.up, a.latency)
+	}
+	return a
+}
+
+// Check probes every dependency, each within its own timeout, and returns
+// their statuses in name order with the overall status
+func (a *Aggregator) Check(ctx context.Context) HealthStatus {
+	dependencies := a.dependencies()
+	statuses := make([]DependencyStatus, len(dependencies))
+
+	var wg sync.WaitGroup
+	for i, dependency := range dependencies {
+		wg.Add(1)
+		go func(i int, dependency Dependency) {
+			defer wg.Done()
+			statuses[i] = probe(ctx, dependency)
+		}(i, dependency)
+	}
+	wg.Wait()
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	a.export(statuses)
+	return HealthStatus{
+		Status:       Overall(statuses),
+		Timestamp:    time.Now(),
+		Version:      a.version,
+		Dependencies: statuses,
+	}
+}
+
+// probe runs one dependency's probe within its timeout
+func probe(ctx context.Context, dependency Dependency) DependencyStatus {
+	timeout := dependency.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := dependency.Probe(ctx)
+	status := DependencyStatus{
+		Name:      dependency.Name,
+		Status:    StatusOK,
+		Critical:  dependency.Critical,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		status.Status = StatusDown
+		status.Error = err.Error()
+	}
+	return status
+}
+
+// Overall returns down when a critical dependency is down, degraded when
+// any other dependency is, and ok otherwise
+func Overall(statuses []DependencyStatus) string {
+	overall := StatusOK
+	for _, status := range statuses {
+		if status.Status == StatusOK {
+			continue
+		}
+		if status.Critical {
+			return StatusDown
 		}
+		overall = StatusDegraded
+	}
+	return overall
+}
 
+// export sets the gauges of the probed dependencies and deletes those of
+// dependencies no longer configured
+func (a *Aggregator) export(statuses []DependencyStatus) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	probed := make(map[string]bool, len(statuses))
+	for _, status := range statuses {
+		probed[status.Name] = true
+		// Criticality may have changed since the last check
+		a.up.DeletePartialMatch(prometheus.Labels{"dependency": status.Name})
+		up := 0.0
+		if status.Status == StatusOK {
+			up = 1
+		}
+		a.up.WithLabelValues(status.Name, strconv.FormatBool(status.Critical)).Set(up)
+		a.latency.WithLabelValues(status.Name).Set(status.LatencyMs / 1000)
+	}
+	for name := range a.exported {
+		if !probed[name] {
+			a.up.DeletePartialMatch(prometheus.Labels{"dependency": name})
+			a.latency.DeleteLabelValues(name)
+		}
+	}
+	a.exported = probed
+}
+
+// Handler returns a health check handler serving the aggregated status. It
+// responds 503 Service Unavailable when the stack is down.
+func Handler(aggregator *Aggregator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := aggregator.Check(r.Context())
+
+		code := http.StatusOK
+		if status.Status == StatusDown {
+			code = http.StatusServiceUnavailable
+		}
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
+		w.WriteHeader(code)
 		json.NewEncoder(w).Encode(status)
 	}
 }
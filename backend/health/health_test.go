@@ -0,0 +1,257 @@
+package health
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// fakeScanner serves the gRPC health service, returning the health server
+// to change its status
+func fakeScanner(t *testing.T) (string, *grpchealth.Server) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	status := grpchealth.NewServer()
+	healthpb.RegisterHealthServer(server, status)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	return listener.Addr().String(), status
+}
+
+// fakeGateway answers the IBKR API handshake with reply
+func fakeGateway(t *testing.T, reply string) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				prefix := make([]byte, 4)
+				var size uint32
+				if _, err := io.ReadFull(conn, prefix); err != nil || string(prefix) != "API\x00" {
+					return
+				}
+				if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+					return
+				}
+				if _, err := io.CopyN(io.Discard, conn, int64(size)); err != nil {
+					return
+				}
+				binary.Write(conn, binary.BigEndian, uint32(len(reply)))
+				io.WriteString(conn, reply)
+			}(conn)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// fakeDeployment returns a Kubernetes client with the deployment's Available
+// condition set to available
+func fakeDeployment(available corev1.ConditionStatus) func() (kubernetes.Interface, error) {
+	clientset := fake.NewSimpleClientset(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "orchestrator", Namespace: "traderadmin"},
+		Status: appsv1.DeploymentStatus{
+			Conditions: []appsv1.DeploymentCondition{{Type: appsv1.DeploymentAvailable, Status: available, Message: "Deployment does not have minimum availability."}},
+		},
+	})
+	return func() (kubernetes.Interface, error) { return clientset, nil }
+}
+
+func TestOverall(t *testing.T) {
+	ok := func(name string, critical bool) DependencyStatus {
+		return DependencyStatus{Name: name, Status: StatusOK, Critical: critical}
+	}
+	down := func(name string, critical bool) DependencyStatus {
+		return DependencyStatus{Name: name, Status: StatusDown, Critical: critical}
+	}
+
+	tests := []struct {
+		name     string
+		statuses []DependencyStatus
+		want     string
+	}{
+		{"no dependencies", nil, StatusOK},
+		{"all ok", []DependencyStatus{ok("ibkr", true), ok("scanner", false)}, StatusOK},
+		{"optional down", []DependencyStatus{ok("ibkr", true), down("scanner", false)}, StatusDegraded},
+		{"critical down", []DependencyStatus{down("ibkr", true), ok("scanner", false)}, StatusDown},
+		{"critical after optional", []DependencyStatus{down("scanner", false), down("ibkr", true)}, StatusDown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Overall(tt.statuses); got != tt.want {
+				t.Errorf("Overall() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAggregatorProbesFakeDependencies(t *testing.T) {
+	scanner, scannerStatus := fakeScanner(t)
+	orchestrator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer orchestrator.Close()
+	gateway := fakeGateway(t, "176\x0020251016 09:30:00 EST\x00")
+	deployment := fakeDeployment(corev1.ConditionTrue)
+
+	dependencies := []Dependency{
+		{Name: "scanner", Probe: GRPCProbe(scanner, "")},
+		{Name: "orchestrator", Critical: true, Probe: HTTPProbe(nil, orchestrator.URL+"/health")},
+		{Name: "ibkr", Critical: true, Probe: IBKRProbe(gateway)},
+		{Name: "kubernetes", Probe: DeploymentProbe(deployment, "traderadmin", "orchestrator")},
+	}
+	aggregator := NewAggregator("1.0.0", func() []Dependency { return dependencies }, nil)
+
+	status := aggregator.Check(context.Background())
+	if status.Status != StatusOK || status.Version != "1.0.0" || len(status.Dependencies) != 4 {
+		t.Fatalf("Check() = %+v, want all ok", status)
+	}
+	for _, dependency := range status.Dependencies {
+		if dependency.Status != StatusOK {
+			t.Errorf("%s = %+v, want ok", dependency.Name, dependency)
+		}
+	}
+
+	// The scanner is not critical
+	scannerStatus.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	if status := aggregator.Check(context.Background()); status.Status != StatusDegraded {
+		t.Errorf("Status with the scanner not serving = %q, want degraded", status.Status)
+	}
+
+	// The gateway is
+	dependencies[2].Probe = IBKRProbe(fakeGateway(t, "HTTP/1.1 400 Bad Request\r\n"))
+	status = aggregator.Check(context.Background())
+	if status.Status != StatusDown {
+		t.Errorf("Status with the gateway failing the handshake = %q, want down", status.Status)
+	}
+	if ibkr := status.Dependencies[0]; ibkr.Name != "ibkr" || ibkr.Status != StatusDown || ibkr.Error == "" {
+		t.Errorf("ibkr = %+v, want down with the handshake error", ibkr)
+	}
+}
+
+func TestAggregatorTimesOutEachDependency(t *testing.T) {
+	slow := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	aggregator := NewAggregator("", func() []Dependency {
+		return []Dependency{
+			{Name: "slow", Timeout: 20 * time.Millisecond, Probe: slow},
+			{Name: "fast", Critical: true, Timeout: time.Second, Probe: func(context.Context) error { return nil }},
+		}
+	}, nil)
+
+	start := time.Now()
+	status := aggregator.Check(context.Background())
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Check() took %v, want the slow dependency's timeout", elapsed)
+	}
+	if status.Status != StatusDegraded {
+		t.Errorf("Status = %q, want degraded", status.Status)
+	}
+	if s := status.Dependencies[1]; s.Name != "slow" || s.Error != context.DeadlineExceeded.Error() {
+		t.Errorf("slow = %+v, want a deadline error", s)
+	}
+}
+
+func TestDeploymentProbe(t *testing.T) {
+	if err := DeploymentProbe(fakeDeployment(corev1.ConditionFalse), "traderadmin", "orchestrator")(context.Background()); err == nil {
+		t.Error("Expected an unavailable deployment to fail")
+	}
+	if err := DeploymentProbe(fakeDeployment(corev1.ConditionTrue), "traderadmin", "scanner")(context.Background()); err == nil {
+		t.Error("Expected a missing deployment to fail")
+	}
+	unavailable := func() (kubernetes.Interface, error) { return nil, errors.New("kubernetes unavailable") }
+	if err := DeploymentProbe(unavailable, "traderadmin", "orchestrator")(context.Background()); err == nil {
+		t.Error("Expected a disconnected client to fail")
+	}
+}
+
+func TestAggregatorGauges(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	dependencies := []Dependency{
+		{Name: "ibkr", Critical: true, Probe: func(context.Context) error { return nil }},
+		{Name: "scanner", Probe: func(context.Context) error { return errors.New("connection refused") }},
+	}
+	aggregator := NewAggregator("", func() []Dependency { return dependencies }, registry)
+	aggregator.Check(context.Background())
+
+	if up := testutil.ToFloat64(aggregator.up.WithLabelValues("ibkr", "true")); up != 1 {
+		t.Errorf("ibkr up = %v, want 1", up)
+	}
+	if up := testutil.ToFloat64(aggregator.up.WithLabelValues("scanner", "false")); up != 0 {
+		t.Errorf("scanner up = %v, want 0", up)
+	}
+
+	// Removed dependencies lose their gauges
+	dependencies = dependencies[:1]
+	aggregator.Check(context.Background())
+	if n := testutil.CollectAndCount(registry, "traderadmin_dependency_up"); n != 1 {
+		t.Errorf("Dependency up series = %d, want 1", n)
+	}
+	if n := testutil.CollectAndCount(registry, "traderadmin_dependency_latency_seconds"); n != 1 {
+		t.Errorf("Dependency latency series = %d, want 1", n)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		critical bool
+		wantCode int
+		want     string
+	}{
+		{"optional dependency down", false, http.StatusOK, StatusDegraded},
+		{"critical dependency down", true, http.StatusServiceUnavailable, StatusDown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aggregator := NewAggregator("1.0.0", func() []Dependency {
+				return []Dependency{{Name: "orchestrator", Critical: tt.critical, Probe: HTTPProbe(nil, "http://127.0.0.1:1/health")}}
+			}, nil)
+			recorder := httptest.NewRecorder()
+			Handler(aggregator)(recorder, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+			if recorder.Code != tt.wantCode {
+				t.Errorf("Code = %d, want %d", recorder.Code, tt.wantCode)
+			}
+			var status HealthStatus
+			if err := json.NewDecoder(recorder.Body).Decode(&status); err != nil {
+				t.Fatal(err)
+			}
+			if status.Status != tt.want || len(status.Dependencies) != 1 || status.Dependencies[0].Error == "" {
+				t.Errorf("Body = %+v, want %s with the dependency's error", status, tt.want)
+			}
+		})
+	}
+}
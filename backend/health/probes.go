@@ -0,0 +1,145 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// IBKR API versions offered in the handshake, those of TWS 10.19 onwards
+const (
+	ibkrMinVersion = 100
+	ibkrMaxVersion = 176
+)
+
+// GRPCProbe asks the gRPC health service at address whether service, or the
+// whole server when service is "", is serving
+func GRPCProbe(address, service string) Probe {
+	return func(ctx context.Context) error {
+		conn, err := grpc.DialContext(ctx, address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return fmt.Errorf("failed to dial %s: %w", address, err)
+		}
+		defer conn.Close()
+
+		resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			return fmt.Errorf("health check failed: %w", err)
+		}
+		if resp.Status != healthpb.HealthCheckResponse_SERVING {
+			return fmt.Errorf("status %s", resp.Status)
+		}
+		return nil
+	}
+}
+
+// HTTPProbe expects a 2xx response to a GET of url
+func HTTPProbe(client *http.Client, url string) Probe {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		io.Copy(io.Discard, resp.Body)
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("%s returned %s", url, resp.Status)
+		}
+		return nil
+	}
+}
+
+// IBKRProbe connects to TWS or IB Gateway at address and completes the API
+// handshake without starting an API session, so that a port answered by
+// something other than the API is reported down
+func IBKRProbe(address string) Probe {
+	return func(ctx context.Context) error {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+		}
+
+		versions := fmt.Sprintf("v%d..%d", ibkrMinVersion, ibkrMaxVersion)
+		var hello bytes.Buffer
+		hello.WriteString("API\x00")
+		binary.Write(&hello, binary.BigEndian, uint32(len(versions)))
+		hello.WriteString(versions)
+		if _, err := conn.Write(hello.Bytes()); err != nil {
+			return fmt.Errorf("API handshake: %w", err)
+		}
+
+		var size uint32
+		if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+			return fmt.Errorf("API handshake: %w", err)
+		}
+		if size == 0 || size > 1024 {
+			return fmt.Errorf("API handshake: unexpected reply of %d bytes", size)
+		}
+		reply := make([]byte, size)
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return fmt.Errorf("API handshake: %w", err)
+		}
+
+		// The reply is the server version and connection time
+		field, _, _ := bytes.Cut(reply, []byte{0})
+		version, err := strconv.Atoi(string(field))
+		if err != nil || version < ibkrMinVersion {
+			return fmt.Errorf("API handshake: unexpected server version %q", field)
+		}
+		return nil
+	}
+}
+
+// DeploymentProbe expects the Kubernetes deployment to be available. client
+// returns the current client, or an error when Kubernetes is not connected.
+func DeploymentProbe(client func() (kubernetes.Interface, error), namespace, name string) Probe {
+	return func(ctx context.Context) error {
+		clientset, err := client()
+		if err != nil {
+			return err
+		}
+		deployment, err := clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		for _, condition := range deployment.Status.Conditions {
+			if condition.Type == appsv1.DeploymentAvailable {
+				if condition.Status != corev1.ConditionTrue {
+					return fmt.Errorf("deployment unavailable: %s", condition.Message)
+				}
+				return nil
+			}
+		}
+		if deployment.Status.AvailableReplicas == 0 {
+			return errors.New("deployment has no available replicas")
+		}
+		return nil
+	}
+}
@@ -0,0 +1,201 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Snapshot is a point-in-time record of portfolio value
+type Snapshot struct {
+	Timestamp     time.Time `json:"timestamp"`
+	Equity        float64   `json:"equity"`
+	RealizedPNL   float64   `json:"realizedPnl"`
+	UnrealizedPNL float64   `json:"unrealizedPnl"`
+	OpenPositions int       `json:"openPositions"`
+}
+
+// EquityStore persists portfolio snapshots to an append-only JSONL file
+type EquityStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewEquityStore creates a store backed by equity_history.jsonl in the given directory
+func NewEquityStore(dir string) (*EquityStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+	return &EquityStore{path: filepath.Join(dir, "equity_history.jsonl")}, nil
+}
+
+// Record appends a snapshot to the history file
+func (s *EquityStore) Record(snapshot Snapshot) error {
+	line, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return file.Sync()
+}
+
+// Query returns the snapshots between from and to (inclusive), downsampled to the
+// given resolution by keeping the last snapshot of each bucket. Supported
+// resolutions are "raw" (or empty), any Go duration such as "5m" or "1h", and "1d".
+func (s *EquityStore) Query(from, to time.Time, resolution string) ([]Snapshot, error) {
+	bucket, err := ParseResolution(resolution)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	snapshots, err := s.readAll()
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []Snapshot
+	for _, snapshot := range snapshots {
+		if snapshot.Timestamp.Before(from) || snapshot.Timestamp.After(to) {
+			continue
+		}
+		selected = append(selected, snapshot)
+	}
+
+	return Downsample(selected, bucket), nil
+}
+
+// Compact reduces snapshots older than the retention window to one snapshot per
+// day (the last of each day) and rewrites the history file atomically
+func (s *EquityStore) Compact(retention time.Duration, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshots, err := s.readAll()
+	if err != nil {
+		return err
+	}
+
+	cutoff := now.Add(-retention)
+	var old, recent []Snapshot
+	for _, snapshot := range snapshots {
+		if snapshot.Timestamp.Before(cutoff) {
+			old = append(old, snapshot)
+		} else {
+			recent = append(recent, snapshot)
+		}
+	}
+
+	compacted := append(Downsample(old, 24*time.Hour), recent...)
+	if len(compacted) == len(snapshots) {
+		return nil
+	}
+
+	tmpPath := s.path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create compacted history: %w", err)
+	}
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, snapshot := range compacted {
+		if err := encoder.Encode(snapshot); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to encode snapshot: %w", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write compacted history: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to sync compacted history: %w", err)
+	}
+	file.Close()
+
+	return os.Rename(tmpPath, s.path)
+}
+
+// readAll reads every snapshot from disk sorted by timestamp; callers must hold the lock
+func (s *EquityStore) readAll() ([]Snapshot, error) {
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer file.Close()
+
+	var snapshots []Snapshot
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var snapshot Snapshot
+		if err := json.Unmarshal(scanner.Bytes(), &snapshot); err != nil {
+			// Skip a torn trailing line from an interrupted write
+			continue
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history file: %w", err)
+	}
+
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].Timestamp.Before(snapshots[j].Timestamp)
+	})
+	return snapshots, nil
+}
+
+// Downsample keeps the last snapshot of each bucket of the given size. Snapshots
+// must be sorted by timestamp; a zero bucket returns the input unchanged.
+func Downsample(snapshots []Snapshot, bucket time.Duration) []Snapshot {
+	if bucket <= 0 || len(snapshots) == 0 {
+		return snapshots
+	}
+
+	result := make([]Snapshot, 0, len(snapshots))
+	for i, snapshot := range snapshots {
+		isLast := i == len(snapshots)-1
+		if isLast || !snapshots[i+1].Timestamp.UTC().Truncate(bucket).Equal(snapshot.Timestamp.UTC().Truncate(bucket)) {
+			result = append(result, snapshot)
+		}
+	}
+	return result
+}
+
+// ParseResolution converts a resolution string into a bucket size
+func ParseResolution(resolution string) (time.Duration, error) {
+	switch resolution {
+	case "", "raw":
+		return 0, nil
+	case "1d":
+		return 24 * time.Hour, nil
+	}
+
+	bucket, err := time.ParseDuration(resolution)
+	if err != nil || bucket < 0 {
+		return 0, fmt.Errorf("unsupported resolution %q", resolution)
+	}
+	return bucket, nil
+}
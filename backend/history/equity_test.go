@@ -0,0 +1,92 @@
+package history
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEquityStoreRecordAndDownsample(t *testing.T) {
+	store, err := NewEquityStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	start := time.Date(2024, 3, 1, 14, 0, 0, 0, time.UTC)
+	for i := 0; i < 12; i++ {
+		snapshot := Snapshot{Timestamp: start.Add(time.Duration(i) * 10 * time.Minute), Equity: 100000 + float64(i)}
+		if err := store.Record(snapshot); err != nil {
+			t.Fatalf("Failed to record snapshot: %v", err)
+		}
+	}
+
+	raw, err := store.Query(start, start.Add(24*time.Hour), "raw")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(raw) != 12 {
+		t.Fatalf("Raw snapshot count: got %d, want 12", len(raw))
+	}
+
+	hourly, err := store.Query(start, start.Add(24*time.Hour), "1h")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(hourly) != 2 {
+		t.Fatalf("Hourly snapshot count: got %d, want 2", len(hourly))
+	}
+	// The last snapshot of each hour represents the bucket
+	if hourly[0].Equity != 100005 || hourly[1].Equity != 100011 {
+		t.Errorf("Unexpected hourly equity values: %v, %v", hourly[0].Equity, hourly[1].Equity)
+	}
+
+	window, err := store.Query(start.Add(30*time.Minute), start.Add(50*time.Minute), "raw")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(window) != 3 {
+		t.Errorf("Windowed snapshot count: got %d, want 3", len(window))
+	}
+
+	if _, err := store.Query(start, start, "fortnightly"); err == nil {
+		t.Errorf("Expected error for unsupported resolution")
+	}
+}
+
+func TestEquityStoreCompact(t *testing.T) {
+	store, err := NewEquityStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	// Three old days with four snapshots each, plus four recent snapshots
+	for day := 0; day < 3; day++ {
+		for i := 0; i < 4; i++ {
+			ts := time.Date(2024, 2, 1+day, 14+i, 0, 0, 0, time.UTC)
+			if err := store.Record(Snapshot{Timestamp: ts, Equity: float64(day*10 + i)}); err != nil {
+				t.Fatalf("Failed to record snapshot: %v", err)
+			}
+		}
+	}
+	for i := 0; i < 4; i++ {
+		if err := store.Record(Snapshot{Timestamp: now.Add(-time.Duration(i) * time.Hour), Equity: 500}); err != nil {
+			t.Fatalf("Failed to record snapshot: %v", err)
+		}
+	}
+
+	if err := store.Compact(7*24*time.Hour, now); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+
+	all, err := store.Query(time.Time{}, now, "raw")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(all) != 7 {
+		t.Fatalf("Snapshot count after compaction: got %d, want 7", len(all))
+	}
+	// Old days keep their final snapshot
+	if all[0].Equity != 3 || all[1].Equity != 13 || all[2].Equity != 23 {
+		t.Errorf("Unexpected compacted values: %v %v %v", all[0].Equity, all[1].Equity, all[2].Equity)
+	}
+}
@@ -0,0 +1,178 @@
+package ibkr
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Position is a position of an account as TWS reports it. Options have an
+// expiry, strike and right; Quantity is negative for a short position.
+type Position struct {
+	Account    string  `json:"account"`
+	ConID      int64   `json:"conId"`
+	Symbol     string  `json:"symbol"`
+	SecType    string  `json:"secType"`
+	Expiry     string  `json:"expiry,omitempty"` // YYYYMMDD
+	Strike     float64 `json:"strike,omitempty"`
+	Right      string  `json:"right,omitempty"` // "C" or "P"
+	Multiplier float64 `json:"multiplier,omitempty"`
+	Quantity   float64 `json:"quantity"`
+	// AvgCost is the average cost of one unit, multiplier included
+	AvgCost float64 `json:"avgCost"`
+}
+
+// AccountSummary holds the values of an account TraderAdmin tracks
+type AccountSummary struct {
+	Account        string  `json:"account"`
+	NetLiquidation float64 `json:"netLiquidation"`
+	BuyingPower    float64 `json:"buyingPower"`
+	// RealizedPnL and UnrealizedPnL are today's, zero when TWS did not
+	// report them in time
+	RealizedPnL   float64 `json:"realizedPnl"`
+	UnrealizedPnL float64 `json:"unrealizedPnl"`
+}
+
+// AccountClient defines the account requests performed over the IBKR trading connection
+type AccountClient interface {
+	// Positions returns the open positions of every account of the login
+	Positions(ctx context.Context) ([]Position, error)
+
+	// AccountSummary returns the values of an account, the login's first
+	// when account is empty
+	AccountSummary(ctx context.Context, account string) (AccountSummary, error)
+}
+
+// Positions returns the open positions of every account the trading
+// connection's login manages
+func (c *Client) Positions(ctx context.Context) ([]Position, error) {
+	s, err := c.session(ConnectionTrading)
+	if err != nil {
+		return nil, err
+	}
+
+	// TWS sends the positions of each request to every one running
+	c.positionsMu.Lock()
+	defer c.positionsMu.Unlock()
+	sub := s.subscribe(nil, msgPosition, msgPositionEnd)
+	defer s.unsubscribe(sub)
+	if err := s.send(msgReqPositions, 1); err != nil {
+		return nil, err
+	}
+	defer s.send(msgCancelPositions, 1)
+
+	var positions []Position
+	for {
+		fields, err := s.next(ctx, sub)
+		if err != nil {
+			return nil, fmt.Errorf("positions: %w", err)
+		}
+		if messageID(fields) == msgPositionEnd {
+			return positions, nil
+		}
+		// Fields are the id, version, account, then the contract id, symbol,
+		// security type, expiry, strike, right, multiplier, exchange,
+		// currency, local symbol and trading class, the position and its
+		// average cost
+		r := newFieldReader(fields, 2)
+		position := Position{Account: r.str(), ConID: r.int64(), Symbol: r.str(), SecType: r.str(), Expiry: r.str(), Strike: r.float()}
+		position.Right = normalizeRight(r.str())
+		position.Multiplier = r.float()
+		r.skip(4)
+		position.Quantity, position.AvgCost = r.float(), r.float()
+		if position.Quantity == 0 {
+			continue
+		}
+		if position.SecType == "OPT" {
+			c.contractsMu.Lock()
+			c.contracts[contractKey{Symbol: position.Symbol, OptionKey: position.option()}] = position.ConID
+			c.contractsMu.Unlock()
+		}
+		positions = append(positions, position)
+	}
+}
+
+// option returns the option of an option position
+func (p Position) option() OptionKey {
+	return OptionKey{Expiry: p.Expiry, Strike: p.Strike, Right: p.Right}
+}
+
+// AccountSummary returns the net liquidation value and buying power of an
+// account, the first the login manages when account is empty, with today's
+// profit and loss
+func (c *Client) AccountSummary(ctx context.Context, account string) (AccountSummary, error) {
+	s, err := c.session(ConnectionTrading)
+	if err != nil {
+		return AccountSummary{}, err
+	}
+	reqID, sub, err := s.request(func(reqID int64) []interface{} {
+		return []interface{}{msgReqAccountSummary, 1, reqID, "All", "NetLiquidation,BuyingPower"}
+	})
+	if err != nil {
+		return AccountSummary{}, err
+	}
+	defer s.unsubscribe(sub)
+	defer s.send(msgCancelAccountSummary, 1, reqID)
+
+	summary := AccountSummary{Account: account}
+	for {
+		fields, err := s.next(ctx, sub)
+		if err != nil {
+			return AccountSummary{}, fmt.Errorf("account summary: %w", err)
+		}
+		if messageID(fields) == msgAccountSummaryEnd {
+			break
+		}
+		// Fields are the id, version, request id, account, tag, value and
+		// currency
+		r := newFieldReader(fields, 3)
+		name, tag, value := r.str(), r.str(), r.float()
+		if summary.Account == "" {
+			summary.Account = name
+		}
+		if !strings.EqualFold(name, summary.Account) {
+			continue
+		}
+		switch tag {
+		case "NetLiquidation":
+			summary.NetLiquidation = value
+		case "BuyingPower":
+			summary.BuyingPower = value
+		}
+	}
+	if summary.Account == "" {
+		return AccountSummary{}, fmt.Errorf("account summary: no account")
+	}
+
+	summary.RealizedPnL, summary.UnrealizedPnL = c.dailyPnL(ctx, s, summary.Account)
+	return summary, nil
+}
+
+// dailyPnL returns the realized and unrealized profit and loss of today,
+// zero when TWS does not report them within quoteTimeout
+func (c *Client) dailyPnL(ctx context.Context, s *session, account string) (realized, unrealized float64) {
+	reqID, sub, err := s.request(func(reqID int64) []interface{} {
+		return []interface{}{msgReqPnL, reqID, account, ""}
+	})
+	if err != nil {
+		return 0, 0
+	}
+	defer s.unsubscribe(sub)
+	defer s.send(msgCancelPnL, reqID)
+
+	ctx, cancel := context.WithTimeout(ctx, quoteTimeout)
+	defer cancel()
+	for {
+		fields, err := s.next(ctx, sub)
+		if err != nil {
+			return 0, 0
+		}
+		if messageID(fields) == msgPnL {
+			// Fields are the id, request id, daily, unrealized and realized
+			// profit and loss
+			r := newFieldReader(fields, 3)
+			unrealized, realized = r.float(), r.float()
+			return realized, unrealized
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package ibkr
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OptionParams lists the expirations and strikes of an underlying's options on
+// one exchange, as reported by reqSecDefOptParams
+type OptionParams struct {
+	Exchange    string    `json:"exchange"`
+	Multiplier  string    `json:"multiplier"`
+	Expirations []string  `json:"expirations"` // YYYYMMDD
+	Strikes     []float64 `json:"strikes"`
+}
+
+// OptionKey identifies one option of an underlying
+type OptionKey struct {
+	Expiry string  `json:"expiry"` // YYYYMMDD
+	Strike float64 `json:"strike"`
+	Right  string  `json:"right"` // "C" or "P"
+}
+
+// OptionQuote is a market data snapshot of an option with the model Greeks
+// computed by TWS; prices without a quote are 0
+type OptionQuote struct {
+	OptionKey
+	Bid          float64 `json:"bid"`
+	Ask          float64 `json:"ask"`
+	ImpliedVol   float64 `json:"impliedVol"`
+	Delta        float64 `json:"delta"`
+	Gamma        float64 `json:"gamma"`
+	Theta        float64 `json:"theta"`
+	Vega         float64 `json:"vega"`
+	OpenInterest int     `json:"openInterest"`
+}
+
+// MarketDataClient defines the market data requests performed over the IBKR data connection
+type MarketDataClient interface {
+	// UnderlyingPrice returns the last price of a stock
+	UnderlyingPrice(ctx context.Context, symbol string) (float64, error)
+
+	// OptionParams returns the option chain parameters of a stock on each exchange
+	OptionParams(ctx context.Context, symbol string) ([]OptionParams, error)
+
+	// OptionSnapshots requests snapshot market data for the options; each one
+	// holds a market data line until its snapshot completes
+	OptionSnapshots(ctx context.Context, symbol string, options []OptionKey) ([]OptionQuote, error)
+}
+
+// OptionContract is one option of a chain with its quote and Greeks
+type OptionContract struct {
+	OptionQuote
+	Symbol string  `json:"symbol"`
+	DTE    int     `json:"dte"`
+	Mid    float64 `json:"mid"`
+	// BidAskSpreadPct is the bid-ask spread as a percentage of the mid price,
+	// 100 without a two-sided quote
+	BidAskSpreadPct float64 `json:"bidAskSpreadPct"`
+}
+
+// OptionChain is the options of an underlying within a strike band and DTE
+// range. Truncated is set when the range held more options than were fetched;
+// the options nearest the money are kept.
+type OptionChain struct {
+	Symbol          string           `json:"symbol"`
+	UnderlyingPrice float64          `json:"underlyingPrice"`
+	Contracts       []OptionContract `json:"contracts"`
+	Truncated       bool             `json:"truncated"`
+	FetchedAt       time.Time        `json:"fetchedAt"`
+}
+
+// ChainRequest selects the options FetchOptionChain fetches
+type ChainRequest struct {
+	Symbol string
+	// StrikeBandPct keeps strikes within this percentage of the underlying price
+	StrikeBandPct float64
+	MinDTE        int
+	MaxDTE        int
+	// Lines is the number of market data lines used at once
+	Lines int
+	// MaxContracts caps the options fetched; 0 fetches all
+	MaxContracts int
+	Now          time.Time
+}
+
+// FetchOptionChain fetches the calls and puts of the requested strikes and
+// expirations, requesting snapshots in batches of at most req.Lines so that
+// the account's market data line limit is not exceeded
+func FetchOptionChain(ctx context.Context, client MarketDataClient, req ChainRequest) (OptionChain, error) {
+	symbol := strings.ToUpper(strings.TrimSpace(req.Symbol))
+	if symbol == "" {
+		return OptionChain{}, fmt.Errorf("symbol is required")
+	}
+	if req.Lines <= 0 {
+		return OptionChain{}, fmt.Errorf("at least one market data line is required")
+	}
+
+	price, err := client.UnderlyingPrice(ctx, symbol)
+	if err != nil {
+		return OptionChain{}, fmt.Errorf("failed to get %s price: %w", symbol, err)
+	}
+	if price <= 0 {
+		return OptionChain{}, fmt.Errorf("no price for %s", symbol)
+	}
+
+	params, err := client.OptionParams(ctx, symbol)
+	if err != nil {
+		return OptionChain{}, fmt.Errorf("failed to get %s option parameters: %w", symbol, err)
+	}
+
+	chain := OptionChain{Symbol: symbol, UnderlyingPrice: price, FetchedAt: req.Now}
+	keys := selectOptions(chainParams(params), price, req)
+	if req.MaxContracts > 0 && len(keys) > req.MaxContracts {
+		keys = keys[:req.MaxContracts]
+		chain.Truncated = true
+	}
+
+	for start := 0; start < len(keys); start += req.Lines {
+		end := start + req.Lines
+		if end > len(keys) {
+			end = len(keys)
+		}
+		quotes, err := client.OptionSnapshots(ctx, symbol, keys[start:end])
+		if err != nil {
+			return OptionChain{}, fmt.Errorf("failed to get %s option quotes: %w", symbol, err)
+		}
+		for _, quote := range quotes {
+			chain.Contracts = append(chain.Contracts, newOptionContract(symbol, quote, req.Now))
+		}
+	}
+
+	sort.Slice(chain.Contracts, func(i, j int) bool {
+		a, b := chain.Contracts[i], chain.Contracts[j]
+		if a.Expiry != b.Expiry {
+			return a.Expiry < b.Expiry
+		}
+		if a.Strike != b.Strike {
+			return a.Strike < b.Strike
+		}
+		return a.Right < b.Right
+	})
+	return chain, nil
+}
+
+// chainParams returns the SMART routed parameters, or the union of all
+// exchanges when SMART is not listed
+func chainParams(params []OptionParams) OptionParams {
+	for _, p := range params {
+		if p.Exchange == "SMART" {
+			return p
+		}
+	}
+
+	var union OptionParams
+	expirations := make(map[string]bool)
+	strikes := make(map[float64]bool)
+	for _, p := range params {
+		for _, expiry := range p.Expirations {
+			if !expirations[expiry] {
+				expirations[expiry] = true
+				union.Expirations = append(union.Expirations, expiry)
+			}
+		}
+		for _, strike := range p.Strikes {
+			if !strikes[strike] {
+				strikes[strike] = true
+				union.Strikes = append(union.Strikes, strike)
+			}
+		}
+	}
+	return union
+}
+
+// selectOptions returns the calls and puts within the strike band and DTE
+// range, nearest the money first and then by expiry
+func selectOptions(params OptionParams, price float64, req ChainRequest) []OptionKey {
+	band := price * req.StrikeBandPct / 100
+	var strikes []float64
+	for _, strike := range params.Strikes {
+		if math.Abs(strike-price) <= band {
+			strikes = append(strikes, strike)
+		}
+	}
+
+	var expirations []string
+	for _, expiry := range params.Expirations {
+		dte, err := daysToExpiry(expiry, req.Now)
+		if err == nil && dte >= req.MinDTE && dte <= req.MaxDTE {
+			expirations = append(expirations, expiry)
+		}
+	}
+	sort.Strings(expirations)
+
+	sort.SliceStable(strikes, func(i, j int) bool {
+		return math.Abs(strikes[i]-price) < math.Abs(strikes[j]-price)
+	})
+
+	keys := make([]OptionKey, 0, 2*len(strikes)*len(expirations))
+	for _, strike := range strikes {
+		for _, expiry := range expirations {
+			keys = append(keys,
+				OptionKey{Expiry: expiry, Strike: strike, Right: "C"},
+				OptionKey{Expiry: expiry, Strike: strike, Right: "P"})
+		}
+	}
+	return keys
+}
+
+// newOptionContract maps a quote to a chain contract
+func newOptionContract(symbol string, quote OptionQuote, now time.Time) OptionContract {
+	contract := OptionContract{OptionQuote: quote, Symbol: symbol, BidAskSpreadPct: 100}
+	contract.DTE, _ = daysToExpiry(quote.Expiry, now)
+	if quote.Bid > 0 && quote.Ask >= quote.Bid {
+		contract.Mid = (quote.Bid + quote.Ask) / 2
+		contract.BidAskSpreadPct = (quote.Ask - quote.Bid) / contract.Mid * 100
+	}
+	return contract
+}
+
+// daysToExpiry returns the calendar days from now's date to a YYYYMMDD expiry
+func daysToExpiry(expiry string, now time.Time) (int, error) {
+	date, err := time.Parse("20060102", expiry)
+	if err != nil {
+		return 0, fmt.Errorf("invalid expiry %q: %w", expiry, err)
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	return int(date.Sub(today).Hours() / 24), nil
+}
@@ -0,0 +1,186 @@
+package ibkr
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// fakeMarketData is a scripted IBKR responder quoting every option it is asked
+// for and recording the snapshot batches
+type fakeMarketData struct {
+	price   float64
+	params  []OptionParams
+	quotes  map[OptionKey]OptionQuote
+	batches [][]OptionKey
+	err     error
+}
+
+func (f *fakeMarketData) UnderlyingPrice(ctx context.Context, symbol string) (float64, error) {
+	return f.price, nil
+}
+
+func (f *fakeMarketData) OptionParams(ctx context.Context, symbol string) ([]OptionParams, error) {
+	return f.params, nil
+}
+
+func (f *fakeMarketData) OptionSnapshots(ctx context.Context, symbol string, options []OptionKey) ([]OptionQuote, error) {
+	f.batches = append(f.batches, options)
+	if f.err != nil {
+		return nil, f.err
+	}
+	quotes := make([]OptionQuote, 0, len(options))
+	for _, key := range options {
+		quote, ok := f.quotes[key]
+		if !ok {
+			quote = OptionQuote{OptionKey: key, Bid: 1.00, Ask: 1.10, ImpliedVol: 0.2, OpenInterest: 1000}
+		}
+		quotes = append(quotes, quote)
+	}
+	return quotes, nil
+}
+
+// chainNow is a Wednesday; 20240315 is 9 days out and 20240719 135
+var chainNow = time.Date(2024, 3, 6, 15, 0, 0, 0, time.UTC)
+
+func newFakeMarketData() *fakeMarketData {
+	return &fakeMarketData{
+		price: 100,
+		params: []OptionParams{
+			{Exchange: "CBOE", Expirations: []string{"20240308"}, Strikes: []float64{50}},
+			{
+				Exchange:    "SMART",
+				Expirations: []string{"20240719", "20240315", "20240412"},
+				Strikes:     []float64{80, 84, 90, 95, 100, 105, 110, 115, 116, 120},
+			},
+		},
+		quotes: map[OptionKey]OptionQuote{
+			{Expiry: "20240315", Strike: 95, Right: "P"}: {
+				OptionKey: OptionKey{Expiry: "20240315", Strike: 95, Right: "P"},
+				Bid:       1.90, Ask: 2.10, ImpliedVol: 0.25,
+				Delta: -0.30, Gamma: 0.04, Theta: -0.05, Vega: 0.08, OpenInterest: 2500,
+			},
+			{Expiry: "20240315", Strike: 115, Right: "C"}: {
+				OptionKey: OptionKey{Expiry: "20240315", Strike: 115, Right: "C"},
+				Bid:       0, Ask: 0.05,
+			},
+		},
+	}
+}
+
+func chainRequest() ChainRequest {
+	return ChainRequest{Symbol: "spy", StrikeBandPct: 15, MinDTE: 7, MaxDTE: 60, Lines: 10, Now: chainNow}
+}
+
+func findContract(chain OptionChain, expiry string, strike float64, right string) (OptionContract, bool) {
+	for _, contract := range chain.Contracts {
+		if contract.Expiry == expiry && contract.Strike == strike && contract.Right == right {
+			return contract, true
+		}
+	}
+	return OptionContract{}, false
+}
+
+func TestFetchOptionChainSelectsBandAndDTE(t *testing.T) {
+	client := newFakeMarketData()
+
+	chain, err := FetchOptionChain(context.Background(), client, chainRequest())
+	if err != nil {
+		t.Fatalf("FetchOptionChain() error = %v", err)
+	}
+
+	// Strikes 90-115 within 15% of 100, expirations 9 and 37 days out, calls and puts
+	if chain.Symbol != "SPY" || chain.UnderlyingPrice != 100 || chain.Truncated {
+		t.Errorf("Chain = %s at %v, truncated %v", chain.Symbol, chain.UnderlyingPrice, chain.Truncated)
+	}
+	if len(chain.Contracts) != 6*2*2 {
+		t.Fatalf("Contracts = %d, want 24", len(chain.Contracts))
+	}
+	for _, contract := range chain.Contracts {
+		if contract.Strike < 85 || contract.Strike > 115 {
+			t.Errorf("Strike %v outside the band", contract.Strike)
+		}
+		if contract.Expiry != "20240315" && contract.Expiry != "20240412" {
+			t.Errorf("Expiry %s outside the DTE range", contract.Expiry)
+		}
+	}
+	if first := chain.Contracts[0]; first.Expiry != "20240315" || first.Strike != 90 || first.Right != "C" {
+		t.Errorf("First contract = %+v, want the lowest strike of the nearest expiry", first.OptionKey)
+	}
+
+	put, ok := findContract(chain, "20240315", 95, "P")
+	if !ok {
+		t.Fatal("Missing the 95 put")
+	}
+	if put.DTE != 9 || put.Delta != -0.30 || put.OpenInterest != 2500 || put.Mid != 2.0 {
+		t.Errorf("95 put = %+v", put)
+	}
+	if math.Abs(put.BidAskSpreadPct-10) > 1e-9 {
+		t.Errorf("BidAskSpreadPct = %v, want 10", put.BidAskSpreadPct)
+	}
+
+	// A one-sided quote has no mid
+	call, _ := findContract(chain, "20240315", 115, "C")
+	if call.Mid != 0 || call.BidAskSpreadPct != 100 {
+		t.Errorf("One-sided quote: mid %v, spread %v%%", call.Mid, call.BidAskSpreadPct)
+	}
+}
+
+func TestFetchOptionChainBatchesByMarketDataLines(t *testing.T) {
+	client := newFakeMarketData()
+	req := chainRequest()
+	req.Lines = 5
+
+	chain, err := FetchOptionChain(context.Background(), client, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var requested int
+	for _, batch := range client.batches {
+		if len(batch) > req.Lines {
+			t.Errorf("Batch of %d options exceeds %d lines", len(batch), req.Lines)
+		}
+		requested += len(batch)
+	}
+	if len(client.batches) != 5 || requested != 24 || len(chain.Contracts) != 24 {
+		t.Errorf("Batches = %d, requested = %d, contracts = %d", len(client.batches), requested, len(chain.Contracts))
+	}
+}
+
+func TestFetchOptionChainTruncatesNearestTheMoney(t *testing.T) {
+	client := newFakeMarketData()
+	req := chainRequest()
+	req.MaxContracts = 8
+
+	chain, err := FetchOptionChain(context.Background(), client, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !chain.Truncated || len(chain.Contracts) != 8 {
+		t.Fatalf("Truncated = %v with %d contracts, want 8", chain.Truncated, len(chain.Contracts))
+	}
+
+	// The 100 strike, then 95 and 105
+	for _, contract := range chain.Contracts {
+		if contract.Strike != 100 && contract.Strike != 95 && contract.Strike != 105 {
+			t.Errorf("Kept strike %v, want those nearest 100", contract.Strike)
+		}
+	}
+}
+
+func TestFetchOptionChainErrors(t *testing.T) {
+	client := newFakeMarketData()
+	client.err = errors.New("max number of tickers has been reached")
+	if _, err := FetchOptionChain(context.Background(), client, chainRequest()); err == nil {
+		t.Error("Expected the snapshot error")
+	}
+
+	client = newFakeMarketData()
+	client.price = 0
+	if _, err := FetchOptionChain(context.Background(), client, chainRequest()); err == nil {
+		t.Error("Expected an error without an underlying price")
+	}
+}
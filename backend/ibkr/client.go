@@ -0,0 +1,141 @@
+package ibkr
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// quoteTimeout bounds the wait for the quotes of a market data request;
+// whatever arrived by then is returned
+const quoteTimeout = 5 * time.Second
+
+// Client performs the order, market data and account requests of TraderAdmin
+// over the connections of a ConnectionManager: orders and account requests
+// over the trading connection and market data over the data connection. It
+// follows the manager connections returns, so that it keeps working when
+// the manager is restarted for another account, and fails with
+// ErrNotConnected while the connection a request needs is down.
+type Client struct {
+	connections func() *ConnectionManager
+
+	// contract ids by contract, which do not change
+	contractsMu sync.Mutex
+	contracts   map[contractKey]int64
+
+	// positionsMu lets one positions request run at a time
+	positionsMu sync.Mutex
+}
+
+var (
+	_ OrderClient      = (*Client)(nil)
+	_ MarketDataClient = (*Client)(nil)
+	_ AccountClient    = (*Client)(nil)
+)
+
+// contractKey identifies a stock, with an empty right, or an option
+type contractKey struct {
+	Symbol string
+	OptionKey
+}
+
+// NewClient returns a client of the manager connections returns, nil while
+// there is none
+func NewClient(connections func() *ConnectionManager) *Client {
+	return &Client{connections: connections, contracts: make(map[contractKey]int64)}
+}
+
+// session returns the session of the named connection
+func (c *Client) session(name string) (*session, error) {
+	manager := c.connections()
+	if manager == nil {
+		return nil, fmt.Errorf("%s connection: %w", name, ErrNotConnected)
+	}
+	return manager.session(name)
+}
+
+// request sends a request with a new request id, made by fields from it, and
+// returns the subscription to its messages; the caller unsubscribes
+func (s *session) request(fields func(reqID int64) []interface{}) (int64, *subscription, error) {
+	reqID := s.requestID()
+	sub := s.subscribe([]int64{reqID})
+	if err := s.send(fields(reqID)...); err != nil {
+		s.unsubscribe(sub)
+		return 0, nil, err
+	}
+	return reqID, sub, nil
+}
+
+// contractID returns the contract id of a stock, or of an option of it when
+// key is set, looking it up with reqContractData once
+func (c *Client) contractID(ctx context.Context, s *session, symbol string, key OptionKey) (int64, error) {
+	cacheKey := contractKey{Symbol: symbol, OptionKey: key}
+	c.contractsMu.Lock()
+	conID, ok := c.contracts[cacheKey]
+	c.contractsMu.Unlock()
+	if ok {
+		return conID, nil
+	}
+
+	secType, strike, multiplier := "STK", "0", ""
+	if key.Right != "" {
+		secType, strike, multiplier = "OPT", number(key.Strike, true), "100"
+	}
+	_, sub, err := s.request(func(reqID int64) []interface{} {
+		return []interface{}{msgReqContractData, 8, reqID, 0, symbol, secType, key.Expiry, strike, key.Right, multiplier,
+			"SMART", "", "USD", "", "", 0, "", "", ""}
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer s.unsubscribe(sub)
+
+	// An option may be listed under several trading classes; the one named
+	// after the underlying is the standard one
+	for {
+		fields, err := s.next(ctx, sub)
+		if err != nil {
+			return 0, fmt.Errorf("contract of %s: %w", describeContract(symbol, key), err)
+		}
+		if messageID(fields) == msgContractDataEnd {
+			break
+		}
+		// Fields are the id, request id, symbol, security type, expiry,
+		// strike, right, exchange, currency, local symbol, market name,
+		// trading class and contract id
+		r := newFieldReader(fields, 11)
+		tradingClass, id := r.str(), r.int64()
+		if conID == 0 || tradingClass == symbol {
+			conID = id
+		}
+	}
+	if conID == 0 {
+		return 0, fmt.Errorf("no contract for %s", describeContract(symbol, key))
+	}
+
+	c.contractsMu.Lock()
+	c.contracts[cacheKey] = conID
+	c.contractsMu.Unlock()
+	return conID, nil
+}
+
+// describeContract names a stock or an option of it
+func describeContract(symbol string, key OptionKey) string {
+	if key.Right == "" {
+		return symbol
+	}
+	return fmt.Sprintf("%s %s %g%s", symbol, key.Expiry, key.Strike, key.Right)
+}
+
+// normalizeRight returns the right of an option as C or P
+func normalizeRight(right string) string {
+	switch strings.ToUpper(right) {
+	case "C", "CALL":
+		return "C"
+	case "P", "PUT":
+		return "P"
+	}
+	return right
+}
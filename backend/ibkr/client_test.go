@@ -0,0 +1,351 @@
+package ibkr
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// brokerFake answers the requests of Client for AAPL and its options the
+// way TWS does. Options have the contract id 1000 + strike * 10, plus one
+// for a put; the 999 strike does not exist.
+type brokerFake struct {
+	mu     sync.Mutex
+	orders [][]string
+}
+
+func (b *brokerFake) placed() [][]string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.orders
+}
+
+func optionConID(strike float64, right string) int64 {
+	id := 1000 + int64(strike*10)
+	if right == "P" {
+		id++
+	}
+	return id
+}
+
+func (b *brokerFake) handle(w *wire, fields []string) {
+	reqID := func(i int) string { return fields[i] }
+	switch messageID(fields) {
+	case msgReqContractData:
+		// Fields are the id, version, request id, contract id, symbol,
+		// security type, expiry, strike and right
+		id, symbol, secType, expiry, strike, right := fields[3], fields[4], fields[5], fields[6], parseFloat(fields[7]), fields[8]
+		switch {
+		case id == "100" || (symbol == "AAPL" && secType == "STK"):
+			w.write(msgContractData, reqID(2), "AAPL", "STK", "", 0, "", "SMART", "USD", "AAPL", "NMS", "NMS", 100)
+		case id != "0":
+			conID, _ := strconv.ParseInt(id, 10, 64)
+			strike, right := float64((conID-1000)/10), "C"
+			if conID%2 == 1 {
+				right = "P"
+			}
+			w.write(msgContractData, reqID(2), "AAPL", "OPT", "20250117 16:00 US/Eastern", strike, right, "SMART", "USD", "", "AAPL", "AAPL", conID)
+		case strike != 999:
+			// A weekly class is listed before the standard one
+			w.write(msgContractData, reqID(2), "AAPL", "OPT", expiry, strike, right, "SMART", "USD", "", "AAPL", "2AAPL", 1)
+			w.write(msgContractData, reqID(2), "AAPL", "OPT", expiry, strike, right, "SMART", "USD", "", "AAPL", "AAPL", optionConID(strike, right))
+		}
+		w.write(msgContractDataEnd, 1, reqID(2))
+
+	case msgReqMktData:
+		id, secType, strike, right := reqID(2), fields[5], parseFloat(fields[7]), fields[8]
+		if secType == "STK" {
+			w.write(msgTickPrice, 6, id, tickBid, 189.9, 100, 0)
+			w.write(msgTickPrice, 6, id, tickAsk, 190.1, 100, 0)
+			w.write(msgTickPrice, 6, id, tickClose, 185, 0, 0)
+			w.write(msgTickSnapshotEnd, 1, id)
+			return
+		}
+		if strike == 999 {
+			w.write(msgError, 2, id, codeNoSecurityDefinition, "No security definition has been found for the request")
+			return
+		}
+		w.write(msgError, 2, id, codeDelayedMarketData, "Requested market data is not subscribed. Displaying delayed market data.")
+		w.write(msgTickPrice, 6, id, tickDelayedBid, strike/100, 10, 0)
+		w.write(msgTickPrice, 6, id, tickDelayedAsk, (strike+20)/100, 10, 0)
+		oi := tickCallOI
+		if right == "P" {
+			oi = tickPutOI
+		}
+		w.write(msgTickSize, 6, id, oi, 1500)
+		w.write(msgTickOptionComputation, id, tickDelayedModelOpt, 0, 0.31, 0.45, 1.9, 0, 0.02, 0.11, -0.05, 190)
+
+	case msgReqSecDefOptParams:
+		id := fields[1]
+		w.write(msgSecDefOptParams, id, "SMART", 100, "2AAPL", 100, 1, "20250110", 1, 190)
+		w.write(msgSecDefOptParams, id, "SMART", 100, "AAPL", 100, 2, "20250221", "20250117", 3, 195, 185, 190)
+		w.write(msgSecDefOptParamsEnd, id)
+
+	case msgPlaceOrder:
+		b.mu.Lock()
+		b.orders = append(b.orders, fields)
+		b.mu.Unlock()
+		orderID := fields[1]
+		legs, _ := strconv.Atoi(fields[35])
+		if fields[88+8*legs] == "1" {
+			w.write(openOrderMessage(orderID, "AAPL", "U1", "PreSubmitted", true, 1870, 2130)...)
+			return
+		}
+		if fields[19] == "9.99" {
+			w.write(msgError, 2, orderID, codeOrderRejected, "Order rejected - reason: margin")
+			return
+		}
+		w.write(msgOrderStatus, orderID, OrderPreSubmitted, 0, 2, 0, 1, 0, 0, 1, "", 0)
+		w.write(msgOrderStatus, orderID, OrderSubmitted, 0, 2, 0, 1, 0, 0, 1, "", 0)
+		w.write(msgOrderStatus, orderID, OrderSubmitted, 0, 2, 0, 1, 0, 0, 1, "", 0)
+		w.write(msgOrderStatus, orderID, OrderFilled, 2, 0, 1.52, 1, 0, 1.52, 1, "", 0)
+
+	case msgReqAllOpenOrders:
+		w.write(openOrderMessage("7", "AAPL", "U1", OrderSubmitted, false, 0, 0)...)
+		w.write(msgOrderStatus, 7, OrderSubmitted, 1, 1, 1.5, 1, 0, 1.5, 1, "", 0)
+		w.write(openOrderMessage("8", "AAPL", "U1", OrderFilled, false, 0, 0)...)
+		w.write(msgOpenOrderEnd, 1)
+
+	case msgReqPositions:
+		w.write(msgPosition, 3, "U1", 100, "AAPL", "STK", "", 0, "", "", "NASDAQ", "USD", "AAPL", "NMS", 50, 180.5)
+		w.write(msgPosition, 3, "U1", optionConID(190, "C"), "AAPL", "OPT", "20250117", 190, "CALL", 100, "", "USD", "", "AAPL", -2, 310)
+		w.write(msgPosition, 3, "U2", 200, "MSFT", "STK", "", 0, "", "", "NASDAQ", "USD", "MSFT", "NMS", 0, 0)
+		w.write(msgPositionEnd, 1)
+
+	case msgReqAccountSummary:
+		id := reqID(2)
+		w.write(msgAccountSummary, 1, id, "U1", "NetLiquidation", "100000.50", "USD")
+		w.write(msgAccountSummary, 1, id, "U2", "NetLiquidation", "5000", "USD")
+		w.write(msgAccountSummary, 1, id, "U1", "BuyingPower", "250000", "USD")
+		w.write(msgAccountSummaryEnd, 1, id)
+
+	case msgReqPnL:
+		w.write(msgPnL, fields[1], 90, 120.5, -30.5)
+	}
+}
+
+// openOrderMessage returns an openOrder message of a two-legged AAPL combo
+// as TWS 176 sends it, with the margin change and commission of a what-if
+// order
+func openOrderMessage(orderID, symbol, account, status string, whatIf bool, initMargin, equity float64) []interface{} {
+	fields := []interface{}{msgOpenOrder, orderID,
+		28812380, symbol, "BAG", "", 0, "?", "", "SMART", "USD", "", "COMB",
+		"BUY", 2, "LMT", 1.5, 0, "DAY", "", account,
+	}
+	for i := 0; i < 39; i++ {
+		fields = append(fields, "")
+	}
+	fields = append(fields,
+		// Volatility, trailing stop and basis points
+		"", 0, "", "", 0, 0, "", "", "", "",
+		// Two combo legs, no prices, one smart combo routing parameter
+		"", 2,
+		optionConID(190, "C"), 1, "BUY", "SMART", 0, 0, "", -1,
+		optionConID(195, "C"), 1, "SELL", "SMART", 0, 0, "", -1,
+		0, 1, "NonGuaranteed", "1",
+		// Scale fields, a hedge, clearing and not held, delta neutral, an
+		// algo with a parameter, solicited
+		"", "", "", "D", "0.5", 0, "", "", 0, 0, "Adaptive", 1, "adaptivePriority", "Normal", 0,
+		flag(whatIf), status,
+		"", "", equity, initMargin, 1650, "", "", "", "",
+		2.6, "", "", "USD", "",
+		// Fields after the order state
+		0, 0, "",
+	)
+	return fields
+}
+
+// startClient returns a client of a manager connected to a fake TWS
+// answering like brokerFake
+func startClient(t *testing.T) (*Client, *brokerFake) {
+	t.Helper()
+	broker := &brokerFake{}
+	f := startFakeTWS(t)
+	f.handle = broker.handle
+	m, _, _ := startManager(t, f)
+	waitForConnection(t, m, ConnectionTrading, "connected", connected)
+	waitForConnection(t, m, ConnectionData, "connected", connected)
+	return NewClient(func() *ConnectionManager { return m }), broker
+}
+
+func TestClientNotConnected(t *testing.T) {
+	c := NewClient(func() *ConnectionManager { return nil })
+	if _, err := c.UnderlyingPrice(context.Background(), "AAPL"); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("UnderlyingPrice without a manager: got %v, want ErrNotConnected", err)
+	}
+
+	m := NewConnectionManager(ConnectionConfig{Address: "127.0.0.1:1"})
+	c = NewClient(func() *ConnectionManager { return m })
+	if _, err := c.OpenOrders(context.Background()); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("OpenOrders while disconnected: got %v, want ErrNotConnected", err)
+	}
+}
+
+func TestClientMarketData(t *testing.T) {
+	c, _ := startClient(t)
+	ctx := context.Background()
+
+	// Without a last price the mid is used
+	if price, err := c.UnderlyingPrice(ctx, "aapl"); err != nil || price != 190 {
+		t.Errorf("UnderlyingPrice: got %v, %v, want the mid 190", price, err)
+	}
+
+	params, err := c.OptionParams(ctx, "AAPL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(params) != 1 || params[0].Exchange != "SMART" || params[0].Expirations[0] != "20250117" || len(params[0].Strikes) != 3 || params[0].Strikes[0] != 185 {
+		t.Errorf("OptionParams: got %+v, want the sorted standard AAPL class", params)
+	}
+
+	quotes, err := c.OptionSnapshots(ctx, "AAPL", []OptionKey{
+		{Expiry: "20250117", Strike: 190, Right: "C"},
+		{Expiry: "20250117", Strike: 999, Right: "C"},
+		{Expiry: "20250117", Strike: 185, Right: "P"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(quotes) != 2 {
+		t.Fatalf("OptionSnapshots: got %+v, want the two known options", quotes)
+	}
+	want := OptionQuote{OptionKey: OptionKey{Expiry: "20250117", Strike: 185, Right: "P"},
+		Bid: 1.85, Ask: 2.05, ImpliedVol: 0.31, Delta: 0.45, Gamma: 0.02, Theta: -0.05, Vega: 0.11, OpenInterest: 1500}
+	if quotes[0].Strike != 190 || quotes[1] != want {
+		t.Errorf("OptionSnapshots: got %+v, want %+v second", quotes, want)
+	}
+}
+
+func TestClientPlaceOrder(t *testing.T) {
+	c, broker := startClient(t)
+	order := NewComboOrder(SpreadOrder{
+		Symbol:   "AAPL",
+		Quantity: 2,
+		Legs: []OptionLeg{
+			{Strike: 190, Expiry: "20250117", Right: "C", Action: "BUY"},
+			{Strike: 195, Expiry: "20250117", Right: "C", Action: "SELL"},
+		},
+		FAAllocation: FAAllocation{Group: "Growth", Method: FAMethodNetLiq},
+	}, 1.52)
+	order.Account = "U1"
+
+	statuses := make(chan OrderState, 10)
+	orderID, err := c.PlaceOrder(context.Background(), order, func(state OrderState) { statuses <- state })
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for state := range statuses {
+		got = append(got, state.Status)
+		if state.OrderID != orderID || state.Symbol != "AAPL" || state.Account != "U1" {
+			t.Errorf("Status update: got %+v", state)
+		}
+		if state.Done() {
+			if state.Filled != 2 || state.AvgFillPrice != 1.52 {
+				t.Errorf("Filled order: got %+v", state)
+			}
+			break
+		}
+	}
+	if len(got) != 3 || got[0] != OrderPreSubmitted || got[1] != OrderSubmitted {
+		t.Errorf("Statuses: got %v, want each change once", got)
+	}
+
+	fields := broker.placed()[0]
+	if len(fields) != 118+8*2 || fields[4] != "BAG" || fields[19] != "1.52" || fields[21] != "DAY" || fields[23] != "U1" {
+		t.Errorf("placeOrder: got %d fields %q", len(fields), fields)
+	}
+	if fields[36] != strconv.FormatInt(optionConID(190, "C"), 10) || fields[38] != "BUY" || fields[44] != strconv.FormatInt(optionConID(195, "C"), 10) || fields[46] != "SELL" {
+		t.Errorf("placeOrder legs: got %q, want the standard class contract ids", fields[35:52])
+	}
+	if fields[58] != "Growth" || fields[59] != FAMethodNetLiq {
+		t.Errorf("placeOrder allocation: got %q", fields[58:63])
+	}
+
+	// A rejected order ends Inactive with TWS's reason
+	order.LimitPrice = 9.99
+	if _, err := c.PlaceOrder(context.Background(), order, func(state OrderState) { statuses <- state }); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case state := <-statuses:
+		if state.Status != OrderInactive || state.Message != "Order rejected - reason: margin" {
+			t.Errorf("Rejected order: got %+v", state)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("No status for the rejected order")
+	}
+}
+
+func TestClientWhatIfAndOpenOrders(t *testing.T) {
+	c, _ := startClient(t)
+	ctx := context.Background()
+
+	result, err := c.WhatIfOrder(ctx, SpreadOrder{
+		Symbol:   "AAPL",
+		Quantity: 1,
+		Legs: []OptionLeg{
+			{Strike: 190, Expiry: "20250117", Right: "C", Action: "BUY"},
+			{Strike: 185, Expiry: "20250117", Right: "P", Action: "SELL"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := WhatIfResult{InitMarginChange: 1870, MaintMarginChange: 1650, EquityWithLoanBefore: 2130, Commission: 2.6, CommissionCurrency: "USD"}
+	if result != want {
+		t.Errorf("WhatIfOrder: got %+v, want %+v", result, want)
+	}
+
+	// The filled order is left out, and the legs are looked up by id
+	orders, err := c.OpenOrders(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 1 {
+		t.Fatalf("OpenOrders: got %+v, want order 7", orders)
+	}
+	order := orders[0]
+	if order.OrderID != 7 || order.Status != OrderSubmitted || order.Filled != 1 || order.Remaining != 1 || order.LimitPrice != 1.5 || order.Account != "U1" {
+		t.Errorf("Open order: got %+v", order)
+	}
+	wantLegs := []OptionLeg{
+		{Strike: 190, Expiry: "20250117", Right: "C", Action: "BUY", Ratio: 1},
+		{Strike: 195, Expiry: "20250117", Right: "C", Action: "SELL", Ratio: 1},
+	}
+	if len(order.Legs) != 2 || order.Legs[0] != wantLegs[0] || order.Legs[1] != wantLegs[1] {
+		t.Errorf("Open order legs: got %+v, want %+v", order.Legs, wantLegs)
+	}
+}
+
+func TestClientAccount(t *testing.T) {
+	c, _ := startClient(t)
+	ctx := context.Background()
+
+	positions, err := c.Positions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(positions) != 2 {
+		t.Fatalf("Positions: got %+v, want the two open ones", positions)
+	}
+	want := Position{Account: "U1", ConID: optionConID(190, "C"), Symbol: "AAPL", SecType: "OPT", Expiry: "20250117", Strike: 190, Right: "C", Multiplier: 100, Quantity: -2, AvgCost: 310}
+	if positions[1] != want {
+		t.Errorf("Option position: got %+v, want %+v", positions[1], want)
+	}
+
+	summary, err := c.AccountSummary(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSummary := AccountSummary{Account: "U1", NetLiquidation: 100000.5, BuyingPower: 250000, RealizedPnL: -30.5, UnrealizedPnL: 120.5}
+	if summary != wantSummary {
+		t.Errorf("AccountSummary: got %+v, want %+v", summary, wantSummary)
+	}
+	if summary, err := c.AccountSummary(ctx, "U2"); err != nil || summary.NetLiquidation != 5000 || summary.BuyingPower != 0 {
+		t.Errorf("AccountSummary(U2): got %+v, %v", summary, err)
+	}
+}
@@ -0,0 +1,417 @@
+package ibkr
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Names of the connections a ConnectionManager keeps open
+const (
+	ConnectionTrading = "trading"
+	ConnectionData    = "data"
+)
+
+// ConnectionState is the state of one managed connection
+type ConnectionState string
+
+const (
+	// StateConnecting is set while dialing and performing the API handshake
+	StateConnecting ConnectionState = "connecting"
+	// StateConnected is set once TWS/Gateway has accepted the client
+	StateConnected ConnectionState = "connected"
+	// StateDisconnected is set between reconnection attempts and after shutdown
+	StateDisconnected ConnectionState = "disconnected"
+)
+
+// Defaults used when ConnectionConfig leaves a duration unset
+const (
+	DefaultHeartbeatInterval = 10 * time.Second
+	DefaultInitialBackoff    = time.Second
+	DefaultMaxBackoff        = time.Minute
+)
+
+// ErrClientIDInUse is returned when TWS/Gateway rejects the client ID because
+// another client is connected with it
+var ErrClientIDInUse = errors.New("ibkr: client id already in use")
+
+// errHeartbeatTimeout is returned when TWS/Gateway stops answering heartbeats
+var errHeartbeatTimeout = errors.New("ibkr: no reply to heartbeats")
+
+// TWS API versions accepted in the handshake. The requests of Client are
+// encoded for version 176, so older servers are refused.
+const (
+	minServerVersion = 176
+	maxServerVersion = 176
+)
+
+// Ids of the TWS API messages exchanged by the manager
+const (
+	msgError       = 4
+	msgNextValidID = 9
+	msgCurrentTime = 49
+	msgStartAPI    = 71
+)
+
+// codeClientIDInUse is the TWS error code for a duplicate client ID
+const codeClientIDInUse = 326
+
+// maxMessageSize bounds the messages read from TWS/Gateway
+const maxMessageSize = 16 << 20
+
+// ConnectionConfig configures a ConnectionManager
+type ConnectionConfig struct {
+	Address         string // host:port of TWS/Gateway
+	TradingClientID int
+	DataClientID    int
+	// HeartbeatInterval is how often the server's time is requested; a
+	// connection that has sent nothing for two intervals is considered lost
+	HeartbeatInterval time.Duration
+	// Reconnection attempts back off exponentially from InitialBackoff to
+	// MaxBackoff
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// ConnectionStatus describes one managed connection. It is also the payload
+// of the state transitions published by the manager.
+type ConnectionStatus struct {
+	Name          string          `json:"name"`
+	ClientID      int             `json:"clientId"`
+	State         ConnectionState `json:"state"`
+	ServerVersion int             `json:"serverVersion,omitempty"`
+	ConnectedAt   time.Time       `json:"connectedAt,omitempty"`
+	LastError     string          `json:"lastError,omitempty"`
+	// Attempts counts the failed attempts since the connection was last up
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"nextAttempt,omitempty"`
+}
+
+// ConnectionManager keeps the trading and data connections to TWS/Gateway
+// open for the life of Run. Each connection performs the API handshake once,
+// is checked with heartbeats and is redialed with exponential backoff when it
+// drops, so that the client IDs are held by one session at a time. Requests
+// are sent over a connection's session while it is up.
+type ConnectionManager struct {
+	config ConnectionConfig
+	events chan ConnectionStatus
+
+	mu       sync.RWMutex
+	statuses map[string]*ConnectionStatus
+	sessions map[string]*session
+}
+
+// NewConnectionManager returns a manager for config; call Run to connect
+func NewConnectionManager(config ConnectionConfig) *ConnectionManager {
+	if config.HeartbeatInterval <= 0 {
+		config.HeartbeatInterval = DefaultHeartbeatInterval
+	}
+	if config.InitialBackoff <= 0 {
+		config.InitialBackoff = DefaultInitialBackoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = DefaultMaxBackoff
+	}
+	if config.MaxBackoff < config.InitialBackoff {
+		config.MaxBackoff = config.InitialBackoff
+	}
+
+	m := &ConnectionManager{
+		config:   config,
+		events:   make(chan ConnectionStatus, 32),
+		statuses: make(map[string]*ConnectionStatus),
+		sessions: make(map[string]*session),
+	}
+	m.statuses[ConnectionTrading] = &ConnectionStatus{Name: ConnectionTrading, ClientID: config.TradingClientID, State: StateDisconnected}
+	m.statuses[ConnectionData] = &ConnectionStatus{Name: ConnectionData, ClientID: config.DataClientID, State: StateDisconnected}
+	return m
+}
+
+// Events returns the state transitions of both connections. Transitions are
+// dropped while the channel is full; Status always has the current state.
+func (m *ConnectionManager) Events() <-chan ConnectionStatus {
+	return m.events
+}
+
+// Status returns the trading and data connections, in that order
+func (m *ConnectionManager) Status() []ConnectionStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return []ConnectionStatus{*m.statuses[ConnectionTrading], *m.statuses[ConnectionData]}
+}
+
+// Connection returns the status of the named connection
+func (m *ConnectionManager) Connection(name string) ConnectionStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if status, ok := m.statuses[name]; ok {
+		return *status
+	}
+	return ConnectionStatus{Name: name, State: StateDisconnected}
+}
+
+// session returns the request layer of the named connection, or
+// ErrNotConnected while the connection is down
+func (m *ConnectionManager) session(name string) (*session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if s := m.sessions[name]; s != nil {
+		return s, nil
+	}
+	return nil, fmt.Errorf("%s connection: %w", name, ErrNotConnected)
+}
+
+// setSession makes s the named connection's session, nil while it is down
+func (m *ConnectionManager) setSession(name string, s *session) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s == nil {
+		delete(m.sessions, name)
+		return
+	}
+	m.sessions[name] = s
+}
+
+// Run keeps both connections open until ctx is done, then closes them and
+// returns
+func (m *ConnectionManager) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, name := range []string{ConnectionTrading, ConnectionData} {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			m.maintain(ctx, name)
+		}(name)
+	}
+	wg.Wait()
+}
+
+// maintain connects the named connection and reconnects it whenever it drops
+func (m *ConnectionManager) maintain(ctx context.Context, name string) {
+	clientID := m.Connection(name).ClientID
+	delay := m.config.InitialBackoff
+	for {
+		m.update(name, func(s *ConnectionStatus) {
+			s.State = StateConnecting
+			s.NextAttempt = time.Time{}
+		})
+
+		session, err := m.connect(ctx, clientID)
+		if err == nil {
+			m.update(name, func(s *ConnectionStatus) {
+				s.State = StateConnected
+				s.ServerVersion = session.version
+				s.ConnectedAt = time.Now()
+				s.LastError = ""
+				s.Attempts = 0
+			})
+			delay = m.config.InitialBackoff
+			m.setSession(name, session)
+			err = m.serve(ctx, session)
+			m.setSession(name, nil)
+			session.close(err)
+		}
+
+		if ctx.Err() != nil {
+			m.update(name, func(s *ConnectionStatus) { s.State = StateDisconnected })
+			return
+		}
+		next := time.Now().Add(delay)
+		m.update(name, func(s *ConnectionStatus) {
+			s.State = StateDisconnected
+			s.LastError = err.Error()
+			s.Attempts++
+			s.NextAttempt = next
+		})
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > m.config.MaxBackoff {
+			delay = m.config.MaxBackoff
+		}
+	}
+}
+
+// update changes the named connection's status and publishes the result
+func (m *ConnectionManager) update(name string, change func(*ConnectionStatus)) {
+	m.mu.Lock()
+	status := m.statuses[name]
+	change(status)
+	published := *status
+	m.mu.Unlock()
+
+	select {
+	case m.events <- published:
+	default:
+	}
+}
+
+// wire is an open connection with its buffered reader
+type wire struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// connect dials TWS/Gateway and performs the API handshake for clientID,
+// returning the connection's session once the client is accepted
+func (m *ConnectionManager) connect(ctx context.Context, clientID int) (*session, error) {
+	dialCtx, cancel := context.WithTimeout(ctx, m.config.HeartbeatInterval)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(dialCtx, "tcp", m.config.Address)
+	if err != nil {
+		return nil, err
+	}
+	w := &wire{conn: conn, reader: bufio.NewReader(conn)}
+
+	// The handshake must complete within one heartbeat interval
+	deadline, _ := dialCtx.Deadline()
+	conn.SetDeadline(deadline)
+	version, nextOrderID, err := w.handshake(clientID)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return newSession(w, version, nextOrderID, m.config.HeartbeatInterval), nil
+}
+
+// handshake negotiates the API version and starts the API for clientID,
+// waiting for the next valid order id that TWS/Gateway sends on acceptance
+func (w *wire) handshake(clientID int) (version int, nextOrderID int64, err error) {
+	versions := fmt.Sprintf("v%d..%d", minServerVersion, maxServerVersion)
+	var hello bytes.Buffer
+	hello.WriteString("API\x00")
+	binary.Write(&hello, binary.BigEndian, uint32(len(versions)))
+	hello.WriteString(versions)
+	if _, err := w.conn.Write(hello.Bytes()); err != nil {
+		return 0, 0, fmt.Errorf("API handshake: %w", err)
+	}
+
+	// The reply is the server version and connection time
+	reply, err := w.read()
+	if err != nil {
+		return 0, 0, fmt.Errorf("API handshake: %w", err)
+	}
+	version, err = strconv.Atoi(reply[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("API handshake: unexpected server version %q", reply[0])
+	}
+	if version < minServerVersion {
+		return 0, 0, fmt.Errorf("API handshake: TWS/Gateway API version %d is older than %d", version, minServerVersion)
+	}
+
+	if err := w.write(msgStartAPI, 2, clientID, ""); err != nil {
+		return 0, 0, fmt.Errorf("API handshake: %w", err)
+	}
+	for {
+		fields, err := w.read()
+		if err != nil {
+			return 0, 0, fmt.Errorf("API handshake: %w", err)
+		}
+		switch messageID(fields) {
+		case msgNextValidID:
+			// Fields are the id, version and next order id
+			if len(fields) >= 3 {
+				nextOrderID, _ = strconv.ParseInt(fields[2], 10, 64)
+			}
+			return version, nextOrderID, nil
+		case msgError:
+			// Fields are the id, version, request id, code and message
+			if len(fields) >= 5 && fields[3] == strconv.Itoa(codeClientIDInUse) {
+				return 0, 0, fmt.Errorf("client id %d: %w", clientID, ErrClientIDInUse)
+			}
+		}
+	}
+}
+
+// serve reads messages, routing them to the session's requests, and sends
+// heartbeats until the connection is lost or ctx is done, and closes the
+// connection
+func (m *ConnectionManager) serve(ctx context.Context, s *session) error {
+	defer s.w.conn.Close()
+
+	var lastRead atomic.Int64
+	lastRead.Store(time.Now().UnixNano())
+	readErr := make(chan error, 1)
+	go func() {
+		for {
+			fields, err := s.w.read()
+			if err != nil {
+				readErr <- err
+				return
+			}
+			lastRead.Store(time.Now().UnixNano())
+			s.dispatch(fields)
+		}
+	}()
+
+	interval := m.config.HeartbeatInterval
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-readErr:
+			return fmt.Errorf("connection lost: %w", err)
+		case <-ticker.C:
+			if time.Since(time.Unix(0, lastRead.Load())) > 2*interval {
+				return errHeartbeatTimeout
+			}
+			if err := s.send(msgCurrentTime, 1); err != nil {
+				return fmt.Errorf("connection lost: %w", err)
+			}
+		}
+	}
+}
+
+// write sends a message of NUL-terminated fields with its length prefix
+func (w *wire) write(fields ...interface{}) error {
+	var payload bytes.Buffer
+	for _, field := range fields {
+		fmt.Fprint(&payload, field)
+		payload.WriteByte(0)
+	}
+	message := make([]byte, 4, 4+payload.Len())
+	binary.BigEndian.PutUint32(message, uint32(payload.Len()))
+	_, err := w.conn.Write(append(message, payload.Bytes()...))
+	return err
+}
+
+// read returns the fields of the next length-prefixed message
+func (w *wire) read() ([]string, error) {
+	var size uint32
+	if err := binary.Read(w.reader, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+	if size == 0 || size > maxMessageSize {
+		return nil, fmt.Errorf("unexpected message of %d bytes", size)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(w.reader, payload); err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimSuffix(string(payload), "\x00"), "\x00"), nil
+}
+
+// messageID returns the id in a message's first field, or 0
+func messageID(fields []string) int {
+	id, _ := strconv.Atoi(fields[0])
+	return id
+}
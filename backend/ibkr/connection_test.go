@@ -0,0 +1,281 @@
+package ibkr
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTWS accepts API clients the way TWS/Gateway does, answering heartbeats
+// unless silent and passing the other requests to handle when it is set.
+// Tests kill and restart it on the same address.
+type fakeTWS struct {
+	t       *testing.T
+	address string
+	handle  func(w *wire, fields []string)
+
+	mu        sync.Mutex
+	listener  net.Listener
+	conns     map[net.Conn]bool
+	clientIDs map[string]bool
+	silent    bool
+}
+
+// startFakeTWS listens on a free local port
+func startFakeTWS(t *testing.T) *fakeTWS {
+	t.Helper()
+	f := &fakeTWS{t: t, address: "127.0.0.1:0", conns: make(map[net.Conn]bool), clientIDs: make(map[string]bool)}
+	f.start()
+	t.Cleanup(f.kill)
+	return f
+}
+
+// start listens on the fake's address, which is kept across restarts
+func (f *fakeTWS) start() {
+	f.t.Helper()
+	listener, err := net.Listen("tcp", f.address)
+	if err != nil {
+		f.t.Fatalf("fake TWS: %v", err)
+	}
+	f.mu.Lock()
+	f.listener = listener
+	f.address = listener.Addr().String()
+	f.mu.Unlock()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.conns[conn] = true
+			f.mu.Unlock()
+			go f.serve(conn)
+		}
+	}()
+}
+
+// kill stops listening and drops every client
+func (f *fakeTWS) kill() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.listener != nil {
+		f.listener.Close()
+		f.listener = nil
+	}
+	for conn := range f.conns {
+		conn.Close()
+	}
+}
+
+func (f *fakeTWS) setSilent(silent bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.silent = silent
+}
+
+// openConnections counts the clients still connected
+func (f *fakeTWS) openConnections() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.conns)
+}
+
+func (f *fakeTWS) serve(conn net.Conn) {
+	w := &wire{conn: conn, reader: bufio.NewReader(conn)}
+	var clientID string
+	defer func() {
+		conn.Close()
+		f.mu.Lock()
+		delete(f.conns, conn)
+		if clientID != "" {
+			delete(f.clientIDs, clientID)
+		}
+		f.mu.Unlock()
+	}()
+
+	prefix := make([]byte, 4)
+	if _, err := io.ReadFull(w.reader, prefix); err != nil || string(prefix) != "API\x00" {
+		return
+	}
+	if _, err := w.read(); err != nil {
+		return
+	}
+	w.write(maxServerVersion, "20240102 10:00:00 EST")
+
+	start, err := w.read()
+	if err != nil || messageID(start) != msgStartAPI {
+		return
+	}
+	f.mu.Lock()
+	inUse := f.clientIDs[start[2]]
+	if !inUse {
+		clientID = start[2]
+		f.clientIDs[clientID] = true
+	}
+	f.mu.Unlock()
+	if inUse {
+		w.write(msgError, 2, -1, codeClientIDInUse, "Unable to connect as the client id is already in use.")
+		return
+	}
+	w.write(msgNextValidID, 1, 1)
+
+	for {
+		fields, err := w.read()
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		silent := f.silent
+		f.mu.Unlock()
+		switch {
+		case messageID(fields) == msgCurrentTime:
+			if !silent {
+				w.write(msgCurrentTime, 1, time.Now().Unix())
+			}
+		case f.handle != nil:
+			f.handle(w, fields)
+		}
+	}
+}
+
+// startManager runs a manager with short heartbeats and backoff against the
+// fake until the test ends
+func startManager(t *testing.T, f *fakeTWS) (*ConnectionManager, context.CancelFunc, <-chan struct{}) {
+	t.Helper()
+	m := NewConnectionManager(ConnectionConfig{
+		Address:           f.address,
+		TradingClientID:   1,
+		DataClientID:      2,
+		HeartbeatInterval: 50 * time.Millisecond,
+		InitialBackoff:    10 * time.Millisecond,
+		MaxBackoff:        40 * time.Millisecond,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return m, cancel, done
+}
+
+// waitForConnection waits until the named connection satisfies cond
+func waitForConnection(t *testing.T, m *ConnectionManager, name, what string, cond func(ConnectionStatus) bool) ConnectionStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status := m.Connection(name)
+		if cond(status) {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s connection: timed out waiting for %s, last %+v", name, what, status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func connected(s ConnectionStatus) bool { return s.State == StateConnected }
+
+func TestConnectionManagerReconnectsAfterRestart(t *testing.T) {
+	f := startFakeTWS(t)
+	m, cancel, done := startManager(t, f)
+
+	for _, name := range []string{ConnectionTrading, ConnectionData} {
+		status := waitForConnection(t, m, name, "connected", connected)
+		if status.ServerVersion != maxServerVersion || status.ConnectedAt.IsZero() {
+			t.Errorf("%s connection: got %+v, want version %d", name, status, maxServerVersion)
+		}
+	}
+	firstConnected := m.Connection(ConnectionTrading).ConnectedAt
+
+	// Heartbeats keep the connections up
+	time.Sleep(200 * time.Millisecond)
+	if status := m.Connection(ConnectionTrading); !connected(status) || !status.ConnectedAt.Equal(firstConnected) {
+		t.Fatalf("Trading connection dropped while TWS answered heartbeats: %+v", status)
+	}
+
+	f.kill()
+	status := waitForConnection(t, m, ConnectionTrading, "a failed reconnection", func(s ConnectionStatus) bool {
+		return s.State == StateDisconnected && s.Attempts >= 2
+	})
+	if status.LastError == "" || status.NextAttempt.IsZero() {
+		t.Errorf("Disconnected status: got %+v, want the error and next attempt", status)
+	}
+
+	f.start()
+	for _, name := range []string{ConnectionTrading, ConnectionData} {
+		status := waitForConnection(t, m, name, "reconnected", connected)
+		if status.Attempts != 0 || status.LastError != "" || !status.ConnectedAt.After(firstConnected) {
+			t.Errorf("%s connection after reconnecting: got %+v", name, status)
+		}
+	}
+
+	// The transitions were published in order
+	var states []ConnectionState
+	for len(m.Events()) > 0 {
+		if event := <-m.Events(); event.Name == ConnectionTrading {
+			states = append(states, event.State)
+		}
+	}
+	if len(states) < 5 || states[0] != StateConnecting || states[1] != StateConnected || states[2] != StateDisconnected || states[len(states)-1] != StateConnected {
+		t.Errorf("Trading transitions: got %v", states)
+	}
+
+	// Shutting down closes the sockets
+	cancel()
+	<-done
+	deadline := time.Now().Add(time.Second)
+	for f.openConnections() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d connections still open after shutdown", f.openConnections())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if status := m.Connection(ConnectionData); status.State != StateDisconnected {
+		t.Errorf("Data connection after shutdown: got %+v", status)
+	}
+}
+
+func TestConnectionManagerDetectsHeartbeatTimeout(t *testing.T) {
+	f := startFakeTWS(t)
+	m, _, _ := startManager(t, f)
+	waitForConnection(t, m, ConnectionTrading, "connected", connected)
+
+	f.setSilent(true)
+	status := waitForConnection(t, m, ConnectionTrading, "a heartbeat timeout", func(s ConnectionStatus) bool {
+		return s.State == StateDisconnected
+	})
+	if !strings.Contains(status.LastError, "heartbeats") {
+		t.Errorf("LastError: got %q, want a heartbeat timeout", status.LastError)
+	}
+
+	f.setSilent(false)
+	waitForConnection(t, m, ConnectionTrading, "reconnected", connected)
+}
+
+func TestConnectionManagerReportsClientIDInUse(t *testing.T) {
+	f := startFakeTWS(t)
+	f.clientIDs[strconv.Itoa(1)] = true
+	m, _, _ := startManager(t, f)
+
+	status := waitForConnection(t, m, ConnectionTrading, "a rejected client id", func(s ConnectionStatus) bool {
+		return s.LastError != ""
+	})
+	if !strings.Contains(status.LastError, ErrClientIDInUse.Error()) {
+		t.Errorf("LastError: got %q, want the client id in use", status.LastError)
+	}
+	waitForConnection(t, m, ConnectionData, "connected", connected)
+}
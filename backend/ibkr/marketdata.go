@@ -0,0 +1,272 @@
+package ibkr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Tick types of the quotes Client reads, live then delayed
+const (
+	tickBid             = 1
+	tickAsk             = 2
+	tickLast            = 4
+	tickClose           = 9
+	tickModelOption     = 13
+	tickCallOI          = 27
+	tickPutOI           = 28
+	tickDelayedBid      = 66
+	tickDelayedAsk      = 67
+	tickDelayedLast     = 68
+	tickDelayedClose    = 75
+	tickDelayedModelOpt = 83
+)
+
+// genericTickOpenInterest requests the open interest of options
+const genericTickOpenInterest = "101"
+
+// reqMktData returns the fields of a market data request for a contract
+func reqMktData(reqID int64, symbol, secType string, key OptionKey, genericTicks string, snapshot bool) []interface{} {
+	strike, multiplier := "0", ""
+	if secType == "OPT" {
+		strike, multiplier = number(key.Strike, true), "100"
+	}
+	return []interface{}{msgReqMktData, 11, reqID, 0, symbol, secType, key.Expiry, strike, key.Right, multiplier,
+		"SMART", "", "USD", "", "", 0, genericTicks, flag(snapshot), 0, ""}
+}
+
+// UnderlyingPrice returns the last price of a stock, or the mid of its
+// quote or its last close when it has not traded
+func (c *Client) UnderlyingPrice(ctx context.Context, symbol string) (float64, error) {
+	s, err := c.session(ConnectionData)
+	if err != nil {
+		return 0, err
+	}
+	symbol = strings.ToUpper(symbol)
+	_, sub, err := s.request(func(reqID int64) []interface{} {
+		return reqMktData(reqID, symbol, "STK", OptionKey{}, "", true)
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer s.unsubscribe(sub)
+
+	ctx, cancel := context.WithTimeout(ctx, quoteTimeout)
+	defer cancel()
+	var bid, ask, last, closePrice float64
+	for done := false; !done; {
+		fields, err := s.next(ctx, sub)
+		switch {
+		case err == context.DeadlineExceeded:
+			// Fields missing from the snapshot by now will not come
+			done = true
+			continue
+		case err != nil:
+			return 0, fmt.Errorf("%s price: %w", symbol, err)
+		}
+		switch messageID(fields) {
+		case msgTickSnapshotEnd:
+			done = true
+		case msgTickPrice:
+			// Fields are the id, version, request id, tick type and price
+			r := newFieldReader(fields, 3)
+			tickType, price := r.int(), r.float()
+			switch tickType {
+			case tickBid, tickDelayedBid:
+				bid = price
+			case tickAsk, tickDelayedAsk:
+				ask = price
+			case tickLast, tickDelayedLast:
+				last = price
+			case tickClose, tickDelayedClose:
+				closePrice = price
+			}
+		}
+	}
+
+	switch {
+	case last > 0:
+		return last, nil
+	case bid > 0 && ask >= bid:
+		return (bid + ask) / 2, nil
+	case closePrice > 0:
+		return closePrice, nil
+	}
+	return 0, fmt.Errorf("no quote for %s", symbol)
+}
+
+// OptionParams returns the option chain parameters of a stock on each
+// exchange, of the trading class named after the stock when it has several
+func (c *Client) OptionParams(ctx context.Context, symbol string) ([]OptionParams, error) {
+	s, err := c.session(ConnectionData)
+	if err != nil {
+		return nil, err
+	}
+	symbol = strings.ToUpper(symbol)
+	conID, err := c.contractID(ctx, s, symbol, OptionKey{})
+	if err != nil {
+		return nil, err
+	}
+	_, sub, err := s.request(func(reqID int64) []interface{} {
+		return []interface{}{msgReqSecDefOptParams, reqID, symbol, "", "STK", conID}
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer s.unsubscribe(sub)
+
+	byClass := make(map[string][]OptionParams)
+	for {
+		fields, err := s.next(ctx, sub)
+		if err != nil {
+			return nil, fmt.Errorf("%s option parameters: %w", symbol, err)
+		}
+		if messageID(fields) == msgSecDefOptParamsEnd {
+			break
+		}
+		// Fields are the id, request id, exchange, underlying contract id,
+		// trading class, multiplier, then the counted expirations and strikes
+		r := newFieldReader(fields, 2)
+		params := OptionParams{Exchange: r.str()}
+		r.skip(1)
+		tradingClass := r.str()
+		params.Multiplier = r.str()
+		for n := r.int(); n > 0; n-- {
+			params.Expirations = append(params.Expirations, r.str())
+		}
+		for n := r.int(); n > 0; n-- {
+			params.Strikes = append(params.Strikes, r.float())
+		}
+		sort.Strings(params.Expirations)
+		sort.Float64s(params.Strikes)
+		byClass[tradingClass] = append(byClass[tradingClass], params)
+	}
+
+	if params, ok := byClass[symbol]; ok {
+		return params, nil
+	}
+	var all []OptionParams
+	for _, params := range byClass {
+		all = append(all, params...)
+	}
+	return all, nil
+}
+
+// OptionSnapshots streams market data for each option until its bid, ask,
+// model Greeks and open interest have arrived, or quoteTimeout has passed,
+// then cancels it. Options TWS does not know are left out.
+func (c *Client) OptionSnapshots(ctx context.Context, symbol string, options []OptionKey) ([]OptionQuote, error) {
+	s, err := c.session(ConnectionData)
+	if err != nil {
+		return nil, err
+	}
+	symbol = strings.ToUpper(symbol)
+
+	type pending struct {
+		quote                     OptionQuote
+		bid, ask, model, interest bool
+		unknown                   bool
+	}
+	requests := make(map[int64]*pending, len(options))
+	ids := make([]int64, len(options))
+	for i := range options {
+		ids[i] = s.requestID()
+		requests[ids[i]] = &pending{quote: OptionQuote{OptionKey: options[i]}}
+	}
+	sub := s.subscribe(ids)
+	defer s.unsubscribe(sub)
+
+	var sent []int64
+	defer func() {
+		for _, reqID := range sent {
+			s.send(msgCancelMktData, 2, reqID)
+		}
+	}()
+	for i, option := range options {
+		if err := s.send(reqMktData(ids[i], symbol, "OPT", option, genericTickOpenInterest, false)...); err != nil {
+			return nil, err
+		}
+		sent = append(sent, ids[i])
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, quoteTimeout)
+	defer cancel()
+	complete := 0
+	for complete < len(options) {
+		fields, err := s.next(ctx, sub)
+		var apiErr *APIError
+		switch {
+		case err == context.DeadlineExceeded:
+			// The quotes are returned with the fields that arrived
+			complete = len(options)
+			continue
+		case errors.As(err, &apiErr) && apiErr.Code == codeNoSecurityDefinition:
+		case err != nil:
+			return nil, fmt.Errorf("%s option quotes: %w", symbol, err)
+		}
+
+		id := newFieldReader(fields, requestIDField[messageID(fields)]).int64()
+		p := requests[id]
+		if p == nil {
+			continue
+		}
+		wasComplete := p.unknown || (p.bid && p.ask && p.model && p.interest)
+		r := newFieldReader(fields, requestIDField[messageID(fields)]+1)
+		switch messageID(fields) {
+		case msgError:
+			p.unknown = true
+		case msgTickPrice:
+			switch tickType, price := r.int(), r.float(); tickType {
+			case tickBid, tickDelayedBid:
+				p.quote.Bid, p.bid = price, true
+			case tickAsk, tickDelayedAsk:
+				p.quote.Ask, p.ask = price, true
+			}
+		case msgTickSize:
+			switch tickType, size := r.int(), r.float(); tickType {
+			case tickCallOI, tickPutOI:
+				p.quote.OpenInterest, p.interest = int(size), true
+			}
+		case msgTickOptionComputation:
+			// Fields are the tick type, attributes, implied volatility,
+			// delta, price, dividends, gamma, vega, theta and underlying
+			// price; TWS sends -1 or -2 for those it could not compute
+			if tickType := r.int(); tickType != tickModelOption && tickType != tickDelayedModelOpt {
+				continue
+			}
+			r.skip(1)
+			iv, delta := r.float(), r.float()
+			r.skip(2)
+			gamma, vega, theta := r.float(), r.float(), r.float()
+			if iv >= 0 {
+				p.quote.ImpliedVol = iv
+			}
+			if delta != -2 {
+				p.quote.Delta = delta
+			}
+			if gamma != -2 {
+				p.quote.Gamma = gamma
+			}
+			if vega != -2 {
+				p.quote.Vega = vega
+			}
+			if theta != -2 {
+				p.quote.Theta = theta
+			}
+			p.model = true
+		}
+		if !wasComplete && (p.unknown || (p.bid && p.ask && p.model && p.interest)) {
+			complete++
+		}
+	}
+
+	quotes := make([]OptionQuote, 0, len(options))
+	for _, reqID := range ids {
+		if p := requests[reqID]; !p.unknown {
+			quotes = append(quotes, p.quote)
+		}
+	}
+	return quotes, nil
+}
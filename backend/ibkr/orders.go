@@ -0,0 +1,223 @@
+package ibkr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// ErrNotConnected is returned when an operation needs the IBKR trading connection and it is unavailable
+var ErrNotConnected = errors.New("ibkr: not connected to TWS/Gateway")
+
+// OptionLeg describes a single option leg of a spread order
+type OptionLeg struct {
+	Strike float64 `json:"strike"`
+	Expiry string  `json:"expiry"` // YYYYMMDD
+	Right  string  `json:"right"`  // "C" or "P"
+	Action string  `json:"action"` // "BUY" or "SELL"
+	Ratio  int     `json:"ratio"`
+}
+
+// SpreadOrder describes a multi-leg option order on a single underlying
+type SpreadOrder struct {
+	Symbol     string      `json:"symbol"`
+	Legs       []OptionLeg `json:"legs"`
+	Quantity   int         `json:"quantity"`
+	LimitPrice float64     `json:"limitPrice"` // Net price per spread, 0 for the current mid
+	// FAAllocation allocates the order of a financial-advisor account
+	FAAllocation
+}
+
+// Methods of allocating an order among the accounts of an FA group
+const (
+	FAMethodEqualQuantity   = "EqualQuantity"
+	FAMethodNetLiq          = "NetLiq"
+	FAMethodAvailableEquity = "AvailableEquity"
+	FAMethodPctChange       = "PctChange"
+)
+
+// FAAllocation allocates an order placed by a financial-advisor account
+// among its sub-accounts, either to a group by a method or by a predefined
+// allocation profile. TWS requires one on every order of an advisor account.
+type FAAllocation struct {
+	Group   string `json:"faGroup,omitempty"`
+	Profile string `json:"faProfile,omitempty"`
+	Method  string `json:"faMethod,omitempty"`
+	// Percentage is the change in position of the PctChange method
+	Percentage float64 `json:"faPercentage,omitempty"`
+}
+
+// Active reports whether the allocation names a group or profile
+func (f FAAllocation) Active() bool {
+	return f.Group != "" || f.Profile != ""
+}
+
+// WhatIfResult contains the margin and commission impact reported by an IBKR what-if order
+type WhatIfResult struct {
+	InitMarginChange     float64 `json:"initMarginChange"`
+	MaintMarginChange    float64 `json:"maintMarginChange"`
+	EquityWithLoanBefore float64 `json:"equityWithLoanBefore"`
+	Commission           float64 `json:"commission"`
+	CommissionCurrency   string  `json:"commissionCurrency"`
+	WarningText          string  `json:"warningText,omitempty"`
+}
+
+// Order statuses reported by TWS. A partially filled order stays Submitted
+// with a nonzero Filled count; a rejected one becomes Inactive.
+const (
+	OrderPendingSubmit = "PendingSubmit"
+	OrderPreSubmitted  = "PreSubmitted"
+	OrderSubmitted     = "Submitted"
+	OrderFilled        = "Filled"
+	OrderCancelled     = "Cancelled"
+	OrderApiCancelled  = "ApiCancelled"
+	OrderInactive      = "Inactive"
+)
+
+// ComboOrder is the combo (BAG) limit order placed for a spread. The combo is
+// bought with the legs' own actions, so a negative LimitPrice is a credit.
+type ComboOrder struct {
+	Symbol     string      `json:"symbol"`
+	SecType    string      `json:"secType"` // Always "BAG"
+	Exchange   string      `json:"exchange"`
+	Currency   string      `json:"currency"`
+	Action     string      `json:"action"`
+	Quantity   int         `json:"quantity"`
+	OrderType  string      `json:"orderType"`
+	LimitPrice float64     `json:"limitPrice"`
+	TIF        string      `json:"tif"`
+	Legs       []OptionLeg `json:"legs"`
+	// Account is the IBKR account code the order is placed for; empty leaves
+	// it to the connection's default account
+	Account string `json:"account,omitempty"`
+	FAAllocation
+}
+
+// OrderState is the latest status of an order placed over the trading connection
+type OrderState struct {
+	OrderID      int64       `json:"orderId"`
+	Symbol       string      `json:"symbol"`
+	Legs         []OptionLeg `json:"legs"`
+	LimitPrice   float64     `json:"limitPrice"`
+	Status       string      `json:"status"`
+	Filled       int         `json:"filled"`
+	Remaining    int         `json:"remaining"`
+	AvgFillPrice float64     `json:"avgFillPrice"`
+	// Message is the reason TWS gave for rejecting or cancelling the order
+	Message   string    `json:"message,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// Account is the IBKR account code of the order, empty when unknown
+	Account string `json:"account,omitempty"`
+}
+
+// Done reports whether the order can no longer fill
+func (s OrderState) Done() bool {
+	switch s.Status {
+	case OrderFilled, OrderCancelled, OrderApiCancelled, OrderInactive:
+		return true
+	}
+	return false
+}
+
+// OrderClient defines the order operations performed over the IBKR trading connection
+type OrderClient interface {
+	// WhatIfOrder submits the order with whatIf set and returns the reported impact without placing it
+	WhatIfOrder(ctx context.Context, order SpreadOrder) (WhatIfResult, error)
+
+	// PlaceOrder submits a combo order and returns its order ID. onStatus is
+	// called with each status update of the order until it is done.
+	PlaceOrder(ctx context.Context, order ComboOrder, onStatus func(OrderState)) (int64, error)
+
+	// OpenOrders returns the orders of the account that are not done yet
+	OpenOrders(ctx context.Context) ([]OrderState, error)
+
+	// CancelOrder requests the cancellation of an open order
+	CancelOrder(ctx context.Context, orderID int64) error
+}
+
+// NewComboOrder builds the combo limit order of a spread at the given net price
+func NewComboOrder(order SpreadOrder, limitPrice float64) ComboOrder {
+	legs := make([]OptionLeg, len(order.Legs))
+	for i, leg := range order.Legs {
+		if leg.Ratio == 0 {
+			leg.Ratio = 1
+		}
+		legs[i] = leg
+	}
+	return ComboOrder{
+		Symbol:     strings.ToUpper(strings.TrimSpace(order.Symbol)),
+		SecType:    "BAG",
+		Exchange:   "SMART",
+		Currency:   "USD",
+		Action:     "BUY",
+		Quantity:   order.Quantity,
+		OrderType:  "LMT",
+		LimitPrice: limitPrice,
+		TIF:        "DAY",
+		Legs:       legs,
+
+		FAAllocation: order.FAAllocation,
+	}
+}
+
+// ComboLimitPrice prices a combo between its natural bid and ask: a factor of
+// 0.5 is the mid price, less is closer to the bid and so a better price for
+// the buyer. quotes holds the quote of each leg in order. The price is
+// rounded to the cent.
+func ComboLimitPrice(legs []OptionLeg, quotes []OptionQuote, factor float64) (float64, error) {
+	if len(quotes) != len(legs) {
+		return 0, fmt.Errorf("got %d quotes for %d legs", len(quotes), len(legs))
+	}
+	var bid, ask float64
+	for i, leg := range legs {
+		quote := quotes[i]
+		if quote.Bid <= 0 || quote.Ask <= 0 {
+			return 0, fmt.Errorf("leg %d: no two-sided quote for %s %g%s", i+1, leg.Expiry, leg.Strike, leg.Right)
+		}
+		ratio := float64(max(leg.Ratio, 1))
+		if leg.Action == "BUY" {
+			bid += quote.Bid * ratio
+			ask += quote.Ask * ratio
+		} else {
+			bid -= quote.Ask * ratio
+			ask -= quote.Bid * ratio
+		}
+	}
+	return math.Round((bid+(ask-bid)*factor)*100) / 100, nil
+}
+
+// Validate checks that a spread order is well formed
+func (o SpreadOrder) Validate() error {
+	if strings.TrimSpace(o.Symbol) == "" {
+		return fmt.Errorf("symbol is required")
+	}
+	if o.Quantity <= 0 {
+		return fmt.Errorf("quantity must be positive")
+	}
+	if len(o.Legs) == 0 {
+		return fmt.Errorf("at least one leg is required")
+	}
+
+	for i, leg := range o.Legs {
+		if leg.Strike <= 0 {
+			return fmt.Errorf("leg %d: strike must be positive", i+1)
+		}
+		if len(leg.Expiry) != 8 {
+			return fmt.Errorf("leg %d: expiry must be in YYYYMMDD format", i+1)
+		}
+		if leg.Right != "C" && leg.Right != "P" {
+			return fmt.Errorf("leg %d: right must be C or P", i+1)
+		}
+		if leg.Action != "BUY" && leg.Action != "SELL" {
+			return fmt.Errorf("leg %d: action must be BUY or SELL", i+1)
+		}
+		if leg.Ratio < 0 {
+			return fmt.Errorf("leg %d: ratio cannot be negative", i+1)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,363 @@
+package ibkr
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Ids of the TWS API messages sent by Client
+const (
+	msgReqMktData           = 1
+	msgCancelMktData        = 2
+	msgPlaceOrder           = 3
+	msgCancelOrder          = 4
+	msgReqContractData      = 9
+	msgReqAllOpenOrders     = 16
+	msgReqPositions         = 61
+	msgReqAccountSummary    = 62
+	msgCancelAccountSummary = 63
+	msgCancelPositions      = 64
+	msgReqSecDefOptParams   = 78
+	msgReqPnL               = 92
+	msgCancelPnL            = 93
+)
+
+// Ids of the TWS API messages received by Client
+const (
+	msgTickPrice             = 1
+	msgTickSize              = 2
+	msgOrderStatus           = 3
+	msgOpenOrder             = 5
+	msgContractData          = 10
+	msgTickOptionComputation = 21
+	msgTickGeneric           = 45
+	msgTickString            = 46
+	msgContractDataEnd       = 52
+	msgOpenOrderEnd          = 53
+	msgTickSnapshotEnd       = 57
+	msgMarketDataType        = 58
+	msgPosition              = 61
+	msgPositionEnd           = 62
+	msgAccountSummary        = 63
+	msgAccountSummaryEnd     = 64
+	msgSecDefOptParams       = 75
+	msgSecDefOptParamsEnd    = 76
+	msgTickReqParams         = 81
+	msgPnL                   = 94
+)
+
+// requestIDField is the field holding the request or order id of the
+// messages routed by id. The others only reach the requests watching them.
+var requestIDField = map[int]int{
+	msgTickPrice:             2,
+	msgTickSize:              2,
+	msgOrderStatus:           1,
+	msgError:                 2,
+	msgOpenOrder:             1,
+	msgContractData:          1,
+	msgTickOptionComputation: 1,
+	msgTickGeneric:           2,
+	msgTickString:            2,
+	msgContractDataEnd:       2,
+	msgTickSnapshotEnd:       2,
+	msgMarketDataType:        2,
+	msgAccountSummary:        2,
+	msgAccountSummaryEnd:     2,
+	msgSecDefOptParams:       1,
+	msgSecDefOptParamsEnd:    1,
+	msgTickReqParams:         1,
+	msgPnL:                   1,
+}
+
+// firstRequestID is the first request id of a session. Order ids count up
+// from the next valid id TWS/Gateway sends, far below, so that error
+// messages, which carry either, are routed by id alone.
+const firstRequestID = 1 << 30
+
+// subscriptionBuffer is the number of messages a subscription holds before
+// the connection's reader waits for it
+const subscriptionBuffer = 256
+
+// Codes of TWS errors that are notices rather than failures of the request
+const (
+	codeOrderWarning      = 399
+	codeNotSubscribed     = 10090
+	codeDelayedMarketData = 10167
+)
+
+// Codes of TWS errors ending a request or an order
+const (
+	codeNoSecurityDefinition = 200
+	codeOrderRejected        = 201
+	codeOrderCancelled       = 202
+)
+
+// APIError is an error TWS/Gateway reported for a request or an order
+type APIError struct {
+	Code    int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("ibkr: error %d: %s", e.Code, e.Message)
+}
+
+// warning reports whether the error is a notice that leaves the request
+// running, such as market data falling back to delayed quotes
+func (e *APIError) warning() bool {
+	switch {
+	case e.Code >= 2100 && e.Code < 2200:
+		return true
+	case e.Code == codeOrderWarning, e.Code == codeNotSubscribed, e.Code == codeDelayedMarketData:
+		return true
+	}
+	return false
+}
+
+// apiError returns the error of an error message
+func apiError(fields []string) *APIError {
+	// Fields are the id, version, request id, code and message
+	r := newFieldReader(fields, 3)
+	return &APIError{Code: r.int(), Message: r.str()}
+}
+
+// session is the request layer of an open connection. It sends requests
+// and routes the messages TWS/Gateway sends back to the subscriptions of
+// their request or order id, and to those watching their message id.
+type session struct {
+	w            *wire
+	version      int
+	writeTimeout time.Duration
+
+	writeMu sync.Mutex
+
+	mu          sync.Mutex
+	nextReqID   int64
+	nextOrderID int64
+	byID        map[int64]map[*subscription]bool
+	byMessage   map[int]map[*subscription]bool
+	done        chan struct{}
+	err         error
+}
+
+// subscription receives the messages routed to it until it is cancelled
+type subscription struct {
+	ids       []int64
+	messages  []int
+	ch        chan []string
+	cancelled chan struct{}
+}
+
+func newSession(w *wire, version int, nextOrderID int64, writeTimeout time.Duration) *session {
+	return &session{
+		w:            w,
+		version:      version,
+		writeTimeout: writeTimeout,
+		nextReqID:    firstRequestID,
+		nextOrderID:  nextOrderID,
+		byID:         make(map[int64]map[*subscription]bool),
+		byMessage:    make(map[int]map[*subscription]bool),
+		done:         make(chan struct{}),
+	}
+}
+
+// send writes a message, failing when it is not written within the write
+// timeout
+func (s *session) send(fields ...interface{}) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.w.conn.SetWriteDeadline(time.Now().Add(s.writeTimeout))
+	return s.w.write(fields...)
+}
+
+// requestID returns a new request id
+func (s *session) requestID() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextReqID++
+	return s.nextReqID - 1
+}
+
+// orderID returns a new order id
+func (s *session) orderID() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextOrderID++
+	return s.nextOrderID - 1
+}
+
+// subscribe returns a subscription to the messages of the request or order
+// ids and to every message of the message ids
+func (s *session) subscribe(ids []int64, messages ...int) *subscription {
+	sub := &subscription{ids: ids, messages: messages, ch: make(chan []string, subscriptionBuffer), cancelled: make(chan struct{})}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		if s.byID[id] == nil {
+			s.byID[id] = make(map[*subscription]bool)
+		}
+		s.byID[id][sub] = true
+	}
+	for _, msg := range messages {
+		if s.byMessage[msg] == nil {
+			s.byMessage[msg] = make(map[*subscription]bool)
+		}
+		s.byMessage[msg][sub] = true
+	}
+	return sub
+}
+
+// unsubscribe stops routing messages to sub
+func (s *session) unsubscribe(sub *subscription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range sub.ids {
+		delete(s.byID[id], sub)
+		if len(s.byID[id]) == 0 {
+			delete(s.byID, id)
+		}
+	}
+	for _, msg := range sub.messages {
+		delete(s.byMessage[msg], sub)
+	}
+	close(sub.cancelled)
+}
+
+// dispatch routes a message read from the connection
+func (s *session) dispatch(fields []string) {
+	msg := messageID(fields)
+	var targets []*subscription
+	s.mu.Lock()
+	if msg == msgNextValidID && len(fields) >= 3 {
+		if id, err := strconv.ParseInt(fields[2], 10, 64); err == nil && id > s.nextOrderID {
+			s.nextOrderID = id
+		}
+	}
+	if field, ok := requestIDField[msg]; ok && field < len(fields) {
+		if id, err := strconv.ParseInt(fields[field], 10, 64); err == nil {
+			for sub := range s.byID[id] {
+				targets = append(targets, sub)
+			}
+		}
+	}
+	for sub := range s.byMessage[msg] {
+		targets = append(targets, sub)
+	}
+	s.mu.Unlock()
+
+	for _, sub := range targets {
+		select {
+		case sub.ch <- fields:
+		case <-sub.cancelled:
+		}
+	}
+}
+
+// close ends the session's requests with err, the reason the connection
+// was lost
+func (s *session) close(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+	close(s.done)
+}
+
+// next returns the next message of sub. It fails when ctx is done or the
+// connection is lost, and with the error TWS/Gateway reported for the
+// request unless that is a warning, which is skipped.
+func (s *session) next(ctx context.Context, sub *subscription) ([]string, error) {
+	for {
+		var fields []string
+		select {
+		case fields = <-sub.ch:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-s.done:
+			return nil, fmt.Errorf("%w: %v", ErrNotConnected, s.err)
+		}
+		if messageID(fields) != msgError {
+			return fields, nil
+		}
+		if err := apiError(fields); !err.warning() {
+			return fields, err
+		}
+	}
+}
+
+// fieldReader reads the fields of a message in order. Numbers that do not
+// parse, which TWS sends empty or as the largest double when they are
+// unset, read as zero.
+type fieldReader struct {
+	fields []string
+	i      int
+}
+
+// newFieldReader reads fields from the one at start
+func newFieldReader(fields []string, start int) *fieldReader {
+	return &fieldReader{fields: fields, i: start}
+}
+
+func (r *fieldReader) str() string {
+	if r.i >= len(r.fields) {
+		r.i++
+		return ""
+	}
+	r.i++
+	return r.fields[r.i-1]
+}
+
+func (r *fieldReader) int() int {
+	n, _ := strconv.Atoi(r.str())
+	return n
+}
+
+func (r *fieldReader) int64() int64 {
+	n, _ := strconv.ParseInt(r.str(), 10, 64)
+	return n
+}
+
+func (r *fieldReader) float() float64 {
+	return parseFloat(r.str())
+}
+
+func (r *fieldReader) bool() bool {
+	switch r.str() {
+	case "1", "true":
+		return true
+	}
+	return false
+}
+
+func (r *fieldReader) skip(n int) {
+	r.i += n
+}
+
+// parseFloat parses a number TWS sent, zero when it is unset
+func parseFloat(field string) float64 {
+	f, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) || math.Abs(f) >= math.MaxFloat64/2 {
+		return 0
+	}
+	return f
+}
+
+// flag encodes a boolean field
+func flag(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// number encodes a price or size, empty for the zero of an unset one
+func number(f float64, set bool) string {
+	if !set {
+		return ""
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,434 @@
+package ibkr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// WhatIfOrder prices the spread at the mid of its legs' quotes unless it has
+// a limit price, and submits its combo order with whatIf set, returning the
+// margin and commission impact TWS reports without placing it
+func (c *Client) WhatIfOrder(ctx context.Context, spread SpreadOrder) (WhatIfResult, error) {
+	limit := spread.LimitPrice
+	if limit == 0 {
+		keys := make([]OptionKey, len(spread.Legs))
+		for i, leg := range spread.Legs {
+			keys[i] = OptionKey{Expiry: leg.Expiry, Strike: leg.Strike, Right: leg.Right}
+		}
+		quotes, err := c.OptionSnapshots(ctx, spread.Symbol, keys)
+		if err != nil {
+			return WhatIfResult{}, err
+		}
+		byKey := make(map[OptionKey]OptionQuote, len(quotes))
+		for _, quote := range quotes {
+			byKey[quote.OptionKey] = quote
+		}
+		legQuotes := make([]OptionQuote, len(keys))
+		for i, key := range keys {
+			legQuotes[i] = byKey[key]
+		}
+		if limit, err = ComboLimitPrice(spread.Legs, legQuotes, 0.5); err != nil {
+			return WhatIfResult{}, fmt.Errorf("cannot price the what-if order: %w", err)
+		}
+	}
+
+	s, err := c.session(ConnectionTrading)
+	if err != nil {
+		return WhatIfResult{}, err
+	}
+	orderID := s.orderID()
+	fields, err := c.placeOrderFields(ctx, s, orderID, NewComboOrder(spread, limit), true)
+	if err != nil {
+		return WhatIfResult{}, err
+	}
+	sub := s.subscribe([]int64{orderID})
+	defer s.unsubscribe(sub)
+	if err := s.send(fields...); err != nil {
+		return WhatIfResult{}, err
+	}
+
+	for {
+		fields, err := s.next(ctx, sub)
+		if err != nil {
+			return WhatIfResult{}, fmt.Errorf("what-if order: %w", err)
+		}
+		if messageID(fields) != msgOpenOrder {
+			continue
+		}
+		decoded := decodeOpenOrder(fields)
+		if !decoded.whatIf {
+			continue
+		}
+		return decoded.result, nil
+	}
+}
+
+// PlaceOrder submits a combo order over the trading connection and calls
+// onStatus with each status update of the order until it is done or the
+// connection is lost
+func (c *Client) PlaceOrder(ctx context.Context, order ComboOrder, onStatus func(OrderState)) (int64, error) {
+	s, err := c.session(ConnectionTrading)
+	if err != nil {
+		return 0, err
+	}
+	orderID := s.orderID()
+	fields, err := c.placeOrderFields(ctx, s, orderID, order, false)
+	if err != nil {
+		return 0, err
+	}
+	sub := s.subscribe([]int64{orderID})
+	if err := s.send(fields...); err != nil {
+		s.unsubscribe(sub)
+		return 0, err
+	}
+
+	state := OrderState{
+		OrderID:    orderID,
+		Symbol:     order.Symbol,
+		Legs:       order.Legs,
+		LimitPrice: order.LimitPrice,
+		Status:     OrderPendingSubmit,
+		Remaining:  order.Quantity,
+		Account:    order.Account,
+	}
+	go c.trackOrder(s, sub, state, onStatus)
+	return orderID, nil
+}
+
+// trackOrder calls onStatus with each change of the order's status until it
+// is done or the session ends
+func (c *Client) trackOrder(s *session, sub *subscription, state OrderState, onStatus func(OrderState)) {
+	defer s.unsubscribe(sub)
+	for !state.Done() {
+		fields, err := s.next(context.Background(), sub)
+		var apiErr *APIError
+		switch {
+		case errors.As(err, &apiErr):
+			switch apiErr.Code {
+			case codeOrderRejected:
+				state.Status = OrderInactive
+			case codeOrderCancelled:
+				state.Status = OrderCancelled
+			}
+			state.Message = apiErr.Message
+		case err != nil:
+			return
+		case messageID(fields) == msgOrderStatus:
+			// Fields are the id, order id, status, filled, remaining and
+			// average fill price
+			r := newFieldReader(fields, 2)
+			status, filled, remaining, avgFillPrice := r.str(), r.float(), r.float(), r.float()
+			if status == state.Status && int(filled) == state.Filled && int(remaining) == state.Remaining {
+				continue
+			}
+			state.Status, state.Filled, state.Remaining, state.AvgFillPrice = status, int(filled), int(remaining), avgFillPrice
+		default:
+			continue
+		}
+		state.UpdatedAt = time.Now()
+		if onStatus != nil {
+			onStatus(state)
+		}
+	}
+}
+
+// OpenOrders returns the orders of every client of the account that TWS
+// still works on
+func (c *Client) OpenOrders(ctx context.Context) ([]OrderState, error) {
+	s, err := c.session(ConnectionTrading)
+	if err != nil {
+		return nil, err
+	}
+	sub := s.subscribe(nil, msgOpenOrder, msgOrderStatus, msgOpenOrderEnd)
+	if err := s.send(msgReqAllOpenOrders, 1); err != nil {
+		s.unsubscribe(sub)
+		return nil, err
+	}
+
+	// The legs are resolved once the orders are in, since a contract request
+	// waits for messages read after those of the orders
+	var orders []*OrderState
+	byID := make(map[int64]*OrderState)
+	legs := make(map[int64][]comboLeg)
+	for done := false; !done; {
+		fields, err := s.next(ctx, sub)
+		if err != nil {
+			s.unsubscribe(sub)
+			return nil, fmt.Errorf("open orders: %w", err)
+		}
+		switch messageID(fields) {
+		case msgOpenOrder:
+			decoded := decodeOpenOrder(fields)
+			if decoded.whatIf {
+				continue
+			}
+			state := byID[decoded.state.OrderID]
+			if state == nil {
+				state = &OrderState{}
+				orders = append(orders, state)
+				byID[decoded.state.OrderID] = state
+			}
+			status, filled := state.Status, state.Filled
+			*state = decoded.state
+			if status != "" {
+				state.Status, state.Filled = status, filled
+			}
+			legs[state.OrderID] = decoded.legs
+		case msgOrderStatus:
+			r := newFieldReader(fields, 1)
+			if state := byID[r.int64()]; state != nil {
+				state.Status, state.Filled, state.Remaining, state.AvgFillPrice = r.str(), int(r.float()), int(r.float()), r.float()
+			}
+		case msgOpenOrderEnd:
+			done = true
+		}
+	}
+	s.unsubscribe(sub)
+
+	result := make([]OrderState, 0, len(orders))
+	for _, state := range orders {
+		if state.Done() {
+			continue
+		}
+		if state.Legs, err = c.orderLegs(ctx, legs[state.OrderID]); err != nil {
+			return nil, err
+		}
+		result = append(result, *state)
+	}
+	return result, nil
+}
+
+// CancelOrder requests the cancellation of an open order; its status
+// becomes Cancelled once TWS has cancelled it
+func (c *Client) CancelOrder(ctx context.Context, orderID int64) error {
+	s, err := c.session(ConnectionTrading)
+	if err != nil {
+		return err
+	}
+	return s.send(msgCancelOrder, 1, orderID, "")
+}
+
+// comboLeg is a leg of a combo order as TWS reports it
+type comboLeg struct {
+	conID  int64
+	ratio  int
+	action string
+}
+
+// orderLegs returns the option legs of a combo order's legs
+func (c *Client) orderLegs(ctx context.Context, legs []comboLeg) ([]OptionLeg, error) {
+	result := make([]OptionLeg, 0, len(legs))
+	for _, leg := range legs {
+		contract, err := c.contractByID(ctx, leg.conID)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, OptionLeg{
+			Strike: contract.Strike,
+			Expiry: contract.Expiry,
+			Right:  contract.Right,
+			Action: leg.action,
+			Ratio:  leg.ratio,
+		})
+	}
+	return result, nil
+}
+
+// contractByID returns the contract of a contract id, looking it up with
+// reqContractData unless it was resolved before
+func (c *Client) contractByID(ctx context.Context, conID int64) (contractKey, error) {
+	c.contractsMu.Lock()
+	for key, id := range c.contracts {
+		if id == conID {
+			c.contractsMu.Unlock()
+			return key, nil
+		}
+	}
+	c.contractsMu.Unlock()
+
+	s, err := c.session(ConnectionTrading)
+	if err != nil {
+		return contractKey{}, err
+	}
+	_, sub, err := s.request(func(reqID int64) []interface{} {
+		return []interface{}{msgReqContractData, 8, reqID, conID, "", "", "", 0, "", "", "", "", "", "", "", 0, "", "", ""}
+	})
+	if err != nil {
+		return contractKey{}, err
+	}
+	defer s.unsubscribe(sub)
+
+	var key contractKey
+	for {
+		fields, err := s.next(ctx, sub)
+		if err != nil {
+			return contractKey{}, fmt.Errorf("contract %d: %w", conID, err)
+		}
+		if messageID(fields) == msgContractDataEnd {
+			break
+		}
+		r := newFieldReader(fields, 2)
+		key.Symbol = r.str()
+		r.skip(1)
+		key.Expiry = r.str()
+		if len(key.Expiry) > 8 {
+			key.Expiry = key.Expiry[:8]
+		}
+		key.Strike = r.float()
+		key.Right = normalizeRight(r.str())
+	}
+	if key.Symbol == "" {
+		return contractKey{}, fmt.Errorf("no contract %d", conID)
+	}
+
+	c.contractsMu.Lock()
+	c.contracts[key] = conID
+	c.contractsMu.Unlock()
+	return key, nil
+}
+
+// placeOrderFields returns the placeOrder message of a combo order with the
+// contract ids of its legs
+func (c *Client) placeOrderFields(ctx context.Context, s *session, orderID int64, order ComboOrder, whatIf bool) ([]interface{}, error) {
+	fields := []interface{}{msgPlaceOrder, orderID,
+		// Contract
+		0, order.Symbol, order.SecType, "", 0, "", "", order.Exchange, "", order.Currency, "", "", "", "",
+		// Main order fields
+		order.Action, order.Quantity, order.OrderType, number(order.LimitPrice, true), "",
+		// Extended order fields up to hidden, transmitted
+		order.TIF, "", order.Account, "", 0, "", 1, 0, 0, 0, 0, 0, 0, 0,
+		len(order.Legs),
+	}
+	for _, leg := range order.Legs {
+		conID, err := c.contractID(ctx, s, order.Symbol, OptionKey{Expiry: leg.Expiry, Strike: leg.Strike, Right: leg.Right})
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, conID, max(leg.Ratio, 1), leg.Action, order.Exchange, 0, 0, "", -1)
+	}
+
+	percentage := ""
+	if order.Percentage != 0 {
+		percentage = strconv.FormatFloat(order.Percentage, 'f', -1, 64)
+	}
+	fields = append(fields,
+		// Combo leg prices and smart combo routing parameters
+		0, 0,
+		// Shares allocation, discretionary amount, good after and till
+		"", 0, "", "",
+		// Financial advisor allocation and model code
+		order.Group, order.Method, percentage, order.Profile, "",
+		// Short sale slot, designated location and exempt code
+		0, "", -1,
+		// OCA type to override percentage constraints
+		0, "", "", 0, "", "", 0, 0, "", 0, "", "", "", "", "", 0,
+		// Volatility, continuous update and reference price type
+		"", "", "", "", 0, "",
+		// Trailing stop price and percent
+		"", "",
+		// Scale order fields and active times
+		"", "", "", "", "", "",
+		// Hedge type to algo id
+		"", 0, "", "", 0, 0, "", "",
+		flag(whatIf),
+		// Misc options to randomize price
+		"", 0, 0, 0,
+		// Conditions and adjusted order fields
+		0, "", "", "", "", "", "", 0,
+		// External operator, soft dollar tier and cash quantity
+		"", "", "", "",
+		// MiFID II fields
+		"", "", "", "",
+		// Don't use auto price for hedge to manual order time
+		0, 0, 0, "", "", "", 0, "", "",
+	)
+	return fields, nil
+}
+
+// openOrder is the part of an openOrder message Client reads
+type openOrder struct {
+	state  OrderState
+	legs   []comboLeg
+	whatIf bool
+	result WhatIfResult
+}
+
+// decodeOpenOrder reads an openOrder message of API version 176
+func decodeOpenOrder(fields []string) openOrder {
+	r := newFieldReader(fields, 1)
+	var order openOrder
+	order.state.OrderID = r.int64()
+
+	// Contract id, symbol, security type, expiry, strike, right, multiplier,
+	// exchange, currency, local symbol and trading class
+	r.skip(1)
+	order.state.Symbol = r.str()
+	r.skip(9)
+
+	// Action, quantity, order type, limit and aux price, TIF, OCA group and
+	// account, then the fields up to the trigger method
+	r.skip(1)
+	quantity := r.float()
+	r.skip(1)
+	order.state.LimitPrice = r.float()
+	r.skip(3)
+	order.state.Account = r.str()
+	order.state.Remaining = int(quantity)
+	r.skip(39)
+
+	// Volatility fields, with those of the delta neutral order when it has
+	// one, trailing stop and basis points
+	r.skip(2)
+	deltaNeutralType := r.str()
+	r.skip(1)
+	if deltaNeutralType != "" {
+		r.skip(8)
+	}
+	r.skip(2 + 2 + 2)
+
+	// Combo legs, their prices and the smart combo routing parameters
+	r.skip(1)
+	for n := r.int(); n > 0; n-- {
+		leg := comboLeg{conID: r.int64(), ratio: r.int(), action: r.str()}
+		r.skip(5)
+		order.legs = append(order.legs, leg)
+	}
+	r.skip(r.int())
+	r.skip(2 * r.int())
+
+	// Scale order fields, with the price increment's own when it is set
+	r.skip(2)
+	if r.float() > 0 {
+		r.skip(7)
+	}
+	if r.str() != "" {
+		r.skip(1) // hedge parameter
+	}
+	// Opt out of smart routing, clearing account and intent, not held
+	r.skip(4)
+	if r.bool() {
+		r.skip(3) // delta neutral contract
+	}
+	if r.str() != "" {
+		r.skip(2 * r.int()) // algo parameters
+	}
+	r.skip(1) // solicited
+
+	order.whatIf = r.bool()
+	order.state.Status = r.str()
+	// Initial and maintenance margin and equity with loan before, change
+	// and after
+	r.skip(2)
+	order.result.EquityWithLoanBefore = r.float()
+	order.result.InitMarginChange = r.float()
+	order.result.MaintMarginChange = r.float()
+	r.skip(4)
+	order.result.Commission = r.float()
+	r.skip(2)
+	order.result.CommissionCurrency = r.str()
+	order.result.WarningText = r.str()
+	return order
+}
@@ -0,0 +1,117 @@
+package journal
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tradeHeader is the CSV header row for trade history exports
+var tradeHeader = []string{
+	"id", "symbol", "strategy", "quantity", "entry_time", "entry_price", "max_loss",
+	"status", "exit_time", "exit_price", "realized_pl",
+}
+
+// ExportTrades writes the trades to path as CSV or indented JSON and returns the
+// number of rows exported. The file is written to a temp file and renamed into place.
+func ExportTrades(trades []TradeRecord, format, path string) (int, error) {
+	var content []byte
+
+	switch strings.ToLower(format) {
+	case "csv":
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		if err := w.Write(tradeHeader); err != nil {
+			return 0, fmt.Errorf("failed to encode CSV header: %w", err)
+		}
+		for _, trade := range trades {
+			if err := w.Write(tradeCSVRecord(trade)); err != nil {
+				return 0, fmt.Errorf("failed to encode trade %d: %w", trade.ID, err)
+			}
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return 0, fmt.Errorf("failed to encode CSV: %w", err)
+		}
+		content = buf.Bytes()
+	case "json":
+		if trades == nil {
+			trades = []TradeRecord{}
+		}
+		encoded, err := json.MarshalIndent(trades, "", "  ")
+		if err != nil {
+			return 0, fmt.Errorf("failed to encode trades: %w", err)
+		}
+		content = append(encoded, '\n')
+	default:
+		return 0, fmt.Errorf("unsupported export format: %s", format)
+	}
+
+	if err := writeFileAtomic(path, content); err != nil {
+		return 0, err
+	}
+	return len(trades), nil
+}
+
+// tradeCSVRecord renders a trade as a CSV row matching tradeHeader
+func tradeCSVRecord(trade TradeRecord) []string {
+	formatFloat := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	exitTime, exitPrice := "", ""
+	if trade.ExitTime != nil {
+		exitTime = trade.ExitTime.Format(time.RFC3339)
+		exitPrice = formatFloat(trade.ExitPrice)
+	}
+
+	return []string{
+		strconv.FormatInt(trade.ID, 10),
+		trade.Symbol,
+		trade.Strategy,
+		strconv.Itoa(trade.Quantity),
+		trade.EntryTime.Format(time.RFC3339),
+		formatFloat(trade.EntryPrice),
+		formatFloat(trade.MaxLoss),
+		trade.Status,
+		exitTime,
+		exitPrice,
+		formatFloat(trade.RealizedPL),
+	}
+}
+
+// writeFileAtomic writes content to a temp file next to path and renames it into place
+func writeFileAtomic(path string, content []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create export directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to close export: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to move export into place: %w", err)
+	}
+	return nil
+}
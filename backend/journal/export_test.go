@@ -0,0 +1,79 @@
+package journal
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestExportTradesCSVRoundTrip(t *testing.T) {
+	j, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to open journal: %v", err)
+	}
+
+	entry := time.Date(2024, 3, 5, 14, 30, 0, 0, time.UTC)
+	closed, _ := j.RecordTrade(TradeRecord{Symbol: "SPY", Strategy: `Bull "Put", Spread`, Quantity: 2, EntryTime: entry, EntryPrice: 1.25, MaxLoss: 750})
+	if _, err := j.UpdateTradeOutcome(closed.ID, 0.40, entry.Add(48*time.Hour)); err != nil {
+		t.Fatalf("UpdateTradeOutcome failed: %v", err)
+	}
+	if _, err := j.RecordTrade(TradeRecord{Symbol: "QQQ", Strategy: "LOW_BASE", Quantity: 1, EntryTime: entry, EntryPrice: -2.10}); err != nil {
+		t.Fatalf("RecordTrade failed: %v", err)
+	}
+
+	trades := j.GetTrades(TradeFilter{})
+	path := filepath.Join(t.TempDir(), "trades.csv")
+
+	count, err := ExportTrades(trades, "csv", path)
+	if err != nil {
+		t.Fatalf("ExportTrades failed: %v", err)
+	}
+	if count != len(trades) {
+		t.Fatalf("Row count: got %d, want %d", count, len(trades))
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open export: %v", err)
+	}
+	defer file.Close()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+	if len(records) != len(trades)+1 {
+		t.Fatalf("Record count: got %d, want %d", len(records), len(trades)+1)
+	}
+
+	for i, trade := range trades {
+		row := records[i+1]
+		if row[0] != strconv.FormatInt(trade.ID, 10) || row[1] != trade.Symbol || row[2] != trade.Strategy {
+			t.Errorf("Row %d identity mismatch: %q", i, row)
+		}
+
+		entryTime, err := time.Parse(time.RFC3339, row[4])
+		if err != nil || !entryTime.Equal(trade.EntryTime) {
+			t.Errorf("Row %d entry time mismatch: %q", i, row[4])
+		}
+
+		entryPrice, _ := strconv.ParseFloat(row[5], 64)
+		realized, _ := strconv.ParseFloat(row[10], 64)
+		if entryPrice != trade.EntryPrice || realized != trade.RealizedPL {
+			t.Errorf("Row %d price mismatch: %q", i, row)
+		}
+
+		if trade.ExitTime == nil && row[8] != "" {
+			t.Errorf("Row %d: open trade should have empty exit time, got %q", i, row[8])
+		}
+	}
+}
+
+func TestExportTradesRejectsUnknownFormat(t *testing.T) {
+	if _, err := ExportTrades(nil, "xlsx", filepath.Join(t.TempDir(), "trades.xlsx")); err == nil {
+		t.Error("Expected error for unsupported format")
+	}
+}
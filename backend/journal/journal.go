@@ -0,0 +1,316 @@
+package journal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"traderadmin/backend/ibkr"
+	"traderadmin/backend/models"
+)
+
+// Trade statuses
+const (
+	StatusOpen   = "OPEN"
+	StatusClosed = "CLOSED"
+)
+
+// Reasons of an ExitDecision
+const (
+	ExitTargetProfit = "target_profit"
+	ExitStopLoss     = "stop_loss"
+)
+
+// Actions of an ExitDecision
+const (
+	ExitAlerted     = "alerted"
+	ExitOrderPlaced = "order_placed"
+	ExitOrderFailed = "order_failed"
+)
+
+// contractMultiplier converts per-share option prices into dollars per contract
+const contractMultiplier = 100
+
+// TradeRecord is a single executed spread and its eventual outcome. Prices are
+// per spread: EntryPrice is the net credit received (negative for a debit) and
+// ExitPrice is the net debit paid to close (negative for a credit).
+type TradeRecord struct {
+	ID         int64            `json:"id"`
+	Symbol     string           `json:"symbol"`
+	Strategy   string           `json:"strategy"`
+	Legs       []ibkr.OptionLeg `json:"legs"`
+	Quantity   int              `json:"quantity"`
+	EntryTime  time.Time        `json:"entryTime"`
+	EntryPrice float64          `json:"entryPrice"`
+	MaxLoss    float64          `json:"maxLoss"`
+	Status     string           `json:"status"`
+	ExitTime   *time.Time       `json:"exitTime,omitempty"`
+	ExitPrice  float64          `json:"exitPrice,omitempty"`
+	RealizedPL float64          `json:"realizedPl"`
+
+	ExitDecisions []ExitDecision `json:"exitDecisions,omitempty"`
+}
+
+// ExitDecision is what the exit manager did when an open trade crossed its
+// profit target or stop loss. Price is the net debit to close the spread at
+// the mid price, negative for a credit, like ExitPrice.
+type ExitDecision struct {
+	Time       time.Time `json:"time"`
+	Reason     string    `json:"reason"`
+	Action     string    `json:"action"`
+	ProfitPct  float64   `json:"profitPct"` // of the max profit, negative at a loss
+	LossPct    float64   `json:"lossPct"`   // of the max loss, 0 at a profit
+	Price      float64   `json:"price"`
+	LimitPrice float64   `json:"limitPrice,omitempty"` // of the closing order
+	OrderID    int64     `json:"orderId,omitempty"`
+	Detail     string    `json:"detail,omitempty"`
+}
+
+// TradeFilter selects trades from the journal; zero values match everything
+type TradeFilter struct {
+	Symbol   string    `json:"symbol"`
+	Strategy string    `json:"strategy"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Outcome  string    `json:"outcome"` // "win", "loss", "open" or empty
+}
+
+// Journal is a durable record of executed trades stored as a JSON file
+type Journal struct {
+	mu     sync.Mutex
+	path   string
+	trades []TradeRecord
+	nextID int64
+}
+
+// Open loads the trade journal from trade_journal.json in the given directory
+func Open(dir string) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create journal directory: %w", err)
+	}
+
+	j := &Journal{
+		path:   filepath.Join(dir, "trade_journal.json"),
+		nextID: 1,
+	}
+
+	content, err := os.ReadFile(j.path)
+	if os.IsNotExist(err) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trade journal: %w", err)
+	}
+
+	if err := json.Unmarshal(content, &j.trades); err != nil {
+		return nil, fmt.Errorf("failed to decode trade journal: %w", err)
+	}
+	for _, trade := range j.trades {
+		if trade.ID >= j.nextID {
+			j.nextID = trade.ID + 1
+		}
+	}
+
+	return j, nil
+}
+
+// RecordTrade adds a newly executed trade to the journal and returns it with its assigned ID
+func (j *Journal) RecordTrade(entry TradeRecord) (TradeRecord, error) {
+	if strings.TrimSpace(entry.Symbol) == "" {
+		return TradeRecord{}, fmt.Errorf("symbol is required")
+	}
+	if entry.Quantity <= 0 {
+		return TradeRecord{}, fmt.Errorf("quantity must be positive")
+	}
+	if entry.EntryTime.IsZero() {
+		entry.EntryTime = time.Now()
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entry.ID = j.nextID
+	entry.Status = StatusOpen
+	entry.ExitTime = nil
+	entry.ExitPrice = 0
+	entry.RealizedPL = 0
+	entry.ExitDecisions = nil
+
+	j.trades = append(j.trades, entry)
+	if err := j.save(); err != nil {
+		j.trades = j.trades[:len(j.trades)-1]
+		return TradeRecord{}, err
+	}
+	j.nextID++
+
+	return entry, nil
+}
+
+// UpdateTradeOutcome closes a trade at the given exit price and computes its realized P&L
+func (j *Journal) UpdateTradeOutcome(id int64, exitPrice float64, exitTime time.Time) (TradeRecord, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for i := range j.trades {
+		if j.trades[i].ID != id {
+			continue
+		}
+
+		previous := j.trades[i]
+		trade := &j.trades[i]
+		trade.Status = StatusClosed
+		trade.ExitTime = &exitTime
+		trade.ExitPrice = exitPrice
+		trade.RealizedPL = (trade.EntryPrice - exitPrice) * float64(trade.Quantity*contractMultiplier)
+
+		if err := j.save(); err != nil {
+			j.trades[i] = previous
+			return TradeRecord{}, err
+		}
+		return *trade, nil
+	}
+
+	return TradeRecord{}, fmt.Errorf("trade %d not found", id)
+}
+
+// RecordExitDecision adds an exit decision to an open trade
+func (j *Journal) RecordExitDecision(id int64, decision ExitDecision) (TradeRecord, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for i := range j.trades {
+		if j.trades[i].ID != id {
+			continue
+		}
+		if j.trades[i].Status != StatusOpen {
+			return TradeRecord{}, fmt.Errorf("trade %d is closed", id)
+		}
+
+		trade := &j.trades[i]
+		trade.ExitDecisions = append(trade.ExitDecisions, decision)
+		if err := j.save(); err != nil {
+			trade.ExitDecisions = trade.ExitDecisions[:len(trade.ExitDecisions)-1]
+			return TradeRecord{}, err
+		}
+		return *trade, nil
+	}
+
+	return TradeRecord{}, fmt.Errorf("trade %d not found", id)
+}
+
+// GetTrades returns the trades matching the filter in entry order
+func (j *Journal) GetTrades(filter TradeFilter) []TradeRecord {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var result []TradeRecord
+	for _, trade := range j.trades {
+		if filter.matches(trade) {
+			result = append(result, trade)
+		}
+	}
+	return result
+}
+
+// StatsForDay computes trade statistics for the calendar day containing day, in
+// day's location. Trades entered that day count as executed; trades closed that
+// day count towards the win/loss figures.
+func (j *Journal) StatsForDay(day time.Time) models.TradeStatsToday {
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	end := start.AddDate(0, 0, 1)
+	inDay := func(t time.Time) bool {
+		return !t.Before(start) && t.Before(end)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var stats models.TradeStatsToday
+	var totalWin, totalLoss float64
+	for _, trade := range j.trades {
+		if inDay(trade.EntryTime) {
+			stats.ExecutedCount++
+		}
+		if trade.Status != StatusClosed || trade.ExitTime == nil || !inDay(*trade.ExitTime) {
+			continue
+		}
+
+		if trade.RealizedPL > 0 {
+			stats.WinCount++
+			totalWin += trade.RealizedPL
+		} else {
+			stats.LossCount++
+			totalLoss += trade.RealizedPL
+		}
+	}
+
+	if closed := stats.WinCount + stats.LossCount; closed > 0 {
+		stats.WinRate = float64(stats.WinCount) / float64(closed)
+	}
+	if stats.WinCount > 0 {
+		stats.AvgWinAmount = totalWin / float64(stats.WinCount)
+	}
+	if stats.LossCount > 0 {
+		stats.AvgLossAmount = totalLoss / float64(stats.LossCount)
+	}
+
+	return stats
+}
+
+// save writes the journal to a temp file, syncs it and renames it into place;
+// callers must hold the lock
+func (j *Journal) save() error {
+	content, err := json.MarshalIndent(j.trades, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode trade journal: %w", err)
+	}
+
+	tmpPath := j.path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create trade journal: %w", err)
+	}
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write trade journal: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to sync trade journal: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close trade journal: %w", err)
+	}
+
+	return os.Rename(tmpPath, j.path)
+}
+
+// matches reports whether the trade satisfies the filter
+func (f TradeFilter) matches(trade TradeRecord) bool {
+	if f.Symbol != "" && !strings.EqualFold(f.Symbol, trade.Symbol) {
+		return false
+	}
+	if f.Strategy != "" && !strings.EqualFold(f.Strategy, trade.Strategy) {
+		return false
+	}
+	if !f.From.IsZero() && trade.EntryTime.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && trade.EntryTime.After(f.To) {
+		return false
+	}
+
+	switch strings.ToLower(f.Outcome) {
+	case "win":
+		return trade.Status == StatusClosed && trade.RealizedPL > 0
+	case "loss":
+		return trade.Status == StatusClosed && trade.RealizedPL <= 0
+	case "open":
+		return trade.Status == StatusOpen
+	}
+	return true
+}
@@ -0,0 +1,148 @@
+package journal
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestJournalConcurrentWrites(t *testing.T) {
+	dir := t.TempDir()
+	j, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open journal: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			_, err := j.RecordTrade(TradeRecord{Symbol: fmt.Sprintf("SYM%d", n), Strategy: "HIGH_BASE", Quantity: 1, EntryPrice: 1.0})
+			if err != nil {
+				t.Errorf("RecordTrade failed: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	reloaded, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reload journal: %v", err)
+	}
+
+	trades := reloaded.GetTrades(TradeFilter{})
+	if len(trades) != 20 {
+		t.Fatalf("Trade count after reload: got %d, want 20", len(trades))
+	}
+
+	seen := make(map[int64]bool)
+	for _, trade := range trades {
+		if seen[trade.ID] {
+			t.Errorf("Duplicate trade ID %d", trade.ID)
+		}
+		seen[trade.ID] = true
+	}
+
+	next, err := reloaded.RecordTrade(TradeRecord{Symbol: "NEXT", Quantity: 1})
+	if err != nil {
+		t.Fatalf("RecordTrade failed: %v", err)
+	}
+	if next.ID != 21 {
+		t.Errorf("Next ID after reload: got %d, want 21", next.ID)
+	}
+}
+
+func TestJournalStatsAcrossDayBoundary(t *testing.T) {
+	j, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to open journal: %v", err)
+	}
+
+	yesterday := time.Date(2024, 3, 4, 23, 50, 0, 0, time.UTC)
+	today := time.Date(2024, 3, 5, 10, 0, 0, 0, time.UTC)
+
+	// Entered yesterday, closed today for a win
+	overnight, _ := j.RecordTrade(TradeRecord{Symbol: "SPY", Strategy: "HIGH_BASE", Quantity: 2, EntryTime: yesterday, EntryPrice: 1.50})
+	if _, err := j.UpdateTradeOutcome(overnight.ID, 0.50, today); err != nil {
+		t.Fatalf("UpdateTradeOutcome failed: %v", err)
+	}
+
+	// Entered and closed today for a loss
+	intraday, _ := j.RecordTrade(TradeRecord{Symbol: "QQQ", Strategy: "LOW_BASE", Quantity: 1, EntryTime: today, EntryPrice: 1.00})
+	if _, err := j.UpdateTradeOutcome(intraday.ID, 2.50, today.Add(time.Hour)); err != nil {
+		t.Fatalf("UpdateTradeOutcome failed: %v", err)
+	}
+
+	// Entered today, still open
+	if _, err := j.RecordTrade(TradeRecord{Symbol: "IWM", Strategy: "HIGH_BASE", Quantity: 1, EntryTime: today}); err != nil {
+		t.Fatalf("RecordTrade failed: %v", err)
+	}
+
+	stats := j.StatsForDay(today)
+	if stats.ExecutedCount != 2 {
+		t.Errorf("ExecutedCount: got %d, want 2", stats.ExecutedCount)
+	}
+	if stats.WinCount != 1 || stats.LossCount != 1 {
+		t.Errorf("Win/Loss count: got %d/%d, want 1/1", stats.WinCount, stats.LossCount)
+	}
+	if stats.WinRate != 0.5 {
+		t.Errorf("WinRate: got %v, want 0.5", stats.WinRate)
+	}
+	if stats.AvgWinAmount != 200 {
+		t.Errorf("AvgWinAmount: got %v, want 200", stats.AvgWinAmount)
+	}
+	if stats.AvgLossAmount != -150 {
+		t.Errorf("AvgLossAmount: got %v, want -150", stats.AvgLossAmount)
+	}
+
+	previous := j.StatsForDay(yesterday)
+	if previous.ExecutedCount != 1 || previous.WinCount != 0 {
+		t.Errorf("Yesterday stats: got executed=%d wins=%d, want 1/0", previous.ExecutedCount, previous.WinCount)
+	}
+
+	wins := j.GetTrades(TradeFilter{Outcome: "win"})
+	if len(wins) != 1 || wins[0].Symbol != "SPY" {
+		t.Errorf("Unexpected win filter result: %v", wins)
+	}
+	highBase := j.GetTrades(TradeFilter{Strategy: "high_base", From: today})
+	if len(highBase) != 1 || highBase[0].Symbol != "IWM" {
+		t.Errorf("Unexpected strategy/date filter result: %v", highBase)
+	}
+}
+
+func TestJournalRecordExitDecision(t *testing.T) {
+	dir := t.TempDir()
+	j, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open journal: %v", err)
+	}
+	trade, err := j.RecordTrade(TradeRecord{Symbol: "SPY", Quantity: 1, EntryPrice: 1.25})
+	if err != nil {
+		t.Fatalf("RecordTrade failed: %v", err)
+	}
+
+	decision := ExitDecision{Time: time.Now(), Reason: ExitTargetProfit, Action: ExitAlerted, ProfitPct: 52, Price: 0.6}
+	if _, err := j.RecordExitDecision(trade.ID, decision); err != nil {
+		t.Fatalf("RecordExitDecision failed: %v", err)
+	}
+	reloaded, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to reload journal: %v", err)
+	}
+	decisions := reloaded.GetTrades(TradeFilter{})[0].ExitDecisions
+	if len(decisions) != 1 || decisions[0].Reason != ExitTargetProfit || decisions[0].ProfitPct != 52 {
+		t.Errorf("Exit decisions after reload: got %+v", decisions)
+	}
+
+	if _, err := j.UpdateTradeOutcome(trade.ID, 0.6, time.Now()); err != nil {
+		t.Fatalf("UpdateTradeOutcome failed: %v", err)
+	}
+	if _, err := j.RecordExitDecision(trade.ID, decision); err == nil {
+		t.Error("Expected an exit decision for a closed trade to be refused")
+	}
+	if _, err := j.RecordExitDecision(99, decision); err == nil {
+		t.Error("Expected an exit decision for an unknown trade to be refused")
+	}
+}
@@ -10,6 +10,7 @@ type PortfolioMetrics struct {
 	UnrealizedPNL      float64   `json:"unrealizedPnl"`
 	OpenPositionsCount int       `json:"openPositionsCount"`
 	BuyingPower        float64   `json:"buyingPower"`
+	AccountCode        string    `json:"accountCode"` // IBKR account the metrics are for
 }
 
 // TradeStatsToday contains aggregated trade statistics for the current day
@@ -17,7 +18,7 @@ type TradeStatsToday struct {
 	ExecutedCount int     `json:"executedCount"`
 	WinCount      int     `json:"winCount"`
 	LossCount     int     `json:"lossCount"`
-	WinRate       float64 `json:"winRate"` // Calculated: WinCount / ExecutedCount
+	WinRate       float64 `json:"winRate"` // Calculated: WinCount / (WinCount + LossCount)
 	AvgWinAmount  float64 `json:"avgWinAmount"`
 	AvgLossAmount float64 `json:"avgLossAmount"`
 }
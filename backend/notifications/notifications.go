@@ -0,0 +1,296 @@
+// Package notifications keeps the events of TraderAdmin's notification
+// center: a bounded history of alerts, operations, config warnings, schedule
+// transitions and connection changes, persisted to a JSONL file
+package notifications
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Severities of an event, from the least to the most severe
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Categories of an event
+const (
+	CategoryAlert      = "alert"
+	CategoryOperation  = "operation"
+	CategoryConfig     = "config"
+	CategorySchedule   = "schedule"
+	CategoryConnection = "connection"
+)
+
+// Defaults of a Retention left at zero
+const (
+	DefaultMaxEvents = 500
+	DefaultMaxAge    = 30 * 24 * time.Hour
+)
+
+// fileName is the store's file in its directory
+const fileName = "notifications.jsonl"
+
+// maxLineBytes bounds a line of the file, an event with its payload
+const maxLineBytes = 1 << 20
+
+// NotificationEvent is an entry of the notification center. Payload is the
+// data the event is about, such as the alert or the operation report, and
+// is nil when the message says it all.
+type NotificationEvent struct {
+	ID       int64       `json:"id"`
+	Time     time.Time   `json:"time"`
+	Severity string      `json:"severity"`
+	Category string      `json:"category"`
+	Message  string      `json:"message"`
+	Payload  interface{} `json:"payload,omitempty"`
+	Read     bool        `json:"read"`
+}
+
+// Retention bounds the events kept: at most MaxEvents, none older than
+// MaxAge. Zero values use the defaults.
+type Retention struct {
+	MaxEvents int
+	MaxAge    time.Duration
+}
+
+// withDefaults fills in the zero bounds
+func (r Retention) withDefaults() Retention {
+	if r.MaxEvents <= 0 {
+		r.MaxEvents = DefaultMaxEvents
+	}
+	if r.MaxAge <= 0 {
+		r.MaxAge = DefaultMaxAge
+	}
+	return r
+}
+
+// Store keeps the events, oldest first, in a ring bounded by its retention.
+// New events are appended to notifications.jsonl; the file is rewritten with
+// the retained events when they are marked read or once it holds twice the
+// most events retained.
+type Store struct {
+	mu        sync.Mutex
+	path      string
+	retention Retention
+	events    []NotificationEvent
+	nextID    int64
+	// lines is the number of events in the file
+	lines int
+	now   func() time.Time
+}
+
+// Open loads the events retained from notifications.jsonl in the given
+// directory. Lines that do not parse are skipped.
+func Open(dir string, retention Retention) (*Store, error) {
+	return open(dir, retention, time.Now)
+}
+
+// open is Open with the clock of the store
+func open(dir string, retention Retention, now func() time.Time) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create notification directory: %w", err)
+	}
+
+	s := &Store{path: filepath.Join(dir, fileName), retention: retention.withDefaults(), nextID: 1, now: now}
+	content, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notifications: %w", err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, maxLineBytes)
+	for scanner.Scan() {
+		var event NotificationEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+		s.events = append(s.events, event)
+		s.lines++
+		if event.ID >= s.nextID {
+			s.nextID = event.ID + 1
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read notifications: %w", err)
+	}
+	s.prune()
+	return s, nil
+}
+
+// SetRetention changes the bounds, dropping the events now beyond them
+func (s *Store) SetRetention(retention Retention) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retention = retention.withDefaults()
+	if s.prune() {
+		return s.rewrite()
+	}
+	return nil
+}
+
+// Append records an event, unread, numbering it and timestamping it when its
+// time is unset, and returns it as recorded. The event is kept in memory
+// even when writing it fails.
+func (s *Store) Append(event NotificationEvent) (NotificationEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event.ID = s.nextID
+	s.nextID++
+	if event.Time.IsZero() {
+		event.Time = s.now().UTC()
+	}
+	event.Read = false
+	if event.Severity == "" {
+		event.Severity = SeverityInfo
+	}
+	s.events = append(s.events, event)
+	s.prune()
+
+	// Compact the file once it holds twice the events retained at most
+	if s.lines >= 2*s.retention.MaxEvents {
+		return event, s.rewrite()
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		return event, fmt.Errorf("failed to encode notification: %w", err)
+	}
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return event, fmt.Errorf("failed to write notification: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return event, fmt.Errorf("failed to write notification: %w", err)
+	}
+	s.lines++
+	return event, nil
+}
+
+// List returns the events after since, or all retained events when it is
+// zero, at minSeverity or above, newest first and at most limit of them
+// when limit is above zero. An empty minSeverity matches every event.
+func (s *Store) List(since time.Time, minSeverity string, limit int) ([]NotificationEvent, error) {
+	rank, err := severityRank(minSeverity)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := []NotificationEvent{}
+	for i := len(s.events) - 1; i >= 0; i-- {
+		event := s.events[i]
+		if limit > 0 && len(events) == limit {
+			break
+		}
+		if !since.IsZero() && !event.Time.After(since) {
+			break
+		}
+		if r, _ := severityRank(event.Severity); r >= rank {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// MarkRead marks the events of ids read, or every event when ids is empty,
+// and returns how many were unread
+func (s *Store) MarkRead(ids []int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	marked := 0
+	for i := range s.events {
+		if !s.events[i].Read && (len(ids) == 0 || slices.Contains(ids, s.events[i].ID)) {
+			s.events[i].Read = true
+			marked++
+		}
+	}
+	if marked == 0 {
+		return 0, nil
+	}
+	return marked, s.rewrite()
+}
+
+// Unread returns the number of unread events
+func (s *Store) Unread() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unread := 0
+	for _, event := range s.events {
+		if !event.Read {
+			unread++
+		}
+	}
+	return unread
+}
+
+// prune drops the events beyond the retention, the oldest first, and
+// reports whether it dropped any
+func (s *Store) prune() bool {
+	before := len(s.events)
+	cutoff := s.now().Add(-s.retention.MaxAge)
+	first := 0
+	for first < len(s.events) && s.events[first].Time.Before(cutoff) {
+		first++
+	}
+	first = max(first, len(s.events)-s.retention.MaxEvents)
+	if first > 0 {
+		s.events = slices.Clone(s.events[first:])
+	}
+	return len(s.events) != before
+}
+
+// rewrite writes the retained events to a temporary file and renames it over
+// the store's file
+func (s *Store) rewrite() error {
+	var content bytes.Buffer
+	for _, event := range s.events {
+		line, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to encode notification: %w", err)
+		}
+		content.Write(line)
+		content.WriteByte('\n')
+	}
+
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, content.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write notifications: %w", err)
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return fmt.Errorf("failed to write notifications: %w", err)
+	}
+	s.lines = len(s.events)
+	return nil
+}
+
+// severityRank orders the severities, "" below them all
+func severityRank(severity string) (int, error) {
+	switch strings.ToLower(severity) {
+	case "":
+		return 0, nil
+	case SeverityInfo:
+		return 1, nil
+	case SeverityWarning:
+		return 2, nil
+	case SeverityCritical:
+		return 3, nil
+	}
+	return 0, fmt.Errorf("unknown severity %q, want %s, %s or %s", severity, SeverityInfo, SeverityWarning, SeverityCritical)
+}
@@ -0,0 +1,175 @@
+package notifications
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// openAt opens a store in dir whose clock reads *now
+func openAt(t *testing.T, dir string, retention Retention, now *time.Time) *Store {
+	t.Helper()
+	store, err := open(dir, retention, func() time.Time { return *now })
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestStorePersistsAcrossRestart(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 7, 2, 14, 0, 0, 0, time.UTC)
+	store := openAt(t, dir, Retention{}, &now)
+
+	first, err := store.Append(NotificationEvent{Severity: SeverityWarning, Category: CategoryAlert, Message: "Order latency high", Payload: map[string]string{"rule": "order_latency"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Minute)
+	if _, err := store.Append(NotificationEvent{Category: CategorySchedule, Message: "Trading hours started"}); err != nil {
+		t.Fatal(err)
+	}
+	if marked, err := store.MarkRead([]int64{first.ID}); err != nil || marked != 1 {
+		t.Fatalf("MarkRead() = %d, %v; want 1", marked, err)
+	}
+	now = now.Add(time.Minute)
+	if _, err := store.Append(NotificationEvent{Severity: SeverityCritical, Category: CategoryConnection, Message: "IBKR trading connection lost"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A line cut short by a crash is skipped
+	file, err := os.OpenFile(filepath.Join(dir, fileName), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"id":9,"mess`)
+	file.Close()
+
+	reopened := openAt(t, dir, Retention{}, &now)
+	events, err := reopened.List(time.Time{}, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 || events[0].ID != 3 || events[2].ID != first.ID || events[1].Severity != SeverityInfo {
+		t.Fatalf("List() after reopening = %+v, want events 3, 2 and 1", events)
+	}
+	if !events[2].Read || events[1].Read || reopened.Unread() != 2 {
+		t.Errorf("Read = %v, %v with %d unread; want only event 1 read", events[2].Read, events[1].Read, reopened.Unread())
+	}
+	if payload, ok := events[2].Payload.(map[string]interface{}); !ok || payload["rule"] != "order_latency" {
+		t.Errorf("Payload = %#v, want the rule", events[2].Payload)
+	}
+
+	// Numbering continues after the events loaded
+	if event, _ := reopened.Append(NotificationEvent{Message: "next"}); event.ID != 4 {
+		t.Errorf("ID after reopening = %d, want 4", event.ID)
+	}
+}
+
+func TestStoreMarkRead(t *testing.T) {
+	now := time.Date(2024, 7, 2, 14, 0, 0, 0, time.UTC)
+	dir := t.TempDir()
+	store := openAt(t, dir, Retention{}, &now)
+	for _, message := range []string{"a", "b", "c"} {
+		store.Append(NotificationEvent{Message: message})
+	}
+
+	if marked, _ := store.MarkRead([]int64{2, 2, 99}); marked != 1 || store.Unread() != 2 {
+		t.Errorf("MarkRead(2) = %d with %d unread, want 1 with 2", marked, store.Unread())
+	}
+	if marked, _ := store.MarkRead([]int64{2}); marked != 0 {
+		t.Errorf("MarkRead(2) again = %d, want 0", marked)
+	}
+	if marked, _ := store.MarkRead(nil); marked != 2 || store.Unread() != 0 {
+		t.Errorf("MarkRead(all) = %d with %d unread, want 2 with none", marked, store.Unread())
+	}
+
+	// New events are unread whatever they were appended as
+	store.Append(NotificationEvent{Message: "d", Read: true})
+	if store.Unread() != 1 {
+		t.Errorf("Unread() = %d, want the new event", store.Unread())
+	}
+	if reopened := openAt(t, dir, Retention{}, &now); reopened.Unread() != 1 {
+		t.Errorf("Unread() after reopening = %d, want 1", reopened.Unread())
+	}
+}
+
+func TestStoreList(t *testing.T) {
+	now := time.Date(2024, 7, 2, 14, 0, 0, 0, time.UTC)
+	start := now
+	store := openAt(t, t.TempDir(), Retention{}, &now)
+	for _, severity := range []string{SeverityInfo, SeverityCritical, SeverityWarning, SeverityInfo} {
+		now = now.Add(time.Minute)
+		store.Append(NotificationEvent{Severity: severity})
+	}
+
+	ids := func(events []NotificationEvent, err error) []int64 {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []int64
+		for _, event := range events {
+			ids = append(ids, event.ID)
+		}
+		return ids
+	}
+	for _, tc := range []struct {
+		since    time.Time
+		severity string
+		limit    int
+		want     []int64
+	}{
+		{want: []int64{4, 3, 2, 1}},
+		{severity: "Warning", want: []int64{3, 2}},
+		{severity: SeverityCritical, want: []int64{2}},
+		{limit: 2, want: []int64{4, 3}},
+		{since: start.Add(2 * time.Minute), want: []int64{4, 3}},
+		{since: start.Add(time.Minute), severity: SeverityWarning, limit: 1, want: []int64{3}},
+	} {
+		if got := ids(store.List(tc.since, tc.severity, tc.limit)); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("List(%v, %q, %d) = %v, want %v", tc.since.Format(time.Kitchen), tc.severity, tc.limit, got, tc.want)
+		}
+	}
+	if _, err := store.List(time.Time{}, "loud", 0); err == nil {
+		t.Error("List(loud) succeeded, want an unknown severity error")
+	}
+}
+
+func TestStoreRetention(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 7, 2, 14, 0, 0, 0, time.UTC)
+	store := openAt(t, dir, Retention{MaxEvents: 3, MaxAge: 24 * time.Hour}, &now)
+	for i := 0; i < 7; i++ {
+		now = now.Add(time.Hour)
+		store.Append(NotificationEvent{Message: "event"})
+	}
+
+	// At most three are kept, and the file holding six is compacted by the
+	// seventh
+	events, _ := store.List(time.Time{}, "", 0)
+	if len(events) != 3 || events[2].ID != 5 {
+		t.Errorf("Events = %d from %d, want 3 from 5", len(events), events[len(events)-1].ID)
+	}
+	if store.lines != 3 {
+		t.Errorf("Lines = %d, want 3 after compacting", store.lines)
+	}
+
+	// Events older than the most age are dropped, as they load too
+	now = now.Add(23*time.Hour + 30*time.Minute)
+	reopened := openAt(t, dir, Retention{MaxEvents: 3, MaxAge: 24 * time.Hour}, &now)
+	if events, _ := reopened.List(time.Time{}, "", 0); len(events) != 1 || events[0].ID != 7 {
+		t.Errorf("Events after a day = %+v, want only 7", events)
+	}
+
+	// A smaller retention drops events at once
+	reopened.Append(NotificationEvent{Message: "new"})
+	if err := reopened.SetRetention(Retention{MaxEvents: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if again := openAt(t, dir, Retention{MaxEvents: 1}, &now); again.Unread() != 1 {
+		t.Errorf("Unread() after shrinking = %d, want 1", again.Unread())
+	}
+}
@@ -0,0 +1,258 @@
+package options
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"traderadmin/backend/ibkr"
+)
+
+// ErrInvalidPageToken is returned for a page token that was not issued for
+// the same filter and the same fetch of the chain
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+// Chain page sizes
+const (
+	DefaultChainPageSize = 100
+	MaxChainPageSize     = 1000
+)
+
+// Sort fields of a chain page
+const (
+	SortExpiry       = "expiry"
+	SortStrike       = "strike"
+	SortDelta        = "delta"
+	SortOpenInterest = "openInterest"
+	SortSpreadPct    = "spreadPct"
+	SortImpliedVol   = "impliedVol"
+)
+
+// ChainFilter selects and orders the contracts of an option chain for
+// display. Zero bounds are open.
+type ChainFilter struct {
+	MinExpiry string  `json:"minExpiry"` // YYYYMMDD, inclusive
+	MaxExpiry string  `json:"maxExpiry"`
+	MinStrike float64 `json:"minStrike"`
+	MaxStrike float64 `json:"maxStrike"`
+	// Band on the absolute delta, e.g. 0.15 to 0.35
+	MinAbsDelta float64 `json:"minAbsDelta"`
+	MaxAbsDelta float64 `json:"maxAbsDelta"`
+	// Right is "C", "P" or empty for both
+	Right           string  `json:"right"`
+	MinOpenInterest int     `json:"minOpenInterest"`
+	MaxSpreadPct    float64 `json:"maxSpreadPct"`
+
+	// SortBy is one of the Sort fields, expiry when empty. Ties are broken by
+	// expiry, strike and right so that pages are stable.
+	SortBy     string `json:"sortBy"`
+	Descending bool   `json:"descending"`
+	// PageToken is the NextPageToken of the previous page, empty for the first
+	PageToken string `json:"pageToken"`
+	PageSize  int    `json:"pageSize"`
+}
+
+// ChainPage is one page of the contracts passing a ChainFilter
+type ChainPage struct {
+	Symbol          string                `json:"symbol"`
+	UnderlyingPrice float64               `json:"underlyingPrice"`
+	Truncated       bool                  `json:"truncated"`
+	FetchedAt       time.Time             `json:"fetchedAt"`
+	Contracts       []ibkr.OptionContract `json:"contracts"`
+	// Total is the number of contracts passing the filter across all pages
+	Total int `json:"total"`
+	// NextPageToken fetches the next page, empty on the last one
+	NextPageToken string          `json:"nextPageToken"`
+	Rejections    []RejectionStat `json:"rejections"`
+}
+
+// FilterChainContract reports whether a contract passes the display filter
+// and the reasons it does not. Open interest and the bid-ask spread are
+// checked by FilterOption.
+func FilterChainContract(contract ibkr.OptionContract, filter ChainFilter) (bool, []RejectionReason) {
+	leg := fmt.Sprintf("%g%s", contract.Strike, contract.Right)
+	var reasons []RejectionReason
+	reject := func(code RejectionCode, value, threshold float64, format string, args ...interface{}) {
+		reasons = append(reasons, RejectionReason{
+			Code: code, Leg: leg, Value: value, Threshold: threshold, Message: leg + " " + fmt.Sprintf(format, args...),
+		})
+	}
+
+	if filter.Right != "" && !strings.EqualFold(contract.Right, filter.Right) {
+		reject(RejectOptionType, 0, 0, "is not of type %s", strings.ToUpper(filter.Right))
+	}
+	if filter.MinExpiry != "" && contract.Expiry < filter.MinExpiry {
+		reject(RejectExpiryOutOfRange, 0, 0, "expiry %s before %s", contract.Expiry, filter.MinExpiry)
+	} else if filter.MaxExpiry != "" && contract.Expiry > filter.MaxExpiry {
+		reject(RejectExpiryOutOfRange, 0, 0, "expiry %s after %s", contract.Expiry, filter.MaxExpiry)
+	}
+	if filter.MinStrike > 0 && contract.Strike < filter.MinStrike {
+		reject(RejectStrikeOutOfRange, contract.Strike, filter.MinStrike, "strike below %g", filter.MinStrike)
+	} else if filter.MaxStrike > 0 && contract.Strike > filter.MaxStrike {
+		reject(RejectStrikeOutOfRange, contract.Strike, filter.MaxStrike, "strike above %g", filter.MaxStrike)
+	}
+	delta := math.Abs(contract.Delta)
+	if filter.MinAbsDelta > 0 && delta < filter.MinAbsDelta {
+		reject(RejectDeltaOutOfRange, delta, filter.MinAbsDelta, "delta %.2f below %.2f", delta, filter.MinAbsDelta)
+	} else if filter.MaxAbsDelta > 0 && delta > filter.MaxAbsDelta {
+		reject(RejectDeltaOutOfRange, delta, filter.MaxAbsDelta, "delta %.2f above %.2f", delta, filter.MaxAbsDelta)
+	}
+
+	_, liquidity := FilterOption(contract, SpreadFilters{
+		MinOpenInterest:           filter.MinOpenInterest,
+		MaxBidAskSpreadPercentage: filter.MaxSpreadPct,
+	})
+	reasons = append(reasons, liquidity...)
+	return len(reasons) == 0, reasons
+}
+
+// FilterChain returns the page of the chain's contracts passing filter that
+// filter.PageToken points at, along with how many contracts each filter
+// rejected. Identical requests against the same fetch of the chain return the
+// same pages and tokens.
+func FilterChain(chain ibkr.OptionChain, filter ChainFilter) (ChainPage, error) {
+	// Accept the YYYY-MM-DD dates of date inputs
+	filter.MinExpiry = strings.ReplaceAll(filter.MinExpiry, "-", "")
+	filter.MaxExpiry = strings.ReplaceAll(filter.MaxExpiry, "-", "")
+
+	compare, err := chainSortFunc(filter.SortBy)
+	if err != nil {
+		return ChainPage{}, err
+	}
+	pageSize := filter.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultChainPageSize
+	}
+	if pageSize > MaxChainPageSize {
+		pageSize = MaxChainPageSize
+	}
+	offset, err := decodePageToken(filter.PageToken, chain, filter)
+	if err != nil {
+		return ChainPage{}, err
+	}
+
+	counter := newRejectionCounter()
+	matched := make([]ibkr.OptionContract, 0)
+	for _, contract := range chain.Contracts {
+		ok, reasons := FilterChainContract(contract, filter)
+		counter.add(contract.Expiry, reasons)
+		if ok {
+			matched = append(matched, contract)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		if filter.Descending {
+			i, j = j, i
+		}
+		if c := compare(matched[i], matched[j]); c != 0 {
+			return c < 0
+		}
+		return compareContracts(matched[i], matched[j]) < 0
+	})
+
+	page := ChainPage{
+		Symbol:          chain.Symbol,
+		UnderlyingPrice: chain.UnderlyingPrice,
+		Truncated:       chain.Truncated,
+		FetchedAt:       chain.FetchedAt,
+		Contracts:       []ibkr.OptionContract{},
+		Total:           len(matched),
+		Rejections:      counter.stats(),
+	}
+	if offset < len(matched) {
+		end := offset + pageSize
+		if end < len(matched) {
+			page.NextPageToken = encodePageToken(end, chain, filter)
+		} else {
+			end = len(matched)
+		}
+		page.Contracts = matched[offset:end]
+	}
+	return page, nil
+}
+
+// chainSortFunc returns the comparison of contracts by the sort field
+func chainSortFunc(field string) (func(a, b ibkr.OptionContract) int, error) {
+	switch field {
+	case "", SortExpiry:
+		return func(a, b ibkr.OptionContract) int { return 0 }, nil
+	case SortStrike:
+		return func(a, b ibkr.OptionContract) int { return compareFloats(a.Strike, b.Strike) }, nil
+	case SortDelta:
+		return func(a, b ibkr.OptionContract) int { return compareFloats(math.Abs(a.Delta), math.Abs(b.Delta)) }, nil
+	case SortOpenInterest:
+		return func(a, b ibkr.OptionContract) int { return a.OpenInterest - b.OpenInterest }, nil
+	case SortSpreadPct:
+		return func(a, b ibkr.OptionContract) int { return compareFloats(a.BidAskSpreadPct, b.BidAskSpreadPct) }, nil
+	case SortImpliedVol:
+		return func(a, b ibkr.OptionContract) int { return compareFloats(a.ImpliedVol, b.ImpliedVol) }, nil
+	default:
+		return nil, fmt.Errorf("unknown sort field %q, expected %s, %s, %s, %s, %s or %s",
+			field, SortExpiry, SortStrike, SortDelta, SortOpenInterest, SortSpreadPct, SortImpliedVol)
+	}
+}
+
+// compareContracts orders contracts by expiry, strike and right
+func compareContracts(a, b ibkr.OptionContract) int {
+	if a.Expiry != b.Expiry {
+		return strings.Compare(a.Expiry, b.Expiry)
+	}
+	if c := compareFloats(a.Strike, b.Strike); c != 0 {
+		return c
+	}
+	return strings.Compare(a.Right, b.Right)
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// encodePageToken returns the token of the page starting at offset. It binds
+// the offset to the fetch of the chain and the filter, so that a token is not
+// applied to a refreshed chain or another filter.
+func encodePageToken(offset int, chain ibkr.OptionChain, filter ChainFilter) string {
+	token := strconv.Itoa(offset) + ":" + pageTokenKey(chain, filter)
+	return base64.RawURLEncoding.EncodeToString([]byte(token))
+}
+
+// decodePageToken returns the offset of a page token, 0 for an empty token
+func decodePageToken(token string, chain ibkr.OptionChain, filter ChainFilter) (int, error) {
+	if token == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, ErrInvalidPageToken
+	}
+	offsetText, key, found := strings.Cut(string(raw), ":")
+	offset, err := strconv.Atoi(offsetText)
+	if !found || err != nil || offset < 0 {
+		return 0, ErrInvalidPageToken
+	}
+	if key != pageTokenKey(chain, filter) {
+		return 0, fmt.Errorf("%w: the chain was refreshed or the filter changed since the token was issued", ErrInvalidPageToken)
+	}
+	return offset, nil
+}
+
+// pageTokenKey identifies the fetch of the chain and the filter, leaving out
+// the page token and size
+func pageTokenKey(chain ibkr.OptionChain, filter ChainFilter) string {
+	filter.PageToken, filter.PageSize = "", 0
+	encoded, _ := json.Marshal(filter)
+	sum := sha256.Sum256(append([]byte(chain.Symbol+chain.FetchedAt.UTC().Format(time.RFC3339Nano)), encoded...))
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
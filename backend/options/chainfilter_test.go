@@ -0,0 +1,158 @@
+package options
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"traderadmin/backend/ibkr"
+)
+
+// largeChain is a 1000-contract chain: calls and puts of 50 strikes around
+// $100 for 10 weekly expiries, with deltas falling off away from the money
+func largeChain() ibkr.OptionChain {
+	chain := ibkr.OptionChain{Symbol: "SPX", UnderlyingPrice: 100, FetchedAt: time.Date(2024, 3, 1, 15, 0, 0, 0, time.UTC)}
+	first := time.Date(2024, 3, 8, 0, 0, 0, 0, time.UTC)
+	for week := 0; week < 10; week++ {
+		expiry := first.AddDate(0, 0, 7*week).Format("20060102")
+		for i := 0; i < 50; i++ {
+			strike := 75 + float64(i)
+			callDelta := 1 / (1 + math.Exp((strike-100)/5))
+			for _, right := range []string{"C", "P"} {
+				delta := callDelta
+				if right == "P" {
+					delta = callDelta - 1
+				}
+				chain.Contracts = append(chain.Contracts, ibkr.OptionContract{
+					OptionQuote: ibkr.OptionQuote{
+						OptionKey:    ibkr.OptionKey{Expiry: expiry, Strike: strike, Right: right},
+						Delta:        delta,
+						OpenInterest: 100 * (i + 1),
+					},
+					Symbol:          "SPX",
+					BidAskSpreadPct: 2,
+				})
+			}
+		}
+	}
+	return chain
+}
+
+func TestFilterChainPagesThroughDeltaBand(t *testing.T) {
+	chain := largeChain()
+	filter := ChainFilter{MinAbsDelta: 0.2, MaxAbsDelta: 0.4, SortBy: SortDelta, PageSize: 7}
+
+	want := 0
+	for _, contract := range chain.Contracts {
+		if delta := math.Abs(contract.Delta); delta >= 0.2 && delta <= 0.4 {
+			want++
+		}
+	}
+
+	seen := make(map[string]bool)
+	var previous float64
+	pages := 0
+	for {
+		page, err := FilterChain(chain, filter)
+		if err != nil {
+			t.Fatalf("FilterChain() page %d error = %v", pages, err)
+		}
+		pages++
+		if page.Total != want {
+			t.Fatalf("Total = %d, want %d", page.Total, want)
+		}
+		if page.NextPageToken != "" && len(page.Contracts) != 7 {
+			t.Errorf("Page %d has %d contracts, want 7", pages, len(page.Contracts))
+		}
+		for _, contract := range page.Contracts {
+			key := fmt.Sprintf("%s %g%s", contract.Expiry, contract.Strike, contract.Right)
+			if seen[key] {
+				t.Errorf("%s listed twice", key)
+			}
+			seen[key] = true
+			if delta := math.Abs(contract.Delta); delta < previous {
+				t.Errorf("%s delta %.3f after %.3f, want ascending", key, delta, previous)
+			} else {
+				previous = delta
+			}
+		}
+
+		// The same request returns the same page
+		again, err := FilterChain(chain, filter)
+		if err != nil || again.NextPageToken != page.NextPageToken || len(again.Contracts) != len(page.Contracts) {
+			t.Fatalf("Repeated request returned token %q, want %q", again.NextPageToken, page.NextPageToken)
+		}
+
+		if page.NextPageToken == "" {
+			break
+		}
+		filter.PageToken = page.NextPageToken
+	}
+
+	if len(seen) != want || pages != (want+6)/7 {
+		t.Errorf("Paged through %d contracts in %d pages, want %d in %d", len(seen), pages, want, (want+6)/7)
+	}
+
+	first, _ := FilterChain(chain, ChainFilter{MinAbsDelta: 0.2, MaxAbsDelta: 0.4})
+	if len(first.Rejections) != 1 || first.Rejections[0].Code != RejectDeltaOutOfRange || first.Rejections[0].Count != 1000-want {
+		t.Errorf("Rejections = %+v, want %d for the delta band", first.Rejections, 1000-want)
+	}
+}
+
+func TestFilterChainCombinesFilters(t *testing.T) {
+	chain := largeChain()
+	page, err := FilterChain(chain, ChainFilter{
+		MinExpiry:       "2024-03-15",
+		MaxExpiry:       "2024-03-22",
+		MinStrike:       90,
+		MaxStrike:       99,
+		Right:           "p",
+		MinOpenInterest: 2000,
+		PageSize:        100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Strikes 94 to 99 have at least 2000 open interest
+	if page.Total != 12 || page.NextPageToken != "" {
+		t.Fatalf("Total = %d, next page %q; want 12 puts on one page", page.Total, page.NextPageToken)
+	}
+	if c := page.Contracts[0]; c.Expiry != "20240315" || c.Strike != 94 || c.Right != "P" {
+		t.Errorf("First contract = %s %g%s, want 20240315 94P", c.Expiry, c.Strike, c.Right)
+	}
+
+	counts := make(map[RejectionCode]int)
+	for _, stat := range page.Rejections {
+		counts[stat.Code] = stat.Count
+	}
+	if counts[RejectOptionType] != 500 || counts[RejectExpiryOutOfRange] != 800 || counts[RejectMinOpenInterest] != 380 {
+		t.Errorf("Rejections = %+v", page.Rejections)
+	}
+}
+
+func TestFilterChainRejectsStalePageTokens(t *testing.T) {
+	chain := largeChain()
+	filter := ChainFilter{Right: "C", PageSize: 50}
+	page, err := FilterChain(chain, filter)
+	if err != nil || page.NextPageToken == "" {
+		t.Fatalf("FilterChain() = %v, want a next page", err)
+	}
+
+	refreshed := chain
+	refreshed.FetchedAt = chain.FetchedAt.Add(time.Minute)
+	filter.PageToken = page.NextPageToken
+	if _, err := FilterChain(refreshed, filter); !errors.Is(err, ErrInvalidPageToken) {
+		t.Errorf("Token on a refreshed chain error = %v, want ErrInvalidPageToken", err)
+	}
+
+	filter.Right = "P"
+	if _, err := FilterChain(chain, filter); !errors.Is(err, ErrInvalidPageToken) {
+		t.Errorf("Token with another filter error = %v, want ErrInvalidPageToken", err)
+	}
+
+	if _, err := FilterChain(chain, ChainFilter{SortBy: "volume"}); err == nil {
+		t.Error("FilterChain() with an unknown sort field should fail")
+	}
+}
@@ -0,0 +1,212 @@
+package options
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"traderadmin/backend/ibkr"
+)
+
+// Target DTE modes of TradeTiming.TargetDTEMode
+const (
+	DTEModeFixed           = "FIXED"
+	DTEModeATRMultiple     = "ATR_MULTIPLE"
+	DTEModeVolatilityIndex = "VOLATILITY_INDEX"
+)
+
+// VolatilityIndexBaseline is the volatility index value at which the
+// VOLATILITY_INDEX mode targets the fixed DTE; the target scales with the
+// index from there
+const VolatilityIndexBaseline = 20.0
+
+// nearTheMoneyPct is how far from the underlying price, in percent, the
+// strikes whose open interest breaks ties between expirations lie
+const nearTheMoneyPct = 5.0
+
+// ErrNoExpiration is returned when no expiration of the chain lies within the
+// DTE bounds
+var ErrNoExpiration = errors.New("no expiration within the DTE bounds")
+
+// DTESettings choose the target days to expiry
+type DTESettings struct {
+	// Mode is FIXED, ATR_MULTIPLE or VOLATILITY_INDEX; empty is FIXED
+	Mode string
+	// Fixed is the target of the FIXED mode and, at the baseline index
+	// value, of the VOLATILITY_INDEX mode
+	Fixed int
+	// ATRCoefficient multiplies the ATR in the ATR_MULTIPLE mode
+	ATRCoefficient float64
+	// MinDTE and MaxDTE bound the target and the expirations chosen; a zero
+	// MaxDTE leaves them unbounded above
+	MinDTE int
+	MaxDTE int
+	// SkipExpiries are expirations ("20060102") never chosen, each with the
+	// reason, such as earnings within the holding period
+	SkipExpiries map[string]string
+}
+
+// DTEDecision explains the expiration chosen for a target DTE
+type DTEDecision struct {
+	Mode      string  `json:"mode"`
+	RawTarget float64 `json:"rawTarget"`
+	Target    int     `json:"target"` // RawTarget rounded and clamped to the bounds
+	Expiry    string  `json:"expiry"`
+	DTE       int     `json:"dte"`
+	// TieBreak tells why Expiry was chosen over an expiration as far from
+	// the target, if there was one
+	TieBreak string `json:"tieBreak,omitempty"`
+	// Skipped are the expirations within the bounds passed over for
+	// SkipExpiries, each as "20060102: reason"
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+// TargetDTE returns the days to expiry the mode aims for before and after
+// rounding and clamping to the bounds. The ATR_MULTIPLE mode needs the
+// underlying's ATR and the VOLATILITY_INDEX mode a VIX-like index value.
+func TargetDTE(settings DTESettings, atr, volatilityIndex float64) (float64, int, error) {
+	var raw float64
+	switch strings.ToUpper(settings.Mode) {
+	case "", DTEModeFixed:
+		raw = float64(settings.Fixed)
+	case DTEModeATRMultiple:
+		if atr <= 0 {
+			return 0, 0, fmt.Errorf("the %s mode needs a positive ATR, got %g", DTEModeATRMultiple, atr)
+		}
+		raw = atr * settings.ATRCoefficient
+	case DTEModeVolatilityIndex:
+		if volatilityIndex <= 0 {
+			return 0, 0, fmt.Errorf("the %s mode needs a positive volatility index, got %g", DTEModeVolatilityIndex, volatilityIndex)
+		}
+		raw = float64(settings.Fixed) * volatilityIndex / VolatilityIndexBaseline
+	default:
+		return 0, 0, fmt.Errorf("unknown target DTE mode %q", settings.Mode)
+	}
+
+	target := int(math.Round(raw))
+	if target < settings.MinDTE {
+		target = settings.MinDTE
+	}
+	if settings.MaxDTE > 0 && target > settings.MaxDTE {
+		target = settings.MaxDTE
+	}
+	return raw, target, nil
+}
+
+// SelectExpiration chooses the chain's expiration nearest the target DTE
+// within the bounds. Of two as far from the target, the one with more open
+// interest near the money wins, then a monthly expiration over a weekly one,
+// then the earlier one.
+func SelectExpiration(chain ibkr.OptionChain, settings DTESettings, atr, volatilityIndex float64) (DTEDecision, error) {
+	raw, target, err := TargetDTE(settings, atr, volatilityIndex)
+	if err != nil {
+		return DTEDecision{}, err
+	}
+	decision := DTEDecision{Mode: strings.ToUpper(settings.Mode), RawTarget: raw, Target: target}
+	if decision.Mode == "" {
+		decision.Mode = DTEModeFixed
+	}
+
+	expirations := chainExpirations(chain)
+	var nearest []expiration
+	for _, e := range expirations {
+		if e.dte < settings.MinDTE || (settings.MaxDTE > 0 && e.dte > settings.MaxDTE) {
+			continue
+		}
+		if reason, skip := settings.SkipExpiries[e.expiry]; skip {
+			decision.Skipped = append(decision.Skipped, e.expiry+": "+reason)
+			continue
+		}
+		switch distance := abs(e.dte - target); {
+		case len(nearest) == 0 || distance < abs(nearest[0].dte-target):
+			nearest = []expiration{e}
+		case distance == abs(nearest[0].dte-target):
+			nearest = append(nearest, e)
+		}
+	}
+	if len(nearest) == 0 {
+		return decision, fmt.Errorf("%w (%d expirations listed, %d skipped)", ErrNoExpiration, len(expirations), len(decision.Skipped))
+	}
+
+	best := nearest[0]
+	if len(nearest) > 1 {
+		other := nearest[1]
+		if other.betterThan(best) {
+			best, other = other, best
+		}
+		switch {
+		case best.openInterest != other.openInterest:
+			decision.TieBreak = fmt.Sprintf("%s has more open interest near the money than %s (%d vs %d)",
+				best.expiry, other.expiry, best.openInterest, other.openInterest)
+		case best.monthly != other.monthly:
+			decision.TieBreak = fmt.Sprintf("%s is a monthly expiration, %s a weekly one", best.expiry, other.expiry)
+		default:
+			decision.TieBreak = fmt.Sprintf("%s expires before %s", best.expiry, other.expiry)
+		}
+	}
+	decision.Expiry, decision.DTE = best.expiry, best.dte
+	return decision, nil
+}
+
+// expiration is an expiration of a chain with the open interest of its
+// options near the money
+type expiration struct {
+	expiry       string
+	dte          int
+	openInterest int
+	monthly      bool
+}
+
+// betterThan breaks a tie between expirations as far from the target
+func (e expiration) betterThan(other expiration) bool {
+	if e.openInterest != other.openInterest {
+		return e.openInterest > other.openInterest
+	}
+	if e.monthly != other.monthly {
+		return e.monthly
+	}
+	return e.expiry < other.expiry
+}
+
+// chainExpirations returns the expirations of the chain, earliest first
+func chainExpirations(chain ibkr.OptionChain) []expiration {
+	band := chain.UnderlyingPrice * nearTheMoneyPct / 100
+	byExpiry := make(map[string]*expiration)
+	for _, contract := range chain.Contracts {
+		e, ok := byExpiry[contract.Expiry]
+		if !ok {
+			e = &expiration{expiry: contract.Expiry, dte: contract.DTE, monthly: monthlyExpiry(contract.Expiry)}
+			byExpiry[contract.Expiry] = e
+		}
+		if math.Abs(contract.Strike-chain.UnderlyingPrice) <= band {
+			e.openInterest += contract.OpenInterest
+		}
+	}
+
+	expirations := make([]expiration, 0, len(byExpiry))
+	for _, e := range byExpiry {
+		expirations = append(expirations, *e)
+	}
+	sort.Slice(expirations, func(i, j int) bool { return expirations[i].expiry < expirations[j].expiry })
+	return expirations
+}
+
+// monthlyExpiry reports whether an expiry ("20060102") is the third Friday of
+// its month, when the standard monthly options expire
+func monthlyExpiry(expiry string) bool {
+	date, err := time.Parse("20060102", expiry)
+	if err != nil {
+		return false
+	}
+	return date.Weekday() == time.Friday && (date.Day()-1)/7 == 2
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,186 @@
+package options
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"traderadmin/backend/ibkr"
+)
+
+// expirationChain returns a chain on a $100 underlying holding the at the money
+// puts and, for each, a put at 80 with farOpenInterest
+func expirationChain(farOpenInterest int, expirations ...ibkr.OptionContract) ibkr.OptionChain {
+	chain := ibkr.OptionChain{Symbol: "SPY", UnderlyingPrice: 100}
+	for _, e := range expirations {
+		far := e
+		far.Strike, far.OpenInterest = 80, farOpenInterest
+		chain.Contracts = append(chain.Contracts, e, far)
+	}
+	return chain
+}
+
+// atTheMoney returns the put at 100 expiring on expiry
+func atTheMoney(expiry string, dte, openInterest int) ibkr.OptionContract {
+	return ibkr.OptionContract{
+		OptionQuote: ibkr.OptionQuote{
+			OptionKey:    ibkr.OptionKey{Expiry: expiry, Strike: 100, Right: "P"},
+			OpenInterest: openInterest,
+		},
+		Symbol: "SPY",
+		DTE:    dte,
+	}
+}
+
+func TestTargetDTEModes(t *testing.T) {
+	bounds := DTESettings{Fixed: 40, ATRCoefficient: 1.2, MinDTE: 7, MaxDTE: 90}
+	withMode := func(mode string) DTESettings {
+		settings := bounds
+		settings.Mode = mode
+		return settings
+	}
+
+	tests := []struct {
+		name            string
+		settings        DTESettings
+		atr, index      float64
+		wantRaw         float64
+		wantTarget      int
+		wantErrContains string
+	}{
+		{name: "Fixed", settings: withMode(DTEModeFixed), wantRaw: 40, wantTarget: 40},
+		{name: "No mode is fixed", settings: withMode(""), wantRaw: 40, wantTarget: 40},
+		{name: "ATR multiple", settings: withMode(DTEModeATRMultiple), atr: 20, wantRaw: 24, wantTarget: 24},
+		{name: "ATR multiple rounds", settings: withMode("atr_multiple"), atr: 21, wantRaw: 25.2, wantTarget: 25},
+		{name: "Volatility index", settings: withMode(DTEModeVolatilityIndex), index: 30, wantRaw: 60, wantTarget: 60},
+		{name: "Clamped to MinDTE", settings: withMode(DTEModeATRMultiple), atr: 2, wantRaw: 2.4, wantTarget: 7},
+		{name: "Clamped to MaxDTE", settings: withMode(DTEModeVolatilityIndex), index: 80, wantRaw: 160, wantTarget: 90},
+		{name: "ATR missing", settings: withMode(DTEModeATRMultiple), wantErrContains: "positive ATR"},
+		{name: "Index missing", settings: withMode(DTEModeVolatilityIndex), atr: 20, wantErrContains: "positive volatility index"},
+		{name: "Unknown mode", settings: withMode("EARNINGS"), wantErrContains: "unknown target DTE mode"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, target, err := TargetDTE(tt.settings, tt.atr, tt.index)
+			if tt.wantErrContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrContains) {
+					t.Fatalf("TargetDTE() error = %v, want %q", err, tt.wantErrContains)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if raw < tt.wantRaw-1e-9 || raw > tt.wantRaw+1e-9 || target != tt.wantTarget {
+				t.Errorf("TargetDTE() = %g, %d; want %g, %d", raw, target, tt.wantRaw, tt.wantTarget)
+			}
+		})
+	}
+}
+
+func TestSelectExpirationClampsToBounds(t *testing.T) {
+	// Expirations from 2024-03-20: weeklies and the April and May monthlies
+	chain := expirationChain(0,
+		atTheMoney("20240329", 9, 1000),
+		atTheMoney("20240412", 23, 1000),
+		atTheMoney("20240419", 30, 1000),
+		atTheMoney("20240426", 37, 1000),
+		atTheMoney("20240517", 58, 1000),
+	)
+
+	tests := []struct {
+		name       string
+		settings   DTESettings
+		wantTarget int
+		wantExpiry string
+	}{
+		{"Nearest the target", DTESettings{Fixed: 32, MaxDTE: 90}, 32, "20240419"},
+		{"Target above MaxDTE", DTESettings{Fixed: 120, MinDTE: 7, MaxDTE: 60}, 60, "20240517"},
+		{"Target below MinDTE", DTESettings{Fixed: 3, MinDTE: 14, MaxDTE: 60}, 14, "20240412"},
+		{"Nearest expiration outside the bounds", DTESettings{Fixed: 60, MinDTE: 7, MaxDTE: 45}, 45, "20240426"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := SelectExpiration(chain, tt.settings, 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decision.Mode != DTEModeFixed || decision.Target != tt.wantTarget || decision.Expiry != tt.wantExpiry || decision.TieBreak != "" {
+				t.Errorf("SelectExpiration() = %+v, want target %d and %s", decision, tt.wantTarget, tt.wantExpiry)
+			}
+		})
+	}
+
+	if _, err := SelectExpiration(chain, DTESettings{Fixed: 120, MinDTE: 100, MaxDTE: 150}, 0, 0); !errors.Is(err, ErrNoExpiration) {
+		t.Errorf("SelectExpiration() beyond every expiration error = %v, want ErrNoExpiration", err)
+	}
+}
+
+func TestSelectExpirationBreaksTies(t *testing.T) {
+	tests := []struct {
+		name         string
+		chain        ibkr.OptionChain
+		target       int // seven days from both expirations
+		wantExpiry   string
+		wantTieBreak string
+	}{
+		{
+			// The far strikes' open interest is not near the money
+			name:         "More open interest near the money",
+			chain:        expirationChain(50000, atTheMoney("20240412", 23, 800), atTheMoney("20240426", 37, 1200)),
+			target:       30,
+			wantExpiry:   "20240426",
+			wantTieBreak: "20240426 has more open interest near the money than 20240412 (1200 vs 800)",
+		},
+		{
+			name:         "Monthly over weekly",
+			chain:        expirationChain(0, atTheMoney("20240503", 44, 1000), atTheMoney("20240419", 30, 1000)),
+			target:       37,
+			wantExpiry:   "20240419",
+			wantTieBreak: "20240419 is a monthly expiration, 20240503 a weekly one",
+		},
+		{
+			name:         "Earlier of two weeklies",
+			chain:        expirationChain(0, atTheMoney("20240426", 37, 1000), atTheMoney("20240412", 23, 1000)),
+			target:       30,
+			wantExpiry:   "20240412",
+			wantTieBreak: "20240412 expires before 20240426",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := SelectExpiration(tt.chain, DTESettings{Fixed: tt.target, MaxDTE: 90}, 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decision.Expiry != tt.wantExpiry || decision.TieBreak != tt.wantTieBreak {
+				t.Errorf("SelectExpiration() = %+v, want %s because %q", decision, tt.wantExpiry, tt.wantTieBreak)
+			}
+		})
+	}
+}
+
+func TestSelectExpirationSkipsExpiries(t *testing.T) {
+	chain := expirationChain(0,
+		atTheMoney("20240412", 23, 1000),
+		atTheMoney("20240419", 30, 1000),
+		atTheMoney("20240426", 37, 1000),
+	)
+	settings := DTESettings{Fixed: 30, MaxDTE: 90, SkipExpiries: map[string]string{
+		"20240419": "earnings on 2024-04-16 within holding period",
+		"20240426": "earnings on 2024-04-16 within holding period",
+	}}
+
+	decision, err := SelectExpiration(chain, settings, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decision.Expiry != "20240412" || len(decision.Skipped) != 2 || decision.Skipped[0] != "20240419: earnings on 2024-04-16 within holding period" {
+		t.Errorf("SelectExpiration() = %+v, want 20240412 with the later two skipped", decision)
+	}
+
+	settings.SkipExpiries["20240412"] = "ex-dividend on 2024-04-10 within holding period"
+	if _, err := SelectExpiration(chain, settings, 0, 0); !errors.Is(err, ErrNoExpiration) || !strings.Contains(err.Error(), "3 skipped") {
+		t.Errorf("SelectExpiration() with every expiration skipped error = %v, want ErrNoExpiration", err)
+	}
+}
@@ -0,0 +1,209 @@
+package options
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IVRankLookbackDays is the number of daily observations used for IV rank (one trading year)
+const IVRankLookbackDays = 252
+
+// IVRankResult contains the IV rank and IV percentile for a current implied volatility
+type IVRankResult struct {
+	Rank         float64 `json:"rank"`       // 0-100, position of current IV between the period low and high
+	Percentile   float64 `json:"percentile"` // 0-100, share of observations below current IV
+	Low          float64 `json:"low"`
+	High         float64 `json:"high"`
+	Observations int     `json:"observations"`
+}
+
+// IVRank computes the IV rank and IV percentile of currentIV against a history of
+// daily implied volatility observations (oldest first). Only the most recent
+// IVRankLookbackDays observations are used. When the history is empty or flat the
+// rank is undefined and 50 is returned.
+func IVRank(history []float64, currentIV float64) IVRankResult {
+	if len(history) > IVRankLookbackDays {
+		history = history[len(history)-IVRankLookbackDays:]
+	}
+
+	result := IVRankResult{
+		Rank:         50,
+		Percentile:   50,
+		Observations: len(history),
+	}
+	if len(history) == 0 {
+		return result
+	}
+
+	low, high := history[0], history[0]
+	below := 0
+	for _, iv := range history {
+		low = math.Min(low, iv)
+		high = math.Max(high, iv)
+		if iv < currentIV {
+			below++
+		}
+	}
+	result.Low = low
+	result.High = high
+	result.Percentile = float64(below) / float64(len(history)) * 100
+
+	if high-low > 0 {
+		rank := (currentIV - low) / (high - low) * 100
+		result.Rank = math.Max(0, math.Min(100, rank))
+	}
+
+	return result
+}
+
+// RealizedVolatility returns a rolling annualized close-to-close volatility series
+// computed over the given window. It can be used as a fallback IV history for
+// symbols without recorded implied volatility.
+func RealizedVolatility(closes []float64, window int) []float64 {
+	if window < 2 || len(closes) <= window {
+		return nil
+	}
+
+	returns := make([]float64, 0, len(closes)-1)
+	for i := 1; i < len(closes); i++ {
+		if closes[i-1] <= 0 || closes[i] <= 0 {
+			returns = append(returns, 0)
+			continue
+		}
+		returns = append(returns, math.Log(closes[i]/closes[i-1]))
+	}
+
+	series := make([]float64, 0, len(returns)-window+1)
+	for end := window; end <= len(returns); end++ {
+		sample := returns[end-window : end]
+
+		mean := 0.0
+		for _, r := range sample {
+			mean += r
+		}
+		mean /= float64(len(sample))
+
+		variance := 0.0
+		for _, r := range sample {
+			variance += (r - mean) * (r - mean)
+		}
+		variance /= float64(len(sample) - 1)
+
+		series = append(series, math.Sqrt(variance)*math.Sqrt(IVRankLookbackDays))
+	}
+
+	return series
+}
+
+// IVObservation is a single daily implied volatility reading for a symbol
+type IVObservation struct {
+	Date string  `json:"date"` // YYYY-MM-DD
+	IV   float64 `json:"iv"`
+}
+
+// IVHistoryStore accumulates daily IV observations per symbol and persists them to disk
+type IVHistoryStore struct {
+	mu   sync.RWMutex
+	path string
+	data map[string][]IVObservation
+}
+
+// NewIVHistoryStore creates a store backed by a JSON file in the given directory,
+// loading any previously recorded observations
+func NewIVHistoryStore(dir string) (*IVHistoryStore, error) {
+	store := &IVHistoryStore{
+		path: filepath.Join(dir, "iv_history.json"),
+		data: make(map[string][]IVObservation),
+	}
+
+	content, err := os.ReadFile(store.path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read IV history: %w", err)
+	}
+
+	if err := json.Unmarshal(content, &store.data); err != nil {
+		return nil, fmt.Errorf("failed to decode IV history: %w", err)
+	}
+
+	return store, nil
+}
+
+// Record stores the IV observation for the symbol on the given day, replacing any
+// earlier observation for the same day, and prunes history beyond IVRankLookbackDays
+func (s *IVHistoryStore) Record(symbol string, date time.Time, iv float64) error {
+	symbol = strings.ToUpper(symbol)
+	day := date.Format("2006-01-02")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	observations := s.data[symbol]
+	replaced := false
+	for i := range observations {
+		if observations[i].Date == day {
+			observations[i].IV = iv
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		observations = append(observations, IVObservation{Date: day, IV: iv})
+		sort.Slice(observations, func(i, j int) bool {
+			return observations[i].Date < observations[j].Date
+		})
+	}
+
+	if len(observations) > IVRankLookbackDays {
+		observations = observations[len(observations)-IVRankLookbackDays:]
+	}
+	s.data[symbol] = observations
+
+	return s.save()
+}
+
+// History returns the recorded IV values for the symbol, oldest first
+func (s *IVHistoryStore) History(symbol string) []float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	observations := s.data[strings.ToUpper(symbol)]
+	history := make([]float64, len(observations))
+	for i, obs := range observations {
+		history[i] = obs.IV
+	}
+	return history
+}
+
+// Rank computes the IV rank of currentIV against the symbol's recorded history
+func (s *IVHistoryStore) Rank(symbol string, currentIV float64) IVRankResult {
+	return IVRank(s.History(symbol), currentIV)
+}
+
+// save writes the store to disk via a temp file and rename; callers must hold the lock
+func (s *IVHistoryStore) save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create IV history directory: %w", err)
+	}
+
+	content, err := json.Marshal(s.data)
+	if err != nil {
+		return fmt.Errorf("failed to encode IV history: %w", err)
+	}
+
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, content, 0644); err != nil {
+		return fmt.Errorf("failed to write IV history: %w", err)
+	}
+
+	return os.Rename(tmpPath, s.path)
+}
@@ -0,0 +1,128 @@
+package options
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestIVRank(t *testing.T) {
+	monotonic := make([]float64, 100)
+	for i := range monotonic {
+		monotonic[i] = 0.10 + float64(i)*0.01 // 0.10 .. 1.09
+	}
+
+	tests := []struct {
+		name           string
+		history        []float64
+		current        float64
+		wantRank       float64
+		wantPercentile float64
+	}{
+		{
+			name:           "Empty history",
+			history:        nil,
+			current:        0.30,
+			wantRank:       50,
+			wantPercentile: 50,
+		},
+		{
+			name:           "Constant IV",
+			history:        []float64{0.25, 0.25, 0.25, 0.25},
+			current:        0.25,
+			wantRank:       50,
+			wantPercentile: 0,
+		},
+		{
+			name:           "Monotonic series at midpoint",
+			history:        monotonic,
+			current:        0.595,
+			wantRank:       50,
+			wantPercentile: 50,
+		},
+		{
+			name:           "Monotonic series above high",
+			history:        monotonic,
+			current:        2.0,
+			wantRank:       100,
+			wantPercentile: 100,
+		},
+		{
+			name:           "Partial history",
+			history:        []float64{0.20, 0.40, 0.30},
+			current:        0.35,
+			wantRank:       75,
+			wantPercentile: 200.0 / 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := IVRank(tt.history, tt.current)
+
+			if math.Abs(result.Rank-tt.wantRank) > 1e-9 {
+				t.Errorf("Rank mismatch: got %v, want %v", result.Rank, tt.wantRank)
+			}
+			if math.Abs(result.Percentile-tt.wantPercentile) > 1e-9 {
+				t.Errorf("Percentile mismatch: got %v, want %v", result.Percentile, tt.wantPercentile)
+			}
+			if result.Observations != len(tt.history) {
+				t.Errorf("Observations mismatch: got %v, want %v", result.Observations, len(tt.history))
+			}
+		})
+	}
+}
+
+func TestIVRankUsesLookbackWindow(t *testing.T) {
+	// An old extreme value outside the lookback window must not affect the rank
+	history := []float64{5.0}
+	for i := 0; i < IVRankLookbackDays; i++ {
+		history = append(history, 0.20+float64(i%2)*0.20)
+	}
+
+	result := IVRank(history, 0.40)
+	if result.High != 0.40 {
+		t.Errorf("High mismatch: got %v, want %v", result.High, 0.40)
+	}
+	if result.Rank != 100 {
+		t.Errorf("Rank mismatch: got %v, want %v", result.Rank, 100.0)
+	}
+}
+
+func TestIVHistoryStorePersistsAndPrunes(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewIVHistoryStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	start := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < IVRankLookbackDays+10; i++ {
+		if err := store.Record("spy", start.AddDate(0, 0, i), float64(i)); err != nil {
+			t.Fatalf("Failed to record observation: %v", err)
+		}
+	}
+
+	// Recording the same day twice replaces the observation
+	last := start.AddDate(0, 0, IVRankLookbackDays+9)
+	if err := store.Record("SPY", last, 1000); err != nil {
+		t.Fatalf("Failed to record observation: %v", err)
+	}
+
+	reloaded, err := NewIVHistoryStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to reload store: %v", err)
+	}
+
+	history := reloaded.History("SPY")
+	if len(history) != IVRankLookbackDays {
+		t.Fatalf("History length mismatch: got %v, want %v", len(history), IVRankLookbackDays)
+	}
+	if history[0] != 10 {
+		t.Errorf("Oldest observation mismatch: got %v, want %v", history[0], 10.0)
+	}
+	if history[len(history)-1] != 1000 {
+		t.Errorf("Latest observation mismatch: got %v, want %v", history[len(history)-1], 1000.0)
+	}
+}
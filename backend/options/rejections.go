@@ -0,0 +1,141 @@
+package options
+
+import (
+	"fmt"
+	"sort"
+)
+
+// RejectionCode identifies the filter that rejected an option or spread
+type RejectionCode string
+
+// Rejection codes of the option filters
+const (
+	RejectMinOpenInterest RejectionCode = "MIN_OPEN_INTEREST"
+	RejectSpreadTooWide   RejectionCode = "SPREAD_TOO_WIDE"
+)
+
+// Rejection codes of the chain display filters
+const (
+	RejectExpiryOutOfRange RejectionCode = "EXPIRY_OUT_OF_RANGE"
+	RejectStrikeOutOfRange RejectionCode = "STRIKE_OUT_OF_RANGE"
+	RejectDeltaOutOfRange  RejectionCode = "DELTA_OUT_OF_RANGE"
+	RejectOptionType       RejectionCode = "OPTION_TYPE"
+)
+
+// contractRejections are the codes rejecting single contracts rather than
+// spreads
+var contractRejections = map[RejectionCode]bool{
+	RejectMinOpenInterest:  true,
+	RejectSpreadTooWide:    true,
+	RejectExpiryOutOfRange: true,
+	RejectStrikeOutOfRange: true,
+	RejectDeltaOutOfRange:  true,
+	RejectOptionType:       true,
+}
+
+// Rejection codes of the spread filters
+const (
+	RejectNoCredit            RejectionCode = "NO_CREDIT"
+	RejectDTEOutOfRange       RejectionCode = "DTE_OUT_OF_RANGE"
+	RejectCorporateEvent      RejectionCode = "CORPORATE_EVENT"
+	RejectIVRankOutOfRange    RejectionCode = "IV_RANK_OUT_OF_RANGE"
+	RejectMinPOP              RejectionCode = "MIN_POP"
+	RejectWidthVsExpectedMove RejectionCode = "WIDTH_VS_EXPECTED_MOVE"
+	RejectMaxDelta            RejectionCode = "MAX_DELTA"
+	RejectMaxGamma            RejectionCode = "MAX_GAMMA"
+	RejectMaxVega             RejectionCode = "MAX_VEGA"
+	RejectMinTheta            RejectionCode = "MIN_THETA"
+)
+
+// rejectionDescriptions complete "rejected for ..." in statistics
+var rejectionDescriptions = map[RejectionCode]string{
+	RejectMinOpenInterest:     "open interest",
+	RejectSpreadTooWide:       "bid-ask spread",
+	RejectExpiryOutOfRange:    "expiry",
+	RejectStrikeOutOfRange:    "strike",
+	RejectDeltaOutOfRange:     "delta band",
+	RejectOptionType:          "option type",
+	RejectNoCredit:            "no credit",
+	RejectDTEOutOfRange:       "days to expiry",
+	RejectCorporateEvent:      "corporate event",
+	RejectIVRankOutOfRange:    "IV rank",
+	RejectMinPOP:              "probability of profit",
+	RejectWidthVsExpectedMove: "width vs expected move",
+	RejectMaxDelta:            "delta",
+	RejectMaxGamma:            "gamma",
+	RejectMaxVega:             "vega",
+	RejectMinTheta:            "theta",
+}
+
+// RejectionReason is a filter an option or spread failed, with the offending
+// value and the threshold it crossed. Leg names the option, e.g. "95P", for
+// the option filters.
+type RejectionReason struct {
+	Code      RejectionCode `json:"code"`
+	Leg       string        `json:"leg,omitempty"`
+	Value     float64       `json:"value"`
+	Threshold float64       `json:"threshold"`
+	Message   string        `json:"message"`
+}
+
+func (r RejectionReason) String() string {
+	return r.Message
+}
+
+// RejectionStat counts the contracts or spreads a filter rejected
+type RejectionStat struct {
+	Code    RejectionCode `json:"code"`
+	Count   int           `json:"count"`
+	Summary string        `json:"summary"` // e.g. "42 contracts rejected for open interest"
+}
+
+// rejectionCounter aggregates reasons, counting each contract once per option
+// filter and each spread once per spread filter
+type rejectionCounter struct {
+	counts    map[RejectionCode]int
+	contracts map[string]bool
+}
+
+func newRejectionCounter() *rejectionCounter {
+	return &rejectionCounter{counts: make(map[RejectionCode]int), contracts: make(map[string]bool)}
+}
+
+// add counts the reasons a spread expiring on expiry was rejected for
+func (c *rejectionCounter) add(expiry string, reasons []RejectionReason) {
+	for _, reason := range reasons {
+		if reason.Leg != "" {
+			key := expiry + " " + reason.Leg + " " + string(reason.Code)
+			if c.contracts[key] {
+				continue
+			}
+			c.contracts[key] = true
+		}
+		c.counts[reason.Code]++
+	}
+}
+
+// stats returns the counts, most frequent first
+func (c *rejectionCounter) stats() []RejectionStat {
+	stats := make([]RejectionStat, 0, len(c.counts))
+	for code, count := range c.counts {
+		unit := "spreads"
+		if contractRejections[code] {
+			unit = "contracts"
+		}
+		if count == 1 {
+			unit = unit[:len(unit)-1]
+		}
+		stats = append(stats, RejectionStat{
+			Code:    code,
+			Count:   count,
+			Summary: fmt.Sprintf("%d %s rejected for %s", count, unit, rejectionDescriptions[code]),
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Count != stats[j].Count {
+			return stats[i].Count > stats[j].Count
+		}
+		return stats[i].Code < stats[j].Code
+	})
+	return stats
+}
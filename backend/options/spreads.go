@@ -0,0 +1,468 @@
+package options
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"traderadmin/backend/ibkr"
+)
+
+// Spread strategies: credit verticals and the iron condor selling both
+const (
+	BullPut    = "BULL_PUT"
+	BearCall   = "BEAR_CALL"
+	IronCondor = "IRON_CONDOR"
+)
+
+// SpreadStrategies are all the strategies SelectSpreads builds
+var SpreadStrategies = []string{BullPut, BearCall, IronCondor}
+
+// Spread scores ranking candidates
+const (
+	ScorePOPRewardRisk = "POP_REWARD_RISK" // POP (0-1) times credit over max loss
+	ScorePOP           = "POP"
+	ScoreRewardRisk    = "REWARD_RISK"
+	ScoreCredit        = "CREDIT"
+)
+
+// nearMissRejections is the most filters a spread may fail and still be
+// reported as a near miss
+const nearMissRejections = 2
+
+// condorWings is the number of best put and call verticals per expiry that
+// are combined into iron condors
+const condorWings = 3
+
+// SpreadFilters are the thresholds applied to options and spreads; a zero
+// threshold of an optional filter is not applied
+type SpreadFilters struct {
+	MinOpenInterest           int
+	MaxBidAskSpreadPercentage float64
+
+	UseIVRankFilter bool
+	MinIVRank       float64
+	MaxIVRank       float64
+	// IVRank is the underlying's current IV rank; HasIVRank is false without IV history
+	IVRank    float64
+	HasIVRank bool
+
+	UsePOPFilter                           bool
+	MinProbabilityOfProfitPercentage       float64
+	UseWidthVsExpectedMoveFilter           bool
+	MaxSpreadWidthVsExpectedMovePercentage float64
+
+	// Limits on the spread's net Greeks per share
+	UseGreekLimits      bool
+	MaxAbsPositionDelta float64
+	MaxAbsPositionGamma float64
+	MaxAbsPositionVega  float64
+	MinPositionTheta    float64
+
+	MinDTE int
+	MaxDTE int
+	// SkipExpiries are expirations ("20060102") no spread may use, each with
+	// the reason, such as earnings within the holding period
+	SkipExpiries map[string]string
+}
+
+// SpreadSettings choose the verticals built from a chain
+type SpreadSettings struct {
+	// Width is the distance between the strikes; 0 pairs adjacent strikes
+	Width float64
+	// StrikeOffset is the number of strikes between the money and the
+	// nearest short strike considered
+	StrikeOffset int
+	// MaxCandidates is the number of candidates and of near misses returned
+	MaxCandidates int
+	Score         string
+}
+
+// SpreadCandidate is a credit vertical or iron condor built from a chain.
+// Prices are per share: Credit is the net mid price received and MaxLoss the
+// width less the credit. POP approximates the probability of profit from the
+// short legs' deltas, in percent. An iron condor has no Short and Long legs
+// of its own; its Wings are the put and call verticals it combines.
+type SpreadCandidate struct {
+	Strategy       string              `json:"strategy"`
+	Symbol         string              `json:"symbol"`
+	Expiry         string              `json:"expiry"`
+	DTE            int                 `json:"dte"`
+	Short          ibkr.OptionContract `json:"short"`
+	Long           ibkr.OptionContract `json:"long"`
+	Wings          []SpreadCandidate   `json:"wings,omitempty"`
+	Width          float64             `json:"width"`
+	Credit         float64             `json:"credit"`
+	MaxLoss        float64             `json:"maxLoss"`
+	RewardRisk     float64             `json:"rewardRisk"`
+	POP            float64             `json:"pop"`
+	ExpectedMove   float64             `json:"expectedMove"`
+	WidthVsMovePct float64             `json:"widthVsMovePct"`
+	NetDelta       float64             `json:"netDelta"`
+	NetGamma       float64             `json:"netGamma"`
+	NetTheta       float64             `json:"netTheta"`
+	NetVega        float64             `json:"netVega"`
+	Score          float64             `json:"score"`
+	Rejections     []RejectionReason   `json:"rejections,omitempty"`
+}
+
+// SpreadCandidates are the best spreads passing every filter and the best of
+// those knocked out by one or two filters, each with the reasons. Rejections
+// counts what every filter rejected across all spreads evaluated.
+type SpreadCandidates struct {
+	Symbol          string            `json:"symbol"`
+	UnderlyingPrice float64           `json:"underlyingPrice"`
+	Evaluated       int               `json:"evaluated"`
+	Candidates      []SpreadCandidate `json:"candidates"`
+	NearMisses      []SpreadCandidate `json:"nearMisses"`
+	Rejections      []RejectionStat   `json:"rejections"`
+	// Sector and MarketCap are the scanner's metadata of the underlying,
+	// empty when it has none
+	Sector    string  `json:"sector,omitempty"`
+	MarketCap float64 `json:"marketCap,omitempty"`
+}
+
+// ParseDirection returns the strategies for a direction: "bullish" builds
+// bull put spreads, "bearish" bear call spreads, "" or "both" either,
+// "neutral" iron condors and "all" every strategy
+func ParseDirection(direction string) ([]string, error) {
+	switch strings.ToUpper(strings.TrimSpace(direction)) {
+	case "", "BOTH":
+		return []string{BullPut, BearCall}, nil
+	case "BULLISH", "BULL", BullPut:
+		return []string{BullPut}, nil
+	case "BEARISH", "BEAR", BearCall:
+		return []string{BearCall}, nil
+	case "NEUTRAL", IronCondor:
+		return []string{IronCondor}, nil
+	case "ALL":
+		return append([]string(nil), SpreadStrategies...), nil
+	default:
+		return nil, fmt.Errorf("unknown direction %q, expected bullish, bearish, both, neutral or all", direction)
+	}
+}
+
+// SelectSpreads builds the spreads of the strategies from the chain, filters
+// and scores them, and returns the top candidates and near misses
+func SelectSpreads(chain ibkr.OptionChain, strategies []string, settings SpreadSettings, filters SpreadFilters) (SpreadCandidates, error) {
+	score, err := scoreFunc(settings.Score)
+	if err != nil {
+		return SpreadCandidates{}, err
+	}
+
+	result := SpreadCandidates{
+		Symbol:          chain.Symbol,
+		UnderlyingPrice: chain.UnderlyingPrice,
+		Candidates:      []SpreadCandidate{},
+		NearMisses:      []SpreadCandidate{},
+	}
+	counter := newRejectionCounter()
+	for _, strategy := range strategies {
+		var spreads []SpreadCandidate
+		if strategy == IronCondor {
+			spreads = BuildIronCondors(chain, settings, score)
+		} else {
+			spreads = BuildVerticals(chain, strategy, settings)
+		}
+		for _, spread := range spreads {
+			spread.Score = score(spread)
+			spread.Rejections = nil
+			for _, leg := range spread.legs() {
+				_, reasons := FilterOption(leg, filters)
+				spread.Rejections = append(spread.Rejections, reasons...)
+			}
+			_, spreadReasons := FilterSpread(spread, filters)
+			spread.Rejections = append(spread.Rejections, spreadReasons...)
+			counter.add(spread.Expiry, spread.Rejections)
+			result.Evaluated++
+
+			switch {
+			case len(spread.Rejections) == 0:
+				result.Candidates = append(result.Candidates, spread)
+			case len(spread.Rejections) <= nearMissRejections:
+				result.NearMisses = append(result.NearMisses, spread)
+			}
+		}
+	}
+
+	result.Candidates = topSpreads(result.Candidates, settings.MaxCandidates)
+	result.NearMisses = topSpreads(result.NearMisses, settings.MaxCandidates)
+	result.Rejections = counter.stats()
+	return result, nil
+}
+
+// BuildVerticals pairs each out of the money short strike, from StrikeOffset
+// strikes away from the money, with the long strike Width further out
+func BuildVerticals(chain ibkr.OptionChain, strategy string, settings SpreadSettings) []SpreadCandidate {
+	right := "P"
+	if strategy == BearCall {
+		right = "C"
+	}
+
+	byExpiry := make(map[string][]ibkr.OptionContract)
+	for _, contract := range chain.Contracts {
+		if contract.Right == right {
+			byExpiry[contract.Expiry] = append(byExpiry[contract.Expiry], contract)
+		}
+	}
+
+	expiries := make([]string, 0, len(byExpiry))
+	for expiry := range byExpiry {
+		expiries = append(expiries, expiry)
+	}
+	sort.Strings(expiries)
+
+	var spreads []SpreadCandidate
+	for _, expiry := range expiries {
+		contracts := byExpiry[expiry]
+		// Out of the money strikes, nearest the money first
+		var otm []ibkr.OptionContract
+		for _, contract := range contracts {
+			if (right == "P" && contract.Strike < chain.UnderlyingPrice) || (right == "C" && contract.Strike > chain.UnderlyingPrice) {
+				otm = append(otm, contract)
+			}
+		}
+		sort.Slice(otm, func(i, j int) bool {
+			return math.Abs(otm[i].Strike-chain.UnderlyingPrice) < math.Abs(otm[j].Strike-chain.UnderlyingPrice)
+		})
+
+		for i := settings.StrikeOffset; i < len(otm); i++ {
+			long, ok := longLeg(otm, i, settings.Width)
+			if !ok {
+				continue
+			}
+			spreads = append(spreads, newSpread(chain, strategy, otm[i], long))
+		}
+	}
+	return spreads
+}
+
+// BuildIronCondors combines, per expiry, the best put and call verticals by
+// score into iron condors. The verticals need a credit, and the call short
+// strike must lie above the put short strike.
+func BuildIronCondors(chain ibkr.OptionChain, settings SpreadSettings, score func(SpreadCandidate) float64) []SpreadCandidate {
+	wings := func(strategy string) map[string][]SpreadCandidate {
+		byExpiry := make(map[string][]SpreadCandidate)
+		for _, spread := range BuildVerticals(chain, strategy, settings) {
+			if spread.Credit > 0 {
+				spread.Score = score(spread)
+				byExpiry[spread.Expiry] = append(byExpiry[spread.Expiry], spread)
+			}
+		}
+		for expiry, spreads := range byExpiry {
+			byExpiry[expiry] = topSpreads(spreads, condorWings)
+		}
+		return byExpiry
+	}
+	puts, calls := wings(BullPut), wings(BearCall)
+
+	expiries := make([]string, 0, len(puts))
+	for expiry := range puts {
+		expiries = append(expiries, expiry)
+	}
+	sort.Strings(expiries)
+
+	var condors []SpreadCandidate
+	for _, expiry := range expiries {
+		for _, put := range puts[expiry] {
+			for _, call := range calls[expiry] {
+				if call.Short.Strike > put.Short.Strike {
+					condors = append(condors, newIronCondor(put, call))
+				}
+			}
+		}
+	}
+	return condors
+}
+
+// longLeg returns the contract further out of the money than otm[short] by
+// width, or the next one when width is 0
+func longLeg(otm []ibkr.OptionContract, short int, width float64) (ibkr.OptionContract, bool) {
+	for _, contract := range otm[short+1:] {
+		distance := math.Abs(contract.Strike - otm[short].Strike)
+		if width == 0 || math.Abs(distance-width) < 1e-6 {
+			return contract, true
+		}
+		if distance > width {
+			break
+		}
+	}
+	return ibkr.OptionContract{}, false
+}
+
+// newSpread computes the prices, probability and net Greeks of a credit
+// vertical selling short and buying long
+func newSpread(chain ibkr.OptionChain, strategy string, short, long ibkr.OptionContract) SpreadCandidate {
+	spread := SpreadCandidate{
+		Strategy: strategy,
+		Symbol:   chain.Symbol,
+		Expiry:   short.Expiry,
+		DTE:      short.DTE,
+		Short:    short,
+		Long:     long,
+		Width:    math.Abs(short.Strike - long.Strike),
+		Credit:   short.Mid - long.Mid,
+		POP:      (1 - math.Abs(short.Delta)) * 100,
+		NetDelta: long.Delta - short.Delta,
+		NetGamma: long.Gamma - short.Gamma,
+		NetTheta: long.Theta - short.Theta,
+		NetVega:  long.Vega - short.Vega,
+	}
+	spread.MaxLoss = spread.Width - spread.Credit
+	if spread.MaxLoss > 0 && spread.Credit > 0 {
+		spread.RewardRisk = spread.Credit / spread.MaxLoss
+	}
+	spread.ExpectedMove = chain.UnderlyingPrice * short.ImpliedVol * math.Sqrt(float64(short.DTE)/365)
+	if spread.ExpectedMove > 0 {
+		spread.WidthVsMovePct = spread.Width / spread.ExpectedMove * 100
+	}
+	return spread
+}
+
+// newIronCondor combines a bull put and a bear call vertical of the same
+// expiry. Only one wing can finish in the money, so the wings share margin:
+// the condor risks the wider wing's width less the total credit. It profits
+// when the underlying ends between the short strikes, which is approximated
+// from both short deltas.
+func newIronCondor(put, call SpreadCandidate) SpreadCandidate {
+	put.Score, call.Score = 0, 0
+	condor := SpreadCandidate{
+		Strategy: IronCondor,
+		Symbol:   put.Symbol,
+		Expiry:   put.Expiry,
+		DTE:      put.DTE,
+		Wings:    []SpreadCandidate{put, call},
+		Width:    math.Max(put.Width, call.Width),
+		Credit:   put.Credit + call.Credit,
+		POP:      math.Max(put.POP+call.POP-100, 0),
+		NetDelta: put.NetDelta + call.NetDelta,
+		NetGamma: put.NetGamma + call.NetGamma,
+		NetTheta: put.NetTheta + call.NetTheta,
+		NetVega:  put.NetVega + call.NetVega,
+	}
+	condor.MaxLoss = condor.Width - condor.Credit
+	if condor.MaxLoss > 0 && condor.Credit > 0 {
+		condor.RewardRisk = condor.Credit / condor.MaxLoss
+	}
+	condor.ExpectedMove = math.Max(put.ExpectedMove, call.ExpectedMove)
+	if condor.ExpectedMove > 0 {
+		condor.WidthVsMovePct = condor.Width / condor.ExpectedMove * 100
+	}
+	return condor
+}
+
+// legs returns the contracts of a spread: its short and long legs, or those
+// of each wing of an iron condor
+func (s SpreadCandidate) legs() []ibkr.OptionContract {
+	if len(s.Wings) == 0 {
+		return []ibkr.OptionContract{s.Short, s.Long}
+	}
+	var legs []ibkr.OptionContract
+	for _, wing := range s.Wings {
+		legs = append(legs, wing.legs()...)
+	}
+	return legs
+}
+
+// FilterOption reports whether an option passes the liquidity filters and
+// the reasons it does not
+func FilterOption(contract ibkr.OptionContract, filters SpreadFilters) (bool, []RejectionReason) {
+	var reasons []RejectionReason
+	leg := fmt.Sprintf("%g%s", contract.Strike, contract.Right)
+	if contract.OpenInterest < filters.MinOpenInterest {
+		reasons = append(reasons, RejectionReason{
+			Code: RejectMinOpenInterest, Leg: leg,
+			Value: float64(contract.OpenInterest), Threshold: float64(filters.MinOpenInterest),
+			Message: fmt.Sprintf("%s open interest %d below %d", leg, contract.OpenInterest, filters.MinOpenInterest),
+		})
+	}
+	if filters.MaxBidAskSpreadPercentage > 0 && contract.BidAskSpreadPct > filters.MaxBidAskSpreadPercentage {
+		reasons = append(reasons, RejectionReason{
+			Code: RejectSpreadTooWide, Leg: leg,
+			Value: contract.BidAskSpreadPct, Threshold: filters.MaxBidAskSpreadPercentage,
+			Message: fmt.Sprintf("%s bid-ask spread %.1f%% above %.1f%%", leg, contract.BidAskSpreadPct, filters.MaxBidAskSpreadPercentage),
+		})
+	}
+	return len(reasons) == 0, reasons
+}
+
+// FilterSpread reports whether a spread passes the pricing, probability,
+// volatility, Greek and timing filters and the reasons it does not
+func FilterSpread(spread SpreadCandidate, filters SpreadFilters) (bool, []RejectionReason) {
+	var reasons []RejectionReason
+	reject := func(code RejectionCode, value, threshold float64, format string, args ...interface{}) {
+		reasons = append(reasons, RejectionReason{
+			Code: code, Value: value, Threshold: threshold, Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	if spread.Credit <= 0 {
+		reject(RejectNoCredit, spread.Credit, 0, "no credit received (%.2f)", spread.Credit)
+	}
+	if spread.DTE < filters.MinDTE {
+		reject(RejectDTEOutOfRange, float64(spread.DTE), float64(filters.MinDTE), "%d days to expiry below %d", spread.DTE, filters.MinDTE)
+	} else if filters.MaxDTE > 0 && spread.DTE > filters.MaxDTE {
+		reject(RejectDTEOutOfRange, float64(spread.DTE), float64(filters.MaxDTE), "%d days to expiry above %d", spread.DTE, filters.MaxDTE)
+	}
+	if reason, skip := filters.SkipExpiries[spread.Expiry]; skip {
+		reject(RejectCorporateEvent, 0, 0, "%s expiry skipped: %s", spread.Expiry, reason)
+	}
+	if filters.UseIVRankFilter && filters.HasIVRank {
+		if filters.IVRank < filters.MinIVRank {
+			reject(RejectIVRankOutOfRange, filters.IVRank, filters.MinIVRank, "IV rank %.0f below %.0f", filters.IVRank, filters.MinIVRank)
+		} else if filters.IVRank > filters.MaxIVRank {
+			reject(RejectIVRankOutOfRange, filters.IVRank, filters.MaxIVRank, "IV rank %.0f above %.0f", filters.IVRank, filters.MaxIVRank)
+		}
+	}
+	if filters.UsePOPFilter && spread.POP < filters.MinProbabilityOfProfitPercentage {
+		reject(RejectMinPOP, spread.POP, filters.MinProbabilityOfProfitPercentage,
+			"probability of profit %.0f%% below %.0f%%", spread.POP, filters.MinProbabilityOfProfitPercentage)
+	}
+	if filters.UseWidthVsExpectedMoveFilter && spread.WidthVsMovePct > filters.MaxSpreadWidthVsExpectedMovePercentage {
+		reject(RejectWidthVsExpectedMove, spread.WidthVsMovePct, filters.MaxSpreadWidthVsExpectedMovePercentage,
+			"width %.0f%% of the expected move above %.0f%%", spread.WidthVsMovePct, filters.MaxSpreadWidthVsExpectedMovePercentage)
+	}
+
+	if filters.UseGreekLimits {
+		if filters.MaxAbsPositionDelta > 0 && math.Abs(spread.NetDelta) > filters.MaxAbsPositionDelta {
+			reject(RejectMaxDelta, spread.NetDelta, filters.MaxAbsPositionDelta, "net delta %.2f beyond %.2f", spread.NetDelta, filters.MaxAbsPositionDelta)
+		}
+		if filters.MaxAbsPositionGamma > 0 && math.Abs(spread.NetGamma) > filters.MaxAbsPositionGamma {
+			reject(RejectMaxGamma, spread.NetGamma, filters.MaxAbsPositionGamma, "net gamma %.3f beyond %.3f", spread.NetGamma, filters.MaxAbsPositionGamma)
+		}
+		if filters.MaxAbsPositionVega > 0 && math.Abs(spread.NetVega) > filters.MaxAbsPositionVega {
+			reject(RejectMaxVega, spread.NetVega, filters.MaxAbsPositionVega, "net vega %.2f beyond %.2f", spread.NetVega, filters.MaxAbsPositionVega)
+		}
+		if spread.NetTheta < filters.MinPositionTheta {
+			reject(RejectMinTheta, spread.NetTheta, filters.MinPositionTheta, "net theta %.3f below %.3f", spread.NetTheta, filters.MinPositionTheta)
+		}
+	}
+	return len(reasons) == 0, reasons
+}
+
+// scoreFunc returns the function computing a score; empty is POP_REWARD_RISK
+func scoreFunc(score string) (func(SpreadCandidate) float64, error) {
+	switch strings.ToUpper(score) {
+	case "", ScorePOPRewardRisk:
+		return func(s SpreadCandidate) float64 { return s.POP / 100 * s.RewardRisk }, nil
+	case ScorePOP:
+		return func(s SpreadCandidate) float64 { return s.POP }, nil
+	case ScoreRewardRisk:
+		return func(s SpreadCandidate) float64 { return s.RewardRisk }, nil
+	case ScoreCredit:
+		return func(s SpreadCandidate) float64 { return s.Credit }, nil
+	default:
+		return nil, fmt.Errorf("unknown spread score %q", score)
+	}
+}
+
+// topSpreads sorts spreads by descending score and keeps the first n; n of 0
+// keeps all
+func topSpreads(spreads []SpreadCandidate, n int) []SpreadCandidate {
+	sort.SliceStable(spreads, func(i, j int) bool { return spreads[i].Score > spreads[j].Score })
+	if n > 0 && len(spreads) > n {
+		spreads = spreads[:n]
+	}
+	return spreads
+}
@@ -0,0 +1,325 @@
+package options
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"traderadmin/backend/ibkr"
+)
+
+// syntheticChain is a 30 day chain on a $100 underlying with a strike every
+// $5. The 95/90 bull put and 105/110 bear call are the best spreads by POP
+// times reward over risk; the 85 put is illiquid.
+func syntheticChain() ibkr.OptionChain {
+	option := func(strike float64, right string, delta, mid float64, openInterest int) ibkr.OptionContract {
+		return ibkr.OptionContract{
+			OptionQuote: ibkr.OptionQuote{
+				OptionKey:    ibkr.OptionKey{Expiry: "20240405", Strike: strike, Right: right},
+				Bid:          mid - 0.01,
+				Ask:          mid + 0.01,
+				Delta:        delta,
+				Theta:        -mid / 30,
+				OpenInterest: openInterest,
+			},
+			Symbol:          "SPY",
+			DTE:             30,
+			Mid:             mid,
+			BidAskSpreadPct: 0.02 / mid * 100,
+		}
+	}
+	return ibkr.OptionChain{
+		Symbol:          "SPY",
+		UnderlyingPrice: 100,
+		Contracts: []ibkr.OptionContract{
+			option(85, "P", -0.07, 0.25, 100),
+			option(90, "P", -0.15, 0.60, 1500),
+			option(95, "P", -0.30, 1.50, 3000),
+			option(100, "P", -0.50, 3.00, 5000),
+			option(100, "C", 0.50, 3.10, 5000),
+			option(105, "C", 0.30, 1.40, 3000),
+			option(110, "C", 0.15, 0.55, 1500),
+			option(115, "C", 0.06, 0.20, 800),
+		},
+	}
+}
+
+func liquidityFilters() SpreadFilters {
+	return SpreadFilters{MinOpenInterest: 500, MaxBidAskSpreadPercentage: 10, MinDTE: 7, MaxDTE: 60}
+}
+
+// spreadNames returns the spreads as "95/90P", in order
+func spreadNames(spreads []SpreadCandidate) string {
+	names := make([]string, len(spreads))
+	for i, s := range spreads {
+		names[i] = fmt.Sprintf("%g/%g%s", s.Short.Strike, s.Long.Strike, s.Short.Right)
+	}
+	return strings.Join(names, " ")
+}
+
+func TestSelectSpreadsRanksByPOPTimesRewardRisk(t *testing.T) {
+	result, err := SelectSpreads(syntheticChain(), []string{BullPut, BearCall}, SpreadSettings{Width: 5, MaxCandidates: 10}, liquidityFilters())
+	if err != nil {
+		t.Fatalf("SelectSpreads() error = %v", err)
+	}
+
+	if result.Evaluated != 4 {
+		t.Errorf("Evaluated = %d, want 4", result.Evaluated)
+	}
+	if got := spreadNames(result.Candidates); got != "95/90P 105/110C 110/115C" {
+		t.Fatalf("Candidates = %s", got)
+	}
+
+	best := result.Candidates[0]
+	if best.Strategy != BullPut || math.Abs(best.Credit-0.90) > 1e-9 || math.Abs(best.MaxLoss-4.10) > 1e-9 {
+		t.Errorf("Best spread = %s credit %v max loss %v", best.Strategy, best.Credit, best.MaxLoss)
+	}
+	if math.Abs(best.POP-70) > 1e-9 || math.Abs(best.Score-0.7*0.90/4.10) > 1e-9 {
+		t.Errorf("Best spread POP = %v, score = %v", best.POP, best.Score)
+	}
+	if math.Abs(best.NetDelta-0.15) > 1e-9 || best.NetTheta <= 0 {
+		t.Errorf("Best spread net delta = %v, net theta = %v", best.NetDelta, best.NetTheta)
+	}
+
+	// The spread buying the illiquid 85 put is a near miss with the reason
+	if got := spreadNames(result.NearMisses); got != "90/85P" {
+		t.Fatalf("Near misses = %s", got)
+	}
+	if reasons := result.NearMisses[0].Rejections; len(reasons) != 1 || reasons[0].Message != "85P open interest 100 below 500" {
+		t.Errorf("Rejections = %v", reasons)
+	}
+}
+
+func TestSelectSpreadsReportsNearMisses(t *testing.T) {
+	filters := liquidityFilters()
+	filters.MinOpenInterest = 0
+	filters.UsePOPFilter = true
+	filters.MinProbabilityOfProfitPercentage = 80
+
+	result, err := SelectSpreads(syntheticChain(), []string{BullPut, BearCall}, SpreadSettings{Width: 5, MaxCandidates: 1}, filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the far spreads have a POP of 85%; one of each list is kept
+	if got := spreadNames(result.Candidates); got != "90/85P" && got != "110/115C" {
+		t.Errorf("Candidates = %s", got)
+	}
+	if got := spreadNames(result.NearMisses); got != "95/90P" {
+		t.Fatalf("Near misses = %s", got)
+	}
+	if reasons := result.NearMisses[0].Rejections; len(reasons) != 1 || reasons[0].Message != "probability of profit 70% below 80%" {
+		t.Errorf("Rejections = %v", reasons)
+	}
+}
+
+func TestBuildVerticalsHonorsWidthAndOffset(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		settings SpreadSettings
+		want     string
+	}{
+		{name: "Adjacent strikes", strategy: BullPut, settings: SpreadSettings{}, want: "95/90P 90/85P"},
+		{name: "Ten wide", strategy: BullPut, settings: SpreadSettings{Width: 10}, want: "95/85P"},
+		{name: "Offset by one strike", strategy: BearCall, settings: SpreadSettings{Width: 5, StrikeOffset: 1}, want: "110/115C"},
+		{name: "Width not listed", strategy: BearCall, settings: SpreadSettings{Width: 7.5}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := spreadNames(BuildVerticals(syntheticChain(), tt.strategy, tt.settings)); got != tt.want {
+				t.Errorf("BuildVerticals() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterSpreadReasonCodes(t *testing.T) {
+	spread := SpreadCandidate{Credit: 1, DTE: 30, POP: 70, WidthVsMovePct: 40, NetDelta: 0.2, NetGamma: -0.01, NetTheta: 0.02}
+	tests := []struct {
+		name    string
+		spread  func(SpreadCandidate) SpreadCandidate
+		filters SpreadFilters
+		want    []RejectionReason
+	}{
+		{
+			name:    "Passes",
+			filters: SpreadFilters{MinDTE: 7, MaxDTE: 45},
+		},
+		{
+			name:    "Debit and expiry too far",
+			spread:  func(s SpreadCandidate) SpreadCandidate { s.Credit = -0.1; s.DTE = 60; return s },
+			filters: SpreadFilters{MaxDTE: 45},
+			want:    []RejectionReason{{Code: RejectNoCredit, Value: -0.1}, {Code: RejectDTEOutOfRange, Value: 60, Threshold: 45}},
+		},
+		{
+			name:    "IV rank below range",
+			filters: SpreadFilters{UseIVRankFilter: true, MinIVRank: 30, MaxIVRank: 100, IVRank: 12, HasIVRank: true},
+			want:    []RejectionReason{{Code: RejectIVRankOutOfRange, Value: 12, Threshold: 30}},
+		},
+		{
+			name:    "IV rank without history",
+			filters: SpreadFilters{UseIVRankFilter: true, MinIVRank: 30, MaxIVRank: 100},
+		},
+		{
+			name:    "Probability and width",
+			filters: SpreadFilters{UsePOPFilter: true, MinProbabilityOfProfitPercentage: 80, UseWidthVsExpectedMoveFilter: true, MaxSpreadWidthVsExpectedMovePercentage: 25},
+			want:    []RejectionReason{{Code: RejectMinPOP, Value: 70, Threshold: 80}, {Code: RejectWidthVsExpectedMove, Value: 40, Threshold: 25}},
+		},
+		{
+			name:    "Greek limits",
+			filters: SpreadFilters{UseGreekLimits: true, MaxAbsPositionDelta: 0.1, MaxAbsPositionGamma: 0.05, MinPositionTheta: 0.05},
+			want:    []RejectionReason{{Code: RejectMaxDelta, Value: 0.2, Threshold: 0.1}, {Code: RejectMinTheta, Value: 0.02, Threshold: 0.05}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := spread
+			if tt.spread != nil {
+				s = tt.spread(spread)
+			}
+			ok, reasons := FilterSpread(s, tt.filters)
+			if ok != (len(tt.want) == 0) || len(reasons) != len(tt.want) {
+				t.Fatalf("FilterSpread() = %v, %v, want %v", ok, reasons, tt.want)
+			}
+			for i, want := range tt.want {
+				got := reasons[i]
+				if got.Code != want.Code || got.Value != want.Value || got.Threshold != want.Threshold || got.Message == "" {
+					t.Errorf("Reason %d = %+v, want %s %v/%v", i, got, want.Code, want.Value, want.Threshold)
+				}
+			}
+		})
+	}
+}
+
+func TestFilterOptionReasonCodes(t *testing.T) {
+	contract := syntheticChain().Contracts[0]
+	contract.BidAskSpreadPct = 25
+
+	ok, reasons := FilterOption(contract, liquidityFilters())
+	if ok || len(reasons) != 2 {
+		t.Fatalf("FilterOption() = %v, %v", ok, reasons)
+	}
+	if r := reasons[0]; r.Code != RejectMinOpenInterest || r.Leg != "85P" || r.Value != 100 || r.Threshold != 500 {
+		t.Errorf("Open interest reason = %+v", r)
+	}
+	if r := reasons[1]; r.Code != RejectSpreadTooWide || r.Leg != "85P" || r.Value != 25 || r.Threshold != 10 {
+		t.Errorf("Bid-ask reason = %+v", r)
+	}
+}
+
+func TestSelectSpreadsCountsRejections(t *testing.T) {
+	filters := liquidityFilters()
+	filters.UsePOPFilter = true
+	filters.MinProbabilityOfProfitPercentage = 80
+
+	result, err := SelectSpreads(syntheticChain(), []string{BullPut, BearCall}, SpreadSettings{Width: 5, MaxCandidates: 10}, filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 95/90P and 105/110C miss the POP filter; the 85 put is counted once
+	want := []RejectionStat{
+		{Code: RejectMinPOP, Count: 2, Summary: "2 spreads rejected for probability of profit"},
+		{Code: RejectMinOpenInterest, Count: 1, Summary: "1 contract rejected for open interest"},
+	}
+	if len(result.Rejections) != len(want) {
+		t.Fatalf("Rejections = %+v", result.Rejections)
+	}
+	for i := range want {
+		if result.Rejections[i] != want[i] {
+			t.Errorf("Rejections[%d] = %+v, want %+v", i, result.Rejections[i], want[i])
+		}
+	}
+}
+
+func TestParseDirection(t *testing.T) {
+	if got, _ := ParseDirection("bullish"); len(got) != 1 || got[0] != BullPut {
+		t.Errorf("bullish = %v", got)
+	}
+	if got, _ := ParseDirection(""); len(got) != 2 {
+		t.Errorf("empty direction = %v", got)
+	}
+	if got, _ := ParseDirection("neutral"); len(got) != 1 || got[0] != IronCondor {
+		t.Errorf("neutral = %v", got)
+	}
+	if _, err := ParseDirection("sideways"); err == nil {
+		t.Error("Expected an error for an unknown direction")
+	}
+}
+
+// condorNames returns iron condors as "95/90P 105/110C", in order
+func condorNames(condors []SpreadCandidate) []string {
+	names := make([]string, len(condors))
+	for i, condor := range condors {
+		names[i] = spreadNames(condor.Wings)
+	}
+	return names
+}
+
+func TestBuildIronCondors(t *testing.T) {
+	// A 125 call makes the 115/125 call wing twice as wide as the others
+	chain := syntheticChain()
+	far := chain.Contracts[len(chain.Contracts)-1]
+	far.Strike, far.Delta, far.Mid = 125, 0.02, 0.05
+	chain.Contracts = append(chain.Contracts, far)
+
+	score, _ := scoreFunc("")
+	condors := BuildIronCondors(chain, SpreadSettings{}, score)
+
+	// The best two put and three call wings by score
+	want := []string{
+		"95/90P 105/110C", "95/90P 110/115C", "95/90P 115/125C",
+		"90/85P 105/110C", "90/85P 110/115C", "90/85P 115/125C",
+	}
+	if got := condorNames(condors); strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Fatalf("Condors = %v, want %v", got, want)
+	}
+
+	for _, condor := range condors {
+		put, call := condor.Wings[0], condor.Wings[1]
+		if condor.Strategy != IronCondor || condor.Expiry != "20240405" {
+			t.Errorf("%s: strategy %s expiring %s", spreadNames(condor.Wings), condor.Strategy, condor.Expiry)
+		}
+		// Only one wing can lose, so the wider wing bounds the loss
+		wantLoss := math.Max(put.Width, call.Width) - (put.Credit + call.Credit)
+		if math.Abs(condor.MaxLoss-wantLoss) > 1e-9 {
+			t.Errorf("%s: max loss %.2f, want %.2f", spreadNames(condor.Wings), condor.MaxLoss, wantLoss)
+		}
+	}
+
+	uneven := condors[2]
+	if uneven.Width != 10 || math.Abs(uneven.Credit-1.05) > 1e-9 || math.Abs(uneven.MaxLoss-8.95) > 1e-9 {
+		t.Errorf("95/90P 115/125C width %g, credit %.2f, max loss %.2f; want 10, 1.05, 8.95", uneven.Width, uneven.Credit, uneven.MaxLoss)
+	}
+	if math.Abs(uneven.POP-64) > 1e-9 || math.Abs(uneven.NetDelta-0.11) > 1e-9 {
+		t.Errorf("95/90P 115/125C POP %.1f, net delta %.2f; want 64, 0.11", uneven.POP, uneven.NetDelta)
+	}
+}
+
+func TestSelectSpreadsIronCondors(t *testing.T) {
+	result, err := SelectSpreads(syntheticChain(), []string{IronCondor}, SpreadSettings{Width: 5, MaxCandidates: 10}, liquidityFilters())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Condors with the illiquid 85 put are near misses
+	if result.Evaluated != 4 || len(result.Candidates) != 2 || len(result.NearMisses) != 2 {
+		t.Fatalf("Evaluated %d, candidates %v, near misses %v", result.Evaluated, condorNames(result.Candidates), condorNames(result.NearMisses))
+	}
+	best := result.Candidates[0]
+	if got := spreadNames(best.Wings); got != "95/90P 105/110C" {
+		t.Errorf("Best condor = %s, want 95/90P 105/110C", got)
+	}
+	if math.Abs(best.Credit-1.75) > 1e-9 || math.Abs(best.MaxLoss-3.25) > 1e-9 || math.Abs(best.POP-40) > 1e-9 {
+		t.Errorf("Best condor credit %.2f, max loss %.2f, POP %.0f; want 1.75, 3.25, 40", best.Credit, best.MaxLoss, best.POP)
+	}
+	for _, miss := range result.NearMisses {
+		if len(miss.Rejections) != 1 || miss.Rejections[0].Leg != "85P" {
+			t.Errorf("%s rejections = %+v, want the 85 put's open interest", spreadNames(miss.Wings), miss.Rejections)
+		}
+	}
+}
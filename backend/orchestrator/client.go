@@ -0,0 +1,100 @@
+// Package orchestrator is TraderAdmin's client of the Python orchestrator's
+// control service
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	orchestratorpb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// ErrUnreachable is returned when the orchestrator cannot be reached
+var ErrUnreachable = errors.New("orchestrator unreachable")
+
+// Status is the state the orchestrator reports of itself
+type Status struct {
+	TradingActive bool   `json:"tradingActive"`
+	PausedReason  string `json:"pausedReason,omitempty"`
+	OpenPositions int    `json:"openPositions"`
+	LastError     string `json:"lastError,omitempty"`
+	// LastErrorAt and ConfigLoadedAt are zero when unknown
+	LastErrorAt    time.Time `json:"lastErrorAt,omitempty"`
+	ConfigLoadedAt time.Time `json:"configLoadedAt,omitempty"`
+}
+
+// Client calls the orchestrator's control service over one long-lived
+// connection
+type Client struct {
+	conn    *grpc.ClientConn
+	control orchestratorpb.OrchestratorControlClient
+}
+
+// Dial returns a client of the orchestrator at address. The connection is
+// made in the background and re-established by gRPC when it drops.
+func Dial(address string, options ...grpc.DialOption) (*Client, error) {
+	options = append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, options...)
+	conn, err := grpc.Dial(address, options...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnreachable, err)
+	}
+	return &Client{conn: conn, control: orchestratorpb.NewOrchestratorControlClient(conn)}, nil
+}
+
+// Close closes the connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// PauseTrading stops the orchestrator opening positions, recording reason
+func (c *Client) PauseTrading(ctx context.Context, reason string) (Status, error) {
+	return statusOf(c.control.PauseTrading(ctx, &orchestratorpb.PauseTradingRequest{Reason: reason}))
+}
+
+// ResumeTrading lets the orchestrator open positions again
+func (c *Client) ResumeTrading(ctx context.Context) (Status, error) {
+	return statusOf(c.control.ResumeTrading(ctx, &orchestratorpb.ResumeTradingRequest{}))
+}
+
+// ReloadConfig makes the orchestrator reread its configuration file
+func (c *Client) ReloadConfig(ctx context.Context) (Status, error) {
+	return statusOf(c.control.ReloadConfig(ctx, &orchestratorpb.ReloadConfigRequest{}))
+}
+
+// Status returns the orchestrator's state
+func (c *Client) Status(ctx context.Context) (Status, error) {
+	return statusOf(c.control.GetOrchestratorStatus(ctx, &orchestratorpb.OrchestratorStatusRequest{}))
+}
+
+// statusOf converts the response of a control call, wrapping ErrUnreachable
+// when the orchestrator could not be reached
+func statusOf(resp *orchestratorpb.OrchestratorStatus, err error) (Status, error) {
+	if err != nil {
+		switch status.Code(err) {
+		case codes.Unavailable, codes.DeadlineExceeded:
+			return Status{}, fmt.Errorf("%w: %v", ErrUnreachable, status.Convert(err).Message())
+		}
+		return Status{}, fmt.Errorf("orchestrator: %s", status.Convert(err).Message())
+	}
+
+	s := Status{
+		TradingActive: resp.TradingActive,
+		PausedReason:  resp.PausedReason,
+		OpenPositions: int(resp.OpenPositions),
+		LastError:     resp.LastError,
+	}
+	if resp.LastErrorUnix > 0 {
+		s.LastErrorAt = time.Unix(resp.LastErrorUnix, 0)
+	}
+	if resp.ConfigLoadedUnix > 0 {
+		s.ConfigLoadedAt = time.Unix(resp.ConfigLoadedUnix, 0)
+	}
+	return s, nil
+}
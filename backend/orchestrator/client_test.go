@@ -0,0 +1,117 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	orchestratorpb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// fakeOrchestrator keeps the trading state the control calls change and
+// fails ReloadConfig while badConfig is set
+type fakeOrchestrator struct {
+	orchestratorpb.UnimplementedOrchestratorControlServer
+	state     orchestratorpb.OrchestratorStatus
+	badConfig bool
+}
+
+func (f *fakeOrchestrator) PauseTrading(ctx context.Context, req *orchestratorpb.PauseTradingRequest) (*orchestratorpb.OrchestratorStatus, error) {
+	f.state.TradingActive, f.state.PausedReason = false, req.Reason
+	return f.GetOrchestratorStatus(ctx, nil)
+}
+
+func (f *fakeOrchestrator) ResumeTrading(ctx context.Context, _ *orchestratorpb.ResumeTradingRequest) (*orchestratorpb.OrchestratorStatus, error) {
+	f.state.TradingActive, f.state.PausedReason = true, ""
+	return f.GetOrchestratorStatus(ctx, nil)
+}
+
+func (f *fakeOrchestrator) ReloadConfig(ctx context.Context, _ *orchestratorpb.ReloadConfigRequest) (*orchestratorpb.OrchestratorStatus, error) {
+	if f.badConfig {
+		return nil, status.Error(codes.FailedPrecondition, "max_positions must be positive")
+	}
+	f.state.ConfigLoadedUnix = time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC).Unix()
+	return f.GetOrchestratorStatus(ctx, nil)
+}
+
+func (f *fakeOrchestrator) GetOrchestratorStatus(context.Context, *orchestratorpb.OrchestratorStatusRequest) (*orchestratorpb.OrchestratorStatus, error) {
+	state := orchestratorpb.OrchestratorStatus{
+		TradingActive:    f.state.TradingActive,
+		PausedReason:     f.state.PausedReason,
+		OpenPositions:    f.state.OpenPositions,
+		LastError:        f.state.LastError,
+		LastErrorUnix:    f.state.LastErrorUnix,
+		ConfigLoadedUnix: f.state.ConfigLoadedUnix,
+	}
+	return &state, nil
+}
+
+// serveFakeOrchestrator serves orchestrator over bufconn and returns a client
+// of it along with the listener
+func serveFakeOrchestrator(t *testing.T, orchestrator *fakeOrchestrator) (*Client, *bufconn.Listener) {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	orchestratorpb.RegisterOrchestratorControlServer(server, orchestrator)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	client, err := Dial("passthrough:///bufnet", grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return listener.DialContext(ctx)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client, listener
+}
+
+func TestControlCalls(t *testing.T) {
+	orchestrator := &fakeOrchestrator{}
+	orchestrator.state.TradingActive = true
+	orchestrator.state.OpenPositions = 3
+	orchestrator.state.LastError = "order 12 rejected"
+	orchestrator.state.LastErrorUnix = time.Date(2024, 1, 2, 14, 31, 0, 0, time.UTC).Unix()
+	client, _ := serveFakeOrchestrator(t, orchestrator)
+	ctx := context.Background()
+
+	s, err := client.Status(ctx)
+	if err != nil || !s.TradingActive || s.OpenPositions != 3 || s.LastError != "order 12 rejected" ||
+		!s.LastErrorAt.Equal(time.Date(2024, 1, 2, 14, 31, 0, 0, time.UTC)) || !s.ConfigLoadedAt.IsZero() {
+		t.Errorf("Status() = %+v, %v", s, err)
+	}
+
+	if s, err = client.PauseTrading(ctx, "config change"); err != nil || s.TradingActive || s.PausedReason != "config change" {
+		t.Errorf("PauseTrading() = %+v, %v", s, err)
+	}
+	if s, err = client.ReloadConfig(ctx); err != nil || s.ConfigLoadedAt.IsZero() {
+		t.Errorf("ReloadConfig() = %+v, %v", s, err)
+	}
+	if s, err = client.ResumeTrading(ctx); err != nil || !s.TradingActive || s.PausedReason != "" {
+		t.Errorf("ResumeTrading() = %+v, %v", s, err)
+	}
+
+	orchestrator.badConfig = true
+	if _, err := client.ReloadConfig(ctx); err == nil || errors.Is(err, ErrUnreachable) || !strings.Contains(err.Error(), "max_positions") {
+		t.Errorf("ReloadConfig() of an invalid config error = %v, want the orchestrator's reason", err)
+	}
+}
+
+func TestControlCallsToUnreachableOrchestrator(t *testing.T) {
+	client, listener := serveFakeOrchestrator(t, &fakeOrchestrator{})
+	listener.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.PauseTrading(ctx, ""); !errors.Is(err, ErrUnreachable) {
+		t.Errorf("PauseTrading() error = %v, want ErrUnreachable", err)
+	}
+}
@@ -0,0 +1,134 @@
+package risk
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// DefaultMultiplier is the contract multiplier for standard equity options
+const DefaultMultiplier = 100
+
+// Greeks holds per-contract option Greeks as reported by the option chain provider
+type Greeks struct {
+	Delta     float64   `json:"delta"`
+	Gamma     float64   `json:"gamma"`
+	Vega      float64   `json:"vega"`
+	Theta     float64   `json:"theta"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// LegExposure is a single option leg held (or to be held) in the portfolio together with its Greeks
+type LegExposure struct {
+	Symbol     string  `json:"symbol"`
+	Strike     float64 `json:"strike"`
+	Expiry     string  `json:"expiry"`
+	Right      string  `json:"right"`
+	Quantity   int     `json:"quantity"`   // Signed: positive for long, negative for short
+	Multiplier int     `json:"multiplier"` // Defaults to 100 when zero
+	Greeks     Greeks  `json:"greeks"`
+	Account    string  `json:"account,omitempty"` // IBKR account code holding the leg, empty when unknown
+}
+
+// PortfolioGreeks contains net portfolio Greeks in share-equivalent units
+// (per-contract Greek x signed quantity x multiplier)
+type PortfolioGreeks struct {
+	Delta      float64   `json:"delta"`
+	Gamma      float64   `json:"gamma"`
+	Vega       float64   `json:"vega"`
+	Theta      float64   `json:"theta"`
+	LegCount   int       `json:"legCount"`
+	Stale      bool      `json:"stale"`
+	StaleLegs  []string  `json:"staleLegs,omitempty"`
+	ComputedAt time.Time `json:"computedAt"`
+}
+
+// Limits defines portfolio-level Greek limits. A zero maximum is not
+// enforced, and neither is a nil MinNetTheta, as zero is a meaningful theta
+// floor that would reject every debit spread.
+type Limits struct {
+	MaxAbsNetDelta float64
+	MaxAbsNetGamma float64
+	MaxAbsNetVega  float64
+	MinNetTheta    *float64
+}
+
+// LimitCheck is the result of checking a new position against portfolio limits
+type LimitCheck struct {
+	Allowed    bool            `json:"allowed"`
+	Violations []string        `json:"violations,omitempty"`
+	Current    PortfolioGreeks `json:"current"`
+	Projected  PortfolioGreeks `json:"projected"`
+}
+
+// Aggregate computes net portfolio Greeks for the given legs. Legs whose Greeks
+// are older than maxAge (when positive) are flagged as stale but still included.
+func Aggregate(legs []LegExposure, now time.Time, maxAge time.Duration) PortfolioGreeks {
+	result := PortfolioGreeks{ComputedAt: now}
+
+	for _, leg := range legs {
+		weight := float64(leg.Quantity * leg.multiplier())
+
+		result.Delta += leg.Greeks.Delta * weight
+		result.Gamma += leg.Greeks.Gamma * weight
+		result.Vega += leg.Greeks.Vega * weight
+		result.Theta += leg.Greeks.Theta * weight
+		result.LegCount++
+
+		if maxAge > 0 && now.Sub(leg.Greeks.UpdatedAt) > maxAge {
+			result.Stale = true
+			result.StaleLegs = append(result.StaleLegs, leg.Description())
+		}
+	}
+
+	return result
+}
+
+// CheckNewPosition projects the portfolio Greeks after adding the new legs and
+// reports every limit the projected exposure would breach
+func CheckNewPosition(current []LegExposure, newLegs []LegExposure, limits Limits, now time.Time, maxAge time.Duration) LimitCheck {
+	combined := make([]LegExposure, 0, len(current)+len(newLegs))
+	combined = append(combined, current...)
+	combined = append(combined, newLegs...)
+
+	check := LimitCheck{
+		Current:   Aggregate(current, now, maxAge),
+		Projected: Aggregate(combined, now, maxAge),
+	}
+
+	projected := check.Projected
+	if limits.MaxAbsNetDelta > 0 && math.Abs(projected.Delta) > limits.MaxAbsNetDelta {
+		check.Violations = append(check.Violations, fmt.Sprintf("net delta %.2f exceeds limit %.2f", projected.Delta, limits.MaxAbsNetDelta))
+	}
+	if limits.MaxAbsNetGamma > 0 && math.Abs(projected.Gamma) > limits.MaxAbsNetGamma {
+		check.Violations = append(check.Violations, fmt.Sprintf("net gamma %.2f exceeds limit %.2f", projected.Gamma, limits.MaxAbsNetGamma))
+	}
+	if limits.MaxAbsNetVega > 0 && math.Abs(projected.Vega) > limits.MaxAbsNetVega {
+		check.Violations = append(check.Violations, fmt.Sprintf("net vega %.2f exceeds limit %.2f", projected.Vega, limits.MaxAbsNetVega))
+	}
+	if limits.MinNetTheta != nil && projected.Theta < *limits.MinNetTheta {
+		check.Violations = append(check.Violations, fmt.Sprintf("net theta %.2f below minimum %.2f", projected.Theta, *limits.MinNetTheta))
+	}
+
+	check.Allowed = len(check.Violations) == 0
+	return check
+}
+
+// Description returns a short human readable identifier for the leg
+func (l LegExposure) Description() string {
+	return fmt.Sprintf("%s %s %.2f%s x%d", l.Symbol, l.Expiry, l.Strike, l.Right, l.Quantity)
+}
+
+// multiplier returns the contract multiplier, defaulting to DefaultMultiplier
+func (l LegExposure) multiplier() int {
+	if l.Multiplier == 0 {
+		return DefaultMultiplier
+	}
+	return l.Multiplier
+}
+
+// ExposureSource provides the option legs currently held in the portfolio with their latest Greeks
+type ExposureSource interface {
+	OpenExposures(ctx context.Context) ([]LegExposure, error)
+}
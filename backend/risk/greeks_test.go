@@ -0,0 +1,107 @@
+package risk
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAggregateMultiLegSigns(t *testing.T) {
+	now := time.Date(2024, 3, 1, 15, 0, 0, 0, time.UTC)
+
+	// Bull put spread: short 400P, long 395P
+	legs := []LegExposure{
+		{Symbol: "SPY", Strike: 400, Expiry: "20240315", Right: "P", Quantity: -2,
+			Greeks: Greeks{Delta: -0.30, Gamma: 0.04, Vega: 0.20, Theta: -0.05, UpdatedAt: now}},
+		{Symbol: "SPY", Strike: 395, Expiry: "20240315", Right: "P", Quantity: 2,
+			Greeks: Greeks{Delta: -0.20, Gamma: 0.03, Vega: 0.15, Theta: -0.04, UpdatedAt: now}},
+	}
+
+	result := Aggregate(legs, now, time.Minute)
+
+	// Short put contributes positive delta, long put negative
+	want := PortfolioGreeks{Delta: 20, Gamma: -2, Vega: -10, Theta: 2}
+	if math.Abs(result.Delta-want.Delta) > 1e-9 {
+		t.Errorf("Delta mismatch: got %v, want %v", result.Delta, want.Delta)
+	}
+	if math.Abs(result.Gamma-want.Gamma) > 1e-9 {
+		t.Errorf("Gamma mismatch: got %v, want %v", result.Gamma, want.Gamma)
+	}
+	if math.Abs(result.Vega-want.Vega) > 1e-9 {
+		t.Errorf("Vega mismatch: got %v, want %v", result.Vega, want.Vega)
+	}
+	if math.Abs(result.Theta-want.Theta) > 1e-9 {
+		t.Errorf("Theta mismatch: got %v, want %v", result.Theta, want.Theta)
+	}
+	if result.Stale {
+		t.Errorf("Expected fresh Greeks, got stale legs %v", result.StaleLegs)
+	}
+}
+
+func TestAggregateFlagsStaleGreeks(t *testing.T) {
+	now := time.Date(2024, 3, 1, 15, 0, 0, 0, time.UTC)
+	legs := []LegExposure{
+		{Symbol: "QQQ", Strike: 350, Expiry: "20240315", Right: "C", Quantity: -1,
+			Greeks: Greeks{Delta: 0.25, UpdatedAt: now.Add(-10 * time.Minute)}},
+	}
+
+	result := Aggregate(legs, now, 5*time.Minute)
+	if !result.Stale || len(result.StaleLegs) != 1 {
+		t.Errorf("Expected one stale leg, got stale=%v legs=%v", result.Stale, result.StaleLegs)
+	}
+}
+
+func TestCheckNewPosition(t *testing.T) {
+	now := time.Date(2024, 3, 1, 15, 0, 0, 0, time.UTC)
+	limits := Limits{MaxAbsNetDelta: 100, MaxAbsNetGamma: 10, MaxAbsNetVega: 100, MinNetTheta: floatPtr(-50)}
+
+	current := []LegExposure{
+		{Symbol: "SPY", Strike: 400, Right: "P", Quantity: -2, Greeks: Greeks{Delta: -0.30, UpdatedAt: now}},
+	}
+
+	small := []LegExposure{
+		{Symbol: "IWM", Strike: 180, Right: "P", Quantity: -1, Greeks: Greeks{Delta: -0.20, UpdatedAt: now}},
+	}
+	check := CheckNewPosition(current, small, limits, now, time.Minute)
+	if !check.Allowed {
+		t.Errorf("Expected position to be allowed, got violations %v", check.Violations)
+	}
+	if math.Abs(check.Projected.Delta-80) > 1e-9 {
+		t.Errorf("Projected delta mismatch: got %v, want %v", check.Projected.Delta, 80.0)
+	}
+
+	large := []LegExposure{
+		{Symbol: "IWM", Strike: 180, Right: "P", Quantity: -3, Greeks: Greeks{Delta: -0.20, UpdatedAt: now}},
+	}
+	check = CheckNewPosition(current, large, limits, now, time.Minute)
+	if check.Allowed || len(check.Violations) != 1 {
+		t.Errorf("Expected one delta violation, got allowed=%v violations=%v", check.Allowed, check.Violations)
+	}
+}
+
+func TestCheckNewPositionThetaFloor(t *testing.T) {
+	now := time.Date(2024, 3, 1, 15, 0, 0, 0, time.UTC)
+
+	// Bull call debit spread: long 400C, short 405C, paying 3.00/day of decay
+	debit := []LegExposure{
+		{Symbol: "SPY", Strike: 400, Right: "C", Quantity: 1, Greeks: Greeks{Delta: 0.50, Theta: -0.08, UpdatedAt: now}},
+		{Symbol: "SPY", Strike: 405, Right: "C", Quantity: -1, Greeks: Greeks{Delta: 0.40, Theta: -0.05, UpdatedAt: now}},
+	}
+
+	// Without a theta floor the debit spread is allowed
+	limits := Limits{MaxAbsNetDelta: 500, MaxAbsNetGamma: 50, MaxAbsNetVega: 1000}
+	if check := CheckNewPosition(nil, debit, limits, now, time.Minute); !check.Allowed {
+		t.Errorf("Debit spread with no theta floor rejected: %v", check.Violations)
+	}
+
+	// A floor of zero rejects it
+	limits.MinNetTheta = floatPtr(0)
+	check := CheckNewPosition(nil, debit, limits, now, time.Minute)
+	if check.Allowed || len(check.Violations) != 1 || math.Abs(check.Projected.Theta+3) > 1e-9 {
+		t.Errorf("Expected one theta violation at -3.00, got allowed=%v theta=%v violations=%v", check.Allowed, check.Projected.Theta, check.Violations)
+	}
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
@@ -0,0 +1,111 @@
+package risk
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Errors for positions SizePosition cannot size
+var (
+	ErrNoEquity      = errors.New("account equity unavailable")
+	ErrUndefinedRisk = errors.New("max loss per contract must be positive and bounded")
+)
+
+// SizingInput is what SizePosition sizes a trade from. Limits of zero are
+// unlimited.
+type SizingInput struct {
+	Equity             float64 `json:"equity"`
+	RiskPercent        float64 `json:"riskPercent"`        // Percentage of the equity not already at risk to risk on the trade
+	MaxLossPerContract float64 `json:"maxLossPerContract"` // Dollars lost per spread at worst
+	OpenRisk           float64 `json:"openRisk"`           // Dollars the open positions can lose at worst
+	OpenPositions      int     `json:"openPositions"`
+	MaxPositions       int     `json:"maxPositions"`
+	TradesToday        int     `json:"tradesToday"`
+	MaxDailyTrades     int     `json:"maxDailyTrades"`
+}
+
+// PositionSize is the number of contracts a trade risks the configured share
+// of the account with, and whether the position limits permit the trade
+type PositionSize struct {
+	Quantity           int      `json:"quantity"`
+	MaxLossPerContract float64  `json:"maxLossPerContract"`
+	RiskBudget         float64  `json:"riskBudget"`
+	TotalRisk          float64  `json:"totalRisk"` // Dollars Quantity contracts lose at worst
+	OpenRisk           float64  `json:"openRisk"`
+	Permitted          bool     `json:"permitted"`
+	Reasons            []string `json:"reasons"` // Why the trade is not permitted
+}
+
+// SizePosition converts the risk per trade into whole contracts. The budget
+// is RiskPercent of the equity less the open risk, and the quantity rounds
+// down, so a contract losing more than the budget sizes to none.
+func SizePosition(in SizingInput) (PositionSize, error) {
+	if in.Equity <= 0 {
+		return PositionSize{}, ErrNoEquity
+	}
+	if in.MaxLossPerContract <= 0 || math.IsInf(in.MaxLossPerContract, 0) || math.IsNaN(in.MaxLossPerContract) {
+		return PositionSize{}, fmt.Errorf("%w, got %g", ErrUndefinedRisk, in.MaxLossPerContract)
+	}
+
+	size := PositionSize{
+		MaxLossPerContract: in.MaxLossPerContract,
+		RiskBudget:         max(in.Equity-in.OpenRisk, 0) * in.RiskPercent / 100,
+		OpenRisk:           in.OpenRisk,
+		Reasons:            []string{},
+	}
+	// The epsilon keeps a budget of exactly n contracts from rounding to n-1
+	size.Quantity = max(int(math.Floor(size.RiskBudget/in.MaxLossPerContract+1e-9)), 0)
+	size.TotalRisk = float64(size.Quantity) * in.MaxLossPerContract
+
+	if size.Quantity == 0 {
+		size.Reasons = append(size.Reasons, fmt.Sprintf("one contract risks %.2f, over the %.2f budget", in.MaxLossPerContract, size.RiskBudget))
+	}
+	if in.MaxPositions > 0 && in.OpenPositions >= in.MaxPositions {
+		size.Reasons = append(size.Reasons, fmt.Sprintf("%d open positions of at most %d", in.OpenPositions, in.MaxPositions))
+	}
+	if in.MaxDailyTrades > 0 && in.TradesToday >= in.MaxDailyTrades {
+		size.Reasons = append(size.Reasons, fmt.Sprintf("%d trades today of at most %d", in.TradesToday, in.MaxDailyTrades))
+	}
+	size.Permitted = len(size.Reasons) == 0
+	return size, nil
+}
+
+// MaxLoss returns the dollars legs lose at worst at expiry after premium, the
+// dollars paid for them (negative when received). It is +Inf when a short
+// call leaves the loss unbounded. The legs are taken to share an underlying
+// and an expiry.
+func MaxLoss(legs []LegExposure, premium float64) float64 {
+	// The payoff is linear between strikes, so its minimum lies at a strike,
+	// at zero or, when falling with the price, beyond the highest strike
+	prices := []float64{0}
+	slope := 0.0
+	for _, leg := range legs {
+		prices = append(prices, leg.Strike)
+		if leg.Right == "C" {
+			slope += float64(leg.Quantity * leg.multiplier())
+		}
+	}
+	if slope < 0 {
+		return math.Inf(1)
+	}
+
+	worst := math.Inf(1)
+	for _, price := range prices {
+		payoff := -premium
+		for _, leg := range legs {
+			payoff += float64(leg.Quantity*leg.multiplier()) * intrinsic(leg, price)
+		}
+		worst = min(worst, payoff)
+	}
+	return max(-worst, 0)
+}
+
+// intrinsic returns the value per share of leg at expiry with the underlying
+// at price
+func intrinsic(leg LegExposure, price float64) float64 {
+	if leg.Right == "C" {
+		return max(price-leg.Strike, 0)
+	}
+	return max(leg.Strike-price, 0)
+}
@@ -0,0 +1,154 @@
+package risk
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestSizePosition(t *testing.T) {
+	tests := []struct {
+		name          string
+		in            SizingInput
+		wantQuantity  int
+		wantRisk      float64
+		wantPermitted bool
+		wantReasons   []string
+	}{
+		{
+			name:         "Budget of whole contracts",
+			in:           SizingInput{Equity: 100000, RiskPercent: 1, MaxLossPerContract: 250},
+			wantQuantity: 4, wantRisk: 1000, wantPermitted: true, wantReasons: []string{},
+		},
+		{
+			name:         "Rounds down",
+			in:           SizingInput{Equity: 100000, RiskPercent: 1, MaxLossPerContract: 300},
+			wantQuantity: 3, wantRisk: 900, wantPermitted: true, wantReasons: []string{},
+		},
+		{
+			name:         "Fractional percentage",
+			in:           SizingInput{Equity: 50000, RiskPercent: 0.5, MaxLossPerContract: 125},
+			wantQuantity: 2, wantRisk: 250, wantPermitted: true, wantReasons: []string{},
+		},
+		{
+			name:         "Open risk shrinks the budget",
+			in:           SizingInput{Equity: 100000, RiskPercent: 1, MaxLossPerContract: 250, OpenRisk: 20000},
+			wantQuantity: 3, wantRisk: 750, wantPermitted: true, wantReasons: []string{},
+		},
+		{
+			name:         "Contract over the budget",
+			in:           SizingInput{Equity: 10000, RiskPercent: 1, MaxLossPerContract: 420},
+			wantQuantity: 0, wantRisk: 0, wantPermitted: false,
+			wantReasons: []string{"one contract risks 420.00, over the 100.00 budget"},
+		},
+		{
+			name:         "Open risk over the equity",
+			in:           SizingInput{Equity: 10000, RiskPercent: 1, MaxLossPerContract: 100, OpenRisk: 12000},
+			wantQuantity: 0, wantRisk: 0, wantPermitted: false,
+			wantReasons: []string{"one contract risks 100.00, over the 0.00 budget"},
+		},
+		{
+			name:         "At the maximum positions",
+			in:           SizingInput{Equity: 100000, RiskPercent: 2, MaxLossPerContract: 500, OpenPositions: 5, MaxPositions: 5},
+			wantQuantity: 4, wantRisk: 2000, wantPermitted: false,
+			wantReasons: []string{"5 open positions of at most 5"},
+		},
+		{
+			name:         "At the maximum daily trades",
+			in:           SizingInput{Equity: 100000, RiskPercent: 2, MaxLossPerContract: 500, TradesToday: 3, MaxDailyTrades: 3},
+			wantQuantity: 4, wantRisk: 2000, wantPermitted: false,
+			wantReasons: []string{"3 trades today of at most 3"},
+		},
+		{
+			name:         "Under the limits",
+			in:           SizingInput{Equity: 100000, RiskPercent: 2, MaxLossPerContract: 500, OpenPositions: 4, MaxPositions: 5, TradesToday: 2, MaxDailyTrades: 3},
+			wantQuantity: 4, wantRisk: 2000, wantPermitted: true, wantReasons: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			size, err := SizePosition(tt.in)
+			if err != nil {
+				t.Fatalf("SizePosition() error = %v", err)
+			}
+			if size.Quantity != tt.wantQuantity || math.Abs(size.TotalRisk-tt.wantRisk) > 1e-9 || size.Permitted != tt.wantPermitted {
+				t.Errorf("SizePosition() = %d contracts risking %v, permitted %v; want %d risking %v, permitted %v",
+					size.Quantity, size.TotalRisk, size.Permitted, tt.wantQuantity, tt.wantRisk, tt.wantPermitted)
+			}
+			if !reflect.DeepEqual(size.Reasons, tt.wantReasons) {
+				t.Errorf("Reasons = %q, want %q", size.Reasons, tt.wantReasons)
+			}
+		})
+	}
+}
+
+func TestSizePositionErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      SizingInput
+		wantErr error
+	}{
+		{name: "No equity", in: SizingInput{RiskPercent: 1, MaxLossPerContract: 250}, wantErr: ErrNoEquity},
+		{name: "Zero max loss", in: SizingInput{Equity: 100000, RiskPercent: 1}, wantErr: ErrUndefinedRisk},
+		{name: "Negative max loss", in: SizingInput{Equity: 100000, RiskPercent: 1, MaxLossPerContract: -50}, wantErr: ErrUndefinedRisk},
+		{name: "Unbounded max loss", in: SizingInput{Equity: 100000, RiskPercent: 1, MaxLossPerContract: math.Inf(1)}, wantErr: ErrUndefinedRisk},
+	}
+	for _, tt := range tests {
+		if _, err := SizePosition(tt.in); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: SizePosition() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestMaxLoss(t *testing.T) {
+	tests := []struct {
+		name    string
+		legs    []LegExposure
+		premium float64
+		want    float64
+	}{
+		{
+			name:    "Bull put spread for a credit",
+			legs:    []LegExposure{{Strike: 400, Right: "P", Quantity: -1}, {Strike: 395, Right: "P", Quantity: 1}},
+			premium: -120,
+			want:    380,
+		},
+		{
+			name:    "Bull call spread for a debit",
+			legs:    []LegExposure{{Strike: 400, Right: "C", Quantity: 1}, {Strike: 405, Right: "C", Quantity: -1}},
+			premium: 210,
+			want:    210,
+		},
+		{
+			name: "Iron condor",
+			legs: []LegExposure{
+				{Strike: 390, Right: "P", Quantity: 1}, {Strike: 395, Right: "P", Quantity: -1},
+				{Strike: 410, Right: "C", Quantity: -1}, {Strike: 420, Right: "C", Quantity: 1},
+			},
+			premium: -150,
+			want:    850,
+		},
+		{
+			name: "Quantity and multiplier",
+			legs: []LegExposure{{Strike: 50, Right: "P", Quantity: -2, Multiplier: 10}, {Strike: 45, Right: "P", Quantity: 2, Multiplier: 10}},
+			want: 100,
+		},
+		{
+			name:    "Naked put",
+			legs:    []LegExposure{{Strike: 100, Right: "P", Quantity: -1}},
+			premium: -300,
+			want:    9700,
+		},
+		{
+			name: "Naked call",
+			legs: []LegExposure{{Strike: 100, Right: "C", Quantity: -1}},
+			want: math.Inf(1),
+		},
+	}
+	for _, tt := range tests {
+		if got := MaxLoss(tt.legs, tt.premium); got != tt.want && math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: MaxLoss() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+// Package scanner is TraderAdmin's client of the scanner service
+package scanner
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+
+	scannerpb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// ErrUnreachable is returned when the scanner service cannot be reached
+var ErrUnreachable = errors.New("scanner unreachable")
+
+// ErrNoData is returned when the scanner has no bars for a symbol in the
+// requested range
+var ErrNoData = errors.New("symbol has no data")
+
+// keepaliveParams ping an idle connection so that a dead scanner is noticed
+// before the next request
+var keepaliveParams = keepalive.ClientParameters{
+	Time:                30 * time.Second,
+	Timeout:             10 * time.Second,
+	PermitWithoutStream: true,
+}
+
+// MarketData is one bar served by the scanner
+type MarketData struct {
+	Symbol    string    `json:"symbol"`
+	Timestamp time.Time `json:"timestamp"`
+	Open      float64   `json:"open"`
+	High      float64   `json:"high"`
+	Low       float64   `json:"low"`
+	Close     float64   `json:"close"`
+	Volume    int64     `json:"volume"`
+}
+
+// Signal is one signal of a scan, with the strength of its setup from 0 to
+// 100
+type Signal struct {
+	Symbol    string  `json:"symbol"`
+	Strategy  string  `json:"strategy"`
+	Direction string  `json:"direction"`
+	Score     float64 `json:"score"`
+}
+
+// Client calls the scanner service over one long-lived connection, or an
+// embedded scanner in-process
+type Client struct {
+	conn    *grpc.ClientConn
+	scanner scannerpb.ScannerServiceClient
+}
+
+// Dial returns a client of the scanner at address. The connection is made in
+// the background and re-established by gRPC when it drops.
+func Dial(address string, options ...grpc.DialOption) (*Client, error) {
+	options = append([]grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithKeepaliveParams(keepaliveParams),
+	}, options...)
+	conn, err := grpc.Dial(address, options...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnreachable, err)
+	}
+	return &Client{conn: conn, scanner: scannerpb.NewScannerServiceClient(conn)}, nil
+}
+
+// Close closes the connection, if the client has one
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+// FetchBars returns the daily bars of symbol between startDate and endDate
+// (YYYY-MM-DD) using the scanner's BulkFetch
+func (c *Client) FetchBars(ctx context.Context, symbol, startDate, endDate string) ([]MarketData, error) {
+	resp, err := c.scanner.BulkFetch(ctx, &scannerpb.BulkFetchRequest{
+		Symbols:   []string{symbol},
+		DateRange: &scannerpb.DateRange{StartDate: startDate, EndDate: endDate},
+	})
+	if err != nil {
+		return nil, callError("BulkFetch", err)
+	}
+
+	payload, ok := resp.Data[symbol]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", symbol, ErrNoData)
+	}
+	if resp.Compressed[symbol] {
+		if payload, err = gunzip(payload); err != nil {
+			return nil, fmt.Errorf("decompress %s bars: %w", symbol, err)
+		}
+	}
+
+	var bars []MarketData
+	if err := json.Unmarshal(payload, &bars); err != nil {
+		return nil, fmt.Errorf("decode %s bars: %w", symbol, err)
+	}
+	if len(bars) == 0 {
+		return nil, fmt.Errorf("%s: %w", symbol, ErrNoData)
+	}
+	return bars, nil
+}
+
+// LatestSignals returns the signals of the scanner's latest scan, ranked
+// strongest first. Signals past the scan's max_results are not ranked and
+// follow without a score, in symbol order.
+func (c *Client) LatestSignals(ctx context.Context) ([]Signal, error) {
+	resp, err := c.scanner.GetScanResults(ctx, &scannerpb.ResultsRequest{})
+	if err != nil {
+		return nil, callError("GetScanResults", err)
+	}
+	return signalsOf(resp), nil
+}
+
+// signalsOf returns the signals of a scan, ranked strongest first, followed
+// by those past its max_results without a score in symbol order
+func signalsOf(resp *scannerpb.ScanResponse) []Signal {
+	signals := make([]Signal, 0, len(resp.RankedSignals))
+	ranked := make(map[Signal]bool, len(resp.RankedSignals))
+	for _, signal := range resp.RankedSignals {
+		signals = append(signals, Signal{Symbol: signal.Symbol, Strategy: signal.Strategy, Direction: signal.Direction, Score: signal.Score})
+		ranked[Signal{Symbol: signal.Symbol, Strategy: signal.Strategy, Direction: signal.Direction}] = true
+	}
+
+	symbols := make([]string, 0, len(resp.Signals))
+	for symbol := range resp.Signals {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	for _, symbol := range symbols {
+		list := resp.Signals[symbol]
+		for i, direction := range list.SignalTypes {
+			signal := Signal{Symbol: symbol, Direction: direction}
+			if i < len(list.Strategies) {
+				signal.Strategy = list.Strategies[i]
+			}
+			if !ranked[signal] {
+				signals = append(signals, signal)
+			}
+		}
+	}
+	return signals
+}
+
+// callError wraps the error of a call of method, as ErrUnreachable when the
+// scanner could not be reached
+func callError(method string, err error) error {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return fmt.Errorf("%w: %v", ErrUnreachable, status.Convert(err).Message())
+	}
+	return fmt.Errorf("scanner %s: %w", method, err)
+}
+
+// gunzip decompresses a payload the scanner gzipped
+func gunzip(payload []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// Downsample merges consecutive bars so that at most max remain. Each merged
+// bar opens at its first bar, closes at its last and spans their range and
+// volume, so a chart keeps the extremes.
+func Downsample(bars []MarketData, max int) []MarketData {
+	if max <= 0 || len(bars) <= max {
+		return bars
+	}
+	size := (len(bars) + max - 1) / max
+
+	merged := make([]MarketData, 0, (len(bars)+size-1)/size)
+	for start := 0; start < len(bars); start += size {
+		end := start + size
+		if end > len(bars) {
+			end = len(bars)
+		}
+		bar := bars[start]
+		for _, next := range bars[start+1 : end] {
+			if next.High > bar.High {
+				bar.High = next.High
+			}
+			if next.Low < bar.Low {
+				bar.Low = next.Low
+			}
+			bar.Volume += next.Volume
+		}
+		bar.Close = bars[end-1].Close
+		merged = append(merged, bar)
+	}
+	return merged
+}
@@ -0,0 +1,178 @@
+package scanner
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+
+	scannerpb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// fakeScanner serves daily bars for AAPL, gzipped bars for BIG and nothing
+// for other symbols, the way the scanner leaves out symbols it cannot fetch
+type fakeScanner struct {
+	scannerpb.UnimplementedScannerServiceServer
+	requests []*scannerpb.BulkFetchRequest
+}
+
+func (f *fakeScanner) BulkFetch(ctx context.Context, req *scannerpb.BulkFetchRequest) (*scannerpb.BulkFetchResponse, error) {
+	f.requests = append(f.requests, req)
+	resp := &scannerpb.BulkFetchResponse{Data: map[string][]byte{}, Compressed: map[string]bool{}}
+	for _, symbol := range req.Symbols {
+		switch symbol {
+		case "AAPL":
+			resp.Data[symbol], _ = json.Marshal(testBars(symbol, 3))
+		case "BIG":
+			payload, _ := json.Marshal(testBars(symbol, 1000))
+			var buf bytes.Buffer
+			writer := gzip.NewWriter(&buf)
+			writer.Write(payload)
+			writer.Close()
+			resp.Data[symbol] = buf.Bytes()
+			resp.Compressed[symbol] = true
+		case "EMPTY":
+			resp.Data[symbol] = []byte("[]")
+		}
+	}
+	return resp, nil
+}
+
+// testBars returns n daily bars whose close rises by one a day
+func testBars(symbol string, n int) []MarketData {
+	bars := make([]MarketData, n)
+	start := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	for i := range bars {
+		close := 100 + float64(i)
+		bars[i] = MarketData{
+			Symbol:    symbol,
+			Timestamp: start.AddDate(0, 0, i),
+			Open:      close - 0.5,
+			High:      close + 1,
+			Low:       close - 1,
+			Close:     close,
+			Volume:    1000,
+		}
+	}
+	return bars
+}
+
+// serveFakeScanner serves scanner over bufconn and returns a client of it
+// along with the listener
+func serveFakeScanner(t *testing.T, scanner scannerpb.ScannerServiceServer) (*Client, *bufconn.Listener) {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	scannerpb.RegisterScannerServiceServer(server, scanner)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	client, err := Dial("passthrough:///bufnet", grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return listener.DialContext(ctx)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client, listener
+}
+
+func TestFetchBars(t *testing.T) {
+	scanner := &fakeScanner{}
+	client, _ := serveFakeScanner(t, scanner)
+	ctx := context.Background()
+
+	bars, err := client.FetchBars(ctx, "AAPL", "2024-01-02", "2024-01-04")
+	if err != nil {
+		t.Fatalf("FetchBars(AAPL) error = %v", err)
+	}
+	if len(bars) != 3 || bars[2].Close != 102 || !bars[0].Timestamp.Equal(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("FetchBars(AAPL) = %+v", bars)
+	}
+	if req := scanner.requests[0]; len(req.Symbols) != 1 || req.DateRange.StartDate != "2024-01-02" || req.DateRange.EndDate != "2024-01-04" {
+		t.Errorf("BulkFetch request = %v", req)
+	}
+
+	bars, err = client.FetchBars(ctx, "BIG", "2020-01-01", "2024-01-01")
+	if err != nil || len(bars) != 1000 {
+		t.Fatalf("FetchBars(BIG) = %d bars, %v; want the 1000 gzipped bars", len(bars), err)
+	}
+
+	for _, symbol := range []string{"NONE", "EMPTY"} {
+		if _, err := client.FetchBars(ctx, symbol, "2024-01-02", "2024-01-04"); !errors.Is(err, ErrNoData) {
+			t.Errorf("FetchBars(%s) error = %v, want ErrNoData", symbol, err)
+		}
+	}
+
+	// Every request went over the one connection
+	if len(scanner.requests) != 4 {
+		t.Errorf("BulkFetch calls = %d, want 4", len(scanner.requests))
+	}
+}
+
+// scanResults is a fakeScanner whose latest scan ranked AAPL's signal and
+// left SPY's past max_results
+type scanResults struct {
+	fakeScanner
+}
+
+func (s *scanResults) GetScanResults(ctx context.Context, req *scannerpb.ResultsRequest) (*scannerpb.ScanResponse, error) {
+	return &scannerpb.ScanResponse{
+		Signals: map[string]*scannerpb.SignalList{
+			"SPY":  {SignalTypes: []string{"LONG"}, Strategies: []string{"HIGH_BASE"}},
+			"AAPL": {SignalTypes: []string{"LONG"}, Strategies: []string{"HIGH_BASE"}},
+		},
+		RankedSignals: []*scannerpb.RankedSignal{{Symbol: "AAPL", Strategy: "HIGH_BASE", Direction: "LONG", Score: 71}},
+	}, nil
+}
+
+func TestLatestSignals(t *testing.T) {
+	client, _ := serveFakeScanner(t, &scanResults{})
+	signals, err := client.LatestSignals(context.Background())
+	want := []Signal{
+		{Symbol: "AAPL", Strategy: "HIGH_BASE", Direction: "LONG", Score: 71},
+		{Symbol: "SPY", Strategy: "HIGH_BASE", Direction: "LONG"},
+	}
+	if err != nil || len(signals) != 2 || signals[0] != want[0] || signals[1] != want[1] {
+		t.Errorf("LatestSignals() = %+v, %v; want %+v", signals, err, want)
+	}
+}
+
+func TestFetchBarsFromUnreachableScanner(t *testing.T) {
+	client, listener := serveFakeScanner(t, &fakeScanner{})
+	listener.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.FetchBars(ctx, "AAPL", "2024-01-02", "2024-01-04"); !errors.Is(err, ErrUnreachable) {
+		t.Errorf("FetchBars() error = %v, want ErrUnreachable", err)
+	}
+}
+
+func TestDownsample(t *testing.T) {
+	bars := testBars("AAPL", 1001)
+	sampled := Downsample(bars, 500)
+	if len(sampled) != 334 {
+		t.Fatalf("Downsample(1001 bars, 500) = %d bars, want 334 of 3 bars each", len(sampled))
+	}
+
+	first := sampled[0]
+	if !first.Timestamp.Equal(bars[0].Timestamp) || first.Open != bars[0].Open || first.Close != bars[2].Close ||
+		first.High != bars[2].High || first.Low != bars[0].Low || first.Volume != 3000 {
+		t.Errorf("First merged bar = %+v", first)
+	}
+	if last := sampled[len(sampled)-1]; last.Close != bars[1000].Close || last.Volume != 2000 {
+		t.Errorf("Last merged bar = %+v, want the last two bars", last)
+	}
+
+	if short := Downsample(bars[:10], 500); len(short) != 10 {
+		t.Errorf("Downsample(10 bars, 500) = %d bars, want them unchanged", len(short))
+	}
+}
@@ -0,0 +1,55 @@
+package scanner
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	engine "github.com/trustdan/ibkr-trader/go/pkg/scanner"
+)
+
+// Embedded is a scanner engine running in TraderAdmin's process, for setups
+// without a scanner service to dial
+type Embedded struct {
+	engine *engine.Engine
+}
+
+// LoadEmbeddedConfig returns the configuration of an embedded scanner: the
+// scanner's defaults overridden by the YAML file at path, when set, and by
+// the SCANNER_ environment variables, as the scanner service loads its own
+func LoadEmbeddedConfig(path string) (*engine.Config, []engine.ConfigWarning, error) {
+	if path == "" {
+		return engine.DefaultConfig(), nil, nil
+	}
+	return engine.LoadLayeredConfig(path, nil)
+}
+
+// NewEmbedded returns a stopped scanner engine of cfg whose metrics are
+// registered with reg. Its metrics can only be registered once, so a
+// registry serves one embedded scanner.
+func NewEmbedded(cfg *engine.Config, reg prometheus.Registerer) *Embedded {
+	return &Embedded{engine: engine.NewEngine(cfg, nil, reg)}
+}
+
+// Start runs the scheduled scans, the cache warm-up and the memory guard the
+// configuration enables until Stop or until ctx is done
+func (e *Embedded) Start(ctx context.Context) {
+	e.engine.Start(ctx)
+}
+
+// Stop stops the background work of Start
+func (e *Embedded) Stop() {
+	e.engine.Stop()
+}
+
+// Reload replaces the engine's configuration, as a scanner service does when
+// its config file changes
+func (e *Embedded) Reload(cfg *engine.Config) {
+	e.engine.UpdateConfig(cfg)
+}
+
+// Client returns a client calling the engine directly rather than over the
+// network. Closing it leaves the engine running.
+func (e *Embedded) Client() *Client {
+	return &Client{scanner: e.engine.Client()}
+}
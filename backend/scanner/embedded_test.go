@@ -0,0 +1,69 @@
+package scanner
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	engine "github.com/trustdan/ibkr-trader/go/pkg/scanner"
+)
+
+func TestEmbeddedMatchesService(t *testing.T) {
+	cfg := engine.DefaultConfig()
+	cfg.DataProviderType = "mock"
+	cfg.CacheEnabled = false
+	cfg.EventCalendarType = "none"
+	reg := prometheus.NewRegistry()
+	embedded := NewEmbedded(cfg, reg)
+
+	// The same engine served over gRPC, as the scanner service serves it
+	remote, _ := serveFakeScanner(t, engine.NewEngineService(embedded.engine))
+	local := embedded.Client()
+	defer local.Close()
+	ctx := context.Background()
+
+	scan := ScanRequest{
+		Symbols:   []string{"AAPL", "MSFT", "SPY", "QQQ", "TSLA", "NVDA"},
+		StartDate: "2023-06-01",
+		EndDate:   "2024-06-28",
+	}
+	viaGRPC, err := remote.Scan(ctx, scan)
+	if err != nil {
+		t.Fatalf("Scan over gRPC failed: %v", err)
+	}
+	inProcess, err := local.Scan(ctx, scan)
+	if err != nil {
+		t.Fatalf("Scan in-process failed: %v", err)
+	}
+	viaGRPC.ScanTimeSeconds, inProcess.ScanTimeSeconds = 0, 0
+	if len(viaGRPC.Signals) == 0 || !reflect.DeepEqual(viaGRPC, inProcess) {
+		t.Errorf("Scan results differ:\ngRPC:     %+v\nembedded: %+v", viaGRPC, inProcess)
+	}
+
+	barsGRPC, err := remote.FetchBars(ctx, "AAPL", "2024-01-02", "2024-03-01")
+	if err != nil {
+		t.Fatalf("FetchBars over gRPC failed: %v", err)
+	}
+	barsInProcess, err := local.FetchBars(ctx, "AAPL", "2024-01-02", "2024-03-01")
+	if err != nil {
+		t.Fatalf("FetchBars in-process failed: %v", err)
+	}
+	if len(barsGRPC) == 0 || !reflect.DeepEqual(barsGRPC, barsInProcess) {
+		t.Errorf("FetchBars returned %d bars over gRPC and %d in-process", len(barsGRPC), len(barsInProcess))
+	}
+
+	// The engine's metrics are in the registry it was given
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, family := range families {
+		found = found || family.GetName() == "scanner_scan_duration_seconds"
+	}
+	if !found {
+		t.Error("scanner_scan_duration_seconds is not in the registry")
+	}
+}
@@ -0,0 +1,178 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	scannerpb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// MaxMetadataBatch is the most symbols the scanner returns metadata of per
+// call
+const MaxMetadataBatch = 500
+
+// maxMetadataAttempts bounds the fetches of a metadata snapshot that keeps
+// changing between batches
+const maxMetadataAttempts = 3
+
+// DefaultMetadataPollInterval is how often a MetadataCache asks the scanner
+// whether its metadata changed
+const DefaultMetadataPollInterval = time.Minute
+
+// SymbolMetadata is the scanner's metadata of a symbol. Present is false for
+// a symbol the scanner has no metadata for, whose sector is UNKNOWN.
+type SymbolMetadata struct {
+	Symbol    string  `json:"symbol"`
+	Present   bool    `json:"present"`
+	Sector    string  `json:"sector"`
+	Industry  string  `json:"industry"`
+	MarketCap float64 `json:"marketCap"`
+}
+
+// MetadataSnapshot is the metadata of the symbols asked for and the etag of
+// the scanner's metadata they come from. NotModified is set, without
+// symbols, when the etag asked with is still current.
+type MetadataSnapshot struct {
+	ETag        string
+	NotModified bool
+	Symbols     []SymbolMetadata
+}
+
+// SymbolMetadata returns the scanner's sector, industry and market cap of
+// symbols, in order, asking for MaxMetadataBatch at a time. When etag is
+// still the etag of the scanner's metadata, only NotModified is returned.
+// A snapshot that changes between batches is fetched again.
+func (c *Client) SymbolMetadata(ctx context.Context, symbols []string, etag string) (MetadataSnapshot, error) {
+	for attempt := 0; attempt < maxMetadataAttempts; attempt++ {
+		snapshot := MetadataSnapshot{Symbols: make([]SymbolMetadata, 0, len(symbols))}
+		changed := false
+		for start := 0; start == 0 || start < len(symbols); start += MaxMetadataBatch {
+			batch := symbols[start:min(start+MaxMetadataBatch, len(symbols))]
+			resp, err := c.scanner.GetSymbolMetadata(ctx, &scannerpb.SymbolMetadataRequest{Symbols: batch, IfNoneMatch: etag})
+			if err != nil {
+				return MetadataSnapshot{}, callError("GetSymbolMetadata", err)
+			}
+			if resp.NotModified {
+				return MetadataSnapshot{ETag: resp.Etag, NotModified: true}, nil
+			}
+			if start > 0 && resp.Etag != snapshot.ETag {
+				changed = true
+				break
+			}
+			// The later batches must come from the same snapshot
+			snapshot.ETag, etag = resp.Etag, ""
+			for _, meta := range resp.Symbols {
+				snapshot.Symbols = append(snapshot.Symbols, SymbolMetadata{
+					Symbol:    meta.Symbol,
+					Present:   meta.Present,
+					Sector:    meta.Sector,
+					Industry:  meta.Industry,
+					MarketCap: meta.MarketCap,
+				})
+			}
+		}
+		if !changed {
+			return snapshot, nil
+		}
+	}
+	return MetadataSnapshot{}, fmt.Errorf("scanner GetSymbolMetadata: metadata changed during each of %d attempts", maxMetadataAttempts)
+}
+
+// MetadataSource serves symbol metadata snapshots, as Client does
+type MetadataSource interface {
+	SymbolMetadata(ctx context.Context, symbols []string, etag string) (MetadataSnapshot, error)
+}
+
+// MetadataCache keeps the scanner's metadata of the symbols looked up, so
+// that TraderAdmin shares the scanner's metadata instead of loading its own.
+// Every PollInterval it asks the scanner whether its snapshot changed, which
+// costs one call without symbols, and drops the cached metadata when it has.
+type MetadataCache struct {
+	PollInterval time.Duration
+
+	mu      sync.Mutex
+	etag    string
+	checked time.Time
+	entries map[string]SymbolMetadata
+	now     func() time.Time
+}
+
+// NewMetadataCache returns an empty cache polling every
+// DefaultMetadataPollInterval
+func NewMetadataCache() *MetadataCache {
+	return &MetadataCache{PollInterval: DefaultMetadataPollInterval, entries: map[string]SymbolMetadata{}, now: time.Now}
+}
+
+// Lookup returns the metadata of symbols, in order, fetching from source the
+// symbols not cached yet
+func (c *MetadataCache) Lookup(ctx context.Context, source MetadataSource, symbols []string) ([]SymbolMetadata, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.etag != "" && c.now().Sub(c.checked) >= c.PollInterval {
+		snapshot, err := source.SymbolMetadata(ctx, nil, c.etag)
+		if err != nil {
+			return nil, err
+		}
+		if !snapshot.NotModified {
+			c.reset(snapshot.ETag)
+		}
+		c.checked = c.now()
+	}
+
+	for attempt := 0; ; attempt++ {
+		missing := c.missing(symbols)
+		if len(missing) == 0 {
+			break
+		}
+		if attempt == maxMetadataAttempts {
+			return nil, fmt.Errorf("scanner GetSymbolMetadata: metadata changed during each of %d attempts", maxMetadataAttempts)
+		}
+		snapshot, err := source.SymbolMetadata(ctx, missing, "")
+		if err != nil {
+			return nil, err
+		}
+		// Metadata cached from an older snapshot is fetched again
+		if snapshot.ETag != c.etag {
+			c.reset(snapshot.ETag)
+			c.checked = c.now()
+		}
+		for _, meta := range snapshot.Symbols {
+			c.entries[meta.Symbol] = meta
+		}
+	}
+
+	result := make([]SymbolMetadata, len(symbols))
+	for i, symbol := range symbols {
+		result[i] = c.entries[normalizeSymbol(symbol)]
+	}
+	return result, nil
+}
+
+// reset drops the cached metadata for the snapshot etag
+func (c *MetadataCache) reset(etag string) {
+	c.etag = etag
+	c.entries = map[string]SymbolMetadata{}
+}
+
+// missing returns the symbols not cached, once each
+func (c *MetadataCache) missing(symbols []string) []string {
+	var missing []string
+	seen := make(map[string]bool, len(symbols))
+	for _, symbol := range symbols {
+		symbol = normalizeSymbol(symbol)
+		if _, ok := c.entries[symbol]; !ok && !seen[symbol] {
+			seen[symbol] = true
+			missing = append(missing, symbol)
+		}
+	}
+	return missing
+}
+
+// normalizeSymbol upper-cases a symbol, as the scanner reports it
+func normalizeSymbol(symbol string) string {
+	return strings.ToUpper(strings.TrimSpace(symbol))
+}
@@ -0,0 +1,122 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	scannerpb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// metadataScanner serves metadata of every symbol but ZZZZ from the snapshot
+// etag, recording the symbols of each call
+type metadataScanner struct {
+	scannerpb.UnimplementedScannerServiceServer
+	etag    string
+	batches [][]string
+}
+
+func (m *metadataScanner) GetSymbolMetadata(ctx context.Context, req *scannerpb.SymbolMetadataRequest) (*scannerpb.SymbolMetadataResponse, error) {
+	m.batches = append(m.batches, req.Symbols)
+	resp := &scannerpb.SymbolMetadataResponse{Etag: m.etag}
+	if req.IfNoneMatch == m.etag {
+		resp.NotModified = true
+		return resp, nil
+	}
+	for _, symbol := range req.Symbols {
+		resp.Symbols = append(resp.Symbols, &scannerpb.SymbolMetadata{Symbol: symbol, Present: symbol != "ZZZZ", Sector: "Technology", MarketCap: 1e12})
+	}
+	return resp, nil
+}
+
+func TestSymbolMetadataBatches(t *testing.T) {
+	fake := &metadataScanner{etag: "v1"}
+	client, _ := serveFakeScanner(t, fake)
+	symbols := make([]string, MaxMetadataBatch+1)
+	for i := range symbols {
+		symbols[i] = fmt.Sprintf("S%d", i)
+	}
+	symbols[MaxMetadataBatch] = "ZZZZ"
+
+	snapshot, err := client.SymbolMetadata(context.Background(), symbols, "")
+	if err != nil {
+		t.Fatalf("SymbolMetadata() error = %v", err)
+	}
+	if len(fake.batches) != 2 || len(fake.batches[0]) != MaxMetadataBatch || len(fake.batches[1]) != 1 {
+		t.Errorf("Calls = %d, want batches of 500 and 1", len(fake.batches))
+	}
+	if snapshot.ETag != "v1" || len(snapshot.Symbols) != len(symbols) || !snapshot.Symbols[0].Present || snapshot.Symbols[MaxMetadataBatch].Present {
+		t.Errorf("Snapshot %q of %d symbols, want v1 with ZZZZ missing", snapshot.ETag, len(snapshot.Symbols))
+	}
+
+	fake.batches = nil
+	if snapshot, err := client.SymbolMetadata(context.Background(), symbols, "v1"); err != nil || !snapshot.NotModified || len(fake.batches) != 1 {
+		t.Errorf("SymbolMetadata(v1) = %+v, %v after %d calls; want not modified after one", snapshot, err, len(fake.batches))
+	}
+}
+
+// countingSource is a MetadataSource over a metadataScanner's snapshot,
+// without a server
+type countingSource struct {
+	metadataScanner
+}
+
+func (c *countingSource) SymbolMetadata(ctx context.Context, symbols []string, etag string) (MetadataSnapshot, error) {
+	resp, _ := c.GetSymbolMetadata(ctx, &scannerpb.SymbolMetadataRequest{Symbols: symbols, IfNoneMatch: etag})
+	snapshot := MetadataSnapshot{ETag: resp.Etag, NotModified: resp.NotModified}
+	for _, meta := range resp.Symbols {
+		snapshot.Symbols = append(snapshot.Symbols, SymbolMetadata{Symbol: meta.Symbol, Present: meta.Present, Sector: meta.Sector})
+	}
+	return snapshot, nil
+}
+
+func TestMetadataCache(t *testing.T) {
+	source := &countingSource{metadataScanner{etag: "v1"}}
+	cache := NewMetadataCache()
+	now := time.Date(2024, 7, 2, 14, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	got, err := cache.Lookup(ctx, source, []string{"aapl", "ZZZZ", "AAPL"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0].Symbol != "AAPL" || !got[0].Present || got[1].Present || got[2] != got[0] {
+		t.Errorf("Lookup() = %+v", got)
+	}
+	if len(source.batches) != 1 || len(source.batches[0]) != 2 {
+		t.Errorf("Calls = %v, want AAPL and ZZZZ fetched once", source.batches)
+	}
+
+	// Cached symbols are served without a call until the poll is due, which
+	// the etag answers without symbols
+	source.batches = nil
+	cache.Lookup(ctx, source, []string{"AAPL"})
+	now = now.Add(DefaultMetadataPollInterval)
+	cache.Lookup(ctx, source, []string{"AAPL", "ZZZZ"})
+	if len(source.batches) != 1 || len(source.batches[0]) != 0 {
+		t.Errorf("Calls = %v, want one poll without symbols", source.batches)
+	}
+
+	// A changed snapshot drops the cached metadata
+	source.etag = "v2"
+	source.batches = nil
+	now = now.Add(DefaultMetadataPollInterval)
+	if _, err := cache.Lookup(ctx, source, []string{"AAPL"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(source.batches) != 2 || len(source.batches[1]) != 1 || cache.etag != "v2" || len(cache.entries) != 1 {
+		t.Errorf("Calls = %v, etag %q, %d entries; want AAPL fetched again from v2", source.batches, cache.etag, len(cache.entries))
+	}
+
+	// So does a new etag seen while fetching new symbols
+	source.etag = "v3"
+	source.batches = nil
+	if _, err := cache.Lookup(ctx, source, []string{"AAPL", "MSFT"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(source.batches) != 2 || len(source.batches[1]) != 1 || source.batches[1][0] != "AAPL" || cache.etag != "v3" {
+		t.Errorf("Calls = %v, etag %q; want AAPL fetched again from v3", source.batches, cache.etag)
+	}
+}
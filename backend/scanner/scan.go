@@ -0,0 +1,90 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+
+	scannerpb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// StrategyInfo is a strategy the scanner can evaluate, with the parameters a
+// scan may override
+type StrategyInfo struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Custom      bool            `json:"custom"`
+	Params      []StrategyParam `json:"params"`
+}
+
+// StrategyParam is a tunable parameter of a strategy. Min and Max are both
+// zero for a parameter without bounds.
+type StrategyParam struct {
+	Name    string  `json:"name"`
+	Default float64 `json:"default"`
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+}
+
+// ScanRequest is a scan of Symbols between StartDate and EndDate
+// (YYYY-MM-DD) with Strategies, every registered strategy when empty.
+// Parameters overrides parameters by strategy name, for this scan only.
+type ScanRequest struct {
+	Symbols    []string
+	Strategies []string
+	StartDate  string
+	EndDate    string
+	Parameters map[string]map[string]float64
+}
+
+// ScanResult is the outcome of a scan: its signals ranked as LatestSignals
+// returns them, and the symbols the scanner left out with the reason
+type ScanResult struct {
+	Signals         []Signal          `json:"signals"`
+	Errors          map[string]string `json:"errors"`
+	ScanTimeSeconds float64           `json:"scanTimeSeconds"`
+}
+
+// Strategies returns the strategies the scanner can evaluate, in name order
+func (c *Client) Strategies(ctx context.Context) ([]StrategyInfo, error) {
+	resp, err := c.scanner.ListStrategies(ctx, &scannerpb.ListStrategiesRequest{})
+	if err != nil {
+		return nil, callError("ListStrategies", err)
+	}
+
+	strategies := make([]StrategyInfo, len(resp.Strategies))
+	for i, strategy := range resp.Strategies {
+		info := StrategyInfo{Name: strategy.Name, Description: strategy.Description, Custom: strategy.Custom, Params: []StrategyParam{}}
+		for _, param := range strategy.Params {
+			info.Params = append(info.Params, StrategyParam{Name: param.Name, Default: param.DefaultValue, Min: param.Min, Max: param.Max})
+		}
+		strategies[i] = info
+	}
+	return strategies, nil
+}
+
+// Scan runs a scan and waits for its result. A scan stopped by cancelling
+// ctx returns an error wrapping ctx.Err().
+func (c *Client) Scan(ctx context.Context, req ScanRequest) (ScanResult, error) {
+	parameters := make(map[string]*scannerpb.StrategyParams, len(req.Parameters))
+	for strategy, values := range req.Parameters {
+		parameters[strategy] = &scannerpb.StrategyParams{Values: values}
+	}
+	resp, err := c.scanner.Scan(ctx, &scannerpb.ScanRequest{
+		Symbols:    req.Symbols,
+		Strategies: req.Strategies,
+		DateRange:  &scannerpb.DateRange{StartDate: req.StartDate, EndDate: req.EndDate},
+		Parameters: parameters,
+	})
+	if ctx.Err() != nil {
+		return ScanResult{}, fmt.Errorf("scanner Scan: %w", ctx.Err())
+	}
+	if err != nil {
+		return ScanResult{}, callError("Scan", err)
+	}
+
+	result := ScanResult{Signals: signalsOf(resp), Errors: resp.Errors, ScanTimeSeconds: float64(resp.ScanTimeSeconds)}
+	if result.Errors == nil {
+		result.Errors = map[string]string{}
+	}
+	return result, nil
+}
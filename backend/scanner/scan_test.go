@@ -0,0 +1,67 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	scannerpb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// scriptedScan is a fakeScanner answering Scan with a scripted response, or
+// blocking until the call is cancelled while block is set
+type scriptedScan struct {
+	fakeScanner
+	block   bool
+	scanned chan *scannerpb.ScanRequest
+}
+
+func (s *scriptedScan) Scan(ctx context.Context, req *scannerpb.ScanRequest) (*scannerpb.ScanResponse, error) {
+	s.scanned <- req
+	if s.block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return &scannerpb.ScanResponse{
+		Signals:       map[string]*scannerpb.SignalList{"AAPL": {SignalTypes: []string{"LONG"}, Strategies: []string{"HIGH_BASE"}}},
+		RankedSignals: []*scannerpb.RankedSignal{{Symbol: "AAPL", Strategy: "HIGH_BASE", Direction: "LONG", Score: 64}},
+		Errors:        map[string]string{"GAPS": "DATA_QUALITY: 5 missing trading days, at most 2 allowed"},
+	}, nil
+}
+
+func TestScan(t *testing.T) {
+	fake := &scriptedScan{scanned: make(chan *scannerpb.ScanRequest, 1)}
+	client, _ := serveFakeScanner(t, fake)
+
+	result, err := client.Scan(context.Background(), ScanRequest{
+		Symbols:    []string{"AAPL", "GAPS"},
+		Strategies: []string{"HIGH_BASE"},
+		StartDate:  "2024-01-02",
+		EndDate:    "2024-03-01",
+		Parameters: map[string]map[string]float64{"HIGH_BASE": {"min_atr_ratio": 2}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := <-fake.scanned
+	if req.DateRange.GetEndDate() != "2024-03-01" || req.Parameters["HIGH_BASE"].GetValues()["min_atr_ratio"] != 2 {
+		t.Errorf("Scan request = %v", req)
+	}
+	if len(result.Signals) != 1 || result.Signals[0].Score != 64 || result.Errors["GAPS"] == "" {
+		t.Errorf("Scan() = %+v, want AAPL's signal and GAPS's error", result)
+	}
+}
+
+func TestScanCancelled(t *testing.T) {
+	fake := &scriptedScan{block: true, scanned: make(chan *scannerpb.ScanRequest, 1)}
+	client, _ := serveFakeScanner(t, fake)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-fake.scanned
+		cancel()
+	}()
+	if _, err := client.Scan(ctx, ScanRequest{Symbols: []string{"AAPL"}}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Scan() error = %v, want context.Canceled", err)
+	}
+}
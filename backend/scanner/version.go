@@ -0,0 +1,123 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	scannerpb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// ProtocolVersion is the version of the scanner's RPCs this client was
+// written against, the scanner's protocol_version of the same RPCs
+const ProtocolVersion = 8
+
+// Features of TraderAdmin that call the scanner, keys of
+// ClientProtocol.Features
+const (
+	FeatureSymbolData     = "symbol-data"
+	FeatureSymbolMetadata = "symbol-metadata"
+)
+
+// ErrIncompatible is returned for a feature the connected scanner's protocol
+// does not support
+var ErrIncompatible = errors.New("scanner incompatible")
+
+// Protocol is what a client of the scanner speaks: its protocol version, the
+// oldest scanner protocol it works with at all and the scanner protocol each
+// of its features needs
+type Protocol struct {
+	Version    int
+	MinScanner int
+	Features   map[string]int
+}
+
+// ClientProtocol is TraderAdmin's protocol. Symbol data uses BulkFetch, which
+// every scanner serves; symbol metadata needs GetSymbolMetadata.
+var ClientProtocol = Protocol{
+	Version:    ProtocolVersion,
+	MinScanner: 0,
+	Features: map[string]int{
+		FeatureSymbolData:     0,
+		FeatureSymbolMetadata: 8,
+	},
+}
+
+// VersionInfo is the build and protocol a scanner reports
+type VersionInfo struct {
+	Version            string `json:"version"`
+	Commit             string `json:"commit"`
+	BuildDate          string `json:"buildDate"`
+	ProtocolVersion    int    `json:"protocolVersion"`
+	MinProtocolVersion int    `json:"minProtocolVersion"`
+}
+
+// Compatibility is the outcome of checking a scanner against a Protocol
+type Compatibility struct {
+	Compatible       bool     `json:"compatible"`
+	Reason           string   `json:"reason,omitempty"`
+	DisabledFeatures []string `json:"disabledFeatures,omitempty"`
+}
+
+// Check compares the scanner's protocol with p. The scanner is incompatible
+// when it is older than p.MinScanner or no longer serves p.Version, which
+// disables every feature; otherwise only the features needing a newer
+// scanner are disabled.
+func (p Protocol) Check(scanner VersionInfo) Compatibility {
+	c := Compatibility{Compatible: true}
+	switch {
+	case scanner.ProtocolVersion < p.MinScanner:
+		c.Compatible = false
+		c.Reason = fmt.Sprintf("scanner protocol %d is older than the %d TraderAdmin needs; upgrade the scanner",
+			scanner.ProtocolVersion, p.MinScanner)
+	case scanner.MinProtocolVersion > p.Version:
+		c.Compatible = false
+		c.Reason = fmt.Sprintf("scanner needs protocol %d but TraderAdmin speaks %d; upgrade TraderAdmin",
+			scanner.MinProtocolVersion, p.Version)
+	}
+
+	for feature, needs := range p.Features {
+		if !c.Compatible || scanner.ProtocolVersion < needs {
+			c.DisabledFeatures = append(c.DisabledFeatures, feature)
+		}
+	}
+	sort.Strings(c.DisabledFeatures)
+	if c.Compatible && len(c.DisabledFeatures) > 0 {
+		c.Reason = fmt.Sprintf("scanner protocol %d is too old for %v; upgrade the scanner",
+			scanner.ProtocolVersion, c.DisabledFeatures)
+	}
+	return c
+}
+
+// Enabled reports whether feature was left enabled by the check
+func (c Compatibility) Enabled(feature string) bool {
+	for _, disabled := range c.DisabledFeatures {
+		if disabled == feature {
+			return false
+		}
+	}
+	return true
+}
+
+// Version asks the scanner for its build and protocol. Scanners older than
+// the GetVersion RPC report protocol 0 without a version.
+func (c *Client) Version(ctx context.Context) (VersionInfo, error) {
+	resp, err := c.scanner.GetVersion(ctx, &scannerpb.VersionRequest{})
+	if status.Code(err) == codes.Unimplemented {
+		return VersionInfo{}, nil
+	}
+	if err != nil {
+		return VersionInfo{}, callError("GetVersion", err)
+	}
+	return VersionInfo{
+		Version:            resp.Version,
+		Commit:             resp.Commit,
+		BuildDate:          resp.BuildDate,
+		ProtocolVersion:    int(resp.ProtocolVersion),
+		MinProtocolVersion: int(resp.MinProtocolVersion),
+	}, nil
+}
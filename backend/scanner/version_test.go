@@ -0,0 +1,78 @@
+package scanner
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	scannerpb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// versionedScanner is a fakeScanner that answers GetVersion
+type versionedScanner struct {
+	fakeScanner
+	version *scannerpb.VersionResponse
+}
+
+func (v *versionedScanner) GetVersion(ctx context.Context, req *scannerpb.VersionRequest) (*scannerpb.VersionResponse, error) {
+	return v.version, nil
+}
+
+func TestVersion(t *testing.T) {
+	client, _ := serveFakeScanner(t, &versionedScanner{version: &scannerpb.VersionResponse{
+		Version: "1.4.0", Commit: "abc123", BuildDate: "2024-06-01", ProtocolVersion: 1,
+	}})
+	info, err := client.Version(context.Background())
+	want := VersionInfo{Version: "1.4.0", Commit: "abc123", BuildDate: "2024-06-01", ProtocolVersion: 1}
+	if err != nil || info != want {
+		t.Errorf("Version() = %+v, %v; want %+v", info, err, want)
+	}
+
+	// A scanner older than GetVersion speaks protocol 0
+	client, _ = serveFakeScanner(t, &fakeScanner{})
+	if info, err := client.Version(context.Background()); err != nil || info != (VersionInfo{}) {
+		t.Errorf("Version() of a scanner without GetVersion = %+v, %v; want protocol 0", info, err)
+	}
+}
+
+func TestProtocolCheck(t *testing.T) {
+	protocol := Protocol{
+		Version:    3,
+		MinScanner: 1,
+		Features:   map[string]int{"bulk": 1, "stream": 2, "backtest": 3},
+	}
+	tests := []struct {
+		name             string
+		scanner, minimum int
+		compatible       bool
+		disabled         []string
+	}{
+		{"scanner without GetVersion", 0, 0, false, []string{"backtest", "bulk", "stream"}},
+		{"oldest supported scanner", 1, 0, true, []string{"backtest", "stream"}},
+		{"older scanner", 2, 0, true, []string{"backtest"}},
+		{"same protocol", 3, 0, true, nil},
+		{"newer scanner", 5, 2, true, nil},
+		{"scanner past the client", 5, 4, false, []string{"backtest", "bulk", "stream"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := protocol.Check(VersionInfo{ProtocolVersion: tt.scanner, MinProtocolVersion: tt.minimum})
+			if c.Compatible != tt.compatible || !reflect.DeepEqual(c.DisabledFeatures, tt.disabled) {
+				t.Errorf("Check() = %+v, want compatible %v with %v disabled", c, tt.compatible, tt.disabled)
+			}
+			if (c.Reason == "") != (tt.disabled == nil) {
+				t.Errorf("Check() reason = %q", c.Reason)
+			}
+			for _, feature := range tt.disabled {
+				if c.Enabled(feature) {
+					t.Errorf("Enabled(%s) = true for a disabled feature", feature)
+				}
+			}
+		})
+	}
+
+	// Every scanner serves what TraderAdmin uses today
+	if c := ClientProtocol.Check(VersionInfo{}); !c.Compatible || !c.Enabled(FeatureSymbolData) {
+		t.Errorf("ClientProtocol.Check(protocol 0) = %+v, want symbol data enabled", c)
+	}
+}
@@ -0,0 +1,243 @@
+// Package watchlist keeps named lists of symbols whose scanner signals are
+// alerted on, and when each signal was last alerted
+package watchlist
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Notification channels of a watchlist
+const (
+	ChannelDesktop = "desktop"
+	ChannelEmail   = "email"
+	ChannelSlack   = "slack"
+	// ChannelInApp only records the alert in TraderAdmin's notification
+	// center, where every alert is recorded whatever its channel
+	ChannelInApp = "in-app"
+)
+
+// Watchlist is a named list of symbols alerted on through Channel when the
+// scanner signals one of them with one of Strategies, any strategy when
+// empty
+type Watchlist struct {
+	Name       string   `json:"name"`
+	Symbols    []string `json:"symbols"`
+	Strategies []string `json:"strategies,omitempty"`
+	Channel    string   `json:"channel"`
+}
+
+// Signal is one signal of a scan
+type Signal struct {
+	Symbol    string  `json:"symbol"`
+	Strategy  string  `json:"strategy"`
+	Direction string  `json:"direction"`
+	Score     float64 `json:"score"`
+}
+
+// Alert is a signal of a symbol of a watchlist
+type Alert struct {
+	Watchlist string    `json:"watchlist"`
+	Channel   string    `json:"channel"`
+	Signal    Signal    `json:"signal"`
+	Time      time.Time `json:"time"`
+}
+
+// state is the content of the store's file
+type state struct {
+	Watchlists []Watchlist `json:"watchlists"`
+	// Alerted is when each signal of a watchlist was last alerted, by
+	// alertKey
+	Alerted map[string]time.Time `json:"alerted,omitempty"`
+}
+
+// Store keeps the watchlists in watchlists.json
+type Store struct {
+	mu    sync.Mutex
+	path  string
+	state state
+}
+
+// Open loads the watchlists from watchlists.json in the given directory
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create watchlist directory: %w", err)
+	}
+
+	s := &Store{path: filepath.Join(dir, "watchlists.json")}
+	content, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read watchlists: %w", err)
+	}
+	if err := json.Unmarshal(content, &s.state); err != nil {
+		return nil, fmt.Errorf("failed to decode watchlists: %w", err)
+	}
+	return s, nil
+}
+
+// Normalize trims the watchlist's name and channel, upper-cases its symbols
+// and strategies and drops duplicates, and checks that it is complete
+func Normalize(list Watchlist) (Watchlist, error) {
+	list.Name = strings.TrimSpace(list.Name)
+	if list.Name == "" {
+		return Watchlist{}, fmt.Errorf("watchlist name is required")
+	}
+	list.Symbols = normalizeNames(list.Symbols)
+	if len(list.Symbols) == 0 {
+		return Watchlist{}, fmt.Errorf("watchlist %s needs at least one symbol", list.Name)
+	}
+	list.Strategies = normalizeNames(list.Strategies)
+
+	list.Channel = strings.ToLower(strings.TrimSpace(list.Channel))
+	switch list.Channel {
+	case "":
+		list.Channel = ChannelDesktop
+	case ChannelDesktop, ChannelEmail, ChannelSlack, ChannelInApp:
+	default:
+		return Watchlist{}, fmt.Errorf("watchlist %s: unsupported notification channel %q", list.Name, list.Channel)
+	}
+	return list, nil
+}
+
+// normalizeNames upper-cases and trims names, dropping empty and repeated ones
+func normalizeNames(names []string) []string {
+	var normalized []string
+	for _, name := range names {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if name != "" && !slices.Contains(normalized, name) {
+			normalized = append(normalized, name)
+		}
+	}
+	return normalized
+}
+
+// Add normalizes a watchlist and adds it to the store
+func (s *Store) Add(list Watchlist) (Watchlist, error) {
+	list, err := Normalize(list)
+	if err != nil {
+		return Watchlist{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.state.Watchlists {
+		if strings.EqualFold(existing.Name, list.Name) {
+			return Watchlist{}, fmt.Errorf("watchlist %s already exists", list.Name)
+		}
+	}
+
+	s.state.Watchlists = append(s.state.Watchlists, list)
+	if err := s.save(); err != nil {
+		s.state.Watchlists = s.state.Watchlists[:len(s.state.Watchlists)-1]
+		return Watchlist{}, err
+	}
+	return list, nil
+}
+
+// Remove removes the named watchlist and forgets its alerts
+func (s *Store) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.state
+	index := slices.IndexFunc(previous.Watchlists, func(list Watchlist) bool {
+		return strings.EqualFold(list.Name, strings.TrimSpace(name))
+	})
+	if index < 0 {
+		return fmt.Errorf("watchlist %s not found", name)
+	}
+
+	removed := previous.Watchlists[index].Name
+	s.state = state{Watchlists: slices.Delete(slices.Clone(previous.Watchlists), index, index+1), Alerted: map[string]time.Time{}}
+	for key, at := range previous.Alerted {
+		if !strings.HasPrefix(key, removed+"|") {
+			s.state.Alerted[key] = at
+		}
+	}
+	if err := s.save(); err != nil {
+		s.state = previous
+		return err
+	}
+	return nil
+}
+
+// List returns the watchlists by name
+func (s *Store) List() []Watchlist {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lists := slices.Clone(s.state.Watchlists)
+	sort.Slice(lists, func(i, j int) bool { return lists[i].Name < lists[j].Name })
+	return lists
+}
+
+// Match returns an alert for each signal of a symbol and strategy of a
+// watchlist unless the same signal was alerted for that watchlist within
+// the quiet period. The alerts are recorded, so a signal still present at
+// the next scan is not alerted again until the quiet period has passed.
+// The alerts are returned even when saving them fails.
+func (s *Store) Match(signals []Signal, now time.Time, quiet time.Duration) ([]Alert, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.state.Alerted
+	alerted := make(map[string]time.Time, len(previous))
+	for key, at := range previous {
+		if now.Sub(at) < quiet {
+			alerted[key] = at
+		}
+	}
+
+	var alerts []Alert
+	for _, list := range s.state.Watchlists {
+		for _, signal := range signals {
+			signal.Symbol = strings.ToUpper(signal.Symbol)
+			if !slices.Contains(list.Symbols, signal.Symbol) ||
+				(len(list.Strategies) > 0 && !slices.Contains(list.Strategies, strings.ToUpper(signal.Strategy))) {
+				continue
+			}
+			key := alertKey(list.Name, signal)
+			if _, ok := alerted[key]; ok {
+				continue
+			}
+			alerted[key] = now
+			alerts = append(alerts, Alert{Watchlist: list.Name, Channel: list.Channel, Signal: signal, Time: now})
+		}
+	}
+
+	if len(alerts) == 0 && len(alerted) == len(previous) {
+		return nil, nil
+	}
+	s.state.Alerted = alerted
+	return alerts, s.save()
+}
+
+// alertKey identifies a signal of a watchlist for the quiet period
+func alertKey(watchlist string, signal Signal) string {
+	return strings.Join([]string{watchlist, signal.Symbol, strings.ToUpper(signal.Strategy), signal.Direction}, "|")
+}
+
+// save writes the state to a temporary file and renames it over the
+// store's file
+func (s *Store) save() error {
+	content, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode watchlists: %w", err)
+	}
+
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, content, 0644); err != nil {
+		return fmt.Errorf("failed to write watchlists: %w", err)
+	}
+	return os.Rename(tmpPath, s.path)
+}
@@ -0,0 +1,128 @@
+package watchlist
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testSignals are a scan signalling AAPL with two strategies and SPY with one
+var testSignals = []Signal{
+	{Symbol: "AAPL", Strategy: "HIGH_BASE", Direction: "LONG", Score: 82},
+	{Symbol: "AAPL", Strategy: "LOW_BASE", Direction: "SHORT", Score: 40},
+	{Symbol: "SPY", Strategy: "HIGH_BASE", Direction: "LONG", Score: 65},
+}
+
+func TestMatch(t *testing.T) {
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Add(Watchlist{Name: "tech", Symbols: []string{" aapl", "MSFT", "AAPL"}, Strategies: []string{"high_base"}, Channel: "Slack"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Add(Watchlist{Name: "index", Symbols: []string{"spy", "aapl"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	alerts, err := store.Match(testSignals, time.Now(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, alert := range alerts {
+		got = append(got, alert.Watchlist+" "+alert.Channel+" "+alert.Signal.Symbol+" "+alert.Signal.Strategy)
+	}
+	want := []string{
+		"tech slack AAPL HIGH_BASE",
+		"index desktop AAPL HIGH_BASE",
+		"index desktop AAPL LOW_BASE",
+		"index desktop SPY HIGH_BASE",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Match() = %v, want %v", got, want)
+	}
+	if alerts[0].Signal.Score != 82 {
+		t.Errorf("Alert score = %v, want 82", alerts[0].Signal.Score)
+	}
+}
+
+func TestMatchQuietPeriod(t *testing.T) {
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Add(Watchlist{Name: "spy", Symbols: []string{"SPY"}}); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 6, 3, 14, 0, 0, 0, time.UTC)
+	quiet := 30 * time.Minute
+
+	if alerts, _ := store.Match(testSignals, start, quiet); len(alerts) != 1 {
+		t.Fatalf("First scan alerts = %+v, want SPY", alerts)
+	}
+	if alerts, _ := store.Match(testSignals, start.Add(quiet-time.Second), quiet); len(alerts) != 0 {
+		t.Errorf("Scan within the quiet period alerts = %+v, want none", alerts)
+	}
+	// The opposite direction is a new signal
+	short := []Signal{{Symbol: "SPY", Strategy: "HIGH_BASE", Direction: "SHORT", Score: 50}}
+	if alerts, _ := store.Match(short, start.Add(time.Minute), quiet); len(alerts) != 1 {
+		t.Errorf("Short signal alerts = %+v, want one", alerts)
+	}
+	if alerts, _ := store.Match(testSignals, start.Add(quiet), quiet); len(alerts) != 1 {
+		t.Errorf("Scan after the quiet period alerts = %+v, want SPY again", alerts)
+	}
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Add(Watchlist{Name: "tech", Symbols: []string{"AAPL"}, Channel: ChannelEmail}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Add(Watchlist{Name: "index", Symbols: []string{"SPY"}, Strategies: []string{"HIGH_BASE"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Add(Watchlist{Name: "TECH", Symbols: []string{"MSFT"}}); err == nil {
+		t.Error("Adding a second watchlist named tech should fail")
+	}
+	now := time.Now()
+	store.Match(testSignals, now, time.Hour)
+
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := reopened.List(), store.List(); !reflect.DeepEqual(got, want) || len(got) != 2 || got[0].Name != "index" {
+		t.Errorf("Reopened watchlists = %+v, want %+v by name", got, want)
+	}
+	// The quiet period survives a restart
+	if alerts, _ := reopened.Match(testSignals, now.Add(time.Minute), time.Hour); len(alerts) != 0 {
+		t.Errorf("Alerts after reopening = %+v, want none within the quiet period", alerts)
+	}
+
+	if err := reopened.Remove("Tech"); err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.Remove("tech"); err == nil {
+		t.Error("Removing a missing watchlist should fail")
+	}
+	if again, _ := Open(dir); len(again.List()) != 1 || again.List()[0].Name != "index" {
+		t.Errorf("Watchlists after removing tech = %+v", again.List())
+	}
+}
+
+func TestNormalizeRejects(t *testing.T) {
+	for _, list := range []Watchlist{
+		{Symbols: []string{"SPY"}},
+		{Name: "empty", Symbols: []string{" "}},
+		{Name: "pager", Symbols: []string{"SPY"}, Channel: "pager"},
+	} {
+		if _, err := Normalize(list); err == nil {
+			t.Errorf("Normalize(%+v) should fail", list)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	wailsruntime "github.com/wailsapp/wails/v2/pkg/runtime"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Backend names used in BackendStatus, errors and events
+const (
+	BackendDocker     = "Docker"
+	BackendKubernetes = "Kubernetes"
+)
+
+// BackendAvailableEvent is emitted with the BackendStatus whenever a backend
+// becomes available, so the frontend can enable the features that need it
+const BackendAvailableEvent = "backend:available"
+
+// ErrBackendUnavailable is returned by methods whose backend has not connected
+// yet; the wrapping message names the backend, e.g. "waiting for Docker"
+var ErrBackendUnavailable = errors.New("backend unavailable")
+
+// backendUnavailable returns ErrBackendUnavailable for the named backend
+func backendUnavailable(backend string) error {
+	return fmt.Errorf("waiting for %s: %w", backend, ErrBackendUnavailable)
+}
+
+// BackendState describes the connection to one optional backend
+type BackendState struct {
+	Available   bool      `json:"available"`
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"lastError,omitempty"`
+	LastAttempt time.Time `json:"lastAttempt,omitempty"`
+	ConnectedAt time.Time `json:"connectedAt,omitempty"`
+}
+
+// BackendStatus reports the optional backends TraderAdmin manages services with
+type BackendStatus struct {
+	Docker     BackendState `json:"docker"`
+	Kubernetes BackendState `json:"kubernetes"`
+}
+
+// backoffPolicy controls the delay between backend connection attempts
+type backoffPolicy struct {
+	Initial time.Duration
+	Max     time.Duration
+	Factor  float64
+}
+
+// dockerPingTimeout bounds a check that the Docker daemon answers
+const dockerPingTimeout = 10 * time.Second
+
+// defaultBackoff retries quickly at first, for a backend that is still
+// starting, then settles at one attempt a minute
+var defaultBackoff = backoffPolicy{Initial: time.Second, Max: time.Minute, Factor: 2}
+
+// next returns the delay after delay
+func (p backoffPolicy) next(delay time.Duration) time.Duration {
+	delay = time.Duration(float64(delay) * p.Factor)
+	if delay > p.Max {
+		return p.Max
+	}
+	return delay
+}
+
+// GetBackendStatus returns the connection state of Docker and Kubernetes
+func (a *App) GetBackendStatus() BackendStatus {
+	a.backendMu.RLock()
+	defer a.backendMu.RUnlock()
+	return a.backends
+}
+
+// startBackendDiscovery connects to Docker and Kubernetes in the background.
+// Neither is required: users may run only one flavor of the stack or start
+// Docker Desktop after TraderAdmin, so each is retried until it connects or
+// ctx is cancelled.
+func (a *App) startBackendDiscovery(ctx context.Context) {
+	go a.discoverBackend(ctx, BackendDocker, a.pingDocker)
+	go a.discoverBackend(ctx, BackendKubernetes, a.connectKubernetes)
+}
+
+// discoverBackend calls connect with exponential backoff until it succeeds,
+// recording each attempt in the backend's state
+func (a *App) discoverBackend(ctx context.Context, backend string, connect func(context.Context) error) {
+	delay := a.backoff.Initial
+	for {
+		err := connect(ctx)
+		if a.recordBackendAttempt(backend, err) {
+			log.Info().Str("backend", backend).Msg("Backend available")
+			a.emitEvent(BackendAvailableEvent, a.GetBackendStatus())
+			return
+		}
+		log.Debug().Err(err).Str("backend", backend).Dur("retry_in", delay).Msg("Backend not available yet")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = a.backoff.next(delay)
+	}
+}
+
+// recordBackendAttempt updates the backend's state after a connection attempt
+// and reports whether it succeeded
+func (a *App) recordBackendAttempt(backend string, err error) bool {
+	a.backendMu.Lock()
+	defer a.backendMu.Unlock()
+
+	state := &a.backends.Docker
+	if backend == BackendKubernetes {
+		state = &a.backends.Kubernetes
+	}
+
+	now := time.Now()
+	state.Attempts++
+	state.LastAttempt = now
+	if err != nil {
+		state.LastError = err.Error()
+		return false
+	}
+	state.Available = true
+	state.LastError = ""
+	state.ConnectedAt = now
+	return true
+}
+
+// emitEvent sends an event to the frontend; replaced in tests, where there is
+// no Wails runtime
+func (a *App) emitEvent(name string, data ...interface{}) {
+	if a.emit != nil {
+		a.emit(name, data...)
+		return
+	}
+	if a.ctx != nil {
+		wailsruntime.EventsEmit(a.ctx, name, data...)
+	}
+}
+
+// kubernetesClients are the clients used to manage and deploy the stack
+type kubernetesClients struct {
+	typed   kubernetes.Interface
+	dynamic dynamic.Interface
+	mapper  meta.RESTMapper
+}
+
+// kubernetesClients returns the Kubernetes clients, or ErrBackendUnavailable
+// until discovery has connected
+func (a *App) kubernetesClients() (*kubernetesClients, error) {
+	a.backendMu.RLock()
+	defer a.backendMu.RUnlock()
+	if a.k8s == nil {
+		return nil, backendUnavailable(BackendKubernetes)
+	}
+	return a.k8s, nil
+}
+
+// kubernetesClient returns the typed Kubernetes client, or
+// ErrBackendUnavailable until discovery has connected
+func (a *App) kubernetesClient() (kubernetes.Interface, error) {
+	clients, err := a.kubernetesClients()
+	if err != nil {
+		return nil, err
+	}
+	return clients.typed, nil
+}
+
+// requireDocker returns ErrBackendUnavailable until discovery has connected to
+// Docker
+func (a *App) requireDocker() error {
+	a.backendMu.RLock()
+	defer a.backendMu.RUnlock()
+	if !a.backends.Docker.Available {
+		return backendUnavailable(BackendDocker)
+	}
+	return nil
+}
+
+// rediscoverDocker marks Docker unavailable and connects to it again after
+// the Docker host changed. While discovery is still retrying, its next
+// attempt uses the new host.
+func (a *App) rediscoverDocker() {
+	a.backendMu.Lock()
+	wasAvailable := a.backends.Docker.Available
+	a.backends.Docker.Available = false
+	a.backends.Docker.ConnectedAt = time.Time{}
+	a.backendMu.Unlock()
+
+	if wasAvailable && a.bgCtx != nil {
+		go a.discoverBackend(a.bgCtx, BackendDocker, a.pingDocker)
+	}
+}
+
+// pingDockerCLI checks that the Docker daemon answers through the docker CLI,
+// which knows the platform's default socket or named pipe, DOCKER_HOST and
+// the [docker] settings
+func (a *App) pingDockerCLI(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, dockerPingTimeout)
+	defer cancel()
+
+	output, err := a.dockerCmd(ctx, "version", "--format", "{{.Server.Version}}").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("docker daemon not reachable: %s: %w", strings.TrimSpace(string(output)), err)
+	}
+	return nil
+}
+
+// connectKubernetes builds a client from the in-cluster config or kubeconfig
+// and checks that the API server answers before storing it
+func (a *App) connectKubernetes(ctx context.Context) error {
+	clients, err := a.newKubernetesClients()
+	if err != nil {
+		return err
+	}
+	if _, err := clients.typed.Discovery().ServerVersion(); err != nil {
+		return fmt.Errorf("kubernetes API server not reachable: %w", err)
+	}
+
+	a.backendMu.Lock()
+	a.k8s = clients
+	a.backendMu.Unlock()
+	return nil
+}
+
+// kubernetesClientsFromConfig creates Kubernetes clients from the in-cluster
+// config, or from the kubeconfig when running outside a cluster
+func kubernetesClientsFromConfig() (*kubernetesClients, error) {
+	// Try to use in-cluster config first (for when running inside Kubernetes)
+	k8sConfig, err := rest.InClusterConfig()
+	if err != nil {
+		// If that fails, try to use local kubeconfig
+		kubeconfig := os.Getenv("KUBECONFIG")
+		if kubeconfig == "" {
+			// If KUBECONFIG is not set, use default location
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, fmt.Errorf("failed to find home directory: %w", err)
+			}
+			kubeconfig = filepath.Join(home, ".kube", "config")
+		}
+
+		k8sConfig, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build kubeconfig: %w", err)
+		}
+	}
+
+	return newKubernetesClients(k8sConfig)
+}
+
+// newKubernetesClients creates the typed and dynamic clients for k8sConfig.
+// Resource mappings are discovered from the API server on first use.
+func newKubernetesClients(k8sConfig *rest.Config) (*kubernetesClients, error) {
+	clientset, err := kubernetes.NewForConfig(k8sConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+	dynamicClient, err := dynamic.NewForConfig(k8sConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes dynamic client: %w", err)
+	}
+
+	return &kubernetesClients{
+		typed:   clientset,
+		dynamic: dynamicClient,
+		mapper:  restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(clientset.Discovery())),
+	}, nil
+}
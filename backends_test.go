@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/rest"
+)
+
+// newKubernetesAPIServer serves the version endpoint the discovery check reads;
+// every other request is not found
+func newKubernetesAPIServer(t *testing.T) *rest.Config {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/version" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"major":"1","minor":"30","gitVersion":"v1.30.0"}`)
+	}))
+	t.Cleanup(server.Close)
+	return &rest.Config{Host: server.URL}
+}
+
+// newBackendTestApp returns an app whose backends connect after the given
+// number of failed attempts, and a channel receiving emitted events
+func newBackendTestApp(t *testing.T, dockerFailures, kubernetesFailures int32) (*App, chan BackendStatus) {
+	t.Helper()
+	apiServer := newKubernetesAPIServer(t)
+
+	app := NewApp()
+	app.ctx = context.Background()
+	app.backoff = backoffPolicy{Initial: time.Millisecond, Max: 4 * time.Millisecond, Factor: 2}
+
+	var dockerAttempts, kubernetesAttempts atomic.Int32
+	app.pingDocker = func(ctx context.Context) error {
+		if dockerAttempts.Add(1) <= dockerFailures {
+			return errors.New("Cannot connect to the Docker daemon")
+		}
+		return nil
+	}
+	app.newKubernetesClients = func() (*kubernetesClients, error) {
+		if kubernetesAttempts.Add(1) <= kubernetesFailures {
+			return nil, errors.New("connection refused")
+		}
+		return newKubernetesClients(apiServer)
+	}
+
+	events := make(chan BackendStatus, 2)
+	app.emit = func(name string, data ...interface{}) {
+		if name == BackendAvailableEvent {
+			events <- data[0].(BackendStatus)
+		}
+	}
+	return app, events
+}
+
+func TestBackendsConnectAfterDelay(t *testing.T) {
+	app, events := newBackendTestApp(t, 3, 2)
+
+	// Before discovery, Kubernetes methods report the backend they wait for
+	err := app.PauseTradingServices()
+	if !errors.Is(err, ErrBackendUnavailable) || !strings.Contains(err.Error(), "waiting for Kubernetes") {
+		t.Fatalf("PauseTradingServices() error = %v, want ErrBackendUnavailable for Kubernetes", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	app.startBackendDiscovery(ctx)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-events:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for backend available events")
+		}
+	}
+
+	status := app.GetBackendStatus()
+	if !status.Docker.Available || status.Docker.Attempts != 4 || status.Docker.LastError != "" {
+		t.Errorf("Docker state = %+v, want available after 4 attempts", status.Docker)
+	}
+	if !status.Kubernetes.Available || status.Kubernetes.Attempts != 3 || status.Kubernetes.ConnectedAt.IsZero() {
+		t.Errorf("Kubernetes state = %+v, want available after 3 attempts", status.Kubernetes)
+	}
+
+	if err := app.PauseTradingServices(); errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("PauseTradingServices() error = %v after Kubernetes connected", err)
+	}
+}
+
+func TestBackendDiscoveryStopsWhenCancelled(t *testing.T) {
+	app, events := newBackendTestApp(t, 1<<30, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		app.discoverBackend(ctx, BackendDocker, app.pingDocker)
+		close(done)
+	}()
+
+	// Let a few attempts fail, then give up
+	deadline := time.Now().Add(5 * time.Second)
+	for app.GetBackendStatus().Docker.Attempts < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Discovery did not stop after cancellation")
+	}
+
+	status := app.GetBackendStatus().Docker
+	if status.Available || !strings.Contains(status.LastError, "Docker daemon") {
+		t.Errorf("Docker state = %+v, want unavailable with the last error", status)
+	}
+	if len(events) != 0 {
+		t.Errorf("Expected no available event, got %d", len(events))
+	}
+}
+
+func TestBackoffPolicy(t *testing.T) {
+	policy := backoffPolicy{Initial: time.Second, Max: 5 * time.Second, Factor: 2}
+
+	var delays []time.Duration
+	for delay := policy.Initial; len(delays) < 5; delay = policy.next(delay) {
+		delays = append(delays, delay)
+	}
+
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i := range want {
+		if delays[i] != want[i] {
+			t.Fatalf("Delays = %v, want %v", delays, want)
+		}
+	}
+}
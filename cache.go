@@ -0,0 +1,370 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// maxCacheDeletions bounds the files ClearCache deletes at once
+const maxCacheDeletions = 8
+
+// cacheRootCategory is the category of the files directly in the cache
+// directory rather than in one of its subdirectories
+const cacheRootCategory = "."
+
+// ErrUnsafeCacheDir is returned by ClearCache when the cache directory
+// resolves to a directory holding more than the cache: the filesystem root,
+// the home directory or the config directory
+var ErrUnsafeCacheDir = errors.New("refusing to clear the cache directory")
+
+// CacheCategory is a subdirectory of the cache directory with the number and
+// size of its files, or of those ClearCache deleted from it
+type CacheCategory struct {
+	Name  string `json:"name"`
+	Files int    `json:"files"`
+	Bytes int64  `json:"bytes"`
+}
+
+// CacheStats are the current sizes of the caches
+type CacheStats struct {
+	Dir        string          `json:"dir"`
+	Files      int             `json:"files"`
+	Bytes      int64           `json:"bytes"`
+	Categories []CacheCategory `json:"categories"`
+	// OptionChains are the symbols of the option chains cached in memory
+	OptionChains []string `json:"optionChains"`
+}
+
+// CacheReport is what ClearCache deleted, or in dry-run mode would delete.
+// Succeeded lists the option chain symbols dropped and the files deleted,
+// relative to Dir, and Failed the files that could not be.
+type CacheReport struct {
+	OperationReport
+	Dir          string          `json:"dir"`
+	FilesDeleted int             `json:"filesDeleted"`
+	BytesFreed   int64           `json:"bytesFreed"`
+	Categories   []CacheCategory `json:"categories"`
+}
+
+// cacheFile is a file in the cache directory
+type cacheFile struct {
+	// rel is the path relative to the cache directory
+	rel      string
+	category string
+	size     int64
+}
+
+// cacheClearing holds the cancel func of the running ClearCache
+type cacheClearing struct {
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+// cacheDir returns the absolute cache directory: General.CacheDir, or cache
+// next to config.toml when it is not set
+func (a *App) cacheDir() (string, error) {
+	dir := a.config.General.CacheDir
+	if dir == "" {
+		dir = filepath.Join(a.configDir(), "cache")
+	}
+	return filepath.Abs(dir)
+}
+
+// checkCacheDir returns ErrUnsafeCacheDir when deleting the contents of dir
+// would delete more than the cache
+func (a *App) checkCacheDir(dir string) error {
+	dir = resolvePath(dir)
+	if dir == filepath.VolumeName(dir)+string(filepath.Separator) {
+		return fmt.Errorf("%w: %s is the filesystem root", ErrUnsafeCacheDir, dir)
+	}
+	if home, err := os.UserHomeDir(); err == nil && dir == resolvePath(home) {
+		return fmt.Errorf("%w: %s is the home directory", ErrUnsafeCacheDir, dir)
+	}
+	configDir, err := filepath.Abs(a.configDir())
+	if err != nil {
+		return err
+	}
+	if configDir = resolvePath(configDir); dir == configDir || isWithin(configDir, dir) {
+		return fmt.Errorf("%w: %s holds the config directory %s", ErrUnsafeCacheDir, dir, configDir)
+	}
+	return nil
+}
+
+// resolvePath returns path with its symlinks resolved, or cleaned if it
+// does not exist
+func resolvePath(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return filepath.Clean(path)
+}
+
+// isWithin reports whether path is inside dir
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// walkCache returns the files in dir last modified before before, or all of
+// them when before is zero. A missing directory holds none.
+func walkCache(ctx context.Context, dir string, before time.Time) ([]cacheFile, error) {
+	var files []cacheFile
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !before.IsZero() && !info.ModTime().Before(before) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		category := cacheRootCategory
+		if i := strings.IndexRune(rel, filepath.Separator); i >= 0 {
+			category = rel[:i]
+		}
+		files = append(files, cacheFile{rel: rel, category: category, size: info.Size()})
+		return nil
+	})
+	return files, err
+}
+
+// cacheFiles returns the files of the cache directory dir as walkCache does,
+// leaving out the config audit log should the cache directory hold it
+func (a *App) cacheFiles(ctx context.Context, dir string, before time.Time) ([]cacheFile, error) {
+	files, err := walkCache(ctx, dir, before)
+	if err != nil {
+		return nil, err
+	}
+	audit, resolved := a.configAuditFiles(), resolvePath(dir)
+	return slices.DeleteFunc(files, func(file cacheFile) bool {
+		return slices.Contains(audit, filepath.Join(resolved, file.rel))
+	}), nil
+}
+
+// categorize totals files by category, sorted by name
+func categorize(files []cacheFile) []CacheCategory {
+	byName := make(map[string]*CacheCategory)
+	for _, file := range files {
+		category, ok := byName[file.category]
+		if !ok {
+			category = &CacheCategory{Name: file.category}
+			byName[file.category] = category
+		}
+		category.Files++
+		category.Bytes += file.size
+	}
+
+	categories := make([]CacheCategory, 0, len(byName))
+	for _, category := range byName {
+		categories = append(categories, *category)
+	}
+	sort.Slice(categories, func(i, j int) bool { return categories[i].Name < categories[j].Name })
+	return categories
+}
+
+// GetCacheStats returns the sizes of the cache directory's categories and the
+// cached option chains, without deleting anything
+func (a *App) GetCacheStats() (CacheStats, error) {
+	dir, err := a.cacheDir()
+	if err != nil {
+		return CacheStats{}, err
+	}
+	files, err := a.cacheFiles(context.Background(), dir, time.Time{})
+	if err != nil {
+		return CacheStats{}, fmt.Errorf("failed to read the cache directory: %w", err)
+	}
+
+	stats := CacheStats{Dir: dir, Categories: categorize(files), OptionChains: a.optionChains.symbols()}
+	for _, category := range stats.Categories {
+		stats.Files += category.Files
+		stats.Bytes += category.Bytes
+	}
+	return stats, nil
+}
+
+// ClearCache drops the cached option chains and deletes the files of the
+// cache directory, so that they are fetched again. With olderThanDays above
+// zero only the chains and files older than that are removed. With dryRun, or
+// in dry-run mode, the report lists what would be removed instead.
+// CancelClearCache stops it between files.
+func (a *App) ClearCache(dryRun bool, olderThanDays int) (CacheReport, error) {
+	exec := a.executor("clear-cache")
+	exec.dryRun = exec.dryRun || dryRun
+	report := CacheReport{OperationReport: exec.report(), Categories: []CacheCategory{}}
+	if olderThanDays < 0 {
+		return report, fmt.Errorf("olderThanDays must not be negative, got %d", olderThanDays)
+	}
+
+	dir, err := a.cacheDir()
+	if err != nil {
+		return report, err
+	}
+	report.Dir = dir
+	if err := a.checkCacheDir(dir); err != nil {
+		log.Error().Err(err).Msg("Cache not cleared")
+		return report, err
+	}
+
+	var before time.Time
+	if olderThanDays > 0 {
+		before = time.Now().AddDate(0, 0, -olderThanDays)
+	}
+
+	ctx, cancel := a.startClearingCache()
+	defer cancel()
+
+	symbols := a.optionChains.fetchedBefore(before)
+	if len(symbols) > 0 {
+		exec.run("drop the cached option chains of "+strings.Join(symbols, ", "), func() error {
+			a.optionChains.drop(symbols)
+			return nil
+		})
+	}
+	report.Succeeded = append(report.Succeeded, symbols...)
+
+	files, err := a.cacheFiles(ctx, dir, before)
+	if err == nil {
+		var deleted []cacheFile
+		deleted, report.Failed = deleteCacheFiles(ctx, exec, dir, files)
+		for _, file := range deleted {
+			report.Succeeded = append(report.Succeeded, file.rel)
+			report.FilesDeleted++
+			report.BytesFreed += file.size
+		}
+		report.Categories = categorize(deleted)
+		if !exec.dryRun {
+			removeEmptyDirs(dir)
+		}
+		err = ctx.Err()
+	}
+
+	exec.finish(&report.OperationReport)
+	log.Info().Strs("symbols", symbols).Int("files", report.FilesDeleted).Int64("bytes", report.BytesFreed).
+		Int("failed", len(report.Failed)).Bool("dry_run", report.DryRun).Msg("Cache cleared")
+	if err != nil {
+		return report, fmt.Errorf("clearing %s stopped: %w", dir, err)
+	}
+	return report, nil
+}
+
+// CancelClearCache stops a running ClearCache before it deletes any more
+// files; those already deleted stay in its report
+func (a *App) CancelClearCache() {
+	a.cacheClearing.mu.Lock()
+	defer a.cacheClearing.mu.Unlock()
+	if a.cacheClearing.cancel != nil {
+		a.cacheClearing.cancel()
+		a.cacheClearing.cancel = nil
+	}
+}
+
+// startClearingCache returns the context of a ClearCache, cancelled by
+// CancelClearCache and on shutdown
+func (a *App) startClearingCache() (context.Context, context.CancelFunc) {
+	parent := a.bgCtx
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithCancel(parent)
+
+	a.cacheClearing.mu.Lock()
+	defer a.cacheClearing.mu.Unlock()
+	a.cacheClearing.cancel = cancel
+	return ctx, cancel
+}
+
+// deleteCacheFiles deletes files from dir through exec, at most
+// maxCacheDeletions at once, until ctx is cancelled. It returns the files
+// deleted and those that failed.
+func deleteCacheFiles(ctx context.Context, exec *commandExecutor, dir string, files []cacheFile) ([]cacheFile, []ContainerOutcome) {
+	var (
+		mu      sync.Mutex
+		deleted []cacheFile
+		failed  = []ContainerOutcome{}
+		wg      sync.WaitGroup
+	)
+	queue := make(chan cacheFile)
+	for i := 0; i < maxCacheDeletions; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range queue {
+				path := filepath.Join(dir, file.rel)
+				err := exec.run("delete "+path, func() error {
+					if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+						return err
+					}
+					return nil
+				})
+
+				mu.Lock()
+				if err != nil {
+					failed = append(failed, ContainerOutcome{Name: file.rel, Reason: err.Error()})
+				} else {
+					deleted = append(deleted, file)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, file := range files {
+		select {
+		case <-ctx.Done():
+			break feed
+		case queue <- file:
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	sort.Slice(deleted, func(i, j int) bool { return deleted[i].rel < deleted[j].rel })
+	return deleted, failed
+}
+
+// removeEmptyDirs removes the subdirectories of dir left empty, deepest
+// first. The directory itself is kept.
+func removeEmptyDirs(dir string) {
+	var dirs []string
+	filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && entry.IsDir() && path != dir {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	for i := len(dirs) - 1; i >= 0; i-- {
+		// Fails, leaving it, unless the directory is empty
+		os.Remove(dirs[i])
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"traderadmin/backend/ibkr"
+)
+
+// writeCacheFile writes size bytes to the cache file rel, last modified age ago
+func writeCacheFile(t *testing.T, dir, rel string, size int, age time.Duration) {
+	t.Helper()
+	path := filepath.Join(dir, rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modified := time.Now().Add(-age)
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newCacheDirTestApp returns an app whose config.toml is in a temporary
+// directory, with a cache next to it of three files ten days old and one an
+// hour old
+func newCacheDirTestApp(t *testing.T) (*App, string) {
+	t.Helper()
+	configDir := t.TempDir()
+	app := NewApp()
+	app.configPath = filepath.Join(configDir, "config.toml")
+
+	cacheDir := filepath.Join(configDir, "cache")
+	writeCacheFile(t, cacheDir, filepath.Join("bars", "AAPL.json"), 100, 10*24*time.Hour)
+	writeCacheFile(t, cacheDir, filepath.Join("bars", "MSFT.json"), 200, time.Hour)
+	writeCacheFile(t, cacheDir, filepath.Join("universe", "2026", "universe.json"), 50, 10*24*time.Hour)
+	writeCacheFile(t, cacheDir, "index.db", 10, 10*24*time.Hour)
+	return app, cacheDir
+}
+
+func TestGetCacheStats(t *testing.T) {
+	app, cacheDir := newCacheDirTestApp(t)
+	app.optionChains.put(ibkr.OptionChain{Symbol: "SPY", FetchedAt: time.Now()})
+
+	stats, err := app.GetCacheStats()
+	if err != nil {
+		t.Fatalf("GetCacheStats() error = %v", err)
+	}
+	want := []CacheCategory{{".", 1, 10}, {"bars", 2, 300}, {"universe", 1, 50}}
+	if stats.Dir != cacheDir || stats.Files != 4 || stats.Bytes != 360 || len(stats.OptionChains) != 1 {
+		t.Errorf("GetCacheStats() = %+v", stats)
+	}
+	for i, category := range want {
+		if i >= len(stats.Categories) || stats.Categories[i] != category {
+			t.Errorf("Categories = %v, want %v", stats.Categories, want)
+			break
+		}
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "index.db")); err != nil {
+		t.Errorf("GetCacheStats deleted a file: %v", err)
+	}
+
+	// A cache that was never written is empty
+	app.config.General.CacheDir = filepath.Join(cacheDir, "missing")
+	if stats, err := app.GetCacheStats(); err != nil || stats.Files != 0 || len(stats.Categories) != 0 {
+		t.Errorf("GetCacheStats() of a missing directory = %+v, %v", stats, err)
+	}
+}
+
+func TestClearCacheOlderThan(t *testing.T) {
+	app, cacheDir := newCacheDirTestApp(t)
+
+	// Dry run lists the files older than a week without deleting them
+	report, err := app.ClearCache(true, 7)
+	if err != nil {
+		t.Fatalf("ClearCache() error = %v", err)
+	}
+	if !report.DryRun || report.FilesDeleted != 3 || report.BytesFreed != 160 || len(report.Would) != 3 {
+		t.Errorf("Dry-run report = %+v, want the three old files", report)
+	}
+	if stats, _ := app.GetCacheStats(); stats.Files != 4 {
+		t.Errorf("Files after a dry run = %d, want all four kept", stats.Files)
+	}
+
+	report, err = app.ClearCache(false, 7)
+	if err != nil {
+		t.Fatalf("ClearCache() error = %v", err)
+	}
+	want := []CacheCategory{{".", 1, 10}, {"bars", 1, 100}, {"universe", 1, 50}}
+	if report.DryRun || report.FilesDeleted != 3 || report.BytesFreed != 160 || len(report.Categories) != len(want) {
+		t.Fatalf("Report = %+v, want the three old files deleted", report)
+	}
+	for i, category := range want {
+		if report.Categories[i] != category {
+			t.Errorf("Categories = %v, want %v", report.Categories, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "bars", "MSFT.json")); err != nil {
+		t.Errorf("Recent file deleted: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "universe")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Emptied directory kept: %v", err)
+	}
+
+	report, err = app.ClearCache(false, 0)
+	if err != nil || report.FilesDeleted != 1 || report.Succeeded[0] != filepath.Join("bars", "MSFT.json") {
+		t.Errorf("ClearCache() of everything = %+v, %v", report, err)
+	}
+	if _, err := os.Stat(cacheDir); err != nil {
+		t.Errorf("Cache directory removed: %v", err)
+	}
+
+	if _, err := app.ClearCache(false, -1); err == nil {
+		t.Error("Expected an error for a negative olderThanDays")
+	}
+}
+
+func TestClearCacheRefusesUnsafeDirs(t *testing.T) {
+	app, _ := newCacheDirTestApp(t)
+	configDir := filepath.Dir(app.configPath)
+	if err := os.WriteFile(app.configPath, []byte("config_version = 3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	for _, dir := range []string{string(filepath.Separator), home, configDir, filepath.Dir(configDir), configDir + string(filepath.Separator) + "."} {
+		app.config.General.CacheDir = dir
+		if _, err := app.ClearCache(false, 0); !errors.Is(err, ErrUnsafeCacheDir) {
+			t.Errorf("ClearCache() of %s error = %v, want ErrUnsafeCacheDir", dir, err)
+		}
+	}
+	if _, err := os.Stat(app.configPath); err != nil {
+		t.Errorf("config.toml deleted: %v", err)
+	}
+
+	// A symlink to the config directory is the config directory
+	link := filepath.Join(t.TempDir(), "cache")
+	if err := os.Symlink(configDir, link); err == nil {
+		app.config.General.CacheDir = link
+		if _, err := app.ClearCache(false, 0); !errors.Is(err, ErrUnsafeCacheDir) {
+			t.Errorf("ClearCache() of a link to the config directory error = %v, want ErrUnsafeCacheDir", err)
+		}
+	}
+}
+
+func TestClearCacheStopsWhenCancelled(t *testing.T) {
+	app, cacheDir := newCacheDirTestApp(t)
+	files, err := walkCache(context.Background(), cacheDir, time.Time{})
+	if err != nil || len(files) != 4 {
+		t.Fatalf("walkCache() = %v, %v", files, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	deleted, failed := deleteCacheFiles(ctx, app.executor("clear-cache"), cacheDir, files)
+	if len(deleted) != 0 || len(failed) != 0 {
+		t.Errorf("Deleted %v and failed %v after cancelling, want nothing done", deleted, failed)
+	}
+	if stats, _ := app.GetCacheStats(); stats.Files != 4 {
+		t.Errorf("Files after cancelling = %d, want all four kept", stats.Files)
+	}
+
+	// Without a running ClearCache there is nothing to cancel
+	app.CancelClearCache()
+	if report, err := app.ClearCache(false, 0); err != nil || report.FilesDeleted != 4 {
+		t.Errorf("ClearCache() after CancelClearCache = %+v, %v", report, err)
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/rs/zerolog/log"
+)
+
+// configAuditFile is the append-only log of config saves in the data
+// directory, one JSON entry per line
+const configAuditFile = "config-audit.jsonl"
+
+// maxConfigAuditBytes is the size past which the audit log is rotated to
+// configAuditFile.1, replacing the previous one
+const maxConfigAuditBytes = 4 << 20
+
+// ConfigAuditEntry is one save of the config file: who saved it when, through
+// which method, and the settings it changed
+type ConfigAuditEntry struct {
+	ID      int64     `json:"id"`
+	Time    time.Time `json:"time"`
+	User    string    `json:"user"`    // OS user running TraderAdmin
+	Version string    `json:"version"` // TraderAdmin version
+	Action  string    `json:"action"`  // bound method that saved, e.g. UpdateConfig
+	// Detail names what the action applied, such as the preset or the entry
+	// reverted to
+	Detail  string              `json:"detail,omitempty"`
+	Changes []ConfigAuditChange `json:"changes"`
+}
+
+// ConfigAuditChange is a setting a save changed; Previous or Current is empty
+// when the setting is missing there, and both are for secrets
+type ConfigAuditChange struct {
+	Key      string `json:"key"`
+	Previous string `json:"previous,omitempty"`
+	Current  string `json:"current,omitempty"`
+	Secret   bool   `json:"secret,omitempty"`
+}
+
+// configAuditRecord is a line of the audit log: the entry and the config
+// file it saved, without secrets, from which RevertToAuditEntry rebuilds it
+type configAuditRecord struct {
+	ConfigAuditEntry
+	Config string `json:"config"`
+}
+
+// pendingPreset is the configuration ApplyConfigPreset last returned, so
+// that the save confirming it is logged as applying the preset
+type pendingPreset struct {
+	name    string
+	content []byte
+}
+
+// configAuditPath returns the audit log's file
+func (a *App) configAuditPath() string {
+	return filepath.Join(a.dataDir(), configAuditFile)
+}
+
+// configAuditFiles returns the audit log and its rotated file with symlinks
+// resolved, which ClearCache never deletes
+func (a *App) configAuditFiles() []string {
+	path := filepath.Join(resolvePath(a.dataDir()), configAuditFile)
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return []string{path, path + ".1"}
+}
+
+// auditUser returns the name of the OS user running TraderAdmin
+func auditUser() string {
+	if current, err := user.Current(); err == nil && current.Username != "" {
+		return current.Username
+	}
+	for _, name := range []string{"USER", "USERNAME"} {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return "unknown"
+}
+
+// recordConfigAudit appends a save by action of current over previous, the
+// config file's content before, to the audit log. A save of the
+// configuration ApplyConfigPreset last returned is logged as applying it.
+// The save has happened by then, so failing to log it is only reported.
+func (a *App) recordConfigAudit(action, detail string, previous, current []byte) {
+	if preset := a.pendingPreset; preset != nil {
+		a.pendingPreset = nil
+		// SaveConfig raises config_version to the current one
+		changes, err := diffConfigs(preset.content, current)
+		changes = slices.DeleteFunc(changes, func(change ConfigChange) bool { return change.Key == "config_version" })
+		if err == nil && len(changes) == 0 {
+			action, detail = "ApplyConfigPreset", preset.name
+		}
+	}
+	if err := a.appendConfigAudit(action, detail, previous, current); err != nil {
+		log.Error().Err(err).Str("action", action).Msg("Configuration saved without an audit entry")
+	}
+}
+
+// appendConfigAudit writes the audit entry of a save, rotating the log first
+// when it would grow past maxConfigAuditBytes
+func (a *App) appendConfigAudit(action, detail string, previous, current []byte) error {
+	a.configAuditMu.Lock()
+	defer a.configAuditMu.Unlock()
+
+	changes, err := auditChanges(previous, current)
+	if err != nil {
+		return err
+	}
+	snapshot, err := redactedConfig(current)
+	if err != nil {
+		return err
+	}
+	records, err := a.readConfigAudit()
+	if err != nil {
+		return err
+	}
+	record := configAuditRecord{
+		ConfigAuditEntry: ConfigAuditEntry{
+			ID:      1,
+			Time:    time.Now().UTC(),
+			User:    auditUser(),
+			Version: version,
+			Action:  action,
+			Detail:  detail,
+			Changes: changes,
+		},
+		Config: string(snapshot),
+	}
+	if len(records) > 0 {
+		record.ID = records[len(records)-1].ID + 1
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	if err := os.MkdirAll(a.dataDir(), 0755); err != nil {
+		return fmt.Errorf("failed to create data directory: %w", err)
+	}
+	path := a.configAuditPath()
+	if info, err := os.Stat(path); err == nil && info.Size()+int64(len(line)) > maxConfigAuditBytes {
+		if err := os.Rename(path, path+".1"); err != nil {
+			return fmt.Errorf("failed to rotate the config audit log: %w", err)
+		}
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open the config audit log: %w", err)
+	}
+	if _, err := file.Write(line); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write the config audit log: %w", err)
+	}
+	return file.Close()
+}
+
+// auditChanges diffs two config files, leaving out the values of secrets
+func auditChanges(previous, current []byte) ([]ConfigAuditChange, error) {
+	diff, err := diffConfigs(previous, current)
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]ConfigAuditChange, len(diff))
+	for i, change := range diff {
+		changes[i] = ConfigAuditChange{Key: change.Key, Previous: change.Local, Current: change.Cluster}
+		if slices.Contains(secretConfigKeys, change.Key) {
+			changes[i] = ConfigAuditChange{Key: change.Key, Secret: true}
+		}
+	}
+	return changes, nil
+}
+
+// redactedConfig returns a config file's content without its secrets
+func redactedConfig(content []byte) ([]byte, error) {
+	var tree map[string]interface{}
+	if _, err := toml.Decode(string(content), &tree); err != nil {
+		return nil, err
+	}
+	redactSecrets(tree)
+	return encodeTree(tree)
+}
+
+// readConfigAudit returns the records of the rotated and current audit logs,
+// oldest first. Lines that do not parse are skipped.
+func (a *App) readConfigAudit() ([]configAuditRecord, error) {
+	var records []configAuditRecord
+	for _, path := range []string{a.configAuditPath() + ".1", a.configAuditPath()} {
+		content, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the config audit log: %w", err)
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		scanner.Buffer(nil, maxConfigAuditBytes)
+		for scanner.Scan() {
+			var record configAuditRecord
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				log.Warn().Err(err).Str("path", path).Msg("Skipping invalid config audit entry")
+				continue
+			}
+			records = append(records, record)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read the config audit log: %w", err)
+		}
+	}
+	return records, nil
+}
+
+// GetConfigAuditLog returns the config saves since since, or all of them when
+// it is zero, newest first and at most limit of them when limit is above zero
+func (a *App) GetConfigAuditLog(limit int, since time.Time) ([]ConfigAuditEntry, error) {
+	a.configAuditMu.Lock()
+	records, err := a.readConfigAudit()
+	a.configAuditMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []ConfigAuditEntry{}
+	for i := len(records) - 1; i >= 0; i-- {
+		if limit > 0 && len(entries) == limit {
+			break
+		}
+		if !since.IsZero() && records[i].Time.Before(since) {
+			break
+		}
+		entries = append(entries, records[i].ConfigAuditEntry)
+	}
+	return entries, nil
+}
+
+// RevertToAuditEntry saves the configuration as the audit entry id saved it
+// and restarts the services, as SaveConfigurationAndRestart does. Secrets are
+// not logged, so they keep their current values.
+func (a *App) RevertToAuditEntry(id int64) (OperationReport, error) {
+	return a.saveConfigurationAndRestart("RevertToAuditEntry", fmt.Sprintf("entry %d", id), func() (Configuration, error) {
+		return a.configAsOf(id)
+	})
+}
+
+// configAsOf rebuilds the configuration the audit entry id saved, with the
+// current secrets
+func (a *App) configAsOf(id int64) (Configuration, error) {
+	a.configAuditMu.Lock()
+	records, err := a.readConfigAudit()
+	a.configAuditMu.Unlock()
+	if err != nil {
+		return Configuration{}, err
+	}
+	index := slices.IndexFunc(records, func(record configAuditRecord) bool { return record.ID == id })
+	if index < 0 {
+		return Configuration{}, fmt.Errorf("config audit entry %d not found", id)
+	}
+
+	// The entry may predate a config migration
+	migrated, _, err := migrateConfig([]byte(records[index].Config), time.Now())
+	if err != nil {
+		return Configuration{}, fmt.Errorf("config audit entry %d: %w", id, err)
+	}
+	var tree map[string]interface{}
+	if _, err := toml.Decode(string(migrated), &tree); err != nil {
+		return Configuration{}, fmt.Errorf("config audit entry %d: %w", id, err)
+	}
+	current, err := configTree(a.config)
+	if err != nil {
+		return Configuration{}, err
+	}
+	copySecrets(tree, current)
+	content, err := encodeTree(tree)
+	if err != nil {
+		return Configuration{}, err
+	}
+	config, _, err := decodeConfig(content)
+	if err != nil {
+		return Configuration{}, fmt.Errorf("config audit entry %d: %w", id, err)
+	}
+	return config, nil
+}
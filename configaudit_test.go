@@ -0,0 +1,190 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// auditKeys returns the keys of an audit entry's changes
+func auditKeys(entry ConfigAuditEntry) []string {
+	keys := []string{}
+	for _, change := range entry.Changes {
+		keys = append(keys, change.Key)
+	}
+	return keys
+}
+
+func TestConfigAuditRecordsEverySave(t *testing.T) {
+	app := newPresetTestApp(t)
+	if err := app.SaveConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	config := app.config
+	config.GreekLimits.MaxAbsPositionDelta = 0.5
+	config.AlertsConfig.Notifications.Email.SmtpPass = "hunter3"
+	if err := app.UpdateConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.AddSymbol("xom"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The save confirming a preset is logged as applying it
+	if _, err := app.SaveConfigPreset("tight", []string{"GreekLimits"}); err != nil {
+		t.Fatal(err)
+	}
+	config = app.config
+	config.GreekLimits.MaxAbsPositionDelta = 0.1
+	if err := app.UpdateConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	result, err := app.ApplyConfigPreset("tight")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.UpdateConfig(result.Config); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := app.GetConfigAuditLog(0, time.Time{})
+	if err != nil {
+		t.Fatalf("GetConfigAuditLog() error = %v", err)
+	}
+	var actions []string
+	for _, entry := range entries {
+		actions = append(actions, entry.Action)
+	}
+	want := []string{"ApplyConfigPreset", "UpdateConfig", "AddSymbol", "UpdateConfig", "SaveConfig"}
+	if !reflect.DeepEqual(actions, want) {
+		t.Fatalf("Actions = %v, want %v newest first", actions, want)
+	}
+	if entries[0].ID != 5 || entries[4].ID != 1 || entries[0].Detail != "tight" || entries[2].Detail != "XOM" {
+		t.Errorf("Entries = %+v", entries)
+	}
+	if entries[4].User == "" || entries[4].Version != version || len(entries[4].Changes) == 0 {
+		t.Errorf("First save = %+v, want the user, version and every setting", entries[4])
+	}
+
+	update := entries[3]
+	if keys := auditKeys(update); !reflect.DeepEqual(keys, []string{"alerts_config.notifications.email.smtp_pass", "greek_limits.max_abs_position_delta"}) {
+		t.Errorf("UpdateConfig changes = %v", keys)
+	}
+	if secret := update.Changes[0]; !secret.Secret || secret.Previous != "" || secret.Current != "" {
+		t.Errorf("Secret change = %+v, want its values left out", secret)
+	}
+	if delta := update.Changes[1]; delta.Previous != "0.2" || delta.Current != "0.5" {
+		t.Errorf("Delta change = %+v, want 0.2 -> 0.5", delta)
+	}
+	if changes := entries[0].Changes; len(changes) != 1 || changes[0].Previous != "0.1" || changes[0].Current != "0.5" {
+		t.Errorf("Preset changes = %+v, want the delta 0.1 -> 0.5", changes)
+	}
+	content, err := os.ReadFile(app.configAuditPath())
+	if err != nil || strings.Contains(string(content), "hunter") {
+		t.Errorf("Audit log holds the SMTP password, %v:\n%s", err, content)
+	}
+
+	if latest, _ := app.GetConfigAuditLog(1, time.Time{}); len(latest) != 1 || latest[0].ID != 5 {
+		t.Errorf("GetConfigAuditLog(1) = %+v, want the latest entry", latest)
+	}
+	if none, _ := app.GetConfigAuditLog(0, time.Now().Add(time.Minute)); len(none) != 0 {
+		t.Errorf("GetConfigAuditLog(since the future) = %+v", none)
+	}
+}
+
+func TestRevertToAuditEntry(t *testing.T) {
+	app := newPresetTestApp(t)
+	fake := &fakeOrchestrator{active: true}
+	serveOrchestrator(t, app, fake)
+
+	config := app.config
+	config.GreekLimits.MaxAbsPositionDelta = 0.3
+	if err := app.UpdateConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	config.GreekLimits.MaxAbsPositionDelta = 0.6
+	config.TradeTiming.MinDTE = 20
+	config.AlertsConfig.Notifications.Email.SmtpPass = "hunter3"
+	if err := app.UpdateConfig(config); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := app.RevertToAuditEntry(1)
+	if err != nil {
+		t.Fatalf("RevertToAuditEntry() error = %v", err)
+	}
+	if strings.Join(report.Succeeded, ",") != "pause,save,reload,resume" {
+		t.Errorf("Steps = %v, want the restart flow", report.Succeeded)
+	}
+	reverted := app.config
+	if reverted.GreekLimits.MaxAbsPositionDelta != 0.3 || reverted.TradeTiming.MinDTE != 30 {
+		t.Errorf("Reverted delta %g, min DTE %d; want 0.3, 30", reverted.GreekLimits.MaxAbsPositionDelta, reverted.TradeTiming.MinDTE)
+	}
+	if pass := reverted.AlertsConfig.Notifications.Email.SmtpPass; pass != "hunter3" {
+		t.Errorf("Reverted SMTP password = %q, want the current one kept", pass)
+	}
+
+	entries, err := app.GetConfigAuditLog(1, time.Time{})
+	if err != nil || len(entries) != 1 || entries[0].Action != "RevertToAuditEntry" || entries[0].Detail != "entry 1" {
+		t.Fatalf("Latest entry = %+v, %v", entries, err)
+	}
+	if keys := auditKeys(entries[0]); !reflect.DeepEqual(keys, []string{"greek_limits.max_abs_position_delta", "trade_timing.min_dte"}) {
+		t.Errorf("Revert changes = %v", keys)
+	}
+
+	if _, err := app.RevertToAuditEntry(99); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("RevertToAuditEntry(99) error = %v", err)
+	}
+}
+
+func TestConfigAuditRotationAndClearCache(t *testing.T) {
+	app := newPresetTestApp(t)
+	if err := app.SaveConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A full log is rotated, and its entries stay readable
+	path := app.configAuditPath()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	padding := strings.Repeat(" ", maxConfigAuditBytes-len(content))
+	if err := os.WriteFile(path, append(content, padding...), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.AddSymbol("XOM"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".1"); err != nil {
+		t.Errorf("Audit log not rotated: %v", err)
+	}
+	entries, err := app.GetConfigAuditLog(0, time.Time{})
+	if err != nil || len(entries) != 2 || entries[0].ID != 2 {
+		t.Errorf("Entries after the rotation = %+v, %v", entries, err)
+	}
+
+	// Even a cache directory holding the audit log leaves it alone
+	config := app.config
+	config.General.CacheDir = app.dataDir()
+	app.setConfig(config)
+	if err := os.WriteFile(filepath.Join(app.dataDir(), "quotes.json"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	report, err := app.ClearCache(false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(report.Succeeded, []string{"quotes.json"}) {
+		t.Errorf("ClearCache() deleted %v, want only quotes.json", report.Succeeded)
+	}
+	for _, file := range []string{path, path + ".1"} {
+		if _, err := os.Stat(file); err != nil {
+			t.Errorf("ClearCache() deleted %s", file)
+		}
+	}
+}
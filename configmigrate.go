@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	_ "time/tzdata" // Eastern time on machines without a zoneinfo database
+
+	"github.com/BurntSushi/toml"
+	"github.com/rs/zerolog/log"
+)
+
+// currentConfigVersion is the config_version of the layout Configuration
+// decodes. A file without config_version has the first layout.
+const currentConfigVersion = 4
+
+// configMigration rewrites a decoded config file of version from into the
+// layout of version from+1
+type configMigration struct {
+	from        int
+	description string
+	migrate     func(tree map[string]interface{}, now time.Time) error
+}
+
+// configMigrations are applied in order to files older than
+// currentConfigVersion. Renamed settings are otherwise dropped, as decoding
+// ignores keys Configuration does not know.
+var configMigrations = []configMigration{
+	{from: 1, description: "Eastern time [schedule] copied to the UTC [trading_schedule]", migrate: migrateTradingSchedule},
+	{from: 2, description: "flat [alerts] and [email] moved into [alerts_config]", migrate: migrateAlertsConfig},
+	{from: 3, description: "single [ibkr_connection] account moved into [[ibkr_connection.accounts]]", migrate: migrateIBKRAccounts},
+}
+
+// migrateConfig brings a config file to the current layout. It returns the
+// migrated content, which is data itself when no migration applies, and the
+// version the file had.
+func migrateConfig(data []byte, now time.Time) ([]byte, int, error) {
+	var tree map[string]interface{}
+	if _, err := toml.Decode(string(data), &tree); err != nil {
+		return nil, 0, err
+	}
+	version := 1
+	if value, ok := tree["config_version"]; ok {
+		v, ok := value.(int64)
+		if !ok || v < 1 {
+			return nil, 0, fmt.Errorf("config_version must be a positive integer, got %v", value)
+		}
+		version = int(v)
+	}
+	if version >= currentConfigVersion {
+		return data, version, nil
+	}
+
+	for _, migration := range configMigrations {
+		if migration.from < version {
+			continue
+		}
+		if err := migration.migrate(tree, now); err != nil {
+			return nil, version, fmt.Errorf("migrating from version %d (%s): %w", migration.from, migration.description, err)
+		}
+	}
+	tree["config_version"] = int64(currentConfigVersion)
+
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(tree); err != nil {
+		return nil, version, err
+	}
+	return buf.Bytes(), version, nil
+}
+
+// decodeConfig decodes a config file of the current layout and returns a
+// warning for each key Configuration does not know, which is ignored
+func decodeConfig(data []byte) (Configuration, []ConfigWarning, error) {
+	var config Configuration
+	meta, err := toml.Decode(string(data), &config)
+	if err != nil {
+		return Configuration{}, nil, err
+	}
+	return config, unknownKeyWarnings(meta), nil
+}
+
+// writeMigratedConfig replaces the config file of version from with its
+// migrated content, keeping the original next to it
+func (a *App) writeMigratedConfig(original, migrated []byte, from int) error {
+	backupPath := fmt.Sprintf("%s.v%d.bak", a.configPath, from)
+	if err := os.WriteFile(backupPath, original, 0644); err != nil {
+		return fmt.Errorf("failed to back up config file: %w", err)
+	}
+	if err := os.WriteFile(a.configPath, migrated, 0644); err != nil {
+		return fmt.Errorf("failed to write migrated config file: %w", err)
+	}
+	if a.configWatch != nil {
+		a.configWatch.MarkLoaded(migrated)
+	}
+	log.Info().Int("from", from).Int("to", currentConfigVersion).Str("backup", backupPath).Msg("Config file migrated")
+	return nil
+}
+
+// migrateTradingSchedule fills a missing [trading_schedule] from [schedule],
+// whose times are Eastern time, converting them to UTC at today's offset.
+// [schedule] stays, as the trading hours status still reads it.
+func migrateTradingSchedule(tree map[string]interface{}, now time.Time) error {
+	schedule, ok := tree["schedule"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if _, ok := tree["trading_schedule"]; ok {
+		return nil
+	}
+
+	eastern, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		return err
+	}
+	toUTC := func(key string) (string, error) {
+		value, _ := schedule[key].(string)
+		if value == "" {
+			return "", nil
+		}
+		clock, err := time.Parse("15:04", value)
+		if err != nil {
+			return "", fmt.Errorf("schedule.%s: %q is not HH:MM", key, value)
+		}
+		day := now.In(eastern)
+		at := time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, eastern)
+		return at.UTC().Format("15:04"), nil
+	}
+
+	tradingSchedule := map[string]interface{}{"enabled": true}
+	start, err := toUTC("trading_start_time")
+	if err != nil {
+		return err
+	}
+	stop, err := toUTC("trading_end_time")
+	if err != nil {
+		return err
+	}
+	if start != "" {
+		tradingSchedule["start_time_utc"] = start
+	}
+	if stop != "" {
+		tradingSchedule["stop_time_utc"] = stop
+	}
+	days := []string{"Mon", "Tue", "Wed", "Thu", "Fri"}
+	if weekend, _ := schedule["weekend_trading"].(bool); weekend {
+		days = append(days, "Sat", "Sun")
+	}
+	tradingSchedule["days_of_week"] = days
+	tree["trading_schedule"] = tradingSchedule
+	return nil
+}
+
+// legacyAlertKeys map the flat [alerts] and [email] keys to their paths in
+// [alerts_config]
+var legacyAlertKeys = map[string]map[string][]string{
+	"alerts": {
+		"max_latency_ms":    {"thresholds", "max_order_latency_ms"},
+		"min_daily_pnl":     {"thresholds", "min_daily_realized_pnl"},
+		"max_errors":        {"thresholds", "max_api_errors_per_hour"},
+		"enable_email":      {"notifications", "email", "enabled"},
+		"email_to":          {"notifications", "email", "recipients"},
+		"enable_slack":      {"notifications", "slack", "enabled"},
+		"slack_webhook_url": {"notifications", "slack", "webhook_url"},
+	},
+	"email": {
+		"smtp_server":   {"notifications", "email", "smtp_host"},
+		"smtp_port":     {"notifications", "email", "smtp_port"},
+		"smtp_user":     {"notifications", "email", "smtp_user"},
+		"smtp_password": {"notifications", "email", "smtp_pass"},
+	},
+}
+
+// migrateAlertsConfig moves the flat [alerts] thresholds and switches and the
+// [email] server settings into [alerts_config], unless it exists already.
+// Keys without a counterpart are left where they are, to be reported as
+// unknown.
+func migrateAlertsConfig(tree map[string]interface{}, now time.Time) error {
+	if _, ok := tree["alerts"].(map[string]interface{}); !ok {
+		return nil
+	}
+	if _, ok := tree["alerts_config"]; ok {
+		return nil
+	}
+
+	alertsConfig := map[string]interface{}{"enabled": true}
+	for _, section := range []string{"alerts", "email"} {
+		table, ok := tree[section].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for key, path := range legacyAlertKeys[section] {
+			value, ok := table[key]
+			if !ok {
+				continue
+			}
+			if key == "email_to" {
+				value = splitRecipients(value)
+			}
+			setPath(alertsConfig, path, value)
+			delete(table, key)
+		}
+		if len(table) == 0 {
+			delete(tree, section)
+		}
+	}
+	tree["alerts_config"] = alertsConfig
+	return nil
+}
+
+// legacyAccountKeys are the [ibkr_connection] keys of the single account,
+// which became the keys of an entry of [[ibkr_connection.accounts]]
+var legacyAccountKeys = []string{"host", "port", "client_id_trading", "client_id_data", "account_code", "read_only_api"}
+
+// migrateIBKRAccounts moves the account settings of [ibkr_connection] into a
+// one-entry accounts list, made the active account. The account is named
+// paper or live after its account code.
+func migrateIBKRAccounts(tree map[string]interface{}, now time.Time) error {
+	connection, ok := tree["ibkr_connection"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if _, ok := connection["accounts"]; ok {
+		return nil
+	}
+
+	account := make(map[string]interface{})
+	for _, key := range legacyAccountKeys {
+		if value, ok := connection[key]; ok {
+			account[key] = value
+			delete(connection, key)
+		}
+	}
+	if len(account) == 0 {
+		return nil
+	}
+
+	code, _ := account["account_code"].(string)
+	name := "paper"
+	if (IBKRAccount{AccountCode: code}).Live() {
+		name = "live"
+	}
+	account["name"] = name
+	connection["active_account"] = name
+	connection["accounts"] = []map[string]interface{}{account}
+	return nil
+}
+
+// splitRecipients turns the comma separated email_to into a list
+func splitRecipients(value interface{}) interface{} {
+	list, ok := value.(string)
+	if !ok {
+		return value
+	}
+	recipients := []string{}
+	for _, recipient := range strings.Split(list, ",") {
+		if recipient = strings.TrimSpace(recipient); recipient != "" {
+			recipients = append(recipients, recipient)
+		}
+	}
+	return recipients
+}
+
+// setPath sets value at the dotted path in tree, creating the tables between
+func setPath(tree map[string]interface{}, path []string, value interface{}) {
+	for _, key := range path[:len(path)-1] {
+		next, ok := tree[key].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			tree[key] = next
+		}
+		tree = next
+	}
+	tree[path[len(path)-1]] = value
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// loadFixture loads testdata/config/<name> as the config file of a new app
+// and returns it with the file's original content
+func loadFixture(t *testing.T, name string) (*App, []byte) {
+	t.Helper()
+	original, err := os.ReadFile(filepath.Join("testdata", "config", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := NewApp()
+	app.configPath = filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(app.configPath, original, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig(%s) error = %v", name, err)
+	}
+	return app, original
+}
+
+// easternToUTC converts an Eastern time of today to UTC, as the migration does
+func easternToUTC(t *testing.T, clock string) string {
+	t.Helper()
+	eastern, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _ := time.Parse("15:04", clock)
+	day := time.Now().In(eastern)
+	return time.Date(day.Year(), day.Month(), day.Day(), parsed.Hour(), parsed.Minute(), 0, 0, eastern).UTC().Format("15:04")
+}
+
+func TestLoadConfigMigratesVersion1(t *testing.T) {
+	app, original := loadFixture(t, "v1.toml")
+	config := app.config
+
+	if account := config.activeIBKRAccount(); config.ConfigVersion != currentConfigVersion || account.AccountCode != "DU111111" {
+		t.Errorf("Version %d, account %+v", config.ConfigVersion, account)
+	}
+
+	schedule := config.TradingSchedule
+	if !schedule.Enabled || schedule.StartTimeUTC != easternToUTC(t, "09:30") || schedule.StopTimeUTC != easternToUTC(t, "16:00") {
+		t.Errorf("TradingSchedule = %+v, want 09:30 to 16:00 Eastern in UTC", schedule)
+	}
+	if want := []string{"Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun"}; !reflect.DeepEqual(schedule.DaysOfWeek, want) {
+		t.Errorf("DaysOfWeek = %v, want the whole week with weekend trading", schedule.DaysOfWeek)
+	}
+	if config.Schedule.TradingStartTime != "09:30" {
+		t.Errorf("Schedule.TradingStartTime = %q, want it kept", config.Schedule.TradingStartTime)
+	}
+
+	alerts := config.AlertsConfig
+	if !alerts.Enabled || alerts.Thresholds.MaxOrderLatencyMs != 750 || alerts.Thresholds.MinDailyRealizedPnl != -1500 || alerts.Thresholds.MaxApiErrorsPerHour != 8 {
+		t.Errorf("AlertsConfig thresholds = %+v", alerts.Thresholds)
+	}
+	email := alerts.Notifications.Email
+	if !email.Enabled || !reflect.DeepEqual(email.Recipients, []string{"ops@example.com", "trader@example.com"}) ||
+		email.SmtpHost != "smtp.example.com" || email.SmtpPort != 587 || email.SmtpUser != "alerts" || email.SmtpPass != "SMTP_PASSWORD" {
+		t.Errorf("Email = %+v", email)
+	}
+	if slack := alerts.Notifications.Slack; !slack.Enabled || slack.WebhookUrl != "SLACK_WEBHOOK_URL" {
+		t.Errorf("Slack = %+v", slack)
+	}
+
+	// The original is backed up and the file rewritten in the current layout
+	backup, err := os.ReadFile(app.configPath + ".v1.bak")
+	if err != nil || string(backup) != string(original) {
+		t.Errorf("Backup = %q, %v; want the original file", backup, err)
+	}
+	migrated, err := os.ReadFile(app.configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, warnings, err := decodeConfig(migrated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(migrated), "config_version = 4") || len(warnings) != 1 || warnings[0].Key != "alerts" {
+		t.Errorf("Migrated file has unknown keys %v:\n%s", warnings, migrated)
+	}
+	if !reflect.DeepEqual(app.GetConfigWarnings(), warnings) {
+		t.Errorf("GetConfigWarnings() = %v, want %v", app.GetConfigWarnings(), warnings)
+	}
+}
+
+func TestLoadConfigMigratesVersion2(t *testing.T) {
+	app, _ := loadFixture(t, "v2.toml")
+	config := app.config
+
+	// The existing trading schedule is not replaced
+	schedule := config.TradingSchedule
+	if schedule.StartTimeUTC != "14:00" || schedule.StopTimeUTC != "20:30" || !reflect.DeepEqual(schedule.DaysOfWeek, []string{"Mon", "Wed", "Fri"}) {
+		t.Errorf("TradingSchedule = %+v, want the file's", schedule)
+	}
+
+	alerts := config.AlertsConfig
+	if !alerts.Enabled || alerts.Thresholds.MaxOrderLatencyMs != 500 || alerts.Thresholds.MaxApiErrorsPerHour != 3 {
+		t.Errorf("AlertsConfig thresholds = %+v", alerts.Thresholds)
+	}
+	if alerts.Notifications.Email.Enabled || !alerts.Notifications.Slack.Enabled {
+		t.Errorf("Notifications = %+v, want Slack only", alerts.Notifications)
+	}
+	if _, err := os.Stat(app.configPath + ".v2.bak"); err != nil {
+		t.Errorf("No backup of the version 2 file: %v", err)
+	}
+}
+
+func TestLoadConfigMigratesVersion3(t *testing.T) {
+	app, _ := loadFixture(t, "v3.toml")
+	connection := app.config.IBKRConnection
+
+	want := []IBKRAccount{{Name: "paper", Host: "127.0.0.1", Port: 4002, AccountCode: "DU333333"}}
+	if connection.ActiveAccount != "paper" || !reflect.DeepEqual(connection.Accounts, want) {
+		t.Errorf("IBKRConnection = %+v, want the single account as the active paper account", connection)
+	}
+	if connection.HeartbeatSeconds != 15 {
+		t.Errorf("HeartbeatSeconds = %d, want it kept", connection.HeartbeatSeconds)
+	}
+	if _, err := os.Stat(app.configPath + ".v3.bak"); err != nil {
+		t.Errorf("No backup of the version 3 file: %v", err)
+	}
+}
+
+func TestMigrateIBKRAccounts(t *testing.T) {
+	tests := []struct {
+		name       string
+		connection map[string]interface{}
+		want       map[string]interface{}
+	}{
+		{
+			name:       "Live account",
+			connection: map[string]interface{}{"host": "gateway", "account_code": "U7654321", "max_backoff_seconds": int64(30)},
+			want: map[string]interface{}{
+				"active_account":      "live",
+				"accounts":            []map[string]interface{}{{"name": "live", "host": "gateway", "account_code": "U7654321"}},
+				"max_backoff_seconds": int64(30),
+			},
+		},
+		{
+			name:       "Accounts listed already",
+			connection: map[string]interface{}{"accounts": []map[string]interface{}{{"name": "paper"}}},
+			want:       map[string]interface{}{"accounts": []map[string]interface{}{{"name": "paper"}}},
+		},
+		{
+			name:       "No account settings",
+			connection: map[string]interface{}{"heartbeat_seconds": int64(5)},
+			want:       map[string]interface{}{"heartbeat_seconds": int64(5)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := map[string]interface{}{"ibkr_connection": tt.connection}
+			if err := migrateIBKRAccounts(tree, time.Now()); err != nil {
+				t.Fatal(err)
+			}
+			if got := tree["ibkr_connection"]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ibkr_connection = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigKeepsCurrentVersion(t *testing.T) {
+	app, original := loadFixture(t, "v4.toml")
+	config := app.config
+
+	if account := config.activeIBKRAccount(); config.ConfigVersion != 4 || account.Name != "paper" || account.AccountCode != "DU444444" || config.TradingSchedule.StartTimeUTC != "13:30" {
+		t.Errorf("Configuration = %+v", config)
+	}
+	if live, _ := config.ibkrAccount("live"); !live.Live() || live.Port != 4001 || live.ClientIDTrading != 11 {
+		t.Errorf("Live account = %+v", live)
+	}
+	email := config.AlertsConfig.Notifications.Email
+	if config.AlertsConfig.Thresholds.MaxOrderLatencyMs != 250 || email.SmtpPort != 465 || !reflect.DeepEqual(email.Recipients, []string{"ops@example.com"}) {
+		t.Errorf("AlertsConfig = %+v", config.AlertsConfig)
+	}
+
+	content, _ := os.ReadFile(app.configPath)
+	if string(content) != string(original) {
+		t.Error("A current config file should not be rewritten")
+	}
+	if backups, _ := filepath.Glob(app.configPath + ".v*.bak"); len(backups) != 0 {
+		t.Errorf("Unexpected backups %v", backups)
+	}
+}
+
+func TestMigrateTradingScheduleConvertsEasternTime(t *testing.T) {
+	legacy := []byte("[schedule]\ntrading_start_time = \"09:30\"\ntrading_end_time = \"16:00\"\n")
+	tests := []struct {
+		name      string
+		now       time.Time
+		wantStart string
+		wantStop  string
+	}{
+		{"Standard time", time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC), "14:30", "21:00"},
+		{"Daylight saving time", time.Date(2024, 7, 15, 12, 0, 0, 0, time.UTC), "13:30", "20:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrated, version, err := migrateConfig(legacy, tt.now)
+			if err != nil || version != 1 {
+				t.Fatalf("migrateConfig() version %d, error %v", version, err)
+			}
+			config, _, err := decodeConfig(migrated)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := config.TradingSchedule; got.StartTimeUTC != tt.wantStart || got.StopTimeUTC != tt.wantStop {
+				t.Errorf("TradingSchedule = %s to %s, want %s to %s", got.StartTimeUTC, got.StopTimeUTC, tt.wantStart, tt.wantStop)
+			}
+		})
+	}
+
+	if _, _, err := migrateConfig([]byte("config_version = \"two\"\n"), time.Now()); err == nil {
+		t.Error("Expected an error for a config_version that is not a number")
+	}
+}
+
+func TestTemplateConfigHasNoUnknownKeys(t *testing.T) {
+	content, err := os.ReadFile(filepath.Join("config", "config.template.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrated, version, err := migrateConfig(content, time.Now())
+	if err != nil || version != currentConfigVersion || string(migrated) != string(content) {
+		t.Errorf("Template config version %d (%v), want the current layout", version, err)
+	}
+	if _, warnings, err := decodeConfig(content); err != nil || len(warnings) > 0 {
+		t.Errorf("Template config unknown keys %v, %v", warnings, err)
+	}
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/rs/zerolog/log"
+)
+
+// presetMetaKey is the table of a preset file naming the preset; the other
+// tables are the config sections it sets
+const presetMetaKey = "preset"
+
+// presetName is the form of preset names, which are also their file names
+var presetName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,63}$`)
+
+// ConfigPreset is a named partial configuration, kept as <name>.toml in the
+// presets directory next to the config file. Its file is a config file
+// holding only the preset's sections plus a [preset] table, and never holds
+// secrets.
+type ConfigPreset struct {
+	Name     string   `json:"name"`
+	Sections []string `json:"sections"` // JSON names such as OptionsFilters
+	Created  string   `json:"created,omitempty"`
+	Version  int      `json:"version"` // config_version the preset was saved under
+}
+
+// ConfigPresetResult is the configuration a preset applies to, which the
+// frontend saves with UpdateConfig once the user confirms the changes
+type ConfigPresetResult struct {
+	Preset  ConfigPreset         `json:"preset"`
+	Config  Configuration        `json:"config"`
+	Changes []ConfigPresetChange `json:"changes"`
+}
+
+// ConfigPresetChange is a setting the preset changes; Current or Preset is
+// empty when the setting is missing there
+type ConfigPresetChange struct {
+	Key     string `json:"key"`
+	Current string `json:"current,omitempty"`
+	Preset  string `json:"preset,omitempty"`
+}
+
+// configSection is a top-level table of Configuration
+type configSection struct {
+	json string
+	toml string
+}
+
+// configSections are the sections a preset may hold, in declaration order
+var configSections = func() []configSection {
+	var sections []configSection
+	t := reflect.TypeOf(Configuration{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key, _, _ := strings.Cut(field.Tag.Get("toml"), ",")
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if key == "" || key == "config_version" {
+			continue
+		}
+		sections = append(sections, configSection{json: name, toml: key})
+	}
+	return sections
+}()
+
+// sectionByName returns the section named by its JSON or TOML name
+func sectionByName(name string) (configSection, bool) {
+	for _, section := range configSections {
+		if name == section.json || name == section.toml {
+			return section, true
+		}
+	}
+	return configSection{}, false
+}
+
+// presetsDir returns the directory of the presets, next to the config file
+func (a *App) presetsDir() string {
+	return filepath.Join(filepath.Dir(a.configPath), "presets")
+}
+
+// presetPath returns the file of the named preset
+func (a *App) presetPath(name string) (string, error) {
+	if !presetName.MatchString(name) {
+		return "", fmt.Errorf("preset name %q must be up to 64 letters, digits, - or _", name)
+	}
+	return filepath.Join(a.presetsDir(), name+".toml"), nil
+}
+
+// SaveConfigPreset stores the given sections of the current configuration as
+// the named preset, replacing one of the same name. Secrets are left out.
+func (a *App) SaveConfigPreset(name string, sections []string) (ConfigPreset, error) {
+	path, err := a.presetPath(name)
+	if err != nil {
+		return ConfigPreset{}, err
+	}
+	if len(sections) == 0 {
+		return ConfigPreset{}, fmt.Errorf("preset %s: no sections selected", name)
+	}
+	current, err := configTree(a.config)
+	if err != nil {
+		return ConfigPreset{}, err
+	}
+
+	tree := map[string]interface{}{"config_version": int64(currentConfigVersion)}
+	for _, selected := range sections {
+		section, ok := sectionByName(selected)
+		if !ok {
+			return ConfigPreset{}, fmt.Errorf("preset %s: unknown section %q", name, selected)
+		}
+		if value, ok := current[section.toml]; ok {
+			tree[section.toml] = value
+		}
+	}
+	tree[presetMetaKey] = map[string]interface{}{"name": name, "created": time.Now().UTC().Format(time.RFC3339)}
+	redactSecrets(tree)
+
+	content, err := encodeTree(tree)
+	if err != nil {
+		return ConfigPreset{}, err
+	}
+	preset, _, err := parsePreset(content, name)
+	if err != nil {
+		return ConfigPreset{}, err
+	}
+	if err := writePreset(path, content); err != nil {
+		return ConfigPreset{}, err
+	}
+	log.Info().Str("preset", name).Strs("sections", preset.Sections).Msg("Saved config preset")
+	return preset, nil
+}
+
+// ApplyConfigPreset merges the named preset over the current configuration
+// and returns the result with the settings it changes. Settings the preset
+// leaves out keep their current values. Nothing is saved; the result must
+// pass validation, and the frontend saves it with UpdateConfig once the user
+// confirms. A preset of an older config_version is migrated first.
+func (a *App) ApplyConfigPreset(name string) (ConfigPresetResult, error) {
+	path, err := a.presetPath(name)
+	if err != nil {
+		return ConfigPresetResult{}, err
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ConfigPresetResult{}, fmt.Errorf("preset %s not found", name)
+	}
+	if err != nil {
+		return ConfigPresetResult{}, fmt.Errorf("failed to read preset %s: %w", name, err)
+	}
+	preset, sections, err := parsePreset(content, name)
+	if err != nil {
+		return ConfigPresetResult{}, err
+	}
+
+	merged, err := configTree(a.config)
+	if err != nil {
+		return ConfigPresetResult{}, err
+	}
+	mergeTree(merged, sections)
+	mergedContent, err := encodeTree(merged)
+	if err != nil {
+		return ConfigPresetResult{}, err
+	}
+	config, _, err := decodeConfig(mergedContent)
+	if err != nil {
+		return ConfigPresetResult{}, fmt.Errorf("preset %s: %w", name, err)
+	}
+	if err := a.validateConfig(config); err != nil {
+		return ConfigPresetResult{}, fmt.Errorf("preset %s: %w", name, err)
+	}
+
+	currentContent, err := encodeConfig(a.config)
+	if err != nil {
+		return ConfigPresetResult{}, err
+	}
+	resultContent, err := encodeConfig(config)
+	if err != nil {
+		return ConfigPresetResult{}, err
+	}
+	diff, err := diffConfigs(currentContent, resultContent)
+	if err != nil {
+		return ConfigPresetResult{}, err
+	}
+	changes := make([]ConfigPresetChange, len(diff))
+	for i, change := range diff {
+		changes[i] = ConfigPresetChange{Key: change.Key, Current: change.Local, Preset: change.Cluster}
+	}
+	a.pendingPreset = &pendingPreset{name: preset.Name, content: resultContent}
+	return ConfigPresetResult{Preset: preset, Config: config, Changes: changes}, nil
+}
+
+// ListConfigPresets returns the presets by name. Files that are not presets
+// are skipped.
+func (a *App) ListConfigPresets() ([]ConfigPreset, error) {
+	entries, err := os.ReadDir(a.presetsDir())
+	if errors.Is(err, os.ErrNotExist) {
+		return []ConfigPreset{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list presets: %w", err)
+	}
+
+	presets := []ConfigPreset{}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".toml")
+		if !ok || entry.IsDir() || !presetName.MatchString(name) {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(a.presetsDir(), entry.Name()))
+		if err != nil {
+			log.Warn().Err(err).Str("preset", name).Msg("Skipping unreadable config preset")
+			continue
+		}
+		preset, _, err := parsePreset(content, name)
+		if err != nil {
+			log.Warn().Err(err).Str("preset", name).Msg("Skipping invalid config preset")
+			continue
+		}
+		presets = append(presets, preset)
+	}
+	sort.Slice(presets, func(i, j int) bool { return presets[i].Name < presets[j].Name })
+	return presets, nil
+}
+
+// DeleteConfigPreset removes the named preset
+func (a *App) DeleteConfigPreset(name string) error {
+	path, err := a.presetPath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("preset %s not found", name)
+	} else if err != nil {
+		return fmt.Errorf("failed to delete preset %s: %w", name, err)
+	}
+	log.Info().Str("preset", name).Msg("Deleted config preset")
+	return nil
+}
+
+// ExportPreset writes the named preset to path as a single TOML file to share
+func (a *App) ExportPreset(name, path string) error {
+	presetFile, err := a.presetPath(name)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(presetFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("preset %s not found", name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read preset %s: %w", name, err)
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return fmt.Errorf("failed to export preset %s: %w", name, err)
+	}
+	log.Info().Str("preset", name).Str("path", path).Msg("Exported config preset")
+	return nil
+}
+
+// ImportPreset adds the preset of a file written by ExportPreset, named as in
+// its [preset] table or else after the file. Secrets the file holds and
+// tables that are not config sections are dropped; a preset of the same name
+// must be deleted first.
+func (a *App) ImportPreset(path string) (ConfigPreset, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ConfigPreset{}, fmt.Errorf("failed to read preset file: %w", err)
+	}
+	preset, sections, err := parsePreset(content, strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+	if err != nil {
+		return ConfigPreset{}, err
+	}
+	presetFile, err := a.presetPath(preset.Name)
+	if err != nil {
+		return ConfigPreset{}, err
+	}
+	if _, err := os.Stat(presetFile); err == nil {
+		return ConfigPreset{}, fmt.Errorf("preset %s already exists", preset.Name)
+	}
+
+	// Kept in the current layout, without what was dropped
+	sections["config_version"] = int64(currentConfigVersion)
+	sections[presetMetaKey] = map[string]interface{}{"name": preset.Name, "created": preset.Created}
+	imported, err := encodeTree(sections)
+	if err != nil {
+		return ConfigPreset{}, err
+	}
+	if err := writePreset(presetFile, imported); err != nil {
+		return ConfigPreset{}, err
+	}
+	log.Info().Str("preset", preset.Name).Str("path", path).Msg("Imported config preset")
+	return preset, nil
+}
+
+// parsePreset migrates a preset file to the current layout and returns the
+// preset and its sections, without secrets. fallbackName names a preset
+// whose [preset] table has no name.
+func parsePreset(content []byte, fallbackName string) (ConfigPreset, map[string]interface{}, error) {
+	migrated, version, err := migrateConfig(content, time.Now())
+	if err != nil {
+		return ConfigPreset{}, nil, fmt.Errorf("preset %s: %w", fallbackName, err)
+	}
+	var tree map[string]interface{}
+	if _, err := toml.Decode(string(migrated), &tree); err != nil {
+		return ConfigPreset{}, nil, fmt.Errorf("preset %s: %w", fallbackName, err)
+	}
+
+	preset := ConfigPreset{Name: fallbackName, Version: version}
+	if meta, ok := tree[presetMetaKey].(map[string]interface{}); ok {
+		if name, _ := meta["name"].(string); name != "" {
+			preset.Name = name
+		}
+		preset.Created, _ = meta["created"].(string)
+	}
+	if !presetName.MatchString(preset.Name) {
+		return ConfigPreset{}, nil, fmt.Errorf("preset name %q must be up to 64 letters, digits, - or _", preset.Name)
+	}
+
+	sections := make(map[string]interface{})
+	for _, section := range configSections {
+		if value, ok := tree[section.toml]; ok {
+			sections[section.toml] = value
+			preset.Sections = append(preset.Sections, section.json)
+		}
+	}
+	if len(sections) == 0 {
+		return ConfigPreset{}, nil, fmt.Errorf("preset %s has no config sections", preset.Name)
+	}
+	redactSecrets(sections)
+	return preset, sections, nil
+}
+
+// mergeTree sets the settings of src in dst, merging tables key by key
+func mergeTree(dst, src map[string]interface{}) {
+	for key, value := range src {
+		if table, ok := value.(map[string]interface{}); ok {
+			if existing, ok := dst[key].(map[string]interface{}); ok {
+				mergeTree(existing, table)
+				continue
+			}
+		}
+		dst[key] = value
+	}
+}
+
+// configTree returns config as a decoded config file
+func configTree(config Configuration) (map[string]interface{}, error) {
+	content, err := encodeConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	var tree map[string]interface{}
+	if _, err := toml.Decode(string(content), &tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// encodeConfig encodes config as a config file of the current layout
+func encodeConfig(config Configuration) ([]byte, error) {
+	config.ConfigVersion = currentConfigVersion
+	return encodeTree(config)
+}
+
+// encodeTree encodes v as TOML
+func encodeTree(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// writePreset writes a preset file, creating the presets directory
+func writePreset(path string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create presets directory: %w", err)
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return fmt.Errorf("failed to write preset: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newPresetTestApp returns an app with a valid configuration holding secrets
+func newPresetTestApp(t *testing.T) *App {
+	t.Helper()
+	app := NewApp()
+	app.configPath = filepath.Join(t.TempDir(), "config.toml")
+	config := validConfig()
+	config.OptionsFilters.MinOpenInterest = 1000
+	config.OptionsFilters.MaxBidAskSpreadPercentage = 0.3
+	config.GreekLimits.MaxAbsPositionDelta = 0.2
+	config.TradeTiming.MinDTE = 30
+	config.AlertsConfig.Notifications.Email.SmtpHost = "smtp.example.com"
+	config.AlertsConfig.Notifications.Email.SmtpPass = "hunter2"
+	config.AlertsConfig.Notifications.Slack.WebhookUrl = "https://hooks.slack.com/services/T0/B0/secret"
+	app.setConfig(config)
+	return app
+}
+
+// changedKeys returns the keys of a preset's changes
+func changedKeys(changes []ConfigPresetChange) []string {
+	keys := []string{}
+	for _, change := range changes {
+		keys = append(keys, change.Key)
+	}
+	return keys
+}
+
+func TestConfigPresetMergesSelectedSections(t *testing.T) {
+	app := newPresetTestApp(t)
+	preset, err := app.SaveConfigPreset("conservative", []string{"OptionsFilters", "greek_limits"})
+	if err != nil {
+		t.Fatalf("SaveConfigPreset() error = %v", err)
+	}
+	if !reflect.DeepEqual(preset.Sections, []string{"OptionsFilters", "GreekLimits"}) || preset.Version != currentConfigVersion {
+		t.Errorf("Saved preset = %+v", preset)
+	}
+
+	// Settings outside the preset's sections keep their current values
+	config := app.config
+	config.OptionsFilters.MinOpenInterest = 100
+	config.GreekLimits.MaxAbsPositionDelta = 0.8
+	config.TradeTiming.MinDTE = 10
+	app.setConfig(config)
+
+	result, err := app.ApplyConfigPreset("conservative")
+	if err != nil {
+		t.Fatalf("ApplyConfigPreset() error = %v", err)
+	}
+	if got := result.Config; got.OptionsFilters.MinOpenInterest != 1000 || got.GreekLimits.MaxAbsPositionDelta != 0.2 || got.TradeTiming.MinDTE != 10 {
+		t.Errorf("Applied config: open interest %d, delta %g, min DTE %d; want 1000, 0.2, 10",
+			got.OptionsFilters.MinOpenInterest, got.GreekLimits.MaxAbsPositionDelta, got.TradeTiming.MinDTE)
+	}
+	want := []string{"greek_limits.max_abs_position_delta", "options_filters.min_open_interest"}
+	if keys := changedKeys(result.Changes); !reflect.DeepEqual(keys, want) {
+		t.Errorf("Changes = %v, want %v", keys, want)
+	}
+	if result.Changes[1].Current != "100" || result.Changes[1].Preset != "1000" {
+		t.Errorf("Open interest change = %+v, want 100 -> 1000", result.Changes[1])
+	}
+	if app.config.OptionsFilters.MinOpenInterest != 100 {
+		t.Error("ApplyConfigPreset() changed the configuration before confirmation")
+	}
+
+	// A preset setting only some keys of a section merges them key by key
+	if err := os.WriteFile(filepath.Join(app.presetsDir(), "liquid.toml"), []byte("[options_filters]\nmin_open_interest = 2000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err = app.ApplyConfigPreset("liquid")
+	if err != nil {
+		t.Fatalf("ApplyConfigPreset(liquid) error = %v", err)
+	}
+	if filters := result.Config.OptionsFilters; filters.MinOpenInterest != 2000 || filters.MaxBidAskSpreadPercentage != 0.3 {
+		t.Errorf("Options filters = %+v, want only the open interest changed", filters)
+	}
+
+	presets, err := app.ListConfigPresets()
+	if err != nil || len(presets) != 2 || presets[0].Name != "conservative" || presets[1].Name != "liquid" {
+		t.Errorf("ListConfigPresets() = %+v, %v", presets, err)
+	}
+	if err := app.DeleteConfigPreset("liquid"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.ApplyConfigPreset("liquid"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("ApplyConfigPreset() of a deleted preset error = %v", err)
+	}
+}
+
+func TestConfigPresetRejectsInvalidResults(t *testing.T) {
+	app := newPresetTestApp(t)
+	if _, err := app.SaveConfigPreset("../escape", []string{"OptionsFilters"}); err == nil {
+		t.Error("SaveConfigPreset() accepted a name outside the presets directory")
+	}
+	if _, err := app.SaveConfigPreset("unknown", []string{"NoSuchSection"}); err == nil {
+		t.Error("SaveConfigPreset() accepted an unknown section")
+	}
+
+	if err := os.MkdirAll(app.presetsDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(app.presetsDir(), "short.toml"), []byte("[trade_timing]\nmin_dte = 120\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.ApplyConfigPreset("short"); err == nil || !strings.Contains(err.Error(), "TradeTiming.MinDTE") {
+		t.Errorf("ApplyConfigPreset() of an invalid result error = %v", err)
+	}
+}
+
+func TestConfigPresetExcludesSecrets(t *testing.T) {
+	app := newPresetTestApp(t)
+	if _, err := app.SaveConfigPreset("alerts", []string{"AlertsConfig"}); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filepath.Join(app.presetsDir(), "alerts.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "hunter2") || strings.Contains(string(content), "hooks.slack.com") {
+		t.Errorf("Preset holds secrets:\n%s", content)
+	}
+	if !strings.Contains(string(content), "smtp.example.com") {
+		t.Errorf("Preset lost the SMTP host:\n%s", content)
+	}
+
+	// A shared file's secrets are dropped on import and never applied
+	shared := filepath.Join(t.TempDir(), "shared.toml")
+	if err := os.WriteFile(shared, []byte(`config_version = 4
+[preset]
+name = "team"
+[alerts_config.notifications.email]
+smtp_host = "smtp.team.example.com"
+smtp_pass = "leaked"
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	preset, err := app.ImportPreset(shared)
+	if err != nil || preset.Name != "team" {
+		t.Fatalf("ImportPreset() = %+v, %v", preset, err)
+	}
+	imported, err := os.ReadFile(filepath.Join(app.presetsDir(), "team.toml"))
+	if err != nil || strings.Contains(string(imported), "leaked") {
+		t.Errorf("Imported preset holds the secret:\n%s", imported)
+	}
+	result, err := app.ApplyConfigPreset("team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if email := result.Config.AlertsConfig.Notifications.Email; email.SmtpHost != "smtp.team.example.com" || email.SmtpPass != "hunter2" {
+		t.Errorf("Applied email settings = %+v, want the team host with the current password", email)
+	}
+	if _, err := app.ImportPreset(shared); err == nil {
+		t.Error("ImportPreset() replaced an existing preset")
+	}
+}
+
+func TestConfigPresetExportImportAndMigration(t *testing.T) {
+	app := newPresetTestApp(t)
+	if _, err := app.SaveConfigPreset("conservative", []string{"OptionsFilters"}); err != nil {
+		t.Fatal(err)
+	}
+	exported := filepath.Join(t.TempDir(), "conservative.toml")
+	if err := app.ExportPreset("conservative", exported); err != nil {
+		t.Fatalf("ExportPreset() error = %v", err)
+	}
+
+	other := newPresetTestApp(t)
+	config := other.config
+	config.OptionsFilters.MinOpenInterest = 50
+	other.setConfig(config)
+	if _, err := other.ImportPreset(exported); err != nil {
+		t.Fatalf("ImportPreset() error = %v", err)
+	}
+	result, err := other.ApplyConfigPreset("conservative")
+	if err != nil || result.Config.OptionsFilters.MinOpenInterest != 1000 {
+		t.Errorf("Imported preset applied open interest %d, %v; want 1000", result.Config.OptionsFilters.MinOpenInterest, err)
+	}
+
+	// A preset of the first layout goes through the config migrations
+	legacy := filepath.Join(t.TempDir(), "legacy.toml")
+	if err := os.WriteFile(legacy, []byte("[alerts]\nmax_latency_ms = 250.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	preset, err := other.ImportPreset(legacy)
+	if err != nil || preset.Version != 1 || !reflect.DeepEqual(preset.Sections, []string{"AlertsConfig"}) {
+		t.Fatalf("ImportPreset(legacy) = %+v, %v", preset, err)
+	}
+	result, err = other.ApplyConfigPreset("legacy")
+	if err != nil || result.Config.AlertsConfig.Thresholds.MaxOrderLatencyMs != 250 {
+		t.Errorf("Legacy preset applied latency %g, %v; want 250", result.Config.AlertsConfig.Thresholds.MaxOrderLatencyMs, err)
+	}
+}
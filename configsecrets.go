@@ -0,0 +1,95 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+)
+
+// secretConfigKeys are the dotted TOML paths of the settings tagged
+// secret:"true"
+var secretConfigKeys = secretKeys(reflect.TypeOf(Configuration{}), "")
+
+// secretKeys returns the dotted TOML paths of the secret fields of struct
+// type t and the structs nested in it, under prefix
+func secretKeys(t reflect.Type, prefix string) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key, _, _ := strings.Cut(field.Tag.Get("toml"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		switch {
+		case field.Tag.Get("secret") == "true":
+			keys = append(keys, key)
+		case field.Type.Kind() == reflect.Struct:
+			keys = append(keys, secretKeys(field.Type, key)...)
+		}
+	}
+	return keys
+}
+
+// redactSecrets removes the secret settings from a decoded config tree
+func redactSecrets(tree map[string]interface{}) {
+	for _, key := range secretConfigKeys {
+		path := strings.Split(key, ".")
+		table := tree
+		for _, name := range path[:len(path)-1] {
+			if table, _ = table[name].(map[string]interface{}); table == nil {
+				break
+			}
+		}
+		if table != nil {
+			delete(table, path[len(path)-1])
+		}
+	}
+}
+
+// copySecrets sets the secret settings of src in dst, creating the tables
+// holding them as needed
+func copySecrets(dst, src map[string]interface{}) {
+	for _, key := range secretConfigKeys {
+		path := strings.Split(key, ".")
+		from, to := src, dst
+		for _, name := range path[:len(path)-1] {
+			if from, _ = from[name].(map[string]interface{}); from == nil {
+				break
+			}
+			next, ok := to[name].(map[string]interface{})
+			if !ok {
+				next = make(map[string]interface{})
+				to[name] = next
+			}
+			to = next
+		}
+		if from == nil {
+			continue
+		}
+		if value, ok := from[path[len(path)-1]]; ok {
+			to[path[len(path)-1]] = value
+		}
+	}
+}
+
+// clearSecrets zeroes the secret settings of config, for sharing it where
+// the secrets are not needed
+func clearSecrets(config *Configuration) {
+	clearSecretFields(reflect.ValueOf(config).Elem())
+}
+
+// clearSecretFields zeroes the secret fields of struct v and the structs
+// nested in it
+func clearSecretFields(v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		switch {
+		case field.Tag.Get("secret") == "true":
+			v.Field(i).SetZero()
+		case field.Type.Kind() == reflect.Struct:
+			clearSecretFields(v.Field(i))
+		}
+	}
+}
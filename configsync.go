@@ -0,0 +1,384 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Config sync states reported in ConfigSyncStatus.Status
+const (
+	ConfigInSync         = "in-sync"
+	ConfigLocalChanged   = "local-changed"
+	ConfigClusterChanged = "cluster-changed"
+	ConfigConflict       = "conflict"
+	ConfigNotInCluster   = "not-in-cluster"
+)
+
+// configMapKey is the ConfigMap key holding config.toml, as the config
+// watcher writes it
+const configMapKey = "config.toml"
+
+// configHashAnnotation records the hash of config.toml as of the last sync
+const configHashAnnotation = "traderadmin/config-hash"
+
+// configSyncFile records the hash of the last sync in the data directory
+const configSyncFile = "config-sync.json"
+
+// configSyncTimeout bounds each ConfigMap request
+const configSyncTimeout = 30 * time.Second
+
+// ErrConfigConflict is returned when a pull or push would overwrite changes
+// made on the other side since the last sync
+var ErrConfigConflict = errors.New("config changed on both sides since the last sync")
+
+// ConfigChange is a setting that differs between the local file and the
+// cluster; Local or Cluster is empty when the setting is missing there
+type ConfigChange struct {
+	Key     string `json:"key"`
+	Local   string `json:"local,omitempty"`
+	Cluster string `json:"cluster,omitempty"`
+}
+
+// ConfigSyncStatus compares the local config file with the cluster ConfigMap
+type ConfigSyncStatus struct {
+	Status      string         `json:"status"`
+	Namespace   string         `json:"namespace"`
+	ConfigMap   string         `json:"configMap"`
+	LocalHash   string         `json:"localHash"`
+	ClusterHash string         `json:"clusterHash,omitempty"`
+	SyncedHash  string         `json:"syncedHash,omitempty"`
+	Changes     []ConfigChange `json:"changes,omitempty"`
+}
+
+// configSyncRecord is the last sync, persisted so that a restart still knows
+// which side changed
+type configSyncRecord struct {
+	Namespace string    `json:"namespace"`
+	ConfigMap string    `json:"configMap"`
+	Hash      string    `json:"hash"`
+	SyncedAt  time.Time `json:"syncedAt"`
+}
+
+// configSnapshot is both sides of a sync as read at one moment
+type configSnapshot struct {
+	status  ConfigSyncStatus
+	local   []byte
+	cluster *corev1.ConfigMap
+}
+
+// SyncFromCluster compares the local config file with the config.toml key of
+// the ConfigMap named in the Kubernetes settings. The status tells which side
+// changed since the last sync, and Changes lists the differing settings so
+// the user can choose between PullConfigFromCluster and PushConfigToCluster.
+func (a *App) SyncFromCluster() (ConfigSyncStatus, error) {
+	snapshot, err := a.configSnapshot()
+	if err != nil {
+		return ConfigSyncStatus{}, err
+	}
+	return snapshot.status, nil
+}
+
+// PullConfigFromCluster overwrites the local config file with the ConfigMap's
+// and loads it. Unless force is set, local changes since the last sync are
+// not overwritten.
+func (a *App) PullConfigFromCluster(force bool) error {
+	snapshot, err := a.configSnapshot()
+	if err != nil {
+		return err
+	}
+	switch snapshot.status.Status {
+	case ConfigNotInCluster:
+		return fmt.Errorf("ConfigMap %s/%s has no %s", snapshot.status.Namespace, snapshot.status.ConfigMap, configMapKey)
+	case ConfigInSync:
+		return a.recordConfigSync(snapshot.status.LocalHash)
+	case ConfigLocalChanged, ConfigConflict:
+		if !force {
+			return fmt.Errorf("pull would overwrite local changes: %w", ErrConfigConflict)
+		}
+	}
+
+	content := []byte(snapshot.cluster.Data[configMapKey])
+	config, warnings, err := decodeConfig(content)
+	if err != nil {
+		return fmt.Errorf("cluster config is invalid: %w", err)
+	}
+	previous, _ := os.ReadFile(a.configPath)
+	if err := os.WriteFile(a.configPath, content, 0644); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if a.configWatch != nil {
+		a.configWatch.MarkLoaded(content)
+	}
+	a.recordConfigAudit("PullConfigFromCluster", snapshot.status.ConfigMap, previous, content)
+	a.setConfig(config)
+	a.setConfigWarnings(warnings)
+
+	log.Info().Str("configmap", snapshot.status.ConfigMap).Msg("Pulled configuration from cluster")
+	return a.recordConfigSync(snapshot.status.ClusterHash)
+}
+
+// PushConfigToCluster writes the local config file to the ConfigMap, creating
+// it if needed. Unless force is set, changes made in the cluster since the
+// last sync are not overwritten.
+func (a *App) PushConfigToCluster(force bool) error {
+	if err := a.requireWritable("PushConfigToCluster"); err != nil {
+		return err
+	}
+	snapshot, err := a.configSnapshot()
+	if err != nil {
+		return err
+	}
+	switch snapshot.status.Status {
+	case ConfigInSync:
+		if snapshot.cluster.Annotations[configHashAnnotation] == snapshot.status.LocalHash {
+			return a.recordConfigSync(snapshot.status.LocalHash)
+		}
+	case ConfigClusterChanged, ConfigConflict:
+		if !force {
+			return fmt.Errorf("push would overwrite changes made in the cluster: %w", ErrConfigConflict)
+		}
+	}
+
+	client, err := a.kubernetesClient()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), configSyncTimeout)
+	defer cancel()
+
+	// Updating the ConfigMap as read fails if it changed in the meantime
+	cm, exists := snapshot.cluster, snapshot.cluster != nil
+	if !exists {
+		cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Name:      snapshot.status.ConfigMap,
+			Namespace: snapshot.status.Namespace,
+		}}
+	}
+	if cm.Data == nil {
+		cm.Data = make(map[string]string)
+	}
+	if cm.Annotations == nil {
+		cm.Annotations = make(map[string]string)
+	}
+	cm.Data[configMapKey] = string(snapshot.local)
+	cm.Annotations[configHashAnnotation] = snapshot.status.LocalHash
+
+	configMaps := client.CoreV1().ConfigMaps(snapshot.status.Namespace)
+	if !exists {
+		_, err = configMaps.Create(ctx, cm, metav1.CreateOptions{})
+	} else {
+		_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+	}
+	if apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("ConfigMap %s changed during the push: %w", cm.Name, ErrConfigConflict)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write ConfigMap %s: %w", cm.Name, err)
+	}
+
+	log.Info().Str("configmap", cm.Name).Msg("Pushed configuration to cluster")
+	return a.recordConfigSync(snapshot.status.LocalHash)
+}
+
+// pushConfigOnSave pushes the saved config when the Kubernetes settings ask
+// for it. Without a cluster the push is skipped; a conflict is returned so
+// the user can resolve it.
+func (a *App) pushConfigOnSave() error {
+	if a.config.Kubernetes.ConfigMapName == "" || !a.config.Kubernetes.PushConfigOnSave {
+		return nil
+	}
+	err := a.PushConfigToCluster(false)
+	if errors.Is(err, ErrBackendUnavailable) || errors.Is(err, ErrReadOnlyMode) {
+		log.Warn().Err(err).Msg("Configuration not pushed to the cluster")
+		return nil
+	}
+	return err
+}
+
+// configSnapshot reads both sides and works out which changed since the
+// last sync. Without a sync record, the ConfigMap's hash annotation is the
+// last sync.
+func (a *App) configSnapshot() (configSnapshot, error) {
+	namespace, name := a.config.Kubernetes.Namespace, a.config.Kubernetes.ConfigMapName
+	if name == "" {
+		return configSnapshot{}, fmt.Errorf("no ConfigMap configured in the Kubernetes settings")
+	}
+	client, err := a.kubernetesClient()
+	if err != nil {
+		return configSnapshot{}, err
+	}
+
+	local, err := os.ReadFile(a.configPath)
+	if err != nil {
+		return configSnapshot{}, fmt.Errorf("failed to read config file: %w", err)
+	}
+	snapshot := configSnapshot{
+		local: local,
+		status: ConfigSyncStatus{
+			Namespace: namespace,
+			ConfigMap: name,
+			LocalHash: configHash(local),
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), configSyncTimeout)
+	defer cancel()
+	cm, err := client.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return configSnapshot{}, fmt.Errorf("failed to read ConfigMap %s: %w", name, err)
+	}
+	if err == nil {
+		snapshot.cluster = cm
+	}
+
+	clusterContent, ok := "", false
+	if snapshot.cluster != nil {
+		clusterContent, ok = snapshot.cluster.Data[configMapKey]
+	}
+	if !ok {
+		snapshot.status.Status = ConfigNotInCluster
+		return snapshot, nil
+	}
+	snapshot.status.ClusterHash = configHash([]byte(clusterContent))
+
+	synced := a.loadConfigSync(namespace, name)
+	if synced == "" {
+		synced = snapshot.cluster.Annotations[configHashAnnotation]
+	}
+	snapshot.status.SyncedHash = synced
+
+	localChanged := snapshot.status.LocalHash != synced
+	clusterChanged := snapshot.status.ClusterHash != synced
+	switch {
+	case snapshot.status.LocalHash == snapshot.status.ClusterHash:
+		snapshot.status.Status = ConfigInSync
+	case localChanged && clusterChanged:
+		snapshot.status.Status = ConfigConflict
+	case clusterChanged:
+		snapshot.status.Status = ConfigClusterChanged
+	default:
+		snapshot.status.Status = ConfigLocalChanged
+	}
+
+	if snapshot.status.Status != ConfigInSync {
+		snapshot.status.Changes, err = diffConfigs(local, []byte(clusterContent))
+		if err != nil {
+			return configSnapshot{}, err
+		}
+	}
+	return snapshot, nil
+}
+
+// loadConfigSync returns the hash of the last sync with the ConfigMap, or ""
+// when there is none
+func (a *App) loadConfigSync(namespace, name string) string {
+	data, err := os.ReadFile(filepath.Join(a.dataDir(), configSyncFile))
+	if err != nil {
+		return ""
+	}
+	var record configSyncRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		log.Warn().Err(err).Msg("Ignoring unreadable config sync record")
+		return ""
+	}
+	if record.Namespace != namespace || record.ConfigMap != name {
+		return ""
+	}
+	return record.Hash
+}
+
+// recordConfigSync persists hash as the last sync with the configured ConfigMap
+func (a *App) recordConfigSync(hash string) error {
+	record := configSyncRecord{
+		Namespace: a.config.Kubernetes.Namespace,
+		ConfigMap: a.config.Kubernetes.ConfigMapName,
+		Hash:      hash,
+		SyncedAt:  time.Now(),
+	}
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(a.dataDir(), 0755); err != nil {
+		return fmt.Errorf("failed to create data directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(a.dataDir(), configSyncFile), data, 0644); err != nil {
+		return fmt.Errorf("failed to record config sync: %w", err)
+	}
+	return nil
+}
+
+// configHash returns the hex SHA-256 of a config file's content
+func configHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// diffConfigs lists the settings that differ between two config files, keyed
+// by their dotted TOML path, in key order
+func diffConfigs(local, cluster []byte) ([]ConfigChange, error) {
+	localValues, err := flattenConfig(local)
+	if err != nil {
+		return nil, fmt.Errorf("local config is invalid: %w", err)
+	}
+	clusterValues, err := flattenConfig(cluster)
+	if err != nil {
+		return nil, fmt.Errorf("cluster config is invalid: %w", err)
+	}
+
+	keys := make(map[string]bool)
+	for key := range localValues {
+		keys[key] = true
+	}
+	for key := range clusterValues {
+		keys[key] = true
+	}
+
+	var changes []ConfigChange
+	for key := range keys {
+		if localValues[key] != clusterValues[key] {
+			changes = append(changes, ConfigChange{Key: key, Local: localValues[key], Cluster: clusterValues[key]})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes, nil
+}
+
+// flattenConfig decodes a config file into its settings, keyed by dotted path
+func flattenConfig(content []byte) (map[string]string, error) {
+	var tree map[string]interface{}
+	if _, err := toml.Decode(string(content), &tree); err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	flattenInto(values, "", tree)
+	return values, nil
+}
+
+// flattenInto adds the leaves of tree to values under prefix
+func flattenInto(values map[string]string, prefix string, tree map[string]interface{}) {
+	for key, value := range tree {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if table, ok := value.(map[string]interface{}); ok {
+			flattenInto(values, key, table)
+			continue
+		}
+		values[key] = fmt.Sprint(value)
+	}
+}
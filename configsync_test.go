@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const localConfig = `[kubernetes]
+namespace = "traderadmin"
+config_map_name = "traderadmin-config"
+
+[ibkr_connection]
+heartbeat_seconds = 10
+`
+
+// newConfigSyncTestApp returns an app with localConfig on disk, connected to a
+// fake clientset holding objects
+func newConfigSyncTestApp(t *testing.T, objects ...*corev1.ConfigMap) (*App, *fake.Clientset) {
+	t.Helper()
+
+	app := NewApp()
+	app.configPath = filepath.Join(t.TempDir(), "config.toml")
+	writeLocalConfig(t, app, localConfig)
+	app.config.Kubernetes.Namespace = "traderadmin"
+	app.config.Kubernetes.ConfigMapName = "traderadmin-config"
+
+	client := fake.NewSimpleClientset()
+	for _, cm := range objects {
+		if _, err := client.CoreV1().ConfigMaps(cm.Namespace).Create(context.Background(), cm, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	app.k8s = &kubernetesClients{typed: client}
+	return app, client
+}
+
+func writeLocalConfig(t *testing.T, app *App, content string) {
+	t.Helper()
+	if err := os.WriteFile(app.configPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// clusterConfig returns the ConfigMap's config.toml
+func clusterConfig(t *testing.T, client *fake.Clientset) *corev1.ConfigMap {
+	t.Helper()
+	cm, err := client.CoreV1().ConfigMaps("traderadmin").Get(context.Background(), "traderadmin-config", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cm
+}
+
+// setClusterConfig edits the ConfigMap the way kubectl edit would, leaving
+// the hash annotation alone
+func setClusterConfig(t *testing.T, client *fake.Clientset, content string) {
+	t.Helper()
+	cm := clusterConfig(t, client)
+	cm.Data[configMapKey] = content
+	if _, err := client.CoreV1().ConfigMaps("traderadmin").Update(context.Background(), cm, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func syncStatus(t *testing.T, app *App) ConfigSyncStatus {
+	t.Helper()
+	status, err := app.SyncFromCluster()
+	if err != nil {
+		t.Fatalf("SyncFromCluster() error = %v", err)
+	}
+	return status
+}
+
+func TestConfigPushThenClusterEditThenPull(t *testing.T) {
+	app, client := newConfigSyncTestApp(t)
+
+	if status := syncStatus(t, app); status.Status != ConfigNotInCluster {
+		t.Fatalf("Status before the first push: got %q", status.Status)
+	}
+	if err := app.PushConfigToCluster(false); err != nil {
+		t.Fatalf("PushConfigToCluster() error = %v", err)
+	}
+	cm := clusterConfig(t, client)
+	if cm.Data[configMapKey] != localConfig || cm.Annotations[configHashAnnotation] != configHash([]byte(localConfig)) {
+		t.Fatalf("Pushed ConfigMap: %+v", cm)
+	}
+	if status := syncStatus(t, app); status.Status != ConfigInSync {
+		t.Fatalf("Status after push: got %q", status.Status)
+	}
+
+	// Someone edits the ConfigMap directly
+	edited := `[kubernetes]
+namespace = "traderadmin"
+config_map_name = "traderadmin-config"
+
+[ibkr_connection]
+heartbeat_seconds = 15
+max_backoff_seconds = 30
+`
+	setClusterConfig(t, client, edited)
+
+	status := syncStatus(t, app)
+	if status.Status != ConfigClusterChanged {
+		t.Fatalf("Status after the cluster edit: got %q", status.Status)
+	}
+	want := []ConfigChange{
+		{Key: "ibkr_connection.heartbeat_seconds", Local: "10", Cluster: "15"},
+		{Key: "ibkr_connection.max_backoff_seconds", Cluster: "30"},
+	}
+	if len(status.Changes) != len(want) || status.Changes[0] != want[0] || status.Changes[1] != want[1] {
+		t.Errorf("Changes: got %+v, want %+v", status.Changes, want)
+	}
+
+	// Pushing would clobber the edit; pulling takes it
+	if err := app.PushConfigToCluster(false); !errors.Is(err, ErrConfigConflict) {
+		t.Errorf("PushConfigToCluster() error = %v, want ErrConfigConflict", err)
+	}
+	if err := app.PullConfigFromCluster(false); err != nil {
+		t.Fatalf("PullConfigFromCluster() error = %v", err)
+	}
+	if data, _ := os.ReadFile(app.configPath); string(data) != edited {
+		t.Errorf("Local file after pull:\n%s", data)
+	}
+	if app.config.IBKRConnection.HeartbeatSeconds != 15 {
+		t.Errorf("Loaded heartbeat after pull: got %d, want 15", app.config.IBKRConnection.HeartbeatSeconds)
+	}
+	if status := syncStatus(t, app); status.Status != ConfigInSync {
+		t.Errorf("Status after pull: got %q", status.Status)
+	}
+}
+
+func TestConfigConflictIsNotClobbered(t *testing.T) {
+	app, client := newConfigSyncTestApp(t)
+	if err := app.PushConfigToCluster(false); err != nil {
+		t.Fatal(err)
+	}
+
+	writeLocalConfig(t, app, localConfig+"\n[schedule]\nweekend_trading = true\n")
+	setClusterConfig(t, client, localConfig+"\n[schedule]\ntrading_start_time = \"10:00\"\n")
+
+	if status := syncStatus(t, app); status.Status != ConfigConflict {
+		t.Fatalf("Status: got %q, want %q", status.Status, ConfigConflict)
+	}
+	if err := app.PushConfigToCluster(false); !errors.Is(err, ErrConfigConflict) {
+		t.Errorf("PushConfigToCluster() error = %v, want ErrConfigConflict", err)
+	}
+	if err := app.PullConfigFromCluster(false); !errors.Is(err, ErrConfigConflict) {
+		t.Errorf("PullConfigFromCluster() error = %v, want ErrConfigConflict", err)
+	}
+
+	// Forcing a side resolves the conflict
+	if err := app.PushConfigToCluster(true); err != nil {
+		t.Fatalf("PushConfigToCluster(force) error = %v", err)
+	}
+	if status := syncStatus(t, app); status.Status != ConfigInSync {
+		t.Errorf("Status after forced push: got %q", status.Status)
+	}
+}
+
+func TestConfigSyncUsesAnnotationWithoutRecord(t *testing.T) {
+	// Another machine pushed this; the local file was edited since
+	pushed := localConfig + "\n[schedule]\nweekend_trading = false\n"
+	app, _ := newConfigSyncTestApp(t, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "traderadmin-config",
+			Namespace:   "traderadmin",
+			Annotations: map[string]string{configHashAnnotation: configHash([]byte(pushed))},
+		},
+		Data: map[string]string{configMapKey: pushed},
+	})
+
+	if status := syncStatus(t, app); status.Status != ConfigLocalChanged {
+		t.Errorf("Status: got %q, want %q", status.Status, ConfigLocalChanged)
+	}
+}
+
+func TestSaveConfigPushesWhenEnabled(t *testing.T) {
+	app, client := newConfigSyncTestApp(t)
+	app.config.Kubernetes.PushConfigOnSave = true
+	app.config.IBKRConnection.HeartbeatSeconds = 20
+
+	if err := app.SaveConfig(); err != nil {
+		t.Fatalf("SaveConfig() error = %v", err)
+	}
+	local, _ := os.ReadFile(app.configPath)
+	if cm := clusterConfig(t, client); cm.Data[configMapKey] != string(local) {
+		t.Errorf("ConfigMap after save:\n%s\nwant:\n%s", cm.Data[configMapKey], local)
+	}
+
+	// A cluster edit since then is reported rather than overwritten
+	setClusterConfig(t, client, localConfig)
+	app.config.IBKRConnection.HeartbeatSeconds = 25
+	if err := app.SaveConfig(); !errors.Is(err, ErrConfigConflict) {
+		t.Errorf("SaveConfig() error = %v, want ErrConfigConflict", err)
+	}
+	if cm := clusterConfig(t, client); cm.Data[configMapKey] != localConfig {
+		t.Error("SaveConfig overwrote the cluster edit")
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/rs/zerolog/log"
+)
+
+// ConfigWarningsEvent is emitted with the warnings of each config file loaded
+const ConfigWarningsEvent = "config-warnings"
+
+// ConfigWarning is a setting of the config file that is ignored, typically a
+// misspelled key whose intended setting keeps its default
+type ConfigWarning struct {
+	// Key is the full dotted path of the setting, e.g. "trading_parameters.max_positons"
+	Key string `json:"key"`
+	// Suggestion is the known key of the same table the key is probably a
+	// misspelling of
+	Suggestion string `json:"suggestion,omitempty"`
+	Message    string `json:"message"`
+}
+
+// GetConfigWarnings returns the warnings of the config file last loaded
+func (a *App) GetConfigWarnings() []ConfigWarning {
+	if a.configWarnings == nil {
+		return []ConfigWarning{}
+	}
+	return a.configWarnings
+}
+
+// setConfigWarnings keeps, logs and pushes the warnings of a loaded config
+// file, recording the new ones in the notification center
+func (a *App) setConfigWarnings(warnings []ConfigWarning) {
+	previous := a.configWarnings
+	a.configWarnings = warnings
+	for _, warning := range warnings {
+		log.Warn().Str("key", warning.Key).Str("suggestion", warning.Suggestion).Msg(warning.Message)
+	}
+	a.notifyConfigWarnings(previous, warnings)
+	a.emitEvent(ConfigWarningsEvent, a.GetConfigWarnings())
+}
+
+// unknownKeyWarnings returns a warning for each key of the file that
+// Configuration has no setting for. A table Configuration does not know is
+// reported once rather than by each of its keys.
+func unknownKeyWarnings(meta toml.MetaData) []ConfigWarning {
+	var warnings []ConfigWarning
+	reported := make(map[string]bool)
+	for _, key := range meta.Undecoded() {
+		unknown, known := unknownPrefix(key)
+		if reported[unknown.String()] {
+			continue
+		}
+		reported[unknown.String()] = true
+
+		parent, name := unknown[:len(unknown)-1], unknown[len(unknown)-1]
+		warning := ConfigWarning{
+			Key:        unknown.String(),
+			Suggestion: closestKey(name, known),
+			Message:    fmt.Sprintf("%s is not a known setting and is ignored", unknown),
+		}
+		if warning.Suggestion != "" {
+			warning.Message += fmt.Sprintf("; did you mean %s?", warning.Suggestion)
+			if !meta.IsDefined(append(append([]string(nil), parent...), warning.Suggestion)...) {
+				warning.Message += fmt.Sprintf(" %s is not set and keeps its default", warning.Suggestion)
+			}
+		}
+		warnings = append(warnings, warning)
+	}
+	return warnings
+}
+
+// unknownPrefix returns the leading part of key up to its first segment
+// Configuration does not know, with the keys known in its place. Below a
+// table of free-form keys nothing is known.
+func unknownPrefix(key toml.Key) (toml.Key, []string) {
+	t := reflect.TypeOf(Configuration{})
+	for i, name := range key {
+		for t.Kind() == reflect.Slice || t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return key, nil
+		}
+		field, ok := tomlField(t, name)
+		if !ok {
+			return key[:i+1], tomlNames(t)
+		}
+		t = field.Type
+	}
+	return key, nil
+}
+
+// tomlNames returns the TOML keys of struct t
+func tomlNames(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		if name := tomlName(t.Field(i)); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// tomlField returns the field of struct t decoded from key name
+func tomlField(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		if field := t.Field(i); tomlName(field) == name {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// tomlName returns the TOML key of a field, or "" for one never decoded
+func tomlName(field reflect.StructField) string {
+	if !field.IsExported() {
+		return ""
+	}
+	name, _, _ := strings.Cut(field.Tag.Get("toml"), ",")
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return field.Name
+	}
+	return name
+}
+
+// closestKey returns the known key nearest name by edit distance, if it is
+// near enough to be a misspelling: two edits, or a quarter of the key's
+// length for longer keys
+func closestKey(name string, known []string) string {
+	best, bestDistance := "", -1
+	for _, candidate := range known {
+		distance := editDistance(strings.ToLower(name), strings.ToLower(candidate))
+		if distance > max(2, len(candidate)/4) || distance >= len(candidate) {
+			continue
+		}
+		if bestDistance < 0 || distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b, counting a
+// swap of adjacent characters as one edit like an insertion, deletion or
+// substitution
+func editDistance(a, b string) int {
+	rows := make([][]int, len(a)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(b)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			rows[i][j] = min(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				rows[i][j] = min(rows[i][j], rows[i-2][j-2]+1)
+			}
+		}
+	}
+	return rows[len(a)][len(b)]
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDecodeConfigSuggestsMisspelledKeys(t *testing.T) {
+	tests := []struct {
+		name           string
+		content        string
+		wantKey        string
+		wantSuggestion string
+	}{
+		{"Transposed letters", "[[ibkr_connection.accounts]]\nacount_code = \"DU1\"\n", "ibkr_connection.accounts.acount_code", "account_code"},
+		{"Missing letter", "[trading_parameters]\nglobal_max_concurrent_positons = 5\n", "trading_parameters.global_max_concurrent_positons", "global_max_concurrent_positions"},
+		{"Swapped letters", "[[ibkr_connection.accounts]]\nprot = 7497\n", "ibkr_connection.accounts.prot", "port"},
+		{"Hyphen for underscore", "[option_chain]\nmax-contracts = 100\n", "option_chain.max-contracts", "max_contracts"},
+		{"Wrong case", "[spread_builder]\nSpread_Widht = 5.0\n", "spread_builder.Spread_Widht", "spread_width"},
+		{"Extra letter", "[general]\nlog_levell = \"debug\"\n", "general.log_levell", "log_level"},
+		{"Array of tables", "[[health.dependencies]]\nname = \"ibkr\"\ntimout_ms = 100\n", "health.dependencies.timout_ms", "timeout_ms"},
+		{"Unrelated key", "[ibkr_connection]\nfavourite_colour = \"blue\"\n", "ibkr_connection.favourite_colour", ""},
+		{"Misspelled table", "[ibkr_conection]\nhost = \"localhost\"\n", "ibkr_conection", "ibkr_connection"},
+		{"Unknown table", "[dashbord]\ntheme = \"dark\"\nrefresh = 5\n", "dashbord", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, warnings, err := decodeConfig([]byte(tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(warnings) != 1 {
+				t.Fatalf("Warnings = %v, want one", warnings)
+			}
+			warning := warnings[0]
+			if warning.Key != tt.wantKey || warning.Suggestion != tt.wantSuggestion {
+				t.Errorf("Warning = %+v, want key %q suggesting %q", warning, tt.wantKey, tt.wantSuggestion)
+			}
+			if !strings.Contains(warning.Message, tt.wantKey) || (tt.wantSuggestion != "" && !strings.Contains(warning.Message, "did you mean "+tt.wantSuggestion)) {
+				t.Errorf("Message = %q", warning.Message)
+			}
+		})
+	}
+}
+
+func TestDecodeConfigNotesDefaultedSettings(t *testing.T) {
+	_, warnings, err := decodeConfig([]byte("[ibkr_connection]\nheartbeat_seconds = 10\nheartbeat_secnds = 5\nmax_backof_seconds = 30\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 2 {
+		t.Fatalf("Warnings = %v, want two", warnings)
+	}
+	for _, warning := range warnings {
+		defaulted := strings.Contains(warning.Message, "keeps its default")
+		if want := warning.Suggestion == "max_backoff_seconds"; defaulted != want {
+			t.Errorf("Message = %q; only the missing max_backoff_seconds keeps its default", warning.Message)
+		}
+	}
+}
+
+func TestLoadConfigEmitsWarnings(t *testing.T) {
+	template, err := os.ReadFile(filepath.Join("config", "config.template.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := NewApp()
+	app.configPath = filepath.Join(t.TempDir(), "config.toml")
+	misspelled := strings.Replace(string(template), "account_code =", "acount_code =", 1)
+	if err := os.WriteFile(app.configPath, []byte(misspelled), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var emitted []ConfigWarning
+	app.emit = func(name string, data ...interface{}) {
+		if name == ConfigWarningsEvent {
+			emitted = data[0].([]ConfigWarning)
+		}
+	}
+	if err := app.LoadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if len(emitted) != 1 || emitted[0].Suggestion != "account_code" {
+		t.Errorf("Emitted %v, want the account_code suggestion", emitted)
+	}
+
+	// A clean reload clears the warnings
+	if err := app.reloadConfig(template); err != nil {
+		t.Fatal(err)
+	}
+	if len(emitted) != 0 || len(app.GetConfigWarnings()) != 0 {
+		t.Errorf("Warnings %v after a clean reload", app.GetConfigWarnings())
+	}
+}
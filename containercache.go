@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// containerReconcileInterval is how often the container cache is replaced by
+// a full listing, correcting any drift from missed events
+const containerReconcileInterval = 60 * time.Second
+
+// containerEventActions are the Docker events that change a container's
+// state, with the state and docker ps status they leave it in
+var containerEventActions = map[string]struct{ state, status string }{
+	"create":  {ContainerCreated, "Created"},
+	"start":   {ContainerRunning, "Up"},
+	"unpause": {ContainerRunning, "Up"},
+	"pause":   {ContainerPaused, "Up (Paused)"},
+	"die":     {ContainerExited, "Exited"},
+	"destroy": {},
+}
+
+// eventAttributes are the attributes of container events that are not labels
+var eventAttributes = map[string]bool{"name": true, "image": true, "exitCode": true, "signal": true, "execDuration": true}
+
+// dockerEvent is a line of `docker events --format '{{json .}}'`
+type dockerEvent struct {
+	Type   string `json:"Type"`
+	Action string `json:"Action"`
+	Actor  struct {
+		ID         string            `json:"ID"`
+		Attributes map[string]string `json:"Attributes"`
+	} `json:"Actor"`
+	TimeNano int64 `json:"timeNano"`
+}
+
+// containerCache keeps the trading stack's containers between listings. It
+// is only read while the Docker event stream is connected, as without events
+// it cannot tell when it goes stale.
+type containerCache struct {
+	mu         sync.Mutex
+	containers map[string]ContainerInfo
+	// entries hold, by container ID, the daemon time of the latest event
+	// applied and when it was applied. Destroyed containers keep theirs, so an
+	// event delivered after the destroy cannot bring them back.
+	entries map[string]cacheEntry
+	// seq counts the events applied, to tell which ones a listing may miss
+	seq        uint64
+	reconciled time.Time
+	valid      bool
+	streaming  bool
+	// stopStream ends the connected event stream
+	stopStream context.CancelFunc
+}
+
+// cacheEntry records the latest event applied to a container
+type cacheEntry struct {
+	eventTime int64
+	seq       uint64
+}
+
+// snapshot returns the cached containers and when they were last listed, or
+// false when they must be listed again
+func (c *containerCache) snapshot() ([]ContainerInfo, time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.valid || !c.streaming {
+		return nil, time.Time{}, false
+	}
+	containers := make([]ContainerInfo, 0, len(c.containers))
+	for _, container := range c.containers {
+		containers = append(containers, container)
+	}
+	return containers, c.reconciled, true
+}
+
+// mark returns the point a listing starts from, to pass to reconcile
+func (c *containerCache) mark() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.seq
+}
+
+// reconcile replaces the cached containers with a listing started at mark
+// and time at, and returns them. Containers with events applied since mark
+// keep the state the events left them in, as the listing may predate them.
+func (c *containerCache) reconcile(listed []ContainerInfo, mark uint64, at time.Time) []ContainerInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	containers := make(map[string]ContainerInfo, len(listed))
+	merged := make([]ContainerInfo, 0, len(listed))
+	for _, container := range listed {
+		key := cacheKey(container)
+		if entry, ok := c.entries[key]; ok && entry.seq > mark {
+			// Added back below from the cache if the events kept it
+			continue
+		}
+		containers[key] = container
+		merged = append(merged, container)
+	}
+	for id, entry := range c.entries {
+		if entry.seq <= mark {
+			delete(c.entries, id)
+			continue
+		}
+		if container, ok := c.containers[id]; ok {
+			containers[id] = container
+			merged = append(merged, container)
+		}
+	}
+	c.containers = containers
+	c.reconciled = at
+	c.valid = true
+	return merged
+}
+
+// cacheKey keys a container by its ID, or by its name when it has none
+func cacheKey(container ContainerInfo) string {
+	if container.ID == "" {
+		return container.Name
+	}
+	return container.ID
+}
+
+// apply updates the cache with a Docker event. Events of containers the
+// matcher does not list and events older than one already applied to the
+// same container are ignored.
+func (c *containerCache) apply(event dockerEvent, matcher *containerMatcher) {
+	change, ok := containerEventActions[event.Action]
+	if event.Type != "container" || !ok || event.Actor.ID == "" {
+		return
+	}
+
+	container := ContainerInfo{
+		ID:     event.Actor.ID,
+		Name:   event.Actor.Attributes["name"],
+		Image:  event.Actor.Attributes["image"],
+		Labels: make(map[string]string),
+	}
+	for key, value := range event.Actor.Attributes {
+		if !eventAttributes[key] {
+			container.Labels[key] = value
+		}
+	}
+	reason, rule, listed := matcher.match(container)
+	if !listed {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[container.ID]; ok && event.TimeNano < entry.eventTime {
+		return
+	}
+	c.seq++
+	if c.entries == nil {
+		c.entries = make(map[string]cacheEntry)
+	}
+	c.entries[container.ID] = cacheEntry{eventTime: event.TimeNano, seq: c.seq}
+	if c.containers == nil {
+		c.containers = make(map[string]ContainerInfo)
+	}
+
+	if event.Action == "destroy" {
+		delete(c.containers, container.ID)
+		return
+	}
+	container.MatchedBy, container.MatchRule = reason, rule
+	container.State, container.Status = change.state, change.status
+	if code := event.Actor.Attributes["exitCode"]; event.Action == "die" && code != "" {
+		container.Status = fmt.Sprintf("Exited (%s)", code)
+	}
+	c.containers[container.ID] = container
+}
+
+// connected marks the event stream connected, stopped by stop. The cache is
+// listed afresh, as events may have been missed while it was down.
+func (c *containerCache) connected(stop context.CancelFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.streaming = true
+	c.valid = false
+	c.stopStream = stop
+}
+
+// disconnected marks the event stream down, until which the cache is not read
+func (c *containerCache) disconnected() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.streaming = false
+	c.stopStream = nil
+}
+
+// isStreaming reports whether the event stream is connected
+func (c *containerCache) isStreaming() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.streaming
+}
+
+// invalidate makes the next read list the containers again
+func (c *containerCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.valid = false
+}
+
+// restart ends the event stream so it reconnects, to the new Docker host
+// after a change
+func (c *containerCache) restart() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.valid = false
+	if c.stopStream != nil {
+		c.stopStream()
+	}
+}
+
+// watchContainers keeps the container cache current from the Docker event
+// stream until ctx is cancelled, reconnecting with backoff when the stream
+// drops, and reconciles it with a full listing every
+// containerReconcileInterval
+func (a *App) watchContainers(ctx context.Context) {
+	go a.reconcileContainersPeriodically(ctx)
+
+	delay := a.backoff.Initial
+	for {
+		if err := a.requireDocker(); err == nil {
+			started := time.Now()
+			err := a.streamContainerEvents(ctx, started)
+			if ctx.Err() != nil {
+				return
+			}
+			if time.Since(started) > a.backoff.Max {
+				delay = a.backoff.Initial
+			}
+			log.Warn().Err(err).Dur("retry_in", delay).Msg("Docker event stream ended, container cache disabled until it reconnects")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = a.backoff.next(delay)
+	}
+}
+
+// streamContainerEvents applies the container events from since on to the
+// cache until the stream ends
+func (a *App) streamContainerEvents(ctx context.Context, since time.Time) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	a.containers.connected(cancel)
+	defer a.containers.disconnected()
+
+	args := []string{"events", "--format", "{{json .}}", "--since", strconv.FormatInt(since.Unix(), 10), "--filter", "type=container"}
+	for action := range containerEventActions {
+		args = append(args, "--filter", "event="+action)
+	}
+	return a.streamDocker(ctx, a.applyContainerEvent, args...)
+}
+
+// applyContainerEvent applies a line of the Docker event stream to the cache
+func (a *App) applyContainerEvent(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+	var event dockerEvent
+	if err := json.Unmarshal([]byte(line), &event); err != nil {
+		log.Warn().Err(err).Msg("Failed to decode Docker event, relisting containers")
+		a.containers.invalidate()
+		return
+	}
+	matcher, err := newContainerMatcher(a.config)
+	if err != nil {
+		return
+	}
+	a.containers.apply(event, matcher)
+}
+
+// reconcileContainersPeriodically relists the containers into the cache every
+// containerReconcileInterval while the event stream is connected
+func (a *App) reconcileContainersPeriodically(ctx context.Context) {
+	ticker := time.NewTicker(containerReconcileInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !a.containers.isStreaming() {
+				continue
+			}
+			a.containers.invalidate()
+			if _, err := a.GetContainers(); err != nil {
+				log.Debug().Err(err).Msg("Container reconciliation failed")
+			}
+		}
+	}
+}
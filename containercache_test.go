@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// cacheTestContainers are listed by the default name patterns, with IDs
+var cacheTestContainers = []ContainerInfo{
+	{ID: "orch1", Name: "trader-orchestrator-1", Image: "ibkr/orchestrator:latest", State: ContainerRunning, Status: "Up 2 hours"},
+	{ID: "scan1", Name: "trader-scanner-1", Image: "ibkr/scanner:latest", State: ContainerRunning, Status: "Up 2 hours"},
+	{ID: "pg", Name: "postgres", Image: "postgres:16", State: ContainerRunning, Status: "Up 2 hours"},
+}
+
+// newCacheTestApp returns an app with Docker available, the event stream
+// marked connected and listContainers counting its calls
+func newCacheTestApp(listings *atomic.Int32) *App {
+	app := NewApp()
+	app.backends.Docker.Available = true
+	app.listContainers = func(ctx context.Context) ([]ContainerInfo, error) {
+		listings.Add(1)
+		return append([]ContainerInfo(nil), cacheTestContainers...), nil
+	}
+	app.containers.connected(func() {})
+	return app
+}
+
+// containerEvent returns a line of docker events for a container
+func containerEvent(action, id, name string, timeNano int64, attributes map[string]string) string {
+	event := dockerEvent{Type: "container", Action: action, TimeNano: timeNano}
+	event.Actor.ID = id
+	event.Actor.Attributes = map[string]string{"name": name, "image": "ibkr/" + name}
+	for key, value := range attributes {
+		event.Actor.Attributes[key] = value
+	}
+	line, _ := json.Marshal(event)
+	return string(line)
+}
+
+// containerStates maps the listed containers' names to their state and status
+func containerStates(t *testing.T, app *App) map[string]string {
+	t.Helper()
+	containers, err := app.GetContainers()
+	if err != nil {
+		t.Fatalf("GetContainers() error = %v", err)
+	}
+	states := make(map[string]string, len(containers))
+	for _, c := range containers {
+		states[c.Name] = c.State + " " + c.Status
+	}
+	return states
+}
+
+func TestContainerCacheAppliesEvents(t *testing.T) {
+	var listings atomic.Int32
+	app := newCacheTestApp(&listings)
+
+	before := time.Now()
+	containers, err := app.GetContainers()
+	if err != nil || len(containers) != 2 {
+		t.Fatalf("GetContainers() = %v, %v", containers, err)
+	}
+	if containers[0].LastReconciled.Before(before) {
+		t.Errorf("LastReconciled = %v, want the listing time", containers[0].LastReconciled)
+	}
+
+	events := []string{
+		containerEvent("pause", "scan1", "trader-scanner-1", 100, nil),
+		containerEvent("create", "scan2", "trader-scanner-2", 110, map[string]string{"com.docker.compose.project": "trader"}),
+		containerEvent("start", "scan2", "trader-scanner-2", 120, map[string]string{"com.docker.compose.project": "trader"}),
+		containerEvent("die", "orch1", "trader-orchestrator-1", 130, map[string]string{"exitCode": "137"}),
+		containerEvent("destroy", "orch1", "trader-orchestrator-1", 140, nil),
+		// Not a trading stack container
+		containerEvent("start", "pg2", "postgres", 150, nil),
+		// Delivered after the destroy it precedes
+		containerEvent("start", "orch1", "trader-orchestrator-1", 135, nil),
+		"not json",
+	}
+	for _, line := range events[:len(events)-1] {
+		app.applyContainerEvent(line)
+	}
+
+	want := map[string]string{
+		"trader-scanner-1": "paused Up (Paused)",
+		"trader-scanner-2": "running Up",
+	}
+	got := containerStates(t, app)
+	if len(got) != len(want) || got["trader-scanner-1"] != want["trader-scanner-1"] || got["trader-scanner-2"] != want["trader-scanner-2"] {
+		t.Errorf("Containers after events = %v, want %v", got, want)
+	}
+	if n := listings.Load(); n != 1 {
+		t.Errorf("Containers listed %d times, want once with the events applied to the cache", n)
+	}
+
+	containers, _ = app.GetContainers()
+	if added := containers[1]; added.MatchedBy != MatchedByName || added.Labels["com.docker.compose.project"] != "trader" || added.Labels["name"] != "" {
+		t.Errorf("Container added by events = %+v", added)
+	}
+
+	// An undecodable event makes the next read list the containers again
+	app.applyContainerEvent(events[len(events)-1])
+	if got := containerStates(t, app); got["trader-orchestrator-1"] != "running Up 2 hours" || listings.Load() != 2 {
+		t.Errorf("Containers after a bad event = %v with %d listings, want a fresh listing", got, listings.Load())
+	}
+}
+
+func TestContainerCacheIgnoresOutOfOrderEvents(t *testing.T) {
+	var listings atomic.Int32
+	app := newCacheTestApp(&listings)
+	containerStates(t, app)
+
+	// The container died after it started, but the die event arrives first
+	app.applyContainerEvent(containerEvent("die", "scan1", "trader-scanner-1", 200, map[string]string{"exitCode": "1"}))
+	app.applyContainerEvent(containerEvent("start", "scan1", "trader-scanner-1", 100, nil))
+	if got := containerStates(t, app)["trader-scanner-1"]; got != "exited Exited (1)" {
+		t.Errorf("trader-scanner-1 = %q, want exited by the later die event", got)
+	}
+
+	// A new container whose die arrives before its start
+	app.applyContainerEvent(containerEvent("die", "orch2", "trader-orchestrator-2", 300, map[string]string{"exitCode": "0"}))
+	app.applyContainerEvent(containerEvent("start", "orch2", "trader-orchestrator-2", 290, nil))
+	if got := containerStates(t, app)["trader-orchestrator-2"]; got != "exited Exited (0)" {
+		t.Errorf("trader-orchestrator-2 = %q, want exited", got)
+	}
+}
+
+func TestContainerCacheReconcileKeepsEventsDuringListing(t *testing.T) {
+	var listings atomic.Int32
+	app := newCacheTestApp(&listings)
+
+	// An event applied while docker ps runs is newer than its output
+	app.listContainers = func(ctx context.Context) ([]ContainerInfo, error) {
+		listings.Add(1)
+		app.applyContainerEvent(containerEvent("pause", "scan1", "trader-scanner-1", 100, nil))
+		app.applyContainerEvent(containerEvent("destroy", "orch1", "trader-orchestrator-1", 110, nil))
+		return append([]ContainerInfo(nil), cacheTestContainers...), nil
+	}
+	got := containerStates(t, app)
+	if len(got) != 1 || got["trader-scanner-1"] != "paused Up (Paused)" {
+		t.Errorf("Containers = %v, want the events applied during the listing kept", got)
+	}
+}
+
+func TestContainerCacheUnusedWithoutEventStream(t *testing.T) {
+	var listings atomic.Int32
+	app := newCacheTestApp(&listings)
+	app.containers.disconnected()
+
+	containerStates(t, app)
+	containerStates(t, app)
+	if n := listings.Load(); n != 2 {
+		t.Errorf("Containers listed %d times, want every read while the event stream is down", n)
+	}
+
+	// Changing which containers are listed drops the cached ones
+	app.containers.connected(func() {})
+	containerStates(t, app)
+	config := app.config
+	config.Containers.NamePatterns = []string{"postgres"}
+	app.setConfig(config)
+	if got := containerStates(t, app); len(got) != 1 || got["postgres"] == "" || listings.Load() != 4 {
+		t.Errorf("Containers after a [containers] change = %v with %d listings", got, listings.Load())
+	}
+}
+
+func TestWatchContainersReconnects(t *testing.T) {
+	var listings atomic.Int32
+	app := newCacheTestApp(&listings)
+	app.containers.disconnected()
+	app.backoff = backoffPolicy{Initial: time.Millisecond, Max: 4 * time.Millisecond, Factor: 2}
+
+	var mu sync.Mutex
+	var calls int
+	var onEvent func(string)
+	app.streamDocker = func(ctx context.Context, onLine func(string), args ...string) error {
+		mu.Lock()
+		calls++
+		call := calls
+		onEvent = onLine
+		mu.Unlock()
+		if call == 1 {
+			return context.DeadlineExceeded
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go app.watchContainers(ctx)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !app.containers.isStreaming() || func() bool { mu.Lock(); defer mu.Unlock(); return calls < 2 }() {
+		if time.Now().After(deadline) {
+			t.Fatal("Event stream did not reconnect after it dropped")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	containerStates(t, app)
+	mu.Lock()
+	onEvent(containerEvent("pause", "scan1", "trader-scanner-1", 100, nil))
+	mu.Unlock()
+	if got := containerStates(t, app)["trader-scanner-1"]; got != "paused Up (Paused)" || listings.Load() != 1 {
+		t.Errorf("trader-scanner-1 = %q with %d listings, want the streamed event applied", got, listings.Load())
+	}
+
+	// A Docker host change restarts the stream
+	app.containers.restart()
+	for func() bool { mu.Lock(); defer mu.Unlock(); return calls < 3 }() {
+		if time.Now().After(deadline) {
+			t.Fatal("Event stream did not restart")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
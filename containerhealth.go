@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ContainerRestarting is the state of a container Docker is restarting
+const ContainerRestarting = "restarting"
+
+// Healthcheck statuses Docker reports in ContainerInfo.Health
+const (
+	HealthStarting  = "starting"
+	HealthHealthy   = "healthy"
+	HealthUnhealthy = "unhealthy"
+)
+
+// Restart policies SetRestartPolicy applies
+const (
+	RestartNo            = "no"
+	RestartOnFailure     = "on-failure"
+	RestartUnlessStopped = "unless-stopped"
+)
+
+// States of ContainersStatus
+const (
+	StackRunning  = "Running"
+	StackDegraded = "Degraded"
+	StackStopped  = "Stopped"
+)
+
+// defaultMaxRestartsPerHour is used when containers.max_restarts_per_hour is
+// not set
+const defaultMaxRestartsPerHour = 3
+
+// restartWindow is the period ContainerInfo.RestartsLastHour counts over
+const restartWindow = time.Hour
+
+// ContainersStatus sums up the stack's containers for the status. A stack is
+// Degraded while a container fails its healthcheck, is being restarted or
+// restarted more than Containers.MaxRestartsPerHour times in the last hour,
+// whatever Docker's status string says.
+type ContainersStatus struct {
+	State      string `json:"state"`
+	Containers int    `json:"containers"`
+	Running    int    `json:"running"`
+	// Problems say which containers degrade the stack and why
+	Problems []string `json:"problems,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// containerState is what `docker container inspect` reports of a container
+// beyond docker ps
+type containerState struct {
+	ID           string `json:"Id"`
+	RestartCount int    `json:"RestartCount"`
+	State        struct {
+		Status    string    `json:"Status"`
+		ExitCode  int       `json:"ExitCode"`
+		StartedAt time.Time `json:"StartedAt"`
+		Health    *struct {
+			Status string `json:"Status"`
+		} `json:"Health"`
+	} `json:"State"`
+	HostConfig struct {
+		RestartPolicy struct {
+			Name string `json:"Name"`
+		} `json:"RestartPolicy"`
+	} `json:"HostConfig"`
+}
+
+// restartSample is a container's restart count when it was inspected
+type restartSample struct {
+	at    time.Time
+	count int
+}
+
+// restartHistory keeps each container's restart counts over restartWindow.
+// Docker only counts restarts since the container was created, so the
+// restarts of the last hour are the growth of the count since then.
+type restartHistory struct {
+	mu      sync.Mutex
+	samples map[string][]restartSample
+}
+
+// observe records a container's restart count at now and returns how many
+// times it restarted within restartWindow, as far as the samples tell.
+// Samples older than the window are dropped, except the latest of them,
+// which is the count the window started from.
+func (h *restartHistory) observe(id string, count int, now time.Time) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.samples == nil {
+		h.samples = make(map[string][]restartSample)
+	}
+
+	cutoff := now.Add(-restartWindow)
+	for other, samples := range h.samples {
+		if other != id && samples[len(samples)-1].at.Before(cutoff) {
+			delete(h.samples, other)
+		}
+	}
+
+	samples := append(h.samples[id], restartSample{at: now, count: count})
+	for len(samples) > 1 && !samples[1].at.After(cutoff) {
+		samples = samples[1:]
+	}
+	h.samples[id] = samples
+	if restarts := count - samples[0].count; restarts > 0 {
+		return restarts
+	}
+	return 0
+}
+
+// inspectContainers fills in the health, restarts, last exit code and
+// uptime of containers from one `docker container inspect`. Containers are
+// listed without them when Docker cannot inspect them.
+func (a *App) inspectContainers(containers []ContainerInfo) {
+	index := make(map[string]int, len(containers))
+	ids := make([]string, 0, len(containers))
+	for i, container := range containers {
+		if container.ID != "" {
+			index[container.ID] = i
+			ids = append(ids, container.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	states, err := a.inspectStates(ctx, ids)
+	if err != nil {
+		log.Debug().Err(err).Msg("Failed to inspect containers")
+		return
+	}
+
+	now := time.Now()
+	for _, state := range states {
+		i, ok := index[state.ID]
+		if !ok {
+			continue
+		}
+		container := &containers[i]
+		if state.State.Status != "" {
+			container.State = state.State.Status
+		}
+		if state.State.Health != nil {
+			container.Health = state.State.Health.Status
+		}
+		container.RestartCount = state.RestartCount
+		container.RestartsLastHour = a.restarts.observe(state.ID, state.RestartCount, now)
+		container.RestartPolicy = state.HostConfig.RestartPolicy.Name
+		container.ExitCode = state.State.ExitCode
+		if state.State.Status == ContainerRunning && !state.State.StartedAt.IsZero() {
+			container.UptimeSeconds = int64(now.Sub(state.State.StartedAt).Seconds())
+		}
+	}
+}
+
+// dockerInspect inspects containers through the docker CLI
+func (a *App) dockerInspect(ctx context.Context, ids []string) ([]containerState, error) {
+	var stderr bytes.Buffer
+	cmd := a.dockerCmd(ctx, append([]string{"container", "inspect", "--format", "{{json .}}"}, ids...)...)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("docker container inspect: %s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+	return parseContainerStates(output)
+}
+
+// parseContainerStates decodes the JSON lines written by docker container
+// inspect
+func parseContainerStates(output []byte) ([]containerState, error) {
+	var states []containerState
+	for _, line := range bytes.Split(output, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var state containerState
+		if err := json.Unmarshal(line, &state); err != nil {
+			return nil, fmt.Errorf("failed to decode docker container inspect output: %w", err)
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// containersStatus sums up the stack's containers, or returns nil without
+// Docker
+func (a *App) containersStatus() *ContainersStatus {
+	if a.requireDocker() != nil {
+		return nil
+	}
+	containers, err := a.GetContainers()
+	if err != nil {
+		return &ContainersStatus{State: StackDegraded, Error: err.Error()}
+	}
+	return summarizeContainers(containers, a.maxRestartsPerHour())
+}
+
+// summarizeContainers sums up containers, degraded by any that is unhealthy,
+// restarting or restarted more than maxRestarts times in the last hour
+func summarizeContainers(containers []ContainerInfo, maxRestarts int) *ContainersStatus {
+	status := &ContainersStatus{State: StackRunning, Containers: len(containers)}
+	for _, container := range containers {
+		if container.State == ContainerRunning {
+			status.Running++
+		}
+		switch {
+		case container.Health == HealthUnhealthy:
+			status.Problems = append(status.Problems, container.Name+" is unhealthy")
+		case container.State == ContainerRestarting:
+			status.Problems = append(status.Problems, fmt.Sprintf("%s is restarting after exiting with code %d", container.Name, container.ExitCode))
+		case container.RestartsLastHour > maxRestarts:
+			status.Problems = append(status.Problems, fmt.Sprintf("%s restarted %d times in the last hour", container.Name, container.RestartsLastHour))
+		}
+	}
+	switch {
+	case len(status.Problems) > 0:
+		status.State = StackDegraded
+	case status.Running == 0:
+		status.State = StackStopped
+	}
+	return status
+}
+
+// maxRestartsPerHour returns Containers.MaxRestartsPerHour, or the default
+// when it is not set
+func (a *App) maxRestartsPerHour() int {
+	if restarts := a.config.Containers.MaxRestartsPerHour; restarts > 0 {
+		return restarts
+	}
+	return defaultMaxRestartsPerHour
+}
+
+// RestartContainer restarts one container of the trading stack, giving it
+// DockerStack.StopTimeoutSeconds to exit before it is killed
+func (a *App) RestartContainer(containerID string) (OperationReport, error) {
+	if err := a.requireWritable("RestartContainer"); err != nil {
+		return newOperationReport("restart"), err
+	}
+	timeout := a.stopTimeoutSeconds()
+	return a.applyToStackContainer(containerID, containerOperation{
+		name:    "restart",
+		skip:    func(ContainerInfo) string { return "" },
+		args:    func(c ContainerInfo) []string { return []string{"restart", "--time", strconv.Itoa(timeout), c.ID} },
+		timeout: time.Duration(timeout) * time.Second,
+	})
+}
+
+// SetRestartPolicy sets the restart policy of one container of the trading
+// stack to no, on-failure or unless-stopped, which Docker applies without
+// restarting it
+func (a *App) SetRestartPolicy(containerID string, policy string) (OperationReport, error) {
+	const operation = "update restart policy"
+	if err := a.requireWritable("SetRestartPolicy"); err != nil {
+		return newOperationReport(operation), err
+	}
+	switch policy {
+	case RestartNo, RestartOnFailure, RestartUnlessStopped:
+	default:
+		return newOperationReport(operation), fmt.Errorf("restart policy must be %s, %s or %s, got %q", RestartNo, RestartOnFailure, RestartUnlessStopped, policy)
+	}
+	return a.applyToStackContainer(containerID, containerOperation{
+		name: operation,
+		skip: func(ContainerInfo) string { return "" },
+		args: func(c ContainerInfo) []string { return []string{"update", "--restart", policy, c.ID} },
+	})
+}
+
+// applyToStackContainer applies op to the stack's container with
+// containerID, refusing containers outside the stack
+func (a *App) applyToStackContainer(containerID string, op containerOperation) (OperationReport, error) {
+	containers, err := a.GetContainers()
+	if err != nil {
+		return newOperationReport(op.name), err
+	}
+	for _, container := range containers {
+		if container.ID == containerID {
+			return a.applyContainerOperation([]ContainerInfo{container}, op), nil
+		}
+	}
+	return newOperationReport(op.name), fmt.Errorf("container %s is not part of the trading stack", containerID)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// inspectLine returns a line of `docker container inspect` output
+func inspectLine(id, status, health string, restarts, exitCode int, started time.Time) string {
+	healthJSON := "null"
+	if health != "" {
+		healthJSON = fmt.Sprintf(`{"Status":%q}`, health)
+	}
+	return fmt.Sprintf(`{"Id":%q,"RestartCount":%d,"State":{"Status":%q,"ExitCode":%d,"StartedAt":%q,"Health":%s},"HostConfig":{"RestartPolicy":{"Name":"unless-stopped"}}}`,
+		id, restarts, status, exitCode, started.Format(time.RFC3339Nano), healthJSON)
+}
+
+// newContainerHealthTestApp lists an orchestrator and a scanner, inspected
+// from the lines in inspected
+func newContainerHealthTestApp(inspected *[]string) (*App, *fakeDockerCLI) {
+	docker := &fakeDockerCLI{}
+	app := NewApp()
+	app.backends.Docker.Available = true
+	app.runDocker = docker.run
+	app.inspectStates = func(ctx context.Context, ids []string) ([]containerState, error) {
+		return parseContainerStates([]byte(strings.Join(*inspected, "\n")))
+	}
+	app.listContainers = func(ctx context.Context) ([]ContainerInfo, error) {
+		return []ContainerInfo{
+			{ID: "o1", Name: "orchestrator", Image: "ibkr/orchestrator:latest", State: ContainerRunning, Status: "Up 2 hours"},
+			{ID: "s1", Name: "scanner", Image: "ibkr/scanner:latest", State: ContainerRunning, Status: "Up 2 hours"},
+		}, nil
+	}
+	return app, docker
+}
+
+func TestContainersStatus(t *testing.T) {
+	started := time.Now().Add(-2 * time.Hour)
+	tests := []struct {
+		name     string
+		inspect  []string
+		state    string
+		problems string
+	}{
+		{
+			name: "healthy",
+			inspect: []string{
+				inspectLine("o1", ContainerRunning, HealthHealthy, 0, 0, started),
+				inspectLine("s1", ContainerRunning, "", 1, 137, started),
+			},
+			state: StackRunning,
+		},
+		{
+			name: "unhealthy",
+			inspect: []string{
+				inspectLine("o1", ContainerRunning, HealthUnhealthy, 0, 0, started),
+				inspectLine("s1", ContainerRunning, "", 0, 0, started),
+			},
+			state:    StackDegraded,
+			problems: "orchestrator is unhealthy",
+		},
+		{
+			name: "restarting",
+			inspect: []string{
+				inspectLine("o1", ContainerRestarting, "", 2, 1, started),
+				inspectLine("s1", ContainerRunning, "", 0, 0, started),
+			},
+			state:    StackDegraded,
+			problems: "orchestrator is restarting after exiting with code 1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, _ := newContainerHealthTestApp(&tt.inspect)
+
+			status := app.containersStatus()
+			if status.State != tt.state || strings.Join(status.Problems, "; ") != tt.problems {
+				t.Errorf("containersStatus() = %+v, want %s with problems %q", status, tt.state, tt.problems)
+			}
+			if status.Containers != 2 {
+				t.Errorf("Containers = %d, want 2", status.Containers)
+			}
+		})
+	}
+}
+
+func TestGetContainersInspectsHealth(t *testing.T) {
+	inspected := []string{
+		inspectLine("o1", ContainerRunning, HealthHealthy, 0, 0, time.Now().Add(-time.Hour)),
+		inspectLine("s1", ContainerRunning, "", 2, 137, time.Now().Add(-time.Minute)),
+	}
+	app, _ := newContainerHealthTestApp(&inspected)
+
+	containers, err := app.GetContainers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orchestrator, scanner := containers[0], containers[1]
+	if orchestrator.Health != HealthHealthy || orchestrator.RestartPolicy != RestartUnlessStopped || orchestrator.UptimeSeconds < 3599 {
+		t.Errorf("orchestrator = %+v, want healthy and up an hour", orchestrator)
+	}
+	if scanner.Health != "" || scanner.RestartCount != 2 || scanner.ExitCode != 137 || scanner.UptimeSeconds > 120 {
+		t.Errorf("scanner = %+v, want no healthcheck, 2 restarts and exit code 137", scanner)
+	}
+}
+
+func TestContainersStatusCrashLoop(t *testing.T) {
+	var inspected []string
+	app, _ := newContainerHealthTestApp(&inspected)
+	started := time.Now()
+	for restarts := 1; restarts <= 5; restarts++ {
+		inspected = []string{
+			inspectLine("o1", ContainerRunning, "", restarts, 1, started),
+			inspectLine("s1", ContainerRunning, "", 0, 0, started),
+		}
+		status := app.containersStatus()
+		// Docker reports the orchestrator running between crashes, and the
+		// stack degrades once it restarted more than three times
+		want := StackRunning
+		if restarts == 5 {
+			want = StackDegraded
+		}
+		if status.State != want {
+			t.Fatalf("After %d restarts, state = %s, want %s", restarts, status.State, want)
+		}
+	}
+	status := app.containersStatus()
+	if want := "orchestrator restarted 4 times in the last hour"; len(status.Problems) != 1 || status.Problems[0] != want {
+		t.Errorf("Problems = %v, want %q", status.Problems, want)
+	}
+
+	app.config.Containers.MaxRestartsPerHour = 10
+	if status := app.containersStatus(); status.State != StackRunning {
+		t.Errorf("State = %s with 10 restarts allowed, want %s", status.State, StackRunning)
+	}
+}
+
+func TestRestartHistoryWindow(t *testing.T) {
+	var history restartHistory
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	if n := history.observe("o1", 5, start); n != 0 {
+		t.Errorf("First sample counted %d restarts, want 0", n)
+	}
+	if n := history.observe("o1", 8, start.Add(30*time.Minute)); n != 3 {
+		t.Errorf("Restarts after 30 minutes = %d, want 3", n)
+	}
+	if n := history.observe("o1", 9, start.Add(90*time.Minute)); n != 1 {
+		t.Errorf("Restarts after 90 minutes = %d, want the one since 08:30's count", n)
+	}
+	history.observe("s1", 0, start.Add(3*time.Hour))
+	if _, ok := history.samples["o1"]; ok {
+		t.Error("Samples of a container not seen for over an hour were kept")
+	}
+}
+
+func TestRestartContainer(t *testing.T) {
+	var inspected []string
+	app, docker := newContainerHealthTestApp(&inspected)
+
+	report, err := app.RestartContainer("s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Succeeded) != 1 || report.Succeeded[0] != "scanner" {
+		t.Errorf("Report = %+v, want the scanner restarted", report)
+	}
+	if _, err := app.RestartContainer("postgres"); err == nil || !strings.Contains(err.Error(), "not part of the trading stack") {
+		t.Errorf("RestartContainer(postgres) error = %v, want it refused", err)
+	}
+	if _, err := app.SetRestartPolicy("o1", RestartOnFailure); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.SetRestartPolicy("o1", "always"); err == nil {
+		t.Error("SetRestartPolicy(always) succeeded, want an error")
+	}
+
+	if want := "restart --time 30 s1,update --restart on-failure o1"; strings.Join(docker.commands, ",") != want {
+		t.Errorf("Ran %v, want %s", docker.commands, want)
+	}
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Docker container states the stack operations act on
+const (
+	ContainerRunning = "running"
+	ContainerPaused  = "paused"
+	ContainerExited  = "exited"
+	ContainerCreated = "created"
+)
+
+// StackLabel marks the containers StartStack creates, with the spec's name as
+// the value
+const StackLabel = "traderadmin.stack.container"
+
+// maxContainerOperations bounds the docker commands run at once
+const maxContainerOperations = 4
+
+// containerOperationTimeout bounds a whole stack operation, not counting the
+// time StopStack gives containers to exit
+const containerOperationTimeout = time.Minute
+
+// Defaults for the [docker_stack] section
+const (
+	defaultStopTimeoutSeconds = 30
+	defaultConfigMountPath    = "/app/config"
+)
+
+// ContainerOutcome names a container an operation skipped or failed, and why
+type ContainerOutcome struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// OperationReport lists what an operation did to each container, image or
+// order. A container that fails does not stop the others, so the report may
+// mix successes and failures. In dry-run mode nothing is done: Succeeded
+// lists what would have been changed and Would the commands skipped.
+type OperationReport struct {
+	Operation string             `json:"operation"`
+	Succeeded []string           `json:"succeeded"`
+	Skipped   []ContainerOutcome `json:"skipped"`
+	Failed    []ContainerOutcome `json:"failed"`
+	DryRun    bool               `json:"dryRun"`
+	Would     []string           `json:"would"`
+	// OrderID is the ID of the order PlaceSpreadOrder placed
+	OrderID int64 `json:"orderId,omitempty"`
+}
+
+// newOperationReport returns an empty report, with lists the frontend can
+// iterate without checking for null
+func newOperationReport(operation string) OperationReport {
+	return OperationReport{Operation: operation, Succeeded: []string{}, Skipped: []ContainerOutcome{}, Failed: []ContainerOutcome{}, Would: []string{}}
+}
+
+// containerOperation is a docker command applied to the eligible containers
+// of the stack
+type containerOperation struct {
+	name string
+	// method is the bound method, named when read-only mode rejects it
+	method string
+	// skip returns why a container is not eligible, or "" when it is
+	skip func(ContainerInfo) string
+	// args returns the docker command for the container
+	args func(ContainerInfo) []string
+	// timeout is added to containerOperationTimeout
+	timeout time.Duration
+}
+
+// unlessState returns a skip func passing only containers in one of states
+func unlessState(states ...string) func(ContainerInfo) string {
+	return func(c ContainerInfo) string {
+		for _, state := range states {
+			if c.State == state {
+				return ""
+			}
+		}
+		return fmt.Sprintf("container is %s", c.State)
+	}
+}
+
+// PauseStack pauses trading through the orchestrator's control service when
+// it is configured and reachable, and otherwise pauses every running
+// container of the trading stack
+func (a *App) PauseStack() (OperationReport, error) {
+	if report, handled, err := a.orchestratorOperation("pause", "PauseStack", "pause trading through the orchestrator", pauseOrchestrator("PauseStack")); handled {
+		return report, err
+	}
+	return a.runContainerOperation(containerOperation{
+		name:   "pause",
+		method: "PauseStack",
+		skip:   unlessState(ContainerRunning),
+		args:   func(c ContainerInfo) []string { return []string{"pause", c.ID} },
+	})
+}
+
+// UnpauseStack resumes trading through the orchestrator's control service
+// when it is configured and reachable, and otherwise unpauses every paused
+// container of the trading stack; an orchestrator whose container PauseStack
+// paused does not answer, so its container is unpaused
+func (a *App) UnpauseStack() (OperationReport, error) {
+	if report, handled, err := a.orchestratorOperation("unpause", "UnpauseStack", "resume trading through the orchestrator", resumeOrchestrator); handled {
+		return report, err
+	}
+	return a.runContainerOperation(containerOperation{
+		name:   "unpause",
+		method: "UnpauseStack",
+		skip:   unlessState(ContainerPaused),
+		args:   func(c ContainerInfo) []string { return []string{"unpause", c.ID} },
+	})
+}
+
+// ReloadStackConfig sends SIGHUP to every running container of the trading
+// stack, which the scanner handles by reloading its configuration
+func (a *App) ReloadStackConfig() (OperationReport, error) {
+	return a.runContainerOperation(containerOperation{
+		name:   "reload",
+		method: "ReloadStackConfig",
+		skip:   unlessState(ContainerRunning),
+		args:   func(c ContainerInfo) []string { return []string{"kill", "--signal", "HUP", c.ID} },
+	})
+}
+
+// StopStack stops every running or paused container of the trading stack,
+// sending SIGTERM and killing those still running after
+// DockerStack.StopTimeoutSeconds
+func (a *App) StopStack() (OperationReport, error) {
+	timeout := a.stopTimeoutSeconds()
+	return a.runContainerOperation(containerOperation{
+		name:    "stop",
+		method:  "StopStack",
+		skip:    unlessState(ContainerRunning, ContainerPaused),
+		args:    func(c ContainerInfo) []string { return []string{"stop", "--time", strconv.Itoa(timeout), c.ID} },
+		timeout: time.Duration(timeout) * time.Second,
+	})
+}
+
+// StartStack starts the stopped containers of the trading stack. When none of
+// the stack's containers exist, it creates and starts those configured in
+// [docker_stack] instead.
+func (a *App) StartStack() (OperationReport, error) {
+	if err := a.requireWritable("StartStack"); err != nil {
+		return newOperationReport("start"), err
+	}
+	containers, err := a.GetContainers()
+	if err != nil {
+		return newOperationReport("start"), err
+	}
+	if len(containers) == 0 {
+		return a.createStack()
+	}
+	return a.applyContainerOperation(containers, containerOperation{
+		name: "start",
+		skip: unlessState(ContainerExited, ContainerCreated),
+		args: func(c ContainerInfo) []string { return []string{"start", c.ID} },
+	}), nil
+}
+
+// createStack runs a container for each spec of [docker_stack], with the
+// config directory bind mounted read-only
+func (a *App) createStack() (OperationReport, error) {
+	exec := a.executor("create")
+	report := exec.report()
+	specs := a.config.DockerStack.Containers
+	if len(specs) == 0 {
+		return report, errors.New("no stack containers found and none configured in [docker_stack]")
+	}
+
+	configDir, err := filepath.Abs(filepath.Dir(a.configPath))
+	if err != nil {
+		return report, fmt.Errorf("failed to resolve the config directory: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), containerOperationTimeout)
+	defer cancel()
+
+	errs := runBounded(len(specs), func(i int) error {
+		args := a.runArgs(specs[i], configDir)
+		return exec.run("docker "+strings.Join(args, " "), func() error { return a.runDocker(ctx, args...) })
+	})
+	for i, spec := range specs {
+		if errs[i] != nil {
+			log.Error().Err(errs[i]).Str("container", spec.Name).Str("image", spec.Image).Msg("Failed to create container")
+			report.Failed = append(report.Failed, ContainerOutcome{Name: spec.Name, Reason: errs[i].Error()})
+			continue
+		}
+		report.Succeeded = append(report.Succeeded, spec.Name)
+	}
+
+	exec.finish(&report)
+	logReport(report)
+	return report, nil
+}
+
+// runArgs returns the docker run command creating and starting spec's
+// container. Environment variables are passed in name order.
+func (a *App) runArgs(spec StackContainerSpec, configDir string) []string {
+	stack := a.config.DockerStack
+	mountPath := stack.ConfigMountPath
+	if mountPath == "" {
+		mountPath = defaultConfigMountPath
+	}
+
+	args := []string{"run", "--detach", "--name", spec.Name, "--label", StackLabel + "=" + spec.Name}
+	if stack.Network != "" {
+		args = append(args, "--network", stack.Network)
+	}
+	for _, port := range spec.Ports {
+		args = append(args, "--publish", port)
+	}
+	args = append(args, "--volume", configDir+":"+mountPath+":ro")
+	for _, volume := range spec.Volumes {
+		args = append(args, "--volume", volume)
+	}
+
+	names := make([]string, 0, len(spec.Env))
+	for name := range spec.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		args = append(args, "--env", name+"="+spec.Env[name])
+	}
+	return append(args, spec.Image)
+}
+
+// stopTimeoutSeconds returns DockerStack.StopTimeoutSeconds, or the default
+// when it is not set
+func (a *App) stopTimeoutSeconds() int {
+	if timeout := a.config.DockerStack.StopTimeoutSeconds; timeout > 0 {
+		return timeout
+	}
+	return defaultStopTimeoutSeconds
+}
+
+// runContainerOperation applies op to the stack's containers. An error is
+// returned only when the containers could not be listed.
+func (a *App) runContainerOperation(op containerOperation) (OperationReport, error) {
+	if err := a.requireWritable(op.method); err != nil {
+		return newOperationReport(op.name), err
+	}
+	containers, err := a.GetContainers()
+	if err != nil {
+		return newOperationReport(op.name), err
+	}
+	return a.applyContainerOperation(containers, op), nil
+}
+
+// applyContainerOperation runs op's docker command for each eligible
+// container, at most maxContainerOperations at a time, and reports the
+// outcomes in the order of containers
+func (a *App) applyContainerOperation(containers []ContainerInfo, op containerOperation) OperationReport {
+	exec := a.executor(op.name)
+	report := exec.report()
+
+	var eligible []ContainerInfo
+	for _, container := range containers {
+		if reason := op.skip(container); reason != "" {
+			report.Skipped = append(report.Skipped, ContainerOutcome{ID: container.ID, Name: container.Name, Reason: reason})
+			continue
+		}
+		eligible = append(eligible, container)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), containerOperationTimeout+op.timeout)
+	defer cancel()
+
+	errs := runBounded(len(eligible), func(i int) error {
+		args := op.args(eligible[i])
+		return exec.run("docker "+strings.Join(args, " "), func() error { return a.runDocker(ctx, args...) })
+	})
+	for i, container := range eligible {
+		if errs[i] != nil {
+			log.Error().Err(errs[i]).Str("operation", op.name).Str("container", container.Name).Msg("Container operation failed")
+			report.Failed = append(report.Failed, ContainerOutcome{ID: container.ID, Name: container.Name, Reason: errs[i].Error()})
+			continue
+		}
+		report.Succeeded = append(report.Succeeded, container.Name)
+	}
+
+	exec.finish(&report)
+	logReport(report)
+	return report
+}
+
+// runBounded calls run for 0 through n-1, at most maxContainerOperations at
+// a time, and returns the error of each call
+func runBounded(n int, run func(i int) error) []error {
+	errs := make([]error, n)
+	sem := make(chan struct{}, maxContainerOperations)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			errs[i] = run(i)
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
+
+// logReport logs the counts of a finished operation
+func logReport(report OperationReport) {
+	log.Info().Str("operation", report.Operation).Int("succeeded", len(report.Succeeded)).Int("skipped", len(report.Skipped)).
+		Int("failed", len(report.Failed)).Bool("dry_run", report.DryRun).Msg("Container operation finished")
+}
+
+// dockerCommand runs a docker CLI command, returning its stderr in the error
+func (a *App) dockerCommand(ctx context.Context, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := a.dockerCmd(ctx, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("docker %s: %s: %w", args[0], strings.TrimSpace(stderr.String()), err)
+	}
+	return nil
+}
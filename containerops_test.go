@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeDocker records the docker commands run against the stack and fails the
+// containers in failing
+type fakeDocker struct {
+	mu       sync.Mutex
+	commands []string
+	failing  map[string]bool
+	inFlight int32
+	peak     int32
+}
+
+func (f *fakeDocker) run(ctx context.Context, args ...string) error {
+	n := atomic.AddInt32(&f.inFlight, 1)
+	defer atomic.AddInt32(&f.inFlight, -1)
+	for {
+		peak := atomic.LoadInt32(&f.peak)
+		if n <= peak || atomic.CompareAndSwapInt32(&f.peak, peak, n) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	f.mu.Lock()
+	f.commands = append(f.commands, strings.Join(args, " "))
+	f.mu.Unlock()
+
+	if id := args[len(args)-1]; f.failing[id] {
+		return errors.New("docker pause: cannot pause container " + id)
+	}
+	return nil
+}
+
+// newStackOperationsTestApp returns an app listing six running orchestrator
+// workers, a paused scanner and an exited scanner
+func newStackOperationsTestApp(docker *fakeDocker) *App {
+	app := NewApp()
+	app.backends.Docker.Available = true
+	app.runDocker = docker.run
+	app.listContainers = func(ctx context.Context) ([]ContainerInfo, error) {
+		containers := []ContainerInfo{
+			{ID: "s1", Name: "scanner-paused", State: ContainerPaused},
+			{ID: "s2", Name: "scanner-exited", State: "exited"},
+		}
+		for _, id := range []string{"o1", "o2", "o3", "o4", "o5", "o6"} {
+			containers = append(containers, ContainerInfo{ID: id, Name: "orchestrator-" + id, State: ContainerRunning})
+		}
+		return containers, nil
+	}
+	return app
+}
+
+func TestPauseStackReportsPartialFailure(t *testing.T) {
+	docker := &fakeDocker{failing: map[string]bool{"o2": true}}
+	app := newStackOperationsTestApp(docker)
+
+	report, err := app.PauseStack()
+	if err != nil {
+		t.Fatalf("PauseStack() error = %v", err)
+	}
+
+	// The failing container does not stop the other five
+	if got := strings.Join(report.Succeeded, " "); got != "orchestrator-o1 orchestrator-o3 orchestrator-o4 orchestrator-o5 orchestrator-o6" {
+		t.Errorf("Succeeded = %s", got)
+	}
+	if len(report.Failed) != 1 || report.Failed[0].Name != "orchestrator-o2" || !strings.Contains(report.Failed[0].Reason, "cannot pause") {
+		t.Errorf("Failed = %+v", report.Failed)
+	}
+	if len(report.Skipped) != 2 || report.Skipped[0].Reason != "container is exited" || report.Skipped[1].Reason != "container is paused" {
+		t.Errorf("Skipped = %+v", report.Skipped)
+	}
+	if len(docker.commands) != 6 {
+		t.Errorf("Ran %v, want a pause per running container", docker.commands)
+	}
+	if docker.peak > maxContainerOperations {
+		t.Errorf("%d commands ran at once, want at most %d", docker.peak, maxContainerOperations)
+	}
+}
+
+func TestUnpauseAndReloadStack(t *testing.T) {
+	docker := &fakeDocker{}
+	app := newStackOperationsTestApp(docker)
+
+	report, err := app.UnpauseStack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Succeeded) != 1 || report.Succeeded[0] != "scanner-paused" || len(report.Skipped) != 7 {
+		t.Errorf("Unpause report = %+v", report)
+	}
+
+	docker.commands = nil
+	report, err = app.ReloadStackConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Succeeded) != 6 || len(report.Failed) != 0 {
+		t.Errorf("Reload report = %+v", report)
+	}
+	for _, command := range docker.commands {
+		if !strings.HasPrefix(command, "kill --signal HUP ") {
+			t.Errorf("Ran %q, want a SIGHUP", command)
+		}
+	}
+}
+
+func TestStackOperationsWaitForDocker(t *testing.T) {
+	app := newStackOperationsTestApp(&fakeDocker{})
+	app.backends.Docker.Available = false
+
+	if _, err := app.PauseStack(); !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("PauseStack() error = %v, want ErrBackendUnavailable", err)
+	}
+}
+
+func TestStopStackUsesStopTimeout(t *testing.T) {
+	docker := &fakeDocker{}
+	app := newStackOperationsTestApp(docker)
+	app.config.DockerStack.StopTimeoutSeconds = 10
+
+	report, err := app.StopStack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Running and paused containers are stopped; the exited one is skipped
+	if len(report.Succeeded) != 7 || len(report.Skipped) != 1 || report.Skipped[0].Name != "scanner-exited" {
+		t.Errorf("Stop report = %+v", report)
+	}
+	for _, command := range docker.commands {
+		if !strings.HasPrefix(command, "stop --time 10 ") {
+			t.Errorf("Ran %q, want a stop with a 10 second timeout", command)
+		}
+	}
+}
+
+func TestStartStackStartsStoppedContainers(t *testing.T) {
+	docker := &fakeDocker{}
+	app := newStackOperationsTestApp(docker)
+
+	report, err := app.StartStack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Operation != "start" || len(report.Succeeded) != 1 || report.Succeeded[0] != "scanner-exited" {
+		t.Errorf("Start report = %+v", report)
+	}
+	if len(docker.commands) != 1 || docker.commands[0] != "start s2" {
+		t.Errorf("Ran %v, want the exited container started", docker.commands)
+	}
+}
+
+func TestStartStackCreatesMissingContainers(t *testing.T) {
+	docker := &fakeDocker{failing: map[string]bool{"ibkr/orchestrator:broken": true}}
+	app := newStackOperationsTestApp(docker)
+	app.listContainers = func(ctx context.Context) ([]ContainerInfo, error) { return nil, nil }
+	app.configPath = filepath.Join("testdata", "config.toml")
+	configDir, _ := filepath.Abs("testdata")
+
+	stack := &app.config.DockerStack
+	stack.Network = "trader"
+	stack.Containers = []StackContainerSpec{
+		{
+			Name:    "ibkr-scanner",
+			Image:   "ibkr/scanner:1.4",
+			Ports:   []string{"50051:50051"},
+			Volumes: []string{"scanner-cache:/app/cache"},
+			Env:     map[string]string{"LOG_FORMAT": "json", "CONFIG_PATH": "/app/config/config.toml"},
+		},
+		{Name: "ibkr-orchestrator", Image: "ibkr/orchestrator:broken"},
+	}
+
+	report, err := app.StartStack()
+	if err != nil {
+		t.Fatalf("StartStack() error = %v", err)
+	}
+	if report.Operation != "create" || len(report.Succeeded) != 1 || report.Succeeded[0] != "ibkr-scanner" {
+		t.Errorf("Succeeded = %v", report.Succeeded)
+	}
+	if len(report.Failed) != 1 || report.Failed[0].Name != "ibkr-orchestrator" {
+		t.Errorf("Failed = %+v", report.Failed)
+	}
+
+	var scanner string
+	for _, command := range docker.commands {
+		if strings.HasSuffix(command, "ibkr/scanner:1.4") {
+			scanner = command
+		}
+	}
+	want := "run --detach --name ibkr-scanner --label " + StackLabel + "=ibkr-scanner --network trader --publish 50051:50051" +
+		" --volume " + configDir + ":/app/config:ro --volume scanner-cache:/app/cache" +
+		" --env CONFIG_PATH=/app/config/config.toml --env LOG_FORMAT=json ibkr/scanner:1.4"
+	if scanner != want {
+		t.Errorf("Ran %q\nwant %q", scanner, want)
+	}
+}
+
+func TestStartStackWithoutContainersOrSpecs(t *testing.T) {
+	app := newStackOperationsTestApp(&fakeDocker{})
+	app.listContainers = func(ctx context.Context) ([]ContainerInfo, error) { return nil, nil }
+
+	if _, err := app.StartStack(); err == nil {
+		t.Error("Expected an error with nothing to start or create")
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Reasons a container was listed, reported in ContainerInfo.MatchedBy
+const (
+	MatchedByLabel = "label"
+	MatchedByName  = "name"
+	MatchedByImage = "image"
+)
+
+// defaultContainerNamePatterns list the trading stack's containers when the
+// [containers] section is absent
+var defaultContainerNamePatterns = []string{"orchestrator", "scanner", "ibkr-trader"}
+
+// ContainerInfo describes a Docker container of the trading stack
+type ContainerInfo struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	Image     string            `json:"image"`
+	State     string            `json:"state"`
+	Status    string            `json:"status"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	MatchedBy string            `json:"matchedBy"`
+	// MatchRule is the label selector or pattern that listed the container
+	MatchRule string `json:"matchRule"`
+	// LastReconciled is when the containers were last listed from Docker;
+	// Docker events have kept them current since
+	LastReconciled time.Time `json:"lastReconciled"`
+	// Health is the status of the image's healthcheck, "" without one
+	Health       string `json:"health,omitempty"`
+	RestartCount int    `json:"restartCount"`
+	// RestartsLastHour counts the restarts TraderAdmin saw in the last hour
+	RestartsLastHour int    `json:"restartsLastHour"`
+	RestartPolicy    string `json:"restartPolicy,omitempty"`
+	// ExitCode is the code of the container's last exit
+	ExitCode int `json:"exitCode"`
+	// UptimeSeconds is how long the container has been running, 0 when not
+	UptimeSeconds int64 `json:"uptimeSeconds"`
+}
+
+// containerMatcher decides which containers belong to the trading stack
+type containerMatcher struct {
+	labels  []labelSelector
+	names   []*regexp.Regexp
+	images  []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// labelSelector matches a label by key, and by value when one is given
+type labelSelector struct {
+	key      string
+	value    string
+	hasValue bool
+}
+
+// newContainerMatcher compiles the [containers] configuration, falling back to
+// the default name patterns when no selector or pattern is configured
+func newContainerMatcher(cfg Configuration) (*containerMatcher, error) {
+	c := cfg.Containers
+	namePatterns := c.NamePatterns
+	if len(c.Labels) == 0 && len(c.NamePatterns) == 0 && len(c.ImagePatterns) == 0 {
+		namePatterns = defaultContainerNamePatterns
+	}
+
+	m := &containerMatcher{}
+	for _, selector := range c.Labels {
+		key, value, hasValue := strings.Cut(selector, "=")
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return nil, fmt.Errorf("invalid container label selector %q", selector)
+		}
+		m.labels = append(m.labels, labelSelector{key: key, value: strings.TrimSpace(value), hasValue: hasValue})
+	}
+
+	var err error
+	if m.names, err = compilePatterns("name", namePatterns); err != nil {
+		return nil, err
+	}
+	if m.images, err = compilePatterns("image", c.ImagePatterns); err != nil {
+		return nil, err
+	}
+	if m.exclude, err = compilePatterns("exclude", c.ExcludePatterns); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// compilePatterns compiles regular expressions, naming the bad one on error
+func compilePatterns(kind string, patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid container %s pattern %q: %w", kind, pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// match reports whether a container is listed and which rule listed it.
+// Exclusions win, then label selectors, name patterns and image patterns.
+func (m *containerMatcher) match(container ContainerInfo) (reason, rule string, ok bool) {
+	for _, re := range m.exclude {
+		if re.MatchString(container.Name) {
+			return "", "", false
+		}
+	}
+
+	for _, selector := range m.labels {
+		value, found := container.Labels[selector.key]
+		if found && (!selector.hasValue || value == selector.value) {
+			rule := selector.key
+			if selector.hasValue {
+				rule += "=" + selector.value
+			}
+			return MatchedByLabel, rule, true
+		}
+	}
+	for _, re := range m.names {
+		if re.MatchString(container.Name) {
+			return MatchedByName, re.String(), true
+		}
+	}
+	for _, re := range m.images {
+		if re.MatchString(container.Image) {
+			return MatchedByImage, re.String(), true
+		}
+	}
+	return "", "", false
+}
+
+// GetContainers lists the trading stack's Docker containers sorted by name,
+// each with the rule that listed it and its health and restarts. While the
+// Docker event stream is connected they come from the container cache,
+// otherwise from Docker.
+func (a *App) GetContainers() ([]ContainerInfo, error) {
+	if err := a.requireDocker(); err != nil {
+		return nil, err
+	}
+
+	listed, reconciled, cached := a.containers.snapshot()
+	if !cached {
+		matcher, err := newContainerMatcher(a.config)
+		if err != nil {
+			return nil, err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		mark, started := a.containers.mark(), time.Now()
+		all, err := a.listContainers(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list containers: %w", err)
+		}
+
+		var matched []ContainerInfo
+		for _, container := range all {
+			reason, rule, ok := matcher.match(container)
+			if !ok {
+				continue
+			}
+			container.MatchedBy = reason
+			container.MatchRule = rule
+			matched = append(matched, container)
+		}
+		listed, reconciled = a.containers.reconcile(matched, mark, started), started
+	}
+
+	for i := range listed {
+		listed[i].LastReconciled = reconciled
+	}
+	a.inspectContainers(listed)
+	sort.Slice(listed, func(i, j int) bool { return listed[i].Name < listed[j].Name })
+	return listed, nil
+}
+
+// dockerPSEntry is a line of `docker ps --format '{{json .}}'`
+type dockerPSEntry struct {
+	ID     string `json:"ID"`
+	Names  string `json:"Names"`
+	Image  string `json:"Image"`
+	State  string `json:"State"`
+	Status string `json:"Status"`
+	Labels string `json:"Labels"`
+}
+
+// dockerPS lists every container, running or not, through the docker CLI
+func (a *App) dockerPS(ctx context.Context) ([]ContainerInfo, error) {
+	var stderr bytes.Buffer
+	cmd := a.dockerCmd(ctx, "ps", "--all", "--no-trunc", "--format", "{{json .}}")
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("docker ps: %s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+	return parseDockerPS(output)
+}
+
+// parseDockerPS decodes the JSON lines written by docker ps
+func parseDockerPS(output []byte) ([]ContainerInfo, error) {
+	var containers []ContainerInfo
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var entry dockerPSEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return nil, fmt.Errorf("failed to decode docker ps output: %w", err)
+		}
+
+		labels := make(map[string]string)
+		for _, label := range strings.Split(entry.Labels, ",") {
+			if key, value, _ := strings.Cut(label, "="); key != "" {
+				labels[key] = value
+			}
+		}
+
+		containers = append(containers, ContainerInfo{
+			ID:     entry.ID,
+			Name:   entry.Names,
+			Image:  entry.Image,
+			State:  entry.State,
+			Status: entry.Status,
+			Labels: labels,
+		})
+	}
+	return containers, scanner.Err()
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testContainers is the mocked `docker ps` output the discovery tests filter
+var testContainers = []ContainerInfo{
+	{Name: "trader-orchestrator-1", Image: "ibkr/orchestrator:latest", Labels: map[string]string{"com.docker.compose.project": "trader"}},
+	{Name: "trader-scanner-1", Image: "ibkr/scanner:latest", Labels: map[string]string{"com.docker.compose.project": "trader"}},
+	{Name: "renamed-gateway", Image: "ghcr.io/ibkr-trader/gateway:1.2"},
+	{Name: "document-scanner", Image: "paperless/scanner:2"},
+	{Name: "ibkr-trader-test", Image: "busybox"},
+	{Name: "postgres", Image: "postgres:16"},
+}
+
+// newContainersTestApp returns an app with Docker available and the mocked
+// container list
+func newContainersTestApp() *App {
+	app := NewApp()
+	app.backends.Docker.Available = true
+	app.listContainers = func(ctx context.Context) ([]ContainerInfo, error) {
+		return append([]ContainerInfo(nil), testContainers...), nil
+	}
+	return app
+}
+
+// listedBy maps each listed container's name to its match reason
+func listedBy(t *testing.T, app *App) map[string]string {
+	t.Helper()
+	containers, err := app.GetContainers()
+	if err != nil {
+		t.Fatalf("GetContainers() error = %v", err)
+	}
+	reasons := make(map[string]string, len(containers))
+	for _, c := range containers {
+		reasons[c.Name] = c.MatchedBy
+	}
+	return reasons
+}
+
+func assertListed(t *testing.T, got, want map[string]string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("Listed %v, want %v", got, want)
+		return
+	}
+	for name, reason := range want {
+		if got[name] != reason {
+			t.Errorf("%s matched by %q, want %q (listed %v)", name, got[name], reason, got)
+		}
+	}
+}
+
+func TestGetContainersDefaultsToNameHeuristics(t *testing.T) {
+	app := newContainersTestApp()
+
+	assertListed(t, listedBy(t, app), map[string]string{
+		"trader-orchestrator-1": MatchedByName,
+		"trader-scanner-1":      MatchedByName,
+		"document-scanner":      MatchedByName,
+		"ibkr-trader-test":      MatchedByName,
+	})
+}
+
+func TestGetContainersLabelSelector(t *testing.T) {
+	app := newContainersTestApp()
+	app.config.Containers.Labels = []string{"com.docker.compose.project=trader"}
+
+	// Configuring a selector replaces the default name heuristics
+	assertListed(t, listedBy(t, app), map[string]string{
+		"trader-orchestrator-1": MatchedByLabel,
+		"trader-scanner-1":      MatchedByLabel,
+	})
+
+	containers, _ := app.GetContainers()
+	if containers[0].MatchRule != "com.docker.compose.project=trader" {
+		t.Errorf("MatchRule = %q, want the selector", containers[0].MatchRule)
+	}
+}
+
+func TestGetContainersRegexPatterns(t *testing.T) {
+	app := newContainersTestApp()
+	app.config.Containers.NamePatterns = []string{`^trader-(orchestrator|scanner)-\d+$`}
+	app.config.Containers.ImagePatterns = []string{`ibkr-trader/`}
+
+	assertListed(t, listedBy(t, app), map[string]string{
+		"trader-orchestrator-1": MatchedByName,
+		"trader-scanner-1":      MatchedByName,
+		"renamed-gateway":       MatchedByImage,
+	})
+}
+
+func TestGetContainersExclusion(t *testing.T) {
+	app := newContainersTestApp()
+	app.config.Containers.ExcludePatterns = []string{`^document-`, `-test$`}
+
+	// Exclusions alone keep the default name patterns
+	assertListed(t, listedBy(t, app), map[string]string{
+		"trader-orchestrator-1": MatchedByName,
+		"trader-scanner-1":      MatchedByName,
+	})
+}
+
+func TestGetContainersRejectsInvalidPattern(t *testing.T) {
+	app := newContainersTestApp()
+	app.config.Containers.NamePatterns = []string{"scanner("}
+
+	if _, err := app.GetContainers(); err == nil || !strings.Contains(err.Error(), `"scanner("`) {
+		t.Errorf("GetContainers() error = %v, want one naming the pattern", err)
+	}
+}
+
+func TestGetContainersWaitsForDocker(t *testing.T) {
+	app := newContainersTestApp()
+	app.backends.Docker.Available = false
+
+	if _, err := app.GetContainers(); !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("GetContainers() error = %v, want ErrBackendUnavailable", err)
+	}
+}
+
+func TestParseDockerPS(t *testing.T) {
+	output := []byte(`{"ID":"abc","Names":"trader-scanner-1","Image":"ibkr/scanner","State":"running","Status":"Up 2 hours","Labels":"com.docker.compose.project=trader,com.docker.compose.service=scanner"}
+{"ID":"def","Names":"postgres","Image":"postgres:16","State":"exited","Status":"Exited (0)","Labels":""}
+`)
+
+	containers, err := parseDockerPS(output)
+	if err != nil {
+		t.Fatalf("parseDockerPS() error = %v", err)
+	}
+	if len(containers) != 2 {
+		t.Fatalf("Got %d containers, want 2", len(containers))
+	}
+	scanner := containers[0]
+	if scanner.ID != "abc" || scanner.State != "running" || scanner.Labels["com.docker.compose.service"] != "scanner" {
+		t.Errorf("Unexpected container %+v", scanner)
+	}
+	if len(containers[1].Labels) != 0 {
+		t.Errorf("Expected no labels, got %v", containers[1].Labels)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// managedDeploymentSelector selects the deployments of the trading stack
+const managedDeploymentSelector = "app=traderadmin"
+
+// restartedAtAnnotation is the pod template annotation whose change rolls a
+// deployment, as kubectl rollout restart sets it
+const restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+// defaultMaxReplicas bounds ScaleDeployment for the deployments missing from
+// Kubernetes.MaxReplicas, since two orchestrators would trade twice
+const defaultMaxReplicas = 1
+
+// deploymentTimeout bounds a listing, scaling or restart of deployments
+const deploymentTimeout = 30 * time.Second
+
+// Replica health of a ManagedDeployment
+const (
+	ReplicasHealthy   = "healthy"
+	ReplicasDegraded  = "degraded"  // some of the desired replicas are ready
+	ReplicasUnhealthy = "unhealthy" // none of the desired replicas is ready
+	ReplicasStopped   = "stopped"   // scaled to zero
+)
+
+// ManagedDeployment is a deployment of the trading stack, labeled
+// app=traderadmin, as the Kubernetes tab lists it
+type ManagedDeployment struct {
+	Name            string `json:"name"`
+	DesiredReplicas int32  `json:"desiredReplicas"`
+	ReadyReplicas   int32  `json:"readyReplicas"`
+	// MaxReplicas is the most ScaleDeployment accepts
+	MaxReplicas int    `json:"maxReplicas"`
+	ImageTag    string `json:"imageTag"`
+	// LastRestart is when the deployment was last rolled by a restart, or
+	// created when it never was
+	LastRestart time.Time `json:"lastRestart"`
+	Health      string    `json:"health"`
+}
+
+// Replicas formats the ready and desired replicas, as in "scanner 0/2"
+func (d ManagedDeployment) Replicas() string {
+	return fmt.Sprintf("%s %d/%d", d.Name, d.ReadyReplicas, d.DesiredReplicas)
+}
+
+// kubernetesNamespace returns the namespace of the trading stack's deployments
+func (a *App) kubernetesNamespace() string {
+	if namespace := a.config.Kubernetes.Namespace; namespace != "" {
+		return namespace
+	}
+	return "traderadmin"
+}
+
+// maxReplicas returns the most replicas deployment name may be scaled to
+func (a *App) maxReplicas(name string) int {
+	if max, ok := a.config.Kubernetes.MaxReplicas[name]; ok {
+		return max
+	}
+	return defaultMaxReplicas
+}
+
+// ListManagedDeployments returns the deployments labeled app=traderadmin in
+// the configured namespace, by name
+func (a *App) ListManagedDeployments() ([]ManagedDeployment, error) {
+	client, err := a.kubernetesClient()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), deploymentTimeout)
+	defer cancel()
+	return a.managedDeployments(ctx, client)
+}
+
+// managedDeployments lists the managed deployments with client
+func (a *App) managedDeployments(ctx context.Context, client kubernetes.Interface) ([]ManagedDeployment, error) {
+	list, err := client.AppsV1().Deployments(a.kubernetesNamespace()).List(ctx, metav1.ListOptions{LabelSelector: managedDeploymentSelector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %w", err)
+	}
+	deployments := make([]ManagedDeployment, 0, len(list.Items))
+	for i := range list.Items {
+		deployments = append(deployments, a.managedDeployment(&list.Items[i]))
+	}
+	return deployments, nil
+}
+
+// managedDeployment describes a deployment of the trading stack
+func (a *App) managedDeployment(deployment *appsv1.Deployment) ManagedDeployment {
+	managed := ManagedDeployment{
+		Name:          deployment.Name,
+		ReadyReplicas: deployment.Status.ReadyReplicas,
+		MaxReplicas:   a.maxReplicas(deployment.Name),
+		LastRestart:   deployment.CreationTimestamp.Time,
+	}
+	// Kubernetes defaults unset replicas to one
+	managed.DesiredReplicas = 1
+	if deployment.Spec.Replicas != nil {
+		managed.DesiredReplicas = *deployment.Spec.Replicas
+	}
+	if containers := deployment.Spec.Template.Spec.Containers; len(containers) > 0 {
+		managed.ImageTag = imageTag(containers[0].Image)
+	}
+	if restarted, err := time.Parse(time.RFC3339, deployment.Spec.Template.Annotations[restartedAtAnnotation]); err == nil {
+		managed.LastRestart = restarted
+	}
+	managed.Health = replicaHealth(managed.DesiredReplicas, managed.ReadyReplicas)
+	return managed
+}
+
+// replicaHealth rates a deployment by how many of its desired replicas are
+// ready
+func replicaHealth(desired, ready int32) string {
+	switch {
+	case desired == 0:
+		return ReplicasStopped
+	case ready >= desired:
+		return ReplicasHealthy
+	case ready > 0:
+		return ReplicasDegraded
+	default:
+		return ReplicasUnhealthy
+	}
+}
+
+// imageTag returns the tag or digest of an image reference, latest when it
+// has neither
+func imageTag(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		return image[i+1:]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[i+1:]
+	}
+	return "latest"
+}
+
+// ScaleDeployment sets the replicas of a managed deployment, between zero
+// and its Kubernetes.MaxReplicas entry, which defaults to one
+func (a *App) ScaleDeployment(name string, replicas int) (OperationReport, error) {
+	const operation = "scale"
+	if err := a.requireWritable("ScaleDeployment"); err != nil {
+		return newOperationReport(operation), err
+	}
+	if max := a.maxReplicas(name); replicas < 0 || replicas > max {
+		return newOperationReport(operation), fmt.Errorf("replicas of %s must be between 0 and %d, got %d", name, max, replicas)
+	}
+	return a.applyToDeployment(name, operation, fmt.Sprintf("scale deployment %s to %d replicas", name, replicas), func(ctx context.Context, client kubernetes.Interface) error {
+		deployments := client.AppsV1().Deployments(a.kubernetesNamespace())
+		scale, err := deployments.GetScale(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		log.Info().Str("deployment", name).Int32("from", scale.Spec.Replicas).Int("to", replicas).Msg("Scaling deployment")
+		scale.Spec.Replicas = int32(replicas)
+		_, err = deployments.UpdateScale(ctx, name, scale, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// RolloutRestartDeployment replaces the pods of a managed deployment, as
+// kubectl rollout restart does, by stamping the time on its pod template
+func (a *App) RolloutRestartDeployment(name string) (OperationReport, error) {
+	const operation = "rollout restart"
+	if err := a.requireWritable("RolloutRestartDeployment"); err != nil {
+		return newOperationReport(operation), err
+	}
+	return a.applyToDeployment(name, operation, "restart deployment "+name, func(ctx context.Context, client kubernetes.Interface) error {
+		patch := fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{%q:%q}}}}}`, restartedAtAnnotation, time.Now().UTC().Format(time.RFC3339))
+		_, err := client.AppsV1().Deployments(a.kubernetesNamespace()).Patch(ctx, name, types.StrategicMergePatchType, []byte(patch), metav1.PatchOptions{})
+		return err
+	})
+}
+
+// applyToDeployment runs change, which what describes, on the managed
+// deployment name, refusing deployments outside the stack. In dry-run mode
+// it is only reported.
+func (a *App) applyToDeployment(name, operation, what string, change func(context.Context, kubernetes.Interface) error) (OperationReport, error) {
+	exec := a.executor(operation)
+	report := exec.report()
+	client, err := a.kubernetesClient()
+	if err != nil {
+		return report, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), deploymentTimeout)
+	defer cancel()
+
+	deployment, err := client.AppsV1().Deployments(a.kubernetesNamespace()).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return report, fmt.Errorf("failed to get deployment %s: %w", name, err)
+	}
+	if deployment.Labels["app"] != "traderadmin" {
+		return report, fmt.Errorf("deployment %s is not part of the trading stack", name)
+	}
+
+	if err := exec.run(what, func() error { return change(ctx, client) }); err != nil {
+		log.Error().Err(err).Str("operation", operation).Str("deployment", name).Msg("Deployment operation failed")
+		report.Failed = append(report.Failed, ContainerOutcome{Name: name, Reason: err.Error()})
+	} else {
+		report.Succeeded = append(report.Succeeded, name)
+	}
+	exec.finish(&report)
+	logReport(report)
+	return report, nil
+}
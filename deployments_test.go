@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// testDeployment is a deployment in the traderadmin namespace with desired
+// and ready replicas, labeled as part of the stack when managed
+func testDeployment(name, image string, managed bool, desired, ready int32) *appsv1.Deployment {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "traderadmin"},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &desired,
+			Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: name, Image: image}}}},
+		},
+		Status: appsv1.DeploymentStatus{ReadyReplicas: ready},
+	}
+	if managed {
+		deployment.Labels = map[string]string{"app": "traderadmin"}
+	}
+	return deployment
+}
+
+// newDeploymentsTestApp returns an app managing the deployments on a fake
+// clientset
+func newDeploymentsTestApp(deployments ...*appsv1.Deployment) (*App, *fake.Clientset) {
+	app := NewApp()
+	app.config.Kubernetes.Namespace = "traderadmin"
+	app.config.Kubernetes.MaxReplicas = map[string]int{"scanner": 3}
+	client := fake.NewSimpleClientset()
+	for _, deployment := range deployments {
+		client.Tracker().Add(deployment)
+	}
+	app.k8s = &kubernetesClients{typed: client}
+	return app, client
+}
+
+func TestListManagedDeployments(t *testing.T) {
+	orchestrator := testDeployment("orchestrator", "ghcr.io/trustdan/orchestrator:v1.4.2", true, 1, 1)
+	restartedAt := time.Date(2024, 7, 2, 14, 0, 0, 0, time.UTC)
+	orchestrator.Spec.Template.Annotations = map[string]string{restartedAtAnnotation: restartedAt.Format(time.RFC3339)}
+	app, client := newDeploymentsTestApp(
+		orchestrator,
+		testDeployment("scanner", "registry:5000/scanner", true, 2, 0),
+		testDeployment("grafana", "grafana/grafana:10.0.0", false, 1, 1),
+	)
+
+	deployments, err := app.ListManagedDeployments()
+	if err != nil {
+		t.Fatalf("ListManagedDeployments() error = %v", err)
+	}
+	if len(deployments) != 2 {
+		t.Fatalf("Deployments = %+v, want the orchestrator and scanner only", deployments)
+	}
+	if got := deployments[0]; got.ImageTag != "v1.4.2" || !got.LastRestart.Equal(restartedAt) || got.Health != ReplicasHealthy || got.MaxReplicas != 1 {
+		t.Errorf("Orchestrator = %+v", got)
+	}
+	if got := deployments[1]; got.ImageTag != "latest" || got.Health != ReplicasUnhealthy || got.MaxReplicas != 3 || got.Replicas() != "scanner 0/2" {
+		t.Errorf("Scanner = %+v", got)
+	}
+
+	// The status collector reports the same replicas
+	app.updateServicesStatus(client)
+	if services := app.status.Services; len(services) != 2 || services[1].Health != ReplicasUnhealthy || services[1].Message != "scanner 0/2 replicas ready" {
+		t.Errorf("Services = %+v, want the scanner unhealthy at 0/2", services)
+	}
+}
+
+func TestScaleDeployment(t *testing.T) {
+	app, client := newDeploymentsTestApp(
+		testDeployment("scanner", "scanner:v1", true, 1, 1),
+		testDeployment("orchestrator", "orchestrator:v1", true, 1, 1),
+		testDeployment("grafana", "grafana:10", false, 1, 1),
+	)
+	replicas := map[string]int32{"scanner": 1, "orchestrator": 1, "grafana": 1}
+	scaledDeployments(client, replicas)
+
+	report, err := app.ScaleDeployment("scanner", 3)
+	if err != nil || len(report.Succeeded) != 1 || replicas["scanner"] != 3 {
+		t.Fatalf("ScaleDeployment(scanner, 3) = %+v, %v; replicas %d", report, err, replicas["scanner"])
+	}
+
+	// Beyond the configured maximum, or the default of one, nothing changes
+	for name, n := range map[string]int{"scanner": 4, "orchestrator": 2} {
+		if _, err := app.ScaleDeployment(name, n); err == nil || !strings.Contains(err.Error(), "must be between 0") {
+			t.Errorf("ScaleDeployment(%s, %d) error = %v, want the max-replica guard", name, n, err)
+		}
+	}
+	if _, err := app.ScaleDeployment("scanner", -1); err == nil {
+		t.Error("ScaleDeployment(scanner, -1) succeeded")
+	}
+	if _, err := app.ScaleDeployment("grafana", 0); err == nil || !strings.Contains(err.Error(), "not part of the trading stack") {
+		t.Errorf("ScaleDeployment(grafana) error = %v, want it refused", err)
+	}
+	if replicas["scanner"] != 3 || replicas["orchestrator"] != 1 || replicas["grafana"] != 1 {
+		t.Errorf("Replicas = %v after refused scales", replicas)
+	}
+
+	// Dry-run mode only reports the scale
+	app.SetDryRun(true)
+	report, err = app.ScaleDeployment("scanner", 0)
+	if err != nil || !report.DryRun || len(report.Would) != 1 || replicas["scanner"] != 3 {
+		t.Errorf("Dry-run ScaleDeployment() = %+v, %v; replicas %d", report, err, replicas["scanner"])
+	}
+}
+
+func TestRolloutRestartDeployment(t *testing.T) {
+	app, client := newDeploymentsTestApp(testDeployment("scanner", "scanner:v1", true, 2, 2))
+
+	app.SetDryRun(true)
+	if report, err := app.RolloutRestartDeployment("scanner"); err != nil || len(report.Would) != 1 {
+		t.Fatalf("Dry-run RolloutRestartDeployment() = %+v, %v", report, err)
+	}
+	if deployments, _ := app.ListManagedDeployments(); !deployments[0].LastRestart.IsZero() {
+		t.Errorf("Dry run restarted the scanner at %v", deployments[0].LastRestart)
+	}
+
+	app.SetDryRun(false)
+	before := time.Now().Add(-time.Second)
+	report, err := app.RolloutRestartDeployment("scanner")
+	if err != nil || len(report.Succeeded) != 1 {
+		t.Fatalf("RolloutRestartDeployment() = %+v, %v", report, err)
+	}
+	deployment, err := client.AppsV1().Deployments("traderadmin").Get(context.Background(), "scanner", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	restartedAt, err := time.Parse(time.RFC3339, deployment.Spec.Template.Annotations[restartedAtAnnotation])
+	if err != nil || restartedAt.Before(before) {
+		t.Errorf("Restart annotation = %q, want the current time", deployment.Spec.Template.Annotations[restartedAtAnnotation])
+	}
+	if len(deployment.Spec.Template.Spec.Containers) != 1 {
+		t.Errorf("Patch replaced the pod template: %+v", deployment.Spec.Template)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// dockerEnvironment are the variables the docker CLI reads its daemon
+// connection from; a configured host replaces all of them
+var dockerEnvironment = []string{"DOCKER_HOST", "DOCKER_CONTEXT", "DOCKER_TLS_VERIFY", "DOCKER_CERT_PATH", "DOCKER_API_VERSION"}
+
+// dockerTLSFiles must be in DockerSettings.TLSCertPath
+var dockerTLSFiles = []string{"ca.pem", "cert.pem", "key.pem"}
+
+// dockerClient runs the docker CLI against one daemon. The CLI reads the
+// host, TLS certificates and API version from its environment, so a client
+// is the environment of its commands.
+type dockerClient struct {
+	// host is the configured daemon, or "" for the CLI's default
+	host string
+	// env is nil to inherit TraderAdmin's environment
+	env []string
+}
+
+// DockerConnectionInfo describes the daemon TestDockerConnection reached.
+// APIVersion is the version the CLI negotiated with the daemon.
+type DockerConnectionInfo struct {
+	Host             string `json:"host"`
+	APIVersion       string `json:"apiVersion"`
+	ServerVersion    string `json:"serverVersion"`
+	ServerAPIVersion string `json:"serverApiVersion"`
+	MinAPIVersion    string `json:"minApiVersion"`
+	OS               string `json:"os"`
+	Arch             string `json:"arch"`
+	KernelVersion    string `json:"kernelVersion"`
+}
+
+// newDockerClient returns a client for the [docker] settings. Without a host
+// or API version, commands inherit DOCKER_HOST and the other variables from
+// the environment as before.
+func newDockerClient(settings DockerSettings) (*dockerClient, error) {
+	if settings.Host == "" && settings.APIVersion == "" {
+		return &dockerClient{}, nil
+	}
+
+	replaced := []string{"DOCKER_API_VERSION"}
+	if settings.Host != "" {
+		replaced = dockerEnvironment
+	}
+	env := make([]string, 0, len(os.Environ())+4)
+	for _, e := range os.Environ() {
+		name, _, _ := strings.Cut(e, "=")
+		if !slices.Contains(replaced, name) {
+			env = append(env, e)
+		}
+	}
+
+	if settings.Host != "" {
+		env = append(env, "DOCKER_HOST="+settings.Host)
+	}
+	if settings.Host != "" && settings.TLSCertPath != "" {
+		for _, name := range dockerTLSFiles {
+			if _, err := os.Stat(filepath.Join(settings.TLSCertPath, name)); err != nil {
+				return nil, fmt.Errorf("docker TLS certificates: %w", err)
+			}
+		}
+		env = append(env, "DOCKER_TLS_VERIFY=1", "DOCKER_CERT_PATH="+settings.TLSCertPath)
+	}
+	if settings.APIVersion != "" {
+		env = append(env, "DOCKER_API_VERSION="+settings.APIVersion)
+	}
+	return &dockerClient{host: settings.Host, env: env}, nil
+}
+
+// command returns the docker CLI command for args
+func (c *dockerClient) command(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Env = c.env
+	return cmd
+}
+
+// dockerCmd returns the docker CLI command for args against the current
+// Docker host. Commands already running keep the host they started with.
+func (a *App) dockerCmd(ctx context.Context, args ...string) *exec.Cmd {
+	a.dockerMu.RLock()
+	client := a.docker
+	a.dockerMu.RUnlock()
+	if client == nil {
+		client = &dockerClient{}
+	}
+	return client.command(ctx, args...)
+}
+
+// configureDocker builds the Docker client for the [docker] settings. When
+// they are invalid, the current client is kept or, on startup, the
+// environment is used. Replacing a client reconnects to Docker.
+func (a *App) configureDocker() {
+	client, err := a.newDockerClient(a.config.Docker)
+	if err != nil {
+		log.Error().Err(err).Str("host", a.config.Docker.Host).Msg("Invalid Docker settings")
+		a.dockerMu.RLock()
+		configured := a.docker != nil
+		a.dockerMu.RUnlock()
+		if configured {
+			return
+		}
+		client = &dockerClient{}
+	}
+
+	a.dockerMu.Lock()
+	previous := a.docker
+	a.docker = client
+	a.dockerMu.Unlock()
+
+	if previous != nil {
+		log.Info().Str("host", client.host).Msg("Docker host changed, reconnecting")
+		a.containers.restart()
+		a.rediscoverDocker()
+	}
+}
+
+// TestDockerConnection asks the configured Docker host for its version
+func (a *App) TestDockerConnection() (DockerConnectionInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dockerPingTimeout)
+	defer cancel()
+
+	output, err := a.dockerOutput(ctx, "version", "--format", "{{json .}}")
+	if err != nil {
+		return DockerConnectionInfo{}, fmt.Errorf("docker daemon not reachable: %w", err)
+	}
+	var version struct {
+		Client struct {
+			APIVersion string `json:"ApiVersion"`
+		} `json:"Client"`
+		Server *struct {
+			Version       string `json:"Version"`
+			APIVersion    string `json:"ApiVersion"`
+			MinAPIVersion string `json:"MinAPIVersion"`
+			Os            string `json:"Os"`
+			Arch          string `json:"Arch"`
+			KernelVersion string `json:"KernelVersion"`
+		} `json:"Server"`
+	}
+	if err := json.Unmarshal(output, &version); err != nil {
+		return DockerConnectionInfo{}, fmt.Errorf("failed to decode docker version: %w", err)
+	}
+	if version.Server == nil {
+		return DockerConnectionInfo{}, fmt.Errorf("docker daemon not reachable")
+	}
+
+	host := a.config.Docker.Host
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
+	}
+	if host == "" {
+		host = "default"
+	}
+	return DockerConnectionInfo{
+		Host:             host,
+		APIVersion:       version.Client.APIVersion,
+		ServerVersion:    version.Server.Version,
+		ServerAPIVersion: version.Server.APIVersion,
+		MinAPIVersion:    version.Server.MinAPIVersion,
+		OS:               version.Server.Os,
+		Arch:             version.Server.Arch,
+		KernelVersion:    version.Server.KernelVersion,
+	}, nil
+}
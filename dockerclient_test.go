@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestNewDockerClientFromEnvironment(t *testing.T) {
+	client, err := newDockerClient(DockerSettings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.env != nil {
+		t.Errorf("Env = %v, want the inherited environment", client.env)
+	}
+
+	// Pinning only the API version keeps the rest of the environment
+	t.Setenv("DOCKER_HOST", "tcp://wsl:2375")
+	t.Setenv("DOCKER_API_VERSION", "1.41")
+	client, err = newDockerClient(DockerSettings{APIVersion: "1.43"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(client.env, "DOCKER_HOST=tcp://wsl:2375") || !slices.Contains(client.env, "DOCKER_API_VERSION=1.43") ||
+		slices.Contains(client.env, "DOCKER_API_VERSION=1.41") {
+		t.Errorf("Env = %v", client.env)
+	}
+}
+
+func TestNewDockerClientFromSettings(t *testing.T) {
+	t.Setenv("DOCKER_HOST", "unix:///var/run/docker.sock")
+	t.Setenv("DOCKER_CONTEXT", "desktop-linux")
+	certs := t.TempDir()
+	for _, name := range dockerTLSFiles {
+		if err := os.WriteFile(filepath.Join(certs, name), []byte("pem"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client, err := newDockerClient(DockerSettings{Host: "tcp://docker.lan:2376", TLSCertPath: certs, APIVersion: "1.43"})
+	if err != nil {
+		t.Fatalf("newDockerClient() error = %v", err)
+	}
+	for _, want := range []string{"DOCKER_HOST=tcp://docker.lan:2376", "DOCKER_TLS_VERIFY=1", "DOCKER_CERT_PATH=" + certs, "DOCKER_API_VERSION=1.43"} {
+		if !slices.Contains(client.env, want) {
+			t.Errorf("Env is missing %s", want)
+		}
+	}
+	for _, stale := range []string{"DOCKER_HOST=unix:///var/run/docker.sock", "DOCKER_CONTEXT=desktop-linux"} {
+		if slices.Contains(client.env, stale) {
+			t.Errorf("Env keeps %s", stale)
+		}
+	}
+
+	if _, err := newDockerClient(DockerSettings{Host: "tcp://docker.lan:2376", TLSCertPath: t.TempDir()}); err == nil {
+		t.Error("Expected an error without the TLS certificates")
+	}
+}
+
+func TestDockerHostHotSwap(t *testing.T) {
+	app := NewApp()
+	var built []string
+	app.newDockerClient = func(settings DockerSettings) (*dockerClient, error) {
+		if settings.Host == "tcp://broken:2375" {
+			return nil, errors.New("docker TLS certificates: no such file")
+		}
+		built = append(built, settings.Host)
+		return &dockerClient{host: settings.Host}, nil
+	}
+
+	// The first configuration builds the client
+	config := app.config
+	config.Docker.Host = "npipe:////./pipe/docker_engine"
+	app.setConfig(config)
+	app.backends.Docker.Available = true
+	if app.docker == nil || app.docker.host != "npipe:////./pipe/docker_engine" {
+		t.Fatalf("Client = %+v", app.docker)
+	}
+
+	// Other settings leave the client alone
+	config.General.LogLevel = "DEBUG"
+	app.setConfig(config)
+	if len(built) != 1 {
+		t.Errorf("Built %v, want one client", built)
+	}
+
+	// A new host swaps the client and reconnects
+	config.Docker.Host = "tcp://wsl:2375"
+	app.setConfig(config)
+	if app.docker.host != "tcp://wsl:2375" || len(built) != 2 {
+		t.Errorf("Client = %+v after building %v", app.docker, built)
+	}
+	if err := app.requireDocker(); !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("requireDocker() error = %v, want Docker rediscovered", err)
+	}
+
+	// Invalid settings keep the current client
+	config.Docker.Host = "tcp://broken:2375"
+	app.setConfig(config)
+	if app.docker.host != "tcp://wsl:2375" {
+		t.Errorf("Client = %+v, want the previous one kept", app.docker)
+	}
+}
+
+func TestTestDockerConnection(t *testing.T) {
+	app := NewApp()
+	app.config.Docker.Host = "tcp://wsl:2375"
+	app.streamDocker = func(ctx context.Context, onLine func(string), args ...string) error {
+		onLine(`{"Client":{"Version":"26.1.1","ApiVersion":"1.43"},"Server":{"Version":"24.0.7","ApiVersion":"1.43","MinAPIVersion":"1.12","Os":"linux","Arch":"amd64","KernelVersion":"5.15.133.1-microsoft-standard-WSL2"}}`)
+		return nil
+	}
+
+	info, err := app.TestDockerConnection()
+	if err != nil {
+		t.Fatalf("TestDockerConnection() error = %v", err)
+	}
+	want := DockerConnectionInfo{
+		Host: "tcp://wsl:2375", APIVersion: "1.43", ServerVersion: "24.0.7", ServerAPIVersion: "1.43",
+		MinAPIVersion: "1.12", OS: "linux", Arch: "amd64", KernelVersion: "5.15.133.1-microsoft-standard-WSL2",
+	}
+	if info != want {
+		t.Errorf("TestDockerConnection() = %+v, want %+v", info, want)
+	}
+
+	app.streamDocker = func(ctx context.Context, onLine func(string), args ...string) error {
+		return errors.New("docker version: error during connect: exit status 1")
+	}
+	if _, err := app.TestDockerConnection(); err == nil {
+		t.Error("Expected an error for an unreachable daemon")
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DryRunChangedEvent is emitted with the new IsDryRun value whenever dry-run
+// mode is turned on or off
+const DryRunChangedEvent = "dryrun:changed"
+
+// ErrDryRun is returned by the guarded methods that cannot simulate their
+// effects while dry-run mode is on
+var ErrDryRun = errors.New("not available in dry-run mode")
+
+// dryRunMethods are the guarded methods that run their side effects through a
+// commandExecutor, and so only report what they would do in dry-run mode
+var dryRunMethods = map[string]bool{
+	"EmergencyStop":               true,
+	"PauseStack":                  true,
+	"PlaceSpreadOrder":            true,
+	"PullLatestImages":            true,
+	"ReloadStackConfig":           true,
+	"RolloutRestartDeployment":    true,
+	"SaveConfigurationAndRestart": true,
+	"ScaleDeployment":             true,
+	"StartStack":                  true,
+	"StopStack":                   true,
+	"UnpauseStack":                true,
+}
+
+// IsDryRun reports whether TraderAdmin is in dry-run mode, in which the
+// methods changing the trading stack, orders or files only report what they
+// would do
+func (a *App) IsDryRun() bool {
+	return a.config.General.DryRun
+}
+
+// SetDryRun turns dry-run mode on or off. Saving the configuration keeps the
+// setting.
+func (a *App) SetDryRun(enabled bool) {
+	if enabled == a.IsDryRun() {
+		return
+	}
+	a.config.General.DryRun = enabled
+	log.Warn().Bool("dry_run", enabled).Msg("Dry-run mode changed")
+	a.emitEvent(DryRunChangedEvent, enabled)
+}
+
+// requireLive returns ErrDryRun for operation in dry-run mode unless it is
+// one of dryRunMethods
+func (a *App) requireLive(operation string) error {
+	if !a.IsDryRun() || dryRunMethods[operation] {
+		return nil
+	}
+	log.Warn().Str("operation", operation).Msg("Rejected in dry-run mode")
+	return fmt.Errorf("%s: %w", operation, ErrDryRun)
+}
+
+// commandExecutor carries out the side effects of an operation: the docker,
+// Kubernetes, IBKR and file changes. In dry-run mode it logs each one as a
+// "would" entry and records it for the report instead, so that the rest of
+// the operation runs unchanged.
+type commandExecutor struct {
+	operation string
+	dryRun    bool
+
+	mu    sync.Mutex
+	would []string
+
+	// onFinish is given the finished report, when set
+	onFinish func(OperationReport)
+}
+
+// executor returns the executor of an operation in the current mode, which
+// records its finished report in the notification center
+func (a *App) executor(operation string) *commandExecutor {
+	return &commandExecutor{operation: operation, dryRun: a.IsDryRun(), onFinish: a.notifyOperation}
+}
+
+// run calls action, which what describes, or only logs and records what in
+// dry-run mode. It is safe to call from concurrent goroutines.
+func (e *commandExecutor) run(what string, action func() error) error {
+	if !e.dryRun {
+		return action()
+	}
+	log.Info().Bool("dry_run", true).Str("operation", e.operation).Str("would", what).Msg("Dry run, not executed")
+	e.mu.Lock()
+	e.would = append(e.would, what)
+	e.mu.Unlock()
+	return nil
+}
+
+// report returns an empty report of the operation, marked with the mode
+func (e *commandExecutor) report() OperationReport {
+	report := newOperationReport(e.operation)
+	report.DryRun = e.dryRun
+	return report
+}
+
+// finish adds what the operation would have done to its report, which is
+// then complete
+func (e *commandExecutor) finish(report *OperationReport) {
+	report.Would = append(report.Would, e.recorded()...)
+	if e.onFinish != nil {
+		e.onFinish(*report)
+	}
+}
+
+// recorded returns what the operation would have done so far
+func (e *commandExecutor) recorded() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return slices.Clone(e.would)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"traderadmin/backend/ibkr"
+)
+
+// checkDryRunReport fails unless report is marked dry-run and records what
+// would have been done
+func checkDryRunReport(t *testing.T, report OperationReport, wantWould int) {
+	t.Helper()
+	if !report.DryRun || len(report.Would) != wantWould {
+		t.Errorf("Report = %+v, want a dry run with %d would entries", report, wantWould)
+	}
+}
+
+func TestDryRunRunsNoDockerCommands(t *testing.T) {
+	tests := []struct {
+		name          string
+		operation     func(app *App) (OperationReport, error)
+		wantSucceeded int
+	}{
+		{"PauseStack", (*App).PauseStack, 6},
+		{"UnpauseStack", (*App).UnpauseStack, 1},
+		{"StopStack", (*App).StopStack, 7},
+		{"StartStack", (*App).StartStack, 1},
+		{"ReloadStackConfig", (*App).ReloadStackConfig, 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docker := &fakeDocker{}
+			app := newStackOperationsTestApp(docker)
+			app.SetDryRun(true)
+
+			report, err := tt.operation(app)
+			if err != nil {
+				t.Fatalf("%s() error = %v", tt.name, err)
+			}
+			if len(docker.commands) != 0 {
+				t.Errorf("Docker commands %v run in dry-run mode", docker.commands)
+			}
+			// The read side still runs: eligible containers are reported
+			if len(report.Succeeded) != tt.wantSucceeded {
+				t.Errorf("Succeeded = %v, want %d containers", report.Succeeded, tt.wantSucceeded)
+			}
+			checkDryRunReport(t, report, tt.wantSucceeded)
+		})
+	}
+}
+
+func TestDryRunSaveConfigurationAndRestart(t *testing.T) {
+	docker := &fakeDocker{}
+	app := newStackOperationsTestApp(docker)
+	app.configPath = filepath.Join(t.TempDir(), "config.toml")
+	original := []byte("config_version = 3\n")
+	if err := os.WriteFile(app.configPath, original, 0644); err != nil {
+		t.Fatal(err)
+	}
+	app.SetDryRun(true)
+
+	config := validConfig()
+	config.IBKRConnection.Accounts[0].AccountCode = "DU999999"
+	data, _ := json.Marshal(config)
+	var configData map[string]interface{}
+	if err := json.Unmarshal(data, &configData); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := app.SaveConfigurationAndRestart(configData)
+	if err != nil {
+		t.Fatalf("SaveConfigurationAndRestart() error = %v", err)
+	}
+	// Pause, backup, save and resume are only logged
+	checkDryRunReport(t, report, 4)
+	if content, _ := os.ReadFile(app.configPath); string(content) != string(original) {
+		t.Errorf("Config file rewritten in dry-run mode:\n%s", content)
+	}
+	if backups, _ := filepath.Glob(app.configPath + ".bak.*"); len(backups) != 0 {
+		t.Errorf("Backups %v written in dry-run mode", backups)
+	}
+	if app.config.activeIBKRAccount().AccountCode == "DU999999" || app.servicesPaused {
+		t.Error("Configuration or services changed in dry-run mode")
+	}
+	if len(docker.commands) != 0 {
+		t.Errorf("Docker commands %v run in dry-run mode", docker.commands)
+	}
+
+	// Validation is part of the read side and still rejects
+	configData["IBKRConnection"].(map[string]interface{})["Accounts"].([]interface{})[0].(map[string]interface{})["Port"] = 0
+	if _, err := app.SaveConfigurationAndRestart(configData); err == nil {
+		t.Error("Expected an invalid configuration to be rejected in dry-run mode")
+	}
+}
+
+func TestDryRunPlaceSpreadOrder(t *testing.T) {
+	app, client, events := orderTestApp(ibkr.OrderState{Status: ibkr.OrderFilled, Filled: 1})
+	app.SetDryRun(true)
+
+	report, err := app.PlaceSpreadOrder(testSpread())
+	if err != nil {
+		t.Fatalf("PlaceSpreadOrder() error = %v", err)
+	}
+	if len(client.placed) != 0 || len(*events) != 0 || report.OrderID != 0 {
+		t.Errorf("Placed %v with events %v in dry-run mode", client.placed, *events)
+	}
+	checkDryRunReport(t, report, 1)
+
+	// The risk checks still run
+	client.whatIf.InitMarginChange = 1500
+	if _, err := app.PlaceSpreadOrder(testSpread()); !errors.Is(err, ErrRiskLimit) {
+		t.Errorf("PlaceSpreadOrder() error = %v, want ErrRiskLimit in dry-run mode", err)
+	}
+}
+
+func TestDryRunClearCache(t *testing.T) {
+	app := NewApp()
+	app.configPath = filepath.Join(t.TempDir(), "config.toml")
+	app.optionChains.put(ibkr.OptionChain{Symbol: "SPY", FetchedAt: time.Now()})
+	app.optionChains.put(ibkr.OptionChain{Symbol: "QQQ", FetchedAt: time.Now()})
+
+	app.SetDryRun(true)
+	report, err := app.ClearCache(false, 0)
+	if err != nil {
+		t.Fatalf("ClearCache() error = %v", err)
+	}
+	checkDryRunReport(t, report.OperationReport, 1)
+	if got := app.optionChains.symbols(); len(got) != 2 {
+		t.Errorf("Cached chains %v, want them kept in dry-run mode", got)
+	}
+
+	app.SetDryRun(false)
+	report, _ = app.ClearCache(false, 0)
+	if report.DryRun || len(report.Would) != 0 || len(report.Succeeded) != 2 || report.Succeeded[0] != "QQQ" {
+		t.Errorf("Report = %+v, want QQQ and SPY dropped", report)
+	}
+	if got := app.optionChains.symbols(); len(got) != 0 {
+		t.Errorf("Cached chains %v after clearing", got)
+	}
+}
+
+func TestDryRunRejectsOperationsItCannotSimulate(t *testing.T) {
+	docker := &fakeDocker{}
+	app := newStackOperationsTestApp(docker)
+	app.SetDryRun(true)
+
+	for name := range guardedMethods {
+		if dryRunMethods[name] {
+			continue
+		}
+		if err := callBound(t, app, name); !errors.Is(err, ErrDryRun) {
+			t.Errorf("%s() error = %v, want ErrDryRun", name, err)
+		}
+	}
+	if len(docker.commands) != 0 {
+		t.Errorf("Docker commands %v run in dry-run mode", docker.commands)
+	}
+}
+
+func TestSetDryRunEmitsChangesAndStatus(t *testing.T) {
+	app := NewApp()
+	var events []bool
+	app.emit = func(name string, data ...interface{}) {
+		if name == DryRunChangedEvent {
+			events = append(events, data[0].(bool))
+		}
+	}
+
+	app.SetDryRun(true)
+	app.SetDryRun(true)
+	if !app.IsDryRun() || !app.GetStatus().DryRun {
+		t.Error("Status does not show dry-run mode")
+	}
+
+	// Loading a configuration without dry_run turns it off
+	config := app.config
+	config.General.DryRun = false
+	app.setConfig(config)
+
+	if len(events) != 2 || !events[0] || events[1] {
+		t.Errorf("Events = %v, want a flip on then off", events)
+	}
+	report, _ := app.PauseStack()
+	if report.DryRun {
+		t.Error("Reports should not be marked dry-run once it is off")
+	}
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"traderadmin/backend/ibkr"
+	"traderadmin/backend/notifications"
+	"traderadmin/backend/risk"
+)
+
+// EmergencyStopEvent is emitted with the EmergencyStopReport of each
+// emergency stop, including those the drawdown triggers
+const EmergencyStopEvent = "emergency:stop"
+
+// Statuses of an EmergencyStopStep
+const (
+	StepSucceeded = "succeeded"
+	StepFailed    = "failed"
+	StepSkipped   = "skipped"
+)
+
+// defaultEmergencyCooldown is the wait between automatic stops while
+// EmergencyStop.CooldownMinutes is unset
+const defaultEmergencyCooldown = time.Hour
+
+// emergencyPriceFactor prices closing orders at the natural price, the side
+// of the spread that fills at once
+const emergencyPriceFactor = 1.0
+
+// EmergencyStopStep is the outcome of one step of an emergency stop
+type EmergencyStopStep struct {
+	Name       string    `json:"name"`
+	Status     string    `json:"status"`
+	Detail     string    `json:"detail,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	DurationMs int64     `json:"durationMs"`
+}
+
+// EmergencyStopReport reports the steps of an emergency stop in the order
+// they ran; a failed step does not keep the later ones from running
+type EmergencyStopReport struct {
+	Reason string              `json:"reason"`
+	DryRun bool                `json:"dryRun"`
+	Would  []string            `json:"would"`
+	Steps  []EmergencyStopStep `json:"steps"`
+}
+
+// Failed reports whether any step failed
+func (r EmergencyStopReport) Failed() bool {
+	for _, step := range r.Steps {
+		if step.Status == StepFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// EmergencyStop halts trading: it pauses the orchestrator and scanner, cancels
+// the active account's open orders and, with EmergencyStop.ClosePositions,
+// places orders closing its open spread positions at the natural price. Each
+// step runs even when an earlier one fails. Stopping again is safe: the
+// closing orders placed are neither cancelled nor placed twice while they
+// work.
+func (a *App) EmergencyStop() (EmergencyStopReport, error) {
+	if err := a.requireWritable("EmergencyStop"); err != nil {
+		return EmergencyStopReport{Reason: "manual", Would: []string{}, Steps: []EmergencyStopStep{}}, err
+	}
+	report := a.emergencyStop("manual")
+	if report.Failed() {
+		return report, errors.New("emergency stop incomplete, see the failed steps")
+	}
+	return report, nil
+}
+
+// emergencyStop runs the steps of an emergency stop for reason. Stops run one
+// at a time.
+func (a *App) emergencyStop(reason string) EmergencyStopReport {
+	a.emergencyMu.Lock()
+	defer a.emergencyMu.Unlock()
+
+	exec := a.executor("emergency-stop")
+	report := EmergencyStopReport{Reason: reason, DryRun: exec.dryRun, Would: []string{}, Steps: []EmergencyStopStep{}}
+	log.Warn().Str("reason", reason).Bool("dry_run", report.DryRun).Msg("Emergency stop")
+
+	run := func(name string, step func() (string, error)) {
+		started := time.Now()
+		detail, err := step()
+		outcome := EmergencyStopStep{Name: name, Status: StepSucceeded, Detail: detail, StartedAt: started, DurationMs: time.Since(started).Milliseconds()}
+		if err != nil {
+			outcome.Status, outcome.Error = StepFailed, err.Error()
+			log.Error().Err(err).Str("step", name).Msg("Emergency stop step failed")
+		}
+		report.Steps = append(report.Steps, outcome)
+	}
+
+	run("halt-services", func() (string, error) {
+		detail, would, err := a.haltServices(exec)
+		report.Would = append(report.Would, would...)
+		return detail, err
+	})
+	run("cancel-orders", func() (string, error) { return a.cancelOpenOrders(exec) })
+	if a.config.EmergencyStop.ClosePositions {
+		run("close-positions", func() (string, error) { return a.closeOpenPositions(exec) })
+	} else {
+		report.Steps = append(report.Steps, EmergencyStopStep{Name: "close-positions", Status: StepSkipped, Detail: "close_positions is off", StartedAt: time.Now()})
+	}
+
+	report.Would = append(report.Would, exec.recorded()...)
+	a.emitEvent(EmergencyStopEvent, report)
+	severity, message := notifications.SeverityCritical, "Emergency stop ("+reason+") completed"
+	if report.Failed() {
+		message = "Emergency stop (" + reason + ") incomplete, see the failed steps"
+	} else if report.DryRun {
+		severity, message = notifications.SeverityWarning, "Dry run of emergency stop ("+reason+") completed"
+	}
+	a.notify(severity, notifications.CategoryOperation, message, report)
+	return report
+}
+
+// haltServices pauses the trading stack's containers when Docker is
+// available, and otherwise the trading services' deployments; either goes
+// through the orchestrator's control service first when it is configured
+func (a *App) haltServices(exec *commandExecutor) (detail string, would []string, err error) {
+	if a.requireDocker() != nil {
+		if err := exec.run("pause the trading services", a.PauseTradingServices); err != nil {
+			return "", nil, err
+		}
+		return "paused the trading services", nil, nil
+	}
+
+	report, err := a.PauseStack()
+	if err != nil {
+		return "", report.Would, err
+	}
+	if len(report.Failed) > 0 {
+		failed := make([]string, len(report.Failed))
+		for i, outcome := range report.Failed {
+			failed[i] = outcome.Name + ": " + outcome.Reason
+		}
+		return "paused " + strings.Join(report.Succeeded, ", "), report.Would, fmt.Errorf("failed to pause %s", strings.Join(failed, "; "))
+	}
+	if len(report.Succeeded) == 0 {
+		return "nothing running to pause", report.Would, nil
+	}
+	return "paused " + strings.Join(report.Succeeded, ", "), report.Would, nil
+}
+
+// cancelOpenOrders cancels the active account's open orders, except the
+// closing orders of an earlier emergency stop
+func (a *App) cancelOpenOrders(exec *commandExecutor) (string, error) {
+	if a.orderClient == nil {
+		return "", ibkr.ErrNotConnected
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	orders, err := a.orderClient.OpenOrders(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to load open orders: %w", err)
+	}
+	var cancelled []string
+	var errs []error
+	for _, order := range a.accountOrders(orders) {
+		if order.Done() || a.emergencyOrders[order.OrderID] != "" {
+			continue
+		}
+		description := fmt.Sprintf("order %d (%s)", order.OrderID, order.Symbol)
+		if err := exec.run("cancel "+description, func() error { return a.orderClient.CancelOrder(ctx, order.OrderID) }); err != nil {
+			errs = append(errs, fmt.Errorf("failed to cancel %s: %w", description, err))
+			continue
+		}
+		cancelled = append(cancelled, description)
+	}
+	if len(cancelled) == 0 && len(errs) == 0 {
+		return "no open orders", nil
+	}
+	return "cancelled " + strings.Join(cancelled, ", "), errors.Join(errs...)
+}
+
+// closeOpenPositions places an order closing the active account's open legs
+// in each underlying, skipping those a closing order of an earlier emergency
+// stop still works on
+func (a *App) closeOpenPositions(exec *commandExecutor) (string, error) {
+	if a.orderClient == nil || a.marketData == nil || a.exposures == nil {
+		return "", ibkr.ErrNotConnected
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	legs, err := a.openExposures()
+	if err != nil {
+		return "", err
+	}
+	orders, err := a.orderClient.OpenOrders(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to load open orders: %w", err)
+	}
+	closing := make(map[string]bool)
+	for _, order := range orders {
+		if symbol := a.emergencyOrders[order.OrderID]; symbol != "" && !order.Done() {
+			closing[symbol] = true
+		}
+	}
+
+	var closed []string
+	var errs []error
+	for _, spread := range closingSpreads(legs) {
+		if closing[spread.Symbol] {
+			closed = append(closed, spread.Symbol+" (already closing)")
+			continue
+		}
+		quotes, err := a.legQuotes(ctx, spread)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", spread.Symbol, err))
+			continue
+		}
+		limit, err := ibkr.ComboLimitPrice(spread.Legs, quotes, emergencyPriceFactor)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: cannot price the closing order: %w", spread.Symbol, err))
+			continue
+		}
+		order := a.forActiveAccount(ibkr.NewComboOrder(spread, limit))
+		description := fmt.Sprintf("%s %d %s combo at %.2f", order.Action, order.Quantity, order.Symbol, order.LimitPrice)
+		err = exec.run("place "+description, func() error {
+			orderID, err := a.orderClient.PlaceOrder(ctx, order, func(state ibkr.OrderState) { a.emitEvent(OrderStatusEvent, state) })
+			if err == nil {
+				a.emergencyOrders[orderID] = spread.Symbol
+			}
+			return err
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: failed to place the closing order: %w", spread.Symbol, err))
+			continue
+		}
+		closed = append(closed, description)
+	}
+	if len(closed) == 0 && len(errs) == 0 {
+		return "no open positions", nil
+	}
+	return "closing " + strings.Join(closed, ", "), errors.Join(errs...)
+}
+
+// closingSpreads returns the spread orders closing legs, one per underlying
+// in symbol order, each leg taking the opposite side of its position. The
+// legs' quantities become ratios of the spread's quantity.
+func closingSpreads(legs []risk.LegExposure) []ibkr.SpreadOrder {
+	bySymbol := make(map[string]*ibkr.SpreadOrder)
+	for _, leg := range legs {
+		if leg.Quantity == 0 {
+			continue
+		}
+		symbol := strings.ToUpper(leg.Symbol)
+		spread := bySymbol[symbol]
+		if spread == nil {
+			spread = &ibkr.SpreadOrder{Symbol: symbol}
+			bySymbol[symbol] = spread
+		}
+		action, ratio := "SELL", leg.Quantity
+		if ratio < 0 {
+			action, ratio = "BUY", -ratio
+		}
+		spread.Legs = append(spread.Legs, ibkr.OptionLeg{Strike: leg.Strike, Expiry: leg.Expiry, Right: leg.Right, Action: action, Ratio: ratio})
+	}
+
+	spreads := make([]ibkr.SpreadOrder, 0, len(bySymbol))
+	for _, spread := range bySymbol {
+		quantity := spread.Legs[0].Ratio
+		for _, leg := range spread.Legs[1:] {
+			quantity = gcd(quantity, leg.Ratio)
+		}
+		for i := range spread.Legs {
+			spread.Legs[i].Ratio /= quantity
+		}
+		spread.Quantity = quantity
+		spreads = append(spreads, *spread)
+	}
+	sort.Slice(spreads, func(i, j int) bool { return spreads[i].Symbol < spreads[j].Symbol })
+	return spreads
+}
+
+// gcd returns the greatest common divisor of two positive numbers
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// emergencyStopDue reports whether a drawdown of the day's equity by
+// drawdown percent triggers an automatic emergency stop at now: with
+// EmergencyStop.AutoTrigger, beyond TradingParameters.EmergencyStopLossPercentage
+// and once the cooldown since the last automatic stop has passed. A stop
+// that is due is recorded, so it fires once.
+func (a *App) emergencyStopDue(drawdown float64, now time.Time) bool {
+	threshold := a.config.TradingParameters.EmergencyStopLossPercentage
+	if !a.config.EmergencyStop.AutoTrigger || threshold <= 0 || drawdown < threshold {
+		return false
+	}
+	cooldown := time.Duration(a.config.EmergencyStop.CooldownMinutes) * time.Minute
+	if cooldown == 0 {
+		cooldown = defaultEmergencyCooldown
+	}
+
+	a.emergencyAutoMu.Lock()
+	defer a.emergencyAutoMu.Unlock()
+	if !a.emergencyAutoAt.IsZero() && now.Sub(a.emergencyAutoAt) < cooldown {
+		return false
+	}
+	a.emergencyAutoAt = now
+	return true
+}
+
+// triggerEmergencyStop runs an emergency stop in the background when the
+// day's drawdown of drawdown percent makes one due. Read-only mode keeps it
+// from running.
+func (a *App) triggerEmergencyStop(drawdown float64) {
+	if !a.emergencyStopDue(drawdown, time.Now()) {
+		return
+	}
+	reason := fmt.Sprintf("drawdown of %.2f%% breached the emergency stop loss of %.2f%%", drawdown, a.config.TradingParameters.EmergencyStopLossPercentage)
+	if err := a.requireWritable("EmergencyStop"); err != nil {
+		log.Error().Err(err).Str("reason", reason).Msg("Emergency stop not run")
+		return
+	}
+	a.raiseAlert(AlertEmergencyStop, notifications.SeverityCritical, "Emergency stop triggered: "+reason, nil)
+	go a.emergencyStop(reason)
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"traderadmin/backend/ibkr"
+	"traderadmin/backend/models"
+	"traderadmin/backend/risk"
+)
+
+// sequence records the side effects of an emergency stop across the fakes,
+// in the order they happen
+type sequence struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+func (s *sequence) add(entry string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, entry)
+}
+
+func (s *sequence) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return strings.Join(s.entries, ",")
+}
+
+// sequencedOrderClient adds the cancellations and placements of a
+// fakeOrderClient to a sequence
+type sequencedOrderClient struct {
+	*fakeOrderClient
+	sequence *sequence
+}
+
+func (c sequencedOrderClient) PlaceOrder(ctx context.Context, order ibkr.ComboOrder, onStatus func(ibkr.OrderState)) (int64, error) {
+	c.sequence.add("place " + order.Symbol)
+	return c.fakeOrderClient.PlaceOrder(ctx, order, onStatus)
+}
+
+func (c sequencedOrderClient) CancelOrder(ctx context.Context, orderID int64) error {
+	c.sequence.add(fmt.Sprintf("cancel %d", orderID))
+	return c.fakeOrderClient.CancelOrder(ctx, orderID)
+}
+
+// emergencyTestApp returns an app on the stack of newStackOperationsTestApp
+// holding the short put spread of testSpread with an open order to cancel,
+// recording its side effects in the returned sequence
+func emergencyTestApp() (*App, *fakeOrderClient, *sequence) {
+	docker := &fakeDocker{}
+	app := newStackOperationsTestApp(docker)
+	seq := &sequence{}
+	app.runDocker = func(ctx context.Context, args ...string) error {
+		seq.add(args[0])
+		return docker.run(ctx, args...)
+	}
+
+	client := &fakeOrderClient{open: []ibkr.OrderState{{OrderID: 7, Symbol: "QQQ", Status: ibkr.OrderSubmitted, Remaining: 1}}}
+	app.orderClient = sequencedOrderClient{client, seq}
+	app.marketData = spreadQuotes{}
+	app.exposures = &fakeExposures{legs: []risk.LegExposure{
+		{Symbol: "SPY", Strike: 400, Expiry: "20240119", Right: "P", Quantity: -2},
+		{Symbol: "SPY", Strike: 395, Expiry: "20240119", Right: "P", Quantity: 2},
+	}}
+	app.config.EmergencyStop.ClosePositions = true
+	return app, client, seq
+}
+
+func stepStatuses(report EmergencyStopReport) string {
+	statuses := make([]string, len(report.Steps))
+	for i, step := range report.Steps {
+		statuses[i] = step.Name + "=" + step.Status
+	}
+	return strings.Join(statuses, ",")
+}
+
+func TestEmergencyStop(t *testing.T) {
+	app, client, seq := emergencyTestApp()
+	var events []EmergencyStopReport
+	app.emit = func(name string, data ...interface{}) {
+		if name == EmergencyStopEvent {
+			events = append(events, data[0].(EmergencyStopReport))
+		}
+	}
+
+	report, err := app.EmergencyStop()
+	if err != nil {
+		t.Fatalf("EmergencyStop() error = %v, report %+v", err, report)
+	}
+	if got := stepStatuses(report); got != "halt-services=succeeded,cancel-orders=succeeded,close-positions=succeeded" {
+		t.Errorf("Steps = %s", got)
+	}
+	for _, step := range report.Steps {
+		if step.StartedAt.IsZero() || step.DurationMs < 0 {
+			t.Errorf("Step %s timing = %v, %dms", step.Name, step.StartedAt, step.DurationMs)
+		}
+	}
+
+	// The six orchestrators are paused before the order is cancelled and the
+	// spread closed
+	if got := seq.String(); got != strings.Repeat("pause,", 6)+"cancel 7,place SPY" {
+		t.Errorf("Side effects = %s", got)
+	}
+	if len(client.placed) != 1 {
+		t.Fatalf("Placed %d orders, want the spread closed", len(client.placed))
+	}
+	closing := client.placed[0]
+	if closing.Quantity != 2 || closing.LimitPrice != 1.4 ||
+		closing.Legs[0].Action != "BUY" || closing.Legs[0].Ratio != 1 || closing.Legs[1].Action != "SELL" {
+		t.Errorf("Closing order = %+v, want 2 of the spread bought back at the natural 1.40", closing)
+	}
+	if len(events) != 1 || events[0].Reason != "manual" {
+		t.Errorf("Events = %+v, want the report emitted", events)
+	}
+
+	// Stopping again cancels neither the closing order nor closes twice
+	client.open = []ibkr.OrderState{{OrderID: 101, Symbol: "SPY", Status: ibkr.OrderSubmitted, Remaining: 2}}
+	report, err = app.EmergencyStop()
+	if err != nil {
+		t.Fatalf("Second EmergencyStop() error = %v, report %+v", err, report)
+	}
+	if len(client.cancelled) != 1 || len(client.placed) != 1 {
+		t.Errorf("After a second stop cancelled %v and placed %d orders", client.cancelled, len(client.placed))
+	}
+	if detail := report.Steps[2].Detail; !strings.Contains(detail, "SPY (already closing)") {
+		t.Errorf("Second close-positions detail = %q", detail)
+	}
+
+	// Once the closing order is gone the position is closed again
+	client.open = nil
+	if _, err := app.EmergencyStop(); err != nil || len(client.placed) != 2 {
+		t.Errorf("EmergencyStop() after the closing order was cancelled = %v, placed %d", err, len(client.placed))
+	}
+}
+
+func TestEmergencyStopContinuesPastFailures(t *testing.T) {
+	app, _, _ := emergencyTestApp()
+	app.orderClient = nil
+	app.config.EmergencyStop.ClosePositions = false
+
+	report, err := app.EmergencyStop()
+	if err == nil {
+		t.Error("EmergencyStop() without IBKR should report the failed step")
+	}
+	if got := stepStatuses(report); got != "halt-services=succeeded,cancel-orders=failed,close-positions=skipped" {
+		t.Errorf("Steps = %s", got)
+	}
+	if report.Steps[1].Error != ibkr.ErrNotConnected.Error() {
+		t.Errorf("cancel-orders error = %q", report.Steps[1].Error)
+	}
+}
+
+func TestEmergencyStopDryRun(t *testing.T) {
+	app, client, seq := emergencyTestApp()
+	app.SetDryRun(true)
+
+	report, err := app.EmergencyStop()
+	if err != nil {
+		t.Fatalf("EmergencyStop() error = %v", err)
+	}
+	// Six pauses, the cancellation and the closing order
+	if !report.DryRun || len(report.Would) != 8 {
+		t.Errorf("Report = %+v, want a dry run with 8 would entries", report)
+	}
+	if got := seq.String(); got != "" || len(client.placed) != 0 {
+		t.Errorf("Side effects %q in dry-run mode", got)
+	}
+}
+
+// scaledDeployments serves the scale subresource of the deployments on a
+// fake clientset from replicas
+func scaledDeployments(client *fake.Clientset, replicas map[string]int32) {
+	client.PrependReactor("get", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		get := action.(k8stesting.GetAction)
+		if get.GetSubresource() != "scale" {
+			return false, nil, nil
+		}
+		return true, &autoscalingv1.Scale{
+			ObjectMeta: metav1.ObjectMeta{Name: get.GetName(), Namespace: get.GetNamespace()},
+			Spec:       autoscalingv1.ScaleSpec{Replicas: replicas[get.GetName()]},
+		}, nil
+	})
+	client.PrependReactor("update", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		update := action.(k8stesting.UpdateAction)
+		if update.GetSubresource() != "scale" {
+			return false, nil, nil
+		}
+		scale := update.GetObject().(*autoscalingv1.Scale)
+		replicas[scale.Name] = scale.Spec.Replicas
+		return true, scale, nil
+	})
+}
+
+func TestEmergencyStopThroughKubernetes(t *testing.T) {
+	app, client, _ := emergencyTestApp()
+	app.backends.Docker.Available = false
+	app.ctx = context.Background()
+	app.emit = func(string, ...interface{}) {}
+	app.config.Kubernetes.Namespace = "traderadmin"
+	app.config.Kubernetes.OrchestratorDeploymentName = "traderadmin-orchestrator"
+	clientset := fake.NewSimpleClientset()
+	replicas := map[string]int32{"traderadmin-orchestrator": 2}
+	scaledDeployments(clientset, replicas)
+	app.k8s = &kubernetesClients{typed: clientset}
+
+	for i := 0; i < 2; i++ {
+		report, err := app.EmergencyStop()
+		if err != nil {
+			t.Fatalf("EmergencyStop() #%d error = %v, report %+v", i+1, err, report)
+		}
+		if replicas["traderadmin-orchestrator"] != 0 || !app.servicesPaused {
+			t.Errorf("Orchestrator replicas = %d after stop #%d, want 0", replicas["traderadmin-orchestrator"], i+1)
+		}
+		client.open = []ibkr.OrderState{{OrderID: 101, Symbol: "SPY", Status: ibkr.OrderSubmitted, Remaining: 2}}
+	}
+	if len(client.placed) != 1 {
+		t.Errorf("Placed %d closing orders over two stops, want 1", len(client.placed))
+	}
+}
+
+func TestEmergencyStopDue(t *testing.T) {
+	app := NewApp()
+	app.config.TradingParameters.EmergencyStopLossPercentage = 5
+	app.config.EmergencyStop.CooldownMinutes = 30
+	start := time.Date(2024, 7, 2, 14, 0, 0, 0, time.UTC)
+
+	if app.emergencyStopDue(8, start) {
+		t.Error("A stop is due without auto_trigger")
+	}
+	app.config.EmergencyStop.AutoTrigger = true
+	tests := []struct {
+		name     string
+		drawdown float64
+		at       time.Time
+		want     bool
+	}{
+		{"Within the limit", 4.9, start, false},
+		{"At the limit", 5, start, true},
+		{"In the cooldown", 7, start.Add(29 * time.Minute), false},
+		{"After the cooldown", 7, start.Add(30 * time.Minute), true},
+	}
+	for _, tt := range tests {
+		if got := app.emergencyStopDue(tt.drawdown, tt.at); got != tt.want {
+			t.Errorf("%s: emergencyStopDue(%g) = %v, want %v", tt.name, tt.drawdown, got, tt.want)
+		}
+	}
+}
+
+func TestDrawdownTriggersEmergencyStop(t *testing.T) {
+	app, client, _ := emergencyTestApp()
+	app.config.TradingParameters.EmergencyStopLossPercentage = 5
+	app.config.EmergencyStop.AutoTrigger = true
+	stops := make(chan EmergencyStopReport, 2)
+	app.emit = func(name string, data ...interface{}) {
+		if name == EmergencyStopEvent {
+			stops <- data[0].(EmergencyStopReport)
+		}
+	}
+
+	open := time.Date(2024, 7, 2, 13, 30, 0, 0, time.UTC)
+	for i, equity := range []float64{100000, 97000, 94000, 93000} {
+		app.exportMetrics(StatusInfo{}, models.AllMetrics{Portfolio: models.PortfolioMetrics{
+			Equity:    equity,
+			Timestamp: open.Add(time.Duration(i) * time.Minute),
+		}})
+	}
+
+	select {
+	case report := <-stops:
+		if !strings.Contains(report.Reason, "drawdown of 6.00%") || report.Failed() {
+			t.Errorf("Report = %+v, want a stop for the 6%% drawdown", report)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the emergency stop")
+	}
+	select {
+	case report := <-stops:
+		t.Errorf("Second stop %+v within the cooldown", report)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if len(client.cancelled) != 1 {
+		t.Errorf("Cancelled %v, want the open order cancelled once", client.cancelled)
+	}
+}
+
+func TestEmergencyStopCooldownValidation(t *testing.T) {
+	config := validConfig()
+	config.EmergencyStop.CooldownMinutes = -1
+	errs := NewApp().ValidateConfig(config)
+	if len(errs) != 1 || errs[0].Field != "EmergencyStop.CooldownMinutes" {
+		t.Errorf("ValidateConfig() = %v, want EmergencyStop.CooldownMinutes rejected", errs)
+	}
+}
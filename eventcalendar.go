@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/trustdan/ibkr-trader/go/pkg/calendar"
+
+	"traderadmin/backend/ibkr"
+)
+
+// Event calendar defaults and limits
+const (
+	defaultEventCacheTTLHours = 24
+	eventLookupTimeout        = 10 * time.Second
+)
+
+// configureEventCalendar builds the event calendar of [event_calendar]. One
+// that cannot be built is logged and left disabled.
+func (a *App) configureEventCalendar() {
+	settings := a.config.EventCalendar
+	ttl := time.Duration(settings.CacheTTLHours) * time.Hour
+	if ttl <= 0 {
+		ttl = defaultEventCacheTTLHours * time.Hour
+	}
+	events, err := calendar.NewEventCalendarProvider(settings.Type, settings.URL, settings.Token, ttl)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to configure the event calendar, expirations are not skipped around events")
+		events = nil
+	}
+	a.events = events
+}
+
+// skippedExpiries returns the expirations of chain a position opened now and
+// held to expiry would hold through earnings or an ex-dividend date, within
+// the TradeTiming avoidance windows, each with the reason. Without an event
+// calendar, or when its lookup fails, none are skipped.
+func (a *App) skippedExpiries(chain ibkr.OptionChain, now time.Time) map[string]string {
+	if a.events == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), eventLookupTimeout)
+	defer cancel()
+
+	earnings, err := a.events.NextEarningsDate(ctx, chain.Symbol)
+	if err != nil && !errors.Is(err, calendar.ErrNoEventData) {
+		log.Warn().Err(err).Str("symbol", chain.Symbol).Msg("Earnings date unavailable, no expirations skipped")
+		return nil
+	}
+	exDividend, err := a.events.NextExDividendDate(ctx, chain.Symbol)
+	if err != nil && !errors.Is(err, calendar.ErrNoEventData) {
+		log.Warn().Err(err).Str("symbol", chain.Symbol).Msg("Ex-dividend date unavailable, no expirations skipped")
+		return nil
+	}
+
+	timing := a.config.TradeTiming
+	avoid := calendar.EventAvoidance{
+		DaysBeforeEarnings: timing.AvoidEarningsDaysBefore,
+		DaysAfterEarnings:  timing.AvoidEarningsDaysAfter,
+		DaysBeforeExDiv:    timing.AvoidExDividendDaysBefore,
+	}
+	skipped := make(map[string]string)
+	for _, contract := range chain.Contracts {
+		if _, seen := skipped[contract.Expiry]; seen {
+			continue
+		}
+		expiration, err := time.Parse("20060102", contract.Expiry)
+		if err != nil {
+			continue
+		}
+		if skip, reason := calendar.SkipExpirationForEvents(now, expiration, earnings, exDividend, avoid); skip {
+			skipped[contract.Expiry] = reason
+		}
+	}
+	return skipped
+}
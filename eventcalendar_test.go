@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/trustdan/ibkr-trader/go/pkg/calendar"
+
+	"traderadmin/backend/ibkr"
+	"traderadmin/backend/options"
+)
+
+// fakeEvents is an event calendar with scripted dates; a zero date is no data
+type fakeEvents struct {
+	earnings, exDividend time.Time
+	err                  error
+}
+
+func (f *fakeEvents) NextEarningsDate(ctx context.Context, symbol string) (time.Time, error) {
+	if f.earnings.IsZero() && f.err == nil {
+		return time.Time{}, calendar.ErrNoEventData
+	}
+	return f.earnings, f.err
+}
+
+func (f *fakeEvents) NextExDividendDate(ctx context.Context, symbol string) (time.Time, error) {
+	if f.exDividend.IsZero() && f.err == nil {
+		return time.Time{}, calendar.ErrNoEventData
+	}
+	return f.exDividend, f.err
+}
+
+// eventMarketData is an ivMarketData listing expirations 20 and 45 days out
+type eventMarketData struct {
+	ivMarketData
+}
+
+func (f *eventMarketData) OptionParams(ctx context.Context, symbol string) ([]ibkr.OptionParams, error) {
+	now := time.Now()
+	expirations := []string{now.AddDate(0, 0, 20).Format("20060102"), now.AddDate(0, 0, 45).Format("20060102")}
+	return []ibkr.OptionParams{{Exchange: "SMART", Expirations: expirations, Strikes: []float64{90, 95, 100, 105, 110}}}, nil
+}
+
+func TestSelectionSkipsExpirationsAroundEvents(t *testing.T) {
+	now := time.Now()
+	near, far := now.AddDate(0, 0, 20).Format("20060102"), now.AddDate(0, 0, 45).Format("20060102")
+
+	tests := []struct {
+		name       string
+		events     *fakeEvents
+		wantExpiry string
+		wantReason string
+	}{
+		{"Earnings", &fakeEvents{earnings: now.AddDate(0, 0, 30)}, near, "earnings on"},
+		{"Ex-dividend", &fakeEvents{exDividend: now.AddDate(0, 0, 30)}, near, "ex-dividend on"},
+		{"No events", &fakeEvents{}, far, ""},
+		{"Lookup failure", &fakeEvents{err: errors.New("calendar down")}, far, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := NewApp()
+			app.marketData = &eventMarketData{ivMarketData{iv: 0.2}}
+			app.events = tt.events
+			app.config.TradeTiming.FixedTargetDTE = 45
+			app.config.TradeTiming.MinDTE = 7
+			app.config.TradeTiming.MaxDTE = 60
+			app.config.TradeTiming.AvoidEarningsDaysBefore = 3
+			app.config.TradeTiming.AvoidEarningsDaysAfter = 1
+			app.config.TradeTiming.AvoidExDividendDaysBefore = 2
+
+			decision, err := app.SelectExpiration("SPY", 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decision.Expiry != tt.wantExpiry {
+				t.Errorf("SelectExpiration() = %+v, want %s", decision, tt.wantExpiry)
+			}
+			if tt.wantReason != "" && (len(decision.Skipped) != 1 || !strings.Contains(decision.Skipped[0], tt.wantReason)) {
+				t.Errorf("Skipped = %v, want one for %q", decision.Skipped, tt.wantReason)
+			}
+			if tt.wantReason == "" && len(decision.Skipped) != 0 {
+				t.Errorf("Skipped = %v, want none", decision.Skipped)
+			}
+
+			// Spreads on the skipped expiration are rejected for the event
+			result, err := app.GetSpreadCandidates("SPY", "both")
+			if err != nil {
+				t.Fatal(err)
+			}
+			rejected := 0
+			for _, stat := range result.Rejections {
+				if stat.Code == options.RejectCorporateEvent {
+					rejected = stat.Count
+				}
+			}
+			if (tt.wantReason != "") != (rejected > 0) {
+				t.Errorf("Spreads rejected for a corporate event = %d, want them only with an event", rejected)
+			}
+			for _, candidate := range append(result.Candidates, result.NearMisses...) {
+				if tt.wantReason != "" && candidate.Expiry != tt.wantExpiry && len(candidate.Rejections) == 0 {
+					t.Errorf("Candidate %+v on the skipped expiration", candidate)
+				}
+			}
+		})
+	}
+}
+
+func TestEventCalendarFollowsConfig(t *testing.T) {
+	app := NewApp()
+	config := validConfig()
+	config.EventCalendar.Type = "mock"
+	app.setConfig(config)
+	if _, ok := app.events.(*calendar.CachedEventCalendar); !ok {
+		t.Errorf("Event calendar = %T, want the cached mock", app.events)
+	}
+
+	config.EventCalendar.Type = "none"
+	app.setConfig(config)
+	if app.events != nil {
+		t.Errorf("Event calendar = %T, want none", app.events)
+	}
+
+	config.EventCalendar.Type = "nasdaq"
+	if errs := app.ValidateConfig(config); len(errs) != 1 || errs[0].Field != "EventCalendar.Type" {
+		t.Errorf("ValidateConfig() = %v, want the unknown type rejected", errs)
+	}
+}
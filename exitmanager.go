@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"traderadmin/backend/ibkr"
+	"traderadmin/backend/journal"
+	"traderadmin/backend/notifications"
+	"traderadmin/backend/risk"
+)
+
+// ExitSignalEvent is emitted with the ExitSignal of each exit decision the
+// exit manager records
+const ExitSignalEvent = "exit:signal"
+
+// defaultExitInterval is the wait between evaluations of the open trades
+// while ExitManagement.IntervalSeconds is unset
+const defaultExitInterval = 30 * time.Second
+
+// PositionExitStatus is the latest evaluation of an open trade against its
+// profit target and stop loss. CurrentPrice is the net debit to close it at
+// the mid price, negative for a credit, like the journal's ExitPrice.
+type PositionExitStatus struct {
+	TradeID         int64     `json:"tradeId"`
+	Symbol          string    `json:"symbol"`
+	Strategy        string    `json:"strategy"`
+	EntryPrice      float64   `json:"entryPrice"`
+	CurrentPrice    float64   `json:"currentPrice"`
+	ProfitPct       float64   `json:"profitPct"` // of the max profit, negative at a loss
+	LossPct         float64   `json:"lossPct"`   // of the max loss, 0 at a profit
+	TargetProfitPct float64   `json:"targetProfitPct"`
+	StopLossPct     float64   `json:"stopLossPct"`
+	AutoExit        bool      `json:"autoExit"`
+	Reason          string    `json:"reason,omitempty"` // the rule crossed, journal.ExitTargetProfit or journal.ExitStopLoss
+	Stale           bool      `json:"stale"`            // the legs could not be quoted, so the trade was not evaluated
+	Closing         bool      `json:"closing"`          // an order in the trade's underlying is working
+	Note            string    `json:"note,omitempty"`
+	EvaluatedAt     time.Time `json:"evaluatedAt"`
+}
+
+// ExitSignal is emitted as ExitSignalEvent when an open trade crossed its
+// profit target or stop loss
+type ExitSignal struct {
+	TradeID  int64                `json:"tradeId"`
+	Symbol   string               `json:"symbol"`
+	Strategy string               `json:"strategy"`
+	Decision journal.ExitDecision `json:"decision"`
+}
+
+// exitAccount is what an evaluation knows of the active account for placing
+// closing orders
+type exitAccount struct {
+	working map[string]bool // underlyings with a working order
+	held    []risk.LegExposure
+	err     error // why closing orders cannot be placed
+}
+
+// GetExitStatus returns the latest evaluation of each open trade of the
+// journal against its profit target and stop loss
+func (a *App) GetExitStatus() []PositionExitStatus {
+	a.exitMu.Lock()
+	defer a.exitMu.Unlock()
+	return slices.Clone(a.exitStatus)
+}
+
+// manageExits evaluates the open trades every ExitManagement.IntervalSeconds
+// while the exit manager is enabled and IBKR connected
+func (a *App) manageExits(ctx context.Context) {
+	for {
+		interval := time.Duration(a.config.ExitManagement.IntervalSeconds) * time.Second
+		if interval <= 0 {
+			interval = defaultExitInterval
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+
+		if !a.config.ExitManagement.Enabled || a.journal == nil || a.orderClient == nil || a.marketData == nil {
+			continue
+		}
+		a.evaluateExits(ctx, time.Now())
+	}
+}
+
+// evaluateExits checks each open trade of the journal against its profit
+// target and stop loss at the legs' mid prices, as GetPositionsRisk prices
+// them. A trade crossing one is alerted on or, with auto exit, closed by an
+// order unless an order in its underlying is working already. A decision is
+// recorded in the journal unless it repeats the trade's last one.
+func (a *App) evaluateExits(ctx context.Context, now time.Time) []PositionExitStatus {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	trades := openTrades(a.journal)
+	rows, quotes := a.refreshPositionsRisk(ctx, trades, now)
+	var account *exitAccount
+	statuses := make([]PositionExitStatus, 0, len(trades))
+	for i, trade := range trades {
+		status := a.evaluateExit(trade, rows[i], now)
+		if status.Reason != "" {
+			if account == nil && status.AutoExit {
+				account = a.loadExitAccount(ctx)
+			}
+			a.actOnExit(ctx, trade, &status, quotes[i], account)
+		}
+		statuses = append(statuses, status)
+	}
+
+	a.exitMu.Lock()
+	a.exitStatus = statuses
+	a.exitMu.Unlock()
+	return statuses
+}
+
+// evaluateExit reports the rule trade crossed at its risk row, the profit
+// target before the stop loss. A stale row is not evaluated.
+func (a *App) evaluateExit(trade journal.TradeRecord, row PositionRisk, now time.Time) PositionExitStatus {
+	status := PositionExitStatus{
+		TradeID:     trade.ID,
+		Symbol:      strings.ToUpper(trade.Symbol),
+		Strategy:    trade.Strategy,
+		EntryPrice:  trade.EntryPrice,
+		EvaluatedAt: now,
+	}
+	status.TargetProfitPct, status.StopLossPct, status.AutoExit = a.exitRules(trade.Strategy)
+	if row.Stale {
+		status.Stale, status.Note = true, row.Note
+		return status
+	}
+	status.CurrentPrice, status.ProfitPct, status.LossPct = row.CurrentValue, row.ProfitPct, row.LossPct
+
+	switch {
+	case status.TargetProfitPct > 0 && status.ProfitPct >= status.TargetProfitPct:
+		status.Reason = journal.ExitTargetProfit
+	case status.StopLossPct > 0 && status.LossPct >= status.StopLossPct:
+		status.Reason = journal.ExitStopLoss
+	}
+	return status
+}
+
+// exitRules returns the profit target and stop loss percents of strategy and
+// whether its trades are closed automatically: those its strategy_defaults
+// table sets, and otherwise ExitManagement's
+func (a *App) exitRules(strategy string) (targetProfitPct, stopLossPct float64, autoExit bool) {
+	rules := a.config.ExitManagement
+	targetProfitPct, stopLossPct, autoExit = rules.TargetProfitPct, rules.StopLossPct, rules.AutoExit
+
+	var settings map[string]interface{}
+	for name, defaults := range a.config.StrategyDefaults {
+		if strings.EqualFold(name, strategy) {
+			settings = defaults
+			break
+		}
+	}
+	if pct, ok := settingNumber(settings["target_profit_pct"]); ok {
+		targetProfitPct = pct
+	}
+	if pct, ok := settingNumber(settings["stop_loss_pct"]); ok {
+		stopLossPct = pct
+	}
+	if auto, ok := settings["auto_exit"].(bool); ok {
+		autoExit = auto
+	}
+	return targetProfitPct, stopLossPct, autoExit
+}
+
+// settingNumber returns a strategy_defaults value that is a number, which
+// TOML decodes as int64 or float64 and JSON as float64
+func settingNumber(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// loadExitAccount loads the working orders and open legs of the active
+// account
+func (a *App) loadExitAccount(ctx context.Context) *exitAccount {
+	account := &exitAccount{working: make(map[string]bool)}
+	orders, err := a.orderClient.OpenOrders(ctx)
+	if err != nil {
+		account.err = fmt.Errorf("failed to load open orders: %w", err)
+		return account
+	}
+	for _, order := range a.accountOrders(orders) {
+		if !order.Done() {
+			account.working[strings.ToUpper(order.Symbol)] = true
+		}
+	}
+	account.held, account.err = a.openExposures()
+	return account
+}
+
+// actOnExit alerts on a trade that crossed status.Reason or, with auto exit,
+// places the order closing it, and records the decision. A trade whose
+// underlying has a working order, or whose legs are no longer held, is left
+// alone.
+func (a *App) actOnExit(ctx context.Context, trade journal.TradeRecord, status *PositionExitStatus, quotes []ibkr.OptionQuote, account *exitAccount) {
+	decision := journal.ExitDecision{
+		Time:      status.EvaluatedAt,
+		Reason:    status.Reason,
+		Action:    journal.ExitAlerted,
+		ProfitPct: status.ProfitPct,
+		LossPct:   status.LossPct,
+		Price:     status.CurrentPrice,
+	}
+	switch {
+	case !status.AutoExit:
+	case account.err != nil:
+		decision.Detail = "auto exit unavailable: " + account.err.Error()
+	case account.working[status.Symbol]:
+		status.Closing = true
+		return
+	case !holdsTrade(account.held, trade):
+		status.Note = "legs no longer held, close the trade in the journal"
+		return
+	default:
+		// The closing order is a spread order, allowed, and only reported,
+		// in dry-run mode like PlaceSpreadOrder
+		if err := a.requireWritable("PlaceSpreadOrder"); err != nil {
+			decision.Detail = "auto exit unavailable: " + err.Error()
+		} else if !a.inTradingSchedule(status.EvaluatedAt) {
+			decision.Detail = "auto exit waits for the trading schedule"
+		} else {
+			a.placeExitOrder(ctx, trade, quotes, &decision)
+			status.Closing = decision.Action == journal.ExitOrderPlaced
+		}
+	}
+
+	// Repeats are only recorded for orders placed
+	decisions := trade.ExitDecisions
+	if last := len(decisions) - 1; last >= 0 && decision.OrderID == 0 &&
+		decisions[last].Reason == decision.Reason && decisions[last].Action == decision.Action {
+		return
+	}
+	if _, err := a.journal.RecordExitDecision(trade.ID, decision); err != nil {
+		log.Error().Err(err).Int64("trade_id", trade.ID).Msg("Failed to record exit decision")
+	}
+
+	rule := AlertExitTarget
+	if decision.Reason == journal.ExitStopLoss {
+		rule = AlertExitStop
+	}
+	signal := ExitSignal{TradeID: trade.ID, Symbol: status.Symbol, Strategy: trade.Strategy, Decision: decision}
+	a.raiseAlert(rule, notifications.SeverityWarning, fmt.Sprintf("%s trade %d crossed its %s: %s", status.Symbol, trade.ID, strings.ReplaceAll(decision.Reason, "_", " "), decision.Action), signal)
+	a.emitEvent(ExitSignalEvent, signal)
+	log.Warn().
+		Int64("trade_id", trade.ID).
+		Str("symbol", status.Symbol).
+		Str("reason", decision.Reason).
+		Str("action", decision.Action).
+		Float64("profit_pct", decision.ProfitPct).
+		Float64("loss_pct", decision.LossPct).
+		Str("detail", decision.Detail).
+		Msg("Trade crossed its exit rule")
+}
+
+// placeExitOrder places the order closing trade, at the natural price for a
+// stop loss and priced like new orders for a profit target, and completes
+// decision with its outcome. The trade is closed in the journal at the
+// order's fill price.
+func (a *App) placeExitOrder(ctx context.Context, trade journal.TradeRecord, quotes []ibkr.OptionQuote, decision *journal.ExitDecision) {
+	closing := closingTradeSpread(trade)
+	factor := a.priceImprovementFactor()
+	if decision.Reason == journal.ExitStopLoss {
+		factor = emergencyPriceFactor
+	}
+	limit, err := ibkr.ComboLimitPrice(closing.Legs, quotes, factor)
+	if err != nil {
+		decision.Action, decision.Detail = journal.ExitOrderFailed, "cannot price the closing order: "+err.Error()
+		return
+	}
+
+	order := a.forActiveAccount(ibkr.NewComboOrder(closing, limit))
+	decision.LimitPrice = limit
+	description := fmt.Sprintf("%s %d %s combo at %.2f", order.Action, order.Quantity, order.Symbol, order.LimitPrice)
+	exec := a.executor("exit-order")
+	err = exec.run("place "+description, func() error {
+		orderID, err := a.orderClient.PlaceOrder(ctx, order, func(state ibkr.OrderState) {
+			a.emitEvent(OrderStatusEvent, state)
+			if state.Status == ibkr.OrderFilled {
+				a.closeExitedTrade(trade.ID, state)
+			}
+		})
+		decision.OrderID = orderID
+		return err
+	})
+	if err != nil {
+		decision.Action, decision.Detail = journal.ExitOrderFailed, "failed to place the closing order: "+err.Error()
+		return
+	}
+	decision.Action = journal.ExitOrderPlaced
+	if exec.dryRun {
+		decision.Detail = "dry run, would place " + description
+	}
+}
+
+// closeExitedTrade closes a journal trade at the fill price of its closing
+// order
+func (a *App) closeExitedTrade(id int64, state ibkr.OrderState) {
+	exitTime := state.UpdatedAt
+	if exitTime.IsZero() {
+		exitTime = time.Now()
+	}
+	if _, err := a.journal.UpdateTradeOutcome(id, state.AvgFillPrice, exitTime); err != nil {
+		log.Error().Err(err).Int64("trade_id", id).Int64("order_id", state.OrderID).Msg("Failed to close the exited trade in the journal")
+		return
+	}
+	log.Info().Int64("trade_id", id).Int64("order_id", state.OrderID).Float64("exit_price", state.AvgFillPrice).Msg("Exited trade closed in the journal")
+}
+
+// closingTradeSpread returns the spread order closing trade, each leg taking
+// the opposite side
+func closingTradeSpread(trade journal.TradeRecord) ibkr.SpreadOrder {
+	legs := make([]ibkr.OptionLeg, len(trade.Legs))
+	for i, leg := range trade.Legs {
+		legs[i] = leg
+		legs[i].Action = "SELL"
+		if leg.Action == "SELL" {
+			legs[i].Action = "BUY"
+		}
+	}
+	return ibkr.SpreadOrder{Symbol: strings.ToUpper(trade.Symbol), Legs: legs, Quantity: trade.Quantity}
+}
+
+// holdsTrade reports whether held includes each leg of trade at its full
+// quantity on the same side
+func holdsTrade(held []risk.LegExposure, trade journal.TradeRecord) bool {
+	for _, leg := range trade.Legs {
+		want := trade.Quantity * max(leg.Ratio, 1)
+		if leg.Action == "SELL" {
+			want = -want
+		}
+		found := slices.ContainsFunc(held, func(h risk.LegExposure) bool {
+			return strings.EqualFold(h.Symbol, trade.Symbol) && h.Strike == leg.Strike && h.Expiry == leg.Expiry && h.Right == leg.Right &&
+				(want > 0 && h.Quantity >= want || want < 0 && h.Quantity <= want)
+		})
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"traderadmin/backend/ibkr"
+	"traderadmin/backend/journal"
+	"traderadmin/backend/risk"
+)
+
+// movingQuotes quotes the legs of testSpread at prices a test moves, by
+// strike
+type movingQuotes struct {
+	spreadQuotes
+
+	mu     sync.Mutex
+	quotes map[float64]ibkr.OptionQuote
+}
+
+// move sets the bid and ask of the 400 and 395 puts
+func (m *movingQuotes) move(bid400, ask400, bid395, ask395 float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.quotes = map[float64]ibkr.OptionQuote{
+		400: {Bid: bid400, Ask: ask400},
+		395: {Bid: bid395, Ask: ask395},
+	}
+}
+
+func (m *movingQuotes) OptionSnapshots(ctx context.Context, symbol string, options []ibkr.OptionKey) ([]ibkr.OptionQuote, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snapshots := make([]ibkr.OptionQuote, len(options))
+	for i, option := range options {
+		snapshots[i] = m.quotes[option.Strike]
+		snapshots[i].OptionKey = option
+	}
+	return snapshots, nil
+}
+
+// Prices of testSpread, opened for a credit of 1.25: its max profit is 125
+// and its max loss 375
+var (
+	exitAtEntry  = [4]float64{3.0, 3.2, 1.8, 1.9}   // closes for 1.25
+	exitAtTarget = [4]float64{1.0, 1.1, 0.42, 0.46} // closes for 0.61, 51.2% of the max profit
+	exitAtStop   = [4]float64{6.0, 6.2, 2.9, 3.0}   // closes for 3.15, 50.7% of the max loss
+)
+
+// exitTestApp is an orderTestApp with a journal holding testSpread, opened
+// for a credit of 1.25, whose legs the account holds, and the exit signals
+// it emits
+func exitTestApp(t *testing.T, statuses ...ibkr.OrderState) (*App, *fakeOrderClient, *movingQuotes, journal.TradeRecord, *[]ExitSignal) {
+	t.Helper()
+	app, client, _ := orderTestApp(statuses...)
+	var err error
+	if app.journal, err = journal.Open(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	spread := testSpread()
+	trade, err := app.journal.RecordTrade(journal.TradeRecord{Symbol: "SPY", Strategy: "HIGH_BASE", Legs: spread.Legs, Quantity: 1, EntryPrice: 1.25})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.exposures = &fakeExposures{legs: []risk.LegExposure{
+		{Symbol: "SPY", Strike: 400, Expiry: "20240119", Right: "P", Quantity: -1},
+		{Symbol: "SPY", Strike: 395, Expiry: "20240119", Right: "P", Quantity: 1},
+	}}
+	quotes := &movingQuotes{}
+	quotes.move(exitAtEntry[0], exitAtEntry[1], exitAtEntry[2], exitAtEntry[3])
+	app.marketData = quotes
+
+	app.config.ExitManagement.Enabled = true
+	app.config.ExitManagement.TargetProfitPct = 50
+	app.config.ExitManagement.StopLossPct = 50
+	signals := &[]ExitSignal{}
+	app.emit = func(name string, data ...interface{}) {
+		if name == ExitSignalEvent {
+			*signals = append(*signals, data[0].(ExitSignal))
+		}
+	}
+	return app, client, quotes, trade, signals
+}
+
+// evaluateAt moves the quotes to prices and evaluates the open trades
+func evaluateAt(t *testing.T, app *App, quotes *movingQuotes, prices [4]float64) PositionExitStatus {
+	t.Helper()
+	quotes.move(prices[0], prices[1], prices[2], prices[3])
+	statuses := app.evaluateExits(context.Background(), time.Now())
+	if len(statuses) != 1 {
+		t.Fatalf("evaluateExits() = %d statuses, want 1", len(statuses))
+	}
+	return statuses[0]
+}
+
+func TestExitManagerAlertsOnceAtTarget(t *testing.T) {
+	app, client, quotes, trade, signals := exitTestApp(t)
+
+	status := evaluateAt(t, app, quotes, exitAtEntry)
+	if status.Reason != "" || math.Abs(status.CurrentPrice-1.25) > 1e-9 || math.Abs(status.ProfitPct) > 1e-9 {
+		t.Errorf("Status at entry = %+v, want no exit at a price of 1.25", status)
+	}
+
+	for i := 0; i < 2; i++ {
+		status = evaluateAt(t, app, quotes, exitAtTarget)
+	}
+	if status.Reason != journal.ExitTargetProfit || math.Abs(status.ProfitPct-51.2) > 1e-9 {
+		t.Errorf("Status at target = %+v, want target_profit at 51.2%%", status)
+	}
+	if len(*signals) != 1 || (*signals)[0].Decision.Action != journal.ExitAlerted {
+		t.Errorf("Exit signals = %+v, want one alert", *signals)
+	}
+	decisions := app.journal.GetTrades(journal.TradeFilter{})[0].ExitDecisions
+	if len(decisions) != 1 || decisions[0].Reason != journal.ExitTargetProfit {
+		t.Errorf("Journal exit decisions = %+v, want one at the target", decisions)
+	}
+	if len(client.placed) != 0 {
+		t.Errorf("Placed %d orders without auto exit", len(client.placed))
+	}
+	if got := app.GetExitStatus(); len(got) != 1 || got[0].TradeID != trade.ID {
+		t.Errorf("GetExitStatus() = %+v", got)
+	}
+
+	// Crossing the stop is a new decision
+	evaluateAt(t, app, quotes, exitAtStop)
+	if len(*signals) != 2 || (*signals)[1].Decision.Reason != journal.ExitStopLoss {
+		t.Errorf("Exit signals = %+v, want a stop loss alert after the target", *signals)
+	}
+}
+
+func TestExitManagerAutoExitAtStop(t *testing.T) {
+	filled := ibkr.OrderState{Status: ibkr.OrderFilled, Filled: 1, AvgFillPrice: 3.3, UpdatedAt: time.Date(2024, 1, 10, 15, 0, 0, 0, time.UTC)}
+	app, client, quotes, trade, signals := exitTestApp(t, filled)
+	app.config.ExitManagement.AutoExit = true
+
+	// No closing order while an order in the underlying works
+	client.open = []ibkr.OrderState{{OrderID: 7, Symbol: "SPY", Status: ibkr.OrderSubmitted, Remaining: 1}}
+	if status := evaluateAt(t, app, quotes, exitAtStop); !status.Closing || len(client.placed) != 0 {
+		t.Fatalf("Status with a working order = %+v and %d orders placed, want closing and none", status, len(client.placed))
+	}
+
+	client.open = nil
+	status := evaluateAt(t, app, quotes, exitAtStop)
+	if status.Reason != journal.ExitStopLoss || !status.Closing {
+		t.Errorf("Status at the stop = %+v, want a closing stop_loss", status)
+	}
+	if len(client.placed) != 1 {
+		t.Fatalf("Placed %d orders, want 1", len(client.placed))
+	}
+	// The stop closes at the natural price, buying the 400 put at its ask
+	// and selling the 395 put at its bid
+	order := client.placed[0]
+	if order.Symbol != "SPY" || order.Quantity != 1 || math.Abs(order.LimitPrice-3.3) > 1e-9 ||
+		order.Legs[0].Action != "BUY" || order.Legs[1].Action != "SELL" {
+		t.Errorf("Closing order = %+v, want BUY 400P / SELL 395P at 3.30", order)
+	}
+	if len(*signals) != 1 || (*signals)[0].Decision.Action != journal.ExitOrderPlaced || (*signals)[0].Decision.OrderID != 101 {
+		t.Errorf("Exit signals = %+v, want order 101 placed", *signals)
+	}
+
+	closed := app.journal.GetTrades(journal.TradeFilter{})[0]
+	if closed.ID != trade.ID || closed.Status != journal.StatusClosed || math.Abs(closed.RealizedPL+205) > 1e-9 {
+		t.Errorf("Trade after the fill = %+v, want closed for a loss of 205", closed)
+	}
+	if statuses := app.evaluateExits(context.Background(), time.Now()); len(statuses) != 0 {
+		t.Errorf("evaluateExits() after the fill = %+v, want no open trades", statuses)
+	}
+}
+
+func TestExitManagerAlertsWhenAutoExitUnavailable(t *testing.T) {
+	app, client, quotes, _, signals := exitTestApp(t)
+	app.config.ExitManagement.AutoExit = true
+	app.config.IBKRConnection.Accounts = []IBKRAccount{{Name: "paper", ReadOnlyAPI: true}}
+
+	evaluateAt(t, app, quotes, exitAtTarget)
+	if len(client.placed) != 0 {
+		t.Errorf("Placed %d orders in read-only mode", len(client.placed))
+	}
+	if len(*signals) != 1 || (*signals)[0].Decision.Action != journal.ExitAlerted || !strings.Contains((*signals)[0].Decision.Detail, ErrReadOnlyMode.Error()) {
+		t.Errorf("Exit signals = %+v, want an alert explaining the missing order", *signals)
+	}
+}
+
+func TestExitManagerAutoExitInDryRun(t *testing.T) {
+	app, client, quotes, _, signals := exitTestApp(t)
+	app.config.ExitManagement.AutoExit = true
+	app.SetDryRun(true)
+
+	evaluateAt(t, app, quotes, exitAtStop)
+	if len(client.placed) != 0 {
+		t.Errorf("Placed %d orders in dry-run mode", len(client.placed))
+	}
+	decisions := app.journal.GetTrades(journal.TradeFilter{})[0].ExitDecisions
+	if len(decisions) != 1 || decisions[0].Action != journal.ExitOrderPlaced || !strings.HasPrefix(decisions[0].Detail, "dry run, would place BUY 1 SPY combo at 3.30") {
+		t.Errorf("Journal exit decisions = %+v, want the order it would place", decisions)
+	}
+	if len(*signals) != 1 || (*signals)[0].Decision.OrderID != 0 {
+		t.Errorf("Exit signals = %+v, want one without an order", *signals)
+	}
+}
+
+func TestExitManagerSkipsStaleQuotes(t *testing.T) {
+	app, _, quotes, _, signals := exitTestApp(t)
+
+	status := evaluateAt(t, app, quotes, [4]float64{0, 0, 0.42, 0.46})
+	if !status.Stale || status.Note == "" || status.Reason != "" {
+		t.Errorf("Status without a quote = %+v, want stale and not evaluated", status)
+	}
+	if len(*signals) != 0 {
+		t.Errorf("Exit signals = %+v, want none", *signals)
+	}
+}
+
+func TestExitRulesFromStrategyDefaults(t *testing.T) {
+	app := NewApp()
+	app.config.ExitManagement.TargetProfitPct = 50
+	app.config.ExitManagement.StopLossPct = 50
+	app.config.StrategyDefaults = map[string]map[string]interface{}{
+		"high_base": {"target_profit_pct": int64(40), "stop_loss_pct": 100.0, "auto_exit": true},
+	}
+
+	if target, stop, auto := app.exitRules("HIGH_BASE"); target != 40 || stop != 100 || !auto {
+		t.Errorf("exitRules(HIGH_BASE) = %v, %v, %v, want 40, 100, true", target, stop, auto)
+	}
+	if target, stop, auto := app.exitRules("LOW_BASE"); target != 50 || stop != 50 || auto {
+		t.Errorf("exitRules(LOW_BASE) = %v, %v, %v, want 50, 50, false", target, stop, auto)
+	}
+}
@@ -1,7 +1,7 @@
 import { render, screen } from '@testing-library/svelte';
 import { vi, describe, it, expect, beforeEach } from 'vitest';
 import StatusBar from './StatusBar.svelte';
-import { statusStore } from '../stores/statusStore';
+import { statusStore, updateStatus, subscribeStatusUpdates } from '../stores/statusStore';
 import { get } from 'svelte/store';
 
 // Mock the statusStore to prevent actual API calls
@@ -13,7 +13,10 @@ vi.mock('../stores/statusStore', () => {
     ibkr: {
       connected: true,
       lastConnected: mockDate,
-      error: ''
+      error: '',
+      account: 'live',
+      accountCode: 'U7654321',
+      live: true
     },
     services: [
       {
@@ -34,6 +37,7 @@ vi.mock('../stores/statusStore', () => {
     activePositions: 3,
     tradingActive: true,
     isTradingHours: true,
+    dryRun: false,
     lastUpdated: mockDate
   };
 
@@ -47,7 +51,7 @@ vi.mock('../stores/statusStore', () => {
       set: vi.fn()
     },
     updateStatus: vi.fn().mockResolvedValue(undefined),
-    startStatusPolling: vi.fn().mockReturnValue(() => {})
+    subscribeStatusUpdates: vi.fn().mockReturnValue(() => {})
   };
 });
 
@@ -83,9 +87,18 @@ describe('StatusBar Component', () => {
     expect(screen.getByText('Last Updated:')).toBeInTheDocument();
   });
 
-  it('should start status polling on mount', () => {
+  it('should mark a live account loudly', () => {
+    const { container } = render(StatusBar);
+
+    expect(screen.getByText('Account:')).toBeInTheDocument();
+    expect(screen.getByText('live (U7654321)')).toBeInTheDocument();
+    expect(screen.getByText('LIVE')).toHaveClass('account-live');
+    expect(container.querySelector('.status-bar')).toHaveClass('status-bar-live');
+  });
+
+  it('should subscribe to status updates on mount', () => {
     render(StatusBar);
     expect(updateStatus).toHaveBeenCalledTimes(1);
-    expect(startStatusPolling).toHaveBeenCalledWith(5000);
+    expect(subscribeStatusUpdates).toHaveBeenCalledTimes(1);
   });
 });
@@ -6,6 +6,7 @@ export type TabId =
   | 'monitoring'
   | 'connection'
   | 'scheduling'
+  | 'risk'
   | 'strategies'
   | 'alerts'
   | 'logs'
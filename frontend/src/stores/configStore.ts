@@ -3,6 +3,7 @@ import { writable, get } from 'svelte/store';
 
 // Import from the generated Wails bindings
 import { GetConfig, UpdateConfig, SaveConfigurationAndRestart, PauseTradingServices, ResumeTradingServices } from '../wailsjs/go/main/App';
+import { EventsOn } from '../wailsjs/wailsjs/runtime/runtime';
 
 // Import the AllMetrics type definition
 import type { AllMetrics } from './metricsStore';
@@ -12,34 +13,52 @@ declare global {
   interface Window {
     go: {
       main: {
-        App: {
+        ReadService: {
           // Methods from configStore.ts
           GetConfig: () => Promise<Configuration>;
+          IsReadOnly: () => Promise<boolean>;
+          IsViewerMode: () => Promise<boolean>;
+          GetConfigWarnings: () => Promise<ConfigWarning[]>;
+          // Methods from metricsStore.ts
+          GetLatestMetrics: () => Promise<AllMetrics>;
+        };
+        // Not bound in viewer mode
+        AdminService: {
+          // Methods from configStore.ts
           UpdateConfig: (config: Configuration) => Promise<void>;
           SaveConfigurationAndRestart: (config: Configuration) => Promise<void>;
           PauseTradingServices: () => Promise<void>;
           ResumeTradingServices: () => Promise<void>;
+          SetDryRun: (enabled: boolean) => Promise<void>;
           // Methods from metricsStore.ts
-          GetLatestMetrics: () => Promise<AllMetrics>;
           TestAlertNotification: (channelType: string, message: string) => Promise<void>;
-        }
+        };
       }
     }
   }
 }
 
+// A TWS/Gateway account TraderAdmin can connect to
+export interface IBKRAccount {
+  Name: string;
+  Host: string;
+  Port: number;
+  ClientIDTrading: number;
+  ClientIDData: number;
+  AccountCode: string;
+  ReadOnlyAPI: boolean;
+}
+
 // For now, we'll define a simple type that matches our config structure
 export interface Configuration {
   General: {
     LogLevel: string;
   };
   IBKRConnection: {
-    Host: string;
-    Port: number;
-    ClientIDTrading: number;
-    ClientIDData: number;
-    AccountCode: string;
-    ReadOnlyAPI: boolean;
+    ActiveAccount: string;
+    Accounts: IBKRAccount[];
+    HeartbeatSeconds: number;
+    MaxBackoffSeconds: number;
   };
   TradingParameters: {
     GlobalMaxConcurrentPositions: number;
@@ -129,6 +148,40 @@ export interface Configuration {
 // Create a writable store for the configuration
 export const currentConfig = writable<Configuration | null>(null);
 
+// Whether the backend rejects pausing, restarting and deploying services;
+// buttons for those should be disabled while it is set
+export const readOnlyMode = writable<boolean>(false);
+
+// A setting of the config file the backend ignores, usually a misspelled key
+export interface ConfigWarning {
+  key: string;
+  suggestion?: string;
+  message: string;
+}
+
+// The warnings of the config file last loaded
+export const configWarnings = writable<ConfigWarning[]>([]);
+
+// A step of SaveConfigurationAndRestart starting or finishing; services are
+// the trading services the pause and resume steps act on
+export interface RestartProgress {
+  operation: string;
+  step: 'validate' | 'pause' | 'backup' | 'save' | 'reload' | 'resume' | 'done';
+  percent: number;
+  state: 'running' | 'succeeded' | 'failed' | 'skipped';
+  error?: string;
+  services?: { name: string; state: string }[];
+  dryRun: boolean;
+}
+
+// The latest progress of a save and restart, null before the first
+export const restartProgress = writable<RestartProgress | null>(null);
+
+// Whether a save and restart is running, so its button can be disabled
+export function restartRunning(progress: RestartProgress | null): boolean {
+  return progress !== null && progress.step !== 'done' && progress.state !== 'failed';
+}
+
 // Define a function to load the configuration from the backend
 export async function loadConfig(): Promise<boolean> {
   try {
@@ -136,6 +189,8 @@ export async function loadConfig(): Promise<boolean> {
     const config = await GetConfig();
     console.log('Received config from backend:', config);
     currentConfig.set(config);
+    readOnlyMode.set(await window.go.main.ReadService.IsReadOnly());
+    configWarnings.set(await window.go.main.ReadService.GetConfigWarnings());
     return true;
   } catch (error) {
     console.error("Failed to load configuration:", error);
@@ -190,3 +245,21 @@ export async function resumeTradingServices(): Promise<boolean> {
     throw error;
   }
 }
+
+// Subscribe to the read-only mode changes the backend pushes when the
+// configuration is reloaded or saved
+export function subscribeReadOnlyChanges(): () => void {
+  return EventsOn('readonly:changed', (readOnly: boolean) => readOnlyMode.set(readOnly));
+}
+
+// Subscribe to the warnings the backend pushes each time it loads the config
+// file
+export function subscribeConfigWarnings(): () => void {
+  return EventsOn('config-warnings', (warnings: ConfigWarning[]) => configWarnings.set(warnings ?? []));
+}
+
+// Subscribe to the progress the backend pushes at each step of a save and
+// restart
+export function subscribeRestartProgress(): () => void {
+  return EventsOn('restart:progress', (progress: RestartProgress) => restartProgress.set(progress));
+}
@@ -2,23 +2,31 @@
 import { writable, get } from 'svelte/store';
 import type { Configuration } from './configStore'; // Import the type
 import { GetLatestMetrics } from '../wailsjs/go/main/App';
+import { EventsOn } from '../wailsjs/wailsjs/runtime/runtime';
 
 // Declare the global window interface to extend it with Wails properties
 declare global {
   interface Window {
     go: {
       main: {
-        App: {
+        ReadService: {
           // Methods from metricsStore.ts
           GetLatestMetrics: () => Promise<AllMetrics>;
-          TestAlertNotification: (channelType: string, message: string) => Promise<void>;
+          // Methods from OptionChainViewer.svelte
+          FetchOptionChain: (symbol: string) => Promise<any>;
           // Methods from configStore.ts
           GetConfig: () => Promise<Configuration>;
+        };
+        // Not bound in viewer mode
+        AdminService: {
+          // Methods from metricsStore.ts
+          TestAlertNotification: (channelType: string, message: string) => Promise<void>;
+          // Methods from configStore.ts
           UpdateConfig: (config: Configuration) => Promise<void>;
           SaveConfigurationAndRestart: (config: Configuration) => Promise<void>;
           PauseTradingServices: () => Promise<void>;
           ResumeTradingServices: () => Promise<void>;
-        }
+        };
       }
     }
   }
@@ -95,43 +103,38 @@ const initialMetrics: AllMetrics = {
 // Create the store
 export const metricsStore = writable<AllMetrics | null>(null);
 
-// Flag to track if polling is active
-let pollingActive = false;
-let pollingInterval: number | null = null;
-
-// Function to fetch the latest metrics
-export async function updateMetrics(): Promise<void> {
-  try {
-    // Call the real backend function
-    const metrics = await GetLatestMetrics();
+// Store metrics received from the backend
+function setMetrics(metrics: AllMetrics): void {
+  // Convert any string dates to Date objects
+  if (metrics.portfolio && metrics.portfolio.timestamp) {
+    metrics.portfolio.timestamp = new Date(metrics.portfolio.timestamp);
+  }
 
-    // Convert any string dates to Date objects
-    if (metrics.portfolio && metrics.portfolio.timestamp) {
-      metrics.portfolio.timestamp = new Date(metrics.portfolio.timestamp);
-    }
+  if (metrics.system && metrics.system.lastDataSync) {
+    metrics.system.lastDataSync = new Date(metrics.system.lastDataSync);
+  }
 
-    if (metrics.system && metrics.system.lastDataSync) {
-      metrics.system.lastDataSync = new Date(metrics.system.lastDataSync);
-    }
+  metricsStore.set(metrics);
+}
 
-    metricsStore.set(metrics);
+// Function to fetch the metrics of the backend's last refresh
+export async function updateMetrics(): Promise<void> {
+  try {
+    setMetrics(await GetLatestMetrics());
   } catch (error) {
     console.error("Failed to fetch metrics:", error);
   }
 }
 
-// Start polling for metrics updates
-export function startMetricsPolling(intervalMs: number = 10000): () => void {
-  const interval = setInterval(updateMetrics, intervalMs);
-
-  // Return cleanup function
-  return () => clearInterval(interval);
+// Subscribe to the metrics updates the backend pushes whenever the metrics change
+export function subscribeMetricsUpdates(): () => void {
+  return EventsOn('metrics-update', setMetrics);
 }
 
 // Test alert notification
 export async function testAlertNotification(channelType: string, message: string = "This is a test alert from TraderAdmin."): Promise<boolean> {
   try {
-    await window.go.main.App.TestAlertNotification(channelType, message);
+    await window.go.main.AdminService.TestAlertNotification(channelType, message);
     return true;
   } catch (error) {
     console.error(`Failed to send test ${channelType} alert:`, error);
@@ -1,10 +1,15 @@
 import { writable } from 'svelte/store';
 import { GetStatus } from '../wailsjs/go/main/App';
+import { EventsOn } from '../wailsjs/wailsjs/runtime/runtime';
 
 export interface ConnectionStatus {
   connected: boolean;
   lastConnected?: Date;
   error?: string;
+  // The active account; live is false for paper trading accounts
+  account?: string;
+  accountCode?: string;
+  live?: boolean;
 }
 
 export interface ServiceStatus {
@@ -15,13 +20,47 @@ export interface ServiceStatus {
   message?: string;
 }
 
+// What the orchestrator reports of itself over its control service
+export interface OrchestratorStatus {
+  reachable: boolean;
+  error?: string;
+  tradingActive: boolean;
+  pausedReason?: string;
+  openPositions: number;
+  lastError?: string;
+  lastErrorAt?: string;
+  configLoadedAt?: string;
+}
+
+// The scanner's version and whether TraderAdmin can use it
+export interface ScannerStatus {
+  address: string;
+  reachable: boolean;
+  error?: string;
+  version: string;
+  commit: string;
+  buildDate: string;
+  // 0 for scanners without the GetVersion RPC
+  protocolVersion: number;
+  minProtocolVersion: number;
+  compatible: boolean;
+  reason?: string;
+  disabledFeatures?: string[];
+}
+
 export interface StatusInfo {
   ibkr: ConnectionStatus;
   services: ServiceStatus[];
   activePositions: number;
   tradingActive: boolean;
   isTradingHours: boolean;
+  // Why it is not trading hours, as in "Market closed: Independence Day"
+  marketStatus?: string;
+  dryRun: boolean;
   lastUpdated: Date;
+  // Set when an [orchestrator] address is configured
+  orchestrator?: OrchestratorStatus;
+  scanner?: ScannerStatus;
 }
 
 // Create a writable store with an initial state
@@ -33,34 +72,37 @@ export const statusStore = writable<StatusInfo>({
   activePositions: 0,
   tradingActive: false,
   isTradingHours: false,
+  dryRun: false,
   lastUpdated: new Date()
 });
 
-// Function to update the status by calling the backend
+// Store a status received from the backend
+function setStatus(status: StatusInfo): void {
+  // Convert string dates to Date objects
+  if (status.ibkr.lastConnected) {
+    status.ibkr.lastConnected = new Date(status.ibkr.lastConnected);
+  }
+
+  if (status.services) {
+    status.services.forEach(service => {
+      if (service.lastChecked) {
+        service.lastChecked = new Date(service.lastChecked);
+      }
+    });
+  }
+
+  if (status.lastUpdated) {
+    status.lastUpdated = new Date(status.lastUpdated);
+  }
+
+  statusStore.set(status);
+}
+
+// Function to update the status by calling the backend; it returns the
+// status of the backend's last refresh
 export async function updateStatus(): Promise<void> {
   try {
-    // Call the real backend function
-    const status = await GetStatus();
-
-    // Convert string dates to Date objects
-    if (status.ibkr.lastConnected) {
-      status.ibkr.lastConnected = new Date(status.ibkr.lastConnected);
-    }
-
-    if (status.services) {
-      status.services.forEach(service => {
-        if (service.lastChecked) {
-          service.lastChecked = new Date(service.lastChecked);
-        }
-      });
-    }
-
-    if (status.lastUpdated) {
-      status.lastUpdated = new Date(status.lastUpdated);
-    }
-
-    // Update the store with the status from the backend
-    statusStore.set(status);
+    setStatus(await GetStatus());
   } catch (error) {
     console.error("Failed to update status:", error);
   }
@@ -76,10 +118,20 @@ function isWithinTradingHours(): boolean {
   return day >= 1 && day <= 5 && hour >= 9 && hour < 16;
 }
 
-// Set up polling interval for status updates
-export function startStatusPolling(intervalMs: number = 5000): () => void {
-  const interval = setInterval(updateStatus, intervalMs);
+// Subscribe to the status updates the backend pushes whenever the status changes
+export function subscribeStatusUpdates(): () => void {
+  return EventsOn('status-update', setStatus);
+}
+
+// Turn dry-run mode on or off; stack operations, config saves and orders
+// only report what they would do while it is on
+export async function setDryRun(enabled: boolean): Promise<void> {
+  await window.go.main.AdminService.SetDryRun(enabled);
+  statusStore.update(status => ({ ...status, dryRun: enabled }));
+}
 
-  // Return a cleanup function
-  return () => clearInterval(interval);
+// Subscribe to the dry-run mode changes the backend pushes, including those
+// of a reloaded or saved configuration
+export function subscribeDryRunChanges(): () => void {
+  return EventsOn('dryrun:changed', (dryRun: boolean) => statusStore.update(status => ({ ...status, dryRun })));
 }
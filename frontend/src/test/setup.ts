@@ -25,6 +25,7 @@ vi.mock('../wailsjs/go/main/App', () => ({
     activePositions: 0,
     tradingActive: false,
     isTradingHours: true,
+    dryRun: false,
     lastUpdated: new Date().toISOString(),
   }),
   GetLatestMetrics: vi.fn().mockResolvedValue({
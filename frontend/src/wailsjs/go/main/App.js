@@ -1,38 +1,48 @@
 // Wails bindings for Go functions
 // This is a placeholder file - in a real implementation, these would be generated by Wails
+// App is not bound itself: reads go to ReadService and changes to AdminService,
+// which is not bound in viewer mode
 
 export function GetConfig() {
-    return window.go.main.App.GetConfig();
+    return window.go.main.ReadService.GetConfig();
 }
 
 export function UpdateConfig(config) {
-    return window.go.main.App.UpdateConfig(config);
+    return window.go.main.AdminService.UpdateConfig(config);
 }
 
 export function SaveConfigurationAndRestart(config) {
-    return window.go.main.App.SaveConfigurationAndRestart(config);
+    return window.go.main.AdminService.SaveConfigurationAndRestart(config);
 }
 
 export function PauseTradingServices() {
-    return window.go.main.App.PauseTradingServices();
+    return window.go.main.AdminService.PauseTradingServices();
 }
 
 export function ResumeTradingServices() {
-    return window.go.main.App.ResumeTradingServices();
+    return window.go.main.AdminService.ResumeTradingServices();
 }
 
 export function GetLatestMetrics() {
-    return window.go.main.App.GetLatestMetrics();
+    return window.go.main.ReadService.GetLatestMetrics();
 }
 
 export function TestAlertNotification(channelType, message) {
-    return window.go.main.App.TestAlertNotification(channelType, message);
+    return window.go.main.AdminService.TestAlertNotification(channelType, message);
 }
 
 export function GetStatus() {
-    return window.go.main.App.GetStatus();
+    return window.go.main.ReadService.GetStatus();
 }
 
 export function GetConfigSchema() {
-    return window.go.main.App.GetConfigSchema();
+    return window.go.main.ReadService.GetConfigSchema();
+}
+
+export function GetStrategyParameterSchema(strategy) {
+    return window.go.main.ReadService.GetStrategyParameterSchema(strategy);
+}
+
+export function UpdateStrategyDefaults(strategy, params) {
+    return window.go.main.AdminService.UpdateStrategyDefaults(strategy, params);
 }
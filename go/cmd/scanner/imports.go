@@ -36,8 +36,8 @@ import (
 	_ "gopkg.in/yaml.v3"
 
 	// Internal imports - update these paths to match your actual project structure
-	_ "github.com/trustdan/ibkr-trader/go/src/config"
-	_ "github.com/trustdan/ibkr-trader/go/src/metrics"
+	_ "github.com/trustdan/ibkr-trader/go/pkg/proto"
+	_ "github.com/trustdan/ibkr-trader/go/pkg/scanner"
 )
 
 // This function is never called, it's just here to prevent compiler warnings
@@ -1,89 +1,315 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"runtime"
+	"runtime/pprof"
 	"syscall"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+
+	"github.com/trustdan/ibkr-trader/go/pkg/logging"
 	"github.com/trustdan/ibkr-trader/go/pkg/proto"
 	"github.com/trustdan/ibkr-trader/go/pkg/scanner"
-	"google.golang.org/grpc"
 )
 
 func main() {
 	// Parse command line flags
-	configPath := flag.String("config", "config.json", "Path to configuration file")
+	configPath := flag.String("config", "config.json", "Path to configuration file (YAML or JSON)")
+	cpuProfile := flag.String("cpuprofile", "", "write cpu profile to file")
+	memProfile := flag.String("memprofile", "", "write memory profile to file")
+	showVersion := flag.Bool("version", false, "print the version and exit")
+	configFlags := scanner.RegisterConfigFlags(flag.CommandLine)
 	flag.Parse()
 
-	// Load configuration
-	config, err := scanner.LoadConfig(*configPath)
+	if *showVersion {
+		fmt.Printf("scanner %s (commit %s, built %s, protocol %d)\n", scanner.Version, scanner.Commit, scanner.BuildDate, scanner.ProtocolVersion)
+		return
+	}
+
+	// CPU profiling if enabled
+	if *cpuProfile != "" {
+		f, err := os.Create(*cpuProfile)
+		if err != nil {
+			logrus.Fatalf("could not create CPU profile: %v", err)
+		}
+		defer f.Close()
+		if err := pprof.StartCPUProfile(f); err != nil {
+			logrus.Fatalf("could not start CPU profile: %v", err)
+		}
+		defer pprof.StopCPUProfile()
+	}
+
+	// Load configuration: the defaults, the file, SCANNER_ environment
+	// variables and flags, each overriding the last
+	config, warnings, err := scanner.LoadLayeredConfig(*configPath, configFlags)
 	if err != nil {
 		logrus.Fatalf("Failed to load configuration: %v", err)
 	}
 
 	// Configure logging
-	setupLogging(config.LogLevel)
-	logrus.Info("Starting IBKR Auto Vertical Spread Trader Scanner Service")
+	setupLogging(config, false)
+	logConfigWarnings(warnings)
+	logrus.WithFields(logrus.Fields{
+		"version":          scanner.Version,
+		"commit":           scanner.Commit,
+		"build_date":       scanner.BuildDate,
+		"protocol_version": scanner.ProtocolVersion,
+	}).Info("Starting IBKR Auto Vertical Spread Trader Scanner Service")
+	logEffectiveConfig(config)
+
+	// Set up tracing; a no-op provider is returned when it is disabled
+	tracerProvider, shutdownTracing, err := scanner.InitTracing(context.Background(), config)
+	if err != nil {
+		logrus.Fatalf("Failed to initialize tracing: %v", err)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logrus.Errorf("Failed to flush traces: %v", err)
+		}
+	}()
 
 	// Create scanner service
 	scannerService := scanner.NewScannerService(config)
+	scannerService.SetTracerProvider(tracerProvider)
+
+	// Create gRPC server with performance tuning, TLS and authentication
+	serverOptions, err := scanner.ServerOptions(config, scannerService.Metrics())
+	if err != nil {
+		logrus.Fatalf("Failed to configure gRPC server: %v", err)
+	}
 
-	// Create gRPC server
-	server := grpc.NewServer()
+	// Record the scan requests in the audit log when it is configured
+	if config.AuditLogDir != "" {
+		auditLog, err := scanner.OpenAuditLog(config.AuditLogDir, config.AuditLogMaxSizeMB, config.AuditLogMaxFiles, config.AuditLogBufferSize)
+		if err != nil {
+			logrus.Fatalf("Failed to open audit log: %v", err)
+		}
+		defer auditLog.Close()
+		scannerService.SetAuditLog(auditLog)
+		serverOptions = append(serverOptions, auditLog.ServerOptions()...)
+	}
+	server := grpc.NewServer(serverOptions...)
 	proto.RegisterScannerServiceServer(server, scannerService)
 
+	// Report health over the standard gRPC protocol; readiness waits for the
+	// data provider and can wait for the cache warm-up
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+	warming := config.WarmupEnabled && config.WarmupReadyFraction > 0
+	setServingStatus(healthServer, healthpb.HealthCheckResponse_NOT_SERVING)
+
+	// Enable reflection for debugging
+	if config.Debug {
+		reflection.Register(server)
+	}
+
+	// Start Prometheus metrics server
+	go func() {
+		http.Handle("/metrics", promhttp.Handler())
+		logrus.Infof("Starting metrics server on %s", config.MetricsAddress())
+		if err := http.ListenAndServe(config.MetricsAddress(), nil); err != nil {
+			logrus.Errorf("Failed to start metrics server: %v", err)
+		}
+	}()
+
 	// Start listening
-	listener, err := net.Listen("tcp", config.ServerAddress)
+	listener, err := net.Listen("tcp", config.ListenAddress())
 	if err != nil {
-		logrus.Fatalf("Failed to listen on %s: %v", config.ServerAddress, err)
+		logrus.Fatalf("Failed to listen on %s: %v", config.ListenAddress(), err)
 	}
-	logrus.Infof("Server listening on %s", config.ServerAddress)
+	logrus.Infof("Server listening on %s", config.ListenAddress())
+	// Bound the open connections and report them in metrics
+	listener = scanner.LimitListener(listener, config.MaxConcurrentConnections, scannerService.Metrics())
+
+	// Wait for the data provider before fetching anything; RPCs that would
+	// fetch are turned away until it answers
+	schedulerCtx, stopScheduler := context.WithCancel(context.Background())
+	defer stopScheduler()
+	providerReady := scannerService.AwaitDataProvider(schedulerCtx)
+
+	// Watch the heap against the memory watermarks
+	if config.MemoryCheckInterval > 0 {
+		go scannerService.RunMemoryGuard(schedulerCtx, config.MemoryCheckInterval)
+	}
+
+	// Continue the counters of the previous run and save them periodically; a
+	// snapshot that cannot be restored only loses the old totals
+	if snapshotFile := config.MetricsSnapshotFile; snapshotFile != "" {
+		if err := scannerService.Metrics().RestoreSnapshot(snapshotFile); err != nil {
+			logrus.Warnf("Starting metric counters from zero: %v", err)
+		}
+		go scannerService.Metrics().PersistSnapshots(schedulerCtx, snapshotFile, config.MetricsSnapshotInterval)
+	}
+
+	// Once the data provider answers, or the wait gives up, run scheduled
+	// scans until shutdown and prefetch the scan window in the background
+	go func() {
+		if err := <-providerReady; err != nil {
+			if schedulerCtx.Err() != nil {
+				return
+			}
+			logrus.Errorf("Starting without the data provider: %v", err)
+		}
+		if !warming {
+			setServingStatus(healthServer, healthpb.HealthCheckResponse_SERVING)
+		}
+		go scannerService.RunScheduler(schedulerCtx)
+		if config.WarmupEnabled {
+			scannerService.Warmup(schedulerCtx, func() {
+				if warming {
+					logrus.Info("Cache warm-up reached its ready fraction, reporting SERVING")
+					setServingStatus(healthServer, healthpb.HealthCheckResponse_SERVING)
+				}
+			})
+		}
+	}()
 
-	// Handle graceful shutdown
-	go handleShutdown(server)
+	// Handle configuration reloads and graceful shutdown
+	go handleSignals(server, scannerService, *configPath, configFlags, stopScheduler)
 
 	// Start serving
 	if err := server.Serve(listener); err != nil {
 		logrus.Fatalf("Failed to serve: %v", err)
 	}
+
+	// Save the counters of a graceful shutdown
+	if snapshotFile := config.MetricsSnapshotFile; snapshotFile != "" {
+		if err := scannerService.Metrics().SaveSnapshot(snapshotFile); err != nil {
+			logrus.Errorf("Failed to save metrics snapshot: %v", err)
+		}
+	}
+
+	// Memory profiling if enabled
+	if *memProfile != "" {
+		f, err := os.Create(*memProfile)
+		if err != nil {
+			logrus.Fatalf("could not create memory profile: %v", err)
+		}
+		defer f.Close()
+		runtime.GC() // get up-to-date statistics
+		if err := pprof.WriteHeapProfile(f); err != nil {
+			logrus.Fatalf("could not write memory profile: %v", err)
+		}
+	}
+}
+
+// logFile is the rotating log file, nil when logging only to stdout
+var logFile *logging.RotatingFile
+
+// logConfigWarnings logs the settings of the config file that are ignored
+func logConfigWarnings(warnings []scanner.ConfigWarning) {
+	for _, warning := range warnings {
+		logrus.WithFields(logrus.Fields{"key": warning.Key, "suggestion": warning.Suggestion}).Warn(warning.Message)
+	}
+}
+
+// logEffectiveConfig logs every setting with where it came from, secrets
+// redacted
+func logEffectiveConfig(config *scanner.Config) {
+	fields := logrus.Fields{}
+	for _, value := range config.Effective() {
+		fields[value.Key] = fmt.Sprintf("%s (%s)", value.Value, value.Source)
+	}
+	logrus.WithFields(fields).Info("Effective configuration")
 }
 
-// setupLogging configures the logging level
-func setupLogging(level string) {
-	// Set log format
-	logrus.SetFormatter(&logrus.TextFormatter{
-		FullTimestamp: true,
+// setupLogging configures the logging format, level and file. A failure at
+// startup is fatal; on reload the current logging is kept.
+func setupLogging(config *scanner.Config, reload bool) {
+	level := config.LogLevel
+	if config.Debug {
+		level = "debug"
+	}
+
+	file, err := logging.Setup(logrus.StandardLogger(), logging.Config{
+		Level:      level,
+		Format:     config.LogFormat,
+		File:       config.LogFile,
+		MaxSizeMB:  config.LogMaxSizeMB,
+		MaxBackups: config.LogMaxBackups,
+		MaxAgeDays: config.LogMaxAgeDays,
 	})
+	if err != nil {
+		if !reload {
+			logrus.Fatalf("Failed to configure logging: %v", err)
+		}
+		logrus.Errorf("Failed to configure logging, keeping current settings: %v", err)
+		return
+	}
 
-	// Set log level
-	switch level {
-	case "debug":
-		logrus.SetLevel(logrus.DebugLevel)
-	case "info":
-		logrus.SetLevel(logrus.InfoLevel)
-	case "warn":
-		logrus.SetLevel(logrus.WarnLevel)
-	case "error":
-		logrus.SetLevel(logrus.ErrorLevel)
-	default:
-		logrus.SetLevel(logrus.InfoLevel)
+	if logFile != nil {
+		logFile.Close()
 	}
+	logFile = file
 }
 
-// handleShutdown handles graceful shutdown on signals
-func handleShutdown(server *grpc.Server) {
+// handleSignals reloads the configuration on SIGHUP or SIGUSR1, reopens the log
+// file on SIGUSR2 and gracefully shuts down on SIGINT or SIGTERM, stopping the
+// scan scheduler first. A reload also reopens the log file.
+func handleSignals(server *grpc.Server, service *scanner.ScannerService, configPath string, configFlags *scanner.ConfigFlags, stopScheduler context.CancelFunc) {
 	// Create channel to receive signals
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	signals := append(append(reloadSignals, reopenSignals...), syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(sigChan, signals...)
 
-	// Wait for termination signal
-	sig := <-sigChan
-	logrus.Infof("Received signal %v, gracefully shutting down", sig)
+	for sig := range sigChan {
+		if isReopenSignal(sig) {
+			if logFile != nil {
+				if err := logFile.Reopen(); err != nil {
+					logrus.Errorf("Failed to reopen log file: %v", err)
+				}
+			}
+			continue
+		}
 
-	// Gracefully stop the server
-	server.GracefulStop()
-	logrus.Info("Server stopped")
+		if sig != syscall.SIGINT && sig != syscall.SIGTERM {
+			config, warnings, err := scanner.LoadLayeredConfig(configPath, configFlags)
+			if err != nil {
+				logrus.Errorf("Failed to reload configuration, keeping current settings: %v", err)
+				continue
+			}
+			setupLogging(config, true)
+			logConfigWarnings(warnings)
+			logEffectiveConfig(config)
+			service.UpdateConfig(config)
+			continue
+		}
+
+		logrus.Infof("Received signal %v, gracefully shutting down", sig)
+		stopScheduler()
+
+		// Gracefully stop the server
+		server.GracefulStop()
+		logrus.Info("Server stopped")
+		return
+	}
+}
+
+// setServingStatus sets the health of the server as a whole and of the
+// scanner service
+func setServingStatus(healthServer *health.Server, status healthpb.HealthCheckResponse_ServingStatus) {
+	healthServer.SetServingStatus("", status)
+	healthServer.SetServingStatus(proto.ScannerService_ServiceDesc.ServiceName, status)
+}
+
+// isReopenSignal reports whether sig asks for the log file to be reopened
+func isReopenSignal(sig os.Signal) bool {
+	for _, reopen := range reopenSignals {
+		if sig == reopen {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// reloadSignals trigger a configuration reload
+var reloadSignals = []os.Signal{syscall.SIGHUP, syscall.SIGUSR1}
+
+// reopenSignals reopen the log file after external rotation
+var reopenSignals = []os.Signal{syscall.SIGUSR2}
@@ -0,0 +1,15 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// reloadSignals trigger a configuration reload; Windows has no SIGUSR1
+var reloadSignals = []os.Signal{syscall.SIGHUP}
+
+// reopenSignals reopen the log file; Windows has no SIGUSR2, so only a reload
+// reopens it
+var reopenSignals []os.Signal
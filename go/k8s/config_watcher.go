@@ -2,43 +2,74 @@ package k8s
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/BurntSushi/toml"
-	"github.com/fsnotify/fsnotify"
 	"github.com/rs/zerolog/log"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/trustdan/ibkr-trader/go/pkg/configwatch"
+)
+
+// ConfigHashAnnotation is patched onto the pod template of deployments that
+// restart on config changes; a new value triggers a rolling restart
+const ConfigHashAnnotation = "traderadmin/config-hash"
+
+// DefaultRestartDebounce is how long the config must stay unchanged before
+// deployments are restarted, so a burst of saves restarts them once
+const DefaultRestartDebounce = 10 * time.Second
+
+// DefaultReloadDebounce is how long the config file must stay unchanged
+// before it is reloaded, so an editor's chunked or atomic save loads once
+const DefaultReloadDebounce = configwatch.DefaultDebounce
+
+// RestartPolicy says what happens to a deployment when the config changes
+type RestartPolicy string
+
+const (
+	// RestartAnnotate patches ConfigHashAnnotation to roll the deployment
+	RestartAnnotate RestartPolicy = "annotate-restart"
+	// RestartNone leaves the deployment to pick up the mounted file itself
+	RestartNone RestartPolicy = "none"
 )
 
 // ConfigWatcher watches for changes to a config file and triggers a callback
 type ConfigWatcher struct {
 	configPath    string
-	watcher       *fsnotify.Watcher
 	mu            sync.Mutex
-	clientset     *kubernetes.Clientset
+	clientset     kubernetes.Interface
 	namespace     string
 	configMapName string
 	callbacks     []func(map[string]interface{})
+
+	// Debounced reloads of the config file, by the watcher Start creates
+	reloadDebounce time.Duration
+	watch          *configwatch.Watcher
+
+	// Rolling restarts of the deployments listed in the config
+	restartMu       sync.Mutex
+	restartDebounce time.Duration
+	restartTimer    *time.Timer
+	pendingHash     string
+	lastAppliedHash string
+	lastAppliedAt   time.Time
 }
 
 // NewConfigWatcher creates a new ConfigWatcher
 func NewConfigWatcher(configPath, namespace, configMapName string) (*ConfigWatcher, error) {
-	// Create fsnotify watcher
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		return nil, fmt.Errorf("error creating watcher: %w", err)
-	}
-
 	// Initialize Kubernetes client
-	var clientset *kubernetes.Clientset
+	var clientset kubernetes.Interface
 
 	// Use in-cluster config if running in Kubernetes
 	config, err := rest.InClusterConfig()
@@ -58,21 +89,52 @@ func NewConfigWatcher(configPath, namespace, configMapName string) (*ConfigWatch
 	}
 
 	if config != nil {
-		clientset, err = kubernetes.NewForConfig(config)
+		cs, err := kubernetes.NewForConfig(config)
 		if err != nil {
 			log.Warn().Err(err).Msg("Failed to create Kubernetes client")
 			// Continue without K8s client
+		} else {
+			clientset = cs
 		}
 	}
 
+	return newConfigWatcher(configPath, namespace, configMapName, clientset), nil
+}
+
+// newConfigWatcher creates a ConfigWatcher using the given Kubernetes client,
+// which may be nil
+func newConfigWatcher(configPath, namespace, configMapName string, clientset kubernetes.Interface) *ConfigWatcher {
 	return &ConfigWatcher{
-		configPath:    configPath,
-		watcher:       watcher,
-		clientset:     clientset,
-		namespace:     namespace,
-		configMapName: configMapName,
-		callbacks:     []func(map[string]interface{}){},
-	}, nil
+		configPath:      configPath,
+		clientset:       clientset,
+		namespace:       namespace,
+		configMapName:   configMapName,
+		callbacks:       []func(map[string]interface{}){},
+		reloadDebounce:  DefaultReloadDebounce,
+		restartDebounce: DefaultRestartDebounce,
+	}
+}
+
+// SetReloadDebounce sets how long the config file must stay unchanged before
+// it is reloaded. Call it before Start.
+func (cw *ConfigWatcher) SetReloadDebounce(debounce time.Duration) {
+	cw.reloadDebounce = debounce
+}
+
+// SetRestartDebounce sets how long the config must stay unchanged before
+// deployments are restarted
+func (cw *ConfigWatcher) SetRestartDebounce(debounce time.Duration) {
+	cw.restartMu.Lock()
+	defer cw.restartMu.Unlock()
+	cw.restartDebounce = debounce
+}
+
+// LastAppliedHash returns the config hash last patched onto the deployments
+// and when, or "" before the first restart
+func (cw *ConfigWatcher) LastAppliedHash() (string, time.Time) {
+	cw.restartMu.Lock()
+	defer cw.restartMu.Unlock()
+	return cw.lastAppliedHash, cw.lastAppliedAt
 }
 
 // AddCallback adds a callback function that will be called with the new config when changes occur
@@ -82,7 +144,8 @@ func (cw *ConfigWatcher) AddCallback(callback func(map[string]interface{})) {
 	cw.callbacks = append(cw.callbacks, callback)
 }
 
-// Start begins watching the config file for changes
+// Start loads the config file and reloads it whenever its content changes,
+// once the file has been quiet for the reload debounce, until ctx is done
 func (cw *ConfigWatcher) Start(ctx context.Context) error {
 	// Get the config directory to watch
 	configDir := filepath.Dir(cw.configPath)
@@ -93,71 +156,60 @@ func (cw *ConfigWatcher) Start(ctx context.Context) error {
 		return fmt.Errorf("config directory does not exist: %w", err)
 	}
 
-	// Watch the config directory
-	if err := cw.watcher.Add(configDir); err != nil {
-		return fmt.Errorf("error watching directory: %w", err)
+	watch, err := configwatch.New(cw.configPath, configwatch.Options{
+		Debounce: cw.reloadDebounce,
+		Load: func(content []byte) error {
+			log.Info().Str("file", cw.configPath).Msg("Config file changed")
+			return cw.loadAndNotify(content)
+		},
+		OnError: func(err error) {
+			log.Error().Err(err).Msg("Failed to reload config")
+		},
+	})
+	if err != nil {
+		return err
 	}
+	cw.mu.Lock()
+	cw.watch = watch
+	cw.mu.Unlock()
 
 	log.Info().Str("path", configDir).Msg("Started watching config directory")
 
 	// Load the initial config
-	if err := cw.loadAndNotify(); err != nil {
+	content, err := os.ReadFile(cw.configPath)
+	if err == nil {
+		err = cw.loadAndNotify(content)
+	}
+	if err != nil {
 		log.Warn().Err(err).Msg("Failed to load initial config")
+	} else {
+		watch.MarkLoaded(content)
 	}
 
-	// Watch for changes
 	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				cw.watcher.Close()
-				return
-
-			case event, ok := <-cw.watcher.Events:
-				if !ok {
-					return
-				}
-
-				// Only care about the specific config file
-				if filepath.Base(event.Name) != filepath.Base(cw.configPath) {
-					continue
-				}
-
-				if event.Op&fsnotify.Write == fsnotify.Write || event.Op&fsnotify.Create == fsnotify.Create {
-					log.Info().Str("file", event.Name).Msg("Config file changed")
-
-					// Small delay to ensure the file is completely written
-					time.Sleep(100 * time.Millisecond)
-
-					if err := cw.loadAndNotify(); err != nil {
-						log.Error().Err(err).Msg("Failed to reload config")
-					}
-				}
-
-			case err, ok := <-cw.watcher.Errors:
-				if !ok {
-					return
-				}
-				log.Error().Err(err).Msg("Watcher error")
-			}
-		}
+		watch.Run(ctx)
+		watch.Close()
 	}()
-
 	return nil
 }
 
-// loadAndNotify loads the config file and notifies all callbacks
-func (cw *ConfigWatcher) loadAndNotify() error {
-	// Read config file
-	config, err := cw.loadConfig()
-	if err != nil {
-		return err
+// loadAndNotify parses the config file's content, pushes it to the ConfigMap
+// and notifies all callbacks. Content that does not parse is never pushed.
+func (cw *ConfigWatcher) loadAndNotify(content []byte) error {
+	var config map[string]interface{}
+	if _, err := toml.Decode(string(content), &config); err != nil {
+		return fmt.Errorf("error decoding config: %w", err)
 	}
+	log.Info().Str("path", cw.configPath).Msg("Config loaded successfully")
 
-	// Update Kubernetes ConfigMap if available
+	// Update Kubernetes ConfigMap if available, and restart the deployments
+	// that need it when its content changed
 	if cw.clientset != nil {
-		if err := cw.updateConfigMap(config); err != nil {
+		hash, changed, err := cw.updateConfigMap(content)
+		if err != nil {
 			log.Error().Err(err).Msg("Failed to update ConfigMap")
+		} else if changed {
+			cw.scheduleRestart(hash, restartPolicies(config))
 		}
 	}
 
@@ -171,33 +223,13 @@ func (cw *ConfigWatcher) loadAndNotify() error {
 	return nil
 }
 
-// loadConfig loads the config file and returns the parsed content
-func (cw *ConfigWatcher) loadConfig() (map[string]interface{}, error) {
-	var config map[string]interface{}
-
-	if _, err := os.Stat(cw.configPath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("config file does not exist: %w", err)
-	}
-
-	if _, err := toml.DecodeFile(cw.configPath, &config); err != nil {
-		return nil, fmt.Errorf("error decoding config: %w", err)
-	}
-
-	log.Info().Str("path", cw.configPath).Msg("Config loaded successfully")
-	return config, nil
-}
-
-// updateConfigMap updates a Kubernetes ConfigMap with the current config
-func (cw *ConfigWatcher) updateConfigMap(config map[string]interface{}) error {
+// updateConfigMap updates a Kubernetes ConfigMap with the loaded config file
+// content and returns the content's hash and whether the content changed
+func (cw *ConfigWatcher) updateConfigMap(fileContent []byte) (string, bool, error) {
 	if cw.clientset == nil {
-		return fmt.Errorf("Kubernetes client is not available")
-	}
-
-	// Read the config file contents
-	fileContent, err := os.ReadFile(cw.configPath)
-	if err != nil {
-		return fmt.Errorf("error reading config file: %w", err)
+		return "", false, fmt.Errorf("Kubernetes client is not available")
 	}
+	hash := configwatch.Hash(fileContent)
 
 	// Check if the ConfigMap exists
 	cmClient := cw.clientset.CoreV1().ConfigMaps(cw.namespace)
@@ -215,10 +247,15 @@ func (cw *ConfigWatcher) updateConfigMap(config map[string]interface{}) error {
 		}
 		_, err = cmClient.Create(context.Background(), cm, metav1.CreateOptions{})
 		if err != nil {
-			return fmt.Errorf("error creating ConfigMap: %w", err)
+			return "", false, fmt.Errorf("error creating ConfigMap: %w", err)
 		}
 		log.Info().Msg("Created ConfigMap with config data")
 	} else {
+		// Rewriting the same content is not a change
+		if cm.Data["config.toml"] == string(fileContent) {
+			return hash, false, nil
+		}
+
 		// Update the existing ConfigMap
 		if cm.Data == nil {
 			cm.Data = make(map[string]string)
@@ -226,17 +263,105 @@ func (cw *ConfigWatcher) updateConfigMap(config map[string]interface{}) error {
 		cm.Data["config.toml"] = string(fileContent)
 		_, err = cmClient.Update(context.Background(), cm, metav1.UpdateOptions{})
 		if err != nil {
-			return fmt.Errorf("error updating ConfigMap: %w", err)
+			return "", false, fmt.Errorf("error updating ConfigMap: %w", err)
 		}
 		log.Info().Msg("Updated ConfigMap with new config data")
 	}
 
-	return nil
+	return hash, true, nil
+}
+
+// restartPolicies reads the [kubernetes.restart_deployments] table of the
+// config, mapping deployment names to their RestartPolicy
+func restartPolicies(config map[string]interface{}) map[string]RestartPolicy {
+	policies := make(map[string]RestartPolicy)
+	kubernetesConfig, _ := config["kubernetes"].(map[string]interface{})
+	deployments, _ := kubernetesConfig["restart_deployments"].(map[string]interface{})
+	for name, value := range deployments {
+		policy, _ := value.(string)
+		switch RestartPolicy(policy) {
+		case RestartAnnotate, RestartNone:
+			policies[name] = RestartPolicy(policy)
+		default:
+			log.Warn().Str("deployment", name).Interface("policy", value).Msg("Unknown restart policy, not restarting")
+			policies[name] = RestartNone
+		}
+	}
+	return policies
+}
+
+// scheduleRestart restarts the deployments once the config has stayed at
+// hash for the debounce period; a newer change replaces a pending restart
+func (cw *ConfigWatcher) scheduleRestart(hash string, policies map[string]RestartPolicy) {
+	cw.restartMu.Lock()
+	defer cw.restartMu.Unlock()
+
+	cw.pendingHash = hash
+	if cw.restartTimer != nil {
+		cw.restartTimer.Stop()
+	}
+	cw.restartTimer = time.AfterFunc(cw.restartDebounce, func() {
+		cw.restartDeployments(hash, policies)
+	})
+}
+
+// restartDeployments patches the config hash onto the pod template of each
+// deployment whose policy is RestartAnnotate, unless a newer change is
+// pending or the hash was already applied
+func (cw *ConfigWatcher) restartDeployments(hash string, policies map[string]RestartPolicy) {
+	cw.restartMu.Lock()
+	defer cw.restartMu.Unlock()
+	if hash != cw.pendingHash || hash == cw.lastAppliedHash {
+		return
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]string{ConfigHashAnnotation: hash},
+				},
+			},
+		},
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to build restart patch")
+		return
+	}
+
+	names := make([]string, 0, len(policies))
+	for name, policy := range policies {
+		if policy == RestartAnnotate {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	deployments := cw.clientset.AppsV1().Deployments(cw.namespace)
+	for _, name := range names {
+		if _, err := deployments.Patch(context.Background(), name, types.StrategicMergePatchType, patch, metav1.PatchOptions{}); err != nil {
+			log.Error().Err(err).Str("deployment", name).Msg("Failed to restart deployment for config change")
+			continue
+		}
+		log.Info().Str("deployment", name).Str("config_hash", hash).Msg("Restarting deployment for config change")
+	}
+
+	cw.lastAppliedHash = hash
+	cw.lastAppliedAt = time.Now()
 }
 
-// Stop stops the config watcher
+// Stop stops the config watcher and drops any pending restart
 func (cw *ConfigWatcher) Stop() {
-	if cw.watcher != nil {
-		cw.watcher.Close()
+	cw.mu.Lock()
+	watch := cw.watch
+	cw.mu.Unlock()
+	if watch != nil {
+		watch.Close()
+	}
+
+	cw.restartMu.Lock()
+	defer cw.restartMu.Unlock()
+	if cw.restartTimer != nil {
+		cw.restartTimer.Stop()
 	}
 }
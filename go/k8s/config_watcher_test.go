@@ -0,0 +1,198 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/trustdan/ibkr-trader/go/pkg/configwatch"
+)
+
+const watchedConfig = `[kubernetes]
+namespace = "traderadmin"
+
+[kubernetes.restart_deployments]
+orchestrator = "annotate-restart"
+scanner = "none"
+
+[ibkr_connection]
+port = %d
+`
+
+// newRestartTestWatcher returns a watcher with a fake clientset holding the
+// orchestrator and scanner deployments
+func newRestartTestWatcher(t *testing.T) (*ConfigWatcher, *fake.Clientset) {
+	t.Helper()
+
+	client := fake.NewSimpleClientset(
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "orchestrator", Namespace: "traderadmin"}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "scanner", Namespace: "traderadmin"}},
+	)
+	cw := newConfigWatcher(filepath.Join(t.TempDir(), "config.toml"), "traderadmin", "traderadmin-config", client)
+	cw.SetRestartDebounce(20 * time.Millisecond)
+	t.Cleanup(cw.Stop)
+	return cw, client
+}
+
+// writeConfig writes the watched config with the given port and reloads it
+// the way a file event would
+func writeConfig(t *testing.T, cw *ConfigWatcher, port int) {
+	t.Helper()
+	content := []byte(fmt.Sprintf(watchedConfig, port))
+	if err := os.WriteFile(cw.configPath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cw.loadAndNotify(content); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// deploymentPatches counts the patches sent for each deployment
+func deploymentPatches(client *fake.Clientset) map[string]int {
+	patches := make(map[string]int)
+	for _, action := range client.Actions() {
+		if patch, ok := action.(k8stesting.PatchAction); ok && action.GetResource().Resource == "deployments" {
+			patches[patch.GetName()]++
+		}
+	}
+	return patches
+}
+
+// waitForApplied waits until the watcher has applied a config hash other
+// than previous
+func waitForApplied(t *testing.T, cw *ConfigWatcher, previous string) string {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if hash, _ := cw.LastAppliedHash(); hash != previous {
+			return hash
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the deployments to restart")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestConfigChangeRestartsDeploymentsOnce(t *testing.T) {
+	cw, client := newRestartTestWatcher(t)
+
+	writeConfig(t, cw, 7497)
+	hash := waitForApplied(t, cw, "")
+
+	// Only the deployment with annotate-restart is patched
+	if got := deploymentPatches(client); got["orchestrator"] != 1 || got["scanner"] != 0 {
+		t.Fatalf("Patches after the first change: %v", got)
+	}
+	deployment, err := client.AppsV1().Deployments("traderadmin").Get(context.Background(), "orchestrator", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := deployment.Spec.Template.Annotations[ConfigHashAnnotation]; got != hash {
+		t.Errorf("Pod template annotation: got %q, want %q", got, hash)
+	}
+
+	// Rewriting the same content is not a change
+	writeConfig(t, cw, 7497)
+	time.Sleep(60 * time.Millisecond)
+	if got := deploymentPatches(client); got["orchestrator"] != 1 {
+		t.Errorf("Patches after rewriting the same config: %v", got)
+	}
+
+	// A new change restarts again
+	writeConfig(t, cw, 4002)
+	if newHash := waitForApplied(t, cw, hash); newHash == hash {
+		t.Error("Expected a new hash after the second change")
+	}
+	if got := deploymentPatches(client); got["orchestrator"] != 2 {
+		t.Errorf("Patches after the second change: %v", got)
+	}
+}
+
+func TestRapidConfigChangesAreDebounced(t *testing.T) {
+	cw, client := newRestartTestWatcher(t)
+
+	// A burst of saves within the debounce period restarts once, with the
+	// last content
+	for port := 4001; port <= 4005; port++ {
+		writeConfig(t, cw, port)
+	}
+	hash := waitForApplied(t, cw, "")
+	time.Sleep(60 * time.Millisecond)
+
+	if got := deploymentPatches(client); got["orchestrator"] != 1 {
+		t.Errorf("Patches after a burst of changes: %v", got)
+	}
+	cm, err := client.CoreV1().ConfigMaps("traderadmin").Get(context.Background(), "traderadmin-config", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != configwatch.Hash([]byte(cm.Data["config.toml"])) {
+		t.Error("Applied hash is not the hash of the last config written")
+	}
+}
+
+func TestUnparsableConfigIsNotPushed(t *testing.T) {
+	cw, client := newRestartTestWatcher(t)
+	writeConfig(t, cw, 7497)
+
+	// A half-written file is not loaded, nor pushed to the ConfigMap
+	if err := cw.loadAndNotify([]byte("[kubernetes\nnamespace = ")); err == nil {
+		t.Error("Expected an error loading a half-written config")
+	}
+	cm, err := client.CoreV1().ConfigMaps("traderadmin").Get(context.Background(), "traderadmin-config", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cm.Data["config.toml"] != fmt.Sprintf(watchedConfig, 7497) {
+		t.Errorf("ConfigMap after a half-written config: %q", cm.Data["config.toml"])
+	}
+}
+
+func TestStartReloadsOnlyChangedConfig(t *testing.T) {
+	cw, _ := newRestartTestWatcher(t)
+	cw.SetReloadDebounce(20 * time.Millisecond)
+	if err := os.WriteFile(cw.configPath, []byte(fmt.Sprintf(watchedConfig, 7497)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	notified := make(chan map[string]interface{}, 10)
+	cw.AddCallback(func(config map[string]interface{}) { notified <- config })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := cw.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-notified:
+	case <-time.After(time.Second):
+		t.Fatal("Initial config was not loaded")
+	}
+
+	// Rewriting the same content is not a change
+	if err := os.WriteFile(cw.configPath, []byte(fmt.Sprintf(watchedConfig, 7497)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-notified:
+		t.Fatal("Unchanged config was reloaded")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if err := os.WriteFile(cw.configPath, []byte(fmt.Sprintf(watchedConfig, 4002)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-notified:
+	case <-time.After(time.Second):
+		t.Fatal("Changed config was not reloaded")
+	}
+}
@@ -0,0 +1,289 @@
+package calendar
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+// ErrNoEventData is returned when a provider has no event date for a symbol
+var ErrNoEventData = errors.New("no event data available")
+
+// EventCalendarProvider defines the interface for looking up corporate event dates
+type EventCalendarProvider interface {
+	// NextEarningsDate returns the next scheduled earnings date for a symbol
+	NextEarningsDate(ctx context.Context, symbol string) (time.Time, error)
+	// NextExDividendDate returns the next ex-dividend date for a symbol
+	NextExDividendDate(ctx context.Context, symbol string) (time.Time, error)
+}
+
+// NewEventCalendarProvider creates an event calendar provider of the given type,
+// wrapped with a cache when ttl is positive. The types "" and "none" disable
+// event lookups and return a nil provider; any type other than those, "mock"
+// and "http" is an error.
+func NewEventCalendarProvider(providerType, url, token string, ttl time.Duration) (EventCalendarProvider, error) {
+	var provider EventCalendarProvider
+	switch providerType {
+	case "", "none":
+		return nil, nil
+	case "mock":
+		provider = NewMockEventCalendar()
+	case "http":
+		if url == "" {
+			return nil, errors.New("the http event calendar needs a URL")
+		}
+		provider = NewHTTPEventCalendar(url, token)
+	default:
+		return nil, fmt.Errorf("unknown event calendar type %q, want none, mock or http", providerType)
+	}
+
+	if ttl > 0 {
+		return NewCachedEventCalendar(provider, ttl), nil
+	}
+	return provider, nil
+}
+
+// MockEventCalendar returns deterministic, symbol-derived event dates for testing
+type MockEventCalendar struct {
+	now func() time.Time
+}
+
+// NewMockEventCalendar creates a new mock event calendar
+func NewMockEventCalendar() *MockEventCalendar {
+	return &MockEventCalendar{now: time.Now}
+}
+
+// NextEarningsDate returns a mock earnings date within the next quarter
+func (m *MockEventCalendar) NextEarningsDate(ctx context.Context, symbol string) (time.Time, error) {
+	return m.dateFor(symbol, "earnings", 91), nil
+}
+
+// NextExDividendDate returns a mock ex-dividend date within the next quarter
+func (m *MockEventCalendar) NextExDividendDate(ctx context.Context, symbol string) (time.Time, error) {
+	return m.dateFor(symbol, "exdiv", 91), nil
+}
+
+// dateFor derives a stable offset in days from the symbol and event kind
+func (m *MockEventCalendar) dateFor(symbol, kind string, periodDays int) time.Time {
+	h := fnv.New32a()
+	h.Write([]byte(strings.ToUpper(symbol) + ":" + kind))
+	offset := int(h.Sum32()%uint32(periodDays)) + 1
+
+	today := truncateToDay(m.now())
+	return today.AddDate(0, 0, offset)
+}
+
+// HTTPEventCalendar looks up event dates from an HTTP endpoint. The URL may
+// contain a {symbol} placeholder; otherwise the symbol is appended as a path
+// segment. The endpoint must return JSON of the form
+// {"earnings_date": "YYYY-MM-DD", "ex_dividend_date": "YYYY-MM-DD"}.
+type HTTPEventCalendar struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// eventResponse is the JSON document returned by the HTTP event source
+type eventResponse struct {
+	EarningsDate   string `json:"earnings_date"`
+	ExDividendDate string `json:"ex_dividend_date"`
+}
+
+// NewHTTPEventCalendar creates a new HTTP-backed event calendar
+func NewHTTPEventCalendar(url, token string) *HTTPEventCalendar {
+	return &HTTPEventCalendar{
+		url:    url,
+		token:  token,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// NextEarningsDate fetches the next earnings date from the HTTP source
+func (h *HTTPEventCalendar) NextEarningsDate(ctx context.Context, symbol string) (time.Time, error) {
+	events, err := h.fetch(ctx, symbol)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return parseEventDate(events.EarningsDate)
+}
+
+// NextExDividendDate fetches the next ex-dividend date from the HTTP source
+func (h *HTTPEventCalendar) NextExDividendDate(ctx context.Context, symbol string) (time.Time, error) {
+	events, err := h.fetch(ctx, symbol)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return parseEventDate(events.ExDividendDate)
+}
+
+// fetch retrieves the event document for a symbol
+func (h *HTTPEventCalendar) fetch(ctx context.Context, symbol string) (*eventResponse, error) {
+	if h.url == "" {
+		return nil, fmt.Errorf("event calendar URL not configured")
+	}
+
+	url := h.url
+	if strings.Contains(url, "{symbol}") {
+		url = strings.ReplaceAll(url, "{symbol}", symbol)
+	} else {
+		url = strings.TrimSuffix(url, "/") + "/" + symbol
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating event request: %w", err)
+	}
+	if h.token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.token)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching events for %s: %w", symbol, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNoEventData
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("event source returned status %d for %s", resp.StatusCode, symbol)
+	}
+
+	var events eventResponse
+	if err := json.NewDecoder(resp.Body).Decode(&events); err != nil {
+		return nil, fmt.Errorf("error decoding events for %s: %w", symbol, err)
+	}
+
+	return &events, nil
+}
+
+// parseEventDate parses a YYYY-MM-DD date, treating empty values as missing data
+func parseEventDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, ErrNoEventData
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// CachedEventCalendar wraps a provider and caches lookups, including misses,
+// since event dates change rarely
+type CachedEventCalendar struct {
+	provider EventCalendarProvider
+	cache    *cache.Cache
+}
+
+// cachedEvent is a cached lookup result
+type cachedEvent struct {
+	date time.Time
+	err  error
+}
+
+// NewCachedEventCalendar creates a caching decorator with the given TTL
+func NewCachedEventCalendar(provider EventCalendarProvider, ttl time.Duration) *CachedEventCalendar {
+	return &CachedEventCalendar{
+		provider: provider,
+		cache:    cache.New(ttl, ttl*2),
+	}
+}
+
+// NextEarningsDate returns the cached earnings date or fetches it from the provider
+func (c *CachedEventCalendar) NextEarningsDate(ctx context.Context, symbol string) (time.Time, error) {
+	return c.lookup("earnings:"+symbol, func() (time.Time, error) {
+		return c.provider.NextEarningsDate(ctx, symbol)
+	})
+}
+
+// NextExDividendDate returns the cached ex-dividend date or fetches it from the provider
+func (c *CachedEventCalendar) NextExDividendDate(ctx context.Context, symbol string) (time.Time, error) {
+	return c.lookup("exdiv:"+symbol, func() (time.Time, error) {
+		return c.provider.NextExDividendDate(ctx, symbol)
+	})
+}
+
+// lookup serves a cached result or calls fetch, caching successes and known misses
+func (c *CachedEventCalendar) lookup(key string, fetch func() (time.Time, error)) (time.Time, error) {
+	if cached, found := c.cache.Get(key); found {
+		event := cached.(cachedEvent)
+		return event.date, event.err
+	}
+
+	date, err := fetch()
+	if err == nil || errors.Is(err, ErrNoEventData) {
+		c.cache.Set(key, cachedEvent{date: date, err: err}, cache.DefaultExpiration)
+	}
+
+	return date, err
+}
+
+// EventAvoidance holds the number of days around corporate events to avoid holding a position
+type EventAvoidance struct {
+	DaysBeforeEarnings int
+	DaysAfterEarnings  int
+	DaysBeforeExDiv    int
+}
+
+// SkipExpirationForEvents reports whether a position opened today and held to
+// expiration would overlap an avoidance window around earnings or an ex-dividend
+// date. Zero event dates are treated as unknown and never cause a skip.
+func SkipExpirationForEvents(today, expiration, earningsDate, exDivDate time.Time, avoid EventAvoidance) (bool, string) {
+	today = truncateToDay(today)
+	expiration = truncateToDay(expiration)
+
+	if !earningsDate.IsZero() {
+		earningsDate = truncateToDay(earningsDate)
+		windowStart := earningsDate.AddDate(0, 0, -avoid.DaysBeforeEarnings)
+		windowEnd := earningsDate.AddDate(0, 0, avoid.DaysAfterEarnings)
+		if !windowStart.After(expiration) && !windowEnd.Before(today) {
+			return true, fmt.Sprintf("earnings on %s within holding period", earningsDate.Format("2006-01-02"))
+		}
+	}
+
+	if !exDivDate.IsZero() {
+		exDivDate = truncateToDay(exDivDate)
+		windowStart := exDivDate.AddDate(0, 0, -avoid.DaysBeforeExDiv)
+		if !windowStart.After(expiration) && !exDivDate.Before(today) {
+			return true, fmt.Sprintf("ex-dividend on %s within holding period", exDivDate.Format("2006-01-02"))
+		}
+	}
+
+	return false, ""
+}
+
+// DescribeUpcomingEvents returns human readable notes such as "earnings in 5 days"
+// for event dates on or after today. Zero dates are ignored.
+func DescribeUpcomingEvents(today, earningsDate, exDivDate time.Time) []string {
+	var notes []string
+	if days, ok := daysUntil(today, earningsDate); ok {
+		notes = append(notes, fmt.Sprintf("earnings in %d days", days))
+	}
+	if days, ok := daysUntil(today, exDivDate); ok {
+		notes = append(notes, fmt.Sprintf("ex-dividend in %d days", days))
+	}
+	return notes
+}
+
+// daysUntil returns the number of calendar days from today until date
+func daysUntil(today, date time.Time) (int, bool) {
+	if date.IsZero() {
+		return 0, false
+	}
+	days := int(truncateToDay(date).Sub(truncateToDay(today)).Hours() / 24)
+	if days < 0 {
+		return 0, false
+	}
+	return days, true
+}
+
+// truncateToDay strips the time of day, keeping the date in UTC
+func truncateToDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
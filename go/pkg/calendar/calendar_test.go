@@ -0,0 +1,134 @@
+package calendar
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countingCalendar counts provider lookups and returns fixed dates
+type countingCalendar struct {
+	calls    int
+	earnings time.Time
+}
+
+func (c *countingCalendar) NextEarningsDate(ctx context.Context, symbol string) (time.Time, error) {
+	c.calls++
+	if c.earnings.IsZero() {
+		return time.Time{}, ErrNoEventData
+	}
+	return c.earnings, nil
+}
+
+func (c *countingCalendar) NextExDividendDate(ctx context.Context, symbol string) (time.Time, error) {
+	c.calls++
+	return time.Time{}, ErrNoEventData
+}
+
+func TestCachedEventCalendarExpiry(t *testing.T) {
+	earnings := time.Date(2024, 1, 25, 0, 0, 0, 0, time.UTC)
+	provider := &countingCalendar{earnings: earnings}
+	cached := NewCachedEventCalendar(provider, 50*time.Millisecond)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		date, err := cached.NextEarningsDate(ctx, "AAPL")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !date.Equal(earnings) {
+			t.Errorf("Earnings date mismatch: got %v, want %v", date, earnings)
+		}
+	}
+	if provider.calls != 1 {
+		t.Errorf("Provider calls before expiry: got %d, want 1", provider.calls)
+	}
+
+	// Misses are cached too so unknown symbols do not hit the source every scan
+	for i := 0; i < 2; i++ {
+		if _, err := cached.NextExDividendDate(ctx, "AAPL"); err != ErrNoEventData {
+			t.Errorf("Expected ErrNoEventData, got %v", err)
+		}
+	}
+	if provider.calls != 2 {
+		t.Errorf("Provider calls after miss: got %d, want 2", provider.calls)
+	}
+
+	time.Sleep(80 * time.Millisecond)
+
+	if _, err := cached.NextEarningsDate(ctx, "AAPL"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if provider.calls != 3 {
+		t.Errorf("Provider calls after expiry: got %d, want 3", provider.calls)
+	}
+}
+
+func TestSkipExpirationForEvents(t *testing.T) {
+	today := time.Date(2024, 3, 1, 15, 0, 0, 0, time.UTC)
+	expiration := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+	avoid := EventAvoidance{DaysBeforeEarnings: 3, DaysAfterEarnings: 1, DaysBeforeExDiv: 2}
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name     string
+		earnings time.Time
+		exDiv    time.Time
+		wantSkip bool
+	}{
+		{name: "No events", wantSkip: false},
+		{name: "Earnings before expiration", earnings: day(10), wantSkip: true},
+		{name: "Earnings just inside before-window", earnings: day(18), wantSkip: true},
+		{name: "Earnings outside before-window", earnings: day(19), wantSkip: false},
+		{name: "Earnings yesterday inside after-window", earnings: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), wantSkip: true},
+		{name: "Earnings two days ago outside after-window", earnings: time.Date(2024, 2, 28, 0, 0, 0, 0, time.UTC), wantSkip: false},
+		{name: "Ex-dividend inside window", exDiv: day(17), wantSkip: true},
+		{name: "Ex-dividend outside window", exDiv: day(18), wantSkip: false},
+		{name: "Ex-dividend already passed", exDiv: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), wantSkip: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			skip, reason := SkipExpirationForEvents(today, expiration, tt.earnings, tt.exDiv, avoid)
+			if skip != tt.wantSkip {
+				t.Errorf("SkipExpirationForEvents() = %v (%s), want %v", skip, reason, tt.wantSkip)
+			}
+		})
+	}
+}
+
+func TestDescribeUpcomingEvents(t *testing.T) {
+	today := time.Date(2024, 3, 1, 23, 0, 0, 0, time.UTC)
+	notes := DescribeUpcomingEvents(today, time.Date(2024, 3, 6, 0, 0, 0, 0, time.UTC), time.Time{})
+
+	if len(notes) != 1 || notes[0] != "earnings in 5 days" {
+		t.Errorf("Unexpected notes: %v", notes)
+	}
+}
+
+func TestNewEventCalendarProvider(t *testing.T) {
+	for _, providerType := range []string{"", "none"} {
+		if provider, err := NewEventCalendarProvider(providerType, "", "", time.Hour); provider != nil || err != nil {
+			t.Errorf("NewEventCalendarProvider(%q) = %v, %v, want disabled", providerType, provider, err)
+		}
+	}
+	if provider, err := NewEventCalendarProvider("mock", "", "", 0); err != nil {
+		t.Error(err)
+	} else if _, ok := provider.(*MockEventCalendar); !ok {
+		t.Errorf("NewEventCalendarProvider(mock) = %T", provider)
+	}
+	if provider, err := NewEventCalendarProvider("http", "https://events.example.com", "", time.Hour); err != nil {
+		t.Error(err)
+	} else if _, ok := provider.(*CachedEventCalendar); !ok {
+		t.Errorf("NewEventCalendarProvider(http) with a TTL = %T, want it cached", provider)
+	}
+
+	// Unknown types do not fall back to mock dates
+	if provider, err := NewEventCalendarProvider("nasdaq", "", "", 0); provider != nil || err == nil || !strings.Contains(err.Error(), "nasdaq") {
+		t.Errorf("NewEventCalendarProvider(nasdaq) = %v, %v, want an error", provider, err)
+	}
+	if _, err := NewEventCalendarProvider("http", "", "", 0); err == nil {
+		t.Error("An http event calendar without a URL succeeded")
+	}
+}
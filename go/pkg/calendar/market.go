@@ -0,0 +1,209 @@
+package calendar
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+	_ "time/tzdata" // exchange timezones in images without a zoneinfo database
+)
+
+// nyseSchedule is the NYSE's trading hours, holidays and early closes,
+// which TraderAdmin shares by importing this package
+//
+//go:embed nyse.json
+var nyseSchedule []byte
+
+// marketSchedule is the layout of nyse.json and of an override file. An
+// override replaces the fields it sets and adds its dates to those embedded;
+// a date with an empty name removes it.
+type marketSchedule struct {
+	Timezone    string            `json:"timezone"`
+	Open        string            `json:"open"`
+	Close       string            `json:"close"`
+	EarlyClose  string            `json:"early_close"`
+	PreMarket   string            `json:"pre_market_open"`
+	PostMarket  string            `json:"post_market_close"`
+	Holidays    map[string]string `json:"holidays"`
+	EarlyCloses map[string]string `json:"early_closes"`
+}
+
+// MarketCalendar answers whether the exchange is trading at a given time
+type MarketCalendar struct {
+	location    *time.Location
+	open        time.Duration
+	close       time.Duration
+	earlyClose  time.Duration
+	preMarket   time.Duration
+	postMarket  time.Duration
+	holidays    map[string]string
+	earlyCloses map[string]string
+}
+
+// MarketDay is the schedule of one day in the exchange's timezone. Open and
+// Close are set even when the market stays closed, as are PreMarketOpen and
+// PostMarketClose, which bound the extended sessions trading before the open
+// and after the close.
+type MarketDay struct {
+	Open            time.Time
+	Close           time.Time
+	PreMarketOpen   time.Time
+	PostMarketClose time.Time
+	Weekend         bool
+	Holiday         string // name of the holiday the market is closed for
+	EarlyClose      string // occasion the market closes early for
+}
+
+// Closed reports whether the market does not open that day
+func (d MarketDay) Closed() bool {
+	return d.Weekend || d.Holiday != ""
+}
+
+// DefaultMarketCalendar returns the embedded NYSE calendar
+func DefaultMarketCalendar() *MarketCalendar {
+	market, err := NewMarketCalendar("", "")
+	if err != nil {
+		panic(fmt.Sprintf("embedded market calendar: %v", err))
+	}
+	return market
+}
+
+// NewMarketCalendar returns the embedded NYSE calendar with the dates of
+// overrideFile applied and in timezone; either may be empty to keep the
+// embedded ones
+func NewMarketCalendar(overrideFile, timezone string) (*MarketCalendar, error) {
+	var schedule marketSchedule
+	if err := json.Unmarshal(nyseSchedule, &schedule); err != nil {
+		return nil, err
+	}
+	if overrideFile != "" {
+		data, err := os.ReadFile(overrideFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read market calendar: %w", err)
+		}
+		var override marketSchedule
+		if err := json.Unmarshal(data, &override); err != nil {
+			return nil, fmt.Errorf("failed to parse market calendar %s: %w", overrideFile, err)
+		}
+		schedule.merge(override)
+	}
+	if timezone != "" {
+		schedule.Timezone = timezone
+	}
+	return schedule.calendar()
+}
+
+// merge applies override to s
+func (s *marketSchedule) merge(override marketSchedule) {
+	for _, field := range []struct{ to, from *string }{
+		{&s.Timezone, &override.Timezone}, {&s.Open, &override.Open}, {&s.Close, &override.Close}, {&s.EarlyClose, &override.EarlyClose},
+		{&s.PreMarket, &override.PreMarket}, {&s.PostMarket, &override.PostMarket},
+	} {
+		if *field.from != "" {
+			*field.to = *field.from
+		}
+	}
+	for _, dates := range []struct{ to, from map[string]string }{
+		{s.Holidays, override.Holidays}, {s.EarlyCloses, override.EarlyCloses},
+	} {
+		for date, name := range dates.from {
+			if name == "" {
+				delete(dates.to, date)
+			} else {
+				dates.to[date] = name
+			}
+		}
+	}
+}
+
+// calendar validates s and builds the calendar of it
+func (s marketSchedule) calendar() (*MarketCalendar, error) {
+	location, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown market timezone %q: %w", s.Timezone, err)
+	}
+	market := &MarketCalendar{location: location, holidays: s.Holidays, earlyCloses: s.EarlyCloses}
+	for _, clock := range []struct {
+		to    *time.Duration
+		value string
+	}{
+		{&market.open, s.Open}, {&market.close, s.Close}, {&market.earlyClose, s.EarlyClose},
+		{&market.preMarket, s.PreMarket}, {&market.postMarket, s.PostMarket},
+	} {
+		if *clock.to, err = parseClock(clock.value); err != nil {
+			return nil, err
+		}
+	}
+	for _, dates := range []map[string]string{s.Holidays, s.EarlyCloses} {
+		for date := range dates {
+			if _, err := time.Parse("2006-01-02", date); err != nil {
+				return nil, fmt.Errorf("market calendar dates must be YYYY-MM-DD, got %q", date)
+			}
+		}
+	}
+	return market, nil
+}
+
+// parseClock returns the time of day of an HH:MM clock as an offset from
+// midnight
+func parseClock(clock string) (time.Duration, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("market hours must be HH:MM, got %q", clock)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Location returns the exchange's timezone
+func (m *MarketCalendar) Location() *time.Location {
+	return m.location
+}
+
+// Day returns the schedule of the day of t in the exchange's timezone. Its
+// clock times are wall times, so a day of a DST change keeps them.
+func (m *MarketCalendar) Day(t time.Time) MarketDay {
+	local := t.In(m.location)
+	date := local.Format("2006-01-02")
+	at := func(offset time.Duration) time.Time {
+		return time.Date(local.Year(), local.Month(), local.Day(), int(offset/time.Hour), int(offset%time.Hour/time.Minute), 0, 0, m.location)
+	}
+
+	day := MarketDay{
+		Open:            at(m.open),
+		Close:           at(m.close),
+		PreMarketOpen:   at(m.preMarket),
+		PostMarketClose: at(m.postMarket),
+		Weekend:         local.Weekday() == time.Saturday || local.Weekday() == time.Sunday,
+		Holiday:         m.holidays[date],
+		EarlyClose:      m.earlyCloses[date],
+	}
+	if day.EarlyClose != "" {
+		day.Close = at(m.earlyClose)
+	}
+	return day
+}
+
+// IsMarketOpen reports whether the exchange is trading at t
+func (m *MarketCalendar) IsMarketOpen(t time.Time) bool {
+	return m.ClosedReason(t) == ""
+}
+
+// ClosedReason explains why the exchange is not trading at t, as in "Market
+// closed: Independence Day", or is empty while it is
+func (m *MarketCalendar) ClosedReason(t time.Time) string {
+	day := m.Day(t)
+	switch {
+	case day.Holiday != "":
+		return "Market closed: " + day.Holiday
+	case day.Weekend:
+		return "Market closed: weekend"
+	case t.Before(day.Open):
+		return "Market closed: opens at " + day.Open.Format("15:04")
+	case !t.Before(day.Close) && day.EarlyClose != "":
+		return "Market closed early: " + day.EarlyClose
+	case !t.Before(day.Close):
+		return "Market closed: closed at " + day.Close.Format("15:04")
+	}
+	return ""
+}
@@ -0,0 +1,118 @@
+package calendar
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMarketClosedReason(t *testing.T) {
+	market := DefaultMarketCalendar()
+	eastern := market.Location()
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want string
+	}{
+		{name: "Regular session", at: time.Date(2024, 7, 2, 10, 0, 0, 0, eastern), want: ""},
+		{name: "Before the open", at: time.Date(2024, 7, 2, 9, 29, 0, 0, eastern), want: "Market closed: opens at 09:30"},
+		{name: "At the close", at: time.Date(2024, 7, 2, 16, 0, 0, 0, eastern), want: "Market closed: closed at 16:00"},
+		{name: "Holiday", at: time.Date(2024, 7, 4, 11, 0, 0, 0, eastern), want: "Market closed: Independence Day"},
+		{name: "Weekend", at: time.Date(2024, 7, 6, 11, 0, 0, 0, eastern), want: "Market closed: weekend"},
+		{name: "Before an early close", at: time.Date(2024, 12, 24, 12, 59, 0, 0, eastern), want: ""},
+		{name: "At an early close", at: time.Date(2024, 12, 24, 13, 0, 0, 0, eastern), want: "Market closed early: Christmas Eve"},
+		{name: "Holiday in UTC", at: time.Date(2025, 1, 1, 16, 0, 0, 0, time.UTC), want: "Market closed: New Year's Day"},
+	}
+	for _, tt := range tests {
+		if got := market.ClosedReason(tt.at); got != tt.want {
+			t.Errorf("%s: ClosedReason() = %q, want %q", tt.name, got, tt.want)
+		}
+		if got := market.IsMarketOpen(tt.at); got != (tt.want == "") {
+			t.Errorf("%s: IsMarketOpen() = %v", tt.name, got)
+		}
+	}
+}
+
+func TestMarketHoursAcrossDaylightSaving(t *testing.T) {
+	market := DefaultMarketCalendar()
+
+	// The session opens at 14:30 UTC in winter and 13:30 UTC in summer
+	tests := []struct {
+		name string
+		open time.Time
+	}{
+		{name: "Friday before spring forward", open: time.Date(2024, 3, 8, 14, 30, 0, 0, time.UTC)},
+		{name: "Monday after spring forward", open: time.Date(2024, 3, 11, 13, 30, 0, 0, time.UTC)},
+		{name: "Friday before fall back", open: time.Date(2024, 11, 1, 13, 30, 0, 0, time.UTC)},
+		{name: "Monday after fall back", open: time.Date(2024, 11, 4, 14, 30, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if market.IsMarketOpen(tt.open.Add(-time.Minute)) || !market.IsMarketOpen(tt.open) {
+			t.Errorf("%s: expected the market to open at %v", tt.name, tt.open)
+		}
+		if closing := tt.open.Add(390 * time.Minute); !market.IsMarketOpen(closing.Add(-time.Minute)) || market.IsMarketOpen(closing) {
+			t.Errorf("%s: expected the market to close at %v", tt.name, closing)
+		}
+
+		// The extended sessions run from 5.5 hours before the open to 4 after
+		// the close
+		day := market.Day(tt.open)
+		if want := tt.open.Add(-330 * time.Minute); !day.PreMarketOpen.Equal(want) {
+			t.Errorf("%s: pre-market opens at %v, want %v", tt.name, day.PreMarketOpen, want)
+		}
+		if want := tt.open.Add(630 * time.Minute); !day.PostMarketClose.Equal(want) {
+			t.Errorf("%s: after-hours close at %v, want %v", tt.name, day.PostMarketClose, want)
+		}
+	}
+}
+
+func TestNewMarketCalendarOverride(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "calendar.json")
+	override := `{"holidays": {"2024-07-02": "Exchange outage", "2024-07-04": ""}, "early_closes": {"2024-07-05": "Half day"}}`
+	if err := os.WriteFile(file, []byte(override), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	market, err := NewMarketCalendar(file, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	eastern := market.Location()
+	if reason := market.ClosedReason(time.Date(2024, 7, 2, 11, 0, 0, 0, eastern)); reason != "Market closed: Exchange outage" {
+		t.Errorf("Added holiday: got %q", reason)
+	}
+	if !market.IsMarketOpen(time.Date(2024, 7, 4, 11, 0, 0, 0, eastern)) {
+		t.Error("Expected the removed holiday to trade")
+	}
+	if day := market.Day(time.Date(2024, 7, 5, 11, 0, 0, 0, eastern)); day.EarlyClose != "Half day" || day.Close.Hour() != 13 {
+		t.Errorf("Added early close: got %+v", day)
+	}
+
+	bad := filepath.Join(dir, "bad.json")
+	os.WriteFile(bad, []byte(`{"early_closes": {"Nov 29": "Day after Thanksgiving"}}`), 0o644)
+	if _, err := NewMarketCalendar(bad, ""); err == nil {
+		t.Error("Expected an error for a malformed date")
+	}
+	if _, err := NewMarketCalendar("", "Eastern"); err == nil {
+		t.Error("Expected an error for an unknown timezone")
+	}
+	badClock := filepath.Join(dir, "clock.json")
+	os.WriteFile(badClock, []byte(`{"open": "9:30am"}`), 0o644)
+	if _, err := NewMarketCalendar(badClock, ""); err == nil {
+		t.Error("Expected an error for a malformed clock")
+	}
+	if _, err := NewMarketCalendar(filepath.Join(dir, "missing.json"), ""); err == nil {
+		t.Error("Expected an error for a missing override file")
+	}
+	if london, err := NewMarketCalendar("", "Europe/London"); err != nil || london.Location().String() != "Europe/London" {
+		t.Errorf("Calendar in Europe/London: got %v, %v", london, err)
+	}
+
+	// The embedded calendar is left as it was
+	if reason := DefaultMarketCalendar().ClosedReason(time.Date(2024, 7, 4, 11, 0, 0, 0, eastern)); reason != "Market closed: Independence Day" {
+		t.Errorf("Embedded calendar after an override: got %q", reason)
+	}
+}
@@ -0,0 +1,180 @@
+// Package configwatch reloads a config file when it changes on disk.
+//
+// Editors save in several ways: some write a file in chunks, others write a
+// temporary file and rename it over the original. A Watcher waits until the
+// file has been quiet for the debounce window, then loads it once, and only
+// when its content differs from the version last loaded.
+package configwatch
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultDebounce is how long the file must stay unchanged before it is
+// reloaded when Options sets no debounce
+const DefaultDebounce = 500 * time.Millisecond
+
+// Options configure a Watcher
+type Options struct {
+	// Debounce coalesces the events of one save; DefaultDebounce when zero
+	Debounce time.Duration
+	// Load parses, validates and applies the file's content. On error the
+	// previous version stays loaded and the same content is retried on the
+	// next change.
+	Load func(data []byte) error
+	// OnError reports failed reloads and watcher errors; they are dropped
+	// when it is nil
+	OnError func(err error)
+}
+
+// Watcher reloads one file when its content changes
+type Watcher struct {
+	path     string
+	debounce time.Duration
+	load     func(data []byte) error
+	onError  func(err error)
+	fs       *fsnotify.Watcher
+
+	mu       sync.Mutex
+	lastHash string
+}
+
+// New returns a Watcher of path. It watches the file's directory, so that
+// the file can be replaced and recreated.
+func New(path string, options Options) (*Watcher, error) {
+	if options.Load == nil {
+		return nil, fmt.Errorf("configwatch: no Load function")
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	fs, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create watcher: %w", err)
+	}
+	if err := fs.Add(filepath.Dir(absPath)); err != nil {
+		fs.Close()
+		return nil, fmt.Errorf("failed to watch %s: %w", filepath.Dir(absPath), err)
+	}
+
+	debounce := options.Debounce
+	if debounce <= 0 {
+		debounce = DefaultDebounce
+	}
+	return &Watcher{
+		path:     absPath,
+		debounce: debounce,
+		load:     options.Load,
+		onError:  options.OnError,
+		fs:       fs,
+	}, nil
+}
+
+// Hash returns the hex sha256 of data, as compared between reloads
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// MarkLoaded records data as the loaded version, so that a change to the
+// same content is not reloaded. Call it after loading or writing the file
+// outside the watcher.
+func (w *Watcher) MarkLoaded(data []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastHash = Hash(data)
+}
+
+// Run reloads the file after changes until ctx is done or the watcher is
+// closed
+func (w *Watcher) Run(ctx context.Context) {
+	// Stopped until the first event of a save
+	timer := time.NewTimer(w.debounce)
+	if !timer.Stop() {
+		<-timer.C
+	}
+	defer timer.Stop()
+
+	dir := filepath.Dir(w.path)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case event, ok := <-w.fs.Events:
+			if !ok {
+				return
+			}
+			if event.Name != w.path && event.Name != dir {
+				continue
+			}
+			if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) &&
+				!event.Has(fsnotify.Rename) && !event.Has(fsnotify.Remove) {
+				continue
+			}
+			timer.Reset(w.debounce)
+
+		case <-timer.C:
+			w.reload()
+
+		case err, ok := <-w.fs.Errors:
+			if !ok {
+				return
+			}
+			w.report(fmt.Errorf("config watcher: %w", err))
+		}
+	}
+}
+
+// reload loads the file unless it is missing or unchanged. An atomic save or
+// a recreated directory may drop the watch, so it is added again first.
+func (w *Watcher) reload() {
+	if err := w.fs.Add(filepath.Dir(w.path)); err != nil {
+		w.report(fmt.Errorf("failed to watch %s: %w", filepath.Dir(w.path), err))
+	}
+
+	data, err := os.ReadFile(w.path)
+	if err != nil {
+		// Removed for good, or between the removal and the rename of a
+		// save; the rename brings another event
+		if !os.IsNotExist(err) {
+			w.report(fmt.Errorf("failed to read %s: %w", w.path, err))
+		}
+		return
+	}
+
+	hash := Hash(data)
+	w.mu.Lock()
+	unchanged := hash == w.lastHash
+	w.mu.Unlock()
+	if unchanged {
+		return
+	}
+
+	if err := w.load(data); err != nil {
+		w.report(fmt.Errorf("failed to reload %s: %w", w.path, err))
+		return
+	}
+	w.MarkLoaded(data)
+}
+
+func (w *Watcher) report(err error) {
+	if w.onError != nil {
+		w.onError(err)
+	}
+}
+
+// Close stops watching the file
+func (w *Watcher) Close() error {
+	return w.fs.Close()
+}
@@ -0,0 +1,159 @@
+package configwatch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testDebounce = 200 * time.Millisecond
+
+// startWatcher runs a Watcher of path whose loads are sent on the returned
+// channel; loads of content containing "invalid" fail
+func startWatcher(t *testing.T, path string) (*Watcher, <-chan string) {
+	t.Helper()
+	loads := make(chan string, 10)
+	w, err := New(path, Options{
+		Debounce: testDebounce,
+		Load: func(data []byte) error {
+			if strings.Contains(string(data), "invalid") {
+				return errors.New("invalid config")
+			}
+			loads <- string(data)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go w.Run(ctx)
+	t.Cleanup(func() {
+		cancel()
+		w.Close()
+	})
+	return w, loads
+}
+
+// expectLoad waits for one load of want and no other within the debounce
+func expectLoad(t *testing.T, loads <-chan string, want string) {
+	t.Helper()
+	select {
+	case got := <-loads:
+		if got != want {
+			t.Fatalf("loaded %q, want %q", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no load of %q", want)
+	}
+	expectNoLoad(t, loads)
+}
+
+func expectNoLoad(t *testing.T, loads <-chan string) {
+	t.Helper()
+	select {
+	case got := <-loads:
+		t.Fatalf("unexpected load of %q", got)
+	case <-time.After(3 * testDebounce):
+	}
+}
+
+func TestChunkedWriteLoadsOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte("a = 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	w, loads := startWatcher(t, path)
+	w.MarkLoaded([]byte("a = 1\n"))
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, chunk := range []string{"a = 2\n", "b = ", "3\n"} {
+		if _, err := file.WriteString(chunk); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(testDebounce / 4)
+	}
+	file.Close()
+
+	expectLoad(t, loads, "a = 2\nb = 3\n")
+}
+
+func TestAtomicRenameLoadsAndKeepsWatching(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+	if err := os.WriteFile(path, []byte("a = 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, loads := startWatcher(t, path)
+
+	save := func(content string) {
+		tmp, err := os.CreateTemp(dir, "config.toml.*.tmp")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmp.WriteString(content)
+		tmp.Close()
+		if err := os.Rename(tmp.Name(), path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	save("a = 2\n")
+	expectLoad(t, loads, "a = 2\n")
+
+	// The watch survives the rename
+	save("a = 3\n")
+	expectLoad(t, loads, "a = 3\n")
+
+	// Removing and recreating the file, as some editors save
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("a = 4\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expectLoad(t, loads, "a = 4\n")
+}
+
+func TestUnchangedAndInvalidContentIsNotLoaded(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+	if err := os.WriteFile(path, []byte("a = 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	w, loads := startWatcher(t, path)
+	w.MarkLoaded([]byte("a = 1\n"))
+
+	// Rewriting the loaded content is a no-op
+	if err := os.WriteFile(path, []byte("a = 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expectNoLoad(t, loads)
+
+	// A rejected version leaves the previous one loaded
+	if err := os.WriteFile(path, []byte("invalid\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expectNoLoad(t, loads)
+	if err := os.WriteFile(path, []byte("a = 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expectNoLoad(t, loads)
+	if err := os.WriteFile(path, []byte("a = 5\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expectLoad(t, loads, "a = 5\n")
+
+	// Other files in the directory are ignored
+	if err := os.WriteFile(filepath.Join(dir, "other.toml"), []byte("b = 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expectNoLoad(t, loads)
+}
@@ -0,0 +1,151 @@
+// Package export renders scan results to CSV or JSON files for use in spreadsheets
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// Supported export formats
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// scanHeader is the CSV header row for scan result exports
+var scanHeader = []string{"scan_time", "symbol", "strategy", "signal", "event_notes"}
+
+// ScanResultRow is a single symbol/strategy/signal entry from a scan
+type ScanResultRow struct {
+	ScanTime   time.Time `json:"scan_time"`
+	Symbol     string    `json:"symbol"`
+	Strategy   string    `json:"strategy"`
+	Signal     string    `json:"signal"`
+	EventNotes []string  `json:"event_notes,omitempty"`
+}
+
+// ScanRows flattens a scan response into one row per symbol/strategy/signal,
+// ordered by symbol
+func ScanRows(resp *pb.ScanResponse, scanTime time.Time) []ScanResultRow {
+	if resp == nil {
+		return nil
+	}
+
+	symbols := make([]string, 0, len(resp.Signals))
+	for symbol := range resp.Signals {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+
+	var rows []ScanResultRow
+	for _, symbol := range symbols {
+		list := resp.Signals[symbol]
+		if list == nil {
+			continue
+		}
+		for i, signal := range list.SignalTypes {
+			row := ScanResultRow{
+				ScanTime:   scanTime.UTC(),
+				Symbol:     symbol,
+				Signal:     signal,
+				EventNotes: list.EventNotes,
+			}
+			if i < len(list.Strategies) {
+				row.Strategy = list.Strategies[i]
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	return rows
+}
+
+// WriteScanResults writes the scan response to path in the given format and
+// returns the number of rows exported
+func WriteScanResults(resp *pb.ScanResponse, scanTime time.Time, format, path string) (int, error) {
+	rows := ScanRows(resp, scanTime)
+
+	switch strings.ToLower(format) {
+	case FormatCSV:
+		records := make([][]string, 0, len(rows))
+		for _, row := range rows {
+			records = append(records, []string{
+				row.ScanTime.Format(time.RFC3339),
+				row.Symbol,
+				row.Strategy,
+				row.Signal,
+				strings.Join(row.EventNotes, "; "),
+			})
+		}
+		return len(rows), WriteCSV(path, scanHeader, records)
+	case FormatJSON:
+		if rows == nil {
+			rows = []ScanResultRow{}
+		}
+		return len(rows), WriteJSON(path, rows)
+	default:
+		return 0, fmt.Errorf("unsupported export format: %s", format)
+	}
+}
+
+// WriteCSV atomically writes a header row followed by the records to path
+func WriteCSV(path string, header []string, records [][]string) error {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(header); err != nil {
+		return fmt.Errorf("failed to encode CSV header: %w", err)
+	}
+	if err := w.WriteAll(records); err != nil {
+		return fmt.Errorf("failed to encode CSV records: %w", err)
+	}
+	return writeAtomic(path, buf.Bytes())
+}
+
+// WriteJSON atomically writes v to path as indented JSON
+func WriteJSON(path string, v interface{}) error {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	return writeAtomic(path, append(content, '\n'))
+}
+
+// writeAtomic writes content to a temp file in the destination directory and
+// renames it into place so readers never see a partial export
+func writeAtomic(path string, content []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create export directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to close export: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to move export into place: %w", err)
+	}
+	return nil
+}
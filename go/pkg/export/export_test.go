@@ -0,0 +1,97 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+func testScanResponse() *pb.ScanResponse {
+	return &pb.ScanResponse{
+		Signals: map[string]*pb.SignalList{
+			"SPY": {
+				SignalTypes: []string{"LONG", "SHORT"},
+				Strategies:  []string{"HIGH_BASE", "LOW_BASE"},
+			},
+			"BRK,B": {
+				SignalTypes: []string{"LONG"},
+				Strategies:  []string{"HIGH_BASE"},
+				EventNotes:  []string{`earnings in 3 days`, `"special" dividend`},
+			},
+		},
+	}
+}
+
+func TestWriteScanResultsCSVRoundTrip(t *testing.T) {
+	scanTime := time.Date(2024, 5, 1, 14, 30, 0, 0, time.UTC)
+	path := filepath.Join(t.TempDir(), "scan.csv")
+
+	count, err := WriteScanResults(testScanResponse(), scanTime, "CSV", path)
+	if err != nil {
+		t.Fatalf("WriteScanResults failed: %v", err)
+	}
+	if count != 3 {
+		t.Fatalf("Row count: got %d, want 3", count)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open export: %v", err)
+	}
+	defer file.Close()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+
+	want := [][]string{
+		scanHeader,
+		{"2024-05-01T14:30:00Z", "BRK,B", "HIGH_BASE", "LONG", `earnings in 3 days; "special" dividend`},
+		{"2024-05-01T14:30:00Z", "SPY", "HIGH_BASE", "LONG", ""},
+		{"2024-05-01T14:30:00Z", "SPY", "LOW_BASE", "SHORT", ""},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("CSV mismatch:\ngot  %q\nwant %q", records, want)
+	}
+
+	leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "*.tmp"))
+	if len(leftovers) != 0 {
+		t.Errorf("Temp files left behind: %v", leftovers)
+	}
+}
+
+func TestWriteScanResultsJSON(t *testing.T) {
+	scanTime := time.Date(2024, 5, 1, 14, 30, 0, 0, time.UTC)
+	path := filepath.Join(t.TempDir(), "scan.json")
+
+	count, err := WriteScanResults(testScanResponse(), scanTime, FormatJSON, path)
+	if err != nil {
+		t.Fatalf("WriteScanResults failed: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read export: %v", err)
+	}
+
+	var rows []ScanResultRow
+	if err := json.Unmarshal(content, &rows); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if len(rows) != count || !reflect.DeepEqual(rows, ScanRows(testScanResponse(), scanTime)) {
+		t.Errorf("JSON rows do not match source: %+v", rows)
+	}
+}
+
+func TestWriteScanResultsRejectsUnknownFormat(t *testing.T) {
+	if _, err := WriteScanResults(testScanResponse(), time.Now(), "xlsx", filepath.Join(t.TempDir(), "scan.xlsx")); err == nil {
+		t.Error("Expected error for unsupported format")
+	}
+}
@@ -0,0 +1,81 @@
+// Package logging configures logrus for the Go services: level, text or JSON
+// format, and an optional rotating log file alongside stdout
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Log formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Config describes how a service logs. Without a File, logs go to stdout
+// only; with one, they also go to stdout when it is a terminal.
+type Config struct {
+	Level      string
+	Format     string
+	File       string
+	MaxSizeMB  int
+	MaxBackups int
+	MaxAgeDays int
+}
+
+// Setup configures logger from cfg and returns the log file, or nil when
+// logging only to stdout. The caller closes the file, typically once a later
+// Setup has replaced it.
+func Setup(logger *logrus.Logger, cfg Config) (*RotatingFile, error) {
+	formatter, err := newFormatter(cfg.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	level, err := logrus.ParseLevel(cfg.Level)
+	if err != nil {
+		level = logrus.InfoLevel
+	}
+
+	var file *RotatingFile
+	var out io.Writer = os.Stdout
+	if cfg.File != "" {
+		maxAge := time.Duration(cfg.MaxAgeDays) * 24 * time.Hour
+		file, err = OpenRotatingFile(cfg.File, cfg.MaxSizeMB, cfg.MaxBackups, maxAge)
+		if err != nil {
+			return nil, err
+		}
+		out = file
+		if isTerminal(os.Stdout) {
+			out = io.MultiWriter(os.Stdout, file)
+		}
+	}
+
+	logger.SetFormatter(formatter)
+	logger.SetLevel(level)
+	logger.SetOutput(out)
+	return file, nil
+}
+
+// newFormatter returns the logrus formatter for format; empty means text
+func newFormatter(format string) (logrus.Formatter, error) {
+	switch format {
+	case FormatText, "":
+		return &logrus.TextFormatter{FullTimestamp: true}, nil
+	case FormatJSON:
+		return &logrus.JSONFormatter{}, nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q, expected %q or %q", format, FormatText, FormatJSON)
+	}
+}
+
+// isTerminal reports whether f is an interactive terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,36 @@
+package logging
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestSetupWritesJSONToFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "scanner.log")
+	logger := logrus.New()
+
+	file, err := Setup(logger, Config{Level: "debug", Format: FormatJSON, File: path, MaxSizeMB: 1})
+	if err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+	defer file.Close()
+
+	logger.WithField("symbol", "AAPL").Debug("scanned")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(readFile(t, path)), &entry); err != nil {
+		t.Fatalf("Log file is not JSON: %v", err)
+	}
+	if entry["msg"] != "scanned" || entry["symbol"] != "AAPL" || entry["level"] != "debug" {
+		t.Errorf("Unexpected entry: %v", entry)
+	}
+}
+
+func TestSetupRejectsUnknownFormat(t *testing.T) {
+	if _, err := Setup(logrus.New(), Config{Format: "xml"}); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,150 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestFile opens a rotating file limited to maxSize bytes whose clock
+// advances a second on every rotation
+func newTestFile(t *testing.T, maxSize int64, maxBackups int, maxAge time.Duration) *RotatingFile {
+	t.Helper()
+
+	f, err := OpenRotatingFile(filepath.Join(t.TempDir(), "scanner.log"), 0, maxBackups, maxAge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	f.maxSize = maxSize
+
+	clock := time.Date(2024, 3, 6, 15, 0, 0, 0, time.UTC)
+	f.now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+	return f
+}
+
+// logFiles returns the names of the files in the log's directory, sorted
+func logFiles(t *testing.T, f *RotatingFile) []string {
+	t.Helper()
+	entries, err := os.ReadDir(filepath.Dir(f.Path()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRotatingFileRotatesPastMaxSize(t *testing.T) {
+	f := newTestFile(t, 20, 0, 0)
+
+	// Two 9-byte lines fill the file; the third starts a new one
+	for _, line := range []string{"line 001\n", "line 002\n", "line 003\n", "line 004\n", "line 005\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	want := []string{
+		"scanner-2024-03-06T15-00-01.000.log",
+		"scanner-2024-03-06T15-00-02.000.log",
+		"scanner.log",
+	}
+	if got := logFiles(t, f); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("Files: got %v, want %v", got, want)
+	}
+
+	dir := filepath.Dir(f.Path())
+	if got := readFile(t, filepath.Join(dir, want[0])); got != "line 001\nline 002\n" {
+		t.Errorf("First backup: %q", got)
+	}
+	if got := readFile(t, filepath.Join(dir, want[1])); got != "line 003\nline 004\n" {
+		t.Errorf("Second backup: %q", got)
+	}
+	if got := readFile(t, f.Path()); got != "line 005\n" {
+		t.Errorf("Current file: %q", got)
+	}
+}
+
+func TestRotatingFileKeepsMaxBackups(t *testing.T) {
+	f := newTestFile(t, 10, 2, 0)
+	for i := 0; i < 6; i++ {
+		if _, err := f.Write([]byte("0123456789")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Five rotations, of which the newest two are kept
+	want := []string{
+		"scanner-2024-03-06T15-00-04.000.log",
+		"scanner-2024-03-06T15-00-05.000.log",
+		"scanner.log",
+	}
+	if got := logFiles(t, f); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Files: got %v, want %v", got, want)
+	}
+}
+
+func TestRotatingFileRemovesOldBackups(t *testing.T) {
+	f := newTestFile(t, 10, 0, time.Hour)
+
+	// A backup from the day before is past the age limit
+	stale := f.backupName(time.Date(2024, 3, 5, 9, 0, 0, 0, time.UTC))
+	if err := os.WriteFile(stale, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := f.Write([]byte("0123456789")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{"scanner-2024-03-06T15-00-01.000.log", "scanner.log"}
+	if got := logFiles(t, f); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Files: got %v, want %v", got, want)
+	}
+}
+
+func TestRotatingFileReopen(t *testing.T) {
+	f := newTestFile(t, 0, 0, 0)
+	if _, err := f.Write([]byte("before\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	// An external tool moves the file away, then signals a reopen
+	moved := f.Path() + ".1"
+	if err := os.Rename(f.Path(), moved); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Reopen(); err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	if _, err := f.Write([]byte("after\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readFile(t, moved); got != "before\n" {
+		t.Errorf("Moved file: %q", got)
+	}
+	if got := readFile(t, f.Path()); got != "after\n" {
+		t.Errorf("Reopened file: %q", got)
+	}
+}
@@ -0,0 +1,213 @@
+// Package metadata provides sector, industry and market-cap information per symbol
+package metadata
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Unknown is used for any metadata field that is not available
+const Unknown = "UNKNOWN"
+
+// SymbolMetadata contains descriptive information about a symbol
+type SymbolMetadata struct {
+	Symbol    string  `json:"symbol"`
+	Sector    string  `json:"sector"`
+	Industry  string  `json:"industry"`
+	MarketCap float64 `json:"market_cap"`
+}
+
+// Provider defines the interface for looking up symbol metadata. Implementations
+// return metadata with Unknown sector and industry rather than an error when a
+// symbol is not covered.
+type Provider interface {
+	Lookup(ctx context.Context, symbol string) (SymbolMetadata, error)
+}
+
+// Catalog is implemented by providers holding a snapshot of their metadata,
+// which can tell the symbols they cover from those they do not
+type Catalog interface {
+	Provider
+	// Find returns the metadata of symbol and whether it is covered
+	Find(symbol string) (SymbolMetadata, bool)
+	// ETag identifies the snapshot; it changes whenever the metadata does
+	ETag() string
+}
+
+// unknownMetadata returns placeholder metadata for a symbol without coverage
+func unknownMetadata(symbol string) SymbolMetadata {
+	return SymbolMetadata{Symbol: symbol, Sector: Unknown, Industry: Unknown}
+}
+
+// StaticProvider serves metadata loaded from a CSV or JSON file
+type StaticProvider struct {
+	entries map[string]SymbolMetadata
+	etag    string
+}
+
+var _ Catalog = (*StaticProvider)(nil)
+
+// NewStaticProvider creates a provider from the given entries
+func NewStaticProvider(entries []SymbolMetadata) *StaticProvider {
+	p := &StaticProvider{entries: make(map[string]SymbolMetadata, len(entries))}
+	for _, entry := range entries {
+		entry.Symbol = strings.ToUpper(strings.TrimSpace(entry.Symbol))
+		if entry.Sector == "" {
+			entry.Sector = Unknown
+		}
+		if entry.Industry == "" {
+			entry.Industry = Unknown
+		}
+		p.entries[entry.Symbol] = entry
+	}
+	p.etag = p.hash()
+	return p
+}
+
+// hash returns a digest of the entries, in symbol order
+func (p *StaticProvider) hash() string {
+	symbols := make([]string, 0, len(p.entries))
+	for symbol := range p.entries {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	h := sha256.New()
+	for _, symbol := range symbols {
+		entry := p.entries[symbol]
+		fmt.Fprintf(h, "%s\x00%s\x00%s\x00%g\n", entry.Symbol, entry.Sector, entry.Industry, entry.MarketCap)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// LoadStaticProvider reads metadata from a .json file (an array of entries) or a
+// CSV file with a header row of symbol, sector, industry and market_cap columns
+func LoadStaticProvider(path string) (*StaticProvider, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open metadata file: %w", err)
+	}
+	defer file.Close()
+
+	var entries []SymbolMetadata
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		if err := json.NewDecoder(file).Decode(&entries); err != nil {
+			return nil, fmt.Errorf("failed to decode metadata file: %w", err)
+		}
+	} else {
+		entries, err = parseCSV(file)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return NewStaticProvider(entries), nil
+}
+
+// parseCSV reads metadata entries from CSV with a header row
+func parseCSV(r io.Reader) ([]SymbolMetadata, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["symbol"]; !ok {
+		return nil, fmt.Errorf("metadata CSV has no symbol column")
+	}
+
+	field := func(record []string, name string) string {
+		if col, ok := columns[name]; ok && col < len(record) {
+			return strings.TrimSpace(record[col])
+		}
+		return ""
+	}
+
+	var entries []SymbolMetadata
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse metadata CSV: %w", err)
+		}
+
+		entry := SymbolMetadata{
+			Symbol:   field(record, "symbol"),
+			Sector:   field(record, "sector"),
+			Industry: field(record, "industry"),
+		}
+		if marketCap := field(record, "market_cap"); marketCap != "" {
+			entry.MarketCap, err = strconv.ParseFloat(marketCap, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid market cap for %s: %w", entry.Symbol, err)
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// Lookup implements Provider
+func (p *StaticProvider) Lookup(ctx context.Context, symbol string) (SymbolMetadata, error) {
+	entry, _ := p.Find(symbol)
+	return entry, nil
+}
+
+// Find implements Catalog
+func (p *StaticProvider) Find(symbol string) (SymbolMetadata, bool) {
+	symbol = strings.ToUpper(strings.TrimSpace(symbol))
+	entry, ok := p.entries[symbol]
+	if !ok {
+		return unknownMetadata(symbol), false
+	}
+	return entry, true
+}
+
+// ETag implements Catalog
+func (p *StaticProvider) ETag() string {
+	return p.etag
+}
+
+// Lookup returns metadata for symbol from the provider, falling back to Unknown
+// values when the provider is nil or fails
+func Lookup(ctx context.Context, provider Provider, symbol string) SymbolMetadata {
+	if provider == nil {
+		return unknownMetadata(symbol)
+	}
+	meta, err := provider.Lookup(ctx, symbol)
+	if err != nil {
+		return unknownMetadata(symbol)
+	}
+	return meta
+}
+
+// InSectors reports whether the sector matches one of the allowed sectors,
+// case-insensitively. An empty allow list matches every sector.
+func InSectors(sector string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, s := range allowed {
+		if strings.EqualFold(strings.TrimSpace(s), sector) {
+			return true
+		}
+	}
+	return false
+}
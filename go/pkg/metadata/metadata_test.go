@@ -0,0 +1,93 @@
+package metadata
+
+import (
+	"context"
+	"testing"
+)
+
+func TestLoadStaticProvider(t *testing.T) {
+	for _, path := range []string{"testdata/metadata.csv", "testdata/metadata.json"} {
+		t.Run(path, func(t *testing.T) {
+			provider, err := LoadStaticProvider(path)
+			if err != nil {
+				t.Fatalf("Failed to load metadata: %v", err)
+			}
+
+			meta, err := provider.Lookup(context.Background(), "aapl")
+			if err != nil {
+				t.Fatalf("Lookup failed: %v", err)
+			}
+			if meta.Sector != "Technology" || meta.Industry != "Consumer Electronics" || meta.MarketCap != 3e12 {
+				t.Errorf("Unexpected AAPL metadata: %+v", meta)
+			}
+
+			missing, err := provider.Lookup(context.Background(), "ZZZZ")
+			if err != nil {
+				t.Fatalf("Lookup of missing symbol failed: %v", err)
+			}
+			if missing.Symbol != "ZZZZ" || missing.Sector != Unknown || missing.Industry != Unknown {
+				t.Errorf("Missing symbol should be UNKNOWN, got %+v", missing)
+			}
+		})
+	}
+}
+
+func TestMissingIndustryIsUnknown(t *testing.T) {
+	provider, err := LoadStaticProvider("testdata/metadata.csv")
+	if err != nil {
+		t.Fatalf("Failed to load metadata: %v", err)
+	}
+
+	meta := Lookup(context.Background(), provider, "JPM")
+	if meta.Sector != "Financials" || meta.Industry != Unknown {
+		t.Errorf("Unexpected JPM metadata: %+v", meta)
+	}
+
+	if meta := Lookup(context.Background(), nil, "JPM"); meta.Sector != Unknown {
+		t.Errorf("Nil provider should yield UNKNOWN, got %+v", meta)
+	}
+}
+
+func TestInSectors(t *testing.T) {
+	tests := []struct {
+		sector  string
+		allowed []string
+		want    bool
+	}{
+		{"Technology", nil, true},
+		{"Technology", []string{"technology", "Energy"}, true},
+		{"Financials", []string{"Technology", "Energy"}, false},
+		{Unknown, []string{"Technology"}, false},
+		{Unknown, []string{"unknown"}, true},
+	}
+
+	for _, tt := range tests {
+		if got := InSectors(tt.sector, tt.allowed); got != tt.want {
+			t.Errorf("InSectors(%q, %v) = %v, want %v", tt.sector, tt.allowed, got, tt.want)
+		}
+	}
+}
+
+func TestStaticProviderETag(t *testing.T) {
+	entries := []SymbolMetadata{
+		{Symbol: "AAPL", Sector: "Technology", MarketCap: 3e12},
+		{Symbol: "xom", Sector: "Energy", MarketCap: 4.5e11},
+	}
+	provider := NewStaticProvider(entries)
+	if _, ok := provider.Find("XOM"); !ok {
+		t.Error("Find(XOM) reports it missing")
+	}
+	if meta, ok := provider.Find("ZZZZ"); ok || meta.Sector != Unknown {
+		t.Errorf("Find(ZZZZ) = %+v, %v; want it missing", meta, ok)
+	}
+
+	// The etag depends on the content, not the order it was loaded in
+	reordered := NewStaticProvider([]SymbolMetadata{entries[1], entries[0]})
+	if provider.ETag() == "" || reordered.ETag() != provider.ETag() {
+		t.Errorf("ETags %q and %q of the same metadata differ", provider.ETag(), reordered.ETag())
+	}
+	entries[1].MarketCap = 5e11
+	if changed := NewStaticProvider(entries); changed.ETag() == provider.ETag() {
+		t.Error("ETag unchanged by a new market cap")
+	}
+}
@@ -0,0 +1,6 @@
+// Package proto contains the generated gRPC bindings for proto/scanner.proto
+// and proto/orchestrator.proto, and the JSON payload of the scanner's scan
+// webhooks
+package proto
+
+//go:generate protoc -I ../../../proto --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative scanner.proto orchestrator.proto
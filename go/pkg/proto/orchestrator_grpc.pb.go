@@ -0,0 +1,228 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             v4.25.1
+// source: orchestrator.proto
+
+package proto
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	OrchestratorControl_PauseTrading_FullMethodName          = "/orchestrator.OrchestratorControl/PauseTrading"
+	OrchestratorControl_ResumeTrading_FullMethodName         = "/orchestrator.OrchestratorControl/ResumeTrading"
+	OrchestratorControl_ReloadConfig_FullMethodName          = "/orchestrator.OrchestratorControl/ReloadConfig"
+	OrchestratorControl_GetOrchestratorStatus_FullMethodName = "/orchestrator.OrchestratorControl/GetOrchestratorStatus"
+)
+
+// OrchestratorControlClient is the client API for OrchestratorControl service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type OrchestratorControlClient interface {
+	// Stop opening positions; open positions keep being managed
+	PauseTrading(ctx context.Context, in *PauseTradingRequest, opts ...grpc.CallOption) (*OrchestratorStatus, error)
+	// Start opening positions again
+	ResumeTrading(ctx context.Context, in *ResumeTradingRequest, opts ...grpc.CallOption) (*OrchestratorStatus, error)
+	// Reread the configuration file; FAILED_PRECONDITION when it is invalid,
+	// keeping the current settings
+	ReloadConfig(ctx context.Context, in *ReloadConfigRequest, opts ...grpc.CallOption) (*OrchestratorStatus, error)
+	GetOrchestratorStatus(ctx context.Context, in *OrchestratorStatusRequest, opts ...grpc.CallOption) (*OrchestratorStatus, error)
+}
+
+type orchestratorControlClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewOrchestratorControlClient(cc grpc.ClientConnInterface) OrchestratorControlClient {
+	return &orchestratorControlClient{cc}
+}
+
+func (c *orchestratorControlClient) PauseTrading(ctx context.Context, in *PauseTradingRequest, opts ...grpc.CallOption) (*OrchestratorStatus, error) {
+	out := new(OrchestratorStatus)
+	err := c.cc.Invoke(ctx, OrchestratorControl_PauseTrading_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orchestratorControlClient) ResumeTrading(ctx context.Context, in *ResumeTradingRequest, opts ...grpc.CallOption) (*OrchestratorStatus, error) {
+	out := new(OrchestratorStatus)
+	err := c.cc.Invoke(ctx, OrchestratorControl_ResumeTrading_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orchestratorControlClient) ReloadConfig(ctx context.Context, in *ReloadConfigRequest, opts ...grpc.CallOption) (*OrchestratorStatus, error) {
+	out := new(OrchestratorStatus)
+	err := c.cc.Invoke(ctx, OrchestratorControl_ReloadConfig_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orchestratorControlClient) GetOrchestratorStatus(ctx context.Context, in *OrchestratorStatusRequest, opts ...grpc.CallOption) (*OrchestratorStatus, error) {
+	out := new(OrchestratorStatus)
+	err := c.cc.Invoke(ctx, OrchestratorControl_GetOrchestratorStatus_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// OrchestratorControlServer is the server API for OrchestratorControl service.
+// All implementations must embed UnimplementedOrchestratorControlServer
+// for forward compatibility
+type OrchestratorControlServer interface {
+	// Stop opening positions; open positions keep being managed
+	PauseTrading(context.Context, *PauseTradingRequest) (*OrchestratorStatus, error)
+	// Start opening positions again
+	ResumeTrading(context.Context, *ResumeTradingRequest) (*OrchestratorStatus, error)
+	// Reread the configuration file; FAILED_PRECONDITION when it is invalid,
+	// keeping the current settings
+	ReloadConfig(context.Context, *ReloadConfigRequest) (*OrchestratorStatus, error)
+	GetOrchestratorStatus(context.Context, *OrchestratorStatusRequest) (*OrchestratorStatus, error)
+	mustEmbedUnimplementedOrchestratorControlServer()
+}
+
+// UnimplementedOrchestratorControlServer must be embedded to have forward compatible implementations.
+type UnimplementedOrchestratorControlServer struct {
+}
+
+func (UnimplementedOrchestratorControlServer) PauseTrading(context.Context, *PauseTradingRequest) (*OrchestratorStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PauseTrading not implemented")
+}
+func (UnimplementedOrchestratorControlServer) ResumeTrading(context.Context, *ResumeTradingRequest) (*OrchestratorStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResumeTrading not implemented")
+}
+func (UnimplementedOrchestratorControlServer) ReloadConfig(context.Context, *ReloadConfigRequest) (*OrchestratorStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReloadConfig not implemented")
+}
+func (UnimplementedOrchestratorControlServer) GetOrchestratorStatus(context.Context, *OrchestratorStatusRequest) (*OrchestratorStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetOrchestratorStatus not implemented")
+}
+func (UnimplementedOrchestratorControlServer) mustEmbedUnimplementedOrchestratorControlServer() {}
+
+// UnsafeOrchestratorControlServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to OrchestratorControlServer will
+// result in compilation errors.
+type UnsafeOrchestratorControlServer interface {
+	mustEmbedUnimplementedOrchestratorControlServer()
+}
+
+func RegisterOrchestratorControlServer(s grpc.ServiceRegistrar, srv OrchestratorControlServer) {
+	s.RegisterService(&OrchestratorControl_ServiceDesc, srv)
+}
+
+func _OrchestratorControl_PauseTrading_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PauseTradingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorControlServer).PauseTrading(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OrchestratorControl_PauseTrading_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorControlServer).PauseTrading(ctx, req.(*PauseTradingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OrchestratorControl_ResumeTrading_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResumeTradingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorControlServer).ResumeTrading(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OrchestratorControl_ResumeTrading_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorControlServer).ResumeTrading(ctx, req.(*ResumeTradingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OrchestratorControl_ReloadConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReloadConfigRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorControlServer).ReloadConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OrchestratorControl_ReloadConfig_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorControlServer).ReloadConfig(ctx, req.(*ReloadConfigRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OrchestratorControl_GetOrchestratorStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(OrchestratorStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorControlServer).GetOrchestratorStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: OrchestratorControl_GetOrchestratorStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorControlServer).GetOrchestratorStatus(ctx, req.(*OrchestratorStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// OrchestratorControl_ServiceDesc is the grpc.ServiceDesc for OrchestratorControl service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var OrchestratorControl_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "orchestrator.OrchestratorControl",
+	HandlerType: (*OrchestratorControlServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "PauseTrading",
+			Handler:    _OrchestratorControl_PauseTrading_Handler,
+		},
+		{
+			MethodName: "ResumeTrading",
+			Handler:    _OrchestratorControl_ResumeTrading_Handler,
+		},
+		{
+			MethodName: "ReloadConfig",
+			Handler:    _OrchestratorControl_ReloadConfig_Handler,
+		},
+		{
+			MethodName: "GetOrchestratorStatus",
+			Handler:    _OrchestratorControl_GetOrchestratorStatus_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "orchestrator.proto",
+}
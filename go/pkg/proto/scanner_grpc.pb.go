@@ -0,0 +1,820 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             v4.25.1
+// source: scanner.proto
+
+package proto
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	ScannerService_Scan_FullMethodName               = "/scanner.ScannerService/Scan"
+	ScannerService_BulkFetch_FullMethodName          = "/scanner.ScannerService/BulkFetch"
+	ScannerService_BulkFetchStream_FullMethodName    = "/scanner.ScannerService/BulkFetchStream"
+	ScannerService_GetMetrics_FullMethodName         = "/scanner.ScannerService/GetMetrics"
+	ScannerService_GetScanResults_FullMethodName     = "/scanner.ScannerService/GetScanResults"
+	ScannerService_GetScanHistory_FullMethodName     = "/scanner.ScannerService/GetScanHistory"
+	ScannerService_ExportResults_FullMethodName      = "/scanner.ScannerService/ExportResults"
+	ScannerService_Backtest_FullMethodName           = "/scanner.ScannerService/Backtest"
+	ScannerService_GetSymbolHealth_FullMethodName    = "/scanner.ScannerService/GetSymbolHealth"
+	ScannerService_ResetSymbolHealth_FullMethodName  = "/scanner.ScannerService/ResetSymbolHealth"
+	ScannerService_ListProfiles_FullMethodName       = "/scanner.ScannerService/ListProfiles"
+	ScannerService_ListStrategies_FullMethodName     = "/scanner.ScannerService/ListStrategies"
+	ScannerService_GetAuditLog_FullMethodName        = "/scanner.ScannerService/GetAuditLog"
+	ScannerService_GetEffectiveConfig_FullMethodName = "/scanner.ScannerService/GetEffectiveConfig"
+	ScannerService_GetVersion_FullMethodName         = "/scanner.ScannerService/GetVersion"
+	ScannerService_GetDataQuality_FullMethodName     = "/scanner.ScannerService/GetDataQuality"
+	ScannerService_GetSymbolMetadata_FullMethodName  = "/scanner.ScannerService/GetSymbolMetadata"
+)
+
+// ScannerServiceClient is the client API for ScannerService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ScannerServiceClient interface {
+	// Scan a list of symbols for trading signals
+	Scan(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (*ScanResponse, error)
+	// Fetch historical data for multiple symbols. A response larger than the
+	// message size limit fails with RESOURCE_EXHAUSTED; page it or stream it.
+	BulkFetch(ctx context.Context, in *BulkFetchRequest, opts ...grpc.CallOption) (*BulkFetchResponse, error)
+	// Fetch historical data for multiple symbols, streaming each symbol's data
+	// in request order as soon as it is ready. A slow reader slows the fetch
+	// rather than the data piling up in the scanner.
+	BulkFetchStream(ctx context.Context, in *BulkFetchRequest, opts ...grpc.CallOption) (ScannerService_BulkFetchStreamClient, error)
+	// Get real-time performance metrics
+	GetMetrics(ctx context.Context, in *MetricsRequest, opts ...grpc.CallOption) (*MetricsResponse, error)
+	// Retrieve the results of the latest scan
+	GetScanResults(ctx context.Context, in *ResultsRequest, opts ...grpc.CallOption) (*ScanResponse, error)
+	// Retrieve the signals of the recent scans kept in the scan history
+	GetScanHistory(ctx context.Context, in *ScanHistoryRequest, opts ...grpc.CallOption) (*ScanHistoryResponse, error)
+	// Export the latest scan results to a CSV or JSON file
+	ExportResults(ctx context.Context, in *ExportRequest, opts ...grpc.CallOption) (*ExportResponse, error)
+	// Replay strategies over historical data, streaming progress followed by the
+	// signals raised and their forward returns
+	Backtest(ctx context.Context, in *BacktestRequest, opts ...grpc.CallOption) (ScannerService_BacktestClient, error)
+	// List the symbols whose fetches have been failing, including those skipped
+	// by scans while they cool down after repeated timeouts
+	GetSymbolHealth(ctx context.Context, in *SymbolHealthRequest, opts ...grpc.CallOption) (*SymbolHealthResponse, error)
+	// Forget the failures of symbols, readmitting them to scans
+	ResetSymbolHealth(ctx context.Context, in *ResetSymbolHealthRequest, opts ...grpc.CallOption) (*ResetSymbolHealthResponse, error)
+	// List the scan profiles configured on the server
+	ListProfiles(ctx context.Context, in *ListProfilesRequest, opts ...grpc.CallOption) (*ListProfilesResponse, error)
+	// List the strategies scans can evaluate, built-in and custom ones defined
+	// by rules in the server config
+	ListStrategies(ctx context.Context, in *ListStrategiesRequest, opts ...grpc.CallOption) (*ListStrategiesResponse, error)
+	// Retrieve the latest records of the audit log of Scan, BulkFetch and
+	// Backtest calls; FAILED_PRECONDITION when the audit log is disabled
+	GetAuditLog(ctx context.Context, in *AuditLogRequest, opts ...grpc.CallOption) (*AuditLogResponse, error)
+	// Report the configuration in effect and where each setting came from:
+	// the defaults, the config file, an environment variable or a flag.
+	// Secrets are redacted.
+	GetEffectiveConfig(ctx context.Context, in *EffectiveConfigRequest, opts ...grpc.CallOption) (*EffectiveConfigResponse, error)
+	// Report the scanner's build and the protocol version of its RPCs, which
+	// clients check for compatibility. Scanners older than this RPC answer
+	// UNIMPLEMENTED and are taken to speak protocol version 0.
+	GetVersion(ctx context.Context, in *VersionRequest, opts ...grpc.CallOption) (*VersionResponse, error)
+	// Report the data quality checks of the symbols scanned, the latest one of
+	// each symbol
+	GetDataQuality(ctx context.Context, in *DataQualityRequest, opts ...grpc.CallOption) (*DataQualityResponse, error)
+	// Return the sector, industry and market cap the scanner holds for up to
+	// 500 symbols, with an etag of its metadata snapshot. A request whose
+	// if_none_match is the current etag is answered not_modified, without
+	// the symbols.
+	GetSymbolMetadata(ctx context.Context, in *SymbolMetadataRequest, opts ...grpc.CallOption) (*SymbolMetadataResponse, error)
+}
+
+type scannerServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewScannerServiceClient(cc grpc.ClientConnInterface) ScannerServiceClient {
+	return &scannerServiceClient{cc}
+}
+
+func (c *scannerServiceClient) Scan(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (*ScanResponse, error) {
+	out := new(ScanResponse)
+	err := c.cc.Invoke(ctx, ScannerService_Scan_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *scannerServiceClient) BulkFetch(ctx context.Context, in *BulkFetchRequest, opts ...grpc.CallOption) (*BulkFetchResponse, error) {
+	out := new(BulkFetchResponse)
+	err := c.cc.Invoke(ctx, ScannerService_BulkFetch_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *scannerServiceClient) BulkFetchStream(ctx context.Context, in *BulkFetchRequest, opts ...grpc.CallOption) (ScannerService_BulkFetchStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &ScannerService_ServiceDesc.Streams[0], ScannerService_BulkFetchStream_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &scannerServiceBulkFetchStreamClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type ScannerService_BulkFetchStreamClient interface {
+	Recv() (*SymbolData, error)
+	grpc.ClientStream
+}
+
+type scannerServiceBulkFetchStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *scannerServiceBulkFetchStreamClient) Recv() (*SymbolData, error) {
+	m := new(SymbolData)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *scannerServiceClient) GetMetrics(ctx context.Context, in *MetricsRequest, opts ...grpc.CallOption) (*MetricsResponse, error) {
+	out := new(MetricsResponse)
+	err := c.cc.Invoke(ctx, ScannerService_GetMetrics_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *scannerServiceClient) GetScanResults(ctx context.Context, in *ResultsRequest, opts ...grpc.CallOption) (*ScanResponse, error) {
+	out := new(ScanResponse)
+	err := c.cc.Invoke(ctx, ScannerService_GetScanResults_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *scannerServiceClient) GetScanHistory(ctx context.Context, in *ScanHistoryRequest, opts ...grpc.CallOption) (*ScanHistoryResponse, error) {
+	out := new(ScanHistoryResponse)
+	err := c.cc.Invoke(ctx, ScannerService_GetScanHistory_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *scannerServiceClient) ExportResults(ctx context.Context, in *ExportRequest, opts ...grpc.CallOption) (*ExportResponse, error) {
+	out := new(ExportResponse)
+	err := c.cc.Invoke(ctx, ScannerService_ExportResults_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *scannerServiceClient) Backtest(ctx context.Context, in *BacktestRequest, opts ...grpc.CallOption) (ScannerService_BacktestClient, error) {
+	stream, err := c.cc.NewStream(ctx, &ScannerService_ServiceDesc.Streams[1], ScannerService_Backtest_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &scannerServiceBacktestClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type ScannerService_BacktestClient interface {
+	Recv() (*BacktestUpdate, error)
+	grpc.ClientStream
+}
+
+type scannerServiceBacktestClient struct {
+	grpc.ClientStream
+}
+
+func (x *scannerServiceBacktestClient) Recv() (*BacktestUpdate, error) {
+	m := new(BacktestUpdate)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *scannerServiceClient) GetSymbolHealth(ctx context.Context, in *SymbolHealthRequest, opts ...grpc.CallOption) (*SymbolHealthResponse, error) {
+	out := new(SymbolHealthResponse)
+	err := c.cc.Invoke(ctx, ScannerService_GetSymbolHealth_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *scannerServiceClient) ResetSymbolHealth(ctx context.Context, in *ResetSymbolHealthRequest, opts ...grpc.CallOption) (*ResetSymbolHealthResponse, error) {
+	out := new(ResetSymbolHealthResponse)
+	err := c.cc.Invoke(ctx, ScannerService_ResetSymbolHealth_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *scannerServiceClient) ListProfiles(ctx context.Context, in *ListProfilesRequest, opts ...grpc.CallOption) (*ListProfilesResponse, error) {
+	out := new(ListProfilesResponse)
+	err := c.cc.Invoke(ctx, ScannerService_ListProfiles_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *scannerServiceClient) ListStrategies(ctx context.Context, in *ListStrategiesRequest, opts ...grpc.CallOption) (*ListStrategiesResponse, error) {
+	out := new(ListStrategiesResponse)
+	err := c.cc.Invoke(ctx, ScannerService_ListStrategies_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *scannerServiceClient) GetAuditLog(ctx context.Context, in *AuditLogRequest, opts ...grpc.CallOption) (*AuditLogResponse, error) {
+	out := new(AuditLogResponse)
+	err := c.cc.Invoke(ctx, ScannerService_GetAuditLog_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *scannerServiceClient) GetEffectiveConfig(ctx context.Context, in *EffectiveConfigRequest, opts ...grpc.CallOption) (*EffectiveConfigResponse, error) {
+	out := new(EffectiveConfigResponse)
+	err := c.cc.Invoke(ctx, ScannerService_GetEffectiveConfig_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *scannerServiceClient) GetVersion(ctx context.Context, in *VersionRequest, opts ...grpc.CallOption) (*VersionResponse, error) {
+	out := new(VersionResponse)
+	err := c.cc.Invoke(ctx, ScannerService_GetVersion_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *scannerServiceClient) GetDataQuality(ctx context.Context, in *DataQualityRequest, opts ...grpc.CallOption) (*DataQualityResponse, error) {
+	out := new(DataQualityResponse)
+	err := c.cc.Invoke(ctx, ScannerService_GetDataQuality_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *scannerServiceClient) GetSymbolMetadata(ctx context.Context, in *SymbolMetadataRequest, opts ...grpc.CallOption) (*SymbolMetadataResponse, error) {
+	out := new(SymbolMetadataResponse)
+	err := c.cc.Invoke(ctx, ScannerService_GetSymbolMetadata_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ScannerServiceServer is the server API for ScannerService service.
+// All implementations must embed UnimplementedScannerServiceServer
+// for forward compatibility
+type ScannerServiceServer interface {
+	// Scan a list of symbols for trading signals
+	Scan(context.Context, *ScanRequest) (*ScanResponse, error)
+	// Fetch historical data for multiple symbols. A response larger than the
+	// message size limit fails with RESOURCE_EXHAUSTED; page it or stream it.
+	BulkFetch(context.Context, *BulkFetchRequest) (*BulkFetchResponse, error)
+	// Fetch historical data for multiple symbols, streaming each symbol's data
+	// in request order as soon as it is ready. A slow reader slows the fetch
+	// rather than the data piling up in the scanner.
+	BulkFetchStream(*BulkFetchRequest, ScannerService_BulkFetchStreamServer) error
+	// Get real-time performance metrics
+	GetMetrics(context.Context, *MetricsRequest) (*MetricsResponse, error)
+	// Retrieve the results of the latest scan
+	GetScanResults(context.Context, *ResultsRequest) (*ScanResponse, error)
+	// Retrieve the signals of the recent scans kept in the scan history
+	GetScanHistory(context.Context, *ScanHistoryRequest) (*ScanHistoryResponse, error)
+	// Export the latest scan results to a CSV or JSON file
+	ExportResults(context.Context, *ExportRequest) (*ExportResponse, error)
+	// Replay strategies over historical data, streaming progress followed by the
+	// signals raised and their forward returns
+	Backtest(*BacktestRequest, ScannerService_BacktestServer) error
+	// List the symbols whose fetches have been failing, including those skipped
+	// by scans while they cool down after repeated timeouts
+	GetSymbolHealth(context.Context, *SymbolHealthRequest) (*SymbolHealthResponse, error)
+	// Forget the failures of symbols, readmitting them to scans
+	ResetSymbolHealth(context.Context, *ResetSymbolHealthRequest) (*ResetSymbolHealthResponse, error)
+	// List the scan profiles configured on the server
+	ListProfiles(context.Context, *ListProfilesRequest) (*ListProfilesResponse, error)
+	// List the strategies scans can evaluate, built-in and custom ones defined
+	// by rules in the server config
+	ListStrategies(context.Context, *ListStrategiesRequest) (*ListStrategiesResponse, error)
+	// Retrieve the latest records of the audit log of Scan, BulkFetch and
+	// Backtest calls; FAILED_PRECONDITION when the audit log is disabled
+	GetAuditLog(context.Context, *AuditLogRequest) (*AuditLogResponse, error)
+	// Report the configuration in effect and where each setting came from:
+	// the defaults, the config file, an environment variable or a flag.
+	// Secrets are redacted.
+	GetEffectiveConfig(context.Context, *EffectiveConfigRequest) (*EffectiveConfigResponse, error)
+	// Report the scanner's build and the protocol version of its RPCs, which
+	// clients check for compatibility. Scanners older than this RPC answer
+	// UNIMPLEMENTED and are taken to speak protocol version 0.
+	GetVersion(context.Context, *VersionRequest) (*VersionResponse, error)
+	// Report the data quality checks of the symbols scanned, the latest one of
+	// each symbol
+	GetDataQuality(context.Context, *DataQualityRequest) (*DataQualityResponse, error)
+	// Return the sector, industry and market cap the scanner holds for up to
+	// 500 symbols, with an etag of its metadata snapshot. A request whose
+	// if_none_match is the current etag is answered not_modified, without
+	// the symbols.
+	GetSymbolMetadata(context.Context, *SymbolMetadataRequest) (*SymbolMetadataResponse, error)
+	mustEmbedUnimplementedScannerServiceServer()
+}
+
+// UnimplementedScannerServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedScannerServiceServer struct {
+}
+
+func (UnimplementedScannerServiceServer) Scan(context.Context, *ScanRequest) (*ScanResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Scan not implemented")
+}
+func (UnimplementedScannerServiceServer) BulkFetch(context.Context, *BulkFetchRequest) (*BulkFetchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BulkFetch not implemented")
+}
+func (UnimplementedScannerServiceServer) BulkFetchStream(*BulkFetchRequest, ScannerService_BulkFetchStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method BulkFetchStream not implemented")
+}
+func (UnimplementedScannerServiceServer) GetMetrics(context.Context, *MetricsRequest) (*MetricsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMetrics not implemented")
+}
+func (UnimplementedScannerServiceServer) GetScanResults(context.Context, *ResultsRequest) (*ScanResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetScanResults not implemented")
+}
+func (UnimplementedScannerServiceServer) GetScanHistory(context.Context, *ScanHistoryRequest) (*ScanHistoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetScanHistory not implemented")
+}
+func (UnimplementedScannerServiceServer) ExportResults(context.Context, *ExportRequest) (*ExportResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExportResults not implemented")
+}
+func (UnimplementedScannerServiceServer) Backtest(*BacktestRequest, ScannerService_BacktestServer) error {
+	return status.Errorf(codes.Unimplemented, "method Backtest not implemented")
+}
+func (UnimplementedScannerServiceServer) GetSymbolHealth(context.Context, *SymbolHealthRequest) (*SymbolHealthResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSymbolHealth not implemented")
+}
+func (UnimplementedScannerServiceServer) ResetSymbolHealth(context.Context, *ResetSymbolHealthRequest) (*ResetSymbolHealthResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResetSymbolHealth not implemented")
+}
+func (UnimplementedScannerServiceServer) ListProfiles(context.Context, *ListProfilesRequest) (*ListProfilesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListProfiles not implemented")
+}
+func (UnimplementedScannerServiceServer) ListStrategies(context.Context, *ListStrategiesRequest) (*ListStrategiesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListStrategies not implemented")
+}
+func (UnimplementedScannerServiceServer) GetAuditLog(context.Context, *AuditLogRequest) (*AuditLogResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAuditLog not implemented")
+}
+func (UnimplementedScannerServiceServer) GetEffectiveConfig(context.Context, *EffectiveConfigRequest) (*EffectiveConfigResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetEffectiveConfig not implemented")
+}
+func (UnimplementedScannerServiceServer) GetVersion(context.Context, *VersionRequest) (*VersionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetVersion not implemented")
+}
+func (UnimplementedScannerServiceServer) GetDataQuality(context.Context, *DataQualityRequest) (*DataQualityResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDataQuality not implemented")
+}
+func (UnimplementedScannerServiceServer) GetSymbolMetadata(context.Context, *SymbolMetadataRequest) (*SymbolMetadataResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSymbolMetadata not implemented")
+}
+func (UnimplementedScannerServiceServer) mustEmbedUnimplementedScannerServiceServer() {}
+
+// UnsafeScannerServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ScannerServiceServer will
+// result in compilation errors.
+type UnsafeScannerServiceServer interface {
+	mustEmbedUnimplementedScannerServiceServer()
+}
+
+func RegisterScannerServiceServer(s grpc.ServiceRegistrar, srv ScannerServiceServer) {
+	s.RegisterService(&ScannerService_ServiceDesc, srv)
+}
+
+func _ScannerService_Scan_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScanRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ScannerServiceServer).Scan(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ScannerService_Scan_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ScannerServiceServer).Scan(ctx, req.(*ScanRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ScannerService_BulkFetch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BulkFetchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ScannerServiceServer).BulkFetch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ScannerService_BulkFetch_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ScannerServiceServer).BulkFetch(ctx, req.(*BulkFetchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ScannerService_BulkFetchStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(BulkFetchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ScannerServiceServer).BulkFetchStream(m, &scannerServiceBulkFetchStreamServer{stream})
+}
+
+type ScannerService_BulkFetchStreamServer interface {
+	Send(*SymbolData) error
+	grpc.ServerStream
+}
+
+type scannerServiceBulkFetchStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *scannerServiceBulkFetchStreamServer) Send(m *SymbolData) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _ScannerService_GetMetrics_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MetricsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ScannerServiceServer).GetMetrics(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ScannerService_GetMetrics_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ScannerServiceServer).GetMetrics(ctx, req.(*MetricsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ScannerService_GetScanResults_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResultsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ScannerServiceServer).GetScanResults(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ScannerService_GetScanResults_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ScannerServiceServer).GetScanResults(ctx, req.(*ResultsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ScannerService_GetScanHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScanHistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ScannerServiceServer).GetScanHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ScannerService_GetScanHistory_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ScannerServiceServer).GetScanHistory(ctx, req.(*ScanHistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ScannerService_ExportResults_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExportRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ScannerServiceServer).ExportResults(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ScannerService_ExportResults_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ScannerServiceServer).ExportResults(ctx, req.(*ExportRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ScannerService_Backtest_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(BacktestRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ScannerServiceServer).Backtest(m, &scannerServiceBacktestServer{stream})
+}
+
+type ScannerService_BacktestServer interface {
+	Send(*BacktestUpdate) error
+	grpc.ServerStream
+}
+
+type scannerServiceBacktestServer struct {
+	grpc.ServerStream
+}
+
+func (x *scannerServiceBacktestServer) Send(m *BacktestUpdate) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _ScannerService_GetSymbolHealth_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SymbolHealthRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ScannerServiceServer).GetSymbolHealth(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ScannerService_GetSymbolHealth_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ScannerServiceServer).GetSymbolHealth(ctx, req.(*SymbolHealthRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ScannerService_ResetSymbolHealth_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResetSymbolHealthRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ScannerServiceServer).ResetSymbolHealth(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ScannerService_ResetSymbolHealth_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ScannerServiceServer).ResetSymbolHealth(ctx, req.(*ResetSymbolHealthRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ScannerService_ListProfiles_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListProfilesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ScannerServiceServer).ListProfiles(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ScannerService_ListProfiles_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ScannerServiceServer).ListProfiles(ctx, req.(*ListProfilesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ScannerService_ListStrategies_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListStrategiesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ScannerServiceServer).ListStrategies(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ScannerService_ListStrategies_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ScannerServiceServer).ListStrategies(ctx, req.(*ListStrategiesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ScannerService_GetAuditLog_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AuditLogRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ScannerServiceServer).GetAuditLog(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ScannerService_GetAuditLog_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ScannerServiceServer).GetAuditLog(ctx, req.(*AuditLogRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ScannerService_GetEffectiveConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EffectiveConfigRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ScannerServiceServer).GetEffectiveConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ScannerService_GetEffectiveConfig_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ScannerServiceServer).GetEffectiveConfig(ctx, req.(*EffectiveConfigRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ScannerService_GetVersion_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VersionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ScannerServiceServer).GetVersion(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ScannerService_GetVersion_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ScannerServiceServer).GetVersion(ctx, req.(*VersionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ScannerService_GetDataQuality_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DataQualityRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ScannerServiceServer).GetDataQuality(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ScannerService_GetDataQuality_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ScannerServiceServer).GetDataQuality(ctx, req.(*DataQualityRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ScannerService_GetSymbolMetadata_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SymbolMetadataRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ScannerServiceServer).GetSymbolMetadata(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ScannerService_GetSymbolMetadata_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ScannerServiceServer).GetSymbolMetadata(ctx, req.(*SymbolMetadataRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// ScannerService_ServiceDesc is the grpc.ServiceDesc for ScannerService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ScannerService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "scanner.ScannerService",
+	HandlerType: (*ScannerServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Scan",
+			Handler:    _ScannerService_Scan_Handler,
+		},
+		{
+			MethodName: "BulkFetch",
+			Handler:    _ScannerService_BulkFetch_Handler,
+		},
+		{
+			MethodName: "GetMetrics",
+			Handler:    _ScannerService_GetMetrics_Handler,
+		},
+		{
+			MethodName: "GetScanResults",
+			Handler:    _ScannerService_GetScanResults_Handler,
+		},
+		{
+			MethodName: "GetScanHistory",
+			Handler:    _ScannerService_GetScanHistory_Handler,
+		},
+		{
+			MethodName: "ExportResults",
+			Handler:    _ScannerService_ExportResults_Handler,
+		},
+		{
+			MethodName: "GetSymbolHealth",
+			Handler:    _ScannerService_GetSymbolHealth_Handler,
+		},
+		{
+			MethodName: "ResetSymbolHealth",
+			Handler:    _ScannerService_ResetSymbolHealth_Handler,
+		},
+		{
+			MethodName: "ListProfiles",
+			Handler:    _ScannerService_ListProfiles_Handler,
+		},
+		{
+			MethodName: "ListStrategies",
+			Handler:    _ScannerService_ListStrategies_Handler,
+		},
+		{
+			MethodName: "GetAuditLog",
+			Handler:    _ScannerService_GetAuditLog_Handler,
+		},
+		{
+			MethodName: "GetEffectiveConfig",
+			Handler:    _ScannerService_GetEffectiveConfig_Handler,
+		},
+		{
+			MethodName: "GetVersion",
+			Handler:    _ScannerService_GetVersion_Handler,
+		},
+		{
+			MethodName: "GetDataQuality",
+			Handler:    _ScannerService_GetDataQuality_Handler,
+		},
+		{
+			MethodName: "GetSymbolMetadata",
+			Handler:    _ScannerService_GetSymbolMetadata_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "BulkFetchStream",
+			Handler:       _ScannerService_BulkFetchStream_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Backtest",
+			Handler:       _ScannerService_Backtest_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "scanner.proto",
+}
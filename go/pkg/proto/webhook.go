@@ -0,0 +1,69 @@
+package proto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// Scan webhooks. After each scheduled scan the scanner POSTs a
+// ScanWebhookPayload as JSON to each configured webhook endpoint. Version
+// is ScanWebhookVersion, raised when a field changes meaning or is removed;
+// new fields may be added within a version, so consumers should ignore
+// fields they do not know.
+//
+// An endpoint configured with a secret receives the body's HMAC-SHA256
+// under that secret in the ScanWebhookSignatureHeader header, as
+// "sha256=" and the hex digest, which ScanWebhookSignature computes.
+// Consumers should compare it with hmac.Equal over the raw body.
+//
+// Signals depend on the endpoint's filter: "all" sends every ranked signal,
+// with the diff against the previous scan when there is one; "diff-only"
+// sends only the diff, and nothing when no signal was added or removed;
+// "strategy" sends the signals, and the diff, of the endpoint's strategies.
+const (
+	ScanWebhookVersion         = 1
+	ScanWebhookEvent           = "scan.completed"
+	ScanWebhookSignatureHeader = "X-Scanner-Signature"
+)
+
+// ScanWebhookPayload is the body of a scan webhook
+type ScanWebhookPayload struct {
+	Version  int       `json:"version"`
+	Event    string    `json:"event"`
+	ScanTime time.Time `json:"scan_time"`
+	// Profile is the scan profile of the scheduled scan, empty without one
+	Profile string `json:"profile,omitempty"`
+	// Filter is the endpoint's filter: "all", "diff-only" or "strategy"
+	Filter string `json:"filter"`
+	// Signals strongest first; left out by the diff-only filter
+	Signals []ScanWebhookSignal `json:"signals,omitempty"`
+	Diff    *ScanWebhookDiff    `json:"diff,omitempty"`
+}
+
+// ScanWebhookSignal is a signal of a scan
+type ScanWebhookSignal struct {
+	Symbol    string  `json:"symbol"`
+	Strategy  string  `json:"strategy"`
+	Direction string  `json:"direction"`
+	Score     float64 `json:"score"`
+}
+
+// ScanWebhookDiff is how a scan's signals differ from the previous scan's.
+// Reason is set instead when the scans are not comparable.
+type ScanWebhookDiff struct {
+	Added            []ScanWebhookSignal `json:"added"`
+	Removed          []ScanWebhookSignal `json:"removed"`
+	Unchanged        int                 `json:"unchanged"`
+	PreviousScanTime string              `json:"previous_scan_time,omitempty"`
+	Reason           string              `json:"reason,omitempty"`
+}
+
+// ScanWebhookSignature returns the ScanWebhookSignatureHeader value of body
+// signed with secret
+func ScanWebhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
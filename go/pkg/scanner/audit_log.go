@@ -0,0 +1,379 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/trustdan/ibkr-trader/go/pkg/logging"
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// auditLogFile is the name of the audit log in audit_log_dir
+const auditLogFile = "audit.jsonl"
+
+// defaultAuditLimit is the number of records GetAuditLog returns for a limit of 0
+const defaultAuditLimit = 100
+
+// auditedMethods are the RPCs recorded in the audit log
+var auditedMethods = map[string]bool{"Scan": true, "BulkFetch": true, "BulkFetchStream": true, "Backtest": true}
+
+// AuditRecord is one audited call, a line of the audit log
+type AuditRecord struct {
+	Time            time.Time `json:"time"`
+	Method          string    `json:"method"`
+	Peer            string    `json:"peer,omitempty"`
+	SymbolCount     int       `json:"symbol_count"`
+	Strategies      []string  `json:"strategies,omitempty"`
+	StartDate       string    `json:"start_date,omitempty"`
+	EndDate         string    `json:"end_date,omitempty"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	SignalCount     int       `json:"signal_count"`
+	ErrorCount      int       `json:"error_count"`
+	Status          string    `json:"status"`
+}
+
+// AuditLog appends a record of every Scan, BulkFetch and Backtest call to a
+// rotating JSONL file. Records are written by a goroutine of their own, so a
+// slow disk never holds up a call; a record the full buffer has no room for
+// is dropped and counted instead.
+type AuditLog struct {
+	file    *logging.RotatingFile
+	out     io.Writer
+	records chan AuditRecord
+	done    chan struct{}
+	dropped atomic.Int64
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// OpenAuditLog opens the audit log in dir, rotating it past maxSizeMB and
+// keeping maxFiles rotated files; 0 never rotates or keeps every file. Up to
+// bufferSize records wait to be written.
+func OpenAuditLog(dir string, maxSizeMB, maxFiles, bufferSize int) (*AuditLog, error) {
+	file, err := logging.OpenRotatingFile(filepath.Join(dir, auditLogFile), maxSizeMB, maxFiles, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return newAuditLog(file, file, bufferSize), nil
+}
+
+// newAuditLog starts the writer of records to out, which writes to file
+func newAuditLog(file *logging.RotatingFile, out io.Writer, bufferSize int) *AuditLog {
+	l := &AuditLog{
+		file:    file,
+		out:     out,
+		records: make(chan AuditRecord, max(bufferSize, 1)),
+		done:    make(chan struct{}),
+	}
+	go l.write()
+	return l
+}
+
+// write appends the records to the file until the log is closed
+func (l *AuditLog) write() {
+	defer close(l.done)
+	for record := range l.records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			logrus.Errorf("Failed to encode audit record: %v", err)
+			continue
+		}
+		if _, err := l.out.Write(append(line, '\n')); err != nil {
+			logrus.Errorf("Failed to write audit record: %v", err)
+		}
+	}
+}
+
+// Record queues record for writing without blocking
+func (l *AuditLog) Record(record AuditRecord) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		return
+	}
+	select {
+	case l.records <- record:
+	default:
+		l.dropped.Add(1)
+	}
+}
+
+// Dropped returns the number of records dropped because the buffer was full
+func (l *AuditLog) Dropped() int64 {
+	return l.dropped.Load()
+}
+
+// Close writes the queued records and closes the file
+func (l *AuditLog) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	close(l.records)
+	l.mu.Unlock()
+
+	<-l.done
+	return l.file.Close()
+}
+
+// Records returns the latest limit records of calls made at or after since
+// and before until, oldest first. Zero times do not bound the calls. Records
+// still waiting to be written are not included.
+func (l *AuditLog) Records(limit int, since, until time.Time) ([]AuditRecord, error) {
+	if limit <= 0 {
+		limit = defaultAuditLimit
+	}
+	backups, err := l.file.Backups()
+	if err != nil {
+		return nil, err
+	}
+
+	// Read the files newest first until enough records are found
+	var newest []AuditRecord
+	for _, file := range append([]string{l.file.Path()}, backups...) {
+		records, err := readAuditRecords(file)
+		if err != nil {
+			return nil, err
+		}
+		for i := len(records) - 1; i >= 0 && len(newest) < limit; i-- {
+			record := records[i]
+			if (!since.IsZero() && record.Time.Before(since)) || (!until.IsZero() && !record.Time.Before(until)) {
+				continue
+			}
+			newest = append(newest, record)
+		}
+		if len(newest) == limit {
+			break
+		}
+	}
+
+	oldest := make([]AuditRecord, len(newest))
+	for i, record := range newest {
+		oldest[len(newest)-1-i] = record
+	}
+	return oldest, nil
+}
+
+// readAuditRecords reads the records of one audit log file, skipping a line
+// the writer has not finished
+func readAuditRecords(file string) ([]AuditRecord, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, nil // rotated away since it was listed
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	defer f.Close()
+
+	var records []AuditRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var record AuditRecord
+		if json.Unmarshal(scanner.Bytes(), &record) == nil {
+			records = append(records, record)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return records, nil
+}
+
+// ServerOptions returns the interceptors recording the audited calls
+func (l *AuditLog) ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(l.UnaryInterceptor()),
+		grpc.ChainStreamInterceptor(l.StreamInterceptor()),
+	}
+}
+
+// UnaryInterceptor records the audited unary calls
+func (l *AuditLog) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		method := path.Base(info.FullMethod)
+		if !auditedMethods[method] {
+			return handler(ctx, req)
+		}
+
+		start := time.Now()
+		call := &auditCall{}
+		resp, err := handler(context.WithValue(ctx, auditCallKey{}, call), req)
+		if scan, ok := resp.(*pb.ScanResponse); ok {
+			for _, signals := range scan.GetSignals() {
+				call.signals.Add(int32(len(signals.GetSignalTypes())))
+			}
+		}
+		l.Record(call.record(ctx, method, start, req, err))
+		return resp, err
+	}
+}
+
+// StreamInterceptor records the audited streaming calls
+func (l *AuditLog) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		method := path.Base(info.FullMethod)
+		if !auditedMethods[method] {
+			return handler(srv, ss)
+		}
+
+		start := time.Now()
+		call := &auditCall{}
+		stream := &auditedStream{ServerStream: ss, ctx: context.WithValue(ss.Context(), auditCallKey{}, call), call: call}
+		err := handler(srv, stream)
+		l.Record(call.record(ss.Context(), method, start, stream.req, err))
+		return err
+	}
+}
+
+// auditCallKey is the context key of the auditCall of a call
+type auditCallKey struct{}
+
+// auditCall collects what the handler of an audited call counts
+type auditCall struct {
+	symbols atomic.Int32 // resolved symbols, 0 to take the request's
+	signals atomic.Int32
+	errors  atomic.Int32
+}
+
+// auditSymbols notes the number of symbols the audited call of ctx covers
+// when they differ from the request's
+func auditSymbols(ctx context.Context, n int) {
+	if call, ok := ctx.Value(auditCallKey{}).(*auditCall); ok {
+		call.symbols.Store(int32(n))
+	}
+}
+
+// auditError counts a symbol the audited call of ctx could not fetch
+func auditError(ctx context.Context) {
+	if call, ok := ctx.Value(auditCallKey{}).(*auditCall); ok {
+		call.errors.Add(1)
+	}
+}
+
+// record returns the audit record of a call of method to req started at start
+func (c *auditCall) record(ctx context.Context, method string, start time.Time, req interface{}, err error) AuditRecord {
+	record := AuditRecord{
+		Time:            start,
+		Method:          method,
+		SymbolCount:     int(c.symbols.Load()),
+		DurationSeconds: time.Since(start).Seconds(),
+		SignalCount:     int(c.signals.Load()),
+		ErrorCount:      int(c.errors.Load()),
+		Status:          status.Code(err).String(),
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		record.Peer = p.Addr.String()
+	}
+	if r, ok := req.(symbolRequest); ok && record.SymbolCount == 0 {
+		record.SymbolCount = len(r.GetSymbols())
+	}
+	if r, ok := req.(interface{ GetStrategies() []string }); ok {
+		record.Strategies = r.GetStrategies()
+	}
+	if r, ok := req.(interface{ GetDateRange() *pb.DateRange }); ok {
+		record.StartDate, record.EndDate = r.GetDateRange().GetStartDate(), r.GetDateRange().GetEndDate()
+	}
+	return record
+}
+
+// auditedStream is the stream of an audited streaming call; it keeps the
+// request and counts the signals sent
+type auditedStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	call *auditCall
+	req  interface{}
+}
+
+func (s *auditedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *auditedStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.req = m
+	}
+	return err
+}
+
+func (s *auditedStream) SendMsg(m interface{}) error {
+	if update, ok := m.(*pb.BacktestUpdate); ok {
+		for _, symbol := range update.GetResult().GetSymbols() {
+			s.call.signals.Add(int32(len(symbol.GetSignals())))
+		}
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+// GetAuditLog implements the GetAuditLog RPC method
+func (s *Engine) GetAuditLog(ctx context.Context, req *pb.AuditLogRequest) (*pb.AuditLogResponse, error) {
+	if s.audit == nil {
+		return nil, status.Error(codes.FailedPrecondition, "the audit log is disabled; set audit_log_dir to enable it")
+	}
+	if req.GetLimit() < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "limit must not be negative, got %d", req.GetLimit())
+	}
+	var since, until time.Time
+	for _, bound := range []struct {
+		name  string
+		value string
+		to    *time.Time
+	}{{"since", req.GetSince(), &since}, {"until", req.GetUntil(), &until}} {
+		if bound.value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, bound.value)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%s must be RFC3339, got %q", bound.name, bound.value)
+		}
+		*bound.to = t
+	}
+
+	records, err := s.audit.Records(int(req.GetLimit()), since, until)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	resp := &pb.AuditLogResponse{Records: make([]*pb.AuditRecord, len(records)), Dropped: s.audit.Dropped()}
+	for i, record := range records {
+		resp.Records[i] = &pb.AuditRecord{
+			Time:            record.Time.Format(time.RFC3339Nano),
+			Method:          record.Method,
+			Peer:            record.Peer,
+			SymbolCount:     int32(record.SymbolCount),
+			Strategies:      record.Strategies,
+			DateRange:       &pb.DateRange{StartDate: record.StartDate, EndDate: record.EndDate},
+			DurationSeconds: float32(record.DurationSeconds),
+			SignalCount:     int32(record.SignalCount),
+			ErrorCount:      int32(record.ErrorCount),
+			Status:          record.Status,
+		}
+	}
+	return resp, nil
+}
+
+// SetAuditLog makes GetAuditLog serve the records of audit. The calls are
+// only recorded with audit's ServerOptions installed on the server.
+func (s *Engine) SetAuditLog(audit *AuditLog) {
+	s.audit = audit
+}
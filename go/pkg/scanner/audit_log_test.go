@@ -0,0 +1,239 @@
+package scanner
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/trustdan/ibkr-trader/go/pkg/logging"
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// openTestAuditLog opens an audit log in a temporary directory
+func openTestAuditLog(t *testing.T, maxSizeMB, maxFiles, bufferSize int) *AuditLog {
+	t.Helper()
+	audit, err := OpenAuditLog(t.TempDir(), maxSizeMB, maxFiles, bufferSize)
+	if err != nil {
+		t.Fatalf("OpenAuditLog() error = %v", err)
+	}
+	t.Cleanup(func() { audit.Close() })
+	return audit
+}
+
+// waitForAuditRecords waits until the audit log holds n records
+func waitForAuditRecords(t *testing.T, audit *AuditLog, n int) []AuditRecord {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		records, err := audit.Records(0, time.Time{}, time.Time{})
+		if err != nil {
+			t.Fatalf("Records() error = %v", err)
+		}
+		if len(records) >= n || time.Now().After(deadline) {
+			if len(records) != n {
+				t.Fatalf("Records() = %d records, want %d", len(records), n)
+			}
+			return records
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestAuditLogRecordsCalls(t *testing.T) {
+	service := newTestService(t)
+	audit := openTestAuditLog(t, 0, 0, 16)
+	service.SetAuditLog(audit)
+	client := dialTestServerWithOptions(t, service, audit.ServerOptions())
+	ctx := context.Background()
+
+	resp, err := client.Scan(ctx, &pb.ScanRequest{
+		Symbols:    []string{"AAPL", "XOM"},
+		Strategies: []string{"HIGH_BASE"},
+		DateRange:  testDateRange(),
+	})
+	if err != nil {
+		t.Fatalf("Scan RPC failed: %v", err)
+	}
+	wantSignals := 0
+	for _, signals := range resp.GetSignals() {
+		wantSignals += len(signals.GetSignalTypes())
+	}
+
+	useProvider(service, failingProvider{})
+	if _, err := client.BulkFetch(ctx, &pb.BulkFetchRequest{Symbols: []string{"NVDA"}, DateRange: testDateRange()}); err != nil {
+		t.Fatalf("BulkFetch RPC failed: %v", err)
+	}
+	_, scanErr := client.Scan(ctx, &pb.ScanRequest{})
+	if scanErr == nil {
+		t.Fatal("Scan RPC without a date range succeeded")
+	}
+	// Calls outside the audited methods are not recorded
+	if _, err := client.GetMetrics(ctx, &pb.MetricsRequest{}); err != nil {
+		t.Fatalf("GetMetrics RPC failed: %v", err)
+	}
+
+	records := waitForAuditRecords(t, audit, 3)
+	scan, fetch, failed := records[0], records[1], records[2]
+	if scan.Method != "Scan" || scan.SymbolCount != 2 || !reflect.DeepEqual(scan.Strategies, []string{"HIGH_BASE"}) ||
+		scan.StartDate != "2024-01-02" || scan.EndDate != "2024-01-31" || scan.Status != "OK" || scan.Peer == "" {
+		t.Errorf("Scan record = %+v", scan)
+	}
+	if scan.SignalCount != wantSignals || wantSignals == 0 {
+		t.Errorf("Scan record signal count = %d, want %d", scan.SignalCount, wantSignals)
+	}
+	if fetch.Method != "BulkFetch" || fetch.SymbolCount != 1 || fetch.ErrorCount != 1 || fetch.Status != "OK" {
+		t.Errorf("BulkFetch record = %+v, want one symbol failing", fetch)
+	}
+	if failed.Method != "Scan" || failed.Status != status.Code(scanErr).String() {
+		t.Errorf("Failed Scan record = %+v", failed)
+	}
+	for _, record := range records {
+		if record.DurationSeconds <= 0 || record.Time.IsZero() {
+			t.Errorf("Record %+v has no time or duration", record)
+		}
+	}
+}
+
+func TestGetAuditLog(t *testing.T) {
+	service := newTestService(t)
+	client := dialTestServer(t, service)
+	ctx := context.Background()
+
+	if _, err := client.GetAuditLog(ctx, &pb.AuditLogRequest{}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("GetAuditLog with the log disabled: got %v, want FailedPrecondition", err)
+	}
+
+	audit := openTestAuditLog(t, 0, 0, 16)
+	service.SetAuditLog(audit)
+	start := time.Date(2024, 5, 1, 14, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		audit.Record(AuditRecord{Time: start.Add(time.Duration(i) * time.Minute), Method: "Scan", SymbolCount: i, Status: "OK"})
+	}
+	waitForAuditRecords(t, audit, 5)
+
+	tests := []struct {
+		name    string
+		req     *pb.AuditLogRequest
+		symbols []int32
+	}{
+		{name: "All", req: &pb.AuditLogRequest{}, symbols: []int32{0, 1, 2, 3, 4}},
+		{name: "Latest", req: &pb.AuditLogRequest{Limit: 2}, symbols: []int32{3, 4}},
+		{
+			name:    "Window",
+			req:     &pb.AuditLogRequest{Since: start.Add(time.Minute).Format(time.RFC3339), Until: start.Add(3 * time.Minute).Format(time.RFC3339)},
+			symbols: []int32{1, 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.GetAuditLog(ctx, tt.req)
+			if err != nil {
+				t.Fatalf("GetAuditLog RPC failed: %v", err)
+			}
+			var symbols []int32
+			for _, record := range resp.GetRecords() {
+				symbols = append(symbols, record.GetSymbolCount())
+			}
+			if !reflect.DeepEqual(symbols, tt.symbols) {
+				t.Errorf("GetAuditLog returned the records of %v symbols, want %v", symbols, tt.symbols)
+			}
+		})
+	}
+
+	for _, req := range []*pb.AuditLogRequest{{Limit: -1}, {Since: "yesterday"}} {
+		if _, err := client.GetAuditLog(ctx, req); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("GetAuditLog(%v): got %v, want InvalidArgument", req, err)
+		}
+	}
+}
+
+// slowWriter takes delay over each write
+type slowWriter struct {
+	io.Writer
+	delay time.Duration
+}
+
+func (w slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(w.delay)
+	return w.Writer.Write(p)
+}
+
+func TestAuditLogDoesNotBlockOnSlowDisk(t *testing.T) {
+	file, err := logging.OpenRotatingFile(filepath.Join(t.TempDir(), auditLogFile), 0, 0, 0)
+	if err != nil {
+		t.Fatalf("OpenRotatingFile() error = %v", err)
+	}
+	audit := newAuditLog(file, slowWriter{Writer: file, delay: 50 * time.Millisecond}, 2)
+
+	started := time.Now()
+	for i := 0; i < 50; i++ {
+		audit.Record(AuditRecord{Time: time.Now(), Method: "Scan", Status: "OK"})
+	}
+	if elapsed := time.Since(started); elapsed > 25*time.Millisecond {
+		t.Errorf("Recording 50 calls took %v, want no waiting on the writer", elapsed)
+	}
+	// The buffer holds 2 records and the writer one more
+	if dropped := audit.Dropped(); dropped < 47 {
+		t.Errorf("Dropped() = %d, want at least 47", dropped)
+	}
+
+	if err := audit.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	records, err := audit.Records(0, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+	if int64(len(records))+audit.Dropped() != 50 {
+		t.Errorf("Wrote %d records and dropped %d, want 50 in all", len(records), audit.Dropped())
+	}
+}
+
+func TestAuditLogRotation(t *testing.T) {
+	audit := openTestAuditLog(t, 1, 2, 4096)
+	dir := filepath.Dir(audit.file.Path())
+
+	// About 3.5MB of records, past three rotations of the 1MB file
+	strategies := []string{strings.Repeat("S", 1000)}
+	start := time.Date(2024, 5, 1, 14, 0, 0, 0, time.UTC)
+	const n = 3500
+	for i := 0; i < n; i++ {
+		audit.Record(AuditRecord{Time: start.Add(time.Duration(i) * time.Second), Method: "Scan", SymbolCount: i, Strategies: strategies})
+	}
+	if audit.Dropped() != 0 {
+		t.Fatalf("Dropped %d records", audit.Dropped())
+	}
+	if err := audit.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("Audit log directory holds %d files, want the log and 2 rotated files", len(entries))
+	}
+
+	// The latest records span the current file and the rotated ones
+	records, err := audit.Records(1500, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Records() error = %v", err)
+	}
+	if len(records) != 1500 {
+		t.Fatalf("Records() = %d records, want 1500", len(records))
+	}
+	for i, record := range records {
+		if record.SymbolCount != n-1500+i {
+			t.Fatalf("Records()[%d] is record %d, want %d", i, record.SymbolCount, n-1500+i)
+		}
+	}
+}
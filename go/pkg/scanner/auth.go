@@ -0,0 +1,115 @@
+package scanner
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// authorizationHeader is the metadata key carrying the bearer token
+const authorizationHeader = "authorization"
+
+// TokenAuthenticator checks a bearer token on incoming RPCs
+type TokenAuthenticator struct {
+	token  string
+	exempt map[string]bool
+}
+
+// NewTokenAuthenticator creates an authenticator for token. Exempt methods may be
+// given as full method names ("/scanner.ScannerService/GetMetrics") or bare
+// method names ("GetMetrics").
+func NewTokenAuthenticator(token string, exemptMethods []string) *TokenAuthenticator {
+	exempt := make(map[string]bool, len(exemptMethods))
+	for _, method := range exemptMethods {
+		exempt[method] = true
+	}
+	return &TokenAuthenticator{token: token, exempt: exempt}
+}
+
+// LoadAuthToken returns the configured token, reading it from AuthTokenFile when
+// AuthToken is empty. An empty result means authentication is disabled.
+func LoadAuthToken(cfg *Config) (string, error) {
+	if cfg.AuthToken != "" || cfg.AuthTokenFile == "" {
+		return cfg.AuthToken, nil
+	}
+
+	content, err := os.ReadFile(cfg.AuthTokenFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read auth token file: %w", err)
+	}
+
+	token := strings.TrimSpace(string(content))
+	if token == "" {
+		return "", fmt.Errorf("auth token file %s is empty", cfg.AuthTokenFile)
+	}
+	return token, nil
+}
+
+// UnaryInterceptor rejects unary calls without a valid bearer token
+func (a *TokenAuthenticator) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := a.authorize(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamInterceptor rejects streaming calls without a valid bearer token
+func (a *TokenAuthenticator) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := a.authorize(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// authorize checks the bearer token for a call to fullMethod
+func (a *TokenAuthenticator) authorize(ctx context.Context, fullMethod string) error {
+	if a.exempt[fullMethod] || a.exempt[path.Base(fullMethod)] {
+		return nil
+	}
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "missing metadata")
+	}
+
+	values := md.Get(authorizationHeader)
+	if len(values) == 0 {
+		return status.Error(codes.Unauthenticated, "missing authorization header")
+	}
+
+	token, found := strings.CutPrefix(values[0], "Bearer ")
+	if !found || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+		return status.Error(codes.Unauthenticated, "invalid bearer token")
+	}
+	return nil
+}
+
+// TokenCredentials attaches a bearer token to every RPC made by a client. Use it
+// with grpc.WithPerRPCCredentials.
+type TokenCredentials struct {
+	Token string
+	// AllowInsecure permits sending the token over a connection without TLS
+	AllowInsecure bool
+}
+
+// GetRequestMetadata implements credentials.PerRPCCredentials
+func (c TokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{authorizationHeader: "Bearer " + c.Token}, nil
+}
+
+// RequireTransportSecurity implements credentials.PerRPCCredentials
+func (c TokenCredentials) RequireTransportSecurity() bool {
+	return !c.AllowInsecure
+}
@@ -0,0 +1,82 @@
+package scanner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// dialAuthServer serves the scanner with token auth enabled and GetMetrics exempt
+func dialAuthServer(t *testing.T, dialOptions ...grpc.DialOption) pb.ScannerServiceClient {
+	t.Helper()
+
+	cfg := DefaultConfig()
+	cfg.AuthToken = "s3cret"
+	cfg.AuthExemptMethods = []string{"GetMetrics"}
+	options, err := ServerOptions(cfg, nil)
+	if err != nil {
+		t.Fatalf("ServerOptions failed: %v", err)
+	}
+
+	return dialTestServerWithOptions(t, newTestService(t), options, dialOptions...)
+}
+
+func TestAuthAcceptsValidToken(t *testing.T) {
+	client := dialAuthServer(t, grpc.WithPerRPCCredentials(TokenCredentials{Token: "s3cret", AllowInsecure: true}))
+
+	_, err := client.Scan(context.Background(), &pb.ScanRequest{Symbols: []string{"AAPL"}, DateRange: testDateRange()})
+	if err != nil {
+		t.Fatalf("Scan with valid token failed: %v", err)
+	}
+}
+
+func TestAuthRejectsMissingOrInvalidToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []grpc.DialOption
+	}{
+		{name: "missing token"},
+		{name: "wrong token", options: []grpc.DialOption{grpc.WithPerRPCCredentials(TokenCredentials{Token: "guess", AllowInsecure: true})}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := dialAuthServer(t, tt.options...)
+
+			_, err := client.Scan(context.Background(), &pb.ScanRequest{Symbols: []string{"AAPL"}, DateRange: testDateRange()})
+			if status.Code(err) != codes.Unauthenticated {
+				t.Errorf("Expected Unauthenticated, got %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthExemptMethod(t *testing.T) {
+	client := dialAuthServer(t)
+
+	if _, err := client.GetMetrics(context.Background(), &pb.MetricsRequest{}); err != nil {
+		t.Errorf("Exempt GetMetrics should not require a token: %v", err)
+	}
+}
+
+func TestLoadAuthTokenFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := LoadAuthToken(&Config{AuthTokenFile: path})
+	if err != nil {
+		t.Fatalf("LoadAuthToken failed: %v", err)
+	}
+	if token != "from-file" {
+		t.Errorf("Token: got %q, want %q", token, "from-file")
+	}
+}
@@ -0,0 +1,231 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+	"github.com/trustdan/ibkr-trader/go/pkg/strategy"
+)
+
+// Backtest implements the Backtest RPC method. Each symbol's bars are replayed
+// on the worker pool and a progress update is streamed as each symbol finishes,
+// followed by the result. Forward returns are reported 1, 5 and 10 bars after
+// each signal; the first bars of the range only warm up the indicators.
+func (s *ScannerService) Backtest(req *pb.BacktestRequest, stream pb.ScannerService_BacktestServer) error {
+	startTime := time.Now()
+	d := s.current()
+
+	ctx, span := s.tracer.Start(stream.Context(), "Backtest", trace.WithAttributes(attribute.Int("scanner.symbol_count", len(req.Symbols))))
+	defer span.End()
+
+	configured, spec, err := validateBacktest(req, d.strategies, d.config)
+	if err != nil {
+		recordSpanError(span, err)
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	span.SetAttributes(attrBarSpec.String(spec.String()))
+
+	if err := s.admitProviderCalls(ctx); err != nil {
+		recordSpanError(span, err)
+		return err
+	}
+
+	// Stop the remaining symbols if the client goes away
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	triggers := make(map[string][]strategy.Trigger, len(req.Symbols))
+	results := make(map[string]*pb.SymbolBacktest, len(req.Symbols))
+	var mu sync.Mutex
+
+	var wg sync.WaitGroup
+	var panics panicCollector
+	completed := make(chan struct{}, len(req.Symbols))
+
+	// Dispatch from a separate goroutine so this one is free to stream progress
+	go func() {
+		defer close(completed)
+		defer wg.Wait()
+
+		for _, symbol := range req.Symbols {
+			if s.workers.acquire(ctx) != nil {
+				return
+			}
+
+			wg.Add(1)
+			go func(sym string) {
+				defer wg.Done()
+				defer s.workers.release()
+				defer panics.capture()
+
+				result, symbolTriggers, err := s.backtestSymbol(ctx, d, sym, req.DateRange, spec, configured)
+				if err != nil {
+					return
+				}
+
+				mu.Lock()
+				results[sym] = result
+				triggers[sym] = symbolTriggers
+				mu.Unlock()
+				completed <- struct{}{}
+			}(symbol)
+		}
+	}()
+
+	done := 0
+	for range completed {
+		done++
+		progress := &pb.BacktestUpdate{Update: &pb.BacktestUpdate_PercentComplete{
+			PercentComplete: 100 * float32(done) / float32(len(req.Symbols)),
+		}}
+		if err := stream.Send(progress); err != nil {
+			cancel()
+		}
+	}
+	panics.repanic()
+
+	if err := ctx.Err(); err != nil {
+		recordSpanError(span, err)
+		return status.FromContextError(err).Err()
+	}
+
+	// Pool the signals in symbol order so the overall statistics do not depend
+	// on which symbol finished first
+	var all []strategy.Trigger
+	for _, symbol := range sortedKeys(triggers) {
+		all = append(all, triggers[symbol]...)
+	}
+
+	result := &pb.BacktestResult{
+		Symbols:        results,
+		Stats:          horizonStatsToProto(strategy.Summarize(all, strategy.DefaultHorizons)),
+		RunTimeSeconds: float32(time.Since(startTime).Seconds()),
+	}
+	span.SetAttributes(attribute.Int("scanner.signal_count", len(all)))
+
+	return stream.Send(&pb.BacktestUpdate{Update: &pb.BacktestUpdate_Result{Result: result}})
+}
+
+// validateBacktest checks the request and resolves its strategies and bar
+// spec, with extended hours as the request or else cfg asks
+func validateBacktest(req *pb.BacktestRequest, custom map[string]strategy.Strategy, cfg *Config) ([]strategy.Configured, BarSpec, error) {
+	if req.DateRange == nil {
+		return nil, BarSpec{}, fmt.Errorf("date range is required")
+	}
+	if len(req.Symbols) == 0 {
+		return nil, BarSpec{}, fmt.Errorf("at least one symbol is required")
+	}
+
+	spec, err := ParseBarSpec(req.BarSize, "")
+	if err != nil {
+		return nil, BarSpec{}, err
+	}
+
+	configured, err := resolveStrategies(req.Strategies, req.Parameters, custom)
+	if err != nil {
+		return nil, BarSpec{}, err
+	}
+	return configured, cfg.withExtendedHours(spec, req.IncludeExtendedHours), nil
+}
+
+// replaySessions replays the strategies over data, each over the bars of the
+// sessions it reads, and returns the signals raised in time order. Forward
+// returns of the strategies reading the regular session only are counted in
+// its bars.
+func replaySessions(ctx context.Context, data []MarketData, configured []strategy.Configured) ([]strategy.Trigger, error) {
+	regular, extended := sessionSeries(data)
+	if regular == extended {
+		return strategy.Replay(ctx, regular, configured, strategy.DefaultHorizons)
+	}
+
+	var onRegular, onExtended []strategy.Configured
+	for _, c := range configured {
+		if seriesFor(c.Strategy, regular, extended) == extended {
+			onExtended = append(onExtended, c)
+		} else {
+			onRegular = append(onRegular, c)
+		}
+	}
+	triggers, err := strategy.Replay(ctx, regular, onRegular, strategy.DefaultHorizons)
+	if err != nil {
+		return nil, err
+	}
+	more, err := strategy.Replay(ctx, extended, onExtended, strategy.DefaultHorizons)
+	if err != nil {
+		return nil, err
+	}
+	triggers = append(triggers, more...)
+	sort.SliceStable(triggers, func(i, j int) bool { return triggers[i].Time.Before(triggers[j].Time) })
+	return triggers, nil
+}
+
+// backtestSymbol fetches and replays one symbol. A fetch failure is reported in
+// the symbol's result; an error is returned only when the run was cancelled.
+func (s *Engine) backtestSymbol(ctx context.Context, d *serviceDeps, symbol string, dateRange *pb.DateRange, spec BarSpec, configured []strategy.Configured) (*pb.SymbolBacktest, []strategy.Trigger, error) {
+	fetchCtx, cancel := context.WithTimeout(ctx, d.config.SymbolTimeout)
+	data, err := s.fetchSymbolData(fetchCtx, d, symbol, dateRange, spec)
+	cancel()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		return &pb.SymbolBacktest{Error: err.Error()}, nil, nil
+	}
+
+	triggers, err := replaySessions(ctx, data, configured)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := &pb.SymbolBacktest{
+		Signals: make([]*pb.BacktestSignal, len(triggers)),
+		Stats:   horizonStatsToProto(strategy.Summarize(triggers, strategy.DefaultHorizons)),
+	}
+	for i, trigger := range triggers {
+		returns := make(map[int32]float64, len(trigger.ForwardReturns))
+		for horizon, r := range trigger.ForwardReturns {
+			returns[int32(horizon)] = r
+		}
+		result.Signals[i] = &pb.BacktestSignal{
+			Timestamp:      trigger.Time.Format(time.RFC3339),
+			Strategy:       trigger.Strategy,
+			SignalType:     trigger.Signal,
+			Price:          trigger.Price,
+			ForwardReturns: returns,
+		}
+	}
+	return result, triggers, nil
+}
+
+// horizonStatsToProto converts forward-return statistics to their message form
+func horizonStatsToProto(stats []strategy.HorizonStats) []*pb.HorizonStats {
+	out := make([]*pb.HorizonStats, len(stats))
+	for i, st := range stats {
+		out[i] = &pb.HorizonStats{
+			Horizon:       int32(st.Horizon),
+			Count:         int32(st.Count),
+			HitRate:       st.HitRate,
+			AverageReturn: st.AverageReturn,
+		}
+	}
+	return out
+}
+
+// sortedKeys returns the keys of m in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
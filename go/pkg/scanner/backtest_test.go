@@ -0,0 +1,204 @@
+package scanner
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// blockingProvider blocks every fetch until the request is cancelled
+type blockingProvider struct {
+	started   chan struct{}
+	cancelled chan struct{}
+}
+
+func (b *blockingProvider) GetHistoricalData(ctx context.Context, symbol, startDate, endDate string, spec BarSpec) ([]MarketData, error) {
+	b.started <- struct{}{}
+	<-ctx.Done()
+	close(b.cancelled)
+	return nil, ctx.Err()
+}
+
+// runBacktest collects the progress updates and the result of a backtest
+func runBacktest(t *testing.T, client pb.ScannerServiceClient, req *pb.BacktestRequest) ([]float32, *pb.BacktestResult) {
+	t.Helper()
+
+	stream, err := client.Backtest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Backtest RPC failed: %v", err)
+	}
+
+	var progress []float32
+	var result *pb.BacktestResult
+	for {
+		update, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Backtest stream failed: %v", err)
+		}
+		if result != nil {
+			t.Fatal("Received an update after the result")
+		}
+		if update.GetResult() != nil {
+			result = update.GetResult()
+		} else {
+			progress = append(progress, update.GetPercentComplete())
+		}
+	}
+	if result == nil {
+		t.Fatal("Backtest stream ended without a result")
+	}
+	return progress, result
+}
+
+func yearBacktest() *pb.BacktestRequest {
+	return &pb.BacktestRequest{
+		Symbols:   []string{"AAPL", "MSFT", "XOM", "JPM"},
+		DateRange: &pb.DateRange{StartDate: "2023-01-01", EndDate: "2023-12-31"},
+	}
+}
+
+func TestBacktestIsDeterministic(t *testing.T) {
+	client := dialTestServer(t, newMockTestService(t))
+
+	progress, first := runBacktest(t, client, yearBacktest())
+	if len(progress) != 4 || progress[len(progress)-1] != 100 {
+		t.Errorf("Expected one progress update per symbol ending at 100, got %v", progress)
+	}
+	for i := 1; i < len(progress); i++ {
+		if progress[i] <= progress[i-1] {
+			t.Errorf("Progress went backwards: %v", progress)
+		}
+	}
+
+	_, second := runBacktest(t, client, yearBacktest())
+	first.RunTimeSeconds, second.RunTimeSeconds = 0, 0
+	if !proto.Equal(first, second) {
+		t.Error("Expected identical results for the same seed")
+	}
+
+	signals := 0
+	for _, symbol := range first.Symbols {
+		signals += len(symbol.Signals)
+	}
+	if signals == 0 {
+		t.Fatal("Expected the mock data to raise signals over a year")
+	}
+	// Signals on the last bars of the range have no forward return
+	if overall := first.Stats[0]; overall.Horizon != 1 || overall.Count == 0 || int(overall.Count) > signals {
+		t.Errorf("Unexpected one bar statistics %+v for %d signals", overall, signals)
+	}
+}
+
+func TestBacktestForwardReturnsMatchBars(t *testing.T) {
+	service := newMockTestService(t)
+	client := dialTestServer(t, service)
+	req := yearBacktest()
+	_, result := runBacktest(t, client, req)
+
+	for symbol, backtest := range result.Symbols {
+		data, err := NewMockDataProvider(service.Config()).GetHistoricalData(context.Background(), symbol,
+			req.DateRange.StartDate, req.DateRange.EndDate, DefaultBarSpec())
+		if err != nil {
+			t.Fatal(err)
+		}
+		index := make(map[string]int, len(data))
+		for i, bar := range data {
+			index[bar.Timestamp.Format(time.RFC3339)] = i
+		}
+
+		for _, signal := range backtest.Signals {
+			i := index[signal.Timestamp]
+			if data[i].Close != signal.Price {
+				t.Fatalf("%s %s: price %v, bar closed at %v", symbol, signal.Timestamp, signal.Price, data[i].Close)
+			}
+			for horizon, got := range signal.ForwardReturns {
+				want := data[i+int(horizon)].Close/data[i].Close - 1
+				if signal.SignalType == "SHORT" {
+					want = -want
+				}
+				if !closeTo(got, want) {
+					t.Errorf("%s %s %d bar return: got %v, want %v", symbol, signal.Timestamp, horizon, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestBacktestRejectsInvalidRequests(t *testing.T) {
+	client := dialTestServer(t, newTestService(t))
+
+	tests := []struct {
+		name    string
+		modify  func(*pb.BacktestRequest)
+		wantMsg string
+	}{
+		{"unknown strategy", func(r *pb.BacktestRequest) { r.Strategies = []string{"MOMENTUM"} }, `"MOMENTUM"`},
+		{"unknown parameter", func(r *pb.BacktestRequest) {
+			r.Parameters = map[string]*pb.StrategyParams{"HIGH_BASE": {Values: map[string]float64{"min_rsy": 70}}}
+		}, `"min_rsy"`},
+		{"parameters for another strategy", func(r *pb.BacktestRequest) {
+			r.Strategies = []string{"HIGH_BASE"}
+			r.Parameters = map[string]*pb.StrategyParams{"LOW_BASE": {Values: map[string]float64{"max_rsi": 30}}}
+		}, `"LOW_BASE"`},
+		{"unknown bar size", func(r *pb.BacktestRequest) { r.BarSize = "1hour" }, "1hour"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := yearBacktest()
+			tt.modify(req)
+
+			stream, err := client.Backtest(context.Background(), req)
+			if err == nil {
+				_, err = stream.Recv()
+			}
+			if status.Code(err) != codes.InvalidArgument || !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Errorf("Expected InvalidArgument naming %s, got %v", tt.wantMsg, err)
+			}
+		})
+	}
+}
+
+func TestBacktestCancelled(t *testing.T) {
+	service := newTestService(t)
+	provider := &blockingProvider{started: make(chan struct{}, 4), cancelled: make(chan struct{})}
+	useProvider(service, provider)
+	client := dialTestServer(t, service)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := client.Backtest(ctx, &pb.BacktestRequest{
+		Symbols:   []string{"AAPL"},
+		DateRange: testDateRange(),
+	})
+	if err != nil {
+		t.Fatalf("Backtest RPC failed: %v", err)
+	}
+
+	<-provider.started
+	cancel()
+
+	if _, err := stream.Recv(); status.Code(err) != codes.Canceled {
+		t.Errorf("Expected Canceled, got %v", err)
+	}
+	select {
+	case <-provider.cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Fetch was not cancelled")
+	}
+}
+
+func closeTo(a, b float64) bool {
+	diff := a - b
+	return diff < 1e-12 && diff > -1e-12
+}
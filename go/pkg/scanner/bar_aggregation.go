@@ -0,0 +1,113 @@
+package scanner
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/trustdan/ibkr-trader/go/pkg/calendar"
+)
+
+// intradayBarSizes are the bar sizes daily bars can be aggregated from,
+// longest and so cheapest first
+var intradayBarSizes = []string{BarSize30Min, BarSize5Min, BarSize1Min}
+
+// intradaySpecs returns the specs of the intraday series of whatToShow daily
+// bars can be aggregated from, those without extended hours, which are
+// smaller, before those with them for each bar size
+func intradaySpecs(whatToShow string) []BarSpec {
+	specs := make([]BarSpec, 0, 2*len(intradayBarSizes))
+	for _, size := range intradayBarSizes {
+		specs = append(specs,
+			BarSpec{BarSize: size, WhatToShow: whatToShow},
+			BarSpec{BarSize: size, WhatToShow: whatToShow, IncludeExtendedHours: true})
+	}
+	return specs
+}
+
+// Aggregate resamples bars of size from, sorted by timestamp as providers
+// return them, into bars of the longer size to. Each opens at the first of its
+// bars, closes at the last, spans their highs and lows and sums their volume.
+// Periods follow market's sessions: a period never spans two sessions, the
+// last of a session ends at its close, early or not, and a daily bar is dated
+// at midnight UTC of its session as the providers date them. Pre-market and
+// after-hours bars are aggregated into periods of their own session, aligned
+// to its start and tagged with it, and left out of daily bars, which cover
+// the regular session as the providers' do. Bars outside every session are
+// left out. The first and last periods are left out when the bars do not
+// reach their start or end, as they would only summarize part of it.
+func Aggregate(bars []MarketData, from, to string, market *calendar.MarketCalendar) ([]MarketData, error) {
+	fromInterval, fromOK := barSizeIntervals[from]
+	toInterval, toOK := barSizeIntervals[to]
+	switch {
+	case !fromOK || !toOK:
+		return nil, fmt.Errorf("cannot aggregate %s bars into %s bars: unsupported bar size", from, to)
+	case from == BarSize1Day || toInterval <= fromInterval:
+		return nil, fmt.Errorf("cannot aggregate %s bars into %s bars: %s bars are not longer", from, to, to)
+	case to != BarSize1Day && toInterval%fromInterval != 0:
+		return nil, fmt.Errorf("cannot aggregate %s bars into %s bars: %s is not a multiple of %s", from, to, to, from)
+	}
+
+	// period is one output bar and the span of its bars
+	type period struct {
+		start, end  time.Time
+		first, last time.Time
+		bar         MarketData
+	}
+	var periods []period
+	for _, bar := range bars {
+		session, start, end, ok := sessionAt(market, bar.Timestamp)
+		if !ok || (to == BarSize1Day && session != SessionRegular) {
+			continue
+		}
+		if to != BarSize1Day {
+			start = start.Add(bar.Timestamp.Sub(start) / toInterval * toInterval)
+			if end.After(start.Add(toInterval)) {
+				end = start.Add(toInterval)
+			}
+		}
+
+		if n := len(periods); n > 0 && periods[n-1].start.Equal(start) {
+			p := &periods[n-1]
+			p.last = bar.Timestamp
+			p.bar.High = max(p.bar.High, bar.High)
+			p.bar.Low = min(p.bar.Low, bar.Low)
+			p.bar.Close = bar.Close
+			p.bar.Volume += bar.Volume
+			p.bar.Adjusted = p.bar.Adjusted && bar.Adjusted
+			continue
+		}
+		timestamp := start
+		if to == BarSize1Day {
+			timestamp = barDate(start)
+		}
+		periods = append(periods, period{
+			start: start,
+			end:   end,
+			first: bar.Timestamp,
+			last:  bar.Timestamp,
+			bar: MarketData{
+				Symbol:    bar.Symbol,
+				Timestamp: timestamp,
+				Open:      bar.Open,
+				High:      bar.High,
+				Low:       bar.Low,
+				Close:     bar.Close,
+				Volume:    bar.Volume,
+				Adjusted:  bar.Adjusted,
+				Session:   session,
+			},
+		})
+	}
+
+	if n := len(periods); n > 0 && periods[n-1].last.Add(fromInterval).Before(periods[n-1].end) {
+		periods = periods[:n-1]
+	}
+	if len(periods) > 0 && periods[0].first.After(periods[0].start) {
+		periods = periods[1:]
+	}
+	aggregated := make([]MarketData, len(periods))
+	for i, p := range periods {
+		aggregated[i] = p.bar
+	}
+	return aggregated, nil
+}
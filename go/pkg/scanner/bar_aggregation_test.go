@@ -0,0 +1,135 @@
+package scanner
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/trustdan/ibkr-trader/go/pkg/calendar"
+)
+
+// loadBars reads the bars of a fixture in testdata/aggregation. AAPL_5min.json
+// holds the week of July 4th 2024 with its early close, a pre-market and an
+// after-hours bar; AAPL_1day.json holds the daily bars of the same sessions.
+func loadBars(t *testing.T, name string) []MarketData {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "aggregation", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bars []MarketData
+	if err := json.Unmarshal(data, &bars); err != nil {
+		t.Fatal(err)
+	}
+	return bars
+}
+
+// assertBars fails unless got and want hold the same bars
+func assertBars(t *testing.T, got, want []MarketData) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("Got %d bars, want %d:\n%+v", len(got), len(want), got)
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if !g.Timestamp.Equal(w.Timestamp) || g.Open != w.Open || g.High != w.High || g.Low != w.Low || g.Close != w.Close || g.Volume != w.Volume {
+			t.Errorf("Bar %d = %+v, want %+v", i, g, w)
+		}
+	}
+}
+
+func TestAggregateDailyMatchesFixture(t *testing.T) {
+	daily, err := Aggregate(loadBars(t, "AAPL_5min.json"), BarSize5Min, BarSize1Day, calendar.DefaultMarketCalendar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertBars(t, daily, loadBars(t, "AAPL_1day.json"))
+}
+
+func TestAggregateIntraday(t *testing.T) {
+	bars := loadBars(t, "AAPL_5min.json")
+	halfHours, err := Aggregate(bars, BarSize5Min, BarSize30Min, calendar.DefaultMarketCalendar())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The pre-market bar is a period of its own session, while the
+	// after-hours bar ending the week only covers part of its period
+	if first := halfHours[0]; first.Session != SessionPreMarket || !first.Timestamp.Equal(bars[0].Timestamp) || first.Close != bars[0].Close {
+		t.Errorf("First 30-minute bar = %+v, want the pre-market bar", first)
+	}
+	regular := halfHours[1:]
+
+	// 13 periods a regular session, 7 on July 3rd, which closes at 13:00
+	perDay := map[string]int{}
+	for _, bar := range regular {
+		if bar.Session != SessionRegular {
+			t.Errorf("30-minute bar of %s in session %q", bar.Timestamp, bar.Session)
+		}
+		perDay[bar.Timestamp.Format(dateLayout)]++
+	}
+	if perDay["2024-07-01"] != 13 || perDay["2024-07-03"] != 7 || len(perDay) != 4 {
+		t.Errorf("30-minute bars per day = %v", perDay)
+	}
+
+	// The first period of the week is the first six bars of the session
+	session := bars[1:7]
+	want := MarketData{Timestamp: session[0].Timestamp, Open: session[0].Open, Close: session[5].Close, High: session[0].High, Low: session[0].Low}
+	for _, bar := range session {
+		want.High, want.Low, want.Volume = max(want.High, bar.High), min(want.Low, bar.Low), want.Volume+bar.Volume
+	}
+	assertBars(t, regular[:1], []MarketData{want})
+
+	// The last period of the early close starts half an hour before it
+	last := regular[13+13+6]
+	if got := last.Timestamp.In(calendar.DefaultMarketCalendar().Location()).Format("2006-01-02 15:04"); got != "2024-07-03 12:30" {
+		t.Errorf("Last bar of July 3rd at %s, want 12:30", got)
+	}
+}
+
+func TestAggregatePartialEdges(t *testing.T) {
+	bars := loadBars(t, "AAPL_5min.json")
+	daily := loadBars(t, "AAPL_1day.json")
+
+	// Without the opening bar of the first session and the closing bar of the
+	// last, only the sessions between are whole
+	partial := bars[2 : len(bars)-2]
+	aggregated, err := Aggregate(partial, BarSize5Min, BarSize1Day, calendar.DefaultMarketCalendar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertBars(t, aggregated, daily[1:3])
+
+	// A period missing bars between its first and last is kept
+	gapped := append(append([]MarketData(nil), bars[:20]...), bars[25:]...)
+	aggregated, err = Aggregate(gapped, BarSize5Min, BarSize1Day, calendar.DefaultMarketCalendar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(aggregated) != len(daily) {
+		t.Errorf("Got %d bars with a gap inside a session, want %d", len(aggregated), len(daily))
+	}
+}
+
+func TestAggregateSizes(t *testing.T) {
+	market := calendar.DefaultMarketCalendar()
+	bars := []MarketData{{Timestamp: time.Date(2024, 7, 1, 13, 30, 0, 0, time.UTC), Open: 1, High: 1, Low: 1, Close: 1}}
+	for _, tc := range []struct {
+		from, to string
+		valid    bool
+	}{
+		{BarSize1Min, BarSize5Min, true},
+		{BarSize1Min, BarSize1Day, true},
+		{BarSize30Min, BarSize1Day, true},
+		{BarSize5Min, BarSize5Min, false},
+		{BarSize30Min, BarSize5Min, false},
+		{BarSize1Day, BarSize1Day, false},
+		{BarSize5Min, "1hour", false},
+	} {
+		if _, err := Aggregate(bars, tc.from, tc.to, market); (err == nil) != tc.valid {
+			t.Errorf("Aggregate(%s, %s) error = %v, want valid %v", tc.from, tc.to, err, tc.valid)
+		}
+	}
+}
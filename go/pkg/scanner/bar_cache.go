@@ -0,0 +1,174 @@
+package scanner
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// dateLayout is the format of request start and end dates
+const dateLayout = "2006-01-02"
+
+// Cache lookup outcomes, recorded on the fetch span: served from memory, from
+// the disk cache after a memory miss, from cached intraday bars aggregated,
+// partly from the cache, or from the provider
+const (
+	cacheResultHit        = "hit"
+	cacheResultDiskHit    = "disk_hit"
+	cacheResultAggregated = "aggregated"
+	cacheResultPartial    = "partial"
+	cacheResultMiss       = "miss"
+)
+
+// dateRange is an inclusive range of calendar dates
+type dateRange struct {
+	start, end time.Time
+}
+
+// barSeries is the cached bar history of one symbol and bar spec. The covered
+// range records which dates have already been requested from the provider; it is
+// tracked separately from the bars so that weekends and halts, which have no
+// bars, are not fetched again.
+type barSeries struct {
+	mu sync.Mutex
+
+	bars     []MarketData // sorted by timestamp
+	from, to time.Time    // covered dates, zero when nothing is cached
+
+	// refreshed is when the series was last merged, used to expire the bars of
+	// the session still in progress
+	refreshed time.Time
+
+	// splits are the corporate actions known when the bars were fetched,
+	// which the bars of an adjusting provider are adjusted for
+	splits []CorporateAction
+}
+
+// empty reports whether no dates are covered
+func (s *barSeries) empty() bool {
+	return s.from.IsZero()
+}
+
+// contiguous reports whether r overlaps or adjoins the covered range, so the
+// two can be merged without leaving a hole
+func (s *barSeries) contiguous(r dateRange) bool {
+	return !s.empty() && !r.end.Before(s.from.AddDate(0, 0, -1)) && !r.start.After(s.to.AddDate(0, 0, 1))
+}
+
+// reset drops the bars and their coverage, keeping the known splits
+func (s *barSeries) reset() {
+	s.bars = nil
+	s.from, s.to = time.Time{}, time.Time{}
+}
+
+// expireOpenSession forgets coverage of today once it is older than ttl, as the
+// bars of an open session are still changing. The bars stay cached and are
+// replaced when today is fetched again.
+func (s *barSeries) expireOpenSession(today, now time.Time, ttl time.Duration) {
+	if s.empty() || s.to.Before(today) || now.Sub(s.refreshed) <= ttl {
+		return
+	}
+	s.to = today.AddDate(0, 0, -1)
+	if s.to.Before(s.from) {
+		s.from, s.to = time.Time{}, time.Time{}
+	}
+}
+
+// covers reports whether the covered range includes r
+func (s *barSeries) covers(r dateRange) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.empty() && !r.start.Before(s.from) && !r.end.After(s.to)
+}
+
+// missing returns the parts of r that have to be fetched and whether any of r
+// can be served from the cache. Only the head and tail around the covered range
+// are fetched; a request that does not touch the covered range is fetched whole.
+func (s *barSeries) missing(r dateRange) ([]dateRange, bool) {
+	if !s.contiguous(r) {
+		return []dateRange{r}, false
+	}
+
+	var ranges []dateRange
+	if r.start.Before(s.from) {
+		ranges = append(ranges, dateRange{start: r.start, end: s.from.AddDate(0, 0, -1)})
+	}
+	if r.end.After(s.to) {
+		ranges = append(ranges, dateRange{start: s.to.AddDate(0, 0, 1), end: r.end})
+	}
+	overlap := !r.end.Before(s.from) && !r.start.After(s.to)
+	return ranges, overlap
+}
+
+// merge adds bars fetched for r. Bars with the same timestamp are replaced by
+// the newly fetched ones. A range that is not contiguous with the covered range
+// replaces the series.
+func (s *barSeries) merge(r dateRange, bars []MarketData, now time.Time) {
+	fetched := make([]MarketData, len(bars))
+	copy(fetched, bars)
+
+	if !s.contiguous(r) {
+		s.bars = nil
+		s.from, s.to = r.start, r.end
+	} else {
+		if r.start.Before(s.from) {
+			s.from = r.start
+		}
+		if r.end.After(s.to) {
+			s.to = r.end
+		}
+	}
+	s.refreshed = now
+
+	// Stable sort keeps fetched bars after cached ones with the same timestamp
+	merged := append(s.bars, fetched...)
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Timestamp.Before(merged[j].Timestamp)
+	})
+
+	s.bars = merged[:0]
+	for i, bar := range merged {
+		if i+1 < len(merged) && merged[i+1].Timestamp.Equal(bar.Timestamp) {
+			continue
+		}
+		s.bars = append(s.bars, bar)
+	}
+}
+
+// prune drops bars more than maxLookback before the end of the covered range.
+// A zero maxLookback keeps everything.
+func (s *barSeries) prune(maxLookback time.Duration) {
+	if maxLookback <= 0 || s.empty() {
+		return
+	}
+
+	cutoff := barDate(s.to.Add(-maxLookback))
+	if !s.from.Before(cutoff) {
+		return
+	}
+	s.from = cutoff
+
+	keep := sort.Search(len(s.bars), func(i int) bool {
+		return !barDate(s.bars[i].Timestamp).Before(cutoff)
+	})
+	s.bars = append([]MarketData(nil), s.bars[keep:]...)
+}
+
+// slice returns a copy of the bars dated within r
+func (s *barSeries) slice(r dateRange) []MarketData {
+	result := make([]MarketData, 0)
+	for _, bar := range s.bars {
+		date := barDate(bar.Timestamp)
+		if date.Before(r.start) || date.After(r.end) {
+			continue
+		}
+		result = append(result, bar)
+	}
+	return result
+}
+
+// barDate returns the calendar date of t in its own location, as a UTC midnight
+// comparable with parsed request dates
+func barDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,113 @@
+package scanner
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Supported bar sizes
+const (
+	BarSize1Min  = "1min"
+	BarSize5Min  = "5min"
+	BarSize30Min = "30min"
+	BarSize1Day  = "1day"
+)
+
+// Supported data types, named as in the IBKR historical data API
+const (
+	WhatToShowTrades                  = "TRADES"
+	WhatToShowMidpoint                = "MIDPOINT"
+	WhatToShowOptionImpliedVolatility = "OPTION_IMPLIED_VOLATILITY"
+)
+
+// barSizeIntervals maps each supported bar size to its duration
+var barSizeIntervals = map[string]time.Duration{
+	BarSize1Min:  time.Minute,
+	BarSize5Min:  5 * time.Minute,
+	BarSize30Min: 30 * time.Minute,
+	BarSize1Day:  24 * time.Hour,
+}
+
+// whatToShowBarSizes lists the bar sizes available for each data type. Implied
+// volatility history is too sparse below 30-minute bars to be useful.
+var whatToShowBarSizes = map[string][]string{
+	WhatToShowTrades:                  {BarSize1Min, BarSize5Min, BarSize30Min, BarSize1Day},
+	WhatToShowMidpoint:                {BarSize1Min, BarSize5Min, BarSize30Min, BarSize1Day},
+	WhatToShowOptionImpliedVolatility: {BarSize30Min, BarSize1Day},
+}
+
+// BarSpec selects the bar size and data type of historical data.
+// IncludeExtendedHours adds the pre-market and after-hours bars to intraday
+// bars; daily bars cover the regular session only.
+type BarSpec struct {
+	BarSize              string
+	WhatToShow           string
+	IncludeExtendedHours bool
+}
+
+// DefaultBarSpec returns daily trade bars
+func DefaultBarSpec() BarSpec {
+	return BarSpec{BarSize: BarSize1Day, WhatToShow: WhatToShowTrades}
+}
+
+// ParseBarSpec validates a bar size and data type from a request, defaulting
+// empty values to daily trade bars
+func ParseBarSpec(barSize, whatToShow string) (BarSpec, error) {
+	spec := DefaultBarSpec()
+	if barSize != "" {
+		spec.BarSize = barSize
+	}
+	if whatToShow != "" {
+		spec.WhatToShow = strings.ToUpper(whatToShow)
+	}
+
+	if _, ok := barSizeIntervals[spec.BarSize]; !ok {
+		return BarSpec{}, fmt.Errorf("unsupported bar size %q, supported: %s, %s, %s, %s",
+			spec.BarSize, BarSize1Min, BarSize5Min, BarSize30Min, BarSize1Day)
+	}
+
+	barSizes, ok := whatToShowBarSizes[spec.WhatToShow]
+	if !ok {
+		return BarSpec{}, fmt.Errorf("unsupported what to show %q, supported: %s, %s, %s",
+			spec.WhatToShow, WhatToShowTrades, WhatToShowMidpoint, WhatToShowOptionImpliedVolatility)
+	}
+	for _, size := range barSizes {
+		if size == spec.BarSize {
+			return spec, nil
+		}
+	}
+	return BarSpec{}, fmt.Errorf("bar size %s is not supported for %s, supported: %s",
+		spec.BarSize, spec.WhatToShow, strings.Join(barSizes, ", "))
+}
+
+// Interval returns the duration of one bar
+func (b BarSpec) Interval() time.Duration {
+	return barSizeIntervals[b.BarSize]
+}
+
+// Intraday reports whether bars are shorter than a trading day
+func (b BarSpec) Intraday() bool {
+	return b.BarSize != BarSize1Day
+}
+
+// String returns the spec in the form used in cache keys, e.g. "30min:TRADES",
+// or "30min:TRADES:EXT" with extended hours
+func (b BarSpec) String() string {
+	if b.IncludeExtendedHours {
+		return b.BarSize + ":" + b.WhatToShow + ":EXT"
+	}
+	return b.BarSize + ":" + b.WhatToShow
+}
+
+// withExtendedHours returns spec including the extended sessions when
+// requested asks for them, or when it is unset and UsePremarketData is on.
+// Daily specs are left without them.
+func (c *Config) withExtendedHours(spec BarSpec, requested *bool) BarSpec {
+	include := c.UsePremarketData
+	if requested != nil {
+		include = *requested
+	}
+	spec.IncludeExtendedHours = include && spec.Intraday()
+	return spec
+}
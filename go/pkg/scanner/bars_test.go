@@ -0,0 +1,42 @@
+package scanner
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseBarSpec(t *testing.T) {
+	tests := []struct {
+		name       string
+		barSize    string
+		whatToShow string
+		want       BarSpec
+		wantErr    string
+	}{
+		{name: "defaults", want: DefaultBarSpec()},
+		{name: "intraday trades", barSize: "30min", whatToShow: "TRADES", want: BarSpec{BarSize: BarSize30Min, WhatToShow: WhatToShowTrades}},
+		{name: "case insensitive data type", barSize: "5min", whatToShow: "midpoint", want: BarSpec{BarSize: BarSize5Min, WhatToShow: WhatToShowMidpoint}},
+		{name: "daily implied volatility", whatToShow: "OPTION_IMPLIED_VOLATILITY", want: BarSpec{BarSize: BarSize1Day, WhatToShow: WhatToShowOptionImpliedVolatility}},
+		{name: "unknown bar size", barSize: "1hour", wantErr: "1min, 5min, 30min, 1day"},
+		{name: "unknown data type", whatToShow: "BID", wantErr: "TRADES, MIDPOINT, OPTION_IMPLIED_VOLATILITY"},
+		{name: "unsupported combination", barSize: "1min", whatToShow: "OPTION_IMPLIED_VOLATILITY", wantErr: "supported: 30min, 1day"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseBarSpec(tt.barSize, tt.whatToShow)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error listing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseBarSpec failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
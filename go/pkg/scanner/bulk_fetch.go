@@ -0,0 +1,346 @@
+package scanner
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// errFetchPanicked is reported by BulkFetchStream for a symbol whose fetch
+// panicked; the panic itself fails the stream once the rest are sent
+var errFetchPanicked = errors.New("internal error")
+
+// bulkPayload is the serialized market data of one symbol
+type bulkPayload struct {
+	data       []byte
+	compressed bool
+}
+
+// size approximates the bytes the payload of symbol adds to a response
+func (p bulkPayload) size(symbol string) int {
+	return len(p.data) + len(symbol) + 16
+}
+
+// bulkMaxTotalBytes returns the limit on the payloads of a BulkFetch response
+func (c *Config) bulkMaxTotalBytes() int {
+	if c.BulkMaxTotalBytes > 0 {
+		return c.BulkMaxTotalBytes
+	}
+	return c.MaxMessageSize
+}
+
+// bulkFetchSpec validates the date range, bar size and concurrency shared by BulkFetch and
+// BulkFetchStream and returns the bars to fetch, with extended hours as the
+// request or else cfg asks
+func bulkFetchSpec(req *pb.BulkFetchRequest, cfg *Config) (BarSpec, error) {
+	if req.DateRange == nil {
+		return BarSpec{}, fmt.Errorf("date range is required")
+	}
+
+	// Honour the older timeframe field when no bar size is given
+	barSize := req.BarSize
+	if barSize == "" && req.Timeframe == "minute" {
+		barSize = BarSize1Min
+	}
+	spec, err := ParseBarSpec(barSize, req.WhatToShow)
+	if err != nil {
+		return BarSpec{}, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if req.MaxConcurrency < 0 {
+		return BarSpec{}, status.Errorf(codes.InvalidArgument, "max concurrency must not be negative, got %d", req.MaxConcurrency)
+	}
+	return cfg.withExtendedHours(spec, req.IncludeExtendedHours), nil
+}
+
+// fetchPayload fetches the bars of symbol within the symbol timeout and
+// serializes them, gzipped past the compression threshold
+func (s *Engine) fetchPayload(ctx context.Context, d *serviceDeps, symbol string, dateRange *pb.DateRange, spec BarSpec) (bulkPayload, error) {
+	symbolCtx, cancel := context.WithTimeout(ctx, d.config.SymbolTimeout)
+	defer cancel()
+
+	marketData, err := s.fetchSymbolData(symbolCtx, d, symbol, dateRange, spec)
+	if err != nil {
+		return bulkPayload{}, err
+	}
+
+	serialized, err := s.serializeMarketData(marketData, nil)
+	if err != nil {
+		logrus.Errorf("Error serializing data for %s: %v", symbol, err)
+		s.metricTracker.IncrementErrorCount()
+		auditError(ctx)
+		return bulkPayload{}, err
+	}
+
+	// Gzip large payloads so big pages stay under the message size limit
+	if threshold := d.config.BulkCompressThreshold; threshold > 0 && len(serialized) > threshold {
+		gzipped, err := gzipPayload(serialized)
+		if err != nil {
+			logrus.Errorf("Error compressing data for %s: %v", symbol, err)
+			s.metricTracker.IncrementErrorCount()
+			auditError(ctx)
+			return bulkPayload{}, err
+		}
+		return bulkPayload{data: gzipped, compressed: true}, nil
+	}
+	return bulkPayload{data: serialized}, nil
+}
+
+// bulkResult is the outcome of fetching one symbol of a BulkFetchStream
+type bulkResult struct {
+	payload bulkPayload
+	err     error
+}
+
+// BulkFetchStream implements the BulkFetchStream RPC method. Symbols are sent
+// in request order as soon as each is fetched. At most the request's worker
+// limit of symbols are fetched ahead of the one being sent, so a slow reader holds the fetching
+// back through flow control instead of the payloads piling up in memory. Above
+// the hard memory watermark the stream ends with RESOURCE_EXHAUSTED.
+func (s *ScannerService) BulkFetchStream(req *pb.BulkFetchRequest, stream pb.ScannerService_BulkFetchStreamServer) error {
+	startTime := time.Now()
+	d := s.current()
+
+	ctx, span := s.tracer.Start(stream.Context(), "BulkFetchStream", trace.WithAttributes(attribute.Int("scanner.symbol_count", len(req.Symbols))))
+	defer span.End()
+
+	spec, err := bulkFetchSpec(req, d.config)
+	if err == nil && (req.PageSize != 0 || req.PageToken != "") {
+		err = status.Error(codes.InvalidArgument, "BulkFetchStream does not page; leave page_size and page_token unset")
+	}
+	if err != nil {
+		recordSpanError(span, err)
+		return err
+	}
+	span.SetAttributes(attrBarSpec.String(spec.String()))
+
+	if err := s.admitProviderCalls(ctx); err != nil {
+		recordSpanError(span, err)
+		return err
+	}
+	if err := s.admitBulkFetch(ctx, d.config); err != nil {
+		recordSpanError(span, err)
+		return err
+	}
+
+	// The memory guard cancels the stream above the hard watermark
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	defer s.memory.track(cancel)()
+
+	// Name the symbols as the data provider does; invalid ones are sent
+	// with their error, unfetched
+	names := make([]string, len(req.Symbols))
+	invalid := make([]error, len(req.Symbols))
+	for i, symbol := range req.Symbols {
+		if names[i], invalid[i] = NormalizeSymbol(d.dataProvider, symbol); invalid[i] != nil {
+			names[i], invalid[i] = symbol, fmt.Errorf("%s: %w", ErrorInvalidSymbol, invalid[i])
+		}
+	}
+
+	// pending holds the result of each dispatched symbol in request order; its
+	// capacity is how far the fetching may run ahead of the sending
+	workers := s.workersFor(req.MaxConcurrency)
+	pending := make(chan chan bulkResult, workers.size())
+	var held atomic.Int64
+	var wg sync.WaitGroup
+	var panics panicCollector
+
+	go func() {
+		defer close(pending)
+		for i, symbol := range names {
+			result := make(chan bulkResult, 1)
+			select {
+			case pending <- result:
+			case <-ctx.Done():
+				return
+			}
+			if invalid[i] != nil {
+				result <- bulkResult{err: invalid[i]}
+				continue
+			}
+
+			if err := workers.acquire(ctx); err != nil {
+				result <- bulkResult{err: err}
+				return
+			}
+
+			wg.Add(1)
+			go func(sym string) {
+				defer wg.Done()
+				defer workers.release()
+
+				outcome := bulkResult{err: errFetchPanicked}
+				defer func() {
+					if outcome.err == nil {
+						if n := held.Add(1); s.onPayloadHeld != nil {
+							s.onPayloadHeld(int(n))
+						}
+					}
+					result <- outcome
+				}()
+				defer panics.capture()
+
+				outcome.payload, outcome.err = s.fetchPayload(ctx, d, sym, req.DateRange, spec)
+			}(symbol)
+		}
+	}()
+
+	// Send in request order; a failed symbol carries its error instead of data
+	var sendErr error
+	for _, symbol := range names {
+		result, ok := <-pending
+		if !ok {
+			break
+		}
+		outcome := <-result
+		if sendErr = memoryCancelled(ctx, d.config); sendErr != nil {
+			break
+		}
+		msg := &pb.SymbolData{Symbol: symbol, Data: outcome.payload.data, Compressed: outcome.payload.compressed}
+		if outcome.err != nil {
+			msg.Error = outcome.err.Error()
+		} else {
+			held.Add(-1)
+		}
+		if sendErr = stream.Send(msg); sendErr != nil {
+			break
+		}
+	}
+
+	// On a failed send stop dispatching and let the running fetches finish
+	cancel(nil)
+	for range pending {
+	}
+	wg.Wait()
+	panics.repanic()
+
+	if sendErr == nil {
+		sendErr = stream.Context().Err()
+	}
+	if sendErr != nil {
+		recordSpanError(span, sendErr)
+		return sendErr
+	}
+
+	s.metricTracker.RecordFetch(len(req.Symbols), time.Since(startTime).Seconds())
+	return nil
+}
+
+// paginate returns the symbols of the page selected by the request's page size
+// and token, plus the token of the following page, which is empty on the last
+// page. A zero page size returns every symbol.
+func paginate(req *pb.BulkFetchRequest) ([]string, string, error) {
+	offset := 0
+	if req.PageToken != "" {
+		var err error
+		offset, err = decodePageToken(req.PageToken, req)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	if req.PageSize < 0 {
+		return nil, "", fmt.Errorf("page size must not be negative, got %d", req.PageSize)
+	}
+	if req.PageSize == 0 {
+		return req.Symbols[offset:], "", nil
+	}
+
+	end := offset + int(req.PageSize)
+	if end >= len(req.Symbols) {
+		return req.Symbols[offset:], "", nil
+	}
+	return req.Symbols[offset:end], encodePageToken(end, req), nil
+}
+
+// encodePageToken encodes the offset of the next page together with a
+// fingerprint of the request, so a token cannot be replayed against a
+// different symbol list
+func encodePageToken(offset int, req *pb.BulkFetchRequest) string {
+	token := strconv.Itoa(offset) + ":" + requestFingerprint(req)
+	return base64.RawURLEncoding.EncodeToString([]byte(token))
+}
+
+// decodePageToken returns the offset encoded in token
+func decodePageToken(token string, req *pb.BulkFetchRequest) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, fmt.Errorf("malformed page token")
+	}
+
+	offsetText, fingerprint, found := strings.Cut(string(raw), ":")
+	offset, err := strconv.Atoi(offsetText)
+	if !found || err != nil || offset < 0 || offset > len(req.Symbols) {
+		return 0, fmt.Errorf("malformed page token")
+	}
+	if fingerprint != requestFingerprint(req) {
+		return 0, fmt.Errorf("page token does not belong to this request")
+	}
+	return offset, nil
+}
+
+// requestFingerprint hashes the fields that must stay the same across pages
+func requestFingerprint(req *pb.BulkFetchRequest) string {
+	h := fnv.New64a()
+	for _, symbol := range req.Symbols {
+		h.Write([]byte(symbol))
+		h.Write([]byte{0})
+	}
+	h.Write([]byte(req.GetDateRange().GetStartDate() + ":" + req.GetDateRange().GetEndDate()))
+	return strconv.FormatUint(h.Sum64(), 36)
+}
+
+// gzipPayload compresses a serialized symbol payload
+func gzipPayload(payload []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(payload); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// BulkFetchPayload returns the serialized market data for symbol from a
+// BulkFetch response, decompressing it when the server gzipped it
+func BulkFetchPayload(resp *pb.BulkFetchResponse, symbol string) ([]byte, error) {
+	payload, ok := resp.GetData()[symbol]
+	if !ok {
+		return nil, fmt.Errorf("no data for %s", symbol)
+	}
+	if !resp.GetCompressed()[symbol] {
+		return payload, nil
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress data for %s: %w", symbol, err)
+	}
+	defer zr.Close()
+
+	decompressed, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress data for %s: %w", symbol, err)
+	}
+	return decompressed, nil
+}
@@ -0,0 +1,278 @@
+package scanner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+func TestBulkFetchPagesAndDecompresses(t *testing.T) {
+	service := newMockTestService(t)
+	options, err := ServerOptions(DefaultConfig(), service.Metrics())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := dialTestServerWithOptions(t, service, options, grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name)))
+
+	symbols := make([]string, 12)
+	for i := range symbols {
+		symbols[i] = fmt.Sprintf("SYM%02d", i)
+	}
+
+	// A month of minute bars per symbol, well over the compression threshold
+	req := &pb.BulkFetchRequest{
+		Symbols:   symbols,
+		DateRange: testDateRange(),
+		BarSize:   BarSize1Min,
+		PageSize:  5,
+	}
+
+	fetched := map[string]int{}
+	pages := 0
+	for {
+		resp, err := client.BulkFetch(context.Background(), req)
+		if err != nil {
+			t.Fatalf("BulkFetch page %d failed: %v", pages, err)
+		}
+		pages++
+
+		for symbol := range resp.Data {
+			if !resp.Compressed[symbol] {
+				t.Errorf("Large payload for %s should be compressed", symbol)
+			}
+			payload, err := BulkFetchPayload(resp, symbol)
+			if err != nil {
+				t.Fatalf("BulkFetchPayload(%s) failed: %v", symbol, err)
+			}
+			var bars []MarketData
+			if err := json.Unmarshal(payload, &bars); err != nil {
+				t.Fatalf("Decoding %s failed: %v", symbol, err)
+			}
+			if len(bars) == 0 || bars[0].Symbol != symbol {
+				t.Fatalf("Unexpected bars for %s", symbol)
+			}
+			fetched[symbol] = len(bars)
+		}
+
+		if resp.NextPageToken == "" {
+			break
+		}
+		req.PageToken = resp.NextPageToken
+	}
+
+	if pages != 3 {
+		t.Errorf("Pages: got %d, want 3", pages)
+	}
+	if len(fetched) != len(symbols) {
+		t.Errorf("Fetched %d symbols, want %d", len(fetched), len(symbols))
+	}
+	// 22 sessions of 390 minute bars in January 2024 from the 2nd to the 31st
+	if fetched["SYM00"] != 22*390 {
+		t.Errorf("Bars for SYM00: got %d, want %d", fetched["SYM00"], 22*390)
+	}
+}
+
+func TestBulkFetchSmallRequestUnchanged(t *testing.T) {
+	service := newMockTestService(t)
+
+	resp, err := service.BulkFetch(context.Background(), &pb.BulkFetchRequest{
+		Symbols:   []string{"AAPL", "MSFT"},
+		DateRange: testDateRange(),
+	})
+	if err != nil {
+		t.Fatalf("BulkFetch failed: %v", err)
+	}
+	if len(resp.Data) != 2 || resp.Compressed != nil || resp.NextPageToken != "" {
+		t.Errorf("Small request should be unpaged and uncompressed: %v", resp)
+	}
+
+	var bars []MarketData
+	if err := json.Unmarshal(resp.Data["AAPL"], &bars); err != nil || len(bars) == 0 {
+		t.Errorf("Payload should be plain JSON: %v", err)
+	}
+}
+
+func TestBulkFetchRejectsForeignPageToken(t *testing.T) {
+	service := newMockTestService(t)
+	ctx := context.Background()
+
+	first, err := service.BulkFetch(ctx, &pb.BulkFetchRequest{
+		Symbols:   []string{"AAPL", "MSFT", "XOM"},
+		DateRange: testDateRange(),
+		PageSize:  1,
+	})
+	if err != nil || first.NextPageToken == "" {
+		t.Fatalf("First page: %v, %v", first, err)
+	}
+
+	_, err = service.BulkFetch(ctx, &pb.BulkFetchRequest{
+		Symbols:   []string{"SPY", "QQQ"},
+		DateRange: testDateRange(),
+		PageSize:  1,
+		PageToken: first.NextPageToken,
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for a token from another request, got %v", err)
+	}
+}
+
+// unevenProvider serves rising bars, slower for the symbols earlier in the
+// alphabet so they finish out of request order, and fails for BAD
+type unevenProvider struct{}
+
+func (unevenProvider) GetHistoricalData(ctx context.Context, symbol, startDate, endDate string, spec BarSpec) ([]MarketData, error) {
+	if symbol == "BAD" {
+		return nil, errors.New("no such symbol")
+	}
+	time.Sleep(time.Duration('Z'-symbol[len(symbol)-1]) * time.Millisecond)
+	return risingBars(symbol, startDate, endDate), nil
+}
+
+func TestBulkFetchStreamSendsInRequestOrder(t *testing.T) {
+	service := newTestService(t)
+	useProvider(service, unevenProvider{})
+	client := dialTestServer(t, service)
+
+	symbols := []string{"SYMA", "SYMB", "BAD", "SYMC", "SYMD", "SYME", "SYMF"}
+	stream, err := client.BulkFetchStream(context.Background(), &pb.BulkFetchRequest{
+		Symbols:   symbols,
+		DateRange: testDateRange(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		got = append(got, msg.Symbol)
+
+		if msg.Symbol == "BAD" {
+			if msg.Error == "" || msg.Data != nil {
+				t.Errorf("Failed symbol: got %v, want only an error", msg)
+			}
+			continue
+		}
+		var bars []MarketData
+		if err := json.Unmarshal(msg.Data, &bars); err != nil || len(bars) == 0 || bars[0].Symbol != msg.Symbol {
+			t.Errorf("Payload for %s: %d bars, %v", msg.Symbol, len(bars), err)
+		}
+	}
+	if strings.Join(got, ",") != strings.Join(symbols, ",") {
+		t.Errorf("Symbols sent: got %v, want %v", got, symbols)
+	}
+}
+
+func TestBulkFetchStreamBoundsHeldPayloads(t *testing.T) {
+	service := newMockTestService(t)
+	service.workers.resize(3)
+	var mu sync.Mutex
+	maxHeld := 0
+	service.onPayloadHeld = func(held int) {
+		mu.Lock()
+		maxHeld = max(maxHeld, held)
+		mu.Unlock()
+	}
+	client := dialTestServer(t, service)
+
+	// Minute bars are large enough to fill the flow control window, so the
+	// slow reader below holds the sends back
+	symbols := make([]string, 15)
+	for i := range symbols {
+		symbols[i] = fmt.Sprintf("SYM%02d", i)
+	}
+	stream, err := client.BulkFetchStream(context.Background(), &pb.BulkFetchRequest{
+		Symbols:   symbols,
+		DateRange: &pb.DateRange{StartDate: "2024-01-02", EndDate: "2024-01-05"},
+		BarSize:   BarSize1Min,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received := 0
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		if msg.Error != "" || !msg.Compressed {
+			t.Errorf("%s: got error %q, compressed %v", msg.Symbol, msg.Error, msg.Compressed)
+		}
+		received++
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if received != len(symbols) {
+		t.Errorf("Received %d symbols, want %d", received, len(symbols))
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	// The 3 results queued behind the one being sent may all be fetched
+	if maxHeld == 0 || maxHeld > 4 {
+		t.Errorf("Payloads held at once: got %d, want between 1 and the 3 workers plus the one being sent", maxHeld)
+	}
+}
+
+func TestBulkFetchStreamRejectsPaging(t *testing.T) {
+	service := newTestService(t)
+	client := dialTestServer(t, service)
+
+	stream, err := client.BulkFetchStream(context.Background(), &pb.BulkFetchRequest{
+		Symbols:   []string{"AAPL", "MSFT"},
+		DateRange: testDateRange(),
+		PageSize:  1,
+	})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for a page size, got %v", err)
+	}
+}
+
+func TestBulkFetchTooLargeIsResourceExhausted(t *testing.T) {
+	service := newTestService(t)
+	cfg := *service.Config()
+	cfg.BulkMaxTotalBytes = 4 * 1024
+	service.UpdateConfig(&cfg)
+	useProvider(service, risingProvider{})
+
+	symbols := make([]string, 20)
+	for i := range symbols {
+		symbols[i] = fmt.Sprintf("SYM%02d", i)
+	}
+	req := &pb.BulkFetchRequest{Symbols: symbols, DateRange: testDateRange()}
+	_, err := service.BulkFetch(context.Background(), req)
+	if status.Code(err) != codes.ResourceExhausted || !strings.Contains(err.Error(), "BulkFetchStream") {
+		t.Fatalf("Expected ResourceExhausted pointing at BulkFetchStream, got %v", err)
+	}
+
+	// A page within the limit still succeeds
+	req.PageSize = 1
+	if resp, err := service.BulkFetch(context.Background(), req); err != nil || len(resp.Data) != 1 {
+		t.Errorf("Single page: %v, %v", resp, err)
+	}
+}
@@ -1,90 +1,437 @@
 package scanner
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
+
+	"github.com/trustdan/ibkr-trader/go/pkg/calendar"
 )
 
-// Config holds configuration for the scanner service
+// Config holds the configuration for the scanner service
 type Config struct {
-	// Server configuration
-	ServerAddress string `json:"server_address"`
+	// Server settings
+	ServerHost string `yaml:"server_host" json:"server_host"`
+	ServerPort string `yaml:"server_port" json:"server_port"`
+
+	// Metrics server settings
+	MetricsHost string `yaml:"metrics_host" json:"metrics_host"`
+	MetricsPort string `yaml:"metrics_port" json:"metrics_port"`
+
+	// Metric persistence; with a snapshot file, the counters are saved there
+	// every MetricsSnapshotInterval (a minute when zero) and on shutdown, and
+	// restored on startup. Both are only read at startup.
+	MetricsSnapshotFile     string        `yaml:"metrics_snapshot_file" json:"metrics_snapshot_file"`
+	MetricsSnapshotInterval time.Duration `yaml:"metrics_snapshot_interval" json:"metrics_snapshot_interval"`
+
+	// Security settings; TLS is enabled when a certificate is configured, mutual
+	// TLS when a client CA is also set, and token auth when a token is set
+	TLSCertFile       string   `yaml:"tls_cert_file" json:"tls_cert_file"`
+	TLSKeyFile        string   `yaml:"tls_key_file" json:"tls_key_file"`
+	TLSClientCAFile   string   `yaml:"tls_client_ca_file" json:"tls_client_ca_file"`
+	AuthToken         string   `yaml:"auth_token" json:"auth_token"`
+	AuthTokenFile     string   `yaml:"auth_token_file" json:"auth_token_file"`
+	AuthExemptMethods []string `yaml:"auth_exempt_methods" json:"auth_exempt_methods"`
+
+	// Logging settings; successful RPCs are logged once every RequestLogSampling
+	// calls, failed RPCs are always logged. LogFormat is "text" or "json". With a
+	// LogFile, logs are written there and also to stdout when it is a terminal;
+	// the file is rotated past LogMaxSizeMB, keeping LogMaxBackups rotated files
+	// for at most LogMaxAgeDays (0 keeps them all).
+	LogLevel           string `yaml:"log_level" json:"log_level"`
+	RequestLogSampling int    `yaml:"request_log_sampling" json:"request_log_sampling"`
+	LogFormat          string `yaml:"log_format" json:"log_format"`
+	LogFile            string `yaml:"log_file" json:"log_file"`
+	LogMaxSizeMB       int    `yaml:"log_max_size_mb" json:"log_max_size_mb"`
+	LogMaxBackups      int    `yaml:"log_max_backups" json:"log_max_backups"`
+	LogMaxAgeDays      int    `yaml:"log_max_age_days" json:"log_max_age_days"`
+
+	// Performance settings
+	MaxConcurrency       int           `yaml:"max_concurrency" json:"max_concurrency"`
+	MaxConcurrentStreams int           `yaml:"max_concurrent_streams" json:"max_concurrent_streams"`
+	MaxMessageSize       int           `yaml:"max_message_size" json:"max_message_size"`
+	SymbolTimeout        time.Duration `yaml:"symbol_timeout" json:"symbol_timeout"`
+
+	// Connection settings; a connection idle for GRPCKeepaliveTime is pinged
+	// and closed when the ping is not answered within GRPCKeepaliveTimeout,
+	// so a dead client is released. Connections idle for
+	// GRPCMaxConnectionIdle, or open for GRPCMaxConnectionAge, are sent
+	// GOAWAY, the latter after GRPCMaxConnectionAgeGrace for its calls to
+	// finish; zero leaves them open. Clients pinging more often than every
+	// GRPCKeepaliveMinTime are disconnected. Connections beyond
+	// MaxConcurrentConnections, 0 for no limit, are closed as soon as they
+	// are accepted. Read when the scanner starts.
+	GRPCKeepaliveTime         time.Duration `yaml:"grpc_keepalive_time" json:"grpc_keepalive_time"`
+	GRPCKeepaliveTimeout      time.Duration `yaml:"grpc_keepalive_timeout" json:"grpc_keepalive_timeout"`
+	GRPCKeepaliveMinTime      time.Duration `yaml:"grpc_keepalive_min_time" json:"grpc_keepalive_min_time"`
+	GRPCMaxConnectionIdle     time.Duration `yaml:"grpc_max_connection_idle" json:"grpc_max_connection_idle"`
+	GRPCMaxConnectionAge      time.Duration `yaml:"grpc_max_connection_age" json:"grpc_max_connection_age"`
+	GRPCMaxConnectionAgeGrace time.Duration `yaml:"grpc_max_connection_age_grace" json:"grpc_max_connection_age_grace"`
+	MaxConcurrentConnections  int           `yaml:"max_concurrent_connections" json:"max_concurrent_connections"`
+
+	// A symbol whose fetch times out SymbolCooldownAfter scans in a row is
+	// skipped by the next SymbolCooldownScans scans; 0 never skips symbols
+	SymbolCooldownAfter int `yaml:"symbol_cooldown_after" json:"symbol_cooldown_after"`
+	SymbolCooldownScans int `yaml:"symbol_cooldown_scans" json:"symbol_cooldown_scans"`
+
+	// BulkFetch payloads larger than this many bytes are gzipped, 0 disables it
+	BulkCompressThreshold int `yaml:"bulk_compress_threshold" json:"bulk_compress_threshold"`
+
+	// A BulkFetch response whose payloads add up to more than this many bytes
+	// fails with RESOURCE_EXHAUSTED; 0 uses MaxMessageSize
+	BulkMaxTotalBytes int `yaml:"bulk_max_total_bytes" json:"bulk_max_total_bytes"`
+
+	// Memory guard; every MemoryCheckInterval the heap in use is compared with
+	// the watermarks, each the lower of its MB and its percent of the cgroup
+	// memory limit, with 0 leaving a form unset. Above the soft watermark the
+	// worker pool shrinks to MemoryGuardMinWorkers, the oldest cached series
+	// are dropped and new bulk fetches fail with RESOURCE_EXHAUSTED, asking
+	// to retry after MemoryRetryAfter; above the hard watermark the bulk
+	// fetches in flight are cancelled too. MemoryCheckInterval, 0 disabling
+	// the guard, is read when the scanner starts.
+	MemorySoftWatermarkMB      int           `yaml:"memory_soft_watermark_mb" json:"memory_soft_watermark_mb"`
+	MemorySoftWatermarkPercent float64       `yaml:"memory_soft_watermark_percent" json:"memory_soft_watermark_percent"`
+	MemoryHardWatermarkMB      int           `yaml:"memory_hard_watermark_mb" json:"memory_hard_watermark_mb"`
+	MemoryHardWatermarkPercent float64       `yaml:"memory_hard_watermark_percent" json:"memory_hard_watermark_percent"`
+	MemoryCheckInterval        time.Duration `yaml:"memory_check_interval" json:"memory_check_interval"`
+	MemoryGuardMinWorkers      int           `yaml:"memory_guard_min_workers" json:"memory_guard_min_workers"`
+	MemoryRetryAfter           time.Duration `yaml:"memory_retry_after" json:"memory_retry_after"`
+
+	// GetScanHistory keeps the signals of the last ScanHistorySize scans, 0
+	// keeps none
+	ScanHistorySize int `yaml:"scan_history_size" json:"scan_history_size"`
+
+	// With an AuditLogDir, every Scan, BulkFetch and Backtest call is recorded
+	// in its audit.jsonl, which is rotated past AuditLogMaxSizeMB keeping
+	// AuditLogMaxFiles rotated files (0 keeps them all). Up to
+	// AuditLogBufferSize records wait for the disk before new ones are
+	// dropped. Read when the scanner starts.
+	AuditLogDir        string `yaml:"audit_log_dir" json:"audit_log_dir"`
+	AuditLogMaxSizeMB  int    `yaml:"audit_log_max_size_mb" json:"audit_log_max_size_mb"`
+	AuditLogMaxFiles   int    `yaml:"audit_log_max_files" json:"audit_log_max_files"`
+	AuditLogBufferSize int    `yaml:"audit_log_buffer_size" json:"audit_log_buffer_size"`
+
+	// ExportResults writes the files it is asked for under ExportDir, which a
+	// requested path cannot leave
+	ExportDir string `yaml:"export_dir" json:"export_dir"`
+
+	// Caching settings; CacheTTL bounds how long bars of the current session are
+	// reused, CacheSeriesTTL how long an unused symbol's bars are kept and
+	// CacheMaxLookback how much history is kept per symbol. With
+	// CacheAggregateBars, daily bars are built from the cached intraday bars
+	// of the same data type when they cover the requested dates.
+	CacheEnabled         bool          `yaml:"cache_enabled" json:"cache_enabled"`
+	CacheTTL             time.Duration `yaml:"cache_ttl" json:"cache_ttl"`
+	CacheSeriesTTL       time.Duration `yaml:"cache_series_ttl" json:"cache_series_ttl"`
+	CacheMaxLookback     time.Duration `yaml:"cache_max_lookback" json:"cache_max_lookback"`
+	CacheCleanupInterval time.Duration `yaml:"cache_cleanup_interval" json:"cache_cleanup_interval"`
+	MaxCachedItems       int           `yaml:"max_cached_items" json:"max_cached_items"`
+	CacheAggregateBars   bool          `yaml:"cache_aggregate_bars" json:"cache_aggregate_bars"`
+
+	// Disk cache settings; with CacheDiskDir set, a series missing from memory
+	// is read from its file there, one per symbol and bar spec, before the
+	// provider is asked, and fetched bars are appended to it. A file not
+	// written for CacheDiskTTL is dropped, while the bars of the current
+	// session follow CacheTTL as in memory. A file holding more than
+	// CacheDiskMaxSegments appended ranges is compacted in the background.
+	CacheDiskDir         string        `yaml:"cache_disk_dir" json:"cache_disk_dir"`
+	CacheDiskTTL         time.Duration `yaml:"cache_disk_ttl" json:"cache_disk_ttl"`
+	CacheDiskMaxSegments int           `yaml:"cache_disk_max_segments" json:"cache_disk_max_segments"`
+
+	// Data provider settings; MockSeed varies the prices of the mock provider,
+	// which are otherwise the same for every run. DataProviderURL is the API
+	// base URL of yahoo and the host:port of TWS or IB Gateway for ibkr.
+	// UsePremarketData fetches the pre-market and after-hours bars of
+	// intraday bar sizes along with the regular session's, for requests that
+	// do not say; only strategies declaring they read them see them.
+	DataProviderType  string `yaml:"data_provider_type" json:"data_provider_type"`
+	DataProviderURL   string `yaml:"data_provider_url" json:"data_provider_url"`
+	DataProviderToken string `yaml:"data_provider_token" json:"data_provider_token"`
+	MockSeed          int64  `yaml:"mock_seed" json:"mock_seed"`
+	UsePremarketData  bool   `yaml:"use_premarket_data" json:"use_premarket_data"`
+
+	// Startup wait; before reporting SERVING and scheduling scans the scanner
+	// probes the data provider until it answers, first after
+	// DataProviderProbeBackoff and then doubling the delay up to 30s, for at
+	// most DataProviderWaitMax, 0 skipping the wait. Until then Scan,
+	// BulkFetch and Backtest fail with UNAVAILABLE. Read when the scanner
+	// starts.
+	DataProviderWaitMax      time.Duration `yaml:"data_provider_wait_max" json:"data_provider_wait_max"`
+	DataProviderProbeBackoff time.Duration `yaml:"data_provider_probe_backoff" json:"data_provider_probe_backoff"`
+
+	// Fault injection for testing; with ChaosEnabled, or a DataProviderType
+	// of "chaos:<type>", fetches from the provider fail at ChaosErrorRate,
+	// stall past SymbolTimeout at ChaosTimeoutRate and are delayed by
+	// ChaosLatency plus up to ChaosJitter. Symbols of ChaosFailSymbols always
+	// fail. A zero ChaosSeed draws different faults on each start.
+	ChaosEnabled     bool          `yaml:"chaos_enabled" json:"chaos_enabled"`
+	ChaosErrorRate   float64       `yaml:"chaos_error_rate" json:"chaos_error_rate"`
+	ChaosTimeoutRate float64       `yaml:"chaos_timeout_rate" json:"chaos_timeout_rate"`
+	ChaosLatency     time.Duration `yaml:"chaos_latency" json:"chaos_latency"`
+	ChaosJitter      time.Duration `yaml:"chaos_jitter" json:"chaos_jitter"`
+	ChaosFailSymbols []string      `yaml:"chaos_fail_symbols" json:"chaos_fail_symbols"`
+	ChaosSeed        int64         `yaml:"chaos_seed" json:"chaos_seed"`
+
+	// Event calendar settings
+	EventCalendarType     string        `yaml:"event_calendar_type" json:"event_calendar_type"`
+	EventCalendarURL      string        `yaml:"event_calendar_url" json:"event_calendar_url"`
+	EventCalendarToken    string        `yaml:"event_calendar_token" json:"event_calendar_token"`
+	EventCalendarCacheTTL time.Duration `yaml:"event_calendar_cache_ttl" json:"event_calendar_cache_ttl"`
+
+	// Universe settings
+	UniverseFile         string        `yaml:"universe_file" json:"universe_file"`
+	UniverseCacheDir     string        `yaml:"universe_cache_dir" json:"universe_cache_dir"`
+	UniverseCacheExpiry  time.Duration `yaml:"universe_cache_expiry" json:"universe_cache_expiry"`
+	UniverseMinMarketCap float64       `yaml:"universe_min_market_cap" json:"universe_min_market_cap"`
+	UniverseMinPrice     float64       `yaml:"universe_min_price" json:"universe_min_price"`
+	UniverseMinVolume    float64       `yaml:"universe_min_volume" json:"universe_min_volume"`
+
+	// Scan profiles by name, which scan requests and the scheduler can name
+	Profiles map[string]ScanProfile `yaml:"profiles" json:"profiles"`
+
+	// Custom strategies by name, scanned alongside the built-in ones; their
+	// rules are compiled when the config is loaded
+	CustomStrategies map[string]CustomStrategy `yaml:"custom_strategies" json:"custom_strategies"`
 
-	// Performance configuration
-	MaxConcurrency int `json:"max_concurrency"`
+	// Scheduled scan settings; a zero ScanInterval disables scheduled scans. Scans
+	// run on exchange trading days between the trading hours ("15:04", in the
+	// market's timezone) and no later than an early close, or around the clock
+	// when the hours are empty, and results are posted to
+	// ScanPushURL when set. With a ScanProfile, scheduled scans use that
+	// profile, falling back to ScanStrategies and ScanLookbackDays for what it
+	// leaves unset. With ScanIncludeDiff scheduled scans are diffed against
+	// the previous one, and with ScanPushDiffOnly only that diff is posted,
+	// and nothing when no signal was added or removed.
+	ScanInterval          time.Duration `yaml:"scan_interval" json:"scan_interval"`
+	ScanProfile           string        `yaml:"scan_profile" json:"scan_profile"`
+	ScanStrategies        []string      `yaml:"scan_strategies" json:"scan_strategies"`
+	ScanLookbackDays      int           `yaml:"scan_lookback_days" json:"scan_lookback_days"`
+	ScanTradingHoursStart string        `yaml:"scan_trading_hours_start" json:"scan_trading_hours_start"`
+	ScanTradingHoursEnd   string        `yaml:"scan_trading_hours_end" json:"scan_trading_hours_end"`
+	ScanPushURL           string        `yaml:"scan_push_url" json:"scan_push_url"`
+	ScanPushToken         string        `yaml:"scan_push_token" json:"scan_push_token"`
+	ScanIncludeDiff       bool          `yaml:"scan_include_diff" json:"scan_include_diff"`
+	ScanPushDiffOnly      bool          `yaml:"scan_push_diff_only" json:"scan_push_diff_only"`
 
-	// Data provider configuration
-	DataProviderType string `json:"data_provider_type"`
-	APIKey           string `json:"api_key"`
+	// Webhook endpoints each scheduled scan's results are posted to, signed
+	// and filtered per endpoint. Deliveries wait on a queue of
+	// WebhookQueueSize, read at startup, and are dropped when it is full.
+	Webhooks         []WebhookConfig `yaml:"webhooks" json:"webhooks"`
+	WebhookQueueSize int             `yaml:"webhook_queue_size" json:"webhook_queue_size"`
 
-	// Logging configuration
-	LogLevel string `json:"log_level"`
+	// Market calendar the trading hours are checked against: the embedded NYSE
+	// holidays and early closes, with MarketCalendarFile's dates merged over
+	// them, in MarketTimezone
+	MarketTimezone     string `yaml:"market_timezone" json:"market_timezone"`
+	MarketCalendarFile string `yaml:"market_calendar_file" json:"market_calendar_file"`
 
-	// Cache configuration
-	CacheTTL     int `json:"cache_ttl"`
-	ScanInterval int `json:"scan_interval"`
+	// Data quality settings; with DataQualityEnabled each symbol's bars are
+	// checked before the strategies are evaluated, and the symbol is left out
+	// of the scan when its daily bars skip more than DataQualityMaxMissing
+	// open market days, more than DataQualityMaxBadBars bars have a price at
+	// or below zero, a high below the low or a repeated timestamp, or more
+	// than DataQualityMaxGaps closes move over DataQualityGapPercent from the
+	// previous close
+	DataQualityEnabled    bool    `yaml:"data_quality_enabled" json:"data_quality_enabled"`
+	DataQualityMaxMissing int     `yaml:"data_quality_max_missing" json:"data_quality_max_missing"`
+	DataQualityMaxBadBars int     `yaml:"data_quality_max_bad_bars" json:"data_quality_max_bad_bars"`
+	DataQualityGapPercent float64 `yaml:"data_quality_gap_percent" json:"data_quality_gap_percent"`
+	DataQualityMaxGaps    int     `yaml:"data_quality_max_gaps" json:"data_quality_max_gaps"`
+
+	// Warm-up settings; with WarmupEnabled the scanner prefetches the last
+	// ScanLookbackDays of bars for WarmupSymbols, or the cached universe when
+	// empty, once the gRPC server starts. WarmupConcurrency workers of their own
+	// do the fetches and progress is logged every WarmupLogEvery symbols. With a
+	// WarmupReadyFraction above zero the gRPC health status is NOT_SERVING until
+	// that fraction of the symbols is cached.
+	WarmupEnabled       bool     `yaml:"warmup_enabled" json:"warmup_enabled"`
+	WarmupSymbols       []string `yaml:"warmup_symbols" json:"warmup_symbols"`
+	WarmupConcurrency   int      `yaml:"warmup_concurrency" json:"warmup_concurrency"`
+	WarmupLogEvery      int      `yaml:"warmup_log_every" json:"warmup_log_every"`
+	WarmupReadyFraction float64  `yaml:"warmup_ready_fraction" json:"warmup_ready_fraction"`
+
+	// Symbol metadata settings; an empty file reports every sector as UNKNOWN
+	MetadataFile string `yaml:"metadata_file" json:"metadata_file"`
+
+	// Debug settings
+	Debug            bool   `yaml:"debug" json:"debug"`
+	ProfilerEnabled  bool   `yaml:"profiler_enabled" json:"profiler_enabled"`
+	ProfilerEndpoint string `yaml:"profiler_endpoint" json:"profiler_endpoint"`
+
+	// Tracing settings; spans are exported over OTLP/gRPC when enabled and a
+	// fraction TracingSampleRatio of new traces is sampled
+	TracingEnabled     bool    `yaml:"tracing_enabled" json:"tracing_enabled"`
+	TracingEndpoint    string  `yaml:"tracing_endpoint" json:"tracing_endpoint"`
+	TracingInsecure    bool    `yaml:"tracing_insecure" json:"tracing_insecure"`
+	TracingServiceName string  `yaml:"tracing_service_name" json:"tracing_service_name"`
+	TracingSampleRatio float64 `yaml:"tracing_sample_ratio" json:"tracing_sample_ratio"`
+
+	// Where the settings came from, set by the loaders; a setting missing
+	// here has its default
+	file    string
+	sources map[string]string
 }
 
-// NewDefaultConfig creates a new configuration with default values
-func NewDefaultConfig() *Config {
+// DefaultConfig returns the default configuration. The older unprefixed
+// environment variables read here (SERVER_PORT, LOG_LEVEL, ...) only change
+// defaults, which the config file overrides; LoadLayeredConfig applies the
+// SCANNER_ variables over the file.
+func DefaultConfig() *Config {
 	return &Config{
-		ServerAddress:    getEnvOrDefault("SERVER_ADDRESS", "0.0.0.0:50051"),
-		MaxConcurrency:   getEnvIntOrDefault("MAX_CONCURRENCY", 50),
-		DataProviderType: getEnvOrDefault("DATA_PROVIDER_TYPE", "mock"),
-		APIKey:           getEnvOrDefault("API_KEY", ""),
-		LogLevel:         getEnvOrDefault("LOG_LEVEL", "info"),
-		CacheTTL:         getEnvIntOrDefault("CACHE_TTL", 15),
-		ScanInterval:     getEnvIntOrDefault("SCAN_INTERVAL", 5),
-	}
-}
+		ServerHost:            getEnvOrDefault("SERVER_HOST", "0.0.0.0"),
+		ServerPort:            getEnvOrDefault("SERVER_PORT", "50051"),
+		MetricsHost:           "0.0.0.0",
+		MetricsPort:           getEnvOrDefault("METRICS_PORT", "2112"),
+		MetricsSnapshotFile:   getEnvOrDefault("METRICS_SNAPSHOT_FILE", ""),
+		AuthToken:             getEnvOrDefault("SCANNER_AUTH_TOKEN", ""),
+		LogLevel:              getEnvOrDefault("LOG_LEVEL", "info"),
+		RequestLogSampling:    1,
+		LogFormat:             getEnvOrDefault("LOG_FORMAT", "text"),
+		LogFile:               getEnvOrDefault("LOG_FILE", ""),
+		LogMaxSizeMB:          100,
+		LogMaxBackups:         5,
+		LogMaxAgeDays:         30,
+		MaxConcurrency:        getEnvIntOrDefault("MAX_CONCURRENCY", 50),
+		MaxConcurrentStreams:  100,
+		MaxMessageSize:        10 * 1024 * 1024, // 10MB
+		BulkCompressThreshold: 64 * 1024,
+		ScanHistorySize:       20,
 
-// LoadConfig loads the scanner service configuration from a JSON file
-func LoadConfig(configPath string) (*Config, error) {
-	// Resolve relative path if needed
-	if !filepath.IsAbs(configPath) {
-		workDir, err := os.Getwd()
-		if err != nil {
-			return nil, err
-		}
-		configPath = filepath.Join(workDir, configPath)
+		MemorySoftWatermarkPercent: 75,
+		MemoryHardWatermarkPercent: 90,
+		MemoryCheckInterval:        5 * time.Second,
+		MemoryGuardMinWorkers:      4,
+		MemoryRetryAfter:           30 * time.Second,
+
+		DataProviderWaitMax:      5 * time.Minute,
+		DataProviderProbeBackoff: time.Second,
+
+		WebhookQueueSize: 100,
+
+		AuditLogDir:           getEnvOrDefault("AUDIT_LOG_DIR", ""),
+		AuditLogMaxSizeMB:     10,
+		AuditLogMaxFiles:      5,
+		AuditLogBufferSize:    1024,
+		ExportDir:             "exports",
+		SymbolTimeout:         5 * time.Second,
+		GRPCKeepaliveTime:     time.Minute,
+		GRPCKeepaliveTimeout:  20 * time.Second,
+		GRPCKeepaliveMinTime:  20 * time.Second,
+		SymbolCooldownAfter:   3,
+		SymbolCooldownScans:   5,
+		CacheEnabled:          true,
+		CacheTTL:              5 * time.Minute,
+		CacheSeriesTTL:        48 * time.Hour,
+		CacheMaxLookback:      400 * 24 * time.Hour,
+		CacheCleanupInterval:  1 * time.Minute,
+		MaxCachedItems:        10000,
+		CacheAggregateBars:    true,
+		CacheDiskTTL:          30 * 24 * time.Hour,
+		CacheDiskMaxSegments:  8,
+		DataProviderType:      getEnvOrDefault("DATA_PROVIDER_TYPE", "mock"),
+		DataProviderToken:     getEnvOrDefault("API_KEY", ""),
+		EventCalendarType:     "none",
+		EventCalendarCacheTTL: 24 * time.Hour,
+		ScanStrategies:        []string{"HIGH_BASE", "LOW_BASE"},
+		ScanLookbackDays:      60,
+		ScanTradingHoursStart: "09:30",
+		ScanTradingHoursEnd:   "16:00",
+		MarketTimezone:        "America/New_York",
+		DataQualityEnabled:    true,
+		DataQualityMaxMissing: 2,
+		DataQualityGapPercent: 30,
+		DataQualityMaxGaps:    1,
+		WarmupConcurrency:     2,
+		WarmupLogEvery:        100,
+		UniverseFile:          "universe.txt",
+		UniverseCacheDir:      "cache",
+		UniverseCacheExpiry:   24 * time.Hour,
+		UniverseMinMarketCap:  10e9,
+		UniverseMinPrice:      20,
+		UniverseMinVolume:     1e6,
+		Debug:                 false,
+		TracingEnabled:        false,
+		TracingEndpoint:       "localhost:4317",
+		TracingInsecure:       true,
+		TracingServiceName:    "ibkr-scanner",
+		TracingSampleRatio:    1.0,
+		ProfilerEnabled:       false,
+		ProfilerEndpoint:      "/debug/pprof",
 	}
+}
 
-	logrus.Infof("Loading configuration from: %s", configPath)
+// LoadConfig loads the configuration from a YAML or JSON file on top of the
+// defaults. The format is taken from the file extension (.yaml, .yml, .json) and
+// otherwise detected from the content. JSON is decoded with the YAML decoder, which
+// accepts it, so both formats share field names and duration strings such as "5m".
+// Keys Config does not know are ignored and returned as warnings. The rules of
+// custom strategies are compiled and webhooks and the event calendar checked,
+// so a config with an invalid one fails to load.
+func LoadConfig(configPath string) (*Config, []ConfigWarning, error) {
+	config := DefaultConfig()
 
-	// Read the configuration file
-	configData, err := os.ReadFile(configPath)
+	data, err := os.ReadFile(configPath)
 	if err != nil {
-		return nil, err
+		return nil, nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	// Parse the JSON data
-	var config Config
-	if err := json.Unmarshal(configData, &config); err != nil {
-		return nil, err
+	format := detectConfigFormat(configPath, data)
+	if format == "json" && !json.Valid(data) {
+		return nil, nil, fmt.Errorf("config file %s is not valid JSON", configPath)
 	}
 
-	// Set defaults for empty values
-	if config.ServerAddress == "" {
-		config.ServerAddress = ":50051"
+	warnings, err := decodeConfig(data, config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse %s config: %w", format, err)
 	}
-
-	if config.LogLevel == "" {
-		config.LogLevel = "info"
+	if _, err := compileCustomStrategies(config.CustomStrategies); err != nil {
+		return nil, nil, fmt.Errorf("invalid config %s: %w", configPath, err)
+	}
+	if err := validateWebhooks(config.Webhooks); err != nil {
+		return nil, nil, fmt.Errorf("invalid config %s: %w", configPath, err)
+	}
+	if _, err := calendar.NewEventCalendarProvider(config.EventCalendarType, config.EventCalendarURL, config.EventCalendarToken, 0); err != nil {
+		return nil, nil, fmt.Errorf("invalid config %s: %w", configPath, err)
+	}
+	config.file = configPath
+	for _, key := range fileKeys(data) {
+		config.setSource(key, SourceFile)
 	}
 
-	if config.CacheTTL == 0 {
-		config.CacheTTL = 15 // 15 minutes default
+	logrus.Infof("Loaded %s configuration from %s", format, configPath)
+	return config, warnings, nil
+}
+
+// detectConfigFormat returns "json" or "yaml" for a config file
+func detectConfigFormat(path string, data []byte) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return "json"
+	case ".yaml", ".yml":
+		return "yaml"
 	}
 
-	if config.ScanInterval == 0 {
-		config.ScanInterval = 5 // 5 minutes default
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		return "json"
 	}
+	return "yaml"
+}
+
+// ListenAddress returns the host:port the gRPC server listens on
+func (c *Config) ListenAddress() string {
+	return c.ServerHost + ":" + c.ServerPort
+}
 
-	return &config, nil
+// MetricsAddress returns the host:port the Prometheus metrics server listens on
+func (c *Config) MetricsAddress() string {
+	return c.MetricsHost + ":" + c.MetricsPort
 }
 
 // getEnvOrDefault gets an environment variable or returns a default value
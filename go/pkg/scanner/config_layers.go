@@ -0,0 +1,332 @@
+package scanner
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// Sources of a setting, in increasing precedence
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// EnvPrefix starts the environment variable overriding each setting
+const EnvPrefix = "SCANNER_"
+
+// redacted replaces the value of a secret that is set
+const redacted = "[REDACTED]"
+
+// secretSettings are the settings whose values are never logged or reported
+var secretSettings = map[string]bool{
+	"auth_token":           true,
+	"data_provider_token":  true,
+	"event_calendar_token": true,
+	"scan_push_token":      true,
+}
+
+// EnvVar returns the environment variable overriding the setting key: the
+// key in upper case after EnvPrefix, e.g. SCANNER_MAX_CONCURRENCY for
+// max_concurrency
+func EnvVar(key string) string {
+	return EnvPrefix + strings.ToUpper(key)
+}
+
+// FlagName returns the command-line flag overriding the setting key: the key
+// with hyphens, e.g. max-concurrency for max_concurrency
+func FlagName(key string) string {
+	return strings.ReplaceAll(key, "_", "-")
+}
+
+// configSetting is a top-level setting of Config
+type configSetting struct {
+	key   string
+	index int
+	typ   reflect.Type
+}
+
+// overridable reports whether environment variables and flags can set the
+// setting; maps such as profiles and custom_strategies can only be set in
+// the config file
+func (s configSetting) overridable() bool {
+	switch s.typ.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int64, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return s.typ.Elem().Kind() == reflect.String
+	}
+	return false
+}
+
+// configSettings returns the settings of Config in field order
+func configSettings() []configSetting {
+	t := reflect.TypeOf(Config{})
+	var settings []configSetting
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if !field.IsExported() || key == "" || key == "-" {
+			continue
+		}
+		settings = append(settings, configSetting{key: key, index: i, typ: field.Type})
+	}
+	return settings
+}
+
+// set parses value into the setting of config. Lists are comma-separated.
+func (s configSetting) set(config *Config, value string) error {
+	field := reflect.ValueOf(config).Elem().Field(s.index)
+	if s.typ == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration such as 30s or 5m", value)
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch s.typ.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, s.typ.Bits())
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		field.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("%s can only be set in the config file", s.key)
+	}
+	return nil
+}
+
+// format returns the setting's value in config as text
+func (s configSetting) format(config *Config) string {
+	value := reflect.ValueOf(config).Elem().Field(s.index).Interface()
+	switch v := value.(type) {
+	case time.Duration:
+		return v.String()
+	case []string:
+		return strings.Join(v, ",")
+	case string:
+		return v
+	case map[string]ScanProfile, map[string]CustomStrategy:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	case []WebhookConfig:
+		webhooks := slices.Clone(v)
+		for i := range webhooks {
+			if webhooks[i].Secret != "" {
+				webhooks[i].Secret = redacted
+			}
+		}
+		encoded, _ := json.Marshal(webhooks)
+		return string(encoded)
+	}
+	return fmt.Sprint(value)
+}
+
+// ConfigFlags are the command-line flags overriding the settings, one for
+// each setting an environment variable can override
+type ConfigFlags struct {
+	values map[string]*configFlag
+}
+
+// configFlag is the flag of a setting, holding its text until the
+// configuration is loaded
+type configFlag struct {
+	value  string
+	set    bool
+	isBool bool
+}
+
+func (f *configFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.value
+}
+
+func (f *configFlag) Set(value string) error {
+	f.value, f.set = value, true
+	return nil
+}
+
+// IsBoolFlag lets a boolean setting's flag be given without a value
+func (f *configFlag) IsBoolFlag() bool {
+	return f.isBool
+}
+
+// RegisterConfigFlags defines the flags of the settings on fs, named by
+// FlagName. Their values are parsed by LoadLayeredConfig.
+func RegisterConfigFlags(fs *flag.FlagSet) *ConfigFlags {
+	flags := &ConfigFlags{values: make(map[string]*configFlag)}
+	for _, setting := range configSettings() {
+		if !setting.overridable() {
+			continue
+		}
+		value := &configFlag{isBool: setting.typ.Kind() == reflect.Bool}
+		fs.Var(value, FlagName(setting.key), fmt.Sprintf("override %s of the config file (also %s)", setting.key, EnvVar(setting.key)))
+		flags.values[setting.key] = value
+	}
+	return flags
+}
+
+// lookup returns the value of the flag of key when it was given
+func (f *ConfigFlags) lookup(key string) (string, bool) {
+	if f == nil || f.values[key] == nil || !f.values[key].set {
+		return "", false
+	}
+	return f.values[key].value, true
+}
+
+// LoadLayeredConfig loads the configuration in layers, each overriding the
+// last: the defaults, the config file at configPath, the SCANNER_
+// environment variables named by EnvVar and the flags of RegisterConfigFlags;
+// flags may be nil. A variable or flag whose value does not parse fails the
+// load with an error naming it.
+func LoadLayeredConfig(configPath string, flags *ConfigFlags) (*Config, []ConfigWarning, error) {
+	config, warnings, err := LoadConfig(configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := applyOverrides(config, os.LookupEnv, flags); err != nil {
+		return nil, nil, err
+	}
+	return config, warnings, nil
+}
+
+// applyOverrides sets the settings of config given by environment variables,
+// looked up with lookupEnv, then by flags
+func applyOverrides(config *Config, lookupEnv func(string) (string, bool), flags *ConfigFlags) error {
+	for _, setting := range configSettings() {
+		if !setting.overridable() {
+			continue
+		}
+		if value, ok := lookupEnv(EnvVar(setting.key)); ok {
+			if err := setting.set(config, value); err != nil {
+				return fmt.Errorf("invalid environment variable %s: %w", EnvVar(setting.key), err)
+			}
+			config.setSource(setting.key, SourceEnv)
+		}
+		if value, ok := flags.lookup(setting.key); ok {
+			if err := setting.set(config, value); err != nil {
+				return fmt.Errorf("invalid flag -%s: %w", FlagName(setting.key), err)
+			}
+			config.setSource(setting.key, SourceFlag)
+		}
+	}
+	return nil
+}
+
+// fileKeys returns the top-level keys of a config file
+func fileKeys(data []byte) []string {
+	var root yaml.Node
+	if yaml.Unmarshal(data, &root) != nil || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return nil
+	}
+	mapping := root.Content[0]
+	keys := make([]string, 0, len(mapping.Content)/2)
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		keys = append(keys, mapping.Content[i].Value)
+	}
+	return keys
+}
+
+// setSource records where the setting key came from
+func (c *Config) setSource(key, source string) {
+	if c.sources == nil {
+		c.sources = make(map[string]string)
+	}
+	c.sources[key] = source
+}
+
+// Source returns where the setting key came from: SourceDefault,
+// SourceFile, SourceEnv or SourceFlag
+func (c *Config) Source(key string) string {
+	if source, ok := c.sources[key]; ok {
+		return source
+	}
+	return SourceDefault
+}
+
+// ConfigValue is a setting of the effective configuration
+type ConfigValue struct {
+	Key    string
+	Value  string // redacted for a secret that is set
+	Source string
+	EnvVar string // the variable the setting came from, when it did
+	Flag   string // the flag the setting came from, when it did
+}
+
+// Effective returns every setting of c in key order with where it came
+// from, secrets redacted
+func (c *Config) Effective() []ConfigValue {
+	var values []ConfigValue
+	for _, setting := range configSettings() {
+		value := ConfigValue{Key: setting.key, Value: setting.format(c), Source: c.Source(setting.key)}
+		if secretSettings[setting.key] && value.Value != "" {
+			value.Value = redacted
+		}
+		switch value.Source {
+		case SourceEnv:
+			value.EnvVar = EnvVar(setting.key)
+		case SourceFlag:
+			value.Flag = "-" + FlagName(setting.key)
+		}
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].Key < values[j].Key })
+	return values
+}
+
+// GetEffectiveConfig implements the GetEffectiveConfig RPC method
+func (s *Engine) GetEffectiveConfig(ctx context.Context, req *pb.EffectiveConfigRequest) (*pb.EffectiveConfigResponse, error) {
+	config := s.Config()
+	resp := &pb.EffectiveConfigResponse{ConfigFile: config.file}
+	for _, value := range config.Effective() {
+		resp.Values = append(resp.Values, &pb.ConfigValue{
+			Key:    value.Key,
+			Value:  value.Value,
+			Source: value.Source,
+			EnvVar: value.EnvVar,
+			Flag:   value.Flag,
+		})
+	}
+	return resp, nil
+}
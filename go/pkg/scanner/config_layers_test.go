@@ -0,0 +1,140 @@
+package scanner
+
+import (
+	"context"
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// loadLayered loads content as the config file, with env set as environment
+// variables and args parsed as flags
+func loadLayered(t *testing.T, content string, env map[string]string, args ...string) (*Config, error) {
+	t.Helper()
+	for name, value := range env {
+		t.Setenv(name, value)
+	}
+	fs := flag.NewFlagSet("scanner", flag.ContinueOnError)
+	flags := RegisterConfigFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("Parse(%v) error = %v", args, err)
+	}
+	config, _, err := LoadLayeredConfig(writeConfig(t, "config.yaml", content), flags)
+	return config, err
+}
+
+func TestLayeredConfigPrecedence(t *testing.T) {
+	file := strings.Join([]string{
+		"max_concurrency: 10",
+		"data_provider_url: http://file",
+		"log_level: warn",
+		"symbol_timeout: 10s",
+		"scan_strategies: [HIGH_BASE]",
+		"universe_min_price: 10",
+	}, "\n")
+	env := map[string]string{
+		"SCANNER_MAX_CONCURRENCY":    "20",
+		"SCANNER_DATA_PROVIDER_URL":  "http://env",
+		"SCANNER_LOG_LEVEL":          "debug",
+		"SCANNER_CACHE_ENABLED":      "false",
+		"SCANNER_SCAN_STRATEGIES":    "LOW_BASE, HIGH_BASE",
+		"SCANNER_UNIVERSE_MIN_PRICE": "7",
+	}
+	config, err := loadLayered(t, file, env,
+		"-max-concurrency=30", "-log-level", "error", "-cache-enabled", "-universe-min-price=5")
+	if err != nil {
+		t.Fatalf("LoadLayeredConfig() error = %v", err)
+	}
+
+	tests := []struct {
+		key    string
+		got    interface{}
+		want   interface{}
+		source string
+	}{
+		// Each layer over the last
+		{key: "max_concurrency", got: config.MaxConcurrency, want: 30, source: SourceFlag},
+		{key: "log_level", got: config.LogLevel, want: "error", source: SourceFlag},
+		{key: "cache_enabled", got: config.CacheEnabled, want: true, source: SourceFlag},
+		{key: "universe_min_price", got: config.UniverseMinPrice, want: 5.0, source: SourceFlag},
+		{key: "data_provider_url", got: config.DataProviderURL, want: "http://env", source: SourceEnv},
+		{key: "scan_strategies", got: config.ScanStrategies, want: []string{"LOW_BASE", "HIGH_BASE"}, source: SourceEnv},
+		{key: "symbol_timeout", got: config.SymbolTimeout, want: 10 * time.Second, source: SourceFile},
+		{key: "max_message_size", got: config.MaxMessageSize, want: 10 * 1024 * 1024, source: SourceDefault},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) || config.Source(tt.key) != tt.source {
+			t.Errorf("%s = %v from %s, want %v from %s", tt.key, tt.got, config.Source(tt.key), tt.want, tt.source)
+		}
+	}
+}
+
+func TestLayeredConfigRejectsInvalidValues(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{name: "Integer", env: map[string]string{"SCANNER_MAX_CONCURRENCY": "lots"}, want: "SCANNER_MAX_CONCURRENCY"},
+		{name: "Duration", env: map[string]string{"SCANNER_SYMBOL_TIMEOUT": "5"}, want: "SCANNER_SYMBOL_TIMEOUT"},
+		{name: "Boolean", env: map[string]string{"SCANNER_DEBUG": "sometimes"}, want: "SCANNER_DEBUG"},
+		{name: "Flag", args: []string{"-tracing-sample-ratio=half"}, want: "-tracing-sample-ratio"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadLayered(t, "max_concurrency: 10", tt.env, tt.args...)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadLayeredConfig() error = %v, want one naming %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEffectiveConfigOverGRPC(t *testing.T) {
+	config, err := loadLayered(t, "auth_token: hunter2\nmax_concurrency: 10",
+		map[string]string{"SCANNER_SCAN_PUSH_TOKEN": "push-secret"}, "-data-provider-url=http://flag")
+	if err != nil {
+		t.Fatalf("LoadLayeredConfig() error = %v", err)
+	}
+	config.CacheEnabled = false
+	config.EventCalendarType = "none"
+	service := newTestService(t)
+	service.UpdateConfig(config)
+
+	resp, err := dialTestServer(t, service).GetEffectiveConfig(context.Background(), &pb.EffectiveConfigRequest{})
+	if err != nil {
+		t.Fatalf("GetEffectiveConfig RPC failed: %v", err)
+	}
+	if !strings.HasSuffix(resp.GetConfigFile(), "config.yaml") {
+		t.Errorf("ConfigFile = %q", resp.GetConfigFile())
+	}
+
+	values := make(map[string]*pb.ConfigValue)
+	for _, value := range resp.GetValues() {
+		values[value.GetKey()] = value
+		if strings.Contains(value.GetValue(), "hunter2") || strings.Contains(value.GetValue(), "push-secret") {
+			t.Errorf("%s reveals a secret: %q", value.GetKey(), value.GetValue())
+		}
+	}
+	tests := []struct {
+		key, value, source, envVar, flag string
+	}{
+		{key: "auth_token", value: redacted, source: SourceFile},
+		{key: "scan_push_token", value: redacted, source: SourceEnv, envVar: "SCANNER_SCAN_PUSH_TOKEN"},
+		{key: "data_provider_url", value: "http://flag", source: SourceFlag, flag: "-data-provider-url"},
+		{key: "max_concurrency", value: "10", source: SourceFile},
+		{key: "symbol_timeout", value: "5s", source: SourceDefault},
+		{key: "event_calendar_token", value: "", source: SourceDefault},
+	}
+	for _, tt := range tests {
+		got := values[tt.key]
+		if got.GetValue() != tt.value || got.GetSource() != tt.source || got.GetEnvVar() != tt.envVar || got.GetFlag() != tt.flag {
+			t.Errorf("%s = %v, want %+v", tt.key, got, tt)
+		}
+	}
+}
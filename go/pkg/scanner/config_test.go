@@ -0,0 +1,146 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfigFormats(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{
+			name:    "YAML",
+			file:    "config.yaml",
+			content: "server_port: \"6000\"\nmax_concurrency: 8\nsymbol_timeout: 2s\nmetadata_file: sectors.csv\n",
+		},
+		{
+			name:    "JSON",
+			file:    "config.json",
+			content: `{"server_port": "6000", "max_concurrency": 8, "symbol_timeout": "2s", "metadata_file": "sectors.csv"}`,
+		},
+		{
+			name:    "JSON detected from content",
+			file:    "scanner.conf",
+			content: `  {"server_port": "6000", "max_concurrency": 8, "symbol_timeout": "2s", "metadata_file": "sectors.csv"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, warnings, err := LoadConfig(writeConfig(t, tt.file, tt.content))
+			if err != nil {
+				t.Fatalf("LoadConfig failed: %v", err)
+			}
+			if len(warnings) > 0 {
+				t.Errorf("Unexpected warnings %v", warnings)
+			}
+
+			if config.ServerPort != "6000" || config.MaxConcurrency != 8 || config.MetadataFile != "sectors.csv" {
+				t.Errorf("Unexpected config values: %+v", config)
+			}
+			if config.SymbolTimeout != 2*time.Second {
+				t.Errorf("SymbolTimeout: got %v, want 2s", config.SymbolTimeout)
+			}
+			// Unset values keep their defaults
+			if config.CacheTTL != 5*time.Minute || !config.CacheEnabled {
+				t.Errorf("Defaults not preserved: %+v", config)
+			}
+		})
+	}
+}
+
+func TestLoadConfigRejectsInvalidJSON(t *testing.T) {
+	if _, _, err := LoadConfig(writeConfig(t, "config.json", "server_port: 6000\n")); err == nil {
+		t.Error("Expected error for YAML content in a .json file")
+	}
+}
+
+func TestRepositoryConfigLoads(t *testing.T) {
+	config, warnings, err := LoadConfig("../../config.json")
+	if err != nil {
+		t.Fatalf("Failed to load repository config.json: %v", err)
+	}
+	if len(warnings) > 0 {
+		t.Errorf("Repository config.json has unknown keys: %v", warnings)
+	}
+	if config.ListenAddress() != "0.0.0.0:50051" || config.MetricsAddress() != "0.0.0.0:2112" {
+		t.Errorf("Unexpected addresses: %s, %s", config.ListenAddress(), config.MetricsAddress())
+	}
+}
+
+func TestLoadConfigWarnsAboutMisspelledKeys(t *testing.T) {
+	tests := []struct {
+		name           string
+		file           string
+		content        string
+		wantKey        string
+		wantSuggestion string
+	}{
+		{"Missing letter", "config.yaml", "max_concurency: 8\n", "max_concurency", "max_concurrency"},
+		{"Swapped letters", "config.yaml", "server_prot: \"6000\"\n", "server_prot", "server_port"},
+		{"Doubled letter", "config.yaml", "cache_ttll: 1m\n", "cache_ttll", "cache_ttl"},
+		{"Hyphen for underscore", "config.json", `{"symbol-timeout": "2s"}`, "symbol-timeout", "symbol_timeout"},
+		{"Wrong case", "config.json", `{"Log_Levle": "debug"}`, "Log_Levle", "log_level"},
+		{"Nested in a profile", "config.yaml", "profiles:\n  daily:\n    lookback_dyas: 30\n", "profiles.daily.lookback_dyas", "lookback_days"},
+		{"Unrelated key", "config.yaml", "favourite_colour: blue\n", "favourite_colour", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, warnings, err := LoadConfig(writeConfig(t, tt.file, tt.content))
+			if err != nil {
+				t.Fatalf("LoadConfig failed: %v", err)
+			}
+			if config.MaxConcurrency != DefaultConfig().MaxConcurrency {
+				t.Errorf("MaxConcurrency = %d, want the default", config.MaxConcurrency)
+			}
+			if len(warnings) != 1 {
+				t.Fatalf("Warnings = %v, want one", warnings)
+			}
+			warning := warnings[0]
+			if warning.Key != tt.wantKey || warning.Suggestion != tt.wantSuggestion {
+				t.Errorf("Warning = %+v, want key %q suggesting %q", warning, tt.wantKey, tt.wantSuggestion)
+			}
+			if tt.wantSuggestion != "" && !strings.Contains(warning.Message, "did you mean "+tt.wantSuggestion+"? "+tt.wantSuggestion+" is not set") {
+				t.Errorf("Message = %q", warning.Message)
+			}
+		})
+	}
+}
+
+func TestLoadConfigStillRejectsInvalidValues(t *testing.T) {
+	if _, _, err := LoadConfig(writeConfig(t, "config.yaml", "max_concurency: 8\nmax_concurrency: many\n")); err == nil {
+		t.Error("Expected an error for a value of the wrong type next to an unknown key")
+	}
+}
+
+func TestLoadConfigChecksEventCalendarType(t *testing.T) {
+	config, _, err := LoadConfig(writeConfig(t, "config.yaml", "max_concurrency: 4\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.EventCalendarType != "none" {
+		t.Errorf("EventCalendarType = %q, want none by default", config.EventCalendarType)
+	}
+
+	for _, content := range []string{"event_calendar_type: nasdaq\n", "event_calendar_type: http\n"} {
+		if _, _, err := LoadConfig(writeConfig(t, "config.yaml", content)); err == nil {
+			t.Errorf("Loading %q succeeded, want an invalid event calendar", content)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package scanner
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigWarning is a setting of the config file that is ignored, typically a
+// misspelled key whose intended setting keeps its default
+type ConfigWarning struct {
+	// Key is the full path of the setting, e.g. "profiles.daily.lookback_dyas"
+	Key string
+	// Suggestion is the known key of the same mapping the key is probably a
+	// misspelling of
+	Suggestion string
+	Message    string
+}
+
+// String returns the warning's message
+func (w ConfigWarning) String() string {
+	return w.Message
+}
+
+// decodeConfig decodes a YAML or JSON config file into config, rejecting
+// keys Config does not know. Those are returned as warnings rather than
+// failing the load, so that a typo does not stop the scanner.
+func decodeConfig(data []byte, config *Config) ([]ConfigWarning, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	err := decoder.Decode(config)
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		// The decoder sets every known field before reporting unknown ones
+		var others []string
+		for _, message := range typeErr.Errors {
+			if !strings.Contains(message, "not found in type") {
+				others = append(others, message)
+			}
+		}
+		err = nil
+		if len(others) > 0 {
+			err = &yaml.TypeError{Errors: others}
+		}
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	if len(root.Content) == 0 {
+		return nil, nil
+	}
+	return unknownKeyWarnings(root.Content[0], reflect.TypeOf(Config{}), ""), nil
+}
+
+// unknownKeyWarnings returns a warning for each key under node that type t
+// has no field for, descending into the fields, map values and list items
+// it knows
+func unknownKeyWarnings(node *yaml.Node, t reflect.Type, path string) []ConfigWarning {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	var warnings []ConfigWarning
+	switch {
+	case t.Kind() == reflect.Struct && node.Kind == yaml.MappingNode:
+		fields, names := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i].Value, node.Content[i+1]
+			keyPath := joinKey(path, key)
+			if field, ok := fields[key]; ok {
+				warnings = append(warnings, unknownKeyWarnings(value, field, keyPath)...)
+				continue
+			}
+			warnings = append(warnings, unknownKeyWarning(node, keyPath, key, names))
+		}
+	case t.Kind() == reflect.Map && node.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			keyPath := joinKey(path, node.Content[i].Value)
+			warnings = append(warnings, unknownKeyWarnings(node.Content[i+1], t.Elem(), keyPath)...)
+		}
+	case t.Kind() == reflect.Slice && node.Kind == yaml.SequenceNode:
+		for i, item := range node.Content {
+			warnings = append(warnings, unknownKeyWarnings(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+	return warnings
+}
+
+// unknownKeyWarning describes the unknown key of mapping, suggesting the
+// known key nearest it
+func unknownKeyWarning(mapping *yaml.Node, keyPath, key string, known []string) ConfigWarning {
+	warning := ConfigWarning{
+		Key:        keyPath,
+		Suggestion: closestKey(key, known),
+		Message:    fmt.Sprintf("%s is not a known setting and is ignored", keyPath),
+	}
+	if warning.Suggestion == "" {
+		return warning
+	}
+	warning.Message += fmt.Sprintf("; did you mean %s?", warning.Suggestion)
+	for i := 0; i < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == warning.Suggestion {
+			return warning
+		}
+	}
+	warning.Message += fmt.Sprintf(" %s is not set and keeps its default", warning.Suggestion)
+	return warning
+}
+
+// yamlFields returns the types of struct t's fields by YAML key, and the keys
+func yamlFields(t reflect.Type) (map[string]reflect.Type, []string) {
+	fields := make(map[string]reflect.Type)
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field.Type
+		names = append(names, name)
+	}
+	return fields, names
+}
+
+// joinKey appends key to the dotted path
+func joinKey(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// closestKey returns the known key nearest name by edit distance, if it is
+// near enough to be a misspelling: two edits, or a quarter of the key's
+// length for longer keys
+func closestKey(name string, known []string) string {
+	best, bestDistance := "", -1
+	for _, candidate := range known {
+		distance := editDistance(strings.ToLower(name), strings.ToLower(candidate))
+		if distance > max(2, len(candidate)/4) || distance >= len(candidate) {
+			continue
+		}
+		if bestDistance < 0 || distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b, counting a
+// swap of adjacent characters as one edit like an insertion, deletion or
+// substitution
+func editDistance(a, b string) int {
+	rows := make([][]int, len(a)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(b)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			rows[i][j] = min(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				rows[i][j] = min(rows[i][j], rows[i-2][j-2]+1)
+			}
+		}
+	}
+	return rows[len(a)][len(b)]
+}
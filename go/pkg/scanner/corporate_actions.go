@@ -0,0 +1,56 @@
+package scanner
+
+import (
+	"context"
+	"time"
+)
+
+// CorporateActionSplit is the type of a stock split, the only corporate
+// action the providers report so far
+const CorporateActionSplit = "split"
+
+// CorporateAction is an event that changes a symbol's prices without the
+// market moving them. Ratio is the shares held after a split per share held
+// before, 4 for a 4:1 split and 0.1 for a 1:10 reverse split.
+type CorporateAction struct {
+	Symbol string    `json:"symbol"`
+	Type   string    `json:"type"`
+	Date   time.Time `json:"date"` // ex-date, as a UTC midnight
+	Ratio  float64   `json:"ratio"`
+}
+
+// CorporateActionProvider is implemented by data providers whose bars are
+// adjusted for the corporate actions they report. Bars fetched before an
+// action then no longer match those fetched after it.
+type CorporateActionProvider interface {
+	// GetCorporateActions returns the actions of symbol dated between
+	// startDate and endDate, oldest first
+	GetCorporateActions(ctx context.Context, symbol, startDate, endDate string) ([]CorporateAction, error)
+}
+
+// GetCorporateActions returns the corporate actions provider reports for
+// symbol between startDate and endDate, none when it reports none
+func GetCorporateActions(ctx context.Context, provider DataProvider, symbol, startDate, endDate string) ([]CorporateAction, error) {
+	if reporter, ok := provider.(CorporateActionProvider); ok {
+		return reporter.GetCorporateActions(ctx, symbol, startDate, endDate)
+	}
+	return nil, nil
+}
+
+// newActions returns the actions of actions missing from known
+func newActions(known, actions []CorporateAction) []CorporateAction {
+	var added []CorporateAction
+	for _, action := range actions {
+		found := false
+		for _, k := range known {
+			if k.Type == action.Type && k.Date.Equal(action.Date) && k.Ratio == action.Ratio {
+				found = true
+				break
+			}
+		}
+		if !found {
+			added = append(added, action)
+		}
+	}
+	return added
+}
@@ -0,0 +1,148 @@
+package scanner
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/trustdan/ibkr-trader/go/pkg/calendar"
+)
+
+// splitProvider serves bars of a stock trading near 400 that splits 4:1 on
+// the split date. Like Yahoo, it adjusts every bar for the split once it
+// reports it, which it does only from announced on.
+type splitProvider struct {
+	split     time.Time
+	announced bool
+	fetches   []string
+}
+
+func (p *splitProvider) GetHistoricalData(ctx context.Context, symbol, startDate, endDate string, spec BarSpec) ([]MarketData, error) {
+	p.fetches = append(p.fetches, startDate+".."+endDate)
+	data := risingBars(symbol, startDate, endDate)
+	for i := range data {
+		close := 400 + float64(data[i].Timestamp.YearDay())
+		if p.announced || !data[i].Timestamp.Before(p.split) {
+			close /= 4
+		}
+		data[i].Open, data[i].High, data[i].Low, data[i].Close = close, close+1, close-1, close
+		data[i].Adjusted = true
+	}
+	return data, nil
+}
+
+func (p *splitProvider) GetCorporateActions(ctx context.Context, symbol, startDate, endDate string) ([]CorporateAction, error) {
+	if !p.announced {
+		return nil, nil
+	}
+	return []CorporateAction{{Symbol: symbol, Type: CorporateActionSplit, Date: p.split, Ratio: 4}}, nil
+}
+
+func TestCachedDataProviderDropsBarsOnSplit(t *testing.T) {
+	cfg := diskCacheConfig(t)
+	ctx := context.Background()
+	now := time.Date(2024, 2, 15, 15, 0, 0, 0, time.UTC)
+	base := &splitProvider{split: time.Date(2024, 1, 16, 0, 0, 0, 0, time.UTC)}
+	provider := NewCachedDataProvider(cfg, base, nil)
+	provider.now = func() time.Time { return now }
+
+	if _, err := provider.GetHistoricalData(ctx, "NVDA", "2024-01-02", "2024-01-12", DefaultBarSpec()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The split shows up before the tail is fetched, so the whole range is
+	base.announced = true
+	data, err := provider.GetHistoricalData(ctx, "NVDA", "2024-01-02", "2024-01-31", DefaultBarSpec())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(base.fetches) != 2 || base.fetches[1] != "2024-01-02..2024-01-31" {
+		t.Errorf("Fetches = %v, want the whole range again", base.fetches)
+	}
+	for i := 1; i < len(data); i++ {
+		if ratio := data[i].Close / data[i-1].Close; ratio < 0.9 || ratio > 1.1 {
+			t.Fatalf("Close jumps from %g to %g on %s", data[i-1].Close, data[i].Close, data[i].Timestamp.Format(dateLayout))
+		}
+	}
+	if report := CheckDataQuality("NVDA", data, DefaultBarSpec(), calendar.DefaultMarketCalendar(), cfg.qualityTolerances(), now); !report.Passed {
+		t.Errorf("Merged series failed its quality check: %s", report.Reason)
+	}
+
+	// The disk cache holds only the refetched bars, along with the split
+	key := "NVDA:" + DefaultBarSpec().String()
+	segments, err := provider.disk.read(provider.disk.path(key), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 1 || len(segments[0].splits) != 1 || !segments[0].bars[0].Adjusted {
+		t.Fatalf("Segments on disk = %d, want the refetched one with its split", len(segments))
+	}
+
+	// After a restart the split is known, and only the new tail is fetched
+	restarted := NewCachedDataProvider(cfg, base, nil)
+	restarted.now = func() time.Time { return now }
+	if _, err := restarted.GetHistoricalData(ctx, "NVDA", "2024-01-02", "2024-02-09", DefaultBarSpec()); err != nil {
+		t.Fatal(err)
+	}
+	if last := base.fetches[len(base.fetches)-1]; len(base.fetches) != 3 || last != "2024-02-01..2024-02-09" {
+		t.Errorf("Fetches after the restart = %v, want only February's", base.fetches)
+	}
+}
+
+// slowActionsProvider is a splitProvider whose corporate actions wait for
+// release once it is set, telling asked when they are requested
+type slowActionsProvider struct {
+	splitProvider
+	asked   chan struct{}
+	release chan struct{}
+}
+
+func (p *slowActionsProvider) GetCorporateActions(ctx context.Context, symbol, startDate, endDate string) ([]CorporateAction, error) {
+	if p.release != nil {
+		p.asked <- struct{}{}
+		<-p.release
+	}
+	return p.splitProvider.GetCorporateActions(ctx, symbol, startDate, endDate)
+}
+
+func TestCachedDataProviderChecksSplitsUnlocked(t *testing.T) {
+	ctx := context.Background()
+	base := &slowActionsProvider{splitProvider: splitProvider{split: time.Date(2024, 1, 16, 0, 0, 0, 0, time.UTC)}}
+	provider := NewCachedDataProvider(diskCacheConfig(t), base, nil)
+	provider.now = func() time.Time { return time.Date(2024, 2, 15, 15, 0, 0, 0, time.UTC) }
+	if _, err := provider.GetHistoricalData(ctx, "NVDA", "2024-01-02", "2024-01-12", DefaultBarSpec()); err != nil {
+		t.Fatal(err)
+	}
+
+	base.asked, base.release = make(chan struct{}), make(chan struct{})
+	partial := make(chan error, 1)
+	go func() {
+		_, err := provider.GetHistoricalData(ctx, "NVDA", "2024-01-02", "2024-01-31", DefaultBarSpec())
+		partial <- err
+	}()
+	<-base.asked
+
+	// While the partial hit waits on the corporate actions, a request the
+	// cache covers is served
+	served := make(chan error, 1)
+	go func() {
+		_, err := provider.GetHistoricalData(ctx, "NVDA", "2024-01-03", "2024-01-10", DefaultBarSpec())
+		served <- err
+	}()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("Covered request error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Covered request waited on the corporate actions")
+	}
+
+	close(base.release)
+	if err := <-partial; err != nil {
+		t.Fatal(err)
+	}
+	if len(base.fetches) != 2 || base.fetches[1] != "2024-01-13..2024-01-31" {
+		t.Errorf("Fetches = %v, want only the missing tail", base.fetches)
+	}
+}
@@ -0,0 +1,89 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+	"github.com/trustdan/ibkr-trader/go/pkg/strategy"
+)
+
+// CustomStrategy is a strategy defined in the config by a rule over bar values
+// and indicators, e.g. "close / atr(14) > 2 and volume > 2 * avg_volume(20)".
+// It raises Signal, LONG or SHORT, when the rule holds at the latest bar.
+type CustomStrategy struct {
+	Signal      string `yaml:"signal" json:"signal"`
+	Rule        string `yaml:"rule" json:"rule"`
+	Description string `yaml:"description" json:"description"`
+}
+
+// compileCustomStrategies compiles the rules of the custom strategies. A
+// syntax error, an unknown variable or indicator, or a name taken by a
+// built-in strategy is an error.
+func compileCustomStrategies(custom map[string]CustomStrategy) (map[string]strategy.Strategy, error) {
+	compiled := make(map[string]strategy.Strategy, len(custom))
+	for _, name := range sortedKeys(custom) {
+		if _, ok := strategy.Lookup(name); ok {
+			return nil, fmt.Errorf("custom strategy %q has the name of a built-in strategy", name)
+		}
+		def := custom[name]
+		rule, err := strategy.CompileRule(name, strings.ToUpper(def.Signal), def.Description, def.Rule)
+		if err != nil {
+			return nil, fmt.Errorf("custom strategy %q: %w", name, err)
+		}
+		compiled[name] = rule
+	}
+	return compiled, nil
+}
+
+// lookupStrategy returns the built-in or custom strategy named name
+func lookupStrategy(name string, custom map[string]strategy.Strategy) (strategy.Strategy, bool) {
+	if strat, ok := strategy.Lookup(name); ok {
+		return strat, true
+	}
+	strat, ok := custom[name]
+	return strat, ok
+}
+
+// strategyNames returns the names of the built-in and custom strategies in
+// sorted order
+func strategyNames(custom map[string]strategy.Strategy) []string {
+	names := append(strategy.Names(), sortedKeys(custom)...)
+	sort.Strings(names)
+	return names
+}
+
+// ListStrategies implements the ListStrategies RPC method
+func (s *Engine) ListStrategies(ctx context.Context, req *pb.ListStrategiesRequest) (*pb.ListStrategiesResponse, error) {
+	custom := s.current().strategies
+
+	names := strategyNames(custom)
+	resp := &pb.ListStrategiesResponse{Strategies: make([]*pb.StrategyInfo, 0, len(names))}
+	for _, name := range names {
+		strat, _ := lookupStrategy(name, custom)
+		info := &pb.StrategyInfo{Name: name}
+		for _, spec := range strat.Params() {
+			info.Params = append(info.Params, &pb.StrategyParam{
+				Name:         spec.Name,
+				DefaultValue: spec.Default,
+				Min:          spec.Min,
+				Max:          spec.Max,
+				Description:  spec.Description,
+			})
+		}
+		if lookback, ok := strategy.RequiredLookback(strat); ok {
+			info.LookbackBars = int32(lookback.Bars)
+			info.LookbackBarSize = lookback.BarSize
+		}
+		if rule, ok := strat.(*strategy.Rule); ok {
+			info.Custom = true
+			info.Rule = rule.Expr()
+			info.Signal = rule.Signal()
+			info.Description = rule.Description()
+		}
+		resp.Strategies = append(resp.Strategies, info)
+	}
+	return resp, nil
+}
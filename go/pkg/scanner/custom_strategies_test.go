@@ -0,0 +1,118 @@
+package scanner
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+func TestLoadConfigCompilesCustomStrategies(t *testing.T) {
+	config, _, err := LoadConfig(writeConfig(t, "config.yaml", `
+custom_strategies:
+  HIGH_BASE_VOLUME:
+    signal: long
+    rule: "close / atr(14) > 2 and rsi(14) > 60 and volume > 2 * avg_volume(20)"
+    description: HIGH_BASE on twice the average volume
+`))
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if custom := config.CustomStrategies["HIGH_BASE_VOLUME"]; custom.Signal != "long" || !strings.Contains(custom.Rule, "avg_volume(20)") {
+		t.Errorf("CustomStrategies = %+v", config.CustomStrategies)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "unknown indicator",
+			content: "custom_strategies:\n  BREAKOUT:\n    signal: LONG\n    rule: \"close > ema(20)\"\n",
+			want:    `custom strategy "BREAKOUT": column 9: unknown variable or indicator "ema"`,
+		},
+		{
+			name:    "syntax error",
+			content: "custom_strategies:\n  BREAKOUT:\n    signal: LONG\n    rule: \"close > sma(20) and\"\n",
+			want:    `custom strategy "BREAKOUT": column 20: expected a number, variable or indicator`,
+		},
+		{
+			name:    "missing signal",
+			content: "custom_strategies:\n  BREAKOUT:\n    rule: \"close > sma(20)\"\n",
+			want:    "signal must be LONG or SHORT",
+		},
+		{
+			name:    "built-in name",
+			content: "custom_strategies:\n  HIGH_BASE:\n    signal: LONG\n    rule: \"close > sma(20)\"\n",
+			want:    `custom strategy "HIGH_BASE" has the name of a built-in strategy`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := LoadConfig(writeConfig(t, "config.yaml", tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadConfig() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanEvaluatesCustomStrategies(t *testing.T) {
+	cfg := newTestService(t).Config()
+	cfg.CustomStrategies = map[string]CustomStrategy{
+		// risingProvider's closes rise by one a day on a steady volume
+		"ABOVE_SMA":    {Signal: "LONG", Rule: "close > sma(10) and volume >= avg_volume(10)"},
+		"VOLUME_SPIKE": {Signal: "SHORT", Rule: "volume > 2 * avg_volume(20)", Description: "volume twice its average"},
+	}
+	service := NewScannerServiceWithRegistry(cfg, prometheus.NewRegistry())
+	useProvider(service, risingProvider{})
+
+	resp, err := service.Scan(context.Background(), &pb.ScanRequest{Symbols: []string{"AAPL"}, DateRange: testDateRange()})
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	producers := append([]string(nil), resp.Signals["AAPL"].Strategies...)
+	sort.Strings(producers)
+	if got := strings.Join(producers, ","); got != "ABOVE_SMA,HIGH_BASE" {
+		t.Errorf("Signalling strategies = %s, want ABOVE_SMA and HIGH_BASE", got)
+	}
+	if len(resp.Parameters) != 4 {
+		t.Errorf("Scan evaluated %v, want the built-in and custom strategies", resp.Parameters)
+	}
+
+	_, err = service.Scan(context.Background(), &pb.ScanRequest{
+		Symbols:    []string{"AAPL"},
+		DateRange:  testDateRange(),
+		Strategies: []string{"ABOVE_SMA"},
+		Parameters: map[string]*pb.StrategyParams{"ABOVE_SMA": {Values: map[string]float64{"period": 5}}},
+	})
+	if err == nil || !strings.Contains(err.Error(), `unknown parameter "period"`) {
+		t.Errorf("Scan with parameters for a rule error = %v", err)
+	}
+
+	listed, err := service.ListStrategies(context.Background(), &pb.ListStrategiesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, info := range listed.Strategies {
+		names = append(names, info.Name)
+	}
+	if strings.Join(names, ",") != "ABOVE_SMA,HIGH_BASE,LOW_BASE,VOLUME_SPIKE" {
+		t.Errorf("ListStrategies() names = %v", names)
+	}
+	if spike := listed.Strategies[3]; !spike.Custom || spike.Signal != "SHORT" || spike.Rule != "volume > 2 * avg_volume(20)" || spike.Description != "volume twice its average" {
+		t.Errorf("VOLUME_SPIKE = %v", spike)
+	}
+	if highBase := listed.Strategies[1]; highBase.Custom || len(highBase.Params) != 2 || highBase.LookbackBars != 200 {
+		t.Errorf("HIGH_BASE = %v, want a built-in strategy with its parameters and lookback", highBase)
+	}
+	if spike := listed.Strategies[3]; spike.LookbackBars != 21 || spike.LookbackBarSize != "" {
+		t.Errorf("VOLUME_SPIKE lookback = %d %q, want 21 of the bars scanned", spike.LookbackBars, spike.LookbackBarSize)
+	}
+}
@@ -1,75 +1,822 @@
 package scanner
 
 import (
-	"math/rand"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/trustdan/ibkr-trader/go/pkg/calendar"
 )
 
-// DataProvider is an interface for retrieving market data
+// MarketData represents stock market data
+type MarketData struct {
+	Symbol     string      `json:"symbol"`
+	Timestamp  time.Time   `json:"timestamp"`
+	Open       float64     `json:"open"`
+	High       float64     `json:"high"`
+	Low        float64     `json:"low"`
+	Close      float64     `json:"close"`
+	Volume     int64       `json:"volume"`
+	Indicators interface{} `json:"indicators,omitempty"`
+	// Adjusted is set on bars whose prices and volume the provider adjusted
+	// for the splits it knew of when they were fetched
+	Adjusted bool `json:"adjusted,omitempty"`
+	// Session is the trading session of the bar: SessionPreMarket,
+	// SessionRegular or SessionPostMarket. Daily bars are of the regular
+	// session.
+	Session string `json:"session,omitempty"`
+}
+
+// DataProvider defines the interface for getting historical market data
 type DataProvider interface {
-	// GetHistoricalData retrieves historical market data for a symbol
-	GetHistoricalData(symbol, startDate, endDate string) (interface{}, error)
+	// GetHistoricalData retrieves historical market data for a symbol in the bar
+	// size and data type given by spec
+	GetHistoricalData(ctx context.Context, symbol, startDate, endDate string, spec BarSpec) ([]MarketData, error)
+}
+
+// CachedDataProvider implements the DataProvider interface with caching support.
+// Bars are cached as one series per symbol and bar spec, so a request whose
+// window has moved only fetches the dates it does not already hold.
+type CachedDataProvider struct {
+	config        *Config
+	dataProvider  DataProvider
+	cache         *cache.Cache
+	mu            sync.Mutex
+	metricTracker MetricRecorder
+	// providerName is the provider lookups are attributed to, "" when the
+	// provider is not instrumented
+	providerName string
+
+	// disk is the tier consulted on a memory miss, nil without CacheDiskDir
+	disk *diskCache
+	// flights shares concurrent fetches of the same dates of a series
+	flights singleflight.Group
+	// market sets the sessions intraday bars are aggregated by
+	market *calendar.MarketCalendar
+
+	// now returns the current time; replaced in tests
+	now func() time.Time
+}
+
+// MetricRecorder defines the interface for recording metrics. provider names
+// the data provider behind the cache, or is "" when it is not known.
+type MetricRecorder interface {
+	RecordCacheHit(provider string)
+	RecordCacheDiskHit(provider string)
+	RecordCachePartialHit(provider string)
+	RecordCacheMiss(provider string)
+	RecordProviderFetch(provider string, seconds float64, err error)
+	RecordDeduplicatedFetch(provider string)
+	RecordAggregatedFetch(provider string)
+}
+
+// instrumentedProvider records the duration and outcome of each fetch from
+// the provider named name
+type instrumentedProvider struct {
+	name     string
+	provider DataProvider
+	recorder MetricRecorder
+}
+
+// GetHistoricalData fetches from the provider and records the fetch
+func (p *instrumentedProvider) GetHistoricalData(ctx context.Context, symbol, startDate, endDate string, spec BarSpec) ([]MarketData, error) {
+	start := time.Now()
+	data, err := p.provider.GetHistoricalData(ctx, symbol, startDate, endDate, spec)
+	p.recorder.RecordProviderFetch(p.name, time.Since(start).Seconds(), err)
+	return data, err
+}
+
+// NormalizeSymbol names symbol as the instrumented provider does
+func (p *instrumentedProvider) NormalizeSymbol(symbol string) (string, error) {
+	return NormalizeSymbol(p.provider, symbol)
+}
+
+// GetCorporateActions returns the instrumented provider's corporate actions
+func (p *instrumentedProvider) GetCorporateActions(ctx context.Context, symbol, startDate, endDate string) ([]CorporateAction, error) {
+	return GetCorporateActions(ctx, p.provider, symbol, startDate, endDate)
+}
+
+// ProbeHealth probes the instrumented provider
+func (p *instrumentedProvider) ProbeHealth(ctx context.Context) error {
+	return ProbeHealth(ctx, p.provider)
+}
+
+// NewDataProvider creates a new data provider with the specified configuration,
+// reporting its fetches to metricTracker, along with cache hits and misses when
+// caching is enabled. A DataProviderType of "chaos:<type>", or ChaosEnabled,
+// injects faults in front of the provider, which metricTracker counts apart
+// from the provider's own errors when it is a FaultRecorder.
+func NewDataProvider(cfg *Config, metricTracker MetricRecorder) DataProvider {
+	// Create the base data provider
+	var provider DataProvider
+	name, chaos := strings.CutPrefix(cfg.DataProviderType, chaosPrefix)
+	chaos = chaos || cfg.ChaosEnabled
+	switch name {
+	case "mock":
+		provider = NewMockDataProvider(cfg)
+	case "yahoo":
+		provider = NewYahooDataProvider(cfg)
+	case "ibkr":
+		provider = NewIBKRDataProvider(cfg)
+	default:
+		logrus.Warnf("Unknown data provider type: %s, using mock", cfg.DataProviderType)
+		provider = NewMockDataProvider(cfg)
+		name = "mock"
+	}
+
+	if metricTracker != nil {
+		provider = &instrumentedProvider{name: name, provider: provider, recorder: metricTracker}
+	}
+	if chaos {
+		recorder, _ := metricTracker.(FaultRecorder)
+		provider = NewFaultInjectingDataProvider(cfg, provider, name, recorder)
+		logrus.Warnf("Injecting faults into the %s data provider", name)
+	}
+
+	// If caching is enabled, wrap the provider with a cache
+	if cfg.CacheEnabled {
+		return NewCachedDataProvider(cfg, provider, metricTracker)
+	}
+
+	return provider
+}
+
+// NewCachedDataProvider creates a new cached data provider. A series is dropped
+// from memory once it has not been used for CacheSeriesTTL. With CacheDiskDir
+// set, series are also kept on disk there.
+func NewCachedDataProvider(cfg *Config, provider DataProvider, metricTracker MetricRecorder) *CachedDataProvider {
+	// The engine logs a calendar that does not load
+	market, _ := marketCalendar(cfg)
+	c := &CachedDataProvider{
+		config:        cfg,
+		dataProvider:  provider,
+		cache:         cache.New(cfg.CacheSeriesTTL, cfg.CacheCleanupInterval),
+		market:        market,
+		metricTracker: metricTracker,
+		now:           time.Now,
+	}
+	if cfg.CacheDiskDir != "" {
+		disk, err := newDiskCache(cfg.CacheDiskDir, cfg.CacheDiskTTL, cfg.CacheDiskMaxSegments)
+		if err != nil {
+			logrus.Errorf("Caching bars in memory only: %v", err)
+		} else {
+			c.disk = disk
+		}
+	}
+	if faults, ok := provider.(*FaultInjectingDataProvider); ok {
+		provider = faults.provider
+	}
+	if instrumented, ok := provider.(*instrumentedProvider); ok {
+		c.providerName = instrumented.name
+	}
+	return c
+}
+
+// GetHistoricalData retrieves historical market data with caching. Dates already
+// covered by the cached series are served from it and only the missing head or
+// tail of the range is fetched. Bars of the current session are refetched once
+// they are older than CacheTTL. A series missing from memory is read from the
+// disk cache when there is one, and fetched bars are written through to it.
+// Before fetching, a split the cached bars were not adjusted for drops them
+// and the whole range is fetched again. Concurrent requests missing the same
+// dates share one fetch. With CacheAggregateBars, daily bars the cache does
+// not hold are built from cached intraday bars covering the whole range.
+func (c *CachedDataProvider) GetHistoricalData(ctx context.Context, symbol, startDate, endDate string, spec BarSpec) ([]MarketData, error) {
+	// Record the outcome on the caller's fetch span, a no-op when not tracing
+	span := trace.SpanFromContext(ctx)
+
+	start, startErr := time.Parse(dateLayout, startDate)
+	end, endErr := time.Parse(dateLayout, endDate)
+	if startErr != nil || endErr != nil || end.Before(start) {
+		// Ranges the cache cannot reason about go straight to the provider
+		c.recordResult(span, cacheResultMiss)
+		return c.dataProvider.GetHistoricalData(ctx, symbol, startDate, endDate, spec)
+	}
+	requested := dateRange{start: start, end: end}
+
+	key := symbol + ":" + spec.String()
+	series := c.series(key)
+	if spec.BarSize == BarSize1Day && c.config.CacheAggregateBars && !series.covers(requested) {
+		if bars, ok := c.aggregate(symbol, spec, requested); ok {
+			c.recordResult(span, cacheResultAggregated)
+			return bars, nil
+		}
+	}
+	missing := c.lookup(ctx, span, key, symbol, series, requested)
+
+	// The series is unlocked while fetching, so a caller giving up does not
+	// hold up the others
+	var fetched []MarketData
+	for _, r := range missing {
+		data, err := c.fetch(ctx, key, symbol, series, r, spec)
+		if err != nil {
+			return nil, err
+		}
+		fetched = data
+	}
+
+	series.mu.Lock()
+	uncovered, _ := series.missing(requested)
+	series.prune(c.config.CacheMaxLookback)
+	if len(uncovered) == 0 {
+		defer series.mu.Unlock()
+		return series.slice(requested), nil
+	}
+	series.mu.Unlock()
+
+	// A fetch of dates apart from these, or of a series evicted meanwhile,
+	// replaced the bars merged for them, so they are served from the fetch
+	if len(missing) == 1 && missing[0] == requested {
+		return append([]MarketData(nil), fetched...), nil
+	}
+	return c.fetch(ctx, key, symbol, series, requested, spec)
+}
+
+// aggregate returns the daily bars of requested built from the cached
+// intraday bars of symbol and spec's data type, with or without extended
+// hours, and false unless a cached series covers every date of requested,
+// has a bar in each of its sessions and no session of it is still open
+func (c *CachedDataProvider) aggregate(symbol string, spec BarSpec, requested dateRange) ([]MarketData, bool) {
+	// Sessions after today have no bars yet
+	now := c.now()
+	today := c.market.Day(now)
+	date, last := barDate(today.Open), requested.end
+	if !last.Before(date) {
+		if !today.Closed() && now.Before(today.Close) {
+			return nil, false
+		}
+		last = date
+	}
+
+	for _, intraday := range intradaySpecs(spec.WhatToShow) {
+		c.mu.Lock()
+		cached, found := c.cache.Get(symbol + ":" + intraday.String())
+		c.mu.Unlock()
+		if !found {
+			continue
+		}
+		series := cached.(*barSeries)
+		series.mu.Lock()
+		series.expireOpenSession(date, now, c.config.CacheTTL)
+		missing, _ := series.missing(requested)
+		var bars []MarketData
+		if len(missing) == 0 {
+			bars = series.slice(requested)
+		}
+		series.mu.Unlock()
+		if len(missing) > 0 {
+			continue
+		}
+
+		aggregated, err := Aggregate(bars, intraday.BarSize, BarSize1Day, c.market)
+		if err == nil && c.sessionsCovered(aggregated, requested.start, last) {
+			return aggregated, true
+		}
+	}
+	return nil, false
+}
+
+// sessionsCovered reports whether daily bars has a bar for every session from
+// first to last, dates as in requests
+func (c *CachedDataProvider) sessionsCovered(bars []MarketData, first, last time.Time) bool {
+	dated := make(map[time.Time]bool, len(bars))
+	for _, bar := range bars {
+		dated[barDate(bar.Timestamp)] = true
+	}
+	loc := c.market.Location()
+	for date := first; !date.After(last); date = date.AddDate(0, 0, 1) {
+		noon := time.Date(date.Year(), date.Month(), date.Day(), 12, 0, 0, 0, loc)
+		if !c.market.Day(noon).Closed() && !dated[date] {
+			return false
+		}
+	}
+	return true
+}
+
+// lookup locks series, restoring it from disk when it is empty and dropping
+// bars a split was announced for, and returns the dates of requested it does
+// not hold, recording whether it was a hit
+func (c *CachedDataProvider) lookup(ctx context.Context, span trace.Span, key, symbol string, series *barSeries, requested dateRange) []dateRange {
+	series.mu.Lock()
+	defer series.mu.Unlock()
+
+	now := c.now()
+	fromDisk := false
+	if series.empty() && c.disk != nil {
+		if segments := c.disk.load(key, now); len(segments) > 0 {
+			series.restore(segments)
+			fromDisk = true
+		}
+	}
+	series.expireOpenSession(barDate(now.In(newYorkLocation())), now, c.config.CacheTTL)
+
+	// The series is unlocked while the splits are checked, so what it is
+	// missing is found again after
+	missing, overlap := series.missing(requested)
+	if len(missing) > 0 {
+		c.checkSplits(ctx, key, symbol, series, requested)
+		missing, overlap = series.missing(requested)
+	}
+	switch {
+	case len(missing) == 0 && fromDisk:
+		c.recordResult(span, cacheResultDiskHit)
+	case len(missing) == 0:
+		c.recordResult(span, cacheResultHit)
+	case overlap:
+		c.recordResult(span, cacheResultPartial)
+	default:
+		c.recordResult(span, cacheResultMiss)
+	}
+	return missing
+}
+
+// fetch returns the bars of r from the provider and merges them into series.
+// Concurrent fetches of the same series and dates share one provider call,
+// which is keyed like the series and outlives a caller giving up; its
+// deadline is the first caller's. A failed call is shared but not cached,
+// so the next fetch calls the provider again.
+func (c *CachedDataProvider) fetch(ctx context.Context, key, symbol string, series *barSeries, r dateRange, spec BarSpec) ([]MarketData, error) {
+	startDate, endDate := r.start.Format(dateLayout), r.end.Format(dateLayout)
+	led := false
+	flight := c.flights.DoChan(key+":"+startDate+":"+endDate, func() (interface{}, error) {
+		led = true
+
+		// A call that finished just before this one began may have merged
+		// the dates already
+		series.mu.Lock()
+		if missing, _ := series.missing(r); len(missing) == 0 {
+			defer series.mu.Unlock()
+			return series.slice(r), nil
+		}
+		series.mu.Unlock()
+
+		fetchCtx := context.WithoutCancel(ctx)
+		if deadline, ok := ctx.Deadline(); ok {
+			var cancel context.CancelFunc
+			fetchCtx, cancel = context.WithDeadline(fetchCtx, deadline)
+			defer cancel()
+		}
+		data, err := c.dataProvider.GetHistoricalData(fetchCtx, symbol, startDate, endDate, spec)
+		if err != nil {
+			return nil, err
+		}
+
+		now := c.now()
+		series.mu.Lock()
+		defer series.mu.Unlock()
+		series.merge(r, data, now)
+		if c.disk != nil {
+			if err := c.disk.append(key, diskSegment{written: now, r: r, bars: data, splits: series.splits}); err != nil {
+				logrus.Warnf("Bars of %s not cached on disk: %v", key, err)
+			}
+		}
+		return data, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-flight:
+		if !led && c.metricTracker != nil {
+			c.metricTracker.RecordDeduplicatedFetch(c.providerName)
+		}
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		return result.Val.([]MarketData), nil
+	}
+}
+
+// checkSplits fetches the corporate actions of symbol over the cached and
+// requested dates and adds the new ones to those the series was fetched
+// with. A new one drops the cached bars, from memory and disk. When the
+// actions cannot be fetched the cache is kept. series is locked when it is
+// called and when it returns, but not while the actions are fetched, so
+// requests the series already covers are not held up.
+func (c *CachedDataProvider) checkSplits(ctx context.Context, key, symbol string, series *barSeries, requested dateRange) {
+	r := requested
+	if !series.empty() {
+		if series.from.Before(r.start) {
+			r.start = series.from
+		}
+		if series.to.After(r.end) {
+			r.end = series.to
+		}
+	}
+	series.mu.Unlock()
+	actions, err := GetCorporateActions(ctx, c.dataProvider, symbol, r.start.Format(dateLayout), r.end.Format(dateLayout))
+	series.mu.Lock()
+	if err != nil {
+		logrus.Warnf("Corporate actions of %s unavailable, keeping its cached bars: %v", symbol, err)
+		return
+	}
+	added := newActions(series.splits, actions)
+	series.splits = append(series.splits, added...)
+	if len(added) == 0 || series.empty() {
+		return
+	}
+
+	logrus.Infof("New %s of %s on %s at %g, dropping its cached bars", added[0].Type, symbol, added[0].Date.Format(dateLayout), added[0].Ratio)
+	series.reset()
+	if c.disk != nil {
+		c.disk.drop(key)
+	}
+}
+
+// NormalizeSymbol names symbol as the cached provider does
+func (c *CachedDataProvider) NormalizeSymbol(symbol string) (string, error) {
+	return NormalizeSymbol(c.dataProvider, symbol)
+}
+
+// GetCorporateActions returns the corporate actions of the provider behind
+// the cache, which are not cached
+func (c *CachedDataProvider) GetCorporateActions(ctx context.Context, symbol, startDate, endDate string) ([]CorporateAction, error) {
+	return GetCorporateActions(ctx, c.dataProvider, symbol, startDate, endDate)
+}
+
+// ProbeHealth probes the provider behind the cache
+func (c *CachedDataProvider) ProbeHealth(ctx context.Context) error {
+	return ProbeHealth(ctx, c.dataProvider)
+}
+
+// EvictOldest drops the least recently used fraction of the series cached in
+// memory, leaving the disk cache alone, and returns how many it dropped
+func (c *CachedDataProvider) EvictOldest(fraction float64) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// A series expires CacheSeriesTTL after its last use
+	items := c.cache.Items()
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return items[keys[i]].Expiration < items[keys[j]].Expiration })
+
+	evict := int(math.Ceil(float64(len(keys)) * fraction))
+	for _, key := range keys[:evict] {
+		c.cache.Delete(key)
+	}
+	return evict
+}
+
+// series returns the cached series for key, creating it when absent, and
+// extends its lifetime
+func (c *CachedDataProvider) series(key string) *barSeries {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	series := &barSeries{}
+	if cached, found := c.cache.Get(key); found {
+		series = cached.(*barSeries)
+	}
+	c.cache.SetDefault(key, series)
+	return series
 }
 
-// MockDataProvider is a mock implementation of DataProvider for testing
+// recordResult reports a cache lookup outcome to the span and metrics
+func (c *CachedDataProvider) recordResult(span trace.Span, result string) {
+	span.SetAttributes(attrCacheHit.Bool(result != cacheResultPartial && result != cacheResultMiss), attrCacheResult.String(result))
+
+	if c.metricTracker == nil {
+		return
+	}
+	switch result {
+	case cacheResultHit:
+		c.metricTracker.RecordCacheHit(c.providerName)
+	case cacheResultDiskHit:
+		c.metricTracker.RecordCacheDiskHit(c.providerName)
+	case cacheResultAggregated:
+		c.metricTracker.RecordAggregatedFetch(c.providerName)
+	case cacheResultPartial:
+		c.metricTracker.RecordCachePartialHit(c.providerName)
+	default:
+		c.metricTracker.RecordCacheMiss(c.providerName)
+	}
+}
+
+// MockDataProvider implements the DataProvider interface for testing
 type MockDataProvider struct {
 	config *Config
 }
 
-// NewDataProvider creates a data provider based on configuration
-func NewDataProvider(config *Config) DataProvider {
-	// Based on configuration, return the appropriate data provider
-	switch config.DataProviderType {
-	case "mock":
-		return &MockDataProvider{config: config}
+// NewMockDataProvider creates a new mock data provider
+func NewMockDataProvider(cfg *Config) *MockDataProvider {
+	return &MockDataProvider{
+		config: cfg,
+	}
+}
+
+// GetHistoricalData generates mock historical data. Intraday bars cover regular
+// trading hours, and the pre-market from 4:00 and after-hours until 20:00 on
+// thinner volume when spec includes extended hours; implied volatility bars
+// hold annualized volatility in place of prices.
+func (m *MockDataProvider) GetHistoricalData(ctx context.Context, symbol, startDate, endDate string, spec BarSpec) ([]MarketData, error) {
+	// Parse start and end dates
+	start, err := time.Parse("2006-01-02", startDate)
+	if err != nil {
+		start = time.Now().AddDate(0, -1, 0) // Default to 1 month ago
+	}
+
+	end, err := time.Parse("2006-01-02", endDate)
+	if err != nil {
+		end = time.Now() // Default to today
+	}
+
+	// Generate mock data
+	data := make([]MarketData, 0)
+	for d := start; d.Before(end) || d.Equal(end); d = d.AddDate(0, 0, 1) {
+		// Skip weekends
+		if d.Weekday() == time.Saturday || d.Weekday() == time.Sunday {
+			continue
+		}
+
+		for _, ts := range barTimestamps(d, spec) {
+			session := mockSession(ts, spec)
+			price := mockPrice(m.config.MockSeed, symbol, ts)
+			if spec.WhatToShow == WhatToShowOptionImpliedVolatility {
+				price /= 400 // annualized volatility around 0.25
+			}
+			noise := mockNoise(m.config.MockSeed, symbol+":range", ts)
+
+			// Create a data point; only trade bars carry volume
+			marketData := MarketData{
+				Symbol:    symbol,
+				Timestamp: ts,
+				Open:      price * (1 - 0.01*noise),
+				High:      price * (1 + 0.01 + 0.01*math.Abs(noise)),
+				Low:       price * (1 - 0.01 - 0.01*math.Abs(noise)),
+				Close:     price,
+				Session:   session,
+			}
+			if spec.WhatToShow == WhatToShowTrades {
+				marketData.Volume = int64(1500000 + 500000*mockNoise(m.config.MockSeed, symbol+":volume", ts))
+				if session != SessionRegular {
+					marketData.Volume /= 20
+				}
+			}
+
+			data = append(data, marketData)
+		}
+	}
+
+	return data, nil
+}
+
+// GetCorporateActions reports no corporate actions, as the mock bars have none
+func (m *MockDataProvider) GetCorporateActions(ctx context.Context, symbol, startDate, endDate string) ([]CorporateAction, error) {
+	return nil, nil
+}
+
+// ProbeHealth always succeeds, as the mock provider has nothing to reach
+func (m *MockDataProvider) ProbeHealth(ctx context.Context) error {
+	return nil
+}
+
+// mockPrice returns the mock close of symbol at ts. Each symbol oscillates
+// around its own base price with its own period and amplitude, plus noise, and
+// the price depends only on the seed, symbol and time, so overlapping requests
+// agree on every bar.
+func mockPrice(seed int64, symbol string, ts time.Time) float64 {
+	h := mockHash(seed, symbol, 0)
+	base := 50 + float64(h%200)
+	period := 20 + float64(h>>8%60)           // days
+	amplitude := 0.05 + float64(h>>16%20)/100 // 5% to 25%
+
+	days := float64(ts.Unix()) / (24 * 60 * 60)
+	cycle := math.Sin(2 * math.Pi * days / period)
+	return base * (1 + amplitude*cycle + 0.02*mockNoise(seed, symbol, ts))
+}
+
+// mockNoise returns a value in [-1, 1) derived from the seed, key and time
+func mockNoise(seed int64, key string, ts time.Time) float64 {
+	return float64(mockHash(seed, key, ts.Unix())%2000)/1000 - 1
+}
+
+// mockHash hashes the seed, key and unix time
+func mockHash(seed int64, key string, unix int64) uint64 {
+	h := fnv.New64a()
+	var buf [16]byte
+	binary.LittleEndian.PutUint64(buf[:8], uint64(seed))
+	binary.LittleEndian.PutUint64(buf[8:], uint64(unix))
+	h.Write(buf[:])
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+// Regular trading hours of US equity markets, and the extended hours around
+// them, in New York time
+const (
+	preMarketOpenMinutes   = 4 * 60
+	marketOpenMinutes      = 9*60 + 30
+	marketCloseMinutes     = 16 * 60
+	postMarketCloseMinutes = 20 * 60
+)
+
+// barTimestamps returns the start time of each bar on day. Daily bars use the
+// date itself; intraday bars run from the open until the close, or from the
+// pre-market open until the after-hours close with extended hours.
+func barTimestamps(day time.Time, spec BarSpec) []time.Time {
+	if !spec.Intraday() {
+		return []time.Time{day}
+	}
+
+	first, last := marketOpenMinutes, marketCloseMinutes
+	if spec.IncludeExtendedHours {
+		first, last = preMarketOpenMinutes, postMarketCloseMinutes
+	}
+	loc := newYorkLocation()
+	open := time.Date(day.Year(), day.Month(), day.Day(), 0, first, 0, 0, loc)
+	closing := time.Date(day.Year(), day.Month(), day.Day(), 0, last, 0, 0, loc)
+
+	timestamps := make([]time.Time, 0, int(closing.Sub(open)/spec.Interval()))
+	for ts := open; ts.Before(closing); ts = ts.Add(spec.Interval()) {
+		timestamps = append(timestamps, ts)
+	}
+	return timestamps
+}
+
+// mockSession returns the session of a mock bar starting at ts
+func mockSession(ts time.Time, spec BarSpec) string {
+	if !spec.Intraday() {
+		return SessionRegular
+	}
+	local := ts.In(newYorkLocation())
+	switch minutes := local.Hour()*60 + local.Minute(); {
+	case minutes < marketOpenMinutes:
+		return SessionPreMarket
+	case minutes < marketCloseMinutes:
+		return SessionRegular
 	default:
-		// Default to mock provider for now
-		return &MockDataProvider{config: config}
+		return SessionPostMarket
+	}
+}
+
+// newYorkLocation returns the exchange time zone, falling back to a fixed
+// Eastern Standard Time offset when no time zone database is installed
+func newYorkLocation() *time.Location {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		return time.FixedZone("EST", -5*60*60)
 	}
+	return loc
 }
 
-// GetHistoricalData returns mock historical data for testing
-func (m *MockDataProvider) GetHistoricalData(symbol, startDate, endDate string) (interface{}, error) {
-	// Simulate processing time
-	time.Sleep(time.Duration(rand.Intn(100)) * time.Millisecond)
+// YahooDataProvider implements the DataProvider interface using Yahoo Finance
+type YahooDataProvider struct {
+	config *Config
+}
 
-	// For testing, just return a mock data structure
-	// In a real implementation, this would fetch actual market data
-	mockData := struct {
-		Symbol    string
-		StartDate string
-		EndDate   string
-		Data      []float64
-	}{
-		Symbol:    symbol,
-		StartDate: startDate,
-		EndDate:   endDate,
-		Data:      generateMockPriceData(30),
+// NewYahooDataProvider creates a new Yahoo Finance data provider
+func NewYahooDataProvider(cfg *Config) *YahooDataProvider {
+	return &YahooDataProvider{
+		config: cfg,
 	}
+}
 
-	return mockData, nil
+// GetHistoricalData retrieves historical data from Yahoo Finance
+func (y *YahooDataProvider) GetHistoricalData(ctx context.Context, symbol, startDate, endDate string, spec BarSpec) ([]MarketData, error) {
+	// Yahoo Finance only publishes trade bars
+	if spec.WhatToShow != WhatToShowTrades {
+		return nil, fmt.Errorf("yahoo data provider supports only %s data, got %s", WhatToShowTrades, spec.WhatToShow)
+	}
+
+	// In a real implementation, this would use the Yahoo Finance API
+	// For now, return mock data
+	query, err := yahooChartQuery(startDate, endDate, spec)
+	if err != nil {
+		return nil, err
+	}
+	logrus.Infof("Yahoo Finance API not implemented, using mock data for chart/%s?%s", symbol, query.Encode())
+	mockProvider := NewMockDataProvider(y.config)
+	data, err := mockProvider.GetHistoricalData(ctx, symbol, startDate, endDate, spec)
+	// The chart API's bars are adjusted for the splits it reports
+	for i := range data {
+		data[i].Adjusted = true
+	}
+	return data, err
 }
 
-// generateMockPriceData creates random price data for testing
-func generateMockPriceData(days int) []float64 {
-	// Start with a base price between 50 and 200
-	basePrice := 50.0 + rand.Float64()*150.0
+// yahooChartIntervals maps the bar sizes to the chart API's intervals
+var yahooChartIntervals = map[string]string{
+	BarSize1Min:  "1m",
+	BarSize5Min:  "5m",
+	BarSize30Min: "30m",
+	BarSize1Day:  "1d",
+}
 
-	// Generate daily prices with random fluctuations
-	prices := make([]float64, days)
-	currentPrice := basePrice
+// yahooChartQuery returns the query of a chart API request for the bars of
+// spec from startDate through endDate. Extended hours ask for includePrePost,
+// which adds the pre-market and after-hours bars to intraday intervals.
+func yahooChartQuery(startDate, endDate string, spec BarSpec) (url.Values, error) {
+	start, err := time.Parse(dateLayout, startDate)
+	if err != nil {
+		return nil, fmt.Errorf("yahoo data provider: invalid start date %q", startDate)
+	}
+	end, err := time.Parse(dateLayout, endDate)
+	if err != nil {
+		return nil, fmt.Errorf("yahoo data provider: invalid end date %q", endDate)
+	}
+	interval, ok := yahooChartIntervals[spec.BarSize]
+	if !ok {
+		return nil, fmt.Errorf("yahoo data provider: unsupported bar size %s", spec.BarSize)
+	}
+	return url.Values{
+		"period1":        {fmt.Sprint(start.Unix())},
+		"period2":        {fmt.Sprint(end.AddDate(0, 0, 1).Unix())},
+		"interval":       {interval},
+		"includePrePost": {fmt.Sprint(spec.IncludeExtendedHours)},
+		"events":         {"split"},
+	}, nil
+}
 
-	for i := 0; i < days; i++ {
-		// Random daily change between -2% and +2%
-		change := (rand.Float64()*4.0 - 2.0) / 100.0
-		currentPrice = currentPrice * (1.0 + change)
-		prices[i] = currentPrice
+// GetCorporateActions returns the splits Yahoo Finance reports for symbol.
+// They come with the bars, in the events of the chart API's response.
+func (y *YahooDataProvider) GetCorporateActions(ctx context.Context, symbol, startDate, endDate string) ([]CorporateAction, error) {
+	// In a real implementation, this would read the splits of the chart API
+	// response; the mock data has none
+	return NewMockDataProvider(y.config).GetCorporateActions(ctx, symbol, startDate, endDate)
+}
+
+// NormalizeSymbol writes the share class after a dash, as in BRK-B
+func (y *YahooDataProvider) NormalizeSymbol(symbol string) (string, error) {
+	return NormalizeSymbolWith(symbol, ClassSeparatorDash)
+}
+
+// ProbeHealth sends a HEAD request to the API, DataProviderURL or
+// defaultYahooURL. Any answer but a server error means Yahoo Finance can be
+// reached.
+func (y *YahooDataProvider) ProbeHealth(ctx context.Context) error {
+	url := y.config.DataProviderURL
+	if url == "" {
+		url = defaultYahooURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return fmt.Errorf("yahoo data provider: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("yahoo data provider: %w", err)
 	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("yahoo data provider: %s answered %s", url, resp.Status)
+	}
+	return nil
+}
 
-	return prices
+// IBKRDataProvider implements the DataProvider interface using Interactive Brokers
+type IBKRDataProvider struct {
+	config *Config
+}
+
+// NewIBKRDataProvider creates a new IBKR data provider
+func NewIBKRDataProvider(cfg *Config) *IBKRDataProvider {
+	return &IBKRDataProvider{
+		config: cfg,
+	}
+}
+
+// GetHistoricalData retrieves historical data from Interactive Brokers
+func (i *IBKRDataProvider) GetHistoricalData(ctx context.Context, symbol, startDate, endDate string, spec BarSpec) ([]MarketData, error) {
+	// In a real implementation, this would use the IBKR API
+	// For now, return mock data
+	logrus.Info("IBKR API not implemented, using mock data")
+	mockProvider := NewMockDataProvider(i.config)
+	return mockProvider.GetHistoricalData(ctx, symbol, startDate, endDate, spec)
+}
+
+// NormalizeSymbol writes the share class after a dot, as in BRK.B
+func (i *IBKRDataProvider) NormalizeSymbol(symbol string) (string, error) {
+	return NormalizeSymbolWith(symbol, ClassSeparatorDot)
 }
 
-// Initialize random seed
-func init() {
-	rand.Seed(time.Now().UnixNano())
+// ProbeHealth dials TWS or IB Gateway at DataProviderURL, or
+// defaultIBKRAddress, without starting an API session
+func (i *IBKRDataProvider) ProbeHealth(ctx context.Context) error {
+	address := i.config.DataProviderURL
+	if address == "" {
+		address = defaultIBKRAddress
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return fmt.Errorf("ibkr data provider: %w", err)
+	}
+	return conn.Close()
 }
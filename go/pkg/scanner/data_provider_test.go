@@ -0,0 +1,472 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// countingProvider returns one bar per weekday and records every range it is
+// asked for
+type countingProvider struct {
+	calls  int
+	ranges []string
+}
+
+func (c *countingProvider) GetHistoricalData(ctx context.Context, symbol, startDate, endDate string, spec BarSpec) ([]MarketData, error) {
+	c.calls++
+	c.ranges = append(c.ranges, startDate+".."+endDate)
+
+	start, _ := time.Parse(dateLayout, startDate)
+	end, _ := time.Parse(dateLayout, endDate)
+	var data []MarketData
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		if d.Weekday() == time.Saturday || d.Weekday() == time.Sunday {
+			continue
+		}
+		data = append(data, MarketData{Symbol: symbol, Timestamp: d, Close: 100, Volume: 1000})
+	}
+	return data, nil
+}
+
+// sharedProvider counts its calls, which each wait for release and then
+// return err or the bars of countingProvider
+type sharedProvider struct {
+	calls   atomic.Int32
+	release chan struct{}
+	err     error
+}
+
+func (g *sharedProvider) GetHistoricalData(ctx context.Context, symbol, startDate, endDate string, spec BarSpec) ([]MarketData, error) {
+	g.calls.Add(1)
+	select {
+	case <-g.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if g.err != nil {
+		return nil, g.err
+	}
+	return (&countingProvider{}).GetHistoricalData(ctx, symbol, startDate, endDate, spec)
+}
+
+// countingRecorder counts cache hits from memory and disk, partial hits and
+// misses, provider fetches, fetches shared with another and requests served
+// by aggregation
+type countingRecorder struct {
+	hits, diskHits, partials, misses, fetches, shared, aggregated int
+}
+
+func (c *countingRecorder) RecordCacheHit(string)        { c.hits++ }
+func (c *countingRecorder) RecordCacheDiskHit(string)    { c.diskHits++ }
+func (c *countingRecorder) RecordCachePartialHit(string) { c.partials++ }
+func (c *countingRecorder) RecordCacheMiss(string)       { c.misses++ }
+func (c *countingRecorder) RecordProviderFetch(string, float64, error) {
+	c.fetches++
+}
+func (c *countingRecorder) RecordDeduplicatedFetch(string) { c.shared++ }
+func (c *countingRecorder) RecordAggregatedFetch(string)   { c.aggregated++ }
+
+func TestCachedDataProvider(t *testing.T) {
+	base := &countingProvider{}
+	recorder := &countingRecorder{}
+	provider := NewCachedDataProvider(DefaultConfig(), base, recorder)
+
+	for i := 0; i < 3; i++ {
+		data, err := provider.GetHistoricalData(context.Background(), "SPY", "2024-01-02", "2024-01-31", DefaultBarSpec())
+		if err != nil || len(data) != 22 {
+			t.Fatalf("GetHistoricalData failed: %v, %v", data, err)
+		}
+	}
+	if _, err := provider.GetHistoricalData(context.Background(), "SPY", "2024-02-01", "2024-02-29", DefaultBarSpec()); err != nil {
+		t.Fatalf("GetHistoricalData failed: %v", err)
+	}
+
+	if base.calls != 2 {
+		t.Errorf("Underlying calls: got %d, want 2", base.calls)
+	}
+	if recorder.hits != 2 || recorder.misses != 2 {
+		t.Errorf("Hits/misses: got %d/%d, want 2/2", recorder.hits, recorder.misses)
+	}
+}
+
+func TestCachedDataProviderMergesOverlappingRanges(t *testing.T) {
+	base := &countingProvider{}
+	recorder := &countingRecorder{}
+	provider := NewCachedDataProvider(DefaultConfig(), base, recorder)
+	ctx := context.Background()
+
+	// A window shifted by a day only fetches the new day
+	if _, err := provider.GetHistoricalData(ctx, "SPY", "2024-01-02", "2024-03-01", DefaultBarSpec()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := provider.GetHistoricalData(ctx, "SPY", "2024-01-03", "2024-03-04", DefaultBarSpec())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := base.ranges[len(base.ranges)-1]; got != "2024-03-02..2024-03-04" {
+		t.Errorf("Shifted window fetched %s, want only the missing tail", got)
+	}
+	if first, last := data[0].Timestamp.Format(dateLayout), data[len(data)-1].Timestamp.Format(dateLayout); first != "2024-01-03" || last != "2024-03-04" {
+		t.Errorf("Served bars %s..%s, want 2024-01-03..2024-03-04", first, last)
+	}
+
+	// A wider window fetches the head and the tail but not the cached middle
+	base.ranges = nil
+	if _, err := provider.GetHistoricalData(ctx, "SPY", "2023-12-27", "2024-03-08", DefaultBarSpec()); err != nil {
+		t.Fatal(err)
+	}
+	if len(base.ranges) != 2 || base.ranges[0] != "2023-12-27..2024-01-01" || base.ranges[1] != "2024-03-05..2024-03-08" {
+		t.Errorf("Wider window fetched %v, want head and tail only", base.ranges)
+	}
+
+	// Sub-ranges, including ones ending on a weekend, are served from the cache
+	base.ranges = nil
+	data, err = provider.GetHistoricalData(ctx, "SPY", "2024-02-01", "2024-02-11", DefaultBarSpec())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(base.ranges) != 0 {
+		t.Errorf("Cached sub-range fetched %v", base.ranges)
+	}
+	if len(data) != 7 {
+		t.Errorf("Sub-range bars: got %d, want 7", len(data))
+	}
+
+	if recorder.hits != 1 || recorder.partials != 2 || recorder.misses != 1 {
+		t.Errorf("Hits/partials/misses: got %d/%d/%d, want 1/2/1", recorder.hits, recorder.partials, recorder.misses)
+	}
+}
+
+func TestCachedDataProviderDoesNotRefetchGaps(t *testing.T) {
+	base := &countingProvider{}
+	provider := NewCachedDataProvider(DefaultConfig(), base, nil)
+	ctx := context.Background()
+
+	// A weekend-only range has no bars but is still covered once fetched
+	for i := 0; i < 3; i++ {
+		data, err := provider.GetHistoricalData(ctx, "SPY", "2024-01-06", "2024-01-07", DefaultBarSpec())
+		if err != nil || len(data) != 0 {
+			t.Fatalf("GetHistoricalData: %v, %v", data, err)
+		}
+	}
+	if base.calls != 1 {
+		t.Errorf("Underlying calls: got %d, want 1", base.calls)
+	}
+}
+
+func TestCachedDataProviderPrunesToMaxLookback(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.CacheMaxLookback = 30 * 24 * time.Hour
+	base := &countingProvider{}
+	provider := NewCachedDataProvider(cfg, base, nil)
+	ctx := context.Background()
+
+	if _, err := provider.GetHistoricalData(ctx, "SPY", "2024-01-01", "2024-03-31", DefaultBarSpec()); err != nil {
+		t.Fatal(err)
+	}
+
+	// History older than the lookback was dropped and has to be fetched again
+	base.ranges = nil
+	if _, err := provider.GetHistoricalData(ctx, "SPY", "2024-02-15", "2024-03-31", DefaultBarSpec()); err != nil {
+		t.Fatal(err)
+	}
+	if len(base.ranges) != 1 || base.ranges[0] != "2024-02-15..2024-02-29" {
+		t.Errorf("Fetched %v after pruning, want 2024-02-15..2024-02-29", base.ranges)
+	}
+}
+
+func TestCachedDataProviderRefreshesOpenSession(t *testing.T) {
+	base := &countingProvider{}
+	provider := NewCachedDataProvider(DefaultConfig(), base, nil)
+	now := time.Date(2024, 3, 6, 15, 0, 0, 0, time.UTC)
+	provider.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if _, err := provider.GetHistoricalData(ctx, "SPY", "2024-02-01", "2024-03-06", DefaultBarSpec()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Within the TTL today's bars are reused; after it only today is refetched
+	now = now.Add(time.Minute)
+	if _, err := provider.GetHistoricalData(ctx, "SPY", "2024-02-01", "2024-03-06", DefaultBarSpec()); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Hour)
+	base.ranges = nil
+	if _, err := provider.GetHistoricalData(ctx, "SPY", "2024-02-01", "2024-03-06", DefaultBarSpec()); err != nil {
+		t.Fatal(err)
+	}
+	if len(base.ranges) != 1 || base.ranges[0] != "2024-03-06..2024-03-06" {
+		t.Errorf("Fetched %v after the TTL, want today only", base.ranges)
+	}
+	if base.calls != 2 {
+		t.Errorf("Underlying calls: got %d, want 2", base.calls)
+	}
+}
+
+func TestCachedDataProviderKeysIncludeBarSpec(t *testing.T) {
+	base := &countingProvider{}
+	provider := NewCachedDataProvider(DefaultConfig(), base, nil)
+	ctx := context.Background()
+
+	specs := []BarSpec{
+		DefaultBarSpec(),
+		{BarSize: BarSize30Min, WhatToShow: WhatToShowTrades},
+		{BarSize: BarSize1Min, WhatToShow: WhatToShowTrades},
+		{BarSize: BarSize1Day, WhatToShow: WhatToShowOptionImpliedVolatility},
+	}
+	for _, spec := range specs {
+		if _, err := provider.GetHistoricalData(ctx, "SPY", "2024-01-02", "2024-01-31", spec); err != nil {
+			t.Fatalf("GetHistoricalData(%s) failed: %v", spec, err)
+		}
+	}
+
+	if base.calls != len(specs) {
+		t.Errorf("Underlying calls: got %d, want %d; bar specs share a cache entry", base.calls, len(specs))
+	}
+}
+
+// fetchConcurrently requests the same range from provider in n goroutines
+// once each has looked it up in the cache, and returns their results
+func fetchConcurrently(t *testing.T, provider *CachedDataProvider, metrics *MetricTracker, base *sharedProvider, n int) ([][]MarketData, []error) {
+	t.Helper()
+	results := make([][]MarketData, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = provider.GetHistoricalData(context.Background(), "SPY", "2024-01-02", "2024-01-31", DefaultBarSpec())
+		}(i)
+	}
+
+	// Every caller missed the cache and is about to join the fetch
+	waitFor(t, "every lookup", func() bool {
+		metrics.mu.Lock()
+		defer metrics.mu.Unlock()
+		return metrics.cacheRequests == n
+	})
+	time.Sleep(20 * time.Millisecond)
+	close(base.release)
+	wg.Wait()
+	return results, errs
+}
+
+func TestCachedDataProviderSharesConcurrentFetches(t *testing.T) {
+	base := &sharedProvider{release: make(chan struct{})}
+	metrics := NewMetricTracker(prometheus.NewRegistry())
+	provider := NewCachedDataProvider(DefaultConfig(), base, metrics)
+
+	const callers = 8
+	results, errs := fetchConcurrently(t, provider, metrics, base, callers)
+	for i := range results {
+		if errs[i] != nil || len(results[i]) != 22 {
+			t.Fatalf("Caller %d got %d bars, %v; want 22", i, len(results[i]), errs[i])
+		}
+	}
+	if calls := base.calls.Load(); calls != 1 {
+		t.Errorf("Underlying calls: got %d, want 1", calls)
+	}
+	if shared := testutil.ToFloat64(metrics.providerShared.WithLabelValues(otherLabel)); shared != callers-1 {
+		t.Errorf("Deduplicated fetches: got %v, want %d", shared, callers-1)
+	}
+}
+
+func TestCachedDataProviderSharesButDoesNotCacheErrors(t *testing.T) {
+	failure := errors.New("pacing violation")
+	base := &sharedProvider{release: make(chan struct{}), err: failure}
+	metrics := NewMetricTracker(prometheus.NewRegistry())
+	provider := NewCachedDataProvider(DefaultConfig(), base, metrics)
+
+	_, errs := fetchConcurrently(t, provider, metrics, base, 4)
+	for i, err := range errs {
+		if !errors.Is(err, failure) {
+			t.Errorf("Caller %d got %v, want the shared error", i, err)
+		}
+	}
+	if calls := base.calls.Load(); calls != 1 {
+		t.Errorf("Underlying calls: got %d, want 1", calls)
+	}
+
+	// The failure was not cached, so the next request calls the provider
+	base.err = nil
+	data, err := provider.GetHistoricalData(context.Background(), "SPY", "2024-01-02", "2024-01-31", DefaultBarSpec())
+	if err != nil || len(data) != 22 {
+		t.Fatalf("GetHistoricalData after the failure: %d bars, %v", len(data), err)
+	}
+	if calls := base.calls.Load(); calls != 2 {
+		t.Errorf("Underlying calls: got %d, want 2", calls)
+	}
+}
+
+func TestCachedDataProviderWaiterCancellation(t *testing.T) {
+	base := &sharedProvider{release: make(chan struct{})}
+	provider := NewCachedDataProvider(DefaultConfig(), base, nil)
+
+	// The first caller leads the fetch and then gives up
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := make(chan error, 1)
+	go func() {
+		_, err := provider.GetHistoricalData(ctx, "SPY", "2024-01-02", "2024-01-31", DefaultBarSpec())
+		cancelled <- err
+	}()
+	waitFor(t, "the fetch", func() bool { return base.calls.Load() == 1 })
+
+	shared := make(chan []MarketData, 1)
+	go func() {
+		data, _ := provider.GetHistoricalData(context.Background(), "SPY", "2024-01-02", "2024-01-31", DefaultBarSpec())
+		shared <- data
+	}()
+	cancel()
+	if err := <-cancelled; !errors.Is(err, context.Canceled) {
+		t.Errorf("Cancelled caller got %v, want context.Canceled", err)
+	}
+
+	// The fetch carries on for the caller still waiting
+	close(base.release)
+	if data := <-shared; len(data) != 22 {
+		t.Errorf("Waiting caller got %d bars, want 22", len(data))
+	}
+	if calls := base.calls.Load(); calls != 1 {
+		t.Errorf("Underlying calls: got %d, want 1", calls)
+	}
+}
+
+func TestMockDataProviderIntradayBars(t *testing.T) {
+	provider := NewMockDataProvider(DefaultConfig())
+	spec := BarSpec{BarSize: BarSize30Min, WhatToShow: WhatToShowTrades}
+
+	// Friday through Monday: the weekend produces no bars
+	data, err := provider.GetHistoricalData(context.Background(), "SPY", "2024-01-05", "2024-01-08", spec)
+	if err != nil {
+		t.Fatalf("GetHistoricalData failed: %v", err)
+	}
+
+	// 09:30 to 16:00 is thirteen 30-minute bars per session
+	if len(data) != 26 {
+		t.Fatalf("Bars: got %d, want 26", len(data))
+	}
+
+	loc := newYorkLocation()
+	for i, bar := range data {
+		local := bar.Timestamp.In(loc)
+		minutes := local.Hour()*60 + local.Minute()
+		if minutes < marketOpenMinutes || minutes >= marketCloseMinutes {
+			t.Errorf("Bar %d at %s is outside regular trading hours", i, local)
+		}
+		if i > 0 && bar.Timestamp.Sub(data[i-1].Timestamp) != 30*time.Minute && local.Day() == data[i-1].Timestamp.In(loc).Day() {
+			t.Errorf("Bar %d is not 30 minutes after the previous bar", i)
+		}
+	}
+	if first := data[0].Timestamp.In(loc); first.Hour() != 9 || first.Minute() != 30 {
+		t.Errorf("First bar: got %s, want 09:30", first)
+	}
+}
+
+func TestMockDataProviderIsSeededAndRangeIndependent(t *testing.T) {
+	cfg := DefaultConfig()
+	provider := NewMockDataProvider(cfg)
+	spec := DefaultBarSpec()
+	ctx := context.Background()
+
+	full, _ := provider.GetHistoricalData(ctx, "AAPL", "2024-01-01", "2024-01-31", spec)
+	tail, _ := provider.GetHistoricalData(ctx, "AAPL", "2024-01-15", "2024-01-31", spec)
+	offset := len(full) - len(tail)
+	for i, bar := range tail {
+		if bar != full[offset+i] {
+			t.Fatalf("Bar %s differs between overlapping requests: %+v vs %+v", bar.Timestamp, bar, full[offset+i])
+		}
+	}
+
+	cfg.MockSeed = 7
+	reseeded, _ := NewMockDataProvider(cfg).GetHistoricalData(ctx, "AAPL", "2024-01-01", "2024-01-31", spec)
+	if reseeded[0].Close == full[0].Close {
+		t.Errorf("Expected a different seed to change prices, both closed at %v", full[0].Close)
+	}
+}
+
+// fixtureProvider serves the bars of the aggregation fixtures, counting the
+// requests of each bar size
+type fixtureProvider struct {
+	intraday, daily []MarketData
+	calls           map[string]int
+}
+
+func (f *fixtureProvider) GetHistoricalData(ctx context.Context, symbol, startDate, endDate string, spec BarSpec) ([]MarketData, error) {
+	f.calls[spec.BarSize]++
+	bars := f.daily
+	if spec.Intraday() {
+		bars = f.intraday
+	}
+	start, _ := time.Parse(dateLayout, startDate)
+	end, _ := time.Parse(dateLayout, endDate)
+	var data []MarketData
+	for _, bar := range bars {
+		if date := barDate(bar.Timestamp); !date.Before(start) && !date.After(end) {
+			data = append(data, bar)
+		}
+	}
+	return data, nil
+}
+
+func TestCachedDataProviderAggregatesDailyBars(t *testing.T) {
+	ctx := context.Background()
+	intraday, daily := BarSpec{BarSize: BarSize5Min, WhatToShow: WhatToShowTrades}, DefaultBarSpec()
+	newProvider := func(now time.Time) (*CachedDataProvider, *fixtureProvider, *countingRecorder) {
+		base := &fixtureProvider{intraday: loadBars(t, "AAPL_5min.json"), daily: loadBars(t, "AAPL_1day.json"), calls: map[string]int{}}
+		recorder := &countingRecorder{}
+		provider := NewCachedDataProvider(DefaultConfig(), base, recorder)
+		provider.now = func() time.Time { return now }
+		if _, err := provider.GetHistoricalData(ctx, "AAPL", "2024-07-01", "2024-07-05", intraday); err != nil {
+			t.Fatal(err)
+		}
+		return provider, base, recorder
+	}
+	afterTheWeek := time.Date(2024, 7, 8, 12, 0, 0, 0, time.UTC)
+
+	// The daily bars are built from the cached 5-minute bars
+	provider, base, recorder := newProvider(afterTheWeek)
+	bars, err := provider.GetHistoricalData(ctx, "AAPL", "2024-07-01", "2024-07-05", daily)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertBars(t, bars, loadBars(t, "AAPL_1day.json"))
+	if base.calls[BarSize1Day] != 0 || recorder.aggregated != 1 {
+		t.Errorf("Daily fetches = %d, aggregated = %d; want the daily bars aggregated", base.calls[BarSize1Day], recorder.aggregated)
+	}
+
+	// Dates the 5-minute bars do not cover are fetched
+	if _, err := provider.GetHistoricalData(ctx, "AAPL", "2024-06-28", "2024-07-05", daily); err != nil {
+		t.Fatal(err)
+	}
+	if base.calls[BarSize1Day] != 1 || recorder.aggregated != 1 {
+		t.Errorf("Daily fetches = %d, aggregated = %d; want dates outside the 5-minute bars fetched", base.calls[BarSize1Day], recorder.aggregated)
+	}
+
+	// So is a session still open, whose bars are not all in yet
+	provider, base, recorder = newProvider(time.Date(2024, 7, 5, 15, 0, 0, 0, time.UTC))
+	if _, err := provider.GetHistoricalData(ctx, "AAPL", "2024-07-01", "2024-07-05", daily); err != nil {
+		t.Fatal(err)
+	}
+	if base.calls[BarSize1Day] != 1 || recorder.aggregated != 0 {
+		t.Errorf("Daily fetches = %d, aggregated = %d; want the open session fetched", base.calls[BarSize1Day], recorder.aggregated)
+	}
+
+	// And everything when aggregation is off
+	provider, base, recorder = newProvider(afterTheWeek)
+	provider.config.CacheAggregateBars = false
+	if _, err := provider.GetHistoricalData(ctx, "AAPL", "2024-07-01", "2024-07-05", daily); err != nil {
+		t.Fatal(err)
+	}
+	if base.calls[BarSize1Day] != 1 || recorder.aggregated != 0 {
+		t.Errorf("Daily fetches = %d, aggregated = %d with aggregation off", base.calls[BarSize1Day], recorder.aggregated)
+	}
+}
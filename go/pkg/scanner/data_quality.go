@@ -0,0 +1,227 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/trustdan/ibkr-trader/go/pkg/calendar"
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// Data quality issues, as counted by a QualityReport
+const (
+	IssueMissingDay         = "missing_day"
+	IssueBadPrice           = "bad_price"
+	IssueHighBelowLow       = "high_below_low"
+	IssueDuplicateTimestamp = "duplicate_timestamp"
+	IssueAbnormalGap        = "abnormal_gap"
+	IssueMixedAdjustment    = "mixed_adjustment"
+)
+
+// ErrorDataQuality prefixes the scan error of a symbol left out for the
+// quality of its bars
+const ErrorDataQuality = "DATA_QUALITY"
+
+// maxQualityDetails bounds the details a QualityReport keeps
+const maxQualityDetails = 20
+
+// QualityTolerances are how many issues of each kind a symbol's bars may have
+// and still be scanned
+type QualityTolerances struct {
+	MaxMissingDays int
+	MaxBadBars     int
+	GapPercent     float64
+	MaxGaps        int
+}
+
+// qualityTolerances returns the tolerances of the configuration
+func (c *Config) qualityTolerances() QualityTolerances {
+	return QualityTolerances{
+		MaxMissingDays: c.DataQualityMaxMissing,
+		MaxBadBars:     c.DataQualityMaxBadBars,
+		GapPercent:     c.DataQualityGapPercent,
+		MaxGaps:        c.DataQualityMaxGaps,
+	}
+}
+
+// QualityReport is the result of checking one symbol's bars
+type QualityReport struct {
+	Symbol    string
+	CheckedAt time.Time
+	Bars      int
+	// Issues counts the issues found by type, without the types not found
+	Issues map[string]int
+	// Details describe the first issues found, one line each
+	Details []string
+	Passed  bool
+	// Reason is the first tolerance exceeded, empty when Passed
+	Reason string
+}
+
+// CheckDataQuality checks a symbol's bars, oldest first, for open market days
+// missing between daily bars, prices at or below zero, highs below lows,
+// repeated timestamps, closes moving more than tolerances.GapPercent from
+// the previous close of the same session and split-adjusted bars next to
+// unadjusted ones, whose prices are not comparable, so that a series mixing
+// them always fails. The first bar of a session is not compared with the
+// last of the session before, as thin pre-market and after-hours trading
+// routinely prices away from the regular session.
+// Missing days are only counted between the first and last bar, and not for
+// intraday bars, whose sessions the calendar does not tell apart from gaps.
+func CheckDataQuality(symbol string, data []MarketData, spec BarSpec, market *calendar.MarketCalendar, tolerances QualityTolerances, now time.Time) QualityReport {
+	report := QualityReport{Symbol: symbol, CheckedAt: now, Bars: len(data), Issues: map[string]int{}}
+	found := func(issue, format string, args ...interface{}) {
+		report.Issues[issue]++
+		if len(report.Details) < maxQualityDetails {
+			report.Details = append(report.Details, fmt.Sprintf(format, args...))
+		}
+	}
+
+	seen := make(map[time.Time]bool, len(data))
+	badBars := 0
+	for i, bar := range data {
+		stamp := bar.Timestamp.Format(time.RFC3339)
+		bad := false
+		if bar.Open <= 0 || bar.High <= 0 || bar.Low <= 0 || bar.Close <= 0 {
+			found(IssueBadPrice, "%s: price at or below zero (open %g, high %g, low %g, close %g)", stamp, bar.Open, bar.High, bar.Low, bar.Close)
+			bad = true
+		}
+		if bar.High < bar.Low {
+			found(IssueHighBelowLow, "%s: high %g below low %g", stamp, bar.High, bar.Low)
+			bad = true
+		}
+		if seen[bar.Timestamp.UTC()] {
+			found(IssueDuplicateTimestamp, "%s: repeated timestamp", stamp)
+			bad = true
+		}
+		seen[bar.Timestamp.UTC()] = true
+		if bad {
+			badBars++
+		}
+		if i == 0 {
+			continue
+		}
+
+		previous := data[i-1]
+		if bar.Adjusted != previous.Adjusted {
+			found(IssueMixedAdjustment, "%s: split-adjusted %t after %t", stamp, bar.Adjusted, previous.Adjusted)
+		}
+		if previous.Close > 0 && tolerances.GapPercent > 0 && bar.session() == previous.session() {
+			if move := (bar.Close/previous.Close - 1) * 100; math.Abs(move) > tolerances.GapPercent {
+				found(IssueAbnormalGap, "%s: close %g moved %.1f%% from the previous close %g", stamp, bar.Close, move, previous.Close)
+			}
+		}
+		if !spec.Intraday() {
+			for _, day := range missingMarketDays(market, previous.Timestamp, bar.Timestamp) {
+				found(IssueMissingDay, "%s: no bar for an open market day", day)
+			}
+		}
+	}
+
+	gaps := report.Issues[IssueAbnormalGap]
+	switch {
+	case report.Issues[IssueMixedAdjustment] > 0:
+		report.Reason = fmt.Sprintf("split-adjusted and unadjusted bars mixed at %d points", report.Issues[IssueMixedAdjustment])
+	case report.Issues[IssueMissingDay] > tolerances.MaxMissingDays:
+		report.Reason = fmt.Sprintf("%d missing trading days, at most %d allowed", report.Issues[IssueMissingDay], tolerances.MaxMissingDays)
+	case badBars > tolerances.MaxBadBars:
+		report.Reason = fmt.Sprintf("%d bad bars, at most %d allowed", badBars, tolerances.MaxBadBars)
+	case gaps > tolerances.MaxGaps:
+		report.Reason = fmt.Sprintf("%d closes moved over %g%%, at most %d allowed", gaps, tolerances.GapPercent, tolerances.MaxGaps)
+	}
+	report.Passed = report.Reason == ""
+	return report
+}
+
+// missingMarketDays returns the dates strictly between two daily bars on
+// which the market was open. A bar's date is the date of its timestamp as
+// given, since providers stamp daily bars at midnight in varying zones.
+func missingMarketDays(market *calendar.MarketCalendar, from, to time.Time) []string {
+	var missing []string
+	day := time.Date(from.Year(), from.Month(), from.Day(), 12, 0, 0, 0, market.Location())
+	last := time.Date(to.Year(), to.Month(), to.Day(), 12, 0, 0, 0, market.Location())
+	for day = day.AddDate(0, 0, 1); day.Before(last); day = day.AddDate(0, 0, 1) {
+		if !market.Day(day).Closed() {
+			missing = append(missing, day.Format(dateLayout))
+		}
+	}
+	return missing
+}
+
+// qualityReports keeps the latest QualityReport of each symbol checked
+type qualityReports struct {
+	mu      sync.Mutex
+	reports map[string]QualityReport
+}
+
+func (q *qualityReports) record(report QualityReport) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.reports == nil {
+		q.reports = make(map[string]QualityReport)
+	}
+	q.reports[report.Symbol] = report
+}
+
+// list returns the latest reports of symbols, or of every symbol when none
+// are given, sorted by symbol
+func (q *qualityReports) list(symbols []string, failedOnly bool) []QualityReport {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	wanted := make(map[string]bool, len(symbols))
+	for _, symbol := range symbols {
+		wanted[symbol] = true
+	}
+	var out []QualityReport
+	for symbol, report := range q.reports {
+		if (len(wanted) > 0 && !wanted[symbol]) || (failedOnly && report.Passed) {
+			continue
+		}
+		out = append(out, report)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Symbol < out[j].Symbol })
+	return out
+}
+
+// checkDataQuality checks the bars fetched for a scan of symbol when data
+// quality checks are enabled, recording and counting the result. It returns
+// the scan error of a symbol that failed, empty otherwise.
+func (s *Engine) checkDataQuality(d *serviceDeps, symbol string, data []MarketData, spec BarSpec) string {
+	if !d.config.DataQualityEnabled {
+		return ""
+	}
+	report := CheckDataQuality(symbol, data, spec, d.market, d.config.qualityTolerances(), time.Now())
+	s.quality.record(report)
+	s.metricTracker.RecordDataQualityIssues(report.Issues)
+	if report.Passed {
+		return ""
+	}
+	return ErrorDataQuality + ": " + report.Reason
+}
+
+// GetDataQuality implements the GetDataQuality RPC method
+func (s *Engine) GetDataQuality(ctx context.Context, req *pb.DataQualityRequest) (*pb.DataQualityResponse, error) {
+	latest := s.quality.list(req.Symbols, req.FailedOnly)
+	reports := make([]*pb.DataQualityReport, len(latest))
+	for i, report := range latest {
+		issues := make(map[string]int32, len(report.Issues))
+		for issue, n := range report.Issues {
+			issues[issue] = int32(n)
+		}
+		reports[i] = &pb.DataQualityReport{
+			Symbol:    report.Symbol,
+			CheckedAt: report.CheckedAt.Format(time.RFC3339),
+			Bars:      int32(report.Bars),
+			Issues:    issues,
+			Details:   report.Details,
+			Passed:    report.Passed,
+			Reason:    report.Reason,
+		}
+	}
+	return &pb.DataQualityResponse{Reports: reports}, nil
+}
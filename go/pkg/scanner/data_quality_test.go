@@ -0,0 +1,134 @@
+package scanner
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/trustdan/ibkr-trader/go/pkg/calendar"
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// withoutDates returns the bars of data not dated on any of dates
+func withoutDates(data []MarketData, dates ...string) []MarketData {
+	return slices.DeleteFunc(slices.Clone(data), func(bar MarketData) bool {
+		return slices.Contains(dates, bar.Timestamp.Format(dateLayout))
+	})
+}
+
+// corrupted returns a copy of data with the bar at index i changed by change
+func corrupted(data []MarketData, i int, change func(*MarketData)) []MarketData {
+	data = slices.Clone(data)
+	change(&data[i])
+	return data
+}
+
+func TestCheckDataQuality(t *testing.T) {
+	// January 2024 has Martin Luther King Jr. Day on the 15th
+	clean := withoutDates(risingBars("AAPL", "2024-01-02", "2024-01-31"), "2024-01-15")
+	withHoliday := risingBars("AAPL", "2024-01-02", "2024-01-31")
+	tolerances := QualityTolerances{MaxMissingDays: 2, GapPercent: 30, MaxGaps: 1}
+	intraday := BarSpec{BarSize: BarSize30Min, WhatToShow: WhatToShowTrades}
+
+	tests := []struct {
+		name   string
+		data   []MarketData
+		spec   BarSpec
+		issues map[string]int
+		passed bool
+	}{
+		{"clean", withHoliday, DefaultBarSpec(), map[string]int{}, true},
+		{"holiday is not missing", clean, DefaultBarSpec(), map[string]int{}, true},
+		{"missing days within tolerance", withoutDates(clean, "2024-01-09", "2024-01-10"), DefaultBarSpec(), map[string]int{IssueMissingDay: 2}, true},
+		{"missing days", withoutDates(clean, "2024-01-09", "2024-01-10", "2024-01-22"), DefaultBarSpec(), map[string]int{IssueMissingDay: 3}, false},
+		{"missing days of intraday bars", withoutDates(clean, "2024-01-09", "2024-01-10", "2024-01-22"), intraday, map[string]int{}, true},
+		{"zero price", corrupted(clean, 5, func(bar *MarketData) { bar.Low = 0 }), DefaultBarSpec(), map[string]int{IssueBadPrice: 1}, false},
+		{"high below low", corrupted(clean, 5, func(bar *MarketData) { bar.High, bar.Low = bar.Low, bar.High }), DefaultBarSpec(), map[string]int{IssueHighBelowLow: 1}, false},
+		{"duplicate timestamp", corrupted(clean, 5, func(bar *MarketData) { bar.Timestamp = clean[4].Timestamp }), DefaultBarSpec(), map[string]int{IssueDuplicateTimestamp: 1, IssueMissingDay: 1}, false},
+		{"one gap", corrupted(clean, len(clean)-1, func(bar *MarketData) { bar.Close *= 2 }), DefaultBarSpec(), map[string]int{IssueAbnormalGap: 1}, true},
+		{"spike", corrupted(clean, 5, func(bar *MarketData) { bar.Close *= 2 }), DefaultBarSpec(), map[string]int{IssueAbnormalGap: 2}, false},
+		{"mixed adjustment", corrupted(clean, 5, func(bar *MarketData) { bar.Adjusted = true }), DefaultBarSpec(), map[string]int{IssueMixedAdjustment: 2}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := CheckDataQuality("AAPL", tt.data, tt.spec, calendar.DefaultMarketCalendar(), tolerances, time.Now())
+			if !maps.Equal(report.Issues, tt.issues) {
+				t.Errorf("Issues = %v, want %v (details %q)", report.Issues, tt.issues, report.Details)
+			}
+			if report.Passed != tt.passed || (report.Reason == "") != tt.passed {
+				t.Errorf("Passed = %v with reason %q, want %v", report.Passed, report.Reason, tt.passed)
+			}
+			if report.Bars != len(tt.data) {
+				t.Errorf("Bars = %d, want %d", report.Bars, len(tt.data))
+			}
+		})
+	}
+}
+
+// gappyProvider serves risingBars with a week of bars missing for GAPS
+type gappyProvider struct{}
+
+func (gappyProvider) GetHistoricalData(ctx context.Context, symbol, startDate, endDate string, spec BarSpec) ([]MarketData, error) {
+	data := risingBars(symbol, startDate, endDate)
+	if symbol == "GAPS" {
+		data = withoutDates(data, "2024-01-08", "2024-01-09", "2024-01-10", "2024-01-11", "2024-01-12")
+	}
+	return data, nil
+}
+
+func TestScanLeavesOutPoorQualityData(t *testing.T) {
+	service := newTestService(t)
+	useProvider(service, gappyProvider{})
+	client := dialTestServer(t, service)
+
+	resp, err := client.Scan(context.Background(), &pb.ScanRequest{
+		Symbols:    []string{"AAPL", "GAPS"},
+		Strategies: []string{"HIGH_BASE"},
+		DateRange:  testDateRange(),
+	})
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if resp.Signals["AAPL"] == nil || resp.Signals["GAPS"] != nil {
+		t.Errorf("Signals = %v, want AAPL only", resp.Signals)
+	}
+	if reason := resp.Errors["GAPS"]; !strings.HasPrefix(reason, ErrorDataQuality+": 5 missing trading days") || len(resp.Errors) != 1 {
+		t.Errorf("Errors = %v, want GAPS left out for its missing days", resp.Errors)
+	}
+	if n := testutil.ToFloat64(service.metricTracker.qualityIssues.WithLabelValues(IssueMissingDay)); n != 5 {
+		t.Errorf("Missing day issues counted = %v, want 5", n)
+	}
+
+	quality, err := client.GetDataQuality(context.Background(), &pb.DataQualityRequest{})
+	if err != nil {
+		t.Fatalf("GetDataQuality failed: %v", err)
+	}
+	if reports := quality.GetReports(); len(reports) != 2 || reports[0].Symbol != "AAPL" || !reports[0].Passed || reports[1].Passed {
+		t.Fatalf("GetDataQuality = %v, want AAPL passed and GAPS failed", reports)
+	}
+	failed, err := client.GetDataQuality(context.Background(), &pb.DataQualityRequest{FailedOnly: true})
+	if err != nil {
+		t.Fatalf("GetDataQuality failed: %v", err)
+	}
+	if reports := failed.GetReports(); len(reports) != 1 || reports[0].Symbol != "GAPS" || reports[0].Issues[IssueMissingDay] != 5 || len(reports[0].Details) != 5 {
+		t.Errorf("Failed reports = %v, want GAPS with 5 missing days", reports)
+	}
+
+	// With the checks disabled the symbol is scanned whatever its bars
+	cfg := *service.Config()
+	cfg.DataQualityEnabled = false
+	service.UpdateConfig(&cfg)
+	useProvider(service, gappyProvider{})
+	resp, err = client.Scan(context.Background(), &pb.ScanRequest{Symbols: []string{"GAPS"}, Strategies: []string{"HIGH_BASE"}, DateRange: testDateRange()})
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if resp.Signals["GAPS"] == nil || len(resp.Errors) != 0 {
+		t.Errorf("Scan without data quality checks = %v, errors %v; want GAPS scanned", resp.Signals, resp.Errors)
+	}
+}
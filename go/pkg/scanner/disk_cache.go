@@ -0,0 +1,422 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// diskCacheMagic starts every disk cache file, naming the format version.
+// Files of another version fail to load as corrupt and are fetched again.
+const diskCacheMagic = "SCNBARS2"
+
+// diskBarSize is the encoded size of one bar: timestamp, UTC offset, open,
+// high, low, close, volume and flags
+const diskBarSize = 8 + 4 + 4*8 + 8 + 1
+
+// diskSplitSize is the encoded size of one split: ex-date and ratio
+const diskSplitSize = 8 + 8
+
+// diskBarAdjusted is the flag of a bar adjusted for splits
+const diskBarAdjusted = 1
+
+// diskBarSessions are the flags of the sessions bars are tagged with; bars
+// without a session have none of them
+var diskBarSessions = map[string]uint8{
+	SessionPreMarket:  2,
+	SessionRegular:    4,
+	SessionPostMarket: 8,
+}
+
+// errCorruptCache is wrapped by the errors of disk cache files that fail
+// their checksums or cannot be decoded
+var errCorruptCache = errors.New("corrupt disk cache file")
+
+// diskCache is the tier of the bar cache kept on disk across restarts. Each
+// series has a file of ranges appended as they are fetched, each with its own
+// checksum, which compaction merges into one.
+//
+// A file is a header of diskCacheMagic, the length of the series key and the
+// key, followed by a CRC-32 of all three. Each segment is its payload length,
+// the payload and its CRC-32. A payload is the time the segment was written,
+// the first and last date of its range, the bar count, the bars, the split
+// count and the splits the bars were fetched with.
+type diskCache struct {
+	dir         string
+	ttl         time.Duration
+	maxSegments int
+
+	mu    sync.Mutex
+	files map[string]*diskCacheFile
+}
+
+// diskCacheFile serializes the operations on one file and counts its
+// segments once it has been read or created
+type diskCacheFile struct {
+	mu         sync.Mutex
+	segments   int
+	counted    bool
+	compacting bool
+}
+
+// diskSegment is one range of bars appended to a file
+type diskSegment struct {
+	written time.Time
+	r       dateRange
+	bars    []MarketData
+	splits  []CorporateAction
+}
+
+// newDiskCache creates dir and returns the disk cache kept there. Files not
+// written for ttl are dropped when read, and those holding more than
+// maxSegments are compacted.
+func newDiskCache(dir string, ttl time.Duration, maxSegments int) (*diskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create disk cache directory: %w", err)
+	}
+	return &diskCache{dir: dir, ttl: ttl, maxSegments: maxSegments, files: make(map[string]*diskCacheFile)}, nil
+}
+
+// file returns the lock of key's file
+func (d *diskCache) file(key string) *diskCacheFile {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	file := d.files[key]
+	if file == nil {
+		file = &diskCacheFile{}
+		d.files[key] = file
+	}
+	return file
+}
+
+// path returns the file of key: its characters that are unsafe in a file
+// name replaced, with a hash of the key telling apart keys that then match
+func (d *diskCache) path(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		}
+		return '_'
+	}, key)
+	return filepath.Join(d.dir, fmt.Sprintf("%s-%08x.bars", name, crc32.ChecksumIEEE([]byte(key))))
+}
+
+// load returns the segments of key's file in the order they were written,
+// none when there is no file. A file not written for the TTL before now, or
+// corrupt, is removed and loads nothing, so the series is fetched again.
+func (d *diskCache) load(key string, now time.Time) []diskSegment {
+	file := d.file(key)
+	file.mu.Lock()
+	defer file.mu.Unlock()
+
+	path := d.path(key)
+	info, err := os.Stat(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logrus.Warnf("Disk cache of %s unavailable: %v", key, err)
+		}
+		return nil
+	}
+	if d.ttl > 0 && now.Sub(info.ModTime()) > d.ttl {
+		logrus.Debugf("Disk cache of %s expired, last written %s", key, info.ModTime().Format(time.RFC3339))
+		d.remove(path)
+		return nil
+	}
+
+	segments, err := d.read(path, key)
+	if err != nil {
+		logrus.Warnf("Dropping the disk cache of %s: %v", key, err)
+		d.remove(path)
+		return nil
+	}
+	file.segments, file.counted = len(segments), true
+
+	// Bars are stored without their symbol, the first part of the key
+	symbol, _, _ := strings.Cut(key, ":")
+	for _, segment := range segments {
+		for i := range segment.bars {
+			segment.bars[i].Symbol = symbol
+		}
+	}
+	return segments
+}
+
+// append adds a segment to key's file, creating the file when needed, and
+// compacts the file in the background once it holds too many segments
+func (d *diskCache) append(key string, segment diskSegment) error {
+	file := d.file(key)
+	file.mu.Lock()
+	defer file.mu.Unlock()
+
+	path := d.path(key)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open disk cache of %s: %w", key, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to open disk cache of %s: %w", key, err)
+	}
+
+	var buf bytes.Buffer
+	if info.Size() == 0 {
+		writeDiskHeader(&buf, key)
+		file.segments, file.counted = 0, true
+	}
+	writeDiskSegment(&buf, segment)
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		file.counted = false
+		return fmt.Errorf("failed to write disk cache of %s: %w", key, err)
+	}
+	if file.counted {
+		file.segments++
+	} else if segments, err := d.read(path, key); err == nil {
+		file.segments, file.counted = len(segments), true
+	}
+
+	if d.maxSegments > 0 && file.segments > d.maxSegments && !file.compacting {
+		file.compacting = true
+		go func() {
+			if err := d.compact(key); err != nil {
+				logrus.Warnf("Failed to compact the disk cache of %s: %v", key, err)
+			}
+		}()
+	}
+	return nil
+}
+
+// compact rewrites key's file as the single segment its segments merge into,
+// keeping its modification time so that compaction does not extend its TTL
+func (d *diskCache) compact(key string) error {
+	file := d.file(key)
+	file.mu.Lock()
+	defer file.mu.Unlock()
+	defer func() { file.compacting = false }()
+	file.counted = false
+
+	path := d.path(key)
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	segments, err := d.read(path, key)
+	if err != nil {
+		d.remove(path)
+		return err
+	}
+	if len(segments) < 2 {
+		return nil
+	}
+
+	var series barSeries
+	series.restore(segments)
+	merged := diskSegment{written: series.refreshed, r: dateRange{start: series.from, end: series.to}, bars: series.bars, splits: series.splits}
+
+	var buf bytes.Buffer
+	writeDiskHeader(&buf, key)
+	writeDiskSegment(&buf, merged)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	if err := os.Chtimes(tmp, info.ModTime(), info.ModTime()); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	file.segments, file.counted = 1, true
+	logrus.Debugf("Compacted %d segments of the disk cache of %s", len(segments), key)
+	return nil
+}
+
+// drop deletes key's file, whose bars are no longer valid
+func (d *diskCache) drop(key string) {
+	file := d.file(key)
+	file.mu.Lock()
+	defer file.mu.Unlock()
+	d.remove(d.path(key))
+	file.segments, file.counted = 0, false
+}
+
+// remove deletes a file that is expired or corrupt
+func (d *diskCache) remove(path string) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		logrus.Warnf("Failed to remove disk cache file %s: %v", path, err)
+	}
+}
+
+// read decodes the file at path, checking that it holds key's series and
+// that every checksum matches
+func (d *diskCache) read(path, key string) ([]diskSegment, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := bytes.NewReader(data)
+	header := make([]byte, len(diskCacheMagic)+2)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:len(diskCacheMagic)]) != diskCacheMagic {
+		return nil, fmt.Errorf("%w: bad header", errCorruptCache)
+	}
+	stored := make([]byte, binary.LittleEndian.Uint16(header[len(diskCacheMagic):]))
+	var sum uint32
+	if _, err := io.ReadFull(r, stored); err != nil || binary.Read(r, binary.LittleEndian, &sum) != nil {
+		return nil, fmt.Errorf("%w: bad header", errCorruptCache)
+	}
+	if crc32.ChecksumIEEE(append(header, stored...)) != sum {
+		return nil, fmt.Errorf("%w: header checksum mismatch", errCorruptCache)
+	}
+	if string(stored) != key {
+		return nil, fmt.Errorf("%w: holds %s", errCorruptCache, stored)
+	}
+
+	var segments []diskSegment
+	for r.Len() > 0 {
+		var size uint32
+		if err := binary.Read(r, binary.LittleEndian, &size); err != nil || int64(size) > int64(r.Len()) {
+			return nil, fmt.Errorf("%w: truncated segment %d", errCorruptCache, len(segments)+1)
+		}
+		payload := make([]byte, size)
+		io.ReadFull(r, payload)
+		if err := binary.Read(r, binary.LittleEndian, &sum); err != nil || crc32.ChecksumIEEE(payload) != sum {
+			return nil, fmt.Errorf("%w: checksum mismatch in segment %d", errCorruptCache, len(segments)+1)
+		}
+		segment, err := decodeDiskSegment(payload)
+		if err != nil {
+			return nil, fmt.Errorf("%w: segment %d: %v", errCorruptCache, len(segments)+1, err)
+		}
+		segments = append(segments, segment)
+	}
+	return segments, nil
+}
+
+// writeDiskHeader encodes the header of key's file
+func writeDiskHeader(buf *bytes.Buffer, key string) {
+	start := buf.Len()
+	buf.WriteString(diskCacheMagic)
+	binary.Write(buf, binary.LittleEndian, uint16(len(key)))
+	buf.WriteString(key)
+	binary.Write(buf, binary.LittleEndian, crc32.ChecksumIEEE(buf.Bytes()[start:]))
+}
+
+// writeDiskSegment encodes a segment with its length and checksum
+func writeDiskSegment(buf *bytes.Buffer, segment diskSegment) {
+	var payload bytes.Buffer
+	binary.Write(&payload, binary.LittleEndian, []int64{segment.written.UnixNano(), segment.r.start.Unix(), segment.r.end.Unix()})
+	binary.Write(&payload, binary.LittleEndian, uint32(len(segment.bars)))
+	for _, bar := range segment.bars {
+		_, offset := bar.Timestamp.Zone()
+		binary.Write(&payload, binary.LittleEndian, bar.Timestamp.UnixNano())
+		binary.Write(&payload, binary.LittleEndian, int32(offset))
+		for _, price := range []float64{bar.Open, bar.High, bar.Low, bar.Close} {
+			binary.Write(&payload, binary.LittleEndian, math.Float64bits(price))
+		}
+		binary.Write(&payload, binary.LittleEndian, bar.Volume)
+		var flags uint8
+		if bar.Adjusted {
+			flags |= diskBarAdjusted
+		}
+		flags |= diskBarSessions[bar.Session]
+		payload.WriteByte(flags)
+	}
+	binary.Write(&payload, binary.LittleEndian, uint32(len(segment.splits)))
+	for _, split := range segment.splits {
+		binary.Write(&payload, binary.LittleEndian, split.Date.Unix())
+		binary.Write(&payload, binary.LittleEndian, math.Float64bits(split.Ratio))
+	}
+
+	binary.Write(buf, binary.LittleEndian, uint32(payload.Len()))
+	buf.Write(payload.Bytes())
+	binary.Write(buf, binary.LittleEndian, crc32.ChecksumIEEE(payload.Bytes()))
+}
+
+// decodeDiskSegment decodes a segment payload whose checksum matched. Bars
+// keep the UTC offset they were fetched in, so their dates do not shift.
+func decodeDiskSegment(payload []byte) (diskSegment, error) {
+	const headerSize = 3*8 + 4
+	if len(payload) < headerSize {
+		return diskSegment{}, fmt.Errorf("payload of %d bytes", len(payload))
+	}
+	le := binary.LittleEndian
+	segment := diskSegment{
+		written: time.Unix(0, int64(le.Uint64(payload))),
+		r: dateRange{
+			start: time.Unix(int64(le.Uint64(payload[8:])), 0).UTC(),
+			end:   time.Unix(int64(le.Uint64(payload[16:])), 0).UTC(),
+		},
+	}
+	count := int(le.Uint32(payload[24:]))
+	barsEnd := headerSize + count*diskBarSize
+	if len(payload) < barsEnd+4 {
+		return diskSegment{}, fmt.Errorf("%d bars in a payload of %d bytes", count, len(payload))
+	}
+	splits := int(le.Uint32(payload[barsEnd:]))
+	if len(payload) != barsEnd+4+splits*diskSplitSize {
+		return diskSegment{}, fmt.Errorf("%d bars and %d splits in a payload of %d bytes", count, splits, len(payload))
+	}
+
+	segment.bars = make([]MarketData, count)
+	for i := range segment.bars {
+		b := payload[headerSize+i*diskBarSize:]
+		location := time.UTC
+		if offset := int(int32(le.Uint32(b[8:]))); offset != 0 {
+			location = time.FixedZone("", offset)
+		}
+		segment.bars[i] = MarketData{
+			Timestamp: time.Unix(0, int64(le.Uint64(b))).In(location),
+			Open:      math.Float64frombits(le.Uint64(b[12:])),
+			High:      math.Float64frombits(le.Uint64(b[20:])),
+			Low:       math.Float64frombits(le.Uint64(b[28:])),
+			Close:     math.Float64frombits(le.Uint64(b[36:])),
+			Volume:    int64(le.Uint64(b[44:])),
+			Adjusted:  b[52]&diskBarAdjusted != 0,
+		}
+		for session, flag := range diskBarSessions {
+			if b[52]&flag != 0 {
+				segment.bars[i].Session = session
+			}
+		}
+	}
+	for i := 0; i < splits; i++ {
+		b := payload[barsEnd+4+i*diskSplitSize:]
+		segment.splits = append(segment.splits, CorporateAction{
+			Type:  CorporateActionSplit,
+			Date:  time.Unix(int64(le.Uint64(b)), 0).UTC(),
+			Ratio: math.Float64frombits(le.Uint64(b[8:])),
+		})
+	}
+	return segment, nil
+}
+
+// restore rebuilds an empty series from the segments of its file, merging
+// them in the order they were written as they were merged in memory. The
+// series counts as refreshed when the segment reaching its last date was
+// written, so the bars of the current session expire as they would have.
+// It was fetched with the splits of all the segments.
+func (s *barSeries) restore(segments []diskSegment) {
+	var tail time.Time
+	for _, segment := range segments {
+		s.splits = append(s.splits, newActions(s.splits, segment.splits)...)
+		s.merge(segment.r, segment.bars, segment.written)
+		if !segment.r.end.Before(s.to) {
+			tail = segment.written
+		}
+	}
+	s.refreshed = tail
+}
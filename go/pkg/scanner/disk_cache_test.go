@@ -0,0 +1,221 @@
+package scanner
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+// diskCacheConfig is the default config with the disk cache in a temporary
+// directory
+func diskCacheConfig(t *testing.T) *Config {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.CacheDiskDir = t.TempDir()
+	return cfg
+}
+
+func TestDiskCacheWritesThrough(t *testing.T) {
+	cfg := diskCacheConfig(t)
+	provider := NewCachedDataProvider(cfg, &countingProvider{}, nil)
+	ctx := context.Background()
+
+	if _, err := provider.GetHistoricalData(ctx, "SPY", "2024-01-02", "2024-01-31", DefaultBarSpec()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.GetHistoricalData(ctx, "SPY", "2024-01-02", "2024-02-29", DefaultBarSpec()); err != nil {
+		t.Fatal(err)
+	}
+
+	key := "SPY:" + DefaultBarSpec().String()
+	segments, err := provider.disk.read(provider.disk.path(key), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 2 || segments[1].r.start.Format(dateLayout) != "2024-02-01" || len(segments[0].bars) != 22 {
+		t.Errorf("Segments written: %d, want January's 22 bars then February's", len(segments))
+	}
+}
+
+func TestDiskCacheHitAfterRestart(t *testing.T) {
+	cfg := diskCacheConfig(t)
+	ctx := context.Background()
+	now := time.Date(2024, 3, 6, 15, 0, 0, 0, time.UTC)
+
+	first := NewCachedDataProvider(cfg, &countingProvider{}, nil)
+	first.now = func() time.Time { return now }
+	want, err := first.GetHistoricalData(ctx, "SPY", "2024-02-01", "2024-03-06", DefaultBarSpec())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A new provider, as after a restart, is served from disk
+	base := &countingProvider{}
+	recorder := &countingRecorder{}
+	restarted := NewCachedDataProvider(cfg, base, recorder)
+	restarted.now = func() time.Time { return now.Add(time.Minute) }
+	got, err := restarted.GetHistoricalData(ctx, "SPY", "2024-02-01", "2024-03-06", DefaultBarSpec())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base.calls != 0 || recorder.diskHits != 1 {
+		t.Errorf("Underlying calls %d and disk hits %d after restart, want 0 and 1", base.calls, recorder.diskHits)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Bars from disk: got %d, want %d", len(got), len(want))
+	}
+	for i := range got {
+		if got[i].Symbol != want[i].Symbol || !got[i].Timestamp.Equal(want[i].Timestamp) || got[i].Close != want[i].Close || got[i].Volume != want[i].Volume {
+			t.Fatalf("Bar %d from disk = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	// Then from memory
+	if _, err := restarted.GetHistoricalData(ctx, "SPY", "2024-02-01", "2024-03-06", DefaultBarSpec()); err != nil {
+		t.Fatal(err)
+	}
+	if recorder.hits != 1 || recorder.diskHits != 1 {
+		t.Errorf("Memory hits %d, disk hits %d; want 1 and 1", recorder.hits, recorder.diskHits)
+	}
+
+	// Today's bars read from disk expire after CacheTTL like those in memory
+	again := NewCachedDataProvider(cfg, base, nil)
+	again.now = func() time.Time { return now.Add(time.Hour) }
+	if _, err := again.GetHistoricalData(ctx, "SPY", "2024-02-01", "2024-03-06", DefaultBarSpec()); err != nil {
+		t.Fatal(err)
+	}
+	if len(base.ranges) != 1 || base.ranges[0] != "2024-03-06..2024-03-06" {
+		t.Errorf("Fetched %v after the TTL, want today only", base.ranges)
+	}
+}
+
+func TestDiskCacheRecoversFromCorruption(t *testing.T) {
+	cfg := diskCacheConfig(t)
+	ctx := context.Background()
+	first := NewCachedDataProvider(cfg, &countingProvider{}, nil)
+	if _, err := first.GetHistoricalData(ctx, "SPY", "2024-01-02", "2024-01-31", DefaultBarSpec()); err != nil {
+		t.Fatal(err)
+	}
+
+	path := first.disk.path("SPY:" + DefaultBarSpec().String())
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-20] ^= 0xff
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The corrupt file is dropped and the bars fetched and written again
+	base := &countingProvider{}
+	recorder := &countingRecorder{}
+	restarted := NewCachedDataProvider(cfg, base, recorder)
+	bars, err := restarted.GetHistoricalData(ctx, "SPY", "2024-01-02", "2024-01-31", DefaultBarSpec())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base.calls != 1 || recorder.misses != 1 || len(bars) != 22 {
+		t.Errorf("Underlying calls %d, misses %d, bars %d; want a single refetch of 22 bars", base.calls, recorder.misses, len(bars))
+	}
+
+	recorder = &countingRecorder{}
+	if _, err := NewCachedDataProvider(cfg, base, recorder).GetHistoricalData(ctx, "SPY", "2024-01-02", "2024-01-31", DefaultBarSpec()); err != nil {
+		t.Fatal(err)
+	}
+	if recorder.diskHits != 1 {
+		t.Errorf("Disk hits after the rewrite: got %d, want 1", recorder.diskHits)
+	}
+}
+
+func TestDiskCacheExpires(t *testing.T) {
+	cfg := diskCacheConfig(t)
+	ctx := context.Background()
+	first := NewCachedDataProvider(cfg, &countingProvider{}, nil)
+	if _, err := first.GetHistoricalData(ctx, "SPY", "2024-01-02", "2024-01-31", DefaultBarSpec()); err != nil {
+		t.Fatal(err)
+	}
+	path := first.disk.path("SPY:" + DefaultBarSpec().String())
+	old := time.Now().Add(-cfg.CacheDiskTTL - time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	base := &countingProvider{}
+	if _, err := NewCachedDataProvider(cfg, base, nil).GetHistoricalData(ctx, "SPY", "2024-01-02", "2024-01-31", DefaultBarSpec()); err != nil {
+		t.Fatal(err)
+	}
+	if base.calls != 1 {
+		t.Errorf("Underlying calls after the disk TTL: got %d, want 1", base.calls)
+	}
+}
+
+func TestDiskCacheCompaction(t *testing.T) {
+	cfg := diskCacheConfig(t)
+	cfg.CacheDiskMaxSegments = 2
+	provider := NewCachedDataProvider(cfg, &countingProvider{}, nil)
+	ctx := context.Background()
+	key := "SPY:" + DefaultBarSpec().String()
+	path := provider.disk.path(key)
+
+	for _, end := range []string{"2024-01-31", "2024-02-29", "2024-03-29"} {
+		if _, err := provider.GetHistoricalData(ctx, "SPY", "2024-01-02", end, DefaultBarSpec()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	written := time.Now().Add(-time.Hour)
+	waitFor(t, "compaction", func() bool {
+		file := provider.disk.file(key)
+		file.mu.Lock()
+		defer file.mu.Unlock()
+		if file.compacting {
+			return false
+		}
+		// Stamp the compacted file to check that compacting again keeps it
+		os.Chtimes(path, written, written)
+		return true
+	})
+
+	segments, err := provider.disk.read(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 1 || segments[0].r.start.Format(dateLayout) != "2024-01-02" || segments[0].r.end.Format(dateLayout) != "2024-03-29" || len(segments[0].bars) != 64 {
+		t.Fatalf("Compacted into %d segments, want one of the 64 bars from 2024-01-02 to 2024-03-29", len(segments))
+	}
+
+	if err := provider.disk.append(key, diskSegment{written: time.Now(), r: dateRange{start: segments[0].r.end.AddDate(0, 0, 1), end: segments[0].r.end.AddDate(0, 0, 1)}}); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(path, written, written)
+	if err := provider.disk.compact(key); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || !info.ModTime().Equal(written) {
+		t.Errorf("Compaction changed the modification time to %v, want %v", info.ModTime(), written)
+	}
+}
+
+func TestDiskSegmentKeepsUTCOffset(t *testing.T) {
+	newYork := newYorkLocation()
+	bar := MarketData{Timestamp: time.Date(2024, 3, 6, 0, 0, 0, 0, newYork), Open: 1, High: 2, Low: 0.5, Close: 1.5, Volume: 7, Session: SessionRegular}
+	segment := diskSegment{written: time.Now(), r: dateRange{start: barDate(bar.Timestamp), end: barDate(bar.Timestamp)}, bars: []MarketData{bar}}
+
+	dir := t.TempDir()
+	disk, err := newDiskCache(dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := disk.append("SPY:1day:TRADES", segment); err != nil {
+		t.Fatal(err)
+	}
+	segments := disk.load("SPY:1day:TRADES", time.Now())
+	if len(segments) != 1 || len(segments[0].bars) != 1 {
+		t.Fatalf("Loaded %+v, want the bar back", segments)
+	}
+	got := segments[0].bars[0]
+	if !got.Timestamp.Equal(bar.Timestamp) || !barDate(got.Timestamp).Equal(barDate(bar.Timestamp)) || got.Symbol != "SPY" || got.High != 2 || got.Volume != 7 || got.Session != SessionRegular {
+		t.Errorf("Loaded bar %+v, want %+v dated 2024-03-06", got, bar)
+	}
+}
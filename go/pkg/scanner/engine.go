@@ -0,0 +1,175 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// Start runs the engine's background work until Stop is called or ctx is
+// done, as the scanner binary does: the memory guard from the start and, once
+// the data provider answers or the wait for it gives up, scheduled scans and
+// the cache warm-up when enabled. Starting a started engine does nothing.
+func (s *Engine) Start(ctx context.Context) {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+	if s.stopRun != nil {
+		return
+	}
+	ctx, s.stopRun = context.WithCancel(ctx)
+
+	cfg := s.Config()
+	ready := s.AwaitDataProvider(ctx)
+	if cfg.MemoryCheckInterval > 0 {
+		s.running.Add(1)
+		go func() {
+			defer s.running.Done()
+			s.RunMemoryGuard(ctx, cfg.MemoryCheckInterval)
+		}()
+	}
+
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		if err := <-ready; err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logrus.Errorf("Starting without the data provider: %v", err)
+		}
+		if cfg.WarmupEnabled {
+			s.running.Add(1)
+			go func() {
+				defer s.running.Done()
+				s.Warmup(ctx, func() {})
+			}()
+		}
+		s.RunScheduler(ctx)
+	}()
+}
+
+// Stop stops the background work of Start and waits for the scheduler, the
+// memory guard and the warm-up to return. A scheduled scan in flight is
+// cancelled but not waited for.
+func (s *Engine) Stop() {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+	if s.stopRun == nil {
+		return
+	}
+	s.stopRun()
+	s.running.Wait()
+	s.stopRun = nil
+}
+
+// Client returns a client calling the engine in-process, for programs that
+// embed the scanner rather than dialing it. Requests and responses are copied
+// as they would be over the network and errors carry gRPC status codes, so
+// code written against a remote scanner behaves the same. The streaming RPCs
+// are not available in-process and fail with UNIMPLEMENTED.
+func (s *Engine) Client() pb.ScannerServiceClient {
+	return inProcessClient{engine: s}
+}
+
+// inProcessClient calls an engine's RPC methods directly
+type inProcessClient struct {
+	engine *Engine
+}
+
+// callInProcess calls method with a copy of req and returns a copy of its
+// response, or its error as a gRPC status
+func callInProcess[Req, Resp proto.Message](ctx context.Context, req Req, method func(context.Context, Req) (Resp, error)) (Resp, error) {
+	resp, err := method(ctx, proto.Clone(req).(Req))
+	if err != nil {
+		var zero Resp
+		return zero, inProcessError(err)
+	}
+	return proto.Clone(resp).(Resp), nil
+}
+
+// inProcessError converts err as a gRPC server would: context errors to
+// CANCELLED or DEADLINE_EXCEEDED and errors without a status to UNKNOWN
+func inProcessError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+	return status.Error(codes.Unknown, err.Error())
+}
+
+func (c inProcessClient) Scan(ctx context.Context, in *pb.ScanRequest, opts ...grpc.CallOption) (*pb.ScanResponse, error) {
+	return callInProcess(ctx, in, c.engine.Scan)
+}
+
+func (c inProcessClient) BulkFetch(ctx context.Context, in *pb.BulkFetchRequest, opts ...grpc.CallOption) (*pb.BulkFetchResponse, error) {
+	return callInProcess(ctx, in, c.engine.BulkFetch)
+}
+
+func (c inProcessClient) BulkFetchStream(ctx context.Context, in *pb.BulkFetchRequest, opts ...grpc.CallOption) (pb.ScannerService_BulkFetchStreamClient, error) {
+	return nil, status.Error(codes.Unimplemented, "BulkFetchStream is not available in-process, use BulkFetch")
+}
+
+func (c inProcessClient) GetMetrics(ctx context.Context, in *pb.MetricsRequest, opts ...grpc.CallOption) (*pb.MetricsResponse, error) {
+	return callInProcess(ctx, in, c.engine.GetMetrics)
+}
+
+func (c inProcessClient) GetScanResults(ctx context.Context, in *pb.ResultsRequest, opts ...grpc.CallOption) (*pb.ScanResponse, error) {
+	return callInProcess(ctx, in, c.engine.GetScanResults)
+}
+
+func (c inProcessClient) GetScanHistory(ctx context.Context, in *pb.ScanHistoryRequest, opts ...grpc.CallOption) (*pb.ScanHistoryResponse, error) {
+	return callInProcess(ctx, in, c.engine.GetScanHistory)
+}
+
+func (c inProcessClient) ExportResults(ctx context.Context, in *pb.ExportRequest, opts ...grpc.CallOption) (*pb.ExportResponse, error) {
+	return callInProcess(ctx, in, c.engine.ExportResults)
+}
+
+func (c inProcessClient) Backtest(ctx context.Context, in *pb.BacktestRequest, opts ...grpc.CallOption) (pb.ScannerService_BacktestClient, error) {
+	return nil, status.Error(codes.Unimplemented, "Backtest is not available in-process")
+}
+
+func (c inProcessClient) GetSymbolHealth(ctx context.Context, in *pb.SymbolHealthRequest, opts ...grpc.CallOption) (*pb.SymbolHealthResponse, error) {
+	return callInProcess(ctx, in, c.engine.GetSymbolHealth)
+}
+
+func (c inProcessClient) ResetSymbolHealth(ctx context.Context, in *pb.ResetSymbolHealthRequest, opts ...grpc.CallOption) (*pb.ResetSymbolHealthResponse, error) {
+	return callInProcess(ctx, in, c.engine.ResetSymbolHealth)
+}
+
+func (c inProcessClient) ListProfiles(ctx context.Context, in *pb.ListProfilesRequest, opts ...grpc.CallOption) (*pb.ListProfilesResponse, error) {
+	return callInProcess(ctx, in, c.engine.ListProfiles)
+}
+
+func (c inProcessClient) ListStrategies(ctx context.Context, in *pb.ListStrategiesRequest, opts ...grpc.CallOption) (*pb.ListStrategiesResponse, error) {
+	return callInProcess(ctx, in, c.engine.ListStrategies)
+}
+
+func (c inProcessClient) GetAuditLog(ctx context.Context, in *pb.AuditLogRequest, opts ...grpc.CallOption) (*pb.AuditLogResponse, error) {
+	return callInProcess(ctx, in, c.engine.GetAuditLog)
+}
+
+func (c inProcessClient) GetEffectiveConfig(ctx context.Context, in *pb.EffectiveConfigRequest, opts ...grpc.CallOption) (*pb.EffectiveConfigResponse, error) {
+	return callInProcess(ctx, in, c.engine.GetEffectiveConfig)
+}
+
+func (c inProcessClient) GetVersion(ctx context.Context, in *pb.VersionRequest, opts ...grpc.CallOption) (*pb.VersionResponse, error) {
+	return callInProcess(ctx, in, c.engine.GetVersion)
+}
+
+func (c inProcessClient) GetDataQuality(ctx context.Context, in *pb.DataQualityRequest, opts ...grpc.CallOption) (*pb.DataQualityResponse, error) {
+	return callInProcess(ctx, in, c.engine.GetDataQuality)
+}
+
+func (c inProcessClient) GetSymbolMetadata(ctx context.Context, in *pb.SymbolMetadataRequest, opts ...grpc.CallOption) (*pb.SymbolMetadataResponse, error) {
+	return callInProcess(ctx, in, c.engine.GetSymbolMetadata)
+}
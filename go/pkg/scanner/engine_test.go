@@ -0,0 +1,156 @@
+package scanner
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+	"github.com/trustdan/ibkr-trader/go/pkg/scannerclient"
+	"github.com/trustdan/ibkr-trader/go/pkg/universe"
+)
+
+// newTestEngine returns an engine fetching the seeded mock data, cached
+func newTestEngine(t *testing.T) *Engine {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.EventCalendarType = "none"
+	cfg.MetadataFile = "../metadata/testdata/metadata.csv"
+	return NewEngine(cfg, NewMockDataProvider(cfg), prometheus.NewRegistry())
+}
+
+func TestEngineInProcessMatchesGRPC(t *testing.T) {
+	engine := newTestEngine(t)
+	remote := dialTestServer(t, NewEngineService(engine))
+	local := engine.Client()
+	ctx := context.Background()
+
+	scan := &pb.ScanRequest{
+		Symbols:    []string{"AAPL", "MSFT", "SPY", "QQQ", "TSLA", "NVDA"},
+		DateRange:  &pb.DateRange{StartDate: "2023-06-01", EndDate: "2024-06-28"},
+		MaxResults: 5,
+	}
+	viaGRPC, err := remote.Scan(ctx, scan)
+	if err != nil {
+		t.Fatalf("Scan over gRPC failed: %v", err)
+	}
+	inProcess, err := local.Scan(ctx, scan)
+	if err != nil {
+		t.Fatalf("Scan in-process failed: %v", err)
+	}
+	viaGRPC.ScanTimeSeconds, inProcess.ScanTimeSeconds = 0, 0
+	if !proto.Equal(viaGRPC, inProcess) {
+		t.Errorf("Scan responses differ:\ngRPC:       %v\nin-process: %v", viaGRPC, inProcess)
+	}
+
+	fetch := &pb.BulkFetchRequest{Symbols: []string{"AAPL", "SPY"}, DateRange: testDateRange()}
+	fetchedGRPC, err := remote.BulkFetch(ctx, fetch)
+	if err != nil {
+		t.Fatalf("BulkFetch over gRPC failed: %v", err)
+	}
+	fetchedInProcess, err := local.BulkFetch(ctx, fetch)
+	if err != nil {
+		t.Fatalf("BulkFetch in-process failed: %v", err)
+	}
+	fetchedGRPC.FetchTimeSeconds, fetchedInProcess.FetchTimeSeconds = 0, 0
+	if !proto.Equal(fetchedGRPC, fetchedInProcess) {
+		t.Error("BulkFetch responses differ between gRPC and in-process")
+	}
+
+	// The Go client wraps either the same way
+	dateRange := scannerclient.DateRange{Start: time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC), End: time.Date(2024, 6, 28, 0, 0, 0, 0, time.UTC)}
+	wrappedGRPC, err := scannerclient.NewServiceClient(remote).Scan(ctx, scan.Symbols, nil, dateRange)
+	if err != nil {
+		t.Fatalf("scannerclient Scan over gRPC failed: %v", err)
+	}
+	wrappedInProcess, err := scannerclient.NewServiceClient(local).Scan(ctx, scan.Symbols, nil, dateRange)
+	if err != nil {
+		t.Fatalf("scannerclient Scan in-process failed: %v", err)
+	}
+	wrappedGRPC.Duration, wrappedInProcess.Duration = 0, 0
+	if !reflect.DeepEqual(wrappedGRPC, wrappedInProcess) {
+		t.Errorf("scannerclient results differ:\ngRPC:       %+v\nin-process: %+v", wrappedGRPC, wrappedInProcess)
+	}
+
+	// Failures carry the same status codes
+	for _, req := range []*pb.ScanRequest{
+		{Symbols: []string{"AAPL"}, Strategies: []string{"NOPE"}, DateRange: testDateRange()},
+		{Symbols: []string{"AAPL"}},
+	} {
+		_, remoteErr := remote.Scan(ctx, req)
+		_, localErr := local.Scan(ctx, req)
+		if remoteErr == nil || status.Code(remoteErr) != status.Code(localErr) {
+			t.Errorf("Scan(%v) failed with %v over gRPC and %v in-process", req, remoteErr, localErr)
+		}
+	}
+	if _, err := local.BulkFetchStream(ctx, fetch); status.Code(err) != codes.Unimplemented {
+		t.Errorf("BulkFetchStream in-process = %v, want UNIMPLEMENTED", err)
+	}
+}
+
+func TestEngineInProcessCopiesMessages(t *testing.T) {
+	engine := newTestEngine(t)
+	local := engine.Client()
+	ctx := context.Background()
+
+	if _, err := local.Scan(ctx, &pb.ScanRequest{Symbols: []string{"AAPL", "SPY"}, DateRange: testDateRange()}); err != nil {
+		t.Fatal(err)
+	}
+	results, err := local.GetScanResults(ctx, &pb.ResultsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Changing a response leaves the engine's latest scan alone
+	results.Errors = map[string]string{"AAPL": "changed"}
+	again, err := local.GetScanResults(ctx, &pb.ResultsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Errors["AAPL"] == "changed" {
+		t.Error("Response shares the engine's latest scan")
+	}
+}
+
+func TestEngineStartStop(t *testing.T) {
+	dir := t.TempDir()
+	if err := universe.New([]string{"AAPL", "MSFT"}).SaveCache(dir); err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig()
+	cfg.CacheEnabled = false
+	cfg.EventCalendarType = "none"
+	cfg.UniverseCacheDir = dir
+	cfg.UniverseCacheExpiry = 0
+	cfg.ScanInterval = 10 * time.Millisecond
+	cfg.ScanStrategies = []string{"HIGH_BASE"}
+	cfg.ScanTradingHoursStart = ""
+	cfg.ScanTradingHoursEnd = ""
+	provider := &gatedProvider{}
+	engine := NewEngine(cfg, provider, prometheus.NewRegistry())
+
+	engine.Start(context.Background())
+	engine.Start(context.Background())
+	waitFor(t, "scheduled scans", func() bool { return provider.calls.Load() >= 4 })
+	engine.Stop()
+	engine.Stop()
+
+	// A scan in flight at Stop may still fetch, but no other scan starts
+	time.Sleep(50 * time.Millisecond)
+	stopped := provider.calls.Load()
+	time.Sleep(50 * time.Millisecond)
+	if calls := provider.calls.Load(); calls != stopped {
+		t.Errorf("Provider calls after Stop: got %d, want %d", calls, stopped)
+	}
+
+	// A stopped engine starts again
+	engine.Start(context.Background())
+	defer engine.Stop()
+	waitFor(t, "scans after a restart", func() bool { return provider.calls.Load() > stopped })
+}
@@ -0,0 +1,182 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// chaosPrefix starts a DataProviderType whose provider, named after the
+// prefix, is wrapped in a FaultInjectingDataProvider
+const chaosPrefix = "chaos:"
+
+// Faults a FaultInjectingDataProvider injects, the fault label of
+// scanner_injected_faults_total
+const (
+	FaultError   = "error"
+	FaultTimeout = "timeout"
+	FaultSymbol  = "symbol"
+)
+
+// ErrInjectedFault is wrapped by every error a FaultInjectingDataProvider
+// injects, so they can be told apart from the provider's own
+var ErrInjectedFault = errors.New("injected fault")
+
+// FaultRecorder counts the faults injected in front of a data provider
+type FaultRecorder interface {
+	RecordInjectedFault(provider, fault string)
+}
+
+// FaultInjectingDataProvider wraps a data provider for testing, failing
+// fetches at random, stalling them past the symbol timeout and delaying the
+// rest. Symbols of ChaosFailSymbols always fail. Each injected fault is
+// logged with the injected_fault field and counted by the recorder.
+type FaultInjectingDataProvider struct {
+	provider DataProvider
+	name     string
+	recorder FaultRecorder
+
+	errorRate   float64
+	timeoutRate float64
+	timeout     time.Duration
+	latency     time.Duration
+	jitter      time.Duration
+	failSymbols []string
+
+	mu  sync.Mutex
+	rng *rand.Rand
+
+	// sleep waits for d or until ctx is done; replaced in tests
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewFaultInjectingDataProvider wraps provider, named name, in the faults
+// of cfg's chaos settings, counting them with recorder, which may be nil. A
+// zero ChaosSeed seeds the faults from the clock.
+func NewFaultInjectingDataProvider(cfg *Config, provider DataProvider, name string, recorder FaultRecorder) *FaultInjectingDataProvider {
+	seed := cfg.ChaosSeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	failSymbols := make([]string, len(cfg.ChaosFailSymbols))
+	for i, symbol := range cfg.ChaosFailSymbols {
+		failSymbols[i] = strings.ToUpper(strings.TrimSpace(symbol))
+	}
+	return &FaultInjectingDataProvider{
+		provider:    provider,
+		name:        name,
+		recorder:    recorder,
+		errorRate:   cfg.ChaosErrorRate,
+		timeoutRate: cfg.ChaosTimeoutRate,
+		timeout:     cfg.SymbolTimeout,
+		latency:     cfg.ChaosLatency,
+		jitter:      cfg.ChaosJitter,
+		failSymbols: failSymbols,
+		rng:         rand.New(rand.NewSource(seed)),
+		sleep:       sleepContext,
+	}
+}
+
+// GetHistoricalData fetches from the wrapped provider unless a fault is
+// injected, after the added latency
+func (p *FaultInjectingDataProvider) GetHistoricalData(ctx context.Context, symbol, startDate, endDate string, spec BarSpec) ([]MarketData, error) {
+	fault, delay := p.draw(symbol)
+	switch fault {
+	case FaultSymbol:
+		return nil, p.inject(fault, symbol, nil)
+	case FaultTimeout:
+		// Stall past the symbol timeout, returning once the caller gives up
+		err := p.sleep(ctx, p.timeout+time.Second)
+		if err == nil {
+			err = context.DeadlineExceeded
+		}
+		return nil, p.inject(fault, symbol, err)
+	}
+
+	if err := p.sleep(ctx, delay); err != nil {
+		return nil, err
+	}
+	if fault == FaultError {
+		return nil, p.inject(fault, symbol, nil)
+	}
+	return p.provider.GetHistoricalData(ctx, symbol, startDate, endDate, spec)
+}
+
+// NormalizeSymbol names symbol as the wrapped provider does
+func (p *FaultInjectingDataProvider) NormalizeSymbol(symbol string) (string, error) {
+	return NormalizeSymbol(p.provider, symbol)
+}
+
+// GetCorporateActions returns the wrapped provider's corporate actions, which
+// faults are not injected into
+func (p *FaultInjectingDataProvider) GetCorporateActions(ctx context.Context, symbol, startDate, endDate string) ([]CorporateAction, error) {
+	return GetCorporateActions(ctx, p.provider, symbol, startDate, endDate)
+}
+
+// ProbeHealth probes the wrapped provider, which faults are not injected
+// into
+func (p *FaultInjectingDataProvider) ProbeHealth(ctx context.Context) error {
+	return ProbeHealth(ctx, p.provider)
+}
+
+// draw picks the fault of a fetch of symbol, "" for none, and the latency
+// added to it
+func (p *FaultInjectingDataProvider) draw(symbol string) (fault string, delay time.Duration) {
+	if slices.Contains(p.failSymbols, strings.ToUpper(symbol)) {
+		return FaultSymbol, 0
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delay = p.latency
+	if p.jitter > 0 {
+		delay += time.Duration(p.rng.Int63n(int64(p.jitter) + 1))
+	}
+	switch roll := p.rng.Float64(); {
+	case roll < p.timeoutRate:
+		fault = FaultTimeout
+	case roll < p.timeoutRate+p.errorRate:
+		fault = FaultError
+	}
+	return fault, delay
+}
+
+// inject logs and counts a fault and returns its error, wrapping cause when
+// there is one
+func (p *FaultInjectingDataProvider) inject(fault, symbol string, cause error) error {
+	logrus.WithFields(logrus.Fields{
+		"injected_fault": true,
+		"fault":          fault,
+		"provider":       p.name,
+		"symbol":         symbol,
+	}).Warn("Injected data provider fault")
+	if p.recorder != nil {
+		p.recorder.RecordInjectedFault(p.name, fault)
+	}
+	if cause != nil {
+		return fmt.Errorf("%w: %s fetching %s: %w", ErrInjectedFault, fault, symbol, cause)
+	}
+	return fmt.Errorf("%w: %s fetching %s", ErrInjectedFault, fault, symbol)
+}
+
+// sleepContext waits for d, or returns the error of ctx when it is done first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,165 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// chaosConfig returns a config injecting faults at the given rates with a
+// fixed seed
+func chaosConfig(errorRate, timeoutRate float64) *Config {
+	cfg := DefaultConfig()
+	cfg.ChaosErrorRate = errorRate
+	cfg.ChaosTimeoutRate = timeoutRate
+	cfg.ChaosSeed = 42
+	return cfg
+}
+
+// recordSleeps makes p record the delays it would sleep instead of sleeping
+func recordSleeps(p *FaultInjectingDataProvider) *[]time.Duration {
+	sleeps := &[]time.Duration{}
+	p.sleep = func(ctx context.Context, d time.Duration) error {
+		*sleeps = append(*sleeps, d)
+		return nil
+	}
+	return sleeps
+}
+
+func TestFaultInjectionRates(t *testing.T) {
+	cfg := chaosConfig(0.2, 0.1)
+	cfg.ChaosLatency = 10 * time.Millisecond
+	cfg.ChaosJitter = 5 * time.Millisecond
+	base := &countingProvider{}
+	provider := NewFaultInjectingDataProvider(cfg, base, "mock", nil)
+	sleeps := recordSleeps(provider)
+
+	const n = 10000
+	var errs, timeouts int
+	for i := 0; i < n; i++ {
+		_, err := provider.GetHistoricalData(context.Background(), "SPY", "2024-01-02", "2024-01-05", DefaultBarSpec())
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			timeouts++
+		case err != nil:
+			errs++
+		}
+		if err != nil && !errors.Is(err, ErrInjectedFault) {
+			t.Fatalf("GetHistoricalData error = %v, want an injected fault", err)
+		}
+	}
+
+	// Binomial standard deviations are 0.004 and 0.003; allow about five
+	if rate := float64(errs) / n; math.Abs(rate-0.2) > 0.02 {
+		t.Errorf("Error rate = %.3f, want 0.2", rate)
+	}
+	if rate := float64(timeouts) / n; math.Abs(rate-0.1) > 0.015 {
+		t.Errorf("Timeout rate = %.3f, want 0.1", rate)
+	}
+	if base.calls != n-errs-timeouts {
+		t.Errorf("Provider called %d times, want %d without a fault", base.calls, n-errs-timeouts)
+	}
+
+	var total time.Duration
+	var delays int
+	for _, d := range *sleeps {
+		if d == cfg.SymbolTimeout+time.Second {
+			continue
+		}
+		if d < 10*time.Millisecond || d > 15*time.Millisecond {
+			t.Fatalf("Added latency %v outside 10ms to 15ms", d)
+		}
+		total += d
+		delays++
+	}
+	if delays != n-timeouts {
+		t.Errorf("Delayed %d fetches, want %d", delays, n-timeouts)
+	}
+	if mean := total / time.Duration(delays); mean < 12400*time.Microsecond || mean > 12600*time.Microsecond {
+		t.Errorf("Mean latency = %v, want 12.5ms", mean)
+	}
+}
+
+func TestFaultInjectionIsSeeded(t *testing.T) {
+	faults := func() []bool {
+		provider := NewFaultInjectingDataProvider(chaosConfig(0.5, 0), &countingProvider{}, "mock", nil)
+		recordSleeps(provider)
+		var failed []bool
+		for i := 0; i < 100; i++ {
+			_, err := provider.GetHistoricalData(context.Background(), "SPY", "2024-01-02", "2024-01-05", DefaultBarSpec())
+			failed = append(failed, err != nil)
+		}
+		return failed
+	}
+
+	first, second := faults(), faults()
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("Fetch %d failed in one run but not the other with the same seed", i)
+		}
+	}
+}
+
+func TestFaultInjectionFailSymbols(t *testing.T) {
+	cfg := chaosConfig(0, 0)
+	cfg.ChaosFailSymbols = []string{"tsla", " NVDA "}
+	base := &countingProvider{}
+	provider := NewFaultInjectingDataProvider(cfg, base, "mock", nil)
+
+	for i := 0; i < 50; i++ {
+		for _, symbol := range []string{"TSLA", "nvda"} {
+			if _, err := provider.GetHistoricalData(context.Background(), symbol, "2024-01-02", "2024-01-05", DefaultBarSpec()); !errors.Is(err, ErrInjectedFault) {
+				t.Fatalf("GetHistoricalData(%s) error = %v, want an injected fault", symbol, err)
+			}
+		}
+		if _, err := provider.GetHistoricalData(context.Background(), "SPY", "2024-01-02", "2024-01-05", DefaultBarSpec()); err != nil {
+			t.Fatalf("GetHistoricalData(SPY) error = %v", err)
+		}
+	}
+	if base.calls != 50 {
+		t.Errorf("Provider called %d times, want only for SPY", base.calls)
+	}
+}
+
+func TestFaultInjectionTimeoutStallsUntilTheSymbolTimeout(t *testing.T) {
+	cfg := chaosConfig(0, 1)
+	cfg.SymbolTimeout = 50 * time.Millisecond
+	provider := NewFaultInjectingDataProvider(cfg, &countingProvider{}, "mock", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.SymbolTimeout)
+	defer cancel()
+	started := time.Now()
+	_, err := provider.GetHistoricalData(ctx, "SPY", "2024-01-02", "2024-01-05", DefaultBarSpec())
+	if !errors.Is(err, ErrInjectedFault) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetHistoricalData error = %v, want an injected deadline exceeded", err)
+	}
+	if elapsed := time.Since(started); elapsed < cfg.SymbolTimeout || elapsed > time.Second {
+		t.Errorf("Stalled for %v, want until the symbol timeout of %v", elapsed, cfg.SymbolTimeout)
+	}
+}
+
+func TestChaosDataProviderType(t *testing.T) {
+	cfg := chaosConfig(0, 0)
+	cfg.DataProviderType = "chaos:mock"
+	cfg.CacheEnabled = false
+	cfg.ChaosFailSymbols = []string{"TSLA"}
+	tracker := NewMetricTracker(prometheus.NewRegistry())
+	provider := NewDataProvider(cfg, tracker)
+
+	for _, symbol := range []string{"TSLA", "TSLA", "SPY"} {
+		provider.GetHistoricalData(context.Background(), symbol, "2024-01-02", "2024-01-05", DefaultBarSpec())
+	}
+	if n := testutil.ToFloat64(tracker.injectedFaults.WithLabelValues("mock", FaultSymbol)); n != 2 {
+		t.Errorf("scanner_injected_faults_total{provider=mock,fault=symbol} = %v, want 2", n)
+	}
+	// Injected faults are not the provider's errors
+	providers := tracker.GetMetrics().Providers
+	if len(providers) != 1 || providers[0].Name != "mock" || providers[0].Fetches != 1 || providers[0].Errors != 0 {
+		t.Errorf("Provider metrics = %+v, want one fetch from mock without errors", providers)
+	}
+}
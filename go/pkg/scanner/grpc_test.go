@@ -0,0 +1,107 @@
+package scanner
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// dialTestServer serves the scanner over an in-memory listener and returns a
+// generated client connected to it
+func dialTestServer(t *testing.T, service *ScannerService) pb.ScannerServiceClient {
+	t.Helper()
+	return dialTestServerWithOptions(t, service, nil)
+}
+
+// dialTestServerWithOptions is dialTestServer with extra server and dial options
+func dialTestServerWithOptions(t *testing.T, service pb.ScannerServiceServer, serverOptions []grpc.ServerOption, dialOptions ...grpc.DialOption) pb.ScannerServiceClient {
+	t.Helper()
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(serverOptions...)
+	pb.RegisterScannerServiceServer(server, service)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	dialOptions = append([]grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}, dialOptions...)
+	conn, err := grpc.DialContext(context.Background(), "bufnet", dialOptions...)
+	if err != nil {
+		t.Fatalf("Failed to dial bufconn: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return pb.NewScannerServiceClient(conn)
+}
+
+func TestScanOverGRPC(t *testing.T) {
+	client := dialTestServer(t, newTestService(t))
+	ctx := context.Background()
+
+	resp, err := client.Scan(ctx, &pb.ScanRequest{
+		Symbols:    []string{"AAPL", "XOM"},
+		Strategies: []string{"HIGH_BASE"},
+		DateRange:  testDateRange(),
+	})
+	if err != nil {
+		t.Fatalf("Scan RPC failed: %v", err)
+	}
+
+	aapl := resp.GetSignals()["AAPL"]
+	if len(resp.GetSignals()) != 2 || aapl.GetSector() != "Technology" {
+		t.Fatalf("Unexpected scan response: %v", resp)
+	}
+	if got := aapl.GetSignalTypes(); len(got) != 1 || got[0] != "LONG" {
+		t.Errorf("AAPL signals: got %v, want [LONG]", got)
+	}
+
+	results, err := client.GetScanResults(ctx, &pb.ResultsRequest{Limit: 1})
+	if err != nil {
+		t.Fatalf("GetScanResults RPC failed: %v", err)
+	}
+	if len(results.GetSignals()) != 1 || results.GetSignals()["AAPL"] == nil {
+		t.Errorf("Unexpected latest results: %v", results)
+	}
+
+	metrics, err := client.GetMetrics(ctx, &pb.MetricsRequest{})
+	if err != nil {
+		t.Fatalf("GetMetrics RPC failed: %v", err)
+	}
+	if metrics.GetTotalScans() != 1 {
+		t.Errorf("TotalScans: got %d, want 1", metrics.GetTotalScans())
+	}
+}
+
+func TestScanOverGRPCReportsErrors(t *testing.T) {
+	client := dialTestServer(t, newTestService(t))
+
+	if _, err := client.Scan(context.Background(), &pb.ScanRequest{Symbols: []string{"AAPL"}}); err == nil {
+		t.Error("Expected error for scan without a date range")
+	}
+}
+
+func TestScanOverGRPCRejectsUnsupportedBars(t *testing.T) {
+	client := dialTestServer(t, newTestService(t))
+
+	_, err := client.Scan(context.Background(), &pb.ScanRequest{
+		Symbols:    []string{"AAPL"},
+		DateRange:  testDateRange(),
+		BarSize:    BarSize1Min,
+		WhatToShow: WhatToShowOptionImpliedVolatility,
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument, got %v", err)
+	}
+}
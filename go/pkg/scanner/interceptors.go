@@ -0,0 +1,160 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// symbolRequest is implemented by requests that carry a symbol list
+type symbolRequest interface {
+	GetSymbols() []string
+}
+
+// RecoveryInterceptor turns a panic in a handler into an Internal error so a
+// single bad request cannot take down the scanner
+func RecoveryInterceptor(metrics *MetricTracker) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				logrus.WithFields(logrus.Fields{
+					"method": info.FullMethod,
+					"panic":  r,
+					"stack":  string(debug.Stack()),
+				}).Error("Recovered from panic in RPC handler")
+				if metrics != nil {
+					metrics.IncrementErrorCount()
+				}
+				resp, err = nil, status.Errorf(codes.Internal, "internal error in %s", info.FullMethod)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// StreamRecoveryInterceptor is RecoveryInterceptor for streaming RPCs
+func StreamRecoveryInterceptor(metrics *MetricTracker) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				logrus.WithFields(logrus.Fields{
+					"method": info.FullMethod,
+					"panic":  r,
+					"stack":  string(debug.Stack()),
+				}).Error("Recovered from panic in RPC handler")
+				if metrics != nil {
+					metrics.IncrementErrorCount()
+				}
+				err = status.Errorf(codes.Internal, "internal error in %s", info.FullMethod)
+			}
+		}()
+		return handler(srv, ss)
+	}
+}
+
+// LoggingInterceptor logs every RPC with its method, peer, symbol count,
+// duration and status code. Failed calls are always logged at Warn; successful
+// calls are logged at Info for one in every sampleEvery calls.
+func LoggingInterceptor(sampleEvery int) grpc.UnaryServerInterceptor {
+	if sampleEvery < 1 {
+		sampleEvery = 1
+	}
+	var calls atomic.Uint64
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		if status.Code(err) != codes.OK || calls.Add(1)%uint64(sampleEvery) == 0 {
+			logRPC(ctx, info.FullMethod, req, start, err)
+		}
+		return resp, err
+	}
+}
+
+// StreamLoggingInterceptor is LoggingInterceptor for streaming RPCs, which it
+// logs once the stream ends with the symbol count of the request received
+func StreamLoggingInterceptor(sampleEvery int) grpc.StreamServerInterceptor {
+	if sampleEvery < 1 {
+		sampleEvery = 1
+	}
+	var calls atomic.Uint64
+
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		stream := &loggedStream{ServerStream: ss}
+		err := handler(srv, stream)
+		if status.Code(err) != codes.OK || calls.Add(1)%uint64(sampleEvery) == 0 {
+			logRPC(ss.Context(), info.FullMethod, stream.req, start, err)
+		}
+		return err
+	}
+}
+
+// logRPC logs a finished RPC of method started at start
+func logRPC(ctx context.Context, method string, req interface{}, start time.Time, err error) {
+	fields := logrus.Fields{
+		"method":   method,
+		"duration": time.Since(start),
+		"code":     status.Code(err).String(),
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		fields["peer"] = p.Addr.String()
+	}
+	if r, ok := req.(symbolRequest); ok {
+		fields["symbols"] = len(r.GetSymbols())
+	}
+
+	entry := logrus.WithFields(fields)
+	if err != nil {
+		entry.WithError(err).Warn("RPC failed")
+	} else {
+		entry.Info("RPC completed")
+	}
+}
+
+// loggedStream is the stream of a logged streaming call; it keeps the request
+type loggedStream struct {
+	grpc.ServerStream
+	req interface{}
+}
+
+func (s *loggedStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil && s.req == nil {
+		s.req = m
+	}
+	return err
+}
+
+// panicCollector carries a panic from a worker goroutine back to the goroutine
+// serving the RPC, where RecoveryInterceptor can turn it into an error. A panic
+// in a bare goroutine would otherwise terminate the process.
+type panicCollector struct {
+	once  sync.Once
+	value interface{}
+}
+
+// capture records the first panic of a worker; defer it directly
+func (p *panicCollector) capture() {
+	if r := recover(); r != nil {
+		p.once.Do(func() {
+			p.value = fmt.Sprintf("%v\n%s", r, debug.Stack())
+		})
+	}
+}
+
+// repanic re-raises a captured panic once all workers have finished
+func (p *panicCollector) repanic() {
+	if p.value != nil {
+		panic(p.value)
+	}
+}
@@ -0,0 +1,78 @@
+package scanner
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// panickingProvider panics while fetching, inside a scan worker goroutine
+type panickingProvider struct{}
+
+func (panickingProvider) GetHistoricalData(ctx context.Context, symbol, startDate, endDate string, spec BarSpec) ([]MarketData, error) {
+	panic("data provider blew up for " + symbol)
+}
+
+func TestRecoveryInterceptorReturnsInternal(t *testing.T) {
+	service := newTestService(t)
+	service.deps.dataProvider = panickingProvider{}
+
+	options, err := ServerOptions(DefaultConfig(), service.Metrics())
+	if err != nil {
+		t.Fatalf("ServerOptions failed: %v", err)
+	}
+	client := dialTestServerWithOptions(t, service, options)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		_, err := client.Scan(ctx, &pb.ScanRequest{Symbols: []string{"AAPL", "MSFT"}, DateRange: testDateRange()})
+		if status.Code(err) != codes.Internal {
+			t.Fatalf("Call %d: expected Internal, got %v", i, err)
+		}
+	}
+
+	metrics, err := client.GetMetrics(ctx, &pb.MetricsRequest{})
+	if err != nil {
+		t.Fatalf("Server should keep serving after a panic: %v", err)
+	}
+	if metrics.GetErrorCount() != 2 {
+		t.Errorf("ErrorCount: got %d, want 2", metrics.GetErrorCount())
+	}
+}
+
+func TestStreamRecoveryInterceptorReturnsInternal(t *testing.T) {
+	service := newTestService(t)
+	service.deps.dataProvider = panickingProvider{}
+
+	options, err := ServerOptions(DefaultConfig(), service.Metrics())
+	if err != nil {
+		t.Fatalf("ServerOptions failed: %v", err)
+	}
+	client := dialTestServerWithOptions(t, service, options)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		stream, err := client.BulkFetchStream(ctx, &pb.BulkFetchRequest{Symbols: []string{"AAPL", "MSFT"}, DateRange: testDateRange()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for err == nil {
+			_, err = stream.Recv()
+		}
+		if status.Code(err) != codes.Internal {
+			t.Fatalf("Stream %d: expected Internal, got %v", i, err)
+		}
+	}
+
+	metrics, err := client.GetMetrics(ctx, &pb.MetricsRequest{})
+	if err != nil {
+		t.Fatalf("Server should keep serving after a panic: %v", err)
+	}
+	if metrics.GetErrorCount() != 2 {
+		t.Errorf("ErrorCount: got %d, want 2", metrics.GetErrorCount())
+	}
+}
@@ -0,0 +1,63 @@
+package scanner
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// connLimitListener bounds the connections open at once, closing those
+// accepted beyond the limit
+type connLimitListener struct {
+	net.Listener
+	limit   int64
+	open    atomic.Int64
+	metrics *MetricTracker
+}
+
+// LimitListener wraps listener so that at most limit connections are open at
+// once, 0 for no limit. A connection accepted beyond the limit is closed at
+// once, which clients see as the scanner being unavailable. The open
+// connections are reported to metrics.
+func LimitListener(listener net.Listener, limit int, metrics *MetricTracker) net.Listener {
+	return &connLimitListener{Listener: listener, limit: int64(limit), metrics: metrics}
+}
+
+// Accept waits for the next connection within the limit
+func (l *connLimitListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		open := l.open.Add(1)
+		if l.limit > 0 && open > l.limit {
+			l.open.Add(-1)
+			logrus.Warnf("Rejecting connection from %s, %d connections are open", conn.RemoteAddr(), l.limit)
+			l.metrics.RecordConnectionRejected()
+			conn.Close()
+			continue
+		}
+		l.metrics.RecordConnections(int(open))
+		return &limitedConn{Conn: conn, listener: l}, nil
+	}
+}
+
+// limitedConn frees its slot of the listener's limit when closed
+type limitedConn struct {
+	net.Conn
+	listener  *connLimitListener
+	closeOnce sync.Once
+}
+
+// Close closes the connection, freeing its slot the first time
+func (c *limitedConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(func() {
+		c.listener.metrics.RecordConnections(int(c.listener.open.Add(-1)))
+	})
+	return err
+}
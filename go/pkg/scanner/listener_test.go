@@ -0,0 +1,124 @@
+package scanner
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+	"github.com/trustdan/ibkr-trader/go/pkg/scannerclient"
+)
+
+// http2Preface opens an HTTP/2 connection: the client preface followed by an
+// empty SETTINGS frame
+const http2Preface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n\x00\x00\x00\x04\x00\x00\x00\x00\x00"
+
+// serveLimited serves service over TCP with cfg's server options behind
+// LimitListener and returns the address
+func serveLimited(t *testing.T, service *ScannerService, cfg *Config) string {
+	t.Helper()
+	options, err := ServerOptions(cfg, service.Metrics())
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer(options...)
+	pb.RegisterScannerServiceServer(server, service)
+	go server.Serve(LimitListener(listener, cfg.MaxConcurrentConnections, service.Metrics()))
+	t.Cleanup(server.Stop)
+	return listener.Addr().String()
+}
+
+// openConnections reads the active connections gauge
+func openConnections(service *ScannerService) int {
+	return int(testutil.ToFloat64(service.Metrics().connections))
+}
+
+func TestKeepaliveReleasesDeadClients(t *testing.T) {
+	service := newTestService(t)
+	cfg := *service.Config()
+	cfg.GRPCKeepaliveTime = time.Second // gRPC's minimum
+	cfg.GRPCKeepaliveTimeout = 200 * time.Millisecond
+	cfg.GRPCKeepaliveMinTime = time.Second
+	addr := serveLimited(t, service, &cfg)
+
+	client, err := scannerclient.NewClient(addr, scannerclient.WithKeepaliveInterval(10*time.Second, time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := client.GetMetrics(context.Background()); err != nil {
+		t.Fatalf("GetMetrics failed: %v", err)
+	}
+
+	// A client that opens a connection and then never answers the server's
+	// pings, as one whose host has gone away
+	dead, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dead.Close()
+	if _, err := io.WriteString(dead, http2Preface); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "both connections", func() bool { return openConnections(service) == 2 })
+
+	// Pinged after a second idle and closed 200ms later, while the live
+	// client answers its pings
+	start := time.Now()
+	waitFor(t, "the dead client's release", func() bool { return openConnections(service) == 1 })
+	if elapsed := time.Since(start); elapsed > 1500*time.Millisecond {
+		t.Errorf("Dead client released after %s, want within the keepalive time and timeout", elapsed)
+	}
+	dead.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.ReadAll(dead); err != nil {
+		t.Errorf("Dead client's connection should have been closed by the server: %v", err)
+	}
+	if _, err := client.GetMetrics(context.Background()); err != nil {
+		t.Errorf("Live client's call after the release failed: %v", err)
+	}
+}
+
+func TestLimitListenerRejectsExcessConnections(t *testing.T) {
+	service := newTestService(t)
+	cfg := *service.Config()
+	cfg.MaxConcurrentConnections = 1
+	addr := serveLimited(t, service, &cfg)
+
+	first, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the first connection", func() bool { return openConnections(service) == 1 })
+
+	second, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	second.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if n, err := second.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Read from the connection over the limit = %d, %v; want it closed", n, err)
+	}
+	if rejected := testutil.ToFloat64(service.Metrics().rejected); rejected != 1 {
+		t.Errorf("Rejected connections = %g, want 1", rejected)
+	}
+
+	// Closing the first frees its slot
+	first.Close()
+	waitFor(t, "the first connection's release", func() bool { return openConnections(service) == 0 })
+	third, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer third.Close()
+	waitFor(t, "the third connection", func() bool { return openConnections(service) == 1 })
+}
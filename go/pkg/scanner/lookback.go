@@ -0,0 +1,90 @@
+package scanner
+
+import (
+	"time"
+
+	"github.com/trustdan/ibkr-trader/go/pkg/calendar"
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+	"github.com/trustdan/ibkr-trader/go/pkg/strategy"
+)
+
+const (
+	// lookbackMarginDays pads the history the strategies declare, for bars
+	// missing from it and closures the market calendar does not know of
+	lookbackMarginDays = 5
+	// sessionLength is the regular trading session, which converts a
+	// lookback of intraday bars to trading days
+	sessionLength = 6*time.Hour + 30*time.Minute
+)
+
+// lookbackDays returns the trading days holding the bars of lookback, which
+// are of spec's size when it names none, and false for a size the scanner
+// does not support
+func lookbackDays(lookback strategy.Lookback, spec BarSpec) (int, bool) {
+	barSize := lookback.BarSize
+	if barSize == "" {
+		barSize = spec.BarSize
+	}
+	interval, ok := barSizeIntervals[barSize]
+	if !ok {
+		return 0, false
+	}
+	if barSize == BarSize1Day {
+		return lookback.Bars, true
+	}
+	perSession := int(sessionLength / interval)
+	return (lookback.Bars + perSession - 1) / perSession, true
+}
+
+// lookbackStart returns the earliest date a scan ending at end, a date in
+// market's timezone, needs bars from for the lookback of every strategy,
+// counted in trading days of market, and false when a strategy declares none
+// and so may need any history
+func lookbackStart(configured []strategy.Configured, spec BarSpec, end time.Time, market *calendar.MarketCalendar) (time.Time, bool) {
+	if len(configured) == 0 {
+		return time.Time{}, false
+	}
+	days := 0
+	for _, strat := range configured {
+		lookback, ok := strategy.RequiredLookback(strat.Strategy)
+		if !ok {
+			return time.Time{}, false
+		}
+		needed, ok := lookbackDays(lookback, spec)
+		if !ok {
+			return time.Time{}, false
+		}
+		days = max(days, needed)
+	}
+	days += lookbackMarginDays
+
+	// The end date is the first of the trading days counted back
+	start := end
+	for counted := 0; ; start = start.AddDate(0, 0, -1) {
+		if !market.Day(start).Closed() {
+			counted++
+		}
+		if counted == days {
+			return start, true
+		}
+	}
+}
+
+// effectiveDateRange returns the range a scan fetches: the requested one,
+// starting no earlier than the strategies' lookback needs unless force is
+// set. A range that does not parse is left to the data provider to reject.
+func effectiveDateRange(requested *pb.DateRange, force bool, configured []strategy.Configured, spec BarSpec, market *calendar.MarketCalendar) *pb.DateRange {
+	if force {
+		return requested
+	}
+	start, startErr := time.ParseInLocation(dateLayout, requested.StartDate, market.Location())
+	end, endErr := time.ParseInLocation(dateLayout, requested.EndDate, market.Location())
+	if startErr != nil || endErr != nil {
+		return requested
+	}
+	needed, ok := lookbackStart(configured, spec, end, market)
+	if !ok || !needed.After(start) {
+		return requested
+	}
+	return &pb.DateRange{StartDate: needed.Format(dateLayout), EndDate: requested.EndDate}
+}
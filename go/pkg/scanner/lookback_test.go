@@ -0,0 +1,109 @@
+package scanner
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/trustdan/ibkr-trader/go/pkg/calendar"
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+	"github.com/trustdan/ibkr-trader/go/pkg/strategy"
+)
+
+// halfHourStrategy is HIGH_BASE declaring a lookback of two sessions of
+// 30-minute bars
+type halfHourStrategy struct{ strategy.Strategy }
+
+func (halfHourStrategy) Lookback() strategy.Lookback {
+	return strategy.Lookback{Bars: 26, BarSize: BarSize30Min}
+}
+
+// undeclaredStrategy is HIGH_BASE without its lookback
+type undeclaredStrategy struct{ strategy.Strategy }
+
+func TestLookbackStartCoversEveryStrategy(t *testing.T) {
+	highBase, _ := strategy.Lookup("HIGH_BASE")
+	rule, err := strategy.CompileRule("ABOVE_SMA", strategy.Long, "", "close > sma(10)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	configured := func(strategies ...strategy.Strategy) []strategy.Configured {
+		out := make([]strategy.Configured, len(strategies))
+		for i, s := range strategies {
+			out[i] = strategy.Configured{Strategy: s}
+		}
+		return out
+	}
+	market := calendar.DefaultMarketCalendar()
+	end := time.Date(2024, 7, 31, 0, 0, 0, 0, market.Location())
+	intraday := BarSpec{BarSize: BarSize30Min, WhatToShow: WhatToShowTrades}
+
+	tests := []struct {
+		name       string
+		strategies []strategy.Strategy
+		spec       BarSpec
+		want       string
+	}{
+		// 11 daily bars of the rule and its margin make 16 trading days
+		// back from the Wednesday, the two sessions fitting inside them
+		{"daily", []strategy.Strategy{rule, halfHourStrategy{highBase}}, DefaultBarSpec(), "2024-07-10"},
+		// Scanning 30-minute bars the two sessions are the longer lookback,
+		// the rule's 11 bars fitting in one
+		{"intraday", []strategy.Strategy{rule, halfHourStrategy{highBase}}, intraday, "2024-07-23"},
+		{"undeclared", []strategy.Strategy{rule, undeclaredStrategy{highBase}}, DefaultBarSpec(), ""},
+	}
+	for _, tt := range tests {
+		start, ok := lookbackStart(configured(tt.strategies...), tt.spec, end, market)
+		if got := start.Format(dateLayout); ok != (tt.want != "") || ok && got != tt.want {
+			t.Errorf("%s: lookbackStart() = %s, %v; want %q", tt.name, got, ok, tt.want)
+		}
+	}
+
+	// HIGH_BASE's 200 bars cover the rule's
+	mixed, _ := lookbackStart(configured(rule, highBase), DefaultBarSpec(), end, market)
+	alone, _ := lookbackStart(configured(highBase), DefaultBarSpec(), end, market)
+	if !mixed.Equal(alone) || !mixed.Before(end.AddDate(0, 0, -200)) {
+		t.Errorf("lookbackStart() of HIGH_BASE and the rule = %s, want HIGH_BASE's %s", mixed.Format(dateLayout), alone.Format(dateLayout))
+	}
+}
+
+func TestScanNarrowsDateRangeToLookback(t *testing.T) {
+	cfg := newTestService(t).Config()
+	cfg.CustomStrategies = map[string]CustomStrategy{
+		"ABOVE_SMA": {Signal: "LONG", Rule: "close > sma(10)"},
+	}
+	service := NewScannerServiceWithRegistry(cfg, prometheus.NewRegistry())
+	provider := &countingProvider{}
+	useProvider(service, provider)
+
+	scan := func(req *pb.ScanRequest) *pb.ScanResponse {
+		t.Helper()
+		resp, err := service.Scan(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+		return resp
+	}
+	long := &pb.DateRange{StartDate: "2023-01-03", EndDate: "2024-07-31"}
+
+	// A year and a half of history is cut to the rule's lookback
+	resp := scan(&pb.ScanRequest{Symbols: []string{"AAPL"}, Strategies: []string{"ABOVE_SMA"}, DateRange: long})
+	if resp.DateRange.GetStartDate() != "2024-07-10" || resp.DateRange.GetEndDate() != "2024-07-31" || provider.ranges[0] != "2024-07-10..2024-07-31" {
+		t.Errorf("Effective range = %v fetched as %s, want from 2024-07-10", resp.DateRange, provider.ranges[0])
+	}
+
+	// Forcing the range fetches all of it
+	resp = scan(&pb.ScanRequest{Symbols: []string{"AAPL"}, Strategies: []string{"ABOVE_SMA"}, DateRange: long, ForceDateRange: true})
+	if resp.DateRange.GetStartDate() != "2023-01-03" || provider.ranges[1] != "2023-01-03..2024-07-31" {
+		t.Errorf("Forced range = %v fetched as %s, want the requested range", resp.DateRange, provider.ranges[1])
+	}
+
+	// A range shorter than the lookback is kept
+	short := &pb.DateRange{StartDate: "2024-07-15", EndDate: "2024-07-31"}
+	resp = scan(&pb.ScanRequest{Symbols: []string{"AAPL"}, Strategies: []string{"ABOVE_SMA"}, DateRange: short})
+	if resp.DateRange.GetStartDate() != short.StartDate {
+		t.Errorf("Short range = %v, want the requested range", resp.DateRange)
+	}
+}
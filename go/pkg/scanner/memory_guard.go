@@ -0,0 +1,301 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Memory guard levels reported by GetMetrics
+const (
+	MemoryDisabled = "DISABLED"
+	MemoryNormal   = "NORMAL"
+	MemorySoft     = "SOFT"
+	MemoryHard     = "HARD"
+)
+
+// memoryEvictFraction is the share of the cached series dropped by each
+// check above the soft watermark, oldest first
+const memoryEvictFraction = 0.25
+
+// cgroupMemoryFiles hold the container's memory limit under cgroup v2 and v1
+var cgroupMemoryFiles = []string{
+	"/sys/fs/cgroup/memory.max",
+	"/sys/fs/cgroup/memory/memory.limit_in_bytes",
+}
+
+// errMemoryHardWatermark cancels the bulk fetches in flight when the heap
+// crosses the hard watermark
+var errMemoryHardWatermark = errors.New("heap above the hard memory watermark")
+
+// MemoryStatus is the state of the memory guard at its latest check
+type MemoryStatus struct {
+	Level         string
+	HeapBytes     uint64
+	SoftWatermark uint64 // bytes, 0 when unset
+	HardWatermark uint64 // bytes, 0 when unset
+	LimitBytes    uint64 // the cgroup memory limit, 0 when there is none
+	Rejected      int    // bulk fetches rejected since startup
+	Cancelled     int    // bulk fetches cancelled since startup
+}
+
+// cacheEvicter is implemented by data providers caching bars in memory
+type cacheEvicter interface {
+	// EvictOldest drops the least recently used fraction of the cache and
+	// returns how many entries it dropped
+	EvictOldest(fraction float64) int
+}
+
+// memoryGuard tracks the heap against the watermarks and the bulk fetches
+// it may cancel
+type memoryGuard struct {
+	mu      sync.Mutex
+	status  MemoryStatus
+	fetches map[int]context.CancelCauseFunc
+	nextID  int
+
+	// readHeap and readLimit measure the heap in use and the cgroup memory
+	// limit; replaced in tests
+	readHeap  func() uint64
+	readLimit func() uint64
+}
+
+// heapInUse returns the bytes of the heap's spans in use
+func heapInUse() uint64 {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapInuse
+}
+
+// cgroupMemoryLimit returns the container's memory limit, or 0 when there is
+// none or it cannot be read
+func cgroupMemoryLimit() uint64 {
+	for _, file := range cgroupMemoryFiles {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		limit, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		// cgroup v2 writes "max" and v1 a page-aligned maximum when unlimited
+		if err != nil || limit >= math.MaxInt64/2 {
+			return 0
+		}
+		return limit
+	}
+	return 0
+}
+
+// memoryWatermarks returns the soft and hard watermarks in bytes under a
+// cgroup memory limit of limit bytes, 0 for none. Each is the lower of its
+// MB and percent forms, 0 when both are unset.
+func (c *Config) memoryWatermarks(limit uint64) (soft, hard uint64) {
+	watermark := func(mb int, percent float64) uint64 {
+		var bytes uint64
+		if mb > 0 {
+			bytes = uint64(mb) * 1024 * 1024
+		}
+		if percent > 0 && limit > 0 {
+			if share := uint64(float64(limit) * percent / 100); bytes == 0 || share < bytes {
+				bytes = share
+			}
+		}
+		return bytes
+	}
+	return watermark(c.MemorySoftWatermarkMB, c.MemorySoftWatermarkPercent),
+		watermark(c.MemoryHardWatermarkMB, c.MemoryHardWatermarkPercent)
+}
+
+// memoryLevel returns the level of heap against the watermarks
+func memoryLevel(heap, soft, hard uint64) string {
+	switch {
+	case soft == 0 && hard == 0:
+		return MemoryDisabled
+	case hard > 0 && heap >= hard:
+		return MemoryHard
+	case soft > 0 && heap >= soft:
+		return MemorySoft
+	}
+	return MemoryNormal
+}
+
+// pressured reports whether the heap was above a watermark at the latest
+// check
+func (g *memoryGuard) pressured() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.status.Level == MemorySoft || g.status.Level == MemoryHard
+}
+
+// get returns the state at the latest check, DISABLED before the first
+func (g *memoryGuard) get() MemoryStatus {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	status := g.status
+	if status.Level == "" {
+		status.Level = MemoryDisabled
+	}
+	return status
+}
+
+// track registers the cancel function of a bulk fetch until the returned
+// function is called
+func (g *memoryGuard) track(cancel context.CancelCauseFunc) func() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.fetches == nil {
+		g.fetches = make(map[int]context.CancelCauseFunc)
+	}
+	id := g.nextID
+	g.nextID++
+	g.fetches[id] = cancel
+	return func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		delete(g.fetches, id)
+	}
+}
+
+// workerLimit returns the worker pool's limit under cfg: MaxConcurrency, or
+// MemoryGuardMinWorkers while the heap is above a watermark
+func (s *Engine) workerLimit(cfg *Config) int {
+	if s.memory.pressured() && cfg.MemoryGuardMinWorkers > 0 && cfg.MemoryGuardMinWorkers < cfg.MaxConcurrency {
+		return cfg.MemoryGuardMinWorkers
+	}
+	return cfg.MaxConcurrency
+}
+
+// MemoryStatus returns the state of the memory guard
+func (s *Engine) MemoryStatus() MemoryStatus {
+	return s.memory.get()
+}
+
+// RunMemoryGuard checks the heap against the memory watermarks every interval
+// until ctx is done. The watermarks of a reloaded configuration apply from the
+// next check.
+func (s *Engine) RunMemoryGuard(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.checkMemory()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkMemory measures the heap and applies the memory guard's level: above
+// the soft watermark the worker pool shrinks and the oldest cached series are
+// dropped, above the hard watermark the bulk fetches in flight are cancelled
+// as well
+func (s *Engine) checkMemory() {
+	d := s.current()
+	readHeap, readLimit := s.memory.readHeap, s.memory.readLimit
+	if readHeap == nil {
+		readHeap = heapInUse
+	}
+	if readLimit == nil {
+		readLimit = cgroupMemoryLimit
+	}
+	heap, limit := readHeap(), readLimit()
+	soft, hard := d.config.memoryWatermarks(limit)
+	level := memoryLevel(heap, soft, hard)
+
+	s.memory.mu.Lock()
+	previous := s.memory.status.Level
+	s.memory.status.Level = level
+	s.memory.status.HeapBytes = heap
+	s.memory.status.SoftWatermark = soft
+	s.memory.status.HardWatermark = hard
+	s.memory.status.LimitBytes = limit
+	var cancels []context.CancelCauseFunc
+	if level == MemoryHard {
+		for id, cancel := range s.memory.fetches {
+			cancels = append(cancels, cancel)
+			delete(s.memory.fetches, id)
+		}
+		s.memory.status.Cancelled += len(cancels)
+	}
+	s.memory.mu.Unlock()
+	s.metricTracker.RecordMemory(level, heap)
+
+	if level != previous && previous != "" {
+		logrus.Warnf("Heap in use %d MB, memory guard %s -> %s", heap/1024/1024, previous, level)
+	}
+	if level != previous {
+		s.workers.resize(s.workerLimit(d.config))
+	}
+	if level == MemorySoft || level == MemoryHard {
+		if evicter, ok := d.dataProvider.(cacheEvicter); ok {
+			if evicted := evicter.EvictOldest(memoryEvictFraction); evicted > 0 {
+				s.metricTracker.RecordMemoryGuardAction("evict", evicted)
+			}
+		}
+	}
+	for _, cancel := range cancels {
+		cancel(errMemoryHardWatermark)
+	}
+	if len(cancels) > 0 {
+		logrus.Warnf("Cancelled %d bulk fetches above the hard memory watermark", len(cancels))
+		s.metricTracker.RecordMemoryGuardAction("cancel", len(cancels))
+	}
+}
+
+// admitBulkFetch returns a RESOURCE_EXHAUSTED error asking the client to retry
+// after MemoryRetryAfter while the heap is above a watermark. The delay is
+// sent as the retry-after header in seconds and as RetryInfo.
+func (s *Engine) admitBulkFetch(ctx context.Context, cfg *Config) error {
+	if !s.memory.pressured() {
+		return nil
+	}
+	s.memory.mu.Lock()
+	s.memory.status.Rejected++
+	s.memory.mu.Unlock()
+	s.metricTracker.RecordMemoryGuardAction("reject", 1)
+	return memoryExhausted(ctx, cfg.MemoryRetryAfter, "scanner memory above its watermark")
+}
+
+// memoryExhausted builds the RESOURCE_EXHAUSTED error of a bulk fetch turned
+// away or cancelled by the memory guard
+func memoryExhausted(ctx context.Context, retryAfter time.Duration, reason string) error {
+	return retryableError(ctx, codes.ResourceExhausted, retryAfter, reason)
+}
+
+// retryableError builds an error of code asking the client to retry after
+// retryAfter, sent as the retry-after header in seconds and as RetryInfo
+func retryableError(ctx context.Context, code codes.Code, retryAfter time.Duration, reason string) error {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	// Failing to set the header only loses the hint
+	_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(seconds)))
+
+	st := status.New(code, fmt.Sprintf("%s; retry after %ds", reason, seconds))
+	if detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// memoryCancelled returns the error of a bulk fetch whose ctx the memory
+// guard cancelled, or nil when it did not
+func memoryCancelled(ctx context.Context, cfg *Config) error {
+	if !errors.Is(context.Cause(ctx), errMemoryHardWatermark) {
+		return nil
+	}
+	return memoryExhausted(ctx, cfg.MemoryRetryAfter, "bulk fetch cancelled above the hard memory watermark")
+}
@@ -0,0 +1,182 @@
+package scanner
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+const mb = 1024 * 1024
+
+func TestMemoryWatermarks(t *testing.T) {
+	cfg := &Config{MemorySoftWatermarkMB: 512, MemorySoftWatermarkPercent: 75, MemoryHardWatermarkPercent: 90}
+	for _, tc := range []struct {
+		limit      uint64
+		soft, hard uint64
+	}{
+		{0, 512 * mb, 0},                 // the percents need a cgroup limit
+		{2000 * mb, 512 * mb, 1800 * mb}, // the lower of MB and percent
+		{400 * mb, 300 * mb, 360 * mb},
+	} {
+		if soft, hard := cfg.memoryWatermarks(tc.limit); soft != tc.soft || hard != tc.hard {
+			t.Errorf("Watermarks under %d MB = %d, %d; want %d, %d", tc.limit/mb, soft, hard, tc.soft, tc.hard)
+		}
+	}
+
+	for _, tc := range []struct {
+		heap, soft, hard uint64
+		want             string
+	}{
+		{100, 0, 0, MemoryDisabled},
+		{100, 200, 300, MemoryNormal},
+		{200, 200, 300, MemorySoft},
+		{300, 200, 300, MemoryHard},
+		{300, 0, 300, MemoryHard},
+		{250, 200, 0, MemorySoft},
+	} {
+		if got := memoryLevel(tc.heap, tc.soft, tc.hard); got != tc.want {
+			t.Errorf("memoryLevel(%d, %d, %d) = %s, want %s", tc.heap, tc.soft, tc.hard, got, tc.want)
+		}
+	}
+}
+
+// guardedService returns a test service whose memory guard reads the heap
+// from heap under a 1000 MB cgroup limit, with watermarks at 50% and 80%
+func guardedService(t *testing.T, heap *atomic.Uint64) *ScannerService {
+	service := newTestService(t)
+	cfg := *service.Config()
+	cfg.MaxConcurrency = 10
+	cfg.MemoryGuardMinWorkers = 2
+	cfg.MemorySoftWatermarkMB = 0
+	cfg.MemorySoftWatermarkPercent = 50
+	cfg.MemoryHardWatermarkMB = 0
+	cfg.MemoryHardWatermarkPercent = 80
+	cfg.MemoryRetryAfter = 15 * time.Second
+	service.UpdateConfig(&cfg)
+	service.memory.readHeap = heap.Load
+	service.memory.readLimit = func() uint64 { return 1000 * mb }
+	return service
+}
+
+func TestMemoryGuardSoftWatermark(t *testing.T) {
+	var heap atomic.Uint64
+	heap.Store(100 * mb)
+	service := guardedService(t, &heap)
+	cache := NewCachedDataProvider(service.Config(), risingProvider{}, nil)
+	useProvider(service, cache)
+	for _, symbol := range []string{"AAPL", "MSFT", "XOM", "SPY"} {
+		if _, err := cache.GetHistoricalData(context.Background(), symbol, "2024-01-02", "2024-01-31", DefaultBarSpec()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	client := dialTestServer(t, service)
+	req := &pb.BulkFetchRequest{Symbols: []string{"AAPL"}, DateRange: testDateRange()}
+
+	service.checkMemory()
+	if status := service.MemoryStatus(); status.Level != MemoryNormal || status.SoftWatermark != 500*mb || status.HardWatermark != 800*mb {
+		t.Errorf("Status below the watermarks = %+v", status)
+	}
+
+	// Above the soft watermark the pool shrinks, the oldest quarter of the
+	// cache goes and bulk fetches are turned away
+	heap.Store(600 * mb)
+	service.checkMemory()
+	if size := service.workers.size(); size != 2 {
+		t.Errorf("Workers above the soft watermark = %d, want 2", size)
+	}
+	if cached := cache.cache.ItemCount(); cached != 3 {
+		t.Errorf("Cached series above the soft watermark = %d, want 3", cached)
+	}
+	var header metadata.MD
+	_, err := client.BulkFetch(context.Background(), req, grpc.Header(&header))
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("BulkFetch above the soft watermark = %v, want ResourceExhausted", err)
+	}
+	if got := header.Get("retry-after"); len(got) != 1 || got[0] != "15" {
+		t.Errorf("retry-after header = %v, want 15", got)
+	}
+	details := status.Convert(err).Details()
+	if len(details) != 1 || details[0].(*errdetails.RetryInfo).RetryDelay.AsDuration() != 15*time.Second {
+		t.Errorf("Error details = %v, want RetryInfo of 15s", details)
+	}
+	stream, err := client.BulkFetchStream(context.Background(), req)
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("BulkFetchStream above the soft watermark = %v, want ResourceExhausted", err)
+	}
+
+	// A reload keeps the pool small while the pressure lasts
+	service.UpdateConfig(service.Config())
+	if size := service.workers.size(); size != 2 {
+		t.Errorf("Workers after a reload above the soft watermark = %d, want 2", size)
+	}
+	metrics, err := client.GetMetrics(context.Background(), &pb.MetricsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metrics.MemoryGuard != MemorySoft || metrics.MemoryHeapMb != 600 || metrics.MemoryLimitMb != 1000 || metrics.MemoryRejectedFetches != 2 {
+		t.Errorf("GetMetrics above the soft watermark = %s, %g MB of %g, %d rejected",
+			metrics.MemoryGuard, metrics.MemoryHeapMb, metrics.MemoryLimitMb, metrics.MemoryRejectedFetches)
+	}
+
+	// Back below it everything is restored
+	heap.Store(100 * mb)
+	service.checkMemory()
+	if size := service.workers.size(); size != 10 {
+		t.Errorf("Workers back below the soft watermark = %d, want 10", size)
+	}
+	if _, err := client.BulkFetch(context.Background(), req); err != nil {
+		t.Errorf("BulkFetch back below the soft watermark failed: %v", err)
+	}
+}
+
+func TestMemoryGuardHardWatermarkCancelsBulkFetches(t *testing.T) {
+	var heap atomic.Uint64
+	service := guardedService(t, &heap)
+	client := dialTestServer(t, service)
+	ctx := context.Background()
+
+	for _, stream := range []bool{false, true} {
+		provider := &blockingProvider{started: make(chan struct{}, 1), cancelled: make(chan struct{})}
+		useProvider(service, provider)
+		heap.Store(100 * mb)
+		service.checkMemory()
+
+		done := make(chan error, 1)
+		req := &pb.BulkFetchRequest{Symbols: []string{"AAPL"}, DateRange: testDateRange()}
+		go func() {
+			if !stream {
+				_, err := client.BulkFetch(ctx, req)
+				done <- err
+				return
+			}
+			s, err := client.BulkFetchStream(ctx, req)
+			for err == nil {
+				_, err = s.Recv()
+			}
+			done <- err
+		}()
+		<-provider.started
+
+		heap.Store(900 * mb)
+		service.checkMemory()
+		<-provider.cancelled
+		if err := <-done; status.Code(err) != codes.ResourceExhausted {
+			t.Errorf("Bulk fetch (stream %t) above the hard watermark = %v, want ResourceExhausted", stream, err)
+		}
+	}
+	if cancelled := service.MemoryStatus().Cancelled; cancelled != 2 {
+		t.Errorf("Cancelled fetches = %d, want 2", cancelled)
+	}
+}
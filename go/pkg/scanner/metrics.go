@@ -1,146 +1,693 @@
 package scanner
 
 import (
-	"runtime"
+	"slices"
+	"sort"
 	"sync"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/shirou/gopsutil/cpu"
+
+	"github.com/trustdan/ibkr-trader/go/pkg/strategy"
 )
 
-// Metrics holds performance metrics for the scanner service
-type Metrics struct {
+// providerTypes are the data providers NewDataProvider builds
+var providerTypes = []string{"mock", "yahoo", "ibkr"}
+
+// otherLabel replaces strategy and provider names that are not registered, so
+// the breakdowns and their label values stay bounded
+const otherLabel = "other"
+
+// MetricsData contains performance metrics for the scanner
+type MetricsData struct {
 	AvgScanTime      float64
 	SymbolsPerSecond float64
 	TotalScans       int
-	MemoryUsage      float64 // MB
-	CPUUsage         float64 // Percentage
+	TotalFetches     int
+	CPUUsage         float64
+	ErrorCount       int
+	CacheHitRate     float64
+	CacheHits        int
+	CacheDiskHits    int
+	CachePartialHits int
+	CacheMisses      int
+
+	// Scheduled scans; LastScheduledScan is zero until the first one finishes
+	LastScheduledScan        time.Time
+	LastScheduledScanSeconds float64
+	ScheduledScansSkipped    int
+
+	// Breakdowns in name order, listing only strategies evaluated and
+	// providers used since startup
+	Strategies []StrategyMetrics
+	Providers  []ProviderMetrics
+
+	// ProcessStartTime is when the tracker was created; CountersRestoredFrom
+	// is when the snapshot restored into it was saved, zero without one
+	ProcessStartTime     time.Time
+	CountersRestoredFrom time.Time
+}
+
+// StrategyMetrics summarizes the evaluations of one strategy
+type StrategyMetrics struct {
+	Name        string
+	AvgMs       float64
+	Evaluations int
+	Signals     int
+}
+
+// ProviderMetrics summarizes the fetches of one data provider and the cache
+// lookups in front of it. AvgMs only counts fetches that reached the provider.
+type ProviderMetrics struct {
+	Name         string
+	AvgMs        float64
+	Fetches      int
+	Errors       int
+	CacheHitRate float64
+}
+
+// strategyStats are the running totals behind StrategyMetrics
+type strategyStats struct {
+	evaluations int
+	signals     int
+	seconds     float64
+}
+
+// providerStats are the running totals behind ProviderMetrics
+type providerStats struct {
+	fetches       int
+	errors        int
+	seconds       float64
+	cacheHits     int
+	cacheRequests int
 }
 
 // MetricTracker tracks performance metrics for the scanner service
 type MetricTracker struct {
-	mu sync.Mutex
+	mu                sync.RWMutex
+	scanTimes         []float64
+	fetchTimes        []float64
+	totalSymbols      int
+	totalScans        int
+	totalFetches      int
+	errorCount        int
+	cacheHits         int
+	cacheDiskHits     int
+	cachePartialHits  int
+	cacheRequests     int
+	lastCPUCheckTime  time.Time
+	lastCPUPercentage float64
+
+	lastScheduledScan        time.Time
+	lastScheduledScanSeconds float64
+	scheduledScansSkipped    int
 
-	// Scan metrics
-	scanTimes      []float64
-	symbolsCounts  []int
-	fetchTimes     []float64
-	fetchedSymbols []int
+	strategies map[string]*strategyStats
+	providers  map[string]*providerStats
 
-	// Execution counts
-	totalScans   int
-	totalFetches int
+	startTime    time.Time
+	restoredFrom time.Time
 
-	// Last metrics update time
-	lastUpdate time.Time
+	// Prometheus metrics
+	scanDuration      prometheus.Histogram
+	fetchDuration     prometheus.Histogram
+	scanCounter       prometheus.Counter
+	fetchCounter      prometheus.Counter
+	errorCounter      prometheus.Counter
+	symbolsScanned    prometheus.Counter
+	symbolsPerSecond  prometheus.Gauge
+	cacheHitRateGauge prometheus.Gauge
+	cacheLookups      *prometheus.CounterVec
+	memoryUsageGauge  prometheus.Gauge
+	cpuUsageGauge     prometheus.Gauge
+	strategyDuration  *prometheus.HistogramVec
+	strategySignals   *prometheus.CounterVec
+	providerDuration  *prometheus.HistogramVec
+	providerErrors    *prometheus.CounterVec
+	providerShared    *prometheus.CounterVec
+	cacheAggregated   *prometheus.CounterVec
+	injectedFaults    *prometheus.CounterVec
+	qualityIssues     *prometheus.CounterVec
+	workerLimit       prometheus.Gauge
+	workersInUse      prometheus.Gauge
+	connections       prometheus.Gauge
+	rejected          prometheus.Counter
+	heapInUse         prometheus.Gauge
+	memoryPressure    prometheus.Gauge
+	memoryActions     *prometheus.CounterVec
+	symbolPhase       *prometheus.HistogramVec
+	webhookDeliveries *prometheus.CounterVec
 }
 
-// NewMetricTracker creates a new metrics tracker
-func NewMetricTracker() *MetricTracker {
+// NewMetricTracker creates a new metric tracker whose Prometheus metrics are
+// registered with reg
+func NewMetricTracker(reg prometheus.Registerer) *MetricTracker {
+	factory := promauto.With(reg)
+
+	// Register Prometheus metrics
+	scanDuration := factory.NewHistogram(prometheus.HistogramOpts{
+		Name:    "scanner_scan_duration_seconds",
+		Help:    "Duration of scan operations",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 10), // 0.01s to ~10s
+	})
+
+	fetchDuration := factory.NewHistogram(prometheus.HistogramOpts{
+		Name:    "scanner_fetch_duration_seconds",
+		Help:    "Duration of fetch operations",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 10),
+	})
+
+	scanCounter := factory.NewCounter(prometheus.CounterOpts{
+		Name: "scanner_scan_total",
+		Help: "Total number of scan operations",
+	})
+
+	fetchCounter := factory.NewCounter(prometheus.CounterOpts{
+		Name: "scanner_fetch_total",
+		Help: "Total number of fetch operations",
+	})
+
+	errorCounter := factory.NewCounter(prometheus.CounterOpts{
+		Name: "scanner_errors_total",
+		Help: "Total number of errors",
+	})
+
+	symbolsScanned := factory.NewCounter(prometheus.CounterOpts{
+		Name: "scanner_symbols_total",
+		Help: "Total number of symbols scanned",
+	})
+
+	symbolsPerSecond := factory.NewGauge(prometheus.GaugeOpts{
+		Name: "scanner_symbols_per_second",
+		Help: "Rate of symbols scanned per second",
+	})
+
+	cacheHitRateGauge := factory.NewGauge(prometheus.GaugeOpts{
+		Name: "scanner_cache_hit_rate",
+		Help: "Cache hit rate percentage",
+	})
+
+	cacheLookups := factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "scanner_cache_requests_total",
+		Help: "Historical data cache lookups by result (hit, disk_hit, partial, miss)",
+	}, []string{"result"})
+
+	memoryUsageGauge := factory.NewGauge(prometheus.GaugeOpts{
+		Name: "scanner_memory_usage_bytes",
+		Help: "Memory usage in bytes",
+	})
+
+	cpuUsageGauge := factory.NewGauge(prometheus.GaugeOpts{
+		Name: "scanner_cpu_usage_percent",
+		Help: "CPU usage percentage",
+	})
+
+	strategyDuration := factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "scanner_strategy_evaluation_duration_seconds",
+		Help:    "Duration of a strategy's evaluation of one symbol",
+		Buckets: prometheus.ExponentialBuckets(0.00001, 4, 10), // 10us to ~2.6s
+	}, []string{"strategy"})
+
+	strategySignals := factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "scanner_strategy_signals_total",
+		Help: "Total number of signals raised by strategy",
+	}, []string{"strategy"})
+
+	providerDuration := factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "scanner_provider_fetch_duration_seconds",
+		Help:    "Duration of historical data fetches by data provider, not counting cache hits",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 10),
+	}, []string{"provider"})
+
+	providerErrors := factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "scanner_provider_errors_total",
+		Help: "Total number of failed historical data fetches by data provider",
+	}, []string{"provider"})
+
+	providerShared := factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "scanner_provider_fetches_deduplicated_total",
+		Help: "Historical data fetches by data provider that joined an identical fetch in flight instead of calling the provider",
+	}, []string{"provider"})
+
+	cacheAggregated := factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "scanner_cache_aggregated_total",
+		Help: "Daily bar requests by data provider served by aggregating cached intraday bars instead of calling the provider",
+	}, []string{"provider"})
+
+	injectedFaults := factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "scanner_injected_faults_total",
+		Help: "Faults injected in front of a data provider for testing by provider and fault (error, timeout, symbol)",
+	}, []string{"provider", "fault"})
+
+	qualityIssues := factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "scanner_data_quality_issues_total",
+		Help: "Data quality issues found in the bars of scanned symbols by issue (missing_day, bad_price, high_below_low, duplicate_timestamp, abnormal_gap, mixed_adjustment)",
+	}, []string{"issue"})
+
+	workerLimit := factory.NewGauge(prometheus.GaugeOpts{
+		Name: "scanner_worker_limit",
+		Help: "Symbols the scanner fetches at once across all requests",
+	})
+
+	workersInUse := factory.NewGauge(prometheus.GaugeOpts{
+		Name: "scanner_workers_in_use",
+		Help: "Symbols being fetched, above scanner_worker_limit while a lowered limit drains",
+	})
+
+	connections := factory.NewGauge(prometheus.GaugeOpts{
+		Name: "scanner_grpc_active_connections",
+		Help: "Open gRPC client connections",
+	})
+
+	rejected := factory.NewCounter(prometheus.CounterOpts{
+		Name: "scanner_grpc_rejected_connections_total",
+		Help: "Connections closed on accept because max_concurrent_connections were open",
+	})
+
+	heapInUse := factory.NewGauge(prometheus.GaugeOpts{
+		Name: "scanner_memory_heap_inuse_bytes",
+		Help: "Heap in use at the memory guard's latest check",
+	})
+
+	memoryPressure := factory.NewGauge(prometheus.GaugeOpts{
+		Name: "scanner_memory_pressure",
+		Help: "Memory guard level at its latest check: 0 below the watermarks or disabled, 1 above the soft and 2 above the hard watermark",
+	})
+
+	memoryActions := factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "scanner_memory_guard_actions_total",
+		Help: "Memory guard actions by action (evict for each cached series dropped, reject and cancel for each bulk fetch)",
+	}, []string{"action"})
+
+	symbolPhase := factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "scanner_symbol_phase_duration_seconds",
+		Help:    "Duration of one scanned symbol's phase by phase (fetch, evaluate)",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10), // 100us to ~26s
+	}, []string{"phase"})
+
+	webhookDeliveries := factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "scanner_webhook_deliveries_total",
+		Help: "Scan webhook payloads by endpoint and result (success, failure after the retries, dropped on a full queue)",
+	}, []string{"endpoint", "result"})
+
 	return &MetricTracker{
-		scanTimes:      make([]float64, 0, 100),
-		symbolsCounts:  make([]int, 0, 100),
-		fetchTimes:     make([]float64, 0, 100),
-		fetchedSymbols: make([]int, 0, 100),
-		lastUpdate:     time.Now(),
+		scanTimes:         make([]float64, 0, 100),
+		fetchTimes:        make([]float64, 0, 100),
+		lastCPUCheckTime:  time.Now(),
+		startTime:         time.Now(),
+		strategies:        make(map[string]*strategyStats),
+		providers:         make(map[string]*providerStats),
+		scanDuration:      scanDuration,
+		fetchDuration:     fetchDuration,
+		scanCounter:       scanCounter,
+		fetchCounter:      fetchCounter,
+		errorCounter:      errorCounter,
+		symbolsScanned:    symbolsScanned,
+		symbolsPerSecond:  symbolsPerSecond,
+		cacheHitRateGauge: cacheHitRateGauge,
+		cacheLookups:      cacheLookups,
+		memoryUsageGauge:  memoryUsageGauge,
+		cpuUsageGauge:     cpuUsageGauge,
+		strategyDuration:  strategyDuration,
+		strategySignals:   strategySignals,
+		providerDuration:  providerDuration,
+		providerErrors:    providerErrors,
+		providerShared:    providerShared,
+		cacheAggregated:   cacheAggregated,
+		injectedFaults:    injectedFaults,
+		qualityIssues:     qualityIssues,
+		workerLimit:       workerLimit,
+		workersInUse:      workersInUse,
+		connections:       connections,
+		rejected:          rejected,
+		heapInUse:         heapInUse,
+		memoryPressure:    memoryPressure,
+		memoryActions:     memoryActions,
+		symbolPhase:       symbolPhase,
+		webhookDeliveries: webhookDeliveries,
+	}
+}
+
+// RecordWorkers sets the worker pool's limit and the slots in use
+func (m *MetricTracker) RecordWorkers(limit, inUse int) {
+	m.workerLimit.Set(float64(limit))
+	m.workersInUse.Set(float64(inUse))
+}
+
+// RecordConnections sets the open client connections
+func (m *MetricTracker) RecordConnections(open int) {
+	m.connections.Set(float64(open))
+}
+
+// RecordConnectionRejected counts a connection closed for exceeding the limit
+func (m *MetricTracker) RecordConnectionRejected() {
+	m.rejected.Inc()
+}
+
+// RecordMemory sets the memory guard's level and the heap in use
+func (m *MetricTracker) RecordMemory(level string, heapBytes uint64) {
+	pressure := 0
+	switch level {
+	case MemorySoft:
+		pressure = 1
+	case MemoryHard:
+		pressure = 2
 	}
+	m.heapInUse.Set(float64(heapBytes))
+	m.memoryPressure.Set(float64(pressure))
+}
+
+// RecordMemoryGuardAction counts n actions of the memory guard
+func (m *MetricTracker) RecordMemoryGuardAction(action string, n int) {
+	m.memoryActions.WithLabelValues(action).Add(float64(n))
+}
+
+// RecordSymbolPhase records the duration of one scanned symbol's fetch or
+// evaluation
+func (m *MetricTracker) RecordSymbolPhase(phase string, seconds float64) {
+	m.symbolPhase.WithLabelValues(phase).Observe(seconds)
+}
+
+// RecordWebhookDelivery counts a scan webhook payload's result at endpoint
+func (m *MetricTracker) RecordWebhookDelivery(endpoint, result string) {
+	m.webhookDeliveries.WithLabelValues(endpoint, result).Inc()
 }
 
 // RecordScan records metrics for a scan operation
-func (m *MetricTracker) RecordScan(symbolsCount int, scanTime float64) {
+func (m *MetricTracker) RecordScan(symbolCount int, scanTime float64) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// Add to scan metrics
-	m.scanTimes = append(m.scanTimes, scanTime)
-	m.symbolsCounts = append(m.symbolsCounts, symbolsCount)
-
-	// Limit array size to last 100 entries
-	if len(m.scanTimes) > 100 {
+	// Record scan time, keeping only the last 100 entries
+	if len(m.scanTimes) >= 100 {
 		m.scanTimes = m.scanTimes[1:]
-		m.symbolsCounts = m.symbolsCounts[1:]
 	}
+	m.scanTimes = append(m.scanTimes, scanTime)
 
-	// Increment total count
+	m.totalSymbols += symbolCount
 	m.totalScans++
+
+	// Update Prometheus metrics
+	m.scanDuration.Observe(scanTime)
+	m.scanCounter.Inc()
+	m.symbolsScanned.Add(float64(symbolCount))
+
+	if scanTime > 0 {
+		symbolsPerSecond := float64(symbolCount) / scanTime
+		m.symbolsPerSecond.Set(symbolsPerSecond)
+	}
+
+	// Update CPU usage metrics every 5 seconds
+	if time.Since(m.lastCPUCheckTime) > 5*time.Second {
+		m.updateCPUUsage()
+	}
 }
 
-// RecordFetch records metrics for a bulk fetch operation
-func (m *MetricTracker) RecordFetch(symbolsCount int, fetchTime float64) {
+// RecordFetch records metrics for a fetch operation
+func (m *MetricTracker) RecordFetch(symbolCount int, fetchTime float64) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// Add to fetch metrics
-	m.fetchTimes = append(m.fetchTimes, fetchTime)
-	m.fetchedSymbols = append(m.fetchedSymbols, symbolsCount)
-
-	// Limit array size to last 100 entries
-	if len(m.fetchTimes) > 100 {
+	// Record fetch time, keeping only the last 100 entries
+	if len(m.fetchTimes) >= 100 {
 		m.fetchTimes = m.fetchTimes[1:]
-		m.fetchedSymbols = m.fetchedSymbols[1:]
 	}
+	m.fetchTimes = append(m.fetchTimes, fetchTime)
 
-	// Increment total count
 	m.totalFetches++
+
+	// Update Prometheus metrics
+	m.fetchDuration.Observe(fetchTime)
+	m.fetchCounter.Inc()
 }
 
-// GetMetrics returns current performance metrics
-func (m *MetricTracker) GetMetrics() Metrics {
+// RecordStrategyEvaluation records one strategy's evaluation of a symbol and
+// whether it raised a signal
+func (m *MetricTracker) RecordStrategyEvaluation(name string, seconds float64, signaled bool) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	metrics := Metrics{
-		AvgScanTime:      m.calculateAvgScanTime(),
-		SymbolsPerSecond: m.calculateSymbolsPerSecond(),
-		TotalScans:       m.totalScans,
-		MemoryUsage:      m.getMemoryUsage(),
-		CPUUsage:         0, // Not implemented in this version
+	name = strategyLabel(name)
+	stats := m.strategies[name]
+	if stats == nil {
+		stats = &strategyStats{}
+		m.strategies[name] = stats
 	}
+	stats.evaluations++
+	stats.seconds += seconds
 
-	m.lastUpdate = time.Now()
-	return metrics
+	m.strategyDuration.WithLabelValues(name).Observe(seconds)
+	if signaled {
+		stats.signals++
+		m.strategySignals.WithLabelValues(name).Inc()
+	}
 }
 
-// calculateAvgScanTime calculates the average scan time over recent scans
-func (m *MetricTracker) calculateAvgScanTime() float64 {
-	if len(m.scanTimes) == 0 {
-		return 0
+// RecordProviderFetch records a historical data fetch from a data provider,
+// which failed when err is not nil
+func (m *MetricTracker) RecordProviderFetch(provider string, seconds float64, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := m.provider(provider)
+	stats.fetches++
+	stats.seconds += seconds
+
+	m.providerDuration.WithLabelValues(providerLabel(provider)).Observe(seconds)
+	if err != nil {
+		stats.errors++
+		m.providerErrors.WithLabelValues(providerLabel(provider)).Inc()
 	}
+}
 
-	sum := 0.0
-	for _, t := range m.scanTimes {
-		sum += t
+// RecordDeduplicatedFetch records a fetch from provider that shared an
+// identical fetch in flight
+func (m *MetricTracker) RecordDeduplicatedFetch(provider string) {
+	m.providerShared.WithLabelValues(providerLabel(provider)).Inc()
+}
+
+// RecordAggregatedFetch records a request for daily bars of provider served
+// by aggregating cached intraday bars
+func (m *MetricTracker) RecordAggregatedFetch(provider string) {
+	m.cacheAggregated.WithLabelValues(providerLabel(provider)).Inc()
+}
+
+// RecordInjectedFault records a fault injected in front of provider, which
+// is not counted among its errors
+func (m *MetricTracker) RecordInjectedFault(provider, fault string) {
+	m.injectedFaults.WithLabelValues(providerLabel(provider), fault).Inc()
+}
+
+// RecordDataQualityIssues counts the issues of a data quality check by type
+func (m *MetricTracker) RecordDataQualityIssues(issues map[string]int) {
+	for issue, n := range issues {
+		m.qualityIssues.WithLabelValues(issue).Add(float64(n))
 	}
+}
 
-	return sum / float64(len(m.scanTimes))
+// RecordCacheHit records a lookup served entirely from the cache in front of
+// provider
+func (m *MetricTracker) RecordCacheHit(provider string) {
+	m.recordCacheLookup(provider, cacheResultHit)
 }
 
-// calculateSymbolsPerSecond calculates the average symbols processed per second
-func (m *MetricTracker) calculateSymbolsPerSecond() float64 {
-	if len(m.scanTimes) == 0 || len(m.symbolsCounts) == 0 {
-		return 0
+// RecordCacheDiskHit records a lookup served entirely from the disk cache
+// after the memory cache missed
+func (m *MetricTracker) RecordCacheDiskHit(provider string) {
+	m.recordCacheLookup(provider, cacheResultDiskHit)
+}
+
+// RecordCachePartialHit records a lookup served partly from the cache, with the
+// rest fetched from the provider
+func (m *MetricTracker) RecordCachePartialHit(provider string) {
+	m.recordCacheLookup(provider, cacheResultPartial)
+}
+
+// RecordCacheMiss records a lookup fetched entirely from the provider
+func (m *MetricTracker) RecordCacheMiss(provider string) {
+	m.recordCacheLookup(provider, cacheResultMiss)
+}
+
+// recordCacheLookup counts a cache lookup and updates the hit rate, which only
+// counts full hits, from memory or disk. Lookups in front of an unnamed
+// provider are only counted in the totals.
+func (m *MetricTracker) recordCacheLookup(provider, result string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch result {
+	case cacheResultHit:
+		m.cacheHits++
+	case cacheResultDiskHit:
+		m.cacheDiskHits++
+	case cacheResultPartial:
+		m.cachePartialHits++
 	}
+	m.cacheRequests++
+	m.cacheLookups.WithLabelValues(result).Inc()
 
-	totalSymbols := 0
-	totalTime := 0.0
+	if provider != "" {
+		stats := m.provider(provider)
+		stats.cacheRequests++
+		if result == cacheResultHit || result == cacheResultDiskHit {
+			stats.cacheHits++
+		}
+	}
+
+	// Update cache hit rate
+	hitRate := float64(m.cacheHits+m.cacheDiskHits) / float64(m.cacheRequests)
+	m.cacheHitRateGauge.Set(hitRate * 100) // percentage
+}
+
+// RecordScheduledScan records the start time and duration of a scheduled scan
+func (m *MetricTracker) RecordScheduledScan(start time.Time, duration float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastScheduledScan = start
+	m.lastScheduledScanSeconds = duration
+}
 
-	for i := range m.scanTimes {
-		totalSymbols += m.symbolsCounts[i]
-		totalTime += m.scanTimes[i]
+// RecordScheduledScanSkipped records a scheduled scan skipped because the
+// previous one was still running
+func (m *MetricTracker) RecordScheduledScanSkipped() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.scheduledScansSkipped++
+}
+
+// IncrementErrorCount increments the error counter
+func (m *MetricTracker) IncrementErrorCount() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.errorCount++
+	m.errorCounter.Inc()
+}
+
+// GetMetrics returns the current metrics
+func (m *MetricTracker) GetMetrics() MetricsData {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	// Calculate average scan time
+	var avgScanTime float64
+	if len(m.scanTimes) > 0 {
+		sum := 0.0
+		for _, t := range m.scanTimes {
+			sum += t
+		}
+		avgScanTime = sum / float64(len(m.scanTimes))
+	}
+
+	// Calculate symbols per second
+	var symbolsPerSecond float64
+	if m.totalScans > 0 && avgScanTime > 0 {
+		symbolsPerSecond = float64(m.totalSymbols) / float64(m.totalScans) / avgScanTime
+	}
+
+	// Calculate cache hit rate
+	var cacheHitRate float64
+	if m.cacheRequests > 0 {
+		cacheHitRate = float64(m.cacheHits+m.cacheDiskHits) / float64(m.cacheRequests) * 100
+	}
+
+	return MetricsData{
+		AvgScanTime:      avgScanTime,
+		SymbolsPerSecond: symbolsPerSecond,
+		TotalScans:       m.totalScans,
+		TotalFetches:     m.totalFetches,
+		CPUUsage:         m.lastCPUPercentage,
+		ErrorCount:       m.errorCount,
+		CacheHitRate:     cacheHitRate,
+		CacheHits:        m.cacheHits,
+		CacheDiskHits:    m.cacheDiskHits,
+		CachePartialHits: m.cachePartialHits,
+		CacheMisses:      m.cacheRequests - m.cacheHits - m.cacheDiskHits - m.cachePartialHits,
+
+		LastScheduledScan:        m.lastScheduledScan,
+		LastScheduledScanSeconds: m.lastScheduledScanSeconds,
+		ScheduledScansSkipped:    m.scheduledScansSkipped,
+
+		Strategies: m.strategyMetrics(),
+		Providers:  m.providerMetrics(),
+
+		ProcessStartTime:     m.startTime,
+		CountersRestoredFrom: m.restoredFrom,
 	}
+}
 
-	if totalTime == 0 {
-		return 0
+// strategyMetrics returns the per-strategy breakdown in name order
+func (m *MetricTracker) strategyMetrics() []StrategyMetrics {
+	metrics := make([]StrategyMetrics, 0, len(m.strategies))
+	for name, stats := range m.strategies {
+		metrics = append(metrics, StrategyMetrics{
+			Name:        name,
+			AvgMs:       stats.seconds / float64(stats.evaluations) * 1000,
+			Evaluations: stats.evaluations,
+			Signals:     stats.signals,
+		})
 	}
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].Name < metrics[j].Name })
+	return metrics
+}
 
-	return float64(totalSymbols) / totalTime
+// providerMetrics returns the per-provider breakdown in name order
+func (m *MetricTracker) providerMetrics() []ProviderMetrics {
+	metrics := make([]ProviderMetrics, 0, len(m.providers))
+	for name, stats := range m.providers {
+		provider := ProviderMetrics{Name: name, Fetches: stats.fetches, Errors: stats.errors}
+		if stats.fetches > 0 {
+			provider.AvgMs = stats.seconds / float64(stats.fetches) * 1000
+		}
+		if stats.cacheRequests > 0 {
+			provider.CacheHitRate = float64(stats.cacheHits) / float64(stats.cacheRequests) * 100
+		}
+		metrics = append(metrics, provider)
+	}
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].Name < metrics[j].Name })
+	return metrics
 }
 
-// getMemoryUsage returns current memory usage in MB
-func (m *MetricTracker) getMemoryUsage() float64 {
-	var memStats runtime.MemStats
-	runtime.ReadMemStats(&memStats)
+// provider returns the running totals of provider, creating them when absent
+func (m *MetricTracker) provider(name string) *providerStats {
+	name = providerLabel(name)
+	stats := m.providers[name]
+	if stats == nil {
+		stats = &providerStats{}
+		m.providers[name] = stats
+	}
+	return stats
+}
+
+// strategyLabel returns name when it is a registered strategy, otherLabel
+// otherwise
+func strategyLabel(name string) string {
+	if _, ok := strategy.Lookup(name); ok {
+		return name
+	}
+	return otherLabel
+}
 
-	// Convert to MB
-	memUsageMB := float64(memStats.Alloc) / (1024 * 1024)
+// providerLabel returns name when it is one of providerTypes, otherLabel
+// otherwise
+func providerLabel(name string) string {
+	if slices.Contains(providerTypes, name) {
+		return name
+	}
+	return otherLabel
+}
 
-	return memUsageMB
+// updateCPUUsage updates the CPU usage metric
+func (m *MetricTracker) updateCPUUsage() {
+	// Get CPU usage
+	percent, err := cpu.Percent(0, false)
+	if err == nil && len(percent) > 0 {
+		m.lastCPUPercentage = percent[0]
+		m.cpuUsageGauge.Set(m.lastCPUPercentage)
+	}
+	m.lastCPUCheckTime = time.Now()
 }
@@ -0,0 +1,146 @@
+package scanner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// defaultSnapshotInterval is used when MetricsSnapshotInterval is zero
+const defaultSnapshotInterval = time.Minute
+
+// metricsSnapshot is the counter state kept across restarts. Scan and fetch
+// times, and so averages and rates, start empty after a restore.
+type metricsSnapshot struct {
+	SavedAt               time.Time `json:"saved_at"`
+	TotalScans            int       `json:"total_scans"`
+	TotalSymbols          int       `json:"total_symbols"`
+	TotalFetches          int       `json:"total_fetches"`
+	ErrorCount            int       `json:"error_count"`
+	CacheHits             int       `json:"cache_hits"`
+	CacheDiskHits         int       `json:"cache_disk_hits"`
+	CachePartialHits      int       `json:"cache_partial_hits"`
+	CacheRequests         int       `json:"cache_requests"`
+	ScheduledScansSkipped int       `json:"scheduled_scans_skipped"`
+}
+
+// SaveSnapshot writes the counters to path, replacing the previous snapshot
+// only once the new one is complete
+func (m *MetricTracker) SaveSnapshot(path string) error {
+	m.mu.RLock()
+	snapshot := metricsSnapshot{
+		SavedAt:               time.Now().UTC(),
+		TotalScans:            m.totalScans,
+		TotalSymbols:          m.totalSymbols,
+		TotalFetches:          m.totalFetches,
+		ErrorCount:            m.errorCount,
+		CacheHits:             m.cacheHits,
+		CacheDiskHits:         m.cacheDiskHits,
+		CachePartialHits:      m.cachePartialHits,
+		CacheRequests:         m.cacheRequests,
+		ScheduledScansSkipped: m.scheduledScansSkipped,
+	}
+	m.mu.RUnlock()
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode metrics snapshot: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create metrics snapshot directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write metrics snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write metrics snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write metrics snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace metrics snapshot: %w", err)
+	}
+	return nil
+}
+
+// RestoreSnapshot adds the counters saved at path to the tracker's, including
+// the Prometheus counters. A missing file restores nothing; a corrupt one
+// returns an error and leaves the counters as they are.
+func (m *MetricTracker) RestoreSnapshot(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read metrics snapshot: %w", err)
+	}
+
+	var snapshot metricsSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("corrupt metrics snapshot %s: %w", path, err)
+	}
+	if snapshot.SavedAt.IsZero() {
+		return fmt.Errorf("corrupt metrics snapshot %s: no saved_at time", path)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.totalScans += snapshot.TotalScans
+	m.totalSymbols += snapshot.TotalSymbols
+	m.totalFetches += snapshot.TotalFetches
+	m.errorCount += snapshot.ErrorCount
+	m.cacheHits += snapshot.CacheHits
+	m.cacheDiskHits += snapshot.CacheDiskHits
+	m.cachePartialHits += snapshot.CachePartialHits
+	m.cacheRequests += snapshot.CacheRequests
+	m.scheduledScansSkipped += snapshot.ScheduledScansSkipped
+	m.restoredFrom = snapshot.SavedAt
+
+	m.scanCounter.Add(float64(snapshot.TotalScans))
+	m.symbolsScanned.Add(float64(snapshot.TotalSymbols))
+	m.fetchCounter.Add(float64(snapshot.TotalFetches))
+	m.errorCounter.Add(float64(snapshot.ErrorCount))
+	m.cacheLookups.WithLabelValues(cacheResultHit).Add(float64(snapshot.CacheHits))
+	m.cacheLookups.WithLabelValues(cacheResultDiskHit).Add(float64(snapshot.CacheDiskHits))
+	m.cacheLookups.WithLabelValues(cacheResultPartial).Add(float64(snapshot.CachePartialHits))
+	m.cacheLookups.WithLabelValues(cacheResultMiss).Add(float64(snapshot.CacheRequests - snapshot.CacheHits - snapshot.CacheDiskHits - snapshot.CachePartialHits))
+	if m.cacheRequests > 0 {
+		m.cacheHitRateGauge.Set(float64(m.cacheHits+m.cacheDiskHits) / float64(m.cacheRequests) * 100)
+	}
+
+	logrus.Infof("Restored metric counters saved at %s from %s", snapshot.SavedAt.Format(time.RFC3339), path)
+	return nil
+}
+
+// PersistSnapshots saves the counters to path every interval, or
+// defaultSnapshotInterval when it is zero, until ctx is done
+func (m *MetricTracker) PersistSnapshots(ctx context.Context, path string, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultSnapshotInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.SaveSnapshot(path); err != nil {
+				logrus.Errorf("Failed to save metrics snapshot: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsSnapshotRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "metrics.json")
+
+	before := NewMetricTracker(prometheus.NewRegistry())
+	before.RecordScan(10, 2)
+	before.RecordScan(30, 4)
+	before.RecordFetch(5, 1)
+	before.IncrementErrorCount()
+	before.RecordCacheHit("mock")
+	before.RecordCachePartialHit("mock")
+	before.RecordCacheMiss("mock")
+	before.RecordScheduledScanSkipped()
+	if err := before.SaveSnapshot(path); err != nil {
+		t.Fatalf("SaveSnapshot failed: %v", err)
+	}
+
+	// A restarted tracker continues the totals, with empty timings
+	after := NewMetricTracker(prometheus.NewRegistry())
+	if err := after.RestoreSnapshot(path); err != nil {
+		t.Fatalf("RestoreSnapshot failed: %v", err)
+	}
+	restored := after.GetMetrics()
+	if restored.TotalScans != 2 || restored.TotalFetches != 1 || restored.ErrorCount != 1 || restored.ScheduledScansSkipped != 1 {
+		t.Errorf("Restored counters: got %+v", restored)
+	}
+	if restored.CacheHits != 1 || restored.CachePartialHits != 1 || restored.CacheMisses != 1 {
+		t.Errorf("Restored cache lookups: got %d/%d/%d, want 1/1/1", restored.CacheHits, restored.CachePartialHits, restored.CacheMisses)
+	}
+	if restored.AvgScanTime != 0 || restored.SymbolsPerSecond != 0 {
+		t.Errorf("Restored timings: got %v s and %v symbols/s, want none", restored.AvgScanTime, restored.SymbolsPerSecond)
+	}
+	if restored.CountersRestoredFrom.IsZero() || restored.CountersRestoredFrom.After(restored.ProcessStartTime) {
+		t.Errorf("CountersRestoredFrom: got %v, want the save time before %v", restored.CountersRestoredFrom, restored.ProcessStartTime)
+	}
+
+	after.RecordScan(20, 1)
+	after.IncrementErrorCount()
+	after.RecordCacheHit("mock")
+	continued := after.GetMetrics()
+	if continued.TotalScans != 3 || continued.ErrorCount != 2 || continued.CacheHits != 2 || continued.CacheHitRate != 50 {
+		t.Errorf("Continued counters: got %+v", continued)
+	}
+	if continued.SymbolsPerSecond != 20 {
+		t.Errorf("SymbolsPerSecond: got %v, want 60 symbols over 3 scans of 1s", continued.SymbolsPerSecond)
+	}
+	if scans := testutil.ToFloat64(after.scanCounter); scans != 3 {
+		t.Errorf("scanner_scan_total: got %v, want 3", scans)
+	}
+	if errs := testutil.ToFloat64(after.errorCounter); errs != 2 {
+		t.Errorf("scanner_errors_total: got %v, want 2", errs)
+	}
+}
+
+func TestRestoreSnapshotToleratesMissingAndCorruptFiles(t *testing.T) {
+	dir := t.TempDir()
+	tracker := NewMetricTracker(prometheus.NewRegistry())
+	tracker.IncrementErrorCount()
+
+	if err := tracker.RestoreSnapshot(filepath.Join(dir, "missing.json")); err != nil {
+		t.Errorf("Missing snapshot: got %v, want nil", err)
+	}
+
+	for name, content := range map[string]string{
+		"truncated.json": `{"saved_at": "2024-05-01T12:00:00Z", "total_sc`,
+		"empty.json":     `{}`,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := tracker.RestoreSnapshot(path); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	metrics := tracker.GetMetrics()
+	if metrics.ErrorCount != 1 || !metrics.CountersRestoredFrom.IsZero() {
+		t.Errorf("Counters after failed restores: got %+v", metrics)
+	}
+}
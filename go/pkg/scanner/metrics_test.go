@@ -0,0 +1,51 @@
+package scanner
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricTrackerBoundsBreakdownLabels(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	tracker := NewMetricTracker(reg)
+
+	tracker.RecordStrategyEvaluation("HIGH_BASE", 0.002, true)
+	tracker.RecordStrategyEvaluation("HIGH_BASE", 0.004, false)
+	for _, name := range []string{"UNREGISTERED_1", "UNREGISTERED_2"} {
+		tracker.RecordStrategyEvaluation(name, 0.001, true)
+	}
+	tracker.RecordProviderFetch("yahoo", 0.5, nil)
+	tracker.RecordProviderFetch("yahoo", 1.5, errors.New("rate limited"))
+	tracker.RecordProviderFetch("custom-feed", 0.1, nil)
+
+	metrics := tracker.GetMetrics()
+	want := []StrategyMetrics{
+		{Name: "HIGH_BASE", AvgMs: 3, Evaluations: 2, Signals: 1},
+		{Name: otherLabel, AvgMs: 1, Evaluations: 2, Signals: 2},
+	}
+	if len(metrics.Strategies) != len(want) {
+		t.Fatalf("Strategies: got %+v, want %+v", metrics.Strategies, want)
+	}
+	for i := range want {
+		if metrics.Strategies[i] != want[i] {
+			t.Errorf("Strategy %d: got %+v, want %+v", i, metrics.Strategies[i], want[i])
+		}
+	}
+	if len(metrics.Providers) != 2 || metrics.Providers[0].Name != otherLabel || metrics.Providers[1] != (ProviderMetrics{Name: "yahoo", AvgMs: 1000, Fetches: 2, Errors: 1}) {
+		t.Errorf("Providers: got %+v", metrics.Providers)
+	}
+
+	// Unregistered names share one series
+	if n := testutil.CollectAndCount(reg, "scanner_strategy_evaluation_duration_seconds"); n != 2 {
+		t.Errorf("Strategy duration series: got %d, want 2", n)
+	}
+	if n := testutil.CollectAndCount(reg, "scanner_provider_fetch_duration_seconds"); n != 2 {
+		t.Errorf("Provider duration series: got %d, want 2", n)
+	}
+	if errs := testutil.ToFloat64(tracker.providerErrors.WithLabelValues("yahoo")); errs != 1 {
+		t.Errorf("yahoo errors: got %v, want 1", errs)
+	}
+}
@@ -0,0 +1,100 @@
+package scanner
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// ScanProfile is a named set of scan settings, such as a morning momentum scan
+// and a mid-day mean reversion scan. A scan request naming the profile takes
+// the fields it leaves unset from it.
+type ScanProfile struct {
+	Strategies   []string                      `yaml:"strategies" json:"strategies"`
+	Parameters   map[string]map[string]float64 `yaml:"parameters" json:"parameters"`
+	BarSize      string                        `yaml:"bar_size" json:"bar_size"`
+	LookbackDays int                           `yaml:"lookback_days" json:"lookback_days"`
+	Symbols      []string                      `yaml:"symbols" json:"symbols"`
+}
+
+// applyProfile returns req with the fields it leaves unset taken from the
+// profile it names. Parameter overrides are merged per strategy with the
+// request's values winning, dropping the profile's for strategies the request
+// does not scan. Without a date range the scan covers the profile's lookback
+// up to now. A request naming no profile is returned as is.
+func applyProfile(req *pb.ScanRequest, profiles map[string]ScanProfile, now time.Time) (*pb.ScanRequest, error) {
+	if req.ProfileName == "" {
+		return req, nil
+	}
+	profile, ok := profiles[req.ProfileName]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "unknown scan profile %q", req.ProfileName)
+	}
+
+	resolved := proto.Clone(req).(*pb.ScanRequest)
+	if len(resolved.Symbols) == 0 {
+		resolved.Symbols = profile.Symbols
+	}
+	if len(resolved.Strategies) == 0 {
+		resolved.Strategies = profile.Strategies
+	}
+	if resolved.BarSize == "" {
+		resolved.BarSize = profile.BarSize
+	}
+	if resolved.DateRange == nil && profile.LookbackDays > 0 {
+		resolved.DateRange = &pb.DateRange{
+			StartDate: now.AddDate(0, 0, -profile.LookbackDays).Format(dateLayout),
+			EndDate:   now.Format(dateLayout),
+		}
+	}
+
+	scanned := make(map[string]bool, len(resolved.Strategies))
+	for _, name := range resolved.Strategies {
+		scanned[name] = true
+	}
+	for name, values := range profile.Parameters {
+		if len(scanned) > 0 && !scanned[name] {
+			continue
+		}
+		if resolved.Parameters == nil {
+			resolved.Parameters = make(map[string]*pb.StrategyParams)
+		}
+		merged := make(map[string]float64, len(values))
+		for param, value := range values {
+			merged[param] = value
+		}
+		for param, value := range resolved.Parameters[name].GetValues() {
+			merged[param] = value
+		}
+		resolved.Parameters[name] = &pb.StrategyParams{Values: merged}
+	}
+	return resolved, nil
+}
+
+// ListProfiles implements the ListProfiles RPC method
+func (s *Engine) ListProfiles(ctx context.Context, req *pb.ListProfilesRequest) (*pb.ListProfilesResponse, error) {
+	profiles := s.Config().Profiles
+
+	resp := &pb.ListProfilesResponse{Profiles: make([]*pb.ScanProfile, 0, len(profiles))}
+	for _, name := range sortedKeys(profiles) {
+		profile := profiles[name]
+		parameters := make(map[string]*pb.StrategyParams, len(profile.Parameters))
+		for strategyName, values := range profile.Parameters {
+			parameters[strategyName] = &pb.StrategyParams{Values: values}
+		}
+		resp.Profiles = append(resp.Profiles, &pb.ScanProfile{
+			Name:         name,
+			Strategies:   profile.Strategies,
+			Parameters:   parameters,
+			BarSize:      profile.BarSize,
+			LookbackDays: int32(profile.LookbackDays),
+			Symbols:      profile.Symbols,
+		})
+	}
+	return resp, nil
+}
@@ -0,0 +1,142 @@
+package scanner
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+var testProfiles = map[string]ScanProfile{
+	"momentum": {
+		Strategies: []string{"HIGH_BASE"},
+		Parameters: map[string]map[string]float64{
+			"HIGH_BASE": {"lookback": 30, "threshold": 0.9},
+			"LOW_BASE":  {"lookback": 40},
+		},
+		BarSize:      "30min",
+		LookbackDays: 10,
+		Symbols:      []string{"AAPL", "MSFT"},
+	},
+}
+
+func TestApplyProfilePrecedence(t *testing.T) {
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		req  *pb.ScanRequest
+		want *pb.ScanRequest
+	}{
+		{
+			name: "no profile",
+			req:  &pb.ScanRequest{Symbols: []string{"NVDA"}},
+			want: &pb.ScanRequest{Symbols: []string{"NVDA"}},
+		},
+		{
+			name: "profile fills unset fields",
+			req:  &pb.ScanRequest{ProfileName: "momentum"},
+			want: &pb.ScanRequest{
+				ProfileName: "momentum",
+				Symbols:     []string{"AAPL", "MSFT"},
+				Strategies:  []string{"HIGH_BASE"},
+				BarSize:     "30min",
+				DateRange:   &pb.DateRange{StartDate: "2024-03-05", EndDate: "2024-03-15"},
+				Parameters: map[string]*pb.StrategyParams{
+					"HIGH_BASE": {Values: map[string]float64{"lookback": 30, "threshold": 0.9}},
+				},
+			},
+		},
+		{
+			name: "request fields override the profile",
+			req: &pb.ScanRequest{
+				ProfileName: "momentum",
+				Symbols:     []string{"NVDA"},
+				Strategies:  []string{"HIGH_BASE", "LOW_BASE"},
+				BarSize:     "1day",
+				DateRange:   &pb.DateRange{StartDate: "2024-01-02", EndDate: "2024-01-31"},
+				Parameters: map[string]*pb.StrategyParams{
+					"HIGH_BASE": {Values: map[string]float64{"threshold": 0.8}},
+				},
+			},
+			want: &pb.ScanRequest{
+				ProfileName: "momentum",
+				Symbols:     []string{"NVDA"},
+				Strategies:  []string{"HIGH_BASE", "LOW_BASE"},
+				BarSize:     "1day",
+				DateRange:   &pb.DateRange{StartDate: "2024-01-02", EndDate: "2024-01-31"},
+				Parameters: map[string]*pb.StrategyParams{
+					"HIGH_BASE": {Values: map[string]float64{"lookback": 30, "threshold": 0.8}},
+					"LOW_BASE":  {Values: map[string]float64{"lookback": 40}},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyProfile(tt.req, testProfiles, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !proto.Equal(got, tt.want) {
+				t.Errorf("applyProfile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	_, err := applyProfile(&pb.ScanRequest{ProfileName: "reversion"}, testProfiles, now)
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("applyProfile(unknown) error = %v, want NotFound", err)
+	}
+}
+
+func TestScanWithProfile(t *testing.T) {
+	service := newTestService(t)
+	cfg := service.Config()
+	cfg.Profiles = map[string]ScanProfile{
+		"daily": {Strategies: []string{"HIGH_BASE"}, LookbackDays: 60, Symbols: []string{"AAPL"}},
+	}
+
+	resp, err := service.Scan(context.Background(), &pb.ScanRequest{ProfileName: "daily"})
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if _, ok := resp.Parameters["HIGH_BASE"]; !ok || len(resp.Parameters) != 1 {
+		t.Errorf("Scan evaluated %v, want only the profile's HIGH_BASE", resp.Parameters)
+	}
+
+	_, err = service.Scan(context.Background(), &pb.ScanRequest{ProfileName: "weekly"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Scan(unknown profile) error = %v, want NotFound", err)
+	}
+
+	listed, err := service.ListProfiles(context.Background(), &pb.ListProfilesRequest{})
+	if err != nil || len(listed.Profiles) != 1 || listed.Profiles[0].Name != "daily" || listed.Profiles[0].LookbackDays != 60 {
+		t.Errorf("ListProfiles() = %v, %v", listed, err)
+	}
+}
+
+func TestScheduledScanRequestUsesProfile(t *testing.T) {
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	cfg := DefaultConfig()
+	cfg.ScanLookbackDays = 30
+	cfg.Profiles = testProfiles
+
+	req := scheduledScanRequest(cfg, now)
+	if req.ProfileName != "" || !reflect.DeepEqual(req.Strategies, cfg.ScanStrategies) || req.DateRange.StartDate != "2024-02-14" {
+		t.Errorf("Request without a profile = %v", req)
+	}
+
+	cfg.ScanProfile = "momentum"
+	req = scheduledScanRequest(cfg, now)
+	if req.ProfileName != "momentum" || req.Strategies != nil || req.DateRange != nil {
+		t.Errorf("Request with a profile = %v, want the profile's strategies and lookback", req)
+	}
+}
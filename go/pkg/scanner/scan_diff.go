@@ -0,0 +1,104 @@
+package scanner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// diffKey identifies a signal across scans
+type diffKey struct {
+	symbol    string
+	strategy  string
+	direction string
+}
+
+// diffBaseline is the latest scan of a profile, which the next scan of the
+// profile is compared with
+type diffBaseline struct {
+	time       time.Time
+	strategies []string // sorted
+	spec       string
+	signals    map[diffKey]*pb.RankedSignal
+}
+
+// scanDiffs keeps the latest scan of each profile, "" for scans naming none
+type scanDiffs struct {
+	mu        sync.Mutex
+	baselines map[string]diffBaseline
+}
+
+// record keeps a finished scan as its profile's baseline and returns how its
+// signals differ from the previous baseline. A scan finishing after a later
+// scan of the profile is compared but not kept.
+func (d *scanDiffs) record(profile string, start time.Time, strategies []string, spec BarSpec, signals []*pb.RankedSignal) *pb.ScanDiff {
+	current := diffBaseline{
+		time:       start,
+		strategies: append([]string(nil), strategies...),
+		spec:       spec.String(),
+		signals:    make(map[diffKey]*pb.RankedSignal, len(signals)),
+	}
+	sort.Strings(current.strategies)
+	for _, signal := range signals {
+		current.signals[diffKey{signal.Symbol, signal.Strategy, signal.Direction}] = signal
+	}
+
+	d.mu.Lock()
+	previous, ok := d.baselines[profile]
+	if !ok || !start.Before(previous.time) {
+		if d.baselines == nil {
+			d.baselines = make(map[string]diffBaseline)
+		}
+		d.baselines[profile] = current
+	}
+	d.mu.Unlock()
+
+	if !ok {
+		return &pb.ScanDiff{Reason: "no previous scan " + profileDescription(profile)}
+	}
+	return current.diff(previous)
+}
+
+// diff compares the scan's signals with those of previous, or explains why
+// the scans are not comparable
+func (b diffBaseline) diff(previous diffBaseline) *pb.ScanDiff {
+	diff := &pb.ScanDiff{PreviousScanTime: previous.time.UTC().Format(time.RFC3339)}
+	switch {
+	case strings.Join(b.strategies, ",") != strings.Join(previous.strategies, ","):
+		diff.Reason = fmt.Sprintf("previous scan evaluated %s, not %s",
+			strings.Join(previous.strategies, ", "), strings.Join(b.strategies, ", "))
+		return diff
+	case b.spec != previous.spec:
+		diff.Reason = fmt.Sprintf("previous scan used %s bars, not %s", previous.spec, b.spec)
+		return diff
+	}
+
+	for key, signal := range b.signals {
+		if previous.signals[key] != nil {
+			diff.Unchanged = append(diff.Unchanged, signal)
+		} else {
+			diff.Added = append(diff.Added, signal)
+		}
+	}
+	for key, signal := range previous.signals {
+		if b.signals[key] == nil {
+			diff.Removed = append(diff.Removed, signal)
+		}
+	}
+	diff.Added = rankSignals(diff.Added, 0)
+	diff.Removed = rankSignals(diff.Removed, 0)
+	diff.Unchanged = rankSignals(diff.Unchanged, 0)
+	return diff
+}
+
+// profileDescription names the scans of profile for a diff's reason
+func profileDescription(profile string) string {
+	if profile == "" {
+		return "without a profile"
+	}
+	return fmt.Sprintf("of profile %q", profile)
+}
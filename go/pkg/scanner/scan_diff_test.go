@@ -0,0 +1,175 @@
+package scanner
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// shiftingProvider serves rising bars, on which HIGH_BASE signals LONG, for
+// the symbols currently rising and falling bars, which signal nothing, for
+// the others
+type shiftingProvider struct {
+	mu     sync.Mutex
+	rising map[string]bool
+}
+
+func (p *shiftingProvider) rise(symbols ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rising = make(map[string]bool, len(symbols))
+	for _, symbol := range symbols {
+		p.rising[symbol] = true
+	}
+}
+
+func (p *shiftingProvider) GetHistoricalData(ctx context.Context, symbol, startDate, endDate string, spec BarSpec) ([]MarketData, error) {
+	p.mu.Lock()
+	rising := p.rising[symbol]
+	p.mu.Unlock()
+
+	bars := risingBars(symbol, startDate, endDate)
+	if !rising {
+		for i := range bars {
+			close := 200 - float64(i)
+			bars[i].Open, bars[i].High, bars[i].Low, bars[i].Close = close, close+1, close-1, close
+		}
+	}
+	return bars, nil
+}
+
+// diffSymbols returns the symbols of diffed signals
+func diffSymbols(signals []*pb.RankedSignal) []string {
+	symbols := []string{}
+	for _, signal := range signals {
+		symbols = append(symbols, signal.Symbol)
+	}
+	return symbols
+}
+
+func TestScanDiffAgainstPreviousScan(t *testing.T) {
+	service := newTestService(t)
+	provider := &shiftingProvider{}
+	useProvider(service, provider)
+	scan := func(strategies ...string) *pb.ScanDiff {
+		t.Helper()
+		resp, err := service.Scan(context.Background(), &pb.ScanRequest{
+			Symbols:     []string{"AAPL", "MSFT", "XOM"},
+			Strategies:  strategies,
+			DateRange:   testDateRange(),
+			IncludeDiff: true,
+			MaxResults:  1,
+		})
+		if err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+		return resp.Diff
+	}
+
+	provider.rise("AAPL", "MSFT")
+	first := scan("HIGH_BASE")
+	if first.Reason != "no previous scan without a profile" || len(first.Added)+len(first.Removed)+len(first.Unchanged) != 0 {
+		t.Errorf("First scan's diff = %v, want it empty for want of a previous scan", first)
+	}
+
+	// Signals beyond max_results are diffed too
+	provider.rise("MSFT", "XOM")
+	second := scan("HIGH_BASE")
+	if second.Reason != "" || second.PreviousScanTime == "" {
+		t.Fatalf("Second scan's diff = %v, want it against the first scan", second)
+	}
+	for name, got := range map[string][]*pb.RankedSignal{"Added": second.Added, "Removed": second.Removed, "Unchanged": second.Unchanged} {
+		want := map[string][]string{"Added": {"XOM"}, "Removed": {"AAPL"}, "Unchanged": {"MSFT"}}[name]
+		if symbols := diffSymbols(got); !reflect.DeepEqual(symbols, want) {
+			t.Errorf("%s = %v, want %v", name, symbols, want)
+		}
+	}
+	if removed := second.Removed[0]; removed.Strategy != "HIGH_BASE" || removed.Direction != "LONG" || removed.Score <= 0 {
+		t.Errorf("Removed signal = %v, want the first scan's HIGH_BASE LONG with its score", removed)
+	}
+
+	// Other strategies are not comparable, but become the next baseline
+	other := scan("HIGH_BASE", "LOW_BASE")
+	if !strings.Contains(other.Reason, "evaluated HIGH_BASE, not HIGH_BASE, LOW_BASE") || len(other.Added) != 0 {
+		t.Errorf("Diff against other strategies = %v, want an empty diff with the reason", other)
+	}
+	if again := scan("LOW_BASE", "HIGH_BASE"); again.Reason != "" || !reflect.DeepEqual(diffSymbols(again.Unchanged), []string{"MSFT", "XOM"}) {
+		t.Errorf("Diff against the same strategies in another order = %v, want MSFT and XOM unchanged", again)
+	}
+}
+
+func TestScanDiffOnlyWhenRequested(t *testing.T) {
+	service := newTestService(t)
+	req := &pb.ScanRequest{Symbols: []string{"AAPL"}, Strategies: []string{"HIGH_BASE"}, DateRange: testDateRange()}
+	for i := 0; i < 2; i++ {
+		resp, err := service.Scan(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Diff != nil {
+			t.Errorf("Scan %d without include_diff returned diff %v", i, resp.Diff)
+		}
+	}
+
+	// A profile's scans are diffed against its own
+	cfg := *service.Config()
+	cfg.Profiles = map[string]ScanProfile{"momentum": {Strategies: []string{"HIGH_BASE"}}}
+	service.UpdateConfig(&cfg)
+	useProvider(service, risingProvider{})
+	resp, err := service.Scan(context.Background(), &pb.ScanRequest{Symbols: []string{"AAPL"}, ProfileName: "momentum", DateRange: testDateRange(), IncludeDiff: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Diff.GetReason() != `no previous scan of profile "momentum"` {
+		t.Errorf("First profile scan's diff = %v, want no previous scan of the profile", resp.Diff)
+	}
+}
+
+func TestSchedulerPushesOnlyTheDiff(t *testing.T) {
+	pushes := make(chan scheduledPush, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body scheduledPush
+		if err := json.NewDecoder(r.Body).Decode(&body); err == nil {
+			pushes <- body
+		}
+	}))
+	defer server.Close()
+
+	provider := &shiftingProvider{}
+	provider.rise("AAPL")
+	service := newScheduledService(t, time.Hour, provider)
+	cfg := *service.Config()
+	cfg.ScanPushURL = server.URL
+	cfg.ScanPushDiffOnly = true
+	service.UpdateConfig(&cfg)
+	useProvider(service, provider)
+
+	// The first scan has no previous scan to compare with, so pushes why
+	service.runScheduledScan(context.Background(), &cfg)
+	first := <-pushes
+	if first.Results != nil || first.Diff == nil || first.Diff.Reason == "" {
+		t.Errorf("First push = %+v, want the diff's reason without results", first)
+	}
+
+	// Nothing changed, so nothing is pushed
+	service.runScheduledScan(context.Background(), &cfg)
+
+	provider.rise("MSFT")
+	service.runScheduledScan(context.Background(), &cfg)
+	third := <-pushes
+	if diff := third.Diff; diff == nil || len(diff.Added) != 1 || diff.Added[0].Symbol != "MSFT" ||
+		len(diff.Removed) != 1 || diff.Removed[0].Symbol != "AAPL" || diff.Unchanged != 0 {
+		t.Errorf("Third push = %+v, want MSFT added and AAPL removed", third.Diff)
+	}
+	if len(pushes) != 0 {
+		t.Errorf("%d unexpected pushes", len(pushes))
+	}
+}
@@ -0,0 +1,131 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// historySignal is one signal of a scan kept in the history
+type historySignal struct {
+	symbol   string
+	strategy string
+	signal   string
+}
+
+// scanSnapshot is a scan kept in the history. Only its signals are kept, as
+// symbol, strategy and signal tuples, so that old scans take little memory.
+type scanSnapshot struct {
+	time        time.Time
+	request     *pb.ScanRequest // without symbols
+	symbolCount int
+	signals     []historySignal // sorted by symbol
+}
+
+// scanHistory keeps the latest scans, oldest first
+type scanHistory struct {
+	mu    sync.RWMutex
+	scans []scanSnapshot
+}
+
+// record adds a finished scan, dropping the oldest ones beyond size
+func (h *scanHistory) record(start time.Time, req *pb.ScanRequest, symbolCount int, resp *pb.ScanResponse, size int) {
+	if size <= 0 {
+		return
+	}
+	request := proto.Clone(req).(*pb.ScanRequest)
+	request.Symbols = nil
+
+	snapshot := scanSnapshot{time: start, request: request, symbolCount: symbolCount}
+	for _, symbol := range sortedKeys(resp.Signals) {
+		list := resp.Signals[symbol]
+		for i, signal := range list.SignalTypes {
+			entry := historySignal{symbol: symbol, signal: signal}
+			if i < len(list.Strategies) {
+				entry.strategy = list.Strategies[i]
+			}
+			snapshot.signals = append(snapshot.signals, entry)
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// Concurrent scans may finish out of order
+	at := sort.Search(len(h.scans), func(i int) bool { return h.scans[i].time.After(start) })
+	h.scans = append(h.scans, scanSnapshot{})
+	copy(h.scans[at+1:], h.scans[at:])
+	h.scans[at] = snapshot
+	if len(h.scans) > size {
+		h.scans = append([]scanSnapshot(nil), h.scans[len(h.scans)-size:]...)
+	}
+}
+
+// latestBefore returns the latest scan started before t
+func (h *scanHistory) latestBefore(t time.Time) (scanSnapshot, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for i := len(h.scans) - 1; i >= 0; i-- {
+		if h.scans[i].time.Before(t) {
+			return h.scans[i], true
+		}
+	}
+	return scanSnapshot{}, false
+}
+
+// since returns the scans started at or after t, oldest first
+func (h *scanHistory) since(t time.Time) []scanSnapshot {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	first := sort.Search(len(h.scans), func(i int) bool { return !h.scans[i].time.Before(t) })
+	return append([]scanSnapshot(nil), h.scans[first:]...)
+}
+
+// signalLists rebuilds the signal lists of the snapshot's symbols, or of
+// symbol alone when it is not empty
+func (s scanSnapshot) signalLists(symbol string) map[string]*pb.SignalList {
+	lists := make(map[string]*pb.SignalList)
+	for _, entry := range s.signals {
+		if symbol != "" && entry.symbol != symbol {
+			continue
+		}
+		list := lists[entry.symbol]
+		if list == nil {
+			list = &pb.SignalList{}
+			lists[entry.symbol] = list
+		}
+		list.SignalTypes = append(list.SignalTypes, entry.signal)
+		list.Strategies = append(list.Strategies, entry.strategy)
+	}
+	return lists
+}
+
+// GetScanHistory implements the GetScanHistory RPC method
+func (s *Engine) GetScanHistory(ctx context.Context, req *pb.ScanHistoryRequest) (*pb.ScanHistoryResponse, error) {
+	var since time.Time
+	if req.Since != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, req.Since); err != nil {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("since must be an RFC3339 time: %v", err))
+		}
+	}
+
+	snapshots := s.history.since(since)
+	resp := &pb.ScanHistoryResponse{Scans: make([]*pb.ScanSnapshot, len(snapshots))}
+	for i, snapshot := range snapshots {
+		resp.Scans[i] = &pb.ScanSnapshot{
+			ScanTime:    snapshot.time.UTC().Format(time.RFC3339),
+			Request:     snapshot.request,
+			SymbolCount: int32(snapshot.symbolCount),
+			Signals:     snapshot.signalLists(req.Symbol),
+		}
+	}
+	return resp, nil
+}
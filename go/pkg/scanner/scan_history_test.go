@@ -0,0 +1,161 @@
+package scanner
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// runHistoryScans scans each group of symbols in turn, then dates the kept
+// scans an hour apart from base so that time slices can be queried
+func runHistoryScans(t *testing.T, service *ScannerService, base time.Time, groups ...[]string) {
+	t.Helper()
+	for _, symbols := range groups {
+		if _, err := service.Scan(context.Background(), &pb.ScanRequest{
+			Symbols:    symbols,
+			Strategies: []string{"HIGH_BASE"},
+			DateRange:  testDateRange(),
+		}); err != nil {
+			t.Fatalf("Scan(%v) failed: %v", symbols, err)
+		}
+	}
+
+	service.history.mu.Lock()
+	defer service.history.mu.Unlock()
+	for i := range service.history.scans {
+		service.history.scans[i].time = base.Add(time.Duration(i) * time.Hour)
+	}
+}
+
+// historySymbols returns the symbols with signals in each scan
+func historySymbols(resp *pb.ScanHistoryResponse) [][]string {
+	out := make([][]string, len(resp.Scans))
+	for i, scan := range resp.Scans {
+		out[i] = []string{}
+		for symbol := range scan.Signals {
+			out[i] = append(out[i], symbol)
+		}
+		sort.Strings(out[i])
+	}
+	return out
+}
+
+func TestGetScanHistory(t *testing.T) {
+	service := newTestService(t)
+	base := time.Date(2024, 3, 15, 14, 0, 0, 0, time.UTC)
+	runHistoryScans(t, service, base,
+		[]string{"AAPL", "MSFT"},
+		[]string{"XOM"},
+		[]string{"AAPL", "XOM"},
+	)
+
+	all, err := service.GetScanHistory(context.Background(), &pb.ScanHistoryRequest{})
+	if err != nil {
+		t.Fatalf("GetScanHistory failed: %v", err)
+	}
+	want := [][]string{{"AAPL", "MSFT"}, {"XOM"}, {"AAPL", "XOM"}}
+	if got := historySymbols(all); !reflect.DeepEqual(got, want) {
+		t.Errorf("History symbols = %v, want %v", got, want)
+	}
+	first := all.Scans[0]
+	if first.ScanTime != "2024-03-15T14:00:00Z" || first.SymbolCount != 2 {
+		t.Errorf("First scan = %s with %d symbols, want 14:00 with 2", first.ScanTime, first.SymbolCount)
+	}
+	if first.Request.Symbols != nil || !reflect.DeepEqual(first.Request.Strategies, []string{"HIGH_BASE"}) {
+		t.Errorf("Kept request = %v, want the strategies without the symbols", first.Request)
+	}
+	if aapl := first.Signals["AAPL"]; aapl.SignalTypes[0] != "LONG" || aapl.Strategies[0] != "HIGH_BASE" {
+		t.Errorf("AAPL signals = %v, want LONG from HIGH_BASE", aapl)
+	}
+
+	tests := []struct {
+		name string
+		req  *pb.ScanHistoryRequest
+		want [][]string
+	}{
+		{"since", &pb.ScanHistoryRequest{Since: "2024-03-15T15:00:00Z"}, [][]string{{"XOM"}, {"AAPL", "XOM"}}},
+		{"symbol", &pb.ScanHistoryRequest{Symbol: "AAPL"}, [][]string{{"AAPL"}, {}, {"AAPL"}}},
+		{"symbol since", &pb.ScanHistoryRequest{Symbol: "MSFT", Since: "2024-03-15T14:30:00Z"}, [][]string{{}, {}}},
+		{"after the last scan", &pb.ScanHistoryRequest{Since: "2024-03-16T00:00:00Z"}, [][]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := service.GetScanHistory(context.Background(), tt.req)
+			if err != nil {
+				t.Fatalf("GetScanHistory failed: %v", err)
+			}
+			if got := historySymbols(resp); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("History symbols = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	_, err = service.GetScanHistory(context.Background(), &pb.ScanHistoryRequest{Since: "yesterday"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("GetScanHistory with a bad since = %v, want InvalidArgument", err)
+	}
+}
+
+func TestScanHistoryKeepsTheLatestScans(t *testing.T) {
+	service := newTestService(t)
+	cfg := *service.Config()
+	cfg.ScanHistorySize = 2
+	service.UpdateConfig(&cfg)
+
+	base := time.Date(2024, 3, 15, 14, 0, 0, 0, time.UTC)
+	runHistoryScans(t, service, base, []string{"AAPL"}, []string{"MSFT"}, []string{"XOM"})
+
+	resp, err := service.GetScanHistory(context.Background(), &pb.ScanHistoryRequest{})
+	if err != nil {
+		t.Fatalf("GetScanHistory failed: %v", err)
+	}
+	if got, want := historySymbols(resp), [][]string{{"MSFT"}, {"XOM"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("History symbols = %v, want %v", got, want)
+	}
+}
+
+func TestGetScanResultsOlderThan(t *testing.T) {
+	service := newTestService(t)
+	base := time.Date(2024, 3, 15, 14, 0, 0, 0, time.UTC)
+	runHistoryScans(t, service, base, []string{"AAPL", "MSFT"}, []string{"XOM"})
+
+	tests := []struct {
+		olderThan string
+		want      []string
+	}{
+		{"", []string{"XOM"}},
+		{"2024-03-15T16:00:00Z", []string{"XOM"}},
+		{"2024-03-15T15:00:00Z", []string{"AAPL", "MSFT"}},
+		{"2024-03-15T14:00:00Z", []string{}},
+	}
+	for _, tt := range tests {
+		resp, err := service.GetScanResults(context.Background(), &pb.ResultsRequest{OlderThan: tt.olderThan})
+		if err != nil {
+			t.Fatalf("GetScanResults(%q) failed: %v", tt.olderThan, err)
+		}
+		got := []string{}
+		for symbol := range resp.Signals {
+			got = append(got, symbol)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GetScanResults(%q) symbols = %v, want %v", tt.olderThan, got, tt.want)
+		}
+	}
+
+	limited, err := service.GetScanResults(context.Background(), &pb.ResultsRequest{OlderThan: "2024-03-15T15:00:00Z", Limit: 1})
+	if err != nil || len(limited.Signals) != 1 || limited.Signals["AAPL"] == nil {
+		t.Errorf("Limited older results = %v, %v; want AAPL only", limited, err)
+	}
+
+	if _, err := service.GetScanResults(context.Background(), &pb.ResultsRequest{OlderThan: "3pm"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("GetScanResults with a bad older_than = %v, want InvalidArgument", err)
+	}
+}
@@ -0,0 +1,126 @@
+package scanner
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// Phases of a scanned symbol timed by scanTimings
+const (
+	phaseFetch    = "fetch"
+	phaseEvaluate = "evaluate"
+)
+
+// defaultTimingsTopK is how many slowest symbols a scan's timings list when
+// the request does not say
+const defaultTimingsTopK = 10
+
+// notTimed marks a phase a symbol did not reach
+const notTimed = time.Duration(-1)
+
+// scanTimings holds the fetch and evaluation durations of a scan's symbols in
+// slices allocated once for the symbol count. Each symbol's worker writes
+// only its own index, so recording takes no lock.
+type scanTimings struct {
+	symbols  []string
+	fetch    []time.Duration
+	evaluate []time.Duration
+}
+
+// newScanTimings returns timings of symbols, none of them timed yet
+func newScanTimings(symbols []string) *scanTimings {
+	t := &scanTimings{
+		symbols:  symbols,
+		fetch:    make([]time.Duration, len(symbols)),
+		evaluate: make([]time.Duration, len(symbols)),
+	}
+	for i := range symbols {
+		t.fetch[i], t.evaluate[i] = notTimed, notTimed
+	}
+	return t
+}
+
+// recordFetch sets the fetch duration of the i-th symbol
+func (t *scanTimings) recordFetch(i int, d time.Duration) {
+	t.fetch[i] = d
+}
+
+// recordEvaluate sets the evaluation duration of the i-th symbol
+func (t *scanTimings) recordEvaluate(i int, d time.Duration) {
+	t.evaluate[i] = d
+}
+
+// observe reports each timed phase to recorder
+func (t *scanTimings) observe(recorder func(phase string, seconds float64)) {
+	for i := range t.symbols {
+		if t.fetch[i] != notTimed {
+			recorder(phaseFetch, t.fetch[i].Seconds())
+		}
+		if t.evaluate[i] != notTimed {
+			recorder(phaseEvaluate, t.evaluate[i].Seconds())
+		}
+	}
+}
+
+// summary returns the topK slowest symbols by fetch plus evaluation and the
+// percentiles of each phase
+func (t *scanTimings) summary(topK int) *pb.ScanTimings {
+	timed := make([]int, 0, len(t.symbols))
+	for i := range t.symbols {
+		if t.fetch[i] != notTimed {
+			timed = append(timed, i)
+		}
+	}
+	total := func(i int) time.Duration { return t.fetch[i] + max(t.evaluate[i], 0) }
+	slices.SortStableFunc(timed, func(a, b int) int { return cmp.Compare(total(b), total(a)) })
+
+	timings := &pb.ScanTimings{
+		Fetch:    latencySummary(t.fetch),
+		Evaluate: latencySummary(t.evaluate),
+		Slowest:  make([]*pb.SymbolTiming, 0, min(topK, len(timed))),
+	}
+	for _, i := range timed[:min(topK, len(timed))] {
+		timings.Slowest = append(timings.Slowest, &pb.SymbolTiming{
+			Symbol:     t.symbols[i],
+			FetchMs:    milliseconds(t.fetch[i]),
+			EvaluateMs: milliseconds(max(t.evaluate[i], 0)),
+		})
+	}
+	return timings
+}
+
+// latencySummary returns the percentiles of the timed durations
+func latencySummary(durations []time.Duration) *pb.LatencySummary {
+	sorted := make([]time.Duration, 0, len(durations))
+	for _, d := range durations {
+		if d != notTimed {
+			sorted = append(sorted, d)
+		}
+	}
+	if len(sorted) == 0 {
+		return &pb.LatencySummary{}
+	}
+	slices.Sort(sorted)
+	return &pb.LatencySummary{
+		Count: int32(len(sorted)),
+		P50Ms: milliseconds(percentile(sorted, 50)),
+		P95Ms: milliseconds(percentile(sorted, 95)),
+		P99Ms: milliseconds(percentile(sorted, 99)),
+		MaxMs: milliseconds(sorted[len(sorted)-1]),
+	}
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted, which must
+// not be empty
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100 // ceil(p/100 * n)
+	return sorted[max(rank, 1)-1]
+}
+
+// milliseconds converts d for a ScanTimings
+func milliseconds(d time.Duration) float32 {
+	return float32(d) / float32(time.Millisecond)
+}
@@ -0,0 +1,108 @@
+package scanner
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// delayProvider serves risingBars after sleeping the scripted delay of each
+// symbol
+type delayProvider map[string]time.Duration
+
+func (p delayProvider) GetHistoricalData(ctx context.Context, symbol, startDate, endDate string, spec BarSpec) ([]MarketData, error) {
+	select {
+	case <-time.After(p[symbol]):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return risingBars(symbol, startDate, endDate), nil
+}
+
+func TestScanTimingsReportSlowestSymbols(t *testing.T) {
+	service := newTestService(t)
+	useProvider(service, delayProvider{"AAPL": 0, "MSFT": 20 * time.Millisecond, "XOM": 80 * time.Millisecond, "SPY": 40 * time.Millisecond})
+	req := &pb.ScanRequest{
+		Symbols:    []string{"AAPL", "MSFT", "XOM", "SPY"},
+		Strategies: []string{"HIGH_BASE"},
+		DateRange:  testDateRange(),
+	}
+
+	resp, err := service.Scan(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Timings != nil {
+		t.Error("Scan() returned timings it was not asked for")
+	}
+
+	req.IncludeTimings = true
+	req.TimingsTopK = 2
+	resp, err = service.Scan(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slowest := resp.Timings.GetSlowest()
+	if len(slowest) != 2 || slowest[0].Symbol != "XOM" || slowest[1].Symbol != "SPY" {
+		t.Fatalf("Slowest symbols = %v, want XOM then SPY", slowest)
+	}
+	if slowest[0].FetchMs < 80 || slowest[1].FetchMs < 40 {
+		t.Errorf("Fetch times = %g, %g ms; want at least 80 and 40", slowest[0].FetchMs, slowest[1].FetchMs)
+	}
+	if fetch, evaluate := resp.Timings.Fetch, resp.Timings.Evaluate; fetch.Count != 4 || evaluate.Count != 4 || fetch.MaxMs != slowest[0].FetchMs {
+		t.Errorf("Fetch summary = %v, evaluate summary = %v", fetch, evaluate)
+	}
+
+	// Without a top k the ten slowest are listed
+	req.TimingsTopK = 0
+	if resp, err = service.Scan(context.Background(), req); err != nil || len(resp.Timings.GetSlowest()) != 4 {
+		t.Errorf("Scan() without a top k listed %d symbols, %v; want 4", len(resp.GetTimings().GetSlowest()), err)
+	}
+	req.TimingsTopK = -1
+	if _, err := service.Scan(context.Background(), req); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Scan() with a negative top k = %v, want InvalidArgument", err)
+	}
+
+	// Every scan feeds the histogram, asked for timings or not
+	if n := testutil.CollectAndCount(service.metricTracker.symbolPhase); n != 2 {
+		t.Errorf("Phase series = %d, want 2", n)
+	}
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(service.metricTracker.symbolPhase)
+	families, err := reg.Gather()
+	if err != nil || len(families) != 1 {
+		t.Fatalf("Gather() = %v, %v", families, err)
+	}
+	for _, metric := range families[0].GetMetric() {
+		if n := metric.GetHistogram().GetSampleCount(); n != 12 {
+			t.Errorf("%v observations = %d, want 12", metric.GetLabel(), n)
+		}
+	}
+}
+
+func TestLatencySummaryPercentiles(t *testing.T) {
+	durations := make([]time.Duration, 0, 101)
+	for ms := 100; ms >= 1; ms-- {
+		durations = append(durations, time.Duration(ms)*time.Millisecond)
+	}
+	durations = append(durations, notTimed)
+	summary := latencySummary(durations)
+	if summary.Count != 100 || summary.P50Ms != 50 || summary.P95Ms != 95 || summary.P99Ms != 99 || summary.MaxMs != 100 {
+		t.Errorf("Summary of 1..100 ms = %v", summary)
+	}
+
+	summary = latencySummary([]time.Duration{30 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond})
+	if summary.P50Ms != 20 || summary.P95Ms != 30 || summary.P99Ms != 30 {
+		t.Errorf("Summary of 10, 20, 30 ms = %v", summary)
+	}
+	if summary := latencySummary([]time.Duration{notTimed}); summary.Count != 0 || summary.MaxMs != 0 {
+		t.Errorf("Summary of nothing timed = %v", summary)
+	}
+}
@@ -0,0 +1,243 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/trustdan/ibkr-trader/go/pkg/calendar"
+	"github.com/trustdan/ibkr-trader/go/pkg/export"
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// pushTimeout bounds a single result push to the configured endpoint
+const pushTimeout = 10 * time.Second
+
+// scheduledPush is the body posted to ScanPushURL after each scheduled scan.
+// Results are left out when only the diff is pushed.
+type scheduledPush struct {
+	ScanTime time.Time              `json:"scan_time"`
+	Results  []export.ScanResultRow `json:"results,omitempty"`
+	Diff     *pushedDiff            `json:"diff,omitempty"`
+}
+
+// pushedDiff is the diff of a scheduled scan against the previous one
+type pushedDiff struct {
+	Added            []pushedSignal `json:"added"`
+	Removed          []pushedSignal `json:"removed"`
+	Unchanged        int            `json:"unchanged"`
+	PreviousScanTime string         `json:"previous_scan_time,omitempty"`
+	Reason           string         `json:"reason,omitempty"`
+}
+
+// pushedSignal is a signal added or removed by a scheduled scan
+type pushedSignal struct {
+	Symbol    string  `json:"symbol"`
+	Strategy  string  `json:"strategy"`
+	Direction string  `json:"direction"`
+	Score     float64 `json:"score"`
+}
+
+// RunScheduler scans the universe every ScanInterval during trading hours until
+// ctx is cancelled. Results are stored as the latest scan and, when ScanPushURL
+// is set, posted there, and to the Webhooks in the background. A cycle is
+// skipped while the previous scan is still running. Configuration reloads
+// take effect at once; a zero interval pauses the scheduler.
+func (s *Engine) RunScheduler(ctx context.Context) {
+	go s.webhooks.run(ctx)
+
+	ticker := time.NewTicker(time.Hour)
+	ticker.Stop()
+	defer ticker.Stop()
+
+	var tick <-chan time.Time
+	setInterval := func(interval time.Duration) {
+		if interval <= 0 {
+			ticker.Stop()
+			tick = nil
+			logrus.Info("Scheduled scanning disabled")
+			return
+		}
+		ticker.Reset(interval)
+		tick = ticker.C
+		logrus.Infof("Scheduled scanning every %s", interval)
+	}
+	setInterval(s.Config().ScanInterval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.reloaded:
+			setInterval(s.Config().ScanInterval)
+		case now := <-tick:
+			s.triggerScheduledScan(ctx, now)
+		}
+	}
+}
+
+// scheduledScanRequest builds the request of a scheduled scan starting at now.
+// ScanStrategies and ScanLookbackDays fill in what the ScanProfile leaves unset.
+func scheduledScanRequest(cfg *Config, now time.Time) *pb.ScanRequest {
+	req := &pb.ScanRequest{ProfileName: cfg.ScanProfile, IncludeDiff: cfg.ScanIncludeDiff || cfg.ScanPushDiffOnly || webhooksWantDiff(cfg.Webhooks)}
+	profile := cfg.Profiles[cfg.ScanProfile]
+	if len(profile.Strategies) == 0 {
+		req.Strategies = cfg.ScanStrategies
+	}
+	if profile.LookbackDays == 0 {
+		req.DateRange = &pb.DateRange{
+			StartDate: now.AddDate(0, 0, -cfg.ScanLookbackDays).Format(dateLayout),
+			EndDate:   now.Format(dateLayout),
+		}
+	}
+	return req
+}
+
+// triggerScheduledScan starts a scheduled scan in the background unless it is
+// outside trading hours or the previous one has not finished
+func (s *Engine) triggerScheduledScan(ctx context.Context, now time.Time) {
+	d := s.current()
+	cfg := d.config
+	if !withinTradingHours(cfg, d.market, now) {
+		logrus.Debugf("Outside trading hours (%s), skipping scheduled scan", d.market.ClosedReason(now))
+		return
+	}
+
+	if !s.schedulerBusy.CompareAndSwap(false, true) {
+		logrus.Warn("Previous scheduled scan still running, skipping this cycle")
+		s.metricTracker.RecordScheduledScanSkipped()
+		return
+	}
+
+	go func() {
+		defer s.schedulerBusy.Store(false)
+		defer func() {
+			if r := recover(); r != nil {
+				logrus.Errorf("Recovered from panic in scheduled scan: %v", r)
+				s.metricTracker.IncrementErrorCount()
+			}
+		}()
+		s.runScheduledScan(ctx, cfg)
+	}()
+}
+
+// runScheduledScan scans with the configured profile, or the universe with the
+// configured strategies, queues the results for the webhooks and pushes them
+func (s *Engine) runScheduledScan(ctx context.Context, cfg *Config) {
+	start := time.Now()
+	resp, err := s.Scan(ctx, scheduledScanRequest(cfg, start))
+	duration := time.Since(start)
+	s.metricTracker.RecordScheduledScan(start, duration.Seconds())
+
+	if err != nil {
+		logrus.Errorf("Scheduled scan failed: %v", err)
+		s.metricTracker.IncrementErrorCount()
+		return
+	}
+	logrus.Infof("Scheduled scan found signals for %d symbols in %s", len(resp.Signals), duration)
+	s.webhooks.enqueue(cfg.Webhooks, cfg.ScanProfile, resp, start)
+
+	if cfg.ScanPushURL == "" {
+		return
+	}
+	if diff := resp.Diff; cfg.ScanPushDiffOnly && diff.GetReason() == "" && len(diff.GetAdded()) == 0 && len(diff.GetRemoved()) == 0 {
+		logrus.Debug("Scheduled scan changed no signals, nothing to push")
+		return
+	}
+	if err := pushResults(ctx, cfg, resp, start); err != nil {
+		logrus.Errorf("Failed to push scan results: %v", err)
+		s.metricTracker.IncrementErrorCount()
+	}
+}
+
+// pushResults posts the scan results as JSON to ScanPushURL, with the diff
+// when the scan has one, or only the diff with ScanPushDiffOnly
+func pushResults(ctx context.Context, cfg *Config, resp *pb.ScanResponse, scanTime time.Time) error {
+	push := scheduledPush{ScanTime: scanTime, Diff: toPushedDiff(resp.Diff)}
+	if !cfg.ScanPushDiffOnly {
+		push.Results = export.ScanRows(resp, scanTime)
+	}
+	body, err := json.Marshal(push)
+	if err != nil {
+		return fmt.Errorf("failed to encode scan results: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pushTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.ScanPushURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create push request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if cfg.ScanPushToken != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.ScanPushToken)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to push scan results: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("push endpoint returned %s", res.Status)
+	}
+	return nil
+}
+
+// toPushedDiff converts a scan's diff for a push, nil without one
+func toPushedDiff(diff *pb.ScanDiff) *pushedDiff {
+	if diff == nil {
+		return nil
+	}
+	signals := func(ranked []*pb.RankedSignal) []pushedSignal {
+		out := make([]pushedSignal, len(ranked))
+		for i, signal := range ranked {
+			out[i] = pushedSignal{Symbol: signal.Symbol, Strategy: signal.Strategy, Direction: signal.Direction, Score: signal.Score}
+		}
+		return out
+	}
+	return &pushedDiff{
+		Added:            signals(diff.Added),
+		Removed:          signals(diff.Removed),
+		Unchanged:        len(diff.Unchanged),
+		PreviousScanTime: diff.PreviousScanTime,
+		Reason:           diff.Reason,
+	}
+}
+
+// withinTradingHours reports whether now falls on one of market's trading
+// days between ScanTradingHoursStart and ScanTradingHoursEnd in its timezone,
+// ending no later than an early close. Scans are allowed around the clock
+// when the hours are not configured or cannot be parsed.
+func withinTradingHours(cfg *Config, market *calendar.MarketCalendar, now time.Time) bool {
+	if cfg.ScanTradingHoursStart == "" || cfg.ScanTradingHoursEnd == "" {
+		return true
+	}
+
+	open, errOpen := time.Parse("15:04", cfg.ScanTradingHoursStart)
+	closing, errClose := time.Parse("15:04", cfg.ScanTradingHoursEnd)
+	if errOpen != nil || errClose != nil {
+		logrus.Warnf("Invalid scan trading hours %q-%q, scanning around the clock",
+			cfg.ScanTradingHoursStart, cfg.ScanTradingHoursEnd)
+		return true
+	}
+
+	day := market.Day(now)
+	if day.Closed() {
+		return false
+	}
+	local := now.In(market.Location())
+	start := time.Date(local.Year(), local.Month(), local.Day(), open.Hour(), open.Minute(), 0, 0, local.Location())
+	end := time.Date(local.Year(), local.Month(), local.Day(), closing.Hour(), closing.Minute(), 0, 0, local.Location())
+	if day.EarlyClose != "" && end.After(day.Close) {
+		end = day.Close
+	}
+	return !now.Before(start) && now.Before(end)
+}
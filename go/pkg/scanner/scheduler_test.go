@@ -0,0 +1,217 @@
+package scanner
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/trustdan/ibkr-trader/go/pkg/calendar"
+	"github.com/trustdan/ibkr-trader/go/pkg/universe"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// gatedProvider counts calls and, when gate is set, blocks each call until the
+// gate is closed
+type gatedProvider struct {
+	calls atomic.Int32
+	gate  chan struct{}
+}
+
+func (g *gatedProvider) GetHistoricalData(ctx context.Context, symbol, startDate, endDate string, spec BarSpec) ([]MarketData, error) {
+	g.calls.Add(1)
+	if g.gate != nil {
+		<-g.gate
+	}
+	return risingBars(symbol, startDate, endDate), nil
+}
+
+// newScheduledService returns a service scanning a cached two-symbol universe
+// every interval around the clock
+func newScheduledService(t *testing.T, interval time.Duration, provider DataProvider) *ScannerService {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := universe.New([]string{"AAPL", "MSFT"}).SaveCache(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	service := newTestService(t)
+	cfg := *service.Config()
+	cfg.UniverseCacheDir = dir
+	cfg.UniverseCacheExpiry = 0
+	cfg.ScanInterval = interval
+	cfg.ScanStrategies = []string{"HIGH_BASE"}
+	cfg.ScanTradingHoursStart = ""
+	cfg.ScanTradingHoursEnd = ""
+	service.UpdateConfig(&cfg)
+	useProvider(service, provider)
+
+	return service
+}
+
+// useProvider swaps the service's data provider the way UpdateConfig swaps
+// dependencies, so running scans keep their snapshot
+func useProvider(service *ScannerService, provider DataProvider) {
+	deps := *service.current()
+	deps.dataProvider = provider
+
+	service.depsMu.Lock()
+	service.deps = &deps
+	service.depsMu.Unlock()
+}
+
+// waitFor polls cond until it holds or the deadline passes
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSchedulerScansAndPushesResults(t *testing.T) {
+	var pushes atomic.Int32
+	var lastPush scheduledPush
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body scheduledPush
+		if err := json.NewDecoder(r.Body).Decode(&body); err == nil && pushes.Load() == 0 {
+			lastPush = body
+		}
+		pushes.Add(1)
+	}))
+	defer server.Close()
+
+	provider := &gatedProvider{}
+	service := newScheduledService(t, 20*time.Millisecond, provider)
+	cfg := *service.Config()
+	cfg.ScanPushURL = server.URL
+	service.UpdateConfig(&cfg)
+	useProvider(service, provider)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go service.RunScheduler(ctx)
+
+	// Two symbols per scan, so at least two scans have run
+	waitFor(t, "two scheduled scans", func() bool { return provider.calls.Load() >= 4 && pushes.Load() >= 2 })
+	cancel()
+
+	results, err := service.GetScanResults(context.Background(), &pb.ResultsRequest{})
+	if err != nil || len(results.Signals) != 2 {
+		t.Fatalf("Latest results: %v, %v", results, err)
+	}
+
+	metrics, err := service.GetMetrics(context.Background(), &pb.MetricsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metrics.LastScheduledScanTime == "" {
+		t.Error("GetMetrics should report the last scheduled scan time")
+	}
+
+	if len(lastPush.Results) != 2 || lastPush.Results[0].Symbol != "AAPL" || lastPush.Results[0].Signal != "LONG" {
+		t.Errorf("Unexpected pushed results: %+v", lastPush)
+	}
+}
+
+func TestSchedulerSkipsWhileBusy(t *testing.T) {
+	provider := &gatedProvider{gate: make(chan struct{})}
+	service := newScheduledService(t, 10*time.Millisecond, provider)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go service.RunScheduler(ctx)
+
+	// The first scan blocks in the provider while later cycles are skipped
+	waitFor(t, "skipped cycles", func() bool { return service.Metrics().GetMetrics().ScheduledScansSkipped >= 3 })
+	if calls := provider.calls.Load(); calls != 2 {
+		t.Errorf("Provider calls while busy: got %d, want 2", calls)
+	}
+
+	close(provider.gate)
+	waitFor(t, "the next scan after the busy one", func() bool { return provider.calls.Load() > 2 })
+}
+
+func TestSchedulerPicksUpIntervalChanges(t *testing.T) {
+	provider := &gatedProvider{}
+	service := newScheduledService(t, 0, provider)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go service.RunScheduler(ctx)
+
+	time.Sleep(50 * time.Millisecond)
+	if calls := provider.calls.Load(); calls != 0 {
+		t.Fatalf("Disabled scheduler scanned %d symbols", calls)
+	}
+
+	cfg := *service.Config()
+	cfg.ScanInterval = 10 * time.Millisecond
+	service.UpdateConfig(&cfg)
+	useProvider(service, provider)
+
+	waitFor(t, "a scan after enabling the scheduler", func() bool { return provider.calls.Load() > 0 })
+}
+
+func TestWithinTradingHours(t *testing.T) {
+	cfg := DefaultConfig()
+	loc := newYorkLocation()
+	market := calendar.DefaultMarketCalendar()
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want bool
+	}{
+		{name: "weekday session", now: time.Date(2024, 3, 6, 10, 0, 0, 0, loc), want: true},
+		{name: "before the open", now: time.Date(2024, 3, 6, 9, 29, 0, 0, loc), want: false},
+		{name: "at the close", now: time.Date(2024, 3, 6, 16, 0, 0, 0, loc), want: false},
+		{name: "weekend", now: time.Date(2024, 3, 9, 11, 0, 0, 0, loc), want: false},
+		{name: "holiday", now: time.Date(2024, 7, 4, 11, 0, 0, 0, loc), want: false},
+		{name: "before an early close", now: time.Date(2024, 11, 29, 12, 59, 0, 0, loc), want: true},
+		{name: "after an early close", now: time.Date(2024, 11, 29, 13, 0, 0, 0, loc), want: false},
+		{name: "open after spring forward", now: time.Date(2024, 3, 11, 13, 30, 0, 0, time.UTC), want: true},
+		{name: "before the open after fall back", now: time.Date(2024, 11, 4, 14, 0, 0, 0, time.UTC), want: false},
+	}
+	for _, tt := range tests {
+		if got := withinTradingHours(cfg, market, tt.now); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMarketCalendarFollowsConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "calendar.json")
+	if err := os.WriteFile(file, []byte(`{"holidays": {"2024-03-06": "Exchange outage"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	service := newMockTestService(t)
+	session := time.Date(2024, 3, 6, 15, 0, 0, 0, time.UTC)
+	if !withinTradingHours(service.Config(), service.current().market, session) {
+		t.Fatal("Expected the embedded calendar to trade on 2024-03-06")
+	}
+
+	cfg := *service.Config()
+	cfg.MarketCalendarFile = file
+	service.UpdateConfig(&cfg)
+	if withinTradingHours(service.Config(), service.current().market, session) {
+		t.Error("Expected the override's holiday to skip scheduled scans")
+	}
+
+	// A calendar that fails to load leaves the embedded one in place
+	cfg.MarketCalendarFile = filepath.Join(t.TempDir(), "missing.json")
+	service.UpdateConfig(&cfg)
+	if !withinTradingHours(service.Config(), service.current().market, session) {
+		t.Error("Expected the embedded calendar after a failed load")
+	}
+}
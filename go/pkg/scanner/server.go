@@ -0,0 +1,207 @@
+package scanner
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+	// Registers the gzip compressor so clients can request compressed responses
+	_ "google.golang.org/grpc/encoding/gzip"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// ServerOptions builds the gRPC server options for the configuration: message
+// and stream limits, keepalive pings to and from idle clients, connection idle
+// and age limits, request logging and
+// panic recovery, OpenTelemetry server spans when tracing is enabled, TLS when
+// a certificate is configured and bearer-token authentication when a token is
+// configured. Recovered panics are counted as errors in metrics.
+func ServerOptions(cfg *Config, metrics *MetricTracker) ([]grpc.ServerOption, error) {
+	options := []grpc.ServerOption{
+		grpc.MaxConcurrentStreams(uint32(cfg.MaxConcurrentStreams)),
+		grpc.MaxRecvMsgSize(cfg.MaxMessageSize),
+		grpc.MaxSendMsgSize(cfg.MaxMessageSize),
+		// Long-lived clients such as TraderAdmin ping idle connections, and
+		// the server pings them so that load balancers dropping idle
+		// connections do not, and dead clients are noticed
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{MinTime: cfg.GRPCKeepaliveMinTime, PermitWithoutStream: true}),
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:                  cfg.GRPCKeepaliveTime,
+			Timeout:               cfg.GRPCKeepaliveTimeout,
+			MaxConnectionIdle:     cfg.GRPCMaxConnectionIdle,
+			MaxConnectionAge:      cfg.GRPCMaxConnectionAge,
+			MaxConnectionAgeGrace: cfg.GRPCMaxConnectionAgeGrace,
+		}),
+		// Logging runs outermost so it records the status of recovered panics
+		grpc.ChainUnaryInterceptor(
+			LoggingInterceptor(cfg.RequestLogSampling),
+			RecoveryInterceptor(metrics),
+		),
+		grpc.ChainStreamInterceptor(
+			StreamLoggingInterceptor(cfg.RequestLogSampling),
+			StreamRecoveryInterceptor(metrics),
+		),
+	}
+
+	// Server spans continue traces whose context arrives in the traceparent
+	// header; the handler is left out entirely when tracing is off
+	if cfg.TracingEnabled {
+		options = append(options, grpc.StatsHandler(otelgrpc.NewServerHandler()))
+	}
+
+	tlsConfig, err := serverTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	} else {
+		logrus.Warn("TLS is not configured, the scanner gRPC endpoint is unencrypted")
+	}
+
+	token, err := LoadAuthToken(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		auth := NewTokenAuthenticator(token, cfg.AuthExemptMethods)
+		options = append(options,
+			grpc.ChainUnaryInterceptor(auth.UnaryInterceptor()),
+			grpc.ChainStreamInterceptor(auth.StreamInterceptor()),
+		)
+	} else {
+		logrus.Warn("No auth token configured, the scanner gRPC endpoint accepts unauthenticated calls")
+	}
+
+	return options, nil
+}
+
+// serverTLSConfig loads the server certificate and, for mutual TLS, the client CA
+// pool. It returns nil when no certificate is configured.
+func serverTLSConfig(cfg *Config) (*tls.Config, error) {
+	if cfg.TLSCertFile == "" && cfg.TLSKeyFile == "" {
+		if cfg.TLSClientCAFile != "" {
+			return nil, fmt.Errorf("tls_client_ca_file requires tls_cert_file and tls_key_file")
+		}
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS key pair: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if cfg.TLSClientCAFile != "" {
+		caPEM, err := os.ReadFile(cfg.TLSClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", cfg.TLSClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
+// ScannerService serves an Engine over gRPC. The streaming RPCs are its own;
+// the others are the engine's.
+type ScannerService struct {
+	pb.UnimplementedScannerServiceServer
+	*Engine
+}
+
+// NewScannerService creates a new scanner service whose Prometheus metrics are
+// registered with the default registerer
+func NewScannerService(cfg *Config) *ScannerService {
+	return NewScannerServiceWithRegistry(cfg, prometheus.DefaultRegisterer)
+}
+
+// NewScannerServiceWithRegistry creates a new scanner service registering its
+// Prometheus metrics with reg
+func NewScannerServiceWithRegistry(cfg *Config, reg prometheus.Registerer) *ScannerService {
+	return NewEngineService(NewEngine(cfg, nil, reg))
+}
+
+// NewEngineService returns a service serving engine, which may also be
+// called directly
+func NewEngineService(engine *Engine) *ScannerService {
+	return &ScannerService{Engine: engine}
+}
+
+func (s *ScannerService) Scan(ctx context.Context, req *pb.ScanRequest) (*pb.ScanResponse, error) {
+	return s.Engine.Scan(ctx, req)
+}
+
+func (s *ScannerService) BulkFetch(ctx context.Context, req *pb.BulkFetchRequest) (*pb.BulkFetchResponse, error) {
+	return s.Engine.BulkFetch(ctx, req)
+}
+
+func (s *ScannerService) GetMetrics(ctx context.Context, req *pb.MetricsRequest) (*pb.MetricsResponse, error) {
+	return s.Engine.GetMetrics(ctx, req)
+}
+
+func (s *ScannerService) GetScanResults(ctx context.Context, req *pb.ResultsRequest) (*pb.ScanResponse, error) {
+	return s.Engine.GetScanResults(ctx, req)
+}
+
+func (s *ScannerService) GetScanHistory(ctx context.Context, req *pb.ScanHistoryRequest) (*pb.ScanHistoryResponse, error) {
+	return s.Engine.GetScanHistory(ctx, req)
+}
+
+func (s *ScannerService) ExportResults(ctx context.Context, req *pb.ExportRequest) (*pb.ExportResponse, error) {
+	return s.Engine.ExportResults(ctx, req)
+}
+
+func (s *ScannerService) GetSymbolHealth(ctx context.Context, req *pb.SymbolHealthRequest) (*pb.SymbolHealthResponse, error) {
+	return s.Engine.GetSymbolHealth(ctx, req)
+}
+
+func (s *ScannerService) ResetSymbolHealth(ctx context.Context, req *pb.ResetSymbolHealthRequest) (*pb.ResetSymbolHealthResponse, error) {
+	return s.Engine.ResetSymbolHealth(ctx, req)
+}
+
+func (s *ScannerService) ListProfiles(ctx context.Context, req *pb.ListProfilesRequest) (*pb.ListProfilesResponse, error) {
+	return s.Engine.ListProfiles(ctx, req)
+}
+
+func (s *ScannerService) ListStrategies(ctx context.Context, req *pb.ListStrategiesRequest) (*pb.ListStrategiesResponse, error) {
+	return s.Engine.ListStrategies(ctx, req)
+}
+
+func (s *ScannerService) GetAuditLog(ctx context.Context, req *pb.AuditLogRequest) (*pb.AuditLogResponse, error) {
+	return s.Engine.GetAuditLog(ctx, req)
+}
+
+func (s *ScannerService) GetEffectiveConfig(ctx context.Context, req *pb.EffectiveConfigRequest) (*pb.EffectiveConfigResponse, error) {
+	return s.Engine.GetEffectiveConfig(ctx, req)
+}
+
+func (s *ScannerService) GetVersion(ctx context.Context, req *pb.VersionRequest) (*pb.VersionResponse, error) {
+	return s.Engine.GetVersion(ctx, req)
+}
+
+func (s *ScannerService) GetDataQuality(ctx context.Context, req *pb.DataQualityRequest) (*pb.DataQualityResponse, error) {
+	return s.Engine.GetDataQuality(ctx, req)
+}
+
+func (s *ScannerService) GetSymbolMetadata(ctx context.Context, req *pb.SymbolMetadataRequest) (*pb.SymbolMetadataResponse, error) {
+	return s.Engine.GetSymbolMetadata(ctx, req)
+}
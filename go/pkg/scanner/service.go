@@ -2,131 +2,961 @@ package scanner
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/patrickmn/go-cache"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
-	"github.com/trustdan/ibkr-trader/go/pkg/proto"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/trustdan/ibkr-trader/go/pkg/calendar"
+	"github.com/trustdan/ibkr-trader/go/pkg/export"
+	"github.com/trustdan/ibkr-trader/go/pkg/metadata"
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+	"github.com/trustdan/ibkr-trader/go/pkg/strategy"
 )
 
-// ScannerService implements the proto.ScannerServiceServer interface
-type ScannerService struct {
-	proto.UnimplementedScannerServiceServer
-	config       *Config
-	resultsCache *cache.Cache
-	lastScan     time.Time
-	scanMutex    sync.Mutex
+// Engine scans, fetches and schedules scans without a transport of its own.
+// ScannerService serves it over gRPC, and programs embedding the scanner call
+// its methods directly or through Client.
+type Engine struct {
+	metricTracker *MetricTracker
+	tracer        trace.Tracer
+	symbolHealth  *symbolHealthTracker
+	warmup        warmupProgress
+
+	// Latest data quality check of each symbol scanned, for GetDataQuality
+	quality qualityReports
+
+	// Configuration-derived dependencies, replaced as a whole by UpdateConfig
+	depsMu sync.RWMutex
+	deps   *serviceDeps
+
+	// Bounds the symbols fetched at once by all requests; UpdateConfig
+	// resizes it, so a new limit also applies to requests in flight
+	workers *workerPool
+
+	// Heap against the memory watermarks, and the bulk fetches in flight
+	memory memoryGuard
+
+	// Startup wait for the data provider
+	dependencies dependencyWait
+
+	// Latest scan response, kept for GetScanResults and ExportResults
+	lastScanMu   sync.RWMutex
+	lastScan     *pb.ScanResponse
+	lastScanTime time.Time
+
+	// Signals of recent scans, kept for GetScanHistory
+	history scanHistory
+
+	// Latest scan of each profile, which the next one is diffed against
+	diffs scanDiffs
+
+	// Audit log GetAuditLog reads, nil when disabled
+	audit *AuditLog
+
+	// Scheduler state; reloaded wakes RunScheduler after UpdateConfig
+	reloaded      chan struct{}
+	schedulerBusy atomic.Bool
+
+	// Payloads of scheduled scans waiting for their webhook endpoints
+	webhooks *webhookQueue
+
+	// onPayloadHeld, when set, observes the payloads BulkFetchStream holds
+	// fetched but not yet sent each time one is fetched
+	onPayloadHeld func(held int)
+
+	// provider is the data provider the engine was built with, nil to build
+	// one from each configuration
+	provider DataProvider
+
+	// Background work of Start, stopped by Stop
+	runMu   sync.Mutex
+	stopRun context.CancelFunc
+	running sync.WaitGroup
+}
+
+// serviceDeps holds everything built from the configuration. A request takes a
+// snapshot at the start so a concurrent reload never mixes two configurations.
+type serviceDeps struct {
+	config        *Config
+	dataProvider  DataProvider
+	eventCalendar calendar.EventCalendarProvider
+	market        *calendar.MarketCalendar
+	metadata      metadata.Provider
+	// Compiled custom strategies by name
+	strategies map[string]strategy.Strategy
+}
+
+// NewEngine creates an engine registering its Prometheus metrics with reg.
+// It fetches from provider, cached as the configuration says, or from the
+// provider the configuration names when provider is nil.
+func NewEngine(cfg *Config, provider DataProvider, reg prometheus.Registerer) *Engine {
+	s := &Engine{
+		metricTracker: NewMetricTracker(reg),
+		tracer:        noop.NewTracerProvider().Tracer(tracerName),
+		symbolHealth:  newSymbolHealthTracker(),
+		reloaded:      make(chan struct{}, 1),
+		provider:      provider,
+	}
+	s.workers = newWorkerPool(cfg.MaxConcurrency, s.metricTracker.RecordWorkers)
+	s.webhooks = newWebhookQueue(cfg.WebhookQueueSize, s.metricTracker)
+	s.deps = s.buildDeps(cfg)
+	return s
+}
+
+// buildDeps creates the configuration-derived dependencies
+func (s *Engine) buildDeps(cfg *Config) *serviceDeps {
+	// LoadConfig rejects invalid rules, so this only fails for a Config built
+	// in code
+	strategies, err := compileCustomStrategies(cfg.CustomStrategies)
+	if err != nil {
+		logrus.Errorf("Custom strategies disabled: %v", err)
+	}
+	market, err := marketCalendar(cfg)
+	if err != nil {
+		logrus.Errorf("Using the NYSE market calendar: %v", err)
+	}
+	eventCalendar, err := calendar.NewEventCalendarProvider(cfg.EventCalendarType, cfg.EventCalendarURL, cfg.EventCalendarToken, cfg.EventCalendarCacheTTL)
+	if err != nil {
+		logrus.Errorf("Event calendar disabled: %v", err)
+	}
+
+	return &serviceDeps{
+		config:        cfg,
+		dataProvider:  s.dataProvider(cfg),
+		eventCalendar: eventCalendar,
+		market:        market,
+		metadata:      newMetadataProvider(cfg),
+		strategies:    strategies,
+	}
+}
+
+// marketCalendar returns the market calendar cfg configures, or the NYSE's
+// along with the error when it does not load
+func marketCalendar(cfg *Config) (*calendar.MarketCalendar, error) {
+	market, err := calendar.NewMarketCalendar(cfg.MarketCalendarFile, cfg.MarketTimezone)
+	if err != nil {
+		return calendar.DefaultMarketCalendar(), err
+	}
+	return market, nil
+}
+
+// dataProvider returns the provider the engine was built with, behind a cache
+// when cfg enables it, or else the one cfg names
+func (s *Engine) dataProvider(cfg *Config) DataProvider {
+	switch {
+	case s.provider == nil:
+		return NewDataProvider(cfg, s.metricTracker)
+	case cfg.CacheEnabled:
+		return NewCachedDataProvider(cfg, s.provider, s.metricTracker)
+	}
+	return s.provider
+}
+
+// current returns the dependencies for the active configuration
+func (s *Engine) current() *serviceDeps {
+	s.depsMu.RLock()
+	defer s.depsMu.RUnlock()
+	return s.deps
+}
+
+// Config returns the active configuration
+func (s *Engine) Config() *Config {
+	return s.current().config
+}
+
+// Metrics returns the engine's metric tracker
+func (s *Engine) Metrics() *MetricTracker {
+	return s.metricTracker
+}
+
+// SetTracerProvider makes the engine create spans with provider. Call it before
+// the engine starts handling requests; until then spans are no-ops.
+func (s *Engine) SetTracerProvider(provider trace.TracerProvider) {
+	s.tracer = provider.Tracer(tracerName)
+}
+
+// UpdateConfig applies a new configuration. In-flight requests finish with the
+// configuration they started with, except for MaxConcurrency, which bounds
+// their next fetches too unless the memory guard holds the pool at
+// MemoryGuardMinWorkers; the data cache is rebuilt.
+func (s *Engine) UpdateConfig(cfg *Config) {
+	deps := s.buildDeps(cfg)
+
+	s.depsMu.Lock()
+	s.deps = deps
+	s.depsMu.Unlock()
+	s.workers.resize(s.workerLimit(cfg))
+
+	// Let a running scheduler pick up a changed interval
+	select {
+	case s.reloaded <- struct{}{}:
+	default:
+	}
+
+	logrus.Info("Scanner configuration reloaded")
+}
+
+// Scan implements the Scan RPC method, failing with UNAVAILABLE while the
+// scanner waits for its data provider at startup
+func (s *Engine) Scan(ctx context.Context, req *pb.ScanRequest) (*pb.ScanResponse, error) {
+	startTime := time.Now()
+	d := s.current()
+
+	ctx, span := s.tracer.Start(ctx, "Scan")
+	defer span.End()
+
+	if err := s.admitProviderCalls(ctx); err != nil {
+		recordSpanError(span, err)
+		return nil, err
+	}
+
+	// Take the fields the request leaves unset from the profile it names
+	req, err := applyProfile(req, d.config.Profiles, startTime)
+	if err != nil {
+		recordSpanError(span, err)
+		return nil, err
+	}
+	if req.ProfileName != "" {
+		span.SetAttributes(attribute.String("scanner.profile", req.ProfileName))
+	}
+
+	if req.DateRange == nil {
+		err := fmt.Errorf("date range is required")
+		recordSpanError(span, err)
+		return nil, err
+	}
+
+	spec, err := ParseBarSpec(req.BarSize, req.WhatToShow)
+	if err != nil {
+		recordSpanError(span, err)
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	spec = d.config.withExtendedHours(spec, req.IncludeExtendedHours)
+
+	if req.MaxResults < 0 {
+		err := fmt.Errorf("max results must not be negative, got %d", req.MaxResults)
+		recordSpanError(span, err)
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if req.MaxConcurrency < 0 {
+		err := fmt.Errorf("max concurrency must not be negative, got %d", req.MaxConcurrency)
+		recordSpanError(span, err)
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if req.TimingsTopK < 0 {
+		err := fmt.Errorf("timings top k must not be negative, got %d", req.TimingsTopK)
+		recordSpanError(span, err)
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	workers := s.workersFor(req.MaxConcurrency)
+
+	// Apply the request's parameter overrides for this scan only
+	configured, err := resolveStrategies(req.Strategies, req.Parameters, d.strategies)
+	if err != nil {
+		recordSpanError(span, err)
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	// Fetch no more history than the strategies need
+	dateRange := effectiveDateRange(req.DateRange, req.ForceDateRange, configured, spec, d.market)
+	if dateRange != req.DateRange {
+		span.SetAttributes(attribute.String("scanner.effective_start_date", dateRange.StartDate))
+	}
+
+	// Fall back to the filtered universe when no symbols are requested
+	symbols := req.Symbols
+	if len(symbols) == 0 {
+		symbols, err = s.universeSymbols(ctx, d)
+		if err != nil {
+			err = fmt.Errorf("no symbols requested and universe unavailable: %w", err)
+			recordSpanError(span, err)
+			return nil, err
+		}
+	}
+	span.SetAttributes(attribute.Int("scanner.symbol_count", len(symbols)), attrBarSpec.String(spec.String()))
+	auditSymbols(ctx, len(symbols))
+
+	// Name the symbols as the data provider does, leaving out invalid ones
+	symbols, invalid := normalizeSymbols(d.dataProvider, symbols)
+
+	// Create result map with capacity hint for better performance
+	signals := make(map[string]*pb.SignalList, len(symbols))
+	errs := make(map[string]string, len(invalid))
+	for symbol, reason := range invalid {
+		errs[symbol] = reason
+	}
+	var ranked []*pb.RankedSignal
+	var mu sync.Mutex
+	timings := newScanTimings(symbols)
+
+	var wg sync.WaitGroup
+	var panics panicCollector
+
+	// Process each symbol concurrently
+	for i, symbol := range symbols {
+		// Give up when the scan is cancelled, once the symbols started have
+		// stopped writing their results
+		if ctx.Err() != nil {
+			wg.Wait()
+			return nil, ctx.Err()
+		}
+
+		wg.Add(1)
+
+		// Add job to worker pool, giving up when the scan is cancelled
+		if err := workers.acquire(ctx); err != nil {
+			wg.Done()
+			wg.Wait()
+			return nil, err
+		}
+
+		go func(i int, sym string) {
+			defer wg.Done()
+			defer workers.release()
+			defer panics.capture()
+
+			// Fetch data for this symbol with timeout context
+			symbolCtx, cancel := context.WithTimeout(ctx, d.config.SymbolTimeout)
+			defer cancel()
+
+			symbolCtx, symbolSpan := s.tracer.Start(symbolCtx, "ScanSymbol", trace.WithAttributes(attrSymbol.String(sym)))
+			defer symbolSpan.End()
+
+			// Skip symbols outside the requested sectors before fetching data
+			meta := metadata.Lookup(symbolCtx, d.metadata, sym)
+			if !metadata.InSectors(meta.Sector, req.SectorFilter) {
+				return
+			}
+
+			// Skip symbols cooling down after repeated timeouts
+			if !s.symbolHealth.admit(sym) {
+				symbolSpan.SetAttributes(attribute.Bool("scanner.skipped", true))
+				mu.Lock()
+				errs[sym] = ErrorCooldown + ": skipped while cooling down after repeated fetch timeouts"
+				mu.Unlock()
+				return
+			}
+
+			fetchStart := time.Now()
+			data, err := s.fetchSymbolData(symbolCtx, d, sym, dateRange, spec)
+			timings.recordFetch(i, time.Since(fetchStart))
+			// A cancelled scan says nothing about the symbol
+			outcome := fetchOutcome(symbolCtx, err)
+			if ctx.Err() == nil {
+				s.symbolHealth.record(sym, outcome, d.config.SymbolCooldownAfter, d.config.SymbolCooldownScans)
+			}
+			if err != nil {
+				recordSpanError(symbolSpan, err)
+				reason := ErrorFetch + ": " + err.Error()
+				if outcome == FetchTimeout {
+					reason = fmt.Sprintf("%s: no data within %s", ErrorTimeout, d.config.SymbolTimeout)
+				}
+				mu.Lock()
+				errs[sym] = reason
+				mu.Unlock()
+				return
+			}
+
+			// Leave out symbols whose bars are too flawed to evaluate
+			if reason := s.checkDataQuality(d, sym, data, spec); reason != "" {
+				symbolSpan.SetAttributes(attribute.String("scanner.data_quality", reason))
+				mu.Lock()
+				errs[sym] = reason
+				mu.Unlock()
+				return
+			}
+
+			// Apply strategies with optimized concurrent indicator calculation
+			_, evalSpan := s.tracer.Start(symbolCtx, "EvaluateStrategies", trace.WithAttributes(attrSymbol.String(sym)))
+			evalStart := time.Now()
+			raised := s.evaluateStrategies(data, configured)
+			timings.recordEvaluate(i, time.Since(evalStart))
+			evalSpan.SetAttributes(attribute.Int("scanner.signal_count", len(raised)))
+			evalSpan.End()
+
+			// Store results with mutex to avoid race conditions
+			if len(raised) > 0 {
+				list := &pb.SignalList{
+					EventNotes: upcomingEventNotes(symbolCtx, d.eventCalendar, sym),
+					Sector:     meta.Sector,
+					Industry:   meta.Industry,
+					MarketCap:  meta.MarketCap,
+				}
+				for _, result := range raised {
+					list.SignalTypes = append(list.SignalTypes, result.signal)
+					list.Strategies = append(list.Strategies, result.strategy)
+				}
+
+				mu.Lock()
+				signals[sym] = list
+				for _, result := range raised {
+					ranked = append(ranked, &pb.RankedSignal{Symbol: sym, Strategy: result.strategy, Direction: result.signal, Score: result.score})
+				}
+				mu.Unlock()
+			}
+		}(i, symbol)
+	}
+
+	// Wait for all goroutines to complete
+	wg.Wait()
+	panics.repanic()
+
+	// Calculate scan time
+	scanTime := time.Since(startTime).Seconds()
+
+	// Track metrics
+	s.metricTracker.RecordScan(len(symbols), scanTime)
+	timings.observe(s.metricTracker.RecordSymbolPhase)
+
+	// Compare every signal with the previous scan, before max_results
+	// truncates the ranking
+	names := make([]string, len(configured))
+	for i, strat := range configured {
+		names[i] = strat.Strategy.Name()
+	}
+	diff := s.diffs.record(req.ProfileName, startTime, names, spec, ranked)
+
+	resp := &pb.ScanResponse{
+		Signals:         signals,
+		ScanTimeSeconds: float32(scanTime),
+		Parameters:      parametersToProto(configured),
+		RankedSignals:   rankSignals(ranked, int(req.MaxResults)),
+		Errors:          errs,
+		DateRange:       dateRange,
+	}
+	if req.IncludeDiff {
+		resp.Diff = diff
+	}
+	if req.IncludeTimings {
+		topK := int(req.TimingsTopK)
+		if topK == 0 {
+			topK = defaultTimingsTopK
+		}
+		resp.Timings = timings.summary(topK)
+	}
+
+	s.lastScanMu.Lock()
+	s.lastScan = resp
+	s.lastScanTime = startTime
+	s.lastScanMu.Unlock()
+	s.history.record(startTime, req, len(symbols), resp, d.config.ScanHistorySize)
+
+	return resp, nil
 }
 
-// NewScannerService creates a new scanner service instance
-func NewScannerService(config *Config) *ScannerService {
-	// Create cache with default expiration time from config
-	resultsCache := cache.New(time.Duration(config.CacheTTL)*time.Minute, time.Duration(config.CacheTTL*2)*time.Minute)
+// BulkFetch implements the BulkFetch RPC method. A response whose payloads
+// would add up to more than the bulk byte limit fails with RESOURCE_EXHAUSTED
+// rather than being built in memory; BulkFetchStream has no such limit. So
+// does one arriving while the heap is above a memory watermark, or in flight
+// when it crosses the hard one.
+func (s *Engine) BulkFetch(ctx context.Context, req *pb.BulkFetchRequest) (*pb.BulkFetchResponse, error) {
+	startTime := time.Now()
+	d := s.current()
+
+	ctx, span := s.tracer.Start(ctx, "BulkFetch", trace.WithAttributes(attribute.Int("scanner.symbol_count", len(req.Symbols))))
+	defer span.End()
+
+	spec, err := bulkFetchSpec(req, d.config)
+	if err != nil {
+		recordSpanError(span, err)
+		return nil, err
+	}
+	span.SetAttributes(attrBarSpec.String(spec.String()))
+
+	if err := s.admitProviderCalls(ctx); err != nil {
+		recordSpanError(span, err)
+		return nil, err
+	}
+	if err := s.admitBulkFetch(ctx, d.config); err != nil {
+		recordSpanError(span, err)
+		return nil, err
+	}
+
+	symbols, nextPageToken, err := paginate(req)
+	if err != nil {
+		recordSpanError(span, err)
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	auditSymbols(ctx, len(symbols))
+	workers := s.workersFor(req.MaxConcurrency)
+	symbols, invalid := normalizeSymbols(d.dataProvider, symbols)
+
+	// Create result maps with capacity hint; compressed stays nil unless a
+	// payload crosses the compression threshold
+	data := make(map[string][]byte, len(symbols))
+	var compressed map[string]bool
+	var mu sync.Mutex
+
+	// Once the payloads exceed the limit the remaining fetches are cancelled,
+	// as are all of them above the hard memory watermark
+	limit := d.config.bulkMaxTotalBytes()
+	total := 0
+	exceeded := false
+	fetchCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	defer s.memory.track(cancel)()
+
+	var wg sync.WaitGroup
+	var panics panicCollector
+
+	// Process each symbol concurrently
+	for _, symbol := range symbols {
+		// Context cancellation check
+		if fetchCtx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+
+		// Add job to worker pool
+		if workers.acquire(fetchCtx) != nil {
+			wg.Done()
+			break
+		}
+
+		go func(sym string) {
+			defer wg.Done()
+			defer workers.release()
+			defer panics.capture()
+
+			payload, err := s.fetchPayload(fetchCtx, d, sym, req.DateRange, spec)
+			if err != nil {
+				return
+			}
 
-	service := &ScannerService{
-		config:       config,
-		resultsCache: resultsCache,
-		lastScan:     time.Time{},
+			// Store in result map
+			mu.Lock()
+			defer mu.Unlock()
+			if total += payload.size(sym); limit > 0 && total > limit {
+				exceeded = true
+				cancel(nil)
+				return
+			}
+			data[sym] = payload.data
+			if payload.compressed {
+				if compressed == nil {
+					compressed = make(map[string]bool)
+				}
+				compressed[sym] = true
+			}
+		}(symbol)
 	}
 
-	return service
+	// Wait for all goroutines to complete
+	wg.Wait()
+	panics.repanic()
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err := memoryCancelled(fetchCtx, d.config); err != nil {
+		recordSpanError(span, err)
+		return nil, err
+	}
+	if exceeded {
+		err := status.Errorf(codes.ResourceExhausted,
+			"BulkFetch response for %d symbols exceeds %d bytes; use BulkFetchStream or a smaller page_size", len(symbols), limit)
+		recordSpanError(span, err)
+		return nil, err
+	}
+
+	// Calculate fetch time
+	fetchTime := time.Since(startTime).Seconds()
+
+	// Track metrics
+	s.metricTracker.RecordFetch(len(symbols), fetchTime)
+
+	return &pb.BulkFetchResponse{
+		Data:             data,
+		FetchTimeSeconds: float32(fetchTime),
+		Compressed:       compressed,
+		NextPageToken:    nextPageToken,
+		Errors:           invalid,
+	}, nil
 }
 
-// ScanMarket performs a market scan based on the provided criteria
-func (s *ScannerService) ScanMarket(ctx context.Context, req *proto.ScanRequest) (*proto.ScanResponse, error) {
-	logrus.Infof("Received scan request for symbol: %s, full scan: %v", req.Symbol, req.FullScan)
+// GetMetrics implements the GetMetrics RPC method
+func (s *Engine) GetMetrics(ctx context.Context, req *pb.MetricsRequest) (*pb.MetricsResponse, error) {
+	metrics := s.metricTracker.GetMetrics()
+	warmup := s.warmup.get()
+	memory := s.memory.get()
 
-	s.scanMutex.Lock()
-	defer s.scanMutex.Unlock()
+	// Get additional system metrics
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
 
-	// Perform market scan (placeholder implementation)
-	results := s.performScan(req)
+	var lastScheduledScan, restoredFrom string
+	if !metrics.LastScheduledScan.IsZero() {
+		lastScheduledScan = metrics.LastScheduledScan.UTC().Format(time.RFC3339)
+	}
+	if !metrics.CountersRestoredFrom.IsZero() {
+		restoredFrom = metrics.CountersRestoredFrom.UTC().Format(time.RFC3339)
+	}
 
-	// Update cache
-	cacheKey := "latest_scan"
-	s.resultsCache.Set(cacheKey, results, cache.DefaultExpiration)
-	s.lastScan = time.Now()
+	return &pb.MetricsResponse{
+		AvgScanTimeSeconds: float32(metrics.AvgScanTime),
+		SymbolsPerSecond:   float32(metrics.SymbolsPerSecond),
+		TotalScans:         int32(metrics.TotalScans),
+		MemoryUsageMb:      float32(memStats.Alloc) / 1024 / 1024,
+		CpuUsagePercent:    float32(metrics.CPUUsage),
+		ErrorCount:         int32(metrics.ErrorCount),
+		CacheHitRate:       float32(metrics.CacheHitRate),
+		CacheHits:          int32(metrics.CacheHits),
+		CacheDiskHits:      int32(metrics.CacheDiskHits),
+		CachePartialHits:   int32(metrics.CachePartialHits),
+		CacheMisses:        int32(metrics.CacheMisses),
 
-	return &proto.ScanResponse{
-		Results:   results,
-		Timestamp: time.Now().Unix(),
-		Status:    "success",
+		LastScheduledScanTime:    lastScheduledScan,
+		LastScheduledScanSeconds: float32(metrics.LastScheduledScanSeconds),
+		Strategies:               strategyMetricsToProto(metrics.Strategies),
+		Providers:                providerMetricsToProto(metrics.Providers),
+		ProcessStartTime:         metrics.ProcessStartTime.UTC().Format(time.RFC3339),
+		CountersRestoredFrom:     restoredFrom,
+		WarmupState:              warmup.State,
+		WarmupSymbols:            int32(warmup.Symbols),
+		WarmupCached:             int32(warmup.Cached),
+		WarmupFailed:             int32(warmup.Failed),
+		MemoryGuard:              memory.Level,
+		MemoryHeapMb:             bytesToMB(memory.HeapBytes),
+		MemorySoftWatermarkMb:    bytesToMB(memory.SoftWatermark),
+		MemoryHardWatermarkMb:    bytesToMB(memory.HardWatermark),
+		MemoryLimitMb:            bytesToMB(memory.LimitBytes),
+		MemoryRejectedFetches:    int32(memory.Rejected),
+		MemoryCancelledFetches:   int32(memory.Cancelled),
 	}, nil
 }
 
-// GetScanResults retrieves the latest scan results
-func (s *ScannerService) GetScanResults(ctx context.Context, req *proto.ResultsRequest) (*proto.ScanResponse, error) {
-	logrus.Infof("Received request for scan results, limit: %d", req.Limit)
+// bytesToMB converts a byte count for GetMetrics
+func bytesToMB(bytes uint64) float32 {
+	return float32(bytes) / 1024 / 1024
+}
 
-	// Get cached results
-	cacheKey := "latest_scan"
-	cachedResults, found := s.resultsCache.Get(cacheKey)
+// strategyMetricsToProto converts the per-strategy breakdown for GetMetrics
+func strategyMetricsToProto(metrics []StrategyMetrics) []*pb.StrategyMetrics {
+	out := make([]*pb.StrategyMetrics, len(metrics))
+	for i, m := range metrics {
+		out[i] = &pb.StrategyMetrics{Name: m.Name, AvgMs: float32(m.AvgMs), Signals: int32(m.Signals)}
+	}
+	return out
+}
 
-	var results []*proto.ScanResult
-	status := "no_results"
+// providerMetricsToProto converts the per-provider breakdown for GetMetrics
+func providerMetricsToProto(metrics []ProviderMetrics) []*pb.ProviderMetrics {
+	out := make([]*pb.ProviderMetrics, len(metrics))
+	for i, m := range metrics {
+		out[i] = &pb.ProviderMetrics{Name: m.Name, AvgMs: float32(m.AvgMs), Errors: int32(m.Errors), CacheHitRate: float32(m.CacheHitRate)}
+	}
+	return out
+}
 
-	if found {
-		results = cachedResults.([]*proto.ScanResult)
-		status = "success"
+// GetScanResults implements the GetScanResults RPC method, returning the latest
+// scan response, or with OlderThan the latest kept scan started before then,
+// limited to the first Limit symbols in alphabetical order
+func (s *Engine) GetScanResults(ctx context.Context, req *pb.ResultsRequest) (*pb.ScanResponse, error) {
+	var resp *pb.ScanResponse
+	if req.OlderThan != "" {
+		olderThan, err := time.Parse(time.RFC3339, req.OlderThan)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("older_than must be an RFC3339 time: %v", err))
+		}
+		if snapshot, ok := s.history.latestBefore(olderThan); ok {
+			resp = &pb.ScanResponse{Signals: snapshot.signalLists("")}
+		}
+	} else {
+		s.lastScanMu.RLock()
+		resp = s.lastScan
+		s.lastScanMu.RUnlock()
+	}
 
-		// Apply limit if specified
-		if req.Limit > 0 && int(req.Limit) < len(results) {
-			results = results[:req.Limit]
+	if resp == nil {
+		return &pb.ScanResponse{Signals: map[string]*pb.SignalList{}}, nil
+	}
+	if req.Limit <= 0 || int(req.Limit) >= len(resp.Signals) {
+		return resp, nil
+	}
+
+	symbols := make([]string, 0, len(resp.Signals))
+	for symbol := range resp.Signals {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+
+	limited := make(map[string]*pb.SignalList, req.Limit)
+	for _, symbol := range symbols[:req.Limit] {
+		limited[symbol] = resp.Signals[symbol]
+	}
+
+	var ranked []*pb.RankedSignal
+	for _, signal := range resp.RankedSignals {
+		if limited[signal.Symbol] != nil {
+			ranked = append(ranked, signal)
 		}
 	}
 
-	return &proto.ScanResponse{
-		Results:   results,
-		Timestamp: s.lastScan.Unix(),
-		Status:    status,
+	return &pb.ScanResponse{
+		Signals:         limited,
+		ScanTimeSeconds: resp.ScanTimeSeconds,
+		RankedSignals:   ranked,
+	}, nil
+}
+
+// ExportResults implements the ExportResults RPC method. The path requested
+// is relative to the configured export directory, which it cannot leave.
+func (s *Engine) ExportResults(ctx context.Context, req *pb.ExportRequest) (*pb.ExportResponse, error) {
+	s.lastScanMu.RLock()
+	resp, scanTime := s.lastScan, s.lastScanTime
+	s.lastScanMu.RUnlock()
+
+	if resp == nil {
+		return nil, status.Error(codes.FailedPrecondition, "no scan results to export")
+	}
+	switch strings.ToLower(req.Format) {
+	case export.FormatCSV, export.FormatJSON:
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unsupported export format %q, use csv or json", req.Format)
+	}
+	path, err := exportPath(s.Config().ExportDir, req.Path)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	rows, err := export.WriteScanResults(resp, scanTime, req.Format, path)
+	if err != nil {
+		logrus.WithError(err).Errorf("Failed to export scan results to %s", path)
+		return nil, status.Errorf(codes.Internal, "failed to export scan results: %v", err)
+	}
+
+	logrus.Infof("Exported %d scan result rows to %s", rows, path)
+	return &pb.ExportResponse{
+		RowsExported: int32(rows),
+		Path:         path,
+		ScanTime:     scanTime.UTC().Format(time.RFC3339),
 	}, nil
 }
 
-// performScan executes the actual market scanning logic
-func (s *ScannerService) performScan(req *proto.ScanRequest) []*proto.ScanResult {
-	// This would be replaced with actual IBKR API calls in a real implementation
-
-	// Create some dummy data for testing
-	results := []*proto.ScanResult{
-		{
-			Symbol:              "AAPL",
-			Price:               175.23,
-			Iv:                  0.32,
-			Strategy:            "BULL_PUT_SPREAD",
-			PotentialProfit:     0.45,
-			MaxLoss:             1.55,
-			ProbabilityOfProfit: 0.75,
-			Options: []*proto.OptionData{
-				{
-					Contract:   "AAPL230917P170",
-					Strike:     170.0,
-					Expiration: "2023-09-17",
-					OptionType: "PUT",
-					Bid:        1.25,
-					Ask:        1.30,
-					Iv:         0.30,
-					Delta:      -0.25,
-					Theta:      -0.05,
-					Gamma:      0.02,
-					Vega:       0.10,
-				},
-				{
-					Contract:   "AAPL230917P165",
-					Strike:     165.0,
-					Expiration: "2023-09-17",
-					OptionType: "PUT",
-					Bid:        0.80,
-					Ask:        0.85,
-					Iv:         0.28,
-					Delta:      -0.18,
-					Theta:      -0.04,
-					Gamma:      0.015,
-					Vega:       0.08,
-				},
-			},
-		},
-	}
-
-	return results
+// exportPath resolves an export path requested by a client under dir. An
+// absolute path, or one leaving dir through "..", is rejected.
+func exportPath(dir, requested string) (string, error) {
+	switch {
+	case requested == "":
+		return "", fmt.Errorf("export path is required")
+	case filepath.IsAbs(requested):
+		return "", fmt.Errorf("export path %q must be relative to the export directory", requested)
+	case !filepath.IsLocal(requested):
+		return "", fmt.Errorf("export path %q must stay within the export directory", requested)
+	}
+	return filepath.Join(dir, requested), nil
+}
+
+// newMetadataProvider loads the configured symbol metadata file; without one every
+// symbol reports an UNKNOWN sector
+func newMetadataProvider(cfg *Config) metadata.Provider {
+	if cfg.MetadataFile == "" {
+		return nil
+	}
+
+	provider, err := metadata.LoadStaticProvider(cfg.MetadataFile)
+	if err != nil {
+		logrus.Warnf("Failed to load symbol metadata, sectors will be UNKNOWN: %v", err)
+		return nil
+	}
+	return provider
+}
+
+// strategySignal pairs a signal with the strategy that produced it
+type strategySignal struct {
+	strategy string
+	signal   string
+	score    float64
+}
+
+// fetchSymbolData fetches the bars for one symbol inside its own span, logging
+// and counting failures
+func (s *Engine) fetchSymbolData(ctx context.Context, d *serviceDeps, symbol string, dateRange *pb.DateRange, spec BarSpec) ([]MarketData, error) {
+	ctx, span := s.tracer.Start(ctx, "FetchHistoricalData", trace.WithAttributes(attrSymbol.String(symbol)))
+	defer span.End()
+
+	data, err := d.dataProvider.GetHistoricalData(ctx, symbol, dateRange.StartDate, dateRange.EndDate, spec)
+	if err != nil {
+		logrus.Errorf("Error fetching data for %s: %v", symbol, err)
+		s.metricTracker.IncrementErrorCount()
+		auditError(ctx)
+		recordSpanError(span, err)
+		return nil, err
+	}
+
+	span.SetAttributes(attrBarCount.Int(len(data)))
+	return data, nil
+}
+
+// evaluateStrategies evaluates the configured strategies on the latest bar of
+// data and returns the signals raised with their strategy and score. Strategies
+// not declaring they read extended hours evaluate the latest bar of the
+// regular session, leaving out pre-market and after-hours bars.
+func (s *Engine) evaluateStrategies(data []MarketData, strategies []strategy.Configured) []strategySignal {
+	if len(data) == 0 {
+		return nil
+	}
+	regular, extended := sessionSeries(data)
+
+	// Create a channel for collecting signals from all strategies
+	signalChan := make(chan strategySignal, len(strategies))
+
+	// Launch concurrent evaluation of all strategies
+	var wg sync.WaitGroup
+	var panics panicCollector
+	for _, configured := range strategies {
+		wg.Add(1)
+		go func(strat strategy.Configured) {
+			defer wg.Done()
+			defer panics.capture()
+
+			series := seriesFor(strat.Strategy, regular, extended)
+			if series.Len() == 0 {
+				return
+			}
+			last := series.Len() - 1
+
+			// Evaluate the strategy
+			start := time.Now()
+			signal := strat.Strategy.Evaluate(series, last, strat.Params)
+			s.metricTracker.RecordStrategyEvaluation(strat.Strategy.Name(), time.Since(start).Seconds(), signal != "")
+			if signal != "" {
+				score := strat.Strategy.Score(series, last, strat.Params)
+				signalChan <- strategySignal{strategy: strat.Strategy.Name(), signal: signal, score: score}
+			}
+		}(configured)
+	}
+
+	// Wait for all strategy evaluations to complete
+	wg.Wait()
+	panics.repanic()
+	close(signalChan)
+
+	// Collect results
+	var raised []strategySignal
+	for result := range signalChan {
+		raised = append(raised, result)
+	}
+	return raised
+}
+
+// rankSignals sorts signals strongest first, breaking ties by symbol then
+// strategy so equal scans rank equally, and keeps the first maxResults when
+// it is above zero
+func rankSignals(signals []*pb.RankedSignal, maxResults int) []*pb.RankedSignal {
+	sort.Slice(signals, func(i, j int) bool {
+		a, b := signals[i], signals[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Symbol != b.Symbol {
+			return a.Symbol < b.Symbol
+		}
+		return a.Strategy < b.Strategy
+	})
+	if maxResults > 0 && len(signals) > maxResults {
+		signals = signals[:maxResults]
+	}
+	return signals
+}
+
+// resolveStrategies looks up the named strategies among the registered and
+// custom ones, all of them when names is empty, and applies the parameter
+// overrides keyed by strategy name
+func resolveStrategies(names []string, overrides map[string]*pb.StrategyParams, custom map[string]strategy.Strategy) ([]strategy.Configured, error) {
+	if len(names) == 0 {
+		names = strategyNames(custom)
+	}
+
+	requested := make(map[string]bool, len(names))
+	configured := make([]strategy.Configured, 0, len(names))
+	for _, name := range names {
+		strat, ok := lookupStrategy(name, custom)
+		if !ok {
+			return nil, fmt.Errorf("unknown strategy %q, supported: %s", name, strings.Join(strategyNames(custom), ", "))
+		}
+		requested[name] = true
+
+		params, err := strategy.ResolveParams(strat, overrides[name].GetValues())
+		if err != nil {
+			return nil, err
+		}
+		configured = append(configured, strategy.Configured{Strategy: strat, Params: params})
+	}
+
+	for _, name := range sortedKeys(overrides) {
+		if !requested[name] {
+			return nil, fmt.Errorf("parameters given for strategy %q which is not requested", name)
+		}
+	}
+	return configured, nil
+}
+
+// parametersToProto returns the effective parameters of each strategy
+func parametersToProto(strategies []strategy.Configured) map[string]*pb.StrategyParams {
+	out := make(map[string]*pb.StrategyParams, len(strategies))
+	for _, configured := range strategies {
+		out[configured.Strategy.Name()] = &pb.StrategyParams{Values: configured.Params}
+	}
+	return out
+}
+
+// toBars converts market data to the bars the strategies evaluate
+func toBars(data []MarketData) []strategy.Bar {
+	bars := make([]strategy.Bar, len(data))
+	for i, bar := range data {
+		bars[i] = strategy.Bar{
+			Time:   bar.Timestamp,
+			Open:   bar.Open,
+			High:   bar.High,
+			Low:    bar.Low,
+			Close:  bar.Close,
+			Volume: bar.Volume,
+		}
+	}
+	return bars
+}
+
+// upcomingEventNotes annotates a signal with upcoming earnings and ex-dividend dates.
+// Missing calendar data is logged and yields no notes rather than failing the symbol.
+func upcomingEventNotes(ctx context.Context, eventCalendar calendar.EventCalendarProvider, symbol string) []string {
+	if eventCalendar == nil {
+		return nil
+	}
+
+	earningsDate, err := eventCalendar.NextEarningsDate(ctx, symbol)
+	if err != nil {
+		logrus.Infof("No earnings date for %s: %v", symbol, err)
+		earningsDate = time.Time{}
+	}
+
+	exDivDate, err := eventCalendar.NextExDividendDate(ctx, symbol)
+	if err != nil {
+		logrus.Infof("No ex-dividend date for %s: %v", symbol, err)
+		exDivDate = time.Time{}
+	}
+
+	return calendar.DescribeUpcomingEvents(time.Now(), earningsDate, exDivDate)
+}
+
+// serializeMarketData serializes market data to an optimized binary format
+func (s *Engine) serializeMarketData(data interface{}, buffer []byte) ([]byte, error) {
+	// For demonstration, using JSON but in production would use a more
+	// efficient format like Protocol Buffers or FlatBuffers
+	return json.Marshal(data)
 }
@@ -0,0 +1,445 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/trustdan/ibkr-trader/go/pkg/metadata"
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// risingProvider serves daily bars that rise steadily, so HIGH_BASE signals
+// LONG on every symbol with its default parameters
+type risingProvider struct{}
+
+func (risingProvider) GetHistoricalData(ctx context.Context, symbol, startDate, endDate string, spec BarSpec) ([]MarketData, error) {
+	return risingBars(symbol, startDate, endDate), nil
+}
+
+// risingBars returns a weekday bar per date whose close rises by one a day,
+// with a high-low range of two around the close
+func risingBars(symbol, startDate, endDate string) []MarketData {
+	start, _ := time.Parse(dateLayout, startDate)
+	end, _ := time.Parse(dateLayout, endDate)
+
+	var data []MarketData
+	close := 100.0
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		if d.Weekday() == time.Saturday || d.Weekday() == time.Sunday {
+			continue
+		}
+		data = append(data, MarketData{Symbol: symbol, Timestamp: d, Open: close, High: close + 1, Low: close - 1, Close: close, Volume: 1000000})
+		close++
+	}
+	return data
+}
+
+// newTestService creates a scanner service with its own Prometheus registry,
+// serving bars from risingProvider
+func newTestService(t *testing.T) *ScannerService {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.CacheEnabled = false
+	cfg.EventCalendarType = "none"
+	cfg.MetadataFile = "../metadata/testdata/metadata.csv"
+	service := NewScannerServiceWithRegistry(cfg, prometheus.NewRegistry())
+	useProvider(service, risingProvider{})
+	return service
+}
+
+// newMockTestService is newTestService serving the seeded mock data
+func newMockTestService(t *testing.T) *ScannerService {
+	t.Helper()
+	service := newTestService(t)
+	useProvider(service, NewMockDataProvider(service.Config()))
+	return service
+}
+
+func testDateRange() *pb.DateRange {
+	return &pb.DateRange{StartDate: "2024-01-02", EndDate: "2024-01-31"}
+}
+
+func TestScanEnrichesSectorMetadata(t *testing.T) {
+	service := newTestService(t)
+
+	resp, err := service.Scan(context.Background(), &pb.ScanRequest{
+		Symbols:    []string{"AAPL", "ZZZZ"},
+		Strategies: []string{"HIGH_BASE", "LOW_BASE"},
+		DateRange:  testDateRange(),
+	})
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+
+	aapl := resp.Signals["AAPL"]
+	if aapl == nil || aapl.Sector != "Technology" || aapl.Industry != "Consumer Electronics" || aapl.MarketCap != 3e12 {
+		t.Fatalf("Unexpected AAPL result: %+v", aapl)
+	}
+	if len(aapl.SignalTypes) != 1 || aapl.SignalTypes[0] != "LONG" || aapl.Strategies[0] != "HIGH_BASE" {
+		t.Errorf("Expected a LONG signal from HIGH_BASE only in an uptrend, got %+v", aapl)
+	}
+
+	unknown := resp.Signals["ZZZZ"]
+	if unknown == nil {
+		t.Fatal("Symbol without metadata should not be dropped")
+	}
+	if unknown.Sector != metadata.Unknown || unknown.Industry != metadata.Unknown {
+		t.Errorf("Missing metadata should be UNKNOWN, got %+v", unknown)
+	}
+}
+
+func TestScanSectorFilter(t *testing.T) {
+	service := newTestService(t)
+
+	resp, err := service.Scan(context.Background(), &pb.ScanRequest{
+		Symbols:      []string{"AAPL", "MSFT", "XOM", "ZZZZ"},
+		Strategies:   []string{"HIGH_BASE"},
+		DateRange:    testDateRange(),
+		SectorFilter: []string{"energy"},
+	})
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+
+	if len(resp.Signals) != 1 || resp.Signals["XOM"] == nil {
+		t.Errorf("Expected only XOM for energy filter, got %v", resp.Signals)
+	}
+}
+
+func TestScanRequiresDateRange(t *testing.T) {
+	service := newTestService(t)
+
+	if _, err := service.Scan(context.Background(), &pb.ScanRequest{Symbols: []string{"AAPL"}}); err == nil {
+		t.Error("Expected error for missing date range")
+	}
+}
+
+func TestGetScanResults(t *testing.T) {
+	service := newTestService(t)
+
+	empty, err := service.GetScanResults(context.Background(), &pb.ResultsRequest{})
+	if err != nil || len(empty.Signals) != 0 {
+		t.Fatalf("Expected empty results before first scan, got %v, %v", empty, err)
+	}
+
+	if _, err := service.Scan(context.Background(), &pb.ScanRequest{
+		Symbols:    []string{"XOM", "AAPL", "MSFT"},
+		Strategies: []string{"HIGH_BASE"},
+		DateRange:  testDateRange(),
+	}); err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+
+	all, err := service.GetScanResults(context.Background(), &pb.ResultsRequest{})
+	if err != nil || len(all.Signals) != 3 {
+		t.Fatalf("Expected 3 results, got %v, %v", all, err)
+	}
+
+	limited, err := service.GetScanResults(context.Background(), &pb.ResultsRequest{Limit: 2})
+	if err != nil {
+		t.Fatalf("GetScanResults failed: %v", err)
+	}
+	if len(limited.Signals) != 2 || limited.Signals["AAPL"] == nil || limited.Signals["MSFT"] == nil {
+		t.Errorf("Expected first two symbols alphabetically, got %v", limited.Signals)
+	}
+}
+
+func TestMetricsTrackScansAndCache(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.EventCalendarType = "none"
+	service := NewScannerServiceWithRegistry(cfg, prometheus.NewRegistry())
+
+	req := &pb.ScanRequest{
+		Symbols:    []string{"AAPL", "MSFT"},
+		Strategies: []string{"HIGH_BASE"},
+		DateRange:  testDateRange(),
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := service.Scan(context.Background(), req); err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+	}
+
+	metrics, err := service.GetMetrics(context.Background(), &pb.MetricsRequest{})
+	if err != nil {
+		t.Fatalf("GetMetrics failed: %v", err)
+	}
+	if metrics.TotalScans != 2 {
+		t.Errorf("TotalScans: got %d, want 2", metrics.TotalScans)
+	}
+	// The second scan is served entirely from cache
+	if metrics.CacheHitRate != 50 {
+		t.Errorf("CacheHitRate: got %v, want 50", metrics.CacheHitRate)
+	}
+}
+
+// failingProvider fails every fetch
+type failingProvider struct{}
+
+func (failingProvider) GetHistoricalData(ctx context.Context, symbol, startDate, endDate string, spec BarSpec) ([]MarketData, error) {
+	return nil, errors.New("provider unavailable")
+}
+
+func TestMetricsBreakdownByStrategyAndProvider(t *testing.T) {
+	service := newTestService(t)
+	tracker := service.Metrics()
+	instrumented := func(name string, provider DataProvider) DataProvider {
+		return NewCachedDataProvider(service.Config(), &instrumentedProvider{name: name, provider: provider, recorder: tracker}, tracker)
+	}
+
+	// Two scans from a provider, the second served from the cache, then one
+	// from a provider that fails
+	useProvider(service, instrumented("ibkr", risingProvider{}))
+	req := &pb.ScanRequest{
+		Symbols:    []string{"AAPL", "MSFT"},
+		Strategies: []string{"HIGH_BASE", "LOW_BASE"},
+		DateRange:  testDateRange(),
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := service.Scan(context.Background(), req); err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+	}
+	useProvider(service, instrumented("yahoo", failingProvider{}))
+	req.Symbols = []string{"NVDA"}
+	if _, err := service.Scan(context.Background(), req); err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+
+	metrics, err := service.GetMetrics(context.Background(), &pb.MetricsRequest{})
+	if err != nil {
+		t.Fatalf("GetMetrics failed: %v", err)
+	}
+
+	if len(metrics.Strategies) != 2 {
+		t.Fatalf("Strategies: got %v, want HIGH_BASE and LOW_BASE", metrics.Strategies)
+	}
+	// HIGH_BASE signals on every rising symbol; nothing is evaluated for NVDA
+	if s := metrics.Strategies[0]; s.Name != "HIGH_BASE" || s.Signals != 4 || s.AvgMs < 0 {
+		t.Errorf("HIGH_BASE: got %v, want 4 signals", s)
+	}
+	if s := metrics.Strategies[1]; s.Name != "LOW_BASE" || s.Signals != 0 {
+		t.Errorf("LOW_BASE: got %v, want no signals", s)
+	}
+
+	if len(metrics.Providers) != 2 {
+		t.Fatalf("Providers: got %v, want ibkr and yahoo", metrics.Providers)
+	}
+	if p := metrics.Providers[0]; p.Name != "ibkr" || p.Errors != 0 || p.CacheHitRate != 50 {
+		t.Errorf("ibkr: got %v, want no errors and a 50%% cache hit rate", p)
+	}
+	if p := metrics.Providers[1]; p.Name != "yahoo" || p.Errors != 1 || p.CacheHitRate != 0 {
+		t.Errorf("yahoo: got %v, want one error", p)
+	}
+	if tracker.GetMetrics().Providers[0].Fetches != 2 {
+		t.Errorf("ibkr fetches: got %d, want one per symbol", tracker.GetMetrics().Providers[0].Fetches)
+	}
+}
+
+func TestUpdateConfigAppliesToNewRequests(t *testing.T) {
+	service := newTestService(t)
+
+	reloaded := DefaultConfig()
+	reloaded.CacheEnabled = false
+	reloaded.EventCalendarType = "none"
+	reloaded.MaxConcurrency = 3
+	service.UpdateConfig(reloaded)
+	useProvider(service, risingProvider{})
+
+	if service.Config() != reloaded {
+		t.Fatal("Config was not replaced")
+	}
+	if service.workers.size() != 3 {
+		t.Errorf("Worker pool size: got %d, want 3", service.workers.size())
+	}
+
+	// Without a metadata file every symbol is UNKNOWN after the reload
+	resp, err := service.Scan(context.Background(), &pb.ScanRequest{
+		Symbols:    []string{"AAPL"},
+		Strategies: []string{"HIGH_BASE"},
+		DateRange:  testDateRange(),
+	})
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if got := resp.Signals["AAPL"].Sector; got != metadata.Unknown {
+		t.Errorf("Sector after reload: got %q, want UNKNOWN", got)
+	}
+}
+
+func TestScanParameterOverrides(t *testing.T) {
+	service := newTestService(t)
+	scan := func(overrides map[string]float64) *pb.ScanResponse {
+		t.Helper()
+		req := &pb.ScanRequest{
+			Symbols:    []string{"AAPL"},
+			Strategies: []string{"HIGH_BASE"},
+			DateRange:  testDateRange(),
+		}
+		if overrides != nil {
+			req.Parameters = map[string]*pb.StrategyParams{"HIGH_BASE": {Values: overrides}}
+		}
+		resp, err := service.Scan(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+		return resp
+	}
+
+	// The uptrend has an RSI of 100, above the default threshold of 60
+	if resp := scan(nil); resp.Signals["AAPL"] == nil {
+		t.Fatalf("Expected a signal with default parameters, got %v", resp)
+	}
+
+	strict := scan(map[string]float64{"min_rsi": 100})
+	if len(strict.Signals) != 0 {
+		t.Errorf("Expected no signal with min_rsi 100, got %v", strict.Signals)
+	}
+	effective := strict.Parameters["HIGH_BASE"].GetValues()
+	if effective["min_rsi"] != 100 || effective["max_atr_ratio"] != 2 {
+		t.Errorf("Expected the override and remaining defaults echoed, got %v", effective)
+	}
+
+	// Overrides apply to their own request only
+	if resp := scan(nil); resp.Signals["AAPL"] == nil || resp.Parameters["HIGH_BASE"].GetValues()["min_rsi"] != 60 {
+		t.Errorf("Expected defaults to be restored, got %v", resp)
+	}
+}
+
+func TestScanRejectsInvalidParameters(t *testing.T) {
+	service := newTestService(t)
+
+	tests := []struct {
+		name       string
+		parameters map[string]*pb.StrategyParams
+		wantMsg    string
+	}{
+		{"unknown key", map[string]*pb.StrategyParams{"HIGH_BASE": {Values: map[string]float64{"rsi_floor": 50}}}, `"rsi_floor"`},
+		{"out of range", map[string]*pb.StrategyParams{"HIGH_BASE": {Values: map[string]float64{"min_rsi": -5}}}, `"min_rsi"`},
+		{"strategy not requested", map[string]*pb.StrategyParams{"LOW_BASE": {Values: map[string]float64{"max_rsi": 30}}}, `"LOW_BASE"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.Scan(context.Background(), &pb.ScanRequest{
+				Symbols:    []string{"AAPL"},
+				Strategies: []string{"HIGH_BASE"},
+				DateRange:  testDateRange(),
+				Parameters: tt.parameters,
+			})
+			if status.Code(err) != codes.InvalidArgument || !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Errorf("Expected InvalidArgument naming %s, got %v", tt.wantMsg, err)
+			}
+		})
+	}
+}
+
+// rangeProvider serves risingBars with the high-low range of each symbol, so
+// the narrower a symbol's range the tighter its base and the stronger its
+// HIGH_BASE setup
+type rangeProvider map[string]float64
+
+func (r rangeProvider) GetHistoricalData(ctx context.Context, symbol, startDate, endDate string, spec BarSpec) ([]MarketData, error) {
+	data := risingBars(symbol, startDate, endDate)
+	for i := range data {
+		data[i].High = data[i].Close + r[symbol]/2
+		data[i].Low = data[i].Close - r[symbol]/2
+	}
+	return data, nil
+}
+
+func TestScanRanksSignalsByScore(t *testing.T) {
+	service := newTestService(t)
+	useProvider(service, rangeProvider{"WIDE": 20, "TIGHT": 2, "MEDIUM": 8})
+
+	scan := func(maxResults int32) *pb.ScanResponse {
+		t.Helper()
+		resp, err := service.Scan(context.Background(), &pb.ScanRequest{
+			Symbols:    []string{"WIDE", "TIGHT", "MEDIUM"},
+			Strategies: []string{"HIGH_BASE", "LOW_BASE"},
+			DateRange:  testDateRange(),
+			MaxResults: maxResults,
+		})
+		if err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+		return resp
+	}
+
+	// All three rise without a loss, an RSI of 100, so the tightness of the
+	// base alone orders them
+	resp := scan(0)
+	var order []string
+	for i, ranked := range resp.RankedSignals {
+		order = append(order, ranked.Symbol)
+		if ranked.Strategy != "HIGH_BASE" || ranked.Direction != "LONG" || ranked.Score <= 0 || ranked.Score > 100 {
+			t.Errorf("Ranked signal %d = %v", i, ranked)
+		}
+		if i > 0 && ranked.Score >= resp.RankedSignals[i-1].Score {
+			t.Errorf("Ranked signal %d scores %v, not below %v", i, ranked.Score, resp.RankedSignals[i-1].Score)
+		}
+	}
+	if strings.Join(order, ",") != "TIGHT,MEDIUM,WIDE" {
+		t.Errorf("Ranking = %v, want TIGHT, MEDIUM, WIDE", order)
+	}
+
+	// MaxResults keeps the strongest; the signal map still has every symbol
+	top := scan(1)
+	if len(top.RankedSignals) != 1 || top.RankedSignals[0].Symbol != "TIGHT" || top.RankedSignals[0].Score != resp.RankedSignals[0].Score {
+		t.Errorf("Top ranked signals = %v, want TIGHT alone with the same score", top.RankedSignals)
+	}
+	if len(top.Signals) != 3 {
+		t.Errorf("Signals = %v, want all three symbols", top.Signals)
+	}
+
+	_, err := service.Scan(context.Background(), &pb.ScanRequest{Symbols: []string{"TIGHT"}, DateRange: testDateRange(), MaxResults: -1})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Scan(max results -1) error = %v, want InvalidArgument", err)
+	}
+}
+
+func TestExportResultsStaysInExportDir(t *testing.T) {
+	service := newTestService(t)
+	dir := t.TempDir()
+	service.Config().ExportDir = dir
+	ctx := context.Background()
+
+	if _, err := service.ExportResults(ctx, &pb.ExportRequest{Format: "csv", Path: "scan.csv"}); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("Export before any scan = %v, want FailedPrecondition", err)
+	}
+	if _, err := service.Scan(ctx, &pb.ScanRequest{Symbols: []string{"AAPL"}, DateRange: testDateRange()}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := service.ExportResults(ctx, &pb.ExportRequest{Format: "csv", Path: "daily/scan.csv"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "daily", "scan.csv"); resp.Path != want {
+		t.Errorf("Exported to %s, want %s", resp.Path, want)
+	}
+	if _, err := os.Stat(resp.Path); err != nil {
+		t.Error(err)
+	}
+
+	for _, path := range []string{"", "/tmp/scan.csv", "../scan.csv", "daily/../../scan.csv"} {
+		if _, err := service.ExportResults(ctx, &pb.ExportRequest{Format: "csv", Path: path}); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Export to %q = %v, want InvalidArgument", path, err)
+		}
+	}
+	if _, err := service.ExportResults(ctx, &pb.ExportRequest{Format: "xml", Path: "scan.xml"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Export as xml = %v, want InvalidArgument", err)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(dir)); len(entries) != 1 {
+		t.Errorf("Rejected exports wrote next to the export directory: %v", entries)
+	}
+}
@@ -0,0 +1,89 @@
+package scanner
+
+import (
+	"time"
+
+	"github.com/trustdan/ibkr-trader/go/pkg/calendar"
+	"github.com/trustdan/ibkr-trader/go/pkg/strategy"
+)
+
+// Trading sessions of a bar, as in MarketData.Session
+const (
+	SessionPreMarket  = "PRE"
+	SessionRegular    = "RTH"
+	SessionPostMarket = "POST"
+)
+
+// ExtendedHours reports whether the bar belongs to the pre-market or
+// after-hours session
+func (m MarketData) ExtendedHours() bool {
+	return m.session() != SessionRegular
+}
+
+// session returns the session of the bar. Bars without one, cached before
+// sessions were recorded, are of the regular session.
+func (m MarketData) session() string {
+	if m.Session == "" {
+		return SessionRegular
+	}
+	return m.Session
+}
+
+// sessionAt returns the session of market that an intraday bar starting at t
+// belongs to, and its bounds; ok is false outside every session, including
+// on days the market is closed
+func sessionAt(market *calendar.MarketCalendar, t time.Time) (session string, start, end time.Time, ok bool) {
+	day := market.Day(t)
+	switch {
+	case day.Closed() || t.Before(day.PreMarketOpen) || !t.Before(day.PostMarketClose):
+		return "", time.Time{}, time.Time{}, false
+	case t.Before(day.Open):
+		return SessionPreMarket, day.PreMarketOpen, day.Open, true
+	case t.Before(day.Close):
+		return SessionRegular, day.Open, day.Close, true
+	default:
+		return SessionPostMarket, day.Close, day.PostMarketClose, true
+	}
+}
+
+// regularSessionBars returns the bars of data outside the extended sessions,
+// data itself when it has none
+func regularSessionBars(data []MarketData) []MarketData {
+	extended := 0
+	for _, bar := range data {
+		if bar.ExtendedHours() {
+			extended++
+		}
+	}
+	if extended == 0 {
+		return data
+	}
+	regular := make([]MarketData, 0, len(data)-extended)
+	for _, bar := range data {
+		if !bar.ExtendedHours() {
+			regular = append(regular, bar)
+		}
+	}
+	return regular
+}
+
+// sessionSeries returns the series strategies evaluate over data: regular of
+// the regular session's bars, for the strategies not declaring they read
+// extended hours, and extended of every bar, for those that do. Both are the
+// same series when data has no extended-hours bars.
+func sessionSeries(data []MarketData) (regular, extended *strategy.Series) {
+	bars := regularSessionBars(data)
+	regular = strategy.NewSeries(toBars(bars))
+	if len(bars) == len(data) {
+		return regular, regular
+	}
+	return regular, strategy.NewSeries(toBars(data))
+}
+
+// seriesFor returns the series of regular and extended that s evaluates
+func seriesFor(s strategy.Strategy, regular, extended *strategy.Series) *strategy.Series {
+	if strategy.UsesExtendedHours(s) {
+		return extended
+	}
+	return regular
+}
@@ -0,0 +1,259 @@
+package scanner
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/trustdan/ibkr-trader/go/pkg/calendar"
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+	"github.com/trustdan/ibkr-trader/go/pkg/strategy"
+)
+
+// afterHoursStrategy reads extended hours and signals long on an after-hours
+// bar
+type afterHoursStrategy struct{}
+
+func (afterHoursStrategy) Name() string                 { return "AFTER_HOURS" }
+func (afterHoursStrategy) Params() []strategy.ParamSpec { return nil }
+func (afterHoursStrategy) ExtendedHours() bool          { return true }
+
+func (afterHoursStrategy) Evaluate(series *strategy.Series, i int, params strategy.Params) string {
+	if bar := series.Bars[i].Time.In(newYorkLocation()); bar.Hour() >= 16 {
+		return strategy.Long
+	}
+	return ""
+}
+
+func (s afterHoursStrategy) Score(series *strategy.Series, i int, params strategy.Params) float64 {
+	if s.Evaluate(series, i, params) == "" {
+		return 0
+	}
+	return strategy.MaxScore
+}
+
+// fetchMock returns the mock 30-minute trade bars of symbol for the first
+// half of 2024, with or without extended hours
+func fetchMock(t *testing.T, symbol string, extended bool) []MarketData {
+	t.Helper()
+	spec := BarSpec{BarSize: BarSize30Min, WhatToShow: WhatToShowTrades, IncludeExtendedHours: extended}
+	data, err := NewMockDataProvider(DefaultConfig()).GetHistoricalData(context.Background(), symbol, "2024-01-02", "2024-06-28", spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestMockTagsSessions(t *testing.T) {
+	spec := BarSpec{BarSize: BarSize30Min, WhatToShow: WhatToShowTrades, IncludeExtendedHours: true}
+	data, err := NewMockDataProvider(DefaultConfig()).GetHistoricalData(context.Background(), "AAPL", "2024-07-01", "2024-07-01", spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 11 pre-market bars from 4:00, 13 regular and 8 after-hours until 20:00
+	counts := map[string]int{}
+	market := calendar.DefaultMarketCalendar()
+	for _, bar := range data {
+		counts[bar.Session]++
+		if session, _, _, ok := sessionAt(market, bar.Timestamp); !ok || session != bar.Session {
+			t.Errorf("Bar at %s tagged %s, the calendar has it in %q", bar.Timestamp, bar.Session, session)
+		}
+		if bar.ExtendedHours() && bar.Volume >= 1000000 {
+			t.Errorf("Extended-hours bar at %s traded %d, want thinner volume", bar.Timestamp, bar.Volume)
+		}
+	}
+	if want := map[string]int{SessionPreMarket: 11, SessionRegular: 13, SessionPostMarket: 8}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("Bars per session = %v, want %v", counts, want)
+	}
+	if first := data[0].Timestamp.In(newYorkLocation()); first.Hour() != 4 || first.Minute() != 0 {
+		t.Errorf("First bar at %s, want 4:00", first)
+	}
+
+	// Daily bars are of the regular session
+	daily, err := NewMockDataProvider(DefaultConfig()).GetHistoricalData(context.Background(), "AAPL", "2024-07-01", "2024-07-01", DefaultBarSpec())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(daily) != 1 || daily[0].Session != SessionRegular {
+		t.Errorf("Daily bars = %+v, want one of the regular session", daily)
+	}
+}
+
+func TestRegularSessionBars(t *testing.T) {
+	regular := fetchMock(t, "MSFT", false)
+	extended := fetchMock(t, "MSFT", true)
+	if len(extended) <= len(regular) {
+		t.Fatalf("Got %d bars with extended hours and %d without", len(extended), len(regular))
+	}
+	if filtered := regularSessionBars(extended); !reflect.DeepEqual(filtered, regular) {
+		t.Errorf("Filtering %d extended bars left %d, want the %d regular ones", len(extended), len(filtered), len(regular))
+	}
+
+	// Bars without extended hours are returned as they are, as are bars
+	// without a session
+	if filtered := regularSessionBars(regular); &filtered[0] != &regular[0] {
+		t.Error("Filtering bars of the regular session copied them")
+	}
+	untagged := []MarketData{{Close: 1}, {Close: 2}}
+	if filtered := regularSessionBars(untagged); len(filtered) != 2 {
+		t.Errorf("Filtering bars without a session left %d, want 2", len(filtered))
+	}
+}
+
+func TestWithExtendedHours(t *testing.T) {
+	cfg := DefaultConfig()
+	intraday := BarSpec{BarSize: BarSize5Min, WhatToShow: WhatToShowTrades}
+	yes, no := true, false
+
+	for _, tc := range []struct {
+		name       string
+		configured bool
+		requested  *bool
+		spec       BarSpec
+		want       bool
+	}{
+		{"config off", false, nil, intraday, false},
+		{"config on", true, nil, intraday, true},
+		{"request on", false, &yes, intraday, true},
+		{"request off", true, &no, intraday, false},
+		{"daily", true, &yes, DefaultBarSpec(), false},
+	} {
+		cfg.UsePremarketData = tc.configured
+		if got := cfg.withExtendedHours(tc.spec, tc.requested); got.IncludeExtendedHours != tc.want {
+			t.Errorf("%s: IncludeExtendedHours = %t, want %t", tc.name, got.IncludeExtendedHours, tc.want)
+		}
+	}
+
+	// Series with and without extended hours are cached apart
+	extended := intraday
+	extended.IncludeExtendedHours = true
+	if intraday.String() == extended.String() {
+		t.Errorf("Specs with and without extended hours share the key %s", intraday)
+	}
+}
+
+func TestRegularSessionStrategiesIgnoreExtendedHours(t *testing.T) {
+	configured := []strategy.Configured{}
+	for _, name := range []string{"HIGH_BASE", "LOW_BASE"} {
+		strat, _ := strategy.Lookup(name)
+		params, err := strategy.ResolveParams(strat, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		configured = append(configured, strategy.Configured{Strategy: strat, Params: params})
+	}
+
+	// Replayed over every bar, the strategies signal as without extended hours
+	for _, symbol := range []string{"AAPL", "SPY", "TSLA"} {
+		without, err := replaySessions(context.Background(), fetchMock(t, symbol, false), configured)
+		if err != nil {
+			t.Fatal(err)
+		}
+		with, err := replaySessions(context.Background(), fetchMock(t, symbol, true), configured)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(without) == 0 {
+			t.Fatalf("No signals replaying %s, the comparison proves nothing", symbol)
+		}
+		if !reflect.DeepEqual(with, without) {
+			t.Errorf("%s: %d signals with extended hours, %d without", symbol, len(with), len(without))
+		}
+	}
+
+	// Scans agree too
+	service := newMockTestService(t)
+	scan := func(extended bool) *pb.ScanResponse {
+		resp, err := service.Scan(context.Background(), &pb.ScanRequest{
+			Symbols:              []string{"AAPL", "MSFT", "SPY", "QQQ", "TSLA", "NVDA"},
+			DateRange:            &pb.DateRange{StartDate: "2024-05-01", EndDate: "2024-06-28"},
+			BarSize:              BarSize30Min,
+			IncludeExtendedHours: &extended,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.ScanTimeSeconds = 0
+		return resp
+	}
+	if with, without := scan(true), scan(false); !proto.Equal(with, without) {
+		t.Errorf("Scan responses differ:\nwith extended hours:    %v\nwithout extended hours: %v", with, without)
+	}
+}
+
+func TestExtendedHoursStrategySeesExtendedBars(t *testing.T) {
+	params := strategy.Params{}
+	configured := []strategy.Configured{{Strategy: afterHoursStrategy{}, Params: params}}
+	engine := newTestEngine(t)
+
+	// The last bar of the day is after hours, so the strategy signals on it
+	if signals := engine.evaluateStrategies(fetchMock(t, "AAPL", true), configured); len(signals) != 1 {
+		t.Errorf("Signals with extended hours = %+v, want one", signals)
+	}
+	if signals := engine.evaluateStrategies(fetchMock(t, "AAPL", false), configured); len(signals) != 0 {
+		t.Errorf("Signals without extended hours = %+v, want none", signals)
+	}
+
+	// Replaying both kinds keeps the signals in time order
+	highBase, _ := strategy.Lookup("HIGH_BASE")
+	defaults, _ := strategy.ResolveParams(highBase, nil)
+	triggers, err := replaySessions(context.Background(), fetchMock(t, "AAPL", true), append(configured, strategy.Configured{Strategy: highBase, Params: defaults}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	strategies := map[string]bool{}
+	for i, trigger := range triggers {
+		strategies[trigger.Strategy] = true
+		if i > 0 && trigger.Time.Before(triggers[i-1].Time) {
+			t.Fatalf("Signal %d at %s follows one at %s", i, trigger.Time, triggers[i-1].Time)
+		}
+	}
+	if !strategies["AFTER_HOURS"] || !strategies["HIGH_BASE"] {
+		t.Errorf("Strategies signaling = %v, want both", strategies)
+	}
+}
+
+func TestYahooChartQueryIncludesPrePost(t *testing.T) {
+	spec := BarSpec{BarSize: BarSize5Min, WhatToShow: WhatToShowTrades}
+	query, err := yahooChartQuery("2024-07-01", "2024-07-05", spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query.Get("includePrePost") != "false" || query.Get("interval") != "5m" {
+		t.Errorf("Query without extended hours = %s", query.Encode())
+	}
+
+	spec.IncludeExtendedHours = true
+	if query, _ = yahooChartQuery("2024-07-01", "2024-07-05", spec); query.Get("includePrePost") != "true" {
+		t.Errorf("Query with extended hours = %s", query.Encode())
+	}
+	if _, err := yahooChartQuery("July 1st", "2024-07-05", spec); err == nil {
+		t.Error("Query of an invalid date succeeded")
+	}
+}
+
+func TestDataQualityGapsWithinSessions(t *testing.T) {
+	newYork := newYorkLocation()
+	bar := func(hour, minute int, session string, closing float64) MarketData {
+		return MarketData{Timestamp: time.Date(2024, 7, 1, hour, minute, 0, 0, newYork), Open: closing, High: closing, Low: closing, Close: closing, Session: session}
+	}
+	spec := BarSpec{BarSize: BarSize30Min, WhatToShow: WhatToShowTrades, IncludeExtendedHours: true}
+	tolerances := QualityTolerances{GapPercent: 5, MaxGaps: 0}
+	market := calendar.DefaultMarketCalendar()
+
+	// The open prices away from the pre-market, which is not a gap
+	data := []MarketData{bar(9, 0, SessionPreMarket, 100), bar(9, 30, SessionRegular, 110), bar(10, 0, SessionRegular, 111)}
+	if report := CheckDataQuality("AAPL", data, spec, market, tolerances, time.Now()); !report.Passed {
+		t.Errorf("Move between sessions failed the check: %s", report.Reason)
+	}
+
+	// Within a session it is
+	data = append(data, bar(10, 30, SessionRegular, 130))
+	if report := CheckDataQuality("AAPL", data, spec, market, tolerances, time.Now()); report.Issues[IssueAbnormalGap] != 1 {
+		t.Errorf("Gaps within a session = %d, want 1", report.Issues[IssueAbnormalGap])
+	}
+}
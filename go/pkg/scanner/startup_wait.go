@@ -0,0 +1,125 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+)
+
+// Default addresses the providers are probed at without a DataProviderURL:
+// a paper IB Gateway on the local host and the Yahoo Finance API
+const (
+	defaultIBKRAddress = "127.0.0.1:4002"
+	defaultYahooURL    = "https://query1.finance.yahoo.com"
+)
+
+// maxProbeBackoff caps the doubling delay between probes of the startup wait
+const maxProbeBackoff = 30 * time.Second
+
+// probeTimeout bounds each probe of the data provider
+const probeTimeout = 5 * time.Second
+
+// HealthProber is implemented by data providers that can check they are
+// reachable without fetching bars
+type HealthProber interface {
+	// ProbeHealth returns an error when the provider cannot serve fetches yet
+	ProbeHealth(ctx context.Context) error
+}
+
+// ProbeHealth checks that provider can serve fetches. A provider that cannot
+// be probed is taken to be reachable.
+func ProbeHealth(ctx context.Context, provider DataProvider) error {
+	if prober, ok := provider.(HealthProber); ok {
+		return prober.ProbeHealth(ctx)
+	}
+	return nil
+}
+
+// dependencyWait tracks the startup wait for the data provider
+type dependencyWait struct {
+	waiting atomic.Bool
+	// nextProbe is when the provider is probed again, in Unix nanoseconds
+	nextProbe atomic.Int64
+}
+
+// AwaitDataProvider probes the data provider until it answers, with the
+// backoff of the startup wait settings, and returns a channel receiving nil
+// once it did, or an error when DataProviderWaitMax passed or ctx was done
+// first. From the call until then, the RPCs that would call the provider
+// fail with UNAVAILABLE rather than fetching. Without a DataProviderWaitMax
+// the provider is not probed and the channel receives nil at once.
+func (s *Engine) AwaitDataProvider(ctx context.Context) <-chan error {
+	done := make(chan error, 1)
+	if s.Config().DataProviderWaitMax <= 0 {
+		done <- nil
+		close(done)
+		return done
+	}
+	s.dependencies.nextProbe.Store(time.Now().UnixNano())
+	s.dependencies.waiting.Store(true)
+
+	go func() {
+		err := s.waitForDataProvider(ctx)
+		s.dependencies.waiting.Store(false)
+		done <- err
+		close(done)
+	}()
+	return done
+}
+
+// waitForDataProvider probes the data provider until it answers, logging each
+// failed probe
+func (s *Engine) waitForDataProvider(ctx context.Context) error {
+	cfg := s.Config()
+	ctx, cancel := context.WithTimeout(ctx, cfg.DataProviderWaitMax)
+	defer cancel()
+
+	start := time.Now()
+	backoff := cfg.DataProviderProbeBackoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+	for probes := 1; ; probes++ {
+		probeCtx, cancelProbe := context.WithTimeout(ctx, probeTimeout)
+		err := ProbeHealth(probeCtx, s.current().dataProvider)
+		cancelProbe()
+		if err == nil {
+			if probes > 1 {
+				logrus.Infof("Data provider reachable after %d probes in %s", probes, time.Since(start).Round(time.Millisecond))
+			}
+			return nil
+		}
+
+		s.dependencies.nextProbe.Store(time.Now().Add(backoff).UnixNano())
+		logrus.WithFields(logrus.Fields{
+			"probe":    probes,
+			"retry_in": backoff,
+			"waited":   time.Since(start).Round(time.Millisecond),
+			"max_wait": cfg.DataProviderWaitMax,
+		}).Warnf("Data provider not reachable: %v", err)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("data provider not reachable after %d probes in %s: %w", probes, time.Since(start).Round(time.Millisecond), err)
+		case <-timer.C:
+		}
+		backoff = min(2*backoff, maxProbeBackoff)
+	}
+}
+
+// admitProviderCalls returns an UNAVAILABLE error while the scanner waits for
+// its data provider at startup, asking the client to retry once the next
+// probe is due, and at least a second later
+func (s *Engine) admitProviderCalls(ctx context.Context) error {
+	if !s.dependencies.waiting.Load() {
+		return nil
+	}
+	retryAfter := max(time.Until(time.Unix(0, s.dependencies.nextProbe.Load())), time.Second)
+	return retryableError(ctx, codes.Unavailable, retryAfter, "scanner waiting for its data provider")
+}
@@ -0,0 +1,161 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// unreachableProvider fails its first failures probes and counts the probes
+// and fetches
+type unreachableProvider struct {
+	failures int32
+	probes   atomic.Int32
+	fetches  atomic.Int32
+}
+
+func (p *unreachableProvider) GetHistoricalData(ctx context.Context, symbol, startDate, endDate string, spec BarSpec) ([]MarketData, error) {
+	p.fetches.Add(1)
+	return risingBars(symbol, startDate, endDate), nil
+}
+
+func (p *unreachableProvider) ProbeHealth(ctx context.Context) error {
+	if p.probes.Add(1) <= p.failures {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+// waitingService returns a service probing provider every 20ms at first, for
+// at most maxWait
+func waitingService(t *testing.T, provider DataProvider, maxWait time.Duration) *ScannerService {
+	t.Helper()
+	service := newTestService(t)
+	cfg := *service.Config()
+	cfg.DataProviderWaitMax = maxWait
+	cfg.DataProviderProbeBackoff = 20 * time.Millisecond
+	service.UpdateConfig(&cfg)
+	useProvider(service, provider)
+	return service
+}
+
+func TestAwaitDataProvider(t *testing.T) {
+	provider := &unreachableProvider{failures: 4}
+	service := waitingService(t, provider, 5*time.Second)
+	client := dialTestServer(t, service)
+	req := &pb.ScanRequest{Symbols: []string{"AAPL"}, Strategies: []string{"HIGH_BASE"}, DateRange: testDateRange()}
+
+	start := time.Now()
+	ready := service.AwaitDataProvider(context.Background())
+
+	// Until the provider answers, scans are turned away without fetching
+	var header metadata.MD
+	if _, err := client.Scan(context.Background(), req, grpc.Header(&header)); status.Code(err) != codes.Unavailable {
+		t.Fatalf("Scan while waiting = %v, want Unavailable", err)
+	}
+	if got := header.Get("retry-after"); len(got) != 1 || got[0] != "1" {
+		t.Errorf("retry-after header = %v, want 1", got)
+	}
+	bulk := &pb.BulkFetchRequest{Symbols: []string{"AAPL"}, DateRange: testDateRange()}
+	if _, err := client.BulkFetch(context.Background(), bulk); status.Code(err) != codes.Unavailable {
+		t.Errorf("BulkFetch while waiting = %v, want Unavailable", err)
+	}
+	if fetches := provider.fetches.Load(); fetches != 0 {
+		t.Errorf("Fetches while waiting = %d, want none", fetches)
+	}
+
+	if err := <-ready; err != nil {
+		t.Fatalf("AwaitDataProvider() = %v", err)
+	}
+	// Four failed probes back off 20, 40, 80 and 160ms before the fifth
+	// succeeds
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("Ready after %s, want the backoff of four failed probes", elapsed)
+	}
+	if probes := provider.probes.Load(); probes != 5 {
+		t.Errorf("Probes = %d, want 5", probes)
+	}
+	if _, err := client.Scan(context.Background(), req); err != nil {
+		t.Errorf("Scan once ready = %v", err)
+	}
+}
+
+func TestAwaitDataProviderGivesUp(t *testing.T) {
+	provider := &unreachableProvider{failures: 1 << 30}
+	service := waitingService(t, provider, 100*time.Millisecond)
+
+	start := time.Now()
+	if err := <-service.AwaitDataProvider(context.Background()); err == nil {
+		t.Fatal("AwaitDataProvider() succeeded with an unreachable provider")
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > time.Second {
+		t.Errorf("Gave up after %s, want the 100ms max wait", elapsed)
+	}
+	// The scanner then serves, so the failures show in the scans
+	if err := service.admitProviderCalls(context.Background()); err != nil {
+		t.Errorf("admitProviderCalls() after the wait = %v", err)
+	}
+
+	// Without a max wait the provider is not probed
+	provider.probes.Store(0)
+	service = waitingService(t, provider, 0)
+	if err := <-service.AwaitDataProvider(context.Background()); err != nil || provider.probes.Load() != 0 {
+		t.Errorf("AwaitDataProvider() without a max wait = %v after %d probes", err, provider.probes.Load())
+	}
+}
+
+func TestProbeHealth(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+
+	up := httptest.NewServer(http.NotFoundHandler())
+	defer up.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	tests := []struct {
+		providerType string
+		url          string
+		wantErr      bool
+	}{
+		{providerType: "mock"},
+		{providerType: "ibkr", url: listener.Addr().String()},
+		{providerType: "ibkr", url: closed.Addr().String(), wantErr: true},
+		{providerType: "yahoo", url: up.URL},
+		{providerType: "yahoo", url: down.URL, wantErr: true},
+		// The probe reaches the provider through the cache and fault injection
+		{providerType: "chaos:ibkr", url: closed.Addr().String(), wantErr: true},
+	}
+	for _, tt := range tests {
+		cfg := DefaultConfig()
+		cfg.DataProviderType = tt.providerType
+		cfg.DataProviderURL = tt.url
+		provider := NewDataProvider(cfg, NewMetricTracker(prometheus.NewRegistry()))
+		if err := ProbeHealth(context.Background(), provider); (err != nil) != tt.wantErr {
+			t.Errorf("ProbeHealth(%s at %q) = %v, want error %v", tt.providerType, tt.url, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// Fetch outcomes of a symbol, as reported by GetSymbolHealth
+const (
+	FetchOK      = "OK"
+	FetchTimeout = "TIMEOUT"
+	FetchError   = "ERROR"
+)
+
+// Prefixes of the scan errors of symbols whose fetch timed out or failed, or
+// that were skipped while cooling down
+const (
+	ErrorTimeout  = "TIMEOUT"
+	ErrorFetch    = "FETCH_ERROR"
+	ErrorCooldown = "COOLDOWN"
+)
+
+// SymbolHealth is the failure record of one symbol since startup or its last
+// reset
+type SymbolHealth struct {
+	Symbol              string
+	LastOutcome         string
+	ConsecutiveTimeouts int
+	Timeouts            int
+	Errors              int
+	// SkippedScansRemaining counts the scans that will still skip the symbol
+	SkippedScansRemaining int
+}
+
+// symbolHealthTracker records the fetch outcomes of scanned symbols and cools
+// down those that keep timing out. Only symbols that have failed are tracked.
+type symbolHealthTracker struct {
+	mu      sync.Mutex
+	symbols map[string]*SymbolHealth
+}
+
+func newSymbolHealthTracker() *symbolHealthTracker {
+	return &symbolHealthTracker{symbols: make(map[string]*SymbolHealth)}
+}
+
+// fetchOutcome classifies the result of fetching a symbol under symbolCtx,
+// which carries the SymbolTimeout
+func fetchOutcome(symbolCtx context.Context, err error) string {
+	switch {
+	case err == nil:
+		return FetchOK
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(symbolCtx.Err(), context.DeadlineExceeded):
+		return FetchTimeout
+	default:
+		return FetchError
+	}
+}
+
+// admit reports whether a scan should fetch symbol. A cooling-down symbol is
+// skipped, which counts down its remaining scans.
+func (t *symbolHealthTracker) admit(symbol string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	health := t.symbols[symbol]
+	if health == nil || health.SkippedScansRemaining == 0 {
+		return true
+	}
+
+	health.SkippedScansRemaining--
+	if health.SkippedScansRemaining == 0 {
+		// The next scan fetches it again, with a fresh run of timeouts
+		health.ConsecutiveTimeouts = 0
+		logrus.Infof("Skipping %s for the last time, it is readmitted to the next scan", symbol)
+	} else {
+		logrus.Infof("Skipping %s after %d consecutive timeouts, %d more scans to skip", symbol, health.ConsecutiveTimeouts, health.SkippedScansRemaining)
+	}
+	return false
+}
+
+// record counts an outcome of fetching symbol. With cooldownAfter and
+// cooldownScans set, cooldownAfter timeouts in a row make the next
+// cooldownScans scans skip the symbol.
+func (t *symbolHealthTracker) record(symbol, outcome string, cooldownAfter, cooldownScans int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	health := t.symbols[symbol]
+	if health == nil {
+		if outcome == FetchOK {
+			return
+		}
+		health = &SymbolHealth{Symbol: symbol}
+		t.symbols[symbol] = health
+	}
+	health.LastOutcome = outcome
+
+	switch outcome {
+	case FetchOK:
+		health.ConsecutiveTimeouts = 0
+	case FetchError:
+		health.Errors++
+		health.ConsecutiveTimeouts = 0
+	case FetchTimeout:
+		health.Timeouts++
+		health.ConsecutiveTimeouts++
+		if cooldownAfter > 0 && cooldownScans > 0 && health.ConsecutiveTimeouts >= cooldownAfter && health.SkippedScansRemaining == 0 {
+			health.SkippedScansRemaining = cooldownScans
+			logrus.Warnf("%s timed out %d scans in a row, skipping it for the next %d scans", symbol, health.ConsecutiveTimeouts, cooldownScans)
+		}
+	}
+}
+
+// list returns the tracked symbols sorted by symbol
+func (t *symbolHealthTracker) list() []SymbolHealth {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := make([]SymbolHealth, 0, len(t.symbols))
+	for _, health := range t.symbols {
+		out = append(out, *health)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Symbol < out[j].Symbol })
+	return out
+}
+
+// reset forgets the given symbols, or every symbol when none are given, and
+// returns how many were tracked
+func (t *symbolHealthTracker) reset(symbols []string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(symbols) == 0 {
+		n := len(t.symbols)
+		t.symbols = make(map[string]*SymbolHealth)
+		return n
+	}
+	n := 0
+	for _, symbol := range symbols {
+		if _, ok := t.symbols[symbol]; ok {
+			delete(t.symbols, symbol)
+			n++
+		}
+	}
+	return n
+}
+
+// GetSymbolHealth implements the GetSymbolHealth RPC method
+func (s *Engine) GetSymbolHealth(ctx context.Context, req *pb.SymbolHealthRequest) (*pb.SymbolHealthResponse, error) {
+	tracked := s.symbolHealth.list()
+	symbols := make([]*pb.SymbolHealth, len(tracked))
+	for i, health := range tracked {
+		symbols[i] = &pb.SymbolHealth{
+			Symbol:                health.Symbol,
+			LastOutcome:           health.LastOutcome,
+			ConsecutiveTimeouts:   int32(health.ConsecutiveTimeouts),
+			Timeouts:              int32(health.Timeouts),
+			Errors:                int32(health.Errors),
+			SkippedScansRemaining: int32(health.SkippedScansRemaining),
+		}
+	}
+	return &pb.SymbolHealthResponse{Symbols: symbols}, nil
+}
+
+// ResetSymbolHealth implements the ResetSymbolHealth RPC method, readmitting
+// the symbols to the next scan
+func (s *Engine) ResetSymbolHealth(ctx context.Context, req *pb.ResetSymbolHealthRequest) (*pb.ResetSymbolHealthResponse, error) {
+	n := s.symbolHealth.reset(req.Symbols)
+	logrus.Infof("Reset the fetch failures of %d symbols", n)
+	return &pb.ResetSymbolHealthResponse{SymbolsReset: int32(n)}, nil
+}
@@ -0,0 +1,201 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// stallingProvider serves rising bars, except that fetches of the stalled
+// symbols block until they time out and those of the broken symbols fail.
+// A stalled fetch returns linger after its timeout. It counts the fetches
+// of each symbol and those running.
+type stallingProvider struct {
+	stalled map[string]bool
+	broken  map[string]bool
+	linger  time.Duration
+
+	mu      sync.Mutex
+	fetches map[string]int
+	active  int
+}
+
+func (p *stallingProvider) GetHistoricalData(ctx context.Context, symbol, startDate, endDate string, spec BarSpec) ([]MarketData, error) {
+	p.mu.Lock()
+	p.fetches[symbol]++
+	p.active++
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.active--
+		p.mu.Unlock()
+	}()
+
+	switch {
+	case p.stalled[symbol]:
+		<-ctx.Done()
+		time.Sleep(p.linger)
+		return nil, ctx.Err()
+	case p.broken[symbol]:
+		return nil, errors.New("no such symbol")
+	}
+	return risingBars(symbol, startDate, endDate), nil
+}
+
+func (p *stallingProvider) fetchCount(symbol string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.fetches[symbol]
+}
+
+// newStallingTestService returns a test service whose symbols cool down
+// after two timeouts for two scans
+func newStallingTestService(t *testing.T) (*ScannerService, *stallingProvider) {
+	t.Helper()
+	service := newTestService(t)
+	cfg := service.Config()
+	cfg.SymbolTimeout = 20 * time.Millisecond
+	cfg.SymbolCooldownAfter = 2
+	cfg.SymbolCooldownScans = 2
+
+	provider := &stallingProvider{
+		stalled: map[string]bool{"ILLQ": true},
+		broken:  map[string]bool{"GONE": true},
+		fetches: make(map[string]int),
+	}
+	useProvider(service, provider)
+	return service, provider
+}
+
+func scanSymbols(t *testing.T, service *ScannerService, symbols ...string) *pb.ScanResponse {
+	t.Helper()
+	resp, err := service.Scan(context.Background(), &pb.ScanRequest{
+		Symbols:    symbols,
+		Strategies: []string{"HIGH_BASE"},
+		DateRange:  testDateRange(),
+	})
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	return resp
+}
+
+func symbolHealth(t *testing.T, service *ScannerService) map[string]*pb.SymbolHealth {
+	t.Helper()
+	resp, err := service.GetSymbolHealth(context.Background(), &pb.SymbolHealthRequest{})
+	if err != nil {
+		t.Fatalf("GetSymbolHealth failed: %v", err)
+	}
+	bySymbol := make(map[string]*pb.SymbolHealth)
+	for _, health := range resp.Symbols {
+		bySymbol[health.Symbol] = health
+	}
+	return bySymbol
+}
+
+func TestTimingOutSymbolsCoolDown(t *testing.T) {
+	service, provider := newStallingTestService(t)
+
+	// Two timeouts in a row put ILLQ on cool-down; errors do not
+	for i := 0; i < 2; i++ {
+		resp := scanSymbols(t, service, "AAPL", "ILLQ", "GONE")
+		if resp.Signals["AAPL"] == nil {
+			t.Fatalf("Scan %d: AAPL should still signal, got %v", i+1, resp.Signals)
+		}
+		if len(resp.Errors) != 2 || !strings.HasPrefix(resp.Errors["ILLQ"], ErrorTimeout+": ") || resp.Errors["GONE"] != ErrorFetch+": no such symbol" {
+			t.Errorf("Scan %d errors: got %v, want ILLQ timed out and GONE failed", i+1, resp.Errors)
+		}
+	}
+	health := symbolHealth(t, service)
+	if len(health) != 2 || health["AAPL"] != nil {
+		t.Fatalf("Only failing symbols should be listed, got %v", health)
+	}
+	if h := health["ILLQ"]; h.LastOutcome != FetchTimeout || h.ConsecutiveTimeouts != 2 || h.Timeouts != 2 || h.SkippedScansRemaining != 2 {
+		t.Errorf("ILLQ: got %v, want two timeouts and two scans to skip", h)
+	}
+	if h := health["GONE"]; h.LastOutcome != FetchError || h.Errors != 2 || h.Timeouts != 0 || h.SkippedScansRemaining != 0 {
+		t.Errorf("GONE: got %v, want two errors and no cool-down", h)
+	}
+
+	// The next two scans skip ILLQ, then it is fetched again
+	for i := 0; i < 2; i++ {
+		if resp := scanSymbols(t, service, "AAPL", "ILLQ"); len(resp.Errors) != 1 || !strings.HasPrefix(resp.Errors["ILLQ"], ErrorCooldown+": ") {
+			t.Errorf("Errors while ILLQ cools down: got %v", resp.Errors)
+		}
+	}
+	if n := provider.fetchCount("ILLQ"); n != 2 {
+		t.Errorf("ILLQ fetches while cooling down: got %d, want 2", n)
+	}
+	if h := symbolHealth(t, service)["ILLQ"]; h.SkippedScansRemaining != 0 || h.ConsecutiveTimeouts != 0 {
+		t.Errorf("ILLQ after its cool-down: got %v, want readmitted", h)
+	}
+	scanSymbols(t, service, "AAPL", "ILLQ")
+	if n := provider.fetchCount("ILLQ"); n != 3 {
+		t.Errorf("ILLQ fetches after its cool-down: got %d, want 3", n)
+	}
+	if n := provider.fetchCount("AAPL"); n != 5 {
+		t.Errorf("AAPL fetches: got %d, want one per scan", n)
+	}
+}
+
+func TestResetSymbolHealthReadmitsSymbols(t *testing.T) {
+	service, provider := newStallingTestService(t)
+	scanSymbols(t, service, "ILLQ", "GONE")
+	scanSymbols(t, service, "ILLQ", "GONE")
+
+	resp, err := service.ResetSymbolHealth(context.Background(), &pb.ResetSymbolHealthRequest{Symbols: []string{"ILLQ", "AAPL"}})
+	if err != nil || resp.SymbolsReset != 1 {
+		t.Fatalf("ResetSymbolHealth(ILLQ, AAPL): got %v, %v, want one symbol reset", resp, err)
+	}
+	scanSymbols(t, service, "ILLQ")
+	if n := provider.fetchCount("ILLQ"); n != 3 {
+		t.Errorf("ILLQ fetches after a reset: got %d, want 3", n)
+	}
+
+	// No symbols reset them all
+	resp, err = service.ResetSymbolHealth(context.Background(), &pb.ResetSymbolHealthRequest{})
+	if err != nil || resp.SymbolsReset != 2 {
+		t.Errorf("ResetSymbolHealth(): got %v, %v, want ILLQ and GONE reset", resp, err)
+	}
+	if health := symbolHealth(t, service); len(health) != 0 {
+		t.Errorf("Symbol health after resetting all: got %v", health)
+	}
+}
+
+func TestCancelledScanDoesNotCountTimeouts(t *testing.T) {
+	service, _ := newStallingTestService(t)
+	service.Config().SymbolTimeout = time.Minute
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	service.Scan(ctx, &pb.ScanRequest{Symbols: []string{"ILLQ"}, DateRange: testDateRange()})
+
+	if health := symbolHealth(t, service); len(health) != 0 {
+		t.Errorf("A cancelled scan should not count against its symbols, got %v", health)
+	}
+}
+
+func TestCancelledScanWaitsForItsSymbols(t *testing.T) {
+	service, provider := newStallingTestService(t)
+	service.Config().SymbolTimeout = time.Minute
+	provider.linger = 50 * time.Millisecond
+
+	// ILLQ holds the only worker until the scan is cancelled, which stops it
+	// while the next symbol waits for the worker
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := service.Scan(ctx, &pb.ScanRequest{Symbols: []string{"ILLQ", "AAPL", "MSFT"}, MaxConcurrency: 1, DateRange: testDateRange()})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Cancelled scan: got %v, want the deadline", err)
+	}
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	if provider.active != 0 {
+		t.Errorf("%d fetches still running after the scan returned", provider.active)
+	}
+}
@@ -0,0 +1,65 @@
+package scanner
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/trustdan/ibkr-trader/go/pkg/metadata"
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// MaxMetadataSymbols bounds the symbols of one GetSymbolMetadata request
+const MaxMetadataSymbols = 500
+
+// GetSymbolMetadata implements the GetSymbolMetadata RPC method. The
+// metadata comes from the snapshot of the active configuration, whose etag
+// lets clients poll without transferring it again. A provider that is not a
+// metadata.Catalog has no etag and reports the symbols with a known sector
+// as present.
+func (s *Engine) GetSymbolMetadata(ctx context.Context, req *pb.SymbolMetadataRequest) (*pb.SymbolMetadataResponse, error) {
+	if len(req.Symbols) > MaxMetadataSymbols {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d symbols per request, got %d", MaxMetadataSymbols, len(req.Symbols))
+	}
+
+	provider := s.current().metadata
+	if provider == nil {
+		// Without metadata every symbol is unknown, which is a snapshot too
+		provider = emptyCatalog
+	}
+	catalog, isCatalog := provider.(metadata.Catalog)
+	resp := &pb.SymbolMetadataResponse{}
+	if isCatalog {
+		resp.Etag = catalog.ETag()
+		if req.IfNoneMatch == resp.Etag {
+			resp.NotModified = true
+			return resp, nil
+		}
+	}
+
+	resp.Symbols = make([]*pb.SymbolMetadata, len(req.Symbols))
+	for i, symbol := range req.Symbols {
+		symbol = strings.ToUpper(strings.TrimSpace(symbol))
+		var meta metadata.SymbolMetadata
+		var present bool
+		if isCatalog {
+			meta, present = catalog.Find(symbol)
+		} else {
+			meta = metadata.Lookup(ctx, provider, symbol)
+			present = meta.Sector != metadata.Unknown
+		}
+		resp.Symbols[i] = &pb.SymbolMetadata{
+			Symbol:    symbol,
+			Present:   present,
+			Sector:    meta.Sector,
+			Industry:  meta.Industry,
+			MarketCap: meta.MarketCap,
+		}
+	}
+	return resp, nil
+}
+
+// emptyCatalog is the metadata of a scanner without a metadata file
+var emptyCatalog = metadata.NewStaticProvider(nil)
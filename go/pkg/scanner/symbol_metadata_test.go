@@ -0,0 +1,82 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+func TestGetSymbolMetadata(t *testing.T) {
+	service := newTestService(t)
+	ctx := context.Background()
+
+	resp, err := service.GetSymbolMetadata(ctx, &pb.SymbolMetadataRequest{Symbols: []string{"aapl", "ZZZZ", "XOM"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	symbols := resp.GetSymbols()
+	if len(symbols) != 3 || resp.Etag == "" || resp.NotModified {
+		t.Fatalf("GetSymbolMetadata() = %v", resp)
+	}
+	if aapl := symbols[0]; aapl.Symbol != "AAPL" || !aapl.Present || aapl.Sector != "Technology" || aapl.MarketCap != 3e12 {
+		t.Errorf("AAPL = %v", aapl)
+	}
+	if missing := symbols[1]; missing.Symbol != "ZZZZ" || missing.Present || missing.Sector != "UNKNOWN" {
+		t.Errorf("ZZZZ = %v, want it reported missing", missing)
+	}
+	if xom := symbols[2]; !xom.Present || xom.Sector != "Energy" {
+		t.Errorf("XOM = %v", xom)
+	}
+
+	// The caller's etag short-circuits the symbols
+	etag := resp.Etag
+	resp, err = service.GetSymbolMetadata(ctx, &pb.SymbolMetadataRequest{Symbols: []string{"AAPL"}, IfNoneMatch: etag})
+	if err != nil || !resp.NotModified || len(resp.Symbols) != 0 || resp.Etag != etag {
+		t.Errorf("GetSymbolMetadata(if_none_match) = %v, %v; want not modified", resp, err)
+	}
+
+	// A new metadata file changes the etag
+	path := filepath.Join(t.TempDir(), "metadata.csv")
+	if err := os.WriteFile(path, []byte("symbol,sector,industry,market_cap\nAAPL,Technology,Hardware,3100000000000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := *service.Config()
+	cfg.MetadataFile = path
+	service.UpdateConfig(&cfg)
+	resp, err = service.GetSymbolMetadata(ctx, &pb.SymbolMetadataRequest{Symbols: []string{"AAPL"}, IfNoneMatch: etag})
+	if err != nil || resp.NotModified || resp.Etag == etag || resp.Symbols[0].MarketCap != 3.1e12 {
+		t.Errorf("GetSymbolMetadata() after a reload = %v, %v; want the new snapshot", resp, err)
+	}
+}
+
+func TestGetSymbolMetadataBatchLimit(t *testing.T) {
+	service := newTestService(t)
+	symbols := make([]string, MaxMetadataSymbols+1)
+	for i := range symbols {
+		symbols[i] = fmt.Sprintf("S%d", i)
+	}
+
+	if _, err := service.GetSymbolMetadata(context.Background(), &pb.SymbolMetadataRequest{Symbols: symbols}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("GetSymbolMetadata(%d symbols) error = %v, want InvalidArgument", len(symbols), err)
+	}
+	resp, err := service.GetSymbolMetadata(context.Background(), &pb.SymbolMetadataRequest{Symbols: symbols[:MaxMetadataSymbols]})
+	if err != nil || len(resp.Symbols) != MaxMetadataSymbols {
+		t.Errorf("GetSymbolMetadata(%d symbols) = %d symbols, %v", MaxMetadataSymbols, len(resp.GetSymbols()), err)
+	}
+
+	// Without symbols only the etag is reported, even without metadata
+	cfg := *service.Config()
+	cfg.MetadataFile = ""
+	service.UpdateConfig(&cfg)
+	resp, err = service.GetSymbolMetadata(context.Background(), &pb.SymbolMetadataRequest{})
+	if err != nil || resp.Etag == "" || len(resp.Symbols) != 0 {
+		t.Errorf("GetSymbolMetadata() without symbols or metadata = %v, %v", resp, err)
+	}
+}
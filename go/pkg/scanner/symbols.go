@@ -0,0 +1,100 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Separators between a symbol's root and its share class in the data
+// providers' conventions: BRK.B at IBKR, BRK-B at Yahoo
+const (
+	ClassSeparatorDot  = "."
+	ClassSeparatorDash = "-"
+)
+
+// classSeparators are the separators accepted in requested symbols
+const classSeparators = ".- /"
+
+// maxSymbolLength is the longest symbol accepted, separators included
+const maxSymbolLength = 10
+
+// ErrorInvalidSymbol prefixes the error of a requested symbol that is not a
+// valid ticker
+const ErrorInvalidSymbol = "INVALID_SYMBOL"
+
+// SymbolNormalizer is implemented by data providers whose symbols follow a
+// convention of their own. Providers that do not implement it take symbols
+// in IBKR's convention.
+type SymbolNormalizer interface {
+	// NormalizeSymbol returns symbol as the provider names it, or an error
+	// when it is not a valid ticker
+	NormalizeSymbol(symbol string) (string, error)
+}
+
+// NormalizeSymbol returns symbol as provider names it
+func NormalizeSymbol(provider DataProvider, symbol string) (string, error) {
+	if normalizer, ok := provider.(SymbolNormalizer); ok {
+		return normalizer.NormalizeSymbol(symbol)
+	}
+	return NormalizeSymbolWith(symbol, ClassSeparatorDot)
+}
+
+// NormalizeSymbolWith trims and upper-cases symbol and writes its share
+// class separators, any of dot, dash, slash or space, as separator. A symbol
+// that is empty, longer than 10 characters, has no letter or has characters
+// other than letters and digits between its separators is invalid.
+func NormalizeSymbolWith(symbol, separator string) (string, error) {
+	normalized := strings.ToUpper(strings.TrimSpace(symbol))
+	if normalized == "" {
+		return "", errors.New("empty symbol")
+	}
+
+	parts := strings.FieldsFunc(normalized, func(r rune) bool { return strings.ContainsRune(classSeparators, r) })
+	letters := false
+	for _, part := range parts {
+		for _, r := range part {
+			switch {
+			case r >= 'A' && r <= 'Z':
+				letters = true
+			case r < '0' || r > '9':
+				return "", fmt.Errorf("%q has the character %q", symbol, r)
+			}
+		}
+	}
+	if joined := strings.Join(parts, ""); len(parts) == 0 || len(normalized) != len(joined)+len(parts)-1 {
+		return "", fmt.Errorf("%q has a misplaced share class separator", symbol)
+	}
+	if !letters {
+		return "", fmt.Errorf("%q has no letters", symbol)
+	}
+
+	normalized = strings.Join(parts, separator)
+	if len(normalized) > maxSymbolLength {
+		return "", fmt.Errorf("%q is longer than %d characters", symbol, maxSymbolLength)
+	}
+	return normalized, nil
+}
+
+// normalizeSymbols returns the requested symbols as provider names them, in
+// request order without repeats, and the scan error of each invalid one
+func normalizeSymbols(provider DataProvider, requested []string) ([]string, map[string]string) {
+	symbols := make([]string, 0, len(requested))
+	seen := make(map[string]bool, len(requested))
+	var invalid map[string]string
+	for _, symbol := range requested {
+		normalized, err := NormalizeSymbol(provider, symbol)
+		if err != nil {
+			if invalid == nil {
+				invalid = make(map[string]string)
+			}
+			invalid[symbol] = ErrorInvalidSymbol + ": " + err.Error()
+			continue
+		}
+		if !seen[normalized] {
+			seen[normalized] = true
+			symbols = append(symbols, normalized)
+		}
+	}
+	return symbols, invalid
+}
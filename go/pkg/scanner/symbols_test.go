@@ -0,0 +1,162 @@
+package scanner
+
+import (
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+func TestNormalizeSymbolWith(t *testing.T) {
+	for _, tc := range []struct {
+		symbol string
+		dot    string
+		dash   string
+	}{
+		{"AAPL", "AAPL", "AAPL"},
+		{" aapl ", "AAPL", "AAPL"},
+		{"BRK.B", "BRK.B", "BRK-B"},
+		{"BRK-B", "BRK.B", "BRK-B"},
+		{"brk b", "BRK.B", "BRK-B"},
+		{"BRK/B", "BRK.B", "BRK-B"},
+		{"BF.B", "BF.B", "BF-B"},
+		{"RDS-A", "RDS.A", "RDS-A"},
+		{"3M", "3M", "3M"},
+	} {
+		if got, err := NormalizeSymbolWith(tc.symbol, ClassSeparatorDot); got != tc.dot || err != nil {
+			t.Errorf("NormalizeSymbolWith(%q, dot) = %q, %v; want %q", tc.symbol, got, err, tc.dot)
+		}
+		if got, err := NormalizeSymbolWith(tc.symbol, ClassSeparatorDash); got != tc.dash || err != nil {
+			t.Errorf("NormalizeSymbolWith(%q, dash) = %q, %v; want %q", tc.symbol, got, err, tc.dash)
+		}
+	}
+
+	for _, symbol := range []string{"", "  ", "1234", "ABCDEFGHIJK", "BRK..B", ".BRK", "BRK-", "AB$", "ÄPPL"} {
+		if got, err := NormalizeSymbolWith(symbol, ClassSeparatorDot); err == nil {
+			t.Errorf("NormalizeSymbolWith(%q) = %q, want an error", symbol, got)
+		}
+	}
+}
+
+func TestNormalizeSymbolFollowsTheProvider(t *testing.T) {
+	cfg := DefaultConfig()
+	for _, tc := range []struct {
+		provider DataProvider
+		want     string
+	}{
+		{NewMockDataProvider(cfg), "BRK.B"},
+		{NewIBKRDataProvider(cfg), "BRK.B"},
+		{NewYahooDataProvider(cfg), "BRK-B"},
+		{NewCachedDataProvider(cfg, &instrumentedProvider{provider: NewYahooDataProvider(cfg)}, nil), "BRK-B"},
+	} {
+		if got, err := NormalizeSymbol(tc.provider, "brk b"); got != tc.want || err != nil {
+			t.Errorf("NormalizeSymbol(%T) = %q, %v; want %q", tc.provider, got, err, tc.want)
+		}
+	}
+}
+
+// recordingProvider serves rising bars and records the symbols fetched
+type recordingProvider struct {
+	mu      sync.Mutex
+	symbols []string
+}
+
+func (p *recordingProvider) GetHistoricalData(ctx context.Context, symbol, startDate, endDate string, spec BarSpec) ([]MarketData, error) {
+	p.mu.Lock()
+	p.symbols = append(p.symbols, symbol)
+	p.mu.Unlock()
+	return risingBars(symbol, startDate, endDate), nil
+}
+
+func (p *recordingProvider) fetched() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	symbols := append([]string(nil), p.symbols...)
+	sort.Strings(symbols)
+	return symbols
+}
+
+func TestScanRejectsInvalidSymbols(t *testing.T) {
+	service := newTestService(t)
+	provider := &recordingProvider{}
+	useProvider(service, provider)
+
+	resp, err := service.Scan(context.Background(), &pb.ScanRequest{
+		Symbols:    []string{"brk b", "BRK.B", "aapl", "1234", "AB$"},
+		Strategies: []string{"HIGH_BASE"},
+		DateRange:  testDateRange(),
+	})
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+
+	// Invalid symbols are never fetched, and BRK.B only once
+	if got := strings.Join(provider.fetched(), ","); got != "AAPL,BRK.B" {
+		t.Errorf("Fetched %s, want AAPL,BRK.B", got)
+	}
+	if resp.Signals["BRK.B"] == nil || resp.Signals["AAPL"] == nil {
+		t.Errorf("Signals = %v, want them keyed by the normalized symbols", resp.Signals)
+	}
+	for _, symbol := range []string{"1234", "AB$"} {
+		if !strings.HasPrefix(resp.Errors[symbol], ErrorInvalidSymbol+": ") {
+			t.Errorf("Error of %q = %q, want %s", symbol, resp.Errors[symbol], ErrorInvalidSymbol)
+		}
+	}
+	if len(resp.Errors) != 2 {
+		t.Errorf("Errors = %v, want only the invalid symbols", resp.Errors)
+	}
+}
+
+func TestBulkFetchReportsInvalidSymbols(t *testing.T) {
+	service := newTestService(t)
+	provider := &recordingProvider{}
+	useProvider(service, provider)
+
+	resp, err := service.BulkFetch(context.Background(), &pb.BulkFetchRequest{
+		Symbols:   []string{"bf b", "1234"},
+		DateRange: testDateRange(),
+	})
+	if err != nil {
+		t.Fatalf("BulkFetch failed: %v", err)
+	}
+	if len(resp.Data) != 1 || resp.Data["BF.B"] == nil {
+		t.Errorf("Data of %d symbols, want BF.B's only", len(resp.Data))
+	}
+	if !strings.HasPrefix(resp.Errors["1234"], ErrorInvalidSymbol) {
+		t.Errorf("Errors = %v, want 1234 invalid", resp.Errors)
+	}
+
+	// The stream keeps request order, sending invalid symbols as requested
+	client := dialTestServer(t, service)
+	stream, err := client.BulkFetchStream(context.Background(), &pb.BulkFetchRequest{
+		Symbols:   []string{"rds a", "1234", "AAPL"},
+		DateRange: testDateRange(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		got = append(got, msg.Symbol)
+		if invalid := strings.HasPrefix(msg.Error, ErrorInvalidSymbol); invalid != (msg.Symbol == "1234") {
+			t.Errorf("Message for %s has error %q", msg.Symbol, msg.Error)
+		}
+	}
+	if strings.Join(got, ",") != "RDS.A,1234,AAPL" {
+		t.Errorf("Symbols sent: got %v, want RDS.A,1234,AAPL", got)
+	}
+	if fetched := strings.Join(provider.fetched(), ","); fetched != "AAPL,BF.B,RDS.A" {
+		t.Errorf("Fetched %s, want AAPL,BF.B,RDS.A", fetched)
+	}
+}
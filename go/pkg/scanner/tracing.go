@@ -0,0 +1,77 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// tracerName identifies spans created by the scanner package
+const tracerName = "github.com/trustdan/ibkr-trader/go/pkg/scanner"
+
+// Span attribute keys shared by the scan and fetch spans
+const (
+	attrSymbol      = attribute.Key("scanner.symbol")
+	attrCacheHit    = attribute.Key("scanner.cache_hit")
+	attrCacheResult = attribute.Key("scanner.cache_result")
+	attrBarCount    = attribute.Key("scanner.bar_count")
+	attrBarSpec     = attribute.Key("scanner.bar_spec")
+)
+
+// InitTracing configures OpenTelemetry from the configuration. With tracing
+// disabled it returns a no-op provider so instrumentation costs nothing;
+// otherwise spans are batched to the OTLP endpoint and the provider and W3C
+// trace-context propagator are installed globally, which lets traces started by
+// the Python orchestrator continue into the scanner. The returned function
+// flushes and stops the exporter.
+func InitTracing(ctx context.Context, cfg *Config) (trace.TracerProvider, func(context.Context) error, error) {
+	if !cfg.TracingEnabled {
+		return noop.NewTracerProvider(), func(context.Context) error { return nil }, nil
+	}
+
+	exporterOptions := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.TracingEndpoint)}
+	if cfg.TracingInsecure {
+		exporterOptions = append(exporterOptions, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, exporterOptions...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(cfg.TracingServiceName),
+	))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to build tracing resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.TracingSampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	return provider, provider.Shutdown, nil
+}
+
+// recordSpanError marks span as failed with err
+func recordSpanError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
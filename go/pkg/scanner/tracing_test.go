@@ -0,0 +1,149 @@
+package scanner
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc/metadata"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// newTracedService returns a service with caching enabled whose spans are
+// recorded by the returned in-memory exporter
+func newTracedService(t *testing.T) (*ScannerService, *tracetest.InMemoryExporter) {
+	t.Helper()
+
+	service := newTestService(t)
+	cfg := *service.Config()
+	cfg.CacheEnabled = true
+	service.UpdateConfig(&cfg)
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+	service.SetTracerProvider(provider)
+
+	return service, exporter
+}
+
+// spanAttr returns the value of key on span, or an empty value
+func spanAttr(span tracetest.SpanStub, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestScanSpanHierarchy(t *testing.T) {
+	service, exporter := newTracedService(t)
+
+	_, err := service.Scan(context.Background(), &pb.ScanRequest{
+		Symbols:    []string{"AAPL", "MSFT"},
+		Strategies: []string{"HIGH_BASE"},
+		DateRange:  testDateRange(),
+	})
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	byName := map[string][]tracetest.SpanStub{}
+	for _, span := range spans {
+		byName[span.Name] = append(byName[span.Name], span)
+	}
+	if len(byName["Scan"]) != 1 || len(byName["ScanSymbol"]) != 2 ||
+		len(byName["FetchHistoricalData"]) != 2 || len(byName["EvaluateStrategies"]) != 2 {
+		t.Fatalf("Unexpected spans: %v", byName)
+	}
+
+	root := byName["Scan"][0]
+	symbolSpans := map[string]tracetest.SpanStub{}
+	for _, span := range byName["ScanSymbol"] {
+		if span.Parent.SpanID() != root.SpanContext.SpanID() {
+			t.Errorf("ScanSymbol span should be a child of Scan")
+		}
+		symbolSpans[span.SpanContext.SpanID().String()] = span
+	}
+
+	symbols := map[string]bool{}
+	for _, span := range byName["FetchHistoricalData"] {
+		parent, ok := symbolSpans[span.Parent.SpanID().String()]
+		if !ok {
+			t.Fatalf("FetchHistoricalData span should be a child of ScanSymbol")
+		}
+		symbol := spanAttr(span, attrSymbol).AsString()
+		if symbol != spanAttr(parent, attrSymbol).AsString() {
+			t.Errorf("Fetch span symbol %q does not match its parent", symbol)
+		}
+		if spanAttr(span, attrCacheHit).AsBool() {
+			t.Errorf("First fetch of %s should be a cache miss", symbol)
+		}
+		if spanAttr(span, attrBarCount).AsInt64() == 0 {
+			t.Errorf("Fetch span for %s should record the bar count", symbol)
+		}
+		symbols[symbol] = true
+	}
+	if !symbols["AAPL"] || !symbols["MSFT"] {
+		t.Errorf("Expected fetch spans for AAPL and MSFT, got %v", symbols)
+	}
+	for _, span := range byName["EvaluateStrategies"] {
+		if _, ok := symbolSpans[span.Parent.SpanID().String()]; !ok {
+			t.Errorf("EvaluateStrategies span should be a child of ScanSymbol")
+		}
+	}
+
+	// A repeated scan is served from the cache
+	exporter.Reset()
+	if _, err := service.Scan(context.Background(), &pb.ScanRequest{Symbols: []string{"AAPL"}, DateRange: testDateRange()}); err != nil {
+		t.Fatalf("Second scan failed: %v", err)
+	}
+	for _, span := range exporter.GetSpans() {
+		if span.Name == "FetchHistoricalData" && !spanAttr(span, attrCacheHit).AsBool() {
+			t.Error("Repeated fetch should be a cache hit")
+		}
+	}
+}
+
+func TestScanContinuesIncomingTrace(t *testing.T) {
+	service, exporter := newTracedService(t)
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator()) })
+
+	cfg := DefaultConfig()
+	cfg.TracingEnabled = true
+	options, err := ServerOptions(cfg, service.Metrics())
+	if err != nil {
+		t.Fatalf("ServerOptions failed: %v", err)
+	}
+	client := dialTestServerWithOptions(t, service, options)
+
+	// As sent by the Python orchestrator
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	ctx := metadata.AppendToOutgoingContext(context.Background(),
+		"traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	if _, err := client.Scan(ctx, &pb.ScanRequest{Symbols: []string{"AAPL"}, DateRange: testDateRange()}); err != nil {
+		t.Fatalf("Scan RPC failed: %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) == 0 {
+		t.Fatal("Expected spans to be recorded")
+	}
+	for _, span := range spans {
+		if got := span.SpanContext.TraceID().String(); got != traceID {
+			t.Errorf("Span %s has trace ID %s, want %s", span.Name, got, traceID)
+		}
+	}
+}
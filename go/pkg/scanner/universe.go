@@ -0,0 +1,77 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/trustdan/ibkr-trader/go/pkg/universe"
+)
+
+// universeLookbackDays is the number of calendar days of history used to compute
+// the price and average volume for universe filtering
+const universeLookbackDays = 30
+
+// dataProviderFundamentals adapts a DataProvider to universe.FundamentalsSource,
+// using the latest close and the average daily volume over the lookback window.
+// Market cap is not available from price history and comes from the universe file.
+type dataProviderFundamentals struct {
+	provider DataProvider
+}
+
+// Fundamentals implements universe.FundamentalsSource
+func (d dataProviderFundamentals) Fundamentals(ctx context.Context, symbol string) (universe.Fundamentals, error) {
+	end := time.Now()
+	start := end.AddDate(0, 0, -universeLookbackDays)
+
+	data, err := d.provider.GetHistoricalData(ctx, symbol, start.Format("2006-01-02"), end.Format("2006-01-02"), DefaultBarSpec())
+	if err != nil {
+		return universe.Fundamentals{}, err
+	}
+	if len(data) == 0 {
+		return universe.Fundamentals{}, fmt.Errorf("no price history for %s", symbol)
+	}
+
+	var totalVolume float64
+	for _, bar := range data {
+		totalVolume += float64(bar.Volume)
+	}
+
+	return universe.Fundamentals{
+		Price:     data[len(data)-1].Close,
+		AvgVolume: totalVolume / float64(len(data)),
+	}, nil
+}
+
+// universeSymbols returns the filtered universe used when a scan request names no
+// symbols. The cached universe is used until it expires, after which the universe
+// file is reloaded, filtered and cached again.
+func (s *Engine) universeSymbols(ctx context.Context, d *serviceDeps) ([]string, error) {
+	cfg := d.config
+
+	cached, err := universe.LoadCache(cfg.UniverseCacheDir, cfg.UniverseCacheExpiry, time.Now())
+	if err == nil {
+		return cached.Symbols(), nil
+	}
+	logrus.Infof("Rebuilding universe: %v", err)
+
+	source, err := universe.LoadFromFile(cfg.UniverseFile)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered, err := source.ApplyFilters(ctx, dataProviderFundamentals{provider: d.dataProvider},
+		cfg.UniverseMinMarketCap, cfg.UniverseMinPrice, cfg.UniverseMinVolume)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := filtered.SaveCache(cfg.UniverseCacheDir); err != nil {
+		logrus.Warnf("Failed to cache universe: %v", err)
+	}
+
+	logrus.Infof("Universe filtered to %d of %d symbols", len(filtered.Members), len(source.Members))
+	return filtered.Symbols(), nil
+}
@@ -0,0 +1,48 @@
+package scanner
+
+import (
+	"context"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// Build information of the scanner binary. Release builds set them with
+// -ldflags "-X github.com/trustdan/ibkr-trader/go/pkg/scanner.Version=..."
+// and likewise for Commit and BuildDate.
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildDate = ""
+)
+
+// ProtocolVersion is the version of the scanner's RPCs that GetVersion
+// reports. Raise it whenever an RPC or a field clients may rely on is added:
+//
+//	0: scanners without GetVersion
+//	1: GetVersion
+//	2: GetDataQuality and the errors of ScanResponse
+//	3: cache_disk_hits of MetricsResponse
+//	4: include_diff of ScanRequest and the diff of ScanResponse
+//	5: errors of BulkFetchResponse and INVALID_SYMBOL errors
+//	6: the memory guard of MetricsResponse
+//	7: include_timings of ScanRequest and the timings of ScanResponse
+//	8: GetSymbolMetadata
+//	9: force_date_range of ScanRequest, the date_range of ScanResponse and
+//	   the lookback of StrategyInfo
+const ProtocolVersion = 9
+
+// MinProtocolVersion is the oldest client protocol version the scanner still
+// serves. Raise it only when an RPC clients rely on is removed or changed
+// incompatibly.
+const MinProtocolVersion = 0
+
+// GetVersion implements the GetVersion RPC method
+func (s *Engine) GetVersion(ctx context.Context, req *pb.VersionRequest) (*pb.VersionResponse, error) {
+	return &pb.VersionResponse{
+		Version:            Version,
+		Commit:             Commit,
+		BuildDate:          BuildDate,
+		ProtocolVersion:    ProtocolVersion,
+		MinProtocolVersion: MinProtocolVersion,
+	}, nil
+}
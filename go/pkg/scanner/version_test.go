@@ -0,0 +1,18 @@
+package scanner
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+func TestGetVersion(t *testing.T) {
+	resp, err := dialTestServer(t, newTestService(t)).GetVersion(context.Background(), &pb.VersionRequest{})
+	if err != nil {
+		t.Fatalf("GetVersion RPC failed: %v", err)
+	}
+	if resp.GetVersion() != Version || resp.GetProtocolVersion() != ProtocolVersion || resp.GetMinProtocolVersion() != MinProtocolVersion {
+		t.Errorf("GetVersion = %v, want version %s and protocol %d from %d", resp, Version, ProtocolVersion, MinProtocolVersion)
+	}
+}
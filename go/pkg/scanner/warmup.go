@@ -0,0 +1,152 @@
+package scanner
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Warm-up states reported by GetMetrics
+const (
+	WarmupDisabled = "DISABLED"
+	WarmupWarming  = "WARMING"
+	WarmupDone     = "DONE"
+)
+
+// WarmupStatus is the progress of the startup cache warm-up
+type WarmupStatus struct {
+	State   string
+	Symbols int // symbols to prefetch
+	Cached  int // symbols fetched so far
+	Failed  int // symbols whose fetch failed
+}
+
+// warmupProgress tracks the warm-up for GetMetrics
+type warmupProgress struct {
+	mu     sync.Mutex
+	status WarmupStatus
+}
+
+// start begins a warm-up of symbols
+func (p *warmupProgress) start(symbols int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status = WarmupStatus{State: WarmupWarming, Symbols: symbols}
+}
+
+// record counts one fetched symbol and returns the progress so far
+func (p *warmupProgress) record(ok bool) WarmupStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if ok {
+		p.status.Cached++
+	} else {
+		p.status.Failed++
+	}
+	return p.status
+}
+
+// finish marks the warm-up done and returns its final progress
+func (p *warmupProgress) finish() WarmupStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status.State = WarmupDone
+	return p.status
+}
+
+// get returns the progress, DISABLED before a warm-up starts
+func (p *warmupProgress) get() WarmupStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	status := p.status
+	if status.State == "" {
+		status.State = WarmupDisabled
+	}
+	return status
+}
+
+// WarmupStatus returns the progress of the cache warm-up
+func (s *Engine) WarmupStatus() WarmupStatus {
+	return s.warmup.get()
+}
+
+// Warmup prefetches the last ScanLookbackDays of bars for the warm-up symbols
+// so that the first scan after a restart is served from the cache. The fetches
+// run on WarmupConcurrency workers of their own rather than the request pool,
+// so interactive requests are never queued behind them. onReady is called once
+// WarmupReadyFraction of the symbols is cached, or when the warm-up ends short
+// of it. Warmup returns when every symbol is fetched or ctx is done.
+func (s *Engine) Warmup(ctx context.Context, onReady func()) {
+	ready := sync.OnceFunc(onReady)
+	defer ready()
+
+	cfg := s.Config()
+	symbols := cfg.WarmupSymbols
+	if len(symbols) == 0 {
+		var err error
+		if symbols, err = s.universeSymbols(ctx, s.current()); err != nil {
+			logrus.Warnf("Skipping cache warm-up, universe unavailable: %v", err)
+			return
+		}
+	}
+
+	// The scheduler scans the same window, so its first scan hits the cache
+	now := time.Now()
+	startDate := now.AddDate(0, 0, -cfg.ScanLookbackDays).Format(dateLayout)
+	endDate := now.Format(dateLayout)
+
+	workers := cfg.WarmupConcurrency
+	if workers <= 0 {
+		workers = 1
+	}
+	s.warmup.start(len(symbols))
+	logrus.Infof("Warming the cache with %d symbols on %d workers", len(symbols), workers)
+
+	progress := func(status WarmupStatus) {
+		if float64(status.Cached) >= cfg.WarmupReadyFraction*float64(status.Symbols) {
+			ready()
+		}
+	}
+	progress(s.warmup.get())
+
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for symbol := range jobs {
+				// A reload during the warm-up warms the new cache
+				d := s.current()
+				symbolCtx, cancel := context.WithTimeout(ctx, d.config.SymbolTimeout)
+				_, err := d.dataProvider.GetHistoricalData(symbolCtx, symbol, startDate, endDate, DefaultBarSpec())
+				cancel()
+				if err != nil {
+					logrus.Debugf("Warm-up fetch of %s failed: %v", symbol, err)
+				}
+
+				status := s.warmup.record(err == nil)
+				if done := status.Cached + status.Failed; cfg.WarmupLogEvery > 0 && done%cfg.WarmupLogEvery == 0 {
+					logrus.Infof("Cache warm-up at %d of %d symbols, %d failed", done, status.Symbols, status.Failed)
+				}
+				progress(status)
+			}
+		}()
+	}
+
+feed:
+	for _, symbol := range symbols {
+		select {
+		case jobs <- symbol:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	status := s.warmup.finish()
+	logrus.Infof("Cache warm-up finished, %d of %d symbols cached, %d failed", status.Cached, status.Symbols, status.Failed)
+}
@@ -0,0 +1,114 @@
+package scanner
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+func TestWarmupPopulatesCache(t *testing.T) {
+	service, provider := newStallingTestService(t)
+	cfg := service.Config()
+	cfg.SymbolTimeout = time.Second
+	cfg.WarmupSymbols = []string{"AAPL", "MSFT", "GONE"}
+	cfg.WarmupLogEvery = 1
+	useProvider(service, NewCachedDataProvider(cfg, provider, service.Metrics()))
+
+	var readyCalls atomic.Int32
+	service.Warmup(context.Background(), func() { readyCalls.Add(1) })
+
+	if readyCalls.Load() != 1 {
+		t.Errorf("onReady called %d times, want once", readyCalls.Load())
+	}
+	metrics, err := service.GetMetrics(context.Background(), &pb.MetricsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metrics.WarmupState != WarmupDone || metrics.WarmupSymbols != 3 || metrics.WarmupCached != 2 || metrics.WarmupFailed != 1 {
+		t.Errorf("Warm-up metrics = %s %d/%d, %d failed; want DONE 2/3, 1 failed",
+			metrics.WarmupState, metrics.WarmupCached, metrics.WarmupSymbols, metrics.WarmupFailed)
+	}
+
+	// A scan of the scheduler's window is served from the warmed cache
+	now := time.Now()
+	if _, err := service.Scan(context.Background(), &pb.ScanRequest{
+		Symbols:    []string{"AAPL", "MSFT"},
+		Strategies: []string{"HIGH_BASE"},
+		DateRange: &pb.DateRange{
+			StartDate: now.AddDate(0, 0, -cfg.ScanLookbackDays).Format(dateLayout),
+			EndDate:   now.Format(dateLayout),
+		},
+	}); err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	for _, symbol := range []string{"AAPL", "MSFT"} {
+		if fetches := provider.fetchCount(symbol); fetches != 1 {
+			t.Errorf("%s fetched %d times, want once by the warm-up", symbol, fetches)
+		}
+	}
+}
+
+func TestScanIsNotBlockedByWarmup(t *testing.T) {
+	service, provider := newStallingTestService(t)
+	cfg := service.Config()
+	cfg.SymbolTimeout = 10 * time.Second
+	cfg.WarmupSymbols = []string{"ILLQ", "ILLQ", "AAPL"}
+	cfg.WarmupConcurrency = 2
+	cfg.WarmupReadyFraction = 0.5
+
+	// A single request worker, which the warm-up must leave alone
+	service.workers.resize(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ready := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		service.Warmup(ctx, func() { close(ready) })
+	}()
+
+	// Both warm-up workers hang on the stalled symbol
+	waitFor(t, "the warm-up workers to stall", func() bool { return provider.fetchCount("ILLQ") == 2 })
+	if status := service.WarmupStatus(); status.State != WarmupWarming || status.Symbols != 3 {
+		t.Errorf("WarmupStatus() = %+v, want WARMING 3 symbols", status)
+	}
+
+	scanned := make(chan error, 1)
+	go func() {
+		_, err := service.Scan(context.Background(), &pb.ScanRequest{
+			Symbols:    []string{"MSFT"},
+			Strategies: []string{"HIGH_BASE"},
+			DateRange:  testDateRange(),
+		})
+		scanned <- err
+	}()
+	select {
+	case err := <-scanned:
+		if err != nil {
+			t.Errorf("Scan failed: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Scan waited behind the warm-up")
+	}
+
+	select {
+	case <-ready:
+		t.Fatal("onReady called before half the symbols were cached")
+	default:
+	}
+
+	// An interrupted warm-up still reports ready
+	cancel()
+	<-done
+	select {
+	case <-ready:
+	default:
+		t.Error("onReady not called when the warm-up ended")
+	}
+	if status := service.WarmupStatus(); status.State != WarmupDone || status.Failed < 2 {
+		t.Errorf("WarmupStatus() = %+v, want DONE with the stalled fetches failed", status)
+	}
+}
@@ -0,0 +1,284 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// Filters of a webhook endpoint, which pick what each scan sends it
+const (
+	WebhookFilterAll      = "all"
+	WebhookFilterDiffOnly = "diff-only"
+	WebhookFilterStrategy = "strategy"
+)
+
+// Results of a webhook delivery, counted by endpoint
+const (
+	WebhookDelivered = "success"
+	WebhookFailed    = "failure"
+	WebhookDropped   = "dropped"
+)
+
+const (
+	// webhookWorkers deliver the queued payloads, so one slow endpoint holds
+	// up at most one of them
+	webhookWorkers = 4
+	// defaultWebhookBackoff is the wait before the first retry of an
+	// endpoint leaving RetryBackoff unset; each retry doubles it up to
+	// maxWebhookBackoff
+	defaultWebhookBackoff = time.Second
+	maxWebhookBackoff     = 30 * time.Second
+)
+
+// WebhookConfig is an endpoint the results of each scheduled scan are posted
+// to as a proto.ScanWebhookPayload. Name labels its metrics and logs,
+// defaulting to the URL's host. With a Secret the body is signed in the
+// X-Scanner-Signature header. Filter is "all" (the default), "diff-only" or
+// "strategy", which sends only the signals of Strategies. A delivery is
+// retried Retries times, waiting RetryBackoff and then twice as long each
+// time, after a 5xx or 429 response or a failed request, and then dropped.
+type WebhookConfig struct {
+	Name         string        `yaml:"name" json:"name"`
+	URL          string        `yaml:"url" json:"url"`
+	Secret       string        `yaml:"secret" json:"secret"`
+	Filter       string        `yaml:"filter" json:"filter"`
+	Strategies   []string      `yaml:"strategies" json:"strategies"`
+	Timeout      time.Duration `yaml:"timeout" json:"timeout"`
+	Retries      int           `yaml:"retries" json:"retries"`
+	RetryBackoff time.Duration `yaml:"retry_backoff" json:"retry_backoff"`
+}
+
+// label returns the endpoint's name in metrics and logs
+func (w WebhookConfig) label() string {
+	if w.Name != "" {
+		return w.Name
+	}
+	if u, err := url.Parse(w.URL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return w.URL
+}
+
+// validateWebhooks checks each endpoint's URL, filter and retry policy
+func validateWebhooks(webhooks []WebhookConfig) error {
+	for i, webhook := range webhooks {
+		u, err := url.Parse(webhook.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("webhook %d: url %q is not an http or https URL", i+1, webhook.URL)
+		}
+		switch webhook.Filter {
+		case "", WebhookFilterAll, WebhookFilterDiffOnly:
+		case WebhookFilterStrategy:
+			if len(webhook.Strategies) == 0 {
+				return fmt.Errorf("webhook %s: the strategy filter needs strategies", webhook.label())
+			}
+		default:
+			return fmt.Errorf("webhook %s: unknown filter %q, want %s, %s or %s", webhook.label(), webhook.Filter,
+				WebhookFilterAll, WebhookFilterDiffOnly, WebhookFilterStrategy)
+		}
+		if webhook.Timeout < 0 || webhook.Retries < 0 || webhook.RetryBackoff < 0 {
+			return fmt.Errorf("webhook %s: timeout, retries and retry_backoff must not be negative", webhook.label())
+		}
+	}
+	return nil
+}
+
+// webhooksWantDiff reports whether an endpoint is sent only the diff, which
+// scheduled scans then compute
+func webhooksWantDiff(webhooks []WebhookConfig) bool {
+	return slices.ContainsFunc(webhooks, func(w WebhookConfig) bool { return w.Filter == WebhookFilterDiffOnly })
+}
+
+// webhookPayload returns what a scan sends endpoint, and false when its
+// filter leaves nothing to send
+func webhookPayload(endpoint WebhookConfig, profile string, resp *pb.ScanResponse, scanTime time.Time) (*pb.ScanWebhookPayload, bool) {
+	filter := endpoint.Filter
+	if filter == "" {
+		filter = WebhookFilterAll
+	}
+	payload := &pb.ScanWebhookPayload{
+		Version:  pb.ScanWebhookVersion,
+		Event:    pb.ScanWebhookEvent,
+		ScanTime: scanTime.UTC(),
+		Profile:  profile,
+		Filter:   filter,
+	}
+
+	keep := func(*pb.RankedSignal) bool { return true }
+	if filter == WebhookFilterStrategy {
+		keep = func(signal *pb.RankedSignal) bool { return slices.Contains(endpoint.Strategies, signal.Strategy) }
+	}
+	if filter != WebhookFilterDiffOnly {
+		payload.Signals = webhookSignals(resp.RankedSignals, keep)
+	}
+	if diff := resp.Diff; diff != nil {
+		payload.Diff = &pb.ScanWebhookDiff{
+			Added:            webhookSignals(diff.Added, keep),
+			Removed:          webhookSignals(diff.Removed, keep),
+			PreviousScanTime: diff.PreviousScanTime,
+			Reason:           diff.Reason,
+		}
+		for _, signal := range diff.Unchanged {
+			if keep(signal) {
+				payload.Diff.Unchanged++
+			}
+		}
+	}
+
+	changed := payload.Diff != nil && (payload.Diff.Reason != "" || len(payload.Diff.Added) > 0 || len(payload.Diff.Removed) > 0)
+	switch filter {
+	case WebhookFilterDiffOnly:
+		return payload, changed
+	case WebhookFilterStrategy:
+		return payload, len(payload.Signals) > 0 || changed
+	}
+	return payload, true
+}
+
+// webhookSignals converts the signals keep accepts
+func webhookSignals(signals []*pb.RankedSignal, keep func(*pb.RankedSignal) bool) []pb.ScanWebhookSignal {
+	out := []pb.ScanWebhookSignal{}
+	for _, signal := range signals {
+		if keep(signal) {
+			out = append(out, pb.ScanWebhookSignal{Symbol: signal.Symbol, Strategy: signal.Strategy, Direction: signal.Direction, Score: signal.Score})
+		}
+	}
+	return out
+}
+
+// webhookDelivery is a payload queued for an endpoint
+type webhookDelivery struct {
+	endpoint WebhookConfig
+	body     []byte
+}
+
+// webhookQueue delivers the payloads of scheduled scans in the background.
+// The queue is bounded, and a payload finding it full is dropped, so slow
+// endpoints never hold up scanning.
+type webhookQueue struct {
+	deliveries chan webhookDelivery
+	metrics    *MetricTracker
+	client     *http.Client
+	// sleep waits out a retry's backoff, or returns the error of ctx when it
+	// is done first
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// newWebhookQueue returns a queue holding up to size deliveries
+func newWebhookQueue(size int, metrics *MetricTracker) *webhookQueue {
+	return &webhookQueue{
+		deliveries: make(chan webhookDelivery, max(size, 1)),
+		metrics:    metrics,
+		client:     &http.Client{},
+		sleep:      sleepContext,
+	}
+}
+
+// enqueue queues the scan's payload for each endpoint whose filter leaves
+// something to send
+func (q *webhookQueue) enqueue(webhooks []WebhookConfig, profile string, resp *pb.ScanResponse, scanTime time.Time) {
+	for _, endpoint := range webhooks {
+		payload, ok := webhookPayload(endpoint, profile, resp, scanTime)
+		if !ok {
+			continue
+		}
+		body, err := json.Marshal(payload)
+		if err != nil {
+			logrus.Errorf("Failed to encode the payload of webhook %s: %v", endpoint.label(), err)
+			continue
+		}
+		select {
+		case q.deliveries <- webhookDelivery{endpoint: endpoint, body: body}:
+		default:
+			logrus.Warnf("Webhook queue full, dropping the payload of webhook %s", endpoint.label())
+			q.metrics.RecordWebhookDelivery(endpoint.label(), WebhookDropped)
+		}
+	}
+}
+
+// run delivers the queued payloads until ctx is done
+func (q *webhookQueue) run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < webhookWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case delivery := <-q.deliveries:
+					q.deliver(ctx, delivery)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// deliver posts a payload, retrying as its endpoint allows
+func (q *webhookQueue) deliver(ctx context.Context, delivery webhookDelivery) {
+	endpoint := delivery.endpoint
+	backoff := endpoint.RetryBackoff
+	if backoff <= 0 {
+		backoff = defaultWebhookBackoff
+	}
+	for attempt := 0; ; attempt++ {
+		retry, err := q.post(ctx, endpoint, delivery.body)
+		if err == nil {
+			q.metrics.RecordWebhookDelivery(endpoint.label(), WebhookDelivered)
+			return
+		}
+		if !retry || attempt == endpoint.Retries {
+			logrus.Errorf("Webhook %s failed after %d attempts, dropping the payload: %v", endpoint.label(), attempt+1, err)
+			q.metrics.RecordWebhookDelivery(endpoint.label(), WebhookFailed)
+			return
+		}
+		logrus.Warnf("Webhook %s failed, retrying in %s: %v", endpoint.label(), backoff, err)
+		if q.sleep(ctx, backoff) != nil {
+			return
+		}
+		backoff = min(2*backoff, maxWebhookBackoff)
+	}
+}
+
+// post sends body to endpoint once, and reports whether a failure is worth
+// retrying: a failed request, a 5xx or a 429
+func (q *webhookQueue) post(ctx context.Context, endpoint WebhookConfig, body []byte) (retry bool, err error) {
+	timeout := endpoint.Timeout
+	if timeout <= 0 {
+		timeout = pushTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if endpoint.Secret != "" {
+		req.Header.Set(pb.ScanWebhookSignatureHeader, pb.ScanWebhookSignature(endpoint.Secret, body))
+	}
+
+	res, err := q.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests, fmt.Errorf("endpoint returned %s", res.Status)
+	}
+	return false, nil
+}
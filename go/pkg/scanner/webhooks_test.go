@@ -0,0 +1,172 @@
+package scanner
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// webhookResponse is a scan of two strategies, diffed against a previous
+// scan that had MSFT instead of SPY
+var webhookResponse = &pb.ScanResponse{
+	RankedSignals: []*pb.RankedSignal{
+		{Symbol: "AAPL", Strategy: "HIGH_BASE", Direction: "LONG", Score: 82},
+		{Symbol: "SPY", Strategy: "LOW_BASE", Direction: "SHORT", Score: 40},
+	},
+	Diff: &pb.ScanDiff{
+		Added:     []*pb.RankedSignal{{Symbol: "SPY", Strategy: "LOW_BASE", Direction: "SHORT", Score: 40}},
+		Removed:   []*pb.RankedSignal{{Symbol: "MSFT", Strategy: "LOW_BASE", Direction: "SHORT", Score: 35}},
+		Unchanged: []*pb.RankedSignal{{Symbol: "AAPL", Strategy: "HIGH_BASE", Direction: "LONG", Score: 82}},
+	},
+}
+
+// newTestWebhookQueue returns a queue of size whose retries do not wait,
+// with its metrics
+func newTestWebhookQueue(size int) (*webhookQueue, *MetricTracker) {
+	metrics := NewMetricTracker(prometheus.NewRegistry())
+	queue := newWebhookQueue(size, metrics)
+	queue.sleep = func(ctx context.Context, d time.Duration) error { return ctx.Err() }
+	return queue, metrics
+}
+
+func TestWebhookDeliverySigned(t *testing.T) {
+	bodies := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !hmac.Equal([]byte(r.Header.Get(pb.ScanWebhookSignatureHeader)), []byte(pb.ScanWebhookSignature("s3cret", body))) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		bodies <- body
+	}))
+	defer server.Close()
+
+	queue, metrics := newTestWebhookQueue(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go queue.run(ctx)
+
+	endpoint := WebhookConfig{Name: "signals", URL: server.URL, Secret: "s3cret"}
+	scanTime := time.Date(2024, 7, 2, 14, 0, 0, 0, time.UTC)
+	queue.enqueue([]WebhookConfig{endpoint}, "momentum", webhookResponse, scanTime)
+
+	var payload pb.ScanWebhookPayload
+	select {
+	case body := <-bodies:
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for the signed delivery")
+	}
+	if payload.Version != pb.ScanWebhookVersion || payload.Event != pb.ScanWebhookEvent || payload.Profile != "momentum" ||
+		!payload.ScanTime.Equal(scanTime) || payload.Filter != WebhookFilterAll {
+		t.Errorf("Payload = %+v", payload)
+	}
+	if len(payload.Signals) != 2 || payload.Diff == nil || len(payload.Diff.Added) != 1 || payload.Diff.Unchanged != 1 {
+		t.Errorf("Payload signals = %+v, diff %+v; want both signals and the diff", payload.Signals, payload.Diff)
+	}
+	waitFor(t, "the delivery counted", func() bool {
+		return testutil.ToFloat64(metrics.webhookDeliveries.WithLabelValues("signals", WebhookDelivered)) == 1
+	})
+
+	// A wrong secret is rejected with a 401, which is not retried
+	queue.enqueue([]WebhookConfig{{Name: "signals", URL: server.URL, Secret: "wrong", Retries: 3}}, "", webhookResponse, scanTime)
+	waitFor(t, "the rejected delivery counted", func() bool {
+		return testutil.ToFloat64(metrics.webhookDeliveries.WithLabelValues("signals", WebhookFailed)) == 1
+	})
+}
+
+func TestWebhookDeliveryRetries(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) <= 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	queue, metrics := newTestWebhookQueue(10)
+	delivery := webhookDelivery{endpoint: WebhookConfig{URL: server.URL, Retries: 2}, body: []byte(`{}`)}
+	label := delivery.endpoint.label()
+
+	// Two 500s and then a success
+	queue.deliver(context.Background(), delivery)
+	if attempts.Load() != 3 || testutil.ToFloat64(metrics.webhookDeliveries.WithLabelValues(label, WebhookDelivered)) != 1 {
+		t.Errorf("Attempts = %d, want a success on the third", attempts.Load())
+	}
+
+	// Retries run out, and the payload is dropped as a failure
+	attempts.Store(-10)
+	queue.deliver(context.Background(), delivery)
+	if attempts.Load() != -7 || testutil.ToFloat64(metrics.webhookDeliveries.WithLabelValues(label, WebhookFailed)) != 1 {
+		t.Errorf("Attempts = %d, want 3 failed", attempts.Load()+10)
+	}
+}
+
+func TestWebhookQueueOverflow(t *testing.T) {
+	queue, metrics := newTestWebhookQueue(2)
+	endpoint := WebhookConfig{Name: "slow", URL: "http://127.0.0.1:1"}
+
+	// Nothing delivers, so the third scan's payload finds the queue full
+	for i := 0; i < 3; i++ {
+		queue.enqueue([]WebhookConfig{endpoint}, "", webhookResponse, time.Now())
+	}
+	if queued := len(queue.deliveries); queued != 2 {
+		t.Errorf("Queued = %d, want 2", queued)
+	}
+	if dropped := testutil.ToFloat64(metrics.webhookDeliveries.WithLabelValues("slow", WebhookDropped)); dropped != 1 {
+		t.Errorf("Dropped = %v, want 1", dropped)
+	}
+}
+
+func TestWebhookPayloadFilters(t *testing.T) {
+	now := time.Now()
+	if payload, ok := webhookPayload(WebhookConfig{Filter: WebhookFilterDiffOnly}, "", webhookResponse, now); !ok || payload.Signals != nil || payload.Diff == nil {
+		t.Errorf("diff-only payload = %+v, %v; want only the diff", payload, ok)
+	}
+	unchanged := &pb.ScanResponse{RankedSignals: webhookResponse.RankedSignals, Diff: &pb.ScanDiff{Unchanged: webhookResponse.RankedSignals}}
+	if _, ok := webhookPayload(WebhookConfig{Filter: WebhookFilterDiffOnly}, "", unchanged, now); ok {
+		t.Error("diff-only payload sent for a scan changing nothing")
+	}
+
+	strategy := WebhookConfig{Filter: WebhookFilterStrategy, Strategies: []string{"HIGH_BASE"}}
+	payload, ok := webhookPayload(strategy, "", webhookResponse, now)
+	if !ok || len(payload.Signals) != 1 || payload.Signals[0].Symbol != "AAPL" ||
+		len(payload.Diff.Added) != 0 || len(payload.Diff.Removed) != 0 || payload.Diff.Unchanged != 1 {
+		t.Errorf("strategy payload = %+v, diff %+v; want only HIGH_BASE", payload, payload.Diff)
+	}
+	strategy.Strategies = []string{"BULL_FLAG"}
+	if _, ok := webhookPayload(strategy, "", unchanged, now); ok {
+		t.Error("strategy payload sent without a signal of the strategy")
+	}
+}
+
+func TestValidateWebhooks(t *testing.T) {
+	for _, tc := range []struct {
+		webhook WebhookConfig
+		valid   bool
+	}{
+		{WebhookConfig{URL: "https://hooks.example.com/scan"}, true},
+		{WebhookConfig{URL: "https://hooks.example.com/scan", Filter: WebhookFilterStrategy, Strategies: []string{"HIGH_BASE"}}, true},
+		{WebhookConfig{URL: "hooks.example.com/scan"}, false},
+		{WebhookConfig{URL: "https://hooks.example.com/scan", Filter: "changes"}, false},
+		{WebhookConfig{URL: "https://hooks.example.com/scan", Filter: WebhookFilterStrategy}, false},
+		{WebhookConfig{URL: "https://hooks.example.com/scan", Retries: -1}, false},
+	} {
+		if err := validateWebhooks([]WebhookConfig{tc.webhook}); (err == nil) != tc.valid {
+			t.Errorf("validateWebhooks(%+v) = %v, want valid %v", tc.webhook, err, tc.valid)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package scanner
+
+import (
+	"context"
+	"sync"
+)
+
+// workerPool bounds how many symbols are fetched at once across all requests.
+// Unlike a buffered channel its limit can change while requests run: lowering
+// it lets running workers finish and blocks new acquisitions until the slots
+// in use drop below the new limit.
+type workerPool struct {
+	mu    sync.Mutex
+	limit int
+	inUse int
+	// changed is closed and replaced whenever a slot frees up or the limit
+	// changes, waking the acquisitions waiting on it
+	changed chan struct{}
+	// observe, when set, is called with the limit and the slots in use after
+	// each change, under mu
+	observe func(limit, inUse int)
+}
+
+// newWorkerPool returns a pool of limit slots
+func newWorkerPool(limit int, observe func(limit, inUse int)) *workerPool {
+	p := &workerPool{limit: limit, changed: make(chan struct{}), observe: observe}
+	p.notify()
+	return p
+}
+
+// acquire takes a slot, waiting until one is free or ctx is done
+func (p *workerPool) acquire(ctx context.Context) error {
+	for {
+		p.mu.Lock()
+		if p.inUse < p.limit {
+			p.inUse++
+			p.notify()
+			p.mu.Unlock()
+			return nil
+		}
+		changed := p.changed
+		p.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release returns a slot taken by acquire
+func (p *workerPool) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.inUse--
+	p.notify()
+}
+
+// resize changes the limit; the slots in use above a lowered limit are kept
+// until their workers release them
+func (p *workerPool) resize(limit int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.limit = limit
+	p.notify()
+}
+
+// size returns the limit
+func (p *workerPool) size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.limit
+}
+
+// notify wakes the waiting acquisitions and reports the change; call it
+// under mu
+func (p *workerPool) notify() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+	if p.observe != nil {
+		p.observe(p.limit, p.inUse)
+	}
+}
+
+// requestWorkers are the slots of one request: those of the shared pool, and
+// at most the request's own limit of them when it sets one
+type requestWorkers struct {
+	pool  *workerPool
+	local chan struct{}
+}
+
+// workersFor returns the slots of a request asking for maxConcurrency
+// workers; 0 uses the pool's limit
+func (s *Engine) workersFor(maxConcurrency int32) requestWorkers {
+	workers := requestWorkers{pool: s.workers}
+	if maxConcurrency > 0 && int(maxConcurrency) < s.workers.size() {
+		workers.local = make(chan struct{}, maxConcurrency)
+	}
+	return workers
+}
+
+// size returns how many symbols the request fetches at once while the pool's
+// limit stays the same
+func (w requestWorkers) size() int {
+	if w.local != nil {
+		return cap(w.local)
+	}
+	return w.pool.size()
+}
+
+// acquire takes a slot of the request and one of the pool, waiting until both
+// are free or ctx is done
+func (w requestWorkers) acquire(ctx context.Context) error {
+	if w.local != nil {
+		select {
+		case w.local <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if err := w.pool.acquire(ctx); err != nil {
+		if w.local != nil {
+			<-w.local
+		}
+		return err
+	}
+	return nil
+}
+
+// release returns the slots taken by acquire
+func (w requestWorkers) release() {
+	w.pool.release()
+	if w.local != nil {
+		<-w.local
+	}
+}
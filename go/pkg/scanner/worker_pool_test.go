@@ -0,0 +1,124 @@
+package scanner
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// tokenProvider serves rising bars, each fetch waiting for a token on gate,
+// and counts the fetches running
+type tokenProvider struct {
+	gate    chan struct{}
+	running atomic.Int32
+}
+
+func newTokenProvider() *tokenProvider {
+	return &tokenProvider{gate: make(chan struct{})}
+}
+
+func (p *tokenProvider) GetHistoricalData(ctx context.Context, symbol, startDate, endDate string, spec BarSpec) ([]MarketData, error) {
+	p.running.Add(1)
+	defer p.running.Add(-1)
+	select {
+	case <-p.gate:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return risingBars(symbol, startDate, endDate), nil
+}
+
+// stillRunning asserts that provider keeps running fetches for a while
+func stillRunning(t *testing.T, provider *tokenProvider, want int32) {
+	t.Helper()
+	time.Sleep(50 * time.Millisecond)
+	if got := provider.running.Load(); got != want {
+		t.Fatalf("Fetches running: got %d, want %d", got, want)
+	}
+}
+
+func TestReducedWorkerLimitAppliesMidScan(t *testing.T) {
+	service := newTestService(t)
+	cfg := *service.Config()
+	cfg.MaxConcurrency = 3
+	service.UpdateConfig(&cfg)
+	provider := newTokenProvider()
+	useProvider(service, provider)
+
+	type result struct {
+		resp *pb.ScanResponse
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := service.Scan(context.Background(), &pb.ScanRequest{
+			Symbols:    []string{"AAPL", "MSFT", "XOM", "SPY", "QQQ", "IWM"},
+			Strategies: []string{"HIGH_BASE"},
+			DateRange:  testDateRange(),
+		})
+		done <- result{resp, err}
+	}()
+	waitFor(t, "three fetches", func() bool { return provider.running.Load() == 3 })
+
+	// Lowering the limit keeps the running fetches
+	reloaded := cfg
+	reloaded.MaxConcurrency = 1
+	service.UpdateConfig(&reloaded)
+	stillRunning(t, provider, 3)
+	if limit, inUse := testutil.ToFloat64(service.metricTracker.workerLimit), testutil.ToFloat64(service.metricTracker.workersInUse); limit != 1 || inUse != 3 {
+		t.Errorf("Worker gauges: limit %v, in use %v; want 1 and 3", limit, inUse)
+	}
+
+	// Once they finish the rest are fetched one at a time
+	for i := 0; i < 3; i++ {
+		provider.gate <- struct{}{}
+	}
+	for i := 0; i < 3; i++ {
+		waitFor(t, "the next fetch", func() bool { return provider.running.Load() == 1 })
+		stillRunning(t, provider, 1)
+		provider.gate <- struct{}{}
+	}
+
+	r := <-done
+	if r.err != nil {
+		t.Fatalf("Scan failed: %v", r.err)
+	}
+	if len(r.resp.Signals) != 6 {
+		t.Errorf("Signals for %d symbols, want all 6", len(r.resp.Signals))
+	}
+	if inUse := testutil.ToFloat64(service.metricTracker.workersInUse); inUse != 0 {
+		t.Errorf("Workers in use after the scan: %v", inUse)
+	}
+}
+
+func TestRequestMaxConcurrency(t *testing.T) {
+	service := newTestService(t)
+	provider := newTokenProvider()
+	useProvider(service, provider)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := service.BulkFetch(context.Background(), &pb.BulkFetchRequest{
+			Symbols:        []string{"AAPL", "MSFT", "XOM", "SPY"},
+			DateRange:      testDateRange(),
+			MaxConcurrency: 2,
+		})
+		done <- err
+	}()
+	waitFor(t, "two fetches", func() bool { return provider.running.Load() == 2 })
+	stillRunning(t, provider, 2)
+	close(provider.gate)
+	if err := <-done; err != nil {
+		t.Fatalf("BulkFetch failed: %v", err)
+	}
+
+	// The server's limit caps a request asking for more
+	if workers := service.workersFor(1000); workers.size() != service.Config().MaxConcurrency {
+		t.Errorf("Workers of an oversized request: got %d, want the server's %d", workers.size(), service.Config().MaxConcurrency)
+	}
+}
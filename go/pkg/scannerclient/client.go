@@ -0,0 +1,177 @@
+// Package scannerclient is the Go client of the scanner service. It dials the
+// scanner once, attaches the bearer token, bounds each call by a timeout and
+// retries calls the scanner was unavailable for, and returns Go structs in
+// place of the generated proto types.
+//
+//	client, err := scannerclient.NewClient("scanner:50051",
+//		scannerclient.WithTLS(nil),
+//		scannerclient.WithToken(os.Getenv("SCANNER_AUTH_TOKEN")),
+//		scannerclient.WithTimeout(time.Minute),
+//	)
+//	if err != nil {
+//		return err
+//	}
+//	defer client.Close()
+//
+//	result, err := client.Scan(ctx, []string{"AAPL", "MSFT"}, []string{"HIGH_BASE"},
+//		scannerclient.DateRange{Start: start, End: end})
+//
+// Code calling the scanner should depend on the Scanner interface, which
+// MockScanner implements for unit tests without a server. A program embedding
+// the scanner gets a Scanner of its engine with
+// NewServiceClient(engine.Client()).
+package scannerclient
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// Scanner is the part of the scanner service Client wraps
+type Scanner interface {
+	// Scan evaluates strategies over symbols; empty slices scan the
+	// configured universe with every registered strategy
+	Scan(ctx context.Context, symbols, strategies []string, dateRange DateRange) (*ScanResult, error)
+	// BulkFetch returns the daily bars of each symbol the scanner has data for
+	BulkFetch(ctx context.Context, symbols []string, dateRange DateRange) (map[string][]Bar, error)
+	// GetMetrics returns the scanner's performance and cache metrics
+	GetMetrics(ctx context.Context) (*Metrics, error)
+	// SymbolMetadata returns the scanner's metadata of symbols, or only
+	// NotModified when etag is still that of its snapshot
+	SymbolMetadata(ctx context.Context, symbols []string, etag string) (*MetadataSnapshot, error)
+}
+
+// MaxMetadataBatch is the most symbols the scanner returns metadata of per
+// call
+const MaxMetadataBatch = 500
+
+// maxMetadataAttempts bounds the fetches of a metadata snapshot that keeps
+// changing between batches
+const maxMetadataAttempts = 3
+
+// Client calls the scanner service over one long-lived connection
+type Client struct {
+	conn    *grpc.ClientConn
+	scanner pb.ScannerServiceClient
+}
+
+var _ Scanner = (*Client)(nil)
+
+// NewClient returns a client of the scanner at addr. The connection is made
+// in the background and re-established by gRPC when it drops, so a scanner
+// that is down fails the calls, not NewClient.
+func NewClient(addr string, opts ...Option) (*Client, error) {
+	options := defaultOptions()
+	for _, opt := range opts {
+		opt(&options)
+	}
+	dialOptions, err := options.dialOptions()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := grpc.Dial(addr, dialOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial the scanner at %s: %w", addr, err)
+	}
+	return &Client{conn: conn, scanner: pb.NewScannerServiceClient(conn)}, nil
+}
+
+// NewServiceClient returns a client calling service, such as the in-process
+// client of an embedded scanner.Engine, rather than dialing a scanner. The
+// options of NewClient apply to the connection and have no equivalent here.
+func NewServiceClient(service pb.ScannerServiceClient) *Client {
+	return &Client{scanner: service}
+}
+
+// Close closes the connection, if the client has one
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+// Scan runs a scan of symbols with strategies over dateRange
+func (c *Client) Scan(ctx context.Context, symbols, strategies []string, dateRange DateRange) (*ScanResult, error) {
+	resp, err := c.scanner.Scan(ctx, &pb.ScanRequest{
+		Symbols:    symbols,
+		Strategies: strategies,
+		DateRange:  dateRange.proto(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scanner Scan: %w", err)
+	}
+	return scanResult(resp), nil
+}
+
+// BulkFetch returns the daily bars of symbols over dateRange, keyed by
+// symbol. Symbols the scanner has no data for are left out.
+func (c *Client) BulkFetch(ctx context.Context, symbols []string, dateRange DateRange) (map[string][]Bar, error) {
+	bars := make(map[string][]Bar, len(symbols))
+	req := &pb.BulkFetchRequest{Symbols: symbols, DateRange: dateRange.proto()}
+	for {
+		resp, err := c.scanner.BulkFetch(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("scanner BulkFetch: %w", err)
+		}
+		for symbol, payload := range resp.GetData() {
+			symbolBars, err := decodeBars(payload, resp.GetCompressed()[symbol])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", symbol, err)
+			}
+			bars[symbol] = symbolBars
+		}
+		if resp.GetNextPageToken() == "" {
+			return bars, nil
+		}
+		req.PageToken = resp.GetNextPageToken()
+	}
+}
+
+// GetMetrics returns the scanner's metrics
+func (c *Client) GetMetrics(ctx context.Context) (*Metrics, error) {
+	resp, err := c.scanner.GetMetrics(ctx, &pb.MetricsRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("scanner GetMetrics: %w", err)
+	}
+	return metrics(resp), nil
+}
+
+// SymbolMetadata returns the scanner's sector, industry and market cap of
+// symbols, in order, asking for MaxMetadataBatch at a time. When etag is
+// still the etag of the scanner's metadata, only NotModified is returned.
+// A snapshot that changes between batches is fetched again.
+func (c *Client) SymbolMetadata(ctx context.Context, symbols []string, etag string) (*MetadataSnapshot, error) {
+	var snapshot *MetadataSnapshot
+	for attempt := 0; attempt < maxMetadataAttempts; attempt++ {
+		snapshot = &MetadataSnapshot{Symbols: make([]SymbolMetadata, 0, len(symbols))}
+		changed := false
+		for start := 0; start == 0 || start < len(symbols); start += MaxMetadataBatch {
+			batch := symbols[start:min(start+MaxMetadataBatch, len(symbols))]
+			resp, err := c.scanner.GetSymbolMetadata(ctx, &pb.SymbolMetadataRequest{Symbols: batch, IfNoneMatch: etag})
+			if err != nil {
+				return nil, fmt.Errorf("scanner GetSymbolMetadata: %w", err)
+			}
+			if resp.GetNotModified() {
+				return &MetadataSnapshot{ETag: resp.GetEtag(), NotModified: true}, nil
+			}
+			if start > 0 && resp.GetEtag() != snapshot.ETag {
+				changed = true
+				break
+			}
+			// The later batches must come from the same snapshot
+			snapshot.ETag, etag = resp.GetEtag(), ""
+			for _, meta := range resp.GetSymbols() {
+				snapshot.Symbols = append(snapshot.Symbols, symbolMetadata(meta))
+			}
+		}
+		if !changed {
+			return snapshot, nil
+		}
+	}
+	return nil, fmt.Errorf("scanner GetSymbolMetadata: metadata changed during each of %d attempts", maxMetadataAttempts)
+}
@@ -0,0 +1,338 @@
+package scannerclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// flakyScanner fails the first failures attempts of each call with failCode,
+// then answers from its fields
+type flakyScanner struct {
+	pb.UnimplementedScannerServiceServer
+
+	failures int
+	failCode codes.Code
+	block    bool // wait for the call's deadline instead of answering
+
+	scan    *pb.ScanResponse
+	fetch   *pb.BulkFetchResponse
+	metrics *pb.MetricsResponse
+	// etags is the metadata etag of each GetSymbolMetadata call in turn,
+	// the last one thereafter
+	etags []string
+	// batches records the symbols of each GetSymbolMetadata call
+	batches [][]string
+
+	mu       sync.Mutex
+	attempts int
+	tokens   []string
+}
+
+// attempt records an attempt and returns the error it fails with
+func (s *flakyScanner) attempt(ctx context.Context) error {
+	s.mu.Lock()
+	s.attempts++
+	attempt := s.attempts
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		s.tokens = append(s.tokens, md.Get("authorization")...)
+	}
+	s.mu.Unlock()
+
+	if s.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	if attempt <= s.failures {
+		return status.Error(s.failCode, "scanner restarting")
+	}
+	return nil
+}
+
+func (s *flakyScanner) Scan(ctx context.Context, req *pb.ScanRequest) (*pb.ScanResponse, error) {
+	if err := s.attempt(ctx); err != nil {
+		return nil, err
+	}
+	return s.scan, nil
+}
+
+func (s *flakyScanner) BulkFetch(ctx context.Context, req *pb.BulkFetchRequest) (*pb.BulkFetchResponse, error) {
+	if err := s.attempt(ctx); err != nil {
+		return nil, err
+	}
+	return s.fetch, nil
+}
+
+func (s *flakyScanner) GetMetrics(ctx context.Context, req *pb.MetricsRequest) (*pb.MetricsResponse, error) {
+	if err := s.attempt(ctx); err != nil {
+		return nil, err
+	}
+	return s.metrics, nil
+}
+
+func (s *flakyScanner) GetSymbolMetadata(ctx context.Context, req *pb.SymbolMetadataRequest) (*pb.SymbolMetadataResponse, error) {
+	if err := s.attempt(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.batches = append(s.batches, req.Symbols)
+	etag := s.etags[min(len(s.batches), len(s.etags))-1]
+	s.mu.Unlock()
+
+	resp := &pb.SymbolMetadataResponse{Etag: etag}
+	if req.IfNoneMatch == etag {
+		resp.NotModified = true
+		return resp, nil
+	}
+	for _, symbol := range req.Symbols {
+		resp.Symbols = append(resp.Symbols, &pb.SymbolMetadata{Symbol: symbol, Present: symbol != "ZZZZ", Sector: "Technology"})
+	}
+	return resp, nil
+}
+
+// testClient serves scanner over an in-memory listener and returns a client
+// of it with backoffs short enough for tests
+func testClient(t *testing.T, scanner *flakyScanner, opts ...Option) *Client {
+	t.Helper()
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	pb.RegisterScannerServiceServer(server, scanner)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	opts = append([]Option{
+		WithRetry(DefaultMaxAttempts, time.Millisecond, 5*time.Millisecond),
+		WithDialOptions(grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		})),
+	}, opts...)
+	client, err := NewClient("bufnet", opts...)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestRetryOnUnavailable(t *testing.T) {
+	scanner := &flakyScanner{failures: 1, failCode: codes.Unavailable, metrics: &pb.MetricsResponse{TotalScans: 7}}
+	client := testClient(t, scanner)
+
+	m, err := client.GetMetrics(context.Background())
+	if err != nil {
+		t.Fatalf("GetMetrics() error = %v", err)
+	}
+	if m.TotalScans != 7 || scanner.attempts != 2 {
+		t.Errorf("GetMetrics() = %d scans after %d attempts, want 7 after 2", m.TotalScans, scanner.attempts)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	tests := []struct {
+		name         string
+		failCode     codes.Code
+		opts         []Option
+		wantAttempts int
+	}{
+		{name: "Unavailable throughout", failCode: codes.Unavailable, wantAttempts: DefaultMaxAttempts},
+		{name: "Other errors are not retried", failCode: codes.InvalidArgument, wantAttempts: 1},
+		{name: "Retrying off", failCode: codes.Unavailable, opts: []Option{WithRetry(1, 0, 0)}, wantAttempts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanner := &flakyScanner{failures: 10, failCode: tt.failCode}
+			client := testClient(t, scanner, tt.opts...)
+
+			_, err := client.Scan(context.Background(), []string{"AAPL"}, nil, DateRange{})
+			if status.Code(errors.Unwrap(err)) != tt.failCode {
+				t.Errorf("Scan() error = %v, want %v", err, tt.failCode)
+			}
+			if scanner.attempts != tt.wantAttempts {
+				t.Errorf("Scan() made %d attempts, want %d", scanner.attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	scanner := &flakyScanner{block: true}
+	client := testClient(t, scanner, WithTimeout(50*time.Millisecond))
+
+	started := time.Now()
+	_, err := client.GetMetrics(context.Background())
+	if status.Code(errors.Unwrap(err)) != codes.DeadlineExceeded {
+		t.Errorf("GetMetrics() error = %v, want DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("GetMetrics() returned after %v, want the 50ms timeout", elapsed)
+	}
+
+	// A shorter deadline of the caller wins
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	client = testClient(t, &flakyScanner{block: true}, WithTimeout(time.Hour))
+	if _, err := client.GetMetrics(ctx); status.Code(errors.Unwrap(err)) != codes.DeadlineExceeded {
+		t.Errorf("GetMetrics() error = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestTimeoutBoundsRetries(t *testing.T) {
+	scanner := &flakyScanner{failures: 1000, failCode: codes.Unavailable}
+	client := testClient(t, scanner, WithRetry(1000, 20*time.Millisecond, 20*time.Millisecond), WithTimeout(100*time.Millisecond))
+
+	started := time.Now()
+	if _, err := client.GetMetrics(context.Background()); status.Code(errors.Unwrap(err)) != codes.Unavailable {
+		t.Errorf("GetMetrics() error = %v, want the last attempt's Unavailable", err)
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second || scanner.attempts >= 1000 {
+		t.Errorf("GetMetrics() made %d attempts over %v, want the timeout to stop the retries", scanner.attempts, elapsed)
+	}
+}
+
+func TestToken(t *testing.T) {
+	scanner := &flakyScanner{metrics: &pb.MetricsResponse{}}
+	client := testClient(t, scanner, WithInsecureToken("secret"))
+	if _, err := client.GetMetrics(context.Background()); err != nil {
+		t.Fatalf("GetMetrics() error = %v", err)
+	}
+	if !reflect.DeepEqual(scanner.tokens, []string{"Bearer secret"}) {
+		t.Errorf("Sent authorization %q, want the bearer token", scanner.tokens)
+	}
+
+	if _, err := NewClient("bufnet", WithToken("secret")); err == nil {
+		t.Error("Expected WithToken without TLS to be refused")
+	}
+}
+
+func TestScanResult(t *testing.T) {
+	scanner := &flakyScanner{scan: &pb.ScanResponse{
+		Signals: map[string]*pb.SignalList{
+			"AAPL": {SignalTypes: []string{"LONG"}, Strategies: []string{"HIGH_BASE"}, Sector: "Technology", MarketCap: 3e12},
+		},
+		RankedSignals:   []*pb.RankedSignal{{Symbol: "AAPL", Strategy: "HIGH_BASE", Direction: "LONG", Score: 82.5}},
+		ScanTimeSeconds: 1.5,
+	}}
+	client := testClient(t, scanner)
+
+	result, err := client.Scan(context.Background(), []string{"AAPL"}, []string{"HIGH_BASE"}, DateRange{})
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	want := &ScanResult{
+		Signals:  map[string]Signals{"AAPL": {Types: []string{"LONG"}, Strategies: []string{"HIGH_BASE"}, Sector: "Technology", MarketCap: 3e12}},
+		Ranked:   []RankedSignal{{Symbol: "AAPL", Strategy: "HIGH_BASE", Direction: "LONG", Score: 82.5}},
+		Duration: 1500 * time.Millisecond,
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("Scan() = %+v, want %+v", result, want)
+	}
+}
+
+func TestBulkFetchDecodesBars(t *testing.T) {
+	plain := []byte(`[{"symbol":"AAPL","timestamp":"2024-01-02T00:00:00Z","close":185.6,"volume":100}]`)
+	var gzipped bytes.Buffer
+	zw := gzip.NewWriter(&gzipped)
+	zw.Write([]byte(`[{"symbol":"MSFT","timestamp":"2024-01-02T00:00:00Z","close":370.9}]`))
+	zw.Close()
+
+	scanner := &flakyScanner{fetch: &pb.BulkFetchResponse{
+		Data:       map[string][]byte{"AAPL": plain, "MSFT": gzipped.Bytes()},
+		Compressed: map[string]bool{"MSFT": true},
+	}}
+	client := testClient(t, scanner)
+
+	start := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	bars, err := client.BulkFetch(context.Background(), []string{"AAPL", "MSFT", "XOM"}, DateRange{Start: start, End: start.AddDate(0, 0, 1)})
+	if err != nil {
+		t.Fatalf("BulkFetch() error = %v", err)
+	}
+	if len(bars) != 2 || bars["AAPL"][0].Close != 185.6 || bars["AAPL"][0].Volume != 100 || bars["MSFT"][0].Close != 370.9 {
+		t.Errorf("BulkFetch() = %+v", bars)
+	}
+	if !bars["AAPL"][0].Timestamp.Equal(start) {
+		t.Errorf("Timestamp = %v, want %v", bars["AAPL"][0].Timestamp, start)
+	}
+}
+
+func TestDateRangeProto(t *testing.T) {
+	r := DateRange{Start: time.Date(2024, 3, 1, 15, 0, 0, 0, time.UTC)}
+	if got := r.proto(); got.GetStartDate() != "2024-03-01" || got.GetEndDate() != "" {
+		t.Errorf("proto() = %v, want the start date alone", got)
+	}
+}
+
+func TestMockScanner(t *testing.T) {
+	var scanner Scanner = &MockScanner{
+		GetMetricsFunc: func(ctx context.Context) (*Metrics, error) { return &Metrics{TotalScans: 3}, nil },
+	}
+	m, err := scanner.GetMetrics(context.Background())
+	if err != nil || m.TotalScans != 3 {
+		t.Errorf("GetMetrics() = %+v, %v", m, err)
+	}
+	if result, err := scanner.Scan(context.Background(), nil, nil, DateRange{}); err != nil || len(result.Signals) != 0 {
+		t.Errorf("Scan() = %+v, %v; want an empty result", result, err)
+	}
+	if calls := scanner.(*MockScanner).Calls(); !reflect.DeepEqual(calls, []string{"GetMetrics", "Scan"}) {
+		t.Errorf("Calls() = %v", calls)
+	}
+}
+
+func TestSymbolMetadataBatches(t *testing.T) {
+	symbols := make([]string, MaxMetadataBatch*2+1)
+	for i := range symbols {
+		symbols[i] = fmt.Sprintf("S%d", i)
+	}
+	symbols[MaxMetadataBatch] = "ZZZZ"
+	scanner := &flakyScanner{etags: []string{"v1"}}
+	client := testClient(t, scanner)
+
+	snapshot, err := client.SymbolMetadata(context.Background(), symbols, "")
+	if err != nil {
+		t.Fatalf("SymbolMetadata() error = %v", err)
+	}
+	if len(scanner.batches) != 3 || len(scanner.batches[0]) != MaxMetadataBatch || len(scanner.batches[2]) != 1 {
+		t.Errorf("Batches of %d symbols = %d, want 500, 500 and 1", len(symbols), len(scanner.batches))
+	}
+	if snapshot.ETag != "v1" || snapshot.NotModified || len(snapshot.Symbols) != len(symbols) || snapshot.Symbols[MaxMetadataBatch].Present {
+		t.Errorf("Snapshot %q of %d symbols, want v1 with ZZZZ missing", snapshot.ETag, len(snapshot.Symbols))
+	}
+
+	// The current etag short-circuits after one call
+	scanner.batches = nil
+	if snapshot, err := client.SymbolMetadata(context.Background(), symbols, "v1"); err != nil || !snapshot.NotModified || len(scanner.batches) != 1 {
+		t.Errorf("SymbolMetadata(v1) = %+v, %v after %d calls; want not modified after one", snapshot, err, len(scanner.batches))
+	}
+}
+
+func TestSymbolMetadataChangingBetweenBatches(t *testing.T) {
+	symbols := make([]string, MaxMetadataBatch+1)
+	for i := range symbols {
+		symbols[i] = fmt.Sprintf("S%d", i)
+	}
+	scanner := &flakyScanner{etags: []string{"v1", "v2"}}
+	client := testClient(t, scanner)
+
+	snapshot, err := client.SymbolMetadata(context.Background(), symbols, "")
+	if err != nil || snapshot.ETag != "v2" || len(snapshot.Symbols) != len(symbols) {
+		t.Fatalf("SymbolMetadata() = %+v, %v; want the v2 snapshot", snapshot, err)
+	}
+	if len(scanner.batches) != 4 {
+		t.Errorf("Calls = %d, want the changed snapshot fetched again", len(scanner.batches))
+	}
+}
@@ -0,0 +1,75 @@
+package scannerclient
+
+import (
+	"context"
+	"sync"
+)
+
+// MockScanner is a Scanner for unit tests. Each call is recorded and answered
+// by the matching func, or with empty results when it is nil.
+type MockScanner struct {
+	ScanFunc       func(ctx context.Context, symbols, strategies []string, dateRange DateRange) (*ScanResult, error)
+	BulkFetchFunc  func(ctx context.Context, symbols []string, dateRange DateRange) (map[string][]Bar, error)
+	GetMetricsFunc func(ctx context.Context) (*Metrics, error)
+	// SymbolMetadataFunc answers SymbolMetadata; without it every symbol is
+	// missing from an empty snapshot
+	SymbolMetadataFunc func(ctx context.Context, symbols []string, etag string) (*MetadataSnapshot, error)
+
+	mu    sync.Mutex
+	calls []string
+}
+
+var _ Scanner = (*MockScanner)(nil)
+
+// Calls returns the names of the methods called, in order
+func (m *MockScanner) Calls() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.calls...)
+}
+
+func (m *MockScanner) record(method string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, method)
+}
+
+// Scan implements Scanner
+func (m *MockScanner) Scan(ctx context.Context, symbols, strategies []string, dateRange DateRange) (*ScanResult, error) {
+	m.record("Scan")
+	if m.ScanFunc != nil {
+		return m.ScanFunc(ctx, symbols, strategies, dateRange)
+	}
+	return &ScanResult{Signals: map[string]Signals{}}, nil
+}
+
+// BulkFetch implements Scanner
+func (m *MockScanner) BulkFetch(ctx context.Context, symbols []string, dateRange DateRange) (map[string][]Bar, error) {
+	m.record("BulkFetch")
+	if m.BulkFetchFunc != nil {
+		return m.BulkFetchFunc(ctx, symbols, dateRange)
+	}
+	return map[string][]Bar{}, nil
+}
+
+// GetMetrics implements Scanner
+func (m *MockScanner) GetMetrics(ctx context.Context) (*Metrics, error) {
+	m.record("GetMetrics")
+	if m.GetMetricsFunc != nil {
+		return m.GetMetricsFunc(ctx)
+	}
+	return &Metrics{}, nil
+}
+
+// SymbolMetadata implements Scanner
+func (m *MockScanner) SymbolMetadata(ctx context.Context, symbols []string, etag string) (*MetadataSnapshot, error) {
+	m.record("SymbolMetadata")
+	if m.SymbolMetadataFunc != nil {
+		return m.SymbolMetadataFunc(ctx, symbols, etag)
+	}
+	snapshot := &MetadataSnapshot{Symbols: make([]SymbolMetadata, len(symbols))}
+	for i, symbol := range symbols {
+		snapshot.Symbols[i] = SymbolMetadata{Symbol: symbol, Sector: "UNKNOWN", Industry: "UNKNOWN"}
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,191 @@
+package scannerclient
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+)
+
+// Defaults of the options
+const (
+	DefaultTimeout        = 30 * time.Second
+	DefaultMaxAttempts    = 3
+	DefaultInitialBackoff = 200 * time.Millisecond
+	DefaultMaxBackoff     = 5 * time.Second
+)
+
+// DefaultKeepalive pings an idle connection so that a dead scanner is
+// noticed before the next call, and a load balancer dropping idle connections
+// keeps this one. The scanner disconnects clients pinging more often than its
+// grpc_keepalive_min_time, 20 seconds by default.
+var DefaultKeepalive = keepalive.ClientParameters{
+	Time:                30 * time.Second,
+	Timeout:             10 * time.Second,
+	PermitWithoutStream: true,
+}
+
+// Option configures a Client
+type Option func(*options)
+
+type options struct {
+	tls            *tls.Config
+	token          string
+	insecureToken  bool
+	keepalive      keepalive.ClientParameters
+	timeout        time.Duration
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	dial           []grpc.DialOption
+}
+
+func defaultOptions() options {
+	return options{
+		keepalive:      DefaultKeepalive,
+		timeout:        DefaultTimeout,
+		maxAttempts:    DefaultMaxAttempts,
+		initialBackoff: DefaultInitialBackoff,
+		maxBackoff:     DefaultMaxBackoff,
+	}
+}
+
+// WithTLS connects over TLS; a nil config verifies the scanner against the
+// system's roots. Without it the connection is plaintext.
+func WithTLS(config *tls.Config) Option {
+	return func(o *options) {
+		if config == nil {
+			config = &tls.Config{}
+		}
+		o.tls = config
+	}
+}
+
+// WithToken sends token as the bearer token the scanner's auth_token checks.
+// The token is only sent over TLS.
+func WithToken(token string) Option {
+	return func(o *options) { o.token = token }
+}
+
+// WithInsecureToken sends token as WithToken does, but over a plaintext
+// connection too, as to a scanner in the same pod
+func WithInsecureToken(token string) Option {
+	return func(o *options) { o.token, o.insecureToken = token, true }
+}
+
+// WithKeepalive replaces DefaultKeepalive
+func WithKeepalive(params keepalive.ClientParameters) Option {
+	return func(o *options) { o.keepalive = params }
+}
+
+// WithKeepaliveInterval pings an idle connection every interval, closing it
+// when a ping is not answered within timeout, as the scanner's
+// grpc_keepalive_time and grpc_keepalive_timeout do from its side. gRPC
+// pings no more often than every 10 seconds.
+func WithKeepaliveInterval(interval, timeout time.Duration) Option {
+	return func(o *options) {
+		o.keepalive = keepalive.ClientParameters{Time: interval, Timeout: timeout, PermitWithoutStream: true}
+	}
+}
+
+// WithTimeout bounds each call, retries included, unless the caller's context
+// ends sooner; 0 leaves calls bounded by the context alone
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) { o.timeout = timeout }
+}
+
+// WithRetry makes up to maxAttempts attempts of a call the scanner is
+// unavailable for, waiting initialBackoff after the first and doubling the
+// wait up to maxBackoff. One attempt turns retrying off.
+func WithRetry(maxAttempts int, initialBackoff, maxBackoff time.Duration) Option {
+	return func(o *options) {
+		o.maxAttempts, o.initialBackoff, o.maxBackoff = max(maxAttempts, 1), initialBackoff, maxBackoff
+	}
+}
+
+// WithDialOptions adds gRPC dial options, applied after those of the other
+// options
+func WithDialOptions(dialOptions ...grpc.DialOption) Option {
+	return func(o *options) { o.dial = append(o.dial, dialOptions...) }
+}
+
+// dialOptions returns the gRPC dial options of o
+func (o options) dialOptions() ([]grpc.DialOption, error) {
+	transport := insecure.NewCredentials()
+	if o.tls != nil {
+		transport = credentials.NewTLS(o.tls)
+	}
+	if o.token != "" && o.tls == nil && !o.insecureToken {
+		return nil, errors.New("scannerclient: WithToken requires WithTLS; use WithInsecureToken for a plaintext connection")
+	}
+
+	dialOptions := []grpc.DialOption{
+		grpc.WithTransportCredentials(transport),
+		grpc.WithKeepaliveParams(o.keepalive),
+		grpc.WithChainUnaryInterceptor(o.timeoutInterceptor, o.retryInterceptor),
+	}
+	if o.token != "" {
+		dialOptions = append(dialOptions, grpc.WithPerRPCCredentials(tokenCredentials{token: o.token, requireTLS: !o.insecureToken}))
+	}
+	return append(dialOptions, o.dial...), nil
+}
+
+// timeoutInterceptor bounds a unary call by the timeout
+func (o options) timeoutInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOptions ...grpc.CallOption) error {
+	if o.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.timeout)
+		defer cancel()
+	}
+	return invoker(ctx, method, req, reply, cc, callOptions...)
+}
+
+// retryInterceptor retries a unary call while the scanner is unavailable,
+// backing off between attempts until the context ends. A retry cut short by
+// the context's end returns the error of the attempt before it.
+func (o options) retryInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOptions ...grpc.CallOption) error {
+	backoff := o.initialBackoff
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		err := invoker(ctx, method, req, reply, cc, callOptions...)
+		if lastErr != nil && err != nil && ctx.Err() != nil {
+			return lastErr
+		}
+		if status.Code(err) != codes.Unavailable || attempt >= o.maxAttempts {
+			return err
+		}
+		lastErr = err
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, o.maxBackoff)
+	}
+}
+
+// tokenCredentials attaches the bearer token to every call
+type tokenCredentials struct {
+	token      string
+	requireTLS bool
+}
+
+// GetRequestMetadata implements credentials.PerRPCCredentials
+func (c tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + c.token}, nil
+}
+
+// RequireTransportSecurity implements credentials.PerRPCCredentials
+func (c tokenCredentials) RequireTransportSecurity() bool {
+	return c.requireTLS
+}
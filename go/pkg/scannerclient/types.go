@@ -0,0 +1,222 @@
+package scannerclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	pb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+)
+
+// dateLayout is the layout of the scanner's dates
+const dateLayout = "2006-01-02"
+
+// DateRange is the days a scan or fetch covers; a zero Start or End leaves
+// the scanner's default
+type DateRange struct {
+	Start time.Time
+	End   time.Time
+}
+
+// proto returns the scanner's DateRange of r
+func (r DateRange) proto() *pb.DateRange {
+	format := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(dateLayout)
+	}
+	return &pb.DateRange{StartDate: format(r.Start), EndDate: format(r.End)}
+}
+
+// ScanResult is the outcome of a scan
+type ScanResult struct {
+	Signals  map[string]Signals // by symbol
+	Ranked   []RankedSignal     // strongest first
+	Duration time.Duration
+}
+
+// Signals are the signals of one symbol. Strategies holds the strategy that
+// produced each of Types.
+type Signals struct {
+	Types      []string
+	Strategies []string
+	EventNotes []string
+	Sector     string
+	Industry   string
+	MarketCap  float64
+}
+
+// RankedSignal is one signal of a scan with the strength of its setup
+type RankedSignal struct {
+	Symbol    string
+	Strategy  string
+	Direction string  // "LONG" or "SHORT"
+	Score     float64 // 0 to 100, higher for stronger setups
+}
+
+// Bar is one bar of market data
+type Bar struct {
+	Symbol    string    `json:"symbol"`
+	Timestamp time.Time `json:"timestamp"`
+	Open      float64   `json:"open"`
+	High      float64   `json:"high"`
+	Low       float64   `json:"low"`
+	Close     float64   `json:"close"`
+	Volume    int64     `json:"volume"`
+}
+
+// Metrics are the scanner's performance and cache metrics
+type Metrics struct {
+	AvgScanTime           time.Duration
+	SymbolsPerSecond      float64
+	TotalScans            int
+	MemoryUsageMB         float64
+	CPUUsagePercent       float64
+	ErrorCount            int
+	CacheHitRate          float64 // percentage
+	CacheHits             int
+	CacheDiskHits         int
+	CachePartialHits      int
+	CacheMisses           int
+	LastScheduledScan     time.Time // zero before the first scheduled scan
+	LastScheduledScanTime time.Duration
+	ProcessStart          time.Time
+	Strategies            []StrategyMetrics
+	Providers             []ProviderMetrics
+}
+
+// StrategyMetrics are the metrics of one strategy
+type StrategyMetrics struct {
+	Name    string
+	AvgTime time.Duration // per symbol
+	Signals int
+}
+
+// ProviderMetrics are the metrics of one data provider
+type ProviderMetrics struct {
+	Name         string
+	AvgTime      time.Duration // per fetch not served from the cache
+	Errors       int
+	CacheHitRate float64 // percentage
+}
+
+// SymbolMetadata is the scanner's metadata of a symbol. Present is false
+// for a symbol the scanner has no metadata for, whose sector is UNKNOWN.
+type SymbolMetadata struct {
+	Symbol    string
+	Present   bool
+	Sector    string
+	Industry  string
+	MarketCap float64 // dollars
+}
+
+// MetadataSnapshot is the metadata of the symbols asked for and the etag of
+// the scanner's metadata they come from. NotModified is set, without
+// symbols, when the etag asked with is still current.
+type MetadataSnapshot struct {
+	ETag        string
+	NotModified bool
+	Symbols     []SymbolMetadata
+}
+
+// seconds returns a duration of seconds
+func seconds(s float32) time.Duration {
+	return time.Duration(float64(s) * float64(time.Second))
+}
+
+// milliseconds returns a duration of milliseconds
+func milliseconds(ms float32) time.Duration {
+	return time.Duration(float64(ms) * float64(time.Millisecond))
+}
+
+// parseTime parses an RFC3339 time of a response, the zero time when unset
+func parseTime(value string) time.Time {
+	t, _ := time.Parse(time.RFC3339, value)
+	return t
+}
+
+// scanResult converts a ScanResponse
+func scanResult(resp *pb.ScanResponse) *ScanResult {
+	result := &ScanResult{
+		Signals:  make(map[string]Signals, len(resp.GetSignals())),
+		Ranked:   make([]RankedSignal, len(resp.GetRankedSignals())),
+		Duration: seconds(resp.GetScanTimeSeconds()),
+	}
+	for symbol, signals := range resp.GetSignals() {
+		result.Signals[symbol] = Signals{
+			Types:      signals.GetSignalTypes(),
+			Strategies: signals.GetStrategies(),
+			EventNotes: signals.GetEventNotes(),
+			Sector:     signals.GetSector(),
+			Industry:   signals.GetIndustry(),
+			MarketCap:  signals.GetMarketCap(),
+		}
+	}
+	for i, signal := range resp.GetRankedSignals() {
+		result.Ranked[i] = RankedSignal{Symbol: signal.GetSymbol(), Strategy: signal.GetStrategy(), Direction: signal.GetDirection(), Score: signal.GetScore()}
+	}
+	return result
+}
+
+// metrics converts a MetricsResponse
+func metrics(resp *pb.MetricsResponse) *Metrics {
+	m := &Metrics{
+		AvgScanTime:           seconds(resp.GetAvgScanTimeSeconds()),
+		SymbolsPerSecond:      float64(resp.GetSymbolsPerSecond()),
+		TotalScans:            int(resp.GetTotalScans()),
+		MemoryUsageMB:         float64(resp.GetMemoryUsageMb()),
+		CPUUsagePercent:       float64(resp.GetCpuUsagePercent()),
+		ErrorCount:            int(resp.GetErrorCount()),
+		CacheHitRate:          float64(resp.GetCacheHitRate()),
+		CacheHits:             int(resp.GetCacheHits()),
+		CacheDiskHits:         int(resp.GetCacheDiskHits()),
+		CachePartialHits:      int(resp.GetCachePartialHits()),
+		CacheMisses:           int(resp.GetCacheMisses()),
+		LastScheduledScan:     parseTime(resp.GetLastScheduledScanTime()),
+		LastScheduledScanTime: seconds(resp.GetLastScheduledScanSeconds()),
+		ProcessStart:          parseTime(resp.GetProcessStartTime()),
+		Strategies:            make([]StrategyMetrics, len(resp.GetStrategies())),
+		Providers:             make([]ProviderMetrics, len(resp.GetProviders())),
+	}
+	for i, strategy := range resp.GetStrategies() {
+		m.Strategies[i] = StrategyMetrics{Name: strategy.GetName(), AvgTime: milliseconds(strategy.GetAvgMs()), Signals: int(strategy.GetSignals())}
+	}
+	for i, provider := range resp.GetProviders() {
+		m.Providers[i] = ProviderMetrics{Name: provider.GetName(), AvgTime: milliseconds(provider.GetAvgMs()), Errors: int(provider.GetErrors()), CacheHitRate: float64(provider.GetCacheHitRate())}
+	}
+	return m
+}
+
+// decodeBars decodes the serialized bars of a BulkFetch response
+func decodeBars(payload []byte, compressed bool) ([]Bar, error) {
+	if compressed {
+		reader, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress bars: %w", err)
+		}
+		defer reader.Close()
+		if payload, err = io.ReadAll(reader); err != nil {
+			return nil, fmt.Errorf("failed to decompress bars: %w", err)
+		}
+	}
+	var bars []Bar
+	if err := json.Unmarshal(payload, &bars); err != nil {
+		return nil, fmt.Errorf("failed to decode bars: %w", err)
+	}
+	return bars, nil
+}
+
+// symbolMetadata converts the metadata of a symbol
+func symbolMetadata(meta *pb.SymbolMetadata) SymbolMetadata {
+	return SymbolMetadata{
+		Symbol:    meta.GetSymbol(),
+		Present:   meta.GetPresent(),
+		Sector:    meta.GetSector(),
+		Industry:  meta.GetIndustry(),
+		MarketCap: meta.GetMarketCap(),
+	}
+}
@@ -0,0 +1,111 @@
+package strategy
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultHorizons are the forward-return horizons, in bars, reported by a
+// backtest when the request names none
+var DefaultHorizons = []int{1, 5, 10}
+
+// Configured is a strategy with its parameters resolved
+type Configured struct {
+	Strategy Strategy
+	Params   Params
+}
+
+// Trigger is a signal raised while replaying a series
+type Trigger struct {
+	Time     time.Time
+	Strategy string
+	Signal   string
+	Price    float64
+	// ForwardReturns maps a horizon to the return in the signal's direction
+	// that many bars later; horizons past the end of the series are absent
+	ForwardReturns map[int]float64
+}
+
+// HorizonStats summarizes the forward returns of signals at one horizon
+type HorizonStats struct {
+	Horizon       int
+	Count         int
+	HitRate       float64
+	AverageReturn float64
+}
+
+// Replay evaluates each strategy bar by bar over series, as the scanner would
+// have at the close of each bar, and returns the signals raised in time order
+func Replay(ctx context.Context, series *Series, strategies []Configured, horizons []int) ([]Trigger, error) {
+	var triggers []Trigger
+	for i := 0; i < series.Len(); i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		for _, configured := range strategies {
+			signal := configured.Strategy.Evaluate(series, i, configured.Params)
+			if signal == "" {
+				continue
+			}
+			triggers = append(triggers, Trigger{
+				Time:           series.Bars[i].Time,
+				Strategy:       configured.Strategy.Name(),
+				Signal:         signal,
+				Price:          series.Bars[i].Close,
+				ForwardReturns: ForwardReturns(series, i, signal, horizons),
+			})
+		}
+	}
+	return triggers, nil
+}
+
+// ForwardReturns returns the close-to-close return from bar i to each horizon,
+// negated for short signals so a positive value is always a profitable call
+func ForwardReturns(series *Series, i int, signal string, horizons []int) map[int]float64 {
+	entry := series.Bars[i].Close
+	returns := make(map[int]float64, len(horizons))
+	if entry == 0 {
+		return returns
+	}
+
+	for _, horizon := range horizons {
+		if i+horizon >= series.Len() {
+			continue
+		}
+		r := series.Bars[i+horizon].Close/entry - 1
+		if signal == Short {
+			r = -r
+		}
+		returns[horizon] = r
+	}
+	return returns
+}
+
+// Summarize computes the hit rate and average forward return of triggers at
+// each horizon. Signals without a return at a horizon are left out of it.
+func Summarize(triggers []Trigger, horizons []int) []HorizonStats {
+	stats := make([]HorizonStats, len(horizons))
+	for h, horizon := range horizons {
+		stats[h].Horizon = horizon
+
+		hits, total := 0, 0.0
+		for _, trigger := range triggers {
+			r, ok := trigger.ForwardReturns[horizon]
+			if !ok {
+				continue
+			}
+			stats[h].Count++
+			total += r
+			if r > 0 {
+				hits++
+			}
+		}
+
+		if stats[h].Count > 0 {
+			stats[h].HitRate = float64(hits) / float64(stats[h].Count)
+			stats[h].AverageReturn = total / float64(stats[h].Count)
+		}
+	}
+	return stats
+}
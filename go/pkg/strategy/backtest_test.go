@@ -0,0 +1,94 @@
+package strategy
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+// scriptedStrategy signals at fixed bar indexes
+type scriptedStrategy map[int]string
+
+func (scriptedStrategy) Name() string        { return "SCRIPTED" }
+func (scriptedStrategy) Params() []ParamSpec { return nil }
+
+func (s scriptedStrategy) Evaluate(series *Series, i int, params Params) string {
+	return s[i]
+}
+
+func (scriptedStrategy) Score(series *Series, i int, params Params) float64 { return 0 }
+
+func TestReplayForwardReturns(t *testing.T) {
+	closes := []float64{100, 110, 99, 121, 90, 100, 120, 80, 88, 100, 132, 99}
+	bars := make([]Bar, len(closes))
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	for i, close := range closes {
+		bars[i] = Bar{Time: day.AddDate(0, 0, i), Open: close, High: close, Low: close, Close: close}
+	}
+
+	strategies := []Configured{{Strategy: scriptedStrategy{0: Long, 2: Short}}}
+	triggers, err := Replay(context.Background(), NewSeries(bars), strategies, DefaultHorizons)
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if len(triggers) != 2 {
+		t.Fatalf("Expected 2 signals, got %d", len(triggers))
+	}
+
+	// Long from 100: 110 after one bar, 100 after five, 132 after ten
+	long := triggers[0]
+	if long.Signal != Long || !long.Time.Equal(day) || long.Price != 100 {
+		t.Errorf("Unexpected long signal %+v", long)
+	}
+	assertReturns(t, long.ForwardReturns, map[int]float64{1: 0.10, 5: 0, 10: 0.32})
+
+	// Short from 99: 121 after one bar is a loss, 80 after five a gain, and
+	// there is no bar ten days later
+	short := triggers[1]
+	if short.Signal != Short || !short.Time.Equal(day.AddDate(0, 0, 2)) {
+		t.Errorf("Unexpected short signal %+v", short)
+	}
+	assertReturns(t, short.ForwardReturns, map[int]float64{1: -22.0 / 99, 5: 19.0 / 99})
+
+	stats := Summarize(triggers, DefaultHorizons)
+	want := []HorizonStats{
+		{Horizon: 1, Count: 2, HitRate: 0.5, AverageReturn: (0.10 - 22.0/99) / 2},
+		// A flat return is not a hit
+		{Horizon: 5, Count: 2, HitRate: 0.5, AverageReturn: (19.0 / 99) / 2},
+		{Horizon: 10, Count: 1, HitRate: 1, AverageReturn: 0.32},
+	}
+	for i, w := range want {
+		got := stats[i]
+		if got.Horizon != w.Horizon || got.Count != w.Count || !near(got.HitRate, w.HitRate) || !near(got.AverageReturn, w.AverageReturn) {
+			t.Errorf("Horizon %d: got %+v, want %+v", w.Horizon, got, w)
+		}
+	}
+}
+
+func TestReplayCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := Replay(ctx, NewSeries(trendingBars(10, 100, 1)), []Configured{{Strategy: scriptedStrategy{}}}, DefaultHorizons)
+	if err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func assertReturns(t *testing.T, got, want map[int]float64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("Got returns %v, want %v", got, want)
+		return
+	}
+	for horizon, w := range want {
+		if g, ok := got[horizon]; !ok || !near(g, w) {
+			t.Errorf("Horizon %d: got %v, want %v", horizon, g, w)
+		}
+	}
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
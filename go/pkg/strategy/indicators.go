@@ -0,0 +1,135 @@
+package strategy
+
+import "math"
+
+// Indicator periods used by the strategies
+const (
+	rsiPeriod      = 14
+	atrPeriod      = 14
+	smaShortPeriod = 50
+	smaLongPeriod  = 200
+)
+
+// Series holds bars in time order together with the indicators the strategies
+// read. Indicator values are NaN until enough bars exist to compute them.
+type Series struct {
+	Bars   []Bar
+	RSI14  []float64
+	ATR14  []float64
+	SMA50  []float64
+	SMA200 []float64
+}
+
+// NewSeries computes the indicators for bars, which must be in time order.
+// RSI and ATR use simple rolling means over their period, matching the Python
+// backtest engine.
+func NewSeries(bars []Bar) *Series {
+	closes := make([]float64, len(bars))
+	for i, bar := range bars {
+		closes[i] = bar.Close
+	}
+
+	return &Series{
+		Bars:   bars,
+		RSI14:  rsi(closes, rsiPeriod),
+		ATR14:  atr(bars, atrPeriod),
+		SMA50:  sma(closes, smaShortPeriod),
+		SMA200: sma(closes, smaLongPeriod),
+	}
+}
+
+// Len returns the number of bars in the series
+func (s *Series) Len() int {
+	return len(s.Bars)
+}
+
+// sma returns the simple moving average of values over period
+func sma(values []float64, period int) []float64 {
+	out := undefinedSlice(len(values))
+	sum := 0.0
+	for i, v := range values {
+		sum += v
+		if i >= period {
+			sum -= values[i-period]
+		}
+		if i >= period-1 {
+			out[i] = sum / float64(period)
+		}
+	}
+	return out
+}
+
+// rsi returns the relative strength index of closes, averaging gains and losses
+// over period. The first change is at index 1, so the first value is at period.
+func rsi(closes []float64, period int) []float64 {
+	out := undefinedSlice(len(closes))
+	if len(closes) < 2 {
+		return out
+	}
+
+	gains := make([]float64, len(closes)-1)
+	losses := make([]float64, len(closes)-1)
+	for i := 1; i < len(closes); i++ {
+		change := closes[i] - closes[i-1]
+		if change > 0 {
+			gains[i-1] = change
+		} else {
+			losses[i-1] = -change
+		}
+	}
+
+	avgGains := sma(gains, period)
+	avgLosses := sma(losses, period)
+	for i := range avgGains {
+		gain, loss := avgGains[i], avgLosses[i]
+		switch {
+		case !defined(gain):
+			continue
+		case loss == 0:
+			out[i+1] = 100
+		default:
+			out[i+1] = 100 - 100/(1+gain/loss)
+		}
+	}
+	return out
+}
+
+// atr returns the average true range of bars over period. The first bar has no
+// previous close, so its true range is its high-low range.
+func atr(bars []Bar, period int) []float64 {
+	ranges := make([]float64, len(bars))
+	for i, bar := range bars {
+		ranges[i] = bar.High - bar.Low
+		if i > 0 {
+			prev := bars[i-1].Close
+			ranges[i] = math.Max(ranges[i], math.Max(math.Abs(bar.High-prev), math.Abs(bar.Low-prev)))
+		}
+	}
+	return sma(ranges, period)
+}
+
+// undefinedSlice returns n NaN values
+func undefinedSlice(n int) []float64 {
+	out := make([]float64, n)
+	for i := range out {
+		out[i] = math.NaN()
+	}
+	return out
+}
+
+// defined reports whether an indicator value has been computed
+func defined(v float64) bool {
+	return !math.IsNaN(v)
+}
+
+// aboveOrUndefined reports whether price is above an indicator, treating an
+// indicator without enough history as satisfied
+func aboveOrUndefined(price, indicator float64) bool {
+	return !defined(indicator) || price > indicator
+}
+
+// belowOrUndefined reports whether price is below an indicator, treating an
+// indicator without enough history as satisfied
+func belowOrUndefined(price, indicator float64) bool {
+	return !defined(indicator) || price < indicator
+}
@@ -0,0 +1,591 @@
+package strategy
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ruleVariables are the bar values a rule can read
+var ruleVariables = map[string]func(bar Bar) float64{
+	"open":   func(bar Bar) float64 { return bar.Open },
+	"high":   func(bar Bar) float64 { return bar.High },
+	"low":    func(bar Bar) float64 { return bar.Low },
+	"close":  func(bar Bar) float64 { return bar.Close },
+	"volume": func(bar Bar) float64 { return float64(bar.Volume) },
+}
+
+// ruleIndicators are the indicators a rule can call with a period, computed at
+// a single bar the way NewSeries computes them over the whole series
+var ruleIndicators = map[string]func(bars []Bar, i, period int) float64{
+	"sma":        smaAt,
+	"rsi":        rsiAt,
+	"atr":        atrAt,
+	"avg_volume": avgVolumeAt,
+}
+
+// RuleScore is the score of every signal of a rule, midway between the
+// weakest and strongest setups of the built-in strategies
+const RuleScore = MaxScore / 2
+
+// maxRulePeriod bounds indicator periods, well beyond any lookback scanned
+const maxRulePeriod = 1000
+
+// RuleError is a syntax or type error in a rule expression
+type RuleError struct {
+	Expr string
+	Pos  int // byte offset of the offending token in Expr
+	Msg  string
+}
+
+func (e *RuleError) Error() string {
+	return fmt.Sprintf("column %d: %s", e.Pos+1, e.Msg)
+}
+
+// Rule is a strategy defined by a boolean expression over bar values and
+// indicators, such as "close > sma(50) and volume > 2 * avg_volume(20)". It
+// signals when the expression holds at a bar. A rule whose indicators lack the
+// history to be computed at a bar does not signal there.
+type Rule struct {
+	name        string
+	signal      string
+	description string
+	expr        string
+	root        ruleNode
+	lookback    int
+}
+
+// CompileRule parses expr into a rule named name raising signal, Long or
+// Short. Syntax errors and unknown variables or indicators are returned as a
+// *RuleError.
+func CompileRule(name, signal, description, expr string) (*Rule, error) {
+	if signal != Long && signal != Short {
+		return nil, fmt.Errorf("signal must be %s or %s, got %q", Long, Short, signal)
+	}
+	p := &ruleParser{expr: expr}
+	p.next()
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf(p.tok.pos, "unexpected %s", p.tok)
+	}
+	if !root.boolean() {
+		return nil, p.errorf(0, "expression must be a condition, not a number")
+	}
+	// An indicator over period bars reads one bar before them too, for the
+	// RSI's first change and the ATR's first true range
+	return &Rule{name: name, signal: signal, description: description, expr: expr, root: root, lookback: p.longest + 1}, nil
+}
+
+func (r *Rule) Name() string { return r.name }
+
+// Params returns no parameters; a rule's thresholds are part of its expression
+func (r *Rule) Params() []ParamSpec { return nil }
+
+func (r *Rule) Evaluate(series *Series, i int, params Params) string {
+	if r.root.eval(series.Bars, i) == 1 {
+		return r.signal
+	}
+	return ""
+}
+
+// Score rates every signal of a rule RuleScore, as a rule has no measure of
+// its own strength
+func (r *Rule) Score(series *Series, i int, params Params) float64 {
+	if r.Evaluate(series, i, params) == "" {
+		return 0
+	}
+	return RuleScore
+}
+
+// Lookback returns the bars the rule's longest indicator reads, in the bars
+// scanned
+func (r *Rule) Lookback() Lookback { return Lookback{Bars: r.lookback} }
+
+// Signal returns the signal the rule raises
+func (r *Rule) Signal() string { return r.signal }
+
+// Description returns the rule's description
+func (r *Rule) Description() string { return r.description }
+
+// Expr returns the rule's expression
+func (r *Rule) Expr() string { return r.expr }
+
+// ruleNode is a node of a compiled expression. Conditions evaluate to 1 or 0
+// and any node to NaN when an indicator below it is undefined.
+type ruleNode interface {
+	eval(bars []Bar, i int) float64
+	boolean() bool
+}
+
+type numberNode float64
+
+func (n numberNode) eval([]Bar, int) float64 { return float64(n) }
+func (numberNode) boolean() bool             { return false }
+
+type variableNode func(bar Bar) float64
+
+func (n variableNode) eval(bars []Bar, i int) float64 { return n(bars[i]) }
+func (variableNode) boolean() bool                    { return false }
+
+type indicatorNode struct {
+	compute func(bars []Bar, i, period int) float64
+	period  int
+}
+
+func (n indicatorNode) eval(bars []Bar, i int) float64 { return n.compute(bars, i, n.period) }
+func (indicatorNode) boolean() bool                    { return false }
+
+type negateNode struct{ operand ruleNode }
+
+func (n negateNode) eval(bars []Bar, i int) float64 { return -n.operand.eval(bars, i) }
+func (negateNode) boolean() bool                    { return false }
+
+type notNode struct{ operand ruleNode }
+
+func (n notNode) eval(bars []Bar, i int) float64 {
+	v := n.operand.eval(bars, i)
+	if !defined(v) {
+		return v
+	}
+	return 1 - v
+}
+func (notNode) boolean() bool { return true }
+
+type binaryNode struct {
+	op          string
+	left, right ruleNode
+}
+
+func (n binaryNode) eval(bars []Bar, i int) float64 {
+	l := n.left.eval(bars, i)
+	// Short-circuit only on a defined result, so an undefined operand on
+	// either side keeps the rule from signalling
+	switch {
+	case n.op == "and" && l == 0, n.op == "or" && l == 1:
+		return l
+	}
+	r := n.right.eval(bars, i)
+	if !defined(l) || !defined(r) {
+		return math.NaN()
+	}
+	switch n.op {
+	case "+":
+		return l + r
+	case "-":
+		return l - r
+	case "*":
+		return l * r
+	case "/":
+		if r == 0 {
+			return math.NaN()
+		}
+		return l / r
+	case "and", "or":
+		return r
+	case "<":
+		return truth(l < r)
+	case "<=":
+		return truth(l <= r)
+	case ">":
+		return truth(l > r)
+	case ">=":
+		return truth(l >= r)
+	case "==":
+		return truth(l == r)
+	case "!=":
+		return truth(l != r)
+	}
+	panic("unknown operator " + n.op)
+}
+
+func (n binaryNode) boolean() bool {
+	switch n.op {
+	case "+", "-", "*", "/":
+		return false
+	}
+	return true
+}
+
+func truth(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Token kinds of rule expressions
+const (
+	tokEOF = iota
+	tokNumber
+	tokIdent
+	tokOp
+	tokLParen
+	tokRParen
+)
+
+type ruleToken struct {
+	kind int
+	text string
+	pos  int
+}
+
+func (t ruleToken) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+// operatorAliases are the symbols accepted for the logical operators
+var operatorAliases = map[string]string{"&&": "and", "||": "or", "!": "not"}
+
+// ruleParser is a recursive descent parser of rule expressions:
+//
+//	or      = and { ("or" | "||") and }
+//	and     = not { ("and" | "&&") not }
+//	not     = ("not" | "!") not | compare
+//	compare = sum [ ("<" | "<=" | ">" | ">=" | "==" | "!=") sum ]
+//	sum     = product { ("+" | "-") product }
+//	product = unary { ("*" | "/") unary }
+//	unary   = "-" unary | number | variable | indicator "(" period ")" | "(" or ")"
+type ruleParser struct {
+	expr string
+	pos  int
+	tok  ruleToken
+	// longest is the longest indicator period parsed
+	longest int
+}
+
+func (p *ruleParser) errorf(pos int, format string, args ...interface{}) error {
+	return &RuleError{Expr: p.expr, Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// next scans the token at p.pos into p.tok. Characters that start no token
+// are scanned as a one character operator for the parser to reject.
+func (p *ruleParser) next() {
+	for p.pos < len(p.expr) && strings.IndexByte(" \t\r\n", p.expr[p.pos]) >= 0 {
+		p.pos++
+	}
+	start := p.pos
+	if start == len(p.expr) {
+		p.tok = ruleToken{kind: tokEOF, pos: start}
+		return
+	}
+
+	c := p.expr[start]
+	switch {
+	case isDigit(c) || c == '.':
+		for p.pos < len(p.expr) && (isDigit(p.expr[p.pos]) || p.expr[p.pos] == '.') {
+			p.pos++
+		}
+		p.tok = ruleToken{kind: tokNumber, text: p.expr[start:p.pos], pos: start}
+	case isLetter(c):
+		for p.pos < len(p.expr) && (isLetter(p.expr[p.pos]) || isDigit(p.expr[p.pos])) {
+			p.pos++
+		}
+		text := strings.ToLower(p.expr[start:p.pos])
+		kind := tokIdent
+		if text == "and" || text == "or" || text == "not" {
+			kind = tokOp
+		}
+		p.tok = ruleToken{kind: kind, text: text, pos: start}
+	case c == '(':
+		p.pos++
+		p.tok = ruleToken{kind: tokLParen, text: "(", pos: start}
+	case c == ')':
+		p.pos++
+		p.tok = ruleToken{kind: tokRParen, text: ")", pos: start}
+	default:
+		p.pos++
+		for _, op := range []string{"<=", ">=", "==", "!=", "&&", "||"} {
+			if strings.HasPrefix(p.expr[start:], op) {
+				p.pos = start + len(op)
+				break
+			}
+		}
+		text := p.expr[start:p.pos]
+		if alias, ok := operatorAliases[text]; ok {
+			text = alias
+		}
+		p.tok = ruleToken{kind: tokOp, text: text, pos: start}
+	}
+}
+
+// accept consumes the current token if it is one of the operators ops
+func (p *ruleParser) accept(ops ...string) (ruleToken, bool) {
+	tok := p.tok
+	if tok.kind != tokOp {
+		return tok, false
+	}
+	for _, op := range ops {
+		if tok.text == op {
+			p.next()
+			return tok, true
+		}
+	}
+	return tok, false
+}
+
+func (p *ruleParser) parseOr() (ruleNode, error) {
+	return p.parseLogical("or", p.parseAnd)
+}
+
+func (p *ruleParser) parseAnd() (ruleNode, error) {
+	return p.parseLogical("and", p.parseNot)
+}
+
+// parseLogical parses operands joined by op, which must all be conditions
+func (p *ruleParser) parseLogical(op string, operand func() (ruleNode, error)) (ruleNode, error) {
+	pos := p.tok.pos
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.accept(op)
+		if !ok {
+			return left, nil
+		}
+		rightPos := p.tok.pos
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		if !left.boolean() {
+			return nil, p.errorf(pos, "%q needs a condition on its left, not a number", tok.text)
+		}
+		if !right.boolean() {
+			return nil, p.errorf(rightPos, "%q needs a condition on its right, not a number", tok.text)
+		}
+		left = binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *ruleParser) parseNot() (ruleNode, error) {
+	tok, ok := p.accept("not")
+	if !ok {
+		return p.parseCompare()
+	}
+	pos := p.tok.pos
+	operand, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	if !operand.boolean() {
+		return nil, p.errorf(pos, "%q needs a condition, not a number", tok.text)
+	}
+	return notNode{operand}, nil
+}
+
+func (p *ruleParser) parseCompare() (ruleNode, error) {
+	pos := p.tok.pos
+	left, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	tok, ok := p.accept("<", "<=", ">", ">=", "==", "!=")
+	if !ok {
+		return left, nil
+	}
+	rightPos := p.tok.pos
+	right, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if left.boolean() {
+		return nil, p.errorf(pos, "%q compares numbers, not conditions", tok.text)
+	}
+	if right.boolean() {
+		return nil, p.errorf(rightPos, "%q compares numbers, not conditions", tok.text)
+	}
+	if next, ok := p.accept("<", "<=", ">", ">=", "==", "!="); ok {
+		return nil, p.errorf(next.pos, "comparisons cannot be chained, join them with \"and\"")
+	}
+	return binaryNode{op: tok.text, left: left, right: right}, nil
+}
+
+func (p *ruleParser) parseSum() (ruleNode, error) {
+	return p.parseArithmetic([]string{"+", "-"}, p.parseProduct)
+}
+
+func (p *ruleParser) parseProduct() (ruleNode, error) {
+	return p.parseArithmetic([]string{"*", "/"}, p.parseUnary)
+}
+
+// parseArithmetic parses operands joined by ops, which must all be numbers
+func (p *ruleParser) parseArithmetic(ops []string, operand func() (ruleNode, error)) (ruleNode, error) {
+	pos := p.tok.pos
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.accept(ops...)
+		if !ok {
+			return left, nil
+		}
+		rightPos := p.tok.pos
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		if left.boolean() {
+			return nil, p.errorf(pos, "%q needs a number on its left, not a condition", tok.text)
+		}
+		if right.boolean() {
+			return nil, p.errorf(rightPos, "%q needs a number on its right, not a condition", tok.text)
+		}
+		left = binaryNode{op: tok.text, left: left, right: right}
+	}
+}
+
+func (p *ruleParser) parseUnary() (ruleNode, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokNumber:
+		value, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, p.errorf(tok.pos, "invalid number %q", tok.text)
+		}
+		p.next()
+		return numberNode(value), nil
+
+	case tokIdent:
+		p.next()
+		if compute, ok := ruleIndicators[tok.text]; ok {
+			return p.parseIndicator(tok, compute)
+		}
+		if value, ok := ruleVariables[tok.text]; ok {
+			if p.tok.kind == tokLParen {
+				return nil, p.errorf(tok.pos, "%s is a variable and takes no period", tok.text)
+			}
+			return variableNode(value), nil
+		}
+		return nil, p.errorf(tok.pos, "unknown variable or indicator %q, available: %s",
+			tok.text, strings.Join(RuleIdentifiers(), ", "))
+
+	case tokLParen:
+		p.next()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokRParen {
+			return nil, p.errorf(p.tok.pos, "expected \")\" to close the \"(\" at column %d, got %s", tok.pos+1, p.tok)
+		}
+		p.next()
+		return node, nil
+
+	case tokOp:
+		if tok.text == "-" {
+			p.next()
+			pos := p.tok.pos
+			operand, err := p.parseUnary()
+			if err != nil {
+				return nil, err
+			}
+			if operand.boolean() {
+				return nil, p.errorf(pos, "\"-\" needs a number, not a condition")
+			}
+			return negateNode{operand}, nil
+		}
+	}
+	return nil, p.errorf(tok.pos, "expected a number, variable or indicator, got %s", tok)
+}
+
+// parseIndicator parses the parenthesized period following an indicator name
+func (p *ruleParser) parseIndicator(name ruleToken, compute func([]Bar, int, int) float64) (ruleNode, error) {
+	if p.tok.kind != tokLParen {
+		return nil, p.errorf(name.pos, "%s needs a period, e.g. %s(14)", name.text, name.text)
+	}
+	p.next()
+	period, err := strconv.Atoi(p.tok.text)
+	if p.tok.kind != tokNumber || err != nil || period < 1 || period > maxRulePeriod {
+		return nil, p.errorf(p.tok.pos, "the period of %s must be a whole number from 1 to %d, got %s", name.text, maxRulePeriod, p.tok)
+	}
+	p.next()
+	if p.tok.kind != tokRParen {
+		return nil, p.errorf(p.tok.pos, "expected \")\" after the period of %s, got %s", name.text, p.tok)
+	}
+	p.next()
+	p.longest = max(p.longest, period)
+	return indicatorNode{compute: compute, period: period}, nil
+}
+
+// RuleIdentifiers returns the variables and indicators rules can use, in
+// sorted order with indicators written as calls
+func RuleIdentifiers() []string {
+	var names []string
+	for name := range ruleVariables {
+		names = append(names, name)
+	}
+	for name := range ruleIndicators {
+		names = append(names, name+"(n)")
+	}
+	sort.Strings(names)
+	return names
+}
+
+func isDigit(c byte) bool  { return c >= '0' && c <= '9' }
+func isLetter(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' }
+
+// smaAt returns the simple moving average of the closes over period at bar i
+func smaAt(bars []Bar, i, period int) float64 {
+	return meanAt(bars, i, period, func(j int) float64 { return bars[j].Close })
+}
+
+// avgVolumeAt returns the average volume over period at bar i
+func avgVolumeAt(bars []Bar, i, period int) float64 {
+	return meanAt(bars, i, period, func(j int) float64 { return float64(bars[j].Volume) })
+}
+
+// rsiAt returns the relative strength index over period at bar i, as rsi
+// computes it
+func rsiAt(bars []Bar, i, period int) float64 {
+	if i < period {
+		return math.NaN()
+	}
+	gain, loss := 0.0, 0.0
+	for j := i - period + 1; j <= i; j++ {
+		if change := bars[j].Close - bars[j-1].Close; change > 0 {
+			gain += change
+		} else {
+			loss -= change
+		}
+	}
+	if loss == 0 {
+		return 100
+	}
+	return 100 - 100/(1+gain/loss)
+}
+
+// atrAt returns the average true range over period at bar i, as atr computes
+// it
+func atrAt(bars []Bar, i, period int) float64 {
+	return meanAt(bars, i, period, func(j int) float64 {
+		r := bars[j].High - bars[j].Low
+		if j > 0 {
+			prev := bars[j-1].Close
+			r = math.Max(r, math.Max(math.Abs(bars[j].High-prev), math.Abs(bars[j].Low-prev)))
+		}
+		return r
+	})
+}
+
+// meanAt returns the mean of value over the period bars ending at bar i, NaN
+// before there are period bars
+func meanAt(bars []Bar, i, period int, value func(j int) float64) float64 {
+	if i < period-1 {
+		return math.NaN()
+	}
+	sum := 0.0
+	for j := i - period + 1; j <= i; j++ {
+		sum += value(j)
+	}
+	return sum / float64(period)
+}
@@ -0,0 +1,169 @@
+package strategy
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+// ruleBars returns five bars with closes 10, 12, 11, 13 and 15, a high-low
+// range of two around the close and a volume spike on the last bar
+func ruleBars() []Bar {
+	closes := []float64{10, 12, 11, 13, 15}
+	volumes := []int64{100, 100, 100, 100, 400}
+	bars := make([]Bar, len(closes))
+	for i, close := range closes {
+		bars[i] = Bar{Open: close, High: close + 1, Low: close - 1, Close: close, Volume: volumes[i]}
+	}
+	return bars
+}
+
+func TestCompileRuleErrors(t *testing.T) {
+	tests := []struct {
+		expr   string
+		column int
+		want   string
+	}{
+		{"", 1, "expected a number, variable or indicator, got end of expression"},
+		{"close >", 8, "expected a number, variable or indicator"},
+		{"close > smaa(20)", 9, `unknown variable or indicator "smaa", available: atr(n), avg_volume(n), close`},
+		{"close > sma(20", 15, `expected ")" after the period of sma`},
+		{"sma(0) > 1", 5, "the period of sma must be a whole number from 1 to 1000"},
+		{"sma(2.5) > 1", 5, "the period of sma must be a whole number"},
+		{"rsi > 50", 1, "rsi needs a period, e.g. rsi(14)"},
+		{"close(3) > 1", 1, "close is a variable and takes no period"},
+		{"close + 1", 1, "expression must be a condition"},
+		{"close > 1 and 2", 15, `"and" needs a condition on its right`},
+		{"(close > 1) * 2 > 1", 1, `"*" needs a number on its left`},
+		{"not close", 5, `"not" needs a condition`},
+		{"1 < close < 2", 11, "comparisons cannot be chained"},
+		{"(close > 1", 11, `expected ")" to close the "(" at column 1`},
+		{"close > 1 )", 11, `unexpected ")"`},
+		{"close @ 1", 7, `unexpected "@"`},
+		{"close > 1..2", 9, `invalid number "1..2"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := CompileRule("CUSTOM", Long, "", tt.expr)
+			var ruleErr *RuleError
+			if !errors.As(err, &ruleErr) {
+				t.Fatalf("CompileRule(%q) error = %v, want a *RuleError", tt.expr, err)
+			}
+			if ruleErr.Pos+1 != tt.column || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("CompileRule(%q) error = %q at column %d, want %q at column %d", tt.expr, err, ruleErr.Pos+1, tt.want, tt.column)
+			}
+		})
+	}
+
+	if _, err := CompileRule("CUSTOM", "BUY", "", "close > 1"); err == nil {
+		t.Error("Expected an error for a signal other than LONG or SHORT")
+	}
+}
+
+func TestRuleEvaluate(t *testing.T) {
+	series := NewSeries(ruleBars())
+	last := series.Len() - 1
+
+	// At the last bar: sma(3) = (11+13+15)/3 = 13, avg_volume(4) = 175,
+	// rsi(4) = 100 - 100/(1+6/1) = 85.7 from gains 2+2+2 and a loss of 1, and
+	// atr(2) = 3 as both true ranges reach the previous close
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"close > sma(3)", true},
+		{"sma(3) == 13 and avg_volume(4) == 175", true},
+		{"volume > 2 * avg_volume(4)", true},
+		{"volume > 2.5 * avg_volume(4)", false},
+		{"rsi(4) > 85.7 and rsi(4) < 85.8", true},
+		{"atr(2) == 3", true},
+		{"close / atr(2) >= 5", true},
+		{"(high - low) * 2 == 4 && open == close", true},
+		{"-close < -14 and not (close > 20)", true},
+		{"close > 20 || ! (volume < 400)", true},
+		{"close > 20 or low != 14", false},
+		{"CLOSE > SMA(3) AND Volume > 300", true},
+		// Indicators without enough history keep the rule from signalling,
+		// even negated
+		{"close > sma(6)", false},
+		{"not (close < sma(6))", false},
+		{"close > 1 or rsi(5) > 50", true},
+		{"close / (volume - 400) > 1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			rule, err := CompileRule("CUSTOM", Short, "", tt.expr)
+			if err != nil {
+				t.Fatalf("CompileRule(%q) error = %v", tt.expr, err)
+			}
+			if got := rule.Evaluate(series, last, nil) == Short; got != tt.want {
+				t.Errorf("%q at the last bar = %v, want %v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleIndicatorsMatchSeries(t *testing.T) {
+	bars := trendingBars(220, 100, 0.5)
+	for i := range bars {
+		// Vary the closes so gains, losses and true ranges differ
+		bars[i].Close += float64(i%7) - 3
+	}
+	series := NewSeries(bars)
+
+	indicators := map[string][]float64{"rsi(14)": series.RSI14, "atr(14)": series.ATR14, "sma(50)": series.SMA50, "sma(200)": series.SMA200}
+	for expr, values := range indicators {
+		node, err := (&ruleParser{expr: expr}).compileNumber()
+		if err != nil {
+			t.Fatalf("Compiling %s: %v", expr, err)
+		}
+		for i, want := range values {
+			got := node.eval(bars, i)
+			if defined(got) != defined(want) || math.Abs(got-want) > 1e-9 {
+				t.Fatalf("%s at bar %d = %v, want %v as NewSeries computes it", expr, i, got, want)
+			}
+		}
+	}
+}
+
+// compileNumber parses the parser's whole expression as a number, for tests
+// reading indicator values
+func (p *ruleParser) compileNumber() (ruleNode, error) {
+	p.next()
+	return p.parseSum()
+}
+
+func TestRuleCompiledOnceEvaluatesWithoutAllocating(t *testing.T) {
+	rule, err := CompileRule("HIGH_BASE_VOLUME", Long, "", "close / atr(14) > 2 and rsi(14) > 60 and volume > 2 * avg_volume(20)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	series := NewSeries(trendingBars(250, 100, 1))
+
+	allocs := testing.AllocsPerRun(100, func() {
+		for i := 0; i < series.Len(); i++ {
+			rule.Evaluate(series, i, nil)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("Evaluating a compiled rule allocated %v times per run, want none", allocs)
+	}
+}
+
+func BenchmarkRuleEvaluate(b *testing.B) {
+	rule, err := CompileRule("HIGH_BASE_VOLUME", Long, "", "close / atr(14) > 2 and rsi(14) > 60 and volume > 2 * avg_volume(20)")
+	if err != nil {
+		b.Fatal(err)
+	}
+	series := NewSeries(trendingBars(250, 100, 1))
+	last := series.Len() - 1
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rule.Evaluate(series, last, nil)
+	}
+}
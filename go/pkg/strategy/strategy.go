@@ -0,0 +1,255 @@
+// Package strategy implements the signal strategies evaluated by the scanner,
+// their tunable parameters and the statistics used to backtest them.
+package strategy
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Signal types
+const (
+	Long  = "LONG"
+	Short = "SHORT"
+)
+
+// Bar is one OHLCV bar
+type Bar struct {
+	Time   time.Time
+	Open   float64
+	High   float64
+	Low    float64
+	Close  float64
+	Volume int64
+}
+
+// ParamSpec declares a tunable strategy parameter and its allowed range
+type ParamSpec struct {
+	Name        string
+	Default     float64
+	Min         float64
+	Max         float64
+	Description string
+}
+
+// Params holds parameter values by name
+type Params map[string]float64
+
+// Strategy evaluates a signal at one bar of a series
+type Strategy interface {
+	// Name is the identifier used in requests, e.g. "HIGH_BASE"
+	Name() string
+	// Params declares the strategy's tunable parameters
+	Params() []ParamSpec
+	// Evaluate returns Long, Short or "" for the bar at index i
+	Evaluate(series *Series, i int, params Params) string
+	// Score rates the strength of the signal Evaluate raises at index i from
+	// 0 to 100, higher for stronger setups, and is 0 without a signal. It
+	// depends on the series and parameters alone, so equal inputs score equal.
+	Score(series *Series, i int, params Params) float64
+}
+
+// MaxScore is the score of the strongest possible setup
+const MaxScore = 100
+
+// Lookback is the history a strategy needs to evaluate a bar: Bars bars
+// ending at it, of BarSize, or of the bars scanned when BarSize is empty
+type Lookback struct {
+	Bars    int
+	BarSize string
+}
+
+// LookbackStrategy is a Strategy declaring the history it needs, which lets
+// the scanner fetch no more than that
+type LookbackStrategy interface {
+	Strategy
+	Lookback() Lookback
+}
+
+// RequiredLookback returns the history s declares it needs, and false when it
+// declares none
+func RequiredLookback(s Strategy) (Lookback, bool) {
+	declaring, ok := s.(LookbackStrategy)
+	if !ok {
+		return Lookback{}, false
+	}
+	return declaring.Lookback(), true
+}
+
+// ExtendedHoursStrategy is a Strategy declaring whether it reads the
+// pre-market and after-hours bars of intraday series. Strategies that do not
+// declare it, or declare false, are given the regular session's bars only.
+type ExtendedHoursStrategy interface {
+	Strategy
+	ExtendedHours() bool
+}
+
+// UsesExtendedHours reports whether s declares it reads extended-hours bars
+func UsesExtendedHours(s Strategy) bool {
+	declaring, ok := s.(ExtendedHoursStrategy)
+	return ok && declaring.ExtendedHours()
+}
+
+// registry holds the available strategies by name
+var registry = map[string]Strategy{
+	highBase{}.Name(): highBase{},
+	lowBase{}.Name():  lowBase{},
+}
+
+// Lookup returns the strategy registered under name
+func Lookup(name string) (Strategy, bool) {
+	s, ok := registry[name]
+	return s, ok
+}
+
+// Names returns the registered strategy names in sorted order
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ResolveParams returns the strategy defaults with overrides applied. Unknown
+// parameter names and values outside the declared range are rejected.
+func ResolveParams(s Strategy, overrides map[string]float64) (Params, error) {
+	specs := make(map[string]ParamSpec)
+	params := make(Params)
+	for _, spec := range s.Params() {
+		specs[spec.Name] = spec
+		params[spec.Name] = spec.Default
+	}
+
+	// Check overrides in a stable order so errors are reproducible
+	names := make([]string, 0, len(overrides))
+	for name := range overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := overrides[name]
+		spec, ok := specs[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown parameter %q for strategy %s, supported: %s",
+				name, s.Name(), strings.Join(paramNames(s), ", "))
+		}
+		if value < spec.Min || value > spec.Max {
+			return nil, fmt.Errorf("parameter %q for strategy %s must be between %g and %g, got %g",
+				name, s.Name(), spec.Min, spec.Max, value)
+		}
+		params[name] = value
+	}
+	return params, nil
+}
+
+// paramNames returns the declared parameter names of s
+func paramNames(s Strategy) []string {
+	var names []string
+	for _, spec := range s.Params() {
+		names = append(names, spec.Name)
+	}
+	return names
+}
+
+// highBase signals LONG for strong stocks building a high base: price high
+// relative to its ATR, RSI above a threshold and price above the 50 and 200 day
+// moving averages when enough history exists to compute them.
+//
+// Its score averages how far RSI14 clears min_rsi, as a fraction of the room
+// up to 100, and how tight the base is, as 1 - max_atr_ratio / (close/ATR14),
+// which nears 1 as the daily range shrinks relative to the price.
+type highBase struct{}
+
+func (highBase) Name() string { return "HIGH_BASE" }
+
+// Lookback covers the SMA200; with fewer bars the strategy still signals,
+// only without checking the moving averages it lacks the history for
+func (highBase) Lookback() Lookback { return Lookback{Bars: smaLongPeriod} }
+
+func (highBase) Params() []ParamSpec {
+	return []ParamSpec{
+		{Name: "max_atr_ratio", Default: 2.0, Min: 0, Max: 1000, Description: "minimum close/ATR14 ratio"},
+		{Name: "min_rsi", Default: 60, Min: 0, Max: 100, Description: "minimum RSI14"},
+	}
+}
+
+func (highBase) Evaluate(series *Series, i int, params Params) string {
+	close, atr, rsi := series.Bars[i].Close, series.ATR14[i], series.RSI14[i]
+	if !defined(atr) || !defined(rsi) || atr <= 0 {
+		return ""
+	}
+
+	if close/atr > params["max_atr_ratio"] && rsi > params["min_rsi"] &&
+		aboveOrUndefined(close, series.SMA50[i]) && aboveOrUndefined(close, series.SMA200[i]) {
+		return Long
+	}
+	return ""
+}
+
+func (h highBase) Score(series *Series, i int, params Params) float64 {
+	if h.Evaluate(series, i, params) == "" {
+		return 0
+	}
+	ratio, rsi := series.Bars[i].Close/series.ATR14[i], series.RSI14[i]
+	momentum := fraction(rsi-params["min_rsi"], 100-params["min_rsi"])
+	tightness := 1 - params["max_atr_ratio"]/ratio
+	return MaxScore * (momentum + tightness) / 2
+}
+
+// lowBase signals SHORT for weak stocks building a low base: price low relative
+// to its ATR, RSI below a threshold and price below the 50 and 200 day moving
+// averages when enough history exists to compute them.
+//
+// Its score averages how far RSI14 falls below max_rsi, as a fraction of the
+// room down to 0, and how far close/ATR14 falls below min_atr_ratio, as a
+// fraction of min_atr_ratio.
+type lowBase struct{}
+
+func (lowBase) Name() string { return "LOW_BASE" }
+
+// Lookback covers the SMA200, as for HIGH_BASE
+func (lowBase) Lookback() Lookback { return Lookback{Bars: smaLongPeriod} }
+
+func (lowBase) Params() []ParamSpec {
+	return []ParamSpec{
+		{Name: "min_atr_ratio", Default: 0.5, Min: 0, Max: 1000, Description: "maximum close/ATR14 ratio"},
+		{Name: "max_rsi", Default: 40, Min: 0, Max: 100, Description: "maximum RSI14"},
+	}
+}
+
+func (lowBase) Evaluate(series *Series, i int, params Params) string {
+	close, atr, rsi := series.Bars[i].Close, series.ATR14[i], series.RSI14[i]
+	if !defined(atr) || !defined(rsi) || atr <= 0 {
+		return ""
+	}
+
+	if close/atr < params["min_atr_ratio"] && rsi < params["max_rsi"] &&
+		belowOrUndefined(close, series.SMA50[i]) && belowOrUndefined(close, series.SMA200[i]) {
+		return Short
+	}
+	return ""
+}
+
+func (l lowBase) Score(series *Series, i int, params Params) float64 {
+	if l.Evaluate(series, i, params) == "" {
+		return 0
+	}
+	ratio, rsi := series.Bars[i].Close/series.ATR14[i], series.RSI14[i]
+	weakness := fraction(params["max_rsi"]-rsi, params["max_rsi"])
+	depth := fraction(params["min_atr_ratio"]-ratio, params["min_atr_ratio"])
+	return MaxScore * (weakness + depth) / 2
+}
+
+// fraction returns part/whole clamped to [0, 1], and 1 for an empty whole
+func fraction(part, whole float64) float64 {
+	if whole <= 0 {
+		return 1
+	}
+	return math.Max(0, math.Min(1, part/whole))
+}
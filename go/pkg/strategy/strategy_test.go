@@ -0,0 +1,164 @@
+package strategy
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// trendingBars returns n daily bars whose close rises by step each day, with a
+// high-low range of two around the close
+func trendingBars(n int, start, step float64) []Bar {
+	bars := make([]Bar, n)
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range bars {
+		close := start + float64(i)*step
+		bars[i] = Bar{
+			Time:   day.AddDate(0, 0, i),
+			Open:   close,
+			High:   close + 1,
+			Low:    close - 1,
+			Close:  close,
+			Volume: 1000,
+		}
+	}
+	return bars
+}
+
+func TestIndicators(t *testing.T) {
+	// Alternate gains and losses of one so average gain equals average loss
+	bars := make([]Bar, 16)
+	for i := range bars {
+		close := 10.0
+		if i%2 == 1 {
+			close = 11
+		}
+		bars[i] = Bar{Close: close, High: close + 1, Low: close - 1}
+	}
+	series := NewSeries(bars)
+
+	if defined(series.RSI14[13]) {
+		t.Errorf("Expected RSI undefined before 14 changes, got %v", series.RSI14[13])
+	}
+	if got := series.RSI14[14]; got != 50 {
+		t.Errorf("Expected RSI 50 for equal gains and losses, got %v", got)
+	}
+
+	// True range is the wider of the bar range and the gap from the previous
+	// close, two here for every bar
+	if defined(series.ATR14[12]) {
+		t.Errorf("Expected ATR undefined before 14 bars, got %v", series.ATR14[12])
+	}
+	if got := series.ATR14[13]; got != 2 {
+		t.Errorf("Expected ATR 2, got %v", got)
+	}
+	if defined(series.SMA50[15]) {
+		t.Errorf("Expected SMA50 undefined for a short series, got %v", series.SMA50[15])
+	}
+
+	rising := NewSeries(trendingBars(60, 100, 1))
+	if got := rising.RSI14[20]; got != 100 {
+		t.Errorf("Expected RSI 100 without losses, got %v", got)
+	}
+	// Mean of closes 110 through 159
+	if got := rising.SMA50[59]; math.Abs(got-134.5) > 1e-9 {
+		t.Errorf("Expected SMA50 134.5, got %v", got)
+	}
+}
+
+func TestResolveParams(t *testing.T) {
+	highBase, ok := Lookup("HIGH_BASE")
+	if !ok {
+		t.Fatal("HIGH_BASE not registered")
+	}
+
+	params, err := ResolveParams(highBase, nil)
+	if err != nil {
+		t.Fatalf("ResolveParams failed: %v", err)
+	}
+	if params["min_rsi"] != 60 || params["max_atr_ratio"] != 2 {
+		t.Errorf("Expected defaults, got %v", params)
+	}
+
+	params, err = ResolveParams(highBase, map[string]float64{"min_rsi": 70})
+	if err != nil {
+		t.Fatalf("ResolveParams failed: %v", err)
+	}
+	if params["min_rsi"] != 70 || params["max_atr_ratio"] != 2 {
+		t.Errorf("Expected min_rsi override only, got %v", params)
+	}
+
+	_, err = ResolveParams(highBase, map[string]float64{"min_rsy": 70})
+	if err == nil || !strings.Contains(err.Error(), `"min_rsy"`) || !strings.Contains(err.Error(), "min_rsi") {
+		t.Errorf("Expected error naming the unknown key and the supported ones, got %v", err)
+	}
+
+	_, err = ResolveParams(highBase, map[string]float64{"min_rsi": 120})
+	if err == nil || !strings.Contains(err.Error(), "between 0 and 100") {
+		t.Errorf("Expected range error, got %v", err)
+	}
+}
+
+func TestStrategiesEvaluate(t *testing.T) {
+	highBase, _ := Lookup("HIGH_BASE")
+	lowBase, _ := Lookup("LOW_BASE")
+
+	rising := NewSeries(trendingBars(30, 100, 1))
+	params, _ := ResolveParams(highBase, nil)
+	if got := highBase.Evaluate(rising, 20, params); got != Long {
+		t.Errorf("Expected LONG for a steady uptrend, got %q", got)
+	}
+	if got := highBase.Evaluate(rising, 5, params); got != "" {
+		t.Errorf("Expected no signal before indicators are defined, got %q", got)
+	}
+
+	// Raising the RSI threshold to its maximum removes the signal
+	params, _ = ResolveParams(highBase, map[string]float64{"min_rsi": 100})
+	if got := highBase.Evaluate(rising, 20, params); got != "" {
+		t.Errorf("Expected no signal with min_rsi 100, got %q", got)
+	}
+
+	// A close of 0.5 with an ATR of 2 is below the default 0.5 ratio
+	falling := NewSeries(trendingBars(30, 29.5, -1))
+	params, _ = ResolveParams(lowBase, nil)
+	if got := lowBase.Evaluate(falling, 29, params); got != Short {
+		t.Errorf("Expected SHORT for a collapsing price, got %q", got)
+	}
+	if got := lowBase.Evaluate(rising, 20, params); got != "" {
+		t.Errorf("Expected no LOW_BASE signal in an uptrend, got %q", got)
+	}
+}
+
+func TestStrategiesScore(t *testing.T) {
+	highBase, _ := Lookup("HIGH_BASE")
+	lowBase, _ := Lookup("LOW_BASE")
+	params, _ := ResolveParams(highBase, nil)
+
+	// With an RSI of 100 the score is (1 + 1 - 2/ratio) / 2 * 100; at bar 20
+	// the close is 120 and the ATR 2, a ratio of 60
+	rising := NewSeries(trendingBars(30, 100, 1))
+	if got, want := highBase.Score(rising, 20, params), 100*(2-2.0/60)/2; math.Abs(got-want) > 1e-9 {
+		t.Errorf("HIGH_BASE score = %v, want %v", got, want)
+	}
+	if got := highBase.Score(rising, 5, params); got != 0 {
+		t.Errorf("Expected a zero score without a signal, got %v", got)
+	}
+
+	// A wider range on the same closes makes a looser base and a weaker setup
+	wide := trendingBars(30, 100, 1)
+	for i := range wide {
+		wide[i].High, wide[i].Low = wide[i].Close+5, wide[i].Close-5
+	}
+	if tight, loose := highBase.Score(rising, 20, params), highBase.Score(NewSeries(wide), 20, params); loose >= tight {
+		t.Errorf("Expected the wide range to score below the tight one, got %v and %v", loose, tight)
+	}
+
+	// An RSI of 0 and a close/ATR ratio of 0.25 against the default 0.5 score
+	// (1 + 0.5) / 2
+	falling := NewSeries(trendingBars(30, 29.5, -1))
+	params, _ = ResolveParams(lowBase, nil)
+	if got := lowBase.Score(falling, 29, params); math.Abs(got-75) > 1e-9 {
+		t.Errorf("LOW_BASE score = %v, want 75", got)
+	}
+}
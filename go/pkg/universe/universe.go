@@ -0,0 +1,252 @@
+// Package universe maintains the list of symbols the scanner trades and filters
+// it by market cap, price and volume
+package universe
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// cacheFileName is the file in the cache directory holding the filtered universe
+const cacheFileName = "universe_cache.json"
+
+// ErrCacheExpired is returned when the cached universe is older than the allowed expiry
+var ErrCacheExpired = errors.New("universe cache expired")
+
+// Member is a symbol in the universe along with optional metadata from the source file
+type Member struct {
+	Symbol    string  `json:"symbol"`
+	MarketCap float64 `json:"market_cap,omitempty"`
+	Sector    string  `json:"sector,omitempty"`
+}
+
+// Fundamentals contains the values used to filter a symbol
+type Fundamentals struct {
+	Price     float64
+	AvgVolume float64
+	MarketCap float64
+}
+
+// FundamentalsSource looks up the fundamentals used for filtering
+type FundamentalsSource interface {
+	Fundamentals(ctx context.Context, symbol string) (Fundamentals, error)
+}
+
+// Universe is an ordered, de-duplicated list of symbols
+type Universe struct {
+	Members     []Member  `json:"members"`
+	GeneratedAt time.Time `json:"generated_at"`
+}
+
+// New creates a universe from plain symbols
+func New(symbols []string) *Universe {
+	u := &Universe{}
+	for _, symbol := range symbols {
+		u.Add(Member{Symbol: symbol})
+	}
+	return u
+}
+
+// LoadFromFile reads a universe from a file containing either one symbol per line
+// or CSV with a header row containing a "symbol" column and optional "market_cap"
+// and "sector" columns. Blank lines and lines starting with # are ignored.
+func LoadFromFile(path string) (*Universe, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read universe file: %w", err)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return &Universe{}, nil
+	}
+
+	if !strings.Contains(lines[0], ",") {
+		return New(lines), nil
+	}
+
+	return parseCSV(strings.Join(lines, "\n"))
+}
+
+// parseCSV parses a universe CSV with a header row
+func parseCSV(content string) (*Universe, error) {
+	reader := csv.NewReader(strings.NewReader(content))
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read universe header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	symbolCol, ok := columns["symbol"]
+	if !ok {
+		return nil, fmt.Errorf("universe CSV has no symbol column")
+	}
+
+	u := &Universe{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse universe CSV: %w", err)
+		}
+
+		member := Member{Symbol: record[symbolCol]}
+		if col, ok := columns["market_cap"]; ok && col < len(record) && record[col] != "" {
+			member.MarketCap, err = strconv.ParseFloat(record[col], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid market cap for %s: %w", member.Symbol, err)
+			}
+		}
+		if col, ok := columns["sector"]; ok && col < len(record) {
+			member.Sector = record[col]
+		}
+		u.Add(member)
+	}
+
+	return u, nil
+}
+
+// Symbols returns the symbols in the universe
+func (u *Universe) Symbols() []string {
+	symbols := make([]string, len(u.Members))
+	for i, member := range u.Members {
+		symbols[i] = member.Symbol
+	}
+	return symbols
+}
+
+// Add inserts a member, normalizing its symbol; it reports false if the symbol is
+// empty or already present
+func (u *Universe) Add(member Member) bool {
+	member.Symbol = strings.ToUpper(strings.TrimSpace(member.Symbol))
+	if member.Symbol == "" || u.Contains(member.Symbol) {
+		return false
+	}
+	u.Members = append(u.Members, member)
+	return true
+}
+
+// Remove deletes a symbol, reporting whether it was present
+func (u *Universe) Remove(symbol string) bool {
+	symbol = strings.ToUpper(strings.TrimSpace(symbol))
+	for i, member := range u.Members {
+		if member.Symbol == symbol {
+			u.Members = append(u.Members[:i], u.Members[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Contains reports whether the symbol is in the universe
+func (u *Universe) Contains(symbol string) bool {
+	symbol = strings.ToUpper(strings.TrimSpace(symbol))
+	for _, member := range u.Members {
+		if member.Symbol == symbol {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyFilters returns a new universe containing only the members that meet the
+// minimum market cap, price and average volume. A zero minimum disables that
+// filter. Market cap from the universe file takes precedence over the source.
+// Symbols whose fundamentals cannot be fetched are dropped.
+func (u *Universe) ApplyFilters(ctx context.Context, source FundamentalsSource, minMarketCap, minPrice, minVolume float64) (*Universe, error) {
+	filtered := &Universe{GeneratedAt: time.Now()}
+
+	for _, member := range u.Members {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		fundamentals, err := source.Fundamentals(ctx, member.Symbol)
+		if err != nil {
+			logrus.Warnf("Dropping %s from universe: %v", member.Symbol, err)
+			continue
+		}
+		if member.MarketCap > 0 {
+			fundamentals.MarketCap = member.MarketCap
+		}
+
+		if minMarketCap > 0 && fundamentals.MarketCap < minMarketCap {
+			continue
+		}
+		if minPrice > 0 && fundamentals.Price < minPrice {
+			continue
+		}
+		if minVolume > 0 && fundamentals.AvgVolume < minVolume {
+			continue
+		}
+
+		filtered.Members = append(filtered.Members, member)
+	}
+
+	return filtered, nil
+}
+
+// SaveCache writes the universe to the cache directory
+func (u *Universe) SaveCache(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create universe cache directory: %w", err)
+	}
+
+	content, err := json.MarshalIndent(u, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode universe cache: %w", err)
+	}
+
+	path := filepath.Join(dir, cacheFileName)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, content, 0644); err != nil {
+		return fmt.Errorf("failed to write universe cache: %w", err)
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// LoadCache reads the cached universe from dir, returning ErrCacheExpired if it
+// was generated more than expiry before now. A non-positive expiry never expires.
+func LoadCache(dir string, expiry time.Duration, now time.Time) (*Universe, error) {
+	content, err := os.ReadFile(filepath.Join(dir, cacheFileName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read universe cache: %w", err)
+	}
+
+	var u Universe
+	if err := json.Unmarshal(content, &u); err != nil {
+		return nil, fmt.Errorf("failed to decode universe cache: %w", err)
+	}
+
+	if expiry > 0 && now.Sub(u.GeneratedAt) > expiry {
+		return nil, ErrCacheExpired
+	}
+
+	return &u, nil
+}
@@ -0,0 +1,108 @@
+package universe
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// mockFundamentals serves fixed fundamentals per symbol
+type mockFundamentals map[string]Fundamentals
+
+func (m mockFundamentals) Fundamentals(ctx context.Context, symbol string) (Fundamentals, error) {
+	f, ok := m[symbol]
+	if !ok {
+		return Fundamentals{}, errors.New("no data")
+	}
+	return f, nil
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "universe.txt")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write fixture: %v", err)
+	}
+	return path
+}
+
+func TestLoadFromFile(t *testing.T) {
+	plain, err := LoadFromFile(writeFile(t, "# core names\nspy\nQQQ\n\nSPY\n"))
+	if err != nil {
+		t.Fatalf("Failed to load plain list: %v", err)
+	}
+	if got := plain.Symbols(); !reflect.DeepEqual(got, []string{"SPY", "QQQ"}) {
+		t.Errorf("Plain symbols: got %v", got)
+	}
+
+	withMeta, err := LoadFromFile(writeFile(t, "symbol,market_cap,sector\nAAPL,3000000000000,Technology\nXOM,,Energy\n"))
+	if err != nil {
+		t.Fatalf("Failed to load CSV: %v", err)
+	}
+	want := []Member{
+		{Symbol: "AAPL", MarketCap: 3e12, Sector: "Technology"},
+		{Symbol: "XOM", Sector: "Energy"},
+	}
+	if !reflect.DeepEqual(withMeta.Members, want) {
+		t.Errorf("CSV members: got %+v, want %+v", withMeta.Members, want)
+	}
+}
+
+func TestApplyFilters(t *testing.T) {
+	u := New([]string{"BIG", "CHEAP", "THIN", "SMALL", "MISSING"})
+	u.Members[3].MarketCap = 5e9 // file metadata overrides the source
+
+	source := mockFundamentals{
+		"BIG":   {Price: 150, AvgVolume: 5e6, MarketCap: 2e11},
+		"CHEAP": {Price: 5, AvgVolume: 5e6, MarketCap: 2e11},
+		"THIN":  {Price: 150, AvgVolume: 1e5, MarketCap: 2e11},
+		"SMALL": {Price: 150, AvgVolume: 5e6, MarketCap: 2e11},
+	}
+
+	filtered, err := u.ApplyFilters(context.Background(), source, 1e10, 20, 1e6)
+	if err != nil {
+		t.Fatalf("ApplyFilters failed: %v", err)
+	}
+	if got := filtered.Symbols(); !reflect.DeepEqual(got, []string{"BIG"}) {
+		t.Errorf("Filtered symbols: got %v, want [BIG]", got)
+	}
+
+	unfiltered, err := u.ApplyFilters(context.Background(), source, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("ApplyFilters failed: %v", err)
+	}
+	if len(unfiltered.Members) != 4 {
+		t.Errorf("Zero minimums should keep all symbols with data, got %v", unfiltered.Symbols())
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	dir := t.TempDir()
+	generated := time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)
+
+	u := New([]string{"SPY", "QQQ"})
+	u.GeneratedAt = generated
+	if err := u.SaveCache(dir); err != nil {
+		t.Fatalf("SaveCache failed: %v", err)
+	}
+
+	cached, err := LoadCache(dir, 24*time.Hour, generated.Add(23*time.Hour))
+	if err != nil {
+		t.Fatalf("LoadCache failed within expiry: %v", err)
+	}
+	if !reflect.DeepEqual(cached.Symbols(), u.Symbols()) {
+		t.Errorf("Cached symbols: got %v, want %v", cached.Symbols(), u.Symbols())
+	}
+
+	if _, err := LoadCache(dir, 24*time.Hour, generated.Add(25*time.Hour)); !errors.Is(err, ErrCacheExpired) {
+		t.Errorf("Expected ErrCacheExpired, got %v", err)
+	}
+
+	if _, err := LoadCache(t.TempDir(), 24*time.Hour, generated); err == nil {
+		t.Error("Expected error for missing cache")
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+	"k8s.io/client-go/kubernetes"
+
+	"traderadmin/backend/health"
+)
+
+// Types of [[health.dependencies]]
+const (
+	HealthGRPC       = "grpc"
+	HealthHTTP       = "http"
+	HealthIBKR       = "ibkr"
+	HealthKubernetes = "kubernetes"
+)
+
+// version is TraderAdmin's version, reported by the health check. Release
+// builds set it with -ldflags "-X main.version=...".
+var version = "dev"
+
+// newHealthAggregator returns the aggregator probing [health] dependencies,
+// with its gauges registered in the app's metrics registry
+func (a *App) newHealthAggregator() *health.Aggregator {
+	a.metrics = prometheus.NewRegistry()
+	return health.NewAggregator(version, a.healthDependencies, a.metrics)
+}
+
+// healthDependencies builds the probes of the configured dependencies
+func (a *App) healthDependencies() []health.Dependency {
+	configured := a.config.Health.Dependencies
+	dependencies := make([]health.Dependency, 0, len(configured))
+	for _, dependency := range configured {
+		var probe health.Probe
+		switch dependency.Type {
+		case HealthGRPC:
+			probe = health.GRPCProbe(dependency.Address, dependency.Service)
+		case HealthHTTP:
+			probe = health.HTTPProbe(nil, dependency.Address)
+		case HealthIBKR:
+			address := dependency.Address
+			if address == "" {
+				address = a.config.ibkrConnectionConfig().Address
+			}
+			probe = health.IBKRProbe(address)
+		case HealthKubernetes:
+			deployment := dependency.Address
+			if deployment == "" {
+				deployment = a.config.Kubernetes.OrchestratorDeploymentName
+			}
+			client := func() (kubernetes.Interface, error) { return a.kubernetesClient() }
+			probe = health.DeploymentProbe(client, a.config.Kubernetes.Namespace, deployment)
+		default:
+			probe = func(context.Context) error { return fmt.Errorf("unknown dependency type %q", dependency.Type) }
+		}
+		dependencies = append(dependencies, health.Dependency{
+			Name:     dependency.Name,
+			Critical: dependency.Critical,
+			Timeout:  time.Duration(dependency.TimeoutMs) * time.Millisecond,
+			Probe:    probe,
+		})
+	}
+	return dependencies
+}
+
+// CheckHealth probes the [health] dependencies and returns the stack's
+// aggregated health
+func (a *App) CheckHealth() health.HealthStatus {
+	return a.health.Check(context.Background())
+}
+
+// serveHealth serves /health and /metrics on Health.ListenAddress until ctx is
+// done. A changed address takes effect on restart.
+func (a *App) serveHealth(ctx context.Context) {
+	address := a.config.Health.ListenAddress
+	if address == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/health", health.Handler(a.health))
+	mux.Handle("/metrics", promhttp.HandlerFor(a.metrics, promhttp.HandlerOpts{}))
+	server := &http.Server{Addr: address, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	log.Info().Str("address", address).Msg("Serving health checks and metrics")
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Error().Err(err).Str("address", address).Msg("Failed to serve health checks")
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"traderadmin/backend/health"
+)
+
+func TestCheckHealthUsesConfiguredDependencies(t *testing.T) {
+	// A port nothing listens on
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	app := NewApp()
+	app.config.IBKRConnection.Accounts = []IBKRAccount{{Name: "paper", Host: "127.0.0.1", Port: port}}
+	app.config.Health.Dependencies = []HealthDependency{
+		{Name: "orchestrator", Type: HealthKubernetes},
+		{Name: "ibkr", Type: HealthIBKR, Critical: true, TimeoutMs: 500},
+	}
+
+	status := app.CheckHealth()
+	if status.Status != health.StatusDown || len(status.Dependencies) != 2 {
+		t.Fatalf("CheckHealth() = %+v, want down", status)
+	}
+	if ibkr := status.Dependencies[0]; ibkr.Status != health.StatusDown || !strings.Contains(ibkr.Error, "refused") {
+		t.Errorf("ibkr = %+v, want the active account's address refused", ibkr)
+	}
+	if orchestrator := status.Dependencies[1]; orchestrator.Status != health.StatusDown || !strings.Contains(orchestrator.Error, "Kubernetes") {
+		t.Errorf("orchestrator = %+v, want Kubernetes unavailable", orchestrator)
+	}
+
+	// Without the critical dependency the stack is only degraded
+	app.config.Health.Dependencies = app.config.Health.Dependencies[:1]
+	if status := app.CheckHealth(); status.Status != health.StatusDegraded {
+		t.Errorf("CheckHealth() = %q, want degraded", status.Status)
+	}
+}
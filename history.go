@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"traderadmin/backend/history"
+	"traderadmin/backend/models"
+)
+
+// GetEquityHistory returns recorded portfolio snapshots between from and to,
+// downsampled to the requested resolution ("raw", "5m", "1h", "1d", ...)
+func (a *App) GetEquityHistory(from, to time.Time, resolution string) ([]history.Snapshot, error) {
+	if a.equityStore == nil {
+		return nil, fmt.Errorf("equity history store not initialized")
+	}
+	return a.equityStore.Query(from, to, resolution)
+}
+
+// recordEquityHistory snapshots the portfolio on the configured interval while
+// connected to IBKR and compacts old history once a day
+func (a *App) recordEquityHistory(ctx context.Context) {
+	var lastCompaction time.Time
+
+	for {
+		interval := time.Duration(a.config.History.SnapshotIntervalMinutes) * time.Minute
+		if interval <= 0 {
+			interval = 5 * time.Minute
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+
+		// Refresh rather than read the cached metrics, which are not refreshed
+		// while the window is minimised
+		snapshot, ok := equitySnapshot(a.collector.refresh())
+		if !ok {
+			continue
+		}
+		if err := a.equityStore.Record(snapshot); err != nil {
+			log.Error().Err(err).Msg("Failed to record equity snapshot")
+			continue
+		}
+
+		if time.Since(lastCompaction) > 24*time.Hour {
+			retention := time.Duration(a.config.History.RetentionDays) * 24 * time.Hour
+			if retention <= 0 {
+				retention = 30 * 24 * time.Hour
+			}
+			if err := a.equityStore.Compact(retention, time.Now()); err != nil {
+				log.Error().Err(err).Msg("Failed to compact equity history")
+			}
+			lastCompaction = time.Now()
+		}
+	}
+}
+
+// equitySnapshot returns the snapshot of the portfolio in metrics, or false
+// while IBKR is not connected or has not reported the account's value, which
+// would record a drop to zero
+func equitySnapshot(status StatusInfo, metrics models.AllMetrics) (history.Snapshot, bool) {
+	if !status.IBKR.Connected || metrics.Portfolio.Equity <= 0 {
+		return history.Snapshot{}, false
+	}
+	return history.Snapshot{
+		Timestamp:     metrics.Portfolio.Timestamp,
+		Equity:        metrics.Portfolio.Equity,
+		RealizedPNL:   metrics.Portfolio.RealizedPNLToday,
+		UnrealizedPNL: metrics.Portfolio.UnrealizedPNL,
+		OpenPositions: metrics.Portfolio.OpenPositionsCount,
+	}, true
+}
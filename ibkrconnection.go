@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"traderadmin/backend/ibkr"
+)
+
+// IBKRConnectionEvent is emitted with an ibkr.ConnectionStatus whenever the
+// trading or data connection to TWS/Gateway changes state
+const IBKRConnectionEvent = "ibkr:connection"
+
+// startIBKRConnections (re)starts the connection manager for the active
+// account of [ibkr_connection]. The previous manager's connections are
+// closed first, so that its client IDs are free again.
+func (a *App) startIBKRConnections() {
+	a.stopIBKRConnections()
+
+	settings := a.config.ibkrConnectionConfig()
+	manager := ibkr.NewConnectionManager(settings)
+	ctx, cancel := context.WithCancel(a.bgCtx)
+	done := make(chan struct{})
+
+	a.ibkrMu.Lock()
+	a.ibkrConn, a.ibkrCancel, a.ibkrDone = manager, cancel, done
+	a.ibkrMu.Unlock()
+
+	go func() {
+		defer close(done)
+		manager.Run(ctx)
+	}()
+	go a.forwardIBKREvents(ctx, manager)
+	log.Info().Str("address", settings.Address).Str("account", a.config.activeIBKRAccount().Name).Msg("Connecting to IBKR TWS/Gateway")
+}
+
+// ibkrConnectionConfig returns the connection manager settings of the active
+// account
+func (c Configuration) ibkrConnectionConfig() ibkr.ConnectionConfig {
+	account := c.activeIBKRAccount()
+	return ibkr.ConnectionConfig{
+		Address:           net.JoinHostPort(account.Host, strconv.Itoa(account.Port)),
+		TradingClientID:   account.ClientIDTrading,
+		DataClientID:      account.ClientIDData,
+		HeartbeatInterval: time.Duration(c.IBKRConnection.HeartbeatSeconds) * time.Second,
+		MaxBackoff:        time.Duration(c.IBKRConnection.MaxBackoffSeconds) * time.Second,
+	}
+}
+
+// stopIBKRConnections closes the manager's connections and waits until they
+// are closed. The manager's last status stays readable.
+func (a *App) stopIBKRConnections() {
+	a.ibkrMu.Lock()
+	cancel, done := a.ibkrCancel, a.ibkrDone
+	a.ibkrCancel, a.ibkrDone = nil, nil
+	a.ibkrMu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+// forwardIBKREvents emits the manager's state transitions to the frontend
+// until ctx is done, recording the connections coming up and going down in
+// the notification center
+func (a *App) forwardIBKREvents(ctx context.Context, manager *ibkr.ConnectionManager) {
+	connected := make(map[string]bool)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case status := <-manager.Events():
+			logEvent := log.Info()
+			if status.State == ibkr.StateDisconnected {
+				logEvent = log.Warn().Str("error", status.LastError)
+				if status.LastError != "" {
+					a.exporter.apiError(status.Name)
+				}
+			}
+			logEvent.Str("connection", status.Name).Int("client_id", status.ClientID).Str("state", string(status.State)).Msg("IBKR connection changed")
+			a.emitEvent(IBKRConnectionEvent, status)
+			a.notifyIBKRConnection(status, connected)
+		}
+	}
+}
+
+// ibkrConnections returns the running connection manager, or nil before the
+// configuration is loaded
+func (a *App) ibkrConnections() *ibkr.ConnectionManager {
+	a.ibkrMu.RLock()
+	defer a.ibkrMu.RUnlock()
+	return a.ibkrConn
+}
+
+// GetIBKRConnections returns the state of the trading and data connections
+// to TWS/Gateway
+func (a *App) GetIBKRConnections() []ibkr.ConnectionStatus {
+	manager := a.ibkrConnections()
+	if manager == nil {
+		return []ibkr.ConnectionStatus{}
+	}
+	return manager.Status()
+}
+
+// ibkrStatus summarises the managed connections for StatusInfo: connected
+// when both are, since when the trading connection has been up, and the
+// first connection's error otherwise
+func (a *App) ibkrStatus() (connected bool, since time.Time, message string) {
+	connections := a.GetIBKRConnections()
+	if len(connections) == 0 {
+		return false, time.Time{}, "Not connected to Interactive Brokers TWS/Gateway"
+	}
+	connected = true
+	for _, connection := range connections {
+		if connection.State == ibkr.StateConnected {
+			continue
+		}
+		connected = false
+		if message == "" {
+			message = fmt.Sprintf("%s connection %s", connection.Name, connection.State)
+			if connection.LastError != "" {
+				message += ": " + connection.LastError
+			}
+		}
+	}
+	return connected, connections[0].ConnectedAt, message
+}
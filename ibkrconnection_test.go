@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"traderadmin/backend/ibkr"
+)
+
+func TestStatusReadsIBKRConnectionState(t *testing.T) {
+	// A port nothing listens on
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	app := NewApp()
+	events := make(chan ibkr.ConnectionStatus, 64)
+	app.emit = func(name string, data ...interface{}) {
+		if name == IBKRConnectionEvent {
+			select {
+			case events <- data[0].(ibkr.ConnectionStatus):
+			default:
+			}
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	app.bgCtx = ctx
+	defer app.stopIBKRConnections()
+
+	// Loading the configuration connects
+	config := validConfig()
+	account := IBKRAccount{Name: "paper", Host: "127.0.0.1", Port: port, ClientIDTrading: 1, ClientIDData: 2, AccountCode: "DU123456"}
+	config.IBKRConnection.Accounts = []IBKRAccount{account}
+	app.setConfig(config)
+	manager := app.ibkrConnections()
+	if manager == nil {
+		t.Fatal("setConfig did not start the IBKR connections")
+	}
+
+	deadline := time.After(5 * time.Second)
+	for refused := false; !refused; {
+		select {
+		case event := <-events:
+			refused = event.Name == ibkr.ConnectionTrading && event.State == ibkr.StateDisconnected && strings.Contains(event.LastError, "refused")
+		case <-deadline:
+			t.Fatal("Timed out waiting for the refused connection event")
+		}
+	}
+
+	status := app.collectStatus()
+	if status.IBKR.Connected || !strings.Contains(status.IBKR.Error, "trading connection") || !strings.Contains(status.IBKR.Error, "refused") {
+		t.Errorf("collectStatus().IBKR = %+v, want the trading connection refused", status.IBKR)
+	}
+
+	// Only a change of the active account reconnects
+	config.TradingParameters.GlobalMaxConcurrentPositions = 3
+	app.setConfig(config)
+	if app.ibkrConnections() != manager {
+		t.Error("An unrelated config change restarted the IBKR connections")
+	}
+	account.ClientIDData = 3
+	config.IBKRConnection.Accounts = []IBKRAccount{account}
+	app.setConfig(config)
+	if app.ibkrConnections() == manager {
+		t.Fatal("Changing the client id did not restart the IBKR connections")
+	}
+	if connections := app.GetIBKRConnections(); len(connections) != 2 || connections[1].ClientID != 3 {
+		t.Errorf("GetIBKRConnections() = %+v, want the data connection with client id 3", connections)
+	}
+}
@@ -0,0 +1,456 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ImagePullProgressEvent is emitted with an ImagePullProgress for each line
+// docker pull reports
+const ImagePullProgressEvent = "image:pull-progress"
+
+// Image update states reported by CheckForImageUpdates
+const (
+	ImageUpToDate = "up-to-date"
+	ImageOutdated = "outdated"
+	ImageUnknown  = "unknown"
+)
+
+// imagePullTimeout bounds pulling one image
+const imagePullTimeout = 10 * time.Minute
+
+// ImageUpdate compares the image a container runs with the registry's
+// current image for the same tag
+type ImageUpdate struct {
+	ContainerID   string `json:"containerId"`
+	ContainerName string `json:"containerName"`
+	Image         string `json:"image"`
+	LocalDigest   string `json:"localDigest,omitempty"`
+	RemoteDigest  string `json:"remoteDigest,omitempty"`
+	Status        string `json:"status"`
+	Error         string `json:"error,omitempty"`
+}
+
+// ImagePullProgress is one line of docker pull output. Layer is empty for
+// lines about the whole image, such as the final digest.
+type ImagePullProgress struct {
+	Image  string `json:"image"`
+	Layer  string `json:"layer,omitempty"`
+	Status string `json:"status"`
+}
+
+// CheckForImageUpdates reports, for each stack container, whether the
+// registry has a newer image for the tag it runs. Registry credentials come
+// from the Docker config file, as for docker pull; an image whose registry
+// cannot be reached is reported as unknown with the error.
+func (a *App) CheckForImageUpdates() ([]ImageUpdate, error) {
+	containers, err := a.GetContainers()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), containerOperationTimeout)
+	defer cancel()
+
+	// Containers share images, so each image is checked once
+	var images []string
+	seen := make(map[string]bool)
+	for _, container := range containers {
+		if !seen[container.Image] {
+			seen[container.Image] = true
+			images = append(images, container.Image)
+		}
+	}
+	checks := make([]ImageUpdate, len(images))
+	runBounded(len(images), func(i int) error {
+		checks[i] = a.checkImage(ctx, images[i])
+		return nil
+	})
+	byImage := make(map[string]ImageUpdate, len(images))
+	for _, check := range checks {
+		byImage[check.Image] = check
+	}
+
+	updates := make([]ImageUpdate, 0, len(containers))
+	for _, container := range containers {
+		update := byImage[container.Image]
+		update.ContainerID, update.ContainerName = container.ID, container.Name
+		updates = append(updates, update)
+	}
+	return updates, nil
+}
+
+// checkImage compares the registry digest of image with the digests it was
+// pulled by
+func (a *App) checkImage(ctx context.Context, image string) ImageUpdate {
+	update := ImageUpdate{Image: image, Status: ImageUnknown}
+
+	local, err := a.localDigests(ctx, image)
+	if err != nil {
+		update.Error = err.Error()
+		return update
+	}
+	if len(local) == 0 {
+		update.Error = "image was not pulled from a registry"
+		return update
+	}
+	update.LocalDigest = local[0]
+
+	remote, err := a.remoteDigest(ctx, image)
+	if err != nil {
+		log.Warn().Err(err).Str("image", image).Msg("Failed to check registry for image updates")
+		update.Error = err.Error()
+		return update
+	}
+	update.RemoteDigest = remote
+
+	update.Status = ImageOutdated
+	for _, digest := range local {
+		if digest == remote {
+			update.LocalDigest, update.Status = digest, ImageUpToDate
+			break
+		}
+	}
+	return update
+}
+
+// localDigests returns the registry digests the local image was pulled by
+func (a *App) localDigests(ctx context.Context, image string) ([]string, error) {
+	output, err := a.dockerOutput(ctx, "image", "inspect", "--format", "{{json .RepoDigests}}", image)
+	if err != nil {
+		return nil, err
+	}
+	var repoDigests []string
+	if err := json.Unmarshal(output, &repoDigests); err != nil {
+		return nil, fmt.Errorf("failed to decode digests of %s: %w", image, err)
+	}
+
+	// Each is repository@sha256:...
+	digests := make([]string, 0, len(repoDigests))
+	for _, repoDigest := range repoDigests {
+		if _, digest, ok := strings.Cut(repoDigest, "@"); ok {
+			digests = append(digests, digest)
+		}
+	}
+	return digests, nil
+}
+
+// remoteDigest returns the registry's digest for the image's tag, which is
+// the manifest list digest for multi-platform images as in RepoDigests
+func (a *App) remoteDigest(ctx context.Context, image string) (string, error) {
+	output, err := a.dockerOutput(ctx, "buildx", "imagetools", "inspect", "--format", "{{json .Manifest}}", image)
+	if err != nil {
+		return "", err
+	}
+	var descriptor struct {
+		Digest string `json:"digest"`
+	}
+	if err := json.Unmarshal(output, &descriptor); err != nil || descriptor.Digest == "" {
+		return "", fmt.Errorf("failed to decode the registry manifest of %s", image)
+	}
+	return descriptor.Digest, nil
+}
+
+// PullLatestImages pulls the images CheckForImageUpdates finds outdated,
+// emitting ImagePullProgressEvent as layers download. Running containers keep
+// their image until they are recreated.
+func (a *App) PullLatestImages() (OperationReport, error) {
+	exec := a.executor("pull")
+	report := exec.report()
+	if err := a.requireWritable("PullLatestImages"); err != nil {
+		return report, err
+	}
+	updates, err := a.CheckForImageUpdates()
+	if err != nil {
+		return report, err
+	}
+
+	var outdated []string
+	seen := make(map[string]bool)
+	for _, update := range updates {
+		if seen[update.Image] {
+			continue
+		}
+		seen[update.Image] = true
+		if update.Status != ImageOutdated {
+			reason := update.Status
+			if update.Error != "" {
+				reason = update.Error
+			}
+			report.Skipped = append(report.Skipped, ContainerOutcome{Name: update.Image, Reason: reason})
+			continue
+		}
+		outdated = append(outdated, update.Image)
+	}
+
+	errs := runBounded(len(outdated), func(i int) error {
+		return exec.run("docker pull "+outdated[i], func() error { return a.pullImage(outdated[i]) })
+	})
+	for i, image := range outdated {
+		if errs[i] != nil {
+			report.Failed = append(report.Failed, ContainerOutcome{Name: image, Reason: errs[i].Error()})
+			continue
+		}
+		report.Succeeded = append(report.Succeeded, image)
+	}
+
+	exec.finish(&report)
+	logReport(report)
+	return report, nil
+}
+
+// pullImage pulls image, emitting its progress
+func (a *App) pullImage(image string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), imagePullTimeout)
+	defer cancel()
+
+	err := a.streamDocker(ctx, func(line string) {
+		a.emitEvent(ImagePullProgressEvent, parsePullProgress(image, line))
+	}, "pull", image)
+	if err != nil {
+		log.Error().Err(err).Str("image", image).Msg("Failed to pull image")
+		return err
+	}
+	log.Info().Str("image", image).Msg("Pulled image")
+	return nil
+}
+
+// parsePullProgress splits a docker pull line such as
+// "4f4fb700ef54: Download complete" into its layer and status
+func parsePullProgress(image, line string) ImagePullProgress {
+	progress := ImagePullProgress{Image: image, Status: line}
+	if layer, status, ok := strings.Cut(line, ": "); ok && isLayerID(layer) {
+		progress.Layer, progress.Status = layer, status
+	}
+	return progress
+}
+
+// isLayerID reports whether s is the short hex ID docker pull names layers by
+func isLayerID(s string) bool {
+	if len(s) != 12 {
+		return false
+	}
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// containerInspect is the part of docker container inspect RecreateWithLatest
+// carries over to the new container
+type containerInspect struct {
+	ID     string `json:"Id"`
+	Name   string `json:"Name"`
+	Image  string `json:"Image"`
+	Config struct {
+		Image  string            `json:"Image"`
+		Env    []string          `json:"Env"`
+		Labels map[string]string `json:"Labels"`
+		Cmd    []string          `json:"Cmd"`
+	} `json:"Config"`
+	HostConfig struct {
+		NetworkMode   string `json:"NetworkMode"`
+		RestartPolicy struct {
+			Name string `json:"Name"`
+		} `json:"RestartPolicy"`
+		PortBindings map[string][]struct {
+			HostIP   string `json:"HostIp"`
+			HostPort string `json:"HostPort"`
+		} `json:"PortBindings"`
+	} `json:"HostConfig"`
+	Mounts []struct {
+		Type        string `json:"Type"`
+		Name        string `json:"Name"`
+		Source      string `json:"Source"`
+		Destination string `json:"Destination"`
+		RW          bool   `json:"RW"`
+	} `json:"Mounts"`
+}
+
+// imageConfig is the image's own environment, labels and command, which the
+// recreated container gets from the new image instead
+type imageConfig struct {
+	Env    []string          `json:"Env"`
+	Labels map[string]string `json:"Labels"`
+	Cmd    []string          `json:"Cmd"`
+}
+
+// RecreateWithLatest pulls the latest image for a container's tag, then
+// stops, removes and recreates the container with the same name, mounts,
+// ports, network, restart policy, environment and labels. Settings the old
+// image supplied are left for the new image to supply.
+func (a *App) RecreateWithLatest(containerID string) error {
+	if err := a.requireWritable("RecreateWithLatest"); err != nil {
+		return err
+	}
+	if err := a.requireDocker(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), containerOperationTimeout)
+	defer cancel()
+
+	output, err := a.dockerOutput(ctx, "container", "inspect", "--format", "{{json .}}", containerID)
+	if err != nil {
+		return err
+	}
+	var container containerInspect
+	if err := json.Unmarshal(output, &container); err != nil {
+		return fmt.Errorf("failed to decode container %s: %w", containerID, err)
+	}
+	output, err = a.dockerOutput(ctx, "image", "inspect", "--format", "{{json .Config}}", container.Image)
+	if err != nil {
+		return err
+	}
+	var image imageConfig
+	if err := json.Unmarshal(output, &image); err != nil {
+		return fmt.Errorf("failed to decode image %s: %w", container.Config.Image, err)
+	}
+
+	if err := a.pullImage(container.Config.Image); err != nil {
+		return err
+	}
+
+	timeout := a.stopTimeoutSeconds()
+	stopCtx, stopCancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second+containerOperationTimeout)
+	defer stopCancel()
+	if err := a.runDocker(stopCtx, "stop", "--time", strconv.Itoa(timeout), container.ID); err != nil {
+		return err
+	}
+	if err := a.runDocker(ctx, "rm", container.ID); err != nil {
+		return err
+	}
+	if err := a.runDocker(ctx, recreateArgs(container, image)...); err != nil {
+		return fmt.Errorf("container %s was removed but could not be recreated: %w", strings.TrimPrefix(container.Name, "/"), err)
+	}
+
+	log.Info().Str("container", container.Name).Str("image", container.Config.Image).Msg("Recreated container with the latest image")
+	return nil
+}
+
+// recreateArgs returns the docker run command recreating container. Ports,
+// environment variables and labels are passed in sorted order.
+func recreateArgs(container containerInspect, image imageConfig) []string {
+	args := []string{"run", "--detach", "--name", strings.TrimPrefix(container.Name, "/")}
+
+	switch mode := container.HostConfig.NetworkMode; mode {
+	case "", "default", "bridge":
+	default:
+		args = append(args, "--network", mode)
+	}
+	if policy := container.HostConfig.RestartPolicy.Name; policy != "" && policy != "no" {
+		args = append(args, "--restart", policy)
+	}
+
+	ports := make([]string, 0, len(container.HostConfig.PortBindings))
+	for port, bindings := range container.HostConfig.PortBindings {
+		for _, binding := range bindings {
+			publish := binding.HostPort + ":" + port
+			if binding.HostIP != "" {
+				publish = binding.HostIP + ":" + publish
+			}
+			ports = append(ports, publish)
+		}
+	}
+	sort.Strings(ports)
+	for _, port := range ports {
+		args = append(args, "--publish", port)
+	}
+
+	for _, mount := range container.Mounts {
+		source := mount.Source
+		switch mount.Type {
+		case "volume":
+			source = mount.Name
+		case "bind":
+		default:
+			continue
+		}
+		volume := source + ":" + mount.Destination
+		if !mount.RW {
+			volume += ":ro"
+		}
+		args = append(args, "--volume", volume)
+	}
+
+	imageEnv := make(map[string]bool, len(image.Env))
+	for _, env := range image.Env {
+		imageEnv[env] = true
+	}
+	env := make([]string, 0, len(container.Config.Env))
+	for _, e := range container.Config.Env {
+		if !imageEnv[e] {
+			env = append(env, e)
+		}
+	}
+	sort.Strings(env)
+	for _, e := range env {
+		args = append(args, "--env", e)
+	}
+
+	labels := make([]string, 0, len(container.Config.Labels))
+	for key, value := range container.Config.Labels {
+		if imageValue, ok := image.Labels[key]; !ok || imageValue != value {
+			labels = append(labels, key+"="+value)
+		}
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		args = append(args, "--label", label)
+	}
+
+	args = append(args, container.Config.Image)
+	if !reflect.DeepEqual(container.Config.Cmd, image.Cmd) {
+		args = append(args, container.Config.Cmd...)
+	}
+	return args
+}
+
+// dockerOutput runs a docker CLI command and returns its output
+func (a *App) dockerOutput(ctx context.Context, args ...string) ([]byte, error) {
+	var output bytes.Buffer
+	err := a.streamDocker(ctx, func(line string) {
+		output.WriteString(line)
+		output.WriteByte('\n')
+	}, args...)
+	return output.Bytes(), err
+}
+
+// dockerStream runs a docker CLI command, calling onLine with each line it
+// writes to stdout, and returns its stderr in the error
+func (a *App) dockerStream(ctx context.Context, onLine func(string), args ...string) error {
+	var stderr bytes.Buffer
+	cmd := a.dockerCmd(ctx, args...)
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("docker %s: %w", args[0], err)
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		onLine(scanner.Text())
+	}
+	scanErr := scanner.Err()
+
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("docker %s: %s: %w", args[0], strings.TrimSpace(stderr.String()), err)
+	}
+	return scanErr
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDockerCLI answers docker commands from scripted output keyed by the
+// command line, and records the commands run
+type fakeDockerCLI struct {
+	mu       sync.Mutex
+	outputs  map[string]string
+	errs     map[string]error
+	commands []string
+}
+
+func (f *fakeDockerCLI) stream(ctx context.Context, onLine func(string), args ...string) error {
+	command := strings.Join(args, " ")
+	f.mu.Lock()
+	f.commands = append(f.commands, command)
+	f.mu.Unlock()
+
+	if err := f.errs[command]; err != nil {
+		return err
+	}
+	for _, line := range strings.Split(strings.TrimSpace(f.outputs[command]), "\n") {
+		onLine(line)
+	}
+	return nil
+}
+
+func (f *fakeDockerCLI) run(ctx context.Context, args ...string) error {
+	return f.stream(ctx, func(string) {}, args...)
+}
+
+// newImageUpdatesTestApp lists a scanner on a current image, two
+// orchestrators on an outdated image and a gateway whose registry is down
+func newImageUpdatesTestApp() (*App, *fakeDockerCLI) {
+	docker := &fakeDockerCLI{
+		outputs: map[string]string{
+			"image inspect --format {{json .RepoDigests}} ibkr/scanner:latest":                  `["ibkr/scanner@sha256:aaa"]`,
+			"buildx imagetools inspect --format {{json .Manifest}} ibkr/scanner:latest":         `{"mediaType":"application/vnd.oci.image.index.v1+json","digest":"sha256:aaa","size":1609}`,
+			"image inspect --format {{json .RepoDigests}} ibkr/orchestrator:latest":             `["ibkr/orchestrator@sha256:old"]`,
+			"buildx imagetools inspect --format {{json .Manifest}} ibkr/orchestrator:latest":    `{"digest":"sha256:new"}`,
+			"image inspect --format {{json .RepoDigests}} registry.internal/ibkr-trader:latest": `["registry.internal/ibkr-trader@sha256:ccc"]`,
+			"pull ibkr/orchestrator:latest":                                                     "latest: Pulling from ibkr/orchestrator\n4f4fb700ef54: Pulling fs layer\n4f4fb700ef54: Pull complete\nDigest: sha256:new",
+		},
+		errs: map[string]error{
+			"buildx imagetools inspect --format {{json .Manifest}} registry.internal/ibkr-trader:latest": errors.New("docker buildx: dial tcp: lookup registry.internal: no such host: exit status 1"),
+		},
+	}
+
+	app := NewApp()
+	app.backends.Docker.Available = true
+	app.streamDocker = docker.stream
+	app.runDocker = docker.run
+	app.listContainers = func(ctx context.Context) ([]ContainerInfo, error) {
+		return []ContainerInfo{
+			{ID: "g1", Name: "ibkr-trader-gateway", Image: "registry.internal/ibkr-trader:latest", State: ContainerRunning},
+			{ID: "o1", Name: "orchestrator-1", Image: "ibkr/orchestrator:latest", State: ContainerRunning},
+			{ID: "o2", Name: "orchestrator-2", Image: "ibkr/orchestrator:latest", State: ContainerRunning},
+			{ID: "s1", Name: "scanner", Image: "ibkr/scanner:latest", State: ContainerRunning},
+		}, nil
+	}
+	return app, docker
+}
+
+func TestCheckForImageUpdates(t *testing.T) {
+	app, docker := newImageUpdatesTestApp()
+
+	updates, err := app.CheckForImageUpdates()
+	if err != nil {
+		t.Fatalf("CheckForImageUpdates() error = %v", err)
+	}
+	status := make(map[string]ImageUpdate)
+	for _, update := range updates {
+		status[update.ContainerName] = update
+	}
+
+	if u := status["scanner"]; u.Status != ImageUpToDate || u.LocalDigest != "sha256:aaa" {
+		t.Errorf("scanner = %+v, want up to date", u)
+	}
+	for _, name := range []string{"orchestrator-1", "orchestrator-2"} {
+		if u := status[name]; u.Status != ImageOutdated || u.LocalDigest != "sha256:old" || u.RemoteDigest != "sha256:new" {
+			t.Errorf("%s = %+v, want outdated", name, u)
+		}
+	}
+	if u := status["ibkr-trader-gateway"]; u.Status != ImageUnknown || !strings.Contains(u.Error, "no such host") {
+		t.Errorf("gateway = %+v, want unknown with the registry error", u)
+	}
+
+	// The orchestrators' image is checked once
+	var registryChecks int
+	for _, command := range docker.commands {
+		if strings.HasPrefix(command, "buildx imagetools inspect") {
+			registryChecks++
+		}
+	}
+	if registryChecks != 3 {
+		t.Errorf("Registry checks = %d, want one per image", registryChecks)
+	}
+}
+
+func TestPullLatestImagesEmitsProgress(t *testing.T) {
+	app, docker := newImageUpdatesTestApp()
+	var mu sync.Mutex
+	var progress []ImagePullProgress
+	app.emit = func(name string, data ...interface{}) {
+		if name == ImagePullProgressEvent {
+			mu.Lock()
+			progress = append(progress, data[0].(ImagePullProgress))
+			mu.Unlock()
+		}
+	}
+
+	report, err := app.PullLatestImages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Succeeded) != 1 || report.Succeeded[0] != "ibkr/orchestrator:latest" || len(report.Skipped) != 2 || len(report.Failed) != 0 {
+		t.Errorf("Pull report = %+v", report)
+	}
+	for _, command := range docker.commands {
+		if strings.HasPrefix(command, "pull ") && command != "pull ibkr/orchestrator:latest" {
+			t.Errorf("Pulled %q, want only the outdated image", command)
+		}
+	}
+
+	if len(progress) != 4 {
+		t.Fatalf("Progress = %+v, want one event per line", progress)
+	}
+	if p := progress[2]; p.Image != "ibkr/orchestrator:latest" || p.Layer != "4f4fb700ef54" || p.Status != "Pull complete" {
+		t.Errorf("Layer progress = %+v", p)
+	}
+	if p := progress[3]; p.Layer != "" || p.Status != "Digest: sha256:new" {
+		t.Errorf("Final progress = %+v", p)
+	}
+}
+
+func TestRecreateWithLatestPreservesSettings(t *testing.T) {
+	app, docker := newImageUpdatesTestApp()
+	docker.outputs["container inspect --format {{json .}} o1"] = `{
+		"Id": "o1", "Name": "/orchestrator-1", "Image": "sha256:oldimage",
+		"Config": {
+			"Image": "ibkr/orchestrator:latest",
+			"Env": ["PATH=/usr/local/bin:/usr/bin", "TRADING_MODE=paper"],
+			"Labels": {"com.docker.compose.project": "ibkr-trader", "org.opencontainers.image.version": "1.2"},
+			"Cmd": ["python", "-m", "orchestrator"]
+		},
+		"HostConfig": {
+			"NetworkMode": "ibkr-trader",
+			"RestartPolicy": {"Name": "unless-stopped"},
+			"PortBindings": {"8080/tcp": [{"HostIp": "", "HostPort": "8080"}]}
+		},
+		"Mounts": [
+			{"Type": "bind", "Source": "/srv/trader/config", "Destination": "/app/config", "RW": false},
+			{"Type": "volume", "Name": "orchestrator-data", "Source": "/var/lib/docker/volumes/orchestrator-data/_data", "Destination": "/app/data", "RW": true}
+		]
+	}`
+	docker.outputs["image inspect --format {{json .Config}} sha256:oldimage"] = `{
+		"Env": ["PATH=/usr/local/bin:/usr/bin"],
+		"Labels": {"org.opencontainers.image.version": "1.2"},
+		"Cmd": ["python", "-m", "orchestrator"]
+	}`
+
+	if err := app.RecreateWithLatest("o1"); err != nil {
+		t.Fatalf("RecreateWithLatest() error = %v", err)
+	}
+
+	want := []string{
+		"pull ibkr/orchestrator:latest",
+		"stop --time 30 o1",
+		"rm o1",
+		"run --detach --name orchestrator-1 --network ibkr-trader --restart unless-stopped --publish 8080:8080/tcp" +
+			" --volume /srv/trader/config:/app/config:ro --volume orchestrator-data:/app/data" +
+			" --env TRADING_MODE=paper --label com.docker.compose.project=ibkr-trader ibkr/orchestrator:latest",
+	}
+	got := docker.commands[2:]
+	if len(got) != len(want) {
+		t.Fatalf("Ran %q", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Command %d = %q\nwant %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestRecreateWithLatestKeepsContainerWhenPullFails(t *testing.T) {
+	app, docker := newImageUpdatesTestApp()
+	docker.outputs["container inspect --format {{json .}} o1"] = `{"Id": "o1", "Name": "/orchestrator-1", "Image": "sha256:oldimage", "Config": {"Image": "ibkr/orchestrator:latest"}}`
+	docker.outputs["image inspect --format {{json .Config}} sha256:oldimage"] = `{}`
+	docker.errs["pull ibkr/orchestrator:latest"] = errors.New("docker pull: unauthorized: exit status 1")
+
+	if err := app.RecreateWithLatest("o1"); err == nil {
+		t.Fatal("Expected the pull error")
+	}
+	for _, command := range docker.commands {
+		if strings.HasPrefix(command, "stop ") || strings.HasPrefix(command, "rm ") {
+			t.Errorf("Ran %q after the pull failed", command)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"path/filepath"
+
+	"github.com/rs/zerolog/log"
+	wailsruntime "github.com/wailsapp/wails/v2/pkg/runtime"
+
+	"traderadmin/internal/instance"
+)
+
+// Buttons of the dialog shown by a second instance
+const (
+	focusRunningButton = "Focus TraderAdmin"
+	exitButton         = "Exit"
+)
+
+// controlCommand returns the command given by -control on the command line.
+// Other flags are left alone, as Wails development builds parse their own.
+func controlCommand(args []string) string {
+	flags := flag.NewFlagSet("traderadmin", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	control := flags.String("control", "", "")
+	flags.Parse(args)
+	return *control
+}
+
+// configDir is the directory of config.toml, which also holds the
+// single-instance lock
+func (a *App) configDir() string {
+	return filepath.Dir(a.configPath)
+}
+
+// acquireInstanceLock makes this the only TraderAdmin using the configuration
+// directory, since two instances would both write config.toml and signal the
+// containers. It reports false when another instance is already running.
+func (a *App) acquireInstanceLock() bool {
+	lock, err := instance.Acquire(a.configDir(), a.controlCommands())
+	switch {
+	case err == nil:
+		a.instanceLock = lock
+	case errors.Is(err, instance.ErrAlreadyRunning):
+		log.Warn().Err(err).Msg("TraderAdmin is already running")
+		return false
+	default:
+		log.Warn().Err(err).Msg("Failed to take the single-instance lock, continuing without it")
+	}
+	return true
+}
+
+// controlCommands are the commands the control socket accepts from later
+// instances and scripts
+func (a *App) controlCommands() map[string]func() error {
+	return map[string]func() error{
+		instance.CommandFocus: func() error {
+			if a.ctx == nil {
+				return errors.New("window not ready")
+			}
+			wailsruntime.WindowUnminimise(a.ctx)
+			wailsruntime.WindowShow(a.ctx)
+			return nil
+		},
+		instance.CommandReloadConfig: a.LoadConfig,
+	}
+}
+
+// offerRunningInstance asks whether to bring the running instance to the
+// front, then quits
+func (a *App) offerRunningInstance() {
+	defer wailsruntime.Quit(a.ctx)
+
+	choice, err := wailsruntime.MessageDialog(a.ctx, wailsruntime.MessageDialogOptions{
+		Type:          wailsruntime.QuestionDialog,
+		Title:         "TraderAdmin is already running",
+		Message:       "Another TraderAdmin is using " + a.configDir() + ". Running two at once would corrupt config.toml.",
+		Buttons:       []string{focusRunningButton, exitButton},
+		DefaultButton: focusRunningButton,
+		CancelButton:  exitButton,
+	})
+	if err != nil || choice != focusRunningButton {
+		return
+	}
+	if err := instance.Send(a.configDir(), instance.CommandFocus); err != nil {
+		log.Error().Err(err).Msg("Failed to focus the running TraderAdmin")
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"traderadmin/internal/instance"
+)
+
+func TestSecondAppDefersToRunningInstance(t *testing.T) {
+	template, err := os.ReadFile(filepath.Join("config", "config.template.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.toml")
+	if err := os.WriteFile(configPath, template, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	first := NewApp()
+	first.configPath = configPath
+	if !first.acquireInstanceLock() {
+		t.Fatal("The first instance did not get the lock")
+	}
+	defer first.instanceLock.Release()
+
+	second := NewApp()
+	second.configPath = configPath
+	if second.acquireInstanceLock() || second.instanceLock != nil {
+		t.Fatal("A second instance got the lock")
+	}
+
+	// Scripts reload the running instance's configuration
+	if err := instance.Send(dir, instance.CommandReloadConfig); err != nil {
+		t.Fatalf("reload-config error = %v", err)
+	}
+	if !first.IsConfigLoaded() {
+		t.Error("reload-config did not load the configuration")
+	}
+}
+
+func TestControlCommand(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, ""},
+		{[]string{"-control", "reload-config"}, "reload-config"},
+		{[]string{"--control=focus"}, "focus"},
+		{[]string{"-assetdir", "frontend"}, ""},
+	}
+	for _, tt := range tests {
+		if got := controlCommand(tt.args); got != tt.want {
+			t.Errorf("controlCommand(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package instance
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Commands understood by the control socket besides those given to Acquire
+const (
+	// CommandFocus brings the running instance's window to the front
+	CommandFocus = "focus"
+	// CommandReloadConfig reloads config.toml
+	CommandReloadConfig = "reload-config"
+
+	commandPing = "ping"
+)
+
+// controlTimeout bounds one command exchange
+const controlTimeout = 2 * time.Second
+
+// controlServer answers the commands of later instances and scripts. A
+// request is one line, the lock's token and the command; the reply is "ok" or
+// "error: " and the reason.
+type controlServer struct {
+	listener net.Listener
+	token    string
+	commands map[string]func() error
+	wg       sync.WaitGroup
+}
+
+// listenControl starts serving commands on a loopback port
+func listenControl(token string, commands map[string]func() error) (*controlServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("listen for control commands: %w", err)
+	}
+	s := &controlServer{listener: listener, token: token, commands: commands}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+func (s *controlServer) address() string {
+	return s.listener.Addr().String()
+}
+
+// close stops accepting commands and waits for those in progress
+func (s *controlServer) close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *controlServer) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+// handle answers one command
+func (s *controlServer) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(controlTimeout))
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return
+	}
+	token, command, _ := strings.Cut(strings.TrimSpace(line), " ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+		fmt.Fprintln(conn, "error: invalid token")
+		return
+	}
+	if command == commandPing {
+		fmt.Fprintln(conn, "ok")
+		return
+	}
+	run, ok := s.commands[command]
+	if !ok {
+		fmt.Fprintf(conn, "error: unknown command %q\n", command)
+		return
+	}
+	if err := run(); err != nil {
+		fmt.Fprintf(conn, "error: %v\n", err)
+		return
+	}
+	fmt.Fprintln(conn, "ok")
+}
+
+// Send sends command to the instance holding the lock in dir
+func Send(dir, command string) error {
+	owner, err := ReadOwner(dir)
+	if err != nil {
+		return err
+	}
+	return send(owner, command)
+}
+
+// send sends command to owner's control socket and returns the error it
+// replies with
+func send(owner Owner, command string) error {
+	if !loopback(owner.Address) {
+		return fmt.Errorf("control socket %s is not on this machine", owner.Address)
+	}
+	conn, err := net.DialTimeout("tcp", owner.Address, controlTimeout)
+	if err != nil {
+		return fmt.Errorf("TraderAdmin (pid %d) is not answering: %w", owner.PID, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(controlTimeout))
+
+	if _, err := fmt.Fprintf(conn, "%s %s\n", owner.Token, command); err != nil {
+		return err
+	}
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("TraderAdmin (pid %d) did not reply: %w", owner.PID, err)
+	}
+	reply = strings.TrimSpace(reply)
+	if reply == "ok" {
+		return nil
+	}
+	return errors.New(strings.TrimPrefix(reply, "error: "))
+}
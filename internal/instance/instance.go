@@ -0,0 +1,192 @@
+// Package instance keeps a single TraderAdmin running per configuration
+// directory. The running instance holds a lock file naming its process and a
+// localhost control socket, through which later instances and scripts send it
+// commands such as "focus" and "reload-config".
+package instance
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// LockFile is the name of the lock file in the configuration directory
+const LockFile = "traderadmin.lock"
+
+// ErrAlreadyRunning is returned by Acquire when a live instance holds the lock
+var ErrAlreadyRunning = errors.New("another TraderAdmin instance is running")
+
+// reclaimAttempts bounds how often Acquire retries after reclaiming a stale
+// lock that another starting instance then took
+const reclaimAttempts = 3
+
+// Owner is the content of the lock file
+type Owner struct {
+	PID       int       `json:"pid"`
+	Address   string    `json:"address"` // of the control socket
+	Token     string    `json:"token"`   // authenticates control commands
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// Lock is the single-instance lock held by the running instance
+type Lock struct {
+	path    string
+	content []byte
+	control *controlServer
+}
+
+// Acquire takes the lock in dir and starts serving the control commands.
+// It fails with ErrAlreadyRunning when a live instance holds the lock. The
+// lock of an instance that crashed, whose process is gone or whose control
+// socket no longer answers, is reclaimed.
+func Acquire(dir string, commands map[string]func() error) (*Lock, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	control, err := listenControl(hex.EncodeToString(token), commands)
+	if err != nil {
+		return nil, err
+	}
+	owner := Owner{PID: os.Getpid(), Address: control.address(), Token: control.token, StartedAt: time.Now().UTC()}
+	content, err := json.Marshal(owner)
+	if err != nil {
+		control.close()
+		return nil, err
+	}
+
+	lock, err := link(filepath.Join(dir, LockFile), content)
+	if err != nil {
+		control.close()
+		return nil, err
+	}
+	lock.control = control
+	return lock, nil
+}
+
+// link creates the lock file with content, reclaiming a stale one. The file is
+// written aside and hard-linked into place, which fails when the lock exists,
+// so other instances never read a partly written lock.
+func link(path string, content []byte) (*Lock, error) {
+	temp := path + "." + strconv.Itoa(os.Getpid()) + ".tmp"
+	if err := os.WriteFile(temp, content, 0600); err != nil {
+		return nil, err
+	}
+	defer os.Remove(temp)
+
+	for attempt := 0; attempt < reclaimAttempts; attempt++ {
+		err := os.Link(temp, path)
+		if err == nil {
+			return &Lock{path: path, content: content}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("create lock file: %w", err)
+		}
+
+		held, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue // released meanwhile
+			}
+			return nil, err
+		}
+		if owner, ok := parseOwner(held); ok && owner.alive() {
+			return nil, fmt.Errorf("%w (pid %d)", ErrAlreadyRunning, owner.PID)
+		}
+		if err := reclaim(path, held); err != nil {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("%w: the lock at %s keeps changing hands", ErrAlreadyRunning, path)
+}
+
+// reclaim removes the lock file if it still holds stale. The lock is moved
+// aside first; if another instance reclaimed it and took the lock in the
+// meantime, its fresh lock is put back.
+func reclaim(path string, stale []byte) error {
+	aside := path + "." + strconv.Itoa(os.Getpid()) + ".stale"
+	if err := os.Rename(path, aside); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("reclaim stale lock: %w", err)
+	}
+	defer os.Remove(aside)
+
+	moved, err := os.ReadFile(aside)
+	if err == nil && !bytes.Equal(moved, stale) {
+		// Restoring fails only when yet another instance holds the lock now,
+		// which the next attempt finds
+		os.Link(aside, path)
+	}
+	return nil
+}
+
+// Release stops the control socket and removes the lock file, unless another
+// instance has reclaimed it
+func (l *Lock) Release() error {
+	if l.control != nil {
+		l.control.close()
+	}
+	held, err := os.ReadFile(l.path)
+	if err != nil || !bytes.Equal(held, l.content) {
+		return nil
+	}
+	return os.Remove(l.path)
+}
+
+// ReadOwner returns the owner of the lock in dir
+func ReadOwner(dir string) (Owner, error) {
+	content, err := os.ReadFile(filepath.Join(dir, LockFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Owner{}, errors.New("no TraderAdmin instance is running")
+		}
+		return Owner{}, err
+	}
+	owner, ok := parseOwner(content)
+	if !ok {
+		return Owner{}, fmt.Errorf("unreadable lock file %s", filepath.Join(dir, LockFile))
+	}
+	return owner, nil
+}
+
+// parseOwner decodes a lock file
+func parseOwner(content []byte) (Owner, bool) {
+	var owner Owner
+	if err := json.Unmarshal(content, &owner); err != nil || owner.PID <= 0 || owner.Address == "" {
+		return Owner{}, false
+	}
+	return owner, true
+}
+
+// alive reports whether the owner's process exists and answers on its control
+// socket; the socket also tells a live owner from a process that reused its PID
+func (o Owner) alive() bool {
+	if !processAlive(o.PID) {
+		return false
+	}
+	return send(o, commandPing) == nil
+}
+
+// loopback reports whether address is a loopback address, which is all
+// the control socket listens on
+func loopback(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
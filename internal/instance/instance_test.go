@@ -0,0 +1,114 @@
+package instance
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSecondInstanceIsRefused(t *testing.T) {
+	dir := t.TempDir()
+	reloads := 0
+	first, err := Acquire(dir, map[string]func() error{
+		CommandReloadConfig: func() error { reloads++; return nil },
+		CommandFocus:        func() error { return errors.New("no window") },
+	})
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+
+	if _, err := Acquire(dir, nil); !errors.Is(err, ErrAlreadyRunning) {
+		t.Fatalf("Second Acquire() error = %v, want ErrAlreadyRunning", err)
+	}
+
+	// The refused instance and scripts reach the first one
+	if err := Send(dir, CommandReloadConfig); err != nil || reloads != 1 {
+		t.Errorf("Send(reload-config) = %v after %d reloads, want one reload", err, reloads)
+	}
+	if err := Send(dir, CommandFocus); err == nil || err.Error() != "no window" {
+		t.Errorf("Send(focus) error = %v, want the command's error", err)
+	}
+	if err := Send(dir, "shutdown"); err == nil {
+		t.Error("Send() of an unknown command should fail")
+	}
+	owner, _ := ReadOwner(dir)
+	owner.Token = "guess"
+	if err := send(owner, CommandReloadConfig); err == nil || reloads != 1 {
+		t.Errorf("send() with a wrong token = %v, want it refused", err)
+	}
+
+	if err := first.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, LockFile)); !os.IsNotExist(err) {
+		t.Errorf("Lock file left after Release: %v", err)
+	}
+	second, err := Acquire(dir, nil)
+	if err != nil {
+		t.Fatalf("Acquire() after Release error = %v", err)
+	}
+	second.Release()
+}
+
+func TestStaleLockIsReclaimed(t *testing.T) {
+	// A process that has exited
+	exited := exec.Command(os.Args[0], "-test.run=^$")
+	if err := exited.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A port nothing listens on
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddress := listener.Addr().String()
+	listener.Close()
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"crashed process", lockContent(t, exited.Process.Pid, closedAddress)},
+		{"reused pid", lockContent(t, os.Getpid(), closedAddress)},
+		{"truncated file", `{"pid": 12`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, LockFile)
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			lock, err := Acquire(dir, nil)
+			if err != nil {
+				t.Fatalf("Acquire() over a stale lock error = %v", err)
+			}
+			defer lock.Release()
+
+			owner, err := ReadOwner(dir)
+			if err != nil || owner.PID != os.Getpid() || owner.Address == closedAddress {
+				t.Errorf("Lock owner = %+v, %v; want this process", owner, err)
+			}
+			if leftovers, _ := filepath.Glob(path + ".*"); len(leftovers) != 0 {
+				t.Errorf("Reclaiming left %v behind", leftovers)
+			}
+		})
+	}
+}
+
+// lockContent returns a lock file naming pid and address
+func lockContent(t *testing.T, pid int, address string) string {
+	t.Helper()
+	content, err := json.Marshal(Owner{PID: pid, Address: address, Token: "stale", StartedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
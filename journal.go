@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"traderadmin/backend/journal"
+)
+
+// RecordTrade adds an executed spread to the trade journal
+func (a *App) RecordTrade(trade journal.TradeRecord) (journal.TradeRecord, error) {
+	if a.journal == nil {
+		return journal.TradeRecord{}, fmt.Errorf("trade journal not initialized")
+	}
+	return a.journal.RecordTrade(trade)
+}
+
+// UpdateTradeOutcome closes a journaled trade at the given exit price and time
+func (a *App) UpdateTradeOutcome(id int64, exitPrice float64, exitTime time.Time) (journal.TradeRecord, error) {
+	if a.journal == nil {
+		return journal.TradeRecord{}, fmt.Errorf("trade journal not initialized")
+	}
+	return a.journal.UpdateTradeOutcome(id, exitPrice, exitTime)
+}
+
+// GetTradeHistory returns journaled trades filtered by symbol, strategy, date range and outcome
+func (a *App) GetTradeHistory(filter journal.TradeFilter) ([]journal.TradeRecord, error) {
+	if a.journal == nil {
+		return nil, fmt.Errorf("trade journal not initialized")
+	}
+	return a.journal.GetTrades(filter), nil
+}
+
+// ExportTradeHistory writes journaled trades entered between from and to to path
+// as CSV or JSON and returns the number of rows exported
+func (a *App) ExportTradeHistory(format, path string, from, to time.Time) (int, error) {
+	if a.journal == nil {
+		return 0, fmt.Errorf("trade journal not initialized")
+	}
+
+	trades := a.journal.GetTrades(journal.TradeFilter{From: from, To: to})
+	count, err := journal.ExportTrades(trades, format, path)
+	if err != nil {
+		return 0, err
+	}
+
+	log.Info().Int("rows", count).Str("path", path).Msg("Exported trade history")
+	return count, nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"embed"
+	"fmt"
 	"os"
 
 	"github.com/rs/zerolog"
@@ -9,6 +10,8 @@ import (
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
 	"github.com/wailsapp/wails/v2/pkg/options/assetserver"
+
+	"traderadmin/internal/instance"
 )
 
 //go:embed all:frontend/dist
@@ -24,6 +27,21 @@ func main() {
 	// Create an instance of the app structure
 	app := NewApp()
 
+	// "-control reload-config" and the like drive the running instance
+	if control := controlCommand(os.Args[1:]); control != "" {
+		if err := instance.Send(app.configDir(), control); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// A second instance stays hidden and only offers to focus the first
+	app.secondInstance = !app.acquireInstanceLock()
+
+	// A viewer binds only the ReadService, so it is decided before binding
+	app.viewer = app.configuredViewerMode()
+
 	// Create application with options
 	err := wails.Run(&options.App{
 		Title:  "TraderAdmin",
@@ -33,11 +51,10 @@ func main() {
 			Assets: assets,
 		},
 		BackgroundColour: &options.RGBA{R: 27, G: 38, B: 54, A: 1},
+		StartHidden:      app.secondInstance,
 		OnStartup:        app.startup,
 		OnShutdown:       app.shutdown,
-		Bind: []interface{}{
-			app,
-		},
+		Bind:             app.boundServices(),
 	})
 
 	if err != nil {
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/trustdan/ibkr-trader/go/pkg/calendar"
+)
+
+// marketCalendar returns the exchange calendar of [market_calendar], reloading
+// it when the section has changed. A calendar that fails to load is logged
+// and the embedded one used in its place.
+func (a *App) marketCalendar() *calendar.MarketCalendar {
+	settings := a.config.MarketCalendar
+	key := settings.Timezone + "\x00" + settings.OverrideFile
+
+	a.calendarMu.Lock()
+	defer a.calendarMu.Unlock()
+	if a.calendar != nil && a.calendarKey == key {
+		return a.calendar
+	}
+	market, err := calendar.NewMarketCalendar(settings.OverrideFile, settings.Timezone)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to load the market calendar, using the NYSE's")
+		market = calendar.DefaultMarketCalendar()
+	}
+	a.calendar, a.calendarKey = market, key
+	return market
+}
+
+// tradingHoursStatus reports whether now lies within the [schedule] hours of
+// an exchange trading day, and otherwise why not, as in "Market closed:
+// Independence Day". The hours are read in the exchange's timezone and end
+// no later than an early close.
+func (a *App) tradingHoursStatus(now time.Time) (bool, string) {
+	market := a.marketCalendar()
+	day := market.Day(now)
+	switch {
+	case day.Holiday != "":
+		return false, "Market closed: " + day.Holiday
+	case day.Weekend && !a.config.Schedule.WeekendTrading:
+		return false, "Market closed: weekend"
+	}
+
+	// An unset or unparsable clock keeps the exchange's own
+	local := now.In(market.Location())
+	at := func(clock string, fallback time.Time) time.Time {
+		t, err := time.Parse("15:04", clock)
+		if err != nil {
+			return fallback
+		}
+		return time.Date(local.Year(), local.Month(), local.Day(), t.Hour(), t.Minute(), 0, 0, market.Location())
+	}
+	start := at(a.config.Schedule.TradingStartTime, day.Open)
+	end := at(a.config.Schedule.TradingEndTime, day.Close)
+	if day.EarlyClose != "" && end.After(day.Close) {
+		end = day.Close
+	}
+
+	switch {
+	case now.Before(start):
+		return false, "Outside trading hours: starts at " + start.Format("15:04")
+	case !now.Before(end) && day.EarlyClose != "" && end.Equal(day.Close):
+		return false, "Market closed early: " + day.EarlyClose
+	case !now.Before(end):
+		return false, "Outside trading hours: ended at " + end.Format("15:04")
+	}
+	return true, ""
+}
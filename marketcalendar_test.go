@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTradingHoursStatus(t *testing.T) {
+	app := NewApp()
+	app.config.Schedule.TradingStartTime = "09:45"
+	app.config.Schedule.TradingEndTime = "15:30"
+
+	eastern, _ := time.LoadLocation("America/New_York")
+	tests := []struct {
+		name       string
+		now        time.Time
+		want       bool
+		wantReason string
+	}{
+		{"Within the hours", time.Date(2024, 7, 2, 10, 0, 0, 0, eastern), true, ""},
+		{"Before the start", time.Date(2024, 7, 2, 9, 40, 0, 0, eastern), false, "Outside trading hours: starts at 09:45"},
+		{"At the end", time.Date(2024, 7, 2, 15, 30, 0, 0, eastern), false, "Outside trading hours: ended at 15:30"},
+		{"Holiday", time.Date(2024, 7, 4, 11, 0, 0, 0, eastern), false, "Market closed: Independence Day"},
+		{"Weekend", time.Date(2024, 7, 6, 11, 0, 0, 0, eastern), false, "Market closed: weekend"},
+		{"Before an early close", time.Date(2024, 7, 3, 12, 59, 0, 0, eastern), true, ""},
+		{"After an early close", time.Date(2024, 7, 3, 13, 0, 0, 0, eastern), false, "Market closed early: Independence Day eve"},
+		// The hours are Eastern whatever the zone of the clock; 14:00 UTC is
+		// 10:00 in summer and 09:00 in winter
+		{"Summer in UTC", time.Date(2024, 7, 2, 14, 0, 0, 0, time.UTC), true, ""},
+		{"Winter in UTC", time.Date(2024, 1, 2, 14, 0, 0, 0, time.UTC), false, "Outside trading hours: starts at 09:45"},
+		{"Day after spring forward", time.Date(2024, 3, 11, 13, 50, 0, 0, time.UTC), true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := app.tradingHoursStatus(tt.now)
+			if got != tt.want || reason != tt.wantReason {
+				t.Errorf("tradingHoursStatus(%v) = %v, %q; want %v, %q", tt.now, got, reason, tt.want, tt.wantReason)
+			}
+		})
+	}
+
+	app.config.Schedule.WeekendTrading = true
+	if open, reason := app.tradingHoursStatus(time.Date(2024, 7, 6, 11, 0, 0, 0, eastern)); !open {
+		t.Errorf("tradingHoursStatus() on a Saturday with weekend trading = %v, %q", open, reason)
+	}
+	if open, _ := app.tradingHoursStatus(time.Date(2024, 12, 25, 11, 0, 0, 0, eastern)); open {
+		t.Error("Weekend trading should not open the market on a holiday")
+	}
+}
+
+func TestMarketCalendarConfig(t *testing.T) {
+	app := NewApp()
+	file := filepath.Join(t.TempDir(), "calendar.json")
+	os.WriteFile(file, []byte(`{"holidays": {"2024-07-02": "Exchange outage"}}`), 0o644)
+	app.config.MarketCalendar.OverrideFile = file
+
+	eastern, _ := time.LoadLocation("America/New_York")
+	if _, reason := app.tradingHoursStatus(time.Date(2024, 7, 2, 11, 0, 0, 0, eastern)); reason != "Market closed: Exchange outage" {
+		t.Errorf("tradingHoursStatus() reason = %q, want the override's holiday", reason)
+	}
+
+	// A broken override falls back to the embedded calendar
+	app.config.MarketCalendar.OverrideFile = filepath.Join(t.TempDir(), "missing.json")
+	if open, reason := app.tradingHoursStatus(time.Date(2024, 7, 2, 11, 0, 0, 0, eastern)); !open {
+		t.Errorf("tradingHoursStatus() = %v, %q; want the embedded calendar", open, reason)
+	}
+
+	config := validConfig()
+	config.MarketCalendar.Timezone = "Eastern"
+	config.MarketCalendar.OverrideFile = app.config.MarketCalendar.OverrideFile
+	errs := NewApp().ValidateConfig(config)
+	if len(errs) != 2 || errs[0].Field != "MarketCalendar.Timezone" || errs[1].Field != "MarketCalendar.OverrideFile" {
+		t.Errorf("ValidateConfig() = %v, want the timezone and override file rejected", errs)
+	}
+}
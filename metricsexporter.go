@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+
+	"traderadmin/backend/models"
+	"traderadmin/backend/notifications"
+)
+
+// defaultMetricsAddress is served when [metrics] is enabled without a
+// listen_address; it only accepts local scrapes
+const defaultMetricsAddress = "127.0.0.1:9464"
+
+// Alert rules of [alerts_config.thresholds], the rule label of
+// traderadmin_alerts_fired_total, AlertEmergencyStop counting the emergency
+// stops the drawdown triggered, AlertExitTarget and AlertExitStop the
+// trades the exit manager found past their target or stop, AlertWatchlist
+// the signals of watchlist symbols and AlertShortLegDelta the open trades
+// whose short leg delta passed max_short_leg_delta
+const (
+	AlertOrderLatency      = "order_latency"
+	AlertDailyRealizedPnL  = "daily_realized_pnl"
+	AlertPortfolioDrawdown = "portfolio_drawdown"
+	AlertAPIErrors         = "api_errors"
+	AlertEmergencyStop     = "emergency_stop"
+	AlertExitTarget        = "exit_target"
+	AlertExitStop          = "exit_stop"
+	AlertWatchlist         = "watchlist"
+	AlertShortLegDelta     = "short_leg_delta"
+)
+
+// metricsExporter keeps Prometheus gauges of the numbers the frontend shows,
+// updated on each refresh of the status collector, and counts the alerts
+// fired and the API errors
+type metricsExporter struct {
+	equity        prometheus.Gauge
+	buyingPower   prometheus.Gauge
+	unrealizedPnL prometheus.Gauge
+	realizedPnL   prometheus.Gauge
+	openPositions prometheus.Gauge
+	positionPnL   *prometheus.GaugeVec
+	ibkrConnected prometheus.Gauge
+	alertsFired   *prometheus.CounterVec
+	apiErrors     *prometheus.CounterVec
+
+	mu sync.Mutex
+	// symbols are those with a position gauge, removed once closed
+	symbols map[string]bool
+	// breached are the alert rules breached at the last update; an alert
+	// fires when its rule becomes breached
+	breached map[string]bool
+	// dayOpen is the first equity seen on day, the base of the drawdown
+	day     string
+	dayOpen float64
+}
+
+// newMetricsExporter returns an exporter with its metrics registered with
+// registerer
+func newMetricsExporter(registerer prometheus.Registerer) *metricsExporter {
+	gauge := func(name, help string) prometheus.Gauge {
+		return prometheus.NewGauge(prometheus.GaugeOpts{Name: name, Help: help})
+	}
+	e := &metricsExporter{
+		equity:        gauge("traderadmin_portfolio_equity", "Net liquidation value of the active account."),
+		buyingPower:   gauge("traderadmin_portfolio_buying_power", "Buying power of the active account."),
+		unrealizedPnL: gauge("traderadmin_portfolio_unrealized_pnl", "Unrealized P&L of the open positions."),
+		realizedPnL:   gauge("traderadmin_portfolio_realized_pnl_today", "P&L realized today."),
+		openPositions: gauge("traderadmin_open_positions", "Number of open positions."),
+		positionPnL: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "traderadmin_position_unrealized_pnl",
+			Help: "Unrealized P&L of the open positions in a symbol.",
+		}, []string{"symbol"}),
+		ibkrConnected: gauge("traderadmin_ibkr_connected", "Whether both connections to TWS/Gateway are up (1) or not (0)."),
+		alertsFired: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "traderadmin_alerts_fired_total",
+			Help: "Alerts fired, by the threshold rule breached.",
+		}, []string{"rule"}),
+		apiErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "traderadmin_api_errors_total",
+			Help: "Errors of the connections to TWS/Gateway.",
+		}, []string{"connection"}),
+		symbols:  make(map[string]bool),
+		breached: make(map[string]bool),
+	}
+	registerer.MustRegister(e.equity, e.buyingPower, e.unrealizedPnL, e.realizedPnL, e.openPositions,
+		e.positionPnL, e.ibkrConnected, e.alertsFired, e.apiErrors)
+	return e
+}
+
+// update sets the gauges from a refresh of the status collector and fires
+// the alerts whose rule the metrics newly breach, which it returns
+func (e *metricsExporter) update(config Configuration, status StatusInfo, metrics models.AllMetrics) []string {
+	portfolio := metrics.Portfolio
+	e.equity.Set(portfolio.Equity)
+	e.buyingPower.Set(portfolio.BuyingPower)
+	e.unrealizedPnL.Set(portfolio.UnrealizedPNL)
+	e.realizedPnL.Set(portfolio.RealizedPNLToday)
+	e.openPositions.Set(float64(len(metrics.OpenPositions)))
+	if status.IBKR.Connected {
+		e.ibkrConnected.Set(1)
+	} else {
+		e.ibkrConnected.Set(0)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	bySymbol := make(map[string]float64, len(metrics.OpenPositions))
+	for _, position := range metrics.OpenPositions {
+		bySymbol[position.Symbol] += position.UnrealizedPL
+	}
+	for symbol := range e.symbols {
+		if _, open := bySymbol[symbol]; !open {
+			e.positionPnL.DeleteLabelValues(symbol)
+			delete(e.symbols, symbol)
+		}
+	}
+	for symbol, pnl := range bySymbol {
+		e.positionPnL.WithLabelValues(symbol).Set(pnl)
+		e.symbols[symbol] = true
+	}
+
+	if day := portfolio.Timestamp.Format(time.DateOnly); day != e.day && portfolio.Equity > 0 {
+		e.day, e.dayOpen = day, portfolio.Equity
+	}
+	if !config.AlertsConfig.Enabled {
+		e.breached = make(map[string]bool)
+		return nil
+	}
+	var fired []string
+	for rule, breached := range e.alertRules(config, metrics) {
+		if breached && !e.breached[rule] {
+			e.fired(rule)
+			fired = append(fired, rule)
+		}
+		e.breached[rule] = breached
+	}
+	sort.Strings(fired)
+	return fired
+}
+
+// alertRules reports which threshold rules the metrics breach. A threshold
+// of zero is not checked, except the minimum realized P&L.
+func (e *metricsExporter) alertRules(config Configuration, metrics models.AllMetrics) map[string]bool {
+	thresholds := config.AlertsConfig.Thresholds
+	rules := map[string]bool{
+		AlertOrderLatency:     thresholds.MaxOrderLatencyMs > 0 && metrics.System.AvgOrderLatencyMs > thresholds.MaxOrderLatencyMs,
+		AlertDailyRealizedPnL: metrics.Portfolio.RealizedPNLToday < thresholds.MinDailyRealizedPnl,
+		AlertAPIErrors:        thresholds.MaxApiErrorsPerHour > 0 && metrics.System.ApiErrorCount > thresholds.MaxApiErrorsPerHour,
+	}
+	if e.dayOpen > 0 && thresholds.MaxPortfolioDrawdownPercentageToday > 0 {
+		drawdown := (e.dayOpen - metrics.Portfolio.Equity) / e.dayOpen * 100
+		rules[AlertPortfolioDrawdown] = drawdown > thresholds.MaxPortfolioDrawdownPercentageToday
+	}
+	return rules
+}
+
+// drawdown returns the percentage equity is below the day's first equity,
+// and false before an equity has been seen that day
+func (e *metricsExporter) drawdown(equity float64) (float64, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.dayOpen <= 0 {
+		return 0, false
+	}
+	return (e.dayOpen - equity) / e.dayOpen * 100, true
+}
+
+// fired counts an alert of rule
+func (e *metricsExporter) fired(rule string) {
+	e.alertsFired.WithLabelValues(rule).Inc()
+	log.Warn().Str("rule", rule).Msg("Alert fired")
+}
+
+// exportMetrics updates the Prometheus metrics from a refresh of the status
+// collector, notifies the threshold alerts it fired and triggers an
+// emergency stop when the drawdown calls for one
+func (a *App) exportMetrics(status StatusInfo, metrics models.AllMetrics) {
+	for _, rule := range a.exporter.update(a.config, status, metrics) {
+		a.notify(notifications.SeverityWarning, notifications.CategoryAlert, thresholdAlertMessage(rule, a.config, metrics), map[string]string{"rule": rule})
+	}
+	if drawdown, ok := a.exporter.drawdown(metrics.Portfolio.Equity); ok {
+		a.triggerEmergencyStop(drawdown)
+	}
+}
+
+// apiError counts an error of the named connection to TWS/Gateway
+func (e *metricsExporter) apiError(connection string) {
+	e.apiErrors.WithLabelValues(connection).Inc()
+}
+
+// metricsAddress returns the address [metrics] is served on
+func (a *App) metricsAddress() string {
+	if address := a.config.Metrics.ListenAddress; address != "" {
+		return address
+	}
+	return defaultMetricsAddress
+}
+
+// serveMetrics serves /metrics on the [metrics] address until ctx is done,
+// when it is enabled. A changed address takes effect on restart.
+func (a *App) serveMetrics(ctx context.Context) {
+	if !a.config.Metrics.Enabled {
+		return
+	}
+	address := a.metricsAddress()
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(a.metrics, promhttp.HandlerOpts{}))
+	server := &http.Server{Addr: address, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	log.Info().Str("address", address).Msg("Serving Prometheus metrics")
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Error().Err(err).Str("address", address).Msg("Failed to serve Prometheus metrics")
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"traderadmin/backend/models"
+)
+
+// serveTestMetrics serves the app's metrics on a free local port until the
+// test ends and returns the scrape URL
+func serveTestMetrics(t *testing.T, app *App) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	app.config.Metrics.Enabled = true
+	app.config.Metrics.ListenAddress = address
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		app.serveMetrics(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Error("Metrics server did not stop with its context")
+		}
+	})
+	return "http://" + address + "/metrics"
+}
+
+// scrape returns the lines of the exposition at url, retrying until the
+// server is up
+func scrape(t *testing.T, url string) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := http.Get(url)
+		if err == nil {
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			return strings.Split(string(body), "\n")
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Scraping %s: %v", url, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// sample returns the value of the sample named series, such as
+// name{label="value"}, and whether it is exposed
+func sample(lines []string, series string) (string, bool) {
+	for _, line := range lines {
+		if value, ok := strings.CutPrefix(line, series+" "); ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+func TestMetricsExporterFollowsStatusCollector(t *testing.T) {
+	app := NewApp()
+	app.config.AlertsConfig.Enabled = true
+	app.config.AlertsConfig.Thresholds.MinDailyRealizedPnl = -500
+	app.config.AlertsConfig.Thresholds.MaxPortfolioDrawdownPercentageToday = 5
+	url := serveTestMetrics(t, app)
+
+	now := time.Now()
+	metrics := models.AllMetrics{
+		Portfolio: models.PortfolioMetrics{Timestamp: now, Equity: 100000, BuyingPower: 40000, UnrealizedPNL: 150, RealizedPNLToday: -200},
+		OpenPositions: []models.Position{
+			{Symbol: "SPY", UnrealizedPL: 100},
+			{Symbol: "SPY", UnrealizedPL: -25},
+			{Symbol: "QQQ", UnrealizedPL: 75},
+		},
+	}
+	app.collector.emit = func(string, ...interface{}) {}
+	app.collector.collectStatus = func() StatusInfo {
+		var status StatusInfo
+		status.IBKR.Connected = true
+		return status
+	}
+	app.collector.collectMetrics = func(StatusInfo) models.AllMetrics { return metrics }
+	app.collector.refresh()
+
+	lines := scrape(t, url)
+	for series, want := range map[string]string{
+		"traderadmin_portfolio_equity":                      "100000",
+		"traderadmin_portfolio_buying_power":                "40000",
+		"traderadmin_portfolio_unrealized_pnl":              "150",
+		"traderadmin_portfolio_realized_pnl_today":          "-200",
+		"traderadmin_open_positions":                        "3",
+		`traderadmin_position_unrealized_pnl{symbol="SPY"}`: "75",
+		`traderadmin_position_unrealized_pnl{symbol="QQQ"}`: "75",
+		"traderadmin_ibkr_connected":                        "1",
+	} {
+		if got, ok := sample(lines, series); got != want {
+			t.Errorf("%s = %q (exposed %v), want %s", series, got, ok, want)
+		}
+	}
+	if _, ok := sample(lines, `traderadmin_alerts_fired_total{rule="daily_realized_pnl"}`); ok {
+		t.Error("Alert fired within the thresholds")
+	}
+
+	// Closing QQQ drops its gauge; the losses breach two rules, which fire
+	// once for as long as they stay breached
+	metrics.Portfolio.Equity = 94000
+	metrics.Portfolio.RealizedPNLToday = -600
+	metrics.OpenPositions = metrics.OpenPositions[:2]
+	app.collector.collectStatus = func() StatusInfo { return StatusInfo{} }
+	app.collector.refresh()
+	app.collector.refresh()
+	app.exporter.apiError("trading")
+
+	lines = scrape(t, url)
+	if _, ok := sample(lines, `traderadmin_position_unrealized_pnl{symbol="QQQ"}`); ok {
+		t.Error("Closed QQQ position still exposed")
+	}
+	for series, want := range map[string]string{
+		"traderadmin_open_positions":                                "2",
+		"traderadmin_ibkr_connected":                                "0",
+		`traderadmin_alerts_fired_total{rule="daily_realized_pnl"}`: "1",
+		`traderadmin_alerts_fired_total{rule="portfolio_drawdown"}`: "1",
+		`traderadmin_api_errors_total{connection="trading"}`:        "1",
+	} {
+		if got, ok := sample(lines, series); got != want {
+			t.Errorf("%s = %q (exposed %v), want %s", series, got, ok, want)
+		}
+	}
+}
+
+func TestServeMetricsDisabled(t *testing.T) {
+	app := NewApp()
+	done := make(chan struct{})
+	go func() {
+		app.serveMetrics(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("serveMetrics served with [metrics] disabled")
+	}
+	if address := app.metricsAddress(); address != "127.0.0.1:9464" {
+		t.Errorf("metricsAddress() = %q, want localhost by default", address)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"traderadmin/backend/ibkr"
+	"traderadmin/backend/models"
+	"traderadmin/backend/notifications"
+)
+
+// NotificationAddedEvent is emitted with each notifications.NotificationEvent
+// recorded in the notification center
+const NotificationAddedEvent = "notification"
+
+// GetNotifications returns the notification center's events after since, or
+// all of them when it is zero, at severityFilter or above ("info",
+// "warning" or "critical"; empty for all), newest first and at most limit
+// of them when limit is above zero
+func (a *App) GetNotifications(since time.Time, severityFilter string, limit int) ([]notifications.NotificationEvent, error) {
+	if a.notifications == nil {
+		return nil, fmt.Errorf("notification center not initialized")
+	}
+	return a.notifications.List(since, severityFilter, limit)
+}
+
+// MarkNotificationsRead marks the events of ids read, or all of them when ids
+// is empty, and returns how many were unread
+func (a *App) MarkNotificationsRead(ids []int64) (int, error) {
+	if a.notifications == nil {
+		return 0, fmt.Errorf("notification center not initialized")
+	}
+	return a.notifications.MarkRead(ids)
+}
+
+// GetUnreadNotificationCount returns the number of unread events, the
+// count on the notification bell
+func (a *App) GetUnreadNotificationCount() int {
+	if a.notifications == nil {
+		return 0
+	}
+	return a.notifications.Unread()
+}
+
+// notificationRetention returns the [notification_center] bounds
+func (c Configuration) notificationRetention() notifications.Retention {
+	return notifications.Retention{
+		MaxEvents: c.NotificationCenter.MaxEvents,
+		MaxAge:    time.Duration(c.NotificationCenter.MaxAgeDays) * 24 * time.Hour,
+	}
+}
+
+// notify records an event in the notification center and pushes it to the
+// frontend. Before the center is open, or when writing the event fails, it
+// is only logged.
+func (a *App) notify(severity, category, message string, payload interface{}) {
+	if a.notifications == nil {
+		return
+	}
+	event, err := a.notifications.Append(notifications.NotificationEvent{Severity: severity, Category: category, Message: message, Payload: payload})
+	if err != nil {
+		log.Warn().Err(err).Str("category", category).Msg("Notification not persisted")
+	}
+	a.emitEvent(NotificationAddedEvent, event)
+}
+
+// raiseAlert counts an alert of rule and records it in the notification
+// center, whatever channels the alert is also sent through
+func (a *App) raiseAlert(rule, severity, message string, payload interface{}) {
+	a.exporter.fired(rule)
+	a.notify(severity, notifications.CategoryAlert, message, payload)
+}
+
+// thresholdAlertMessage describes the breach of a threshold rule
+func thresholdAlertMessage(rule string, config Configuration, metrics models.AllMetrics) string {
+	thresholds := config.AlertsConfig.Thresholds
+	switch rule {
+	case AlertOrderLatency:
+		return fmt.Sprintf("Order latency of %.0f ms is above %.0f ms", metrics.System.AvgOrderLatencyMs, thresholds.MaxOrderLatencyMs)
+	case AlertDailyRealizedPnL:
+		return fmt.Sprintf("Realized P&L today of %.2f is below %.2f", metrics.Portfolio.RealizedPNLToday, thresholds.MinDailyRealizedPnl)
+	case AlertPortfolioDrawdown:
+		return fmt.Sprintf("Portfolio drawdown today is above %.2f%%", thresholds.MaxPortfolioDrawdownPercentageToday)
+	case AlertAPIErrors:
+		return fmt.Sprintf("%d API errors, above %d per hour", metrics.System.ApiErrorCount, thresholds.MaxApiErrorsPerHour)
+	}
+	return "Alert " + rule + " fired"
+}
+
+// notifyOperation records a finished operation report: a warning when any
+// of it failed
+func (a *App) notifyOperation(report OperationReport) {
+	severity := notifications.SeverityInfo
+	if len(report.Failed) > 0 {
+		severity = notifications.SeverityWarning
+	}
+	message := fmt.Sprintf("%s: %d succeeded, %d skipped, %d failed", report.Operation, len(report.Succeeded), len(report.Skipped), len(report.Failed))
+	if report.DryRun {
+		message = fmt.Sprintf("Dry run of %s: %d would run", report.Operation, len(report.Would))
+	}
+	a.notify(severity, notifications.CategoryOperation, message, report)
+}
+
+// notifyConfigWarnings records the warnings of a loaded config file that the
+// previous one did not have, so a reload does not repeat them
+func (a *App) notifyConfigWarnings(previous, warnings []ConfigWarning) {
+	known := make(map[string]bool, len(previous))
+	for _, warning := range previous {
+		known[warning.Key] = true
+	}
+	for _, warning := range warnings {
+		if !known[warning.Key] {
+			a.notify(notifications.SeverityWarning, notifications.CategoryConfig, warning.Message, warning)
+		}
+	}
+}
+
+// observeRefresh exports the metrics of each refresh of the status collector
+// and records the trading hours starting and ending
+func (a *App) observeRefresh(status StatusInfo, metrics models.AllMetrics) {
+	a.exportMetrics(status, metrics)
+
+	a.scheduleMu.Lock()
+	previous := a.tradingHours
+	a.tradingHours = &status.IsTradingHours
+	a.scheduleMu.Unlock()
+	if previous == nil || *previous == status.IsTradingHours {
+		return
+	}
+	if status.IsTradingHours {
+		a.notify(notifications.SeverityInfo, notifications.CategorySchedule, "Trading hours started", nil)
+	} else {
+		a.notify(notifications.SeverityInfo, notifications.CategorySchedule, "Trading hours ended: "+status.MarketStatus, nil)
+	}
+}
+
+// notifyIBKRConnection records a connection to TWS/Gateway coming up, or
+// going down after it was up; connected tracks which are up. The retries of
+// a connection that is down are not recorded.
+func (a *App) notifyIBKRConnection(status ibkr.ConnectionStatus, connected map[string]bool) {
+	switch {
+	case status.State == ibkr.StateConnected && !connected[status.Name]:
+		connected[status.Name] = true
+		a.notify(notifications.SeverityInfo, notifications.CategoryConnection, fmt.Sprintf("IBKR %s connection up", status.Name), status)
+	case status.State == ibkr.StateDisconnected && connected[status.Name]:
+		connected[status.Name] = false
+		message := fmt.Sprintf("IBKR %s connection lost", status.Name)
+		if status.LastError != "" {
+			message += ": " + strings.TrimSpace(status.LastError)
+		}
+		a.notify(notifications.SeverityWarning, notifications.CategoryConnection, message, status)
+	}
+}
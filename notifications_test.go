@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"traderadmin/backend/ibkr"
+	"traderadmin/backend/models"
+	"traderadmin/backend/notifications"
+	"traderadmin/backend/watchlist"
+)
+
+// notifyingApp returns an app with a notification center in a temporary
+// directory and the events it emits to the frontend
+func notifyingApp(t *testing.T) (*App, *[]notifications.NotificationEvent) {
+	t.Helper()
+	app := NewApp()
+	var err error
+	if app.notifications, err = notifications.Open(t.TempDir(), notifications.Retention{}); err != nil {
+		t.Fatal(err)
+	}
+	var events []notifications.NotificationEvent
+	app.emit = func(name string, data ...interface{}) {
+		if name == NotificationAddedEvent {
+			events = append(events, data[0].(notifications.NotificationEvent))
+		}
+	}
+	return app, &events
+}
+
+func TestWatchlistAlertsReachTheNotificationCenter(t *testing.T) {
+	app, events := notifyingApp(t)
+	serveScanner(t, app, &signallingScanner{})
+	var err error
+	if app.watchlists, err = watchlist.Open(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	// Neither email nor Slack is enabled
+	if err := app.AddWatchlist(watchlist.Watchlist{Name: "tech", Symbols: []string{"AAPL"}, Channel: watchlist.ChannelInApp}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := app.checkWatchlists(context.Background(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if len(*events) != 1 || (*events)[0].Category != notifications.CategoryAlert {
+		t.Fatalf("Events = %+v, want the AAPL alert", *events)
+	}
+	stored, err := app.GetNotifications(time.Time{}, "", 0)
+	if err != nil || len(stored) != 1 || stored[0].ID != (*events)[0].ID {
+		t.Fatalf("GetNotifications() = %+v, %v; want the alert emitted", stored, err)
+	}
+	if alert, ok := stored[0].Payload.(watchlist.Alert); !ok || alert.Signal.Symbol != "AAPL" {
+		t.Errorf("Payload = %+v, want the alert", stored[0].Payload)
+	}
+
+	if marked, err := app.MarkNotificationsRead([]int64{stored[0].ID}); err != nil || marked != 1 || app.GetUnreadNotificationCount() != 0 {
+		t.Errorf("MarkNotificationsRead() = %d, %v with %d unread", marked, err, app.GetUnreadNotificationCount())
+	}
+}
+
+func TestNotificationsOfStateChanges(t *testing.T) {
+	app, events := notifyingApp(t)
+
+	// Config warnings are notified once
+	warning := ConfigWarning{Key: "general.log_levl", Message: "Unknown setting general.log_levl"}
+	app.setConfigWarnings([]ConfigWarning{warning})
+	app.setConfigWarnings([]ConfigWarning{warning})
+
+	// The trading hours are notified when they start and end, not at the
+	// first refresh
+	for _, trading := range []bool{false, false, true, true, false} {
+		app.observeRefresh(StatusInfo{IsTradingHours: trading, MarketStatus: "Market closed"}, models.AllMetrics{})
+	}
+
+	// A connection is notified when it comes up and when it goes down, not
+	// while it retries
+	connected := make(map[string]bool)
+	for _, state := range []ibkr.ConnectionState{ibkr.StateConnecting, ibkr.StateDisconnected, ibkr.StateConnected, ibkr.StateDisconnected, ibkr.StateDisconnected} {
+		app.notifyIBKRConnection(ibkr.ConnectionStatus{Name: "trading", State: state}, connected)
+	}
+
+	// Operations are notified as they finish
+	exec := app.executor("restart")
+	report := exec.report()
+	report.Failed = append(report.Failed, ContainerOutcome{Name: "scanner", Reason: "timeout"})
+	exec.finish(&report)
+
+	want := []struct{ category, severity string }{
+		{notifications.CategoryConfig, notifications.SeverityWarning},
+		{notifications.CategorySchedule, notifications.SeverityInfo},
+		{notifications.CategorySchedule, notifications.SeverityInfo},
+		{notifications.CategoryConnection, notifications.SeverityInfo},
+		{notifications.CategoryConnection, notifications.SeverityWarning},
+		{notifications.CategoryOperation, notifications.SeverityWarning},
+	}
+	if len(*events) != len(want) {
+		t.Fatalf("Events = %+v, want %d", *events, len(want))
+	}
+	for i, event := range *events {
+		if event.Category != want[i].category || event.Severity != want[i].severity {
+			t.Errorf("Event %d = %s %s %q, want %s %s", i, event.Severity, event.Category, event.Message, want[i].severity, want[i].category)
+		}
+	}
+	if warnings, _ := app.GetNotifications(time.Time{}, notifications.SeverityWarning, 0); len(warnings) != 3 {
+		t.Errorf("Warnings = %d, want 3", len(warnings))
+	}
+}
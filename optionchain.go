@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"traderadmin/backend/ibkr"
+	"traderadmin/backend/options"
+)
+
+// Option chain defaults for settings missing from the configuration
+const (
+	defaultStrikeBandPct   = 15.0
+	defaultMarketDataLines = 90
+	defaultMaxDTE          = 90
+)
+
+// optionChainCache keeps fetched chains by symbol
+type optionChainCache struct {
+	mu     sync.Mutex
+	chains map[string]ibkr.OptionChain
+}
+
+// get returns the chain of symbol if it was fetched after since
+func (c *optionChainCache) get(symbol string, since time.Time) (ibkr.OptionChain, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	chain, ok := c.chains[symbol]
+	if !ok || chain.FetchedAt.Before(since) {
+		return ibkr.OptionChain{}, false
+	}
+	return chain, true
+}
+
+// put stores a fetched chain
+func (c *optionChainCache) put(chain ibkr.OptionChain) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.chains == nil {
+		c.chains = make(map[string]ibkr.OptionChain)
+	}
+	c.chains[chain.Symbol] = chain
+}
+
+// fetchedBefore returns the symbols of the chains fetched before before,
+// sorted. A zero before returns them all.
+func (c *optionChainCache) fetchedBefore(before time.Time) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var symbols []string
+	for symbol, chain := range c.chains {
+		if before.IsZero() || chain.FetchedAt.Before(before) {
+			symbols = append(symbols, symbol)
+		}
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// drop removes the chains of symbols
+func (c *optionChainCache) drop(symbols []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, symbol := range symbols {
+		delete(c.chains, symbol)
+	}
+}
+
+// symbols returns the symbols of the cached chains, sorted
+func (c *optionChainCache) symbols() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	symbols := make([]string, 0, len(c.chains))
+	for symbol := range c.chains {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// FetchOptionChain returns the options of symbol within the configured strike
+// band around the underlying price and with MinDTE to MaxDTE days to expiry.
+// Chains are reused for OptionChain.CacheExpiryMinutes. A fetched chain's at
+// the money implied volatility is recorded as the symbol's IV for the day.
+func (a *App) FetchOptionChain(symbol string) (ibkr.OptionChain, error) {
+	symbol = strings.ToUpper(strings.TrimSpace(symbol))
+	now := time.Now()
+
+	settings := a.config.OptionChain
+	expiry := time.Duration(settings.CacheExpiryMinutes) * time.Minute
+	if expiry > 0 {
+		if chain, ok := a.optionChains.get(symbol, now.Add(-expiry)); ok {
+			return chain, nil
+		}
+	}
+
+	if a.marketData == nil {
+		return ibkr.OptionChain{}, ibkr.ErrNotConnected
+	}
+
+	req := ibkr.ChainRequest{
+		Symbol:        symbol,
+		StrikeBandPct: settings.StrikeBandPercentage,
+		MinDTE:        a.config.TradeTiming.MinDTE,
+		MaxDTE:        a.config.TradeTiming.MaxDTE,
+		Lines:         settings.MarketDataLines,
+		MaxContracts:  settings.MaxContracts,
+		Now:           now,
+	}
+	if req.StrikeBandPct <= 0 {
+		req.StrikeBandPct = defaultStrikeBandPct
+	}
+	if req.Lines <= 0 {
+		req.Lines = defaultMarketDataLines
+	}
+	if req.MaxDTE <= 0 {
+		req.MaxDTE = defaultMaxDTE
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	chain, err := ibkr.FetchOptionChain(ctx, a.marketData, req)
+	if err != nil {
+		return ibkr.OptionChain{}, err
+	}
+	if chain.Truncated {
+		log.Warn().
+			Str("symbol", symbol).
+			Int("max_contracts", req.MaxContracts).
+			Msg("Option chain truncated, narrow the strike band or DTE range to see all of it")
+	}
+
+	// Each fetch records the day's at the money volatility, the history IV
+	// rank is measured against. A failed write only costs the observation.
+	if a.ivHistory != nil {
+		if iv := atTheMoneyIV(chain); iv > 0 {
+			if err := a.ivHistory.Record(symbol, now, iv); err != nil {
+				log.Warn().Err(err).Str("symbol", symbol).Msg("Failed to record the implied volatility of the option chain")
+			}
+		}
+	}
+
+	a.optionChains.put(chain)
+	return chain, nil
+}
+
+// GetOptionChainFiltered returns a page of the contracts of symbol's chain
+// that pass filter, with the number of matches and the contracts each filter
+// rejected. Pages come from the cached chain, so a page token stays valid
+// until the chain is fetched again.
+func (a *App) GetOptionChainFiltered(symbol string, filter options.ChainFilter) (options.ChainPage, error) {
+	chain, err := a.FetchOptionChain(symbol)
+	if err != nil {
+		return options.ChainPage{}, err
+	}
+	return options.FilterChain(chain, filter)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"traderadmin/backend/ibkr"
+	"traderadmin/backend/options"
+)
+
+// fakeMarketData is a scripted IBKR responder with one strike and one
+// expiration a month out
+type fakeMarketData struct {
+	snapshots int
+}
+
+func (f *fakeMarketData) UnderlyingPrice(ctx context.Context, symbol string) (float64, error) {
+	return 100, nil
+}
+
+func (f *fakeMarketData) OptionParams(ctx context.Context, symbol string) ([]ibkr.OptionParams, error) {
+	expiry := time.Now().AddDate(0, 0, 30).Format("20060102")
+	return []ibkr.OptionParams{{Exchange: "SMART", Expirations: []string{expiry}, Strikes: []float64{100}}}, nil
+}
+
+func (f *fakeMarketData) OptionSnapshots(ctx context.Context, symbol string, options []ibkr.OptionKey) ([]ibkr.OptionQuote, error) {
+	f.snapshots++
+	quotes := make([]ibkr.OptionQuote, len(options))
+	for i, key := range options {
+		quotes[i] = ibkr.OptionQuote{OptionKey: key, Bid: 2, Ask: 2.2}
+	}
+	return quotes, nil
+}
+
+func TestFetchOptionChainCachesChains(t *testing.T) {
+	app := NewApp()
+	client := &fakeMarketData{}
+	app.marketData = client
+	app.config.TradeTiming.MinDTE = 7
+	app.config.TradeTiming.MaxDTE = 45
+	app.config.OptionChain.CacheExpiryMinutes = 5
+
+	chain, err := app.FetchOptionChain("spy")
+	if err != nil {
+		t.Fatalf("FetchOptionChain() error = %v", err)
+	}
+	if len(chain.Contracts) != 2 {
+		t.Fatalf("Contracts = %d, want a call and a put", len(chain.Contracts))
+	}
+
+	if _, err := app.FetchOptionChain("SPY"); err != nil {
+		t.Fatal(err)
+	}
+	if client.snapshots != 1 {
+		t.Errorf("Snapshot requests = %d, want the second fetch cached", client.snapshots)
+	}
+
+	// Without a cache every fetch goes to IBKR
+	app.config.OptionChain.CacheExpiryMinutes = 0
+	if _, err := app.FetchOptionChain("SPY"); err != nil {
+		t.Fatal(err)
+	}
+	if client.snapshots != 2 {
+		t.Errorf("Snapshot requests = %d, want 2", client.snapshots)
+	}
+}
+
+func TestFetchOptionChainDisconnected(t *testing.T) {
+	app := NewApp()
+	if _, err := app.FetchOptionChain("SPY"); !errors.Is(err, ibkr.ErrNotConnected) {
+		t.Errorf("FetchOptionChain() error = %v, want ErrNotConnected", err)
+	}
+}
+
+func TestGetOptionChainFilteredPagesTheCachedChain(t *testing.T) {
+	app := NewApp()
+	client := &fakeMarketData{}
+	app.marketData = client
+	app.config.TradeTiming.MaxDTE = 45
+	app.config.OptionChain.CacheExpiryMinutes = 5
+
+	filter := options.ChainFilter{PageSize: 1}
+	first, err := app.GetOptionChainFiltered("spy", filter)
+	if err != nil {
+		t.Fatalf("GetOptionChainFiltered() error = %v", err)
+	}
+	if first.Total != 2 || len(first.Contracts) != 1 || first.Contracts[0].Right != "C" || first.NextPageToken == "" {
+		t.Fatalf("First page = %+v, want the call of 2 contracts", first)
+	}
+
+	filter.PageToken = first.NextPageToken
+	second, err := app.GetOptionChainFiltered("SPY", filter)
+	if err != nil || len(second.Contracts) != 1 || second.Contracts[0].Right != "P" || second.NextPageToken != "" {
+		t.Fatalf("Second page = %+v, %v; want the put", second, err)
+	}
+	if client.snapshots != 1 {
+		t.Errorf("Snapshot requests = %d, want the pages served from the cached chain", client.snapshots)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"traderadmin/backend/orchestrator"
+)
+
+// orchestratorCallTimeout bounds one call of the orchestrator's control
+// service
+const orchestratorCallTimeout = 10 * time.Second
+
+// orchestratorStatusTimeout bounds the status probe of each status refresh
+const orchestratorStatusTimeout = 2 * time.Second
+
+// OrchestratorStatus is the state the orchestrator reports over its control
+// service, with Reachable false and Error set when it could not be asked
+type OrchestratorStatus struct {
+	orchestrator.Status
+	Reachable bool   `json:"reachable"`
+	Error     string `json:"error,omitempty"`
+}
+
+// orchestratorClient returns the client of the [orchestrator] address,
+// replacing the connection when the address has changed, or nil when no
+// address is configured
+func (a *App) orchestratorClient() (*orchestrator.Client, error) {
+	address := a.config.Orchestrator.Address
+
+	a.orchestratorMu.Lock()
+	defer a.orchestratorMu.Unlock()
+	if a.orchestrator != nil && a.orchestratorAddr == address {
+		return a.orchestrator, nil
+	}
+	if a.orchestrator != nil {
+		a.orchestrator.Close()
+		a.orchestrator, a.orchestratorAddr = nil, ""
+	}
+	if address == "" {
+		return nil, nil
+	}
+	client, err := a.dialOrchestrator(address)
+	if err != nil {
+		return nil, err
+	}
+	a.orchestrator, a.orchestratorAddr = client, address
+	return client, nil
+}
+
+// controlOrchestrator runs call on the orchestrator's control service through
+// exec, which what describes. It reports whether the RPC path was taken: not
+// without an [orchestrator] address or when the orchestrator is unreachable,
+// and the caller then falls back to its containers or deployments.
+func (a *App) controlOrchestrator(exec *commandExecutor, what string, call func(context.Context, *orchestrator.Client) error) (bool, error) {
+	client, err := a.orchestratorClient()
+	if client == nil {
+		if err != nil {
+			log.Warn().Err(err).Str("operation", exec.operation).Msg("Orchestrator unreachable, falling back")
+		}
+		return false, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), orchestratorCallTimeout)
+	defer cancel()
+	err = exec.run(what, func() error { return call(ctx, client) })
+	if errors.Is(err, orchestrator.ErrUnreachable) {
+		log.Warn().Err(err).Str("operation", exec.operation).Msg("Orchestrator unreachable, falling back")
+		return false, nil
+	}
+	return true, err
+}
+
+// orchestratorOperation runs a stack operation as call on the orchestrator's
+// control service, reporting it under the name "orchestrator". handled is
+// false when the RPC path is not taken and the operation should be applied
+// to the containers instead.
+func (a *App) orchestratorOperation(name, method, what string, call func(context.Context, *orchestrator.Client) error) (report OperationReport, handled bool, err error) {
+	if a.config.Orchestrator.Address == "" {
+		return report, false, nil
+	}
+	if err := a.requireWritable(method); err != nil {
+		return newOperationReport(name), true, err
+	}
+
+	exec := a.executor(name)
+	report = exec.report()
+	handled, err = a.controlOrchestrator(exec, what, call)
+	if !handled {
+		return report, false, nil
+	}
+	if err != nil {
+		log.Error().Err(err).Str("operation", name).Msg("Orchestrator operation failed")
+		report.Failed = append(report.Failed, ContainerOutcome{Name: "orchestrator", Reason: err.Error()})
+	} else {
+		report.Succeeded = append(report.Succeeded, "orchestrator")
+	}
+	exec.finish(&report)
+	logReport(report)
+	return report, true, nil
+}
+
+// pauseOrchestrator, resumeOrchestrator and reloadOrchestrator are the
+// control calls of the stack operations
+func pauseOrchestrator(reason string) func(context.Context, *orchestrator.Client) error {
+	return func(ctx context.Context, client *orchestrator.Client) error {
+		_, err := client.PauseTrading(ctx, reason)
+		return err
+	}
+}
+
+func resumeOrchestrator(ctx context.Context, client *orchestrator.Client) error {
+	_, err := client.ResumeTrading(ctx)
+	return err
+}
+
+func reloadOrchestrator(ctx context.Context, client *orchestrator.Client) error {
+	_, err := client.ReloadConfig(ctx)
+	return err
+}
+
+// orchestratorStatus asks the orchestrator for its state, or returns nil
+// without an [orchestrator] address
+func (a *App) orchestratorStatus() *OrchestratorStatus {
+	client, err := a.orchestratorClient()
+	if client == nil && err == nil {
+		return nil
+	}
+	if err != nil {
+		return &OrchestratorStatus{Error: err.Error()}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), orchestratorStatusTimeout)
+	defer cancel()
+	status, err := client.Status(ctx)
+	if err != nil {
+		return &OrchestratorStatus{Error: err.Error()}
+	}
+	return &OrchestratorStatus{Status: status, Reachable: true}
+}
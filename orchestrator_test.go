@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+
+	orchestratorpb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+
+	"traderadmin/backend/orchestrator"
+)
+
+// fakeOrchestrator records the control calls it serves. With pausing set,
+// PauseTrading waits until it is closed.
+type fakeOrchestrator struct {
+	orchestratorpb.UnimplementedOrchestratorControlServer
+	mu      sync.Mutex
+	calls   []string
+	active  bool
+	pausing chan struct{}
+}
+
+func (f *fakeOrchestrator) record(call string, active bool) (*orchestratorpb.OrchestratorStatus, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, call)
+	f.active = active
+	return &orchestratorpb.OrchestratorStatus{TradingActive: active, OpenPositions: 2, LastError: "order 12 rejected"}, nil
+}
+
+func (f *fakeOrchestrator) PauseTrading(context.Context, *orchestratorpb.PauseTradingRequest) (*orchestratorpb.OrchestratorStatus, error) {
+	if f.pausing != nil {
+		<-f.pausing
+	}
+	return f.record("pause", false)
+}
+
+func (f *fakeOrchestrator) ResumeTrading(context.Context, *orchestratorpb.ResumeTradingRequest) (*orchestratorpb.OrchestratorStatus, error) {
+	return f.record("resume", true)
+}
+
+func (f *fakeOrchestrator) ReloadConfig(context.Context, *orchestratorpb.ReloadConfigRequest) (*orchestratorpb.OrchestratorStatus, error) {
+	return f.record("reload", f.active)
+}
+
+func (f *fakeOrchestrator) GetOrchestratorStatus(context.Context, *orchestratorpb.OrchestratorStatusRequest) (*orchestratorpb.OrchestratorStatus, error) {
+	return &orchestratorpb.OrchestratorStatus{TradingActive: f.active, OpenPositions: 2, LastError: "order 12 rejected"}, nil
+}
+
+// serveOrchestrator makes app dial fake over bufconn at a configured address
+// and returns the listener
+func serveOrchestrator(t *testing.T, app *App, fake *fakeOrchestrator) *bufconn.Listener {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	orchestratorpb.RegisterOrchestratorControlServer(server, fake)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	app.config.Orchestrator.Address = "orchestrator:50052"
+	app.dialOrchestrator = func(string) (*orchestrator.Client, error) {
+		return orchestrator.Dial("passthrough:///bufnet", grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}))
+	}
+	t.Cleanup(func() {
+		if app.orchestrator != nil {
+			app.orchestrator.Close()
+		}
+	})
+	return listener
+}
+
+func TestStackOperationsPreferOrchestrator(t *testing.T) {
+	docker := &fakeDocker{}
+	app := newStackOperationsTestApp(docker)
+	fake := &fakeOrchestrator{active: true}
+	serveOrchestrator(t, app, fake)
+
+	report, err := app.PauseStack()
+	if err != nil || len(report.Succeeded) != 1 || report.Succeeded[0] != "orchestrator" {
+		t.Errorf("PauseStack() = %+v, %v; want the orchestrator paused", report, err)
+	}
+	if report, err := app.UnpauseStack(); err != nil || len(report.Succeeded) != 1 {
+		t.Errorf("UnpauseStack() = %+v, %v", report, err)
+	}
+	if strings.Join(fake.calls, ",") != "pause,resume" {
+		t.Errorf("Orchestrator calls = %v, want pause,resume", fake.calls)
+	}
+	if len(docker.commands) != 0 {
+		t.Errorf("Docker commands %v run with the orchestrator reachable", docker.commands)
+	}
+
+	status := app.collectStatus()
+	if status.Orchestrator == nil || !status.Orchestrator.Reachable || status.Orchestrator.LastError != "order 12 rejected" ||
+		!status.TradingActive || status.ActivePositions != 2 {
+		t.Errorf("collectStatus() = %+v, orchestrator %+v; want its self-reported state", status, status.Orchestrator)
+	}
+}
+
+func TestStackOperationsFallBackToContainers(t *testing.T) {
+	// Without an address the containers are paused
+	docker := &fakeDocker{}
+	app := newStackOperationsTestApp(docker)
+	app.dialOrchestrator = func(string) (*orchestrator.Client, error) {
+		t.Fatal("Dialed the orchestrator without an address")
+		return nil, nil
+	}
+	if report, err := app.PauseStack(); err != nil || len(report.Succeeded) != 6 {
+		t.Errorf("PauseStack() = %+v, %v; want the six running containers paused", report, err)
+	}
+	if status := app.collectStatus(); status.Orchestrator != nil {
+		t.Errorf("collectStatus().Orchestrator = %+v without an address", status.Orchestrator)
+	}
+
+	// An unreachable orchestrator falls back to them too
+	docker = &fakeDocker{}
+	app = newStackOperationsTestApp(docker)
+	fake := &fakeOrchestrator{}
+	serveOrchestrator(t, app, fake).Close()
+	if report, err := app.UnpauseStack(); err != nil || len(report.Succeeded) != 1 || report.Succeeded[0] != "scanner-paused" {
+		t.Errorf("UnpauseStack() = %+v, %v; want the paused container unpaused", report, err)
+	}
+	if len(fake.calls) != 0 {
+		t.Errorf("Orchestrator calls = %v after its listener closed", fake.calls)
+	}
+	if status := app.collectStatus(); status.Orchestrator == nil || status.Orchestrator.Reachable || status.Orchestrator.Error == "" {
+		t.Errorf("collectStatus().Orchestrator = %+v, want it reported unreachable", status.Orchestrator)
+	}
+}
+
+func TestSaveConfigurationAndRestartThroughOrchestrator(t *testing.T) {
+	app := NewApp()
+	app.configPath = filepath.Join(t.TempDir(), "config.toml")
+	fake := &fakeOrchestrator{active: true}
+	serveOrchestrator(t, app, fake)
+	app.newKubernetesClients = func() (*kubernetesClients, error) {
+		t.Fatal("Scaled the deployments with the orchestrator reachable")
+		return nil, nil
+	}
+
+	config := validConfig()
+	config.Orchestrator.Address = app.config.Orchestrator.Address
+	data, _ := json.Marshal(config)
+	var configData map[string]interface{}
+	if err := json.Unmarshal(data, &configData); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := app.SaveConfigurationAndRestart(configData)
+	if err != nil {
+		t.Fatalf("SaveConfigurationAndRestart() error = %v", err)
+	}
+	if strings.Join(report.Succeeded, ",") != "pause,save,reload,resume" {
+		t.Errorf("Steps = %v, want pause,save,reload,resume", report.Succeeded)
+	}
+	if strings.Join(fake.calls, ",") != "pause,reload,resume" || app.servicesPaused {
+		t.Errorf("Orchestrator calls = %v, paused %v; want it paused, reloaded and resumed", fake.calls, app.servicesPaused)
+	}
+}
+
+func TestOrchestratorAddressValidation(t *testing.T) {
+	config := validConfig()
+	config.Orchestrator.Address = "orchestrator"
+	errs := NewApp().ValidateConfig(config)
+	if len(errs) != 1 || errs[0].Field != "Orchestrator.Address" {
+		t.Errorf("ValidateConfig() = %v, want Orchestrator.Address rejected", errs)
+	}
+}
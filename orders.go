@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"traderadmin/backend/ibkr"
+	"traderadmin/backend/journal"
+	"traderadmin/backend/risk"
+)
+
+// OrderPreview contains the what-if impact of a spread order and the risk check result
+type OrderPreview struct {
+	ibkr.WhatIfResult
+	MaxRiskPerTrade  float64 `json:"maxRiskPerTrade"`
+	ExceedsRiskLimit bool    `json:"exceedsRiskLimit"`
+}
+
+// PreviewOrder runs an IBKR what-if check for the spread and reports the margin impact,
+// commission estimate and whether the margin exceeds the configured risk per trade
+func (a *App) PreviewOrder(spread ibkr.SpreadOrder) (OrderPreview, error) {
+	if err := spread.Validate(); err != nil {
+		return OrderPreview{}, fmt.Errorf("invalid spread: %w", err)
+	}
+
+	if a.orderClient == nil {
+		return OrderPreview{}, ibkr.ErrNotConnected
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The what-if is allocated as the order would be
+	spread.FAAllocation = a.config.activeIBKRAccount().faAllocation()
+	result, err := a.orderClient.WhatIfOrder(ctx, spread)
+	if err != nil {
+		return OrderPreview{}, fmt.Errorf("what-if order failed: %w", err)
+	}
+
+	preview := OrderPreview{
+		WhatIfResult:    result,
+		MaxRiskPerTrade: result.EquityWithLoanBefore * a.config.TradingParameters.DefaultRiskPerTradePercentage / 100,
+	}
+	preview.ExceedsRiskLimit = result.InitMarginChange > preview.MaxRiskPerTrade
+
+	log.Info().
+		Str("symbol", spread.Symbol).
+		Float64("init_margin_change", result.InitMarginChange).
+		Float64("commission", result.Commission).
+		Bool("exceeds_risk_limit", preview.ExceedsRiskLimit).
+		Msg("Order preview completed")
+
+	return preview, nil
+}
+
+// OrderStatusEvent is emitted with the ibkr.OrderState of each status update
+// of an order placed by PlaceSpreadOrder
+const OrderStatusEvent = "order:status"
+
+// defaultPriceImprovementFactor prices orders while
+// TradingParameters.PriceImprovementFactor is unset, a little closer to the
+// bid than the mid price
+const defaultPriceImprovementFactor = 0.4
+
+// Errors for orders PlaceSpreadOrder refuses
+var (
+	ErrOutsideTradingHours = errors.New("outside the trading schedule")
+	ErrMaxPositions        = errors.New("maximum concurrent positions reached")
+	ErrMaxDailyTrades      = errors.New("maximum daily trades reached")
+	ErrRiskLimit           = errors.New("risk limit exceeded")
+)
+
+// PlaceSpreadOrder places the spread as a combo limit order, priced between
+// the legs' natural bid and ask by TradingParameters.PriceImprovementFactor,
+// and reports its order ID. A spread without a quantity is sized by
+// CalculatePositionSize; a positive quantity overrides the sizing. It is
+// refused in read-only mode, outside the trading schedule, at
+// GlobalMaxConcurrentPositions or MaxDailyTrades and when the portfolio Greek
+// limits or the risk per trade would be exceeded. The order's status updates
+// are emitted as OrderStatusEvent. In dry-run mode the checks run but the
+// order is not placed.
+func (a *App) PlaceSpreadOrder(spread ibkr.SpreadOrder) (OperationReport, error) {
+	exec := a.executor("place-order")
+	report := exec.report()
+	if err := a.requireWritable("PlaceSpreadOrder"); err != nil {
+		return report, err
+	}
+	sized := spread.Quantity == 0
+	if sized {
+		spread.Quantity = 1
+	}
+	if err := spread.Validate(); err != nil {
+		return report, fmt.Errorf("invalid spread: %w", err)
+	}
+	if !a.inTradingSchedule(time.Now()) {
+		return report, fmt.Errorf("PlaceSpreadOrder: %w", ErrOutsideTradingHours)
+	}
+	if a.orderClient == nil || a.marketData == nil {
+		return report, ibkr.ErrNotConnected
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	quotes, err := a.legQuotes(ctx, spread)
+	if err != nil {
+		return report, err
+	}
+	if sized {
+		size, err := a.positionSize(ctx, spread, quotes)
+		if err != nil {
+			return report, err
+		}
+		if size.Quantity == 0 {
+			return report, fmt.Errorf("%s: %w", size.Reasons[0], ErrRiskLimit)
+		}
+		spread.Quantity = size.Quantity
+	}
+	if err := a.checkOrderRisk(ctx, spread, quotes); err != nil {
+		return report, err
+	}
+
+	limit, err := ibkr.ComboLimitPrice(spread.Legs, quotes, a.priceImprovementFactor())
+	if err != nil {
+		return report, fmt.Errorf("cannot price the spread: %w", err)
+	}
+
+	order := a.forActiveAccount(ibkr.NewComboOrder(spread, limit))
+	description := fmt.Sprintf("%s %d %s combo at %.2f", order.Action, order.Quantity, order.Symbol, order.LimitPrice)
+	journaled := false
+	err = exec.run("place "+description, func() error {
+		orderID, err := a.orderClient.PlaceOrder(ctx, order, func(state ibkr.OrderState) {
+			log.Info().
+				Int64("order_id", state.OrderID).
+				Str("status", state.Status).
+				Int("filled", state.Filled).
+				Int("remaining", state.Remaining).
+				Str("message", state.Message).
+				Msg("Order status")
+			a.emitEvent(OrderStatusEvent, state)
+			if state.Status == ibkr.OrderFilled && !journaled {
+				journaled = true
+				a.journalFill(spread, quotes, state)
+			}
+		})
+		report.OrderID = orderID
+		return err
+	})
+	if err != nil {
+		report.Failed = append(report.Failed, ContainerOutcome{Name: description, Reason: err.Error()})
+		exec.finish(&report)
+		return report, fmt.Errorf("failed to place order: %w", err)
+	}
+	report.Succeeded = append(report.Succeeded, description)
+	exec.finish(&report)
+
+	log.Info().
+		Int64("order_id", report.OrderID).
+		Str("symbol", order.Symbol).
+		Int("quantity", order.Quantity).
+		Float64("limit_price", limit).
+		Bool("dry_run", report.DryRun).
+		Msg("Spread order placed")
+	return report, nil
+}
+
+// journalFill records a filled spread order in the trade journal, where it
+// counts toward MaxDailyTrades and the exit manager watches it. The combo's
+// fill price is the debit paid, so the entry price is its negative.
+func (a *App) journalFill(spread ibkr.SpreadOrder, quotes []ibkr.OptionQuote, state ibkr.OrderState) {
+	if a.journal == nil {
+		log.Warn().Int64("order_id", state.OrderID).Msg("Trade journal unavailable, filled order not recorded")
+		return
+	}
+	trade := journal.TradeRecord{
+		Symbol:     strings.ToUpper(spread.Symbol),
+		Legs:       spread.Legs,
+		Quantity:   state.Filled,
+		EntryTime:  state.UpdatedAt,
+		EntryPrice: -state.AvgFillPrice,
+	}
+	spread.Quantity = 1
+	if maxLoss := risk.MaxLoss(spreadExposures(spread, quotes, time.Now()), state.AvgFillPrice*risk.DefaultMultiplier); !math.IsInf(maxLoss, 1) {
+		trade.MaxLoss = maxLoss * float64(state.Filled)
+	}
+	if _, err := a.journal.RecordTrade(trade); err != nil {
+		log.Error().Err(err).Int64("order_id", state.OrderID).Msg("Failed to record filled order in the trade journal")
+	}
+}
+
+// GetOpenOrders returns the active account's orders that are not done yet
+func (a *App) GetOpenOrders() ([]ibkr.OrderState, error) {
+	if a.orderClient == nil {
+		return nil, ibkr.ErrNotConnected
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	orders, err := a.orderClient.OpenOrders(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load open orders: %w", err)
+	}
+	return a.accountOrders(orders), nil
+}
+
+// CancelOrder requests the cancellation of an open order; the outcome is
+// emitted as OrderStatusEvent for orders placed by PlaceSpreadOrder
+func (a *App) CancelOrder(orderID int64) error {
+	if err := a.requireWritable("CancelOrder"); err != nil {
+		return err
+	}
+	if a.orderClient == nil {
+		return ibkr.ErrNotConnected
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := a.orderClient.CancelOrder(ctx, orderID); err != nil {
+		return fmt.Errorf("failed to cancel order %d: %w", orderID, err)
+	}
+	log.Info().Int64("order_id", orderID).Msg("Order cancellation requested")
+	return nil
+}
+
+// legQuotes returns the quote of each leg of the spread, in order
+func (a *App) legQuotes(ctx context.Context, spread ibkr.SpreadOrder) ([]ibkr.OptionQuote, error) {
+	keys := make([]ibkr.OptionKey, len(spread.Legs))
+	for i, leg := range spread.Legs {
+		keys[i] = ibkr.OptionKey{Expiry: leg.Expiry, Strike: leg.Strike, Right: leg.Right}
+	}
+	snapshots, err := a.marketData.OptionSnapshots(ctx, strings.ToUpper(spread.Symbol), keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to quote the legs: %w", err)
+	}
+
+	byKey := make(map[ibkr.OptionKey]ibkr.OptionQuote, len(snapshots))
+	for _, quote := range snapshots {
+		byKey[quote.OptionKey] = quote
+	}
+	quotes := make([]ibkr.OptionQuote, len(keys))
+	for i, key := range keys {
+		quote, ok := byKey[key]
+		if !ok {
+			return nil, fmt.Errorf("no quote for leg %d (%s %g%s)", i+1, key.Expiry, key.Strike, key.Right)
+		}
+		quotes[i] = quote
+	}
+	return quotes, nil
+}
+
+// priceImprovementFactor returns TradingParameters.PriceImprovementFactor,
+// or defaultPriceImprovementFactor while it is unset
+func (a *App) priceImprovementFactor() float64 {
+	if factor := a.config.TradingParameters.PriceImprovementFactor; factor != 0 {
+		return factor
+	}
+	return defaultPriceImprovementFactor
+}
+
+// checkOrderRisk refuses a spread when the open positions are at
+// GlobalMaxConcurrentPositions, the day's trades at MaxDailyTrades, or when it
+// would breach the portfolio Greek limits or the risk per trade PreviewOrder
+// checks
+func (a *App) checkOrderRisk(ctx context.Context, spread ibkr.SpreadOrder, quotes []ibkr.OptionQuote) error {
+	current, err := a.openExposures()
+	if err != nil {
+		return err
+	}
+	if maxTrades := a.config.TradingParameters.MaxDailyTrades; maxTrades > 0 {
+		if trades := a.tradesToday(); trades >= maxTrades {
+			return fmt.Errorf("%d trades today of at most %d: %w", trades, maxTrades, ErrMaxDailyTrades)
+		}
+	}
+	if maxPositions := a.config.TradingParameters.GlobalMaxConcurrentPositions; maxPositions > 0 {
+		working, err := a.orderClient.OpenOrders(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to load open orders: %w", err)
+		}
+		working = a.accountOrders(working)
+		if open := openPositions(current, working); open >= maxPositions {
+			return fmt.Errorf("%d open positions and working orders of at most %d: %w", open, maxPositions, ErrMaxPositions)
+		}
+	}
+
+	check, err := a.CheckNewPositionAgainstLimits(spreadExposures(spread, quotes, time.Now()))
+	if err != nil {
+		return err
+	}
+	if !check.Allowed {
+		return fmt.Errorf("%s: %w", strings.Join(check.Violations, "; "), ErrRiskLimit)
+	}
+
+	preview, err := a.PreviewOrder(spread)
+	if err != nil {
+		return err
+	}
+	if preview.ExceedsRiskLimit {
+		return fmt.Errorf("margin change %.2f is over the %.2f risk per trade: %w", preview.InitMarginChange, preview.MaxRiskPerTrade, ErrRiskLimit)
+	}
+	return nil
+}
+
+// spreadExposures returns the legs spread would add to the portfolio, with
+// the Greeks of their quotes as of now
+func spreadExposures(spread ibkr.SpreadOrder, quotes []ibkr.OptionQuote, now time.Time) []risk.LegExposure {
+	legs := make([]risk.LegExposure, len(spread.Legs))
+	for i, leg := range spread.Legs {
+		quantity := spread.Quantity * max(leg.Ratio, 1)
+		if leg.Action == "SELL" {
+			quantity = -quantity
+		}
+		quote := quotes[i]
+		legs[i] = risk.LegExposure{
+			Symbol:   strings.ToUpper(spread.Symbol),
+			Strike:   leg.Strike,
+			Expiry:   leg.Expiry,
+			Right:    leg.Right,
+			Quantity: quantity,
+			Greeks:   risk.Greeks{Delta: quote.Delta, Gamma: quote.Gamma, Vega: quote.Vega, Theta: quote.Theta, UpdatedAt: now},
+		}
+	}
+	return legs
+}
+
+// openPositions counts the underlyings with open option legs or working
+// orders, a spread being one position
+func openPositions(legs []risk.LegExposure, working []ibkr.OrderState) int {
+	symbols := make(map[string]bool)
+	for _, leg := range legs {
+		if leg.Quantity != 0 {
+			symbols[leg.Symbol] = true
+		}
+	}
+	for _, order := range working {
+		if !order.Done() {
+			symbols[order.Symbol] = true
+		}
+	}
+	return len(symbols)
+}
+
+// inTradingSchedule reports whether now lies within the trading schedule's
+// days and UTC hours and the exchange is not closed for a holiday or after an
+// early close; a disabled schedule allows any time
+func (a *App) inTradingSchedule(now time.Time) bool {
+	schedule := a.config.TradingSchedule
+	if !schedule.Enabled {
+		return true
+	}
+	if day := a.marketCalendar().Day(now); day.Holiday != "" || day.EarlyClose != "" && !now.Before(day.Close) {
+		return false
+	}
+	now = now.UTC()
+	if len(schedule.DaysOfWeek) > 0 && !slices.Contains(schedule.DaysOfWeek, now.Weekday().String()[:3]) {
+		return false
+	}
+	start, err := time.Parse("15:04", schedule.StartTimeUTC)
+	if err != nil {
+		return false
+	}
+	stop, err := time.Parse("15:04", schedule.StopTimeUTC)
+	if err != nil {
+		return false
+	}
+	minutes := now.Hour()*60 + now.Minute()
+	return minutes >= start.Hour()*60+start.Minute() && minutes < stop.Hour()*60+stop.Minute()
+}
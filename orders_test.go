@@ -0,0 +1,426 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"traderadmin/backend/ibkr"
+	"traderadmin/backend/journal"
+	"traderadmin/backend/risk"
+)
+
+// fakeOrderClient is a scripted IBKR responder for order tests. A placed
+// order gets the next order ID and the scripted status updates.
+type fakeOrderClient struct {
+	whatIf ibkr.WhatIfResult
+	err    error
+	orders []ibkr.SpreadOrder
+
+	statuses  []ibkr.OrderState
+	placeErr  error
+	placed    []ibkr.ComboOrder
+	open      []ibkr.OrderState
+	cancelled []int64
+}
+
+func (f *fakeOrderClient) WhatIfOrder(ctx context.Context, order ibkr.SpreadOrder) (ibkr.WhatIfResult, error) {
+	f.orders = append(f.orders, order)
+	return f.whatIf, f.err
+}
+
+func (f *fakeOrderClient) PlaceOrder(ctx context.Context, order ibkr.ComboOrder, onStatus func(ibkr.OrderState)) (int64, error) {
+	if f.placeErr != nil {
+		return 0, f.placeErr
+	}
+	f.placed = append(f.placed, order)
+	orderID := int64(100 + len(f.placed))
+	for _, status := range f.statuses {
+		status.OrderID, status.Symbol, status.Legs, status.LimitPrice = orderID, order.Symbol, order.Legs, order.LimitPrice
+		onStatus(status)
+	}
+	return orderID, nil
+}
+
+func (f *fakeOrderClient) OpenOrders(ctx context.Context) ([]ibkr.OrderState, error) {
+	return f.open, nil
+}
+
+func (f *fakeOrderClient) CancelOrder(ctx context.Context, orderID int64) error {
+	f.cancelled = append(f.cancelled, orderID)
+	return nil
+}
+
+func testSpread() ibkr.SpreadOrder {
+	return ibkr.SpreadOrder{
+		Symbol:   "SPY",
+		Quantity: 1,
+		Legs: []ibkr.OptionLeg{
+			{Strike: 400, Expiry: "20240119", Right: "P", Action: "SELL", Ratio: 1},
+			{Strike: 395, Expiry: "20240119", Right: "P", Action: "BUY", Ratio: 1},
+		},
+	}
+}
+
+func TestPreviewOrder(t *testing.T) {
+	tests := []struct {
+		name             string
+		marginChange     float64
+		wantExceedsLimit bool
+	}{
+		{name: "Within risk limit", marginChange: 500, wantExceedsLimit: false},
+		{name: "Exceeds risk limit", marginChange: 1500, wantExceedsLimit: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := NewApp()
+			app.config.TradingParameters.DefaultRiskPerTradePercentage = 1.0
+			client := &fakeOrderClient{whatIf: ibkr.WhatIfResult{
+				InitMarginChange:     tt.marginChange,
+				MaintMarginChange:    tt.marginChange,
+				EquityWithLoanBefore: 100000,
+				Commission:           2.6,
+			}}
+			app.orderClient = client
+
+			preview, err := app.PreviewOrder(testSpread())
+			if err != nil {
+				t.Fatalf("PreviewOrder() error = %v", err)
+			}
+			if preview.ExceedsRiskLimit != tt.wantExceedsLimit {
+				t.Errorf("ExceedsRiskLimit = %v, want %v", preview.ExceedsRiskLimit, tt.wantExceedsLimit)
+			}
+			if preview.MaxRiskPerTrade != 1000 {
+				t.Errorf("MaxRiskPerTrade = %v, want %v", preview.MaxRiskPerTrade, 1000.0)
+			}
+			if preview.Commission != 2.6 {
+				t.Errorf("Commission = %v, want %v", preview.Commission, 2.6)
+			}
+			if len(client.orders) != 1 {
+				t.Errorf("Expected one what-if order, got %d", len(client.orders))
+			}
+		})
+	}
+}
+
+func TestPreviewOrderDisconnected(t *testing.T) {
+	app := NewApp()
+
+	_, err := app.PreviewOrder(testSpread())
+	if !errors.Is(err, ibkr.ErrNotConnected) {
+		t.Errorf("PreviewOrder() error = %v, want ErrNotConnected", err)
+	}
+}
+
+func TestPreviewOrderRejectsInvalidSpread(t *testing.T) {
+	app := NewApp()
+	app.orderClient = &fakeOrderClient{}
+
+	spread := testSpread()
+	spread.Legs[0].Right = "X"
+
+	if _, err := app.PreviewOrder(spread); err == nil || errors.Is(err, ibkr.ErrNotConnected) {
+		t.Errorf("PreviewOrder() error = %v, want validation error", err)
+	}
+}
+
+// fakeExposures is a scripted portfolio of open option legs
+type fakeExposures struct {
+	legs []risk.LegExposure
+}
+
+func (f *fakeExposures) OpenExposures(ctx context.Context) ([]risk.LegExposure, error) {
+	return f.legs, nil
+}
+
+// spreadQuotes quotes the legs of testSpread, the 400 put at 3.00/3.20 and
+// the 395 put at 1.80/1.90, in the reverse order of the request
+type spreadQuotes struct{}
+
+func (spreadQuotes) UnderlyingPrice(ctx context.Context, symbol string) (float64, error) {
+	return 410, nil
+}
+
+func (spreadQuotes) OptionParams(ctx context.Context, symbol string) ([]ibkr.OptionParams, error) {
+	return nil, nil
+}
+
+func (spreadQuotes) OptionSnapshots(ctx context.Context, symbol string, options []ibkr.OptionKey) ([]ibkr.OptionQuote, error) {
+	quotes := map[float64]ibkr.OptionQuote{
+		400: {Bid: 3.0, Ask: 3.2, Delta: -0.45},
+		395: {Bid: 1.8, Ask: 1.9, Delta: -0.35},
+	}
+	var snapshots []ibkr.OptionQuote
+	for i := len(options) - 1; i >= 0; i-- {
+		quote := quotes[options[i].Strike]
+		quote.OptionKey = options[i]
+		snapshots = append(snapshots, quote)
+	}
+	return snapshots, nil
+}
+
+// orderTestApp returns an app connected to fakes that place orders with the
+// scripted status updates, and the updates it emits
+func orderTestApp(statuses ...ibkr.OrderState) (*App, *fakeOrderClient, *[]ibkr.OrderState) {
+	app := NewApp()
+	app.config.TradingParameters.GlobalMaxConcurrentPositions = 2
+	app.config.TradingParameters.DefaultRiskPerTradePercentage = 1.0
+	client := &fakeOrderClient{
+		whatIf:   ibkr.WhatIfResult{InitMarginChange: 500, EquityWithLoanBefore: 100000},
+		statuses: statuses,
+	}
+	app.orderClient = client
+	app.marketData = spreadQuotes{}
+	app.exposures = &fakeExposures{}
+
+	events := &[]ibkr.OrderState{}
+	app.emit = func(name string, data ...interface{}) {
+		if name == OrderStatusEvent {
+			*events = append(*events, data[0].(ibkr.OrderState))
+		}
+	}
+	return app, client, events
+}
+
+func TestPlaceSpreadOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []ibkr.OrderState
+		wantDone bool
+	}{
+		{
+			name: "Fill",
+			statuses: []ibkr.OrderState{
+				{Status: ibkr.OrderSubmitted, Remaining: 2},
+				{Status: ibkr.OrderFilled, Filled: 2, AvgFillPrice: -1.28},
+			},
+			wantDone: true,
+		},
+		{
+			name: "Partial fill",
+			statuses: []ibkr.OrderState{
+				{Status: ibkr.OrderSubmitted, Remaining: 2},
+				{Status: ibkr.OrderSubmitted, Filled: 1, Remaining: 1, AvgFillPrice: -1.28},
+			},
+			wantDone: false,
+		},
+		{
+			name: "Reject",
+			statuses: []ibkr.OrderState{
+				{Status: ibkr.OrderInactive, Remaining: 2, Message: "Order rejected - reason: insufficient margin"},
+			},
+			wantDone: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, client, events := orderTestApp(tt.statuses...)
+			spread := testSpread()
+			spread.Quantity = 2
+
+			report, err := app.PlaceSpreadOrder(spread)
+			if err != nil {
+				t.Fatalf("PlaceSpreadOrder() error = %v", err)
+			}
+			orderID := report.OrderID
+			if orderID != 101 || len(client.placed) != 1 || report.DryRun {
+				t.Fatalf("Order ID %d, placed %d orders", orderID, len(client.placed))
+			}
+
+			// Selling the 400 put at 3.00-3.20 and buying the 395 put at
+			// 1.80-1.90 is a credit of 1.10 to 1.40, priced 0.4 of the way
+			order := client.placed[0]
+			if order.SecType != "BAG" || order.Action != "BUY" || order.OrderType != "LMT" || order.Quantity != 2 || order.LimitPrice != -1.28 {
+				t.Errorf("Placed %+v, want a BAG limit order at -1.28", order)
+			}
+			if !reflect.DeepEqual(order.Legs, spread.Legs) {
+				t.Errorf("Legs = %+v, want %+v", order.Legs, spread.Legs)
+			}
+
+			if len(*events) != len(tt.statuses) {
+				t.Fatalf("Emitted %d status updates, want %d", len(*events), len(tt.statuses))
+			}
+			last := (*events)[len(*events)-1]
+			if last.OrderID != orderID || last.Status != tt.statuses[len(tt.statuses)-1].Status || last.Done() != tt.wantDone {
+				t.Errorf("Last update = %+v, want done %v", last, tt.wantDone)
+			}
+		})
+	}
+}
+
+func TestPlaceSpreadOrderJournalsFills(t *testing.T) {
+	app, client, _ := orderTestApp(
+		ibkr.OrderState{Status: ibkr.OrderSubmitted, Remaining: 1},
+		ibkr.OrderState{Status: ibkr.OrderFilled, Filled: 1, AvgFillPrice: -1.28},
+	)
+	j, err := journal.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.journal = j
+	app.config.TradingParameters.MaxDailyTrades = 2
+
+	for i := 0; i < 2; i++ {
+		if _, err := app.PlaceSpreadOrder(testSpread()); err != nil {
+			t.Fatalf("Order %d: PlaceSpreadOrder() error = %v", i+1, err)
+		}
+	}
+	trades := j.GetTrades(journal.TradeFilter{})
+	if len(trades) != 2 {
+		t.Fatalf("Journaled %d trades, want both fills", len(trades))
+	}
+	// The 5 point wide put spread sold for a 1.28 credit risks 3.72
+	if trade := trades[0]; trade.Symbol != "SPY" || trade.Quantity != 1 || trade.EntryPrice != 1.28 || trade.Status != journal.StatusOpen || math.Abs(trade.MaxLoss-372) > 1e-9 || !reflect.DeepEqual(trade.Legs, testSpread().Legs) {
+		t.Errorf("Journaled %+v, want the filled spread", trade)
+	}
+
+	if _, err := app.PlaceSpreadOrder(testSpread()); !errors.Is(err, ErrMaxDailyTrades) {
+		t.Errorf("Third order: PlaceSpreadOrder() error = %v, want ErrMaxDailyTrades", err)
+	}
+	if len(client.placed) != 2 {
+		t.Errorf("Placed %d orders, want the third refused", len(client.placed))
+	}
+}
+
+func TestPlaceSpreadOrderUsesPriceImprovementFactor(t *testing.T) {
+	app, client, _ := orderTestApp()
+	app.config.TradingParameters.PriceImprovementFactor = 0.5
+
+	if _, err := app.PlaceSpreadOrder(testSpread()); err != nil {
+		t.Fatal(err)
+	}
+	if price := client.placed[0].LimitPrice; price != -1.25 {
+		t.Errorf("LimitPrice = %v, want the mid price -1.25", price)
+	}
+}
+
+func TestPlaceSpreadOrderRefusals(t *testing.T) {
+	openLeg := func(symbol string) risk.LegExposure {
+		return risk.LegExposure{Symbol: symbol, Strike: 100, Expiry: "20240119", Right: "P", Quantity: -1}
+	}
+	tests := []struct {
+		name    string
+		setup   func(app *App, client *fakeOrderClient)
+		wantErr error
+	}{
+		{
+			name: "Read-only mode",
+			setup: func(app *App, client *fakeOrderClient) {
+				app.config.IBKRConnection.Accounts = []IBKRAccount{{Name: "paper", ReadOnlyAPI: true}}
+			},
+			wantErr: ErrReadOnlyMode,
+		},
+		{
+			name: "Outside trading hours",
+			setup: func(app *App, client *fakeOrderClient) {
+				app.config.TradingSchedule.Enabled = true
+				app.config.TradingSchedule.StartTimeUTC = "00:00"
+				app.config.TradingSchedule.StopTimeUTC = "00:00"
+			},
+			wantErr: ErrOutsideTradingHours,
+		},
+		{
+			name: "Max positions",
+			setup: func(app *App, client *fakeOrderClient) {
+				app.exposures = &fakeExposures{legs: []risk.LegExposure{openLeg("QQQ"), openLeg("IWM"), openLeg("IWM")}}
+			},
+			wantErr: ErrMaxPositions,
+		},
+		{
+			name: "Working orders count as positions",
+			setup: func(app *App, client *fakeOrderClient) {
+				app.exposures = &fakeExposures{legs: []risk.LegExposure{openLeg("QQQ")}}
+				client.open = []ibkr.OrderState{{OrderID: 7, Symbol: "IWM", Status: ibkr.OrderSubmitted}}
+			},
+			wantErr: ErrMaxPositions,
+		},
+		{
+			name: "Portfolio Greek limits",
+			setup: func(app *App, client *fakeOrderClient) {
+				app.config.PortfolioGreekLimits.UsePortfolioGreekLimits = true
+				app.config.PortfolioGreekLimits.MaxAbsNetDelta = 5
+			},
+			wantErr: ErrRiskLimit,
+		},
+		{
+			name: "Risk per trade",
+			setup: func(app *App, client *fakeOrderClient) {
+				client.whatIf.InitMarginChange = 1500
+			},
+			wantErr: ErrRiskLimit,
+		},
+		{
+			name:    "Disconnected",
+			setup:   func(app *App, client *fakeOrderClient) { app.marketData = nil },
+			wantErr: ibkr.ErrNotConnected,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, client, _ := orderTestApp()
+			tt.setup(app, client)
+
+			if _, err := app.PlaceSpreadOrder(testSpread()); !errors.Is(err, tt.wantErr) {
+				t.Errorf("PlaceSpreadOrder() error = %v, want %v", err, tt.wantErr)
+			}
+			if len(client.placed) != 0 {
+				t.Errorf("Placed %+v, want nothing placed", client.placed)
+			}
+		})
+	}
+}
+
+func TestOpenOrdersAndCancel(t *testing.T) {
+	app, client, _ := orderTestApp()
+	client.open = []ibkr.OrderState{{OrderID: 7, Symbol: "SPY", Status: ibkr.OrderSubmitted, Remaining: 1}}
+
+	orders, err := app.GetOpenOrders()
+	if err != nil || !reflect.DeepEqual(orders, client.open) {
+		t.Errorf("GetOpenOrders() = %+v, %v", orders, err)
+	}
+	if err := app.CancelOrder(7); err != nil || !reflect.DeepEqual(client.cancelled, []int64{7}) {
+		t.Errorf("CancelOrder() error = %v, cancelled %v", err, client.cancelled)
+	}
+}
+
+func TestInTradingSchedule(t *testing.T) {
+	app := NewApp()
+	app.config.TradingSchedule.Enabled = true
+	app.config.TradingSchedule.StartTimeUTC = "13:30"
+	app.config.TradingSchedule.StopTimeUTC = "20:00"
+	app.config.TradingSchedule.DaysOfWeek = []string{"Mon", "Tue", "Wed", "Thu", "Fri"}
+
+	eastern, _ := time.LoadLocation("America/New_York")
+	tests := []struct {
+		name string
+		now  time.Time
+		want bool
+	}{
+		{"At the open", time.Date(2024, 7, 15, 13, 30, 0, 0, time.UTC), true},
+		{"In another zone", time.Date(2024, 7, 15, 15, 59, 0, 0, eastern), true},
+		{"At the close", time.Date(2024, 7, 15, 20, 0, 0, 0, time.UTC), false},
+		{"Before the open", time.Date(2024, 7, 15, 9, 0, 0, 0, time.UTC), false},
+		{"Saturday", time.Date(2024, 7, 13, 15, 0, 0, 0, time.UTC), false},
+		{"Holiday", time.Date(2024, 7, 4, 15, 0, 0, 0, time.UTC), false},
+		{"Before an early close", time.Date(2024, 7, 3, 16, 59, 0, 0, time.UTC), true},
+		{"After an early close", time.Date(2024, 7, 3, 17, 0, 0, 0, time.UTC), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := app.inTradingSchedule(tt.now); got != tt.want {
+				t.Errorf("inTradingSchedule(%v) = %v, want %v", tt.now, got, tt.want)
+			}
+		})
+	}
+
+	app.config.TradingSchedule.Enabled = false
+	if !app.inTradingSchedule(time.Date(2024, 7, 13, 3, 0, 0, 0, time.UTC)) {
+		t.Error("A disabled schedule should allow any time")
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"traderadmin/backend/ibkr"
+	"traderadmin/backend/models"
+	"traderadmin/backend/risk"
+)
+
+// GetPortfolioGreeks returns the net Greeks of all open option positions
+func (a *App) GetPortfolioGreeks() (risk.PortfolioGreeks, error) {
+	legs, err := a.openExposures()
+	if err != nil {
+		return risk.PortfolioGreeks{}, err
+	}
+
+	return risk.Aggregate(legs, time.Now(), a.maxGreeksAge()), nil
+}
+
+// CheckNewPositionAgainstLimits projects the portfolio Greeks after adding the given
+// legs and reports whether the configured portfolio-level limits would be breached
+func (a *App) CheckNewPositionAgainstLimits(legs []risk.LegExposure) (risk.LimitCheck, error) {
+	current, err := a.openExposures()
+	if err != nil {
+		return risk.LimitCheck{}, err
+	}
+
+	cfg := a.config.PortfolioGreekLimits
+	limits := risk.Limits{
+		MaxAbsNetDelta: cfg.MaxAbsNetDelta,
+		MaxAbsNetGamma: cfg.MaxAbsNetGamma,
+		MaxAbsNetVega:  cfg.MaxAbsNetVega,
+	}
+	if cfg.UseMinNetTheta {
+		limits.MinNetTheta = &cfg.MinNetTheta
+	}
+
+	check := risk.CheckNewPosition(current, legs, limits, time.Now(), a.maxGreeksAge())
+	if !cfg.UsePortfolioGreekLimits {
+		// Report the projection but never reject when limits are disabled
+		check.Allowed = true
+		check.Violations = nil
+	}
+
+	if !check.Allowed {
+		log.Warn().Strs("violations", check.Violations).Msg("New position rejected by portfolio Greek limits")
+	}
+	if check.Projected.Stale {
+		log.Warn().Strs("stale_legs", check.Projected.StaleLegs).Msg("Portfolio Greek check used stale Greeks")
+	}
+
+	return check, nil
+}
+
+// openExposures loads the open option legs of the active account with their
+// Greeks from the exposure source
+func (a *App) openExposures() ([]risk.LegExposure, error) {
+	if a.exposures == nil {
+		return nil, ibkr.ErrNotConnected
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	legs, err := a.exposures.OpenExposures(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load open positions: %w", err)
+	}
+	return a.accountExposures(legs), nil
+}
+
+// positionExposures is the ExposureSource of the option positions TWS
+// reports, each with the Greeks of a snapshot of its option. An option the
+// snapshot leaves out has no Greeks and is flagged stale.
+type positionExposures struct {
+	account    ibkr.AccountClient
+	marketData ibkr.MarketDataClient
+}
+
+func (p positionExposures) OpenExposures(ctx context.Context) ([]risk.LegExposure, error) {
+	positions, err := p.account.Positions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	bySymbol := make(map[string][]ibkr.Position)
+	for _, position := range positions {
+		if position.SecType == "OPT" {
+			bySymbol[position.Symbol] = append(bySymbol[position.Symbol], position)
+		}
+	}
+
+	var legs []risk.LegExposure
+	for _, symbol := range sortedKeys(bySymbol) {
+		keys := make([]ibkr.OptionKey, len(bySymbol[symbol]))
+		for i, position := range bySymbol[symbol] {
+			keys[i] = ibkr.OptionKey{Expiry: position.Expiry, Strike: position.Strike, Right: position.Right}
+		}
+		quotes, err := p.marketData.OptionSnapshots(ctx, symbol, keys)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s Greeks: %w", symbol, err)
+		}
+		now := time.Now()
+		greeks := make(map[ibkr.OptionKey]risk.Greeks, len(quotes))
+		for _, quote := range quotes {
+			greeks[quote.OptionKey] = risk.Greeks{Delta: quote.Delta, Gamma: quote.Gamma, Vega: quote.Vega, Theta: quote.Theta, UpdatedAt: now}
+		}
+		for i, position := range bySymbol[symbol] {
+			legs = append(legs, risk.LegExposure{
+				Symbol:     symbol,
+				Strike:     position.Strike,
+				Expiry:     position.Expiry,
+				Right:      position.Right,
+				Quantity:   int(position.Quantity),
+				Multiplier: int(position.Multiplier),
+				Greeks:     greeks[keys[i]],
+				Account:    position.Account,
+			})
+		}
+	}
+	return legs, nil
+}
+
+// maxGreeksAge returns the configured maximum Greeks age before they are flagged stale
+func (a *App) maxGreeksAge() time.Duration {
+	return time.Duration(a.config.PortfolioGreekLimits.MaxGreeksAgeSeconds) * time.Second
+}
+
+// SubAccountPositions are the open option legs one account holds, with their
+// net Greeks
+type SubAccountPositions struct {
+	Account string               `json:"account"`
+	Legs    []risk.LegExposure   `json:"legs"`
+	Greeks  risk.PortfolioGreeks `json:"greeks"`
+}
+
+// GetSubAccountPositions breaks the open positions down by the account
+// holding them, sorted by account code. For an advisor account allocating
+// its orders these are its sub-accounts; otherwise the active account is the
+// only one.
+func (a *App) GetSubAccountPositions() ([]SubAccountPositions, error) {
+	legs, err := a.openExposures()
+	if err != nil {
+		return nil, err
+	}
+
+	byAccount := make(map[string][]risk.LegExposure)
+	for _, leg := range legs {
+		account := leg.Account
+		if account == "" {
+			account = a.activeAccountCode()
+		}
+		byAccount[account] = append(byAccount[account], leg)
+	}
+	now := time.Now()
+	accounts := make([]SubAccountPositions, 0, len(byAccount))
+	for account, legs := range byAccount {
+		accounts = append(accounts, SubAccountPositions{Account: account, Legs: legs, Greeks: risk.Aggregate(legs, now, a.maxGreeksAge())})
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].Account < accounts[j].Account })
+	return accounts, nil
+}
+
+// sumPositions sums the legs held across accounts into one position per
+// option contract, sorted by contract
+func sumPositions(legs []risk.LegExposure) []models.Position {
+	quantities := make(map[string]int)
+	for _, leg := range legs {
+		quantities[fmt.Sprintf("%s %s %g%s", leg.Symbol, leg.Expiry, leg.Strike, leg.Right)] += leg.Quantity
+	}
+	positions := make([]models.Position, 0, len(quantities))
+	for contract, quantity := range quantities {
+		if quantity != 0 {
+			positions = append(positions, models.Position{Symbol: contract, Quantity: quantity})
+		}
+	}
+	sort.Slice(positions, func(i, j int) bool { return positions[i].Symbol < positions[j].Symbol })
+	return positions
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"traderadmin/backend/ibkr"
+)
+
+// fakeAccount is a scripted account of the IBKR trading connection
+type fakeAccount struct {
+	positions []ibkr.Position
+	summary   ibkr.AccountSummary
+	err       error
+}
+
+func (f *fakeAccount) Positions(ctx context.Context) ([]ibkr.Position, error) {
+	return f.positions, f.err
+}
+
+func (f *fakeAccount) AccountSummary(ctx context.Context, account string) (ibkr.AccountSummary, error) {
+	return f.summary, f.err
+}
+
+func TestPositionExposures(t *testing.T) {
+	account := &fakeAccount{positions: []ibkr.Position{
+		{Account: "U1", Symbol: "SPY", SecType: "STK", Quantity: 100},
+		{Account: "U1", Symbol: "SPY", SecType: "OPT", Expiry: "20250117", Strike: 400, Right: "P", Multiplier: 100, Quantity: -2},
+		{Account: "U2", Symbol: "SPY", SecType: "OPT", Expiry: "20250117", Strike: 395, Right: "P", Multiplier: 100, Quantity: 2},
+	}}
+	source := positionExposures{account: account, marketData: spreadQuotes{}}
+
+	legs, err := source.OpenExposures(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(legs) != 2 {
+		t.Fatalf("OpenExposures() = %+v, want the two option legs", legs)
+	}
+	short, long := legs[0], legs[1]
+	if short.Strike != 400 || short.Quantity != -2 || short.Multiplier != 100 || short.Account != "U1" || short.Greeks.Delta != -0.45 || short.Greeks.UpdatedAt.IsZero() {
+		t.Errorf("Short leg = %+v, want its position with the 400 put's Greeks", short)
+	}
+	if long.Strike != 395 || long.Quantity != 2 || long.Account != "U2" || long.Greeks.Delta != -0.35 {
+		t.Errorf("Long leg = %+v, want its position with the 395 put's Greeks", long)
+	}
+
+	// The app fails closed when the positions cannot be loaded
+	app := NewApp()
+	account.err = ibkr.ErrNotConnected
+	app.exposures = source
+	if _, err := app.GetPortfolioGreeks(); !errors.Is(err, ibkr.ErrNotConnected) {
+		t.Errorf("GetPortfolioGreeks() error = %v, want ErrNotConnected", err)
+	}
+}
+
+func TestMetricsFromAccountSummary(t *testing.T) {
+	app := NewApp()
+	account := &fakeAccount{summary: ibkr.AccountSummary{Account: "U1", NetLiquidation: 125000, BuyingPower: 250000, RealizedPnL: 300, UnrealizedPnL: -120}}
+	app.account = account
+	connected := StatusInfo{}
+	connected.IBKR.Connected = true
+
+	metrics := app.collectMetrics(connected)
+	if p := metrics.Portfolio; p.Equity != 125000 || p.BuyingPower != 250000 || p.RealizedPNLToday != 300 || p.UnrealizedPNL != -120 {
+		t.Errorf("Portfolio metrics = %+v, want the account summary", p)
+	}
+	snapshot, ok := equitySnapshot(connected, metrics)
+	if !ok || snapshot.Equity != 125000 || snapshot.UnrealizedPNL != -120 {
+		t.Errorf("equitySnapshot() = %+v, %v, want the account's equity", snapshot, ok)
+	}
+
+	// Without an account value nothing is recorded
+	account.err = ibkr.ErrNotConnected
+	metrics = app.collectMetrics(connected)
+	if metrics.Portfolio.Equity != 0 {
+		t.Errorf("Equity without a summary = %v, want 0", metrics.Portfolio.Equity)
+	}
+	if snapshot, ok := equitySnapshot(connected, metrics); ok {
+		t.Errorf("equitySnapshot() without an account value = %+v, want none", snapshot)
+	}
+}
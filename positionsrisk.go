@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"traderadmin/backend/ibkr"
+	"traderadmin/backend/journal"
+	"traderadmin/backend/notifications"
+	"traderadmin/backend/risk"
+)
+
+// positionsRiskBudget is the time the quotes of the open positions are
+// refreshed within; a position not quoted in time keeps its last-known
+// values, flagged stale
+const positionsRiskBudget = 3 * time.Second
+
+// PositionRisk is the risk of an open trade of the journal at its legs'
+// latest quotes. EntryPrice and CurrentValue are per share like the
+// journal's prices, CurrentValue being the net debit to close the trade at
+// the mid prices, negative for a credit; the P&L and its bounds are dollars
+// for the trade's quantity.
+type PositionRisk struct {
+	TradeID       int64                `json:"tradeId"`
+	Symbol        string               `json:"symbol"`
+	Strategy      string               `json:"strategy"`
+	Quantity      int                  `json:"quantity"`
+	Expiry        string               `json:"expiry"` // the legs' nearest, YYYYMMDD
+	DTE           int                  `json:"dte"`
+	EntryPrice    float64              `json:"entryPrice"`
+	CurrentValue  float64              `json:"currentValue"`
+	UnrealizedPnL float64              `json:"unrealizedPnl"`
+	MaxProfit     float64              `json:"maxProfit"`  // 0 when unlimited
+	MaxLoss       float64              `json:"maxLoss"`    // 0 when unlimited
+	ProfitPct     float64              `json:"profitPct"`  // of the max profit, negative at a loss
+	LossPct       float64              `json:"lossPct"`    // of the max loss, 0 at a profit
+	ShortDelta    float64              `json:"shortDelta"` // of the short leg nearest the money
+	Greeks        risk.PortfolioGreeks `json:"greeks"`
+	Held          bool                 `json:"held"`  // the account holds the legs
+	Stale         bool                 `json:"stale"` // the values are the last known, the legs could not be quoted
+	Note          string               `json:"note,omitempty"`
+	QuotedAt      time.Time            `json:"quotedAt"` // when the legs were last quoted
+}
+
+// PositionsRiskTotals sums the open positions. Greeks are those of the open
+// trades and of the legs held outside them.
+type PositionsRiskTotals struct {
+	Positions     int                  `json:"positions"`
+	Stale         int                  `json:"stale"`
+	UnrealizedPnL float64              `json:"unrealizedPnl"`
+	MaxProfit     float64              `json:"maxProfit"`
+	MaxLoss       float64              `json:"maxLoss"`
+	Greeks        risk.PortfolioGreeks `json:"greeks"`
+}
+
+// PositionsRisk is the risk of each open trade and of the portfolio. Untracked
+// are the legs the account holds that no open trade accounts for; Note tells
+// why the account's positions are unknown.
+type PositionsRisk struct {
+	Positions  []PositionRisk      `json:"positions"`
+	Untracked  []risk.LegExposure  `json:"untracked,omitempty"`
+	Totals     PositionsRiskTotals `json:"totals"`
+	Note       string              `json:"note,omitempty"`
+	ComputedAt time.Time           `json:"computedAt"`
+}
+
+// GetPositionsRisk refreshes the quotes and Greeks of the open trades of the
+// journal and returns their risk, the same the exit manager and the short
+// leg delta alert evaluate
+func (a *App) GetPositionsRisk() (PositionsRisk, error) {
+	if a.journal == nil {
+		return PositionsRisk{}, fmt.Errorf("trade journal not initialized")
+	}
+	now := time.Now()
+	trades := openTrades(a.journal)
+	rows, _ := a.refreshPositionsRisk(context.Background(), trades, now)
+
+	summary := PositionsRisk{Positions: rows, ComputedAt: now}
+	held, err := a.openExposures()
+	if err != nil {
+		summary.Note = "account positions unknown: " + err.Error()
+	} else {
+		for i, trade := range trades {
+			summary.Positions[i].Held = holdsTrade(held, trade)
+		}
+		summary.Untracked = untrackedLegs(held, trades)
+	}
+	summary.Totals = positionsRiskTotals(summary.Positions, summary.Untracked, now)
+	return summary, nil
+}
+
+// openTrades returns the open trades of the journal that have legs
+func openTrades(j *journal.Journal) []journal.TradeRecord {
+	var trades []journal.TradeRecord
+	for _, trade := range j.GetTrades(journal.TradeFilter{Outcome: "open"}) {
+		if len(trade.Legs) > 0 {
+			trades = append(trades, trade)
+		}
+	}
+	return trades
+}
+
+// refreshPositionsRisk quotes the legs of trades within positionsRiskBudget
+// and returns the risk of each and the quotes of those quoted. A trade not
+// quoted keeps its last-known risk, flagged stale. Short legs newly past
+// AlertsConfig.Thresholds.MaxShortLegDelta are alerted.
+func (a *App) refreshPositionsRisk(ctx context.Context, trades []journal.TradeRecord, now time.Time) ([]PositionRisk, [][]ibkr.OptionQuote) {
+	ctx, cancel := context.WithTimeout(ctx, positionsRiskBudget)
+	defer cancel()
+
+	rows := make([]PositionRisk, len(trades))
+	quotes := make([][]ibkr.OptionQuote, len(trades))
+	errs := make([]error, len(trades))
+	var wg sync.WaitGroup
+	for i, trade := range trades {
+		if a.marketData == nil {
+			errs[i] = ibkr.ErrNotConnected
+			continue
+		}
+		wg.Add(1)
+		go func(i int, trade journal.TradeRecord) {
+			defer wg.Done()
+			legQuotes, err := a.legQuotes(ctx, ibkr.SpreadOrder{Symbol: trade.Symbol, Legs: trade.Legs, Quantity: 1})
+			if err == nil {
+				rows[i], err = tradeRisk(trade, legQuotes, now)
+			}
+			if err == nil {
+				quotes[i] = legQuotes
+			}
+			errs[i] = err
+		}(i, trade)
+	}
+	wg.Wait()
+
+	a.riskMu.Lock()
+	defer a.riskMu.Unlock()
+	known := make(map[int64]PositionRisk, len(trades))
+	for i, trade := range trades {
+		if errs[i] != nil {
+			rows[i] = a.lastRisk[trade.ID]
+			if rows[i].TradeID == 0 {
+				rows[i] = PositionRisk{TradeID: trade.ID, Symbol: strings.ToUpper(trade.Symbol), Strategy: trade.Strategy, Quantity: trade.Quantity, EntryPrice: trade.EntryPrice}
+			}
+			rows[i].Stale, rows[i].Note = true, errs[i].Error()
+		}
+		known[trade.ID] = rows[i]
+	}
+	a.lastRisk = known
+	a.alertShortDeltas(rows)
+	return rows, quotes
+}
+
+// alertShortDeltas raises an alert for each position whose short leg delta
+// newly passes the threshold; a stale position keeps its state. The caller
+// holds riskMu.
+func (a *App) alertShortDeltas(rows []PositionRisk) {
+	limit := a.config.AlertsConfig.Thresholds.MaxShortLegDelta
+	breached := make(map[int64]bool, len(rows))
+	for _, row := range rows {
+		if row.Stale {
+			breached[row.TradeID] = a.deltaBreached[row.TradeID]
+			continue
+		}
+		breached[row.TradeID] = a.config.AlertsConfig.Enabled && limit > 0 && math.Abs(row.ShortDelta) > limit
+		if breached[row.TradeID] && !a.deltaBreached[row.TradeID] {
+			message := fmt.Sprintf("%s trade %d short leg delta %.2f is past %.2f", row.Symbol, row.TradeID, row.ShortDelta, limit)
+			a.raiseAlert(AlertShortLegDelta, notifications.SeverityWarning, message, row)
+		}
+	}
+	a.deltaBreached = breached
+}
+
+// tradeRisk prices trade at the mid prices of quotes, one per leg, and
+// returns its risk with the Greeks of the quotes
+func tradeRisk(trade journal.TradeRecord, quotes []ibkr.OptionQuote, now time.Time) (PositionRisk, error) {
+	row := PositionRisk{
+		TradeID:    trade.ID,
+		Symbol:     strings.ToUpper(trade.Symbol),
+		Strategy:   trade.Strategy,
+		Quantity:   trade.Quantity,
+		EntryPrice: trade.EntryPrice,
+		QuotedAt:   now,
+	}
+	for i, leg := range trade.Legs {
+		quote := quotes[i]
+		if quote.Bid <= 0 || quote.Ask <= 0 {
+			return PositionRisk{}, fmt.Errorf("no bid and ask for leg %d (%s %g%s)", i+1, leg.Expiry, leg.Strike, leg.Right)
+		}
+		mid := (quote.Bid + quote.Ask) / 2 * float64(max(leg.Ratio, 1))
+		if leg.Action == "SELL" {
+			row.CurrentValue += mid
+			if math.Abs(quote.Delta) > math.Abs(row.ShortDelta) {
+				row.ShortDelta = quote.Delta
+			}
+		} else {
+			row.CurrentValue -= mid
+		}
+		if row.Expiry == "" || leg.Expiry < row.Expiry {
+			row.Expiry = leg.Expiry
+		}
+	}
+	if expiry, err := time.Parse("20060102", row.Expiry); err == nil {
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		row.DTE = max(int(expiry.Sub(today).Hours()/24), 0)
+	}
+
+	// The entry price is the credit received, so the premium paid is its
+	// negative; the other side of the trade loses at worst its max profit
+	spread := ibkr.SpreadOrder{Symbol: trade.Symbol, Legs: trade.Legs, Quantity: 1}
+	legs := spreadExposures(spread, quotes, now)
+	maxLoss := risk.MaxLoss(legs, -trade.EntryPrice*risk.DefaultMultiplier)
+	for i := range legs {
+		legs[i].Quantity = -legs[i].Quantity
+	}
+	maxProfit := risk.MaxLoss(legs, trade.EntryPrice*risk.DefaultMultiplier)
+
+	pnl := (trade.EntryPrice - row.CurrentValue) * risk.DefaultMultiplier
+	if maxProfit > 0 {
+		row.ProfitPct = 100 * pnl / maxProfit
+	}
+	if maxLoss > 0 && pnl < 0 {
+		row.LossPct = -100 * pnl / maxLoss
+	}
+	quantity := float64(max(trade.Quantity, 1))
+	row.UnrealizedPnL = pnl * quantity
+	if !math.IsInf(maxProfit, 1) {
+		row.MaxProfit = maxProfit * quantity
+	}
+	if !math.IsInf(maxLoss, 1) {
+		row.MaxLoss = maxLoss * quantity
+	}
+
+	spread.Quantity = max(trade.Quantity, 1)
+	row.Greeks = risk.Aggregate(spreadExposures(spread, quotes, now), now, 0)
+	return row, nil
+}
+
+// untrackedLegs returns what held holds beyond the legs of trades, by
+// contract
+func untrackedLegs(held []risk.LegExposure, trades []journal.TradeRecord) []risk.LegExposure {
+	type contract struct {
+		symbol, expiry, right string
+		strike                float64
+	}
+	var order []contract
+	remaining := make(map[contract]risk.LegExposure)
+	for _, leg := range held {
+		key := contract{strings.ToUpper(leg.Symbol), leg.Expiry, leg.Right, leg.Strike}
+		if existing, ok := remaining[key]; ok {
+			existing.Quantity += leg.Quantity
+			remaining[key] = existing
+			continue
+		}
+		order = append(order, key)
+		remaining[key] = leg
+	}
+	for _, trade := range trades {
+		for _, leg := range trade.Legs {
+			key := contract{strings.ToUpper(trade.Symbol), leg.Expiry, leg.Right, leg.Strike}
+			existing, ok := remaining[key]
+			if !ok {
+				continue
+			}
+			quantity := trade.Quantity * max(leg.Ratio, 1)
+			if leg.Action == "SELL" {
+				quantity = -quantity
+			}
+			existing.Quantity -= quantity
+			remaining[key] = existing
+		}
+	}
+
+	var untracked []risk.LegExposure
+	for _, key := range order {
+		if leg := remaining[key]; leg.Quantity != 0 {
+			untracked = append(untracked, leg)
+		}
+	}
+	return untracked
+}
+
+// positionsRiskTotals sums the positions, the untracked legs adding their
+// Greeks
+func positionsRiskTotals(rows []PositionRisk, untracked []risk.LegExposure, now time.Time) PositionsRiskTotals {
+	totals := PositionsRiskTotals{Positions: len(rows), Greeks: risk.Aggregate(untracked, now, 0)}
+	for _, row := range rows {
+		if row.Stale {
+			totals.Stale++
+		}
+		totals.UnrealizedPnL += row.UnrealizedPnL
+		totals.MaxProfit += row.MaxProfit
+		totals.MaxLoss += row.MaxLoss
+		totals.Greeks.Delta += row.Greeks.Delta
+		totals.Greeks.Gamma += row.Greeks.Gamma
+		totals.Greeks.Vega += row.Greeks.Vega
+		totals.Greeks.Theta += row.Greeks.Theta
+		totals.Greeks.LegCount += row.Greeks.LegCount
+	}
+	totals.Greeks.Stale = totals.Stale > 0
+	return totals
+}
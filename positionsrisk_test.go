@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"traderadmin/backend/ibkr"
+	"traderadmin/backend/journal"
+	"traderadmin/backend/notifications"
+	"traderadmin/backend/risk"
+)
+
+// scriptedChain quotes options from a script by symbol and strike, failing
+// the symbols marked down, and records the deadline each request had
+type scriptedChain struct {
+	spreadQuotes
+
+	mu        sync.Mutex
+	quotes    map[string]map[float64]ibkr.OptionQuote
+	down      map[string]bool
+	deadlines []time.Duration
+}
+
+func (c *scriptedChain) OptionSnapshots(ctx context.Context, symbol string, options []ibkr.OptionKey) ([]ibkr.OptionQuote, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if deadline, ok := ctx.Deadline(); ok {
+		c.deadlines = append(c.deadlines, time.Until(deadline))
+	}
+	if c.down[symbol] {
+		return nil, errors.New("snapshot timed out")
+	}
+	snapshots := make([]ibkr.OptionQuote, len(options))
+	for i, option := range options {
+		snapshots[i] = c.quotes[symbol][option.Strike]
+		snapshots[i].OptionKey = option
+	}
+	return snapshots, nil
+}
+
+// riskTestApp returns an app whose journal holds two SPY bull put spreads
+// opened for a credit of 1.25 and a QQQ bear call spread opened for 1.00,
+// whose account holds the SPY legs and an IWM put no trade accounts for,
+// with the alerts it raises
+func riskTestApp(t *testing.T) (*App, *scriptedChain, *[]notifications.NotificationEvent) {
+	t.Helper()
+	app, events := notifyingApp(t)
+	var err error
+	if app.journal, err = journal.Open(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	for _, trade := range []journal.TradeRecord{
+		{Symbol: "SPY", Strategy: "HIGH_BASE", Legs: testSpread().Legs, Quantity: 2, EntryPrice: 1.25},
+		{Symbol: "QQQ", Strategy: "LOW_BASE", Quantity: 1, EntryPrice: 1.0, Legs: []ibkr.OptionLeg{
+			{Strike: 450, Expiry: "20240216", Right: "C", Action: "SELL", Ratio: 1},
+			{Strike: 455, Expiry: "20240216", Right: "C", Action: "BUY", Ratio: 1},
+		}},
+	} {
+		if _, err := app.journal.RecordTrade(trade); err != nil {
+			t.Fatal(err)
+		}
+	}
+	app.exposures = &fakeExposures{legs: []risk.LegExposure{
+		{Symbol: "SPY", Strike: 400, Expiry: "20240119", Right: "P", Quantity: -2},
+		{Symbol: "SPY", Strike: 395, Expiry: "20240119", Right: "P", Quantity: 2},
+		{Symbol: "IWM", Strike: 200, Expiry: "20240119", Right: "P", Quantity: -1, Greeks: risk.Greeks{Delta: -0.2}},
+	}}
+	chain := &scriptedChain{
+		quotes: map[string]map[float64]ibkr.OptionQuote{
+			"SPY": {
+				400: {Bid: 1.0, Ask: 1.1, Delta: -0.45},
+				395: {Bid: 0.42, Ask: 0.46, Delta: -0.30},
+			},
+			"QQQ": {
+				450: {Bid: 2.0, Ask: 2.2, Delta: 0.35},
+				455: {Bid: 1.0, Ask: 1.1, Delta: 0.25},
+			},
+		},
+		down: make(map[string]bool),
+	}
+	app.marketData = chain
+	app.config.AlertsConfig.Enabled = true
+	app.config.AlertsConfig.Thresholds.MaxShortLegDelta = 0.4
+	return app, chain, events
+}
+
+func TestPositionsRisk(t *testing.T) {
+	app, chain, events := riskTestApp(t)
+	near := func(got, want float64) bool { return math.Abs(got-want) < 1e-9 }
+
+	summary, err := app.GetPositionsRisk()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Positions) != 2 {
+		t.Fatalf("Positions = %+v, want SPY and QQQ", summary.Positions)
+	}
+
+	// The SPY spreads close for 0.61: 64 a spread of their max profit of 125
+	spy := summary.Positions[0]
+	if spy.Symbol != "SPY" || !near(spy.CurrentValue, 0.61) || !near(spy.UnrealizedPnL, 128) || !near(spy.ProfitPct, 51.2) ||
+		!near(spy.MaxProfit, 250) || !near(spy.MaxLoss, 750) || spy.LossPct != 0 {
+		t.Errorf("SPY = %+v, want 51.2%% of a max profit of 250", spy)
+	}
+	if spy.ShortDelta != -0.45 || spy.Expiry != "20240119" || !near(spy.Greeks.Delta, 30) || !spy.Held || spy.Stale {
+		t.Errorf("SPY short delta %g, expiry %s, delta %g, held %v, stale %v; want -0.45 on 20240119, 30, held", spy.ShortDelta, spy.Expiry, spy.Greeks.Delta, spy.Held, spy.Stale)
+	}
+
+	// The QQQ spread closes for 1.05, 5 of its max loss of 400, and its legs
+	// are not held
+	qqq := summary.Positions[1]
+	if !near(qqq.CurrentValue, 1.05) || !near(qqq.LossPct, 1.25) || !near(qqq.MaxLoss, 400) || qqq.ShortDelta != 0.35 || qqq.Held {
+		t.Errorf("QQQ = %+v, want 1.25%% of a max loss of 400 and not held", qqq)
+	}
+
+	if len(summary.Untracked) != 1 || summary.Untracked[0].Symbol != "IWM" {
+		t.Errorf("Untracked = %+v, want the IWM put", summary.Untracked)
+	}
+	totals := summary.Totals
+	if totals.Positions != 2 || totals.Stale != 0 || !near(totals.UnrealizedPnL, 123) || !near(totals.Greeks.Delta, 40) || totals.Greeks.LegCount != 5 {
+		t.Errorf("Totals = %+v, want P&L 123 and delta 40 over 5 legs", totals)
+	}
+	for _, remaining := range chain.deadlines {
+		if remaining > positionsRiskBudget {
+			t.Errorf("Quotes requested with %s left, want at most %s", remaining, positionsRiskBudget)
+		}
+	}
+
+	// QQQ can no longer be quoted, so keeps its last values flagged stale;
+	// the SPY short leg stays past 0.4 and is alerted once
+	chain.down["QQQ"] = true
+	summary, err = app.GetPositionsRisk()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if qqq := summary.Positions[1]; !qqq.Stale || qqq.Note == "" || !near(qqq.CurrentValue, 1.05) || summary.Totals.Stale != 1 {
+		t.Errorf("QQQ down = %+v, want its last values flagged stale", qqq)
+	}
+	alerts := 0
+	for _, event := range *events {
+		if event.Category == notifications.CategoryAlert {
+			alerts++
+		}
+	}
+	if alerts != 1 {
+		t.Errorf("Alerts = %d, want one for the SPY short leg", alerts)
+	}
+}
+
+func TestExitManagerUsesPositionsRisk(t *testing.T) {
+	app, chain, _ := riskTestApp(t)
+	app.config.ExitManagement.TargetProfitPct = 50
+
+	statuses := app.evaluateExits(context.Background(), time.Now())
+	if len(statuses) != 2 || statuses[0].Reason != journal.ExitTargetProfit || math.Abs(statuses[0].ProfitPct-51.2) > 1e-9 {
+		t.Fatalf("Statuses = %+v, want SPY at its target at 51.2%%", statuses)
+	}
+
+	// A stale position is not evaluated on its last values
+	chain.down["SPY"] = true
+	if statuses := app.evaluateExits(context.Background(), time.Now()); !statuses[0].Stale || statuses[0].Reason != "" {
+		t.Errorf("SPY down = %+v, want stale and not evaluated", statuses[0])
+	}
+}
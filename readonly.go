@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ReadOnlyChangedEvent is emitted with the new IsReadOnly value whenever a
+// configuration change turns read-only mode on or off
+const ReadOnlyChangedEvent = "readonly:changed"
+
+// ErrReadOnlyMode is returned by methods that change the trading services,
+// containers or cluster while the active account's ReadOnlyAPI is set and no
+// override is active
+var ErrReadOnlyMode = errors.New("read-only mode")
+
+// IsReadOnly reports whether TraderAdmin is in read-only mode, in which the
+// methods changing the trading stack are rejected
+func (a *App) IsReadOnly() bool {
+	return a.config.activeIBKRAccount().ReadOnlyAPI
+}
+
+// SetReadOnlyOverride lets the methods guarded by read-only mode run anyway,
+// until it is cleared or read-only mode is turned on again
+func (a *App) SetReadOnlyOverride(enabled bool) {
+	a.readOnlyOverride = enabled
+	log.Warn().Bool("enabled", enabled).Bool("read_only", a.IsReadOnly()).Msg("Read-only override changed")
+}
+
+// requireWritable returns ErrReadOnlyMode for operation in read-only mode,
+// unless overridden, and ErrDryRun in dry-run mode for operations that
+// cannot simulate their effects. Every bound method that changes the trading
+// services, containers, cluster or orders calls it before anything else.
+func (a *App) requireWritable(operation string) error {
+	if !a.IsReadOnly() {
+		return a.requireLive(operation)
+	}
+	if a.readOnlyOverride {
+		log.Warn().Str("operation", operation).Msg("Allowed in read-only mode by override")
+		return a.requireLive(operation)
+	}
+	log.Warn().Str("operation", operation).Msg("Rejected in read-only mode")
+	return fmt.Errorf("%s: %w", operation, ErrReadOnlyMode)
+}
+
+// setConfig replaces the configuration, emitting ReadOnlyChangedEvent and
+// DryRunChangedEvent when read-only or dry-run mode flips. Turning read-only
+// mode on clears the override.
+func (a *App) setConfig(config Configuration) {
+	was, wasDryRun, previousDocker := a.IsReadOnly(), a.IsDryRun(), a.config.Docker
+	previousIBKR, previousAccount := a.config.ibkrConnectionConfig(), a.config.activeIBKRAccount()
+	previousContainers, previousEvents := a.config.Containers, a.config.EventCalendar
+	a.config = config
+
+	// The cache holds the containers the previous [containers] listed
+	if !reflect.DeepEqual(config.Containers, previousContainers) {
+		a.containers.invalidate()
+	}
+
+	// The IBKR connections start once the app has, with the first config, and
+	// restart when the active account or its settings change
+	changedIBKR := config.ibkrConnectionConfig() != previousIBKR || config.activeIBKRAccount() != previousAccount
+	if a.bgCtx != nil && (a.ibkrConnections() == nil || changedIBKR) {
+		a.startIBKRConnections()
+	}
+
+	if config.EventCalendar != previousEvents {
+		a.configureEventCalendar()
+	}
+
+	// The embedded scanner rereads its config file with TraderAdmin's
+	if config.ScannerConfig.Embedded {
+		a.reloadEmbeddedScanner()
+	}
+
+	if a.notifications != nil {
+		if err := a.notifications.SetRetention(config.notificationRetention()); err != nil {
+			log.Warn().Err(err).Msg("Failed to apply notification retention")
+		}
+	}
+
+	a.dockerMu.RLock()
+	configured := a.docker != nil
+	a.dockerMu.RUnlock()
+	if !configured || config.Docker != previousDocker {
+		a.configureDocker()
+	}
+
+	if now := a.IsReadOnly(); now != was {
+		if now {
+			a.readOnlyOverride = false
+		}
+		log.Info().Bool("read_only", now).Msg("Read-only mode changed")
+		a.emitEvent(ReadOnlyChangedEvent, now)
+	}
+	if dryRun := a.IsDryRun(); dryRun != wasDryRun {
+		log.Info().Bool("dry_run", dryRun).Msg("Dry-run mode changed")
+		a.emitEvent(DryRunChangedEvent, dryRun)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// guardedMethods change the trading services, containers, cluster or orders
+// and are rejected in read-only mode
+var guardedMethods = map[string]bool{
+	"CancelOrder":                 true,
+	"DeployStack":                 true,
+	"EmergencyStop":               true,
+	"PauseStack":                  true,
+	"PauseTradingServices":        true,
+	"PlaceSpreadOrder":            true,
+	"PullLatestImages":            true,
+	"PushConfigToCluster":         true,
+	"RecreateWithLatest":          true,
+	"ReloadStackConfig":           true,
+	"RestartContainer":            true,
+	"ResumeTradingServices":       true,
+	"RevertToAuditEntry":          true,
+	"RolloutRestartDeployment":    true,
+	"SaveConfigurationAndRestart": true,
+	"ScaleDeployment":             true,
+	"SetRestartPolicy":            true,
+	"StartStack":                  true,
+	"StopStack":                   true,
+	"UndeployStack":               true,
+	"UnpauseStack":                true,
+}
+
+// unguardedMethods only read state, or change TraderAdmin's own files: the
+// configuration, journal, universe and notifications, so read-only mode can
+// be turned off
+var unguardedMethods = map[string]bool{
+	"AddSymbol":                     true,
+	"AddWatchlist":                  true,
+	"ApplyConfigPreset":             true,
+	"CalculatePositionSize":         true,
+	"CancelAdHocScan":               true,
+	"CancelClearCache":              true,
+	"CheckForImageUpdates":          true,
+	"CheckHealth":                   true,
+	"CheckNewPositionAgainstLimits": true,
+	"ClearCache":                    true,
+	"DeleteConfigPreset":            true,
+	"ExportPreset":                  true,
+	"ExportTradeHistory":            true,
+	"FetchOptionChain":              true,
+	"FetchSymbolData":               true,
+	"GetBackendStatus":              true,
+	"GetCacheStats":                 true,
+	"GetConfig":                     true,
+	"GetConfigAuditLog":             true,
+	"GetConfigSchema":               true,
+	"GetConfigWarnings":             true,
+	"GetContainers":                 true,
+	"GetEquityHistory":              true,
+	"GetExitStatus":                 true,
+	"GetIBKRConnections":            true,
+	"GetIVRank":                     true,
+	"GetLatestMetrics":              true,
+	"GetNotifications":              true,
+	"GetOpenOrders":                 true,
+	"GetOptionChainFiltered":        true,
+	"GetPortfolioGreeks":            true,
+	"GetPositionsRisk":              true,
+	"GetSpreadCandidates":           true,
+	"GetStatus":                     true,
+	"GetStrategyParameterSchema":    true,
+	"GetSubAccountPositions":        true,
+	"GetTradeHistory":               true,
+	"GetUniverse":                   true,
+	"GetUniverseMetadata":           true,
+	"GetUnreadNotificationCount":    true,
+	"ImportPreset":                  true,
+	"IsConfigLoaded":                true,
+	"IsDryRun":                      true,
+	"IsReadOnly":                    true,
+	"IsViewerMode":                  true,
+	"ListConfigPresets":             true,
+	"ListManagedDeployments":        true,
+	"ListScanStrategies":            true,
+	"ListWatchlists":                true,
+	"LoadConfig":                    true,
+	"MarkNotificationsRead":         true,
+	"PreviewOrder":                  true,
+	"PullConfigFromCluster":         true,
+	"RecordTrade":                   true,
+	"RemoveSymbol":                  true,
+	"RemoveWatchlist":               true,
+	"RunAdHocScan":                  true,
+	"SaveConfig":                    true,
+	"SaveConfigPreset":              true,
+	"SelectExpiration":              true,
+	"SetDryRun":                     true,
+	"SetReadOnlyOverride":           true,
+	"SwitchAccount":                 true,
+	"SyncFromCluster":               true,
+	"TestAlertNotification":         true,
+	"TestDockerConnection":          true,
+	"TestIBKRConnection":            true,
+	"UpdateConfig":                  true,
+	"UpdateStrategyDefaults":        true,
+	"UpdateTradeOutcome":            true,
+	"ValidateConfig":                true,
+}
+
+// callBound calls the bound method with zero arguments and returns its error
+func callBound(t *testing.T, app *App, name string) error {
+	t.Helper()
+	method := reflect.ValueOf(app).MethodByName(name)
+	args := make([]reflect.Value, method.Type().NumIn())
+	for i := range args {
+		args[i] = reflect.Zero(method.Type().In(i))
+	}
+	results := method.Call(args)
+	err, _ := results[len(results)-1].Interface().(error)
+	return err
+}
+
+func TestReadOnlyModeGuardsEveryMutatingMethod(t *testing.T) {
+	app := NewApp()
+	app.config.IBKRConnection.Accounts = []IBKRAccount{{Name: "paper", ReadOnlyAPI: true}}
+
+	appType := reflect.TypeOf(app)
+	for i := 0; i < appType.NumMethod(); i++ {
+		name := appType.Method(i).Name
+		if !guardedMethods[name] {
+			if !unguardedMethods[name] {
+				t.Errorf("%s is bound but not classified as guarded or unguarded in read-only mode", name)
+			}
+			continue
+		}
+		if err := callBound(t, app, name); !errors.Is(err, ErrReadOnlyMode) {
+			t.Errorf("%s() error = %v, want ErrReadOnlyMode", name, err)
+		}
+	}
+}
+
+func TestReadOnlyOverride(t *testing.T) {
+	app := NewApp()
+	app.config.IBKRConnection.Accounts = []IBKRAccount{{Name: "paper", ReadOnlyAPI: true}}
+
+	app.SetReadOnlyOverride(true)
+	if err := callBound(t, app, "PauseStack"); errors.Is(err, ErrReadOnlyMode) {
+		t.Errorf("PauseStack() error = %v with the override set", err)
+	}
+
+	// Turning read-only mode on again clears the override
+	config := app.config
+	config.IBKRConnection.Accounts = []IBKRAccount{{Name: "paper"}}
+	app.setConfig(config)
+	config.IBKRConnection.Accounts = []IBKRAccount{{Name: "paper", ReadOnlyAPI: true}}
+	app.setConfig(config)
+	if err := callBound(t, app, "PauseStack"); !errors.Is(err, ErrReadOnlyMode) {
+		t.Errorf("PauseStack() error = %v, want the override cleared", err)
+	}
+}
+
+func TestSetConfigEmitsReadOnlyChanges(t *testing.T) {
+	app := NewApp()
+	var events []bool
+	app.emit = func(name string, data ...interface{}) {
+		if name == ReadOnlyChangedEvent {
+			events = append(events, data[0].(bool))
+		}
+	}
+
+	config := app.config
+	config.IBKRConnection.Accounts = []IBKRAccount{{Name: "paper", ReadOnlyAPI: true}}
+	app.setConfig(config)
+	app.setConfig(config)
+	config.IBKRConnection.Accounts = []IBKRAccount{{Name: "paper"}}
+	app.setConfig(config)
+
+	if len(events) != 2 || !events[0] || events[1] {
+		t.Errorf("Events = %v, want a flip on then off", events)
+	}
+}
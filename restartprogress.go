@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ErrOperationInProgress is returned by SaveConfigurationAndRestart while
+// another call is still running
+var ErrOperationInProgress = errors.New("operation in progress")
+
+// RestartProgressEvent is emitted with a RestartProgress as
+// SaveConfigurationAndRestart starts and finishes each step
+const RestartProgressEvent = "restart:progress"
+
+// Steps of SaveConfigurationAndRestart, the step of a RestartProgress, with
+// RestartDone ending a finished call
+const (
+	RestartValidate = "validate"
+	RestartPause    = "pause"
+	RestartBackup   = "backup"
+	RestartSave     = "save"
+	RestartReload   = "reload"
+	RestartResume   = "resume"
+	RestartDone     = "done"
+)
+
+// restartPercent is how far through SaveConfigurationAndRestart each step
+// starts
+var restartPercent = map[string]int{
+	RestartValidate: 0,
+	RestartPause:    15,
+	RestartBackup:   35,
+	RestartSave:     50,
+	RestartReload:   65,
+	RestartResume:   80,
+	RestartDone:     100,
+}
+
+// States of a RestartProgress and of its services
+const (
+	ProgressRunning   = "running"
+	ProgressSucceeded = "succeeded"
+	ProgressFailed    = "failed"
+	ProgressSkipped   = "skipped"
+)
+
+// RestartProgress is a step of SaveConfigurationAndRestart starting or
+// finishing. Services are the trading services the pause and resume steps
+// act on, with their state.
+type RestartProgress struct {
+	Operation string            `json:"operation"`
+	Step      string            `json:"step"`
+	Percent   int               `json:"percent"`
+	State     string            `json:"state"`
+	Error     string            `json:"error,omitempty"`
+	Services  []ServiceProgress `json:"services,omitempty"`
+	DryRun    bool              `json:"dryRun"`
+}
+
+// ServiceProgress is the state of a trading service in a step
+type ServiceProgress struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+}
+
+// operationGuard lets one operation run at a time; its zero value is idle
+type operationGuard struct {
+	mu      sync.Mutex
+	running string
+}
+
+// begin claims the guard for operation, or returns ErrOperationInProgress
+// while another holds it
+func (g *operationGuard) begin(operation string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.running != "" {
+		return fmt.Errorf("%s: %w: %s is still running", operation, ErrOperationInProgress, g.running)
+	}
+	g.running = operation
+	return nil
+}
+
+// end returns the guard to idle; callers defer it right after begin so that
+// a failed step cannot leave it claimed
+func (g *operationGuard) end() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.running = ""
+}
+
+// restartProgress emits the progress of one SaveConfigurationAndRestart call
+type restartProgress struct {
+	app    *App
+	exec   *commandExecutor
+	step   string
+	failed bool
+}
+
+// start emits step as running
+func (p *restartProgress) start(step string) {
+	p.step = step
+	p.emit(ProgressRunning, nil, nil)
+}
+
+// succeed emits the current step as succeeded, with the state of services
+func (p *restartProgress) succeed(services []ServiceProgress) {
+	p.emit(ProgressSucceeded, nil, services)
+}
+
+// skip emits step as skipped
+func (p *restartProgress) skip(step string) {
+	p.step = step
+	p.emit(ProgressSkipped, nil, nil)
+}
+
+// fail emits the current step as failed with err
+func (p *restartProgress) fail(err error, services []ServiceProgress) {
+	p.failed = true
+	p.emit(ProgressFailed, err, services)
+}
+
+// finish emits RestartDone unless the call failed, and otherwise the
+// failure of the step it stopped at when no step reported it
+func (p *restartProgress) finish(err error) {
+	switch {
+	case err == nil:
+		p.step = RestartDone
+		p.emit(ProgressSucceeded, nil, nil)
+	case !p.failed:
+		p.fail(err, nil)
+	}
+}
+
+func (p *restartProgress) emit(state string, err error, services []ServiceProgress) {
+	progress := RestartProgress{
+		Operation: p.exec.operation,
+		Step:      p.step,
+		Percent:   restartPercent[p.step],
+		State:     state,
+		Services:  services,
+		DryRun:    p.exec.dryRun,
+	}
+	if state == ProgressSucceeded || state == ProgressSkipped {
+		progress.Percent = nextRestartPercent(p.step)
+	}
+	if err != nil {
+		progress.Error = err.Error()
+	}
+	log.Debug().Str("step", progress.Step).Str("state", state).Int("percent", progress.Percent).Msg("Save and restart progress")
+	p.app.emitEvent(RestartProgressEvent, progress)
+}
+
+// nextRestartPercent is how far through SaveConfigurationAndRestart a
+// finished step is, where the following step starts
+func nextRestartPercent(step string) int {
+	next := 100
+	for _, percent := range restartPercent {
+		if percent > restartPercent[step] && percent < next {
+			next = percent
+		}
+	}
+	return next
+}
+
+// tradingServiceProgress returns the trading services the pause and resume
+// steps act on, all in state
+func (a *App) tradingServiceProgress(state string) []ServiceProgress {
+	deployments := a.tradingDeployments()
+	services := make([]ServiceProgress, len(deployments))
+	for i, name := range deployments {
+		services[i] = ServiceProgress{Name: name, State: state}
+	}
+	return services
+}
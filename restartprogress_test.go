@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// restartTestApp returns an app saving to a temporary directory through a
+// reachable orchestrator, the configuration to save and the progress events
+// it emits
+func restartTestApp(t *testing.T, fake *fakeOrchestrator) (*App, map[string]interface{}, func() []RestartProgress) {
+	t.Helper()
+	app := NewApp()
+	app.configPath = filepath.Join(t.TempDir(), "config.toml")
+	serveOrchestrator(t, app, fake)
+
+	config := validConfig()
+	config.Orchestrator.Address = app.config.Orchestrator.Address
+	data, _ := json.Marshal(config)
+	var configData map[string]interface{}
+	if err := json.Unmarshal(data, &configData); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var events []RestartProgress
+	app.emit = func(name string, data ...interface{}) {
+		if name == RestartProgressEvent {
+			mu.Lock()
+			events = append(events, data[0].(RestartProgress))
+			mu.Unlock()
+		}
+	}
+	return app, configData, func() []RestartProgress {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]RestartProgress(nil), events...)
+	}
+}
+
+func TestSaveConfigurationAndRestartRunsOneAtATime(t *testing.T) {
+	fake := &fakeOrchestrator{active: true, pausing: make(chan struct{})}
+	app, configData, events := restartTestApp(t, fake)
+
+	results := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := app.SaveConfigurationAndRestart(configData)
+			results <- err
+		}()
+	}
+	// One call waits in the pause step, so the other is turned away
+	if err := <-results; !errors.Is(err, ErrOperationInProgress) {
+		t.Errorf("Concurrent SaveConfigurationAndRestart() error = %v, want ErrOperationInProgress", err)
+	}
+	close(fake.pausing)
+	if err := <-results; err != nil {
+		t.Errorf("SaveConfigurationAndRestart() error = %v", err)
+	}
+	if strings.Join(fake.calls, ",") != "pause,reload,resume" {
+		t.Errorf("Orchestrator calls = %v, want one pause, reload and resume", fake.calls)
+	}
+	if backups, _ := filepath.Glob(app.configPath + ".bak.*"); len(backups) != 0 {
+		t.Errorf("Backups = %v, want none of a config written only once", backups)
+	}
+
+	var steps []string
+	for _, progress := range events() {
+		steps = append(steps, progress.Step+":"+progress.State)
+	}
+	want := "validate:running validate:succeeded pause:running pause:succeeded backup:running backup:succeeded " +
+		"save:running save:succeeded reload:running reload:succeeded resume:running resume:succeeded done:succeeded"
+	if got := strings.Join(steps, " "); got != want {
+		t.Errorf("Progress = %s\nwant %s", got, want)
+	}
+	all := events()
+	if last := all[len(all)-1]; last.Percent != 100 {
+		t.Errorf("Last progress = %+v, want 100%%", last)
+	}
+	if paused := all[3]; len(paused.Services) != 1 || paused.Services[0].State != "paused" || paused.Percent != 35 {
+		t.Errorf("Pause progress = %+v, want the orchestrator deployment paused at 35%%", paused)
+	}
+}
+
+func TestSaveConfigurationAndRestartRecoversFromAFailedStep(t *testing.T) {
+	fake := &fakeOrchestrator{active: true}
+	app, configData, events := restartTestApp(t, fake)
+	configPath := app.configPath
+	app.configPath = filepath.Join(t.TempDir(), "missing", "config.toml")
+
+	if _, err := app.SaveConfigurationAndRestart(configData); err == nil {
+		t.Fatal("SaveConfigurationAndRestart() into a missing directory should fail")
+	}
+	all := events()
+	if last := all[len(all)-1]; last.Step != RestartSave || last.State != ProgressFailed || last.Error == "" {
+		t.Errorf("Last progress = %+v, want the save step failed", last)
+	}
+
+	// The failure left the guard idle
+	app.configPath = configPath
+	app.servicesPaused = false
+	if _, err := app.SaveConfigurationAndRestart(configData); err != nil {
+		t.Errorf("SaveConfigurationAndRestart() after a failure error = %v", err)
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	engine "github.com/trustdan/ibkr-trader/go/pkg/scanner"
+
+	"traderadmin/backend/scanner"
+)
+
+// Default scanner address when [scanner_config] leaves it unset
+const (
+	defaultScannerHost = "localhost"
+	defaultScannerPort = 50051
+)
+
+// maxPreviewBars bounds the bars FetchSymbolData returns for charting
+const maxPreviewBars = 500
+
+// scannerFetchTimeout bounds one FetchSymbolData call
+const scannerFetchTimeout = 30 * time.Second
+
+// symbolMetadataTimeout bounds looking up the scanner's symbol metadata
+const symbolMetadataTimeout = 5 * time.Second
+
+// scannerVersionTimeout bounds asking the scanner for its version
+const scannerVersionTimeout = 2 * time.Second
+
+// ScannerIncompatibleEvent is emitted with the ScannerStatus when the
+// scanner's protocol is incompatible with TraderAdmin's
+const ScannerIncompatibleEvent = "scanner:incompatible"
+
+// ScannerStatus is the version the scanner reports and its compatibility
+// with TraderAdmin
+type ScannerStatus struct {
+	Address   string `json:"address"`
+	Reachable bool   `json:"reachable"`
+	Error     string `json:"error,omitempty"`
+	scanner.VersionInfo
+	scanner.Compatibility
+}
+
+// embeddedScannerAddress is the address reported for the embedded scanner
+const embeddedScannerAddress = "embedded"
+
+// scannerAddress returns the host:port of the scanner service, or
+// embeddedScannerAddress when the scanner is embedded
+func (a *App) scannerAddress() string {
+	if a.config.ScannerConfig.Embedded {
+		return embeddedScannerAddress
+	}
+	host, port := a.config.ScannerConfig.Host, a.config.ScannerConfig.Port
+	if host == "" {
+		host = defaultScannerHost
+	}
+	if port == 0 {
+		port = defaultScannerPort
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// scannerClient returns the client of the configured scanner, replacing the
+// connection when the address has changed. The embedded scanner is started
+// when switched to and stopped when switched from.
+func (a *App) scannerClient() (*scanner.Client, error) {
+	address := a.scannerAddress()
+
+	a.scannerMu.Lock()
+	defer a.scannerMu.Unlock()
+	if a.scanner != nil && a.scannerAddr == address {
+		return a.scanner, nil
+	}
+	var client *scanner.Client
+	var err error
+	if address == embeddedScannerAddress {
+		client, err = a.startEmbeddedScanner()
+	} else {
+		if a.embeddedScanner != nil {
+			a.embeddedScanner.Stop()
+		}
+		client, err = scanner.Dial(address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if a.scanner != nil {
+		a.scanner.Close()
+	}
+	a.scanner, a.scannerAddr, a.scannerVersion = client, address, nil
+	return client, nil
+}
+
+// embeddedScannerConfig loads the configuration of the embedded scanner from
+// [scanner_config] config_file, logging the keys the scanner does not know
+func (a *App) embeddedScannerConfig() (*engine.Config, error) {
+	path := a.config.ScannerConfig.ConfigFile
+	if path != "" && !filepath.IsAbs(path) {
+		path = filepath.Join(a.configDir(), path)
+	}
+	cfg, warnings, err := scanner.LoadEmbeddedConfig(path)
+	if err != nil {
+		return nil, fmt.Errorf("embedded scanner config: %w", err)
+	}
+	for _, warning := range warnings {
+		log.Warn().Str("key", warning.Key).Str("suggestion", warning.Suggestion).Msg(warning.Message)
+	}
+	return cfg, nil
+}
+
+// startEmbeddedScanner starts the embedded scanner with its current
+// configuration, creating it on first use, and returns its client.
+// a.scannerMu must be held.
+func (a *App) startEmbeddedScanner() (*scanner.Client, error) {
+	cfg, err := a.embeddedScannerConfig()
+	if err != nil {
+		return nil, err
+	}
+	if a.embeddedScanner == nil {
+		a.embeddedScanner = scanner.NewEmbedded(cfg, a.metrics)
+	} else {
+		a.embeddedScanner.Reload(cfg)
+	}
+	ctx := a.bgCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	a.embeddedScanner.Start(ctx)
+	log.Info().Str("config_file", a.config.ScannerConfig.ConfigFile).Msg("Started the embedded scanner")
+	return a.embeddedScanner.Client(), nil
+}
+
+// reloadEmbeddedScanner rereads the embedded scanner's config file, when the
+// embedded scanner is running, keeping its configuration when the file does
+// not load
+func (a *App) reloadEmbeddedScanner() {
+	a.scannerMu.Lock()
+	defer a.scannerMu.Unlock()
+	if a.embeddedScanner == nil || a.scanner == nil || a.scannerAddr != embeddedScannerAddress {
+		return
+	}
+	cfg, err := a.embeddedScannerConfig()
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to reload the embedded scanner")
+		return
+	}
+	a.embeddedScanner.Reload(cfg)
+}
+
+// scannerStatus returns the scanner's version and compatibility, asking the
+// scanner once per connection and, until it answers, on every call. An
+// incompatible scanner is logged and emitted as ScannerIncompatibleEvent
+// when first seen.
+func (a *App) scannerStatus() *ScannerStatus {
+	client, err := a.scannerClient()
+	if err != nil {
+		return &ScannerStatus{Address: a.scannerAddress(), Error: err.Error()}
+	}
+	a.scannerMu.Lock()
+	checked := a.scannerVersion
+	a.scannerMu.Unlock()
+	if checked != nil {
+		return checked
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), scannerVersionTimeout)
+	defer cancel()
+	info, err := client.Version(ctx)
+	status := &ScannerStatus{Address: a.scannerAddress()}
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.Reachable, status.VersionInfo, status.Compatibility = true, info, scanner.ClientProtocol.Check(info)
+
+	a.scannerMu.Lock()
+	if a.scanner == client {
+		a.scannerVersion = status
+	}
+	a.scannerMu.Unlock()
+	switch {
+	case !status.Compatible:
+		log.Warn().Str("version", info.Version).Int("protocol", info.ProtocolVersion).Str("reason", status.Reason).Msg("Scanner is incompatible with TraderAdmin")
+		a.emitEvent(ScannerIncompatibleEvent, *status)
+	case status.Reason != "":
+		log.Warn().Str("version", info.Version).Strs("disabled", status.DisabledFeatures).Str("reason", status.Reason).Msg("Scanner is too old for some features")
+	}
+	return status
+}
+
+// requireScannerFeature refuses feature once the connected scanner's version
+// is known not to support it
+func (a *App) requireScannerFeature(feature string) error {
+	a.scannerMu.Lock()
+	status := a.scannerVersion
+	a.scannerMu.Unlock()
+	if status != nil && !status.Enabled(feature) {
+		return fmt.Errorf("%s: %w: %s", feature, scanner.ErrIncompatible, status.Reason)
+	}
+	return nil
+}
+
+// FetchSymbolData returns the daily bars the scanner serves for symbol
+// between startDate and endDate (YYYY-MM-DD), merged down to at most
+// maxPreviewBars for charting. Errors wrap scanner.ErrUnreachable,
+// scanner.ErrIncompatible or scanner.ErrNoData.
+func (a *App) FetchSymbolData(symbol, startDate, endDate string) ([]scanner.MarketData, error) {
+	symbol = strings.ToUpper(strings.TrimSpace(symbol))
+	if symbol == "" {
+		return nil, fmt.Errorf("symbol is required")
+	}
+	for _, date := range []string{startDate, endDate} {
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return nil, fmt.Errorf("dates must be YYYY-MM-DD, got %q", date)
+		}
+	}
+
+	client, err := a.scannerClient()
+	if err != nil {
+		return nil, err
+	}
+	if err := a.requireScannerFeature(scanner.FeatureSymbolData); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), scannerFetchTimeout)
+	defer cancel()
+	bars, err := client.FetchBars(ctx, symbol, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	return scanner.Downsample(bars, maxPreviewBars), nil
+}
+
+// lookupSymbolMetadata returns the scanner's metadata of symbols, in order,
+// from the metadata cache. Errors wrap scanner.ErrUnreachable or
+// scanner.ErrIncompatible.
+func (a *App) lookupSymbolMetadata(symbols []string) ([]scanner.SymbolMetadata, error) {
+	client, err := a.scannerClient()
+	if err != nil {
+		return nil, err
+	}
+	if err := a.requireScannerFeature(scanner.FeatureSymbolMetadata); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), symbolMetadataTimeout)
+	defer cancel()
+	return a.symbolMetadata.Lookup(ctx, client, symbols)
+}
+
+// GetUniverseMetadata returns the sector, industry and market cap the
+// scanner holds for each symbol of the universe, in universe order. Symbols
+// the scanner has no metadata for are reported with Present unset.
+func (a *App) GetUniverseMetadata() ([]scanner.SymbolMetadata, error) {
+	symbols := a.GetUniverse()
+	if len(symbols) == 0 {
+		return []scanner.SymbolMetadata{}, nil
+	}
+	return a.lookupSymbolMetadata(symbols)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"google.golang.org/grpc"
+
+	scannerpb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+
+	"traderadmin/backend/scanner"
+)
+
+func TestFetchSymbolDataFromUnreachableScanner(t *testing.T) {
+	// A port nothing listens on
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	app := NewApp()
+	defer func() { app.scanner.Close() }()
+	app.config.ScannerConfig.Host = "127.0.0.1"
+	app.config.ScannerConfig.Port = port
+
+	if _, err := app.FetchSymbolData("aapl", "2024-01-02", "2024-01-31"); !errors.Is(err, scanner.ErrUnreachable) {
+		t.Errorf("FetchSymbolData() error = %v, want scanner.ErrUnreachable", err)
+	}
+	client := app.scanner
+
+	// The connection is reused until the address changes
+	app.FetchSymbolData("AAPL", "2024-01-02", "2024-01-31")
+	if app.scanner != client {
+		t.Error("FetchSymbolData dialed the scanner again")
+	}
+	app.config.ScannerConfig.Port = port + 1
+	app.FetchSymbolData("AAPL", "2024-01-02", "2024-01-31")
+	if app.scanner == client || app.scannerAddr != net.JoinHostPort("127.0.0.1", strconv.Itoa(port+1)) {
+		t.Errorf("Changing the scanner port kept the connection to %s", app.scannerAddr)
+	}
+
+	if _, err := app.FetchSymbolData("AAPL", "01/02/2024", "2024-01-31"); err == nil {
+		t.Error("FetchSymbolData() with a malformed date should fail")
+	}
+}
+
+// versionedScanner answers GetVersion with version and nothing else
+type versionedScanner struct {
+	scannerpb.UnimplementedScannerServiceServer
+	version *scannerpb.VersionResponse
+}
+
+func (v *versionedScanner) GetVersion(ctx context.Context, req *scannerpb.VersionRequest) (*scannerpb.VersionResponse, error) {
+	return v.version, nil
+}
+
+// serveScanner serves fake on a local port and points app's scanner at it
+func serveScanner(t *testing.T, app *App, fake scannerpb.ScannerServiceServer) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	scannerpb.RegisterScannerServiceServer(server, fake)
+	go server.Serve(listener)
+	t.Cleanup(func() {
+		app.scannerMu.Lock()
+		if app.scanner != nil {
+			app.scanner.Close()
+		}
+		app.scannerMu.Unlock()
+		server.Stop()
+	})
+	app.config.ScannerConfig.Host = "127.0.0.1"
+	app.config.ScannerConfig.Port = listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestScannerStatusOfIncompatibleScanner(t *testing.T) {
+	app := NewApp()
+	serveScanner(t, app, &versionedScanner{version: &scannerpb.VersionResponse{
+		Version: "9.0.0", ProtocolVersion: 9, MinProtocolVersion: scanner.ProtocolVersion + 1,
+	}})
+	var events []ScannerStatus
+	app.emit = func(name string, data ...interface{}) {
+		if name == ScannerIncompatibleEvent {
+			events = append(events, data[0].(ScannerStatus))
+		}
+	}
+
+	status := app.scannerStatus()
+	if !status.Reachable || status.Version != "9.0.0" || status.Compatible || status.Reason == "" || status.Enabled(scanner.FeatureSymbolData) {
+		t.Errorf("scannerStatus() = %+v, want an incompatible 9.0.0 without symbol data", status)
+	}
+	// The version is checked once per connection
+	if app.scannerStatus() != status || len(events) != 1 {
+		t.Errorf("Second scannerStatus() asked again or emitted %d events, want 1", len(events))
+	}
+	if _, err := app.FetchSymbolData("AAPL", "2024-01-02", "2024-01-31"); !errors.Is(err, scanner.ErrIncompatible) {
+		t.Errorf("FetchSymbolData() error = %v, want scanner.ErrIncompatible", err)
+	}
+}
+
+// metadataScanner is a versionedScanner serving metadata of every symbol
+// but ZZZZ
+type metadataScanner struct {
+	versionedScanner
+}
+
+func (m *metadataScanner) GetSymbolMetadata(ctx context.Context, req *scannerpb.SymbolMetadataRequest) (*scannerpb.SymbolMetadataResponse, error) {
+	resp := &scannerpb.SymbolMetadataResponse{Etag: "v1"}
+	for _, symbol := range req.Symbols {
+		resp.Symbols = append(resp.Symbols, &scannerpb.SymbolMetadata{Symbol: symbol, Present: symbol != "ZZZZ", Sector: "Technology", MarketCap: 3e12})
+	}
+	return resp, nil
+}
+
+func TestGetUniverseMetadata(t *testing.T) {
+	app := NewApp()
+	app.config.Universe.Symbols = []string{"AAPL", "ZZZZ"}
+	fake := &metadataScanner{versionedScanner{version: &scannerpb.VersionResponse{ProtocolVersion: scanner.ProtocolVersion}}}
+	serveScanner(t, app, fake)
+
+	metadata, err := app.GetUniverseMetadata()
+	if err != nil {
+		t.Fatalf("GetUniverseMetadata() error = %v", err)
+	}
+	if len(metadata) != 2 || !metadata[0].Present || metadata[0].Sector != "Technology" || metadata[1].Symbol != "ZZZZ" || metadata[1].Present {
+		t.Errorf("GetUniverseMetadata() = %+v, want AAPL present and ZZZZ missing", metadata)
+	}
+
+	// A scanner older than GetSymbolMetadata disables it
+	fake.version.ProtocolVersion = 7
+	app.scannerMu.Lock()
+	app.scannerVersion = nil
+	app.scannerMu.Unlock()
+	app.scannerStatus()
+	if _, err := app.GetUniverseMetadata(); !errors.Is(err, scanner.ErrIncompatible) {
+		t.Errorf("GetUniverseMetadata() from protocol 7 error = %v, want scanner.ErrIncompatible", err)
+	}
+}
+
+func TestEmbeddedScanner(t *testing.T) {
+	dir := t.TempDir()
+	config := "data_provider_type: mock\ndata_provider_wait_max: 0s\ncache_enabled: false\nevent_calendar_type: none\n"
+	if err := os.WriteFile(filepath.Join(dir, "scanner.yaml"), []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	app := NewApp()
+	app.configPath = filepath.Join(dir, "config.toml")
+	app.config.ScannerConfig.Embedded = true
+	app.config.ScannerConfig.ConfigFile = "scanner.yaml"
+	t.Cleanup(func() {
+		app.scanner.Close()
+		app.embeddedScanner.Stop()
+	})
+
+	bars, err := app.FetchSymbolData("AAPL", "2024-01-02", "2024-01-31")
+	if err != nil || len(bars) == 0 {
+		t.Fatalf("FetchSymbolData() = %d bars, %v; want the embedded scanner's bars", len(bars), err)
+	}
+	status := app.scannerStatus()
+	if status.Address != embeddedScannerAddress || !status.Reachable || !status.Compatible {
+		t.Errorf("scannerStatus() = %+v, want a compatible embedded scanner", status)
+	}
+
+	// The scanner's metrics are served with TraderAdmin's
+	families, err := app.metrics.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, family := range families {
+		found = found || family.GetName() == "scanner_fetch_duration_seconds"
+	}
+	if !found {
+		t.Error("The embedded scanner's metrics are not in the app's registry")
+	}
+
+	// Switching to the scanner service keeps the engine for switching back
+	embedded := app.embeddedScanner
+	app.config.ScannerConfig.Embedded = false
+	app.config.ScannerConfig.Host, app.config.ScannerConfig.Port = "127.0.0.1", 1
+	app.FetchSymbolData("AAPL", "2024-01-02", "2024-01-31")
+	app.config.ScannerConfig.Embedded = true
+	if _, err := app.FetchSymbolData("AAPL", "2024-01-02", "2024-01-31"); err != nil || app.embeddedScanner != embedded {
+		t.Errorf("Switching back to the embedded scanner failed with %v or replaced it", err)
+	}
+}
@@ -0,0 +1,596 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"traderadmin/backend/health"
+	"traderadmin/backend/history"
+	"traderadmin/backend/ibkr"
+	"traderadmin/backend/journal"
+	"traderadmin/backend/models"
+	"traderadmin/backend/notifications"
+	"traderadmin/backend/options"
+	"traderadmin/backend/risk"
+	"traderadmin/backend/scanner"
+	"traderadmin/backend/watchlist"
+)
+
+// ErrViewerMode is returned by every AdminService method while TraderAdmin
+// runs as a viewer, in case a tampered frontend calls one it was never bound
+var ErrViewerMode = errors.New("not available in viewer mode")
+
+// ReadService is the bound surface for looking at the trading stack: status,
+// metrics, scans, option chains, risk and history. Its methods call the App
+// methods of the same name, so the frontend calls them by their old names.
+type ReadService struct {
+	app *App
+}
+
+// AdminService is the bound surface for changing things: the configuration,
+// the containers and cluster, orders, the journal and the caches. Its methods
+// call the App methods of the same name once requireAdmin allows it. Methods
+// returning nothing on App return the rejection as an error here.
+type AdminService struct {
+	app *App
+}
+
+// boundServices returns the services bound to the frontend: only ReadService
+// in viewer mode, both otherwise
+func (a *App) boundServices() []interface{} {
+	if a.viewer {
+		log.Info().Msg("Viewer mode: binding the read-only service only")
+		return []interface{}{&ReadService{app: a}}
+	}
+	return []interface{}{&ReadService{app: a}, &AdminService{app: a}}
+}
+
+// IsViewerMode reports whether TraderAdmin runs as a viewer: built with the
+// viewer tag, or started or since configured with General.ViewerMode
+func (a *App) IsViewerMode() bool {
+	return viewerBuild || a.viewer || a.config.General.ViewerMode
+}
+
+// requireAdmin returns ErrViewerMode for operation in viewer mode
+func (a *App) requireAdmin(operation string) error {
+	if !a.IsViewerMode() {
+		return nil
+	}
+	log.Warn().Str("operation", operation).Msg("Rejected in viewer mode")
+	return fmt.Errorf("%s: %w", operation, ErrViewerMode)
+}
+
+// configuredViewerMode reports whether the viewer build tag or the config
+// file's General.ViewerMode asks for viewer mode. It is read before the
+// services are bound, ahead of the full load in startup; a file that cannot
+// be read or decoded leaves viewer mode to the build.
+func (a *App) configuredViewerMode() bool {
+	if viewerBuild {
+		return true
+	}
+	data, err := os.ReadFile(a.configPath)
+	if err != nil {
+		return false
+	}
+	migrated, _, err := migrateConfig(data, time.Now())
+	if err != nil {
+		return false
+	}
+	config, _, err := decodeConfig(migrated)
+	if err != nil {
+		return false
+	}
+	return config.General.ViewerMode
+}
+
+// IsViewerMode reports whether TraderAdmin runs as a viewer, without the
+// AdminService
+func (s *ReadService) IsViewerMode() bool {
+	return s.app.IsViewerMode()
+}
+
+// GetConfig returns the configuration, without its secret settings in viewer
+// mode
+func (s *ReadService) GetConfig() Configuration {
+	config := s.app.GetConfig()
+	if s.app.IsViewerMode() {
+		clearSecrets(&config)
+	}
+	return config
+}
+
+func (s *ReadService) CalculatePositionSize(spread ibkr.SpreadOrder) (risk.PositionSize, error) {
+	return s.app.CalculatePositionSize(spread)
+}
+
+func (s *ReadService) CancelAdHocScan() {
+	s.app.CancelAdHocScan()
+}
+
+func (s *ReadService) CheckForImageUpdates() ([]ImageUpdate, error) {
+	return s.app.CheckForImageUpdates()
+}
+
+func (s *ReadService) CheckHealth() health.HealthStatus {
+	return s.app.CheckHealth()
+}
+
+func (s *ReadService) CheckNewPositionAgainstLimits(legs []risk.LegExposure) (risk.LimitCheck, error) {
+	return s.app.CheckNewPositionAgainstLimits(legs)
+}
+
+func (s *ReadService) ExportPreset(name, path string) error {
+	return s.app.ExportPreset(name, path)
+}
+
+func (s *ReadService) ExportTradeHistory(format, path string, from, to time.Time) (int, error) {
+	return s.app.ExportTradeHistory(format, path, from, to)
+}
+
+func (s *ReadService) FetchOptionChain(symbol string) (ibkr.OptionChain, error) {
+	return s.app.FetchOptionChain(symbol)
+}
+
+func (s *ReadService) FetchSymbolData(symbol, startDate, endDate string) ([]scanner.MarketData, error) {
+	return s.app.FetchSymbolData(symbol, startDate, endDate)
+}
+
+func (s *ReadService) GetBackendStatus() BackendStatus {
+	return s.app.GetBackendStatus()
+}
+
+func (s *ReadService) GetCacheStats() (CacheStats, error) {
+	return s.app.GetCacheStats()
+}
+
+func (s *ReadService) GetConfigAuditLog(limit int, since time.Time) ([]ConfigAuditEntry, error) {
+	return s.app.GetConfigAuditLog(limit, since)
+}
+
+func (s *ReadService) GetConfigSchema() (string, error) {
+	return s.app.GetConfigSchema()
+}
+
+func (s *ReadService) GetConfigWarnings() []ConfigWarning {
+	return s.app.GetConfigWarnings()
+}
+
+func (s *ReadService) GetContainers() ([]ContainerInfo, error) {
+	return s.app.GetContainers()
+}
+
+func (s *ReadService) GetEquityHistory(from, to time.Time, resolution string) ([]history.Snapshot, error) {
+	return s.app.GetEquityHistory(from, to, resolution)
+}
+
+func (s *ReadService) GetExitStatus() []PositionExitStatus {
+	return s.app.GetExitStatus()
+}
+
+func (s *ReadService) GetIBKRConnections() []ibkr.ConnectionStatus {
+	return s.app.GetIBKRConnections()
+}
+
+func (s *ReadService) GetIVRank(symbol string, currentIV float64) (options.IVRankResult, error) {
+	return s.app.GetIVRank(symbol, currentIV)
+}
+
+func (s *ReadService) GetLatestMetrics() (models.AllMetrics, error) {
+	return s.app.GetLatestMetrics()
+}
+
+func (s *ReadService) GetNotifications(since time.Time, severityFilter string, limit int) ([]notifications.NotificationEvent, error) {
+	return s.app.GetNotifications(since, severityFilter, limit)
+}
+
+func (s *ReadService) GetOpenOrders() ([]ibkr.OrderState, error) {
+	return s.app.GetOpenOrders()
+}
+
+func (s *ReadService) GetOptionChainFiltered(symbol string, filter options.ChainFilter) (options.ChainPage, error) {
+	return s.app.GetOptionChainFiltered(symbol, filter)
+}
+
+func (s *ReadService) GetPortfolioGreeks() (risk.PortfolioGreeks, error) {
+	return s.app.GetPortfolioGreeks()
+}
+
+func (s *ReadService) GetPositionsRisk() (PositionsRisk, error) {
+	return s.app.GetPositionsRisk()
+}
+
+func (s *ReadService) GetSpreadCandidates(symbol string, direction string) (options.SpreadCandidates, error) {
+	return s.app.GetSpreadCandidates(symbol, direction)
+}
+
+func (s *ReadService) GetStatus() StatusInfo {
+	return s.app.GetStatus()
+}
+
+func (s *ReadService) GetStrategyParameterSchema(strategyName string) (StrategyParameterSchema, error) {
+	return s.app.GetStrategyParameterSchema(strategyName)
+}
+
+func (s *ReadService) GetSubAccountPositions() ([]SubAccountPositions, error) {
+	return s.app.GetSubAccountPositions()
+}
+
+func (s *ReadService) GetTradeHistory(filter journal.TradeFilter) ([]journal.TradeRecord, error) {
+	return s.app.GetTradeHistory(filter)
+}
+
+func (s *ReadService) GetUniverse() []string {
+	return s.app.GetUniverse()
+}
+
+func (s *ReadService) GetUniverseMetadata() ([]scanner.SymbolMetadata, error) {
+	return s.app.GetUniverseMetadata()
+}
+
+func (s *ReadService) GetUnreadNotificationCount() int {
+	return s.app.GetUnreadNotificationCount()
+}
+
+func (s *ReadService) IsConfigLoaded() bool {
+	return s.app.IsConfigLoaded()
+}
+
+func (s *ReadService) IsDryRun() bool {
+	return s.app.IsDryRun()
+}
+
+func (s *ReadService) IsReadOnly() bool {
+	return s.app.IsReadOnly()
+}
+
+func (s *ReadService) ListConfigPresets() ([]ConfigPreset, error) {
+	return s.app.ListConfigPresets()
+}
+
+func (s *ReadService) ListManagedDeployments() ([]ManagedDeployment, error) {
+	return s.app.ListManagedDeployments()
+}
+
+func (s *ReadService) ListScanStrategies() ([]scanner.StrategyInfo, error) {
+	return s.app.ListScanStrategies()
+}
+
+func (s *ReadService) ListWatchlists() ([]watchlist.Watchlist, error) {
+	return s.app.ListWatchlists()
+}
+
+func (s *ReadService) MarkNotificationsRead(ids []int64) (int, error) {
+	return s.app.MarkNotificationsRead(ids)
+}
+
+func (s *ReadService) PreviewOrder(spread ibkr.SpreadOrder) (OrderPreview, error) {
+	return s.app.PreviewOrder(spread)
+}
+
+func (s *ReadService) RunAdHocScan(symbols []string, strategies []string, lookbackDays int, paramOverrides map[string]map[string]float64) (*AdHocScanResult, error) {
+	return s.app.RunAdHocScan(symbols, strategies, lookbackDays, paramOverrides)
+}
+
+func (s *ReadService) SelectExpiration(symbol string, atr float64, volatilityIndex float64) (options.DTEDecision, error) {
+	return s.app.SelectExpiration(symbol, atr, volatilityIndex)
+}
+
+func (s *ReadService) TestDockerConnection() (DockerConnectionInfo, error) {
+	return s.app.TestDockerConnection()
+}
+
+func (s *ReadService) TestIBKRConnection() bool {
+	return s.app.TestIBKRConnection()
+}
+
+func (s *ReadService) ValidateConfig(config Configuration) ValidationErrors {
+	return s.app.ValidateConfig(config)
+}
+
+func (s *AdminService) AddSymbol(symbol string) error {
+	if err := s.app.requireAdmin("AddSymbol"); err != nil {
+		return err
+	}
+	return s.app.AddSymbol(symbol)
+}
+
+func (s *AdminService) AddWatchlist(list watchlist.Watchlist) error {
+	if err := s.app.requireAdmin("AddWatchlist"); err != nil {
+		return err
+	}
+	return s.app.AddWatchlist(list)
+}
+
+func (s *AdminService) ApplyConfigPreset(name string) (ConfigPresetResult, error) {
+	if err := s.app.requireAdmin("ApplyConfigPreset"); err != nil {
+		return ConfigPresetResult{}, err
+	}
+	return s.app.ApplyConfigPreset(name)
+}
+
+func (s *AdminService) CancelClearCache() error {
+	if err := s.app.requireAdmin("CancelClearCache"); err != nil {
+		return err
+	}
+	s.app.CancelClearCache()
+	return nil
+}
+
+func (s *AdminService) CancelOrder(orderID int64) error {
+	if err := s.app.requireAdmin("CancelOrder"); err != nil {
+		return err
+	}
+	return s.app.CancelOrder(orderID)
+}
+
+func (s *AdminService) ClearCache(dryRun bool, olderThanDays int) (CacheReport, error) {
+	if err := s.app.requireAdmin("ClearCache"); err != nil {
+		return CacheReport{}, err
+	}
+	return s.app.ClearCache(dryRun, olderThanDays)
+}
+
+func (s *AdminService) DeleteConfigPreset(name string) error {
+	if err := s.app.requireAdmin("DeleteConfigPreset"); err != nil {
+		return err
+	}
+	return s.app.DeleteConfigPreset(name)
+}
+
+func (s *AdminService) DeployStack() (StackResult, error) {
+	if err := s.app.requireAdmin("DeployStack"); err != nil {
+		return StackResult{}, err
+	}
+	return s.app.DeployStack()
+}
+
+func (s *AdminService) EmergencyStop() (EmergencyStopReport, error) {
+	if err := s.app.requireAdmin("EmergencyStop"); err != nil {
+		return EmergencyStopReport{}, err
+	}
+	return s.app.EmergencyStop()
+}
+
+func (s *AdminService) ImportPreset(path string) (ConfigPreset, error) {
+	if err := s.app.requireAdmin("ImportPreset"); err != nil {
+		return ConfigPreset{}, err
+	}
+	return s.app.ImportPreset(path)
+}
+
+func (s *AdminService) LoadConfig() error {
+	if err := s.app.requireAdmin("LoadConfig"); err != nil {
+		return err
+	}
+	return s.app.LoadConfig()
+}
+
+func (s *AdminService) PauseStack() (OperationReport, error) {
+	if err := s.app.requireAdmin("PauseStack"); err != nil {
+		return OperationReport{}, err
+	}
+	return s.app.PauseStack()
+}
+
+func (s *AdminService) PauseTradingServices() error {
+	if err := s.app.requireAdmin("PauseTradingServices"); err != nil {
+		return err
+	}
+	return s.app.PauseTradingServices()
+}
+
+func (s *AdminService) PlaceSpreadOrder(spread ibkr.SpreadOrder) (OperationReport, error) {
+	if err := s.app.requireAdmin("PlaceSpreadOrder"); err != nil {
+		return OperationReport{}, err
+	}
+	return s.app.PlaceSpreadOrder(spread)
+}
+
+func (s *AdminService) PullConfigFromCluster(force bool) error {
+	if err := s.app.requireAdmin("PullConfigFromCluster"); err != nil {
+		return err
+	}
+	return s.app.PullConfigFromCluster(force)
+}
+
+func (s *AdminService) PullLatestImages() (OperationReport, error) {
+	if err := s.app.requireAdmin("PullLatestImages"); err != nil {
+		return OperationReport{}, err
+	}
+	return s.app.PullLatestImages()
+}
+
+func (s *AdminService) PushConfigToCluster(force bool) error {
+	if err := s.app.requireAdmin("PushConfigToCluster"); err != nil {
+		return err
+	}
+	return s.app.PushConfigToCluster(force)
+}
+
+func (s *AdminService) RecordTrade(trade journal.TradeRecord) (journal.TradeRecord, error) {
+	if err := s.app.requireAdmin("RecordTrade"); err != nil {
+		return journal.TradeRecord{}, err
+	}
+	return s.app.RecordTrade(trade)
+}
+
+func (s *AdminService) RecreateWithLatest(containerID string) error {
+	if err := s.app.requireAdmin("RecreateWithLatest"); err != nil {
+		return err
+	}
+	return s.app.RecreateWithLatest(containerID)
+}
+
+func (s *AdminService) ReloadStackConfig() (OperationReport, error) {
+	if err := s.app.requireAdmin("ReloadStackConfig"); err != nil {
+		return OperationReport{}, err
+	}
+	return s.app.ReloadStackConfig()
+}
+
+func (s *AdminService) RemoveSymbol(symbol string) error {
+	if err := s.app.requireAdmin("RemoveSymbol"); err != nil {
+		return err
+	}
+	return s.app.RemoveSymbol(symbol)
+}
+
+func (s *AdminService) RemoveWatchlist(name string) error {
+	if err := s.app.requireAdmin("RemoveWatchlist"); err != nil {
+		return err
+	}
+	return s.app.RemoveWatchlist(name)
+}
+
+func (s *AdminService) RestartContainer(containerID string) (OperationReport, error) {
+	if err := s.app.requireAdmin("RestartContainer"); err != nil {
+		return OperationReport{}, err
+	}
+	return s.app.RestartContainer(containerID)
+}
+
+func (s *AdminService) ResumeTradingServices() error {
+	if err := s.app.requireAdmin("ResumeTradingServices"); err != nil {
+		return err
+	}
+	return s.app.ResumeTradingServices()
+}
+
+func (s *AdminService) RevertToAuditEntry(id int64) (OperationReport, error) {
+	if err := s.app.requireAdmin("RevertToAuditEntry"); err != nil {
+		return OperationReport{}, err
+	}
+	return s.app.RevertToAuditEntry(id)
+}
+
+func (s *AdminService) RolloutRestartDeployment(name string) (OperationReport, error) {
+	if err := s.app.requireAdmin("RolloutRestartDeployment"); err != nil {
+		return OperationReport{}, err
+	}
+	return s.app.RolloutRestartDeployment(name)
+}
+
+func (s *AdminService) SaveConfig() error {
+	if err := s.app.requireAdmin("SaveConfig"); err != nil {
+		return err
+	}
+	return s.app.SaveConfig()
+}
+
+func (s *AdminService) SaveConfigPreset(name string, sections []string) (ConfigPreset, error) {
+	if err := s.app.requireAdmin("SaveConfigPreset"); err != nil {
+		return ConfigPreset{}, err
+	}
+	return s.app.SaveConfigPreset(name, sections)
+}
+
+func (s *AdminService) SaveConfigurationAndRestart(configData map[string]interface{}) (OperationReport, error) {
+	if err := s.app.requireAdmin("SaveConfigurationAndRestart"); err != nil {
+		return OperationReport{}, err
+	}
+	return s.app.SaveConfigurationAndRestart(configData)
+}
+
+func (s *AdminService) ScaleDeployment(name string, replicas int) (OperationReport, error) {
+	if err := s.app.requireAdmin("ScaleDeployment"); err != nil {
+		return OperationReport{}, err
+	}
+	return s.app.ScaleDeployment(name, replicas)
+}
+
+func (s *AdminService) SetDryRun(enabled bool) error {
+	if err := s.app.requireAdmin("SetDryRun"); err != nil {
+		return err
+	}
+	s.app.SetDryRun(enabled)
+	return nil
+}
+
+func (s *AdminService) SetReadOnlyOverride(enabled bool) error {
+	if err := s.app.requireAdmin("SetReadOnlyOverride"); err != nil {
+		return err
+	}
+	s.app.SetReadOnlyOverride(enabled)
+	return nil
+}
+
+func (s *AdminService) SetRestartPolicy(containerID string, policy string) (OperationReport, error) {
+	if err := s.app.requireAdmin("SetRestartPolicy"); err != nil {
+		return OperationReport{}, err
+	}
+	return s.app.SetRestartPolicy(containerID, policy)
+}
+
+func (s *AdminService) StartStack() (OperationReport, error) {
+	if err := s.app.requireAdmin("StartStack"); err != nil {
+		return OperationReport{}, err
+	}
+	return s.app.StartStack()
+}
+
+func (s *AdminService) StopStack() (OperationReport, error) {
+	if err := s.app.requireAdmin("StopStack"); err != nil {
+		return OperationReport{}, err
+	}
+	return s.app.StopStack()
+}
+
+func (s *AdminService) SwitchAccount(name string) error {
+	if err := s.app.requireAdmin("SwitchAccount"); err != nil {
+		return err
+	}
+	return s.app.SwitchAccount(name)
+}
+
+func (s *AdminService) SyncFromCluster() (ConfigSyncStatus, error) {
+	if err := s.app.requireAdmin("SyncFromCluster"); err != nil {
+		return ConfigSyncStatus{}, err
+	}
+	return s.app.SyncFromCluster()
+}
+
+func (s *AdminService) TestAlertNotification(channelType string, message string) error {
+	if err := s.app.requireAdmin("TestAlertNotification"); err != nil {
+		return err
+	}
+	return s.app.TestAlertNotification(channelType, message)
+}
+
+func (s *AdminService) UndeployStack() (StackResult, error) {
+	if err := s.app.requireAdmin("UndeployStack"); err != nil {
+		return StackResult{}, err
+	}
+	return s.app.UndeployStack()
+}
+
+func (s *AdminService) UnpauseStack() (OperationReport, error) {
+	if err := s.app.requireAdmin("UnpauseStack"); err != nil {
+		return OperationReport{}, err
+	}
+	return s.app.UnpauseStack()
+}
+
+func (s *AdminService) UpdateConfig(newConfig Configuration) error {
+	if err := s.app.requireAdmin("UpdateConfig"); err != nil {
+		return err
+	}
+	return s.app.UpdateConfig(newConfig)
+}
+
+func (s *AdminService) UpdateStrategyDefaults(strategyName string, params map[string]interface{}) error {
+	if err := s.app.requireAdmin("UpdateStrategyDefaults"); err != nil {
+		return err
+	}
+	return s.app.UpdateStrategyDefaults(strategyName, params)
+}
+
+func (s *AdminService) UpdateTradeOutcome(id int64, exitPrice float64, exitTime time.Time) (journal.TradeRecord, error) {
+	if err := s.app.requireAdmin("UpdateTradeOutcome"); err != nil {
+		return journal.TradeRecord{}, err
+	}
+	return s.app.UpdateTradeOutcome(id, exitPrice, exitTime)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// methodNames returns the exported method names of v
+func methodNames(v interface{}) map[string]bool {
+	names := map[string]bool{}
+	t := reflect.TypeOf(v)
+	for i := 0; i < t.NumMethod(); i++ {
+		names[t.Method(i).Name] = true
+	}
+	return names
+}
+
+// callService calls the named method of a bound service with zero arguments
+// and returns its error
+func callService(t *testing.T, service interface{}, name string) error {
+	t.Helper()
+	method := reflect.ValueOf(service).MethodByName(name)
+	args := make([]reflect.Value, method.Type().NumIn())
+	for i := range args {
+		args[i] = reflect.Zero(method.Type().In(i))
+	}
+	results := method.Call(args)
+	if len(results) == 0 {
+		return nil
+	}
+	err, _ := results[len(results)-1].Interface().(error)
+	return err
+}
+
+func TestServicesSplitEveryAppMethod(t *testing.T) {
+	app := NewApp()
+	appMethods := methodNames(app)
+	read := methodNames(&ReadService{app: app})
+	admin := methodNames(&AdminService{app: app})
+
+	for name := range appMethods {
+		if read[name] == admin[name] {
+			t.Errorf("%s must be on exactly one of ReadService and AdminService", name)
+		}
+	}
+	for name := range read {
+		if !appMethods[name] {
+			t.Errorf("ReadService.%s has no App method of the same name", name)
+		}
+	}
+	for name := range admin {
+		if !appMethods[name] {
+			t.Errorf("AdminService.%s has no App method of the same name", name)
+		}
+	}
+
+	// Whatever read-only mode guards changes things, so it is admin only
+	for name := range guardedMethods {
+		if !admin[name] {
+			t.Errorf("%s is guarded in read-only mode but not on AdminService", name)
+		}
+	}
+}
+
+func TestViewerModeBindsNoAdminMethod(t *testing.T) {
+	app := NewApp()
+	app.viewer = true
+	admin := methodNames(&AdminService{app: app})
+
+	for _, service := range app.boundServices() {
+		if _, ok := service.(*AdminService); ok {
+			t.Fatal("AdminService is bound in viewer mode")
+		}
+		for name := range methodNames(service) {
+			if admin[name] {
+				t.Errorf("Admin method %s is reachable through %T in viewer mode", name, service)
+			}
+		}
+	}
+
+	app.viewer = false
+	if bound := app.boundServices(); len(bound) != 2 {
+		t.Errorf("Bound %d services outside viewer mode, want ReadService and AdminService", len(bound))
+	}
+}
+
+func TestAdminServiceRejectsViewerMode(t *testing.T) {
+	app := NewApp()
+	app.config.General.ViewerMode = true
+	admin := &AdminService{app: app}
+
+	for name := range methodNames(admin) {
+		if err := callService(t, admin, name); !errors.Is(err, ErrViewerMode) {
+			t.Errorf("%s() error = %v, want ErrViewerMode", name, err)
+		}
+	}
+}
+
+func TestReadServiceHidesSecretsInViewerMode(t *testing.T) {
+	app := NewApp()
+	app.config.AlertsConfig.Notifications.Email.SmtpPass = "hunter3"
+	app.config.AlertsConfig.Notifications.Slack.WebhookUrl = "https://hooks.slack.com/secret"
+	app.config.AlertsConfig.Notifications.Email.SmtpHost = "smtp.example.com"
+	read := &ReadService{app: app}
+
+	if config := read.GetConfig(); !viewerBuild && config.AlertsConfig.Notifications.Email.SmtpPass != "hunter3" {
+		t.Error("GetConfig dropped the secrets outside viewer mode")
+	}
+
+	app.viewer = true
+	config := read.GetConfig()
+	notifications := config.AlertsConfig.Notifications
+	if notifications.Email.SmtpPass != "" || notifications.Slack.WebhookUrl != "" {
+		t.Errorf("GetConfig returned secrets in viewer mode: %+v", notifications)
+	}
+	if notifications.Email.SmtpHost != "smtp.example.com" {
+		t.Errorf("GetConfig cleared SmtpHost = %q in viewer mode", notifications.Email.SmtpHost)
+	}
+	if app.config.AlertsConfig.Notifications.Email.SmtpPass != "hunter3" {
+		t.Error("GetConfig cleared the secrets of the App's configuration")
+	}
+}
+
+func TestConfiguredViewerMode(t *testing.T) {
+	dir := t.TempDir()
+	app := NewApp()
+	app.configPath = filepath.Join(dir, "config.toml")
+	if app.configuredViewerMode() != viewerBuild {
+		t.Error("Viewer mode without a config file differs from the build's")
+	}
+
+	if err := os.WriteFile(app.configPath, []byte("config_version = 2\n[general]\nviewer_mode = true\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if !app.configuredViewerMode() {
+		t.Error("viewer_mode = true in the config file did not turn viewer mode on")
+	}
+}
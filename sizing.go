@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"traderadmin/backend/ibkr"
+	"traderadmin/backend/risk"
+)
+
+// CalculatePositionSize sizes the spread: the contracts that risk
+// TradingParameters.DefaultRiskPerTradePercentage of the account equity not
+// already at risk, at the price PlaceSpreadOrder would place them at, and
+// whether GlobalMaxConcurrentPositions and MaxDailyTrades permit the trade.
+// The spread's quantity is ignored.
+func (a *App) CalculatePositionSize(spread ibkr.SpreadOrder) (risk.PositionSize, error) {
+	spread.Quantity = 1
+	if err := spread.Validate(); err != nil {
+		return risk.PositionSize{}, fmt.Errorf("invalid spread: %w", err)
+	}
+	if a.orderClient == nil || a.marketData == nil {
+		return risk.PositionSize{}, ibkr.ErrNotConnected
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	quotes, err := a.legQuotes(ctx, spread)
+	if err != nil {
+		return risk.PositionSize{}, err
+	}
+	return a.positionSize(ctx, spread, quotes)
+}
+
+// positionSize sizes spread, priced from quotes, against the equity of the
+// latest metrics and the active account's open positions
+func (a *App) positionSize(ctx context.Context, spread ibkr.SpreadOrder, quotes []ibkr.OptionQuote) (risk.PositionSize, error) {
+	_, metrics := a.collector.snapshot()
+	if metrics.Portfolio.Equity <= 0 {
+		return risk.PositionSize{}, fmt.Errorf("%w: connect to IBKR to size positions", risk.ErrNoEquity)
+	}
+
+	limit, err := ibkr.ComboLimitPrice(spread.Legs, quotes, a.priceImprovementFactor())
+	if err != nil {
+		return risk.PositionSize{}, fmt.Errorf("cannot price the spread: %w", err)
+	}
+	spread.Quantity = 1
+	maxLoss := risk.MaxLoss(spreadExposures(spread, quotes, time.Now()), limit*risk.DefaultMultiplier)
+
+	current, err := a.openExposures()
+	if err != nil {
+		return risk.PositionSize{}, err
+	}
+	working, err := a.orderClient.OpenOrders(ctx)
+	if err != nil {
+		return risk.PositionSize{}, fmt.Errorf("failed to load open orders: %w", err)
+	}
+
+	trading := a.config.TradingParameters
+	size, err := risk.SizePosition(risk.SizingInput{
+		Equity:             metrics.Portfolio.Equity,
+		RiskPercent:        trading.DefaultRiskPerTradePercentage,
+		MaxLossPerContract: maxLoss,
+		OpenRisk:           openRisk(current),
+		OpenPositions:      openPositions(current, a.accountOrders(working)),
+		MaxPositions:       trading.GlobalMaxConcurrentPositions,
+		TradesToday:        a.tradesToday(),
+		MaxDailyTrades:     trading.MaxDailyTrades,
+	})
+	if errors.Is(err, risk.ErrUndefinedRisk) {
+		return size, fmt.Errorf("cannot size the spread: %w", err)
+	}
+	return size, err
+}
+
+// openRisk returns the dollars the open legs lose at worst at expiry, taking
+// each underlying's legs together and leaving out the premiums they were
+// opened for
+func openRisk(legs []risk.LegExposure) float64 {
+	bySymbol := make(map[string][]risk.LegExposure)
+	for _, leg := range legs {
+		if leg.Quantity != 0 {
+			symbol := strings.ToUpper(leg.Symbol)
+			bySymbol[symbol] = append(bySymbol[symbol], leg)
+		}
+	}
+	var total float64
+	for _, symbolLegs := range bySymbol {
+		total += risk.MaxLoss(symbolLegs, 0)
+	}
+	return total
+}
+
+// tradesToday returns the number of trades the journal records entered today
+func (a *App) tradesToday() int {
+	if a.journal == nil {
+		return 0
+	}
+	return a.journal.StatsForDay(time.Now()).ExecutedCount
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"traderadmin/backend/ibkr"
+	"traderadmin/backend/journal"
+	"traderadmin/backend/risk"
+)
+
+// sizingTestApp is an orderTestApp whose latest metrics report equity
+func sizingTestApp(t *testing.T, equity float64) (*App, *fakeOrderClient) {
+	t.Helper()
+	app, client, _ := orderTestApp()
+	app.collector.metrics.Portfolio.Equity = equity
+	var err error
+	if app.journal, err = journal.Open(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	return app, client
+}
+
+func TestCalculatePositionSize(t *testing.T) {
+	// testSpread is priced at a credit of 1.28, so one contract loses at
+	// most 500 - 128
+	app, _ := sizingTestApp(t, 100000)
+	app.config.TradingParameters.DefaultRiskPerTradePercentage = 2
+
+	size, err := app.CalculatePositionSize(testSpread())
+	if err != nil {
+		t.Fatalf("CalculatePositionSize() error = %v", err)
+	}
+	if size.Quantity != 5 || math.Abs(size.MaxLossPerContract-372) > 1e-9 || math.Abs(size.TotalRisk-1860) > 1e-9 || !size.Permitted {
+		t.Errorf("CalculatePositionSize() = %+v, want 5 permitted contracts risking 372 each", size)
+	}
+
+	// A short put spread open in QQQ puts 1000 of the equity at risk
+	app.exposures = &fakeExposures{legs: []risk.LegExposure{
+		{Symbol: "QQQ", Strike: 350, Expiry: "20240119", Right: "P", Quantity: -2},
+		{Symbol: "QQQ", Strike: 345, Expiry: "20240119", Right: "P", Quantity: 2},
+	}}
+	app.config.TradingParameters.MaxDailyTrades = 1
+	if _, err := app.journal.RecordTrade(journal.TradeRecord{Symbol: "QQQ", Quantity: 2}); err != nil {
+		t.Fatal(err)
+	}
+	size, err = app.CalculatePositionSize(testSpread())
+	if err != nil {
+		t.Fatalf("CalculatePositionSize() error = %v", err)
+	}
+	if size.OpenRisk != 1000 || size.RiskBudget != 1980 || size.Quantity != 5 {
+		t.Errorf("CalculatePositionSize() = %+v, want 5 contracts of a 1980 budget", size)
+	}
+	if size.Permitted || len(size.Reasons) != 1 || size.Reasons[0] != "1 trades today of at most 1" {
+		t.Errorf("Reasons = %q, want the daily trades limit", size.Reasons)
+	}
+	if _, err := app.PlaceSpreadOrder(testSpread()); !errors.Is(err, ErrMaxDailyTrades) {
+		t.Errorf("PlaceSpreadOrder() error = %v, want %v", err, ErrMaxDailyTrades)
+	}
+}
+
+func TestCalculatePositionSizeErrors(t *testing.T) {
+	app, _ := sizingTestApp(t, 0)
+	if _, err := app.CalculatePositionSize(testSpread()); !errors.Is(err, risk.ErrNoEquity) {
+		t.Errorf("CalculatePositionSize() without equity error = %v, want %v", err, risk.ErrNoEquity)
+	}
+
+	// A naked call loses without bound
+	app.collector.metrics.Portfolio.Equity = 100000
+	spread := ibkr.SpreadOrder{Symbol: "SPY", Legs: []ibkr.OptionLeg{{Strike: 400, Expiry: "20240119", Right: "C", Action: "SELL", Ratio: 1}}}
+	if _, err := app.CalculatePositionSize(spread); err == nil {
+		t.Error("Expected an error for a spread of unbounded risk")
+	}
+
+	app.marketData = nil
+	if _, err := app.CalculatePositionSize(testSpread()); !errors.Is(err, ibkr.ErrNotConnected) {
+		t.Errorf("CalculatePositionSize() disconnected error = %v, want %v", err, ibkr.ErrNotConnected)
+	}
+}
+
+func TestPlaceSpreadOrderSizesByDefault(t *testing.T) {
+	app, client := sizingTestApp(t, 100000)
+	app.config.TradingParameters.DefaultRiskPerTradePercentage = 2
+
+	spread := testSpread()
+	spread.Quantity = 0
+	if _, err := app.PlaceSpreadOrder(spread); err != nil {
+		t.Fatalf("PlaceSpreadOrder() error = %v", err)
+	}
+	spread.Quantity = 2
+	if _, err := app.PlaceSpreadOrder(spread); err != nil {
+		t.Fatalf("PlaceSpreadOrder() error = %v", err)
+	}
+	if len(client.placed) != 2 || client.placed[0].Quantity != 5 || client.placed[1].Quantity != 2 {
+		t.Errorf("Placed %+v, want a sized order of 5 and an override of 2", client.placed)
+	}
+
+	// A contract over the budget sizes to none
+	app.config.TradingParameters.DefaultRiskPerTradePercentage = 0.1
+	spread.Quantity = 0
+	if _, err := app.PlaceSpreadOrder(spread); !errors.Is(err, ErrRiskLimit) {
+		t.Errorf("PlaceSpreadOrder() error = %v, want %v", err, ErrRiskLimit)
+	}
+	if len(client.placed) != 2 {
+		t.Errorf("Placed %d orders, want the unsized order refused", len(client.placed))
+	}
+}
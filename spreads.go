@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"traderadmin/backend/ibkr"
+	"traderadmin/backend/options"
+)
+
+// defaultMaxCandidates is used when spread_builder.max_candidates is not set
+const defaultMaxCandidates = 10
+
+// GetSpreadCandidates builds the credit spreads of symbol for a direction
+// ("bullish", "bearish", "both", "neutral" or "all") from its option chain, and
+// returns the best ones passing the configured filters along with near misses
+// and the filters that knocked them out. Only the enabled spread types are
+// built. The rejection counts are logged per symbol.
+func (a *App) GetSpreadCandidates(symbol string, direction string) (options.SpreadCandidates, error) {
+	strategies, err := options.ParseDirection(direction)
+	if err != nil {
+		return options.SpreadCandidates{}, err
+	}
+	if enabled := a.config.SpreadBuilder.EnabledSpreadTypes; len(enabled) > 0 {
+		strategies = slices.DeleteFunc(strategies, func(strategy string) bool {
+			return !slices.Contains(enabled, strategy)
+		})
+		if len(strategies) == 0 {
+			return options.SpreadCandidates{}, fmt.Errorf("no spread type for direction %q is enabled", direction)
+		}
+	}
+
+	chain, err := a.FetchOptionChain(symbol)
+	if err != nil {
+		return options.SpreadCandidates{}, fmt.Errorf("failed to fetch option chain: %w", err)
+	}
+
+	builder := a.config.SpreadBuilder
+	settings := options.SpreadSettings{
+		Width:         builder.SpreadWidth,
+		StrikeOffset:  builder.StrikeOffset,
+		MaxCandidates: builder.MaxCandidates,
+		Score:         builder.Score,
+	}
+	if settings.MaxCandidates <= 0 {
+		settings.MaxCandidates = defaultMaxCandidates
+	}
+
+	result, err := options.SelectSpreads(chain, strategies, settings, a.spreadFilters(chain))
+	if err != nil {
+		return result, err
+	}
+	// The metadata only labels the candidates, so a scanner without it is
+	// no reason to fail
+	if metadata, err := a.lookupSymbolMetadata([]string{result.Symbol}); err != nil {
+		log.Debug().Err(err).Str("symbol", result.Symbol).Msg("No scanner metadata for spread candidates")
+	} else if metadata[0].Present {
+		result.Sector, result.MarketCap = metadata[0].Sector, metadata[0].MarketCap
+	}
+
+	event := log.Info().Str("symbol", result.Symbol).Int("evaluated", result.Evaluated).Int("candidates", len(result.Candidates))
+	for _, stat := range result.Rejections {
+		event = event.Int(string(stat.Code), stat.Count)
+	}
+	event.Msg("Spread candidates selected")
+	return result, nil
+}
+
+// SelectExpiration chooses the expiration of symbol's option chain nearest the
+// configured target DTE, and explains the choice. The ATR_MULTIPLE mode uses
+// the underlying's atr and the VOLATILITY_INDEX mode a VIX-like
+// volatilityIndex; without UseDynamicDTE the fixed target is used.
+// Expirations held through earnings or an ex-dividend date of the event
+// calendar are passed over.
+func (a *App) SelectExpiration(symbol string, atr float64, volatilityIndex float64) (options.DTEDecision, error) {
+	chain, err := a.FetchOptionChain(symbol)
+	if err != nil {
+		return options.DTEDecision{}, fmt.Errorf("failed to fetch option chain: %w", err)
+	}
+	settings := a.dteSettings()
+	settings.SkipExpiries = a.skippedExpiries(chain, time.Now())
+	return options.SelectExpiration(chain, settings, atr, volatilityIndex)
+}
+
+// dteSettings returns the configured target DTE mode and bounds
+func (a *App) dteSettings() options.DTESettings {
+	timing := a.config.TradeTiming
+	settings := options.DTESettings{
+		Mode:           timing.TargetDTEMode,
+		Fixed:          timing.FixedTargetDTE,
+		ATRCoefficient: timing.DTEAtrCoefficient,
+		MinDTE:         timing.MinDTE,
+		MaxDTE:         timing.MaxDTE,
+	}
+	if !timing.UseDynamicDTE {
+		settings.Mode = options.DTEModeFixed
+	}
+	return settings
+}
+
+// spreadFilters returns the configured option filters, Greek limits and DTE
+// range, with the IV rank of the chain's at the money volatility and the
+// expirations the event calendar rules out
+func (a *App) spreadFilters(chain ibkr.OptionChain) options.SpreadFilters {
+	of, gl := a.config.OptionsFilters, a.config.GreekLimits
+	filters := options.SpreadFilters{
+		MinOpenInterest:                        of.MinOpenInterest,
+		MaxBidAskSpreadPercentage:              of.MaxBidAskSpreadPercentage,
+		UseIVRankFilter:                        of.UseIVRankFilter,
+		MinIVRank:                              of.MinIVRank,
+		MaxIVRank:                              of.MaxIVRank,
+		UsePOPFilter:                           of.UsePOPFilter,
+		MinProbabilityOfProfitPercentage:       of.MinProbabilityOfProfitPercentage,
+		UseWidthVsExpectedMoveFilter:           of.UseWidthVsExpectedMoveFilter,
+		MaxSpreadWidthVsExpectedMovePercentage: of.MaxSpreadWidthVsExpectedMovePercentage,
+		UseGreekLimits:                         gl.UseGreekLimits,
+		MaxAbsPositionDelta:                    gl.MaxAbsPositionDelta,
+		MaxAbsPositionGamma:                    gl.MaxAbsPositionGamma,
+		MaxAbsPositionVega:                     gl.MaxAbsPositionVega,
+		MinPositionTheta:                       gl.MinPositionTheta,
+		MinDTE:                                 a.config.TradeTiming.MinDTE,
+		MaxDTE:                                 a.config.TradeTiming.MaxDTE,
+		SkipExpiries:                           a.skippedExpiries(chain, time.Now()),
+	}
+
+	if a.ivHistory != nil {
+		if iv := atTheMoneyIV(chain); iv > 0 {
+			if rank := a.ivHistory.Rank(chain.Symbol, iv); rank.Observations > 0 {
+				filters.IVRank, filters.HasIVRank = rank.Rank, true
+			}
+		}
+	}
+	return filters
+}
+
+// atTheMoneyIV returns the mean implied volatility of the options at the
+// strike nearest the money in the nearest expiry, or 0 without quotes
+func atTheMoneyIV(chain ibkr.OptionChain) float64 {
+	var expiry string
+	strike, distance := 0.0, math.Inf(1)
+	for _, contract := range chain.Contracts {
+		if contract.ImpliedVol <= 0 {
+			continue
+		}
+		d := math.Abs(contract.Strike - chain.UnderlyingPrice)
+		if expiry == "" || contract.Expiry < expiry || (contract.Expiry == expiry && d < distance) {
+			expiry, strike, distance = contract.Expiry, contract.Strike, d
+		}
+	}
+
+	var sum float64
+	var n int
+	for _, contract := range chain.Contracts {
+		if contract.Expiry == expiry && contract.Strike == strike && contract.ImpliedVol > 0 {
+			sum += contract.ImpliedVol
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / float64(n)
+}
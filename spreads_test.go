@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"traderadmin/backend/ibkr"
+	"traderadmin/backend/options"
+)
+
+func TestGetSpreadCandidates(t *testing.T) {
+	app := NewApp()
+	if _, err := app.GetSpreadCandidates("SPY", "bullish"); !errors.Is(err, ibkr.ErrNotConnected) {
+		t.Errorf("GetSpreadCandidates() error = %v, want ErrNotConnected", err)
+	}
+
+	app.marketData = &fakeMarketData{}
+	if _, err := app.GetSpreadCandidates("SPY", "sideways"); err == nil {
+		t.Error("Expected an error for an unknown direction")
+	}
+
+	// A chain with a single strike has no verticals
+	result, err := app.GetSpreadCandidates("SPY", "both")
+	if err != nil {
+		t.Fatalf("GetSpreadCandidates() error = %v", err)
+	}
+	if result.Symbol != "SPY" || result.Evaluated != 0 || result.Candidates == nil {
+		t.Errorf("Result = %+v", result)
+	}
+
+	app.config.SpreadBuilder.EnabledSpreadTypes = []string{options.IronCondor}
+	if _, err := app.GetSpreadCandidates("SPY", "bullish"); err == nil {
+		t.Error("Expected an error when no spread type of the direction is enabled")
+	}
+	if _, err := app.GetSpreadCandidates("SPY", "all"); err != nil {
+		t.Errorf("GetSpreadCandidates(all) error = %v", err)
+	}
+}
+
+func TestSelectExpiration(t *testing.T) {
+	app := NewApp()
+	app.marketData = &fakeMarketData{}
+	app.config.TradeTiming.FixedTargetDTE = 45
+	app.config.TradeTiming.MaxDTE = 90
+	app.config.TradeTiming.TargetDTEMode = options.DTEModeATRMultiple
+
+	// Without UseDynamicDTE the ATR is not needed
+	decision, err := app.SelectExpiration("SPY", 0, 0)
+	if err != nil || decision.Mode != options.DTEModeFixed || decision.Target != 45 || decision.Expiry == "" {
+		t.Errorf("SelectExpiration() = %+v, %v; want the fixed target", decision, err)
+	}
+
+	app.config.TradeTiming.UseDynamicDTE = true
+	if _, err := app.SelectExpiration("SPY", 0, 0); err == nil {
+		t.Error("Expected an error for the ATR_MULTIPLE mode without an ATR")
+	}
+}
+
+// ivMarketData quotes strikes 90 to 110 a month out, every option at the
+// implied volatility iv
+type ivMarketData struct {
+	fakeMarketData
+	iv float64
+}
+
+func (f *ivMarketData) OptionParams(ctx context.Context, symbol string) ([]ibkr.OptionParams, error) {
+	expiry := time.Now().AddDate(0, 0, 30).Format("20060102")
+	return []ibkr.OptionParams{{Exchange: "SMART", Expirations: []string{expiry}, Strikes: []float64{90, 95, 100, 105, 110}}}, nil
+}
+
+func (f *ivMarketData) OptionSnapshots(ctx context.Context, symbol string, keys []ibkr.OptionKey) ([]ibkr.OptionQuote, error) {
+	quotes := make([]ibkr.OptionQuote, len(keys))
+	for i, key := range keys {
+		quotes[i] = ibkr.OptionQuote{OptionKey: key, Bid: 2, Ask: 2.1, ImpliedVol: f.iv, OpenInterest: 1000}
+	}
+	return quotes, nil
+}
+
+func TestChainFetchesFeedIVRank(t *testing.T) {
+	store, err := options.NewIVHistoryStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := NewApp()
+	client := &ivMarketData{iv: 0.40}
+	app.marketData = client
+	app.ivHistory = store
+	app.config.OptionsFilters.UseIVRankFilter = true
+	app.config.OptionsFilters.MinIVRank = 50
+	app.config.OptionsFilters.MaxIVRank = 100
+
+	// Earlier days put the year's range at 0.10 to 0.50
+	now := time.Now()
+	for days, iv := range map[int]float64{2: 0.50, 1: 0.10} {
+		if err := store.Record("SPY", now.AddDate(0, 0, -days), iv); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Today's fetch at 0.40 ranks 75
+	result, err := app.GetSpreadCandidates("SPY", "both")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Evaluated == 0 || ivRankRejections(result) != 0 {
+		t.Errorf("Rejections at IV 0.40 = %+v, want none for IV rank", result.Rejections)
+	}
+
+	// Fetching again replaces today's observation, and 0.15 ranks 12.5
+	client.iv = 0.15
+	result, err = app.GetSpreadCandidates("SPY", "both")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := store.History("SPY"); len(got) != 3 || got[2] != 0.15 {
+		t.Errorf("History = %v, want today's observation replaced", got)
+	}
+	if n := ivRankRejections(result); n != result.Evaluated || n == 0 {
+		t.Errorf("IV rank rejected %d of %d spreads at IV 0.15, want all", n, result.Evaluated)
+	}
+}
+
+// ivRankRejections counts the spreads result rejected for their IV rank
+func ivRankRejections(result options.SpreadCandidates) int {
+	for _, stat := range result.Rejections {
+		if stat.Code == options.RejectIVRankOutOfRange {
+			return stat.Count
+		}
+	}
+	return 0
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	yamlutil "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// embeddedManifests are deployed when no manifests directory is configured
+//
+//go:embed kubernetes/base
+var embeddedManifests embed.FS
+
+// embeddedManifestsRoot is the directory of embeddedManifests holding the stack
+const embeddedManifestsRoot = "kubernetes/base"
+
+// Actions reported for each resource in a StackResult
+const (
+	ResourceCreated  = "created"
+	ResourceUpdated  = "updated"
+	ResourceDeleted  = "deleted"
+	ResourceNotFound = "not found"
+	ResourceFailed   = "failed"
+)
+
+// stackFieldManager owns the fields TraderAdmin sets with server-side apply
+const stackFieldManager = "traderadmin"
+
+// stackTimeout bounds a whole deploy or undeploy
+const stackTimeout = 2 * time.Minute
+
+// namespaceResource is the cluster-scoped namespaces resource
+var namespaceResource = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+
+// ResourceResult reports what happened to one resource of the stack
+type ResourceResult struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Action    string `json:"action"`
+	Error     string `json:"error,omitempty"`
+}
+
+// StackResult reports the outcome of DeployStack or UndeployStack. Failed
+// counts the resources whose Action is ResourceFailed.
+type StackResult struct {
+	Resources []ResourceResult `json:"resources"`
+	Failed    int              `json:"failed"`
+}
+
+// add records a resource's outcome
+func (r *StackResult) add(result ResourceResult) {
+	if result.Action == ResourceFailed {
+		r.Failed++
+	}
+	r.Resources = append(r.Resources, result)
+}
+
+// stackObject is a decoded manifest with its resource mapping
+type stackObject struct {
+	obj     *unstructured.Unstructured
+	mapping *meta.RESTMapping
+}
+
+// DeployStack applies the stack manifests to the cluster with server-side
+// apply, creating their namespaces first. A resource that fails, for example
+// because RBAC denies it, is reported in the result and does not stop the
+// others; an error is returned only when nothing could be attempted.
+func (a *App) DeployStack() (StackResult, error) {
+	if err := a.requireWritable("DeployStack"); err != nil {
+		return StackResult{}, err
+	}
+	clients, err := a.kubernetesClients()
+	if err != nil {
+		return StackResult{}, err
+	}
+	objects, err := a.loadStackManifests(clients.mapper)
+	if err != nil {
+		return StackResult{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), stackTimeout)
+	defer cancel()
+
+	var result StackResult
+	ensured := make(map[string]bool)
+	for _, o := range objects {
+		if ns := o.obj.GetNamespace(); ns != "" && !ensured[ns] {
+			ensured[ns] = true
+			if nsResult, created := ensureNamespace(ctx, clients.dynamic, ns); created || nsResult.Action == ResourceFailed {
+				result.add(nsResult)
+			}
+		}
+		result.add(applyObject(ctx, clients.dynamic, o))
+	}
+
+	log.Info().Int("resources", len(result.Resources)).Int("failed", result.Failed).Msg("Deployed stack")
+	return result, nil
+}
+
+// UndeployStack deletes the resources of the stack manifests in reverse
+// order. Namespaces are left in place unless a manifest declares them, since
+// they may hold resources TraderAdmin did not deploy.
+func (a *App) UndeployStack() (StackResult, error) {
+	if err := a.requireWritable("UndeployStack"); err != nil {
+		return StackResult{}, err
+	}
+	clients, err := a.kubernetesClients()
+	if err != nil {
+		return StackResult{}, err
+	}
+	objects, err := a.loadStackManifests(clients.mapper)
+	if err != nil {
+		return StackResult{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), stackTimeout)
+	defer cancel()
+
+	var result StackResult
+	for i := len(objects) - 1; i >= 0; i-- {
+		result.add(deleteObject(ctx, clients.dynamic, objects[i]))
+	}
+
+	log.Info().Int("resources", len(result.Resources)).Int("failed", result.Failed).Msg("Undeployed stack")
+	return result, nil
+}
+
+// loadStackManifests decodes every YAML document of the stack manifests, from
+// Kubernetes.ManifestsDir or the embedded kubernetes/base, in file order.
+// Namespaced resources without a namespace go to Kubernetes.Namespace.
+func (a *App) loadStackManifests(mapper meta.RESTMapper) ([]stackObject, error) {
+	manifests, err := a.stackManifests()
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []stackObject
+	err = fs.WalkDir(manifests, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || (path.Ext(name) != ".yaml" && path.Ext(name) != ".yml") {
+			return nil
+		}
+
+		data, err := fs.ReadFile(manifests, name)
+		if err != nil {
+			return err
+		}
+		decoded, err := decodeManifests(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		for _, obj := range decoded {
+			gvk := obj.GroupVersionKind()
+			mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+			if err != nil {
+				return fmt.Errorf("%s: %s %s: %w", name, gvk.Kind, obj.GetName(), err)
+			}
+			if mapping.Scope.Name() == meta.RESTScopeNameNamespace && obj.GetNamespace() == "" {
+				obj.SetNamespace(a.config.Kubernetes.Namespace)
+			}
+			objects = append(objects, stackObject{obj: obj, mapping: mapping})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load stack manifests: %w", err)
+	}
+	if len(objects) == 0 {
+		return nil, fmt.Errorf("no stack manifests found")
+	}
+	return objects, nil
+}
+
+// stackManifests returns the configured manifests directory, or the embedded
+// manifests when none is configured
+func (a *App) stackManifests() (fs.FS, error) {
+	if dir := a.config.Kubernetes.ManifestsDir; dir != "" {
+		if _, err := os.Stat(dir); err != nil {
+			return nil, fmt.Errorf("manifests directory: %w", err)
+		}
+		return os.DirFS(dir), nil
+	}
+	return fs.Sub(embeddedManifests, embeddedManifestsRoot)
+}
+
+// decodeManifests decodes the documents of a YAML file. Kinds the client-go
+// scheme knows are checked by the universal deserializer; others, such as
+// custom resources, are decoded as they are.
+func decodeManifests(data []byte) ([]*unstructured.Unstructured, error) {
+	reader := yamlutil.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+	deserializer := scheme.Codecs.UniversalDeserializer()
+
+	var objects []*unstructured.Unstructured
+	for {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		raw, err := yamlutil.ToJSON(doc)
+		if err != nil {
+			return nil, err
+		}
+		// Empty and comment-only documents decode to nothing
+		if len(bytes.TrimSpace(raw)) == 0 || string(raw) == "null" {
+			continue
+		}
+
+		obj := &unstructured.Unstructured{}
+		typed, gvk, err := deserializer.Decode(raw, nil, nil)
+		switch {
+		case err == nil:
+			content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(typed)
+			if err != nil {
+				return nil, err
+			}
+			obj.SetUnstructuredContent(content)
+			obj.SetGroupVersionKind(*gvk)
+		case runtime.IsNotRegisteredError(err):
+			if err := obj.UnmarshalJSON(raw); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, err
+		}
+		objects = append(objects, obj)
+	}
+}
+
+// ensureNamespace creates the namespace if it does not exist and reports
+// whether it did
+func ensureNamespace(ctx context.Context, client dynamic.Interface, name string) (ResourceResult, bool) {
+	result := ResourceResult{Kind: "Namespace", Name: name}
+
+	_, err := client.Resource(namespaceResource).Get(ctx, name, metav1.GetOptions{})
+	if err == nil {
+		return result, false
+	}
+	if !apierrors.IsNotFound(err) {
+		return failedResource(result, err), false
+	}
+
+	ns := &unstructured.Unstructured{}
+	ns.SetAPIVersion("v1")
+	ns.SetKind("Namespace")
+	ns.SetName(name)
+	if _, err := client.Resource(namespaceResource).Create(ctx, ns, metav1.CreateOptions{FieldManager: stackFieldManager}); err != nil && !apierrors.IsAlreadyExists(err) {
+		return failedResource(result, err), false
+	}
+	result.Action = ResourceCreated
+	return result, true
+}
+
+// applyObject creates the object, or server-side applies it over an existing
+// one, taking ownership of the fields the manifest sets
+func applyObject(ctx context.Context, client dynamic.Interface, o stackObject) ResourceResult {
+	result := resourceResult(o.obj)
+	resource := resourceClient(client, o)
+
+	_, err := resource.Get(ctx, o.obj.GetName(), metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		if _, err := resource.Create(ctx, o.obj, metav1.CreateOptions{FieldManager: stackFieldManager}); err != nil {
+			return failedResource(result, err)
+		}
+		result.Action = ResourceCreated
+	case err != nil:
+		return failedResource(result, err)
+	default:
+		data, err := o.obj.MarshalJSON()
+		if err != nil {
+			return failedResource(result, err)
+		}
+		force := true
+		if _, err := resource.Patch(ctx, o.obj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{FieldManager: stackFieldManager, Force: &force}); err != nil {
+			return failedResource(result, err)
+		}
+		result.Action = ResourceUpdated
+	}
+	return result
+}
+
+// deleteObject deletes the object; one that is already gone is not a failure
+func deleteObject(ctx context.Context, client dynamic.Interface, o stackObject) ResourceResult {
+	result := resourceResult(o.obj)
+
+	err := resourceClient(client, o).Delete(ctx, o.obj.GetName(), metav1.DeleteOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		result.Action = ResourceNotFound
+	case err != nil:
+		return failedResource(result, err)
+	default:
+		result.Action = ResourceDeleted
+	}
+	return result
+}
+
+// resourceClient returns the dynamic client for the object's resource
+func resourceClient(client dynamic.Interface, o stackObject) dynamic.ResourceInterface {
+	resource := client.Resource(o.mapping.Resource)
+	if o.mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		return resource.Namespace(o.obj.GetNamespace())
+	}
+	return resource
+}
+
+// resourceResult starts the result for obj
+func resourceResult(obj *unstructured.Unstructured) ResourceResult {
+	return ResourceResult{Kind: obj.GetKind(), Namespace: obj.GetNamespace(), Name: obj.GetName()}
+}
+
+// failedResource records err against the resource, naming it so RBAC denials
+// say what was denied
+func failedResource(result ResourceResult, err error) ResourceResult {
+	result.Action = ResourceFailed
+	if apierrors.IsForbidden(err) {
+		result.Error = fmt.Sprintf("%s %s: permission denied: %v", result.Kind, result.Name, err)
+	} else {
+		result.Error = fmt.Sprintf("%s %s: %v", result.Kind, result.Name, err)
+	}
+	log.Error().Err(err).Str("kind", result.Kind).Str("namespace", result.Namespace).Str("name", result.Name).Msg("Stack resource failed")
+	return result
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testStackManifests = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: scanner-config
+data:
+  mode: paper
+---
+# The scanner deployment
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: scanner
+  namespace: trading
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: scanner
+  template:
+    metadata:
+      labels:
+        app: scanner
+    spec:
+      containers:
+        - name: scanner
+          image: scanner:latest
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: scanner
+  namespace: trading
+spec:
+  selector:
+    app: scanner
+  ports:
+    - port: 50051
+`
+
+// newStackTestApp returns an app connected to a fake dynamic client, deploying
+// testStackManifests from a temporary manifests directory
+func newStackTestApp(t *testing.T) (*App, *dynamicfake.FakeDynamicClient) {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "stack.yaml"), []byte(testStackManifests), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("not a manifest"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}, meta.RESTScopeRoot)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Service"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+
+	// The fake client treats apply patches as strategic merge patches, which
+	// only typed objects support; as the sole field manager, an apply replaces
+	// the object
+	client.PrependReactor("patch", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		if patch.GetPatchType() != types.ApplyPatchType {
+			return false, nil, nil
+		}
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(patch.GetPatch()); err != nil {
+			return true, nil, err
+		}
+		return true, obj, client.Tracker().Update(patch.GetResource(), obj, patch.GetNamespace())
+	})
+
+	app := NewApp()
+	app.config.Kubernetes.Namespace = "traderadmin"
+	app.config.Kubernetes.ManifestsDir = dir
+	app.k8s = &kubernetesClients{dynamic: client, mapper: mapper}
+	return app, client
+}
+
+// actions returns "Kind name action" for each resource of result
+func actions(result StackResult) []string {
+	var out []string
+	for _, r := range result.Resources {
+		out = append(out, r.Kind+" "+r.Name+" "+r.Action)
+	}
+	return out
+}
+
+func TestDeployStackCreatesThenUpdates(t *testing.T) {
+	app, client := newStackTestApp(t)
+
+	result, err := app.DeployStack()
+	if err != nil {
+		t.Fatalf("DeployStack() error = %v", err)
+	}
+	want := []string{
+		"Namespace traderadmin created",
+		"ConfigMap scanner-config created",
+		"Namespace trading created",
+		"Deployment scanner created",
+		"Service scanner created",
+	}
+	if got := actions(result); strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("First deploy: got %v, want %v", got, want)
+	}
+
+	// The ConfigMap without a namespace went to the configured one
+	deployments := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	if _, err := client.Resource(deployments).Namespace("trading").Get(context.Background(), "scanner", metav1.GetOptions{}); err != nil {
+		t.Errorf("Deployment was not created: %v", err)
+	}
+	configMaps := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	if _, err := client.Resource(configMaps).Namespace("traderadmin").Get(context.Background(), "scanner-config", metav1.GetOptions{}); err != nil {
+		t.Errorf("ConfigMap was not created in the configured namespace: %v", err)
+	}
+
+	// Deploying again applies over the existing resources
+	result, err = app.DeployStack()
+	if err != nil {
+		t.Fatalf("DeployStack() error = %v", err)
+	}
+	want = []string{"ConfigMap scanner-config updated", "Deployment scanner updated", "Service scanner updated"}
+	if got := actions(result); strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("Second deploy: got %v, want %v", got, want)
+	}
+}
+
+func TestDeployStackReportsForbiddenResources(t *testing.T) {
+	app, client := newStackTestApp(t)
+	client.PrependReactor("create", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Group: "apps", Resource: "deployments"}, "scanner", nil)
+	})
+
+	result, err := app.DeployStack()
+	if err != nil {
+		t.Fatalf("DeployStack() error = %v", err)
+	}
+	if result.Failed != 1 {
+		t.Fatalf("Failed: got %d, want 1 in %+v", result.Failed, result.Resources)
+	}
+
+	// The denied deployment is named, and the rest of the stack still deploys
+	for _, r := range result.Resources {
+		switch r.Kind {
+		case "Deployment":
+			if r.Action != ResourceFailed || !strings.Contains(r.Error, "Deployment scanner: permission denied") {
+				t.Errorf("Deployment result: %+v", r)
+			}
+		default:
+			if r.Action != ResourceCreated {
+				t.Errorf("%s %s: got %q, want created", r.Kind, r.Name, r.Action)
+			}
+		}
+	}
+}
+
+func TestUndeployStack(t *testing.T) {
+	app, _ := newStackTestApp(t)
+	if _, err := app.DeployStack(); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := app.UndeployStack()
+	if err != nil {
+		t.Fatalf("UndeployStack() error = %v", err)
+	}
+	want := []string{"Service scanner deleted", "Deployment scanner deleted", "ConfigMap scanner-config deleted"}
+	if got := actions(result); strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("Undeploy: got %v, want %v", got, want)
+	}
+
+	// Undeploying again finds nothing and is not a failure
+	result, err = app.UndeployStack()
+	if err != nil || result.Failed != 0 || result.Resources[0].Action != ResourceNotFound {
+		t.Errorf("Second undeploy: %+v, %v", result, err)
+	}
+}
+
+func TestStackWaitsForKubernetes(t *testing.T) {
+	app := NewApp()
+	if _, err := app.DeployStack(); err == nil || !strings.Contains(err.Error(), "waiting for Kubernetes") {
+		t.Errorf("DeployStack() error = %v, want ErrBackendUnavailable", err)
+	}
+}
+
+func TestEmbeddedStackManifests(t *testing.T) {
+	app, _ := newStackTestApp(t)
+	app.config.Kubernetes.ManifestsDir = ""
+
+	objects, err := app.loadStackManifests(app.k8s.mapper)
+	if err != nil {
+		t.Fatalf("loadStackManifests() error = %v", err)
+	}
+	for _, o := range objects {
+		if o.obj.GetKind() == "ConfigMap" && o.obj.GetName() == "prometheus-config" && o.obj.GetNamespace() == "monitoring" {
+			return
+		}
+	}
+	t.Errorf("Embedded manifests did not include the prometheus ConfigMap: %d objects", len(objects))
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	wailsruntime "github.com/wailsapp/wails/v2/pkg/runtime"
+
+	"traderadmin/backend/models"
+)
+
+// Events pushed to the frontend when the collected status or metrics change
+const (
+	StatusUpdateEvent  = "status-update"
+	MetricsUpdateEvent = "metrics-update"
+)
+
+// defaultStatusRefresh is used when general.status_refresh_seconds is not set
+const defaultStatusRefresh = 5 * time.Second
+
+// statusCollector refreshes the status and metrics in one place on an
+// interval, so that views showing them do not each probe IBKR. The frontend
+// reads the cached snapshot and is pushed an event whenever it changes.
+type statusCollector struct {
+	collectStatus  func() StatusInfo
+	collectMetrics func(StatusInfo) models.AllMetrics
+	emit           func(name string, data ...interface{})
+	interval       func() time.Duration
+	paused         func() bool
+	now            func() time.Time
+	// observe is given every refresh, changed or not, when set
+	observe func(StatusInfo, models.AllMetrics)
+
+	mu          sync.RWMutex
+	status      StatusInfo
+	metrics     models.AllMetrics
+	statusHash  string
+	metricsHash string
+	lastRefresh time.Time
+}
+
+// run refreshes whenever the interval has passed until ctx is cancelled
+func (c *statusCollector) run(ctx context.Context) {
+	for {
+		c.refreshIfDue()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.untilDue()):
+		}
+	}
+}
+
+// refreshIfDue refreshes when the interval has passed since the last refresh
+// and collection is not paused, and reports whether it refreshed
+func (c *statusCollector) refreshIfDue() bool {
+	if c.untilDue() > 0 {
+		return false
+	}
+	c.refresh()
+	return true
+}
+
+// untilDue returns the time left until the next refresh; while paused the
+// collector checks again after a full interval
+func (c *statusCollector) untilDue() time.Duration {
+	interval := c.interval()
+	if c.paused() {
+		return interval
+	}
+
+	c.mu.RLock()
+	last := c.lastRefresh
+	c.mu.RUnlock()
+	if last.IsZero() {
+		return 0
+	}
+	if wait := last.Add(interval).Sub(c.now()); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// refresh collects the status and metrics, caches them and emits an event for
+// each that changed since the last refresh
+func (c *statusCollector) refresh() (StatusInfo, models.AllMetrics) {
+	status := c.collectStatus()
+	metrics := c.collectMetrics(status)
+	statusHash := statusFingerprint(status)
+	metricsHash := metricsFingerprint(metrics)
+
+	c.mu.Lock()
+	statusChanged := statusHash != c.statusHash
+	metricsChanged := metricsHash != c.metricsHash
+	c.status, c.metrics = status, metrics
+	c.statusHash, c.metricsHash = statusHash, metricsHash
+	c.lastRefresh = c.now()
+	c.mu.Unlock()
+
+	if c.observe != nil {
+		c.observe(status, metrics)
+	}
+
+	if statusChanged {
+		c.emit(StatusUpdateEvent, status)
+	}
+	if metricsChanged {
+		c.emit(MetricsUpdateEvent, metrics)
+	}
+	return status, metrics
+}
+
+// snapshot returns the cached status and metrics
+func (c *statusCollector) snapshot() (StatusInfo, models.AllMetrics) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.status, c.metrics
+}
+
+// seed caches an initial status, shown until the first refresh
+func (c *statusCollector) seed(status StatusInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status = status
+}
+
+// statusFingerprint hashes the status without the timestamps that change on
+// every refresh
+func statusFingerprint(status StatusInfo) string {
+	status.LastUpdated = time.Time{}
+	status.IBKR.LastConnected = time.Time{}
+	services := append(status.Services[:0:0], status.Services...)
+	for i := range services {
+		services[i].LastChecked = time.Time{}
+	}
+	status.Services = services
+	return fingerprint(status)
+}
+
+// metricsFingerprint hashes the metrics without their collection timestamps
+func metricsFingerprint(metrics models.AllMetrics) string {
+	metrics.Portfolio.Timestamp = time.Time{}
+	metrics.System.LastDataSync = time.Time{}
+	return fingerprint(metrics)
+}
+
+// fingerprint returns the sha256 of v's JSON encoding, which is what the
+// frontend receives
+func fingerprint(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// newStatusCollector returns the collector refreshing the app's status
+func (a *App) newStatusCollector() *statusCollector {
+	return &statusCollector{
+		collectStatus:  a.collectStatus,
+		collectMetrics: a.collectMetrics,
+		emit:           a.emitEvent,
+		interval:       a.statusRefreshInterval,
+		paused:         a.windowMinimised,
+		now:            time.Now,
+		observe:        a.observeRefresh,
+	}
+}
+
+// statusRefreshInterval returns the configured interval between refreshes
+func (a *App) statusRefreshInterval() time.Duration {
+	if seconds := a.config.General.StatusRefreshSeconds; seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultStatusRefresh
+}
+
+// windowMinimised reports whether the app window is minimised, when nobody
+// is looking at the status
+func (a *App) windowMinimised() bool {
+	return a.ctx != nil && wailsruntime.WindowIsMinimised(a.ctx)
+}
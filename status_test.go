@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"traderadmin/backend/models"
+)
+
+// testCollector is a status collector over fake probes, with a clock the
+// test advances by hand
+type testCollector struct {
+	*statusCollector
+	clock     time.Time
+	connected bool
+	equity    float64
+	minimised bool
+	probes    int
+	events    []string
+}
+
+func newTestCollector() *testCollector {
+	tc := &testCollector{clock: time.Date(2024, 3, 6, 15, 0, 0, 0, time.UTC)}
+	tc.statusCollector = &statusCollector{
+		collectStatus: func() StatusInfo {
+			tc.probes++
+			var status StatusInfo
+			status.IBKR.Connected = tc.connected
+			status.IBKR.LastConnected = tc.clock
+			status.LastUpdated = tc.clock
+			return status
+		},
+		collectMetrics: func(StatusInfo) models.AllMetrics {
+			var metrics models.AllMetrics
+			metrics.Portfolio.Equity = tc.equity
+			metrics.Portfolio.Timestamp = tc.clock
+			return metrics
+		},
+		emit:     func(name string, data ...interface{}) { tc.events = append(tc.events, name) },
+		interval: func() time.Duration { return 5 * time.Second },
+		paused:   func() bool { return tc.minimised },
+		now:      func() time.Time { return tc.clock },
+	}
+	return tc
+}
+
+// advance moves the clock on and refreshes if due
+func (tc *testCollector) advance(d time.Duration) bool {
+	tc.clock = tc.clock.Add(d)
+	return tc.refreshIfDue()
+}
+
+// takeEvents returns the events emitted since the last call
+func (tc *testCollector) takeEvents() []string {
+	events := tc.events
+	tc.events = nil
+	return events
+}
+
+func equalEvents(got []string, want ...string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestStatusCollectorEmitsOnlyChanges(t *testing.T) {
+	tc := newTestCollector()
+
+	// The first refresh reports both
+	tc.advance(0)
+	if got := tc.takeEvents(); !equalEvents(got, StatusUpdateEvent, MetricsUpdateEvent) {
+		t.Fatalf("First refresh events: %v", got)
+	}
+
+	// Only the timestamps moved, which is not a change
+	tc.advance(5 * time.Second)
+	if got := tc.takeEvents(); len(got) != 0 {
+		t.Errorf("Events without changes: %v", got)
+	}
+
+	// A metrics change leaves the status alone
+	tc.equity = 25000
+	tc.advance(5 * time.Second)
+	if got := tc.takeEvents(); !equalEvents(got, MetricsUpdateEvent) {
+		t.Errorf("Events after an equity change: %v", got)
+	}
+
+	tc.connected = true
+	tc.advance(5 * time.Second)
+	if got := tc.takeEvents(); !equalEvents(got, StatusUpdateEvent) {
+		t.Errorf("Events after connecting: %v", got)
+	}
+
+	status, metrics := tc.snapshot()
+	if !status.IBKR.Connected || metrics.Portfolio.Equity != 25000 || !status.LastUpdated.Equal(tc.clock) {
+		t.Errorf("Snapshot: %+v, %+v", status, metrics.Portfolio)
+	}
+}
+
+func TestStatusCollectorInterval(t *testing.T) {
+	tc := newTestCollector()
+
+	if !tc.advance(0) {
+		t.Fatal("The first refresh should be due immediately")
+	}
+	if got := tc.untilDue(); got != 5*time.Second {
+		t.Errorf("untilDue() after a refresh = %v, want 5s", got)
+	}
+	if tc.advance(3 * time.Second) {
+		t.Error("Refreshed before the interval passed")
+	}
+	if got := tc.untilDue(); got != 2*time.Second {
+		t.Errorf("untilDue() = %v, want 2s", got)
+	}
+	if !tc.advance(2 * time.Second) {
+		t.Error("Did not refresh once the interval passed")
+	}
+
+	// Reading the snapshot does not probe
+	tc.snapshot()
+	if tc.probes != 2 {
+		t.Errorf("Probes = %d, want 2", tc.probes)
+	}
+}
+
+func TestStatusCollectorPausesWhileMinimised(t *testing.T) {
+	tc := newTestCollector()
+	tc.advance(0)
+
+	tc.minimised = true
+	if tc.advance(time.Minute) {
+		t.Error("Refreshed while minimised")
+	}
+	if got := tc.untilDue(); got != 5*time.Second {
+		t.Errorf("untilDue() while minimised = %v, want the interval", got)
+	}
+
+	// Restored, the overdue refresh happens at once
+	tc.minimised = false
+	if !tc.advance(0) {
+		t.Error("Did not refresh after being restored")
+	}
+	if tc.probes != 2 {
+		t.Errorf("Probes = %d, want 2", tc.probes)
+	}
+}
+
+func TestStatusCollectorStopsWhenCancelled(t *testing.T) {
+	tc := newTestCollector()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		tc.run(ctx)
+		close(done)
+	}()
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Collector did not stop after cancellation")
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/trustdan/ibkr-trader/go/pkg/strategy"
+)
+
+// Types of strategy parameters
+const (
+	ParameterNumber  = "number"
+	ParameterBoolean = "boolean"
+)
+
+// StrategyParameter is a setting of a strategy's [strategy_defaults.<name>]
+// table. Min and Max bound a number and are both zero for a boolean.
+type StrategyParameter struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type"`
+	Min         float64     `json:"min"`
+	Max         float64     `json:"max"`
+	Default     interface{} `json:"default"`
+	Description string      `json:"description"`
+}
+
+// StrategyParameterSchema lists the settings a strategy's strategy_defaults
+// table may hold: the parameters the scanner's strategy registry declares for
+// it, then the exit rules overriding ExitManagement's
+type StrategyParameterSchema struct {
+	Strategy   string              `json:"strategy"`
+	Parameters []StrategyParameter `json:"parameters"`
+}
+
+// parameter returns the parameter of the schema called name
+func (s StrategyParameterSchema) parameter(name string) (StrategyParameter, bool) {
+	for _, param := range s.Parameters {
+		if param.Name == name {
+			return param, true
+		}
+	}
+	return StrategyParameter{}, false
+}
+
+// parameterNames returns the names of the schema's parameters
+func (s StrategyParameterSchema) parameterNames() []string {
+	names := make([]string, len(s.Parameters))
+	for i, param := range s.Parameters {
+		names[i] = param.Name
+	}
+	return names
+}
+
+// strategySchema returns the schema of the strategy called name in any case,
+// e.g. "high_base", with the exit rules defaulting to config's
+func strategySchema(config Configuration, name string) (StrategyParameterSchema, bool) {
+	registered, ok := strategy.Lookup(strings.ToUpper(strings.TrimSpace(name)))
+	if !ok {
+		return StrategyParameterSchema{}, false
+	}
+	schema := StrategyParameterSchema{Strategy: registered.Name()}
+	for _, spec := range registered.Params() {
+		schema.Parameters = append(schema.Parameters, StrategyParameter{
+			Name:        spec.Name,
+			Type:        ParameterNumber,
+			Min:         spec.Min,
+			Max:         spec.Max,
+			Default:     spec.Default,
+			Description: spec.Description,
+		})
+	}
+	exit := config.ExitManagement
+	schema.Parameters = append(schema.Parameters,
+		StrategyParameter{Name: "target_profit_pct", Type: ParameterNumber, Max: 100, Default: exit.TargetProfitPct,
+			Description: "percent of a trade's max profit that triggers its exit; 0 never"},
+		StrategyParameter{Name: "stop_loss_pct", Type: ParameterNumber, Max: 100, Default: exit.StopLossPct,
+			Description: "percent of a trade's max loss that triggers its exit; 0 never"},
+		StrategyParameter{Name: "auto_exit", Type: ParameterBoolean, Default: exit.AutoExit,
+			Description: "place an order closing a trade that crosses its target or stop instead of only alerting"},
+	)
+	return schema, true
+}
+
+// GetStrategyParameterSchema returns the settings the strategy_defaults
+// table of strategy may hold, for the settings to render and check them
+func (a *App) GetStrategyParameterSchema(strategyName string) (StrategyParameterSchema, error) {
+	schema, ok := strategySchema(a.config, strategyName)
+	if !ok {
+		return StrategyParameterSchema{}, fmt.Errorf("unknown strategy %s, TraderAdmin knows %s", strategyName, strings.Join(strategy.Names(), ", "))
+	}
+	return schema, nil
+}
+
+// UpdateStrategyDefaults sets the strategy_defaults of strategy from params,
+// keeping the settings params leaves out and removing those it sets to null,
+// which fall back to their defaults, then saves the configuration. Numbers
+// given as any numeric type or as text are stored as floats. Nothing is
+// changed unless every value is a parameter of the strategy's schema of the
+// right type within its bounds; the ValidationErrors returned otherwise name
+// each value as StrategyDefaults.<strategy>.<parameter>.
+func (a *App) UpdateStrategyDefaults(strategyName string, params map[string]interface{}) error {
+	schema, err := a.GetStrategyParameterSchema(strategyName)
+	if err != nil {
+		return err
+	}
+
+	// The table keeps the key it has in the config file, e.g. high_base
+	key := schema.Strategy
+	for name := range a.config.StrategyDefaults {
+		if strings.EqualFold(name, schema.Strategy) {
+			key = name
+			break
+		}
+	}
+	table := make(map[string]interface{}, len(a.config.StrategyDefaults[key])+len(params))
+	for name, value := range a.config.StrategyDefaults[key] {
+		table[name] = value
+	}
+
+	var errs ValidationErrors
+	for _, name := range sortedKeys(params) {
+		field := "StrategyDefaults." + key + "." + name
+		param, ok := schema.parameter(name)
+		if !ok {
+			message := fmt.Sprintf("is not a parameter of %s, which has %s", schema.Strategy, strings.Join(schema.parameterNames(), ", "))
+			errs = append(errs, ValidationError{Field: field, Message: message})
+			continue
+		}
+		if params[name] == nil {
+			delete(table, name)
+			continue
+		}
+		value, err := coerceParameter(param, params[name])
+		if err != nil {
+			errs = append(errs, ValidationError{Field: field, Message: err.Error()})
+			continue
+		}
+		table[name] = value
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	config := a.config
+	config.StrategyDefaults = make(map[string]map[string]interface{}, len(a.config.StrategyDefaults)+1)
+	for name, defaults := range a.config.StrategyDefaults {
+		config.StrategyDefaults[name] = defaults
+	}
+	if len(table) == 0 {
+		delete(config.StrategyDefaults, key)
+	} else {
+		config.StrategyDefaults[key] = table
+	}
+	a.setConfig(config)
+	return a.saveConfig("UpdateStrategyDefaults", schema.Strategy)
+}
+
+// coerceParameter returns value as param's type, float64 for a number, and
+// an error when it is not of that type or outside the bounds
+func coerceParameter(param StrategyParameter, value interface{}) (interface{}, error) {
+	if param.Type == ParameterBoolean {
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			if parsed, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+				return parsed, nil
+			}
+		}
+		return nil, fmt.Errorf("must be true or false, got %v", value)
+	}
+
+	var number float64
+	switch v := value.(type) {
+	case float64:
+		number = v
+	case float32:
+		number = float64(v)
+	case int:
+		number = float64(v)
+	case int32:
+		number = float64(v)
+	case int64:
+		number = float64(v)
+	case json.Number:
+		parsed, err := v.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("must be a number, got %q", v)
+		}
+		number = parsed
+	case string:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return nil, fmt.Errorf("must be a number, got %q", v)
+		}
+		number = parsed
+	default:
+		return nil, fmt.Errorf("must be a number, got %v", value)
+	}
+	switch {
+	case math.IsNaN(number) || math.IsInf(number, 0):
+		return nil, fmt.Errorf("must be a finite number, got %g", number)
+	case number < param.Min || number > param.Max:
+		return nil, fmt.Errorf("must be between %g and %g, got %g", param.Min, param.Max, number)
+	}
+	return number, nil
+}
+
+// validateStrategyDefaults reports to invalid each value of a known
+// parameter of a known strategy that is not of the parameter's type within
+// its bounds. Values are checked as written, so a number written as text is
+// invalid here although UpdateStrategyDefaults accepts it.
+func validateStrategyDefaults(config Configuration, invalid func(field, format string, args ...interface{})) {
+	for _, name := range sortedKeys(config.StrategyDefaults) {
+		schema, ok := strategySchema(config, name)
+		if !ok {
+			continue
+		}
+		for _, key := range sortedKeys(config.StrategyDefaults[name]) {
+			param, ok := schema.parameter(key)
+			if !ok {
+				continue
+			}
+			value := config.StrategyDefaults[name][key]
+			if _, text := value.(string); text {
+				invalid("StrategyDefaults."+name+"."+key, "must be a %s, not text, got %q", param.Type, value)
+				continue
+			}
+			if _, err := coerceParameter(param, value); err != nil {
+				invalid("StrategyDefaults."+name+"."+key, "%s", err)
+			}
+		}
+	}
+}
+
+// strategyDefaultsWarnings returns a warning for each strategy_defaults
+// table of a strategy TraderAdmin does not know, and for each setting of a
+// known strategy's table that is not one of its parameters
+func strategyDefaultsWarnings(config Configuration) []ConfigWarning {
+	var warnings []ConfigWarning
+	for _, name := range sortedKeys(config.StrategyDefaults) {
+		schema, ok := strategySchema(config, name)
+		if !ok {
+			warning := ConfigWarning{
+				Key:        "strategy_defaults." + name,
+				Suggestion: closestKey(name, strategy.Names()),
+				Message:    fmt.Sprintf("strategy_defaults.%s is not a known strategy and is not checked", name),
+			}
+			if warning.Suggestion != "" {
+				warning.Message += fmt.Sprintf("; did you mean %s?", warning.Suggestion)
+			}
+			warnings = append(warnings, warning)
+			continue
+		}
+		for _, key := range sortedKeys(config.StrategyDefaults[name]) {
+			if _, ok := schema.parameter(key); ok {
+				continue
+			}
+			warning := ConfigWarning{
+				Key:        "strategy_defaults." + name + "." + key,
+				Suggestion: closestKey(key, schema.parameterNames()),
+				Message:    fmt.Sprintf("strategy_defaults.%s.%s is not a parameter of %s and is ignored", name, key, schema.Strategy),
+			}
+			if warning.Suggestion != "" {
+				warning.Message += fmt.Sprintf("; did you mean %s?", warning.Suggestion)
+			}
+			warnings = append(warnings, warning)
+		}
+	}
+	return warnings
+}
+
+// logStrategyDefaultsWarnings logs the warnings of config's strategy_defaults
+func logStrategyDefaultsWarnings(config Configuration) {
+	for _, warning := range strategyDefaultsWarnings(config) {
+		log.Warn().Str("key", warning.Key).Str("suggestion", warning.Suggestion).Msg(warning.Message)
+	}
+}
+
+// sortedKeys returns the keys of m in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+)
+
+func TestGetStrategyParameterSchema(t *testing.T) {
+	app := NewApp()
+	app.config.ExitManagement.StopLossPct = 75
+
+	schema, err := app.GetStrategyParameterSchema("high_base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema.Strategy != "HIGH_BASE" {
+		t.Errorf("Strategy = %q, want HIGH_BASE", schema.Strategy)
+	}
+	minRSI, ok := schema.parameter("min_rsi")
+	if !ok || minRSI.Type != ParameterNumber || minRSI.Default != 60.0 || minRSI.Max != 100 || minRSI.Description == "" {
+		t.Errorf("min_rsi = %+v, want the scanner's number parameter", minRSI)
+	}
+	if stop, _ := schema.parameter("stop_loss_pct"); stop.Default != 75.0 {
+		t.Errorf("stop_loss_pct defaults to %v, want ExitManagement's 75", stop.Default)
+	}
+	if auto, _ := schema.parameter("auto_exit"); auto.Type != ParameterBoolean {
+		t.Errorf("auto_exit = %+v, want a boolean", auto)
+	}
+
+	if _, err := app.GetStrategyParameterSchema("rsi_strategy"); err == nil || !strings.Contains(err.Error(), "HIGH_BASE, LOW_BASE") {
+		t.Errorf("Unknown strategy error = %v, want the known strategies", err)
+	}
+}
+
+func TestUpdateStrategyDefaultsCoercesNumbers(t *testing.T) {
+	app := NewApp()
+	app.configPath = filepath.Join(t.TempDir(), "config.toml")
+	app.config.StrategyDefaults = map[string]map[string]interface{}{
+		"high_base": {"stop_loss_pct": int64(80), "target_profit_pct": 40.0},
+	}
+
+	err := app.UpdateStrategyDefaults("HIGH_BASE", map[string]interface{}{
+		"min_rsi":           "65",
+		"max_atr_ratio":     int64(3),
+		"stop_loss_pct":     json.Number("60.5"),
+		"auto_exit":         "true",
+		"target_profit_pct": nil,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The table keeps its key, with every number a float
+	table := app.config.StrategyDefaults["high_base"]
+	want := map[string]interface{}{"min_rsi": 65.0, "max_atr_ratio": 3.0, "stop_loss_pct": 60.5, "auto_exit": true}
+	if len(app.config.StrategyDefaults) != 1 || len(table) != len(want) {
+		t.Fatalf("StrategyDefaults = %v, want high_base = %v", app.config.StrategyDefaults, want)
+	}
+	for name, value := range want {
+		if table[name] != value {
+			t.Errorf("%s = %#v, want %#v", name, table[name], value)
+		}
+	}
+
+	// The saved file holds numbers the exit manager reads
+	var saved Configuration
+	if _, err := toml.DecodeFile(app.configPath, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved.StrategyDefaults["high_base"]["min_rsi"] != 65.0 {
+		t.Errorf("Saved min_rsi = %#v, want 65.0", saved.StrategyDefaults["high_base"]["min_rsi"])
+	}
+	if _, stop, auto := app.exitRules("HIGH_BASE"); stop != 60.5 || !auto {
+		t.Errorf("exitRules(HIGH_BASE) stop %v, auto %v, want 60.5, true", stop, auto)
+	}
+}
+
+func TestUpdateStrategyDefaultsRejectsInvalidValues(t *testing.T) {
+	app := NewApp()
+	app.configPath = filepath.Join(t.TempDir(), "config.toml")
+	app.config.StrategyDefaults = map[string]map[string]interface{}{"LOW_BASE": {"max_rsi": 40.0}}
+
+	err := app.UpdateStrategyDefaults("LOW_BASE", map[string]interface{}{
+		"max_rsi":       140,
+		"min_atr_ratio": "half",
+		"stop_loss_pct": -5.0,
+		"auto_exit":     1,
+		"min_rsi":       30,
+	})
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("UpdateStrategyDefaults() error = %v, want ValidationErrors", err)
+	}
+	want := map[string]string{
+		"StrategyDefaults.LOW_BASE.auto_exit":     "must be true or false, got 1",
+		"StrategyDefaults.LOW_BASE.max_rsi":       "must be between 0 and 100, got 140",
+		"StrategyDefaults.LOW_BASE.min_atr_ratio": `must be a number, got "half"`,
+		"StrategyDefaults.LOW_BASE.min_rsi":       "is not a parameter of LOW_BASE",
+		"StrategyDefaults.LOW_BASE.stop_loss_pct": "must be between 0 and 100, got -5",
+	}
+	if len(errs) != len(want) {
+		t.Errorf("Errors = %v, want %d", errs, len(want))
+	}
+	for _, fieldErr := range errs {
+		if message, ok := want[fieldErr.Field]; !ok || !strings.HasPrefix(fieldErr.Message, message) {
+			t.Errorf("Error %s: %s, want %q", fieldErr.Field, fieldErr.Message, message)
+		}
+	}
+
+	// Nothing changed, nothing saved
+	if table := app.config.StrategyDefaults["LOW_BASE"]; len(table) != 1 || table["max_rsi"] != 40.0 {
+		t.Errorf("LOW_BASE = %v after a rejected update", table)
+	}
+	if _, statErr := os.Stat(app.configPath); !os.IsNotExist(statErr) {
+		t.Error("UpdateStrategyDefaults() saved a rejected update")
+	}
+	if err := app.UpdateStrategyDefaults("RSI_STRATEGY", map[string]interface{}{"min_rsi": 30}); err == nil {
+		t.Error("Updating an unknown strategy succeeded")
+	}
+}
+
+func TestValidateConfigChecksStrategyDefaults(t *testing.T) {
+	config := validConfig()
+	config.StrategyDefaults = map[string]map[string]interface{}{
+		"high_base":    {"min_rsi": "60", "max_atr_ratio": int64(2), "target_profit_pct": 150.0},
+		"rsi_strategy": {"min_rsi_value": "anything"},
+	}
+	errs := NewApp().ValidateConfig(config)
+	fields := map[string]bool{}
+	for _, fieldErr := range errs {
+		fields[fieldErr.Field] = true
+	}
+	if len(errs) != 2 || !fields["StrategyDefaults.high_base.min_rsi"] || !fields["StrategyDefaults.high_base.target_profit_pct"] {
+		t.Errorf("Errors = %v, want min_rsi as text and target_profit_pct out of bounds", errs)
+	}
+}
+
+func TestStrategyDefaultsWarnings(t *testing.T) {
+	config := validConfig()
+	config.StrategyDefaults = map[string]map[string]interface{}{
+		"high_base":    {"min_rsi": 60.0, "min_rs": 60.0, "atr_period_for_stop": int64(14)},
+		"hihg_base":    {"min_rsi": 60.0},
+		"rsi_strategy": {"enabled": true},
+	}
+	want := []ConfigWarning{
+		{Key: "strategy_defaults.high_base.atr_period_for_stop"},
+		{Key: "strategy_defaults.high_base.min_rs", Suggestion: "min_rsi"},
+		{Key: "strategy_defaults.hihg_base", Suggestion: "HIGH_BASE"},
+		{Key: "strategy_defaults.rsi_strategy"},
+	}
+	warnings := strategyDefaultsWarnings(config)
+	if len(warnings) != len(want) {
+		t.Fatalf("Warnings = %v, want %d", warnings, len(want))
+	}
+	for i, warning := range warnings {
+		if warning.Key != want[i].Key || warning.Suggestion != want[i].Suggestion {
+			t.Errorf("Warning %d = %+v, want key %s suggesting %q", i, warning, want[i].Key, want[i].Suggestion)
+		}
+	}
+
+	// Loading the file reports them with its other warnings
+	app := NewApp()
+	app.configPath = filepath.Join(t.TempDir(), "config.toml")
+	content := "[strategy_defaults.high_base]\nmin_rsi = 60\nmin_rs = 60\n"
+	if err := os.WriteFile(app.configPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.LoadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if loaded := app.GetConfigWarnings(); len(loaded) != 1 || loaded[0].Suggestion != "min_rsi" {
+		t.Errorf("Loaded warnings = %v, want min_rs suggesting min_rsi", loaded)
+	}
+}
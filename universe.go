@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// GetUniverse returns the configured symbol universe
+func (a *App) GetUniverse() []string {
+	return append([]string(nil), a.config.Universe.Symbols...)
+}
+
+// AddSymbol adds a symbol to the universe and persists the configuration
+func (a *App) AddSymbol(symbol string) error {
+	symbol = strings.ToUpper(strings.TrimSpace(symbol))
+	if symbol == "" {
+		return fmt.Errorf("symbol is required")
+	}
+
+	for _, existing := range a.config.Universe.Symbols {
+		if existing == symbol {
+			return fmt.Errorf("symbol %s is already in the universe", symbol)
+		}
+	}
+
+	a.config.Universe.Symbols = append(a.config.Universe.Symbols, symbol)
+	if err := a.saveConfig("AddSymbol", symbol); err != nil {
+		a.config.Universe.Symbols = a.config.Universe.Symbols[:len(a.config.Universe.Symbols)-1]
+		return err
+	}
+
+	log.Info().Str("symbol", symbol).Msg("Added symbol to universe")
+	return nil
+}
+
+// RemoveSymbol removes a symbol from the universe and persists the configuration
+func (a *App) RemoveSymbol(symbol string) error {
+	symbol = strings.ToUpper(strings.TrimSpace(symbol))
+
+	previous := a.config.Universe.Symbols
+	remaining := make([]string, 0, len(previous))
+	for _, existing := range previous {
+		if existing != symbol {
+			remaining = append(remaining, existing)
+		}
+	}
+	if len(remaining) == len(previous) {
+		return fmt.Errorf("symbol %s is not in the universe", symbol)
+	}
+
+	a.config.Universe.Symbols = remaining
+	if err := a.saveConfig("RemoveSymbol", symbol); err != nil {
+		a.config.Universe.Symbols = previous
+		return err
+	}
+
+	log.Info().Str("symbol", symbol).Msg("Removed symbol from universe")
+	return nil
+}
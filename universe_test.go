@@ -0,0 +1,40 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+)
+
+func TestUniverseEditsPersist(t *testing.T) {
+	app := NewApp()
+	app.configPath = filepath.Join(t.TempDir(), "config.toml")
+	app.config.Universe.Symbols = []string{"SPY"}
+
+	if err := app.AddSymbol(" qqq "); err != nil {
+		t.Fatalf("AddSymbol failed: %v", err)
+	}
+	if err := app.AddSymbol("SPY"); err == nil {
+		t.Error("Expected error adding duplicate symbol")
+	}
+	if err := app.RemoveSymbol("spy"); err != nil {
+		t.Fatalf("RemoveSymbol failed: %v", err)
+	}
+	if err := app.RemoveSymbol("IWM"); err == nil {
+		t.Error("Expected error removing unknown symbol")
+	}
+
+	if got := app.GetUniverse(); !reflect.DeepEqual(got, []string{"QQQ"}) {
+		t.Errorf("Universe: got %v, want [QQQ]", got)
+	}
+
+	var saved Configuration
+	if _, err := toml.DecodeFile(app.configPath, &saved); err != nil {
+		t.Fatalf("Failed to decode saved config: %v", err)
+	}
+	if !reflect.DeepEqual(saved.Universe.Symbols, []string{"QQQ"}) {
+		t.Errorf("Persisted universe: got %v, want [QQQ]", saved.Universe.Symbols)
+	}
+}
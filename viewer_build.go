@@ -0,0 +1,7 @@
+//go:build viewer
+
+package main
+
+// viewerBuild is set by the viewer build tag, which makes every start a
+// viewer whatever the configuration says
+const viewerBuild = true
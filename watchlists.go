@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"traderadmin/backend/notifications"
+	"traderadmin/backend/watchlist"
+)
+
+// WatchlistAlertEvent is emitted with the watchlist.Alert of each signal of a
+// watchlist symbol
+const WatchlistAlertEvent = "watchlist:alert"
+
+// Defaults of [watchlists] while its settings are unset
+const (
+	defaultWatchlistInterval = 60 * time.Second
+	defaultQuietPeriod       = 240 * time.Minute
+)
+
+// ListWatchlists returns the watchlists by name
+func (a *App) ListWatchlists() ([]watchlist.Watchlist, error) {
+	if a.watchlists == nil {
+		return nil, fmt.Errorf("watchlists not initialized")
+	}
+	return a.watchlists.List(), nil
+}
+
+// AddWatchlist adds a watchlist. Its channel defaults to desktop; email and
+// Slack need their notifications enabled in [alerts_config], while in-app
+// only records its alerts in the notification center.
+func (a *App) AddWatchlist(list watchlist.Watchlist) error {
+	if a.watchlists == nil {
+		return fmt.Errorf("watchlists not initialized")
+	}
+	list, err := watchlist.Normalize(list)
+	if err != nil {
+		return err
+	}
+	notifications := a.config.AlertsConfig.Notifications
+	switch {
+	case list.Channel == watchlist.ChannelEmail && !notifications.Email.Enabled:
+		return fmt.Errorf("watchlist %s: email notifications are not enabled", list.Name)
+	case list.Channel == watchlist.ChannelSlack && !notifications.Slack.Enabled:
+		return fmt.Errorf("watchlist %s: slack notifications are not enabled", list.Name)
+	}
+
+	if list, err = a.watchlists.Add(list); err != nil {
+		return err
+	}
+	log.Info().Str("watchlist", list.Name).Strs("symbols", list.Symbols).Str("channel", list.Channel).Msg("Added watchlist")
+	return nil
+}
+
+// RemoveWatchlist removes the named watchlist
+func (a *App) RemoveWatchlist(name string) error {
+	if a.watchlists == nil {
+		return fmt.Errorf("watchlists not initialized")
+	}
+	if err := a.watchlists.Remove(name); err != nil {
+		return err
+	}
+	log.Info().Str("watchlist", name).Msg("Removed watchlist")
+	return nil
+}
+
+// watchSignals checks the scanner's latest scan against the watchlists every
+// Watchlists.PollIntervalSeconds while they are enabled
+func (a *App) watchSignals(ctx context.Context) {
+	for {
+		interval := time.Duration(a.config.Watchlists.PollIntervalSeconds) * time.Second
+		if interval <= 0 {
+			interval = defaultWatchlistInterval
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+
+		if !a.config.Watchlists.Enabled || a.watchlists == nil {
+			continue
+		}
+		if err := a.checkWatchlists(ctx, time.Now()); err != nil {
+			log.Warn().Err(err).Msg("Failed to check the scanner's signals against the watchlists")
+		}
+	}
+}
+
+// checkWatchlists alerts on the signals of the scanner's latest scan for the
+// symbols of the watchlists, each at most once per quiet period
+func (a *App) checkWatchlists(ctx context.Context, now time.Time) error {
+	client, err := a.scannerClient()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, scannerFetchTimeout)
+	defer cancel()
+	latest, err := client.LatestSignals(ctx)
+	if err != nil {
+		return err
+	}
+
+	signals := make([]watchlist.Signal, len(latest))
+	for i, signal := range latest {
+		signals[i] = watchlist.Signal(signal)
+	}
+	quiet := time.Duration(a.config.Watchlists.QuietPeriodMinutes) * time.Minute
+	if quiet <= 0 {
+		quiet = defaultQuietPeriod
+	}
+	alerts, err := a.watchlists.Match(signals, now, quiet)
+	for _, alert := range alerts {
+		message := fmt.Sprintf("%s signalled %s %s on watchlist %s", alert.Signal.Symbol, alert.Signal.Direction, alert.Signal.Strategy, alert.Watchlist)
+		a.raiseAlert(AlertWatchlist, notifications.SeverityInfo, message, alert)
+		a.emitEvent(WatchlistAlertEvent, alert)
+		log.Warn().
+			Str("watchlist", alert.Watchlist).
+			Str("channel", alert.Channel).
+			Str("symbol", alert.Signal.Symbol).
+			Str("strategy", alert.Signal.Strategy).
+			Str("direction", alert.Signal.Direction).
+			Float64("score", alert.Signal.Score).
+			Msg("Watchlist symbol signalled")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record watchlist alerts: %w", err)
+	}
+	return nil
+}
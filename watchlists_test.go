@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	scannerpb "github.com/trustdan/ibkr-trader/go/pkg/proto"
+
+	"traderadmin/backend/watchlist"
+)
+
+// signallingScanner's latest scan signals AAPL and SPY with HIGH_BASE
+type signallingScanner struct {
+	scannerpb.UnimplementedScannerServiceServer
+}
+
+func (s *signallingScanner) GetScanResults(ctx context.Context, req *scannerpb.ResultsRequest) (*scannerpb.ScanResponse, error) {
+	return &scannerpb.ScanResponse{RankedSignals: []*scannerpb.RankedSignal{
+		{Symbol: "AAPL", Strategy: "HIGH_BASE", Direction: "LONG", Score: 82},
+		{Symbol: "SPY", Strategy: "HIGH_BASE", Direction: "LONG", Score: 64},
+	}}, nil
+}
+
+func TestCheckWatchlistsAlertsOncePerQuietPeriod(t *testing.T) {
+	app := NewApp()
+	serveScanner(t, app, &signallingScanner{})
+	var err error
+	if app.watchlists, err = watchlist.Open(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.AddWatchlist(watchlist.Watchlist{Name: "tech", Symbols: []string{"aapl", "msft"}, Strategies: []string{"HIGH_BASE"}}); err != nil {
+		t.Fatal(err)
+	}
+	app.config.Watchlists.QuietPeriodMinutes = 30
+	var alerts []watchlist.Alert
+	app.emit = func(name string, data ...interface{}) {
+		if name == WatchlistAlertEvent {
+			alerts = append(alerts, data[0].(watchlist.Alert))
+		}
+	}
+
+	now := time.Now()
+	for _, at := range []time.Time{now, now.Add(29 * time.Minute), now.Add(30 * time.Minute)} {
+		if err := app.checkWatchlists(context.Background(), at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(alerts) != 2 {
+		t.Fatalf("Alerts = %+v, want AAPL at the first check and after the quiet period", alerts)
+	}
+	if alert := alerts[0]; alert.Watchlist != "tech" || alert.Channel != watchlist.ChannelDesktop ||
+		alert.Signal.Symbol != "AAPL" || alert.Signal.Score != 82 {
+		t.Errorf("First alert = %+v", alert)
+	}
+}
+
+func TestAddWatchlistNeedsItsChannelEnabled(t *testing.T) {
+	app := NewApp()
+	var err error
+	if app.watchlists, err = watchlist.Open(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	slack := watchlist.Watchlist{Name: "tech", Symbols: []string{"AAPL"}, Channel: watchlist.ChannelSlack}
+	if err := app.AddWatchlist(slack); err == nil {
+		t.Error("AddWatchlist() with Slack notifications disabled should fail")
+	}
+	app.config.AlertsConfig.Notifications.Slack.Enabled = true
+	if err := app.AddWatchlist(slack); err != nil {
+		t.Errorf("AddWatchlist() error = %v", err)
+	}
+	if lists, _ := app.ListWatchlists(); len(lists) != 1 || lists[0].Channel != watchlist.ChannelSlack {
+		t.Errorf("ListWatchlists() = %+v", lists)
+	}
+	if err := app.RemoveWatchlist("tech"); err != nil {
+		t.Errorf("RemoveWatchlist() error = %v", err)
+	}
+}